@@ -6,65 +6,343 @@ import (
 	"fmt"
 	"github.com/go-chi/httplog/v2"
 	"github.com/mzeevi/library/internal/api"
+	"github.com/mzeevi/library/internal/auth"
+	"github.com/mzeevi/library/internal/classification"
+	"github.com/mzeevi/library/internal/data"
 	"github.com/mzeevi/library/internal/database"
+	"github.com/mzeevi/library/internal/events"
+	"github.com/mzeevi/library/internal/labels"
+	"github.com/mzeevi/library/internal/mailer"
+	"github.com/mzeevi/library/internal/search"
+	"github.com/mzeevi/library/internal/secrets"
+	"github.com/mzeevi/library/internal/storage"
 	"log/slog"
 	"os"
+	"strconv"
 	"strings"
 	"time"
+	// Embed the timezone database, so that -timezone works on hosts and images without one.
+	_ "time/tzdata"
+)
+
+const (
+	serveCommand              = "serve"
+	migratePIICommand         = "migrate-pii"
+	migrateEmailsCommand      = "migrate-emails"
+	migrateIdentifiersCommand = "migrate-identifiers"
+	migratePublishersCommand  = "migrate-publishers"
+	seedCommand               = "seed"
+	createAdminCommand        = "create-admin"
+	reindexSearchCommand      = "reindex-search"
 )
 
 func main() {
 	var app api.Application
 
+	command, args := serveCommand, os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+
 	flag.IntVar(&app.Config.Port, "port", 8080, "API server port")
 
 	flag.StringVar(&app.Config.DB.DSN, "db-dsn", "", "MongoDB DSN")
+	flag.StringVar(&app.Config.DB.DSNFile, "db-dsn-file", "", "File containing the MongoDB DSN")
+	flag.StringVar(&app.Config.DB.DSNVaultPath, "db-dsn-vault-path", "", "Vault path of the MongoDB DSN (<path>#<field>)")
 	flag.StringVar(&app.Config.DB.Database, "db", "library", "MongoDB Database name")
+	flag.Uint64Var(&app.Config.DB.MaxPoolSize, "db-max-pool-size", 0, "Maximum number of connections to MongoDB per server, or 0 for the driver default")
+	flag.Uint64Var(&app.Config.DB.MinPoolSize, "db-min-pool-size", 0, "Minimum number of idle connections to MongoDB kept per server")
+	flag.DurationVar(&app.Config.DB.MaxConnIdleTime, "db-max-conn-idle-time", 0, "Duration after which idle connections to MongoDB are closed, or 0 for the driver default")
+	flag.DurationVar(&app.Config.DB.ConnectTimeout, "db-connect-timeout", 0, "Timeout of opening a connection to MongoDB, or 0 for the driver default")
+	flag.DurationVar(&app.Config.DB.ServerSelectionTimeout, "db-server-selection-timeout", 0, "Timeout of selecting a MongoDB server for an operation, or 0 for the driver default")
+	flag.DurationVar(&app.Config.DB.Timeout, "db-timeout", 0, "Timeout of MongoDB operations which have no deadline, or 0 for none")
+	flag.StringVar(&app.Config.DB.ReadPreference, "db-read-preference", "", "Read preference of MongoDB: primary, primaryPreferred, secondary, secondaryPreferred or nearest (empty uses the DSN or primary)")
+	flag.Func("db-retry-writes", "Whether MongoDB writes are retried once on network errors (true or false, empty uses the DSN or true)", func(val string) error {
+		retry, err := strconv.ParseBool(val)
+		if err != nil {
+			return err
+		}
+		app.Config.DB.RetryWrites = &retry
+		return nil
+	})
+	flag.Func("db-compressors", "Compressors of messages to MongoDB in order of preference: zstd, zlib or snappy (space separated, empty uses the DSN or none)", func(val string) error {
+		app.Config.DB.Compressors = strings.Fields(val)
+		return nil
+	})
+	flag.StringVar(&app.Config.DB.ListReadPreference, "db-list-read-preference", "", "Read preference of the searches and lists of operations with any of the list read tags, such as secondaryPreferred to offload them from the primary (empty uses the read preference of the client)")
+	flag.Func("db-list-read-tags", "Tags of the operations whose searches and lists are read with the list read preference (space separated, empty uses search reports)", func(val string) error {
+		app.Config.DB.ListReadTags = strings.Fields(val)
+		return nil
+	})
+	flag.DurationVar(&app.Config.DB.SlowQueryThreshold, "db-slow-query-threshold", 0, "Duration from which queries are logged as slow along with the fields they filter by, or 0 to not log them")
+	flag.BoolVar(&app.Config.DB.IndexHints, "db-index-hints", false, "Hint known-hot queries, such as looking up books by identifier or call number, to use their indexes")
 	flag.StringVar(&app.Config.DB.BooksCollection, "books-collection", "books", "MongoDB collection name for books")
 	flag.StringVar(&app.Config.DB.PatronsCollection, "patrons-collection", "patrons", "MongoDB collection name for patrons")
 	flag.StringVar(&app.Config.DB.TransactionsCollection, "transactions-collection", "transactions", "MongoDB collection name for transactions")
 	flag.StringVar(&app.Config.DB.TokensCollection, "tokens-collection", "tokens", "MongoDB collection name for tokens")
 	flag.StringVar(&app.Config.DB.AdminsCollection, "admins-collection", "admins", "MongoDB collection name for admins")
+	flag.StringVar(&app.Config.DB.CategoriesCollection, "categories-collection", "categories", "MongoDB collection name for patron categories")
+	flag.StringVar(&app.Config.DB.PublishersCollection, "publishers-collection", "publishers", "MongoDB collection name for the publishers of books")
+	flag.StringVar(&app.Config.DB.NotificationsCollection, "notifications-collection", "notifications", "MongoDB collection name for notifications")
+	flag.StringVar(&app.Config.DB.EventsCollection, "events-collection", "events", "MongoDB collection name for the outbox of domain events")
+	flag.StringVar(&app.Config.DB.AvailabilityCollection, "availability-collection", "book_availability", "MongoDB collection name for the availability of books")
+	flag.StringVar(&app.Config.DB.KiosksCollection, "kiosks-collection", "kiosks", "MongoDB collection name for self-checkout kiosks")
+	flag.StringVar(&app.Config.DB.KioskRequestsCollection, "kiosk-requests-collection", "kiosk_requests", "MongoDB collection name for the borrow and return requests of kiosks")
+	flag.StringVar(&app.Config.DB.AuditCollection, "audit-collection", "audit", "MongoDB collection name for the audit log of corrections by admins")
+	flag.StringVar(&app.Config.DB.PaymentsCollection, "payments-collection", "payments", "MongoDB collection name for the payments of fines")
+	flag.StringVar(&app.Config.DB.AcquisitionsCollection, "acquisitions-collection", "acquisitions", "MongoDB collection name for the donated and purchased books which the library received")
+	flag.StringVar(&app.Config.DB.WithdrawalsCollection, "withdrawals-collection", "withdrawals", "MongoDB collection name for the copies which were withdrawn from the stock")
+	flag.StringVar(&app.Config.DB.InventorySessionsCollection, "inventory-sessions-collection", "inventory_sessions", "MongoDB collection name for the stock-taking sessions")
+	flag.StringVar(&app.Config.DB.InventoryScansCollection, "inventory-scans-collection", "inventory_scans", "MongoDB collection name for the barcodes scanned in stock-taking sessions")
+	flag.StringVar(&app.Config.DB.SuggestionsCollection, "suggestions-collection", "suggestions", "MongoDB collection name for the titles which patrons suggested to acquire")
+	flag.StringVar(&app.Config.DB.ResourcesCollection, "resources-collection", "resources", "MongoDB collection name for the rooms and equipment which patrons reserve")
+	flag.StringVar(&app.Config.DB.ReservationsCollection, "reservations-collection", "reservations", "MongoDB collection name for the reservations of rooms and equipment")
+	flag.StringVar(&app.Config.DB.ProgramsCollection, "programs-collection", "programs", "MongoDB collection name for the programs of the library, such as story hours and workshops")
+	flag.StringVar(&app.Config.DB.RegistrationsCollection, "registrations-collection", "registrations", "MongoDB collection name for the registrations of patrons to programs")
+	flag.StringVar(&app.Config.DB.AnnouncementsCollection, "announcements-collection", "announcements", "MongoDB collection name for the announcements shown to clients as banners")
+	flag.StringVar(&app.Config.DB.SavedSearchesCollection, "saved-searches-collection", "saved_searches", "MongoDB collection name for the saved searches of librarians")
+	flag.StringVar(&app.Config.DB.DailyStatsCollection, "daily-stats-collection", "stats_daily", "MongoDB collection name for the daily rollups of the circulation statistics")
 
-	flag.BoolVar(&app.Config.Admin.Create, "create-admin", true, "create admin user")
+	flag.BoolVar(&app.Config.Admin.Create, "create-admin", false, "create admin user on start if it does not exist")
 	flag.StringVar(&app.Config.Admin.Username, "admin-username", "", "admin user")
 	flag.StringVar(&app.Config.Admin.Password, "admin-password", "", "admin password")
 
+	flag.IntVar(&app.Config.Passwords.MinLength, "password-min-length", auth.DefaultMinPasswordLength, "Minimum number of characters of the passwords of patrons and admins")
+	flag.BoolVar(&app.Config.Passwords.DenyCommon, "password-deny-common", true, "Reject the most common passwords")
+	flag.BoolVar(&app.Config.Passwords.CheckBreached, "password-check-breached", false, "Reject passwords which appeared in data breaches, checked with the Have I Been Pwned range API")
+	flag.StringVar(&app.Config.Passwords.BreachURL, "pwned-passwords-url", auth.DefaultPwnedPasswordsURL, "URL of the Have I Been Pwned range API, or of a mirror of it")
+	flag.DurationVar(&app.Config.Activation.ResendInterval, "activation-resend-interval", 5*time.Minute, "Interval in which the activation token of a patron may be resent once (0 does not limit it)")
+
+	flag.StringVar(&app.Config.SCIM.Token, "scim-token", os.Getenv("SCIM_TOKEN"), "Bearer token of the identity provider which provisions patrons with SCIM (empty disables SCIM)")
+	flag.Func("scim-group-categories", "Categories of the patrons provisioned with SCIM by their groups, such as Students=student,Staff=teacher (comma separated group=category pairs)", func(val string) error {
+		app.Config.SCIM.GroupCategories = map[string]string{}
+		for _, pair := range strings.Split(val, ",") {
+			if strings.TrimSpace(pair) == "" {
+				continue
+			}
+			group, category, found := strings.Cut(pair, "=")
+			if !found || strings.TrimSpace(group) == "" || strings.TrimSpace(category) == "" {
+				return fmt.Errorf("invalid group=category pair %q", pair)
+			}
+			app.Config.SCIM.GroupCategories[strings.TrimSpace(group)] = strings.TrimSpace(category)
+		}
+		return nil
+	})
+	flag.StringVar(&app.Config.SCIM.DefaultCategory, "scim-default-category", "", "Category of the patrons provisioned with SCIM who are in none of the mapped groups (empty rejects them)")
+
+	flag.StringVar(&app.Config.Passwords.Hash, "password-hash", auth.Bcrypt, "Algorithm of the hashes of new passwords and PINs (bcrypt|argon2id); passwords are re-hashed with it when they log in")
+	flag.IntVar(&app.Config.Passwords.BcryptCost, "bcrypt-cost", auth.DefaultBcryptCost, "Cost of the bcrypt hashes of passwords and PINs; passwords are re-hashed at a new cost when they log in")
+	flag.IntVar(&app.Config.Passwords.Argon2id.Memory, "argon2id-memory", auth.DefaultArgon2idMemory, "Memory in KiB of the argon2id hashes of passwords and PINs")
+	flag.IntVar(&app.Config.Passwords.Argon2id.Iterations, "argon2id-iterations", auth.DefaultArgon2idIterations, "Iterations of the argon2id hashes of passwords and PINs")
+	flag.IntVar(&app.Config.Passwords.Argon2id.Parallelism, "argon2id-parallelism", auth.DefaultArgon2idParallelism, "Parallelism of the argon2id hashes of passwords and PINs")
+
+	flag.StringVar(&app.Config.Name, "library-name", "Library", "Name of the library, printed on receipts")
+	flag.StringVar(&app.Config.Environment, "environment", "production", "Environment the library runs in, such as production, staging or development; fixtures can only be loaded outside production")
+	flag.StringVar(&app.Config.Timezone, "timezone", "UTC", "IANA timezone of the library, such as Asia/Jerusalem, in which days start and end")
+	flag.StringVar(&app.Config.Collation, "collation", "", "Locale by which titles and names are sorted, such as he or en_US; empty sorts them by their bytes")
+	flag.StringVar(&app.Config.Classification, "classification", classification.Dewey, "Classification scheme of the call numbers of copies: dewey or lcc")
+
 	flag.Float64Var(&app.Config.Cost.OverdueFine, "overdue-fine", 10, "Fine for returning overdue book")
-	flag.Float64Var(&app.Config.Cost.Discount.Teacher, "teacher-discount-percentage", 20, "Discount percentage for teachers")
-	flag.Float64Var(&app.Config.Cost.Discount.Student, "student-discount-discountPercentage", 25, "Discount percentage for students")
+	flag.Float64Var(&app.Config.Cost.Discount.Teacher, "teacher-discount-percentage", 20, "Discount percentage for teachers, used when creating the default teacher category")
+	flag.Float64Var(&app.Config.Cost.Discount.Student, "student-discount-discountPercentage", 25, "Discount percentage for students, used when creating the default student category")
 
 	flag.BoolVar(&app.Config.Output.Enabled, "output-enabled", false, "Flag to enable writing to output file")
 	flag.StringVar(&app.Config.Output.File, "output-file", "output", "Filename for the output file")
 	flag.StringVar(&app.Config.Output.Format, "output-format", "csv", "Format for the output file")
 
 	flag.StringVar(&app.Config.JTW.Secret, "jwt-secret", "", "JWT secret")
+	flag.StringVar(&app.Config.JTW.SecretFile, "jwt-secret-file", "", "File containing the JWT secret")
+	flag.StringVar(&app.Config.JTW.SecretVaultPath, "jwt-secret-vault-path", "", "Vault path of the JWT secret (<path>#<field>)")
 	flag.StringVar(&app.Config.JTW.Issuer, "jwt-issuer", "library.com", "JWT secret")
 	flag.StringVar(&app.Config.JTW.Audience, "jwt-audience", "library.com", "JWT secret")
+	flag.DurationVar(&app.Config.JTW.FeedTokenTTL, "feed-token-ttl", 365*24*time.Hour, "Lifetime of the tokens of the due dates calendar feeds")
+	flag.DurationVar(&app.Config.JTW.KioskTokenTTL, "kiosk-token-ttl", 5*time.Minute, "Lifetime of the tokens of patrons who log in at kiosks with their PIN")
 
-	flag.BoolVar(&app.Config.Demo.Patrons, "demo-patrons", false, "create demo patrons")
-	flag.BoolVar(&app.Config.Demo.Patrons, "demo-books", true, "create demo books")
+	flag.IntVar(&app.Config.Seed.Books, "seed-books", 1000, "Number of books to generate with the seed command")
+	flag.IntVar(&app.Config.Seed.Patrons, "seed-patrons", 200, "Number of patrons to generate with the seed command")
+	flag.IntVar(&app.Config.Seed.Transactions, "seed-transactions", 5000, "Number of transactions to generate with the seed command")
+	flag.StringVar(&app.Config.Seed.Password, "seed-password", "password", "Password of the patrons generated with the seed command")
+	flag.Int64Var(&app.Config.Seed.RandomSeed, "seed-random", 1, "Random seed for the seed command, the same seed generates the same data")
 
-	flag.Func("cors-trusted-origins", "Trusted CORS origins (space separated)", func(val string) error {
+	flag.Func("cors-trusted-origins", "Trusted CORS origins, such as https://library.example.com or https://*.example.com for its subdomains (space separated, empty trusts all origins)", func(val string) error {
 		app.Config.CORS.TrustedOrigins = strings.Fields(val)
 		return nil
 	})
+	flag.Func("cors-allowed-methods", "Methods which cross-origin requests may use (space separated, empty uses GET POST PUT PATCH DELETE OPTIONS)", func(val string) error {
+		app.Config.CORS.AllowedMethods = strings.Fields(val)
+		return nil
+	})
+	flag.Func("cors-allowed-headers", "Headers which cross-origin requests may send (space separated, empty uses Accept Authorization Content-Type X-CSRF-Token Idempotency-Key)", func(val string) error {
+		app.Config.CORS.AllowedHeaders = strings.Fields(val)
+		return nil
+	})
+	flag.Func("cors-exposed-headers", "Headers of responses which cross-origin requests may read (space separated, empty uses Link Idempotent-Replayed)", func(val string) error {
+		app.Config.CORS.ExposedHeaders = strings.Fields(val)
+		return nil
+	})
+	flag.BoolVar(&app.Config.CORS.AllowCredentials, "cors-allow-credentials", false, "Allow cross-origin requests with credentials, which needs trusted origins")
+	flag.DurationVar(&app.Config.CORS.MaxAge, "cors-max-age", 5*time.Minute, "How long browsers cache the responses to CORS preflight requests")
+
+	flag.IntVar(&app.Config.Catalog.RateLimit, "catalog-rate-limit", 20, "Requests to the public catalog which each IP may make in every catalog rate window (0 does not limit them beyond the other requests)")
+	flag.DurationVar(&app.Config.Catalog.RateWindow, "catalog-rate-window", time.Minute, "Window of the rate limit of the public catalog")
+
+	flag.Func("trusted-proxies", "CIDRs of proxies whose forwarded headers are trusted (space separated)", func(val string) error {
+		app.Config.Server.TrustedProxies = strings.Fields(val)
+		return nil
+	})
+
+	flag.StringVar(&app.Config.Encryption.Key, "encryption-key", "", "Base64 encoded 32 byte key for encrypting patron personal data")
+	flag.StringVar(&app.Config.Encryption.KeyFile, "encryption-key-file", "", "File containing the encryption key")
+
+	flag.StringVar(&app.Config.Log.Level, "log-level", "debug", "Log level (debug|info|warn|error)")
+	flag.BoolVar(&app.Config.Log.JSON, "log-json", false, "Write logs in JSON format")
+	flag.BoolVar(&app.Config.Log.Concise, "log-concise", true, "Write concise request logs")
+	flag.Func("log-redacted-headers", "Headers redacted from logs and error reports, in addition to Authorization, Cookie and the signature headers (space separated)", func(val string) error {
+		app.Config.Log.RedactedHeaders = strings.Fields(val)
+		return nil
+	})
+	flag.Func("log-redacted-fields", "Body fields and query parameters redacted from logs and error reports, in addition to password, token and secret fields (space separated)", func(val string) error {
+		app.Config.Log.RedactedFields = strings.Fields(val)
+		return nil
+	})
+
+	flag.StringVar(&app.Config.Mail.Host, "smtp-host", "", "SMTP server host (empty logs emails instead of sending them)")
+	flag.IntVar(&app.Config.Mail.Port, "smtp-port", 587, "SMTP server port")
+	flag.StringVar(&app.Config.Mail.Username, "smtp-username", "", "SMTP username")
+	flag.StringVar(&app.Config.Mail.Password, "smtp-password", "", "SMTP password")
+	flag.StringVar(&app.Config.Mail.Sender, "smtp-sender", "Library <no-reply@library.com>", "Sender of emails")
+	flag.StringVar(&app.Config.Mail.Locale, "mail-locale", mailer.DefaultLocale, "Default locale of emails, used when the patron's locale has no template")
+
+	flag.StringVar(&app.Config.SMS.Provider, "sms-provider", "", "SMS provider (twilio|webhook, empty logs text messages instead of sending them)")
+	flag.StringVar(&app.Config.SMS.TwilioAccountSID, "twilio-account-sid", "", "Twilio account SID")
+	flag.StringVar(&app.Config.SMS.TwilioAuthToken, "twilio-auth-token", "", "Twilio auth token")
+	flag.StringVar(&app.Config.SMS.TwilioFrom, "twilio-from", "", "Twilio phone number or messaging service SID to send text messages from")
+	flag.StringVar(&app.Config.SMS.WebhookURL, "sms-webhook-url", "", "URL of the SMS gateway webhook")
+	flag.StringVar(&app.Config.SMS.WebhookSecret, "sms-webhook-secret", "", "Secret for signing SMS gateway webhook requests")
+
+	flag.Func("event-webhook-urls", "URLs which domain events are posted to (space separated)", func(val string) error {
+		app.Config.Events.WebhookURLs = strings.Fields(val)
+		return nil
+	})
+	flag.StringVar(&app.Config.Events.WebhookSecret, "event-webhook-secret", "", "Secret for signing event webhook requests")
+	flag.DurationVar(&app.Config.Events.DispatchInterval, "event-dispatch-interval", events.DefaultInterval, "Interval for dispatching pending domain events")
+	flag.BoolVar(&app.Config.Events.BorrowReceipts, "borrow-receipts", false, "Notify patrons when they borrow a book")
 
-	flag.Parse()
+	flag.DurationVar(&app.Config.Ebooks.ReturnInterval, "ebook-return-interval", time.Minute, "Interval for returning e-book loans whose due date passed")
+
+	flag.StringVar(&app.Config.Files.Storage, "file-storage", storage.Local, "Storage of the files attached to books, such as the PDFs of e-books (local|s3, empty disables attaching files)")
+	flag.StringVar(&app.Config.Files.Dir, "file-dir", "files", "Directory of the files attached to books with local storage")
+	flag.Int64Var(&app.Config.Files.MaxSize, "file-max-size", 100<<20, "Maximum size in bytes of the files attached to books")
+	flag.DurationVar(&app.Config.Files.DownloadURLTTL, "download-url-ttl", 15*time.Minute, "Lifetime of the signed URLs for downloading the files of borrowed books")
+	flag.StringVar(&app.Config.Files.S3.Bucket, "s3-bucket", "", "S3 bucket of the files attached to books")
+	flag.StringVar(&app.Config.Files.S3.Region, "s3-region", "us-east-1", "Region of the S3 bucket")
+	flag.StringVar(&app.Config.Files.S3.Endpoint, "s3-endpoint", "", "Endpoint of an S3 compatible service, such as MinIO (empty uses AWS S3)")
+	flag.StringVar(&app.Config.Files.S3.AccessKeyID, "s3-access-key-id", os.Getenv("AWS_ACCESS_KEY_ID"), "S3 access key ID")
+	flag.StringVar(&app.Config.Files.S3.SecretAccessKey, "s3-secret-access-key", os.Getenv("AWS_SECRET_ACCESS_KEY"), "S3 secret access key")
+
+	flag.Func("overdue-report-recipients", "Librarians the weekly overdue report is emailed to (comma separated, empty disables the report)", func(val string) error {
+		app.Config.Reports.Recipients = nil
+		for _, recipient := range strings.Split(val, ",") {
+			if recipient = strings.TrimSpace(recipient); recipient != "" {
+				app.Config.Reports.Recipients = append(app.Config.Reports.Recipients, recipient)
+			}
+		}
+		return nil
+	})
+	flag.StringVar(&app.Config.Reports.Weekday, "overdue-report-day", "monday", "Day of the week the overdue report is sent on")
+	flag.IntVar(&app.Config.Reports.Hour, "overdue-report-hour", 8, "Hour of the day the overdue report is sent at, in the timezone of the library")
+	flag.StringVar(&app.Config.Reports.Format, "overdue-report-format", "csv", "Format of the files attached to the overdue report")
+
+	flag.Func("report-terms", "Terms which reports can be windowed by, such as fall=09-01/01-31,spring=02-01/06-30 (comma separated name=MM-DD/MM-DD pairs)", func(val string) error {
+		app.Config.Reports.Terms = map[string]string{}
+		for _, pair := range strings.Split(val, ",") {
+			if strings.TrimSpace(pair) == "" {
+				continue
+			}
+			name, days, found := strings.Cut(pair, "=")
+			if !found || strings.TrimSpace(name) == "" || strings.TrimSpace(days) == "" {
+				return fmt.Errorf("invalid name=MM-DD/MM-DD pair %q", pair)
+			}
+			app.Config.Reports.Terms[strings.TrimSpace(name)] = strings.TrimSpace(days)
+		}
+		return nil
+	})
+	flag.StringVar(&app.Config.Reports.FiscalYearStart, "fiscal-year-start", "01-01", "First day of the fiscal year, formatted as MM-DD, such as 07-01")
+	flag.IntVar(&app.Config.Stats.RollupHour, "stats-rollup-hour", 1, "Hour of the night the circulation of the previous days is rolled up at, in the timezone of the library")
+
+	flag.StringVar(&app.Config.Labels.Layout, "label-layout", labels.DefaultLayout, "Avery layout of the sheets of labels of copies: avery-5160, avery-l7160 or avery-l7651")
+
+	flag.StringVar(&app.Config.Booking.Opens, "booking-opens", "09:00", "Time of day from which rooms and equipment can be reserved, in the timezone of the library")
+	flag.StringVar(&app.Config.Booking.Closes, "booking-closes", "21:00", "Time of day until which rooms and equipment can be reserved, in the timezone of the library")
+	flag.DurationVar(&app.Config.Booking.Slot, "booking-slot", 30*time.Minute, "Length of the time slots which rooms and equipment are reserved in")
+	flag.DurationVar(&app.Config.Booking.MaxDuration, "booking-max-duration", 4*time.Hour, "Longest reservation of a room or an item of equipment")
+	flag.IntVar(&app.Config.Booking.HorizonDays, "booking-horizon", 14, "Number of days ahead which rooms and equipment can be reserved")
+	flag.IntVar(&app.Config.Booking.MaxReservations, "booking-max-reservations", 3, "Maximum number of upcoming reservations of a patron (0 is unlimited)")
+
+	flag.IntVar(&app.Config.Retention.Years, "retention-years", 0, "Years for which the history of returned transactions is kept (0 keeps it forever)")
+	flag.StringVar(&app.Config.Retention.Mode, "retention-mode", api.RetentionAnonymize, "What is done with the history past the retention period (anonymize unlinks it from the patrons, delete deletes it)")
+	flag.BoolVar(&app.Config.Retention.DryRun, "retention-dry-run", false, "Only log how many transactions are past the retention period, without anonymizing or deleting them")
+	flag.DurationVar(&app.Config.Retention.Interval, "retention-interval", 24*time.Hour, "Interval for applying the retention policy")
+
+	flag.DurationVar(&app.Config.Programs.ReminderLead, "program-reminder-lead", 24*time.Hour, "How long before a program its registered patrons are reminded of it")
+	flag.DurationVar(&app.Config.Programs.ReminderInterval, "program-reminder-interval", 15*time.Minute, "Interval for reminding patrons of the programs they registered to")
+
+	flag.StringVar(&app.Config.OAI.BaseURL, "oai-base-url", "", "Public URL of the OAI-PMH endpoint (empty uses the host of each request)")
+	flag.StringVar(&app.Config.OAI.AdminEmail, "oai-admin-email", "", "Email address of the administrator of the OAI-PMH repository (empty uses the mail sender)")
+
+	flag.StringVar(&app.Config.Search.URL, "opensearch-url", "", "OpenSearch URL for searching books (empty searches MongoDB)")
+	flag.StringVar(&app.Config.Search.Index, "opensearch-index", "books", "OpenSearch index of books")
+	flag.StringVar(&app.Config.Search.Username, "opensearch-username", "", "OpenSearch username")
+	flag.StringVar(&app.Config.Search.Password, "opensearch-password", "", "OpenSearch password")
+	flag.StringVar(&app.Config.Search.Analyzer, "opensearch-analyzer", search.DefaultAnalyzer, "Language analyzer of book titles in OpenSearch")
+
+	flag.StringVar(&app.Config.Payments.Provider, "payments-provider", "", "Payment provider for paying fines online (stripe|mock, empty disables online payments)")
+	flag.StringVar(&app.Config.Payments.Currency, "payments-currency", "usd", "Currency of fines, as an ISO 4217 code")
+	flag.StringVar(&app.Config.Payments.StripeSecretKey, "stripe-secret-key", "", "Stripe secret API key")
+	flag.StringVar(&app.Config.Payments.WebhookSecret, "payments-webhook-secret", "", "Secret for verifying the webhook requests of the payment provider")
+	flag.StringVar(&app.Config.Payments.SuccessURL, "payments-success-url", "", "URL patrons are sent to after paying their fines")
+	flag.StringVar(&app.Config.Payments.CancelURL, "payments-cancel-url", "", "URL patrons are sent to if they cancel paying their fines")
+
+	flag.StringVar(&app.Config.ErrorReporting.DSN, "sentry-dsn", "", "Sentry DSN for error reporting (empty disables reporting)")
+	flag.StringVar(&app.Config.ErrorReporting.Environment, "sentry-environment", "", "Environment reported to Sentry")
+
+	flag.StringVar(&app.Config.Secrets.VaultAddress, "vault-addr", os.Getenv("VAULT_ADDR"), "Vault server address")
+	flag.StringVar(&app.Config.Secrets.VaultToken, "vault-token", os.Getenv("VAULT_TOKEN"), "Vault token")
+	flag.DurationVar(&app.Config.Secrets.RefreshInterval, "secrets-refresh-interval", 0, "Interval for reloading rotated secrets (0 disables reloading)")
+
+	_ = flag.CommandLine.Parse(args)
 
 	logger := httplog.NewLogger(app.Config.DB.Database, httplog.Options{
-		JSON:             false,
-		LogLevel:         slog.LevelDebug,
-		Concise:          true,
+		JSON:             app.Config.Log.JSON,
+		LogLevel:         httplog.LevelByName(app.Config.Log.Level),
+		Concise:          app.Config.Log.Concise,
 		RequestHeaders:   true,
 		MessageFieldName: "message",
 		QuietDownPeriod:  10 * time.Second,
 		SourceFieldName:  "source",
 	})
 
-	dbClient, err := database.Client(app.Config.DB.DSN)
+	vault := secrets.Vault{Address: app.Config.Secrets.VaultAddress, Token: app.Config.Secrets.VaultToken}
+	dsn, err := secrets.Resolve(context.Background(), secrets.NewSource(app.Config.DB.DSN, app.Config.DB.DSNFile, app.Config.DB.DSNVaultPath, vault))
 	if err != nil {
-		logger.Error(fmt.Sprintf("failed to initiate database client: %v", err))
+		logger.Error("failed to load database DSN", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	dbClient, err := database.Client(dsn, database.Options{
+		MaxPoolSize:            app.Config.DB.MaxPoolSize,
+		MinPoolSize:            app.Config.DB.MinPoolSize,
+		MaxConnIdleTime:        app.Config.DB.MaxConnIdleTime,
+		ConnectTimeout:         app.Config.DB.ConnectTimeout,
+		ServerSelectionTimeout: app.Config.DB.ServerSelectionTimeout,
+		Timeout:                app.Config.DB.Timeout,
+		ReadPreference:         app.Config.DB.ReadPreference,
+		RetryWrites:            app.Config.DB.RetryWrites,
+		Compressors:            app.Config.DB.Compressors,
+		Monitor:                data.NewQueryMonitor(app.Config.DB.SlowQueryThreshold),
+	})
+	if err != nil {
+		logger.Error("failed to initiate database client", slog.Any("error", err))
 		os.Exit(1)
 	}
 	defer func() {
@@ -73,36 +351,99 @@ func main() {
 		}
 	}()
 
+	// Existing emails which only differ in case would fail creating the case-insensitive index.
+	app.Config.DB.SkipIndexes = command == migrateEmailsCommand
+
 	if err = app.Setup(dbClient, logger); err != nil {
-		logger.Error(fmt.Sprintf("failed to set app values: %v", err))
+		logger.Error("failed to set app values", slog.Any("error", err))
 		os.Exit(1)
 	}
 
-	if app.Config.Admin.Create {
-		if err = app.Models.Admins.New(context.Background(), app.Config.Admin.Username, app.Config.Admin.Password); err != nil {
-			logger.Error(fmt.Sprintf("failed to create admin: %v", err))
+	switch command {
+	case serveCommand:
+	case migratePIICommand:
+		migrated, err := app.Models.Patrons.EncryptExisting(context.Background())
+		if err != nil {
+			logger.Error("failed to encrypt existing patrons", slog.Any("error", err))
 			os.Exit(1)
 		}
-	}
+		logger.Info("encrypted existing patrons", slog.Int("count", migrated))
+		return
+	case migrateEmailsCommand:
+		migrated, err := app.Models.Patrons.NormalizeEmails(context.Background())
+		if err != nil {
+			logger.Error("failed to normalize patron emails", slog.Any("error", err))
+			os.Exit(1)
+		}
+		logger.Info("normalized patron emails", slog.Int("count", migrated))
+		return
+	case migrateIdentifiersCommand:
+		migrated, err := app.Models.Books.MigrateIdentifiers(context.Background())
+		if err != nil {
+			logger.Error("failed to migrate book identifiers", slog.Any("error", err))
+			os.Exit(1)
+		}
+		logger.Info("migrated book identifiers", slog.Int("count", migrated))
+		return
+	case migratePublishersCommand:
+		migrated, err := app.MigratePublishers(context.Background())
+		if err != nil {
+			logger.Error("failed to migrate book publishers", slog.Any("error", err))
+			os.Exit(1)
+		}
+		logger.Info("migrated book publishers", slog.Int("count", migrated))
+		return
+	case seedCommand:
+		result, err := app.Seed(context.Background())
+		if err != nil {
+			logger.Error("failed to seed database", slog.Any("error", err))
+			os.Exit(1)
+		}
+		logger.Info("seeded database", slog.Int("books", result.Books), slog.Int("patrons", result.Patrons), slog.Int("transactions", result.Transactions))
+		return
+	case reindexSearchCommand:
+		indexed, err := app.ReindexSearch(context.Background())
+		if err != nil {
+			logger.Error("failed to reindex books", slog.Any("error", err))
+			os.Exit(1)
+		}
+		logger.Info("reindexed books", slog.Int("count", indexed))
+		return
+	case createAdminCommand:
+		if app.Config.Admin.Password == "" {
+			app.Config.Admin.Password, err = promptPassword(app.Config.Admin.Username)
+			if err != nil {
+				logger.Error("failed to read admin password", slog.Any("error", err))
+				os.Exit(1)
+			}
+		}
 
-	if app.Config.Demo.Patrons {
-		_, err = app.InsertPatrons(10)
+		created, err := app.EnsureAdmin(context.Background(), app.Config.Admin.Username, app.Config.Admin.Password)
 		if err != nil {
-			logger.Error(fmt.Sprintf("failed to insert demo patrons to database: %v", err))
+			logger.Error("failed to create admin", slog.Any("error", err))
 			os.Exit(1)
 		}
+
+		if created {
+			logger.Info("created admin", slog.String("username", app.Config.Admin.Username))
+		} else {
+			logger.Info("admin already exists", slog.String("username", app.Config.Admin.Username))
+		}
+		return
+	default:
+		logger.Error("unknown command", slog.String("command", command))
+		os.Exit(1)
 	}
 
-	if app.Config.Demo.Books {
-		_, err = app.InsertBooks(10)
-		if err != nil {
-			logger.Error(fmt.Sprintf("failed to insert demo books to database: %v", err))
+	if app.Config.Admin.Create {
+		if _, err = app.EnsureAdmin(context.Background(), app.Config.Admin.Username, app.Config.Admin.Password); err != nil {
+			logger.Error("failed to create admin", slog.Any("error", err))
 			os.Exit(1)
 		}
 	}
 
 	if err = app.Serve(); err != nil {
-		logger.Error(fmt.Sprintf("failed to set up router: %v", err))
+		logger.Error("failed to set up router", slog.Any("error", err))
 		os.Exit(1)
 	}
 }
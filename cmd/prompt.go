@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/term"
+	"os"
+)
+
+var errPasswordMismatch = errors.New("passwords do not match")
+
+// promptPassword reads a password from the terminal without echoing it, asking for it twice.
+func promptPassword(username string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", errors.New("stdin is not a terminal, use -admin-password instead")
+	}
+
+	fmt.Fprintf(os.Stderr, "Password for admin %q: ", username)
+	password, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Fprint(os.Stderr, "Confirm password: ")
+	confirmation, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+
+	if string(password) != string(confirmation) {
+		return "", errPasswordMismatch
+	}
+
+	return string(password), nil
+}
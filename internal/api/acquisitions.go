@@ -0,0 +1,321 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/mzeevi/library/internal/data"
+	"strings"
+	"time"
+)
+
+const (
+	errAcquisitionCatalogedMsg = "the acquisition is already cataloged"
+	errAcquisitionNoBookMsg    = "no book with the ISBN of the acquisition is in the catalog, create it first or give the ID of the book"
+)
+
+type CreateAcquisitionInput struct {
+	Body struct {
+		Source     string     `json:"source" enum:"donation,purchase" doc:"Whether the copies were donated or purchased"`
+		Vendor     string     `json:"vendor" minLength:"1" doc:"The vendor the copies were purchased from, or the donor who donated them"`
+		ISBN       string     `json:"isbn,omitempty" required:"false" minLength:"13" maxLength:"13" doc:"ISBN of the book, by which the copies are added to the catalog"`
+		Title      string     `json:"title" minLength:"1"`
+		Copies     int        `json:"copies" minimum:"1"`
+		Cost       float64    `json:"cost,omitempty" required:"false" minimum:"0" doc:"Total cost of the copies. Zero for donations by default"`
+		ReceivedAt *time.Time `json:"received_at,omitempty" required:"false" format:"date-time" doc:"When the copies were received. Now by default"`
+		Note       string     `json:"note,omitempty" required:"false" maxLength:"500"`
+	}
+}
+
+type CreateAcquisitionOutput struct {
+	Location string           `header:"Location"`
+	Body     data.Acquisition `json:"acquisition"`
+}
+
+type GetAcquisitionInput struct {
+	ID string `json:"id" path:"id"`
+}
+
+type AcquisitionOutput struct {
+	Body data.Acquisition `json:"acquisition"`
+}
+
+type GetAcquisitionsInput struct {
+	PaginationInput
+	Source string `query:"source" enum:"donation,purchase" doc:"Filter by source"`
+	Status string `query:"status" enum:"received,cataloged" doc:"Filter by status"`
+	Vendor string `query:"vendor" doc:"Filter by vendor or donor"`
+	Sort   string `query:"sort" enum:"received_at,cost,created_at,-received_at,-cost,-created_at" default:"-received_at"`
+}
+
+type GetBookAcquisitionsInput struct {
+	PaginationInput
+	ID   string `json:"id" path:"id"`
+	Sort string `query:"sort" enum:"received_at,cost,created_at,-received_at,-cost,-created_at" default:"-received_at"`
+}
+
+type GetAcquisitionsOutput struct {
+	Body AcquisitionsInfo
+}
+
+type AcquisitionsInfo struct {
+	Acquisitions []data.Acquisition `json:"acquisitions"`
+	Metadata     data.Metadata      `json:"metadata"`
+}
+
+type CatalogAcquisitionInput struct {
+	ID   string `json:"id" path:"id"`
+	Body *struct {
+		BookID string `json:"book_id,omitempty" required:"false" doc:"ID of the Book the copies are added to. The book with the ISBN of the acquisition by default"`
+	}
+}
+
+type CatalogAcquisitionOutput struct {
+	Body CatalogedAcquisition
+}
+
+// CatalogedAcquisition is an Acquisition whose copies were added to the catalog, with the Book
+// they were added to.
+type CatalogedAcquisition struct {
+	Acquisition data.Acquisition `json:"acquisition"`
+	Book        data.Book        `json:"book"`
+}
+
+// Resolve validates the input in CreateAcquisitionInput.
+func (a *CreateAcquisitionInput) Resolve(ctx huma.Context) []error {
+	a.Body.Vendor = strings.TrimSpace(a.Body.Vendor)
+	a.Body.Title = strings.TrimSpace(a.Body.Title)
+	a.Body.Note = strings.TrimSpace(a.Body.Note)
+
+	if a.Body.ReceivedAt != nil && a.Body.ReceivedAt.After(time.Now()) {
+		return []error{&huma.ErrorDetail{
+			Location: "body.received_at",
+			Message:  "Received at must not be in the future",
+			Value:    *a.Body.ReceivedAt,
+		}}
+	}
+
+	return nil
+}
+
+// Resolve validates the input in GetAcquisitionInput.
+func (a *GetAcquisitionInput) Resolve(ctx huma.Context) []error {
+	if err := validateID(&a.ID, "path.id"); err != nil {
+		return []error{err}
+	}
+
+	return nil
+}
+
+// Resolve validates the input in GetBookAcquisitionsInput.
+func (a *GetBookAcquisitionsInput) Resolve(ctx huma.Context) []error {
+	if err := validateID(&a.ID, "path.id"); err != nil {
+		return []error{err}
+	}
+
+	return nil
+}
+
+// Resolve validates the input in CatalogAcquisitionInput.
+func (a *CatalogAcquisitionInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	err := validateID(&a.ID, "path.id")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	if a.Body != nil && a.Body.BookID != "" {
+		err = validateID(&a.Body.BookID, "body.book_id")
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs
+}
+
+// createAcquisitionHandler records copies of a book which the library received.
+func (app *Application) createAcquisitionHandler(ctx context.Context, input *CreateAcquisitionInput) (*CreateAcquisitionOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	receivedAt := time.Now()
+	if input.Body.ReceivedAt != nil {
+		receivedAt = *input.Body.ReceivedAt
+	}
+
+	acquisition := &data.Acquisition{
+		Source:     input.Body.Source,
+		Vendor:     input.Body.Vendor,
+		ISBN:       input.Body.ISBN,
+		Title:      input.Body.Title,
+		Copies:     input.Body.Copies,
+		Cost:       input.Body.Cost,
+		ReceivedAt: receivedAt,
+		Note:       input.Body.Note,
+		Status:     data.AcquisitionStatusReceived,
+	}
+
+	id, err := app.Models.Acquisitions.Insert(ctx, acquisition)
+	if err != nil {
+		return &CreateAcquisitionOutput{}, app.serverError(ctx, err)
+	}
+	acquisition.ID = id
+
+	resp := &CreateAcquisitionOutput{
+		Body:     *acquisition,
+		Location: fmt.Sprintf("%s/%s/%s", basePath, acquisitionsKey, id),
+	}
+
+	return resp, nil
+}
+
+// getAcquisitionHandler fetches an acquisition by its ID.
+func (app *Application) getAcquisitionHandler(ctx context.Context, input *GetAcquisitionInput) (*AcquisitionOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	acquisition, err := app.Models.Acquisitions.Get(ctx, data.AcquisitionFilter{ID: &input.ID})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return &AcquisitionOutput{}, huma.Error404NotFound(errNotFoundMsg)
+		default:
+			return &AcquisitionOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	resp := &AcquisitionOutput{
+		Body: *acquisition,
+	}
+
+	return resp, nil
+}
+
+// getAcquisitionsHandler fetches acquisitions with pagination, filtering and sorting.
+func (app *Application) getAcquisitionsHandler(ctx context.Context, input *GetAcquisitionsInput) (*GetAcquisitionsOutput, error) {
+	filter := data.AcquisitionFilter{}
+	if input.Source != "" {
+		filter.Source = &input.Source
+	}
+	if input.Status != "" {
+		filter.Status = &input.Status
+	}
+	if input.Vendor != "" {
+		filter.Vendor = &input.Vendor
+	}
+
+	return app.getAcquisitions(ctx, filter, input.PaginationInput, input.Sort)
+}
+
+// getBookAcquisitionsHandler fetches the acquisitions whose copies were added to a book, which
+// show how the stock of the book arrived.
+func (app *Application) getBookAcquisitionsHandler(ctx context.Context, input *GetBookAcquisitionsInput) (*GetAcquisitionsOutput, error) {
+	return app.getAcquisitions(ctx, data.AcquisitionFilter{BookID: &input.ID}, input.PaginationInput, input.Sort)
+}
+
+// getAcquisitions fetches the acquisitions matching filter with pagination and sorting.
+func (app *Application) getAcquisitions(ctx context.Context, filter data.AcquisitionFilter, pagination PaginationInput, sort string) (*GetAcquisitionsOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	paginator := data.Paginator{Page: pagination.Page, PageSize: pagination.PageSize}
+	sorter := data.Sorter{Field: sort, SortSafelist: supportedAcquisitionsSortFields, Collation: app.collation}
+
+	acquisitions, metadata, err := app.Models.Acquisitions.GetAll(ctx, filter, paginator, sorter)
+	if err != nil {
+		return &GetAcquisitionsOutput{}, app.serverError(ctx, err)
+	}
+
+	resp := &GetAcquisitionsOutput{
+		Body: AcquisitionsInfo{
+			Acquisitions: acquisitions,
+			Metadata:     metadata,
+		},
+	}
+
+	return resp, nil
+}
+
+// catalogAcquisitionHandler adds the copies of an acquisition to the catalog, either to the given
+// book or to the book with the ISBN of the acquisition, and records the book on the acquisition.
+func (app *Application) catalogAcquisitionHandler(ctx context.Context, input *CatalogAcquisitionInput) (*CatalogAcquisitionOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	var cataloged CatalogedAcquisition
+
+	err := app.Models.Transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		acquisition, err := app.Models.Acquisitions.Get(ctx, data.AcquisitionFilter{ID: &input.ID})
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrDocumentNotFound):
+				return huma.Error404NotFound(errNotFoundMsg)
+			default:
+				return err
+			}
+		}
+
+		if acquisition.Status == data.AcquisitionStatusCataloged {
+			return huma.Error422UnprocessableEntity(errAcquisitionCatalogedMsg)
+		}
+
+		filter := data.BookFilter{Identifier: &acquisition.ISBN}
+		if input.Body != nil && input.Body.BookID != "" {
+			filter = data.BookFilter{ID: ptr(data.BookID(input.Body.BookID))}
+		} else if acquisition.ISBN == "" {
+			return huma.Error422UnprocessableEntity(errAcquisitionNoBookMsg)
+		}
+
+		book, err := app.Models.Books.Get(ctx, filter)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrDocumentNotFound) && filter.ID != nil:
+				return huma.Error404NotFound(errNotFoundMsg)
+			case errors.Is(err, data.ErrDocumentNotFound):
+				return huma.Error422UnprocessableEntity(errAcquisitionNoBookMsg)
+			default:
+				return err
+			}
+		}
+
+		book.Copies += acquisition.Copies
+		if err = app.Models.Books.Update(ctx, data.BookFilter{ID: ptr(data.BookID(book.ID))}, book); err != nil {
+			switch {
+			case errors.Is(err, data.ErrEditConflict):
+				return huma.Error409Conflict(errConflictMsg)
+			case errors.Is(err, data.ErrDocumentNotFound):
+				return huma.Error404NotFound(errNotFoundMsg)
+			default:
+				return err
+			}
+		}
+
+		acquisition.Status = data.AcquisitionStatusCataloged
+		acquisition.BookID = book.ID
+		acquisition.CatalogedAt = time.Now()
+		if err = app.Models.Acquisitions.Update(ctx, data.AcquisitionFilter{ID: &acquisition.ID}, acquisition); err != nil {
+			switch {
+			case errors.Is(err, data.ErrEditConflict):
+				return huma.Error409Conflict(errConflictMsg)
+			default:
+				return err
+			}
+		}
+
+		cataloged = CatalogedAcquisition{Acquisition: *acquisition, Book: *book}
+
+		return app.recordEvent(ctx, data.EventBookUpdated, book)
+	})
+	if err != nil {
+		return &CatalogAcquisitionOutput{}, app.transactionError(ctx, err)
+	}
+
+	resp := &CatalogAcquisitionOutput{
+		Body: cataloged,
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,89 @@
+package api_test
+
+import (
+	"context"
+	"github.com/mzeevi/library/internal/api"
+	"github.com/mzeevi/library/internal/api/apitest"
+	"github.com/mzeevi/library/internal/data"
+	"net/http"
+	"testing"
+)
+
+func TestCatalogAcquisition(t *testing.T) {
+	a := apitest.New(t)
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+
+	bookID := a.SeedBook(apitest.Book("9780306406157", 2))
+
+	create := func(body map[string]any) data.Acquisition {
+		t.Helper()
+
+		rec := a.Do(http.MethodPost, "/acquisitions", admin, body)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("create acquisition status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+		}
+
+		var acquisition data.Acquisition
+		a.Decode(rec, &acquisition)
+
+		return acquisition
+	}
+
+	purchased := create(map[string]any{"source": "purchase", "vendor": "Book Supply Co.", "isbn": "9780306406157", "title": "Purchased", "copies": 3, "cost": 45.5})
+	donated := create(map[string]any{"source": "donation", "vendor": "Jane Doe", "title": "Donated without an ISBN", "copies": 1})
+	unknown := create(map[string]any{"source": "donation", "vendor": "Jane Doe", "isbn": "9780000000002", "title": "Not in the catalog", "copies": 1})
+
+	if purchased.Status != data.AcquisitionStatusReceived || purchased.ReceivedAt.IsZero() {
+		t.Errorf("acquisition = %+v; want a received acquisition", purchased)
+	}
+
+	tests := []struct {
+		name       string
+		id         string
+		body       []any
+		wantStatus int
+		wantCopies int
+	}{
+		{name: "by isbn", id: purchased.ID, wantStatus: http.StatusOK, wantCopies: 5},
+		{name: "already cataloged", id: purchased.ID, wantStatus: http.StatusUnprocessableEntity, wantCopies: 5},
+		{name: "no isbn", id: donated.ID, wantStatus: http.StatusUnprocessableEntity, wantCopies: 5},
+		{name: "isbn not in the catalog", id: unknown.ID, wantStatus: http.StatusUnprocessableEntity, wantCopies: 5},
+		{name: "by book", id: donated.ID, body: []any{map[string]any{"book_id": bookID}}, wantStatus: http.StatusOK, wantCopies: 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := a.Do(http.MethodPost, "/acquisitions/"+tt.id+"/catalog", append([]any{admin}, tt.body...)...)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %v; want %v (body: %s)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+
+			book, err := a.Models.Books.Get(context.Background(), data.BookFilter{ID: apitest.Ptr(data.BookID(bookID))})
+			if err != nil {
+				t.Fatalf("Books.Get() error = %v", err)
+			}
+			if book.Copies != tt.wantCopies {
+				t.Errorf("copies = %v; want %v", book.Copies, tt.wantCopies)
+			}
+		})
+	}
+
+	rec := a.Do(http.MethodGet, "/books/"+bookID+"/acquisitions", admin)
+	var info api.AcquisitionsInfo
+	a.Decode(rec, &info)
+	if len(info.Acquisitions) != 2 {
+		t.Fatalf("acquisitions of the book = %d; want 2", len(info.Acquisitions))
+	}
+	for _, acquisition := range info.Acquisitions {
+		if acquisition.Status != data.AcquisitionStatusCataloged || acquisition.BookID != bookID || acquisition.CatalogedAt.IsZero() {
+			t.Errorf("acquisition = %+v; want it cataloged to %s", acquisition, bookID)
+		}
+	}
+
+	rec = a.Do(http.MethodGet, "/acquisitions?source=donation&status=received", admin)
+	a.Decode(rec, &info)
+	if len(info.Acquisitions) != 1 || info.Acquisitions[0].ID != unknown.ID {
+		t.Errorf("received donations = %+v; want %s", info.Acquisitions, unknown.ID)
+	}
+}
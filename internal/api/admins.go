@@ -0,0 +1,241 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/mzeevi/library/internal/data"
+)
+
+const (
+	errAdminExistsMsg = "an admin with this name already exists"
+	errOwnAdminMsg    = "admins cannot delete or deactivate their own admin"
+)
+
+type GetAdminsOutput struct {
+	Body AdminsInfo
+}
+
+type AdminsInfo struct {
+	Admins []data.Admin `json:"admins"`
+}
+
+type UpdateAdminInput struct {
+	ID   string `json:"id" path:"id"`
+	Body struct {
+		Name      *string `json:"name,omitempty" minLength:"1" doc:"New name of the admin, which must be unique"`
+		Activated *bool   `json:"activated,omitempty" doc:"Whether the admin may authenticate"`
+	}
+}
+
+type UpdateAdminOutput struct {
+	Body data.Admin `json:"admin"`
+}
+
+type DeleteAdminInput struct {
+	ID string `json:"id" path:"id"`
+}
+
+type DeleteAdminOutput struct {
+	Body string `json:"message"`
+}
+
+type UpdateAdminPasswordInput struct {
+	ID   string `json:"id" path:"id"`
+	Body struct {
+		Password string `json:"password" maxLength:"72" doc:"New password of the admin, which must follow the password policy"`
+	}
+}
+
+type UpdateAdminPasswordOutput struct {
+	Body string `json:"message"`
+}
+
+// Resolve validates the input in UpdateAdminPasswordInput.
+func (a *UpdateAdminPasswordInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	err := validateID(&a.ID, "path.id")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// Resolve validates the input in UpdateAdminInput.
+func (a *UpdateAdminInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	err := validateID(&a.ID, "path.id")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// Resolve validates the input in DeleteAdminInput.
+func (a *DeleteAdminInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	err := validateID(&a.ID, "path.id")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// checkNotOwnAdmin returns a 409 Conflict error if the admin is the admin of the request, which
+// cannot delete or deactivate itself. Since only activated admins make requests, this also keeps
+// the last activated admin.
+func checkNotOwnAdmin(ctx context.Context, admin *data.Admin) error {
+	if current, ok := adminFromContext(ctx); ok && current.ID == admin.ID {
+		return huma.Error409Conflict(errOwnAdminMsg)
+	}
+
+	return nil
+}
+
+// getAdminsHandler handles a request to get all admins.
+func (app *Application) getAdminsHandler(ctx context.Context, input *struct{}) (*GetAdminsOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	admins, _, err := app.Models.Admins.GetAll(ctx, data.AdminFilter{}, data.Paginator{}, data.Sorter{})
+	if err != nil {
+		return &GetAdminsOutput{}, app.serverError(ctx, err)
+	}
+
+	resp := &GetAdminsOutput{
+		Body: AdminsInfo{
+			Admins: admins,
+		},
+	}
+
+	return resp, nil
+}
+
+// updateAdminHandler handles a request to rename, activate or deactivate an admin.
+func (app *Application) updateAdminHandler(ctx context.Context, input *UpdateAdminInput) (*UpdateAdminOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	admin, err := app.Models.Admins.Get(ctx, data.AdminFilter{ID: &input.ID})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return &UpdateAdminOutput{}, huma.Error404NotFound(errNotFoundMsg)
+		default:
+			return &UpdateAdminOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	if input.Body.Name != nil {
+		admin.Name = *input.Body.Name
+	}
+
+	if input.Body.Activated != nil {
+		if !*input.Body.Activated {
+			if err = checkNotOwnAdmin(ctx, admin); err != nil {
+				return &UpdateAdminOutput{}, err
+			}
+		}
+		admin.Activated = *input.Body.Activated
+	}
+
+	err = app.Models.Admins.Update(ctx, data.AdminFilter{ID: &input.ID}, admin)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateName):
+			return &UpdateAdminOutput{}, huma.Error409Conflict(errAdminExistsMsg)
+		case errors.Is(err, data.ErrEditConflict):
+			return &UpdateAdminOutput{}, huma.Error409Conflict(errConflictMsg)
+		default:
+			return &UpdateAdminOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	resp := &UpdateAdminOutput{
+		Body: *admin,
+	}
+
+	return resp, nil
+}
+
+// deleteAdminHandler handles a request to delete an admin other than the admin of the request.
+func (app *Application) deleteAdminHandler(ctx context.Context, input *DeleteAdminInput) (*DeleteAdminOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	admin, err := app.Models.Admins.Get(ctx, data.AdminFilter{ID: &input.ID})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return &DeleteAdminOutput{}, huma.Error404NotFound(errNotFoundMsg)
+		default:
+			return &DeleteAdminOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	if err = checkNotOwnAdmin(ctx, admin); err != nil {
+		return &DeleteAdminOutput{}, err
+	}
+
+	err = app.Models.Admins.Delete(ctx, data.AdminFilter{ID: &input.ID})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return &DeleteAdminOutput{}, huma.Error404NotFound(errNotFoundMsg)
+		default:
+			return &DeleteAdminOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	resp := &DeleteAdminOutput{
+		Body: "admin successfully deleted",
+	}
+
+	return resp, nil
+}
+
+// updateAdminPasswordHandler handles a request to rotate the password of an admin.
+func (app *Application) updateAdminPasswordHandler(ctx context.Context, input *UpdateAdminPasswordInput) (*UpdateAdminPasswordOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	admin, err := app.Models.Admins.Get(ctx, data.AdminFilter{ID: &input.ID})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return &UpdateAdminPasswordOutput{}, huma.Error404NotFound(errNotFoundMsg)
+		default:
+			return &UpdateAdminPasswordOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	if err = app.checkPassword(ctx, input.Body.Password, "body.password"); err != nil {
+		return &UpdateAdminPasswordOutput{}, err
+	}
+
+	if err = admin.Password.Set(input.Body.Password); err != nil {
+		return &UpdateAdminPasswordOutput{}, app.serverError(ctx, err)
+	}
+
+	err = app.Models.Admins.Update(ctx, data.AdminFilter{ID: &input.ID}, admin)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			return &UpdateAdminPasswordOutput{}, huma.Error409Conflict(errConflictMsg)
+		default:
+			return &UpdateAdminPasswordOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	resp := &UpdateAdminPasswordOutput{
+		Body: "admin password successfully updated",
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,184 @@
+package api_test
+
+import (
+	"context"
+	"github.com/mzeevi/library/internal/api"
+	"github.com/mzeevi/library/internal/api/apitest"
+	"github.com/mzeevi/library/internal/data"
+	"net/http"
+	"testing"
+)
+
+// concurrentAdminStore is an AdminStore which updates an Admin after it is read, like another
+// request which updated it in the meantime, so the version which was read is stale.
+type concurrentAdminStore struct {
+	data.AdminStore
+	stale bool
+}
+
+func (s *concurrentAdminStore) Get(ctx context.Context, filter data.AdminFilter) (*data.Admin, error) {
+	admin, err := s.AdminStore.Get(ctx, filter)
+	if err != nil || !s.stale || filter.ID == nil {
+		return admin, err
+	}
+
+	read := *admin
+	if err = s.AdminStore.Update(ctx, data.AdminFilter{ID: filter.ID}, admin); err != nil {
+		return nil, err
+	}
+
+	return &read, nil
+}
+
+func adminID(t *testing.T, a *apitest.API, name string) string {
+	t.Helper()
+
+	admin, err := a.Models.Admins.Get(context.Background(), data.AdminFilter{Name: &name})
+	if err != nil {
+		t.Fatalf("failed to get admin %s: %v", name, err)
+	}
+
+	return admin.ID
+}
+
+func TestAdminEndpoints(t *testing.T) {
+	a := apitest.New(t)
+	a.SeedAdmin("admin", "admin-password")
+	a.SeedAdmin("other", "other-password")
+	a.SeedAdmin("third", "third-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+	adminPath := "/admins/" + adminID(t, a, "admin")
+	otherPath := "/admins/" + adminID(t, a, "other")
+	thirdPath := "/admins/" + adminID(t, a, "third")
+
+	rec := a.Do(http.MethodGet, "/admins", admin)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /admins status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var list api.AdminsInfo
+	a.Decode(rec, &list)
+	if len(list.Admins) != 3 {
+		t.Errorf("GET /admins = %d admins; want %d", len(list.Admins), 3)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   any
+		want   int
+	}{
+		{name: "update missing", method: http.MethodPut, path: "/admins/000000000000000000000000", body: map[string]any{"name": "missing"}, want: http.StatusNotFound},
+		{name: "update invalid id", method: http.MethodPut, path: "/admins/not-an-id", body: map[string]any{"name": "invalid"}, want: http.StatusUnprocessableEntity},
+		{name: "update empty name", method: http.MethodPut, path: otherPath, body: map[string]any{"name": ""}, want: http.StatusUnprocessableEntity},
+		{name: "update duplicate name", method: http.MethodPut, path: otherPath, body: map[string]any{"name": "admin"}, want: http.StatusConflict},
+		{name: "rename", method: http.MethodPut, path: otherPath, body: map[string]any{"name": "renamed"}, want: http.StatusOK},
+		{name: "deactivate own admin", method: http.MethodPut, path: adminPath, body: map[string]any{"activated": false}, want: http.StatusConflict},
+		{name: "deactivate other admin", method: http.MethodPut, path: thirdPath, body: map[string]any{"activated": false}, want: http.StatusOK},
+		{name: "delete own admin", method: http.MethodDelete, path: adminPath, want: http.StatusConflict},
+		{name: "delete missing", method: http.MethodDelete, path: "/admins/000000000000000000000000", want: http.StatusNotFound},
+		{name: "delete other admin", method: http.MethodDelete, path: otherPath, want: http.StatusOK},
+		{name: "delete deleted admin", method: http.MethodDelete, path: otherPath, want: http.StatusNotFound},
+		{name: "password of missing admin", method: http.MethodPut, path: "/admins/000000000000000000000000/password", body: map[string]any{"password": "a new pa55word"}, want: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := []any{admin}
+			if tt.body != nil {
+				args = append(args, tt.body)
+			}
+
+			rec := a.Do(tt.method, tt.path, args...)
+			if rec.Code != tt.want {
+				t.Errorf("%s %s status = %v; want %v (body: %s)", tt.method, tt.path, rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+
+	if rec := a.Do(http.MethodGet, "/admins", apitest.AdminAuth("third", "third-password")); rec.Code != http.StatusForbidden {
+		t.Errorf("GET /admins by a deactivated admin status = %v; want %v", rec.Code, http.StatusForbidden)
+	}
+}
+
+func TestDeleteLastAdmin(t *testing.T) {
+	a := apitest.New(t)
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+	path := "/admins/" + adminID(t, a, "admin")
+
+	// The only admin is the admin of the request, so it can be neither deleted nor deactivated.
+	if rec := a.Do(http.MethodDelete, path, admin); rec.Code != http.StatusConflict {
+		t.Errorf("DELETE the last admin status = %v; want %v (body: %s)", rec.Code, http.StatusConflict, rec.Body.String())
+	}
+	if rec := a.Do(http.MethodPut, path, admin, map[string]any{"activated": false}); rec.Code != http.StatusConflict {
+		t.Errorf("deactivate the last admin status = %v; want %v (body: %s)", rec.Code, http.StatusConflict, rec.Body.String())
+	}
+
+	if rec := a.Do(http.MethodGet, "/admins", admin); rec.Code != http.StatusOK {
+		t.Errorf("GET /admins by the last admin status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+}
+
+func TestUpdateAdminStaleVersion(t *testing.T) {
+	models := data.NewMemoryModels()
+	store := &concurrentAdminStore{AdminStore: models.Admins}
+	models.Admins = store
+
+	a := apitest.NewWithModels(t, models)
+	a.SeedAdmin("admin", "admin-password")
+	a.SeedAdmin("other", "other-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+	otherPath := "/admins/" + adminID(t, a, "other")
+
+	// Admins are created with version 0, which is matched by the filter of admins created before
+	// versioning.
+	if rec := a.Do(http.MethodPut, otherPath, admin, map[string]any{"name": "renamed"}); rec.Code != http.StatusOK {
+		t.Fatalf("PUT %s status = %v; want %v (body: %s)", otherPath, rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	store.stale = true
+	if rec := a.Do(http.MethodPut, otherPath, admin, map[string]any{"name": "stale"}); rec.Code != http.StatusConflict {
+		t.Errorf("PUT %s with a stale version status = %v; want %v (body: %s)", otherPath, rec.Code, http.StatusConflict, rec.Body.String())
+	}
+	if rec := a.Do(http.MethodPut, otherPath+"/password", admin, map[string]any{"password": "a new pa55word"}); rec.Code != http.StatusConflict {
+		t.Errorf("PUT %s/password with a stale version status = %v; want %v (body: %s)", otherPath, rec.Code, http.StatusConflict, rec.Body.String())
+	}
+}
+
+func TestUpdateAdminPassword(t *testing.T) {
+	a := apitest.New(t, func(app *api.Application) {
+		app.Config.Passwords.MinLength = 10
+		app.Config.Passwords.DenyCommon = true
+	})
+	a.SeedAdmin("admin", "admin-password")
+	a.SeedAdmin("other", "other-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+	path := "/admins/" + adminID(t, a, "other") + "/password"
+
+	tests := []struct {
+		name     string
+		password string
+		want     int
+	}{
+		{name: "too short", password: "pa55word", want: http.StatusUnprocessableEntity},
+		{name: "common", password: "Password123", want: http.StatusUnprocessableEntity},
+		{name: "too long", password: string(make([]byte, 73)), want: http.StatusUnprocessableEntity},
+		{name: "strong", password: "correct horse battery staple", want: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := a.Do(http.MethodPut, path, admin, map[string]string{"password": tt.password}); rec.Code != tt.want {
+				t.Errorf("PUT %s status = %v; want %v (body: %s)", path, rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+
+	if rec := a.Do(http.MethodGet, "/admins", apitest.AdminAuth("other", "other-password")); rec.Code != http.StatusUnauthorized {
+		t.Errorf("GET /admins with the rotated password status = %v; want %v", rec.Code, http.StatusUnauthorized)
+	}
+	if rec := a.Do(http.MethodGet, "/admins", apitest.AdminAuth("other", "correct horse battery staple")); rec.Code != http.StatusOK {
+		t.Errorf("GET /admins with the new password status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+}
@@ -0,0 +1,346 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/mzeevi/library/internal/data"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	errAnnouncementEndsBeforeStartMsg = "an announcement must end after it starts"
+)
+
+type CreateAnnouncementInput struct {
+	Body struct {
+		Title    string    `json:"title" minLength:"1" maxLength:"200"`
+		Message  string    `json:"message" minLength:"1" maxLength:"2000"`
+		Severity string    `json:"severity,omitempty" required:"false" enum:"info,warning,critical" default:"info"`
+		Audience string    `json:"audience,omitempty" required:"false" enum:"all,patrons,admins" default:"all" doc:"Who is shown the announcement: everyone, including anonymous clients, only patrons, or only admins"`
+		StartsAt time.Time `json:"starts_at,omitempty" required:"false" format:"date-time" doc:"When the announcement is first shown, now by default"`
+		EndsAt   time.Time `json:"ends_at,omitempty" required:"false" format:"date-time" doc:"When the announcement stops being shown. It is shown until it is deleted by default"`
+	}
+}
+
+type CreateAnnouncementOutput struct {
+	Location string            `header:"Location"`
+	Body     data.Announcement `json:"announcement"`
+}
+
+type GetAnnouncementInput struct {
+	ID string `json:"id" path:"id"`
+}
+
+type AnnouncementOutput struct {
+	Body data.Announcement `json:"announcement"`
+}
+
+type GetAnnouncementsInput struct {
+	PaginationInput
+	Active   string `query:"active" enum:"true,false" doc:"Only announcements which are shown now if true, or only scheduled and ended announcements if false. Clients which are not admins are only shown active announcements"`
+	Audience string `query:"audience" enum:"all,patrons,admins" doc:"Filter by audience, for admins"`
+	Severity string `query:"severity" enum:"info,warning,critical" doc:"Filter by severity"`
+	Sort     string `query:"sort" enum:"starts_at,-starts_at,created_at,-created_at" default:"-starts_at"`
+}
+
+type GetAnnouncementsOutput struct {
+	Body AnnouncementsInfo
+}
+
+type AnnouncementsInfo struct {
+	Announcements []data.Announcement `json:"announcements"`
+	Metadata      data.Metadata       `json:"metadata"`
+}
+
+type UpdateAnnouncementInput struct {
+	ID   string `json:"id" path:"id"`
+	Body struct {
+		Title    *string    `json:"title,omitempty" minLength:"1" maxLength:"200"`
+		Message  *string    `json:"message,omitempty" minLength:"1" maxLength:"2000"`
+		Severity *string    `json:"severity,omitempty" enum:"info,warning,critical"`
+		Audience *string    `json:"audience,omitempty" enum:"all,patrons,admins"`
+		StartsAt *time.Time `json:"starts_at,omitempty" format:"date-time"`
+		EndsAt   *time.Time `json:"ends_at,omitempty" format:"date-time"`
+	}
+}
+
+type DeleteAnnouncementInput struct {
+	ID string `json:"id" path:"id"`
+}
+
+type DeleteAnnouncementOutput struct {
+	Body string `json:"message"`
+}
+
+// Resolve validates the input in CreateAnnouncementInput.
+func (a *CreateAnnouncementInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	a.Body.Title = strings.TrimSpace(a.Body.Title)
+	a.Body.Message = strings.TrimSpace(a.Body.Message)
+
+	if a.Body.Title == "" {
+		errs = append(errs, &huma.ErrorDetail{
+			Location: "body.title",
+			Message:  "Title must not be empty",
+			Value:    a.Body.Title,
+		})
+	}
+
+	if a.Body.Message == "" {
+		errs = append(errs, &huma.ErrorDetail{
+			Location: "body.message",
+			Message:  "Message must not be empty",
+			Value:    a.Body.Message,
+		})
+	}
+
+	if !a.Body.StartsAt.IsZero() && !a.Body.EndsAt.IsZero() && !a.Body.EndsAt.After(a.Body.StartsAt) {
+		errs = append(errs, &huma.ErrorDetail{
+			Location: "body.ends_at",
+			Message:  errAnnouncementEndsBeforeStartMsg,
+			Value:    a.Body.EndsAt,
+		})
+	}
+
+	return errs
+}
+
+// Resolve validates the input in GetAnnouncementInput.
+func (a *GetAnnouncementInput) Resolve(ctx huma.Context) []error {
+	if err := validateID(&a.ID, "path.id"); err != nil {
+		return []error{err}
+	}
+
+	return nil
+}
+
+// Resolve validates the input in UpdateAnnouncementInput.
+func (a *UpdateAnnouncementInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	if err := validateID(&a.ID, "path.id"); err != nil {
+		errs = append(errs, err)
+	}
+
+	if a.Body.Title != nil {
+		*a.Body.Title = strings.TrimSpace(*a.Body.Title)
+		if *a.Body.Title == "" {
+			errs = append(errs, &huma.ErrorDetail{
+				Location: "body.title",
+				Message:  "Title must not be empty",
+				Value:    *a.Body.Title,
+			})
+		}
+	}
+
+	if a.Body.Message != nil {
+		*a.Body.Message = strings.TrimSpace(*a.Body.Message)
+		if *a.Body.Message == "" {
+			errs = append(errs, &huma.ErrorDetail{
+				Location: "body.message",
+				Message:  "Message must not be empty",
+				Value:    *a.Body.Message,
+			})
+		}
+	}
+
+	return errs
+}
+
+// Resolve validates the input in DeleteAnnouncementInput.
+func (a *DeleteAnnouncementInput) Resolve(ctx huma.Context) []error {
+	if err := validateID(&a.ID, "path.id"); err != nil {
+		return []error{err}
+	}
+
+	return nil
+}
+
+// createAnnouncementHandler handles a request to schedule an announcement, such as a maintenance
+// notice or the hours of a holiday.
+func (app *Application) createAnnouncementHandler(ctx context.Context, input *CreateAnnouncementInput) (*CreateAnnouncementOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	admin, ok := adminFromContext(ctx)
+	if !ok {
+		return &CreateAnnouncementOutput{}, app.serverError(ctx, errors.New("no admin in the context of an admin request"))
+	}
+
+	announcement := &data.Announcement{
+		Title:     input.Body.Title,
+		Message:   input.Body.Message,
+		Severity:  input.Body.Severity,
+		Audience:  input.Body.Audience,
+		StartsAt:  input.Body.StartsAt,
+		EndsAt:    input.Body.EndsAt,
+		CreatedBy: admin.Name,
+	}
+	if announcement.StartsAt.IsZero() {
+		announcement.StartsAt = time.Now()
+	}
+	if !announcement.EndsAt.IsZero() && !announcement.EndsAt.After(announcement.StartsAt) {
+		return &CreateAnnouncementOutput{}, huma.Error422UnprocessableEntity(errAnnouncementEndsBeforeStartMsg)
+	}
+
+	id, err := app.Models.Announcements.Insert(ctx, announcement)
+	if err != nil {
+		return &CreateAnnouncementOutput{}, app.serverError(ctx, err)
+	}
+	announcement.ID = id
+
+	resp := &CreateAnnouncementOutput{
+		Body:     *announcement,
+		Location: fmt.Sprintf("%s/%s/%s", basePath, announcementsKey, id),
+	}
+
+	return resp, nil
+}
+
+// getAnnouncementHandler fetches an announcement by its ID.
+func (app *Application) getAnnouncementHandler(ctx context.Context, input *GetAnnouncementInput) (*AnnouncementOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	announcement, err := app.Models.Announcements.Get(ctx, data.AnnouncementFilter{ID: &input.ID})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return &AnnouncementOutput{}, huma.Error404NotFound(errNotFoundMsg)
+		default:
+			return &AnnouncementOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	resp := &AnnouncementOutput{
+		Body: *announcement,
+	}
+
+	return resp, nil
+}
+
+// getAnnouncementsHandler fetches the announcements shown to the client with pagination, filtering
+// and sorting. Admins are shown all announcements, while patrons are shown the active announcements
+// to everyone and to patrons, and anonymous clients the active announcements to everyone.
+func (app *Application) getAnnouncementsHandler(ctx context.Context, input *GetAnnouncementsInput) (*GetAnnouncementsOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	paginator := data.Paginator{Page: input.Page, PageSize: input.PageSize}
+	sorter := data.Sorter{Field: input.Sort, SortSafelist: supportedAnnouncementsSortFields, Collation: app.collation}
+
+	filter := data.AnnouncementFilter{}
+	if input.Severity != "" {
+		filter.Severity = &input.Severity
+	}
+
+	if _, ok := adminFromContext(ctx); ok {
+		if input.Audience != "" {
+			filter.Audiences = []string{input.Audience}
+		}
+		if input.Active != "" {
+			active, _ := strconv.ParseBool(input.Active)
+			filter.Active = &active
+		}
+	} else {
+		filter.Audiences = []string{data.AnnouncementAudienceAll}
+		if _, ok := patronFromContext(ctx); ok {
+			filter.Audiences = append(filter.Audiences, data.AnnouncementAudiencePatrons)
+		}
+		filter.Active = ptr(true)
+	}
+
+	announcements, metadata, err := app.Models.Announcements.GetAll(ctx, filter, paginator, sorter)
+	if err != nil {
+		return &GetAnnouncementsOutput{}, app.serverError(ctx, err)
+	}
+
+	resp := &GetAnnouncementsOutput{
+		Body: AnnouncementsInfo{
+			Announcements: announcements,
+			Metadata:      metadata,
+		},
+	}
+
+	return resp, nil
+}
+
+// updateAnnouncementHandler updates the fields of an announcement, such as rescheduling it.
+func (app *Application) updateAnnouncementHandler(ctx context.Context, input *UpdateAnnouncementInput) (*AnnouncementOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	announcement, err := app.Models.Announcements.Get(ctx, data.AnnouncementFilter{ID: &input.ID})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return &AnnouncementOutput{}, huma.Error404NotFound(errNotFoundMsg)
+		default:
+			return &AnnouncementOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	if input.Body.Title != nil {
+		announcement.Title = *input.Body.Title
+	}
+	if input.Body.Message != nil {
+		announcement.Message = *input.Body.Message
+	}
+	if input.Body.Severity != nil {
+		announcement.Severity = *input.Body.Severity
+	}
+	if input.Body.Audience != nil {
+		announcement.Audience = *input.Body.Audience
+	}
+	if input.Body.StartsAt != nil {
+		announcement.StartsAt = *input.Body.StartsAt
+	}
+	if input.Body.EndsAt != nil {
+		announcement.EndsAt = *input.Body.EndsAt
+	}
+	if !announcement.EndsAt.IsZero() && !announcement.EndsAt.After(announcement.StartsAt) {
+		return &AnnouncementOutput{}, huma.Error422UnprocessableEntity(errAnnouncementEndsBeforeStartMsg)
+	}
+
+	if err = app.Models.Announcements.Update(ctx, data.AnnouncementFilter{ID: &announcement.ID}, announcement); err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			return &AnnouncementOutput{}, huma.Error409Conflict(errConflictMsg)
+		default:
+			return &AnnouncementOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	resp := &AnnouncementOutput{
+		Body: *announcement,
+	}
+
+	return resp, nil
+}
+
+// deleteAnnouncementHandler handles a request to delete an announcement, which stops showing it.
+func (app *Application) deleteAnnouncementHandler(ctx context.Context, input *DeleteAnnouncementInput) (*DeleteAnnouncementOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	err := app.Models.Announcements.Delete(ctx, data.AnnouncementFilter{ID: &input.ID})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return &DeleteAnnouncementOutput{}, huma.Error404NotFound(errNotFoundMsg)
+		default:
+			return &DeleteAnnouncementOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	resp := &DeleteAnnouncementOutput{
+		Body: "announcement successfully deleted",
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,117 @@
+package api_test
+
+import (
+	"github.com/mzeevi/library/internal/api"
+	"github.com/mzeevi/library/internal/api/apitest"
+	"github.com/mzeevi/library/internal/auth"
+	"github.com/mzeevi/library/internal/data"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestGetAnnouncements(t *testing.T) {
+	a := apitest.New(t)
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+	patron := a.PatronAuth(a.SeedPatron(apitest.Patron("reader@example.com", auth.ReadBooksPermission)))
+
+	now := time.Now()
+	for _, body := range []map[string]any{
+		{"title": "Everyone", "message": "Open late on Thursday"},
+		{"title": "Patrons", "message": "New e-books", "audience": "patrons"},
+		{"title": "Admins", "message": "Inventory on Sunday", "audience": "admins", "severity": "warning"},
+		{"title": "Scheduled", "message": "Closed for the holiday", "starts_at": now.Add(24 * time.Hour)},
+		{"title": "Ended", "message": "Maintenance tonight", "starts_at": now.Add(-48 * time.Hour), "ends_at": now.Add(-24 * time.Hour)},
+	} {
+		if rec := a.Do(http.MethodPost, "/announcements", admin, body); rec.Code != http.StatusOK {
+			t.Fatalf("create announcement %s status = %v; want %v (body: %s)", body["title"], rec.Code, http.StatusOK, rec.Body.String())
+		}
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		auth  []any
+		want  []string
+	}{
+		{name: "anonymous", query: "?active=false", want: []string{"Everyone"}},
+		{name: "patron", query: "", auth: []any{patron}, want: []string{"Everyone", "Patrons"}},
+		{name: "admin", query: "?active=true", auth: []any{admin}, want: []string{"Everyone", "Patrons", "Admins"}},
+		{name: "admin inactive", query: "?active=false", auth: []any{admin}, want: []string{"Scheduled", "Ended"}},
+		{name: "admin by audience", query: "?audience=admins&severity=warning", auth: []any{admin}, want: []string{"Admins"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := a.Do(http.MethodGet, "/announcements"+tt.query, tt.auth...)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+			}
+
+			var info api.AnnouncementsInfo
+			a.Decode(rec, &info)
+
+			var titles []string
+			for _, announcement := range info.Announcements {
+				titles = append(titles, announcement.Title)
+			}
+			slices.Sort(titles)
+			want := slices.Clone(tt.want)
+			slices.Sort(want)
+			if !slices.Equal(titles, want) {
+				t.Errorf("announcements = %v; want %v", titles, want)
+			}
+		})
+	}
+}
+
+func TestUpdateAnnouncement(t *testing.T) {
+	a := apitest.New(t)
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+	patron := a.PatronAuth(a.SeedPatron(apitest.Patron("reader@example.com", auth.ReadBooksPermission)))
+
+	rec := a.Do(http.MethodPost, "/announcements", admin, map[string]any{"title": "Holiday hours", "message": "Closing at 14:00"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("create announcement status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var announcement data.Announcement
+	a.Decode(rec, &announcement)
+	if announcement.Severity != data.AnnouncementSeverityInfo || announcement.Audience != data.AnnouncementAudienceAll || announcement.CreatedBy != "admin" || announcement.StartsAt.IsZero() {
+		t.Errorf("announcement = %+v; want an info announcement to everyone by admin, starting now", announcement)
+	}
+
+	tests := []struct {
+		name       string
+		auth       string
+		body       map[string]any
+		wantStatus int
+	}{
+		{name: "ends before it starts", auth: admin, body: map[string]any{"ends_at": announcement.StartsAt.Add(-time.Hour)}, wantStatus: http.StatusUnprocessableEntity},
+		{name: "by a patron", auth: patron, body: map[string]any{"title": "Closed"}, wantStatus: http.StatusForbidden},
+		{name: "end it", auth: admin, body: map[string]any{"ends_at": time.Now().Add(-time.Second), "starts_at": time.Now().Add(-time.Hour)}, wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := a.Do(http.MethodPut, "/announcements/"+announcement.ID, tt.auth, tt.body); rec.Code != tt.wantStatus {
+				t.Fatalf("status = %v; want %v (body: %s)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+		})
+	}
+
+	var info api.AnnouncementsInfo
+	a.Decode(a.Do(http.MethodGet, "/announcements", patron), &info)
+	if len(info.Announcements) != 0 {
+		t.Errorf("announcements after it ended = %+v; want none", info.Announcements)
+	}
+
+	if rec = a.Do(http.MethodDelete, "/announcements/"+announcement.ID, admin); rec.Code != http.StatusOK {
+		t.Fatalf("delete announcement status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if rec = a.Do(http.MethodGet, "/announcements/"+announcement.ID, admin); rec.Code != http.StatusNotFound {
+		t.Errorf("get deleted announcement status = %v; want %v", rec.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,207 @@
+// Package apitest runs the API handlers against in-memory models, so that handler
+// behaviour such as authentication, authorization and error mapping can be tested
+// without a database. The same helpers drive the end-to-end suite against MongoDB.
+package apitest
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/go-chi/httplog/v2"
+	"github.com/mzeevi/library/internal/api"
+	"github.com/mzeevi/library/internal/auth"
+	"github.com/mzeevi/library/internal/data"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	JWTSecret = "apitest-jwt-secret"
+	Issuer    = "apitest-issuer"
+	Audience  = "apitest-audience"
+)
+
+// API is an Application which serves requests in-process.
+type API struct {
+	tb      testing.TB
+	App     *api.Application
+	Models  data.Models
+	handler http.Handler
+}
+
+// New creates an API backed by in-memory models. The config may be modified before the API is
+// built, for example to set discounts. The JWT secret, issuer and audience are always the ones of this package.
+func New(tb testing.TB, configure ...func(app *api.Application)) *API {
+	tb.Helper()
+
+	return NewWithModels(tb, data.NewMemoryModels(), configure...)
+}
+
+// NewWithModels creates an API backed by the given models, for example MongoDB models
+// connected to a test container.
+func NewWithModels(tb testing.TB, models data.Models, configure ...func(app *api.Application)) *API {
+	tb.Helper()
+
+	app := &api.Application{}
+	app.Config.JTW.Secret = JWTSecret
+	app.Config.JTW.Issuer = Issuer
+	app.Config.JTW.Audience = Audience
+
+	for _, fn := range configure {
+		fn(app)
+	}
+
+	logger := httplog.NewLogger("apitest", httplog.Options{
+		LogLevel: httplog.LevelByName("error"),
+		Writer:   io.Discard,
+	})
+
+	if err := app.SetupWithModels(models, logger); err != nil {
+		tb.Fatalf("failed to setup application: %v", err)
+	}
+
+	return &API{
+		tb:      tb,
+		App:     app,
+		Models:  models,
+		handler: app.Handler(),
+	}
+}
+
+// WithTB returns a copy of the API which reports failures to tb. It is needed inside
+// f.Fuzz, where the methods of the testing.F of New may not be called.
+func (a *API) WithTB(tb testing.TB) *API {
+	c := *a
+	c.tb = tb
+
+	return &c
+}
+
+// Do sends a request to the API. Like humatest, string arguments in the form "Key: Value"
+// are sent as headers, a []byte argument is sent as the raw body, and any other argument is
+// encoded as the JSON body.
+func (a *API) Do(method, path string, args ...any) *httptest.ResponseRecorder {
+	a.tb.Helper()
+
+	var body io.Reader
+	headers := http.Header{}
+
+	for _, arg := range args {
+		if s, ok := arg.(string); ok {
+			if key, value, found := strings.Cut(s, ":"); found {
+				headers.Add(strings.TrimSpace(key), strings.TrimSpace(value))
+				continue
+			}
+		}
+
+		if raw, ok := arg.([]byte); ok {
+			body = bytes.NewReader(raw)
+			continue
+		}
+
+		encoded, err := json.Marshal(arg)
+		if err != nil {
+			a.tb.Fatalf("failed to encode request body: %v", err)
+		}
+		body = bytes.NewReader(encoded)
+		headers.Set("Content-Type", "application/json")
+	}
+
+	req := httptest.NewRequest(method, path, body)
+	req.Header = headers
+
+	rec := httptest.NewRecorder()
+	a.handler.ServeHTTP(rec, req)
+
+	return rec
+}
+
+// Decode decodes the JSON body of a response into v.
+func (a *API) Decode(rec *httptest.ResponseRecorder, v any) {
+	a.tb.Helper()
+
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		a.tb.Fatalf("failed to decode response body %q: %v", rec.Body.String(), err)
+	}
+}
+
+// Ptr returns a pointer to v, such as to an ID of a filter.
+func Ptr[T any](v T) *T {
+	return &v
+}
+
+// Book returns a new Book with the given ISBN.
+func Book(isbn string, copies int) *data.Book {
+	return data.NewBook("", "Test Book", isbn, 100, 1, copies,
+		[]string{"Test Author"}, []string{"Test Publisher"}, []string{"Fiction"},
+		time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC))
+}
+
+// Patron returns a new activated Patron with the given permissions.
+func Patron(email string, permissions ...string) *data.Patron {
+	patron := data.NewPatron("", "Test Patron", email, data.StudentCategory)
+	patron.Activated = true
+	patron.Permissions = permissions
+
+	return patron
+}
+
+// SeedBook inserts a Book, returning its ID.
+func (a *API) SeedBook(book *data.Book) string {
+	a.tb.Helper()
+
+	id, err := a.Models.Books.Insert(context.Background(), book)
+	if err != nil {
+		a.tb.Fatalf("failed to seed book: %v", err)
+	}
+	book.ID = id
+
+	return id
+}
+
+// SeedPatron inserts a Patron, returning its ID.
+func (a *API) SeedPatron(patron *data.Patron) string {
+	a.tb.Helper()
+
+	id, err := a.Models.Patrons.Insert(context.Background(), patron)
+	if err != nil {
+		a.tb.Fatalf("failed to seed patron: %v", err)
+	}
+	patron.ID = id
+
+	return id
+}
+
+// SeedAdmin creates an Admin with all admin permissions.
+func (a *API) SeedAdmin(username, password string) {
+	a.tb.Helper()
+
+	if _, err := a.Models.Admins.Ensure(context.Background(), username, password); err != nil {
+		a.tb.Fatalf("failed to seed admin: %v", err)
+	}
+}
+
+// PatronAuth returns an Authorization header with a valid JWT for the Patron with the given ID.
+func (a *API) PatronAuth(patronID string) string {
+	a.tb.Helper()
+
+	token, err := auth.CreateJWT(patronID, JWTSecret, Issuer, Audience)
+	if err != nil {
+		a.tb.Fatalf("failed to create jwt: %v", err)
+	}
+
+	return fmt.Sprintf("Authorization: Bearer %s", token)
+}
+
+// AdminAuth returns an Authorization header with the basic auth credentials of an Admin.
+func AdminAuth(username, password string) string {
+	credentials := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+
+	return fmt.Sprintf("Authorization: Basic %s", credentials)
+}
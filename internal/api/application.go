@@ -1,11 +1,44 @@
 package api
 
 import (
+	"cmp"
+	"context"
+	"errors"
 	"fmt"
+	"github.com/go-chi/cors"
 	"github.com/go-chi/httplog/v2"
+	"github.com/mzeevi/library/internal/auth"
+	"github.com/mzeevi/library/internal/booking"
+	"github.com/mzeevi/library/internal/classification"
 	"github.com/mzeevi/library/internal/config"
 	"github.com/mzeevi/library/internal/data"
+	"github.com/mzeevi/library/internal/encryption"
+	"github.com/mzeevi/library/internal/events"
+	"github.com/mzeevi/library/internal/labels"
+	"github.com/mzeevi/library/internal/logging"
+	"github.com/mzeevi/library/internal/mailer"
+	"github.com/mzeevi/library/internal/notifier"
+	"github.com/mzeevi/library/internal/payments"
+	"github.com/mzeevi/library/internal/search"
+	"github.com/mzeevi/library/internal/secrets"
+	"github.com/mzeevi/library/internal/storage"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"golang.org/x/text/language"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/mail"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Providers of text messages.
+const (
+	smsProviderTwilio  = "twilio"
+	smsProviderWebhook = "webhook"
 )
 
 type Application struct {
@@ -17,12 +50,177 @@ type Application struct {
 	}
 	transactions data.Output
 	logger       *httplog.Logger
+	jwtSecret    *secrets.Secret
+	// redactor hides the credentials sent by clients from logs and error reports.
+	redactor *logging.Redactor
+
+	trustedProxies []*net.IPNet
+	// cors holds the origins, methods and headers which cross-origin requests may use.
+	cors cors.Options
+	// catalogCORS holds the options of the cross-origin requests to the public catalog, from any origin.
+	catalogCORS cors.Options
+	location    *time.Location
+	// collation is the locale by which text is sorted, or empty to sort it by its bytes.
+	collation string
+	// classification is the classification scheme of the call numbers of copies.
+	classification string
+	// labelLayout is the layout of the sheets of labels of copies.
+	labelLayout string
+	// booking holds the hours in which resources are reserved and the limits of reservations.
+	booking struct {
+		hours           booking.Hours
+		slot            time.Duration
+		maxDuration     time.Duration
+		horizonDays     int
+		maxReservations int
+	}
+
+	mailer   *mailer.Mailer
+	notifier *notifier.Notifier
+	events   *events.Dispatcher
+	// search is the search index of books, which is nil if books are searched in the database.
+	search *search.Client
+	// payments is the provider which fines are paid with online, which is nil if they are not.
+	payments payments.Provider
+	// passwords is the policy of the passwords which patrons and admins set.
+	passwords auth.PasswordPolicy
+	// files is the storage of the files attached to books, which is nil if files are not attached.
+	files storage.Store
+	// overdueReport holds the recipients and the day of the weekly overdue report.
+	overdueReport struct {
+		recipients []*mail.Address
+		weekday    time.Weekday
+	}
+	// reportTerms are the reporting windows which recur every year by their names, including the fiscal year.
+	reportTerms map[string]reportTerm
+	// listReads holds the read preference of the lists of operations with any of its tags.
+	listReads struct {
+		preference *readpref.ReadPref
+		tags       []string
+	}
+	// wg tracks background tasks, which are completed before the server shuts down.
+	wg sync.WaitGroup
+
+	errorReporting bool
 }
 
 // Setup populates the fields of the Application struct.
 func (app *Application) Setup(dbClient *mongo.Client, logger *httplog.Logger) error {
-	app.logger = logger
+	if err := app.setup(logger); err != nil {
+		return err
+	}
+
 	cfg := app.Config
+	if err := app.setupModels(dbClient, cfg.DB.Database, cfg.DB.BooksCollection, cfg.DB.PatronsCollection, cfg.DB.TransactionsCollection, cfg.DB.TokensCollection, cfg.DB.AdminsCollection, cfg.DB.CategoriesCollection, cfg.DB.PublishersCollection, cfg.DB.NotificationsCollection, cfg.DB.EventsCollection, cfg.DB.AvailabilityCollection, cfg.DB.KiosksCollection, cfg.DB.KioskRequestsCollection, cfg.DB.AuditCollection, cfg.DB.PaymentsCollection, cfg.DB.AcquisitionsCollection, cfg.DB.WithdrawalsCollection, cfg.DB.InventorySessionsCollection, cfg.DB.InventoryScansCollection, cfg.DB.SuggestionsCollection, cfg.DB.ResourcesCollection, cfg.DB.ReservationsCollection, cfg.DB.ProgramsCollection, cfg.DB.RegistrationsCollection, cfg.DB.AnnouncementsCollection, cfg.DB.SavedSearchesCollection, cfg.DB.DailyStatsCollection, app.Config.Encryption.Key); err != nil {
+		return fmt.Errorf("failed to setup models: %v", err)
+	}
+
+	app.setupEvents()
+
+	return nil
+}
+
+// SetupWithModels populates the fields of the Application struct, using the given models
+// instead of connecting to the database. It is used to test the handlers against in-memory models.
+func (app *Application) SetupWithModels(models data.Models, logger *httplog.Logger) error {
+	if err := app.setup(logger); err != nil {
+		return err
+	}
+
+	app.Models = models
+
+	if err := app.Models.Notifications.CreateIndexes(); err != nil {
+		return fmt.Errorf("failed to create index: %v", err)
+	}
+
+	if err := app.Models.Events.CreateIndexes(); err != nil {
+		return fmt.Errorf("failed to create index: %v", err)
+	}
+
+	if err := app.Models.Availability.CreateIndexes(); err != nil {
+		return fmt.Errorf("failed to create index: %v", err)
+	}
+
+	if err := app.Models.Kiosks.CreateIndexes(); err != nil {
+		return fmt.Errorf("failed to create index: %v", err)
+	}
+
+	if err := app.Models.KioskRequests.CreateUniqueIndex(); err != nil {
+		return fmt.Errorf("failed to create unique index: %v", err)
+	}
+
+	if err := app.Models.Audit.CreateIndexes(); err != nil {
+		return fmt.Errorf("failed to create index: %v", err)
+	}
+
+	if err := app.Models.Payments.CreateIndexes(); err != nil {
+		return fmt.Errorf("failed to create index: %v", err)
+	}
+
+	if err := app.Models.Acquisitions.CreateIndexes(); err != nil {
+		return fmt.Errorf("failed to create index: %v", err)
+	}
+
+	if err := app.Models.Withdrawals.CreateIndexes(); err != nil {
+		return fmt.Errorf("failed to create index: %v", err)
+	}
+
+	if err := app.Models.InventoryScans.CreateIndexes(); err != nil {
+		return fmt.Errorf("failed to create index: %v", err)
+	}
+
+	if err := app.Models.Suggestions.CreateIndexes(); err != nil {
+		return fmt.Errorf("failed to create index: %v", err)
+	}
+
+	if err := app.Models.Resources.CreateIndexes(); err != nil {
+		return fmt.Errorf("failed to create index: %v", err)
+	}
+
+	if err := app.Models.Reservations.CreateIndexes(); err != nil {
+		return fmt.Errorf("failed to create index: %v", err)
+	}
+
+	if err := app.Models.Programs.CreateIndexes(); err != nil {
+		return fmt.Errorf("failed to create index: %v", err)
+	}
+
+	if err := app.Models.Registrations.CreateIndexes(); err != nil {
+		return fmt.Errorf("failed to create index: %v", err)
+	}
+
+	if err := app.Models.Announcements.CreateIndexes(); err != nil {
+		return fmt.Errorf("failed to create index: %v", err)
+	}
+
+	if err := app.Models.SavedSearches.CreateIndexes(); err != nil {
+		return fmt.Errorf("failed to create index: %v", err)
+	}
+
+	if err := app.Models.DailyStats.CreateIndexes(); err != nil {
+		return fmt.Errorf("failed to create index: %v", err)
+	}
+
+	if err := app.setupCategories(); err != nil {
+		return fmt.Errorf("failed to create default categories: %v", err)
+	}
+
+	app.setupEvents()
+
+	return nil
+}
+
+// setup populates the fields of the Application struct which do not depend on the database.
+func (app *Application) setup(logger *httplog.Logger) error {
+	cfg := app.Config
+
+	// Logs are written through the redactor, so that the credentials which clients send in
+	// headers, query parameters and bodies are not written to them.
+	app.redactor = logging.NewRedactor(cfg.Log.RedactedHeaders, cfg.Log.RedactedFields)
+	app.logger = &httplog.Logger{
+		Logger:  slog.New(logging.NewRedactingHandler(logger.Handler(), app.redactor)),
+		Options: logger.Options,
+	}
 
 	if cfg.Output.Enabled {
 		if err := app.setupOutput(app.Config.Output.Format); err != nil {
@@ -34,13 +232,400 @@ func (app *Application) Setup(dbClient *mongo.Client, logger *httplog.Logger) er
 		return fmt.Errorf("failed to setup discounts: %v", err)
 	}
 
-	if err := app.setupModels(dbClient, cfg.DB.Database, cfg.DB.BooksCollection, cfg.DB.PatronsCollection, cfg.DB.TransactionsCollection, cfg.DB.TokensCollection, cfg.DB.AdminsCollection); err != nil {
-		return fmt.Errorf("failed to setup models: %v", err)
+	if err := app.setupErrorReporting(cfg.ErrorReporting.DSN, cfg.ErrorReporting.Environment); err != nil {
+		return err
+	}
+
+	if err := app.setupTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		return err
+	}
+
+	if err := app.setupCORS(); err != nil {
+		return err
+	}
+
+	if err := app.setupLocation(cfg.Timezone); err != nil {
+		return err
+	}
+
+	if err := app.setupCollation(cfg.Collation); err != nil {
+		return err
 	}
 
+	if err := app.setupListReads(); err != nil {
+		return err
+	}
+
+	if err := app.setupClassification(cfg.Classification); err != nil {
+		return err
+	}
+
+	if err := app.setupLabels(cfg.Labels.Layout); err != nil {
+		return err
+	}
+
+	if err := app.setupBooking(); err != nil {
+		return err
+	}
+
+	if err := app.setupMailer(); err != nil {
+		return fmt.Errorf("failed to setup mailer: %v", err)
+	}
+
+	if err := app.setupNotifier(); err != nil {
+		return fmt.Errorf("failed to setup notifier: %v", err)
+	}
+
+	if err := app.setupSecrets(); err != nil {
+		return fmt.Errorf("failed to setup secrets: %v", err)
+	}
+
+	if err := app.setupSearch(); err != nil {
+		return fmt.Errorf("failed to setup search: %v", err)
+	}
+
+	if err := app.setupOverdueReport(); err != nil {
+		return err
+	}
+
+	if err := app.setupReportTerms(); err != nil {
+		return err
+	}
+
+	if err := app.setupDailyStats(); err != nil {
+		return err
+	}
+
+	if err := app.setupRetention(); err != nil {
+		return err
+	}
+
+	if err := app.setupPayments(); err != nil {
+		return fmt.Errorf("failed to setup payments: %v", err)
+	}
+
+	if err := app.setupFiles(); err != nil {
+		return fmt.Errorf("failed to setup file storage: %v", err)
+	}
+
+	if err := app.setupPasswords(); err != nil {
+		return fmt.Errorf("failed to setup passwords: %v", err)
+	}
+
+	return nil
+}
+
+// setupLocation loads the timezone of the library. An empty timezone means UTC.
+func (app *Application) setupLocation(name string) error {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return fmt.Errorf("invalid timezone %q: %v", name, err)
+	}
+
+	app.location = loc
+
+	return nil
+}
+
+// setupCollation sets the locale by which text is sorted, in the form MongoDB expects, such as en_US.
+func (app *Application) setupCollation(locale string) error {
+	if locale == "" {
+		return nil
+	}
+
+	tag, err := language.Parse(strings.ReplaceAll(locale, "_", "-"))
+	if err != nil {
+		return fmt.Errorf("invalid collation %q: %v", locale, err)
+	}
+
+	app.collation = strings.ReplaceAll(tag.String(), "-", "_")
+
+	return nil
+}
+
+// setupClassification sets the classification scheme of call numbers. An empty scheme means Dewey.
+func (app *Application) setupClassification(scheme string) error {
+	if scheme == "" {
+		scheme = classification.Dewey
+	}
+
+	if !slices.Contains(classification.Schemes, scheme) {
+		return fmt.Errorf("invalid classification scheme %q: must be one of %v", scheme, classification.Schemes)
+	}
+
+	app.classification = scheme
+
+	return nil
+}
+
+// setupLabels sets the layout of the sheets of labels. An empty layout means the default layout.
+func (app *Application) setupLabels(layout string) error {
+	if layout == "" {
+		layout = labels.DefaultLayout
+	}
+
+	if _, ok := labels.Layouts[layout]; !ok {
+		return fmt.Errorf("invalid label layout %q: must be one of %v", layout, labels.LayoutNames())
+	}
+
+	app.labelLayout = layout
+
+	return nil
+}
+
+// setupBooking sets the hours and the limits of reservations of resources. Empty hours and zero
+// lengths mean the defaults, and a zero maximum of reservations means patrons have no maximum.
+func (app *Application) setupBooking() error {
+	cfg := app.Config.Booking
+
+	hours := booking.DefaultHours
+	if cfg.Opens != "" {
+		opens, err := booking.ParseTimeOfDay(cfg.Opens)
+		if err != nil {
+			return fmt.Errorf("invalid booking opening time: %v", err)
+		}
+		hours.Opens = opens
+	}
+	if cfg.Closes != "" {
+		closes, err := booking.ParseTimeOfDay(cfg.Closes)
+		if err != nil {
+			return fmt.Errorf("invalid booking closing time: %v", err)
+		}
+		hours.Closes = closes
+	}
+	if hours.Opens >= hours.Closes {
+		return fmt.Errorf("invalid booking hours: opening time %q must be before closing time %q", cfg.Opens, cfg.Closes)
+	}
+
+	slot := cmp.Or(cfg.Slot, booking.DefaultSlot)
+	maxDuration := cmp.Or(cfg.MaxDuration, booking.DefaultMaxDuration)
+	if slot < 0 || maxDuration < slot || maxDuration%slot != 0 {
+		return fmt.Errorf("invalid booking slot %v and maximum duration %v: the maximum duration must be a multiple of the slot", slot, maxDuration)
+	}
+
+	if cfg.HorizonDays < 0 || cfg.MaxReservations < 0 {
+		return fmt.Errorf("invalid booking horizon %d and maximum reservations %d: must not be negative", cfg.HorizonDays, cfg.MaxReservations)
+	}
+
+	app.booking.hours = hours
+	app.booking.slot = slot
+	app.booking.maxDuration = maxDuration
+	app.booking.horizonDays = cmp.Or(cfg.HorizonDays, booking.DefaultHorizonDays)
+	app.booking.maxReservations = cfg.MaxReservations
+
 	return nil
 }
 
+// setupMailer creates the mailer. Emails are logged instead of sent if no SMTP host is configured.
+func (app *Application) setupMailer() error {
+	cfg := app.Config.Mail
+
+	var sender mailer.Sender = mailer.LogSender{}
+	if cfg.Host != "" {
+		sender = &mailer.SMTPSender{
+			Host:     cfg.Host,
+			Port:     cfg.Port,
+			Username: cfg.Username,
+			Password: cfg.Password,
+			From:     cfg.Sender,
+		}
+	}
+
+	locale := cfg.Locale
+	if locale == "" {
+		locale = mailer.DefaultLocale
+	}
+
+	m, err := mailer.New(sender, locale)
+	if err != nil {
+		return err
+	}
+	app.mailer = m
+
+	return nil
+}
+
+// setupNotifier creates the notifier, which delivers notifications by email with the mailer
+// and by text message with the configured SMS provider. Text messages are logged instead of sent
+// if no provider is configured.
+func (app *Application) setupNotifier() error {
+	cfg := app.Config.SMS
+
+	var sender notifier.SMSSender
+	switch cfg.Provider {
+	case "":
+		sender = notifier.LogSender{}
+	case smsProviderTwilio:
+		if cfg.TwilioAccountSID == "" || cfg.TwilioAuthToken == "" || cfg.TwilioFrom == "" {
+			return errors.New("twilio requires an account SID, an auth token and a sender")
+		}
+		sender = &notifier.TwilioSender{AccountSID: cfg.TwilioAccountSID, AuthToken: cfg.TwilioAuthToken, From: cfg.TwilioFrom}
+	case smsProviderWebhook:
+		if cfg.WebhookURL == "" {
+			return errors.New("webhook requires a URL")
+		}
+		sender = &notifier.WebhookSender{URL: cfg.WebhookURL, Secret: cfg.WebhookSecret}
+	default:
+		return fmt.Errorf("unknown sms provider %q", cfg.Provider)
+	}
+
+	app.notifier = notifier.New(map[string]notifier.Channel{
+		notifier.Email: &notifier.EmailChannel{Mailer: app.mailer},
+		notifier.SMS:   &notifier.SMSChannel{Mailer: app.mailer, Sender: sender},
+	})
+
+	return nil
+}
+
+// setupPayments creates the configured payment provider. Fines are not paid online if no provider
+// is configured.
+func (app *Application) setupPayments() error {
+	cfg := app.Config.Payments
+
+	switch cfg.Provider {
+	case "":
+		app.payments = nil
+		return nil
+	case payments.Stripe:
+		if cfg.StripeSecretKey == "" {
+			return errors.New("stripe requires a secret key")
+		}
+		app.payments = &payments.StripeProvider{SecretKey: cfg.StripeSecretKey, WebhookSecret: cfg.WebhookSecret, Client: &http.Client{Timeout: webhookTimeout}}
+	case payments.Mock:
+		app.payments = &payments.MockProvider{WebhookSecret: cfg.WebhookSecret}
+	default:
+		return fmt.Errorf("unknown payment provider %q", cfg.Provider)
+	}
+
+	if cfg.WebhookSecret == "" {
+		return errors.New("payments require a webhook secret")
+	}
+	if cfg.SuccessURL == "" || cfg.CancelURL == "" {
+		return errors.New("payments require a success and a cancel URL")
+	}
+
+	return nil
+}
+
+// setupFiles creates the configured storage of the files attached to books. Files are not
+// attached to books if no storage is configured.
+func (app *Application) setupFiles() error {
+	cfg := app.Config.Files
+
+	switch cfg.Storage {
+	case "":
+		app.files = nil
+	case storage.Local:
+		if cfg.Dir == "" {
+			return errors.New("local storage requires a directory")
+		}
+		app.files = &storage.LocalStore{Dir: cfg.Dir}
+	case storage.S3:
+		if cfg.S3.Bucket == "" || cfg.S3.AccessKeyID == "" || cfg.S3.SecretAccessKey == "" {
+			return errors.New("s3 requires a bucket, an access key ID and a secret access key")
+		}
+		app.files = &storage.S3Store{
+			Bucket:          cfg.S3.Bucket,
+			Region:          cfg.S3.Region,
+			AccessKeyID:     cfg.S3.AccessKeyID,
+			SecretAccessKey: cfg.S3.SecretAccessKey,
+			Endpoint:        cfg.S3.Endpoint,
+			Client:          &http.Client{Timeout: fileTimeout},
+		}
+	default:
+		return fmt.Errorf("unknown file storage %q", cfg.Storage)
+	}
+
+	return nil
+}
+
+// setupPasswords creates the policy of the passwords and the hasher of new passwords and PINs.
+// A minimum length or a parameter of the hasher of 0 means the default one.
+func (app *Application) setupPasswords() error {
+	cfg := app.Config.Passwords
+
+	var hasher auth.Hasher
+	var err error
+	switch cfg.Hash {
+	case "", auth.Bcrypt:
+		hasher, err = auth.NewBcryptHasher(cmp.Or(cfg.BcryptCost, auth.DefaultBcryptCost))
+	case auth.Argon2id:
+		hasher, err = auth.NewArgon2idHasher(
+			cmp.Or(cfg.Argon2id.Memory, auth.DefaultArgon2idMemory),
+			cmp.Or(cfg.Argon2id.Iterations, auth.DefaultArgon2idIterations),
+			cmp.Or(cfg.Argon2id.Parallelism, auth.DefaultArgon2idParallelism),
+		)
+	default:
+		return fmt.Errorf("unknown password hash %q", cfg.Hash)
+	}
+	if err != nil {
+		return err
+	}
+	auth.SetHasher(hasher)
+
+	app.passwords = auth.PasswordPolicy{
+		MinLength:  cfg.MinLength,
+		DenyCommon: cfg.DenyCommon,
+	}
+	if app.passwords.MinLength == 0 {
+		app.passwords.MinLength = auth.DefaultMinPasswordLength
+	}
+
+	if cfg.CheckBreached {
+		url := cfg.BreachURL
+		if url == "" {
+			url = auth.DefaultPwnedPasswordsURL
+		}
+		app.passwords.Breaches = auth.PwnedPasswords{URL: url, Client: &http.Client{Timeout: breachTimeout}}
+	}
+
+	return nil
+}
+
+// setupEvents creates the dispatcher of the event outbox, and subscribes the event webhooks
+// and the notifications of patrons to it.
+func (app *Application) setupEvents() {
+	cfg := app.Config.Events
+
+	app.events = events.New(app.Models.Events, app.logger.Logger)
+
+	client := &http.Client{Timeout: webhookTimeout}
+	for _, url := range cfg.WebhookURLs {
+		app.events.Subscribe("webhook:"+url, events.Webhook(url, cfg.WebhookSecret, client))
+	}
+
+	if cfg.BorrowReceipts {
+		app.events.Subscribe("borrow-receipt", app.sendBorrowReceipt, data.EventBookBorrowed)
+	}
+
+	if app.search != nil {
+		app.events.Subscribe("search-index", app.indexBook,
+			data.EventBookCreated, data.EventBookUpdated, data.EventBookDeleted, data.EventBookBorrowed, data.EventBookReturned)
+	}
+}
+
+// setupSearch creates the search index of books if an OpenSearch URL is configured.
+func (app *Application) setupSearch() error {
+	cfg := app.Config.Search
+	if cfg.URL == "" {
+		return nil
+	}
+
+	app.search = &search.Client{
+		URL:      cfg.URL,
+		Index:    cfg.Index,
+		Username: cfg.Username,
+		Password: cfg.Password,
+		Analyzer: cfg.Analyzer,
+		Client:   &http.Client{Timeout: timeout},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return app.search.CreateIndex(ctx)
+}
+
 // setupCost populates the discount fields inside the app struct.
 func (app *Application) setupCost(studentDiscountPercent, teacherDiscountPercent, overdueFine float64) error {
 	if studentDiscountPercent < 0 || studentDiscountPercent > 100 {
@@ -53,8 +638,8 @@ func (app *Application) setupCost(studentDiscountPercent, teacherDiscountPercent
 
 	app.cost.overdueFine = overdueFine
 	app.cost.discounts = map[string]float64{
-		studentCategory: studentDiscountPercent,
-		teacherCategory: teacherDiscountPercent,
+		data.StudentCategory: studentDiscountPercent,
+		data.TeacherCategory: teacherDiscountPercent,
 	}
 
 	return nil
@@ -62,35 +647,95 @@ func (app *Application) setupCost(studentDiscountPercent, teacherDiscountPercent
 
 // setupOutput populates the transaction fields inside the app struct.
 func (app *Application) setupOutput(format string) error {
-	switch data.OutputType(format) {
-	case data.CSVOutputFormat:
-		app.transactions = &data.CSVTransactionOutput{}
-	case data.XLSMOutputFormat:
-		app.transactions = &data.ExcelTransactionOutput{}
-	case data.EXLAMOutputFormat:
-		app.transactions = &data.ExcelTransactionOutput{}
-	case data.XLSXOutputFormat:
-		app.transactions = &data.ExcelTransactionOutput{}
-	case data.XLTMOutputFormat:
-		app.transactions = &data.ExcelTransactionOutput{}
-	case data.XLTXOutputFormat:
-		app.transactions = &data.ExcelTransactionOutput{}
-	default:
-		return fmt.Errorf("unsupported output format")
+	output, err := data.NewOutput(data.OutputType(format))
+	if err != nil {
+		return err
+	}
+	app.transactions = output
+
+	return nil
+}
+
+// setupSecrets loads the secrets used by the app and, if configured,
+// periodically reloads them so that rotated secrets are picked up without a restart.
+func (app *Application) setupSecrets() error {
+	cfg := app.Config
+	vault := secrets.Vault{Address: cfg.Secrets.VaultAddress, Token: cfg.Secrets.VaultToken}
+
+	jwtSecret, err := secrets.New(context.Background(), secrets.NewSource(cfg.JTW.Secret, cfg.JTW.SecretFile, cfg.JTW.SecretVaultPath, vault))
+	if err != nil {
+		return fmt.Errorf("failed to load jwt secret: %v", err)
+	}
+	app.jwtSecret = jwtSecret
+
+	if cfg.Encryption.KeyFile != "" {
+		key, err := secrets.Resolve(context.Background(), secrets.FileSource{Path: cfg.Encryption.KeyFile})
+		if err != nil {
+			return fmt.Errorf("failed to load encryption key: %v", err)
+		}
+		app.Config.Encryption.Key = key
+	}
+
+	if cfg.Secrets.RefreshInterval > 0 {
+		go app.jwtSecret.Watch(context.Background(), cfg.Secrets.RefreshInterval, func(changed bool, err error) {
+			switch {
+			case err != nil:
+				app.logger.Error("failed to refresh jwt secret", slog.Any("error", err))
+			case changed:
+				app.logger.Info("jwt secret rotated")
+			}
+		})
 	}
 
 	return nil
 }
 
 // setupModels populates the model fields inside the app struct.
-func (app *Application) setupModels(dbClient *mongo.Client, dbName, booksCollection, patronsCollection, transactionCollection, tokenCollection, adminCollection string) error {
+func (app *Application) setupModels(dbClient *mongo.Client, dbName, booksCollection, patronsCollection, transactionCollection, tokenCollection, adminCollection, categoryCollection, publisherCollection, notificationCollection, eventCollection, availabilityCollection, kioskCollection, kioskRequestCollection, auditCollection, paymentCollection, acquisitionCollection, withdrawalCollection, inventorySessionCollection, inventoryScanCollection, suggestionCollection, resourceCollection, reservationCollection, programCollection, registrationCollection, announcementCollection, savedSearchCollection, dailyStatsCollection, encryptionKey string) error {
+	var cipher *encryption.Cipher
+	if encryptionKey != "" {
+		var err error
+		if cipher, err = encryption.NewCipherFromString(encryptionKey); err != nil {
+			return fmt.Errorf("failed to setup encryption: %v", err)
+		}
+	}
+
 	app.Models = data.NewModels(dbClient, dbName, map[string]string{
-		data.BooksCollectionKey:        booksCollection,
-		data.PatronsCollectionKey:      patronsCollection,
-		data.TransactionsCollectionKey: transactionCollection,
-		data.TokensCollectionKey:       tokenCollection,
-		data.AdminsCollectionKey:       adminCollection,
-	})
+		data.BooksCollectionKey:             booksCollection,
+		data.PatronsCollectionKey:           patronsCollection,
+		data.TransactionsCollectionKey:      transactionCollection,
+		data.TokensCollectionKey:            tokenCollection,
+		data.AdminsCollectionKey:            adminCollection,
+		data.CategoriesCollectionKey:        categoryCollection,
+		data.PublishersCollectionKey:        publisherCollection,
+		data.NotificationsCollectionKey:     notificationCollection,
+		data.EventsCollectionKey:            eventCollection,
+		data.AvailabilityCollectionKey:      availabilityCollection,
+		data.KiosksCollectionKey:            kioskCollection,
+		data.KioskRequestsCollectionKey:     kioskRequestCollection,
+		data.AuditCollectionKey:             auditCollection,
+		data.PaymentsCollectionKey:          paymentCollection,
+		data.AcquisitionsCollectionKey:      acquisitionCollection,
+		data.WithdrawalsCollectionKey:       withdrawalCollection,
+		data.InventorySessionsCollectionKey: inventorySessionCollection,
+		data.InventoryScansCollectionKey:    inventoryScanCollection,
+		data.SuggestionsCollectionKey:       suggestionCollection,
+		data.ResourcesCollectionKey:         resourceCollection,
+		data.ReservationsCollectionKey:      reservationCollection,
+		data.ProgramsCollectionKey:          programCollection,
+		data.RegistrationsCollectionKey:     registrationCollection,
+		data.AnnouncementsCollectionKey:     announcementCollection,
+		data.SavedSearchesCollectionKey:     savedSearchCollection,
+		data.DailyStatsCollectionKey:        dailyStatsCollection,
+	}, cipher)
+
+	if app.Config.DB.IndexHints {
+		app.Models = app.Models.WithIndexHints()
+	}
+
+	if app.Config.DB.SkipIndexes {
+		return nil
+	}
 
 	if err := app.Models.Books.CreateUniqueIndex(); err != nil {
 		return fmt.Errorf("failed to create unique index: %v", err)
@@ -100,5 +745,112 @@ func (app *Application) setupModels(dbClient *mongo.Client, dbName, booksCollect
 		return fmt.Errorf("failed to create unique index: %v", err)
 	}
 
+	deleted, err := app.Models.Admins.DeleteDuplicates(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to delete duplicate admins: %v", err)
+	}
+	if deleted > 0 {
+		app.logger.Warn("deleted duplicate admins", slog.Int64("count", deleted))
+	}
+
+	if err := app.Models.Admins.CreateUniqueIndex(); err != nil {
+		return fmt.Errorf("failed to create unique index: %v", err)
+	}
+
+	if err := app.Models.Categories.CreateUniqueIndex(); err != nil {
+		return fmt.Errorf("failed to create unique index: %v", err)
+	}
+
+	if err := app.Models.Publishers.CreateUniqueIndex(); err != nil {
+		return fmt.Errorf("failed to create unique index: %v", err)
+	}
+
+	if err := app.Models.Notifications.CreateIndexes(); err != nil {
+		return fmt.Errorf("failed to create index: %v", err)
+	}
+
+	if err := app.Models.Events.CreateIndexes(); err != nil {
+		return fmt.Errorf("failed to create index: %v", err)
+	}
+
+	if err := app.Models.Availability.CreateIndexes(); err != nil {
+		return fmt.Errorf("failed to create index: %v", err)
+	}
+
+	if err := app.Models.Kiosks.CreateIndexes(); err != nil {
+		return fmt.Errorf("failed to create index: %v", err)
+	}
+
+	if err := app.Models.KioskRequests.CreateUniqueIndex(); err != nil {
+		return fmt.Errorf("failed to create unique index: %v", err)
+	}
+
+	if err := app.Models.Audit.CreateIndexes(); err != nil {
+		return fmt.Errorf("failed to create index: %v", err)
+	}
+
+	if err := app.Models.Payments.CreateIndexes(); err != nil {
+		return fmt.Errorf("failed to create index: %v", err)
+	}
+
+	if err := app.Models.Acquisitions.CreateIndexes(); err != nil {
+		return fmt.Errorf("failed to create index: %v", err)
+	}
+
+	if err := app.Models.Withdrawals.CreateIndexes(); err != nil {
+		return fmt.Errorf("failed to create index: %v", err)
+	}
+
+	if err := app.Models.InventoryScans.CreateIndexes(); err != nil {
+		return fmt.Errorf("failed to create index: %v", err)
+	}
+
+	if err := app.Models.Suggestions.CreateIndexes(); err != nil {
+		return fmt.Errorf("failed to create index: %v", err)
+	}
+
+	if err := app.Models.Resources.CreateIndexes(); err != nil {
+		return fmt.Errorf("failed to create index: %v", err)
+	}
+
+	if err := app.Models.Reservations.CreateIndexes(); err != nil {
+		return fmt.Errorf("failed to create index: %v", err)
+	}
+
+	if err := app.Models.Programs.CreateIndexes(); err != nil {
+		return fmt.Errorf("failed to create index: %v", err)
+	}
+
+	if err := app.Models.Registrations.CreateIndexes(); err != nil {
+		return fmt.Errorf("failed to create index: %v", err)
+	}
+
+	if err := app.Models.Announcements.CreateIndexes(); err != nil {
+		return fmt.Errorf("failed to create index: %v", err)
+	}
+
+	if err := app.Models.SavedSearches.CreateIndexes(); err != nil {
+		return fmt.Errorf("failed to create index: %v", err)
+	}
+
+	if err := app.Models.DailyStats.CreateIndexes(); err != nil {
+		return fmt.Errorf("failed to create index: %v", err)
+	}
+
+	if err := app.setupCategories(); err != nil {
+		return fmt.Errorf("failed to create default categories: %v", err)
+	}
+
 	return nil
 }
+
+// setupCategories creates the default student and teacher categories if they do not exist yet.
+func (app *Application) setupCategories() error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return app.Models.Categories.EnsureDefaults(ctx, []*data.Category{
+		data.NewCategory("", data.StudentCategory, app.cost.discounts[data.StudentCategory], data.LoanPolicy{MaxBorrowedBooks: 5, LoanPeriodDays: 14}),
+		data.NewCategory("", data.TeacherCategory, app.cost.discounts[data.TeacherCategory], data.LoanPolicy{MaxBorrowedBooks: 10, LoanPeriodDays: 28}),
+	})
+}
@@ -0,0 +1,235 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/mzeevi/library/internal/atom"
+	"github.com/mzeevi/library/internal/data"
+	"github.com/mzeevi/library/internal/query"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultNewArrivalsPeriod is how long books are new arrivals for if the period isn't given.
+	defaultNewArrivalsPeriod = 30 * 24 * time.Hour
+	// maxFeedEntries is the maximum number of books in a feed, which are the latest ones.
+	maxFeedEntries = 50
+	// newArrivalsSort sorts books from the most recently added.
+	newArrivalsSort = "-created_at"
+	// feedCacheControl lets feed readers and shared caches keep feeds for 15 minutes.
+	feedCacheControl = "public, max-age=900"
+	// genreFeedExt is the extension of the paths of the genre feeds.
+	genreFeedExt = ".xml"
+)
+
+type GetNewArrivalsInput struct {
+	PaginationInput
+	Since query.Period `query:"since" doc:"How far back books were added, 30d by default"`
+}
+
+type GetNewArrivalsFeedInput struct {
+	ConditionalInput
+	Since query.Period `query:"since" doc:"How far back books were added, 30d by default"`
+	host  string
+}
+
+type GetGenreFeedInput struct {
+	ConditionalInput
+	Genre string       `path:"genre" maxLength:"100" doc:"Genre of the books, such as Fiction"`
+	Since query.Period `query:"since" doc:"How far back books were added, 30d by default"`
+	host  string
+}
+
+// Resolve keeps the host of the request, by which the links of the feed are made.
+func (f *GetNewArrivalsFeedInput) Resolve(ctx huma.Context) []error {
+	f.host = ctx.Host()
+
+	return nil
+}
+
+// Resolve keeps the host of the request, by which the links of the feed are made.
+func (f *GetGenreFeedInput) Resolve(ctx huma.Context) []error {
+	f.host = ctx.Host()
+
+	return nil
+}
+
+type FeedOutput struct {
+	CacheValidators
+	ContentType  string `header:"Content-Type"`
+	CacheControl string `header:"Cache-Control"`
+	Body         []byte
+}
+
+// newArrivalsFilter returns the filter of the books which were added within since, or within the
+// default period if it was not given.
+func newArrivalsFilter(since query.Period) data.BookFilter {
+	start := since.Start()
+	if start == nil {
+		start = ptr(time.Now().Add(-defaultNewArrivalsPeriod))
+	}
+
+	return data.BookFilter{MinCreatedAt: start}
+}
+
+// feedURL returns the URL of a path of the API at the host of a request.
+func feedURL(host string, elem ...string) string {
+	return fmt.Sprintf("http://%s%s/%s", host, basePath, strings.Join(elem, "/"))
+}
+
+// booksFeed returns an Atom feed of the latest books matching filter, which is updated when the
+// latest of them was. Each entry links to the book in the public catalog.
+func (app *Application) booksFeed(ctx context.Context, host, title, link string, filter data.BookFilter) (*atom.Feed, error) {
+	books, _, err := app.Models.Books.GetAll(ctx, filter, data.Paginator{Page: 1, PageSize: maxFeedEntries}, data.Sorter{Field: newArrivalsSort, SortSafelist: []string{newArrivalsSort}})
+	if err != nil {
+		return nil, err
+	}
+
+	feed := &atom.Feed{
+		ID:     link,
+		Title:  title,
+		Link:   link,
+		Author: app.Config.Name,
+	}
+
+	for _, book := range books {
+		bookURL := feedURL(host, catalogKey, booksKey, book.ID)
+
+		var summary []string
+		if len(book.Publishers) > 0 {
+			summary = append(summary, strings.Join(book.Publishers, ", "))
+		}
+		if !book.PublishedAt.IsZero() {
+			summary = append(summary, book.PublishedAt.Format("2006"))
+		}
+
+		feed.Entries = append(feed.Entries, atom.Entry{
+			ID:         bookURL,
+			Title:      book.Title,
+			Link:       bookURL,
+			Authors:    book.Authors,
+			Summary:    strings.Join(summary, ", "),
+			Categories: book.Genres,
+			Published:  book.CreatedAt,
+			Updated:    book.UpdatedAt,
+		})
+		if book.UpdatedAt.After(feed.Updated) {
+			feed.Updated = book.UpdatedAt
+		}
+	}
+
+	return feed, nil
+}
+
+// feedVersion returns the version of feed, hashed from its entries, so that it changes when books
+// are added to it, updated or drop out of it.
+func feedVersion(feed *atom.Feed) string {
+	values := []any{feed.Title}
+	for _, entry := range feed.Entries {
+		values = append(values, entry.ID, entry.Updated.UnixNano())
+	}
+
+	return versionOf(values...)
+}
+
+// feedOutput encodes feed with the validators of its version, by which feed readers revalidate
+// it. A feed without entries has no modification time, and is updated now.
+func feedOutput(feed *atom.Feed, version string) (*FeedOutput, error) {
+	validators := newCacheValidators(version, feed.Updated)
+	if feed.Updated.IsZero() {
+		feed.Updated = time.Now()
+	}
+
+	var b bytes.Buffer
+	if err := feed.Encode(&b); err != nil {
+		return nil, err
+	}
+
+	resp := &FeedOutput{
+		CacheValidators: validators,
+		ContentType:     atom.ContentType,
+		CacheControl:    feedCacheControl,
+		Body:            b.Bytes(),
+	}
+
+	return resp, nil
+}
+
+// getNewArrivalsHandler fetches the books which were added recently, from the most recently added.
+func (app *Application) getNewArrivalsHandler(ctx context.Context, input *GetNewArrivalsInput) (*GetBooksOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	paginator := data.Paginator{Page: input.Page, PageSize: input.PageSize}
+	sorter := data.Sorter{Field: newArrivalsSort, SortSafelist: []string{newArrivalsSort}}
+
+	books, metadata, err := app.Models.Books.GetAll(ctx, newArrivalsFilter(input.Since), paginator, sorter)
+	if err != nil {
+		return &GetBooksOutput{}, app.serverError(ctx, err)
+	}
+
+	resp := &GetBooksOutput{
+		Body: BooksInfo{
+			Books:    books,
+			Metadata: metadata,
+		},
+	}
+
+	return resp, nil
+}
+
+// getNewArrivalsFeedHandler handles an anonymous request to get the Atom feed of the books which
+// were added recently, which feed readers subscribe to.
+func (app *Application) getNewArrivalsFeedHandler(ctx context.Context, input *GetNewArrivalsFeedInput) (*FeedOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	feed, err := app.booksFeed(ctx, input.host, fmt.Sprintf("New arrivals at %s", app.Config.Name), feedURL(input.host, booksKey, arrivalsFeedKey), newArrivalsFilter(input.Since))
+	if err != nil {
+		return &FeedOutput{}, app.serverError(ctx, err)
+	}
+
+	version := feedVersion(feed)
+	if err = input.notModified(version, feed.Updated); err != nil {
+		return &FeedOutput{}, err
+	}
+
+	resp, err := feedOutput(feed, version)
+	if err != nil {
+		return &FeedOutput{}, app.serverError(ctx, err)
+	}
+
+	return resp, nil
+}
+
+// getGenreFeedHandler handles an anonymous request to get the Atom feed of the books of a genre
+// which were added recently, so that patrons follow the sections of the collection they read.
+func (app *Application) getGenreFeedHandler(ctx context.Context, input *GetGenreFeedInput) (*FeedOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	filter := newArrivalsFilter(input.Since)
+	filter.Genres = []string{input.Genre}
+
+	link := feedURL(input.host, feedsKey, genresKey, url.PathEscape(input.Genre)+genreFeedExt)
+	feed, err := app.booksFeed(ctx, input.host, fmt.Sprintf("New %s at %s", input.Genre, app.Config.Name), link, filter)
+	if err != nil {
+		return &FeedOutput{}, app.serverError(ctx, err)
+	}
+
+	version := feedVersion(feed)
+	if err = input.notModified(version, feed.Updated); err != nil {
+		return &FeedOutput{}, err
+	}
+
+	resp, err := feedOutput(feed, version)
+	if err != nil {
+		return &FeedOutput{}, app.serverError(ctx, err)
+	}
+
+	return resp, nil
+}
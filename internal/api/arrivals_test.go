@@ -0,0 +1,144 @@
+package api_test
+
+import (
+	"github.com/mzeevi/library/internal/api"
+	"github.com/mzeevi/library/internal/api/apitest"
+	"github.com/mzeevi/library/internal/auth"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewArrivals(t *testing.T) {
+	a := apitest.New(t, func(app *api.Application) {
+		app.Config.Name = "Town Library"
+	})
+
+	first := apitest.Book("9780306406157", 1)
+	first.Title = "First Arrival"
+	firstID := a.SeedBook(first)
+	// Books added within the same millisecond have the same time they were added.
+	time.Sleep(2 * time.Millisecond)
+	second := apitest.Book("9781861972712", 1)
+	second.Title = "Second Arrival"
+	secondID := a.SeedBook(second)
+
+	patron := a.PatronAuth(a.SeedPatron(apitest.Patron("patron@example.com", auth.ReadBooksPermission)))
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{query: "", want: []string{secondID, firstID}},
+		{query: "?since=1h", want: []string{secondID, firstID}},
+		{query: "?since=0h"},
+	}
+
+	for _, tt := range tests {
+		rec := a.Do(http.MethodGet, "/books/new-arrivals"+tt.query, patron)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET /books/new-arrivals%s status = %v; want %v (body: %s)", tt.query, rec.Code, http.StatusOK, rec.Body.String())
+		}
+
+		var body api.BooksInfo
+		a.Decode(rec, &body)
+		var got []string
+		for _, book := range body.Books {
+			got = append(got, book.ID)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("GET /books/new-arrivals%s = %v; want %v", tt.query, got, tt.want)
+		}
+	}
+
+	if rec := a.Do(http.MethodGet, "/books/new-arrivals?since=-30d", patron); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("GET /books/new-arrivals with a negative period status = %v; want %v", rec.Code, http.StatusUnprocessableEntity)
+	}
+	if rec := a.Do(http.MethodGet, "/books/new-arrivals"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("GET /books/new-arrivals anonymously status = %v; want %v", rec.Code, http.StatusUnauthorized)
+	}
+
+	// The feed is read anonymously by feed readers.
+	rec := a.Do(http.MethodGet, "/books/new-arrivals.atom?since=1h")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /books/new-arrivals.atom status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/atom+xml; charset=utf-8" {
+		t.Errorf("feed content type = %q; want an Atom feed", got)
+	}
+
+	feed := rec.Body.String()
+	for _, want := range []string{
+		"<title>New arrivals at Town Library</title>",
+		"<title>Second Arrival</title>",
+		"/catalog/books/" + firstID + `"></link>`,
+		"<name>Test Author</name>",
+		`<category term="Fiction"></category>`,
+	} {
+		if !strings.Contains(feed, want) {
+			t.Errorf("feed = %s; want it to contain %q", feed, want)
+		}
+	}
+	if strings.Index(feed, "Second Arrival") > strings.Index(feed, "First Arrival") {
+		t.Errorf("feed = %s; want the most recently added book first", feed)
+	}
+}
+
+func TestGenreFeed(t *testing.T) {
+	a := apitest.New(t)
+
+	fiction := apitest.Book("9780306406157", 1)
+	fiction.Title = "Fiction Book"
+	a.SeedBook(fiction)
+	scienceFiction := apitest.Book("9781861972712", 1)
+	scienceFiction.Title = "Science Fiction Book"
+	scienceFiction.Genres = []string{"Science Fiction"}
+	a.SeedBook(scienceFiction)
+
+	path := "/feeds/genres/Science%20Fiction.xml"
+	rec := a.Do(http.MethodGet, path)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET %s status = %v; want %v (body: %s)", path, rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if got := rec.Header().Get("Cache-Control"); got != "public, max-age=900" {
+		t.Errorf("GET %s Cache-Control = %q; want it to be cached publicly", path, got)
+	}
+
+	feed := rec.Body.String()
+	if !strings.Contains(feed, "<title>Science Fiction Book</title>") || strings.Contains(feed, "<title>Fiction Book</title>") {
+		t.Errorf("feed = %s; want only the science fiction book", feed)
+	}
+	if !strings.Contains(feed, "/feeds/genres/Science%20Fiction.xml") {
+		t.Errorf("feed = %s; want it to link to itself", feed)
+	}
+
+	etag, lastModified := rec.Header().Get("ETag"), rec.Header().Get("Last-Modified")
+	if etag == "" || lastModified == "" {
+		t.Fatalf("GET %s ETag = %q, Last-Modified = %q; want both", path, etag, lastModified)
+	}
+	if rec := a.Do(http.MethodGet, path, "If-None-Match: "+etag); rec.Code != http.StatusNotModified {
+		t.Errorf("GET %s with its ETag status = %v; want %v", path, rec.Code, http.StatusNotModified)
+	}
+	if rec := a.Do(http.MethodGet, path, "If-Modified-Since: "+lastModified); rec.Code != http.StatusNotModified {
+		t.Errorf("GET %s with its Last-Modified status = %v; want %v", path, rec.Code, http.StatusNotModified)
+	}
+
+	// A new book in the genre changes the feed.
+	another := apitest.Book("9780262033848", 1)
+	another.Genres = []string{"Science Fiction"}
+	a.SeedBook(another)
+	if rec := a.Do(http.MethodGet, path, "If-None-Match: "+etag); rec.Code != http.StatusOK {
+		t.Errorf("GET %s with its old ETag after a book was added status = %v; want %v", path, rec.Code, http.StatusOK)
+	}
+
+	// A genre without books has an empty feed, without a modification time.
+	rec = a.Do(http.MethodGet, "/feeds/genres/Poetry.xml")
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), "<entry>") {
+		t.Errorf("GET the feed of a genre without books status = %v, body = %s; want an empty feed", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("Last-Modified"); got != "" {
+		t.Errorf("empty feed Last-Modified = %q; want none", got)
+	}
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"context"
+	"github.com/mzeevi/library/internal/data"
+)
+
+type GetAuditLogInput struct {
+	PaginationInput
+	Action   string `query:"action" enum:"transaction.force_returned,transaction.canceled,fine.waived,fine.adjusted,payment.recorded" doc:"Filter by action"`
+	Actor    string `query:"actor" doc:"Filter by the name of the admin who made the correction"`
+	TargetID string `query:"target_id" doc:"Filter by the ID of the corrected resource"`
+	Sort     string `query:"sort" enum:"created_at,-created_at" default:"-created_at"`
+}
+
+type GetAuditLogOutput struct {
+	Body AuditLogInfo
+}
+
+type AuditLogInfo struct {
+	Entries  []data.AuditEntry `json:"entries"`
+	Metadata data.Metadata     `json:"metadata"`
+}
+
+// audit records a correction which the authenticated admin made to targetID in the audit log, with
+// the code of its reason if it has one. It should be called within the database transaction of the
+// correction.
+func (app *Application) audit(ctx context.Context, action, targetID, code, reason string, details map[string]any) error {
+	var actor string
+	if admin, ok := adminFromContext(ctx); ok {
+		actor = admin.Name
+	}
+
+	_, err := app.Models.Audit.Insert(ctx, data.NewAuditEntry(action, actor, targetID, code, reason, details))
+
+	return err
+}
+
+// getAuditLogHandler handles a request to fetch the entries of the audit log with pagination and sorting.
+func (app *Application) getAuditLogHandler(ctx context.Context, input *GetAuditLogInput) (*GetAuditLogOutput, error) {
+	paginator := data.Paginator{Page: input.Page, PageSize: input.PageSize}
+	sorter := data.Sorter{Field: input.Sort, SortSafelist: supportedAuditSortFields, Collation: app.collation}
+
+	filter := data.AuditFilter{}
+	if input.Action != "" {
+		filter.Action = &input.Action
+	}
+	if input.Actor != "" {
+		filter.Actor = &input.Actor
+	}
+	if input.TargetID != "" {
+		filter.TargetID = &input.TargetID
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	entries, metadata, err := app.Models.Audit.GetAll(ctx, filter, paginator, sorter)
+	if err != nil {
+		return &GetAuditLogOutput{}, app.serverError(ctx, err)
+	}
+
+	resp := &GetAuditLogOutput{
+		Body: AuditLogInfo{
+			Entries:  entries,
+			Metadata: metadata,
+		},
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/mzeevi/library/internal/data"
+	"log/slog"
+	"time"
+)
+
+// availabilityRetryInterval is the delay before watching changes again after the watch failed.
+const availabilityRetryInterval = 10 * time.Second
+
+type GetBookAvailabilityInput struct {
+	ID data.BookID `json:"id" path:"id"`
+}
+
+type GetBookAvailabilityOutput struct {
+	Body data.BookAvailability `json:"availability"`
+}
+
+type GetAvailabilityInput struct {
+	PaginationInput
+	Available string `query:"available" enum:"true,false" doc:"Only books with an available copy if true, or only books with no available copy if false"`
+	Sort      string `query:"sort" enum:"active_loans,-active_loans,total_loans,-total_loans,available_copies,-available_copies,last_borrowed_at,-last_borrowed_at" default:"-active_loans"`
+}
+
+type GetAvailabilityOutput struct {
+	Body AvailabilityInfo
+}
+
+type AvailabilityInfo struct {
+	Availability []data.BookAvailability `json:"availability"`
+	Metadata     data.Metadata           `json:"metadata"`
+}
+
+// Resolve validates the input in GetBookAvailabilityInput.
+func (b *GetBookAvailabilityInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	err := validateID(&b.ID, "path.id")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// watchAvailability keeps the availability of books up to date until ctx is canceled. Watching
+// is retried after a failure, such as a lost connection, and rebuilds the availability when it resumes.
+func (app *Application) watchAvailability(ctx context.Context) {
+	for {
+		err := app.Models.Availability.Watch(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		app.logger.Error("failed to watch availability of books", slog.Any("error", err))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(availabilityRetryInterval):
+		}
+	}
+}
+
+// getBookAvailabilityHandler handles a request to get the availability of a book.
+func (app *Application) getBookAvailabilityHandler(ctx context.Context, input *GetBookAvailabilityInput) (*GetBookAvailabilityOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	availability, err := app.Models.Availability.Get(ctx, string(input.ID))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return &GetBookAvailabilityOutput{}, huma.Error404NotFound(errNotFoundMsg)
+		default:
+			return &GetBookAvailabilityOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	return &GetBookAvailabilityOutput{Body: *availability}, nil
+}
+
+// getAvailabilityHandler handles a request to list the availability of books, such as the most borrowed ones.
+func (app *Application) getAvailabilityHandler(ctx context.Context, input *GetAvailabilityInput) (*GetAvailabilityOutput, error) {
+	paginator := data.Paginator{Page: input.Page, PageSize: input.PageSize}
+	sorter := data.Sorter{Field: input.Sort, SortSafelist: supportedAvailabilitySortFields, Collation: app.collation}
+
+	filter := data.AvailabilityFilter{}
+	if input.Available != "" {
+		filter.Available = ptr(input.Available == "true")
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	availability, metadata, err := app.Models.Availability.GetAll(ctx, filter, paginator, sorter)
+	if err != nil {
+		return &GetAvailabilityOutput{}, app.serverError(ctx, err)
+	}
+
+	resp := &GetAvailabilityOutput{
+		Body: AvailabilityInfo{
+			Availability: availability,
+			Metadata:     metadata,
+		},
+	}
+
+	return resp, nil
+}
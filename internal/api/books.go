@@ -5,21 +5,32 @@ import (
 	"errors"
 	"fmt"
 	"github.com/danielgtaylor/huma/v2"
+	"github.com/mzeevi/library/internal/classification"
 	"github.com/mzeevi/library/internal/data"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 )
 
+const (
+	errIdentifierAlreadyExistsMsg = "a book with one of these identifiers already exists"
+)
+
 type GetBookInput struct {
-	ID string `json:"id" path:"id"`
+	ConditionalInput
+	ID data.BookID `json:"id" path:"id"`
 }
 
 type GetBookOutput struct {
+	CacheValidators
 	Body data.Book
 }
 
 type GetBooksInput struct {
 	PaginationInput
-	Sort string `json:"sort,omitempty" query:"sort" enum:"id,pages,edition,copies,borrowedCopies,publishedAt,title,isbn,-id,-pages,-edition,-copies,-borrowedCopies,-publishedAt,-title,-isbn"`
+	IDs  []string `json:"ids,omitempty" query:"ids" maxItems:"100" doc:"Only the books with these IDs, such as to resolve the references in a list in one request"`
+	Sort string   `json:"sort,omitempty" query:"sort" enum:"id,pages,edition,copies,borrowedCopies,publishedAt,title,popularity,-id,-pages,-edition,-copies,-borrowedCopies,-publishedAt,-title,-popularity"`
 }
 
 type GetBooksOutput struct {
@@ -31,17 +42,34 @@ type BooksInfo struct {
 	Metadata data.Metadata `json:"metadata"`
 }
 
+// IdentifierInput is an identifier of a book, such as its ISBN-13, in a request.
+type IdentifierInput struct {
+	Type  string `json:"type" enum:"isbn13,isbn10,eisbn,oclc,lccn"`
+	Value string `json:"value" minLength:"1" maxLength:"50"`
+}
+
+// HoldingInput is the call number and the shelf location of a copy of a book, in a request.
+type HoldingInput struct {
+	Copy          int    `json:"copy" minimum:"1" doc:"Number of the copy, from 1 to the copies of the book"`
+	CallNumber    string `json:"call_number,omitempty" maxLength:"100" doc:"Call number of the copy in the classification scheme of the library, such as 823.914 ROW"`
+	ShelfLocation string `json:"shelf_location,omitempty" maxLength:"100" doc:"Where the copy is shelved, such as Main Hall, Shelf 3"`
+}
+
 type CreateBookInput struct {
 	Body struct {
-		Pages       int       `json:"pages" minimum:"1"`
-		Edition     int       `json:"edition" minimum:"1"`
-		Copies      int       `json:"copies" minimum:"1"`
-		PublishedAt time.Time `json:"published_at" format:"date-time"`
-		Title       string    `json:"title" minLength:"1"`
-		ISBN        string    `json:"isbn" minLength:"13" maxLength:"13"`
-		Authors     []string  `json:"authors" minItems:"1" uniqueItems:"true"`
-		Publishers  []string  `json:"publishers" minItems:"1" uniqueItems:"true"`
-		Genres      []string  `json:"genres" minItems:"1" uniqueItems:"true"`
+		Pages       int               `json:"pages" minimum:"1"`
+		Edition     int               `json:"edition" minimum:"1"`
+		Copies      int               `json:"copies" minimum:"1"`
+		PublishedAt time.Time         `json:"published_at" format:"date-time"`
+		Title       string            `json:"title" minLength:"1"`
+		Identifiers []IdentifierInput `json:"identifiers" minItems:"1" doc:"Identifiers of the book, at most one of each type, such as its ISBN-13, ISBN-10 and e-ISBN"`
+		ExternalIDs map[string]string `json:"external_ids,omitempty" maxProperties:"10" doc:"IDs of the book in other systems by the name of the system, such as {\"legacy_ils\": \"B004213\"} for its barcode in a legacy catalog"`
+		Language    string            `json:"language,omitempty" doc:"ISO 639-1 code of the language of the book, such as en"`
+		Format      string            `json:"format,omitempty" enum:"hardcover,paperback,ebook,audiobook"`
+		Authors     []string          `json:"authors" minItems:"1" uniqueItems:"true"`
+		Publishers  []string          `json:"publishers" minItems:"1" uniqueItems:"true"`
+		Genres      []string          `json:"genres" minItems:"1" uniqueItems:"true"`
+		Holdings    []HoldingInput    `json:"holdings,omitempty" doc:"Call numbers and shelf locations of the copies of the book"`
 	}
 }
 
@@ -51,17 +79,21 @@ type CreateBookOutput struct {
 }
 
 type UpdateBookInput struct {
-	ID   string `json:"id" path:"id"`
+	ID   data.BookID `json:"id" path:"id"`
 	Body struct {
-		Pages       *int       `json:"pages,omitempty" minimum:"1"`
-		Edition     *int       `json:"edition,omitempty" minimum:"1"`
-		Copies      *int       `json:"copies,omitempty"  minimum:"1"`
-		PublishedAt *time.Time `json:"published_at,omitempty" format:"date-time"`
-		Title       *string    `json:"title,omitempty" minLength:"1"`
-		ISBN        *string    `json:"isbn,omitempty" minLength:"13" maxLength:"13"`
-		Authors     []string   `json:"authors,omitempty" minItems:"1" uniqueItems:"true"`
-		Publishers  []string   `json:"publishers,omitempty" minItems:"1" uniqueItems:"true"`
-		Genres      []string   `json:"genres,omitempty" minItems:"1" uniqueItems:"true"`
+		Pages       *int              `json:"pages,omitempty" minimum:"1"`
+		Edition     *int              `json:"edition,omitempty" minimum:"1"`
+		Copies      *int              `json:"copies,omitempty"  minimum:"1"`
+		PublishedAt *time.Time        `json:"published_at,omitempty" format:"date-time"`
+		Title       *string           `json:"title,omitempty" minLength:"1"`
+		Identifiers []IdentifierInput `json:"identifiers,omitempty" minItems:"1" doc:"Identifiers of the book, which replace its identifiers"`
+		ExternalIDs map[string]string `json:"external_ids,omitempty" maxProperties:"10" doc:"IDs of the book in other systems by the name of the system, which replace its external IDs"`
+		Language    *string           `json:"language,omitempty" doc:"ISO 639-1 code of the language of the book, such as en"`
+		Format      *string           `json:"format,omitempty" enum:"hardcover,paperback,ebook,audiobook"`
+		Authors     []string          `json:"authors,omitempty" minItems:"1" uniqueItems:"true"`
+		Publishers  []string          `json:"publishers,omitempty" minItems:"1" uniqueItems:"true"`
+		Genres      []string          `json:"genres,omitempty" minItems:"1" uniqueItems:"true"`
+		Holdings    []HoldingInput    `json:"holdings,omitempty" doc:"Call numbers and shelf locations of the copies of the book, which replace its holdings"`
 	}
 }
 
@@ -70,13 +102,18 @@ type UpdateBookOutput struct {
 }
 
 type DeleteBookInput struct {
-	ID string `json:"id" path:"id"`
+	ID data.BookID `json:"id" path:"id"`
 }
 
 type DeleteBookOutput struct {
 	Body string `json:"message"`
 }
 
+// Resolve validates the input in GetBooksInput.
+func (b *GetBooksInput) Resolve(ctx huma.Context) []error {
+	return validateIDs(b.IDs, "query.ids")
+}
+
 func (b *GetBookInput) Resolve(ctx huma.Context) []error {
 	var errs []error
 
@@ -88,6 +125,19 @@ func (b *GetBookInput) Resolve(ctx huma.Context) []error {
 	return errs
 }
 
+func (b *CreateBookInput) Resolve(ctx huma.Context) []error {
+	errs := validateIdentifiers(&b.Body.Identifiers, "body.identifiers")
+	errs = append(errs, validateExternalIDs(b.Body.ExternalIDs, "body.external_ids")...)
+
+	if b.Body.Language != "" {
+		if err := validateLanguage(&b.Body.Language, "body.language"); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs
+}
+
 func (b *UpdateBookInput) Resolve(ctx huma.Context) []error {
 	var errs []error
 
@@ -96,6 +146,14 @@ func (b *UpdateBookInput) Resolve(ctx huma.Context) []error {
 		errs = append(errs, err)
 	}
 
+	errs = append(errs, validateIdentifiers(&b.Body.Identifiers, "body.identifiers")...)
+	errs = append(errs, validateExternalIDs(b.Body.ExternalIDs, "body.external_ids")...)
+
+	err = validateLanguage(b.Body.Language, "body.language")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
 	return errs
 }
 
@@ -110,6 +168,55 @@ func (b *DeleteBookInput) Resolve(ctx huma.Context) []error {
 	return errs
 }
 
+// validateHoldings checks that the holdings of a book are of distinct copies of the book and
+// that their call numbers are valid in the classification scheme of the library, and returns them
+// with normalized call numbers and trimmed shelf locations.
+func (app *Application) validateHoldings(holdings []HoldingInput, copies int, location string) ([]data.Holding, error) {
+	var errs []error
+
+	values := make([]data.Holding, 0, len(holdings))
+	seen := make(map[int]bool, len(holdings))
+	for i, holding := range holdings {
+		if holding.Copy > copies {
+			errs = append(errs, &huma.ErrorDetail{
+				Location: fmt.Sprintf("%s[%d].copy", location, i),
+				Message:  fmt.Sprintf("Copy must be at most the %d copies of the book", copies),
+				Value:    holding.Copy,
+			})
+		}
+		if seen[holding.Copy] {
+			errs = append(errs, &huma.ErrorDetail{
+				Location: fmt.Sprintf("%s[%d].copy", location, i),
+				Message:  fmt.Sprintf("Copy %d has more than one holding", holding.Copy),
+				Value:    holding.Copy,
+			})
+		}
+		seen[holding.Copy] = true
+
+		value := data.Holding{Copy: holding.Copy, ShelfLocation: strings.TrimSpace(holding.ShelfLocation)}
+		if strings.TrimSpace(holding.CallNumber) != "" {
+			callNumber, err := classification.Normalize(app.classification, holding.CallNumber)
+			if err != nil {
+				errs = append(errs, &huma.ErrorDetail{
+					Location: fmt.Sprintf("%s[%d].call_number", location, i),
+					Message:  fmt.Sprintf("Invalid call number in the %s classification scheme", app.classification),
+					Value:    holding.CallNumber,
+				})
+			}
+			value.CallNumber = callNumber
+		}
+		values = append(values, value)
+	}
+
+	if len(errs) > 0 {
+		return nil, huma.Error422UnprocessableEntity("validation failed", errs...)
+	}
+
+	slices.SortFunc(values, func(a, b data.Holding) int { return a.Copy - b.Copy })
+
+	return values, nil
+}
+
 // getBookHandler retrieves a book by its ID.
 func (app *Application) getBookHandler(ctx context.Context, input *GetBookInput) (*GetBookOutput, error) {
 	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
@@ -121,11 +228,17 @@ func (app *Application) getBookHandler(ctx context.Context, input *GetBookInput)
 		case errors.Is(err, data.ErrDocumentNotFound):
 			return &GetBookOutput{}, huma.Error404NotFound(errNotFoundMsg)
 		default:
-			return &GetBookOutput{}, err
+			return &GetBookOutput{}, app.serverError(ctx, err)
 		}
 	}
 
+	version := strconv.Itoa(int(book.Version))
+	if err = input.notModified(version, book.UpdatedAt); err != nil {
+		return &GetBookOutput{}, err
+	}
+
 	resp := &GetBookOutput{}
+	resp.CacheValidators = newCacheValidators(version, book.UpdatedAt)
 	resp.Body = *book
 
 	return resp, nil
@@ -133,16 +246,17 @@ func (app *Application) getBookHandler(ctx context.Context, input *GetBookInput)
 
 // getBooksHandler retrieves a paginated list of books with sorting options.
 func (app *Application) getBooksHandler(ctx context.Context, input *GetBooksInput) (*GetBooksOutput, error) {
-	paginator := data.Paginator{Page: input.Page, PageSize: input.PageSize}
-	filter := data.BookFilter{}
-	sorter := data.Sorter{Field: input.Sort, SortSafelist: supportedBooksSortFields}
+	// A batch of IDs is returned in one page.
+	paginator := data.Paginator{Page: input.Page, PageSize: max(input.PageSize, int64(len(input.IDs)))}
+	filter := data.BookFilter{IDs: typedIDs[data.BookID](input.IDs)}
+	sorter := data.Sorter{Field: input.Sort, SortSafelist: supportedBooksSortFields, Collation: app.collation}
 
 	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
 	defer cancel()
 
 	books, metadata, err := app.Models.Books.GetAll(ctx, filter, paginator, sorter)
 	if err != nil {
-		return &GetBooksOutput{}, err
+		return &GetBooksOutput{}, app.serverError(ctx, err)
 	}
 
 	resp := &GetBooksOutput{
@@ -159,7 +273,10 @@ func (app *Application) getBooksHandler(ctx context.Context, input *GetBooksInpu
 func (app *Application) createBookHandler(ctx context.Context, input *CreateBookInput) (*CreateBookOutput, error) {
 	book := &data.Book{
 		Title:       input.Body.Title,
-		ISBN:        input.Body.ISBN,
+		Identifiers: newIdentifiers(input.Body.Identifiers),
+		ExternalIDs: input.Body.ExternalIDs,
+		Language:    input.Body.Language,
+		Format:      input.Body.Format,
 		Copies:      input.Body.Copies,
 		PublishedAt: input.Body.PublishedAt,
 		Authors:     input.Body.Authors,
@@ -169,13 +286,44 @@ func (app *Application) createBookHandler(ctx context.Context, input *CreateBook
 		Pages:       input.Body.Pages,
 	}
 
+	holdings, err := app.validateHoldings(input.Body.Holdings, input.Body.Copies, "body.holdings")
+	if err != nil {
+		return &CreateBookOutput{}, err
+	}
+	if len(holdings) > 0 {
+		book.Holdings = holdings
+	}
+
 	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
 	defer cancel()
 
-	id, err := app.Models.Books.Insert(ctx, book)
+	var id string
+	err = app.Models.Transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		err := app.checkBookExternalIDs(ctx, book.ExternalIDs, "")
+		if err != nil {
+			return err
+		}
 
+		book.PublisherIDs, book.Publishers, err = app.resolvePublishers(ctx, book.Publishers)
+		if err != nil {
+			return err
+		}
+
+		id, err = app.Models.Books.Insert(ctx, book)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrDuplicateIdentifier):
+				return huma.Error422UnprocessableEntity(errIdentifierAlreadyExistsMsg)
+			default:
+				return err
+			}
+		}
+		book.ID = id
+
+		return app.recordEvent(ctx, data.EventBookCreated, book)
+	})
 	if err != nil {
-		return &CreateBookOutput{}, err
+		return &CreateBookOutput{}, app.transactionError(ctx, err)
 	}
 
 	resp := &CreateBookOutput{
@@ -197,16 +345,29 @@ func (app *Application) updateBookHandler(ctx context.Context, input *UpdateBook
 		case errors.Is(err, data.ErrDocumentNotFound):
 			return nil, huma.Error404NotFound(errNotFoundMsg)
 		default:
-			return &UpdateBookOutput{}, err
+			return &UpdateBookOutput{}, app.serverError(ctx, err)
 		}
 	}
+	original := *book
 
 	if input.Body.Title != nil {
 		book.Title = *input.Body.Title
 	}
 
-	if input.Body.ISBN != nil {
-		book.ISBN = *input.Body.ISBN
+	if input.Body.Identifiers != nil {
+		book.Identifiers = newIdentifiers(input.Body.Identifiers)
+	}
+
+	if input.Body.ExternalIDs != nil {
+		book.ExternalIDs = input.Body.ExternalIDs
+	}
+
+	if input.Body.Language != nil {
+		book.Language = *input.Body.Language
+	}
+
+	if input.Body.Format != nil {
+		book.Format = *input.Body.Format
 	}
 
 	if input.Body.Pages != nil {
@@ -237,16 +398,47 @@ func (app *Application) updateBookHandler(ctx context.Context, input *UpdateBook
 		book.Authors = input.Body.Authors
 	}
 
-	err = app.Models.Books.Update(ctx, data.BookFilter{ID: &input.ID}, book)
-	if err != nil {
-		switch {
-		case errors.Is(err, data.ErrEditConflict):
-			return &UpdateBookOutput{}, huma.Error409Conflict(errConflictMsg)
-		default:
+	if input.Body.Holdings != nil {
+		book.Holdings, err = app.validateHoldings(input.Body.Holdings, book.Copies, "body.holdings")
+		if err != nil {
 			return &UpdateBookOutput{}, err
 		}
 	}
 
+	err = app.Models.Transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+
+		if input.Body.ExternalIDs != nil {
+			if err = app.checkBookExternalIDs(ctx, book.ExternalIDs, book.ID); err != nil {
+				return err
+			}
+		}
+
+		if input.Body.Publishers != nil {
+			book.PublisherIDs, book.Publishers, err = app.resolvePublishers(ctx, book.Publishers)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = app.Models.Books.Patch(ctx, data.BookFilter{ID: &input.ID}, &original, book)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrDocumentNotFound):
+				return huma.Error404NotFound(errNotFoundMsg)
+			case errors.Is(err, data.ErrDuplicateIdentifier):
+				return huma.Error422UnprocessableEntity(errIdentifierAlreadyExistsMsg)
+			default:
+				return err
+			}
+		}
+
+		return app.recordEvent(ctx, data.EventBookUpdated, book)
+	})
+	if err != nil {
+		return &UpdateBookOutput{}, app.transactionError(ctx, err)
+	}
+
 	resp := &UpdateBookOutput{
 		Body: *book,
 	}
@@ -254,21 +446,40 @@ func (app *Application) updateBookHandler(ctx context.Context, input *UpdateBook
 	return resp, nil
 }
 
-// deleteBookHandler deletes a book by its ID.
+// deleteBookHandler deletes a book by its ID, with its file.
 func (app *Application) deleteBookHandler(ctx context.Context, input *DeleteBookInput) (*DeleteBookOutput, error) {
 	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
 	defer cancel()
 
-	err := app.Models.Books.Delete(ctx, data.BookFilter{ID: &input.ID})
+	book, err := app.Models.Books.Get(ctx, data.BookFilter{ID: &input.ID})
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrDocumentNotFound):
 			return &DeleteBookOutput{}, huma.Error404NotFound(errNotFoundMsg)
 		default:
-			return &DeleteBookOutput{}, err
+			return &DeleteBookOutput{}, app.serverError(ctx, err)
 		}
 	}
 
+	err = app.Models.Transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		err := app.Models.Books.Delete(ctx, data.BookFilter{ID: &input.ID})
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrDocumentNotFound):
+				return huma.Error404NotFound(errNotFoundMsg)
+			default:
+				return err
+			}
+		}
+
+		return app.recordEvent(ctx, data.EventBookDeleted, bookEvent{ID: string(input.ID)})
+	})
+	if err != nil {
+		return &DeleteBookOutput{}, app.transactionError(ctx, err)
+	}
+
+	app.deleteBookFile(ctx, book.File)
+
 	resp := &DeleteBookOutput{
 		Body: "book successfully deleted",
 	}
@@ -0,0 +1,395 @@
+package api_test
+
+import (
+	"github.com/mzeevi/library/internal/api"
+	"github.com/mzeevi/library/internal/api/apitest"
+	"github.com/mzeevi/library/internal/auth"
+	"github.com/mzeevi/library/internal/data"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBookHandlers(t *testing.T) {
+	a := apitest.New(t)
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+
+	existing := a.SeedBook(apitest.Book("9780306406157", 1))
+
+	newBook := map[string]any{
+		"pages":        100,
+		"edition":      1,
+		"copies":       2,
+		"published_at": time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC),
+		"title":        "A New Book",
+		"identifiers":  []map[string]string{{"type": "isbn13", "value": "9781861972712"}},
+		"authors":      []string{"Author"},
+		"publishers":   []string{"Publisher"},
+		"genres":       []string{"Fiction"},
+	}
+
+	withIdentifiers := func(identifiers ...map[string]string) map[string]any {
+		book := map[string]any{}
+		for k, v := range newBook {
+			book[k] = v
+		}
+		book["identifiers"] = identifiers
+
+		return book
+	}
+	duplicate := withIdentifiers(map[string]string{"type": "isbn13", "value": "9780306406157"})
+	repeatedType := withIdentifiers(
+		map[string]string{"type": "isbn13", "value": "9780140449136"},
+		map[string]string{"type": "isbn13", "value": "9780000000002"},
+	)
+	invalidISBN := withIdentifiers(map[string]string{"type": "isbn13", "value": "978-0-306-40615-8"})
+	electronic := withIdentifiers(
+		map[string]string{"type": "eisbn", "value": "9780306406157"},
+		map[string]string{"type": "isbn10", "value": "0140449132"},
+	)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   any
+		want   int
+	}{
+		{name: "get existing", method: http.MethodGet, path: "/books/" + existing, want: http.StatusOK},
+		{name: "get missing", method: http.MethodGet, path: "/books/000000000000000000000000", want: http.StatusNotFound},
+		{name: "get invalid id", method: http.MethodGet, path: "/books/not-an-id", want: http.StatusUnprocessableEntity},
+		{name: "create", method: http.MethodPost, path: "/books", body: newBook, want: http.StatusOK},
+		{name: "create duplicate isbn", method: http.MethodPost, path: "/books", body: duplicate, want: http.StatusUnprocessableEntity},
+		{name: "create repeated identifier type", method: http.MethodPost, path: "/books", body: repeatedType, want: http.StatusUnprocessableEntity},
+		{name: "create invalid check digit", method: http.MethodPost, path: "/books", body: invalidISBN, want: http.StatusUnprocessableEntity},
+		{name: "create same value of another type", method: http.MethodPost, path: "/books", body: electronic, want: http.StatusOK},
+		{name: "update language and format", method: http.MethodPut, path: "/books/" + existing, body: map[string]any{"language": "EN", "format": "audiobook"}, want: http.StatusOK},
+		{name: "update unknown language", method: http.MethodPut, path: "/books/" + existing, body: map[string]any{"language": "xx"}, want: http.StatusUnprocessableEntity},
+		{name: "update three letter language", method: http.MethodPut, path: "/books/" + existing, body: map[string]any{"language": "eng"}, want: http.StatusUnprocessableEntity},
+		{name: "update unknown format", method: http.MethodPut, path: "/books/" + existing, body: map[string]any{"format": "scroll"}, want: http.StatusUnprocessableEntity},
+		{name: "update duplicate identifiers", method: http.MethodPut, path: "/books/" + existing, body: map[string]any{"identifiers": electronic["identifiers"]}, want: http.StatusUnprocessableEntity},
+		{name: "patch title", method: http.MethodPatch, path: "/books/" + existing, body: map[string]any{"title": "A Patched Book"}, want: http.StatusOK},
+		{name: "patch missing", method: http.MethodPatch, path: "/books/000000000000000000000000", body: map[string]any{"title": "A Patched Book"}, want: http.StatusNotFound},
+		{name: "delete missing", method: http.MethodDelete, path: "/books/000000000000000000000000", want: http.StatusNotFound},
+		{name: "delete existing", method: http.MethodDelete, path: "/books/" + existing, want: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := []any{admin}
+			if tt.body != nil {
+				args = append(args, tt.body)
+			}
+
+			rec := a.Do(tt.method, tt.path, args...)
+			if rec.Code != tt.want {
+				t.Errorf("%s %s status = %v; want %v (body: %s)", tt.method, tt.path, rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestCreateBookNormalizesISBNs(t *testing.T) {
+	a := apitest.New(t)
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+
+	newBook := map[string]any{
+		"pages":        100,
+		"edition":      1,
+		"copies":       1,
+		"published_at": time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC),
+		"title":        "A New Book",
+		"identifiers": []map[string]string{
+			{"type": "isbn10", "value": "0-8044-2957-x"},
+			{"type": "eisbn", "value": "0-306-40615-2"},
+		},
+		"authors":    []string{"Author"},
+		"publishers": []string{"Publisher"},
+		"genres":     []string{"Fiction"},
+	}
+
+	rec := a.Do(http.MethodPost, "/books", admin, newBook)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("create status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	var book data.Book
+	a.Decode(rec, &book)
+	want := []data.Identifier{
+		{Type: data.IdentifierISBN10, Value: "080442957X"},
+		{Type: data.IdentifierEISBN, Value: "9780306406157"},
+		{Type: data.IdentifierISBN13, Value: "9780804429573"},
+	}
+	if !reflect.DeepEqual(book.Identifiers, want) {
+		t.Errorf("identifiers = %+v; want %+v", book.Identifiers, want)
+	}
+}
+
+func TestBookHoldings(t *testing.T) {
+	a := apitest.New(t)
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+
+	withHoldings := func(holdings ...map[string]any) map[string]any {
+		return map[string]any{
+			"pages":        100,
+			"edition":      1,
+			"copies":       2,
+			"published_at": time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC),
+			"title":        "A New Book",
+			"identifiers":  []map[string]string{{"type": "isbn13", "value": "9781861972712"}},
+			"authors":      []string{"Author"},
+			"publishers":   []string{"Publisher"},
+			"genres":       []string{"Fiction"},
+			"holdings":     holdings,
+		}
+	}
+
+	for name, body := range map[string]map[string]any{
+		"copy beyond the copies": withHoldings(map[string]any{"copy": 3, "call_number": "823.914 ROW"}),
+		"repeated copy":          withHoldings(map[string]any{"copy": 1}, map[string]any{"copy": 1}),
+		"invalid call number":    withHoldings(map[string]any{"copy": 1, "call_number": "QA76.73.G63"}),
+	} {
+		if rec := a.Do(http.MethodPost, "/books", admin, body); rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("create with %s status = %v; want %v (body: %s)", name, rec.Code, http.StatusUnprocessableEntity, rec.Body.String())
+		}
+	}
+
+	rec := a.Do(http.MethodPost, "/books", admin, withHoldings(
+		map[string]any{"copy": 2, "call_number": "823.914 row", "shelf_location": "Main Hall"},
+		map[string]any{"copy": 1, "call_number": " 823.914  ROW ", "shelf_location": "Stacks "},
+	))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("create status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	var book data.Book
+	a.Decode(rec, &book)
+	want := []data.Holding{
+		{Copy: 1, CallNumber: "823.914 ROW", ShelfLocation: "Stacks"},
+		{Copy: 2, CallNumber: "823.914 ROW", ShelfLocation: "Main Hall"},
+	}
+	if !reflect.DeepEqual(book.Holdings, want) {
+		t.Errorf("holdings = %+v; want %+v", book.Holdings, want)
+	}
+
+	for _, path := range []string{"/search/books?call_number=823", "/search/books?shelf_location=Main%20Hall"} {
+		var search struct {
+			Books []data.Book `json:"books"`
+		}
+		a.Decode(a.Do(http.MethodGet, path, admin), &search)
+		if len(search.Books) != 1 || search.Books[0].ID != book.ID {
+			t.Errorf("GET %s = %+v; want the book", path, search.Books)
+		}
+	}
+
+	var search struct {
+		Books []data.Book `json:"books"`
+	}
+	a.Decode(a.Do(http.MethodGet, "/search/books?call_number=82391", admin), &search)
+	if len(search.Books) != 0 {
+		t.Errorf("GET /search/books?call_number=82391 = %+v; want no books", search.Books)
+	}
+
+	rec = a.Do(http.MethodPut, "/books/"+book.ID, admin, map[string]any{"copies": 1, "holdings": []map[string]any{{"copy": 2}}})
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("update with a copy beyond the copies status = %v; want %v", rec.Code, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestBookAvailability(t *testing.T) {
+	a := apitest.New(t)
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+
+	popularID := a.SeedBook(apitest.Book("9780306406157", 1))
+	quietID := a.SeedBook(apitest.Book("9781861972712", 2))
+	patronID := a.SeedPatron(apitest.Patron("patron@example.com", auth.ReadBooksPermission, auth.BorrowBookPermission, auth.ReturnBookPermission))
+	patron := a.PatronAuth(patronID)
+
+	borrow := map[string]any{"patron_id": patronID, "book_id": popularID, "due_date": time.Now().Add(14 * 24 * time.Hour), "copies": 1}
+	giveBack := map[string]any{"patron_id": patronID, "book_id": popularID, "copies": 1}
+	for _, step := range []struct {
+		path string
+		body any
+	}{
+		{path: "/transactions/borrow", body: borrow},
+		{path: "/transactions/return", body: giveBack},
+		{path: "/transactions/borrow", body: borrow},
+	} {
+		if rec := a.Do(http.MethodPost, step.path, patron, step.body); rec.Code != http.StatusOK {
+			t.Fatalf("POST %s status = %v; want %v (body: %s)", step.path, rec.Code, http.StatusOK, rec.Body.String())
+		}
+	}
+
+	var availability data.BookAvailability
+	rec := a.Do(http.MethodGet, "/books/"+popularID+"/availability", patron)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET availability status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	a.Decode(rec, &availability)
+	if availability.AvailableCopies != 0 || availability.ActiveLoans != 1 || availability.TotalLoans != 2 || availability.LastReturnedAt.IsZero() {
+		t.Errorf("GET availability = %+v; want no available copies, one active loan of two and a return", availability)
+	}
+
+	if rec = a.Do(http.MethodGet, "/books/000000000000000000000000/availability", patron); rec.Code != http.StatusNotFound {
+		t.Errorf("GET availability of a missing book status = %v; want %v", rec.Code, http.StatusNotFound)
+	}
+
+	var list struct {
+		Availability []data.BookAvailability `json:"availability"`
+	}
+	a.Decode(a.Do(http.MethodGet, "/availability", admin), &list)
+	if len(list.Availability) != 2 || list.Availability[0].BookID != popularID {
+		t.Errorf("GET /availability = %+v; want the borrowed book first", list.Availability)
+	}
+
+	a.Decode(a.Do(http.MethodGet, "/availability?available=true", admin), &list)
+	if len(list.Availability) != 1 || list.Availability[0].BookID != quietID {
+		t.Errorf("GET /availability?available=true = %+v; want the book which was not borrowed", list.Availability)
+	}
+
+	if rec = a.Do(http.MethodGet, "/availability", patron); rec.Code != http.StatusForbidden {
+		t.Errorf("GET /availability as a patron status = %v; want %v", rec.Code, http.StatusForbidden)
+	}
+}
+
+func TestBookPopularity(t *testing.T) {
+	a := apitest.New(t)
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+
+	quietID := a.SeedBook(apitest.Book("9781861972712", 1))
+	popularID := a.SeedBook(apitest.Book("9780306406157", 1))
+	patronID := a.SeedPatron(apitest.Patron("patron@example.com", auth.BorrowBookPermission, auth.ReturnBookPermission))
+	patron := a.PatronAuth(patronID)
+
+	for _, bookID := range []string{popularID, popularID, quietID} {
+		borrow := map[string]any{"patron_id": patronID, "book_id": bookID, "due_date": time.Now().Add(14 * 24 * time.Hour), "copies": 1}
+		if rec := a.Do(http.MethodPost, "/transactions/borrow", patron, borrow); rec.Code != http.StatusOK {
+			t.Fatalf("borrow status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+		}
+		giveBack := map[string]any{"patron_id": patronID, "book_id": bookID, "copies": 1}
+		if rec := a.Do(http.MethodPost, "/transactions/return", patron, giveBack); rec.Code != http.StatusOK {
+			t.Fatalf("return status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+		}
+	}
+
+	var book data.Book
+	a.Decode(a.Do(http.MethodGet, "/books/"+popularID, admin), &book)
+	if book.Circulation.Borrows != 2 || book.Circulation.LastBorrowedAt.IsZero() {
+		t.Errorf("GET /books/%s circulation = %+v; want two borrows", popularID, book.Circulation)
+	}
+
+	for _, path := range []string{"/books?sort=-popularity", "/search/books?sort=-popularity"} {
+		var list struct {
+			Books []data.Book `json:"books"`
+		}
+		a.Decode(a.Do(http.MethodGet, path, admin), &list)
+		if len(list.Books) != 2 || list.Books[0].ID != popularID {
+			t.Errorf("GET %s = %+v; want the most borrowed book first", path, list.Books)
+		}
+	}
+}
+
+func TestBookCollation(t *testing.T) {
+	a := apitest.New(t, func(app *api.Application) {
+		app.Config.Collation = "he"
+	})
+
+	for i, title := range []string{"בית", "Émile", "apple", "Zebra"} {
+		book := apitest.Book([]string{"9780306406157", "9780140449136", "9781861972712", "9780262033848"}[i], 1)
+		book.Title = title
+		a.SeedBook(book)
+	}
+	patronID := a.SeedPatron(apitest.Patron("patron@example.com", auth.ReadBooksPermission))
+
+	var body struct {
+		Books []data.Book `json:"books"`
+	}
+	a.Decode(a.Do(http.MethodGet, "/books?sort=title", a.PatronAuth(patronID)), &body)
+
+	var got []string
+	for _, book := range body.Books {
+		got = append(got, book.Title)
+	}
+	if want := []string{"apple", "Émile", "Zebra", "בית"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GET /books?sort=title with a Hebrew collation = %v; want %v", got, want)
+	}
+}
+
+func TestBookConditionalGet(t *testing.T) {
+	a := apitest.New(t)
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+
+	bookID := a.SeedBook(apitest.Book("9781861972712", 1))
+
+	for _, path := range []string{"/books/" + bookID, "/catalog/books/" + bookID} {
+		rec := a.Do(http.MethodGet, path, admin)
+		etag, lastModified := rec.Header().Get("ETag"), rec.Header().Get("Last-Modified")
+		if rec.Code != http.StatusOK || etag == "" || lastModified == "" {
+			t.Fatalf("GET %s = %v with ETag %q and Last-Modified %q; want %v with both", path, rec.Code, etag, lastModified, http.StatusOK)
+		}
+
+		if rec := a.Do(http.MethodGet, path, admin, "If-None-Match: "+etag); rec.Code != http.StatusNotModified {
+			t.Errorf("GET %s with its ETag status = %v; want %v", path, rec.Code, http.StatusNotModified)
+		}
+		if rec := a.Do(http.MethodGet, path, admin, "If-Modified-Since: "+lastModified); rec.Code != http.StatusNotModified {
+			t.Errorf("GET %s with its Last-Modified status = %v; want %v", path, rec.Code, http.StatusNotModified)
+		}
+		if rec := a.Do(http.MethodGet, path, admin, `If-None-Match: W/"stale"`, "If-Modified-Since: "+lastModified); rec.Code != http.StatusOK {
+			t.Errorf("GET %s with a stale ETag status = %v; want %v", path, rec.Code, http.StatusOK)
+		}
+	}
+
+	path := "/catalog/books/" + bookID + "/availability"
+	etag := a.Do(http.MethodGet, path).Header().Get("ETag")
+	if rec := a.Do(http.MethodGet, path, "If-None-Match: "+etag); rec.Code != http.StatusNotModified {
+		t.Errorf("GET %s with its ETag status = %v; want %v", path, rec.Code, http.StatusNotModified)
+	}
+
+	etag = a.Do(http.MethodGet, "/books/"+bookID, admin).Header().Get("ETag")
+	if rec := a.Do(http.MethodPatch, "/books/"+bookID, admin, map[string]any{"title": "Another Title"}); rec.Code != http.StatusOK {
+		t.Fatalf("PATCH /books/%s status = %v; want %v (body: %s)", bookID, rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if rec := a.Do(http.MethodGet, "/books/"+bookID, admin, "If-None-Match: "+etag); rec.Code != http.StatusOK {
+		t.Errorf("GET /books/%s with the ETag before an update status = %v; want %v", bookID, rec.Code, http.StatusOK)
+	}
+}
+
+func TestBatchGet(t *testing.T) {
+	a := apitest.New(t)
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+
+	var bookIDs []string
+	for _, isbn := range []string{"9781861972712", "9780306406157", "9780131103627"} {
+		bookIDs = append(bookIDs, a.SeedBook(apitest.Book(isbn, 1)))
+	}
+	patronID := a.SeedPatron(apitest.Patron("patron@example.com"))
+	a.SeedPatron(apitest.Patron("other@example.com"))
+
+	var books struct {
+		Books []data.Book `json:"books"`
+	}
+	a.Decode(a.Do(http.MethodGet, "/books?pageSize=1&ids="+bookIDs[0]+","+bookIDs[2], admin), &books)
+	if len(books.Books) != 2 || books.Books[0].ID == bookIDs[1] || books.Books[1].ID == bookIDs[1] {
+		t.Errorf("GET /books?ids= = %+v; want the two books with the IDs", books.Books)
+	}
+
+	var patrons struct {
+		Patrons []data.Patron `json:"patrons"`
+	}
+	a.Decode(a.Do(http.MethodGet, "/patrons?ids="+patronID, admin), &patrons)
+	if len(patrons.Patrons) != 1 || patrons.Patrons[0].ID != patronID {
+		t.Errorf("GET /patrons?ids= = %+v; want the patron with the ID", patrons.Patrons)
+	}
+
+	if rec := a.Do(http.MethodGet, "/transactions?ids=not-an-id", admin); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("GET /transactions with an invalid ID status = %v; want %v", rec.Code, http.StatusUnprocessableEntity)
+	}
+}
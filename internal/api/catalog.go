@@ -0,0 +1,214 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/mzeevi/library/internal/data"
+	"strconv"
+	"time"
+)
+
+// catalogAvailabilityCacheControl lets browsers and shared caches, such as the CDNs of the sites which
+// embed the availability widget, keep the availability of a book for a minute.
+const catalogAvailabilityCacheControl = "public, max-age=60"
+
+// CatalogBook is a Book as the public catalog shows it: its bibliographic record, holdings and
+// available copies, without its circulation or attached file.
+type CatalogBook struct {
+	ID              string            `json:"id"`
+	Title           string            `json:"title"`
+	Identifiers     []data.Identifier `json:"identifiers"`
+	Language        string            `json:"language,omitempty"`
+	Format          string            `json:"format,omitempty"`
+	Authors         []string          `json:"authors"`
+	Publishers      []string          `json:"publishers"`
+	Genres          []string          `json:"genres"`
+	Pages           int               `json:"pages"`
+	Edition         int               `json:"edition"`
+	PublishedAt     time.Time         `json:"published_at"`
+	Copies          int               `json:"copies"`
+	AvailableCopies int               `json:"available_copies"`
+	Holdings        []data.Holding    `json:"holdings,omitempty"`
+}
+
+type GetCatalogBookInput struct {
+	ConditionalInput
+	ID data.BookID `json:"id" path:"id"`
+}
+
+type GetCatalogBookOutput struct {
+	CacheValidators
+	Body CatalogBook
+}
+
+type GetCatalogBooksInput struct {
+	PaginationInput
+	Sort string `json:"sort,omitempty" query:"sort" enum:"id,pages,edition,publishedAt,title,popularity,-id,-pages,-edition,-publishedAt,-title,-popularity"`
+}
+
+type GetCatalogBooksOutput struct {
+	Body CatalogBooksInfo
+}
+
+type CatalogBooksInfo struct {
+	Books    []CatalogBook `json:"books"`
+	Metadata data.Metadata `json:"metadata"`
+}
+
+// CatalogAvailability is the availability of a Book as the availability widget shows it, without
+// the summary of its loans.
+type CatalogAvailability struct {
+	BookID          string    `json:"book_id"`
+	Title           string    `json:"title"`
+	Copies          int       `json:"copies"`
+	AvailableCopies int       `json:"available_copies"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+type GetCatalogAvailabilityInput struct {
+	ConditionalInput
+	ID data.BookID `json:"id" path:"id"`
+}
+
+type GetCatalogAvailabilityOutput struct {
+	CacheValidators
+	CacheControl string `header:"Cache-Control"`
+	Body         CatalogAvailability
+}
+
+// Resolve validates the input in GetCatalogBookInput.
+func (b *GetCatalogBookInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	err := validateID(&b.ID, "path.id")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// Resolve validates the input in GetCatalogAvailabilityInput.
+func (b *GetCatalogAvailabilityInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	err := validateID(&b.ID, "path.id")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// newCatalogBook returns the public catalog record of a book.
+func newCatalogBook(book data.Book) CatalogBook {
+	return CatalogBook{
+		ID:              book.ID,
+		Title:           book.Title,
+		Identifiers:     book.Identifiers,
+		Language:        book.Language,
+		Format:          book.Format,
+		Authors:         book.Authors,
+		Publishers:      book.Publishers,
+		Genres:          book.Genres,
+		Pages:           book.Pages,
+		Edition:         book.Edition,
+		PublishedAt:     book.PublishedAt,
+		Copies:          book.Copies,
+		AvailableCopies: max(book.Copies-book.BorrowedCopies, 0),
+		Holdings:        book.Holdings,
+	}
+}
+
+// getCatalogBookHandler handles an anonymous request to get a book of the catalog.
+func (app *Application) getCatalogBookHandler(ctx context.Context, input *GetCatalogBookInput) (*GetCatalogBookOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	book, err := app.Models.Books.Get(ctx, data.BookFilter{ID: &input.ID})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return &GetCatalogBookOutput{}, huma.Error404NotFound(errNotFoundMsg)
+		default:
+			return &GetCatalogBookOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	version := strconv.Itoa(int(book.Version))
+	if err = input.notModified(version, book.UpdatedAt); err != nil {
+		return &GetCatalogBookOutput{}, err
+	}
+
+	resp := &GetCatalogBookOutput{
+		CacheValidators: newCacheValidators(version, book.UpdatedAt),
+		Body:            newCatalogBook(*book),
+	}
+
+	return resp, nil
+}
+
+// getCatalogBooksHandler handles an anonymous request to list the books of the catalog.
+func (app *Application) getCatalogBooksHandler(ctx context.Context, input *GetCatalogBooksInput) (*GetCatalogBooksOutput, error) {
+	paginator := data.Paginator{Page: input.Page, PageSize: input.PageSize}
+	sorter := data.Sorter{Field: input.Sort, SortSafelist: supportedBooksSortFields, Collation: app.collation}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	books, metadata, err := app.Models.Books.GetAll(ctx, data.BookFilter{}, paginator, sorter)
+	if err != nil {
+		return &GetCatalogBooksOutput{}, app.serverError(ctx, err)
+	}
+
+	resp := &GetCatalogBooksOutput{
+		Body: CatalogBooksInfo{
+			Books:    make([]CatalogBook, 0, len(books)),
+			Metadata: metadata,
+		},
+	}
+	for _, book := range books {
+		resp.Body.Books = append(resp.Body.Books, newCatalogBook(book))
+	}
+
+	return resp, nil
+}
+
+// getCatalogAvailabilityHandler handles an anonymous request to get the availability of a book,
+// such as by the availability widget which school websites embed.
+func (app *Application) getCatalogAvailabilityHandler(ctx context.Context, input *GetCatalogAvailabilityInput) (*GetCatalogAvailabilityOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	availability, err := app.Models.Availability.Get(ctx, string(input.ID))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return &GetCatalogAvailabilityOutput{}, huma.Error404NotFound(errNotFoundMsg)
+		default:
+			return &GetCatalogAvailabilityOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	// The availability is refreshed without being changed, such as when it is rebuilt, so it is
+	// versioned by what the widget shows rather than by when it was updated.
+	version := versionOf(availability.Title, availability.Copies, availability.AvailableCopies)
+	if err = input.notModified(version, time.Time{}); err != nil {
+		return &GetCatalogAvailabilityOutput{}, err
+	}
+
+	resp := &GetCatalogAvailabilityOutput{
+		CacheValidators: newCacheValidators(version, time.Time{}),
+		CacheControl:    catalogAvailabilityCacheControl,
+		Body: CatalogAvailability{
+			BookID:          availability.BookID,
+			Title:           availability.Title,
+			Copies:          availability.Copies,
+			AvailableCopies: availability.AvailableCopies,
+			UpdatedAt:       availability.UpdatedAt,
+		},
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,79 @@
+package api_test
+
+import (
+	"github.com/mzeevi/library/internal/api"
+	"github.com/mzeevi/library/internal/api/apitest"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCatalog(t *testing.T) {
+	a := apitest.New(t, func(app *api.Application) {
+		app.Config.Catalog.RateLimit = 2
+		app.Config.Catalog.RateWindow = time.Minute
+	})
+
+	bookID := a.SeedBook(apitest.Book("9781861972712", 2))
+
+	var list struct {
+		Books []api.CatalogBook `json:"books"`
+	}
+	a.Decode(a.Do(http.MethodGet, "/catalog/books"), &list)
+	if len(list.Books) != 1 || list.Books[0].ID != bookID || list.Books[0].AvailableCopies != 2 {
+		t.Errorf("GET /catalog/books = %+v; want the book with two available copies", list.Books)
+	}
+
+	rec := a.Do(http.MethodGet, "/catalog/books/"+bookID)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /catalog/books/%s status = %v; want %v (body: %s)", bookID, rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if strings.Contains(rec.Body.String(), "circulation") {
+		t.Errorf("GET /catalog/books/%s = %s; want no circulation", bookID, rec.Body.String())
+	}
+
+	if rec := a.Do(http.MethodGet, "/catalog/books/"+bookID); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("GET /catalog/books/%s over the rate limit status = %v; want %v", bookID, rec.Code, http.StatusTooManyRequests)
+	}
+
+	if rec := a.Do(http.MethodGet, "/books/"+bookID); rec.Code != http.StatusUnauthorized {
+		t.Errorf("GET /books/%s anonymously status = %v; want %v", bookID, rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestCatalogAvailability(t *testing.T) {
+	a := apitest.New(t, func(app *api.Application) {
+		app.Config.CORS.TrustedOrigins = []string{"https://library.example.com"}
+	})
+
+	bookID := a.SeedBook(apitest.Book("9781861972712", 2))
+	path := "/catalog/books/" + bookID + "/availability"
+
+	rec := a.Do(http.MethodGet, path, "Origin: https://school.example.org")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET %s status = %v; want %v (body: %s)", path, rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if got := rec.Header().Get("Cache-Control"); !strings.HasPrefix(got, "public") {
+		t.Errorf("GET %s Cache-Control = %q; want a public cache", path, got)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("GET %s Access-Control-Allow-Origin = %q; want *", path, got)
+	}
+
+	var availability api.CatalogAvailability
+	a.Decode(rec, &availability)
+	if availability.BookID != bookID || availability.AvailableCopies != 2 {
+		t.Errorf("GET %s = %+v; want two available copies", path, availability)
+	}
+
+	// The widget is embedded anywhere, so malformed IDs are rejected before reaching the database.
+	if rec := a.Do(http.MethodGet, "/catalog/books/not-an-id/availability", "Origin: https://school.example.org"); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("GET the availability of a malformed ID status = %v; want %v (body: %s)", rec.Code, http.StatusUnprocessableEntity, rec.Body.String())
+	}
+
+	rec = a.Do(http.MethodGet, "/books/"+bookID, "Origin: https://school.example.org")
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("GET /books/%s from an untrusted origin Access-Control-Allow-Origin = %q; want none", bookID, got)
+	}
+}
@@ -0,0 +1,302 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/mzeevi/library/internal/data"
+)
+
+const (
+	errUnknownCategoryMsg   = "%s is not a known patron category"
+	errCategoryExistsMsg    = "a category with this name already exists"
+	errCategoryInUseMsg     = "the category is assigned to %d patrons and cannot be deleted"
+	errInvalidLoanPolicyMsg = "loan policy values must be positive"
+)
+
+type GetCategoryInput struct {
+	ID string `json:"id" path:"id"`
+}
+
+type GetCategoryOutput struct {
+	Body data.Category
+}
+
+type GetCategoriesOutput struct {
+	Body CategoriesInfo
+}
+
+type CategoriesInfo struct {
+	Categories []data.Category `json:"categories"`
+}
+
+type CreateCategoryInput struct {
+	Body struct {
+		Name               string          `json:"name" minLength:"1"`
+		DiscountPercentage float64         `json:"discount_percentage" minimum:"0" maximum:"100"`
+		LoanPolicy         data.LoanPolicy `json:"loan_policy"`
+	}
+}
+
+type CreateCategoryOutput struct {
+	Location string        `header:"Location"`
+	Body     data.Category `json:"category"`
+}
+
+type UpdateCategoryInput struct {
+	ID   string `json:"id" path:"id"`
+	Body struct {
+		DiscountPercentage *float64         `json:"discount_percentage,omitempty" minimum:"0" maximum:"100"`
+		LoanPolicy         *data.LoanPolicy `json:"loan_policy,omitempty"`
+	}
+}
+
+type UpdateCategoryOutput struct {
+	Body data.Category `json:"category"`
+}
+
+type DeleteCategoryInput struct {
+	ID string `json:"id" path:"id"`
+}
+
+type DeleteCategoryOutput struct {
+	Body string `json:"message"`
+}
+
+// Resolve validates the input in GetCategoryInput.
+func (c *GetCategoryInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	err := validateID(&c.ID, "path.id")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// Resolve validates the input in CreateCategoryInput.
+func (c *CreateCategoryInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	err := validateLoanPolicy(&c.Body.LoanPolicy, "body.loan_policy")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// Resolve validates the input in UpdateCategoryInput.
+func (c *UpdateCategoryInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	err := validateID(&c.ID, "path.id")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	err = validateLoanPolicy(c.Body.LoanPolicy, "body.loan_policy")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// Resolve validates the input in DeleteCategoryInput.
+func (c *DeleteCategoryInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	err := validateID(&c.ID, "path.id")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// validateLoanPolicy validates that the values of a loan policy are positive.
+func validateLoanPolicy(policy *data.LoanPolicy, location string) error {
+	if policy == nil {
+		return nil
+	}
+
+	if policy.MaxBorrowedBooks < 1 || policy.LoanPeriodDays < 1 {
+		return &huma.ErrorDetail{
+			Location: location,
+			Message:  errInvalidLoanPolicyMsg,
+			Value:    *policy,
+		}
+	}
+
+	return nil
+}
+
+// validateCategory checks that a patron category exists in the database.
+func (app *Application) validateCategory(ctx context.Context, name, location string) error {
+	_, err := app.Models.Categories.Get(ctx, data.CategoryFilter{Name: &name})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return huma.Error422UnprocessableEntity("validation failed", &huma.ErrorDetail{
+				Location: location,
+				Message:  fmt.Sprintf(errUnknownCategoryMsg, name),
+				Value:    name,
+			})
+		default:
+			return app.serverError(ctx, err)
+		}
+	}
+
+	return nil
+}
+
+// getCategoryHandler handles a request to fetch a single category by ID.
+func (app *Application) getCategoryHandler(ctx context.Context, input *GetCategoryInput) (*GetCategoryOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	category, err := app.Models.Categories.Get(ctx, data.CategoryFilter{ID: &input.ID})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return &GetCategoryOutput{}, huma.Error404NotFound(errNotFoundMsg)
+		default:
+			return &GetCategoryOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	resp := &GetCategoryOutput{}
+	resp.Body = *category
+
+	return resp, nil
+}
+
+// getCategoriesHandler handles a request to fetch all categories.
+func (app *Application) getCategoriesHandler(ctx context.Context, input *struct{}) (*GetCategoriesOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	categories, err := app.Models.Categories.GetAll(ctx, data.CategoryFilter{})
+	if err != nil {
+		return &GetCategoriesOutput{}, app.serverError(ctx, err)
+	}
+
+	resp := &GetCategoriesOutput{
+		Body: CategoriesInfo{
+			Categories: categories,
+		},
+	}
+
+	return resp, nil
+}
+
+// createCategoryHandler handles a request to create a new category.
+func (app *Application) createCategoryHandler(ctx context.Context, input *CreateCategoryInput) (*CreateCategoryOutput, error) {
+	category := data.NewCategory("", input.Body.Name, input.Body.DiscountPercentage, input.Body.LoanPolicy)
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	id, err := app.Models.Categories.Insert(ctx, category)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateCategory):
+			return &CreateCategoryOutput{}, huma.Error409Conflict(errCategoryExistsMsg)
+		default:
+			return &CreateCategoryOutput{}, app.serverError(ctx, err)
+		}
+	}
+	category.ID = id
+
+	resp := &CreateCategoryOutput{
+		Body:     *category,
+		Location: fmt.Sprintf("%s/%s/%s", basePath, categoriesKey, id),
+	}
+
+	return resp, nil
+}
+
+// updateCategoryHandler handles a request to update the discount and loan policy of a category.
+// Categories cannot be renamed, since patrons reference them by name.
+func (app *Application) updateCategoryHandler(ctx context.Context, input *UpdateCategoryInput) (*UpdateCategoryOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	category, err := app.Models.Categories.Get(ctx, data.CategoryFilter{ID: &input.ID})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return &UpdateCategoryOutput{}, huma.Error404NotFound(errNotFoundMsg)
+		default:
+			return &UpdateCategoryOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	if input.Body.DiscountPercentage != nil {
+		category.DiscountPercentage = *input.Body.DiscountPercentage
+	}
+
+	if input.Body.LoanPolicy != nil {
+		category.LoanPolicy = *input.Body.LoanPolicy
+	}
+
+	err = app.Models.Categories.Update(ctx, data.CategoryFilter{ID: &input.ID}, category)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			return &UpdateCategoryOutput{}, huma.Error409Conflict(errConflictMsg)
+		default:
+			return &UpdateCategoryOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	resp := &UpdateCategoryOutput{
+		Body: *category,
+	}
+
+	return resp, nil
+}
+
+// deleteCategoryHandler handles a request to delete a category which is not assigned to any patron.
+func (app *Application) deleteCategoryHandler(ctx context.Context, input *DeleteCategoryInput) (*DeleteCategoryOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	category, err := app.Models.Categories.Get(ctx, data.CategoryFilter{ID: &input.ID})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return &DeleteCategoryOutput{}, huma.Error404NotFound(errNotFoundMsg)
+		default:
+			return &DeleteCategoryOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	patrons, err := app.Models.Patrons.Count(ctx, data.PatronFilter{Category: &category.Name})
+	if err != nil {
+		return &DeleteCategoryOutput{}, app.serverError(ctx, err)
+	}
+
+	if patrons > 0 {
+		return &DeleteCategoryOutput{}, huma.Error409Conflict(fmt.Sprintf(errCategoryInUseMsg, patrons))
+	}
+
+	err = app.Models.Categories.Delete(ctx, data.CategoryFilter{ID: &input.ID})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return &DeleteCategoryOutput{}, huma.Error404NotFound(errNotFoundMsg)
+		default:
+			return &DeleteCategoryOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	resp := &DeleteCategoryOutput{
+		Body: "category successfully deleted",
+	}
+
+	return resp, nil
+}
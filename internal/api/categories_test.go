@@ -0,0 +1,125 @@
+package api_test
+
+import (
+	"context"
+	"github.com/mzeevi/library/internal/api/apitest"
+	"github.com/mzeevi/library/internal/auth"
+	"github.com/mzeevi/library/internal/data"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCategoryEndpoints(t *testing.T) {
+	a := apitest.New(t)
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+
+	// Patrons are seeded as students, so the student category is in use.
+	a.SeedPatron(apitest.Patron("patron@example.com"))
+	student, err := a.Models.Categories.Get(context.Background(), data.CategoryFilter{Name: apitest.Ptr(data.StudentCategory)})
+	if err != nil {
+		t.Fatalf("failed to get the student category: %v", err)
+	}
+
+	rec := a.Do(http.MethodPost, "/categories", admin, map[string]any{
+		"name":                "staff",
+		"discount_percentage": 50,
+		"loan_policy":         map[string]int{"max_borrowed_books": 3, "loan_period_days": 21},
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /categories status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var staff data.Category
+	a.Decode(rec, &staff)
+	if location := rec.Header().Get("Location"); !strings.HasSuffix(location, "/categories/"+staff.ID) {
+		t.Errorf("POST /categories Location = %q; want the path of category %s", location, staff.ID)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   any
+		want   int
+	}{
+		{name: "get existing", method: http.MethodGet, path: "/categories/" + staff.ID, want: http.StatusOK},
+		{name: "get missing", method: http.MethodGet, path: "/categories/000000000000000000000000", want: http.StatusNotFound},
+		{name: "list", method: http.MethodGet, path: "/categories", want: http.StatusOK},
+		{name: "create duplicate name", method: http.MethodPost, path: "/categories", body: map[string]any{"name": "staff", "discount_percentage": 0, "loan_policy": map[string]int{"max_borrowed_books": 1, "loan_period_days": 1}}, want: http.StatusConflict},
+		{name: "create without a loan policy", method: http.MethodPost, path: "/categories", body: map[string]any{"name": "visitor", "discount_percentage": 0}, want: http.StatusUnprocessableEntity},
+		{name: "create discount above 100", method: http.MethodPost, path: "/categories", body: map[string]any{"name": "visitor", "discount_percentage": 101, "loan_policy": map[string]int{"max_borrowed_books": 1, "loan_period_days": 1}}, want: http.StatusUnprocessableEntity},
+		{name: "update discount", method: http.MethodPut, path: "/categories/" + staff.ID, body: map[string]any{"discount_percentage": 25}, want: http.StatusOK},
+		{name: "update loan policy", method: http.MethodPut, path: "/categories/" + staff.ID, body: map[string]any{"loan_policy": map[string]int{"max_borrowed_books": 4, "loan_period_days": 30}}, want: http.StatusOK},
+		{name: "update zero loan period", method: http.MethodPut, path: "/categories/" + staff.ID, body: map[string]any{"loan_policy": map[string]int{"max_borrowed_books": 4, "loan_period_days": 0}}, want: http.StatusUnprocessableEntity},
+		{name: "update missing", method: http.MethodPut, path: "/categories/000000000000000000000000", body: map[string]any{"discount_percentage": 25}, want: http.StatusNotFound},
+		{name: "delete in use", method: http.MethodDelete, path: "/categories/" + student.ID, want: http.StatusConflict},
+		{name: "delete missing", method: http.MethodDelete, path: "/categories/000000000000000000000000", want: http.StatusNotFound},
+		{name: "delete unused", method: http.MethodDelete, path: "/categories/" + staff.ID, want: http.StatusOK},
+		{name: "get deleted", method: http.MethodGet, path: "/categories/" + staff.ID, want: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := []any{admin}
+			if tt.body != nil {
+				args = append(args, tt.body)
+			}
+
+			rec := a.Do(tt.method, tt.path, args...)
+			if rec.Code != tt.want {
+				t.Errorf("%s %s status = %v; want %v (body: %s)", tt.method, tt.path, rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+
+	if _, err := a.Models.Categories.Get(context.Background(), data.CategoryFilter{ID: &student.ID}); err != nil {
+		t.Errorf("category in use was deleted: %v", err)
+	}
+
+	// Patrons can only be created with, or moved to, a known category.
+	patron := map[string]string{"name": "Noa", "email": "noa@example.com", "password": "pa55word1234", "category": "unknown"}
+	if rec := a.Do(http.MethodPost, "/patrons", admin, patron); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("POST /patrons with an unknown category status = %v; want %v (body: %s)", rec.Code, http.StatusUnprocessableEntity, rec.Body.String())
+	}
+	patronID := a.SeedPatron(apitest.Patron("moved@example.com"))
+	if rec := a.Do(http.MethodPut, "/patrons/"+patronID, admin, map[string]string{"category": "unknown"}); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("PUT /patrons/%s to an unknown category status = %v; want %v (body: %s)", patronID, rec.Code, http.StatusUnprocessableEntity, rec.Body.String())
+	}
+}
+
+func TestCategoryLoanPolicy(t *testing.T) {
+	a := apitest.New(t)
+
+	category := data.NewCategory("", "staff", 50, data.LoanPolicy{MaxBorrowedBooks: 2, LoanPeriodDays: 14})
+	if _, err := a.Models.Categories.Insert(context.Background(), category); err != nil {
+		t.Fatalf("failed to seed category: %v", err)
+	}
+	staff := apitest.Patron("staff@example.com", auth.BorrowBookPermission)
+	staff.Category = category.Name
+	patronID := a.SeedPatron(staff)
+	patron := a.PatronAuth(patronID)
+	bookID := a.SeedBook(apitest.Book("9780306406157", 5))
+
+	// The discount of the category is kept on the loan, to be taken off its overdue fine.
+	rec := a.Do(http.MethodPost, "/transactions/borrow", patron, map[string]any{"patron_id": patronID, "book_id": bookID, "copies": 1})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("first borrow status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var transaction data.Transaction
+	a.Decode(rec, &transaction)
+	if transaction.FineDiscount != 50 {
+		t.Errorf("FineDiscount = %v; want %v", transaction.FineDiscount, 50)
+	}
+
+	// Patrons of the category may hold at most 2 copies at a time.
+	if rec := a.Do(http.MethodPost, "/transactions/borrow", patron, map[string]any{"patron_id": patronID, "book_id": bookID, "copies": 2}); rec.Code != http.StatusConflict {
+		t.Errorf("borrow beyond the limit status = %v; want %v (body: %s)", rec.Code, http.StatusConflict, rec.Body.String())
+	}
+	if rec := a.Do(http.MethodPost, "/transactions/borrow", patron, map[string]any{"patron_id": patronID, "book_id": bookID, "copies": 1}); rec.Code != http.StatusOK {
+		t.Errorf("borrow up to the limit status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if rec := a.Do(http.MethodPost, "/transactions/borrow", patron, map[string]any{"patron_id": patronID, "book_id": bookID, "copies": 1}); rec.Code != http.StatusConflict {
+		t.Errorf("borrow at the limit status = %v; want %v (body: %s)", rec.Code, http.StatusConflict, rec.Body.String())
+	}
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"context"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/mzeevi/library/internal/data"
+	"time"
+)
+
+const (
+	errInvalidAsOfMsg = "As of must be a date formatted as YYYY-MM-DD"
+)
+
+type GetCirculationReportInput struct {
+	AsOf string `query:"as_of" doc:"Day of the report, formatted as YYYY-MM-DD in the timezone of the library, as of its end. Now by default"`
+	Term string `query:"term" doc:"Term of the report instead of a day, such as 2024-fall or 2024-fiscal for the fiscal year which starts in 2024"`
+}
+
+type GetCirculationReportOutput struct {
+	Body CirculationReport
+}
+
+// CirculationReport is the circulation of the library as of a time. Borrows, Returns, NewPatrons
+// and Fines are the totals of the daily rollups up to the day of AsOf, or from the day of From for
+// the report of a Term, through RolledUpThrough if the later days were not rolled up yet.
+// ActiveLoans and OverdueLoans were outstanding at AsOf, by the history of the loans. The report of
+// a Term is as of its end, or now if it did not end yet.
+type CirculationReport struct {
+	Term            string     `json:"term,omitempty"`
+	From            *time.Time `json:"from,omitempty"`
+	AsOf            time.Time  `json:"as_of"`
+	RolledUpThrough string     `json:"rolled_up_through,omitempty"`
+	Borrows         int        `json:"borrows"`
+	Returns         int        `json:"returns"`
+	NewPatrons      int64      `json:"new_patrons"`
+	Fines           float64    `json:"fines"`
+	ActiveLoans     int64      `json:"active_loans"`
+	OverdueLoans    int64      `json:"overdue_loans"`
+}
+
+// validateAsOf validates the day which a report is as of, if it is set.
+func validateAsOf(asOf, location string) error {
+	if asOf == "" {
+		return nil
+	}
+
+	if _, err := time.Parse(time.DateOnly, asOf); err != nil {
+		return &huma.ErrorDetail{
+			Location: location,
+			Message:  errInvalidAsOfMsg,
+			Value:    asOf,
+		}
+	}
+
+	return nil
+}
+
+// asOf returns the end of the day asOf in the timezone of the library, or now if it is not set.
+// It should be validated with validateAsOf.
+func (app *Application) asOf(asOf string) time.Time {
+	if asOf == "" {
+		return time.Now().In(app.location)
+	}
+
+	day, _ := time.ParseInLocation(time.DateOnly, asOf, app.location)
+
+	return endOfDay(day)
+}
+
+// endOfDay returns the last millisecond of the day which starts at day, which is the precision
+// of the times in the database.
+func endOfDay(day time.Time) time.Time {
+	return day.AddDate(0, 0, 1).Add(-time.Millisecond)
+}
+
+// Resolve validates the input in GetCirculationReportInput.
+func (c *GetCirculationReportInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	if err := validateAsOf(c.AsOf, "query.as_of"); err != nil {
+		errs = append(errs, err)
+	}
+
+	if c.Term != "" && c.AsOf != "" {
+		errs = append(errs, &huma.ErrorDetail{
+			Location: "query.term",
+			Message:  errTermWithDatesMsg,
+			Value:    c.Term,
+		})
+	}
+
+	return errs
+}
+
+// getCirculationReportHandler handles a request to report the circulation of the library as of a day.
+func (app *Application) getCirculationReportHandler(ctx context.Context, input *GetCirculationReportInput) (*GetCirculationReportOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), reportTimeout)
+	defer cancel()
+
+	report := CirculationReport{AsOf: app.asOf(input.AsOf)}
+	if input.Term != "" {
+		from, to, err := app.termWindow(input.Term, "query.term")
+		if err != nil {
+			return &GetCirculationReportOutput{}, err
+		}
+		report.Term, report.From = input.Term, &from
+		if to.Before(report.AsOf) {
+			report.AsOf = to
+		}
+	}
+
+	days, _, err := app.Models.DailyStats.GetAll(ctx, data.DailyStatsFilter{MinDate: report.From, MaxDate: &report.AsOf}, data.Paginator{}, data.Sorter{Field: "date", SortSafelist: supportedDailyStatsSortFields})
+	if err != nil {
+		return &GetCirculationReportOutput{}, app.serverError(ctx, err)
+	}
+	for _, day := range days {
+		report.Borrows += day.Borrows
+		report.Returns += day.Returns
+		report.NewPatrons += day.NewPatrons
+		report.Fines = roundAmount(report.Fines + day.Fines)
+	}
+	if len(days) > 0 {
+		report.RolledUpThrough = days[len(days)-1].ID
+	}
+
+	// Only the number of the loans is needed, which the metadata of a page of one has.
+	count := data.Paginator{Page: 1, PageSize: 1}
+
+	_, active, err := app.Models.Transactions.GetAll(ctx, data.TransactionFilter{OutstandingAt: &report.AsOf}, count, data.Sorter{})
+	if err != nil {
+		return &GetCirculationReportOutput{}, app.serverError(ctx, err)
+	}
+	report.ActiveLoans = active.TotalRecords
+
+	_, overdue, err := app.Models.Transactions.GetAll(ctx, data.TransactionFilter{OutstandingAt: &report.AsOf, MaxDueDate: &report.AsOf}, count, data.Sorter{})
+	if err != nil {
+		return &GetCirculationReportOutput{}, app.serverError(ctx, err)
+	}
+	report.OverdueLoans = overdue.TotalRecords
+
+	resp := &GetCirculationReportOutput{
+		Body: report,
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,182 @@
+package api
+
+import (
+	"context"
+	"github.com/mzeevi/library/internal/data"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// unknownCollectionGroup groups the books whose publication date is not known.
+const unknownCollectionGroup = "unknown"
+
+var collectionExportHeader = []string{"by", "group", "titles", "copies", "borrowed_copies", "withdrawn_copies", "borrows", "never_borrowed"}
+
+type GetCollectionReportInput struct {
+	Genres []string `query:"genres" doc:"Genres of the books to report (comma separated), such as to report one section at a time. All books by default"`
+	ExportInput
+}
+
+// CollectionReport is the age of the collection, grouped by the decade in which the books were
+// published and by the year in which they were acquired. The year of acquisition of a book is
+// the year in which its first cataloged acquisition was received, or the year in which it was
+// added to the catalog if it was not acquired through acquisitions.
+type CollectionReport struct {
+	GeneratedAt       time.Time         `json:"generated_at"`
+	Genres            []string          `json:"genres,omitempty"`
+	Titles            int               `json:"titles"`
+	Copies            int               `json:"copies"`
+	ByDecade          []CollectionGroup `json:"by_decade"`
+	ByAcquisitionYear []CollectionGroup `json:"by_acquisition_year"`
+}
+
+// CollectionGroup sums up the titles of a group of the CollectionReport, with their copies in stock
+// and withdrawn, their borrows, and the titles which were NeverBorrowed, which are candidates
+// for weeding.
+type CollectionGroup struct {
+	Group           string `json:"group"`
+	Titles          int    `json:"titles"`
+	Copies          int    `json:"copies"`
+	BorrowedCopies  int    `json:"borrowed_copies"`
+	WithdrawnCopies int    `json:"withdrawn_copies"`
+	Borrows         int    `json:"borrows"`
+	NeverBorrowed   int    `json:"never_borrowed"`
+}
+
+// add adds a book to the CollectionGroup.
+func (g *CollectionGroup) add(book data.Book) {
+	g.Titles++
+	g.Copies += book.Copies
+	g.BorrowedCopies += book.BorrowedCopies
+	g.WithdrawnCopies += book.WithdrawnCopies
+	g.Borrows += book.Circulation.Borrows
+	if book.Circulation.Borrows == 0 {
+		g.NeverBorrowed++
+	}
+}
+
+// collectionGroups returns the groups in order, with the unknown group last.
+func collectionGroups(groups map[string]*CollectionGroup) []CollectionGroup {
+	sorted := make([]CollectionGroup, 0, len(groups))
+	for _, group := range groups {
+		sorted = append(sorted, *group)
+	}
+	slices.SortFunc(sorted, func(a, b CollectionGroup) int {
+		switch {
+		case a.Group == b.Group:
+			return 0
+		case a.Group == unknownCollectionGroup:
+			return 1
+		case b.Group == unknownCollectionGroup:
+			return -1
+		case a.Group < b.Group:
+			return -1
+		default:
+			return 1
+		}
+	})
+
+	return sorted
+}
+
+// publicationDecade returns the decade in which a book was published, such as 1990s.
+func publicationDecade(book data.Book) string {
+	if book.PublishedAt.IsZero() {
+		return unknownCollectionGroup
+	}
+
+	return strconv.Itoa(book.PublishedAt.Year()/10*10) + "s"
+}
+
+// collectionReport builds the CollectionReport of the books of genres, or of all books.
+func (app *Application) collectionReport(ctx context.Context, genres []string, now time.Time) (CollectionReport, error) {
+	report := CollectionReport{GeneratedAt: now, Genres: genres, ByDecade: []CollectionGroup{}, ByAcquisitionYear: []CollectionGroup{}}
+
+	books, _, err := app.Models.Books.GetAll(ctx, data.BookFilter{Genres: genres}, data.Paginator{}, data.Sorter{})
+	if err != nil {
+		return report, err
+	}
+
+	acquisitions, _, err := app.Models.Acquisitions.GetAll(ctx, data.AcquisitionFilter{Status: ptr(data.AcquisitionStatusCataloged)}, data.Paginator{}, data.Sorter{})
+	if err != nil {
+		return report, err
+	}
+	acquiredAt := make(map[string]time.Time)
+	for _, acquisition := range acquisitions {
+		if at, ok := acquiredAt[acquisition.BookID]; !ok || acquisition.ReceivedAt.Before(at) {
+			acquiredAt[acquisition.BookID] = acquisition.ReceivedAt
+		}
+	}
+
+	decades := make(map[string]*CollectionGroup)
+	years := make(map[string]*CollectionGroup)
+	group := func(groups map[string]*CollectionGroup, name string) *CollectionGroup {
+		if groups[name] == nil {
+			groups[name] = &CollectionGroup{Group: name}
+		}
+		return groups[name]
+	}
+
+	for _, book := range books {
+		report.Titles++
+		report.Copies += book.Copies
+
+		group(decades, publicationDecade(book)).add(book)
+
+		at, ok := acquiredAt[book.ID]
+		if !ok {
+			at = book.CreatedAt
+		}
+		group(years, strconv.Itoa(at.In(app.location).Year())).add(book)
+	}
+
+	report.ByDecade = collectionGroups(decades)
+	report.ByAcquisitionYear = collectionGroups(years)
+
+	return report, nil
+}
+
+// collectionRecords returns the records of the groups of the CollectionReport to export, with a
+// header.
+func collectionRecords(report CollectionReport) [][]string {
+	records := [][]string{collectionExportHeader}
+	for _, by := range []struct {
+		name   string
+		groups []CollectionGroup
+	}{
+		{name: "decade", groups: report.ByDecade},
+		{name: "acquisition_year", groups: report.ByAcquisitionYear},
+	} {
+		for _, g := range by.groups {
+			records = append(records, []string{
+				by.name, g.Group, strconv.Itoa(g.Titles), strconv.Itoa(g.Copies), strconv.Itoa(g.BorrowedCopies),
+				strconv.Itoa(g.WithdrawnCopies), strconv.Itoa(g.Borrows), strconv.Itoa(g.NeverBorrowed),
+			})
+		}
+	}
+
+	return records
+}
+
+// getCollectionReportHandler handles a request to report the age of the collection, or to export
+// it as a file.
+func (app *Application) getCollectionReportHandler(ctx context.Context, input *GetCollectionReportInput) (*ExportOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), reportTimeout)
+	defer cancel()
+
+	report, err := app.collectionReport(ctx, input.Genres, time.Now().In(app.location))
+	if err != nil {
+		return &ExportOutput{}, app.serverError(ctx, err)
+	}
+
+	if format, export := input.exportFormat(); export {
+		return app.exportResults(ctx, "collection", format, collectionRecords(report))
+	}
+
+	resp := &ExportOutput{
+		Body: report,
+	}
+
+	return resp, nil
+}
@@ -8,21 +8,34 @@ const (
 	errNotFoundMsg        = "the requested resource could not be found"
 	errConflictMsg        = "unable to update the record due to an edit conflict, please try again"
 	errIDAlreadyExistsMsg = "a resource with this ID address already exists"
-)
-
-const (
-	studentCategory = "student"
-	teacherCategory = "teacher"
+	errMinMaxGreaterMsg   = "%s cannot be greater than %s"
+	errMinMaxLaterMsg     = "%s cannot be later than %s"
 )
 
 var (
 	timeout = 10 * time.Second
+	// emailTimeout bounds sending an email, which is done in the background.
+	emailTimeout = 30 * time.Second
+	// webhookTimeout bounds posting an event to a webhook.
+	webhookTimeout = 10 * time.Second
+	// breachTimeout bounds checking a password against breached passwords.
+	breachTimeout = 5 * time.Second
+	// fileTimeout bounds uploading or downloading the file of a book.
+	fileTimeout = 5 * time.Minute
+	// reportTimeout bounds building and emailing the overdue report.
+	reportTimeout = 5 * time.Minute
+	// importTimeout bounds importing a roster of patrons, which creates each of them in a transaction.
+	importTimeout = 5 * time.Minute
+	// fixtureTimeout bounds loading a fixture set, the largest of which has tens of thousands of documents.
+	fixtureTimeout = 10 * time.Minute
+	// maxKioskQueueAge bounds how long ago a request queued by an offline kiosk may have occurred.
+	maxKioskQueueAge = 7 * 24 * time.Hour
 
 	emailRX = "^[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$"
 
 	supportedBooksSortFields = []string{
-		"id", "pages", "edition", "copies", "borrowedCopies", "publishedAt", "title", "isbn",
-		"-id", "-pages", "-edition", "-copies", "-borrowedCopies", "-publishedAt", "-title", "-isbn",
+		"id", "pages", "edition", "copies", "borrowedCopies", "publishedAt", "title", "popularity",
+		"-id", "-pages", "-edition", "-copies", "-borrowedCopies", "-publishedAt", "-title", "-popularity",
 	}
 
 	supportedPatronsSortFields = []string{
@@ -30,6 +43,28 @@ var (
 		"-category", "-name", "-email",
 	}
 
+	supportedNotificationsSortFields = []string{"created_at", "-created_at"}
+	supportedEventsSortFields        = []string{"created_at", "-created_at"}
+	supportedAuditSortFields         = []string{"created_at", "-created_at"}
+	supportedCashReportSortFields    = []string{"paid_at"}
+	supportedAcquisitionsSortFields  = []string{"received_at", "cost", "created_at", "-received_at", "-cost", "-created_at"}
+	supportedWithdrawalsSortFields   = []string{"withdrawn_at", "copies", "-withdrawn_at", "-copies"}
+	supportedInventorySortFields     = []string{"opened_at", "-opened_at"}
+	supportedKiosksSortFields        = []string{"name", "branch", "created_at", "-name", "-branch", "-created_at"}
+	supportedPublishersSortFields    = []string{"name", "-name"}
+	supportedSuggestionsSortFields   = []string{"created_at", "-created_at"}
+	supportedResourcesSortFields     = []string{"name", "-name", "created_at", "-created_at"}
+	supportedReservationsSortFields  = []string{"starts_at", "-starts_at", "created_at", "-created_at"}
+	supportedProgramsSortFields      = []string{"starts_at", "-starts_at", "title", "-title"}
+	supportedRegistrationsSortFields = []string{"created_at", "-created_at"}
+	supportedAnnouncementsSortFields = []string{"starts_at", "-starts_at", "created_at", "-created_at"}
+	supportedSavedSearchesSortFields = []string{"name", "-name", "created_at", "-created_at"}
+	supportedDailyStatsSortFields    = []string{"date", "-date"}
+	supportedAvailabilitySortFields  = []string{
+		"active_loans", "total_loans", "available_copies", "last_borrowed_at",
+		"-active_loans", "-total_loans", "-available_copies", "-last_borrowed_at",
+	}
+
 	supportedTransactionsSortFields = []string{
 		"patronID", "bookID", "status", "borrowed_at", "due_date", "returned_at",
 		"-patronID", "-bookID", "-status", "-borrowed_at", "-due_date", "-returned_at",
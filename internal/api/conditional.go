@@ -0,0 +1,62 @@
+package api
+
+import (
+	"fmt"
+	"github.com/danielgtaylor/huma/v2/conditional"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ConditionalInput holds the headers of a conditional GET, by which a client which cached a
+// resource revalidates it.
+type ConditionalInput struct {
+	IfNoneMatch     []string  `header:"If-None-Match" doc:"Not modified if the resource matches one of the passed ETags"`
+	IfModifiedSince time.Time `header:"If-Modified-Since" doc:"Not modified if the resource was not modified after the passed date"`
+}
+
+// CacheValidators are the headers by which a client revalidates a resource it cached.
+type CacheValidators struct {
+	ETag         string `header:"ETag"`
+	LastModified string `header:"Last-Modified"`
+}
+
+// newCacheValidators returns the validators of a resource with a version, which is changed
+// whenever the resource is, and the time it was last modified, if it is known. The ETag is weak,
+// since the resource may be encoded in more than one format.
+func newCacheValidators(version string, modified time.Time) CacheValidators {
+	validators := CacheValidators{ETag: fmt.Sprintf("W/%q", version)}
+	if !modified.IsZero() {
+		validators.LastModified = modified.UTC().Format(http.TimeFormat)
+	}
+
+	return validators
+}
+
+// versionOf returns a version of a resource which has no version of its own, such as the
+// availability of a book, hashed from the values it shows.
+func versionOf(values ...any) string {
+	h := fnv.New64a()
+	for _, value := range values {
+		_, _ = fmt.Fprintf(h, "%v\x00", value)
+	}
+
+	return strconv.FormatUint(h.Sum64(), 36)
+}
+
+// notModified returns a 304 Not Modified error if the client already has the resource of the
+// version which was modified at modified, or whose modification time is unknown if it is zero.
+// If-None-Match takes precedence over If-Modified-Since, which is only precise to the second.
+func (c ConditionalInput) notModified(version string, modified time.Time) error {
+	params := conditional.Params{IfNoneMatch: c.IfNoneMatch}
+	if len(c.IfNoneMatch) == 0 && !modified.IsZero() {
+		params.IfModifiedSince = c.IfModifiedSince
+	}
+
+	if err := params.PreconditionFailed(version, modified.Truncate(time.Second)); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"context"
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/mzeevi/library/internal/data"
 )
@@ -10,8 +11,14 @@ type contextKey string
 const (
 	adminContextKey  = contextKey("admin")
 	patronContextKey = contextKey("patron")
+	kioskContextKey  = contextKey("kiosk")
 )
 
+// String returns the name of the context key.
+func (c contextKey) String() string {
+	return string(c)
+}
+
 // contextSetPatron adds the Patron to the context.
 func (app *Application) contextSetPatron(ctx huma.Context, patron *data.Patron) huma.Context {
 	ctx = huma.WithValue(ctx, patronContextKey, patron)
@@ -35,3 +42,33 @@ func (app *Application) contextGetAdmin(ctx huma.Context) (*data.Admin, bool) {
 	admin, ok := ctx.Context().Value(adminContextKey).(*data.Admin)
 	return admin, ok
 }
+
+// adminFromContext gets the Admin from the context of a handler.
+func adminFromContext(ctx context.Context) (*data.Admin, bool) {
+	admin, ok := ctx.Value(adminContextKey).(*data.Admin)
+	return admin, ok
+}
+
+// patronFromContext gets the Patron from the context of a handler.
+func patronFromContext(ctx context.Context) (*data.Patron, bool) {
+	patron, ok := ctx.Value(patronContextKey).(*data.Patron)
+	return patron, ok
+}
+
+// contextSetKiosk adds the Kiosk to the context.
+func (app *Application) contextSetKiosk(ctx huma.Context, kiosk *data.Kiosk) huma.Context {
+	ctx = huma.WithValue(ctx, kioskContextKey, kiosk)
+	return ctx
+}
+
+// contextGetKiosk gets the Kiosk from the context.
+func (app *Application) contextGetKiosk(ctx huma.Context) (*data.Kiosk, bool) {
+	kiosk, ok := ctx.Context().Value(kioskContextKey).(*data.Kiosk)
+	return kiosk, ok
+}
+
+// kioskFromContext gets the Kiosk from the context of a handler.
+func kioskFromContext(ctx context.Context) (*data.Kiosk, bool) {
+	kiosk, ok := ctx.Value(kioskContextKey).(*data.Kiosk)
+	return kiosk, ok
+}
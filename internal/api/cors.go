@@ -0,0 +1,170 @@
+package api
+
+import (
+	"cmp"
+	"fmt"
+	"github.com/go-chi/cors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	// defaultCORSMethods are the methods which cross-origin requests may use when none are configured.
+	defaultCORSMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions}
+	// defaultCORSHeaders are the headers which cross-origin requests may send when none are configured.
+	defaultCORSHeaders = []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "Idempotency-Key"}
+	// defaultCORSExposedHeaders are the headers which cross-origin responses expose when none are configured.
+	defaultCORSExposedHeaders = []string{"Link", "Idempotent-Replayed"}
+)
+
+// defaultCORSMaxAge is how long browsers cache the responses to preflight requests when none is configured.
+const defaultCORSMaxAge = 5 * time.Minute
+
+// catalogCORSMethods are the methods which cross-origin requests to the public catalog may use.
+var catalogCORSMethods = []string{http.MethodGet, http.MethodHead, http.MethodOptions}
+
+// originPattern is a trusted origin. A pattern whose host starts with "*." matches the origins of
+// all the subdomains of the rest of the host, with the same scheme and port.
+type originPattern struct {
+	scheme string
+	host   string
+	port   string
+	// wildcard is set for patterns of subdomains, whose host is the parent domain with a leading dot.
+	wildcard bool
+}
+
+// parseOriginPattern parses a trusted origin, such as https://library.example.com or
+// https://*.example.com. An origin has no path, query or credentials.
+func parseOriginPattern(origin string) (originPattern, error) {
+	u, err := url.Parse(strings.ToLower(origin))
+	if err != nil {
+		return originPattern{}, fmt.Errorf("invalid CORS origin %q: %v", origin, err)
+	}
+	if u.Scheme == "" || u.Host == "" || u.User != nil || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" {
+		return originPattern{}, fmt.Errorf("invalid CORS origin %q: must be a scheme and a host, such as https://library.example.com", origin)
+	}
+
+	pattern := originPattern{scheme: u.Scheme, host: u.Hostname(), port: u.Port()}
+	if rest, ok := strings.CutPrefix(pattern.host, "*."); ok {
+		pattern.host = "." + rest
+		pattern.wildcard = true
+	}
+	// A wildcard must be followed by a domain with a dot, so that it can't match all the domains of
+	// a top-level domain, such as https://*.com.
+	if strings.Contains(pattern.host, "*") || (pattern.wildcard && !strings.Contains(pattern.host[1:], ".")) {
+		return originPattern{}, fmt.Errorf("invalid CORS origin %q: a wildcard may only replace the subdomain of a domain, such as https://*.example.com", origin)
+	}
+
+	return pattern, nil
+}
+
+// matches checks if an origin sent by a browser matches the pattern.
+func (p originPattern) matches(origin string) bool {
+	u, err := url.Parse(strings.ToLower(origin))
+	if err != nil || u.Scheme != p.scheme || u.Port() != p.port {
+		return false
+	}
+
+	host := u.Hostname()
+	if !p.wildcard {
+		return host == p.host
+	}
+
+	subdomain, ok := strings.CutSuffix(host, p.host)
+	return ok && subdomain != ""
+}
+
+// setupCORS builds the CORS options of the API. Requests from all origins are allowed if no
+// origins are trusted, or if "*" is, which can't be combined with credentials, since browsers
+// would send the cookies and the credentials of patrons to any site.
+func (app *Application) setupCORS() error {
+	cfg := app.Config.CORS
+
+	if cfg.MaxAge < 0 {
+		return fmt.Errorf("invalid CORS max age %v: must not be negative", cfg.MaxAge)
+	}
+
+	options := cors.Options{
+		AllowedMethods:   defaultCORSMethods,
+		AllowedHeaders:   defaultCORSHeaders,
+		ExposedHeaders:   defaultCORSExposedHeaders,
+		AllowCredentials: cfg.AllowCredentials,
+		MaxAge:           int(cmp.Or(cfg.MaxAge, defaultCORSMaxAge) / time.Second),
+	}
+	if len(cfg.AllowedMethods) > 0 {
+		options.AllowedMethods = cfg.AllowedMethods
+	}
+	if len(cfg.AllowedHeaders) > 0 {
+		options.AllowedHeaders = cfg.AllowedHeaders
+	}
+	if len(cfg.ExposedHeaders) > 0 {
+		options.ExposedHeaders = cfg.ExposedHeaders
+	}
+
+	patterns := make([]originPattern, 0, len(cfg.TrustedOrigins))
+	allowAll := len(cfg.TrustedOrigins) == 0
+	for _, origin := range cfg.TrustedOrigins {
+		if origin == "*" {
+			allowAll = true
+			continue
+		}
+
+		pattern, err := parseOriginPattern(origin)
+		if err != nil {
+			return err
+		}
+		patterns = append(patterns, pattern)
+	}
+
+	if allowAll {
+		if cfg.AllowCredentials {
+			return fmt.Errorf("invalid CORS origins: credentials can't be allowed for all origins, trusted origins must be set")
+		}
+		options.AllowedOrigins = []string{"*"}
+	} else {
+		options.AllowOriginFunc = func(_ *http.Request, origin string) bool {
+			for _, pattern := range patterns {
+				if pattern.matches(origin) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	app.cors = options
+	// The public catalog, and its availability widget, may be called from any origin, since it needs
+	// no credentials, which are not sent to it.
+	app.catalogCORS = cors.Options{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: catalogCORSMethods,
+		AllowedHeaders: []string{"Accept", "If-None-Match", "If-Modified-Since"},
+		ExposedHeaders: []string{"ETag"},
+		MaxAge:         options.MaxAge,
+	}
+
+	return nil
+}
+
+// handleCORS handles cross-origin requests from the trusted origins, and the requests to the
+// public catalog from any origin.
+func (app *Application) handleCORS() func(http.Handler) http.Handler {
+	trusted := cors.Handler(app.cors)
+	open := cors.Handler(app.catalogCORS)
+	prefix := fmt.Sprintf("%s/%s/", basePath, catalogKey)
+
+	return func(next http.Handler) http.Handler {
+		trustedNext, openNext := trusted(next), open(next)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				openNext.ServeHTTP(w, r)
+				return
+			}
+
+			trustedNext.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package api_test
+
+import (
+	"github.com/mzeevi/library/internal/api"
+	"github.com/mzeevi/library/internal/api/apitest"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCORS(t *testing.T) {
+	a := apitest.New(t, func(app *api.Application) {
+		app.Config.CORS.TrustedOrigins = []string{"https://library.example.com", "https://*.branches.example.com"}
+		app.Config.CORS.AllowedMethods = []string{http.MethodGet, http.MethodPost}
+		app.Config.CORS.AllowCredentials = true
+		app.Config.CORS.MaxAge = time.Hour
+	})
+
+	tests := []struct {
+		name       string
+		origin     string
+		method     string
+		wantOrigin string
+	}{
+		{name: "trusted origin", origin: "https://library.example.com", method: http.MethodPost, wantOrigin: "https://library.example.com"},
+		{name: "subdomain of a wildcard", origin: "https://north.branches.example.com", method: http.MethodGet, wantOrigin: "https://north.branches.example.com"},
+		{name: "untrusted origin", origin: "https://example.org", method: http.MethodGet},
+		{name: "method which is not allowed", origin: "https://library.example.com", method: http.MethodDelete},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := a.Do(http.MethodOptions, "/books", "Origin: "+tt.origin, "Access-Control-Request-Method: "+tt.method)
+
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Fatalf("Access-Control-Allow-Origin = %q; want %q", got, tt.wantOrigin)
+			}
+			if tt.wantOrigin == "" {
+				return
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+				t.Errorf("Access-Control-Allow-Credentials = %q; want true", got)
+			}
+			if got := rec.Header().Get("Access-Control-Max-Age"); got != "3600" {
+				t.Errorf("Access-Control-Max-Age = %q; want 3600", got)
+			}
+		})
+	}
+}
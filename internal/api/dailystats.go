@@ -0,0 +1,228 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/mzeevi/library/internal/data"
+	"github.com/mzeevi/library/internal/timezone"
+	"log/slog"
+	"time"
+)
+
+type GetDailyStatsInput struct {
+	PaginationInput
+	From string `query:"from" doc:"First day of the rollups, formatted as YYYY-MM-DD in the timezone of the library"`
+	To   string `query:"to" doc:"Last day of the rollups, formatted as YYYY-MM-DD in the timezone of the library"`
+	Term string `query:"term" doc:"Term of the rollups instead of dates, such as 2024-fall or 2024-fiscal for the fiscal year which starts in 2024"`
+	Sort string `query:"sort" enum:"date,-date" default:"date"`
+}
+
+type GetDailyStatsOutput struct {
+	Body DailyStatsInfo
+}
+
+type DailyStatsInfo struct {
+	Days     []data.DailyStats `json:"days"`
+	Metadata data.Metadata     `json:"metadata"`
+}
+
+// Resolve validates the input in GetDailyStatsInput.
+func (d *GetDailyStatsInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	for _, date := range []struct{ location, value string }{{"query.from", d.From}, {"query.to", d.To}} {
+		if date.value == "" {
+			continue
+		}
+		if _, err := time.Parse(time.DateOnly, date.value); err != nil {
+			errs = append(errs, &huma.ErrorDetail{
+				Location: date.location,
+				Message:  errInvalidReportDateMsg,
+				Value:    date.value,
+			})
+		}
+	}
+
+	if d.Term != "" && (d.From != "" || d.To != "") {
+		errs = append(errs, &huma.ErrorDetail{
+			Location: "query.term",
+			Message:  errTermWithDatesMsg,
+			Value:    d.Term,
+		})
+	}
+
+	return errs
+}
+
+// setupDailyStats validates the hour at which the circulation is rolled up.
+func (app *Application) setupDailyStats() error {
+	if hour := app.Config.Stats.RollupHour; hour < 0 || hour > 23 {
+		return fmt.Errorf("invalid statistics rollup hour %d, it must be between 0 and 23", hour)
+	}
+
+	return nil
+}
+
+// scheduleDailyStats rolls up the circulation of the days which are over every night until ctx is
+// canceled, at the configured hour in the timezone of the library.
+func (app *Application) scheduleDailyStats(ctx context.Context) {
+	for {
+		next := timezone.NextDaily(time.Now(), app.Config.Stats.RollupHour, app.location)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(next)):
+		}
+
+		rollupCtx, cancel := context.WithTimeout(ctx, reportTimeout)
+		if _, err := app.RollupDailyStats(rollupCtx, time.Now()); err != nil {
+			app.logger.Error("failed to roll up the daily statistics", slog.Any("error", err))
+		}
+		cancel()
+	}
+}
+
+// RollupDailyStats rolls up the circulation of every day which is over by now and was not rolled up
+// yet, in the timezone of the library, and returns the rollups. The first run rolls up the days since
+// the first loan. A day which was already rolled up, such as by another instance, is skipped, since
+// rollups are never updated.
+func (app *Application) RollupDailyStats(ctx context.Context, now time.Time) ([]data.DailyStats, error) {
+	today := timezone.StartOfDay(now, app.location)
+
+	day, err := app.firstDayToRollup(ctx, today)
+	if err != nil {
+		return nil, err
+	}
+
+	rollups := make([]data.DailyStats, 0)
+	for ; day.Before(today); day = day.AddDate(0, 0, 1) {
+		stats, err := app.buildDailyStats(ctx, day)
+		if err != nil {
+			return rollups, err
+		}
+
+		if err = app.Models.DailyStats.Insert(ctx, stats); err != nil {
+			switch {
+			case errors.Is(err, data.ErrDuplicateID):
+				continue
+			default:
+				return rollups, err
+			}
+		}
+		rollups = append(rollups, *stats)
+	}
+
+	if len(rollups) > 0 {
+		app.logger.Info("rolled up the daily statistics", slog.String("from", rollups[0].ID), slog.String("to", rollups[len(rollups)-1].ID))
+	}
+
+	return rollups, nil
+}
+
+// firstDayToRollup returns the day after the last day which was rolled up, or the day of the first
+// loan if no day was, or yesterday if there are no loans either.
+func (app *Application) firstDayToRollup(ctx context.Context, today time.Time) (time.Time, error) {
+	first := data.Paginator{Page: 1, PageSize: 1}
+
+	last, _, err := app.Models.DailyStats.GetAll(ctx, data.DailyStatsFilter{}, first, data.Sorter{Field: "-date", SortSafelist: supportedDailyStatsSortFields})
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(last) > 0 {
+		return timezone.StartOfDay(last[0].Date, app.location).AddDate(0, 0, 1), nil
+	}
+
+	transactions, _, err := app.Models.Transactions.GetAll(ctx, data.TransactionFilter{}, first, data.Sorter{Field: "borrowed_at", SortSafelist: supportedTransactionsSortFields})
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(transactions) > 0 {
+		return timezone.StartOfDay(transactions[0].BorrowedAt, app.location), nil
+	}
+
+	return today.AddDate(0, 0, -1), nil
+}
+
+// buildDailyStats counts the loans, the returns and the new patrons of day, and sums the fines of
+// the loans which were returned on it.
+func (app *Application) buildDailyStats(ctx context.Context, day time.Time) (*data.DailyStats, error) {
+	start := day
+	end := endOfDay(day)
+
+	borrowed, _, err := app.Models.Transactions.GetAll(ctx, data.TransactionFilter{MinBorrowedAt: &start, MaxBorrowedAt: &end}, data.Paginator{}, data.Sorter{})
+	if err != nil {
+		return nil, err
+	}
+
+	returned, _, err := app.Models.Transactions.GetAll(ctx, data.TransactionFilter{
+		Status:        ptr(data.TransactionStatusReturned),
+		MinReturnedAt: &start,
+		MaxReturnedAt: &end,
+	}, data.Paginator{}, data.Sorter{})
+	if err != nil {
+		return nil, err
+	}
+
+	newPatrons, err := app.Models.Patrons.Count(ctx, data.PatronFilter{MinCreatedAt: &start, MaxCreatedAt: &end})
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &data.DailyStats{
+		ID:         day.Format(time.DateOnly),
+		Date:       day,
+		Borrows:    len(borrowed),
+		Returns:    len(returned),
+		NewPatrons: newPatrons,
+		CreatedAt:  time.Now(),
+	}
+	for _, transaction := range returned {
+		stats.Fines = roundAmount(stats.Fines + app.transactionFine(&transaction, transaction.ReturnedAt).Amount)
+	}
+
+	return stats, nil
+}
+
+// getDailyStatsHandler handles a request to fetch the daily rollups of the circulation with
+// pagination and sorting.
+func (app *Application) getDailyStatsHandler(ctx context.Context, input *GetDailyStatsInput) (*GetDailyStatsOutput, error) {
+	paginator := data.Paginator{Page: input.Page, PageSize: input.PageSize}
+	sorter := data.Sorter{Field: input.Sort, SortSafelist: supportedDailyStatsSortFields}
+
+	filter := data.DailyStatsFilter{}
+	if input.From != "" {
+		from, _ := time.ParseInLocation(time.DateOnly, input.From, app.location)
+		filter.MinDate = &from
+	}
+	if input.To != "" {
+		to, _ := time.ParseInLocation(time.DateOnly, input.To, app.location)
+		filter.MaxDate = &to
+	}
+	if input.Term != "" {
+		from, to, err := app.termWindow(input.Term, "query.term")
+		if err != nil {
+			return &GetDailyStatsOutput{}, err
+		}
+		filter.MinDate, filter.MaxDate = &from, &to
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	days, metadata, err := app.Models.DailyStats.GetAll(ctx, filter, paginator, sorter)
+	if err != nil {
+		return &GetDailyStatsOutput{}, app.serverError(ctx, err)
+	}
+
+	resp := &GetDailyStatsOutput{
+		Body: DailyStatsInfo{
+			Days:     days,
+			Metadata: metadata,
+		},
+	}
+
+	return resp, nil
+}
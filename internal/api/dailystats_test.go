@@ -0,0 +1,82 @@
+package api_test
+
+import (
+	"context"
+	"github.com/mzeevi/library/internal/api"
+	"github.com/mzeevi/library/internal/api/apitest"
+	"github.com/mzeevi/library/internal/data"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRollupDailyStats(t *testing.T) {
+	a := apitest.New(t, func(app *api.Application) {
+		app.Config.Cost.OverdueFine = 2
+	})
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+
+	bookID := a.SeedBook(apitest.Book("9780306406157", 3))
+	patronID := a.SeedPatron(apitest.Patron("patron@example.com"))
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	at := func(days int) time.Time {
+		return today.AddDate(0, 0, days).Add(10 * time.Hour)
+	}
+
+	late := data.NewTransaction("", patronID, bookID, data.TransactionStatusReturned, at(-3), at(-2))
+	late.ReturnedAt = at(-1)
+	borrowed := data.NewTransaction("", patronID, bookID, data.TransactionStatusBorrowed, at(0), at(14))
+	for _, transaction := range []*data.Transaction{late, borrowed} {
+		if _, err := a.Models.Transactions.Insert(context.Background(), transaction); err != nil {
+			t.Fatalf("failed to seed transaction: %v", err)
+		}
+	}
+
+	// Rolling up tomorrow covers the days since the first loan, up to and including today.
+	rollups, err := a.App.RollupDailyStats(context.Background(), at(1))
+	if err != nil {
+		t.Fatalf("RollupDailyStats() error = %v", err)
+	}
+	want := []data.DailyStats{
+		{ID: at(-3).Format(time.DateOnly), Borrows: 1},
+		{ID: at(-2).Format(time.DateOnly)},
+		{ID: at(-1).Format(time.DateOnly), Returns: 1, Fines: 2},
+		{ID: at(0).Format(time.DateOnly), Borrows: 1, NewPatrons: 1},
+	}
+	if len(rollups) != len(want) {
+		t.Fatalf("RollupDailyStats() = %+v; want %d days", rollups, len(want))
+	}
+	for i, stats := range rollups {
+		if stats.ID != want[i].ID || stats.Borrows != want[i].Borrows || stats.Returns != want[i].Returns || stats.NewPatrons != want[i].NewPatrons || stats.Fines != want[i].Fines {
+			t.Errorf("rollup %d = %+v; want %+v", i, stats, want[i])
+		}
+	}
+
+	// Rollups are immutable: anonymizing the history does not change them, and the days which
+	// were rolled up are not rolled up again.
+	if _, err = a.Models.Transactions.Anonymize(context.Background(), data.TransactionFilter{}); err != nil {
+		t.Fatalf("failed to anonymize the transactions: %v", err)
+	}
+	if rollups, err = a.App.RollupDailyStats(context.Background(), at(1)); err != nil || len(rollups) != 0 {
+		t.Errorf("second RollupDailyStats() = %+v, %v; want no days", rollups, err)
+	}
+
+	if rec := a.Do(http.MethodGet, "/reports/daily", a.PatronAuth(patronID)); rec.Code != http.StatusForbidden {
+		t.Errorf("GET /reports/daily by a patron status = %v; want %v", rec.Code, http.StatusForbidden)
+	}
+
+	rec := a.Do(http.MethodGet, "/reports/daily?from="+want[2].ID+"&to="+want[3].ID+"&sort=-date", admin)
+	var info api.DailyStatsInfo
+	a.Decode(rec, &info)
+	if rec.Code != http.StatusOK || len(info.Days) != 2 || info.Days[0].ID != want[3].ID || info.Days[1].Fines != 2 {
+		t.Errorf("GET /reports/daily = %v %+v; want the last two days, latest first", rec.Code, info)
+	}
+
+	for _, query := range []string{"term=2024-winter", "term=2024-fiscal&from=2024-01-01", "from=yesterday"} {
+		if rec := a.Do(http.MethodGet, "/reports/daily?"+query, admin); rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("GET /reports/daily?%s status = %v; want %v", query, rec.Code, http.StatusUnprocessableEntity)
+		}
+	}
+}
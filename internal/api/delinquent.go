@@ -0,0 +1,264 @@
+package api
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"github.com/mzeevi/library/internal/data"
+	"github.com/mzeevi/library/internal/mailer"
+	"github.com/mzeevi/library/internal/timezone"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Rankings of the delinquent patrons report.
+const (
+	delinquentByOverdue = "overdue"
+	delinquentByFines   = "fines"
+)
+
+var delinquentPatronsExportHeader = []string{"patron_id", "name", "email", "overdue_loans", "max_days_overdue", "overdue_fines", "outstanding_fines"}
+
+type DelinquentPatronsInput struct {
+	Limit int    `query:"limit" minimum:"1" maximum:"100" default:"10" doc:"Number of patrons to report"`
+	Rank  string `query:"rank" enum:"overdue,fines" default:"overdue" doc:"Rank patrons by their overdue loans, or by their overdue and outstanding fines"`
+}
+
+type GetDelinquentPatronsInput struct {
+	DelinquentPatronsInput
+	ExportInput
+}
+
+type RemindDelinquentPatronsInput struct {
+	DelinquentPatronsInput
+}
+
+type RemindDelinquentPatronsOutput struct {
+	Body DelinquentReminders
+}
+
+// DelinquentPatronsReport ranks the patrons with the most overdue loans or the highest fines.
+type DelinquentPatronsReport struct {
+	GeneratedAt time.Time          `json:"generated_at"`
+	Rank        string             `json:"rank"`
+	Patrons     []DelinquentPatron `json:"patrons"`
+}
+
+// DelinquentPatron sums up the delinquency of a patron: the loans which are overdue, with the fines
+// which are accruing on them, and the OutstandingFines of the returned loans which were not paid.
+type DelinquentPatron struct {
+	PatronID         string  `json:"patron_id"`
+	Name             string  `json:"name"`
+	Email            string  `json:"email"`
+	OverdueLoans     int     `json:"overdue_loans"`
+	MaxDaysOverdue   int     `json:"max_days_overdue"`
+	OverdueFines     float64 `json:"overdue_fines"`
+	OutstandingFines float64 `json:"outstanding_fines"`
+
+	overdue []data.Transaction
+}
+
+// DelinquentReminders is the result of reminding the delinquent patrons of their overdue loans.
+// Patrons who only have outstanding fines, or who were deleted, are Skipped, and Failed
+// notifications can be resent.
+type DelinquentReminders struct {
+	Patrons       int `json:"patrons"`
+	Notifications int `json:"notifications"`
+	Failed        int `json:"failed"`
+	Skipped       int `json:"skipped"`
+}
+
+// delinquentPatrons returns the limit patrons with the most overdue loans, or with the highest
+// fines, as of now. Loans which were anonymized are not attributed to any patron.
+func (app *Application) delinquentPatrons(ctx context.Context, limit int, rank string, now time.Time) ([]*DelinquentPatron, error) {
+	patrons := make(map[string]*DelinquentPatron)
+	patron := func(id string) *DelinquentPatron {
+		if patrons[id] == nil {
+			patrons[id] = &DelinquentPatron{PatronID: id}
+		}
+		return patrons[id]
+	}
+
+	overdue, _, err := app.Models.Transactions.GetAll(ctx, data.TransactionFilter{Overdue: ptr(true)}, data.Paginator{}, data.Sorter{})
+	if err != nil {
+		return nil, err
+	}
+	for _, transaction := range overdue {
+		if transaction.PatronID == "" {
+			continue
+		}
+		p := patron(transaction.PatronID)
+		p.OverdueLoans++
+		p.MaxDaysOverdue = max(p.MaxDaysOverdue, timezone.DaysBetween(transaction.DueDate, now, app.location))
+		p.OverdueFines = roundAmount(p.OverdueFines + app.transactionFine(&transaction, now).Amount)
+		p.overdue = append(p.overdue, transaction)
+	}
+
+	unpaid, _, err := app.Models.Transactions.GetAll(ctx, data.TransactionFilter{Status: ptr(data.TransactionStatusReturned), FinePaid: ptr(false)}, data.Paginator{}, data.Sorter{})
+	if err != nil {
+		return nil, err
+	}
+	for _, transaction := range unpaid {
+		if transaction.PatronID == "" {
+			continue
+		}
+		if fine := app.transactionFine(&transaction, now); fine.Amount > 0 {
+			p := patron(transaction.PatronID)
+			p.OutstandingFines = roundAmount(p.OutstandingFines + fine.Amount)
+		}
+	}
+
+	ranked := make([]*DelinquentPatron, 0, len(patrons))
+	for _, p := range patrons {
+		ranked = append(ranked, p)
+	}
+	slices.SortFunc(ranked, func(a, b *DelinquentPatron) int {
+		byFines := cmp.Compare(b.OverdueFines+b.OutstandingFines, a.OverdueFines+a.OutstandingFines)
+		byOverdue := cmp.Or(cmp.Compare(b.OverdueLoans, a.OverdueLoans), cmp.Compare(b.MaxDaysOverdue, a.MaxDaysOverdue))
+		if rank == delinquentByFines {
+			return cmp.Or(byFines, byOverdue, cmp.Compare(a.PatronID, b.PatronID))
+		}
+		return cmp.Or(byOverdue, byFines, cmp.Compare(a.PatronID, b.PatronID))
+	})
+	ranked = ranked[:min(limit, len(ranked))]
+	if len(ranked) == 0 {
+		return ranked, nil
+	}
+
+	// The patrons are resolved in one query, and those which were deleted since are reported
+	// without their details.
+	ids := make([]data.PatronID, 0, len(ranked))
+	for _, p := range ranked {
+		ids = append(ids, data.PatronID(p.PatronID))
+	}
+	details, _, err := app.Models.Patrons.GetAll(ctx, data.PatronFilter{IDs: ids}, data.Paginator{}, data.Sorter{})
+	if err != nil {
+		return nil, err
+	}
+	for _, detail := range details {
+		patrons[detail.ID].Name = detail.Name
+		patrons[detail.ID].Email = detail.Email
+	}
+
+	return ranked, nil
+}
+
+// delinquentPatronRecords returns the records of the delinquent patrons to export, with a header.
+func delinquentPatronRecords(patrons []DelinquentPatron) [][]string {
+	records := [][]string{delinquentPatronsExportHeader}
+	for _, p := range patrons {
+		records = append(records, []string{
+			p.PatronID, p.Name, p.Email, strconv.Itoa(p.OverdueLoans), strconv.Itoa(p.MaxDaysOverdue),
+			strconv.FormatFloat(p.OverdueFines, 'f', 2, 64), strconv.FormatFloat(p.OutstandingFines, 'f', 2, 64),
+		})
+	}
+
+	return records
+}
+
+// getDelinquentPatronsHandler handles a request to report the most delinquent patrons, or to export
+// them as a file.
+func (app *Application) getDelinquentPatronsHandler(ctx context.Context, input *GetDelinquentPatronsInput) (*ExportOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), reportTimeout)
+	defer cancel()
+
+	now := time.Now().In(app.location)
+
+	ranked, err := app.delinquentPatrons(ctx, input.Limit, input.Rank, now)
+	if err != nil {
+		return &ExportOutput{}, app.serverError(ctx, err)
+	}
+
+	report := DelinquentPatronsReport{GeneratedAt: now, Rank: input.Rank, Patrons: make([]DelinquentPatron, 0, len(ranked))}
+	for _, p := range ranked {
+		report.Patrons = append(report.Patrons, *p)
+	}
+
+	if format, export := input.exportFormat(); export {
+		return app.exportResults(ctx, "delinquent-patrons", format, delinquentPatronRecords(report.Patrons))
+	}
+
+	resp := &ExportOutput{
+		Body: report,
+	}
+
+	return resp, nil
+}
+
+// remindDelinquentPatronsHandler handles a request to remind each of the most delinquent patrons of
+// each of their overdue loans, over their notification channels. A reminder which fails to be
+// delivered is stored as failed, so that it can be resent.
+func (app *Application) remindDelinquentPatronsHandler(ctx context.Context, input *RemindDelinquentPatronsInput) (*RemindDelinquentPatronsOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), reportTimeout)
+	defer cancel()
+
+	now := time.Now()
+
+	ranked, err := app.delinquentPatrons(ctx, input.Limit, input.Rank, now)
+	if err != nil {
+		return &RemindDelinquentPatronsOutput{}, app.serverError(ctx, err)
+	}
+
+	var bookIDs []data.BookID
+	for _, p := range ranked {
+		for _, transaction := range p.overdue {
+			bookIDs = append(bookIDs, data.BookID(transaction.BookID))
+		}
+	}
+	titles := make(map[string]string)
+	if len(bookIDs) > 0 {
+		books, _, err := app.Models.Books.GetAll(ctx, data.BookFilter{IDs: bookIDs}, data.Paginator{}, data.Sorter{})
+		if err != nil {
+			return &RemindDelinquentPatronsOutput{}, app.serverError(ctx, err)
+		}
+		for _, book := range books {
+			titles[book.ID] = book.Title
+		}
+	}
+
+	var reminders DelinquentReminders
+	for _, p := range ranked {
+		if len(p.overdue) == 0 {
+			reminders.Skipped++
+			continue
+		}
+
+		patron, err := app.Models.Patrons.Get(ctx, data.PatronFilter{ID: ptr(data.PatronID(p.PatronID))})
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrDocumentNotFound):
+				reminders.Skipped++
+				continue
+			default:
+				return &RemindDelinquentPatronsOutput{}, app.serverError(ctx, err)
+			}
+		}
+		reminders.Patrons++
+
+		for _, transaction := range p.overdue {
+			loanData := mailer.LoanData{
+				Name:        patron.Name,
+				Title:       titles[transaction.BookID],
+				DueDate:     transaction.DueDate.In(app.location),
+				DaysOverdue: timezone.DaysBetween(transaction.DueDate, now, app.location),
+				Fine:        calculateFine(transaction, app.cost.overdueFine, now, app.location),
+			}
+
+			notification, err := app.notifyPatron(ctx, patron, mailer.OverdueTemplate, loanData)
+			if err != nil {
+				return &RemindDelinquentPatronsOutput{}, app.serverError(ctx, err)
+			}
+			reminders.Notifications++
+			if notification.Status == data.NotificationStatusFailed {
+				reminders.Failed++
+			}
+		}
+	}
+
+	resp := &RemindDelinquentPatronsOutput{
+		Body: reminders,
+	}
+
+	return resp, nil
+}
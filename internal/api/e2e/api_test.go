@@ -0,0 +1,146 @@
+package e2e
+
+import (
+	"fmt"
+	"github.com/mzeevi/library/internal/api/apitest"
+	"github.com/mzeevi/library/internal/auth"
+	"github.com/mzeevi/library/internal/data"
+	"github.com/mzeevi/library/internal/data/testhelpers"
+	"net/http"
+	"time"
+)
+
+func (ts *TestSuite) TestAuthentication() {
+	patron := ts.api.SeedPatron(apitest.Patron("reader@example.com", auth.ReadBooksPermission))
+
+	tests := []struct {
+		name   string
+		header []any
+		want   int
+	}{
+		{name: "missing header", want: http.StatusUnauthorized},
+		{name: "invalid jwt", header: []any{"Authorization: Bearer not-a-jwt"}, want: http.StatusUnauthorized},
+		{name: "wrong admin password", header: []any{apitest.AdminAuth(adminName, "wrong")}, want: http.StatusUnauthorized},
+		{name: "patron", header: []any{ts.api.PatronAuth(patron)}, want: http.StatusOK},
+		{name: "admin", header: []any{ts.admin()}, want: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		ts.Run(tt.name, func() {
+			rec := ts.api.Do(http.MethodGet, "/books", tt.header...)
+			ts.Equal(tt.want, rec.Code, rec.Body.String())
+		})
+	}
+}
+
+func (ts *TestSuite) TestPermissions() {
+	reader := ts.api.PatronAuth(ts.api.SeedPatron(apitest.Patron("reader@example.com", auth.ReadBooksPermission)))
+	bookID := ts.api.SeedBook(apitest.Book(testhelpers.GenerateISBN(), 1))
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+	}{
+		{name: "create book", method: http.MethodPost, path: "/books"},
+		{name: "delete book", method: http.MethodDelete, path: "/books/" + bookID},
+		{name: "list patrons", method: http.MethodGet, path: "/patrons"},
+		{name: "list transactions", method: http.MethodGet, path: "/transactions"},
+		{name: "list categories", method: http.MethodGet, path: "/categories"},
+	}
+
+	for _, tt := range tests {
+		ts.Run(tt.name, func() {
+			rec := ts.api.Do(tt.method, tt.path, reader)
+			ts.Equal(http.StatusForbidden, rec.Code, rec.Body.String())
+		})
+	}
+}
+
+func (ts *TestSuite) TestBorrowAndReturn() {
+	bookID := ts.api.SeedBook(apitest.Book(testhelpers.GenerateISBN(), 2))
+	patronID := ts.api.SeedPatron(apitest.Patron("borrower@example.com", auth.BorrowBookPermission, auth.ReturnBookPermission, auth.ReadBooksPermission))
+	patron := ts.api.PatronAuth(patronID)
+
+	borrow := map[string]any{
+		"patron_id": patronID,
+		"book_id":   bookID,
+		"due_date":  time.Now().Add(14 * 24 * time.Hour),
+		"copies":    2,
+	}
+
+	rec := ts.api.Do(http.MethodPost, "/transactions/borrow", patron, borrow)
+	ts.Require().Equal(http.StatusOK, rec.Code, rec.Body.String())
+
+	var book data.Book
+	rec = ts.api.Do(http.MethodGet, "/books/"+bookID, patron)
+	ts.Require().Equal(http.StatusOK, rec.Code, rec.Body.String())
+	ts.api.Decode(rec, &book)
+	ts.Equal(2, book.BorrowedCopies)
+
+	rec = ts.api.Do(http.MethodPost, "/transactions/borrow", patron, borrow)
+	ts.Equal(http.StatusConflict, rec.Code, rec.Body.String())
+
+	giveBack := map[string]any{"patron_id": patronID, "book_id": bookID, "copies": 2}
+	rec = ts.api.Do(http.MethodPost, "/transactions/return", patron, giveBack)
+	ts.Require().Equal(http.StatusOK, rec.Code, rec.Body.String())
+
+	rec = ts.api.Do(http.MethodGet, "/books/"+bookID, patron)
+	ts.Require().Equal(http.StatusOK, rec.Code, rec.Body.String())
+	ts.api.Decode(rec, &book)
+	ts.Equal(0, book.BorrowedCopies)
+
+	rec = ts.api.Do(http.MethodPost, "/transactions/return", patron, giveBack)
+	ts.Equal(http.StatusNotFound, rec.Code, rec.Body.String())
+}
+
+func (ts *TestSuite) TestBorrowRollsBackOnMissingPatron() {
+	bookID := ts.api.SeedBook(apitest.Book(testhelpers.GenerateISBN(), 1))
+
+	borrow := map[string]any{
+		"patron_id": "000000000000000000000000",
+		"book_id":   bookID,
+		"due_date":  time.Now().Add(14 * 24 * time.Hour),
+		"copies":    1,
+	}
+
+	rec := ts.api.Do(http.MethodPost, "/transactions/borrow", ts.admin(), borrow)
+	ts.Equal(http.StatusNotFound, rec.Code, rec.Body.String())
+
+	var book data.Book
+	rec = ts.api.Do(http.MethodGet, "/books/"+bookID, ts.admin())
+	ts.Require().Equal(http.StatusOK, rec.Code, rec.Body.String())
+	ts.api.Decode(rec, &book)
+	ts.Equal(0, book.BorrowedCopies)
+}
+
+func (ts *TestSuite) TestPagination() {
+	for i := 0; i < 25; i++ {
+		book := apitest.Book(testhelpers.GenerateISBN(), 1)
+		book.Title = fmt.Sprintf("Book %02d", i)
+		ts.api.SeedBook(book)
+	}
+
+	var page struct {
+		Books    []data.Book   `json:"books"`
+		Metadata data.Metadata `json:"metadata"`
+	}
+
+	rec := ts.api.Do(http.MethodGet, "/books?page=3&pageSize=10&sort=title", ts.admin())
+	ts.Require().Equal(http.StatusOK, rec.Code, rec.Body.String())
+	ts.api.Decode(rec, &page)
+
+	ts.Len(page.Books, 5)
+	ts.Equal("Book 20", page.Books[0].Title)
+	ts.Equal(data.Metadata{CurrentPage: 3, PageSize: 10, FirstPage: 1, LastPage: 3, TotalRecords: 25}, page.Metadata)
+
+	rec = ts.api.Do(http.MethodGet, "/books?page=0", ts.admin())
+	ts.Equal(http.StatusUnprocessableEntity, rec.Code, rec.Body.String())
+}
+
+func (ts *TestSuite) TestDuplicateEmailIgnoresCase() {
+	ts.api.SeedPatron(apitest.Patron("Dup@Example.com"))
+
+	_, err := ts.api.Models.Patrons.Insert(ts.ctx, apitest.Patron("dup@example.COM"))
+	ts.ErrorIs(err, data.ErrDuplicateEmail)
+}
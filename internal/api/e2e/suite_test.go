@@ -0,0 +1,108 @@
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"github.com/mzeevi/library/internal/api/apitest"
+	"github.com/mzeevi/library/internal/data"
+	"github.com/mzeevi/library/internal/data/testhelpers"
+	"github.com/stretchr/testify/suite"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log"
+	"testing"
+)
+
+const (
+	adminName     = "admin"
+	adminPassword = "admin-password"
+)
+
+func TestSuiteEndToEnd(t *testing.T) {
+	testhelpers.SkipIfNoDocker(t)
+	suite.Run(t, new(TestSuite))
+}
+
+// TestSuite runs the API against a MongoDB container, so that flows which depend on
+// MongoDB, such as transactions and indexes, are covered over HTTP.
+type TestSuite struct {
+	suite.Suite
+	mdbContainer *testhelpers.MongoDBContainer
+	client       *mongo.Client
+	ctx          context.Context
+	databases    int
+
+	api *apitest.API
+}
+
+// SetupSuite starts the MongoDB container.
+func (ts *TestSuite) SetupSuite() {
+	ts.ctx = context.Background()
+
+	mdbContainer, err := testhelpers.CreateMongoDBContainer(ts.ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	ts.mdbContainer = mdbContainer
+
+	ts.client, err = mdbContainer.Client(ts.ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// SetupTest builds the API on a fresh database, so that tests don't see each other's data.
+func (ts *TestSuite) SetupTest() {
+	ts.databases++
+	database := fmt.Sprintf("test-library-e2e-%d", ts.databases)
+
+	models := data.NewModels(ts.client, database, map[string]string{
+		data.BooksCollectionKey:             data.BooksCollectionKey,
+		data.PatronsCollectionKey:           data.PatronsCollectionKey,
+		data.TransactionsCollectionKey:      data.TransactionsCollectionKey,
+		data.TokensCollectionKey:            data.TokensCollectionKey,
+		data.AdminsCollectionKey:            data.AdminsCollectionKey,
+		data.CategoriesCollectionKey:        data.CategoriesCollectionKey,
+		data.PublishersCollectionKey:        data.PublishersCollectionKey,
+		data.NotificationsCollectionKey:     data.NotificationsCollectionKey,
+		data.EventsCollectionKey:            data.EventsCollectionKey,
+		data.AvailabilityCollectionKey:      data.AvailabilityCollectionKey,
+		data.KiosksCollectionKey:            data.KiosksCollectionKey,
+		data.KioskRequestsCollectionKey:     data.KioskRequestsCollectionKey,
+		data.AuditCollectionKey:             data.AuditCollectionKey,
+		data.PaymentsCollectionKey:          data.PaymentsCollectionKey,
+		data.AcquisitionsCollectionKey:      data.AcquisitionsCollectionKey,
+		data.WithdrawalsCollectionKey:       data.WithdrawalsCollectionKey,
+		data.InventorySessionsCollectionKey: data.InventorySessionsCollectionKey,
+		data.InventoryScansCollectionKey:    data.InventoryScansCollectionKey,
+		data.SuggestionsCollectionKey:       data.SuggestionsCollectionKey,
+		data.ResourcesCollectionKey:         data.ResourcesCollectionKey,
+		data.ReservationsCollectionKey:      data.ReservationsCollectionKey,
+		data.ProgramsCollectionKey:          data.ProgramsCollectionKey,
+		data.RegistrationsCollectionKey:     data.RegistrationsCollectionKey,
+		data.AnnouncementsCollectionKey:     data.AnnouncementsCollectionKey,
+		data.SavedSearchesCollectionKey:     data.SavedSearchesCollectionKey,
+	}, nil)
+
+	for _, index := range []func() error{models.Books.CreateUniqueIndex, models.Patrons.CreateUniqueIndex, models.Admins.CreateUniqueIndex, models.Categories.CreateUniqueIndex, models.Publishers.CreateUniqueIndex} {
+		ts.Require().NoError(index())
+	}
+
+	ts.api = apitest.NewWithModels(ts.T(), models)
+	ts.api.SeedAdmin(adminName, adminPassword)
+}
+
+// TearDownSuite performs clean up.
+func (ts *TestSuite) TearDownSuite() {
+	if err := ts.client.Disconnect(ts.ctx); err != nil {
+		log.Printf("error disconnecting from mongodb: %s", err)
+	}
+
+	if err := ts.mdbContainer.Terminate(ts.ctx); err != nil {
+		log.Fatalf("error terminating mongodb container: %s", err)
+	}
+}
+
+// admin returns the Authorization header of the seeded admin.
+func (ts *TestSuite) admin() string {
+	return apitest.AdminAuth(adminName, adminPassword)
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"context"
+	"github.com/mzeevi/library/internal/data"
+	"log/slog"
+	"time"
+)
+
+// defaultEbookReturnInterval is the interval between returns of expired e-book loans when none is configured.
+const defaultEbookReturnInterval = time.Minute
+
+const (
+	errEbookReturnMsg = "e-books are returned automatically at their due date"
+	errEbookCopiesMsg = "only one license of an e-book can be borrowed at a time"
+)
+
+// scheduleEbookReturns returns the e-book loans which expired every interval until ctx is canceled.
+func (app *Application) scheduleEbookReturns(ctx context.Context) {
+	interval := app.Config.Ebooks.ReturnInterval
+	if interval <= 0 {
+		interval = defaultEbookReturnInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		returnCtx, cancel := context.WithTimeout(ctx, reportTimeout)
+		if _, err := app.ReturnExpiredEbooks(returnCtx); err != nil {
+			app.logger.Error("failed to return expired e-book loans", slog.Any("error", err))
+		}
+		cancel()
+	}
+}
+
+// ReturnExpiredEbooks returns the e-book loans whose due date passed, releasing their license
+// seats, and returns how many were returned.
+func (app *Application) ReturnExpiredEbooks(ctx context.Context) (int, error) {
+	var returned int
+
+	err := app.Models.Transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+
+		returned, err = app.returnExpiredEbooks(ctx, nil, time.Now())
+
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return returned, nil
+}
+
+// returnExpiredEbooks returns the e-book loans which were due by now, of a book if bookID is set,
+// as of their due date, so that they are never fined. It should be called within a database
+// transaction.
+func (app *Application) returnExpiredEbooks(ctx context.Context, bookID *data.BookID, now time.Time) (int, error) {
+	transactions, _, err := app.Models.Transactions.GetAll(ctx, data.TransactionFilter{
+		BookID:     bookID,
+		Status:     ptr(data.TransactionStatusBorrowed),
+		Digital:    ptr(true),
+		MaxDueDate: &now,
+	}, data.Paginator{}, data.Sorter{})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, transaction := range transactions {
+		transaction.ReturnedAt = transaction.DueDate
+		transaction.Status = data.TransactionStatusReturned
+
+		if err = app.Models.Transactions.Update(ctx, data.TransactionFilter{ID: ptr(data.TransactionID(transaction.ID))}, &transaction); err != nil {
+			return 0, err
+		}
+
+		copies, err := app.releaseCopies(ctx, &transaction)
+		if err != nil {
+			return 0, err
+		}
+
+		if err = app.recordEvent(ctx, data.EventBookReturned, transactionEvent{Transaction: transaction, Copies: copies}); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(transactions), nil
+}
@@ -0,0 +1,98 @@
+package api_test
+
+import (
+	"context"
+	"github.com/mzeevi/library/internal/api/apitest"
+	"github.com/mzeevi/library/internal/auth"
+	"github.com/mzeevi/library/internal/data"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestEbookLending(t *testing.T) {
+	a := apitest.New(t)
+
+	ebook := apitest.Book("9780306406157", 1)
+	ebook.Format = data.FormatEbook
+	bookID := a.SeedBook(ebook)
+
+	firstID := a.SeedPatron(apitest.Patron("first@example.com", auth.BorrowBookPermission, auth.ReturnBookPermission))
+	secondID := a.SeedPatron(apitest.Patron("second@example.com", auth.BorrowBookPermission))
+
+	borrow := func(patronID string, copies int) int {
+		body := map[string]any{
+			"patron_id": patronID,
+			"book_id":   bookID,
+			"due_date":  time.Now().Add(14 * 24 * time.Hour),
+			"copies":    copies,
+		}
+		return a.Do(http.MethodPost, "/transactions/borrow", a.PatronAuth(patronID), body).Code
+	}
+
+	if code := borrow(firstID, 2); code != http.StatusUnprocessableEntity {
+		t.Errorf("borrow two licenses status = %v; want %v", code, http.StatusUnprocessableEntity)
+	}
+	if code := borrow(firstID, 1); code != http.StatusOK {
+		t.Fatalf("borrow status = %v; want %v", code, http.StatusOK)
+	}
+	if code := borrow(secondID, 1); code != http.StatusConflict {
+		t.Errorf("borrow without a free license status = %v; want %v", code, http.StatusConflict)
+	}
+
+	giveBack := map[string]any{"patron_id": firstID, "book_id": bookID, "copies": 1}
+	if rec := a.Do(http.MethodPost, "/transactions/return", a.PatronAuth(firstID), giveBack); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("return e-book status = %v; want %v (body: %s)", rec.Code, http.StatusUnprocessableEntity, rec.Body.String())
+	}
+
+	ctx := context.Background()
+	loan, err := a.Models.Transactions.Get(ctx, data.TransactionFilter{PatronID: apitest.Ptr(data.PatronID(firstID))})
+	if err != nil {
+		t.Fatalf("Transactions.Get() error = %v", err)
+	}
+	if !loan.Digital {
+		t.Errorf("Digital = false; want true")
+	}
+
+	if returned, err := a.App.ReturnExpiredEbooks(ctx); err != nil || returned != 0 {
+		t.Errorf("ReturnExpiredEbooks() before the due date = %d, %v; want 0, nil", returned, err)
+	}
+
+	// The license of an expired loan is released when the e-book is borrowed again.
+	loan.DueDate = time.Now().Add(-time.Hour)
+	if err = a.Models.Transactions.Update(ctx, data.TransactionFilter{ID: apitest.Ptr(data.TransactionID(loan.ID))}, loan); err != nil {
+		t.Fatalf("Transactions.Update() error = %v", err)
+	}
+	if code := borrow(secondID, 1); code != http.StatusOK {
+		t.Fatalf("borrow after the loan expired status = %v; want %v", code, http.StatusOK)
+	}
+
+	expired, err := a.Models.Transactions.Get(ctx, data.TransactionFilter{ID: apitest.Ptr(data.TransactionID(loan.ID))})
+	if err != nil {
+		t.Fatalf("Transactions.Get() error = %v", err)
+	}
+	if expired.Status != data.TransactionStatusReturned || !expired.ReturnedAt.Equal(expired.DueDate) {
+		t.Errorf("expired loan = %+v; want returned at its due date", expired)
+	}
+
+	loan, err = a.Models.Transactions.Get(ctx, data.TransactionFilter{PatronID: apitest.Ptr(data.PatronID(secondID))})
+	if err != nil {
+		t.Fatalf("Transactions.Get() error = %v", err)
+	}
+	loan.DueDate = time.Now().Add(-time.Hour)
+	if err = a.Models.Transactions.Update(ctx, data.TransactionFilter{ID: apitest.Ptr(data.TransactionID(loan.ID))}, loan); err != nil {
+		t.Fatalf("Transactions.Update() error = %v", err)
+	}
+
+	if returned, err := a.App.ReturnExpiredEbooks(ctx); err != nil || returned != 1 {
+		t.Errorf("ReturnExpiredEbooks() = %d, %v; want 1, nil", returned, err)
+	}
+
+	book, err := a.Models.Books.Get(ctx, data.BookFilter{ID: apitest.Ptr(data.BookID(bookID))})
+	if err != nil {
+		t.Fatalf("Books.Get() error = %v", err)
+	}
+	if book.BorrowedCopies != 0 {
+		t.Errorf("BorrowedCopies after the loans expired = %v; want 0", book.BorrowedCopies)
+	}
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/mzeevi/library/internal/mailer"
+	"time"
+)
+
+type PreviewEmailInput struct {
+	Name   string `path:"name" enum:"activation,password_reset,due_soon,overdue,hold_ready,borrowed,overdue_report,reservation_confirmed,reservation_canceled,program_registered,program_waitlisted,program_reminder,program_canceled" doc:"Name of the email template"`
+	Locale string `query:"locale" doc:"Locale to render the email in, the default locale is used if the template has no variant in it"`
+}
+
+type PreviewEmailOutput struct {
+	Body *mailer.Message
+}
+
+// previewEmailHandler renders an email template with sample data.
+func (app *Application) previewEmailHandler(ctx context.Context, input *PreviewEmailInput) (*PreviewEmailOutput, error) {
+	sample, err := mailer.SampleData(input.Name, time.Now().In(app.location))
+	if err != nil {
+		switch {
+		case errors.Is(err, mailer.ErrUnknownTemplate):
+			return &PreviewEmailOutput{}, huma.Error404NotFound(errNotFoundMsg)
+		default:
+			return &PreviewEmailOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	msg, err := app.mailer.Render(input.Name, input.Locale, sample)
+	if err != nil {
+		return &PreviewEmailOutput{}, app.serverError(ctx, err)
+	}
+
+	return &PreviewEmailOutput{Body: msg}, nil
+}
@@ -0,0 +1,57 @@
+package api_test
+
+import (
+	"github.com/mzeevi/library/internal/api/apitest"
+	"github.com/mzeevi/library/internal/auth"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestPreviewEmail(t *testing.T) {
+	a := apitest.New(t)
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+	patronID := a.SeedPatron(apitest.Patron("patron@example.com", auth.ReadPatronsPermission))
+
+	var body struct {
+		Subject   string `json:"subject"`
+		PlainBody string `json:"plain_body"`
+		HTMLBody  string `json:"html_body"`
+	}
+
+	tests := []struct {
+		path     string
+		header   string
+		want     int
+		wantLang string
+	}{
+		{path: "/emails/activation/preview", header: admin, want: http.StatusOK, wantLang: `lang="en"`},
+		{path: "/emails/overdue/preview?locale=he", header: admin, want: http.StatusOK, wantLang: `lang="he"`},
+		{path: "/emails/due_soon/preview?locale=fr", header: admin, want: http.StatusOK, wantLang: `lang="en"`},
+		{path: "/emails/unknown/preview", header: admin, want: http.StatusUnprocessableEntity},
+		{path: "/emails/activation/preview", header: a.PatronAuth(patronID), want: http.StatusForbidden},
+		{path: "/emails/activation/preview", want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		var args []any
+		if tt.header != "" {
+			args = append(args, tt.header)
+		}
+
+		rec := a.Do(http.MethodGet, tt.path, args...)
+		if rec.Code != tt.want {
+			t.Errorf("GET %s status = %v; want %v (body: %s)", tt.path, rec.Code, tt.want, rec.Body.String())
+			continue
+		}
+		if tt.want != http.StatusOK {
+			continue
+		}
+
+		a.Decode(rec, &body)
+		if body.Subject == "" || body.PlainBody == "" || !strings.Contains(body.HTMLBody, tt.wantLang) {
+			t.Errorf("GET %s = %+v; want a rendered email with %s", tt.path, body, tt.wantLang)
+		}
+	}
+}
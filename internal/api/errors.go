@@ -0,0 +1,78 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/mzeevi/library/internal/data"
+	"github.com/mzeevi/library/internal/logging"
+	"log/slog"
+	"net/http"
+)
+
+const (
+	requestIDLogKey = "requestID"
+)
+
+// requestLogger returns the logger of the request in the context,
+// which is annotated with the ID of the request.
+func (app *Application) requestLogger(ctx context.Context) *slog.Logger {
+	return logging.FromContext(ctx)
+}
+
+// correlateLogs stores a logger annotated with the ID of the request in the request context,
+// so that handlers and the data layer log lines can be correlated to a request.
+func (app *Application) correlateLogs(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger := app.logger.Logger.With(slog.String(requestIDLogKey, middleware.GetReqID(r.Context())))
+		next.ServeHTTP(w, r.WithContext(logging.WithLogger(r.Context(), logger)))
+	})
+}
+
+// serverError logs an unexpected error and returns a generic internal server error,
+// so that the details of the error are not exposed to the client. An ID which is not valid
+// can't be of any document, so if one reaches the models it is not found instead.
+func (app *Application) serverError(ctx context.Context, err error) error {
+	if errors.Is(err, data.ErrInvalidID) {
+		return huma.Error404NotFound(errNotFoundMsg)
+	}
+
+	app.requestLogger(ctx).Error(errInternalServerErrorMsg, slog.Any("error", err))
+	app.reportError(ctx, err)
+
+	return huma.Error500InternalServerError(errInternalServerErrorMsg)
+}
+
+// transactionError returns the errors which handlers return from within a database
+// transaction as-is, and maps any other error to an internal server error.
+func (app *Application) transactionError(ctx context.Context, err error) error {
+	var statusErr huma.StatusError
+	if errors.As(err, &statusErr) {
+		return err
+	}
+
+	return app.serverError(ctx, err)
+}
+
+// background runs fn in a goroutine which is completed before the server shuts down. The context
+// passed to fn is not canceled with ctx, and panics in fn are logged and reported.
+func (app *Application) background(ctx context.Context, fn func(ctx context.Context)) {
+	ctx = context.WithoutCancel(ctx)
+
+	app.wg.Add(1)
+	go func() {
+		defer app.wg.Done()
+
+		defer func() {
+			if r := recover(); r != nil {
+				err := fmt.Errorf("panic in background task: %v", r)
+				app.requestLogger(ctx).Error(err.Error())
+				app.reportError(ctx, err)
+			}
+		}()
+
+		fn(ctx)
+	}()
+}
@@ -0,0 +1,187 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/mzeevi/library/internal/data"
+	"github.com/mzeevi/library/internal/mailer"
+	"time"
+)
+
+const (
+	errEventDispatchedMsg = "the event was already dispatched"
+)
+
+// transactionEvent is the payload of the book.borrowed and book.returned events.
+type transactionEvent struct {
+	Transaction data.Transaction `json:"transaction"`
+	Copies      int              `json:"copies"`
+}
+
+// bookEvent is the payload of the book.deleted event, and the part of the payload of the
+// book.created and book.updated events, which hold the whole book, that identifies it.
+type bookEvent struct {
+	ID string `json:"id"`
+}
+
+// patronEvent is the payload of the patron.created event. It holds no personal fields,
+// since events are posted to webhooks as they are.
+type patronEvent struct {
+	ID       string `json:"id"`
+	Category string `json:"category"`
+}
+
+type GetEventsInput struct {
+	PaginationInput
+	Status string `query:"status" enum:"pending,dispatched,failed" doc:"Filter by dispatch status"`
+	Type   string `query:"type" enum:"book.created,book.updated,book.deleted,book.borrowed,book.returned,patron.created" doc:"Filter by type"`
+	Sort   string `query:"sort" enum:"created_at,-created_at" default:"-created_at"`
+}
+
+type GetEventsOutput struct {
+	Body EventsInfo
+}
+
+type EventsInfo struct {
+	Events   []data.Event  `json:"events"`
+	Metadata data.Metadata `json:"metadata"`
+}
+
+type RetryEventInput struct {
+	ID string `json:"id" path:"id"`
+}
+
+type RetryEventOutput struct {
+	Body data.Event `json:"event"`
+}
+
+// Resolve validates the input in RetryEventInput.
+func (e *RetryEventInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	err := validateID(&e.ID, "path.id")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// recordEvent inserts a domain event into the outbox. It should be called within the
+// transaction of the change which the event describes, so that both are stored or neither is.
+func (app *Application) recordEvent(ctx context.Context, eventType string, payload any) error {
+	event, err := data.NewEvent(eventType, payload)
+	if err != nil {
+		return err
+	}
+
+	_, err = app.Models.Events.Insert(ctx, event)
+	return err
+}
+
+// DispatchEvents delivers a batch of the pending events of the outbox to their subscribers,
+// and returns how many were delivered. The server dispatches events periodically, and it is
+// exported for tests which do not run the server.
+func (app *Application) DispatchEvents(ctx context.Context) (int, error) {
+	return app.events.Dispatch(ctx)
+}
+
+// sendBorrowReceipt notifies a patron of a book they borrowed.
+func (app *Application) sendBorrowReceipt(ctx context.Context, event data.Event) error {
+	var payload transactionEvent
+	if err := json.Unmarshal(event.Payload, &payload); err != nil {
+		return fmt.Errorf("failed to decode %s event: %v", event.Type, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, emailTimeout)
+	defer cancel()
+
+	patron, err := app.Models.Patrons.Get(ctx, data.PatronFilter{ID: ptr(data.PatronID(payload.Transaction.PatronID))})
+	if err != nil {
+		return err
+	}
+
+	book, err := app.Models.Books.Get(ctx, data.BookFilter{ID: ptr(data.BookID(payload.Transaction.BookID))})
+	if err != nil {
+		return err
+	}
+
+	loanData := mailer.LoanData{
+		Name:    patron.Name,
+		Title:   book.Title,
+		DueDate: payload.Transaction.DueDate.In(app.location),
+	}
+
+	_, err = app.notifyPatron(ctx, patron, mailer.BorrowedTemplate, loanData)
+	return err
+}
+
+// getEventsHandler handles a request to list the events of the outbox with their dispatch status.
+func (app *Application) getEventsHandler(ctx context.Context, input *GetEventsInput) (*GetEventsOutput, error) {
+	paginator := data.Paginator{Page: input.Page, PageSize: input.PageSize}
+	sorter := data.Sorter{Field: input.Sort, SortSafelist: supportedEventsSortFields, Collation: app.collation}
+
+	filter := data.EventFilter{}
+	if input.Status != "" {
+		filter.Status = &input.Status
+	}
+	if input.Type != "" {
+		filter.Type = &input.Type
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	events, metadata, err := app.Models.Events.GetAll(ctx, filter, paginator, sorter)
+	if err != nil {
+		return &GetEventsOutput{}, app.serverError(ctx, err)
+	}
+
+	resp := &GetEventsOutput{
+		Body: EventsInfo{
+			Events:   events,
+			Metadata: metadata,
+		},
+	}
+
+	return resp, nil
+}
+
+// retryEventHandler handles a request to dispatch an event which was not dispatched again. The event
+// is made pending and due immediately, with its attempts reset, and is dispatched in the next batch.
+func (app *Application) retryEventHandler(ctx context.Context, input *RetryEventInput) (*RetryEventOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	event, err := app.Models.Events.Get(ctx, data.EventFilter{ID: &input.ID})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return &RetryEventOutput{}, huma.Error404NotFound(errNotFoundMsg)
+		default:
+			return &RetryEventOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	if event.Status == data.EventStatusDispatched {
+		return &RetryEventOutput{}, huma.Error422UnprocessableEntity(errEventDispatchedMsg)
+	}
+
+	event.Status = data.EventStatusPending
+	event.Attempts = 0
+	event.NextAttemptAt = time.Now()
+
+	if err = app.Models.Events.Update(ctx, data.EventFilter{ID: &event.ID}, event); err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			return &RetryEventOutput{}, huma.Error409Conflict(errConflictMsg)
+		default:
+			return &RetryEventOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	return &RetryEventOutput{Body: *event}, nil
+}
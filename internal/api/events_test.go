@@ -0,0 +1,146 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/mzeevi/library/internal/api"
+	"github.com/mzeevi/library/internal/api/apitest"
+	"github.com/mzeevi/library/internal/auth"
+	"github.com/mzeevi/library/internal/data"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEventOutbox(t *testing.T) {
+	var down atomic.Bool
+	down.Store(true)
+	var mu sync.Mutex
+	var received []string
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			http.Error(w, "receiver unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		mu.Lock()
+		received = append(received, r.Header.Get("X-Library-Event"))
+		mu.Unlock()
+	}))
+	defer receiver.Close()
+
+	a := apitest.New(t, func(app *api.Application) {
+		app.Config.Events.WebhookURLs = []string{receiver.URL}
+		app.Config.Events.BorrowReceipts = true
+	})
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+
+	newBook := map[string]any{
+		"pages":        100,
+		"edition":      1,
+		"copies":       2,
+		"published_at": time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC),
+		"title":        "A New Book",
+		"identifiers":  []map[string]string{{"type": "isbn13", "value": "9781861972712"}},
+		"authors":      []string{"Author"},
+		"publishers":   []string{"Publisher"},
+		"genres":       []string{"Fiction"},
+	}
+	var book data.Book
+	rec := a.Do(http.MethodPost, "/books", admin, newBook)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("create book status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	a.Decode(rec, &book)
+
+	patronID := a.SeedPatron(apitest.Patron("patron@example.com", auth.BorrowBookPermission, auth.ReturnBookPermission))
+	patron := a.PatronAuth(patronID)
+
+	borrow := map[string]any{"patron_id": patronID, "book_id": book.ID, "due_date": time.Now().Add(14 * 24 * time.Hour), "copies": 1}
+	if rec = a.Do(http.MethodPost, "/transactions/borrow", patron, borrow); rec.Code != http.StatusOK {
+		t.Fatalf("borrow status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	giveBack := map[string]any{"patron_id": patronID, "book_id": book.ID, "copies": 1}
+	if rec = a.Do(http.MethodPost, "/transactions/return", patron, giveBack); rec.Code != http.StatusOK {
+		t.Fatalf("return status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	// A failed change records no event.
+	if rec = a.Do(http.MethodPost, "/books", admin, newBook); rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("create duplicate book status = %v; want %v", rec.Code, http.StatusUnprocessableEntity)
+	}
+
+	ctx := context.Background()
+	if dispatched, err := a.App.DispatchEvents(ctx); err != nil || dispatched != 0 {
+		t.Fatalf("DispatchEvents() with the receiver down = %d, %v; want 0, nil", dispatched, err)
+	}
+
+	var list struct {
+		Events []data.Event `json:"events"`
+	}
+	a.Decode(a.Do(http.MethodGet, "/events?status=pending&sort=created_at", admin), &list)
+	var types []string
+	for _, event := range list.Events {
+		types = append(types, event.Type)
+	}
+	if want := []string{data.EventBookCreated, data.EventBookBorrowed, data.EventBookReturned}; !slices.Equal(types, want) {
+		t.Fatalf("GET /events?status=pending = %v; want %v", types, want)
+	}
+
+	borrowed := list.Events[1]
+	if borrowed.Attempts != 1 || borrowed.LastError == "" || !slices.Contains(borrowed.Delivered, "borrow-receipt") {
+		t.Errorf("borrowed event = %+v; want a failed attempt after the receipt was sent", borrowed)
+	}
+	var payload struct {
+		Transaction data.Transaction `json:"transaction"`
+		Copies      int              `json:"copies"`
+	}
+	if err := json.Unmarshal(borrowed.Payload, &payload); err != nil || payload.Transaction.BookID != book.ID || payload.Copies != 1 {
+		t.Errorf("borrowed event payload = %s; want the transaction of book %s", borrowed.Payload, book.ID)
+	}
+
+	var notifications struct {
+		Notifications []data.Notification `json:"notifications"`
+	}
+	a.Decode(a.Do(http.MethodGet, "/notifications?patron_id="+patronID, admin), &notifications)
+	if len(notifications.Notifications) != 1 || notifications.Notifications[0].Template != "borrowed" {
+		t.Errorf("GET /notifications = %+v; want one borrow receipt", notifications.Notifications)
+	}
+
+	down.Store(false)
+
+	// Failed events are retried after a backoff, which retrying them skips.
+	if dispatched, err := a.App.DispatchEvents(ctx); err != nil || dispatched != 0 {
+		t.Errorf("DispatchEvents() before the backoff = %d, %v; want 0, nil", dispatched, err)
+	}
+	for _, event := range list.Events {
+		if rec = a.Do(http.MethodPost, "/events/"+event.ID+"/retry", admin); rec.Code != http.StatusOK {
+			t.Fatalf("retry status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+		}
+	}
+	if dispatched, err := a.App.DispatchEvents(ctx); err != nil || dispatched != 3 {
+		t.Fatalf("DispatchEvents() = %d, %v; want 3, nil", dispatched, err)
+	}
+
+	if want := []string{data.EventBookCreated, data.EventBookBorrowed, data.EventBookReturned}; !slices.Equal(received, want) {
+		t.Errorf("webhook received %v; want %v", received, want)
+	}
+
+	a.Decode(a.Do(http.MethodGet, "/notifications?patron_id="+patronID, admin), &notifications)
+	if len(notifications.Notifications) != 1 {
+		t.Errorf("GET /notifications after the retry = %+v; want the borrow receipt sent once", notifications.Notifications)
+	}
+
+	retryPath := "/events/" + borrowed.ID + "/retry"
+	if rec = a.Do(http.MethodPost, retryPath, admin); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("POST %s of a dispatched event status = %v; want %v", retryPath, rec.Code, http.StatusUnprocessableEntity)
+	}
+
+	if rec = a.Do(http.MethodGet, "/events", patron); rec.Code != http.StatusForbidden {
+		t.Errorf("GET /events as a patron status = %v; want %v", rec.Code, http.StatusForbidden)
+	}
+}
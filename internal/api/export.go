@@ -0,0 +1,174 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"github.com/mzeevi/library/internal/data"
+	"mime"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Content types of exported search results.
+const (
+	csvContentType  = "text/csv"
+	xlsxContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+)
+
+// maxExportRecords is the maximum number of results which are exported.
+const maxExportRecords = 10000
+
+// exportContentTypes are the formats search results can be exported in by their content types.
+var exportContentTypes = map[string]data.OutputType{
+	csvContentType:  data.CSVOutputFormat,
+	xlsxContentType: data.XLSXOutputFormat,
+}
+
+var (
+	booksExportHeader        = []string{"id", "title", "isbn", "language", "format", "authors", "publishers", "genres", "pages", "edition", "copies", "borrowed_copies", "published_at", "call_numbers"}
+	patronsExportHeader      = []string{"id", "name", "email", "category", "activated"}
+	transactionsExportHeader = []string{"id", "patron_id", "book_id", "status", "borrowed_at", "due_date", "returned_at"}
+)
+
+// ExportInput selects exporting the results of a search as a file instead of returning a page of
+// them, either with the format query parameter or with the Accept header.
+type ExportInput struct {
+	Format string `query:"format" enum:"csv,xlsx" doc:"Export all the results (up to 10000) as a file of this format instead of returning a page of them"`
+	Accept string `header:"Accept"`
+}
+
+// exportFormat returns the format to export the results in, which is false if they are not exported.
+func (e *ExportInput) exportFormat() (data.OutputType, bool) {
+	if e.Format != "" {
+		return data.OutputType(e.Format), true
+	}
+
+	if mediaType, ok := acceptedMediaType(e.Accept, csvContentType, xlsxContentType); ok {
+		return exportContentTypes[mediaType], true
+	}
+
+	return "", false
+}
+
+// ExportOutput is the output of a search whose results can be exported. Its body is the page of
+// results, or the exported file with its content type and disposition.
+type ExportOutput struct {
+	ContentType        string `header:"Content-Type"`
+	ContentDisposition string `header:"Content-Disposition"`
+	Body               any
+}
+
+// exportResults exports records to a file named name with the export writer of format.
+func (app *Application) exportResults(ctx context.Context, name string, format data.OutputType, records [][]string) (*ExportOutput, error) {
+	b, err := exportRecords(format, records)
+	if err != nil {
+		return &ExportOutput{}, app.serverError(ctx, err)
+	}
+
+	contentType := xlsxContentType
+	if format == data.CSVOutputFormat {
+		contentType = csvContentType + "; charset=utf-8"
+	}
+
+	resp := &ExportOutput{
+		ContentType:        contentType,
+		ContentDisposition: mime.FormatMediaType("attachment", map[string]string{"filename": fmt.Sprintf("%s.%s", name, format)}),
+		Body:               b,
+	}
+
+	return resp, nil
+}
+
+// exportRecords writes records to a temporary file with the export writer of format, and returns
+// the contents of the file.
+func exportRecords(format data.OutputType, records [][]string) ([]byte, error) {
+	output, err := data.NewOutput(format)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "export-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "export")
+	if err = output.CreateWriter(filename, string(format)); err != nil {
+		return nil, err
+	}
+
+	for _, record := range records {
+		if err = output.WriteRecord(record); err != nil {
+			_ = output.CloseWriter()
+			return nil, err
+		}
+	}
+
+	if err = output.CloseWriter(); err != nil {
+		return nil, err
+	}
+
+	return os.ReadFile(fmt.Sprintf("%s.%s", filename, format))
+}
+
+// bookRecords returns the records of books to export, with a header.
+func bookRecords(books []data.Book) [][]string {
+	records := [][]string{booksExportHeader}
+	for _, book := range books {
+		records = append(records, []string{
+			book.ID, book.Title, book.ISBN(), book.Language, book.Format,
+			strings.Join(book.Authors, "; "), strings.Join(book.Publishers, "; "), strings.Join(book.Genres, "; "),
+			strconv.Itoa(book.Pages), strconv.Itoa(book.Edition), strconv.Itoa(book.Copies), strconv.Itoa(book.BorrowedCopies),
+			book.PublishedAt.Format(time.DateOnly), strings.Join(callNumbers(book.Holdings), "; "),
+		})
+	}
+
+	return records
+}
+
+// callNumbers returns the call numbers of the copies of a book, with the number of each copy.
+func callNumbers(holdings []data.Holding) []string {
+	values := make([]string, 0, len(holdings))
+	for _, holding := range holdings {
+		if holding.CallNumber != "" {
+			values = append(values, fmt.Sprintf("%d: %s", holding.Copy, holding.CallNumber))
+		}
+	}
+
+	return values
+}
+
+// patronRecords returns the records of patrons to export, with a header.
+func patronRecords(patrons []data.Patron) [][]string {
+	records := [][]string{patronsExportHeader}
+	for _, patron := range patrons {
+		records = append(records, []string{patron.ID, patron.Name, patron.Email, patron.Category, strconv.FormatBool(patron.Activated)})
+	}
+
+	return records
+}
+
+// transactionRecords returns the records of transactions to export, with a header. Times are
+// formatted in loc.
+func transactionRecords(transactions []data.Transaction, loc *time.Location) [][]string {
+	formatTime := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.In(loc).Format(time.RFC3339)
+	}
+
+	records := [][]string{transactionsExportHeader}
+	for _, transaction := range transactions {
+		records = append(records, []string{
+			transaction.ID, transaction.PatronID, transaction.BookID, transaction.Status,
+			formatTime(transaction.BorrowedAt), formatTime(transaction.DueDate), formatTime(transaction.ReturnedAt),
+		})
+	}
+
+	return records
+}
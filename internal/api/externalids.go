@@ -0,0 +1,180 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/mzeevi/library/internal/data"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const (
+	errExternalIDExistsMsg = "the %s ID %s belongs to another %s"
+)
+
+const (
+	// sisSystem is the system of the IDs of students in the school information system, which the
+	// student IDs of imported rosters are.
+	sisSystem = "sis"
+	// maxExternalIDLength is the longest external ID, such as a barcode or a student ID.
+	maxExternalIDLength = 100
+)
+
+// externalSystemRX matches the names of the systems of external IDs, such as sis or legacy_ils,
+// which are the keys of the external IDs of patrons and books.
+var externalSystemRX = regexp.MustCompile(`^[a-z][a-z0-9_]{0,31}$`)
+
+type GetPatronByExternalIDInput struct {
+	System string `path:"system" doc:"Name of the system of the ID, such as sis"`
+	Value  string `path:"value" doc:"ID of the Patron in the system"`
+}
+
+type GetPatronByExternalIDOutput struct {
+	Body data.Patron `json:"patron"`
+}
+
+type GetBookByExternalIDInput struct {
+	System string `path:"system" doc:"Name of the system of the ID, such as legacy_ils"`
+	Value  string `path:"value" doc:"ID of the Book in the system"`
+}
+
+type GetBookByExternalIDOutput struct {
+	Body data.Book `json:"book"`
+}
+
+// Resolve validates the input in GetPatronByExternalIDInput.
+func (p *GetPatronByExternalIDInput) Resolve(ctx huma.Context) []error {
+	return validateExternalID(p.System, &p.Value, "path.system", "path.value")
+}
+
+// Resolve validates the input in GetBookByExternalIDInput.
+func (b *GetBookByExternalIDInput) Resolve(ctx huma.Context) []error {
+	return validateExternalID(b.System, &b.Value, "path.system", "path.value")
+}
+
+// validateExternalIDs trims the external IDs of a patron or a book in place, and checks that their
+// systems are valid names and that the IDs are not blank.
+func validateExternalIDs(ids map[string]string, location string) []error {
+	var errs []error
+
+	for _, system := range slices.Sorted(maps.Keys(ids)) {
+		value := ids[system]
+		errs = append(errs, validateExternalID(system, &value, location+"."+system, location+"."+system)...)
+		ids[system] = value
+	}
+
+	return errs
+}
+
+// validateExternalID trims an external ID in place, and checks that its system is a valid name and
+// that it is not blank.
+func validateExternalID(system string, value *string, systemLocation, valueLocation string) []error {
+	var errs []error
+
+	if !externalSystemRX.MatchString(system) {
+		errs = append(errs, &huma.ErrorDetail{
+			Location: systemLocation,
+			Message:  "System must be a lowercase name of letters, digits and underscores, such as sis",
+			Value:    system,
+		})
+	}
+
+	*value = strings.TrimSpace(*value)
+	if *value == "" || len(*value) > maxExternalIDLength {
+		errs = append(errs, &huma.ErrorDetail{
+			Location: valueLocation,
+			Message:  fmt.Sprintf("External ID must not be blank or longer than %d characters", maxExternalIDLength),
+			Value:    *value,
+		})
+	}
+
+	return errs
+}
+
+// getPatronByExternalIDHandler handles a request to get a patron by their ID in another system,
+// such as the school information system.
+func (app *Application) getPatronByExternalIDHandler(ctx context.Context, input *GetPatronByExternalIDInput) (*GetPatronByExternalIDOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	patron, err := app.Models.Patrons.Get(ctx, data.PatronFilter{ExternalID: &data.ExternalID{System: input.System, Value: input.Value}})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return &GetPatronByExternalIDOutput{}, huma.Error404NotFound(errNotFoundMsg)
+		default:
+			return &GetPatronByExternalIDOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	resp := &GetPatronByExternalIDOutput{
+		Body: *patron,
+	}
+
+	return resp, nil
+}
+
+// getBookByExternalIDHandler handles a request to get a book by its ID in another system, such as
+// its barcode in a legacy catalog.
+func (app *Application) getBookByExternalIDHandler(ctx context.Context, input *GetBookByExternalIDInput) (*GetBookByExternalIDOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	book, err := app.Models.Books.Get(ctx, data.BookFilter{ExternalID: &data.ExternalID{System: input.System, Value: input.Value}})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return &GetBookByExternalIDOutput{}, huma.Error404NotFound(errNotFoundMsg)
+		default:
+			return &GetBookByExternalIDOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	resp := &GetBookByExternalIDOutput{
+		Body: *book,
+	}
+
+	return resp, nil
+}
+
+// checkPatronExternalIDs checks that no patron other than the patron with the ID id has one of the
+// external IDs, so that a lookup by an external ID finds one patron. It returns a huma error if
+// one does.
+func (app *Application) checkPatronExternalIDs(ctx context.Context, ids map[string]string, id string) error {
+	for _, system := range slices.Sorted(maps.Keys(ids)) {
+		patron, err := app.Models.Patrons.Get(ctx, data.PatronFilter{ExternalID: &data.ExternalID{System: system, Value: ids[system]}})
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			continue
+		case err != nil:
+			return err
+		case patron.ID != id:
+			return huma.Error422UnprocessableEntity(fmt.Sprintf(errExternalIDExistsMsg, system, ids[system], "patron"))
+		}
+	}
+
+	return nil
+}
+
+// checkBookExternalIDs checks that no book other than the book with the ID id has one of the
+// external IDs, so that a lookup by an external ID finds one book. It returns a huma error if one
+// does.
+func (app *Application) checkBookExternalIDs(ctx context.Context, ids map[string]string, id string) error {
+	for _, system := range slices.Sorted(maps.Keys(ids)) {
+		book, err := app.Models.Books.Get(ctx, data.BookFilter{ExternalID: &data.ExternalID{System: system, Value: ids[system]}})
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			continue
+		case err != nil:
+			return err
+		case book.ID != id:
+			return huma.Error422UnprocessableEntity(fmt.Sprintf(errExternalIDExistsMsg, system, ids[system], "book"))
+		}
+	}
+
+	return nil
+}
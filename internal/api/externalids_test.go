@@ -0,0 +1,105 @@
+package api_test
+
+import (
+	"github.com/mzeevi/library/internal/api/apitest"
+	"github.com/mzeevi/library/internal/auth"
+	"github.com/mzeevi/library/internal/data"
+	"net/http"
+	"testing"
+)
+
+func TestPatronExternalIDs(t *testing.T) {
+	a := apitest.New(t)
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+
+	noa := apitest.Patron("noa@example.com")
+	noa.ExternalIDs = map[string]string{"sis": "1001"}
+	noaID := a.SeedPatron(noa)
+	danID := a.SeedPatron(apitest.Patron("dan@example.com"))
+
+	rec := a.Do(http.MethodGet, "/patrons/external-ids/sis/1001", admin)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /patrons/external-ids/sis/1001 status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var patron data.Patron
+	a.Decode(rec, &patron)
+	if patron.ID != noaID || patron.ExternalIDs["sis"] != "1001" {
+		t.Errorf("patron = %+v; want %s with sis ID 1001", patron, noaID)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   any
+		want   int
+	}{
+		{name: "get unknown", method: http.MethodGet, path: "/patrons/external-ids/sis/1002", want: http.StatusNotFound},
+		{name: "get unknown system", method: http.MethodGet, path: "/patrons/external-ids/legacy_ils/1001", want: http.StatusNotFound},
+		{name: "get invalid system", method: http.MethodGet, path: "/patrons/external-ids/SIS/1001", want: http.StatusUnprocessableEntity},
+		{name: "update taken", method: http.MethodPut, path: "/patrons/" + danID, body: map[string]any{"external_ids": map[string]string{"sis": "1001"}}, want: http.StatusUnprocessableEntity},
+		{name: "update blank", method: http.MethodPut, path: "/patrons/" + danID, body: map[string]any{"external_ids": map[string]string{"sis": " "}}, want: http.StatusUnprocessableEntity},
+		{name: "update own", method: http.MethodPut, path: "/patrons/" + noaID, body: map[string]any{"external_ids": map[string]string{"sis": "1001", "legacy_ils": "P-77"}}, want: http.StatusOK},
+		{name: "update", method: http.MethodPut, path: "/patrons/" + danID, body: map[string]any{"external_ids": map[string]string{"sis": " 1002 "}}, want: http.StatusOK},
+		{name: "get updated", method: http.MethodGet, path: "/patrons/external-ids/sis/1002", want: http.StatusOK},
+		{name: "get added", method: http.MethodGet, path: "/patrons/external-ids/legacy_ils/P-77", want: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := []any{admin}
+			if tt.body != nil {
+				args = append(args, tt.body)
+			}
+
+			if rec := a.WithTB(t).Do(tt.method, tt.path, args...); rec.Code != tt.want {
+				t.Errorf("%s %s status = %v; want %v (body: %s)", tt.method, tt.path, rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestBookExternalIDs(t *testing.T) {
+	a := apitest.New(t)
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+	reader := a.PatronAuth(a.SeedPatron(apitest.Patron("reader@example.com", auth.ReadBooksPermission)))
+
+	book := apitest.Book("9780306406157", 1)
+	book.ExternalIDs = map[string]string{"legacy_ils": "B004213"}
+	bookID := a.SeedBook(book)
+	otherID := a.SeedBook(apitest.Book("9781861972712", 1))
+
+	rec := a.Do(http.MethodGet, "/books/external-ids/legacy_ils/B004213", reader)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /books/external-ids/legacy_ils/B004213 status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var found data.Book
+	a.Decode(rec, &found)
+	if found.ID != bookID {
+		t.Errorf("book ID = %s; want %s", found.ID, bookID)
+	}
+
+	if rec := a.Do(http.MethodGet, "/books/external-ids/accession/B004213", reader); rec.Code != http.StatusNotFound {
+		t.Errorf("GET of an unknown system status = %v; want %v", rec.Code, http.StatusNotFound)
+	}
+
+	taken := map[string]any{"external_ids": map[string]string{"legacy_ils": "B004213"}}
+	if rec := a.Do(http.MethodPut, "/books/"+otherID, admin, taken); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("PUT of a taken external ID status = %v; want %v", rec.Code, http.StatusUnprocessableEntity)
+	}
+
+	accession := map[string]any{"external_ids": map[string]string{"accession": "1999-0042"}}
+	if rec := a.Do(http.MethodPut, "/books/"+otherID, admin, accession); rec.Code != http.StatusOK {
+		t.Fatalf("PUT of an external ID status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	rec = a.Do(http.MethodGet, "/books/external-ids/accession/1999-0042", reader)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET by the accession number status = %v; want %v", rec.Code, http.StatusOK)
+	}
+	a.Decode(rec, &found)
+	if found.ID != otherID {
+		t.Errorf("book ID = %s; want %s", found.ID, otherID)
+	}
+}
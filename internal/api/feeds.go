@@ -0,0 +1,139 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/mzeevi/library/internal/auth"
+	"github.com/mzeevi/library/internal/calendar"
+	"github.com/mzeevi/library/internal/data"
+	"net/url"
+	"time"
+)
+
+const (
+	errFeedTokenPatronOnlyMsg = "feed tokens are only issued to patrons"
+)
+
+const (
+	dueDatesFeedProductID = "-//Library//Due Dates//EN"
+	// dueDateReminder is how long before the day a book is due its calendar event alerts.
+	dueDateReminder = 24 * time.Hour
+)
+
+type CreateFeedTokenOutput struct {
+	Body FeedTokenInfo
+}
+
+type FeedTokenInfo struct {
+	FeedToken string    `json:"feed_token"`
+	FeedPath  string    `json:"feed_path" doc:"Path of the feed with the token, to subscribe to in a calendar app"`
+	Expiry    time.Time `json:"expiry"`
+}
+
+type GetDueDatesFeedInput struct {
+	Token string `query:"token" required:"true" doc:"Feed token of the patron"`
+}
+
+type GetDueDatesFeedOutput struct {
+	ContentType  string `header:"Content-Type"`
+	CacheControl string `header:"Cache-Control"`
+	Body         []byte
+}
+
+// createFeedTokenHandler handles a request of a patron to create a token for its due dates calendar feed.
+func (app *Application) createFeedTokenHandler(ctx context.Context, _ *struct{}) (*CreateFeedTokenOutput, error) {
+	patron, ok := patronFromContext(ctx)
+	if !ok {
+		return &CreateFeedTokenOutput{}, huma.Error403Forbidden(errFeedTokenPatronOnlyMsg)
+	}
+
+	expiry := time.Now().Add(app.Config.JTW.FeedTokenTTL)
+
+	jwtBytes, err := auth.CreateFeedJWT(patron.ID, app.jwtSecret.Value(), app.Config.JTW.Issuer, app.Config.JTW.Audience, app.Config.JTW.FeedTokenTTL)
+	if err != nil {
+		return &CreateFeedTokenOutput{}, app.serverError(ctx, err)
+	}
+
+	resp := &CreateFeedTokenOutput{
+		Body: FeedTokenInfo{
+			FeedToken: string(jwtBytes),
+			FeedPath:  fmt.Sprintf("%s/%s/%s/%s?%s", basePath, patronsKey, meKey, dueDatesFeedKey, url.Values{"token": {string(jwtBytes)}}.Encode()),
+			Expiry:    expiry,
+		},
+	}
+
+	return resp, nil
+}
+
+// getDueDatesFeedHandler handles a request to get the iCalendar feed of the due dates of the books
+// borrowed by the patron of a feed token. The token is passed in the query, since calendar apps
+// can't authenticate when they poll a feed.
+func (app *Application) getDueDatesFeedHandler(ctx context.Context, input *GetDueDatesFeedInput) (*GetDueDatesFeedOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	claims, err := app.checkJWT(input.Token)
+	if err != nil || !claims.Valid(time.Now()) || claims.Issuer != app.Config.JTW.Issuer || !claims.AcceptAudience(auth.FeedAudience(app.Config.JTW.Audience)) {
+		return &GetDueDatesFeedOutput{}, huma.Error401Unauthorized(errInvalidTokenMsg)
+	}
+
+	patron, err := app.Models.Patrons.Get(ctx, data.PatronFilter{ID: ptr(data.PatronID(claims.Subject))})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return &GetDueDatesFeedOutput{}, huma.Error401Unauthorized(errInvalidTokenMsg)
+		default:
+			return &GetDueDatesFeedOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	if patron.Suspended {
+		return &GetDueDatesFeedOutput{}, huma.Error401Unauthorized(errInvalidTokenMsg)
+	}
+
+	transactions, _, err := app.Models.Transactions.GetAll(ctx, data.TransactionFilter{PatronID: ptr(data.PatronID(patron.ID)), Status: ptr(data.TransactionStatusBorrowed)}, data.Paginator{}, data.Sorter{})
+	if err != nil {
+		return &GetDueDatesFeedOutput{}, app.serverError(ctx, err)
+	}
+
+	cal := &calendar.Calendar{
+		ProductID: dueDatesFeedProductID,
+		Name:      "Library due dates",
+	}
+
+	for _, transaction := range transactions {
+		title := "a book"
+		book, err := app.Models.Books.Get(ctx, data.BookFilter{ID: ptr(data.BookID(transaction.BookID))})
+		switch {
+		case err == nil:
+			title = fmt.Sprintf("%q", book.Title)
+		case !errors.Is(err, data.ErrDocumentNotFound):
+			return &GetDueDatesFeedOutput{}, app.serverError(ctx, err)
+		}
+
+		cal.Events = append(cal.Events, calendar.Event{
+			UID:         fmt.Sprintf("transaction-%s@%s", transaction.ID, app.Config.JTW.Issuer),
+			Date:        transaction.DueDate.In(app.location),
+			Summary:     fmt.Sprintf("Return %s to the library", title),
+			Description: fmt.Sprintf("Borrowed on %s.", transaction.BorrowedAt.In(app.location).Format("Monday, 2 January 2006")),
+			Stamp:       transaction.UpdatedAt,
+			Reminder:    dueDateReminder,
+		})
+	}
+
+	var b bytes.Buffer
+	if err = cal.Encode(&b); err != nil {
+		return &GetDueDatesFeedOutput{}, app.serverError(ctx, err)
+	}
+
+	resp := &GetDueDatesFeedOutput{
+		ContentType:  calendar.ContentType,
+		CacheControl: "private, max-age=900",
+		Body:         b.Bytes(),
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,89 @@
+package api_test
+
+import (
+	"context"
+	"github.com/mzeevi/library/internal/api"
+	"github.com/mzeevi/library/internal/api/apitest"
+	"github.com/mzeevi/library/internal/auth"
+	"github.com/mzeevi/library/internal/data"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDueDatesFeed(t *testing.T) {
+	a := apitest.New(t, func(app *api.Application) {
+		app.Config.JTW.FeedTokenTTL = time.Hour
+	})
+	a.SeedAdmin("admin", "admin-password")
+
+	borrowedBook := apitest.Book("9780306406157", 3)
+	borrowedBook.Title = "The Borrowed Book"
+	borrowedBookID := a.SeedBook(borrowedBook)
+	returnedBook := apitest.Book("9781861972712", 3)
+	returnedBook.Title = "The Returned Book"
+	returnedBookID := a.SeedBook(returnedBook)
+
+	patronID := a.SeedPatron(apitest.Patron("patron@example.com", auth.ReadPatronPermission))
+	otherPatronID := a.SeedPatron(apitest.Patron("other@example.com", auth.ReadPatronPermission))
+
+	now := time.Now()
+	transactions := []*data.Transaction{
+		data.NewTransaction("", patronID, borrowedBookID, data.TransactionStatusBorrowed, now.Add(-24*time.Hour), time.Date(2030, time.March, 14, 12, 0, 0, 0, time.UTC)),
+		data.NewTransaction("", patronID, returnedBookID, data.TransactionStatusReturned, now.Add(-20*24*time.Hour), now.Add(-6*24*time.Hour)),
+		data.NewTransaction("", otherPatronID, returnedBookID, data.TransactionStatusBorrowed, now.Add(-24*time.Hour), now.Add(2*24*time.Hour)),
+	}
+	for _, transaction := range transactions {
+		if _, err := a.Models.Transactions.Insert(context.Background(), transaction); err != nil {
+			t.Fatalf("failed to seed transaction: %v", err)
+		}
+	}
+
+	if rec := a.Do(http.MethodPost, "/token/feed", apitest.AdminAuth("admin", "admin-password")); rec.Code != http.StatusForbidden {
+		t.Errorf("create feed token as admin status = %v; want %v", rec.Code, http.StatusForbidden)
+	}
+
+	rec := a.Do(http.MethodPost, "/token/feed", a.PatronAuth(patronID))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("create feed token status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	var token api.FeedTokenInfo
+	a.Decode(rec, &token)
+
+	rec = a.Do(http.MethodGet, token.FeedPath)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("get feed status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if got := rec.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/calendar") {
+		t.Errorf("get feed Content-Type = %q; want text/calendar", got)
+	}
+
+	feed := rec.Body.String()
+	if got := strings.Count(feed, "BEGIN:VEVENT"); got != 1 {
+		t.Errorf("feed has %d events; want 1 for the borrowed book (feed: %s)", got, feed)
+	}
+	if !strings.Contains(feed, "The Borrowed Book") || !strings.Contains(feed, "DTSTART;VALUE=DATE:20300314") {
+		t.Errorf("feed = %q; want the due date of the borrowed book", feed)
+	}
+
+	authToken := strings.TrimPrefix(a.PatronAuth(patronID), "Authorization: Bearer ")
+	tests := []struct {
+		name string
+		path string
+		args []any
+		want int
+	}{
+		{name: "without a token", path: "/patrons/me/due-dates.ics", want: http.StatusUnprocessableEntity},
+		{name: "with an authentication token", path: "/patrons/me/due-dates.ics?token=" + authToken, want: http.StatusUnauthorized},
+		{name: "with a tampered token", path: token.FeedPath + "x", want: http.StatusUnauthorized},
+		{name: "feed token as authentication", path: "/patrons/" + patronID, args: []any{"Authorization: Bearer " + token.FeedToken}, want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		if rec := a.Do(http.MethodGet, tt.path, tt.args...); rec.Code != tt.want {
+			t.Errorf("get %s status = %v; want %v", tt.name, rec.Code, tt.want)
+		}
+	}
+}
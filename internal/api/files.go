@@ -0,0 +1,438 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/mzeevi/library/internal/auth"
+	"github.com/mzeevi/library/internal/data"
+	"github.com/mzeevi/library/internal/storage"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	errFilesDisabledMsg       = "files are not attached to books"
+	errFileTypeMsg            = "the file must be a PDF or an EPUB"
+	errNoFileMsg              = "the book has no file"
+	errDownloadPatronOnlyMsg  = "download URLs are only issued to patrons"
+	errDownloadNotBorrowedMsg = "the book is not borrowed by the patron"
+	errFileContentMsg         = "the content of the file does not match its type"
+)
+
+// Content types of the files attached to books.
+const (
+	contentTypePDF  = "application/pdf"
+	contentTypeEPUB = "application/epub+zip"
+)
+
+// defaultDownloadURLTTL is the lifetime of download URLs when none is configured.
+const defaultDownloadURLTTL = 15 * time.Minute
+
+// fileSignatures are the bytes which the content of the files of each content type starts with.
+var fileSignatures = map[string][]byte{
+	contentTypePDF:  []byte("%PDF-"),
+	contentTypeEPUB: []byte("PK\x03\x04"),
+}
+
+// fileExtensions are the extensions of the files of each content type.
+var fileExtensions = map[string]string{
+	contentTypePDF:  ".pdf",
+	contentTypeEPUB: ".epub",
+}
+
+type UploadBookFileInput struct {
+	ID          data.BookID `json:"id" path:"id"`
+	ContentType string      `header:"Content-Type" doc:"application/pdf or application/epub+zip"`
+	Filename    string      `query:"filename" maxLength:"255" doc:"Name which the file is downloaded as, the ID of the book by default"`
+	RawBody     []byte
+}
+
+type UploadBookFileOutput struct {
+	Body data.Book `json:"book"`
+}
+
+type DeleteBookFileInput struct {
+	ID data.BookID `json:"id" path:"id"`
+}
+
+type DeleteBookFileOutput struct {
+	Body data.Book `json:"book"`
+}
+
+type GetBookDownloadInput struct {
+	ID data.BookID `json:"id" path:"id"`
+}
+
+type GetBookDownloadOutput struct {
+	Body DownloadInfo
+}
+
+type DownloadInfo struct {
+	DownloadPath string    `json:"download_path" doc:"Path of the file of the book with the download token, which can be opened without authenticating until the expiry"`
+	Expiry       time.Time `json:"expiry"`
+}
+
+type GetBookFileInput struct {
+	ID    data.BookID `json:"id" path:"id"`
+	Token string      `query:"token" required:"true" doc:"Download token of the patron"`
+}
+
+type GetBookFileOutput struct {
+	ContentType        string `header:"Content-Type"`
+	ContentDisposition string `header:"Content-Disposition"`
+	ContentLength      string `header:"Content-Length"`
+	CacheControl       string `header:"Cache-Control"`
+	ContentTypeOptions string `header:"X-Content-Type-Options"`
+	Body               func(ctx huma.Context)
+}
+
+func (f *UploadBookFileInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	if err := validateID(&f.ID, "path.id"); err != nil {
+		errs = append(errs, err)
+	}
+
+	mediaType, _, err := mime.ParseMediaType(f.ContentType)
+	if _, ok := fileSignatures[mediaType]; err != nil || !ok {
+		errs = append(errs, &huma.ErrorDetail{
+			Location: "header.Content-Type",
+			Message:  errFileTypeMsg,
+			Value:    f.ContentType,
+		})
+	} else {
+		f.ContentType = mediaType
+	}
+
+	// Only the base name is kept, so that the name of a file can't point to another directory
+	// when it is saved.
+	f.Filename = strings.TrimSpace(path.Base(strings.ReplaceAll(f.Filename, "\\", "/")))
+	if f.Filename == "." || f.Filename == "/" {
+		f.Filename = ""
+	}
+
+	return errs
+}
+
+func (f *DeleteBookFileInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	if err := validateID(&f.ID, "path.id"); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+func (f *GetBookDownloadInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	if err := validateID(&f.ID, "path.id"); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+func (f *GetBookFileInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	if err := validateID(&f.ID, "path.id"); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// uploadBookFileHandler handles a request to attach a file to a book, replacing its file. The file
+// is stored before the book is updated, and the replaced file is deleted after it.
+func (app *Application) uploadBookFileHandler(ctx context.Context, input *UploadBookFileInput) (*UploadBookFileOutput, error) {
+	if app.files == nil {
+		return &UploadBookFileOutput{}, huma.Error422UnprocessableEntity(errFilesDisabledMsg)
+	}
+
+	// The content must be of the declared type, so that it is not served as another type.
+	if !bytes.HasPrefix(input.RawBody, fileSignatures[input.ContentType]) {
+		return &UploadBookFileOutput{}, huma.Error422UnprocessableEntity(errFileContentMsg)
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), fileTimeout)
+	defer cancel()
+
+	book, err := app.Models.Books.Get(ctx, data.BookFilter{ID: &input.ID})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return &UploadBookFileOutput{}, huma.Error404NotFound(errNotFoundMsg)
+		default:
+			return &UploadBookFileOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	suffix := make([]byte, 16)
+	if _, err = rand.Read(suffix); err != nil {
+		return &UploadBookFileOutput{}, app.serverError(ctx, err)
+	}
+
+	extension := fileExtensions[input.ContentType]
+	name := input.Filename
+	if name == "" {
+		name = book.ID + extension
+	}
+
+	hash := sha256.Sum256(input.RawBody)
+	file := &data.BookFile{
+		Key:         fmt.Sprintf("%s/%s/%s%s", booksKey, book.ID, hex.EncodeToString(suffix), extension),
+		Name:        name,
+		ContentType: input.ContentType,
+		Size:        int64(len(input.RawBody)),
+		SHA256:      hex.EncodeToString(hash[:]),
+		UploadedAt:  time.Now(),
+	}
+
+	if err = app.files.Put(ctx, file.Key, input.RawBody, file.ContentType); err != nil {
+		return &UploadBookFileOutput{}, app.serverError(ctx, err)
+	}
+
+	replaced := book.File
+	book.File = file
+
+	err = app.Models.Transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := app.Models.Books.Update(ctx, data.BookFilter{ID: &input.ID}, book); err != nil {
+			switch {
+			case errors.Is(err, data.ErrEditConflict):
+				return huma.Error409Conflict(errConflictMsg)
+			case errors.Is(err, data.ErrDocumentNotFound):
+				return huma.Error404NotFound(errNotFoundMsg)
+			default:
+				return err
+			}
+		}
+
+		return app.recordEvent(ctx, data.EventBookUpdated, book)
+	})
+	if err != nil {
+		app.deleteBookFile(ctx, file)
+		return &UploadBookFileOutput{}, app.transactionError(ctx, err)
+	}
+
+	app.deleteBookFile(ctx, replaced)
+
+	resp := &UploadBookFileOutput{
+		Body: *book,
+	}
+
+	return resp, nil
+}
+
+// deleteBookFileHandler handles a request to remove the file of a book.
+func (app *Application) deleteBookFileHandler(ctx context.Context, input *DeleteBookFileInput) (*DeleteBookFileOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	book, err := app.Models.Books.Get(ctx, data.BookFilter{ID: &input.ID})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return &DeleteBookFileOutput{}, huma.Error404NotFound(errNotFoundMsg)
+		default:
+			return &DeleteBookFileOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	if book.File == nil {
+		return &DeleteBookFileOutput{}, huma.Error404NotFound(errNoFileMsg)
+	}
+
+	removed := book.File
+	book.File = nil
+
+	err = app.Models.Transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := app.Models.Books.Update(ctx, data.BookFilter{ID: &input.ID}, book); err != nil {
+			switch {
+			case errors.Is(err, data.ErrEditConflict):
+				return huma.Error409Conflict(errConflictMsg)
+			case errors.Is(err, data.ErrDocumentNotFound):
+				return huma.Error404NotFound(errNotFoundMsg)
+			default:
+				return err
+			}
+		}
+
+		return app.recordEvent(ctx, data.EventBookUpdated, book)
+	})
+	if err != nil {
+		return &DeleteBookFileOutput{}, app.transactionError(ctx, err)
+	}
+
+	app.deleteBookFile(ctx, removed)
+
+	resp := &DeleteBookFileOutput{
+		Body: *book,
+	}
+
+	return resp, nil
+}
+
+// getBookDownloadHandler handles a request of a patron to download the file of a book which they
+// borrow, returning a signed URL of the file which expires after the configured lifetime.
+func (app *Application) getBookDownloadHandler(ctx context.Context, input *GetBookDownloadInput) (*GetBookDownloadOutput, error) {
+	patron, ok := patronFromContext(ctx)
+	if !ok {
+		return &GetBookDownloadOutput{}, huma.Error403Forbidden(errDownloadPatronOnlyMsg)
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	if _, err := app.downloadableFile(ctx, patron.ID, string(input.ID)); err != nil {
+		return &GetBookDownloadOutput{}, err
+	}
+
+	ttl := app.Config.Files.DownloadURLTTL
+	if ttl <= 0 {
+		ttl = defaultDownloadURLTTL
+	}
+	expiry := time.Now().Add(ttl)
+
+	jwtBytes, err := auth.CreateDownloadJWT(patron.ID, string(input.ID), app.jwtSecret.Value(), app.Config.JTW.Issuer, app.Config.JTW.Audience, ttl)
+	if err != nil {
+		return &GetBookDownloadOutput{}, app.serverError(ctx, err)
+	}
+
+	resp := &GetBookDownloadOutput{
+		Body: DownloadInfo{
+			DownloadPath: fmt.Sprintf("%s/%s/%s/%s?%s", basePath, booksKey, input.ID, fileKey, url.Values{"token": {string(jwtBytes)}}.Encode()),
+			Expiry:       expiry,
+		},
+	}
+
+	return resp, nil
+}
+
+// getBookFileHandler handles a request to download the file of a book with a download token. The
+// token is passed in the query, so that the URL can be opened by a browser or an e-reader. The
+// patron of the token must still borrow the book, so that a URL stops working once it is returned.
+func (app *Application) getBookFileHandler(ctx context.Context, input *GetBookFileInput) (*GetBookFileOutput, error) {
+	claims, err := app.checkJWT(input.Token)
+	if err != nil || !claims.Valid(time.Now()) || claims.Issuer != app.Config.JTW.Issuer || !claims.AcceptAudience(auth.DownloadAudience(app.Config.JTW.Audience, string(input.ID))) {
+		return &GetBookFileOutput{}, huma.Error401Unauthorized(errInvalidTokenMsg)
+	}
+
+	// The context is canceled once the file was written, after the handler returns.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), fileTimeout)
+
+	file, err := app.downloadableFile(ctx, claims.Subject, string(input.ID))
+	if err != nil {
+		cancel()
+		return &GetBookFileOutput{}, err
+	}
+
+	content, err := app.files.Open(ctx, file.Key)
+	if err != nil {
+		cancel()
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			return &GetBookFileOutput{}, huma.Error404NotFound(errNoFileMsg)
+		default:
+			return &GetBookFileOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	resp := &GetBookFileOutput{
+		ContentType:        file.ContentType,
+		ContentDisposition: mime.FormatMediaType("attachment", map[string]string{"filename": file.Name}),
+		ContentLength:      strconv.FormatInt(file.Size, 10),
+		CacheControl:       "private, no-store",
+		ContentTypeOptions: "nosniff",
+		Body: func(hctx huma.Context) {
+			defer cancel()
+			defer content.Close()
+
+			// Large files take longer to write than the write timeout of the server.
+			if w, ok := hctx.BodyWriter().(http.ResponseWriter); ok {
+				_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(fileTimeout))
+			}
+
+			if _, err := io.Copy(hctx.BodyWriter(), content); err != nil {
+				app.logger.Error("failed to write book file", slog.String("key", file.Key), slog.Any("error", err))
+			}
+		},
+	}
+
+	return resp, nil
+}
+
+// downloadableFile returns the file of a book if the patron borrows the book.
+func (app *Application) downloadableFile(ctx context.Context, patronID, bookID string) (*data.BookFile, error) {
+	book, err := app.Models.Books.Get(ctx, data.BookFilter{ID: ptr(data.BookID(bookID))})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return nil, huma.Error404NotFound(errNotFoundMsg)
+		default:
+			return nil, app.serverError(ctx, err)
+		}
+	}
+
+	if app.files == nil || book.File == nil {
+		return nil, huma.Error404NotFound(errNoFileMsg)
+	}
+
+	borrowed, err := app.borrowsBook(ctx, patronID, book.ID)
+	if err != nil {
+		return nil, app.serverError(ctx, err)
+	}
+	if !borrowed {
+		return nil, huma.Error403Forbidden(errDownloadNotBorrowedMsg)
+	}
+
+	return book.File, nil
+}
+
+// borrowsBook reports whether a patron has an active loan of a book. E-book loans are not active
+// after their due date, even before they are returned automatically.
+func (app *Application) borrowsBook(ctx context.Context, patronID, bookID string) (bool, error) {
+	transactions, _, err := app.Models.Transactions.GetAll(ctx, data.TransactionFilter{
+		PatronID: ptr(data.PatronID(patronID)),
+		BookID:   ptr(data.BookID(bookID)),
+		Status:   ptr(data.TransactionStatusBorrowed),
+	}, data.Paginator{}, data.Sorter{})
+	if err != nil {
+		return false, err
+	}
+
+	now := time.Now()
+	for _, transaction := range transactions {
+		if !transaction.Digital || transaction.DueDate.After(now) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// deleteBookFile deletes a file which is no longer attached to a book from the storage. Failures
+// are only logged, since the book was already updated.
+func (app *Application) deleteBookFile(ctx context.Context, file *data.BookFile) {
+	if file == nil || app.files == nil {
+		return
+	}
+
+	if err := app.files.Delete(ctx, file.Key); err != nil {
+		app.logger.Error("failed to delete book file", slog.String("key", file.Key), slog.Any("error", err))
+	}
+}
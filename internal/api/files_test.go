@@ -0,0 +1,132 @@
+package api_test
+
+import (
+	"context"
+	"github.com/mzeevi/library/internal/api"
+	"github.com/mzeevi/library/internal/api/apitest"
+	"github.com/mzeevi/library/internal/auth"
+	"github.com/mzeevi/library/internal/data"
+	"github.com/mzeevi/library/internal/storage"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestBookFiles(t *testing.T) {
+	dir := t.TempDir()
+	a := apitest.New(t, func(app *api.Application) {
+		app.Config.Files.Storage = storage.Local
+		app.Config.Files.Dir = dir
+	})
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+
+	bookID := a.SeedBook(apitest.Book("9780306406157", 1))
+	borrowerID := a.SeedPatron(apitest.Patron("borrower@example.com", auth.ReadBooksPermission))
+	otherID := a.SeedPatron(apitest.Patron("other@example.com", auth.ReadBooksPermission))
+
+	pdf := []byte("%PDF-1.7\nbook")
+	filePath := "/books/" + bookID + "/file"
+
+	if rec := a.Do(http.MethodPut, filePath, admin, "Content-Type: text/html", []byte("<script></script>")); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("upload html status = %v; want %v", rec.Code, http.StatusUnprocessableEntity)
+	}
+	if rec := a.Do(http.MethodPut, filePath, admin, "Content-Type: application/pdf", []byte("<script></script>")); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("upload html as pdf status = %v; want %v", rec.Code, http.StatusUnprocessableEntity)
+	}
+	if rec := a.Do(http.MethodPut, filePath+"?filename=book.pdf", a.PatronAuth(borrowerID), "Content-Type: application/pdf", pdf); rec.Code != http.StatusForbidden {
+		t.Errorf("upload by patron status = %v; want %v", rec.Code, http.StatusForbidden)
+	}
+
+	rec := a.Do(http.MethodPut, filePath+"?filename=../dune.pdf", admin, "Content-Type: application/pdf", pdf)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("upload status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var book data.Book
+	a.Decode(rec, &book)
+	if book.File == nil || book.File.Name != "dune.pdf" || book.File.Size != int64(len(pdf)) || book.File.ContentType != "application/pdf" {
+		t.Errorf("file = %+v; want the uploaded file", book.File)
+	}
+
+	ctx := context.Background()
+	uploaded, err := a.Models.Books.Get(ctx, data.BookFilter{ID: apitest.Ptr(data.BookID(bookID))})
+	if err != nil {
+		t.Fatalf("Books.Get() error = %v", err)
+	}
+
+	download := func(patronID string) *api.DownloadInfo {
+		rec := a.Do(http.MethodGet, "/books/"+bookID+"/download", a.PatronAuth(patronID))
+		if rec.Code != http.StatusOK {
+			return nil
+		}
+		var info api.DownloadInfo
+		a.Decode(rec, &info)
+		return &info
+	}
+
+	if info := download(borrowerID); info != nil {
+		t.Errorf("download URL before borrowing = %+v; want none", info)
+	}
+
+	if _, err = a.Models.Transactions.Insert(ctx, data.NewTransaction("", borrowerID, bookID, data.TransactionStatusBorrowed, time.Now(), time.Now().Add(7*24*time.Hour))); err != nil {
+		t.Fatalf("Transactions.Insert() error = %v", err)
+	}
+
+	info := download(borrowerID)
+	if info == nil {
+		t.Fatalf("download URL of the borrower = nil; want a URL")
+	}
+	if time.Until(info.Expiry) > 15*time.Minute || time.Until(info.Expiry) <= 0 {
+		t.Errorf("expiry = %v; want in the next 15 minutes", info.Expiry)
+	}
+	if other := download(otherID); other != nil {
+		t.Errorf("download URL of another patron = %+v; want none", other)
+	}
+
+	rec = a.Do(http.MethodGet, info.DownloadPath)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("download status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if rec.Body.String() != string(pdf) || rec.Header().Get("Content-Type") != "application/pdf" {
+		t.Errorf("download = %q (%s); want the uploaded file", rec.Body.String(), rec.Header().Get("Content-Type"))
+	}
+	if got := rec.Header().Get("Content-Disposition"); got != `attachment; filename=dune.pdf` {
+		t.Errorf("Content-Disposition = %s; want an attachment with the name of the file", got)
+	}
+
+	otherBookID := a.SeedBook(apitest.Book("9780140449136", 1))
+	if rec = a.Do(http.MethodGet, "/books/"+otherBookID+"/file?token="+info.DownloadPath[len(filePath+"?token="):]); rec.Code != http.StatusUnauthorized {
+		t.Errorf("download of another book status = %v; want %v", rec.Code, http.StatusUnauthorized)
+	}
+	feedToken, _ := auth.CreateFeedJWT(borrowerID, apitest.JWTSecret, apitest.Issuer, apitest.Audience, time.Hour)
+	if rec = a.Do(http.MethodGet, filePath+"?token="+string(feedToken)); rec.Code != http.StatusUnauthorized {
+		t.Errorf("download with a feed token status = %v; want %v", rec.Code, http.StatusUnauthorized)
+	}
+
+	// Replacing the file deletes the replaced file from the storage.
+	rec = a.Do(http.MethodPut, filePath, admin, "Content-Type: application/epub+zip", []byte("PK\x03\x04epub"))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("replace status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	stored, err := a.Models.Books.Get(ctx, data.BookFilter{ID: apitest.Ptr(data.BookID(bookID))})
+	if err != nil {
+		t.Fatalf("Books.Get() error = %v", err)
+	}
+	files := &storage.LocalStore{Dir: dir}
+	if _, err = files.Open(ctx, uploaded.File.Key); err != storage.ErrNotFound {
+		t.Errorf("Open() of the replaced file error = %v; want %v", err, storage.ErrNotFound)
+	}
+	if stored.File.Name != bookID+".epub" {
+		t.Errorf("name of the replaced file = %s; want the ID of the book", stored.File.Name)
+	}
+
+	if rec = a.Do(http.MethodDelete, filePath, admin); rec.Code != http.StatusOK {
+		t.Fatalf("delete status = %v; want %v", rec.Code, http.StatusOK)
+	}
+	if _, err = files.Open(ctx, stored.File.Key); err != storage.ErrNotFound {
+		t.Errorf("Open() of the deleted file error = %v; want %v", err, storage.ErrNotFound)
+	}
+	if rec = a.Do(http.MethodGet, info.DownloadPath); rec.Code != http.StatusNotFound {
+		t.Errorf("download of a deleted file status = %v; want %v", rec.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,224 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/mzeevi/library/internal/data"
+	"strings"
+	"time"
+)
+
+const (
+	errFineCanceledMsg      = "The transaction is canceled, so it has no fine"
+	errFineAlreadyWaivedMsg = "The fine of the transaction is already waived"
+	errNoFineToWaiveMsg     = "The transaction has no fine to waive"
+)
+
+// fineReasonOther is the reason code of fine corrections which are explained only by their note.
+const fineReasonOther = "other"
+
+type WaiveFineInput struct {
+	ID   string `json:"id" path:"id" doc:"ID of the Transaction which is fined"`
+	Body struct {
+		ReasonCode string `json:"reason_code" enum:"small_amount,first_offense,hardship,library_error,returned_in_book_drop,other" doc:"Why the fine is waived, which is recorded in the audit log"`
+		Note       string `json:"note,omitempty" required:"false" maxLength:"500" doc:"Details of the reason, required if the reason code is other"`
+	}
+}
+
+type AdjustFineInput struct {
+	ID   string `json:"id" path:"id" doc:"ID of the Transaction which is fined"`
+	Body struct {
+		Amount     float64 `json:"amount" minimum:"0" doc:"The fine which replaces the fine calculated from the due date"`
+		ReasonCode string  `json:"reason_code" enum:"small_amount,first_offense,hardship,library_error,returned_in_book_drop,other" doc:"Why the fine is adjusted, which is recorded in the audit log"`
+		Note       string  `json:"note,omitempty" required:"false" maxLength:"500" doc:"Details of the reason, required if the reason code is other"`
+	}
+}
+
+type FineOutput struct {
+	Body Fine
+}
+
+// Fine is the fine of a Transaction. It is calculated from the due date, unless it was waived or
+// adjusted, and is outstanding until it is paid.
+type Fine struct {
+	TransactionID string  `json:"transaction_id"`
+	PatronID      string  `json:"patron_id"`
+	BookID        string  `json:"book_id"`
+	Amount        float64 `json:"amount"`
+	Waived        bool    `json:"waived"`
+	Adjusted      bool    `json:"adjusted"`
+	Paid          bool    `json:"paid"`
+}
+
+// Resolve validates the input in WaiveFineInput.
+func (f *WaiveFineInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	err := validateID(&f.ID, "path.id")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	err = validateFineNote(f.Body.ReasonCode, &f.Body.Note, "body.note")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// Resolve validates the input in AdjustFineInput.
+func (f *AdjustFineInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	err := validateID(&f.ID, "path.id")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	err = validateFineNote(f.Body.ReasonCode, &f.Body.Note, "body.note")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// validateFineNote trims the note of a fine correction in place, and checks that corrections
+// with the other reason code are explained by a note.
+func validateFineNote(reasonCode string, note *string, location string) error {
+	*note = strings.TrimSpace(*note)
+	if reasonCode == fineReasonOther && *note == "" {
+		return &huma.ErrorDetail{
+			Location: location,
+			Message:  "Note is required if the reason code is other",
+			Value:    *note,
+		}
+	}
+
+	return nil
+}
+
+// transactionFine returns the fine of a transaction, which is fined up to now while it is borrowed,
+// and up to the time it was returned afterward.
+func (app *Application) transactionFine(transaction *data.Transaction, now time.Time) Fine {
+	if transaction.Status == data.TransactionStatusReturned {
+		now = transaction.ReturnedAt
+	}
+
+	return Fine{
+		TransactionID: transaction.ID,
+		PatronID:      transaction.PatronID,
+		BookID:        transaction.BookID,
+		Amount:        calculateFine(*transaction, app.cost.overdueFine, now, app.location),
+		Waived:        transaction.FineWaived,
+		Adjusted:      transaction.AdjustedFine != nil,
+		Paid:          transaction.FinePayment != nil,
+	}
+}
+
+// correctFine applies correct to the transaction with id, which is given the current fine of the
+// transaction, and records the correction in the audit log as action. It returns huma errors for
+// corrections which cannot be applied.
+func (app *Application) correctFine(ctx context.Context, id, action, reasonCode, note string, correct func(transaction *data.Transaction, fine float64) error) (*Fine, error) {
+	var fine Fine
+
+	err := app.Models.Transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		transaction, err := app.Models.Transactions.Get(ctx, data.TransactionFilter{ID: ptr(data.TransactionID(id))})
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrDocumentNotFound):
+				return huma.Error404NotFound(errNotFoundMsg)
+			default:
+				return err
+			}
+		}
+
+		if transaction.Status == data.TransactionStatusCanceled {
+			return huma.Error422UnprocessableEntity(errFineCanceledMsg)
+		}
+
+		now := time.Now()
+		previous := app.transactionFine(transaction, now)
+
+		if err = correct(transaction, previous.Amount); err != nil {
+			return err
+		}
+
+		if err = app.Models.Transactions.Update(ctx, data.TransactionFilter{ID: ptr(data.TransactionID(transaction.ID))}, transaction); err != nil {
+			switch {
+			case errors.Is(err, data.ErrEditConflict):
+				return huma.Error409Conflict(errConflictMsg)
+			case errors.Is(err, data.ErrDocumentNotFound):
+				return huma.Error404NotFound(errNotFoundMsg)
+			default:
+				return err
+			}
+		}
+
+		fine = app.transactionFine(transaction, now)
+
+		return app.audit(ctx, action, transaction.ID, reasonCode, note, map[string]any{
+			"patron_id":     transaction.PatronID,
+			"previous_fine": previous.Amount,
+			"fine":          fine.Amount,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &fine, nil
+}
+
+// waiveFineHandler handles a request to waive the fine of a transaction.
+func (app *Application) waiveFineHandler(ctx context.Context, input *WaiveFineInput) (*FineOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	fine, err := app.correctFine(ctx, input.ID, data.AuditFineWaived, input.Body.ReasonCode, input.Body.Note, func(transaction *data.Transaction, fine float64) error {
+		switch {
+		case transaction.FineWaived:
+			return huma.Error422UnprocessableEntity(errFineAlreadyWaivedMsg)
+		case fine == 0:
+			return huma.Error422UnprocessableEntity(errNoFineToWaiveMsg)
+		}
+
+		transaction.FineWaived = true
+
+		return nil
+	})
+	if err != nil {
+		return &FineOutput{}, app.transactionError(ctx, err)
+	}
+
+	resp := &FineOutput{
+		Body: *fine,
+	}
+
+	return resp, nil
+}
+
+// adjustFineHandler handles a request to replace the fine of a transaction with another amount,
+// which also reinstates a fine that was waived.
+func (app *Application) adjustFineHandler(ctx context.Context, input *AdjustFineInput) (*FineOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	fine, err := app.correctFine(ctx, input.ID, data.AuditFineAdjusted, input.Body.ReasonCode, input.Body.Note, func(transaction *data.Transaction, _ float64) error {
+		transaction.FineWaived = false
+		transaction.AdjustedFine = &input.Body.Amount
+
+		return nil
+	})
+	if err != nil {
+		return &FineOutput{}, app.transactionError(ctx, err)
+	}
+
+	resp := &FineOutput{
+		Body: *fine,
+	}
+
+	return resp, nil
+}
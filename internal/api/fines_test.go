@@ -0,0 +1,104 @@
+package api_test
+
+import (
+	"context"
+	"github.com/mzeevi/library/internal/api"
+	"github.com/mzeevi/library/internal/api/apitest"
+	"github.com/mzeevi/library/internal/data"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCorrectFine(t *testing.T) {
+	a := apitest.New(t, func(app *api.Application) {
+		app.Config.Cost.OverdueFine = 2
+	})
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+
+	bookID := a.SeedBook(apitest.Book("9780306406157", 3))
+	patronID := a.SeedPatron(apitest.Patron("patron@example.com"))
+
+	now := time.Now()
+	transactions := map[string]*data.Transaction{
+		"overdue": data.NewTransaction("", patronID, bookID, data.TransactionStatusBorrowed, now.Add(-20*24*time.Hour), now.Add(-3*24*time.Hour)),
+		"due":     data.NewTransaction("", patronID, bookID, data.TransactionStatusBorrowed, now.Add(-24*time.Hour), now.Add(13*24*time.Hour)),
+	}
+	ids := make(map[string]string)
+	for name, transaction := range transactions {
+		id, err := a.Models.Transactions.Insert(context.Background(), transaction)
+		if err != nil {
+			t.Fatalf("failed to seed transaction: %v", err)
+		}
+		ids[name] = id
+	}
+
+	if rec := a.Do(http.MethodPost, "/fines/"+ids["overdue"]+"/waive", a.PatronAuth(patronID), map[string]any{"reason_code": "small_amount"}); rec.Code != http.StatusForbidden {
+		t.Errorf("waive by patron status = %v; want %v", rec.Code, http.StatusForbidden)
+	}
+	if rec := a.Do(http.MethodPost, "/fines/"+ids["overdue"]+"/waive", admin, map[string]any{"reason_code": "other", "note": " "}); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("waive for other reason without note status = %v; want %v", rec.Code, http.StatusUnprocessableEntity)
+	}
+	if rec := a.Do(http.MethodPost, "/fines/"+ids["due"]+"/waive", admin, map[string]any{"reason_code": "small_amount"}); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("waive without fine status = %v; want %v", rec.Code, http.StatusUnprocessableEntity)
+	}
+
+	rec := a.Do(http.MethodPost, "/fines/"+ids["overdue"]+"/waive", admin, map[string]any{"reason_code": "first_offense"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("waive status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var fine api.Fine
+	a.Decode(rec, &fine)
+	if fine.Amount != 0 || !fine.Waived {
+		t.Errorf("waived fine = %+v; want waived with no amount", fine)
+	}
+
+	if rec := a.Do(http.MethodPost, "/fines/"+ids["overdue"]+"/waive", admin, map[string]any{"reason_code": "first_offense"}); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("waive twice status = %v; want %v", rec.Code, http.StatusUnprocessableEntity)
+	}
+
+	rec = a.Do(http.MethodPost, "/fines/"+ids["overdue"]+"/adjust", admin, map[string]any{"amount": 2.5, "reason_code": "other", "note": "charged for one day only"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("adjust status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	a.Decode(rec, &fine)
+	if fine.Amount != 2.5 || fine.Waived || !fine.Adjusted {
+		t.Errorf("adjusted fine = %+v; want an adjusted amount of 2.5", fine)
+	}
+
+	if rec := a.Do(http.MethodPost, "/fines/"+ids["overdue"]+"/adjust", admin, map[string]any{"amount": -1, "reason_code": "hardship"}); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("adjust to a negative amount status = %v; want %v", rec.Code, http.StatusUnprocessableEntity)
+	}
+	if rec := a.Do(http.MethodPost, "/fines/000000000000000000000000/adjust", admin, map[string]any{"amount": 1, "reason_code": "hardship"}); rec.Code != http.StatusNotFound {
+		t.Errorf("adjust missing fine status = %v; want %v", rec.Code, http.StatusNotFound)
+	}
+
+	rec = a.Do(http.MethodGet, "/audit?sort=created_at&target_id="+ids["overdue"], admin)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("get audit log status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var log struct {
+		Entries []data.AuditEntry `json:"entries"`
+	}
+	a.Decode(rec, &log)
+	want := []struct {
+		action, code, reason string
+		previous, fine       float64
+	}{
+		{action: data.AuditFineWaived, code: "first_offense", previous: 6, fine: 0},
+		{action: data.AuditFineAdjusted, code: "other", reason: "charged for one day only", previous: 0, fine: 2.5},
+	}
+	if len(log.Entries) != len(want) {
+		t.Fatalf("audit log has %d entries; want %d", len(log.Entries), len(want))
+	}
+	for i, w := range want {
+		entry := log.Entries[i]
+		if entry.Action != w.action || entry.Code != w.code || entry.Reason != w.reason || entry.Actor != "admin" {
+			t.Errorf("audit entry %d = %+v; want %s by admin for %s %q", i, entry, w.action, w.code, w.reason)
+		}
+		if entry.Details["previous_fine"] != w.previous || entry.Details["fine"] != w.fine {
+			t.Errorf("audit entry %d fines = %v, %v; want %v, %v", i, entry.Details["previous_fine"], entry.Details["fine"], w.previous, w.fine)
+		}
+	}
+}
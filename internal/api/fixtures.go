@@ -0,0 +1,36 @@
+package api
+
+import (
+	"context"
+	"github.com/mzeevi/library/internal/seed"
+)
+
+// productionEnvironment is the environment in which fixtures can't be loaded.
+const productionEnvironment = "production"
+
+type LoadFixtureInput struct {
+	Body struct {
+		Name string `json:"name" enum:"small,medium,large" doc:"Name of the fixture set"`
+	}
+}
+
+type LoadFixtureOutput struct {
+	Body SeedResult
+}
+
+// loadFixtureHandler handles a request to load a named fixture set into the database.
+func (app *Application) loadFixtureHandler(ctx context.Context, input *LoadFixtureInput) (*LoadFixtureOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), fixtureTimeout)
+	defer cancel()
+
+	result, err := app.LoadFixture(ctx, seed.Fixtures[input.Body.Name])
+	if err != nil {
+		return &LoadFixtureOutput{}, app.serverError(ctx, err)
+	}
+
+	resp := &LoadFixtureOutput{
+		Body: result,
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,45 @@
+package api_test
+
+import (
+	"github.com/mzeevi/library/internal/api"
+	"github.com/mzeevi/library/internal/api/apitest"
+	"net/http"
+	"testing"
+)
+
+func TestLoadFixture(t *testing.T) {
+	a := apitest.New(t, func(app *api.Application) {
+		app.Config.Environment = "staging"
+		app.Config.Seed.Password = "password"
+	})
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+	patronID := a.SeedPatron(apitest.Patron("patron@example.com"))
+
+	if rec := a.Do(http.MethodPost, "/fixtures", a.PatronAuth(patronID), map[string]any{"name": "small"}); rec.Code != http.StatusForbidden {
+		t.Errorf("load by a patron status = %v; want %v", rec.Code, http.StatusForbidden)
+	}
+
+	if rec := a.Do(http.MethodPost, "/fixtures", admin, map[string]any{"name": "huge"}); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("load unknown fixture status = %v; want %v", rec.Code, http.StatusUnprocessableEntity)
+	}
+
+	rec := a.Do(http.MethodPost, "/fixtures", admin, map[string]any{"name": "small"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("load status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	var result api.SeedResult
+	a.Decode(rec, &result)
+	if result.Books != 50 || result.Patrons != 20 || result.Transactions != 200 || result.Resources != 3 || result.Reservations != 10 {
+		t.Errorf("load result = %+v; want the counts of the small fixture set", result)
+	}
+
+	production := apitest.New(t, func(app *api.Application) {
+		app.Config.Environment = "production"
+	})
+	production.SeedAdmin("admin", "admin-password")
+	if rec := production.Do(http.MethodPost, "/fixtures", admin, map[string]any{"name": "small"}); rec.Code != http.StatusNotFound {
+		t.Errorf("load in production status = %v; want %v", rec.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/mzeevi/library/internal/data"
+	"strings"
+	"time"
+)
+
+const (
+	errRegisteredPatronMsg = "the email belongs to a registered patron, who borrows with their own account"
+)
+
+type GuestBorrowInput struct {
+	Body struct {
+		Name    string     `json:"name" minLength:"1" maxLength:"200" doc:"Name of the guest"`
+		Email   string     `json:"email" doc:"Email of the guest, by which a guest who borrowed before is found"`
+		Phone   string     `json:"phone,omitempty" pattern:"^\\+[1-9][0-9]{6,14}$" doc:"Phone number of the guest in E.164 format, such as +972501234567"`
+		BookID  string     `json:"book_id"`
+		DueDate *time.Time `json:"due_date,omitempty" format:"date-time" required:"false" doc:"Due date of the loan, 14 days from today by default"`
+		Copies  int        `json:"copies" minimum:"1" default:"1"`
+	}
+}
+
+type GuestBorrowOutput struct {
+	Location string `header:"Location"`
+	Body     GuestLoanInfo
+}
+
+// GuestLoanInfo is a loan to a guest, with the guest patron it was recorded for.
+type GuestLoanInfo struct {
+	Patron      data.Patron      `json:"patron"`
+	Transaction data.Transaction `json:"transaction"`
+}
+
+// Resolve validates the input in GuestBorrowInput.
+func (g *GuestBorrowInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	g.Body.Name = strings.TrimSpace(g.Body.Name)
+	if g.Body.Name == "" {
+		errs = append(errs, &huma.ErrorDetail{Location: "body.name", Message: "Name must not be blank", Value: g.Body.Name})
+	}
+
+	err := validateEmail(&g.Body.Email, "body.email")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	err = validateID(&g.Body.BookID, "body.bookID")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// guestBorrowHandler handles a request of an admin to lend a book to a walk-in who is not a member
+// of the library. The guest is recorded as a guest patron the first time they borrow, and is found
+// by their email when they borrow again.
+func (app *Application) guestBorrowHandler(ctx context.Context, input *GuestBorrowInput) (*GuestBorrowOutput, error) {
+	var patron *data.Patron
+	var transaction *data.Transaction
+
+	var dueDate time.Time
+	if input.Body.DueDate != nil {
+		dueDate = *input.Body.DueDate
+	}
+
+	err := app.Models.Transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+
+		patron, err = app.guestPatron(ctx, input.Body.Name, input.Body.Email, input.Body.Phone)
+		if err != nil {
+			return err
+		}
+
+		transaction, err = app.borrowBook(ctx, borrowRequest{
+			PatronID:   patron.ID,
+			BookID:     input.Body.BookID,
+			DueDate:    dueDate,
+			Copies:     input.Body.Copies,
+			BorrowedAt: time.Now(),
+		})
+
+		return err
+	})
+	if err != nil {
+		return &GuestBorrowOutput{}, app.transactionError(ctx, err)
+	}
+
+	resp := &GuestBorrowOutput{
+		Body: GuestLoanInfo{
+			Patron:      *patron,
+			Transaction: *transaction,
+		},
+		Location: fmt.Sprintf("%s/%s/%s", basePath, transactionsKey, transaction.ID),
+	}
+
+	return resp, nil
+}
+
+// guestPatron returns the guest patron with an email, creating it if the guest has not borrowed
+// before. A guest has no category, password or permissions, so they borrow for the default loan
+// period and cannot log in. It should be called within a database transaction, and returns a huma
+// error if the email is of a registered patron.
+func (app *Application) guestPatron(ctx context.Context, name, email, phone string) (*data.Patron, error) {
+	patron, err := app.Models.Patrons.Get(ctx, data.PatronFilter{Email: &email})
+	switch {
+	case err == nil:
+		if !patron.Guest {
+			return nil, huma.Error409Conflict(errRegisteredPatronMsg)
+		}
+		return patron, nil
+	case !errors.Is(err, data.ErrDocumentNotFound):
+		return nil, err
+	}
+
+	patron = &data.Patron{
+		Name:        name,
+		Email:       email,
+		Phone:       phone,
+		Guest:       true,
+		Permissions: []string{},
+	}
+
+	patron.ID, err = app.Models.Patrons.Insert(ctx, patron)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateEmail):
+			return nil, huma.Error409Conflict(errEmailAlreadyExistsMsg)
+		default:
+			return nil, err
+		}
+	}
+
+	if err = app.recordEvent(ctx, data.EventPatronCreated, patronEvent{ID: patron.ID}); err != nil {
+		return nil, err
+	}
+
+	return patron, nil
+}
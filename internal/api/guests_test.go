@@ -0,0 +1,61 @@
+package api_test
+
+import (
+	"github.com/mzeevi/library/internal/api"
+	"github.com/mzeevi/library/internal/api/apitest"
+	"github.com/mzeevi/library/internal/auth"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestGuestBorrow(t *testing.T) {
+	a := apitest.New(t)
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+
+	firstID := a.SeedBook(apitest.Book("9780306406157", 1))
+	secondID := a.SeedBook(apitest.Book("9781861972712", 1))
+	memberID := a.SeedPatron(apitest.Patron("member@example.com", auth.BorrowBookPermission))
+
+	now := time.Now()
+	rec := a.Do(http.MethodPost, "/transactions/borrow/guest", admin, map[string]any{"name": " Dana Cohen ", "email": "Dana@Example.com", "book_id": firstID, "copies": 1})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("guest borrow status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	var loan api.GuestLoanInfo
+	a.Decode(rec, &loan)
+	if !loan.Patron.Guest || loan.Patron.Name != "Dana Cohen" || loan.Patron.Activated {
+		t.Errorf("guest = %+v; want an inactive guest named Dana Cohen", loan.Patron)
+	}
+	if loan.Transaction.PatronID != loan.Patron.ID || loan.Transaction.DueDate.Before(now.AddDate(0, 0, 13)) {
+		t.Errorf("transaction = %+v; want a loan to the guest for the default loan period", loan.Transaction)
+	}
+
+	// A guest has no password, so they cannot log in.
+	if rec := a.Do(http.MethodPost, "/token/authentication", map[string]any{"email": "dana@example.com", "password": "any-password"}); rec.Code != http.StatusUnauthorized {
+		t.Errorf("guest login status = %v; want %v (body: %s)", rec.Code, http.StatusUnauthorized, rec.Body.String())
+	}
+
+	// A guest who borrowed before is found by their email.
+	rec = a.Do(http.MethodPost, "/transactions/borrow/guest", admin, map[string]any{"name": "Dana Cohen", "email": "dana@example.com", "book_id": secondID, "copies": 1})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("second guest borrow status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var again api.GuestLoanInfo
+	a.Decode(rec, &again)
+	if again.Patron.ID != loan.Patron.ID {
+		t.Errorf("second guest borrow patron = %v; want the guest %v", again.Patron.ID, loan.Patron.ID)
+	}
+
+	if rec := a.Do(http.MethodPost, "/transactions/borrow/guest", admin, map[string]any{"name": "Member", "email": "member@example.com", "book_id": firstID, "copies": 1}); rec.Code != http.StatusConflict {
+		t.Errorf("guest borrow with the email of a member status = %v; want %v", rec.Code, http.StatusConflict)
+	}
+	if rec := a.Do(http.MethodPost, "/transactions/borrow/guest", admin, map[string]any{"name": " ", "email": "guest@example.com", "book_id": firstID, "copies": 1}); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("guest borrow without a name status = %v; want %v", rec.Code, http.StatusUnprocessableEntity)
+	}
+	if rec := a.Do(http.MethodPost, "/transactions/borrow/guest", a.PatronAuth(memberID), map[string]any{"name": "Guest", "email": "guest@example.com", "book_id": firstID, "copies": 1}); rec.Code != http.StatusForbidden {
+		t.Errorf("guest borrow by a patron status = %v; want %v", rec.Code, http.StatusForbidden)
+	}
+}
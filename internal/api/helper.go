@@ -4,8 +4,16 @@ import (
 	"fmt"
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/mzeevi/library/internal/data"
-	"go.mongodb.org/mongo-driver/bson/primitive"
+	"github.com/mzeevi/library/internal/isbn"
+	"github.com/mzeevi/library/internal/notifier"
+	"github.com/mzeevi/library/internal/query"
+	"github.com/mzeevi/library/internal/timezone"
+	"golang.org/x/text/language"
+	"mime"
+	"reflect"
 	"regexp"
+	"slices"
+	"strings"
 	"time"
 )
 
@@ -15,14 +23,14 @@ func isBookUnavailable(book *data.Book, requestedCopies int) bool {
 }
 
 // processPatronTransactions returns a PatronTransactions slice.
-func processPatronTransactions(transactions []data.Transaction, overdueFine float64) ([]patronTransaction, float64) {
+func processPatronTransactions(transactions []data.Transaction, overdueFine float64, now time.Time, loc *time.Location) ([]patronTransaction, float64) {
 	patronTransactions := make([]patronTransaction, 0)
 	var totalFine float64
 
 	for _, transaction := range transactions {
 		pt := patronTransaction{
 			Transaction: transaction,
-			Fine:        calculateFine(transaction, overdueFine),
+			Fine:        calculateFine(transaction, overdueFine, now, loc),
 		}
 
 		patronTransactions = append(patronTransactions, pt)
@@ -33,12 +41,22 @@ func processPatronTransactions(transactions []data.Transaction, overdueFine floa
 }
 
 // calculateFine calculates the fine for a transaction. It checks if it is overdue based on the due date.
-// For overdue transactions, the fine is calculated by multiplying the number
-// of overdue days by the specified overdue fine rate.
-func calculateFine(transaction data.Transaction, overdueFine float64) (fine float64) {
-	daysOverdue := time.Since(transaction.DueDate).Hours() / 24
+// For overdue transactions, the fine is calculated by multiplying the number of overdue days by the
+// specified overdue fine rate. Overdue days are the calendar days in loc which started after the
+// due date, so a book is not fined on the day it is due. Waived and canceled transactions are not fined,
+// nor are e-book loans, which are returned automatically, and the fine of a transaction which was
+// adjusted is the adjusted fine. The discount of the transaction is taken off the fine.
+func calculateFine(transaction data.Transaction, overdueFine float64, now time.Time, loc *time.Location) (fine float64) {
+	if transaction.FineWaived || transaction.Digital || transaction.Status == data.TransactionStatusCanceled {
+		return 0
+	}
+	if transaction.AdjustedFine != nil {
+		return *transaction.AdjustedFine
+	}
+
+	daysOverdue := timezone.DaysBetween(transaction.DueDate, now, loc)
 	if daysOverdue > 0 {
-		fine = daysOverdue * overdueFine
+		fine = roundAmount(float64(daysOverdue) * overdueFine * (100 - transaction.FineDiscount) / 100)
 	}
 
 	return fine
@@ -67,14 +85,26 @@ func validateEmail(email *string, location string) error {
 	return nil
 }
 
-// validateEmail validates an ID.
-func validateID(id *string, location string) error {
+// validateNotificationChannel checks that a Patron who is notified by text message has a phone number.
+func validateNotificationChannel(channel, phone string, location string) error {
+	if channel == notifier.SMS && phone == "" {
+		return &huma.ErrorDetail{
+			Location: location,
+			Message:  "Phone number is required to be notified by sms",
+			Value:    phone,
+		}
+	}
+
+	return nil
+}
+
+// validateID validates an ID, which is either a plain string or one of the typed IDs of data.
+func validateID[T ~string](id *T, location string) error {
 	if id == nil {
 		return nil
 	}
 
-	_, err := primitive.ObjectIDFromHex(*id)
-	if err != nil {
+	if !data.ValidID(*id) {
 		return &huma.ErrorDetail{
 			Location: location,
 			Message:  "Invalid ID",
@@ -85,23 +115,51 @@ func validateID(id *string, location string) error {
 	return nil
 }
 
-// validateDueDate checks if the due date is valid, ensuring it is between 1 and 14 days from today.
-func validateDueDate(t *time.Time, location string) error {
-	if t == nil {
+// validateIDs validates a list of IDs, such as of the references which a client resolves in a batch.
+func validateIDs(ids []string, location string) []error {
+	var errs []error
+
+	for i := range ids {
+		if err := validateID(&ids[i], fmt.Sprintf("%s[%d]", location, i)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs
+}
+
+// typedIDs converts a list of IDs to one of the typed IDs of data, returning nil if there are
+// none, so that an empty list doesn't filter.
+func typedIDs[T ~string](ids []string) []T {
+	if len(ids) == 0 {
 		return nil
 	}
 
-	oneDayFromNow := time.Now().Add(24 * time.Hour)
-	twoWeeksFromNow := time.Now().Add(14 * 24 * time.Hour)
+	typed := make([]T, 0, len(ids))
+	for _, id := range ids {
+		typed = append(typed, T(id))
+	}
+
+	return typed
+}
+
+// validateDueDate checks if the due date is valid, ensuring it is between 1 and maxDays days from
+// today. Days are calendar days in loc, so any time tomorrow is a valid due date.
+func validateDueDate(t *time.Time, now time.Time, loc *time.Location, maxDays int, location string) error {
+	if t == nil {
+		return nil
+	}
 
-	valid := (*t).After(oneDayFromNow) && (*t).Before(twoWeeksFromNow)
-	if !valid {
+	days := timezone.DaysBetween(now, *t, loc)
+	if days < 1 || days > maxDays {
+		today := timezone.StartOfDay(now, loc)
 		return &huma.ErrorDetail{
 			Location: location,
 			Message: fmt.Sprintf(
-				"Due date must be at least 1 day (after %s) and no more than 14 days (before %s) from today",
-				oneDayFromNow.Format(time.RFC3339),
-				twoWeeksFromNow.Format(time.RFC3339),
+				"Due date must be at least 1 day (from %s) and no more than %d days (before %s) from today",
+				today.AddDate(0, 0, 1).Format(time.RFC3339),
+				maxDays,
+				today.AddDate(0, 0, maxDays+1).Format(time.RFC3339),
 			),
 			Value: *t,
 		}
@@ -110,7 +168,247 @@ func validateDueDate(t *time.Time, location string) error {
 	return nil
 }
 
+// validateBarcode checks that a barcode is an ISBN, and replaces it with its ISBN-13.
+func validateBarcode(barcode *string, location string) error {
+	if barcode == nil {
+		return nil
+	}
+
+	code, err := isbn.FromBarcode(*barcode)
+	if err != nil {
+		return &huma.ErrorDetail{
+			Location: location,
+			Message:  "Invalid ISBN barcode",
+			Value:    *barcode,
+		}
+	}
+	*barcode = code
+
+	return nil
+}
+
+// validateIdentifiers trims the values of the identifiers of a book in place, and checks that no
+// type is given more than once and that ISBNs have valid check digits. ISBNs are normalized without
+// hyphens and spaces, an ISBN-10 given as an ISBN-13 or an e-ISBN is converted, and the ISBN-13 of
+// an ISBN-10 is added if the book has none, so that its copies can be found by their barcodes.
+func validateIdentifiers(identifiers *[]IdentifierInput, location string) []error {
+	var errs []error
+
+	types := make(map[string]bool, len(*identifiers))
+	for i := range *identifiers {
+		identifier := &(*identifiers)[i]
+		identifier.Value = strings.TrimSpace(identifier.Value)
+
+		if types[identifier.Type] {
+			errs = append(errs, &huma.ErrorDetail{
+				Location: fmt.Sprintf("%s[%d].type", location, i),
+				Message:  fmt.Sprintf("A book has at most one identifier of type %s", identifier.Type),
+				Value:    identifier.Type,
+			})
+		}
+		types[identifier.Type] = true
+
+		var code string
+		var err error
+		switch identifier.Type {
+		case data.IdentifierISBN13, data.IdentifierEISBN:
+			code, err = isbn.FromBarcode(identifier.Value)
+		case data.IdentifierISBN10:
+			code, err = isbn.Normalize(identifier.Value)
+			if err == nil && len(code) != 10 {
+				err = isbn.ErrInvalid
+			}
+		default:
+			continue
+		}
+
+		if err != nil {
+			errs = append(errs, &huma.ErrorDetail{
+				Location: fmt.Sprintf("%s[%d].value", location, i),
+				Message:  fmt.Sprintf("Invalid %s, the check digit does not match", identifier.Type),
+				Value:    identifier.Value,
+			})
+			continue
+		}
+		identifier.Value = code
+	}
+
+	if len(errs) > 0 || types[data.IdentifierISBN13] {
+		return errs
+	}
+
+	for _, identifier := range *identifiers {
+		if identifier.Type == data.IdentifierISBN10 {
+			code, _ := isbn.FromBarcode(identifier.Value)
+			*identifiers = append(*identifiers, IdentifierInput{Type: data.IdentifierISBN13, Value: code})
+			break
+		}
+	}
+
+	return errs
+}
+
+// newIdentifiers returns the identifiers of a book from the identifiers of a request.
+func newIdentifiers(identifiers []IdentifierInput) []data.Identifier {
+	values := make([]data.Identifier, 0, len(identifiers))
+	for _, identifier := range identifiers {
+		values = append(values, data.Identifier{Type: identifier.Type, Value: identifier.Value})
+	}
+
+	return values
+}
+
+// validateLanguage lower-cases a language in place, and checks that it is an ISO 639-1 code.
+func validateLanguage(lang *string, location string) error {
+	if lang == nil {
+		return nil
+	}
+
+	*lang = strings.ToLower(strings.TrimSpace(*lang))
+	if _, err := language.ParseBase(*lang); err != nil || len(*lang) != 2 {
+		return &huma.ErrorDetail{
+			Location: location,
+			Message:  "Language must be an ISO 639-1 code, such as en",
+			Value:    *lang,
+		}
+	}
+
+	return nil
+}
+
+// validateReason trims the reason of a correction in place, and checks that it is not blank.
+func validateReason(reason *string, location string) error {
+	*reason = strings.TrimSpace(*reason)
+	if *reason == "" {
+		return &huma.ErrorDetail{
+			Location: location,
+			Message:  "Reason must not be blank",
+			Value:    *reason,
+		}
+	}
+
+	return nil
+}
+
+// validateKioskPatron checks that a kiosk request identifies its patron by either an ID or a token.
+func validateKioskPatron(patronID, patronToken string, location string) error {
+	if (patronID == "") == (patronToken == "") {
+		return &huma.ErrorDetail{
+			Location: location,
+			Message:  "Either a patron ID or a patron token is required",
+			Value:    patronID,
+		}
+	}
+
+	if patronID == "" {
+		return nil
+	}
+
+	return validateID(&patronID, location)
+}
+
+// validateOccurredAt checks that the time a kiosk request occurred at is not in the future,
+// allowing for the clock of the kiosk to be a minute ahead, and is at most maxKioskQueueAge ago.
+func validateOccurredAt(t *time.Time, now time.Time, location string) error {
+	if t == nil {
+		return nil
+	}
+
+	if t.After(now.Add(time.Minute)) || t.Before(now.Add(-maxKioskQueueAge)) {
+		return &huma.ErrorDetail{
+			Location: location,
+			Message:  fmt.Sprintf("Occurred at must not be in the future or more than %d days ago", int(maxKioskQueueAge.Hours()/24)),
+			Value:    *t,
+		}
+	}
+
+	return nil
+}
+
+// validateRange checks that the minimum of a range of query parameters, such as min_pages and
+// max_pages or from and to, is not greater than its maximum. Bounds which were not sent are nil.
+func validateRange[T int | time.Time](minimum, maximum *T, minKey, maxKey string) error {
+	if minimum == nil || maximum == nil {
+		return nil
+	}
+
+	var value any
+	var message string
+	switch minimum := any(*minimum).(type) {
+	case int:
+		if minimum <= any(*maximum).(int) {
+			return nil
+		}
+		value, message = minimum, errMinMaxGreaterMsg
+	case time.Time:
+		if !minimum.After(any(*maximum).(time.Time)) {
+			return nil
+		}
+		value, message = minimum.Format(time.RFC3339), errMinMaxLaterMsg
+	}
+
+	return &huma.ErrorDetail{
+		Location: fmt.Sprintf("%s.%s, %s.%s", query.Key, minKey, query.Key, maxKey),
+		Message:  fmt.Sprintf(message, minKey, maxKey),
+		Value:    value,
+	}
+}
+
+// optional returns a pointer to v, or nil if v is the zero value of a query parameter which was
+// not sent.
+func optional[T comparable](v T) *T {
+	var zero T
+	if v == zero {
+		return nil
+	}
+
+	return &v
+}
+
+// optionalBool returns the value of a boolean query parameter, or nil if it was not sent.
+func optionalBool(v string) *bool {
+	if v == "" {
+		return nil
+	}
+
+	return ptr(v == "true")
+}
+
 // ptr is a generic helper function for creating a pointer to any type.
 func ptr[T any](v T) *T {
 	return &v
 }
+
+// acceptedMediaType returns the first media type of an Accept header which is one of mediaTypes.
+func acceptedMediaType(accept string, mediaTypes ...string) (string, bool) {
+	for _, value := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(value)
+		if err != nil {
+			continue
+		}
+
+		if slices.Contains(mediaTypes, mediaType) {
+			return mediaType, true
+		}
+	}
+
+	return "", false
+}
+
+// fileResponses documents the response of an operation whose body is either body, or a file of
+// one of contentTypes.
+func fileResponses(api huma.API, description string, body any, contentTypes ...string) map[string]*huma.Response {
+	content := map[string]*huma.MediaType{
+		"application/json": {Schema: api.OpenAPI().Components.Schemas.Schema(reflect.TypeOf(body), true, "")},
+	}
+	for _, contentType := range contentTypes {
+		content[contentType] = &huma.MediaType{Schema: &huma.Schema{Type: huma.TypeString, Format: "binary"}}
+	}
+
+	return map[string]*huma.Response{
+		"200": {
+			Description: description,
+			Content:     content,
+		},
+	}
+}
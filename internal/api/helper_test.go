@@ -0,0 +1,220 @@
+package api
+
+import (
+	"context"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/mzeevi/library/internal/data"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCalculateFine(t *testing.T) {
+	loc := time.FixedZone("UTC+2", 2*60*60)
+	dueDate := time.Date(2024, time.December, 10, 20, 0, 0, 0, loc)
+
+	tests := []struct {
+		name     string
+		now      time.Time
+		discount float64
+		want     float64
+	}{
+		{name: "before due date", now: dueDate.Add(-time.Hour), want: 0},
+		{name: "later on the due date", now: dueDate.Add(3 * time.Hour), want: 0},
+		{name: "first day after the due date", now: dueDate.Add(4 * time.Hour), want: 10},
+		{name: "three days after the due date", now: time.Date(2024, time.December, 13, 8, 0, 0, 0, loc), want: 30},
+		{name: "three days after the due date with a discount", now: time.Date(2024, time.December, 13, 8, 0, 0, 0, loc), discount: 25, want: 22.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transaction := data.Transaction{DueDate: dueDate, FineDiscount: tt.discount}
+			if got := calculateFine(transaction, 10, tt.now, loc); got != tt.want {
+				t.Errorf("calculateFine() = %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateDueDate(t *testing.T) {
+	loc := time.FixedZone("UTC+2", 2*60*60)
+	now := time.Date(2024, time.December, 10, 23, 0, 0, 0, loc)
+
+	tests := []struct {
+		name    string
+		dueDate time.Time
+		maxDays int
+		valid   bool
+	}{
+		{name: "later today", dueDate: now.Add(30 * time.Minute), maxDays: 14, valid: false},
+		{name: "early tomorrow", dueDate: now.Add(2 * time.Hour), maxDays: 14, valid: true},
+		{name: "in 14 days", dueDate: time.Date(2024, time.December, 24, 23, 59, 0, 0, loc), maxDays: 14, valid: true},
+		{name: "in 15 days", dueDate: time.Date(2024, time.December, 25, 0, 0, 0, 0, loc), maxDays: 14, valid: false},
+		{name: "in 15 days of 28", dueDate: time.Date(2024, time.December, 25, 0, 0, 0, 0, loc), maxDays: 28, valid: true},
+		{name: "in 29 days of 28", dueDate: time.Date(2025, time.January, 8, 0, 0, 0, 0, loc), maxDays: 28, valid: false},
+		{name: "in the past", dueDate: now.Add(-48 * time.Hour), maxDays: 14, valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateDueDate(&tt.dueDate, now, loc, tt.maxDays, "body.dueDate")
+			if (err == nil) != tt.valid {
+				t.Errorf("validateDueDate(%v) = %v; want valid %v", tt.dueDate, err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestOriginPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		origin  string
+		want    bool
+	}{
+		{pattern: "https://library.example.com", origin: "https://library.example.com", want: true},
+		{pattern: "https://library.example.com", origin: "https://Library.Example.com", want: true},
+		{pattern: "https://library.example.com", origin: "http://library.example.com", want: false},
+		{pattern: "https://library.example.com", origin: "https://library.example.com:8443", want: false},
+		{pattern: "https://*.example.com", origin: "https://catalog.example.com", want: true},
+		{pattern: "https://*.example.com", origin: "https://new.catalog.example.com", want: true},
+		{pattern: "https://*.example.com", origin: "https://example.com", want: false},
+		{pattern: "https://*.example.com", origin: "https://evilexample.com", want: false},
+		{pattern: "https://*.example.com", origin: "https://example.com.evil.org", want: false},
+		{pattern: "http://*.example.com:3000", origin: "http://dev.example.com:3000", want: true},
+		{pattern: "http://*.example.com:3000", origin: "http://dev.example.com", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.origin, func(t *testing.T) {
+			pattern, err := parseOriginPattern(tt.pattern)
+			if err != nil {
+				t.Fatalf("parseOriginPattern(%q) error = %v", tt.pattern, err)
+			}
+			if got := pattern.matches(tt.origin); got != tt.want {
+				t.Errorf("matches(%q) = %v; want %v", tt.origin, got, tt.want)
+			}
+		})
+	}
+
+	for _, invalid := range []string{"library.example.com", "https://*.com", "https://cat*.example.com", "https://library.example.com/catalog", "https://user@library.example.com"} {
+		if _, err := parseOriginPattern(invalid); err == nil {
+			t.Errorf("parseOriginPattern(%q) error = nil; want an error", invalid)
+		}
+	}
+}
+
+func TestValidateRange(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		err     error
+		wantErr bool
+	}{
+		{name: "ints in order", err: validateRange(ptr(1), ptr(2), "min_pages", "max_pages")},
+		{name: "equal ints", err: validateRange(ptr(2), ptr(2), "min_pages", "max_pages")},
+		{name: "ints out of order", err: validateRange(ptr(3), ptr(2), "min_pages", "max_pages"), wantErr: true},
+		{name: "no minimum", err: validateRange(nil, ptr(2), "min_pages", "max_pages")},
+		{name: "times in order", err: validateRange(ptr(now), ptr(now.Add(time.Hour)), "from", "to")},
+		{name: "times out of order", err: validateRange(ptr(now), ptr(now.Add(-time.Hour)), "from", "to"), wantErr: true},
+		{name: "no maximum", err: validateRange(ptr(now), nil, "from", "to")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if (tt.err != nil) != tt.wantErr {
+				t.Fatalf("validateRange() error = %v; want an error %v", tt.err, tt.wantErr)
+			}
+			if tt.err == nil {
+				return
+			}
+
+			detail := tt.err.(*huma.ErrorDetail)
+			if !strings.HasPrefix(detail.Location, "query.") || !strings.Contains(detail.Location, ", query.") {
+				t.Errorf("validateRange() location = %q; want the locations of both query parameters", detail.Location)
+			}
+		})
+	}
+}
+
+func TestWithListReads(t *testing.T) {
+	app := &Application{}
+	app.Config.DB.ListReadPreference = "secondaryPreferred"
+	if err := app.setupListReads(); err != nil {
+		t.Fatalf("setupListReads() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		tags []string
+		want bool
+	}{
+		{name: "search", tags: []string{searchKey}, want: true},
+		{name: "reports", tags: []string{reportsKey}, want: true},
+		{name: "untagged", tags: nil, want: false},
+		{name: "books", tags: []string{booksKey}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if got := app.withListReads(ctx, tt.tags...) != ctx; got != tt.want {
+				t.Errorf("withListReads(%v) changed the context = %v; want %v", tt.tags, got, tt.want)
+			}
+		})
+	}
+
+	app.Config.DB.ListReadPreference = "closest"
+	if err := app.setupListReads(); err == nil {
+		t.Errorf("setupListReads() with an invalid read preference error = nil; want an error")
+	}
+}
+
+func TestTermWindow(t *testing.T) {
+	app := &Application{location: time.UTC}
+	app.Config.Reports.FiscalYearStart = "03-01"
+	app.Config.Reports.Terms = map[string]string{"fall": "09-01/01-31", "spring": "02-01/06-30"}
+	if err := app.setupReportTerms(); err != nil {
+		t.Fatalf("setupReportTerms() error = %v", err)
+	}
+
+	day := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		term      string
+		wantStart time.Time
+		wantEnd   time.Time
+		wantErr   bool
+	}{
+		{term: "2024-spring", wantStart: day(2024, time.February, 1), wantEnd: day(2024, time.July, 1)},
+		{term: "2024-fall", wantStart: day(2024, time.September, 1), wantEnd: day(2025, time.February, 1)},
+		{term: "2023-fiscal", wantStart: day(2023, time.March, 1), wantEnd: day(2024, time.March, 1)},
+		{term: "2024-winter", wantErr: true},
+		{term: "fall", wantErr: true},
+		{term: "24-fall", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.term, func(t *testing.T) {
+			start, end, err := app.termWindow(tt.term, "query.term")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("termWindow(%q) error = %v; want error %v", tt.term, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !start.Equal(tt.wantStart) || !end.Equal(tt.wantEnd.Add(-time.Millisecond)) {
+				t.Errorf("termWindow(%q) = %v, %v; want from %v until %v", tt.term, start, end, tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+
+	for _, terms := range []map[string]string{{"fall": "09-01"}, {"fiscal": "01-01/06-30"}, {"leap": "02-29/03-31"}} {
+		app.Config.Reports.Terms = terms
+		if err := app.setupReportTerms(); err == nil {
+			t.Errorf("setupReportTerms() with terms %v error = nil; want an error", terms)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/mzeevi/library/internal/data"
+	"io"
+	"mime"
+	"slices"
+	"strings"
+)
+
+const (
+	errImportTypeMsg    = "the roster must be a CSV file"
+	errImportHeaderMsg  = "the roster must have a header row with the name, email and category columns"
+	errImportTooManyMsg = "the roster has more than %d rows"
+)
+
+const (
+	// maxImportRows is the largest number of patrons which are imported from one roster.
+	maxImportRows = 5000
+	// maxImportBytes is the largest roster which is uploaded.
+	maxImportBytes = 5 << 20
+)
+
+// Statuses of the rows of an imported roster.
+const (
+	ImportCreated = "created"
+	ImportExists  = "exists"
+	ImportInvalid = "invalid"
+)
+
+// importColumns are the columns of a roster. The name, email and category columns are required,
+// and the student_id column is the external ID of the patron in the school information system.
+var importColumns = []string{"name", "email", "category", "student_id"}
+
+type ImportPatronsInput struct {
+	AcceptLanguage string `header:"Accept-Language" doc:"Locale of the activation emails and later notifications"`
+	ContentType    string `header:"Content-Type" doc:"text/csv"`
+	RawBody        []byte
+}
+
+type ImportPatronsOutput struct {
+	Body ImportReport
+}
+
+// ImportReport is the result of importing a roster, with the result of each of its rows.
+type ImportReport struct {
+	Created int         `json:"created"`
+	Exists  int         `json:"exists"`
+	Invalid int         `json:"invalid"`
+	Rows    []ImportRow `json:"rows"`
+}
+
+// ImportRow is the result of importing a row of a roster. Row is the line the row starts at in the
+// file, in which the header is line 1.
+type ImportRow struct {
+	Row      int    `json:"row"`
+	Email    string `json:"email,omitempty"`
+	Status   string `json:"status" enum:"created,exists,invalid"`
+	PatronID string `json:"patron_id,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Resolve validates the input in ImportPatronsInput.
+func (p *ImportPatronsInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	mediaType, _, err := mime.ParseMediaType(p.ContentType)
+	if err != nil || mediaType != csvContentType {
+		errs = append(errs, &huma.ErrorDetail{
+			Location: "header.Content-Type",
+			Message:  errImportTypeMsg,
+			Value:    p.ContentType,
+		})
+	}
+
+	return errs
+}
+
+// importPatronsHandler handles a request to create the patrons of a roster, such as the students of
+// a school. Each row is created in its own transaction with an activation token, so that invalid
+// rows and patrons who already exist do not prevent the others from being created. The activation
+// tokens are emailed to the created patrons in the background.
+func (app *Application) importPatronsHandler(ctx context.Context, input *ImportPatronsInput) (*ImportPatronsOutput, error) {
+	roster, err := readRoster(input.RawBody)
+	if err != nil {
+		return &ImportPatronsOutput{}, huma.Error422UnprocessableEntity(err.Error())
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), importTimeout)
+	defer cancel()
+
+	categories, err := app.Models.Categories.GetAll(ctx, data.CategoryFilter{})
+	if err != nil {
+		return &ImportPatronsOutput{}, app.serverError(ctx, err)
+	}
+	known := map[string]bool{}
+	for _, category := range categories {
+		known[category.Name] = true
+	}
+
+	locale := app.mailer.Locale(input.AcceptLanguage)
+	seen := map[string]bool{}
+
+	var report ImportReport
+	var activations []activation
+	for _, r := range roster {
+		record := r.fields
+		row := ImportRow{Row: r.line, Email: strings.TrimSpace(record["email"])}
+
+		patron := &data.Patron{
+			Name:        strings.TrimSpace(record["name"]),
+			Email:       row.Email,
+			Category:    strings.TrimSpace(record["category"]),
+			Locale:      locale,
+			Permissions: slices.Clone(patronPermissions),
+		}
+		if studentID := strings.TrimSpace(record["student_id"]); studentID != "" {
+			patron.ExternalIDs = map[string]string{sisSystem: studentID}
+		}
+
+		switch {
+		case patron.Name == "":
+			row.Status, row.Error = ImportInvalid, "the name is blank"
+		case validateEmail(&patron.Email, "email") != nil:
+			row.Status, row.Error = ImportInvalid, "the email is not valid"
+		case len(validateExternalIDs(patron.ExternalIDs, "student_id")) > 0:
+			row.Status, row.Error = ImportInvalid, "the student ID is not valid"
+		case !known[patron.Category]:
+			row.Status, row.Error = ImportInvalid, fmt.Sprintf(errUnknownCategoryMsg, patron.Category)
+		case seen[strings.ToLower(patron.Email)]:
+			row.Status, row.Error = ImportInvalid, "the email is in an earlier row"
+		default:
+			seen[strings.ToLower(patron.Email)] = true
+
+			var statusErr huma.StatusError
+			token, err := app.importPatron(ctx, patron)
+			switch {
+			case err == nil:
+				row.Status, row.PatronID = ImportCreated, patron.ID
+				activations = append(activations, activation{patron: patron, token: token})
+			case errors.Is(err, data.ErrDuplicateEmail):
+				row.Status, row.Error = ImportExists, errEmailAlreadyExistsMsg
+			case errors.As(err, &statusErr):
+				row.Status, row.Error = ImportInvalid, statusErr.Error()
+			default:
+				return &ImportPatronsOutput{}, app.serverError(ctx, err)
+			}
+		}
+
+		switch row.Status {
+		case ImportCreated:
+			report.Created++
+		case ImportExists:
+			report.Exists++
+		case ImportInvalid:
+			report.Invalid++
+		}
+		report.Rows = append(report.Rows, row)
+	}
+
+	// The emails are sent one by one, so that a large roster does not flood the mail server.
+	app.background(ctx, func(ctx context.Context) {
+		for _, a := range activations {
+			app.deliverActivationEmail(ctx, a.patron, a.token)
+		}
+	})
+
+	resp := &ImportPatronsOutput{
+		Body: report,
+	}
+
+	return resp, nil
+}
+
+// activation is a created patron with their activation token, which is emailed to them.
+type activation struct {
+	patron *data.Patron
+	token  *data.Token
+}
+
+// importPatron creates a patron of a roster with an activation token, in a transaction. It returns
+// a huma error if another patron has the student ID of the patron.
+func (app *Application) importPatron(ctx context.Context, patron *data.Patron) (*data.Token, error) {
+	var token *data.Token
+	err := app.Models.Transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		err := app.checkPatronExternalIDs(ctx, patron.ExternalIDs, "")
+		if err != nil {
+			return err
+		}
+
+		id, err := app.Models.Patrons.Insert(ctx, patron)
+		if err != nil {
+			return err
+		}
+		patron.ID = id
+
+		token, err = app.Models.Tokens.New(ctx, id, activationTokenTTL, data.ScopeActivation)
+		if err != nil {
+			return err
+		}
+
+		return app.recordEvent(ctx, data.EventPatronCreated, patronEvent{ID: id, Category: patron.Category})
+	})
+
+	return token, err
+}
+
+// rosterRow is a row of a roster by its column names, with the line it starts at.
+type rosterRow struct {
+	line   int
+	fields map[string]string
+}
+
+// readRoster reads the rows of a roster CSV file by their column names. The columns are found by
+// the header row in any order and case, and unknown columns are ignored. A UTF-8 byte order mark,
+// which spreadsheets add to exported files, is skipped.
+func readRoster(content []byte) ([]rosterRow, error) {
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(content, []byte("\ufeff"))))
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, errors.New(errImportHeaderMsg)
+	}
+
+	indexes := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if slices.Contains(importColumns, name) {
+			indexes[name] = i
+		}
+	}
+	for _, name := range importColumns[:3] {
+		if _, ok := indexes[name]; !ok {
+			return nil, errors.New(errImportHeaderMsg)
+		}
+	}
+
+	var rows []rosterRow
+	for {
+		fields, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("the roster is not a valid CSV file: %v", err)
+		}
+
+		if len(rows) == maxImportRows {
+			return nil, fmt.Errorf(errImportTooManyMsg, maxImportRows)
+		}
+
+		line, _ := reader.FieldPos(0)
+		row := rosterRow{line: line, fields: map[string]string{}}
+		for name, i := range indexes {
+			if i < len(fields) {
+				row.fields[name] = fields[i]
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
@@ -0,0 +1,81 @@
+package api_test
+
+import (
+	"context"
+	"github.com/mzeevi/library/internal/api"
+	"github.com/mzeevi/library/internal/api/apitest"
+	"github.com/mzeevi/library/internal/data"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestImportPatrons(t *testing.T) {
+	a := apitest.New(t)
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+	a.SeedPatron(apitest.Patron("registered@example.com"))
+
+	roster := "\ufeffStudent_ID,Email,Name,Category,Grade\n" +
+		"1001,noa@example.com,Noa Levi,student,7\n" +
+		"1002,not-an-email,Dan Cohen,student,7\n" +
+		"1003,maya@example.com,Maya Katz,pupil,8\n" +
+		"1004,NOA@example.com,Noa Levi,student,7\n" +
+		"1005,registered@example.com,Registered,student,8\n" +
+		",\"teacher@example.com\",\"Ruth\nBen-David\",teacher,\n"
+
+	rec := a.Do(http.MethodPost, "/patrons/import", admin, "Content-Type: text/csv", []byte(roster))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /patrons/import status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	var report api.ImportReport
+	a.Decode(rec, &report)
+
+	if report.Created != 2 || report.Exists != 1 || report.Invalid != 3 {
+		t.Errorf("report = %d created, %d exist, %d invalid; want 2, 1, 3", report.Created, report.Exists, report.Invalid)
+	}
+
+	want := []struct {
+		row    int
+		status string
+	}{
+		{2, api.ImportCreated}, {3, api.ImportInvalid}, {4, api.ImportInvalid}, {5, api.ImportInvalid}, {6, api.ImportExists}, {7, api.ImportCreated},
+	}
+	if len(report.Rows) != len(want) {
+		t.Fatalf("report has %d rows; want %d", len(report.Rows), len(want))
+	}
+	for i, w := range want {
+		if got := report.Rows[i]; got.Row != w.row || got.Status != w.status {
+			t.Errorf("row %d = line %d %s (%s); want line %d %s", i, got.Row, got.Status, got.Error, w.row, w.status)
+		}
+	}
+
+	patron, err := a.Models.Patrons.Get(context.Background(), data.PatronFilter{ID: apitest.Ptr(data.PatronID(report.Rows[0].PatronID))})
+	if err != nil {
+		t.Fatalf("failed to get imported patron: %v", err)
+	}
+	if patron.ExternalIDs["sis"] != "1001" || patron.Category != data.StudentCategory || patron.Activated {
+		t.Errorf("imported patron = %+v; want an inactive student with student ID 1001", patron)
+	}
+
+	// An imported patron has no password, so they set one when they activate.
+	token, err := a.Models.Tokens.New(context.Background(), patron.ID, time.Hour, data.ScopeActivation)
+	if err != nil {
+		t.Fatalf("failed to create token: %v", err)
+	}
+	if rec := a.Do(http.MethodPut, "/patrons/activated", map[string]string{"token": token.Plaintext}); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("PUT /patrons/activated without a password status = %v; want %v", rec.Code, http.StatusUnprocessableEntity)
+	}
+	if rec := a.Do(http.MethodPut, "/patrons/activated", map[string]string{"token": token.Plaintext, "password": "pa55word1234"}); rec.Code != http.StatusOK {
+		t.Fatalf("PUT /patrons/activated with a password status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	login := map[string]string{"email": "noa@example.com", "password": "pa55word1234"}
+	if rec := a.Do(http.MethodPost, "/token/authentication", login); rec.Code != http.StatusOK {
+		t.Errorf("POST /token/authentication status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	if rec := a.Do(http.MethodPost, "/patrons/import", admin, "Content-Type: text/csv", []byte("name,email\nNoa,noa@example.com\n")); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("POST /patrons/import without a category column status = %v; want %v", rec.Code, http.StatusUnprocessableEntity)
+	}
+}
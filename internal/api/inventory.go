@@ -0,0 +1,415 @@
+package api
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/mzeevi/library/internal/data"
+	"github.com/mzeevi/library/internal/isbn"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	errInventoryClosedMsg = "the inventory session is closed"
+)
+
+type OpenInventoryInput struct {
+	Body struct {
+		Name   string   `json:"name" minLength:"1" maxLength:"200"`
+		Genres []string `json:"genres,omitempty" required:"false" uniqueItems:"true" doc:"Genres of the section whose stock is taken. All books by default"`
+	}
+}
+
+type InventorySessionOutput struct {
+	Location string                `header:"Location"`
+	Body     data.InventorySession `json:"session"`
+}
+
+type InventorySessionInput struct {
+	ID string `json:"id" path:"id"`
+}
+
+type GetInventorySessionsInput struct {
+	PaginationInput
+	Status string `query:"status" enum:"open,closed" doc:"Filter by status"`
+	Sort   string `query:"sort" enum:"opened_at,-opened_at" default:"-opened_at"`
+}
+
+type GetInventorySessionsOutput struct {
+	Body InventorySessionsInfo
+}
+
+type InventorySessionsInfo struct {
+	Sessions []data.InventorySession `json:"sessions"`
+	Metadata data.Metadata           `json:"metadata"`
+}
+
+type ScanInventoryInput struct {
+	ID   string `json:"id" path:"id"`
+	Body struct {
+		Barcodes []string `json:"barcodes" minItems:"1" maxItems:"500" doc:"Barcodes of the copies which were scanned since the last request, one for each copy"`
+	}
+}
+
+type ScanInventoryOutput struct {
+	Body InventoryScans
+}
+
+// InventoryScans is the result of recording scanned barcodes, with the barcodes which are not ISBNs.
+type InventoryScans struct {
+	Scanned int      `json:"scanned"`
+	Invalid []string `json:"invalid"`
+}
+
+type InventoryReportOutput struct {
+	Body data.InventoryReport
+}
+
+// Resolve validates the input in OpenInventoryInput.
+func (i *OpenInventoryInput) Resolve(ctx huma.Context) []error {
+	i.Body.Name = strings.TrimSpace(i.Body.Name)
+
+	return nil
+}
+
+// Resolve validates the input in InventorySessionInput.
+func (i *InventorySessionInput) Resolve(ctx huma.Context) []error {
+	if err := validateID(&i.ID, "path.id"); err != nil {
+		return []error{err}
+	}
+
+	return nil
+}
+
+// Resolve validates the input in ScanInventoryInput.
+func (i *ScanInventoryInput) Resolve(ctx huma.Context) []error {
+	if err := validateID(&i.ID, "path.id"); err != nil {
+		return []error{err}
+	}
+
+	return nil
+}
+
+// inventorySession fetches the inventory session with id, as a huma error if it does not exist.
+func (app *Application) inventorySession(ctx context.Context, id string) (*data.InventorySession, error) {
+	session, err := app.Models.InventorySessions.Get(ctx, data.InventorySessionFilter{ID: &id})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return nil, huma.Error404NotFound(errNotFoundMsg)
+		default:
+			return nil, app.serverError(ctx, err)
+		}
+	}
+
+	return session, nil
+}
+
+// buildInventoryReport compares the copies which were scanned in a session with the copies on the
+// shelves of the books in the genres of the session. Copies of books outside of the genres are
+// misplaced, and barcodes which are not identifiers of books of the catalog are unknown.
+func (app *Application) buildInventoryReport(ctx context.Context, session *data.InventorySession, now time.Time) (*data.InventoryReport, error) {
+	scans, err := app.Models.InventoryScans.GetAll(ctx, data.InventoryScanFilter{SessionID: &session.ID})
+	if err != nil {
+		return nil, err
+	}
+
+	report := &data.InventoryReport{
+		GeneratedAt:   now,
+		Scanned:       len(scans),
+		Discrepancies: make([]data.InventoryDiscrepancy, 0),
+		Unrecognized:  make([]data.UnknownBarcode, 0),
+	}
+
+	scanned := make(map[string]int)
+	unknown := make(map[string]int)
+	for _, scan := range scans {
+		if scan.ISBN == "" {
+			unknown[scan.Barcode]++
+			continue
+		}
+		scanned[scan.ISBN]++
+	}
+
+	books, _, err := app.Models.Books.GetAll(ctx, data.BookFilter{Genres: session.Genres}, data.Paginator{}, data.Sorter{})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, book := range books {
+		// The copies of e-books are license seats, which are not on the shelves.
+		if book.Format == data.FormatEbook {
+			continue
+		}
+
+		expected := max(book.Copies-book.BorrowedCopies, 0)
+
+		// Copies of the same book may carry any of its identifiers, such as its ISBN-10 or e-ISBN.
+		count := 0
+		for _, identifier := range book.Identifiers {
+			count += scanned[identifier.Value]
+			delete(scanned, identifier.Value)
+		}
+
+		report.Expected += expected
+
+		discrepancy := data.InventoryDiscrepancy{BookID: book.ID, ISBN: book.ISBN(), Title: book.Title, Expected: expected, Scanned: count}
+		switch {
+		case count < expected:
+			discrepancy.Kind = data.DiscrepancyMissing
+			report.Missing += expected - count
+		case count > expected:
+			discrepancy.Kind = data.DiscrepancySurplus
+			report.Surplus += count - expected
+		default:
+			continue
+		}
+		report.Discrepancies = append(report.Discrepancies, discrepancy)
+	}
+
+	misplaced := make(map[string]*data.InventoryDiscrepancy)
+	for code, count := range scanned {
+		book, err := app.Models.Books.Get(ctx, data.BookFilter{Identifier: &code})
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrDocumentNotFound):
+				unknown[code] += count
+				continue
+			default:
+				return nil, err
+			}
+		}
+
+		report.Misplaced += count
+		if discrepancy, ok := misplaced[book.ID]; ok {
+			discrepancy.Scanned += count
+			continue
+		}
+		misplaced[book.ID] = &data.InventoryDiscrepancy{
+			BookID:  book.ID,
+			ISBN:    book.ISBN(),
+			Title:   book.Title,
+			Kind:    data.DiscrepancyMisplaced,
+			Scanned: count,
+		}
+	}
+	for _, discrepancy := range misplaced {
+		report.Discrepancies = append(report.Discrepancies, *discrepancy)
+	}
+
+	for barcode, count := range unknown {
+		report.Unknown += count
+		report.Unrecognized = append(report.Unrecognized, data.UnknownBarcode{Barcode: barcode, Count: count})
+	}
+
+	slices.SortFunc(report.Discrepancies, func(a, b data.InventoryDiscrepancy) int {
+		return cmp.Or(cmp.Compare(a.Kind, b.Kind), cmp.Compare(a.Title, b.Title), cmp.Compare(a.ISBN, b.ISBN))
+	})
+	slices.SortFunc(report.Unrecognized, func(a, b data.UnknownBarcode) int {
+		return cmp.Compare(a.Barcode, b.Barcode)
+	})
+
+	return report, nil
+}
+
+// openInventoryHandler handles a request to open an inventory session.
+func (app *Application) openInventoryHandler(ctx context.Context, input *OpenInventoryInput) (*InventorySessionOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	admin, ok := adminFromContext(ctx)
+	if !ok {
+		return &InventorySessionOutput{}, app.serverError(ctx, errors.New("no admin in the context of an admin request"))
+	}
+
+	session := &data.InventorySession{
+		Name:     input.Body.Name,
+		Genres:   input.Body.Genres,
+		Status:   data.InventoryStatusOpen,
+		OpenedBy: admin.Name,
+		OpenedAt: time.Now(),
+	}
+
+	id, err := app.Models.InventorySessions.Insert(ctx, session)
+	if err != nil {
+		return &InventorySessionOutput{}, app.serverError(ctx, err)
+	}
+	session.ID = id
+
+	resp := &InventorySessionOutput{
+		Body:     *session,
+		Location: fmt.Sprintf("%s/%s/%s", basePath, inventoryKey, id),
+	}
+
+	return resp, nil
+}
+
+// getInventorySessionHandler fetches an inventory session by its ID.
+func (app *Application) getInventorySessionHandler(ctx context.Context, input *InventorySessionInput) (*InventorySessionOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	session, err := app.inventorySession(ctx, input.ID)
+	if err != nil {
+		return &InventorySessionOutput{}, err
+	}
+
+	resp := &InventorySessionOutput{
+		Body:     *session,
+		Location: fmt.Sprintf("%s/%s/%s", basePath, inventoryKey, session.ID),
+	}
+
+	return resp, nil
+}
+
+// getInventorySessionsHandler fetches inventory sessions with pagination, filtering and sorting.
+func (app *Application) getInventorySessionsHandler(ctx context.Context, input *GetInventorySessionsInput) (*GetInventorySessionsOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	paginator := data.Paginator{Page: input.Page, PageSize: input.PageSize}
+	sorter := data.Sorter{Field: input.Sort, SortSafelist: supportedInventorySortFields, Collation: app.collation}
+
+	filter := data.InventorySessionFilter{}
+	if input.Status != "" {
+		filter.Status = &input.Status
+	}
+
+	sessions, metadata, err := app.Models.InventorySessions.GetAll(ctx, filter, paginator, sorter)
+	if err != nil {
+		return &GetInventorySessionsOutput{}, app.serverError(ctx, err)
+	}
+
+	resp := &GetInventorySessionsOutput{
+		Body: InventorySessionsInfo{
+			Sessions: sessions,
+			Metadata: metadata,
+		},
+	}
+
+	return resp, nil
+}
+
+// scanInventoryHandler handles a request to record barcodes which were scanned in an open
+// inventory session. Scanners send the barcodes in batches as they scan them, and every barcode is
+// counted as one copy, including barcodes which are not ISBNs, which are reported as unknown.
+func (app *Application) scanInventoryHandler(ctx context.Context, input *ScanInventoryInput) (*ScanInventoryOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	admin, ok := adminFromContext(ctx)
+	if !ok {
+		return &ScanInventoryOutput{}, app.serverError(ctx, errors.New("no admin in the context of an admin request"))
+	}
+
+	session, err := app.inventorySession(ctx, input.ID)
+	if err != nil {
+		return &ScanInventoryOutput{}, err
+	}
+
+	if session.Status != data.InventoryStatusOpen {
+		return &ScanInventoryOutput{}, huma.Error422UnprocessableEntity(errInventoryClosedMsg)
+	}
+
+	now := time.Now()
+	result := InventoryScans{Invalid: make([]string, 0)}
+	scans := make([]*data.InventoryScan, 0, len(input.Body.Barcodes))
+	for _, barcode := range input.Body.Barcodes {
+		barcode = strings.TrimSpace(barcode)
+
+		code, err := isbn.FromBarcode(barcode)
+		if err != nil {
+			result.Invalid = append(result.Invalid, barcode)
+		}
+
+		scans = append(scans, &data.InventoryScan{
+			SessionID: session.ID,
+			Barcode:   barcode,
+			ISBN:      code,
+			ScannedBy: admin.Name,
+			ScannedAt: now,
+		})
+	}
+
+	if _, err = app.Models.InventoryScans.InsertMany(ctx, scans); err != nil {
+		return &ScanInventoryOutput{}, app.serverError(ctx, err)
+	}
+	result.Scanned = len(scans)
+
+	resp := &ScanInventoryOutput{
+		Body: result,
+	}
+
+	return resp, nil
+}
+
+// getInventoryReportHandler handles a request for the discrepancy report of an inventory session,
+// which is built from the scans so far while the session is open.
+func (app *Application) getInventoryReportHandler(ctx context.Context, input *InventorySessionInput) (*InventoryReportOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), reportTimeout)
+	defer cancel()
+
+	session, err := app.inventorySession(ctx, input.ID)
+	if err != nil {
+		return &InventoryReportOutput{}, err
+	}
+
+	report := session.Report
+	if report == nil {
+		report, err = app.buildInventoryReport(ctx, session, time.Now())
+		if err != nil {
+			return &InventoryReportOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	resp := &InventoryReportOutput{
+		Body: *report,
+	}
+
+	return resp, nil
+}
+
+// closeInventoryHandler handles a request to close an inventory session. The discrepancy report
+// is built and stored with the session, so that it is kept as the stock was when it was taken.
+func (app *Application) closeInventoryHandler(ctx context.Context, input *InventorySessionInput) (*InventorySessionOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), reportTimeout)
+	defer cancel()
+
+	session, err := app.inventorySession(ctx, input.ID)
+	if err != nil {
+		return &InventorySessionOutput{}, err
+	}
+
+	if session.Status != data.InventoryStatusOpen {
+		return &InventorySessionOutput{}, huma.Error422UnprocessableEntity(errInventoryClosedMsg)
+	}
+
+	now := time.Now()
+	session.Report, err = app.buildInventoryReport(ctx, session, now)
+	if err != nil {
+		return &InventorySessionOutput{}, app.serverError(ctx, err)
+	}
+	session.Status = data.InventoryStatusClosed
+	session.ClosedAt = now
+
+	err = app.Models.InventorySessions.Update(ctx, data.InventorySessionFilter{ID: &session.ID}, session)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			return &InventorySessionOutput{}, huma.Error409Conflict(errConflictMsg)
+		default:
+			return &InventorySessionOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	resp := &InventorySessionOutput{
+		Body:     *session,
+		Location: fmt.Sprintf("%s/%s/%s", basePath, inventoryKey, session.ID),
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,90 @@
+package api_test
+
+import (
+	"github.com/mzeevi/library/internal/api/apitest"
+	"github.com/mzeevi/library/internal/auth"
+	"github.com/mzeevi/library/internal/data"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestInventory(t *testing.T) {
+	a := apitest.New(t)
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+
+	shelvedID := a.SeedBook(apitest.Book("9780306406157", 3))
+	surplusID := a.SeedBook(apitest.Book("9781861972712", 1))
+	history := apitest.Book("9780140449136", 1)
+	history.Genres = []string{"History"}
+	historyID := a.SeedBook(history)
+
+	patronID := a.SeedPatron(apitest.Patron("patron@example.com", auth.BorrowBookPermission))
+	borrow := map[string]any{"patron_id": patronID, "book_id": shelvedID, "due_date": time.Now().Add(14 * 24 * time.Hour), "copies": 1}
+	if rec := a.Do(http.MethodPost, "/transactions/borrow", a.PatronAuth(patronID), borrow); rec.Code != http.StatusOK {
+		t.Fatalf("borrow status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	rec := a.Do(http.MethodPost, "/inventory", admin, map[string]any{"name": "Fiction 2026", "genres": []string{"Fiction"}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("open status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var session data.InventorySession
+	a.Decode(rec, &session)
+	if session.Status != data.InventoryStatusOpen || session.OpenedBy != "admin" {
+		t.Fatalf("session = %+v; want an open session opened by admin", session)
+	}
+
+	batches := [][]string{
+		{"9780306406157", "9781861972712", "not-a-barcode"},
+		{"9781861972712", "9780140449136", "9780000000002"},
+	}
+	for _, barcodes := range batches {
+		rec = a.Do(http.MethodPost, "/inventory/"+session.ID+"/scans", admin, map[string]any{"barcodes": barcodes})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("scan status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+		}
+	}
+
+	want := data.InventoryReport{
+		Expected:  3,
+		Scanned:   6,
+		Missing:   1,
+		Surplus:   1,
+		Misplaced: 1,
+		Unknown:   2,
+		Discrepancies: []data.InventoryDiscrepancy{
+			{BookID: historyID, ISBN: "9780140449136", Title: "Test Book", Kind: data.DiscrepancyMisplaced, Scanned: 1},
+			{BookID: shelvedID, ISBN: "9780306406157", Title: "Test Book", Kind: data.DiscrepancyMissing, Expected: 2, Scanned: 1},
+			{BookID: surplusID, ISBN: "9781861972712", Title: "Test Book", Kind: data.DiscrepancySurplus, Expected: 1, Scanned: 2},
+		},
+		Unrecognized: []data.UnknownBarcode{
+			{Barcode: "9780000000002", Count: 1},
+			{Barcode: "not-a-barcode", Count: 1},
+		},
+	}
+
+	rec = a.Do(http.MethodGet, "/inventory/"+session.ID+"/report", admin)
+	var report data.InventoryReport
+	a.Decode(rec, &report)
+	report.GeneratedAt = time.Time{}
+	if !reflect.DeepEqual(report, want) {
+		t.Errorf("report = %+v; want %+v", report, want)
+	}
+
+	rec = a.Do(http.MethodPost, "/inventory/"+session.ID+"/close", admin)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("close status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	a.Decode(rec, &session)
+	if session.Status != data.InventoryStatusClosed || session.Report == nil || session.Report.Missing != 1 {
+		t.Errorf("closed session = %+v; want a closed session with its report", session)
+	}
+
+	rec = a.Do(http.MethodPost, "/inventory/"+session.ID+"/scans", admin, map[string]any{"barcodes": []string{"9780306406157"}})
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("scan of a closed session status = %v; want %v", rec.Code, http.StatusUnprocessableEntity)
+	}
+}
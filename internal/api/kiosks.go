@@ -0,0 +1,531 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/mzeevi/library/internal/auth"
+	"github.com/mzeevi/library/internal/data"
+	"slices"
+	"time"
+)
+
+const (
+	errKioskRequestReusedMsg     = "the request ID was already used for another request"
+	errKioskRequestInProgressMsg = "the request is already being processed, retry it to get its result"
+)
+
+type CreateKioskInput struct {
+	Body struct {
+		Name        string   `json:"name" minLength:"1"`
+		Branch      string   `json:"branch" minLength:"1" doc:"Branch the kiosk is at, which is recorded on the books borrowed at it"`
+		Permissions []string `json:"permissions,omitempty" doc:"Permissions of the kiosk, out of book:borrow, book:return and book:lookup. All of them by default"`
+		RequirePIN  bool     `json:"require_pin,omitempty" doc:"Identify patrons only by the tokens they get by logging in with their PIN"`
+	}
+}
+
+type CreateKioskOutput struct {
+	Body data.Kiosk `json:"kiosk"`
+}
+
+type GetKiosksInput struct {
+	PaginationInput
+	Branch string `query:"branch" doc:"Filter by branch"`
+	Sort   string `query:"sort" enum:"name,branch,created_at,-name,-branch,-created_at" default:"name"`
+}
+
+type GetKiosksOutput struct {
+	Body KiosksInfo
+}
+
+type KiosksInfo struct {
+	Kiosks   []data.Kiosk  `json:"kiosks"`
+	Metadata data.Metadata `json:"metadata"`
+}
+
+type DeleteKioskInput struct {
+	ID string `json:"id" path:"id"`
+}
+
+type DeleteKioskOutput struct {
+	Body string `json:"message"`
+}
+
+// KioskRequestInput identifies a borrow or return of a kiosk, so that it is applied once however
+// many times it is sent, such as when the kiosk retries it from its offline queue.
+type KioskRequestInput struct {
+	IdempotencyKey string `header:"Idempotency-Key" required:"true" minLength:"16" maxLength:"128" doc:"Unique ID of the request, such as a UUID, which the kiosk generates once and sends on every retry"`
+}
+
+type LookupKioskBookInput struct {
+	Barcode string `path:"barcode" doc:"ISBN-13 (EAN-13) or ISBN-10 barcode of the book"`
+}
+
+type LookupKioskBookOutput struct {
+	Body KioskBook
+}
+
+type KioskBook struct {
+	ID              string   `json:"id"`
+	Title           string   `json:"title"`
+	Authors         []string `json:"authors"`
+	ISBN            string   `json:"isbn"`
+	AvailableCopies int      `json:"available_copies"`
+}
+
+type KioskBorrowInput struct {
+	KioskRequestInput
+	Body struct {
+		PatronID    string     `json:"patron_id,omitempty" doc:"ID of the patron, unless the patron logged in with their PIN"`
+		PatronToken string     `json:"patron_token,omitempty" doc:"Token of the patron who logged in at the kiosk with their PIN"`
+		Barcode     string     `json:"barcode" doc:"ISBN-13 (EAN-13) or ISBN-10 barcode of the book"`
+		Copies      int        `json:"copies" required:"false" minimum:"1" default:"1"`
+		OccurredAt  *time.Time `json:"occurred_at,omitempty" format:"date-time" doc:"When the book was borrowed, if the request was queued while the kiosk was offline"`
+	}
+}
+
+type KioskReturnInput struct {
+	KioskRequestInput
+	Body struct {
+		PatronID    string     `json:"patron_id,omitempty" doc:"ID of the patron, unless the patron logged in with their PIN"`
+		PatronToken string     `json:"patron_token,omitempty" doc:"Token of the patron who logged in at the kiosk with their PIN"`
+		Barcode     string     `json:"barcode" doc:"ISBN-13 (EAN-13) or ISBN-10 barcode of the book"`
+		Copies      int        `json:"copies" required:"false" minimum:"1" default:"1"`
+		OccurredAt  *time.Time `json:"occurred_at,omitempty" format:"date-time" doc:"When the book was returned, if the request was queued while the kiosk was offline. The fine is calculated at this time"`
+	}
+}
+
+type KioskLoanOutput struct {
+	Replayed string `header:"Idempotent-Replayed" doc:"true if the request was already applied, and this is its result"`
+	Body     KioskLoan
+}
+
+// KioskLoan is the result of a borrow or return at a kiosk, with only what the kiosk displays.
+type KioskLoan struct {
+	TransactionID string    `json:"transaction_id"`
+	Status        string    `json:"status"`
+	Title         string    `json:"title"`
+	ISBN          string    `json:"isbn"`
+	Copies        int       `json:"copies"`
+	DueDate       time.Time `json:"due_date"`
+	ReturnedAt    time.Time `json:"returned_at,omitempty"`
+	Fine          float64   `json:"fine"`
+}
+
+// Resolve validates the input in CreateKioskInput.
+func (k *CreateKioskInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	for i, permission := range k.Body.Permissions {
+		if !slices.Contains(auth.KioskPermissions, permission) {
+			errs = append(errs, &huma.ErrorDetail{
+				Location: fmt.Sprintf("body.permissions[%d]", i),
+				Message:  "Kiosks may only be granted book:borrow, book:return and book:lookup",
+				Value:    permission,
+			})
+		}
+	}
+
+	return errs
+}
+
+// Resolve validates the input in DeleteKioskInput.
+func (k *DeleteKioskInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	err := validateID(&k.ID, "path.id")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// Resolve validates the input in LookupKioskBookInput.
+func (k *LookupKioskBookInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	err := validateBarcode(&k.Barcode, "path.barcode")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// Resolve validates the input in KioskBorrowInput.
+func (k *KioskBorrowInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	err := validateKioskPatron(k.Body.PatronID, k.Body.PatronToken, "body.patron_id")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	err = validateBarcode(&k.Body.Barcode, "body.barcode")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	err = validateOccurredAt(k.Body.OccurredAt, time.Now(), "body.occurred_at")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// Resolve validates the input in KioskReturnInput.
+func (k *KioskReturnInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	err := validateKioskPatron(k.Body.PatronID, k.Body.PatronToken, "body.patron_id")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	err = validateBarcode(&k.Body.Barcode, "body.barcode")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	err = validateOccurredAt(k.Body.OccurredAt, time.Now(), "body.occurred_at")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// createKioskHandler handles a request to register a kiosk. The API key of the kiosk is only
+// returned in the response, since only its hash is stored.
+func (app *Application) createKioskHandler(ctx context.Context, input *CreateKioskInput) (*CreateKioskOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	permissions := input.Body.Permissions
+	if len(permissions) == 0 {
+		permissions = auth.KioskPermissions
+	}
+
+	kiosk, err := data.NewKiosk(input.Body.Name, input.Body.Branch, permissions, input.Body.RequirePIN)
+	if err != nil {
+		return &CreateKioskOutput{}, app.serverError(ctx, err)
+	}
+
+	kiosk.ID, err = app.Models.Kiosks.Insert(ctx, kiosk)
+	if err != nil {
+		return &CreateKioskOutput{}, app.serverError(ctx, err)
+	}
+
+	resp := &CreateKioskOutput{
+		Body: *kiosk,
+	}
+
+	return resp, nil
+}
+
+// getKiosksHandler handles a request to list the kiosks.
+func (app *Application) getKiosksHandler(ctx context.Context, input *GetKiosksInput) (*GetKiosksOutput, error) {
+	paginator := data.Paginator{Page: input.Page, PageSize: input.PageSize}
+	sorter := data.Sorter{Field: input.Sort, SortSafelist: supportedKiosksSortFields, Collation: app.collation}
+
+	filter := data.KioskFilter{}
+	if input.Branch != "" {
+		filter.Branch = &input.Branch
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	kiosks, metadata, err := app.Models.Kiosks.GetAll(ctx, filter, paginator, sorter)
+	if err != nil {
+		return &GetKiosksOutput{}, app.serverError(ctx, err)
+	}
+
+	resp := &GetKiosksOutput{
+		Body: KiosksInfo{
+			Kiosks:   kiosks,
+			Metadata: metadata,
+		},
+	}
+
+	return resp, nil
+}
+
+// deleteKioskHandler handles a request to delete a kiosk, which revokes its API key.
+func (app *Application) deleteKioskHandler(ctx context.Context, input *DeleteKioskInput) (*DeleteKioskOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	err := app.Models.Kiosks.Delete(ctx, data.KioskFilter{ID: &input.ID})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return &DeleteKioskOutput{}, huma.Error404NotFound(errNotFoundMsg)
+		default:
+			return &DeleteKioskOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	resp := &DeleteKioskOutput{
+		Body: "kiosk successfully deleted",
+	}
+
+	return resp, nil
+}
+
+// lookupKioskBookHandler handles a request of a kiosk to find a book by its barcode.
+func (app *Application) lookupKioskBookHandler(ctx context.Context, input *LookupKioskBookInput) (*LookupKioskBookOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	book, err := app.Models.Books.Get(ctx, data.BookFilter{Identifier: &input.Barcode})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return &LookupKioskBookOutput{}, huma.Error404NotFound(errNotFoundMsg)
+		default:
+			return &LookupKioskBookOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	resp := &LookupKioskBookOutput{
+		Body: KioskBook{
+			ID:              book.ID,
+			Title:           book.Title,
+			Authors:         book.Authors,
+			ISBN:            book.ISBN(),
+			AvailableCopies: book.Copies - book.BorrowedCopies,
+		},
+	}
+
+	return resp, nil
+}
+
+// kioskBorrowHandler handles a request of a kiosk to borrow a book by its barcode. The book is
+// due at the end of the loan period of the category of the patron.
+func (app *Application) kioskBorrowHandler(ctx context.Context, input *KioskBorrowInput) (*KioskLoanOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	kiosk, _ := kioskFromContext(ctx)
+
+	loan, err := app.replayKioskRequest(ctx, kiosk, input.IdempotencyKey, data.KioskOperationBorrow)
+	if err != nil {
+		return &KioskLoanOutput{}, app.transactionError(ctx, err)
+	}
+	if loan != nil {
+		return &KioskLoanOutput{Replayed: "true", Body: *loan}, nil
+	}
+
+	patronID, err := app.kioskPatronID(kiosk, input.Body.PatronID, input.Body.PatronToken)
+	if err != nil {
+		return &KioskLoanOutput{}, err
+	}
+
+	borrowedAt := time.Now()
+	if input.Body.OccurredAt != nil {
+		borrowedAt = *input.Body.OccurredAt
+	}
+
+	var transaction *data.Transaction
+
+	err = app.Models.Transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		book, err := app.Models.Books.Get(ctx, data.BookFilter{Identifier: &input.Body.Barcode})
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrDocumentNotFound):
+				return huma.Error404NotFound("the requested book resource could not be found")
+			default:
+				return err
+			}
+		}
+
+		patron, err := app.Models.Patrons.Get(ctx, data.PatronFilter{ID: ptr(data.PatronID(patronID))})
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrDocumentNotFound):
+				return huma.Error404NotFound("the requested patron resource could not be found")
+			default:
+				return err
+			}
+		}
+
+		if patron.Suspended {
+			return huma.Error403Forbidden(errSuspendedAccountMsg)
+		}
+
+		transaction, err = app.borrowBook(ctx, borrowRequest{
+			PatronID:   patron.ID,
+			BookID:     book.ID,
+			Copies:     input.Body.Copies,
+			BorrowedAt: borrowedAt,
+			Branch:     kiosk.Branch,
+		})
+		if err != nil {
+			return err
+		}
+
+		return app.recordKioskRequest(ctx, kiosk, input.IdempotencyKey, data.KioskOperationBorrow, transaction.ID, input.Body.Copies)
+	})
+	if err != nil {
+		return &KioskLoanOutput{}, app.transactionError(ctx, err)
+	}
+
+	loan, err = app.kioskLoan(ctx, transaction, input.Body.Copies)
+	if err != nil {
+		return &KioskLoanOutput{}, app.serverError(ctx, err)
+	}
+
+	resp := &KioskLoanOutput{
+		Body: *loan,
+	}
+
+	return resp, nil
+}
+
+// kioskReturnHandler handles a request of a kiosk to return a book by its barcode.
+func (app *Application) kioskReturnHandler(ctx context.Context, input *KioskReturnInput) (*KioskLoanOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	kiosk, _ := kioskFromContext(ctx)
+
+	loan, err := app.replayKioskRequest(ctx, kiosk, input.IdempotencyKey, data.KioskOperationReturn)
+	if err != nil {
+		return &KioskLoanOutput{}, app.transactionError(ctx, err)
+	}
+	if loan != nil {
+		return &KioskLoanOutput{Replayed: "true", Body: *loan}, nil
+	}
+
+	patronID, err := app.kioskPatronID(kiosk, input.Body.PatronID, input.Body.PatronToken)
+	if err != nil {
+		return &KioskLoanOutput{}, err
+	}
+
+	returnedAt := time.Now()
+	if input.Body.OccurredAt != nil {
+		returnedAt = *input.Body.OccurredAt
+	}
+
+	var transaction *data.Transaction
+
+	err = app.Models.Transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		book, err := app.Models.Books.Get(ctx, data.BookFilter{Identifier: &input.Body.Barcode})
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrDocumentNotFound):
+				return huma.Error404NotFound("the requested book resource could not be found")
+			default:
+				return err
+			}
+		}
+
+		_, transaction, err = app.returnBook(ctx, returnRequest{
+			PatronID:   patronID,
+			BookID:     book.ID,
+			Copies:     input.Body.Copies,
+			ReturnedAt: returnedAt,
+		})
+		if err != nil {
+			return err
+		}
+
+		return app.recordKioskRequest(ctx, kiosk, input.IdempotencyKey, data.KioskOperationReturn, transaction.ID, input.Body.Copies)
+	})
+	if err != nil {
+		return &KioskLoanOutput{}, app.transactionError(ctx, err)
+	}
+
+	loan, err = app.kioskLoan(ctx, transaction, input.Body.Copies)
+	if err != nil {
+		return &KioskLoanOutput{}, app.serverError(ctx, err)
+	}
+
+	resp := &KioskLoanOutput{
+		Body: *loan,
+	}
+
+	return resp, nil
+}
+
+// replayKioskRequest returns the result of a request which the kiosk already sent, or nil if it
+// was not sent before. A request ID which was used by another kiosk or for another operation is
+// rejected.
+func (app *Application) replayKioskRequest(ctx context.Context, kiosk *data.Kiosk, requestID, operation string) (*KioskLoan, error) {
+	request, err := app.Models.KioskRequests.Get(ctx, data.KioskRequestFilter{RequestID: &requestID})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return nil, nil
+		default:
+			return nil, err
+		}
+	}
+
+	if request.KioskID != kiosk.ID || request.Operation != operation {
+		return nil, huma.Error422UnprocessableEntity(errKioskRequestReusedMsg)
+	}
+
+	transaction, err := app.Models.Transactions.Get(ctx, data.TransactionFilter{ID: ptr(data.TransactionID(request.TransactionID))})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return nil, huma.Error404NotFound("the requested transaction resource could not be found")
+		default:
+			return nil, err
+		}
+	}
+
+	return app.kioskLoan(ctx, transaction, request.Copies)
+}
+
+// recordKioskRequest records a request of a kiosk within the database transaction which applies it,
+// so that the request is replayed rather than applied again if the kiosk sends it again.
+func (app *Application) recordKioskRequest(ctx context.Context, kiosk *data.Kiosk, requestID, operation, transactionID string, copies int) error {
+	_, err := app.Models.KioskRequests.Insert(ctx, &data.KioskRequest{
+		RequestID:     requestID,
+		KioskID:       kiosk.ID,
+		Operation:     operation,
+		TransactionID: transactionID,
+		Copies:        copies,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateRequestID):
+			return huma.Error409Conflict(errKioskRequestInProgressMsg)
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// kioskLoan returns the result of a borrow or return of copies of a book at a kiosk.
+func (app *Application) kioskLoan(ctx context.Context, transaction *data.Transaction, copies int) (*KioskLoan, error) {
+	loan := &KioskLoan{
+		TransactionID: transaction.ID,
+		Status:        transaction.Status,
+		Copies:        copies,
+		DueDate:       transaction.DueDate,
+		ReturnedAt:    transaction.ReturnedAt,
+	}
+
+	book, err := app.Models.Books.Get(ctx, data.BookFilter{ID: ptr(data.BookID(transaction.BookID))})
+	switch {
+	case err == nil:
+		loan.Title, loan.ISBN = book.Title, book.ISBN()
+	case !errors.Is(err, data.ErrDocumentNotFound):
+		return nil, err
+	}
+
+	if transaction.Status == data.TransactionStatusReturned {
+		loan.Fine = calculateFine(*transaction, app.cost.overdueFine, transaction.ReturnedAt, app.location)
+	}
+
+	return loan, nil
+}
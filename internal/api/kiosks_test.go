@@ -0,0 +1,134 @@
+package api_test
+
+import (
+	"context"
+	"github.com/mzeevi/library/internal/api"
+	"github.com/mzeevi/library/internal/api/apitest"
+	"github.com/mzeevi/library/internal/auth"
+	"github.com/mzeevi/library/internal/data"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestKiosk(t *testing.T) {
+	a := apitest.New(t)
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+
+	bookID := a.SeedBook(apitest.Book("9780306406157", 2))
+	patronID := a.SeedPatron(apitest.Patron("patron@example.com"))
+
+	rec := a.Do(http.MethodPost, "/kiosks", admin, map[string]any{"name": "Lobby", "branch": "north"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("create kiosk status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var kiosk data.Kiosk
+	a.Decode(rec, &kiosk)
+	if kiosk.Key == "" {
+		t.Fatalf("create kiosk returned no key")
+	}
+	key := "Authorization: Bearer " + kiosk.Key
+
+	rec = a.Do(http.MethodPost, "/kiosks", admin, map[string]any{"name": "Desk", "branch": "north", "permissions": []string{auth.WriteBooksPermission}})
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("create kiosk with books:write status = %v; want %v", rec.Code, http.StatusUnprocessableEntity)
+	}
+
+	if rec := a.Do(http.MethodGet, "/kiosk/books/0-306-40615-2", a.PatronAuth(patronID)); rec.Code != http.StatusUnauthorized {
+		t.Errorf("lookup with patron token status = %v; want %v", rec.Code, http.StatusUnauthorized)
+	}
+	if rec := a.Do(http.MethodGet, "/books/"+bookID, key); rec.Code != http.StatusUnauthorized {
+		t.Errorf("get book with kiosk key status = %v; want %v", rec.Code, http.StatusUnauthorized)
+	}
+
+	rec = a.Do(http.MethodGet, "/kiosk/books/0-306-40615-2", key)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("lookup status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var book api.KioskBook
+	a.Decode(rec, &book)
+	if book.ID != bookID || book.AvailableCopies != 2 {
+		t.Errorf("lookup = %+v; want book %v with 2 available copies", book, bookID)
+	}
+
+	if rec := a.Do(http.MethodGet, "/kiosk/books/9780306406158", key); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("lookup invalid barcode status = %v; want %v", rec.Code, http.StatusUnprocessableEntity)
+	}
+
+	borrow := map[string]any{"patron_id": patronID, "barcode": "9780306406157", "occurred_at": time.Now().Add(-2 * time.Hour)}
+	if rec := a.Do(http.MethodPost, "/kiosk/borrow", key, borrow); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("borrow without idempotency key status = %v; want %v", rec.Code, http.StatusUnprocessableEntity)
+	}
+
+	const borrowID = "7c4a1a2e-8f0b-4b8e-9d51-3f2f6c1e0a01"
+	var loans [2]api.KioskLoan
+	for i := range loans {
+		rec = a.Do(http.MethodPost, "/kiosk/borrow", key, "Idempotency-Key: "+borrowID, borrow)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("borrow %d status = %v; want %v (body: %s)", i, rec.Code, http.StatusOK, rec.Body.String())
+		}
+		a.Decode(rec, &loans[i])
+	}
+	if got := rec.Header().Get("Idempotent-Replayed"); got != "true" {
+		t.Errorf("replayed borrow Idempotent-Replayed = %q; want %q", got, "true")
+	}
+	if loans[0].TransactionID != loans[1].TransactionID {
+		t.Errorf("replayed borrow transaction = %v; want %v", loans[1].TransactionID, loans[0].TransactionID)
+	}
+
+	stored, err := a.Models.Books.Get(context.Background(), data.BookFilter{ID: apitest.Ptr(data.BookID(bookID))})
+	if err != nil {
+		t.Fatalf("Books.Get() error = %v", err)
+	}
+	if stored.BorrowedCopies != 1 {
+		t.Errorf("BorrowedCopies after replayed borrow = %v; want %v", stored.BorrowedCopies, 1)
+	}
+
+	transaction, err := a.Models.Transactions.Get(context.Background(), data.TransactionFilter{ID: apitest.Ptr(data.TransactionID(loans[0].TransactionID))})
+	if err != nil {
+		t.Fatalf("Transactions.Get() error = %v", err)
+	}
+	if transaction.Branch != "north" {
+		t.Errorf("Branch = %q; want %q", transaction.Branch, "north")
+	}
+
+	if rec := a.Do(http.MethodPost, "/kiosk/return", key, "Idempotency-Key: "+borrowID, borrow); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("return with the borrow idempotency key status = %v; want %v", rec.Code, http.StatusUnprocessableEntity)
+	}
+
+	// The book was returned an hour ago, while the kiosk was offline.
+	occurredAt := time.Now().Add(-time.Hour).Truncate(time.Second)
+	giveBack := map[string]any{"patron_id": patronID, "barcode": "9780306406157", "occurred_at": occurredAt}
+	rec = a.Do(http.MethodPost, "/kiosk/return", key, "Idempotency-Key: 0f9e4a55-2c7d-4a47-b1a9-6d3c2e8b7f10", giveBack)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("return status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var returned api.KioskLoan
+	a.Decode(rec, &returned)
+	if returned.Status != data.TransactionStatusReturned || !returned.ReturnedAt.Equal(occurredAt) {
+		t.Errorf("return = %+v; want returned at %v", returned, occurredAt)
+	}
+
+	old := map[string]any{"patron_id": patronID, "barcode": "9780306406157", "occurred_at": time.Now().Add(-30 * 24 * time.Hour)}
+	if rec := a.Do(http.MethodPost, "/kiosk/borrow", key, "Idempotency-Key: 5b1d7e3a-9c2f-4e6b-8a0d-1f4c7b9e2d33", old); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("borrow queued a month ago status = %v; want %v", rec.Code, http.StatusUnprocessableEntity)
+	}
+
+	rec = a.Do(http.MethodPost, "/kiosks", admin, map[string]any{"name": "Returns", "branch": "south", "permissions": []string{auth.ReturnBookPermission}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("create returns kiosk status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var returnsKiosk data.Kiosk
+	a.Decode(rec, &returnsKiosk)
+	if rec := a.Do(http.MethodPost, "/kiosk/borrow", "Authorization: Bearer "+returnsKiosk.Key, "Idempotency-Key: 9a8b7c6d-5e4f-4a3b-2c1d-0e9f8a7b6c5d", borrow); rec.Code != http.StatusForbidden {
+		t.Errorf("borrow at a returns kiosk status = %v; want %v", rec.Code, http.StatusForbidden)
+	}
+
+	if rec := a.Do(http.MethodDelete, "/kiosks/"+kiosk.ID, admin); rec.Code != http.StatusOK {
+		t.Fatalf("delete kiosk status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if rec := a.Do(http.MethodGet, "/kiosk/books/9780306406157", key); rec.Code != http.StatusUnauthorized {
+		t.Errorf("lookup with deleted kiosk status = %v; want %v", rec.Code, http.StatusUnauthorized)
+	}
+}
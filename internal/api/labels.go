@@ -0,0 +1,152 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/mzeevi/library/internal/data"
+	"github.com/mzeevi/library/internal/labels"
+	"mime"
+	"time"
+)
+
+type CreateLabelsInput struct {
+	Body struct {
+		Layout string           `json:"layout,omitempty" enum:"avery-5160,avery-l7160,avery-l7651" doc:"Avery layout of the sheets, by default the one set with --label-layout"`
+		Skip   int              `json:"skip,omitempty" minimum:"0" doc:"Number of labels which were already used on the first sheet"`
+		Books  []LabelBookInput `json:"books" minItems:"1" maxItems:"100" doc:"Books whose copies are labeled, in the order of the labels"`
+	}
+}
+
+// LabelBookInput selects copies of a book to label.
+type LabelBookInput struct {
+	BookID string `json:"book_id"`
+	Copies []int  `json:"copies,omitempty" uniqueItems:"true" doc:"Numbers of the copies to label, by default all the copies of the book"`
+}
+
+type CreateLabelsOutput struct {
+	ContentType        string `header:"Content-Type"`
+	ContentDisposition string `header:"Content-Disposition"`
+	Body               []byte
+}
+
+// Resolve validates the input in CreateLabelsInput.
+func (l *CreateLabelsInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	for i := range l.Body.Books {
+		book := &l.Body.Books[i]
+
+		err := validateID(&book.BookID, fmt.Sprintf("body.books[%d].book_id", i))
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		for j, copyNumber := range book.Copies {
+			if copyNumber < 1 {
+				errs = append(errs, &huma.ErrorDetail{
+					Location: fmt.Sprintf("body.books[%d].copies[%d]", i, j),
+					Message:  "Copy must be at least 1",
+					Value:    copyNumber,
+				})
+			}
+		}
+	}
+
+	return errs
+}
+
+// bookLabels returns the labels of copies of a book, with the call numbers of their holdings.
+// All the copies of the book are labeled if no copies are given.
+func bookLabels(book *data.Book, copies []int) []labels.Label {
+	if len(copies) == 0 {
+		for copyNumber := 1; copyNumber <= book.Copies; copyNumber++ {
+			copies = append(copies, copyNumber)
+		}
+	}
+
+	values := make([]labels.Label, 0, len(copies))
+	for _, copyNumber := range copies {
+		label := labels.Label{Title: book.Title, ISBN: book.ISBN(), Copy: copyNumber}
+		for _, holding := range book.Holdings {
+			if holding.Copy == copyNumber {
+				label.CallNumber = holding.CallNumber
+			}
+		}
+		values = append(values, label)
+	}
+
+	return values
+}
+
+// createLabelsHandler handles a request to print the spine and barcode labels of copies of books.
+func (app *Application) createLabelsHandler(ctx context.Context, input *CreateLabelsInput) (*CreateLabelsOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	sheet := &labels.Sheet{
+		Layout:    input.Body.Layout,
+		Skip:      input.Body.Skip,
+		CreatedAt: time.Now().In(app.location),
+	}
+	if sheet.Layout == "" {
+		sheet.Layout = app.labelLayout
+	}
+
+	var errs []error
+	if perSheet := labels.Layouts[sheet.Layout].PerSheet(); sheet.Skip >= perSheet {
+		errs = append(errs, &huma.ErrorDetail{
+			Location: "body.skip",
+			Message:  fmt.Sprintf("Skip must be less than the %d labels on a sheet", perSheet),
+			Value:    sheet.Skip,
+		})
+	}
+
+	for i, item := range input.Body.Books {
+		book, err := app.Models.Books.Get(ctx, data.BookFilter{ID: ptr(data.BookID(item.BookID))})
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrDocumentNotFound):
+				errs = append(errs, &huma.ErrorDetail{
+					Location: fmt.Sprintf("body.books[%d].book_id", i),
+					Message:  "Book does not exist",
+					Value:    item.BookID,
+				})
+				continue
+			default:
+				return &CreateLabelsOutput{}, app.serverError(ctx, err)
+			}
+		}
+
+		for j, copyNumber := range item.Copies {
+			if copyNumber > book.Copies {
+				errs = append(errs, &huma.ErrorDetail{
+					Location: fmt.Sprintf("body.books[%d].copies[%d]", i, j),
+					Message:  fmt.Sprintf("Copy must be at most the %d copies of the book", book.Copies),
+					Value:    copyNumber,
+				})
+			}
+		}
+
+		sheet.Labels = append(sheet.Labels, bookLabels(book, item.Copies)...)
+	}
+
+	if len(errs) > 0 {
+		return &CreateLabelsOutput{}, huma.Error422UnprocessableEntity("validation failed", errs...)
+	}
+
+	var b bytes.Buffer
+	if err := sheet.Write(&b); err != nil {
+		return &CreateLabelsOutput{}, app.serverError(ctx, err)
+	}
+
+	resp := &CreateLabelsOutput{
+		ContentType:        labels.ContentType,
+		ContentDisposition: mime.FormatMediaType("inline", map[string]string{"filename": fmt.Sprintf("labels-%s.pdf", sheet.CreatedAt.Format("20060102-150405"))}),
+		Body:               b.Bytes(),
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,51 @@
+package api_test
+
+import (
+	"bytes"
+	"github.com/mzeevi/library/internal/api/apitest"
+	"github.com/mzeevi/library/internal/auth"
+	"net/http"
+	"testing"
+)
+
+func TestCreateLabels(t *testing.T) {
+	a := apitest.New(t)
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+	patronID := a.SeedPatron(apitest.Patron("reader@example.com", auth.ReadBooksPermission))
+
+	bookID := a.SeedBook(apitest.Book("9780306406157", 3))
+	if rec := a.Do(http.MethodPut, "/books/"+bookID, admin, map[string]any{"holdings": []map[string]any{{"copy": 1, "call_number": "823.914 ROW"}}}); rec.Code != http.StatusOK {
+		t.Fatalf("update holdings status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	tests := []struct {
+		name string
+		body map[string]any
+		want int
+	}{
+		{name: "all copies", body: map[string]any{"books": []map[string]any{{"book_id": bookID}}}, want: http.StatusOK},
+		{name: "selected copies", body: map[string]any{"layout": "avery-5160", "skip": 29, "books": []map[string]any{{"book_id": bookID, "copies": []int{1, 3}}}}, want: http.StatusOK},
+		{name: "copy beyond the copies", body: map[string]any{"books": []map[string]any{{"book_id": bookID, "copies": []int{4}}}}, want: http.StatusUnprocessableEntity},
+		{name: "missing book", body: map[string]any{"books": []map[string]any{{"book_id": "000000000000000000000000"}}}, want: http.StatusUnprocessableEntity},
+		{name: "skip a full sheet", body: map[string]any{"skip": 21, "books": []map[string]any{{"book_id": bookID}}}, want: http.StatusUnprocessableEntity},
+		{name: "unknown layout", body: map[string]any{"layout": "avery-0000", "books": []map[string]any{{"book_id": bookID}}}, want: http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := a.Do(http.MethodPost, "/labels", admin, tt.body)
+			if rec.Code != tt.want {
+				t.Fatalf("POST /labels status = %v; want %v (body: %s)", rec.Code, tt.want, rec.Body.String())
+			}
+
+			if tt.want == http.StatusOK && (rec.Header().Get("Content-Type") != "application/pdf" || !bytes.HasPrefix(rec.Body.Bytes(), []byte("%PDF-"))) {
+				t.Errorf("POST /labels = %s %q...; want a PDF document", rec.Header().Get("Content-Type"), rec.Body.Bytes()[:min(rec.Body.Len(), 16)])
+			}
+		})
+	}
+
+	if rec := a.Do(http.MethodPost, "/labels", a.PatronAuth(patronID), tests[0].body); rec.Code != http.StatusForbidden {
+		t.Errorf("POST /labels by a patron status = %v; want %v", rec.Code, http.StatusForbidden)
+	}
+}
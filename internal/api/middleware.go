@@ -3,9 +3,13 @@ package api
 import (
 	"encoding/base64"
 	"errors"
+	"fmt"
 	"github.com/danielgtaylor/huma/v2"
+	"github.com/go-chi/httprate"
 	"github.com/mzeevi/library/internal/data"
+	"github.com/mzeevi/library/internal/timezone"
 	"github.com/pascaldekloe/jwt"
+	"log/slog"
 	"net/http"
 	"slices"
 	"strings"
@@ -17,6 +21,7 @@ const (
 	errInternalServerErrorMsg    = "the server encountered a problem and could not process your request"
 	errAuthenticationRequiredMsg = "you must be authenticated to access this resource"
 	errInActiveAccountMsg        = "your user account must be activated to access this resource"
+	errSuspendedAccountMsg       = "your user account is suspended"
 	errNotPermittedMsg           = "your account doesn't have the necessary permissions to access this resource"
 )
 
@@ -49,7 +54,7 @@ func (app *Application) authenticate(api huma.API) func(ctx huma.Context, next f
 		case "Bearer":
 			token := authParts[1]
 
-			claims, err := jwt.HMACCheck([]byte(token), []byte(app.Config.JTW.Secret))
+			claims, err := app.checkJWT(token)
 			if err != nil || !claims.Valid(time.Now()) || claims.Issuer != app.Config.JTW.Issuer || !claims.AcceptAudience(app.Config.JTW.Audience) {
 				ctx.SetHeader(headerWWWAuthenticateKey, bearerKey)
 				_ = huma.WriteErr(api, ctx, http.StatusUnauthorized, errInvalidTokenMsg)
@@ -74,17 +79,29 @@ func (app *Application) authenticate(api huma.API) func(ctx huma.Context, next f
 				return
 			}
 
-			patron, err := app.Models.Patrons.Get(ctx.Context(), data.PatronFilter{ID: &claims.Subject})
+			patron, err := app.Models.Patrons.Get(ctx.Context(), data.PatronFilter{ID: ptr(data.PatronID(claims.Subject))})
 			if err != nil {
 				switch {
 				case errors.Is(err, data.ErrDocumentNotFound):
 					ctx.SetHeader(headerWWWAuthenticateKey, bearerKey)
 					_ = huma.WriteErr(api, ctx, http.StatusUnauthorized, errInvalidTokenMsg)
 				default:
+					app.requestLogger(ctx.Context()).Error(errInternalServerErrorMsg, slog.Any("error", err))
+					app.reportError(ctx.Context(), err)
 					_ = huma.WriteErr(api, ctx, http.StatusInternalServerError, errInternalServerErrorMsg)
 				}
+				return
 			}
 
+			// Tokens issued before the password of the patron changed were revoked by the change, and
+			// the tokens of a suspended patron are revoked until they are provisioned again.
+			if patron.Suspended || patron.PasswordChangedAt != nil && claims.Issued.Time().Before(*patron.PasswordChangedAt) {
+				ctx.SetHeader(headerWWWAuthenticateKey, bearerKey)
+				_ = huma.WriteErr(api, ctx, http.StatusUnauthorized, errInvalidTokenMsg)
+				return
+			}
+
+			app.setReportingUser(ctx.Context(), patron.ID, patronContextKey.String())
 			ctx = app.contextSetPatron(ctx, patron)
 		case "Basic":
 			credentials, err := base64.StdEncoding.DecodeString(authParts[1])
@@ -112,6 +129,8 @@ func (app *Application) authenticate(api huma.API) func(ctx huma.Context, next f
 					_ = huma.WriteErr(api, ctx, http.StatusUnauthorized, errInvalidTokenMsg)
 					return
 				default:
+					app.requestLogger(ctx.Context()).Error(errInternalServerErrorMsg, slog.Any("error", err))
+					app.reportError(ctx.Context(), err)
 					ctx.SetHeader(headerWWWAuthenticateKey, `Basic realm="Restricted"`)
 					_ = huma.WriteErr(api, ctx, http.StatusInternalServerError, errInternalServerErrorMsg)
 					return
@@ -120,8 +139,11 @@ func (app *Application) authenticate(api huma.API) func(ctx huma.Context, next f
 
 			matches, err := admin.Password.Matches(password)
 			if err != nil {
+				app.requestLogger(ctx.Context()).Error(errInternalServerErrorMsg, slog.Any("error", err))
+				app.reportError(ctx.Context(), err)
 				ctx.SetHeader(headerWWWAuthenticateKey, `Basic realm="Restricted"`)
 				_ = huma.WriteErr(api, ctx, http.StatusInternalServerError, errInternalServerErrorMsg)
+				return
 			}
 
 			if !matches {
@@ -130,6 +152,9 @@ func (app *Application) authenticate(api huma.API) func(ctx huma.Context, next f
 				return
 			}
 
+			app.rehashAdminPassword(ctx.Context(), admin, password)
+
+			app.setReportingUser(ctx.Context(), admin.ID, adminContextKey.String())
 			ctx = app.contextSetAdmin(ctx, admin)
 		default:
 			ctx.SetHeader(headerWWWAuthenticateKey, `Basic realm="Restricted"`)
@@ -141,6 +166,84 @@ func (app *Application) authenticate(api huma.API) func(ctx huma.Context, next f
 	}
 }
 
+// authenticateOptional authenticates requests which have an Authorization header like authenticate,
+// and lets requests without one through anonymously, without a patron or an admin in their context.
+func (app *Application) authenticateOptional(api huma.API) func(ctx huma.Context, next func(huma.Context)) {
+	authenticate := app.authenticate(api)
+
+	return func(ctx huma.Context, next func(huma.Context)) {
+		if ctx.Header(headerAuthorizationKey) == "" {
+			ctx.SetHeader("Vary", headerAuthorizationKey)
+			next(ctx)
+			return
+		}
+
+		authenticate(ctx, next)
+	}
+}
+
+// checkJWT verifies the signature of a JWT using the current JWT secret,
+// falling back to the previous secret so that tokens survive a secret rotation.
+func (app *Application) checkJWT(token string) (*jwt.Claims, error) {
+	var err error
+	var claims *jwt.Claims
+
+	for _, secret := range app.jwtSecret.Values() {
+		claims, err = jwt.HMACCheck([]byte(token), []byte(secret))
+		if err == nil {
+			return claims, nil
+		}
+	}
+
+	return nil, err
+}
+
+// authenticateKiosk authenticates a self-checkout kiosk by the API key in the Authorization header.
+// Kiosk keys are only accepted by the kiosk endpoints, and patron and admin credentials are not.
+func (app *Application) authenticateKiosk(api huma.API) func(ctx huma.Context, next func(huma.Context)) {
+	return func(ctx huma.Context, next func(huma.Context)) {
+		ctx.SetHeader("Vary", headerAuthorizationKey)
+
+		key, found := strings.CutPrefix(ctx.Header(headerAuthorizationKey), bearerKey+" ")
+		if !found || key == "" {
+			ctx.SetHeader(headerWWWAuthenticateKey, bearerKey)
+			_ = huma.WriteErr(api, ctx, http.StatusUnauthorized, errInvalidTokenMsg)
+			return
+		}
+
+		kiosk, err := app.Models.Kiosks.Get(ctx.Context(), data.KioskFilter{Hash: data.HashKioskKey(key)})
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrDocumentNotFound):
+				ctx.SetHeader(headerWWWAuthenticateKey, bearerKey)
+				_ = huma.WriteErr(api, ctx, http.StatusUnauthorized, errInvalidTokenMsg)
+			default:
+				app.requestLogger(ctx.Context()).Error(errInternalServerErrorMsg, slog.Any("error", err))
+				app.reportError(ctx.Context(), err)
+				_ = huma.WriteErr(api, ctx, http.StatusInternalServerError, errInternalServerErrorMsg)
+			}
+			return
+		}
+
+		app.setReportingUser(ctx.Context(), kiosk.ID, kioskContextKey.String())
+		ctx = app.contextSetKiosk(ctx, kiosk)
+
+		next(ctx)
+	}
+}
+
+// requireKioskPermission checks if the authenticated kiosk has the required permission.
+func (app *Application) requireKioskPermission(api huma.API, code string) func(ctx huma.Context, next func(huma.Context)) {
+	return func(ctx huma.Context, next func(huma.Context)) {
+		if kiosk, ok := app.contextGetKiosk(ctx); ok && slices.Contains(kiosk.Permissions, code) {
+			next(ctx)
+			return
+		}
+
+		_ = huma.WriteErr(api, ctx, http.StatusForbidden, errNotPermittedMsg)
+	}
+}
+
 // requireAuthenticatedPatron ensures the request is made by an authenticated patron.
 func (app *Application) requireAuthenticatedPatron(api huma.API, inFn func(ctx huma.Context, next func(huma.Context))) func(ctx huma.Context, next func(huma.Context)) {
 	return func(ctx huma.Context, next func(huma.Context)) {
@@ -198,9 +301,23 @@ func (app *Application) requirePermission(api huma.API, code string) func(ctx hu
 				next(ctx)
 				return
 			}
-		} else {
-			_ = huma.WriteErr(api, ctx, http.StatusForbidden, errNotPermittedMsg)
 		}
+
+		_ = huma.WriteErr(api, ctx, http.StatusForbidden, errNotPermittedMsg)
+	}
+
+	return app.requireActivatedPatron(api, fn)
+}
+
+// requireAdmin ensures the request is made by an authenticated admin.
+func (app *Application) requireAdmin(api huma.API) func(ctx huma.Context, next func(huma.Context)) {
+	fn := func(ctx huma.Context, next func(huma.Context)) {
+		if admin, ok := app.contextGetAdmin(ctx); ok && !admin.IsAnonymous() {
+			next(ctx)
+			return
+		}
+
+		_ = huma.WriteErr(api, ctx, http.StatusForbidden, errNotPermittedMsg)
 	}
 
 	return app.requireActivatedPatron(api, fn)
@@ -231,3 +348,31 @@ func (app *Application) requireMatchingID(api huma.API) func(ctx huma.Context, n
 		_ = huma.WriteErr(api, ctx, http.StatusForbidden, errNotPermittedMsg)
 	}
 }
+
+// setLocation adds the timezone of the library to the request context, so that input
+// resolvers interpret dates and day boundaries in it.
+func (app *Application) setLocation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(timezone.WithLocation(r.Context(), app.location)))
+	})
+}
+
+// limitCatalog limits the rate of the anonymous requests to the public catalog by IP more heavily
+// than the other requests, since it is open to everyone. It does not limit them if the limit is 0.
+func (app *Application) limitCatalog(next http.Handler) http.Handler {
+	if app.Config.Catalog.RateLimit <= 0 {
+		return next
+	}
+
+	prefix := fmt.Sprintf("%s/%s/", basePath, catalogKey)
+	limited := httprate.Limit(app.Config.Catalog.RateLimit, app.Config.Catalog.RateWindow, httprate.WithKeyFuncs(httprate.KeyByIP))(next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			limited.ServeHTTP(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,71 @@
+package api_test
+
+import (
+	"github.com/mzeevi/library/internal/api/apitest"
+	"github.com/mzeevi/library/internal/auth"
+	"github.com/mzeevi/library/internal/data"
+	"net/http"
+	"testing"
+)
+
+func TestAuthenticate(t *testing.T) {
+	a := apitest.New(t)
+	a.SeedAdmin("admin", "admin-password")
+
+	reader := a.SeedPatron(apitest.Patron("reader@example.com", auth.ReadBooksPermission))
+	noPermissions := a.SeedPatron(apitest.Patron("none@example.com"))
+
+	inactive := apitest.Patron("inactive@example.com", auth.ReadBooksPermission)
+	inactive.Activated = false
+	a.SeedPatron(inactive)
+
+	tests := []struct {
+		name   string
+		header []any
+		want   int
+	}{
+		{name: "missing header", want: http.StatusUnauthorized},
+		{name: "malformed header", header: []any{"Authorization: Bearer"}, want: http.StatusUnauthorized},
+		{name: "unknown scheme", header: []any{"Authorization: Digest abc"}, want: http.StatusUnauthorized},
+		{name: "invalid jwt", header: []any{"Authorization: Bearer not-a-jwt"}, want: http.StatusUnauthorized},
+		{name: "unknown patron", header: []any{a.PatronAuth("000000000000000000000000")}, want: http.StatusUnauthorized},
+		{name: "wrong admin password", header: []any{apitest.AdminAuth("admin", "wrong")}, want: http.StatusUnauthorized},
+		{name: "unknown admin", header: []any{apitest.AdminAuth("nobody", "admin-password")}, want: http.StatusUnauthorized},
+		{name: "inactive patron", header: []any{a.PatronAuth(inactive.ID)}, want: http.StatusForbidden},
+		{name: "missing permission", header: []any{a.PatronAuth(noPermissions)}, want: http.StatusForbidden},
+		{name: "patron with permission", header: []any{a.PatronAuth(reader)}, want: http.StatusOK},
+		{name: "admin", header: []any{apitest.AdminAuth("admin", "admin-password")}, want: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := a.Do(http.MethodGet, "/books", tt.header...)
+			if rec.Code != tt.want {
+				t.Errorf("GET /books status = %v; want %v (body: %s)", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestRequireAdmin(t *testing.T) {
+	a := apitest.New(t)
+	a.SeedAdmin("admin", "admin-password")
+	patron := a.SeedPatron(apitest.Patron("patron@example.com", auth.AdminPermissions...))
+
+	if rec := a.Do(http.MethodGet, "/categories", a.PatronAuth(patron)); rec.Code != http.StatusForbidden {
+		t.Errorf("GET /categories as patron status = %v; want %v", rec.Code, http.StatusForbidden)
+	}
+
+	rec := a.Do(http.MethodGet, "/categories", apitest.AdminAuth("admin", "admin-password"))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /categories as admin status = %v; want %v", rec.Code, http.StatusOK)
+	}
+
+	var body struct {
+		Categories []data.Category `json:"categories"`
+	}
+	a.Decode(rec, &body)
+	if len(body.Categories) != 2 {
+		t.Errorf("GET /categories len = %v; want the 2 default categories", len(body.Categories))
+	}
+}
@@ -0,0 +1,236 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/mzeevi/library/internal/data"
+	"github.com/mzeevi/library/internal/notifier"
+	"log/slog"
+	"time"
+)
+
+const (
+	errNotificationSentMsg = "the notification was already sent"
+)
+
+type GetNotificationsInput struct {
+	PaginationInput
+	Status   string `query:"status" enum:"pending,sent,failed" doc:"Filter by delivery status"`
+	Channel  string `query:"channel" enum:"email,sms" doc:"Filter by channel"`
+	PatronID string `query:"patron_id" doc:"Filter by Patron"`
+	Sort     string `query:"sort" enum:"created_at,-created_at" default:"-created_at"`
+}
+
+type GetNotificationsOutput struct {
+	Body NotificationsInfo
+}
+
+type NotificationsInfo struct {
+	Notifications []data.Notification `json:"notifications"`
+	Metadata      data.Metadata       `json:"metadata"`
+}
+
+type ResendNotificationInput struct {
+	ID string `json:"id" path:"id"`
+}
+
+type ResendNotificationOutput struct {
+	Body data.Notification `json:"notification"`
+}
+
+type ResendFailedNotificationsInput struct{}
+
+type ResendFailedNotificationsOutput struct {
+	Body ResentNotificationsInfo
+}
+
+type ResentNotificationsInfo struct {
+	Sent   int `json:"sent" doc:"Number of failed notifications which were delivered"`
+	Failed int `json:"failed" doc:"Number of failed notifications which failed again"`
+}
+
+// Resolve validates the input in GetNotificationsInput.
+func (n *GetNotificationsInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	if n.PatronID != "" {
+		err := validateID(&n.PatronID, "query.patron_id")
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs
+}
+
+// Resolve validates the input in ResendNotificationInput.
+func (n *ResendNotificationInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	err := validateID(&n.ID, "path.id")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// notifyPatron notifies a patron with a template over the channel they prefer.
+func (app *Application) notifyPatron(ctx context.Context, patron *data.Patron, template string, templateData any) (*data.Notification, error) {
+	return app.sendNotification(ctx, patron.NotificationChannel, patron, template, templateData)
+}
+
+// sendNotification renders a template for a patron on a channel, stores it in the notifications
+// outbox and delivers it. A notification which fails to be delivered is stored with a failed status,
+// so that it can be resent, and only errors rendering or storing it are returned.
+func (app *Application) sendNotification(ctx context.Context, channel string, patron *data.Patron, template string, templateData any) (*data.Notification, error) {
+	recipient := notifier.Recipient{
+		Email:  patron.Email,
+		Phone:  patron.Phone,
+		Locale: patron.Locale,
+	}
+
+	msg, err := app.notifier.Render(channel, recipient, template, templateData)
+	if err != nil {
+		return nil, err
+	}
+
+	notification := data.NewNotification("", patron.ID, msg.Channel, msg.To, template)
+	notification.Subject = msg.Subject
+	notification.Body = msg.Body
+	notification.HTMLBody = msg.HTMLBody
+
+	id, err := app.Models.Notifications.Insert(ctx, notification)
+	if err != nil {
+		return nil, err
+	}
+	notification.ID = id
+
+	return notification, app.deliverNotification(ctx, notification)
+}
+
+// deliverNotification delivers a stored notification and records the attempt in it. Delivery
+// errors are logged and recorded, and only errors recording the attempt are returned.
+func (app *Application) deliverNotification(ctx context.Context, notification *data.Notification) error {
+	msg := &notifier.Message{
+		Channel:  notification.Channel,
+		To:       notification.Recipient,
+		Subject:  notification.Subject,
+		Body:     notification.Body,
+		HTMLBody: notification.HTMLBody,
+	}
+
+	notification.Attempts++
+	if err := app.notifier.Deliver(ctx, msg); err != nil {
+		app.requestLogger(ctx).Warn("failed to deliver notification", slog.String("id", notification.ID), slog.Any("error", err))
+
+		notification.Status = data.NotificationStatusFailed
+		notification.LastError = err.Error()
+	} else {
+		notification.Status = data.NotificationStatusSent
+		notification.LastError = ""
+		notification.SentAt = time.Now()
+	}
+
+	return app.Models.Notifications.Update(ctx, data.NotificationFilter{ID: &notification.ID}, notification)
+}
+
+// getNotificationsHandler handles a request to list notifications with their delivery status.
+func (app *Application) getNotificationsHandler(ctx context.Context, input *GetNotificationsInput) (*GetNotificationsOutput, error) {
+	paginator := data.Paginator{Page: input.Page, PageSize: input.PageSize}
+	sorter := data.Sorter{Field: input.Sort, SortSafelist: supportedNotificationsSortFields, Collation: app.collation}
+
+	filter := data.NotificationFilter{}
+	if input.Status != "" {
+		filter.Status = &input.Status
+	}
+	if input.Channel != "" {
+		filter.Channel = &input.Channel
+	}
+	if input.PatronID != "" {
+		filter.PatronID = &input.PatronID
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	notifications, metadata, err := app.Models.Notifications.GetAll(ctx, filter, paginator, sorter)
+	if err != nil {
+		return &GetNotificationsOutput{}, app.serverError(ctx, err)
+	}
+
+	resp := &GetNotificationsOutput{
+		Body: NotificationsInfo{
+			Notifications: notifications,
+			Metadata:      metadata,
+		},
+	}
+
+	return resp, nil
+}
+
+// resendNotificationHandler handles a request to deliver a notification which was not sent again.
+// The notification is returned with the status of the new attempt.
+func (app *Application) resendNotificationHandler(ctx context.Context, input *ResendNotificationInput) (*ResendNotificationOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	notification, err := app.Models.Notifications.Get(ctx, data.NotificationFilter{ID: &input.ID})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return &ResendNotificationOutput{}, huma.Error404NotFound(errNotFoundMsg)
+		default:
+			return &ResendNotificationOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	if notification.Status == data.NotificationStatusSent {
+		return &ResendNotificationOutput{}, huma.Error422UnprocessableEntity(errNotificationSentMsg)
+	}
+
+	if err = app.deliverNotification(ctx, notification); err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			return &ResendNotificationOutput{}, huma.Error409Conflict(errConflictMsg)
+		default:
+			return &ResendNotificationOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	return &ResendNotificationOutput{Body: *notification}, nil
+}
+
+// resendFailedNotificationsHandler handles a request to deliver all failed notifications again.
+func (app *Application) resendFailedNotificationsHandler(ctx context.Context, _ *ResendFailedNotificationsInput) (*ResendFailedNotificationsOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	notifications, _, err := app.Models.Notifications.GetAll(ctx, data.NotificationFilter{Status: ptr(data.NotificationStatusFailed)}, data.Paginator{}, data.Sorter{})
+	if err != nil {
+		return &ResendFailedNotificationsOutput{}, app.serverError(ctx, err)
+	}
+
+	resp := &ResendFailedNotificationsOutput{}
+	for i := range notifications {
+		notification := &notifications[i]
+
+		err = app.deliverNotification(ctx, notification)
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			// The notification was resent concurrently.
+			continue
+		case err != nil:
+			return &ResendFailedNotificationsOutput{}, app.serverError(ctx, err)
+		}
+
+		if notification.Status == data.NotificationStatusSent {
+			resp.Body.Sent++
+		} else {
+			resp.Body.Failed++
+		}
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,94 @@
+package api_test
+
+import (
+	"context"
+	"github.com/mzeevi/library/internal/api"
+	"github.com/mzeevi/library/internal/api/apitest"
+	"github.com/mzeevi/library/internal/auth"
+	"github.com/mzeevi/library/internal/data"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNotificationOutbox(t *testing.T) {
+	var down atomic.Bool
+	down.Store(true)
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			http.Error(w, "gateway unavailable", http.StatusServiceUnavailable)
+		}
+	}))
+	defer gateway.Close()
+
+	a := apitest.New(t, func(app *api.Application) {
+		app.Config.SMS.Provider = "webhook"
+		app.Config.SMS.WebhookURL = gateway.URL
+	})
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+
+	bookID := a.SeedBook(apitest.Book("9780306406157", 1))
+	patron := apitest.Patron("patron@example.com", auth.ReadPatronPermission)
+	patron.Phone = "+972501234567"
+	patron.NotificationChannel = "sms"
+	patronID := a.SeedPatron(patron)
+
+	now := time.Now()
+	transactionID, err := a.Models.Transactions.Insert(context.Background(),
+		data.NewTransaction("", patronID, bookID, data.TransactionStatusBorrowed, now.Add(-24*time.Hour), now.Add(2*24*time.Hour)))
+	if err != nil {
+		t.Fatalf("failed to seed transaction: %v", err)
+	}
+
+	var notification data.Notification
+	rec := a.Do(http.MethodPost, "/transactions/"+transactionID+"/remind", admin)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("remind status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	a.Decode(rec, &notification)
+	if notification.Status != data.NotificationStatusFailed || notification.Attempts != 1 || !strings.Contains(notification.LastError, "gateway unavailable") {
+		t.Errorf("remind with the gateway down = %+v; want a failed attempt", notification)
+	}
+
+	var list struct {
+		Notifications []data.Notification `json:"notifications"`
+	}
+	a.Decode(a.Do(http.MethodGet, "/notifications?status=failed", admin), &list)
+	if len(list.Notifications) != 1 || list.Notifications[0].ID != notification.ID || list.Notifications[0].Recipient != patron.Phone {
+		t.Errorf("GET /notifications?status=failed = %+v; want the reminder", list.Notifications)
+	}
+
+	resendPath := "/notifications/" + notification.ID + "/resend"
+	a.Decode(a.Do(http.MethodPost, resendPath, admin), &notification)
+	if notification.Status != data.NotificationStatusFailed || notification.Attempts != 2 {
+		t.Errorf("POST %s with the gateway down = %+v; want a second failed attempt", resendPath, notification)
+	}
+
+	down.Store(false)
+
+	var resent struct {
+		Sent   int `json:"sent"`
+		Failed int `json:"failed"`
+	}
+	a.Decode(a.Do(http.MethodPost, "/notifications/resend", admin), &resent)
+	if resent.Sent != 1 || resent.Failed != 0 {
+		t.Errorf("POST /notifications/resend = %+v; want one sent", resent)
+	}
+
+	if rec = a.Do(http.MethodPost, resendPath, admin); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("POST %s of a sent notification status = %v; want %v", resendPath, rec.Code, http.StatusUnprocessableEntity)
+	}
+
+	a.Decode(a.Do(http.MethodGet, "/notifications?status=sent&patron_id="+patronID, admin), &list)
+	if len(list.Notifications) != 1 || list.Notifications[0].Attempts != 3 || list.Notifications[0].SentAt.IsZero() {
+		t.Errorf("GET /notifications?status=sent = %+v; want the reminder sent on the third attempt", list.Notifications)
+	}
+
+	if rec = a.Do(http.MethodGet, "/notifications", a.PatronAuth(patronID)); rec.Code != http.StatusForbidden {
+		t.Errorf("GET /notifications as a patron status = %v; want %v", rec.Code, http.StatusForbidden)
+	}
+}
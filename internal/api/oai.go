@@ -0,0 +1,359 @@
+package api
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/mzeevi/library/internal/data"
+	"github.com/mzeevi/library/internal/oai"
+	"net/mail"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// oaiListSize is the number of headers or records of a response to a list request, which is
+	// resumed with a resumption token.
+	oaiListSize = 100
+	// oaiSortField is the field by which books are harvested, from the least recently updated.
+	oaiSortField = "updated_at"
+)
+
+// oaiArguments are the arguments of the verbs of OAI-PMH, other than verb.
+var oaiArguments = map[string][]string{
+	oai.VerbIdentify:            {},
+	oai.VerbListMetadataFormats: {"identifier"},
+	oai.VerbListSets:            {"resumptionToken"},
+	oai.VerbListIdentifiers:     {"metadataPrefix", "from", "until", "set", "resumptionToken"},
+	oai.VerbListRecords:         {"metadataPrefix", "from", "until", "set", "resumptionToken"},
+	oai.VerbGetRecord:           {"identifier", "metadataPrefix"},
+}
+
+type OAIInput struct {
+	Verb            string `query:"verb" doc:"Verb of OAI-PMH: Identify, ListMetadataFormats, ListSets, ListIdentifiers, ListRecords or GetRecord"`
+	Identifier      string `query:"identifier" doc:"Identifier of a record, such as oai:library.example.org:5f1b2c3d4e5f6a7b8c9d0e1f"`
+	MetadataPrefix  string `query:"metadataPrefix" doc:"Metadata format of the records, which is oai_dc for Dublin Core"`
+	From            string `query:"from" doc:"Harvest the records updated from this datestamp, such as 2024-01-31 or 2024-01-31T08:00:00Z"`
+	Until           string `query:"until" doc:"Harvest the records updated until this datestamp, inclusive"`
+	Set             string `query:"set" doc:"Set of the records, which are not supported"`
+	ResumptionToken string `query:"resumptionToken" doc:"Resumption token of an incomplete list of a previous response"`
+	host            string
+	arguments       url.Values
+}
+
+// Resolve keeps the host and the arguments of the request, since OAI-PMH rejects requests with
+// arguments which their verb does not take, or with repeated arguments.
+func (o *OAIInput) Resolve(ctx huma.Context) []error {
+	o.host = ctx.Host()
+	u := ctx.URL()
+	o.arguments = u.Query()
+
+	return nil
+}
+
+type OAIOutput struct {
+	ContentType string `header:"Content-Type"`
+	Body        []byte
+}
+
+// oaiBaseURL returns the base URL of OAI-PMH requests, which is configured, or else is of the host
+// of the request.
+func (app *Application) oaiBaseURL(host string) string {
+	if app.Config.OAI.BaseURL != "" {
+		return app.Config.OAI.BaseURL
+	}
+
+	return fmt.Sprintf("http://%s%s/%s", host, basePath, oaiKey)
+}
+
+// oaiRepositoryIdentifier returns the identifier of the repository at a base URL, which is its
+// host name, such as library.example.org.
+func oaiRepositoryIdentifier(baseURL string) string {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return ""
+	}
+
+	return u.Hostname()
+}
+
+// oaiAdminEmail returns the address of the administrator of the repository, which is configured,
+// or else is the sender of the emails of the library.
+func (app *Application) oaiAdminEmail() string {
+	if app.Config.OAI.AdminEmail != "" {
+		return app.Config.OAI.AdminEmail
+	}
+
+	address, err := mail.ParseAddress(app.Config.Mail.Sender)
+	if err != nil {
+		return app.Config.Mail.Sender
+	}
+
+	return address.Address
+}
+
+// oaiArgumentsError returns the error of the arguments of a request: a missing, unknown or repeated
+// verb, or an argument which the verb does not take or which is repeated.
+func oaiArgumentsError(arguments url.Values) *oai.Error {
+	verbs := arguments["verb"]
+	if len(verbs) != 1 {
+		return &oai.Error{Code: oai.ErrorBadVerb, Message: "The request must have exactly one verb"}
+	}
+
+	allowed, ok := oaiArguments[verbs[0]]
+	if !ok {
+		return &oai.Error{Code: oai.ErrorBadVerb, Message: fmt.Sprintf("The verb %s is not supported", verbs[0])}
+	}
+
+	for argument, values := range arguments {
+		switch {
+		case argument == "verb":
+		case !slices.Contains(allowed, argument):
+			return &oai.Error{Code: oai.ErrorBadArgument, Message: fmt.Sprintf("The argument %s is illegal for %s", argument, verbs[0])}
+		case len(values) > 1:
+			return &oai.Error{Code: oai.ErrorBadArgument, Message: fmt.Sprintf("The argument %s is repeated", argument)}
+		}
+	}
+
+	return nil
+}
+
+// oaiHarvest returns the state of the harvest of a list request, from its resumption token or from
+// its arguments. A harvest without an until datestamp is until the time of its first request, so
+// that the records which are updated while it is resumed are harvested by the next harvest.
+func oaiHarvest(input *OAIInput, now time.Time) (oai.Token, error) {
+	if input.ResumptionToken != "" {
+		if len(input.arguments) > 2 {
+			return oai.Token{}, &oai.Error{Code: oai.ErrorBadArgument, Message: "The argument resumptionToken is exclusive"}
+		}
+
+		return oai.DecodeToken(input.ResumptionToken)
+	}
+
+	switch {
+	case input.MetadataPrefix == "":
+		return oai.Token{}, &oai.Error{Code: oai.ErrorBadArgument, Message: "The argument metadataPrefix is required"}
+	case input.MetadataPrefix != oai.MetadataPrefixDC:
+		return oai.Token{}, &oai.Error{Code: oai.ErrorCannotDisseminateFormat, Message: fmt.Sprintf("The metadata format %s is not supported", input.MetadataPrefix)}
+	case input.Set != "":
+		return oai.Token{}, &oai.Error{Code: oai.ErrorNoSetHierarchy, Message: "The repository does not support sets"}
+	case input.From != "" && input.Until != "" && len(input.From) != len(input.Until):
+		return oai.Token{}, &oai.Error{Code: oai.ErrorBadArgument, Message: "The arguments from and until must have the same granularity"}
+	}
+
+	token := oai.Token{MetadataPrefix: input.MetadataPrefix, Until: now}
+
+	var err error
+	if input.From != "" {
+		if token.From, err = oai.ParseDatestamp(input.From, false); err != nil {
+			return oai.Token{}, &oai.Error{Code: oai.ErrorBadArgument, Message: fmt.Sprintf("The argument from %s is not a datestamp", input.From)}
+		}
+	}
+	if input.Until != "" {
+		if token.Until, err = oai.ParseDatestamp(input.Until, true); err != nil {
+			return oai.Token{}, &oai.Error{Code: oai.ErrorBadArgument, Message: fmt.Sprintf("The argument until %s is not a datestamp", input.Until)}
+		}
+	}
+	if input.Until != "" && token.Until.Before(token.From) {
+		return oai.Token{}, &oai.Error{Code: oai.ErrorBadArgument, Message: "The argument from is later than until"}
+	}
+
+	return token, nil
+}
+
+// harvestBooks returns the next list of books of a harvest, from the least recently updated, with
+// the resumption token of the rest of the list, which is nil if the list is complete. Books which
+// were updated at the same time as the last book of the previous list are skipped by their number,
+// since a list can end between them.
+func (app *Application) harvestBooks(ctx context.Context, token oai.Token) ([]data.Book, *oai.ResumptionToken, error) {
+	filter := data.BookFilter{MaxUpdatedAt: &token.Until}
+	if from := token.From; token.Last.After(from) {
+		filter.MinUpdatedAt = &token.Last
+	} else if !from.IsZero() {
+		filter.MinUpdatedAt = &from
+	}
+
+	paginator := data.Paginator{Page: 1, PageSize: token.SkipLast + oaiListSize + 1}
+	books, metadata, err := app.Models.Books.GetAll(ctx, filter, paginator, data.Sorter{Field: oaiSortField, SortSafelist: []string{oaiSortField}})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	books = books[min(token.SkipLast, int64(len(books))):]
+	more := len(books) > oaiListSize
+	books = books[:min(oaiListSize, len(books))]
+
+	resumed := token.Returned > 0
+	if !more && !resumed {
+		return books, nil, nil
+	}
+
+	resumption := &oai.ResumptionToken{
+		CompleteListSize: token.Returned + metadata.TotalRecords - token.SkipLast,
+		Cursor:           token.Returned,
+	}
+	if !more {
+		return books, resumption, nil
+	}
+
+	next := token
+	next.Returned += int64(len(books))
+	next.Last, next.SkipLast = books[len(books)-1].UpdatedAt, 0
+	for i := len(books) - 1; i >= 0 && books[i].UpdatedAt.Equal(next.Last); i-- {
+		next.SkipLast++
+	}
+	if next.SkipLast == int64(len(books)) && next.Last.Equal(token.Last) {
+		next.SkipLast += token.SkipLast
+	}
+	resumption.Token = next.Encode()
+
+	return books, resumption, nil
+}
+
+// oaiBook returns the book of the identifier of a record, such as
+// oai:library.example.org:5f1b2c3d4e5f6a7b8c9d0e1f.
+func (app *Application) oaiBook(ctx context.Context, repositoryIdentifier, identifier string) (*data.Book, error) {
+	hex, ok := strings.CutPrefix(identifier, fmt.Sprintf("oai:%s:", repositoryIdentifier))
+	id, err := data.ParseBookID(hex)
+	if !ok || err != nil {
+		return nil, &oai.Error{Code: oai.ErrorIDDoesNotExist, Message: fmt.Sprintf("The identifier %s does not exist", identifier)}
+	}
+
+	book, err := app.Models.Books.Get(ctx, data.BookFilter{ID: &id})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return nil, &oai.Error{Code: oai.ErrorIDDoesNotExist, Message: fmt.Sprintf("The identifier %s does not exist", identifier)}
+		default:
+			return nil, err
+		}
+	}
+
+	return book, nil
+}
+
+// oaiEarliestDatestamp returns when the least recently updated book was updated, or now if there
+// are no books.
+func (app *Application) oaiEarliestDatestamp(ctx context.Context, now time.Time) (time.Time, error) {
+	paginator := data.Paginator{Page: 1, PageSize: 1}
+	books, _, err := app.Models.Books.GetAll(ctx, data.BookFilter{}, paginator, data.Sorter{Field: oaiSortField, SortSafelist: []string{oaiSortField}})
+	if err != nil || len(books) == 0 {
+		return now, err
+	}
+
+	return books[0].UpdatedAt, nil
+}
+
+// oaiRespond sets the result of the verb of a request in a response.
+func (app *Application) oaiRespond(ctx context.Context, input *OAIInput, resp *oai.Response, now time.Time) error {
+	if err := oaiArgumentsError(input.arguments); err != nil {
+		return err
+	}
+
+	baseURL := resp.Request.BaseURL
+	repositoryIdentifier := oaiRepositoryIdentifier(baseURL)
+	header := func(book data.Book) oai.Header {
+		return oai.NewHeader(fmt.Sprintf("oai:%s:%s", repositoryIdentifier, book.ID), book.UpdatedAt)
+	}
+
+	switch input.Verb {
+	case oai.VerbIdentify:
+		earliest, err := app.oaiEarliestDatestamp(ctx, now)
+		if err != nil {
+			return err
+		}
+		resp.SetIdentify(cmp.Or(app.Config.Name, defaultLibraryName), baseURL, app.oaiAdminEmail(), earliest)
+	case oai.VerbListMetadataFormats:
+		if input.Identifier != "" {
+			if _, err := app.oaiBook(ctx, repositoryIdentifier, input.Identifier); err != nil {
+				return err
+			}
+		}
+		resp.SetMetadataFormats()
+	case oai.VerbListSets:
+		return &oai.Error{Code: oai.ErrorNoSetHierarchy, Message: "The repository does not support sets"}
+	case oai.VerbGetRecord:
+		switch {
+		case input.Identifier == "" || input.MetadataPrefix == "":
+			return &oai.Error{Code: oai.ErrorBadArgument, Message: "The arguments identifier and metadataPrefix are required"}
+		case input.MetadataPrefix != oai.MetadataPrefixDC:
+			return &oai.Error{Code: oai.ErrorCannotDisseminateFormat, Message: fmt.Sprintf("The metadata format %s is not supported", input.MetadataPrefix)}
+		}
+
+		book, err := app.oaiBook(ctx, repositoryIdentifier, input.Identifier)
+		if err != nil {
+			return err
+		}
+		resp.SetRecord(oai.NewRecord(header(*book), dublinCore(*book)))
+	case oai.VerbListIdentifiers, oai.VerbListRecords:
+		token, err := oaiHarvest(input, now)
+		if err != nil {
+			return err
+		}
+
+		books, resumption, err := app.harvestBooks(ctx, token)
+		if err != nil {
+			return err
+		}
+		if len(books) == 0 && token.Returned == 0 {
+			return &oai.Error{Code: oai.ErrorNoRecordsMatch, Message: "No records match the request"}
+		}
+
+		if input.Verb == oai.VerbListIdentifiers {
+			headers := make([]oai.Header, 0, len(books))
+			for _, book := range books {
+				headers = append(headers, header(book))
+			}
+			resp.SetIdentifiers(headers, resumption)
+		} else {
+			records := make([]oai.Record, 0, len(books))
+			for _, book := range books {
+				records = append(records, oai.NewRecord(header(book), dublinCore(book)))
+			}
+			resp.SetRecords(records, resumption)
+		}
+	}
+
+	return nil
+}
+
+// oaiHandler handles the verbs of OAI-PMH, by which aggregators harvest the records of the catalog.
+// Errors of requests are reported as OAI-PMH errors in successful responses, as the protocol requires.
+func (app *Application) oaiHandler(ctx context.Context, input *OAIInput) (*OAIOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	now := time.Now()
+	resp := oai.NewResponse(oai.Request{
+		Verb:            input.Verb,
+		Identifier:      input.Identifier,
+		MetadataPrefix:  input.MetadataPrefix,
+		From:            input.From,
+		Until:           input.Until,
+		Set:             input.Set,
+		ResumptionToken: input.ResumptionToken,
+		BaseURL:         app.oaiBaseURL(input.host),
+	}, now)
+
+	if err := app.oaiRespond(ctx, input, resp, now); err != nil {
+		var oaiErr *oai.Error
+		switch {
+		case errors.As(err, &oaiErr):
+			resp.Fail(oaiErr)
+		default:
+			return &OAIOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	var b bytes.Buffer
+	if err := resp.Write(&b); err != nil {
+		return &OAIOutput{}, app.serverError(ctx, err)
+	}
+
+	return &OAIOutput{ContentType: oai.ContentType, Body: b.Bytes()}, nil
+}
@@ -0,0 +1,133 @@
+package api_test
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/mzeevi/library/internal/api/apitest"
+	"github.com/mzeevi/library/internal/auth"
+	"github.com/mzeevi/library/internal/isbn"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// oaiResponse is the part of an OAI-PMH response which the tests read.
+type oaiResponse struct {
+	Errors []struct {
+		Code string `xml:"code,attr"`
+	} `xml:"error"`
+	BaseURL     string   `xml:"Identify>baseURL"`
+	Identifiers []string `xml:"ListIdentifiers>header>identifier"`
+	Token       *struct {
+		CompleteListSize int64  `xml:"completeListSize,attr"`
+		Cursor           int64  `xml:"cursor,attr"`
+		Value            string `xml:",chardata"`
+	} `xml:"ListIdentifiers>resumptionToken"`
+	Records []struct {
+		Identifier string   `xml:"header>identifier"`
+		Titles     []string `xml:"metadata>dc>title"`
+		IDs        []string `xml:"metadata>dc>identifier"`
+	} `xml:"ListRecords>record"`
+	Record struct {
+		Identifier string   `xml:"header>identifier"`
+		Titles     []string `xml:"metadata>dc>title"`
+	} `xml:"GetRecord>record"`
+}
+
+func TestOAI(t *testing.T) {
+	a := apitest.New(t)
+	patronID := a.SeedPatron(apitest.Patron("aggregator@example.com", auth.ReadBooksPermission))
+	aggregator := a.PatronAuth(patronID)
+
+	harvest := func(params url.Values) oaiResponse {
+		t.Helper()
+
+		rec := a.Do(http.MethodGet, "/oai?"+params.Encode(), aggregator)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET /oai?%s status = %v; want %v (body: %s)", params.Encode(), rec.Code, http.StatusOK, rec.Body.String())
+		}
+
+		var resp oaiResponse
+		if err := xml.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("GET /oai?%s = %s; want an OAI-PMH response (%v)", params.Encode(), rec.Body.String(), err)
+		}
+		return resp
+	}
+
+	resp := harvest(url.Values{"verb": {"ListRecords"}, "metadataPrefix": {"oai_dc"}})
+	if len(resp.Errors) != 1 || resp.Errors[0].Code != "noRecordsMatch" {
+		t.Errorf("harvest of an empty catalog errors = %+v; want noRecordsMatch", resp.Errors)
+	}
+
+	ids := make(map[string]bool)
+	for i := range 105 {
+		digits := make([]int, 12)
+		for j, r := range fmt.Sprintf("978%09d", i) {
+			digits[j] = int(r - '0')
+		}
+		ids[a.SeedBook(apitest.Book(fmt.Sprintf("978%09d%d", i, isbn.CheckDigit13(digits)), 1))] = true
+	}
+
+	resp = harvest(url.Values{"verb": {"Identify"}})
+	if resp.BaseURL != "http://example.com/oai" {
+		t.Errorf("Identify base URL = %q; want http://example.com/oai", resp.BaseURL)
+	}
+
+	resp = harvest(url.Values{"verb": {"ListIdentifiers"}, "metadataPrefix": {"oai_dc"}, "from": {"2000-01-01"}})
+	if len(resp.Identifiers) != 100 || resp.Token == nil || resp.Token.Value == "" || resp.Token.CompleteListSize != 105 || resp.Token.Cursor != 0 {
+		t.Fatalf("first list = %d identifiers, token %+v; want 100 and a token of 105 records", len(resp.Identifiers), resp.Token)
+	}
+	identifiers := resp.Identifiers
+
+	resp = harvest(url.Values{"verb": {"ListIdentifiers"}, "resumptionToken": {resp.Token.Value}})
+	if len(resp.Identifiers) != 5 || resp.Token == nil || resp.Token.Value != "" || resp.Token.Cursor != 100 {
+		t.Fatalf("resumed list = %d identifiers, token %+v; want 5 and an empty token", len(resp.Identifiers), resp.Token)
+	}
+	identifiers = append(identifiers, resp.Identifiers...)
+
+	for _, identifier := range identifiers {
+		id, ok := strings.CutPrefix(identifier, "oai:example.com:")
+		if !ok || !ids[id] {
+			t.Errorf("harvested identifier %s; want an identifier of a seeded book, harvested once", identifier)
+		}
+		delete(ids, id)
+	}
+
+	resp = harvest(url.Values{"verb": {"GetRecord"}, "metadataPrefix": {"oai_dc"}, "identifier": {identifiers[0]}})
+	if resp.Record.Identifier != identifiers[0] || len(resp.Record.Titles) != 1 || resp.Record.Titles[0] != "Test Book" {
+		t.Errorf("GetRecord = %+v; want the record of the book", resp.Record)
+	}
+
+	resp = harvest(url.Values{"verb": {"ListRecords"}, "metadataPrefix": {"oai_dc"}, "from": {time.Now().Add(time.Hour).UTC().Format("2006-01-02T15:04:05Z")}})
+	if len(resp.Errors) != 1 || resp.Errors[0].Code != "noRecordsMatch" {
+		t.Errorf("harvest from the future errors = %+v; want noRecordsMatch", resp.Errors)
+	}
+
+	for query, code := range map[string]string{
+		"":                                    "badVerb",
+		"verb=Harvest":                        "badVerb",
+		"verb=Identify&verb=Identify":         "badVerb",
+		"verb=Identify&metadataPrefix=oai_dc": "badArgument",
+		"verb=ListRecords":                    "badArgument",
+		"verb=ListRecords&metadataPrefix=oai_dc&from=2000-01-01&until=2000-01-01T00:00:00Z":        "badArgument",
+		"verb=ListRecords&metadataPrefix=oai_dc&from=yesterday":                                    "badArgument",
+		"verb=ListRecords&metadataPrefix=marc21":                                                   "cannotDisseminateFormat",
+		"verb=ListRecords&metadataPrefix=oai_dc&set=fiction":                                       "noSetHierarchy",
+		"verb=ListRecords&resumptionToken=invalid":                                                 "badResumptionToken",
+		"verb=ListRecords&resumptionToken=invalid&metadataPrefix=oai_dc":                           "badArgument",
+		"verb=GetRecord&metadataPrefix=oai_dc&identifier=oai:example.com:000000000000000000000000": "idDoesNotExist",
+		"verb=ListSets": "noSetHierarchy",
+	} {
+		params, _ := url.ParseQuery(query)
+		resp = harvest(params)
+		if len(resp.Errors) != 1 || resp.Errors[0].Code != code {
+			t.Errorf("GET /oai?%s errors = %+v; want %s", query, resp.Errors, code)
+		}
+	}
+
+	if rec := a.Do(http.MethodGet, "/oai?verb=Identify"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("GET /oai without credentials status = %v; want %v", rec.Code, http.StatusUnauthorized)
+	}
+}
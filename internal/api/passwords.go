@@ -0,0 +1,93 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/mzeevi/library/internal/auth"
+	"github.com/mzeevi/library/internal/data"
+	"log/slog"
+)
+
+// checkPassword checks a new password against the password policy, returning a huma error with
+// the location of the password if it breaks the policy. A password is allowed if the breached
+// passwords cannot be checked, so that patrons and admins can still set passwords while the
+// service is unavailable.
+func (app *Application) checkPassword(ctx context.Context, password, location string) error {
+	ctx, cancel := context.WithTimeout(ctx, breachTimeout)
+	defer cancel()
+
+	err := app.passwords.Check(ctx, password)
+	switch {
+	case err == nil:
+		return nil
+	case auth.IsPolicyViolation(err):
+		return huma.Error422UnprocessableEntity("validation failed", &huma.ErrorDetail{
+			Location: location,
+			Message:  err.Error(),
+		})
+	default:
+		app.requestLogger(ctx).Warn("failed to check breached passwords", slog.Any("error", err))
+		return nil
+	}
+}
+
+// EnsureAdmin creates an admin if no admin has the username, and reports whether it was created.
+// The password of a new admin must follow the password policy, while the password of an existing
+// admin is left as is.
+func (app *Application) EnsureAdmin(ctx context.Context, username, password string) (bool, error) {
+	_, err := app.Models.Admins.Get(ctx, data.AdminFilter{Name: &username})
+	switch {
+	case err == nil:
+		return false, nil
+	case !errors.Is(err, data.ErrDocumentNotFound):
+		return false, err
+	}
+
+	if err = app.passwords.Check(ctx, password); err != nil {
+		if auth.IsPolicyViolation(err) {
+			return false, fmt.Errorf("invalid admin password: %w", err)
+		}
+		app.logger.Warn("failed to check breached passwords", slog.Any("error", err))
+	}
+
+	return app.Models.Admins.Ensure(ctx, username, password)
+}
+
+// rehashPatronPassword sets the password of a patron who logged in with it again if its hash was
+// not calculated by the configured hasher with its current parameters, such as after the cost was
+// raised or the algorithm changed. Failures are only logged, since the patron is re-hashed at their
+// next login.
+func (app *Application) rehashPatronPassword(ctx context.Context, patron *data.Patron, password string) {
+	if !patron.Password.NeedsRehash() {
+		return
+	}
+
+	original := *patron
+	if err := patron.Password.Set(password); err != nil {
+		app.requestLogger(ctx).Warn("failed to rehash password", slog.Any("error", err))
+		return
+	}
+
+	if err := app.Models.Patrons.Patch(ctx, data.PatronFilter{ID: ptr(data.PatronID(patron.ID))}, &original, patron); err != nil {
+		app.requestLogger(ctx).Warn("failed to rehash password", slog.Any("error", err))
+	}
+}
+
+// rehashAdminPassword sets the password of an admin who logged in with it again if its hash was
+// not calculated by the configured hasher with its current parameters. Failures are only logged.
+func (app *Application) rehashAdminPassword(ctx context.Context, admin *data.Admin, password string) {
+	if !admin.Password.NeedsRehash() {
+		return
+	}
+
+	if err := admin.Password.Set(password); err != nil {
+		app.requestLogger(ctx).Warn("failed to rehash password", slog.Any("error", err))
+		return
+	}
+
+	if err := app.Models.Admins.Update(ctx, data.AdminFilter{ID: &admin.ID}, admin); err != nil {
+		app.requestLogger(ctx).Warn("failed to rehash password", slog.Any("error", err))
+	}
+}
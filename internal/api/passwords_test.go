@@ -0,0 +1,152 @@
+package api_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/mzeevi/library/internal/api"
+	"github.com/mzeevi/library/internal/api/apitest"
+	"github.com/mzeevi/library/internal/auth"
+	"github.com/mzeevi/library/internal/data"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	// The server reports the suffix of the SHA-1 hash of "correct horse" as breached in every range.
+	pwned := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "3523B62ABC141A2B4D6019D23CBA835DBD0:3\r\n")
+	}))
+	defer pwned.Close()
+
+	a := apitest.New(t, func(app *api.Application) {
+		app.Config.Passwords.MinLength = 10
+		app.Config.Passwords.DenyCommon = true
+		app.Config.Passwords.CheckBreached = true
+		app.Config.Passwords.BreachURL = pwned.URL + "/range/"
+	})
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+
+	tests := []struct {
+		name     string
+		password string
+		want     int
+	}{
+		{name: "too short", password: "pa55word", want: http.StatusUnprocessableEntity},
+		{name: "common", password: "Password123", want: http.StatusUnprocessableEntity},
+		{name: "breached", password: "correct horse", want: http.StatusUnprocessableEntity},
+		{name: "strong", password: "correct horse battery staple", want: http.StatusOK},
+	}
+
+	for i, tt := range tests {
+		patron := map[string]string{"name": "Noa", "email": fmt.Sprintf("noa%d@example.com", i), "password": tt.password, "category": "student"}
+		if rec := a.Do(http.MethodPost, "/patrons", admin, patron); rec.Code != tt.want {
+			t.Errorf("%s: POST /patrons status = %v; want %v (body: %s)", tt.name, rec.Code, tt.want, rec.Body.String())
+		}
+	}
+
+	patronID := a.SeedPatron(apitest.Patron("patron@example.com"))
+	path := "/patrons/" + patronID
+	if rec := a.Do(http.MethodPut, path, admin, map[string]string{"password": "password123"}); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("PUT %s with a common password status = %v; want %v (body: %s)", path, rec.Code, http.StatusUnprocessableEntity, rec.Body.String())
+	}
+
+	stored, err := a.Models.Admins.Get(context.Background(), data.AdminFilter{Name: apitest.Ptr("admin")})
+	if err != nil {
+		t.Fatalf("failed to get admin: %v", err)
+	}
+	path = "/admins/" + stored.ID + "/password"
+	if rec := a.Do(http.MethodPut, path, admin, map[string]string{"password": "short"}); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("PUT %s with a short password status = %v; want %v (body: %s)", path, rec.Code, http.StatusUnprocessableEntity, rec.Body.String())
+	}
+
+	if _, err = a.App.EnsureAdmin(context.Background(), "other", "password123"); err == nil {
+		t.Errorf("EnsureAdmin() with a common password error = nil; want an error")
+	}
+	if _, err = a.App.EnsureAdmin(context.Background(), "admin", "short"); err != nil {
+		t.Errorf("EnsureAdmin() of an existing admin error = %v; want nil", err)
+	}
+}
+
+func TestPasswordPolicyBreachesUnavailable(t *testing.T) {
+	pwned := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer pwned.Close()
+
+	a := apitest.New(t, func(app *api.Application) {
+		app.Config.Passwords.CheckBreached = true
+		app.Config.Passwords.BreachURL = pwned.URL + "/range/"
+	})
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+
+	patron := map[string]string{"name": "Noa", "email": "noa@example.com", "password": "correct horse", "category": "student"}
+	if rec := a.Do(http.MethodPost, "/patrons", admin, patron); rec.Code != http.StatusOK {
+		t.Errorf("POST /patrons status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+}
+
+func TestRehashPasswordOnLogin(t *testing.T) {
+	a := apitest.New(t)
+	a.SeedAdmin("admin", "admin-password")
+
+	patron := apitest.Patron("patron@example.com")
+	if err := patron.Password.Set("pa55word1234"); err != nil {
+		t.Fatalf("failed to set password: %v", err)
+	}
+	patronID := a.SeedPatron(patron)
+
+	// The cost is lowered after the passwords were hashed, like a restart with another --bcrypt-cost.
+	auth.SetHasher(auth.BcryptHasher{Cost: bcrypt.MinCost})
+	t.Cleanup(func() { auth.SetHasher(auth.BcryptHasher{Cost: auth.DefaultBcryptCost}) })
+
+	login := map[string]string{"email": "patron@example.com", "password": "pa55word1234"}
+	if rec := a.Do(http.MethodPost, "/token/authentication", login); rec.Code != http.StatusOK {
+		t.Fatalf("POST /token/authentication status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	// Admins log in with every request.
+	if rec := a.Do(http.MethodGet, "/patrons/"+patronID, apitest.AdminAuth("admin", "admin-password")); rec.Code != http.StatusOK {
+		t.Fatalf("GET /patrons/%s status = %v; want %v (body: %s)", patronID, rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	stored, err := a.Models.Patrons.Get(context.Background(), data.PatronFilter{ID: apitest.Ptr(data.PatronID(patronID))})
+	if err != nil {
+		t.Fatalf("failed to get patron: %v", err)
+	}
+	if cost, _ := bcrypt.Cost(stored.Password.Hash); cost != bcrypt.MinCost {
+		t.Errorf("patron password cost = %d; want %d", cost, bcrypt.MinCost)
+	}
+	if match, _ := stored.Password.Matches("pa55word1234"); !match {
+		t.Errorf("rehashed patron password does not match")
+	}
+
+	admin, err := a.Models.Admins.Get(context.Background(), data.AdminFilter{Name: apitest.Ptr("admin")})
+	if err != nil {
+		t.Fatalf("failed to get admin: %v", err)
+	}
+	if cost, _ := bcrypt.Cost(admin.Password.Hash); cost != bcrypt.MinCost {
+		t.Errorf("admin password cost = %d; want %d", cost, bcrypt.MinCost)
+	}
+
+	// Switching to argon2id migrates the password at the next login, like a restart with --password-hash=argon2id.
+	auth.SetHasher(auth.Argon2idHasher{Memory: 64, Iterations: 1, Parallelism: 1})
+	if rec := a.Do(http.MethodPost, "/token/authentication", login); rec.Code != http.StatusOK {
+		t.Fatalf("POST /token/authentication status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	stored, err = a.Models.Patrons.Get(context.Background(), data.PatronFilter{ID: apitest.Ptr(data.PatronID(patronID))})
+	if err != nil {
+		t.Fatalf("failed to get patron: %v", err)
+	}
+	if !strings.HasPrefix(string(stored.Password.Hash), "$argon2id$") {
+		t.Errorf("patron password hash = %s; want an argon2id hash", stored.Password.Hash)
+	}
+	if rec := a.Do(http.MethodPost, "/token/authentication", login); rec.Code != http.StatusOK {
+		t.Errorf("POST /token/authentication with an argon2id hash status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+}
@@ -8,16 +8,34 @@ import (
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/mzeevi/library/internal/auth"
 	"github.com/mzeevi/library/internal/data"
+	"github.com/mzeevi/library/internal/mailer"
+	"github.com/mzeevi/library/internal/notifier"
+	"github.com/mzeevi/library/internal/query"
+	"log/slog"
+	"slices"
+	"strings"
 	"time"
 )
 
 const (
 	errInvalidOrExpiredTokenMsg = "invalid or expired activation token"
 	errEmailAlreadyExistsMsg    = "a resource with this email address already exists"
+	errPasswordRequiredMsg      = "a password must be set, since the patron has none"
+	errPasswordAlreadySetMsg    = "the patron already has a password"
+	errAdminOnlyFieldsMsg       = "only admins can change the password, category and external IDs of a patron"
+	errPasswordPatronOnlyMsg    = "passwords are only changed here by patrons"
+	errEncryptedSortMsg         = "patrons can't be sorted by their encrypted name or email"
+	errEncryptedMatchMsg        = "encrypted names are only matched exactly, set match to exact"
 )
 
+// activationTokenTTL is how long the activation token of a new patron is valid.
+const activationTokenTTL = 3 * 24 * time.Hour
+
+// patronPermissions are the permissions of new patrons.
+var patronPermissions = []string{auth.WritePatronPermission, auth.ReadPatronPermission, auth.ReadBooksPermission, auth.BorrowBookPermission, auth.ReturnBookPermission}
+
 type GetPatronInput struct {
-	ID string `json:"id" path:"id"`
+	ID data.PatronID `json:"id" path:"id"`
 }
 
 type GetPatronOutput struct {
@@ -35,9 +53,19 @@ type patronTransaction struct {
 	Fine        float64          `json:"fine"`
 }
 
+type GetPatronStatsInput struct {
+	ID   data.PatronID `json:"id" path:"id"`
+	AsOf string        `query:"as_of" doc:"Day of the statistics, formatted as YYYY-MM-DD in the timezone of the library, as of its end. Now by default"`
+}
+
+type GetPatronStatsOutput struct {
+	Body data.PatronStats
+}
+
 type GetPatronsInput struct {
 	PaginationInput
-	Sort string `json:"sort,omitempty" query:"sort" enum:"category,name,email,-category,-name,-email"`
+	IDs  []string `json:"ids,omitempty" query:"ids" maxItems:"100" doc:"Only the patrons with these IDs, such as to resolve the references in a list in one request"`
+	Sort string   `json:"sort,omitempty" query:"sort" enum:"category,name,email,-category,-name,-email"`
 }
 
 type GetPatronsOutput struct {
@@ -50,11 +78,15 @@ type PatronsInfo struct {
 }
 
 type CreatePatronInput struct {
-	Body struct {
-		Name     string `json:"name" minLength:"1"`
-		Email    string `json:"email"`
-		Password string `json:"password" minLength:"8" maxLength:"72"`
-		Category string `json:"category" enum:"teacher,student"`
+	AcceptLanguage string `header:"Accept-Language" doc:"Locale of the activation email and later notifications"`
+	Body           struct {
+		Name                string            `json:"name" minLength:"1"`
+		Email               string            `json:"email"`
+		Password            string            `json:"password" maxLength:"72" doc:"Password of the Patron, which must follow the password policy"`
+		Category            string            `json:"category" minLength:"1"`
+		Phone               string            `json:"phone,omitempty" pattern:"^\\+[1-9][0-9]{6,14}$" doc:"Phone number in E.164 format, such as +972501234567"`
+		NotificationChannel string            `json:"notification_channel,omitempty" enum:"email,sms" doc:"Channel to notify the Patron on, email by default"`
+		ExternalIDs         map[string]string `json:"external_ids,omitempty" maxProperties:"10" doc:"IDs of the Patron in other systems by the name of the system, such as {\"sis\": \"1001\"} for their student ID"`
 	}
 }
 
@@ -69,12 +101,15 @@ type newPatronInfo struct {
 }
 
 type UpdatePatronInput struct {
-	ID   string `json:"id" path:"id"`
+	ID   data.PatronID `json:"id" path:"id"`
 	Body struct {
-		Name     *string `json:"name,omitempty" minLength:"1"`
-		Email    *string `json:"email,omitempty"`
-		Password *string `json:"password,omitempty" minLength:"8" maxLength:"72"`
-		Category *string `json:"category,omitempty" enum:"teacher,student"`
+		Name                *string           `json:"name,omitempty" minLength:"1"`
+		Email               *string           `json:"email,omitempty"`
+		Password            *string           `json:"password,omitempty" maxLength:"72" doc:"New password of the Patron, which must follow the password policy"`
+		Category            *string           `json:"category,omitempty" minLength:"1"`
+		Phone               *string           `json:"phone,omitempty" pattern:"^(\\+[1-9][0-9]{6,14})?$" doc:"Phone number in E.164 format, or empty to remove it"`
+		NotificationChannel *string           `json:"notification_channel,omitempty" enum:"email,sms" doc:"Channel to notify the Patron on"`
+		ExternalIDs         map[string]string `json:"external_ids,omitempty" maxProperties:"10" doc:"IDs of the Patron in other systems by the name of the system, which replace their external IDs"`
 	}
 }
 
@@ -82,8 +117,19 @@ type UpdatePatronOutput struct {
 	Body data.Patron `json:"patron"`
 }
 
+type UpdatePatronPasswordInput struct {
+	Body struct {
+		CurrentPassword string `json:"current_password" minLength:"8" maxLength:"72" doc:"Current password of the patron"`
+		Password        string `json:"password" maxLength:"72" doc:"New password of the patron, which must follow the password policy"`
+	}
+}
+
+type UpdatePatronPasswordOutput struct {
+	Body string `json:"message"`
+}
+
 type DeletePatronInput struct {
-	ID string `json:"id" path:"id"`
+	ID data.PatronID `json:"id" path:"id"`
 }
 
 type DeletePatronOutput struct {
@@ -93,6 +139,7 @@ type DeletePatronOutput struct {
 type ActivatePatronInput struct {
 	Body struct {
 		TokenPlaintext string `json:"token" minLength:"26" maxLength:"26"`
+		Password       string `json:"password,omitempty" maxLength:"72" required:"false" doc:"Password of a Patron who has none, such as one imported from a roster, which must follow the password policy"`
 	}
 }
 
@@ -100,6 +147,37 @@ type ActivatePatronOutput struct {
 	Body data.Patron `json:"patron"`
 }
 
+type ResendActivationInput struct {
+	Body struct {
+		Email string `json:"email" doc:"Email of the Patron who is not activated yet"`
+	}
+}
+
+type ResendActivationOutput struct {
+	Body string `json:"message"`
+}
+
+type MergePatronsInput struct {
+	Body struct {
+		SourceID string `json:"source_id" doc:"ID of the duplicate Patron, which is deleted after the merge"`
+		TargetID string `json:"target_id" doc:"ID of the Patron which remains after the merge"`
+	}
+}
+
+type MergePatronsOutput struct {
+	Body MergedPatronInfo
+}
+
+type MergedPatronInfo struct {
+	Patron       data.Patron `json:"patron"`
+	Transactions int64       `json:"transactions"`
+}
+
+// Resolve validates the input in GetPatronsInput.
+func (b *GetPatronsInput) Resolve(ctx huma.Context) []error {
+	return validateIDs(b.IDs, "query.ids")
+}
+
 func (p *GetPatronInput) Resolve(ctx huma.Context) []error {
 	var errs []error
 
@@ -111,6 +189,22 @@ func (p *GetPatronInput) Resolve(ctx huma.Context) []error {
 	return errs
 }
 
+// Resolve validates the input in GetPatronStatsInput.
+func (p *GetPatronStatsInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	err := validateID(&p.ID, "path.id")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	if err = validateAsOf(p.AsOf, "query.as_of"); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
 func (p *DeletePatronInput) Resolve(ctx huma.Context) []error {
 	var errs []error
 
@@ -131,6 +225,50 @@ func (p *CreatePatronInput) Resolve(ctx huma.Context) []error {
 		errs = append(errs, err)
 	}
 
+	err = validateNotificationChannel(p.Body.NotificationChannel, p.Body.Phone, "body.phone")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	errs = append(errs, validateExternalIDs(p.Body.ExternalIDs, "body.external_ids")...)
+
+	return errs
+}
+
+// Resolve validates the input in ResendActivationInput.
+func (p *ResendActivationInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	err := validateEmail(&p.Body.Email, "body.email")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// Resolve validates the input in MergePatronsInput.
+func (p *MergePatronsInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	err := validateID(&p.Body.SourceID, "body.source_id")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	err = validateID(&p.Body.TargetID, "body.target_id")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	if p.Body.SourceID == p.Body.TargetID {
+		errs = append(errs, &huma.ErrorDetail{
+			Location: "body.target_id",
+			Message:  "target_id must be different from source_id",
+			Value:    p.Body.TargetID,
+		})
+	}
+
 	return errs
 }
 
@@ -148,6 +286,8 @@ func (p *UpdatePatronInput) Resolve(ctx huma.Context) []error {
 		errs = append(errs, err)
 	}
 
+	errs = append(errs, validateExternalIDs(p.Body.ExternalIDs, "body.external_ids")...)
+
 	return errs
 }
 
@@ -162,16 +302,16 @@ func (app *Application) getPatronHandler(ctx context.Context, input *GetPatronIn
 		case errors.Is(err, data.ErrDocumentNotFound):
 			return &GetPatronOutput{}, huma.Error404NotFound(errNotFoundMsg)
 		default:
-			return &GetPatronOutput{}, err
+			return &GetPatronOutput{}, app.serverError(ctx, err)
 		}
 	}
 
 	patronTransactions, _, err := app.Models.Transactions.GetAll(ctx, data.TransactionFilter{PatronID: &input.ID}, data.Paginator{}, data.Sorter{})
 	if err != nil {
-		return &GetPatronOutput{}, err
+		return &GetPatronOutput{}, app.serverError(ctx, err)
 	}
 
-	transactionsSummary, totalFine := processPatronTransactions(patronTransactions, app.cost.overdueFine)
+	transactionsSummary, totalFine := processPatronTransactions(patronTransactions, app.cost.overdueFine, time.Now(), app.location)
 
 	resp := &GetPatronOutput{
 		Body: PatronSummary{
@@ -184,19 +324,47 @@ func (app *Application) getPatronHandler(ctx context.Context, input *GetPatronIn
 	return resp, nil
 }
 
+// getPatronStatsHandler handles a request to get the engagement statistics of a patron.
+func (app *Application) getPatronStatsHandler(ctx context.Context, input *GetPatronStatsInput) (*GetPatronStatsOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	_, err := app.Models.Patrons.Get(ctx, data.PatronFilter{ID: &input.ID})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return &GetPatronStatsOutput{}, huma.Error404NotFound(errNotFoundMsg)
+		default:
+			return &GetPatronStatsOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	stats, err := app.Models.Transactions.PatronStats(ctx, string(input.ID), app.asOf(input.AsOf))
+	if err != nil {
+		return &GetPatronStatsOutput{}, app.serverError(ctx, err)
+	}
+
+	return &GetPatronStatsOutput{Body: *stats}, nil
+}
+
 // getPatronsHandler retrieves a list of patrons based on filters, pagination, and sorting.
 func (app *Application) getPatronsHandler(ctx context.Context, input *GetPatronsInput) (*GetPatronsOutput, error) {
-	paginator := data.Paginator{Page: input.Page, PageSize: input.PageSize}
-	filter := data.PatronFilter{}
+	// A batch of IDs is returned in one page.
+	paginator := data.Paginator{Page: input.Page, PageSize: max(input.PageSize, int64(len(input.IDs)))}
+	filter := data.PatronFilter{IDs: typedIDs[data.PatronID](input.IDs)}
 
-	sorter := data.Sorter{Field: input.Sort, SortSafelist: supportedPatronsSortFields}
+	sorter := data.Sorter{Field: input.Sort, SortSafelist: supportedPatronsSortFields, Collation: app.collation}
+
+	if err := app.checkEncryptedPatronsQuery(input.Sort, "", ""); err != nil {
+		return &GetPatronsOutput{}, err
+	}
 
 	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
 	defer cancel()
 
 	patrons, metadata, err := app.Models.Patrons.GetAll(ctx, filter, paginator, sorter)
 	if err != nil {
-		return &GetPatronsOutput{}, err
+		return &GetPatronsOutput{}, app.serverError(ctx, err)
 	}
 
 	resp := &GetPatronsOutput{
@@ -209,40 +377,99 @@ func (app *Application) getPatronsHandler(ctx context.Context, input *GetPatrons
 	return resp, nil
 }
 
+// checkEncryptedPatronsQuery checks that a query of patrons can be answered when their personal
+// fields are encrypted: their names are only matched exactly, by their digests, and they can't be
+// sorted by their encrypted name or email.
+func (app *Application) checkEncryptedPatronsQuery(sort, name, match string) error {
+	if app.Config.Encryption.Key == "" {
+		return nil
+	}
+
+	var errs []error
+	if field := strings.TrimPrefix(sort, "-"); field == query.NameKey || field == query.EmailKey {
+		errs = append(errs, &huma.ErrorDetail{
+			Location: fmt.Sprintf("%s.%s", query.Key, query.SortKey),
+			Message:  errEncryptedSortMsg,
+			Value:    sort,
+		})
+	}
+	if name != "" && data.Match(match) != data.MatchExact {
+		errs = append(errs, &huma.ErrorDetail{
+			Location: fmt.Sprintf("%s.%s", query.Key, query.MatchKey),
+			Message:  errEncryptedMatchMsg,
+			Value:    match,
+		})
+	}
+
+	if len(errs) > 0 {
+		return huma.Error422UnprocessableEntity("validation failed", errs...)
+	}
+
+	return nil
+}
+
 // createPatronHandler creates a new patron and stores it in the database.
 func (app *Application) createPatronHandler(ctx context.Context, input *CreatePatronInput) (*CreatePatronOutput, error) {
 	patron := &data.Patron{
-		Name:     input.Body.Name,
-		Email:    input.Body.Email,
-		Category: input.Body.Category,
+		Name:                input.Body.Name,
+		Email:               input.Body.Email,
+		Category:            input.Body.Category,
+		Phone:               input.Body.Phone,
+		NotificationChannel: input.Body.NotificationChannel,
+		Locale:              app.mailer.Locale(input.AcceptLanguage),
+		ExternalIDs:         input.Body.ExternalIDs,
 	}
 
-	if err := patron.Password.Set(input.Body.Password); err != nil {
+	if err := app.checkPassword(ctx, input.Body.Password, "body.password"); err != nil {
 		return &CreatePatronOutput{}, err
 	}
 
-	permissions := []string{auth.WritePatronPermission, auth.ReadPatronPermission, auth.ReadBooksPermission, auth.BorrowBookPermission, auth.ReturnBookPermission}
-	patron.Permissions = permissions
+	if err := patron.Password.Set(input.Body.Password); err != nil {
+		return &CreatePatronOutput{}, app.serverError(ctx, err)
+	}
+
+	patron.Permissions = slices.Clone(patronPermissions)
 
 	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
 	defer cancel()
 
-	id, err := app.Models.Patrons.Insert(ctx, patron)
-	if err != nil {
-		switch {
-		case errors.Is(err, data.ErrDuplicateEmail):
-			return &CreatePatronOutput{}, huma.Error422UnprocessableEntity(errEmailAlreadyExistsMsg)
-		case errors.Is(err, data.ErrDuplicateID):
-			return &CreatePatronOutput{}, huma.Error422UnprocessableEntity(errIDAlreadyExistsMsg)
-		}
+	if err := app.validateCategory(ctx, patron.Category, "body.category"); err != nil {
 		return &CreatePatronOutput{}, err
 	}
 
-	token, err := app.Models.Tokens.New(ctx, id, 3*24*time.Hour, data.ScopeActivation)
+	var id string
+	var token *data.Token
+	err := app.Models.Transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		err := app.checkPatronExternalIDs(ctx, patron.ExternalIDs, "")
+		if err != nil {
+			return err
+		}
+
+		id, err = app.Models.Patrons.Insert(ctx, patron)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrDuplicateEmail):
+				return huma.Error422UnprocessableEntity(errEmailAlreadyExistsMsg)
+			case errors.Is(err, data.ErrDuplicateID):
+				return huma.Error422UnprocessableEntity(errIDAlreadyExistsMsg)
+			}
+			return err
+		}
+		patron.ID = id
+
+		token, err = app.Models.Tokens.New(ctx, id, activationTokenTTL, data.ScopeActivation)
+		if err != nil {
+			return err
+		}
+
+		return app.recordEvent(ctx, data.EventPatronCreated, patronEvent{ID: id, Category: patron.Category})
+	})
 	if err != nil {
-		return &CreatePatronOutput{}, err
+		return &CreatePatronOutput{}, app.transactionError(ctx, err)
 	}
 
+	app.sendActivationEmail(ctx, patron, token)
+
 	resp := &CreatePatronOutput{
 		Body: newPatronInfo{
 			Patron: *patron,
@@ -254,19 +481,61 @@ func (app *Application) createPatronHandler(ctx context.Context, input *CreatePa
 	return resp, nil
 }
 
-// updatePatronHandler updates an existing patron based on the provided ID and fields.
+// sendActivationEmail sends the activation token to a new patron in the background.
+func (app *Application) sendActivationEmail(ctx context.Context, patron *data.Patron, token *data.Token) {
+	app.background(ctx, func(ctx context.Context) {
+		app.deliverActivationEmail(ctx, patron, token)
+	})
+}
+
+// deliverActivationEmail sends the activation token to a new patron, logging failures.
+func (app *Application) deliverActivationEmail(ctx context.Context, patron *data.Patron, token *data.Token) {
+	emailData := mailer.ActivationData{
+		Name:      patron.Name,
+		Token:     token.Plaintext,
+		ExpiresAt: token.Expiry.In(app.location),
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, emailTimeout)
+	defer cancel()
+
+	if _, err := app.sendNotification(ctx, notifier.Email, patron, mailer.ActivationTemplate, emailData); err != nil {
+		app.requestLogger(ctx).Error("failed to send activation email", slog.Any("error", err))
+		app.reportError(ctx, err)
+	}
+}
+
+// updatePatronHandler updates an existing patron based on the provided ID and fields. A new
+// password is hashed and revokes the sessions of the patron. Only admins can change the password,
+// category and external IDs, since patrons change their password with their current password.
 func (app *Application) updatePatronHandler(ctx context.Context, input *UpdatePatronInput) (*UpdatePatronOutput, error) {
 	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
 	defer cancel()
 
+	if _, ok := adminFromContext(ctx); !ok && (input.Body.Password != nil || input.Body.Category != nil || input.Body.ExternalIDs != nil) {
+		return &UpdatePatronOutput{}, huma.Error403Forbidden(errAdminOnlyFieldsMsg)
+	}
+
 	patron, err := app.Models.Patrons.Get(ctx, data.PatronFilter{ID: &input.ID})
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrDocumentNotFound):
 			return nil, huma.Error404NotFound(errNotFoundMsg)
 		default:
+			return &UpdatePatronOutput{}, app.serverError(ctx, err)
+		}
+	}
+	original := *patron
+
+	if input.Body.Password != nil {
+		if err = app.checkPassword(ctx, *input.Body.Password, "body.password"); err != nil {
 			return &UpdatePatronOutput{}, err
 		}
+		if err = patron.Password.Set(*input.Body.Password); err != nil {
+			return &UpdatePatronOutput{}, app.serverError(ctx, err)
+		}
+		changedAt := time.Now()
+		patron.PasswordChangedAt = &changedAt
 	}
 
 	if input.Body.Name != nil {
@@ -278,17 +547,55 @@ func (app *Application) updatePatronHandler(ctx context.Context, input *UpdatePa
 	}
 
 	if input.Body.Category != nil {
+		if err = app.validateCategory(ctx, *input.Body.Category, "body.category"); err != nil {
+			return &UpdatePatronOutput{}, err
+		}
 		patron.Category = *input.Body.Category
 	}
 
-	err = app.Models.Patrons.Update(ctx, data.PatronFilter{ID: &input.ID}, patron)
-	if err != nil {
-		switch {
-		case errors.Is(err, data.ErrEditConflict):
-			return &UpdatePatronOutput{}, huma.Error409Conflict(errConflictMsg)
-		default:
-			return &UpdatePatronOutput{}, err
+	if input.Body.Phone != nil {
+		patron.Phone = *input.Body.Phone
+	}
+
+	if input.Body.NotificationChannel != nil {
+		patron.NotificationChannel = *input.Body.NotificationChannel
+	}
+
+	if input.Body.ExternalIDs != nil {
+		patron.ExternalIDs = input.Body.ExternalIDs
+	}
+
+	if err = validateNotificationChannel(patron.NotificationChannel, patron.Phone, "body.phone"); err != nil {
+		return &UpdatePatronOutput{}, huma.Error422UnprocessableEntity("validation failed", err)
+	}
+
+	err = app.Models.Transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		if input.Body.ExternalIDs != nil {
+			if err := app.checkPatronExternalIDs(ctx, patron.ExternalIDs, patron.ID); err != nil {
+				return err
+			}
+		}
+
+		err := app.Models.Patrons.Patch(ctx, data.PatronFilter{ID: &input.ID}, &original, patron)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrDocumentNotFound):
+				return huma.Error404NotFound(errNotFoundMsg)
+			default:
+				return err
+			}
+		}
+
+		// A new password revokes the sessions of the patron: tokens issued before PasswordChangedAt
+		// are rejected, and the stored authentication tokens are deleted.
+		if input.Body.Password == nil {
+			return nil
 		}
+
+		return app.revokePatronSessions(ctx, patron.ID)
+	})
+	if err != nil {
+		return &UpdatePatronOutput{}, app.transactionError(ctx, err)
 	}
 
 	resp := &UpdatePatronOutput{
@@ -298,21 +605,101 @@ func (app *Application) updatePatronHandler(ctx context.Context, input *UpdatePa
 	return resp, nil
 }
 
+// updatePatronPasswordHandler handles a request of a patron to change their password. The current
+// password of the patron is required, so that a stolen token can't be used to take over the
+// account, and the new password revokes the sessions of the patron.
+func (app *Application) updatePatronPasswordHandler(ctx context.Context, input *UpdatePatronPasswordInput) (*UpdatePatronPasswordOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	patron, ok := patronFromContext(ctx)
+	if !ok {
+		return &UpdatePatronPasswordOutput{}, huma.Error403Forbidden(errPasswordPatronOnlyMsg)
+	}
+
+	match, err := patron.Password.Matches(input.Body.CurrentPassword)
+	if err != nil {
+		return &UpdatePatronPasswordOutput{}, app.serverError(ctx, err)
+	}
+
+	if !match {
+		return &UpdatePatronPasswordOutput{}, huma.Error401Unauthorized(errInvalidAuthenticationCreds)
+	}
+
+	if err = app.checkPassword(ctx, input.Body.Password, "body.password"); err != nil {
+		return &UpdatePatronPasswordOutput{}, err
+	}
+
+	original := *patron
+	updated := *patron
+	if err = updated.Password.Set(input.Body.Password); err != nil {
+		return &UpdatePatronPasswordOutput{}, app.serverError(ctx, err)
+	}
+	changedAt := time.Now()
+	updated.PasswordChangedAt = &changedAt
+
+	err = app.Models.Transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		err := app.Models.Patrons.Patch(ctx, data.PatronFilter{ID: ptr(data.PatronID(patron.ID))}, &original, &updated)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrDocumentNotFound):
+				return huma.Error404NotFound(errNotFoundMsg)
+			default:
+				return err
+			}
+		}
+
+		return app.revokePatronSessions(ctx, patron.ID)
+	})
+	if err != nil {
+		return &UpdatePatronPasswordOutput{}, app.transactionError(ctx, err)
+	}
+
+	resp := &UpdatePatronPasswordOutput{
+		Body: "password successfully updated",
+	}
+
+	return resp, nil
+}
+
+// revokePatronSessions deletes the authentication tokens of a patron whose password was changed.
+// Tokens issued before PasswordChangedAt are rejected as well.
+func (app *Application) revokePatronSessions(ctx context.Context, patronID string) error {
+	err := app.Models.Tokens.DeleteAllForPatron(ctx, data.TokenFilter{PatronID: &patronID, Scope: ptr(data.ScopeAuthentication)})
+	if err != nil && !errors.Is(err, data.ErrDocumentNotFound) {
+		return err
+	}
+
+	return nil
+}
+
 // deletePatronHandler deletes a patron based on the provided ID.
 func (app *Application) deletePatronHandler(ctx context.Context, input *DeletePatronInput) (*DeletePatronOutput, error) {
 	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
 	defer cancel()
 
-	err := app.Models.Patrons.Delete(ctx, data.PatronFilter{ID: &input.ID})
+	patron, err := app.Models.Patrons.Get(ctx, data.PatronFilter{ID: &input.ID})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return &DeletePatronOutput{}, huma.Error404NotFound(errNotFoundMsg)
+		default:
+			return &DeletePatronOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	err = app.Models.Patrons.Delete(ctx, data.PatronFilter{ID: &input.ID})
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrDocumentNotFound):
 			return &DeletePatronOutput{}, huma.Error404NotFound(errNotFoundMsg)
 		default:
-			return &DeletePatronOutput{}, err
+			return &DeletePatronOutput{}, app.serverError(ctx, err)
 		}
 	}
 
+	app.deletePatronPhoto(ctx, patron.Photo)
+
 	resp := &DeletePatronOutput{
 		Body: "book successfully deleted",
 	}
@@ -320,7 +707,68 @@ func (app *Application) deletePatronHandler(ctx context.Context, input *DeletePa
 	return resp, nil
 }
 
-// activatePatronHandler activates a patron.
+// mergePatronsHandler merges a duplicate patron into another patron. The transactions of the
+// source patron are reassigned to the target patron, and the source patron is deleted with its
+// tokens, all within a single database transaction. The tokens are not reassigned, since an
+// activation token of the source would otherwise set the password of the target.
+func (app *Application) mergePatronsHandler(ctx context.Context, input *MergePatronsInput) (*MergePatronsOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	var target, source *data.Patron
+	var transactions int64
+
+	err := app.Models.Transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+
+		target, err = app.Models.Patrons.Get(ctx, data.PatronFilter{ID: ptr(data.PatronID(input.Body.TargetID))})
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrDocumentNotFound):
+				return huma.Error404NotFound("the requested target patron resource could not be found")
+			default:
+				return err
+			}
+		}
+
+		if source, err = app.Models.Patrons.Get(ctx, data.PatronFilter{ID: ptr(data.PatronID(input.Body.SourceID))}); err != nil {
+			switch {
+			case errors.Is(err, data.ErrDocumentNotFound):
+				return huma.Error404NotFound("the requested source patron resource could not be found")
+			default:
+				return err
+			}
+		}
+
+		transactions, err = app.Models.Transactions.ReassignPatron(ctx, input.Body.SourceID, target.ID)
+		if err != nil {
+			return err
+		}
+
+		err = app.Models.Tokens.DeleteAllForPatron(ctx, data.TokenFilter{PatronID: &source.ID})
+		if err != nil && !errors.Is(err, data.ErrDocumentNotFound) {
+			return err
+		}
+
+		return app.Models.Patrons.Delete(ctx, data.PatronFilter{ID: ptr(data.PatronID(input.Body.SourceID))})
+	})
+	if err != nil {
+		return &MergePatronsOutput{}, app.transactionError(ctx, err)
+	}
+
+	app.deletePatronPhoto(ctx, source.Photo)
+
+	resp := &MergePatronsOutput{
+		Body: MergedPatronInfo{
+			Patron:       *target,
+			Transactions: transactions,
+		},
+	}
+
+	return resp, nil
+}
+
+// activatePatronHandler activates a patron, setting the password of a patron who has none.
 func (app *Application) activatePatronHandler(ctx context.Context, input *ActivatePatronInput) (*ActivatePatronOutput, error) {
 	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
 	defer cancel()
@@ -338,34 +786,62 @@ func (app *Application) activatePatronHandler(ctx context.Context, input *Activa
 		case errors.Is(err, data.ErrDocumentNotFound):
 			return &ActivatePatronOutput{}, huma.Error422UnprocessableEntity(errInvalidOrExpiredTokenMsg)
 		default:
-			return &ActivatePatronOutput{}, err
+			return &ActivatePatronOutput{}, app.serverError(ctx, err)
 		}
 	}
 
-	patron, err := app.Models.Patrons.Get(ctx, data.PatronFilter{ID: &patronID})
+	patron, err := app.Models.Patrons.Get(ctx, data.PatronFilter{ID: ptr(data.PatronID(patronID))})
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrDocumentNotFound):
 			return &ActivatePatronOutput{}, huma.Error422UnprocessableEntity(errInvalidOrExpiredTokenMsg)
 		default:
+			return &ActivatePatronOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	if patron.Suspended {
+		return &ActivatePatronOutput{}, huma.Error422UnprocessableEntity(errInvalidOrExpiredTokenMsg)
+	}
+
+	// A patron who was created without a password, such as from a roster, sets it when activating.
+	switch {
+	case len(patron.Password.Hash) > 0 && input.Body.Password != "":
+		return &ActivatePatronOutput{}, huma.Error422UnprocessableEntity("validation failed", &huma.ErrorDetail{
+			Location: "body.password",
+			Message:  errPasswordAlreadySetMsg,
+		})
+	case len(patron.Password.Hash) == 0:
+		if input.Body.Password == "" {
+			return &ActivatePatronOutput{}, huma.Error422UnprocessableEntity("validation failed", &huma.ErrorDetail{
+				Location: "body.password",
+				Message:  errPasswordRequiredMsg,
+			})
+		}
+		if err = app.checkPassword(ctx, input.Body.Password, "body.password"); err != nil {
 			return &ActivatePatronOutput{}, err
 		}
+		if err = patron.Password.Set(input.Body.Password); err != nil {
+			return &ActivatePatronOutput{}, app.serverError(ctx, err)
+		}
 	}
 
 	patron.Activated = true
-	err = app.Models.Patrons.Update(ctx, data.PatronFilter{ID: &patron.ID}, patron)
+	err = app.Models.Patrons.Update(ctx, data.PatronFilter{ID: ptr(data.PatronID(patron.ID))}, patron)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrEditConflict):
 			return &ActivatePatronOutput{}, huma.Error409Conflict(errConflictMsg)
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return &ActivatePatronOutput{}, huma.Error404NotFound(errNotFoundMsg)
 		default:
-			return &ActivatePatronOutput{}, err
+			return &ActivatePatronOutput{}, app.serverError(ctx, err)
 		}
 	}
 
 	err = app.Models.Tokens.DeleteAllForPatron(ctx, data.TokenFilter{PatronID: &patronID, Scope: ptr(data.ScopeActivation)})
 	if err != nil {
-		return &ActivatePatronOutput{}, err
+		return &ActivatePatronOutput{}, app.serverError(ctx, err)
 	}
 
 	resp := &ActivatePatronOutput{
@@ -374,3 +850,67 @@ func (app *Application) activatePatronHandler(ctx context.Context, input *Activa
 
 	return resp, nil
 }
+
+// resendActivationHandler handles a request to send a new activation token to a patron whose
+// activation email was lost or whose token expired. The former tokens of the patron are deleted, so
+// only the new token activates them. The response is the same whether or not the email belongs to
+// a patron who is not activated, so that it does not reveal who is registered. A token is resent at
+// most once in every activation resend interval for each patron, and requests within the interval
+// get the same response without sending one, so that they do not reveal it either.
+func (app *Application) resendActivationHandler(ctx context.Context, input *ResendActivationInput) (*ResendActivationOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	resp := &ResendActivationOutput{
+		Body: "if the email belongs to a patron who is not activated yet, a new activation token was sent to it",
+	}
+
+	patron, err := app.Models.Patrons.Get(ctx, data.PatronFilter{Email: &input.Body.Email})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return resp, nil
+		default:
+			return &ResendActivationOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	if patron.Activated || patron.Guest || patron.Suspended {
+		return resp, nil
+	}
+
+	// The tokens of the patron expire activationTokenTTL after they are sent, so a token which expires
+	// later than that minus the interval was sent within the interval.
+	if interval := app.Config.Activation.ResendInterval; interval > 0 {
+		_, err = app.Models.Tokens.GetPatronID(ctx, data.TokenFilter{
+			PatronID:  &patron.ID,
+			Scope:     ptr(data.ScopeActivation),
+			MinExpiry: ptr(time.Now().Add(activationTokenTTL - interval)),
+		})
+		switch {
+		case err == nil:
+			return resp, nil
+		case !errors.Is(err, data.ErrDocumentNotFound):
+			return &ResendActivationOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	var token *data.Token
+	err = app.Models.Transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		err := app.Models.Tokens.DeleteAllForPatron(ctx, data.TokenFilter{PatronID: &patron.ID, Scope: ptr(data.ScopeActivation)})
+		if err != nil && !errors.Is(err, data.ErrDocumentNotFound) {
+			return err
+		}
+
+		token, err = app.Models.Tokens.New(ctx, patron.ID, activationTokenTTL, data.ScopeActivation)
+
+		return err
+	})
+	if err != nil {
+		return &ResendActivationOutput{}, app.transactionError(ctx, err)
+	}
+
+	app.sendActivationEmail(ctx, patron, token)
+
+	return resp, nil
+}
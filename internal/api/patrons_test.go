@@ -0,0 +1,349 @@
+package api_test
+
+import (
+	"context"
+	"errors"
+	"github.com/mzeevi/library/internal/api"
+	"github.com/mzeevi/library/internal/api/apitest"
+	"github.com/mzeevi/library/internal/auth"
+	"github.com/mzeevi/library/internal/data"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestPatronNotificationChannel(t *testing.T) {
+	a := apitest.New(t)
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+
+	tests := []struct {
+		name   string
+		patron map[string]string
+		want   int
+	}{
+		{name: "email by default", patron: map[string]string{}, want: http.StatusOK},
+		{name: "sms with a phone", patron: map[string]string{"phone": "+972501234567", "notification_channel": "sms"}, want: http.StatusOK},
+		{name: "sms without a phone", patron: map[string]string{"notification_channel": "sms"}, want: http.StatusUnprocessableEntity},
+		{name: "invalid phone", patron: map[string]string{"phone": "0501234567"}, want: http.StatusUnprocessableEntity},
+		{name: "unknown channel", patron: map[string]string{"notification_channel": "pigeon"}, want: http.StatusUnprocessableEntity},
+	}
+
+	for i, tt := range tests {
+		patron := map[string]string{"name": "Noa", "email": string(rune('a'+i)) + "@example.com", "password": "pa55word1234", "category": "student"}
+		for key, value := range tt.patron {
+			patron[key] = value
+		}
+
+		if rec := a.Do(http.MethodPost, "/patrons", admin, patron); rec.Code != tt.want {
+			t.Errorf("%s: POST /patrons status = %v; want %v (body: %s)", tt.name, rec.Code, tt.want, rec.Body.String())
+		}
+	}
+
+	patronID := a.SeedPatron(apitest.Patron("patron@example.com", auth.WritePatronPermission))
+	path := "/patrons/" + patronID
+
+	if rec := a.Do(http.MethodPut, path, admin, map[string]string{"notification_channel": "sms"}); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("PUT %s to sms without a phone status = %v; want %v (body: %s)", path, rec.Code, http.StatusUnprocessableEntity, rec.Body.String())
+	}
+
+	if rec := a.Do(http.MethodPut, path, admin, map[string]string{"notification_channel": "sms", "phone": "+972501234567"}); rec.Code != http.StatusOK {
+		t.Errorf("PUT %s to sms with a phone status = %v; want %v (body: %s)", path, rec.Code, http.StatusOK, rec.Body.String())
+	}
+}
+
+func TestPatronStats(t *testing.T) {
+	a := apitest.New(t)
+
+	bookID := a.SeedBook(apitest.Book("9781861972712", 2))
+	patronID := a.SeedPatron(apitest.Patron("patron@example.com", auth.ReadPatronPermission, auth.BorrowBookPermission, auth.ReturnBookPermission))
+	patron := a.PatronAuth(patronID)
+	otherID := a.SeedPatron(apitest.Patron("other@example.com", auth.ReadPatronPermission))
+
+	for range 2 {
+		borrow := map[string]any{"patron_id": patronID, "book_id": bookID, "due_date": time.Now().Add(14 * 24 * time.Hour), "copies": 1}
+		if rec := a.Do(http.MethodPost, "/transactions/borrow", patron, borrow); rec.Code != http.StatusOK {
+			t.Fatalf("borrow status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+		}
+		giveBack := map[string]any{"patron_id": patronID, "book_id": bookID, "copies": 1}
+		if rec := a.Do(http.MethodPost, "/transactions/return", patron, giveBack); rec.Code != http.StatusOK {
+			t.Fatalf("return status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+		}
+	}
+
+	path := "/patrons/" + patronID + "/stats"
+
+	var stats data.PatronStats
+	a.Decode(a.Do(http.MethodGet, path, patron), &stats)
+	if stats.TotalBorrows != 2 || stats.OnTimeReturnRate != 1 || stats.OnTimeStreak != 2 || stats.BorrowingStreakWeeks != 1 {
+		t.Errorf("GET %s = %+v; want two loans returned on time this week", path, stats)
+	}
+	if len(stats.FavoriteGenres) != 1 || stats.FavoriteGenres[0] != "Fiction" {
+		t.Errorf("GET %s favorite genres = %v; want [Fiction]", path, stats.FavoriteGenres)
+	}
+
+	yesterday := time.Now().UTC().AddDate(0, 0, -1).Format(time.DateOnly)
+	a.Decode(a.Do(http.MethodGet, path+"?as_of="+yesterday, patron), &stats)
+	if stats.TotalBorrows != 0 || stats.BorrowingStreakWeeks != 0 {
+		t.Errorf("GET %s as of %s = %+v; want no loans", path, yesterday, stats)
+	}
+
+	if rec := a.Do(http.MethodGet, path, a.PatronAuth(otherID)); rec.Code != http.StatusForbidden {
+		t.Errorf("GET %s as another patron status = %v; want %v", path, rec.Code, http.StatusForbidden)
+	}
+}
+
+func TestUpdatePatronPassword(t *testing.T) {
+	a := apitest.New(t)
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+
+	patron := apitest.Patron("patron@example.com", auth.ReadPatronPermission)
+	if err := patron.Password.Set("pa55word1234"); err != nil {
+		t.Fatalf("failed to set password: %v", err)
+	}
+	patronID := a.SeedPatron(patron)
+	path := "/patrons/" + patronID
+
+	session := a.PatronAuth(patronID)
+	if rec := a.Do(http.MethodGet, path, session); rec.Code != http.StatusOK {
+		t.Fatalf("GET %s status = %v; want %v (body: %s)", path, rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	// The session must be issued strictly before the password changes.
+	time.Sleep(10 * time.Millisecond)
+
+	if rec := a.Do(http.MethodPut, path, admin, map[string]string{"password": "n3w-pa55word"}); rec.Code != http.StatusOK {
+		t.Fatalf("PUT %s status = %v; want %v (body: %s)", path, rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	if rec := a.Do(http.MethodGet, path, session); rec.Code != http.StatusUnauthorized {
+		t.Errorf("GET %s with a session from before the change status = %v; want %v", path, rec.Code, http.StatusUnauthorized)
+	}
+
+	login := map[string]string{"email": "patron@example.com", "password": "pa55word1234"}
+	if rec := a.Do(http.MethodPost, "/token/authentication", login); rec.Code != http.StatusUnauthorized {
+		t.Errorf("POST /token/authentication with the old password status = %v; want %v", rec.Code, http.StatusUnauthorized)
+	}
+
+	login["password"] = "n3w-pa55word"
+	rec := a.Do(http.MethodPost, "/token/authentication", login)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /token/authentication with the new password status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	var token struct {
+		AuthToken string `json:"auth_token"`
+	}
+	a.Decode(rec, &token)
+	if rec := a.Do(http.MethodGet, path, "Authorization: Bearer "+token.AuthToken); rec.Code != http.StatusOK {
+		t.Errorf("GET %s with a new session status = %v; want %v (body: %s)", path, rec.Code, http.StatusOK, rec.Body.String())
+	}
+}
+
+func TestUpdatePatronOwnership(t *testing.T) {
+	a := apitest.New(t)
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+
+	patronID := a.SeedPatron(apitest.Patron("patron@example.com", auth.ReadPatronPermission, auth.WritePatronPermission))
+	patron := a.PatronAuth(patronID)
+	otherID := a.SeedPatron(apitest.Patron("other@example.com", auth.ReadPatronPermission, auth.WritePatronPermission))
+	path := "/patrons/" + patronID
+	otherPath := "/patrons/" + otherID
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		auth   string
+		body   any
+		want   int
+	}{
+		{name: "update other patron", method: http.MethodPut, path: otherPath, auth: patron, body: map[string]string{"name": "Noa"}, want: http.StatusForbidden},
+		{name: "patch other patron", method: http.MethodPatch, path: otherPath, auth: patron, body: map[string]string{"name": "Noa"}, want: http.StatusForbidden},
+		{name: "delete other patron", method: http.MethodDelete, path: otherPath, auth: patron, want: http.StatusForbidden},
+		{name: "update own name", method: http.MethodPut, path: path, auth: patron, body: map[string]string{"name": "Noa"}, want: http.StatusOK},
+		{name: "update own password", method: http.MethodPut, path: path, auth: patron, body: map[string]string{"password": "n3w-pa55word"}, want: http.StatusForbidden},
+		{name: "update own category", method: http.MethodPatch, path: path, auth: patron, body: map[string]string{"category": data.StudentCategory}, want: http.StatusForbidden},
+		{name: "update own external ids", method: http.MethodPatch, path: path, auth: patron, body: map[string]any{"external_ids": map[string]string{"sis": "1234"}}, want: http.StatusForbidden},
+		{name: "admin updates category", method: http.MethodPatch, path: otherPath, auth: admin, body: map[string]string{"category": data.StudentCategory}, want: http.StatusOK},
+		{name: "admin deletes patron", method: http.MethodDelete, path: otherPath, auth: admin, want: http.StatusOK},
+		{name: "delete own patron", method: http.MethodDelete, path: path, auth: patron, want: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := []any{tt.auth}
+			if tt.body != nil {
+				args = append(args, tt.body)
+			}
+
+			if rec := a.Do(tt.method, tt.path, args...); rec.Code != tt.want {
+				t.Errorf("%s %s status = %v; want %v (body: %s)", tt.method, tt.path, rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestUpdateOwnPassword(t *testing.T) {
+	a := apitest.New(t)
+
+	patron := apitest.Patron("patron@example.com", auth.ReadPatronPermission, auth.WritePatronPermission)
+	if err := patron.Password.Set("pa55word1234"); err != nil {
+		t.Fatalf("failed to set password: %v", err)
+	}
+	patronID := a.SeedPatron(patron)
+	session := a.PatronAuth(patronID)
+	path := "/patrons/me/password"
+
+	tests := []struct {
+		name            string
+		currentPassword string
+		password        string
+		want            int
+	}{
+		{name: "wrong current password", currentPassword: "wr0ng-pa55word", password: "n3w-pa55word", want: http.StatusUnauthorized},
+		{name: "new password too short", currentPassword: "pa55word1234", password: "short", want: http.StatusUnprocessableEntity},
+		{name: "right current password", currentPassword: "pa55word1234", password: "n3w-pa55word", want: http.StatusOK},
+	}
+
+	// The session must be issued strictly before the password changes.
+	time.Sleep(10 * time.Millisecond)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := map[string]string{"current_password": tt.currentPassword, "password": tt.password}
+			if rec := a.Do(http.MethodPut, path, session, body); rec.Code != tt.want {
+				t.Errorf("PUT %s status = %v; want %v (body: %s)", path, rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+
+	if rec := a.Do(http.MethodGet, "/patrons/"+patronID, session); rec.Code != http.StatusUnauthorized {
+		t.Errorf("GET /patrons/%s with a session from before the change status = %v; want %v", patronID, rec.Code, http.StatusUnauthorized)
+	}
+
+	login := map[string]string{"email": "patron@example.com", "password": "n3w-pa55word"}
+	if rec := a.Do(http.MethodPost, "/token/authentication", login); rec.Code != http.StatusOK {
+		t.Errorf("POST /token/authentication with the new password status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	a.SeedAdmin("admin", "admin-password")
+	body := map[string]string{"current_password": "n3w-pa55word", "password": "an0ther-pa55word"}
+	if rec := a.Do(http.MethodPut, path, apitest.AdminAuth("admin", "admin-password"), body); rec.Code != http.StatusForbidden {
+		t.Errorf("PUT %s as an admin status = %v; want %v (body: %s)", path, rec.Code, http.StatusForbidden, rec.Body.String())
+	}
+}
+
+func TestResendActivation(t *testing.T) {
+	a := apitest.New(t, func(app *api.Application) {
+		app.Config.Activation.ResendInterval = time.Minute
+	})
+
+	patron := apitest.Patron("patron@example.com")
+	patron.Activated = false
+	patronID := a.SeedPatron(patron)
+
+	lost, err := a.Models.Tokens.New(context.Background(), patronID, time.Hour, data.ScopeActivation)
+	if err != nil {
+		t.Fatalf("failed to create token: %v", err)
+	}
+
+	path := "/patrons/activation/resend"
+	for _, email := range []string{"patron@example.com", "nobody@example.com"} {
+		if rec := a.Do(http.MethodPost, path, map[string]string{"email": email}); rec.Code != http.StatusOK {
+			t.Errorf("POST %s for %s status = %v; want %v (body: %s)", path, email, rec.Code, http.StatusOK, rec.Body.String())
+		}
+	}
+
+	if rec := a.Do(http.MethodPut, "/patrons/activated", map[string]string{"token": lost.Plaintext}); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("PUT /patrons/activated with a replaced token status = %v; want %v", rec.Code, http.StatusUnprocessableEntity)
+	}
+
+	if _, err = a.Models.Tokens.GetPatronID(context.Background(), data.TokenFilter{PatronID: &patronID, Scope: apitest.Ptr(data.ScopeActivation)}); err != nil {
+		t.Errorf("no activation token was issued: %v", err)
+	}
+
+	// A resend within the interval gets the same response, but does not replace the tokens of the
+	// patron, so a token which was issued since still activates them.
+	kept, err := a.Models.Tokens.New(context.Background(), patronID, time.Hour, data.ScopeActivation)
+	if err != nil {
+		t.Fatalf("failed to create token: %v", err)
+	}
+	if rec := a.Do(http.MethodPost, path, map[string]string{"email": "patron@example.com"}); rec.Code != http.StatusOK {
+		t.Errorf("POST %s again within the interval status = %v; want %v (body: %s)", path, rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if rec := a.Do(http.MethodPut, "/patrons/activated", map[string]string{"token": kept.Plaintext, "password": "pa55word1234"}); rec.Code != http.StatusOK {
+		t.Errorf("PUT /patrons/activated with a token issued before a throttled resend status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+}
+
+func TestMergePatrons(t *testing.T) {
+	a := apitest.New(t)
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+
+	bookID := a.SeedBook(apitest.Book("9780306406157", 3))
+	targetID := a.SeedPatron(apitest.Patron("target@example.com"))
+	duplicate := apitest.Patron("duplicate@example.com")
+	duplicate.Activated = false
+	sourceID := a.SeedPatron(duplicate)
+
+	for range 2 {
+		transaction := data.NewTransaction("", sourceID, bookID, data.TransactionStatusBorrowed, time.Now(), time.Now().Add(14*24*time.Hour))
+		if _, err := a.Models.Transactions.Insert(context.Background(), transaction); err != nil {
+			t.Fatalf("failed to seed transaction: %v", err)
+		}
+	}
+	activation, err := a.Models.Tokens.New(context.Background(), sourceID, time.Hour, data.ScopeActivation)
+	if err != nil {
+		t.Fatalf("failed to create token: %v", err)
+	}
+
+	missingID := "000000000000000000000000"
+	tests := []struct {
+		name     string
+		sourceID string
+		targetID string
+		want     int
+	}{
+		{name: "missing target", sourceID: sourceID, targetID: missingID, want: http.StatusNotFound},
+		{name: "missing source", sourceID: missingID, targetID: targetID, want: http.StatusNotFound},
+		{name: "same patron", sourceID: sourceID, targetID: sourceID, want: http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		rec := a.Do(http.MethodPost, "/patrons/merge", admin, map[string]string{"source_id": tt.sourceID, "target_id": tt.targetID})
+		if rec.Code != tt.want {
+			t.Errorf("merge %s status = %v; want %v (body: %s)", tt.name, rec.Code, tt.want, rec.Body.String())
+		}
+	}
+
+	rec := a.Do(http.MethodPost, "/patrons/merge", admin, map[string]string{"source_id": sourceID, "target_id": targetID})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("merge status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var merged api.MergedPatronInfo
+	a.Decode(rec, &merged)
+	if merged.Patron.ID != targetID || merged.Transactions != 2 {
+		t.Errorf("merge = %+v; want 2 transactions reassigned to %s", merged, targetID)
+	}
+
+	transactions, _, err := a.Models.Transactions.GetAll(context.Background(), data.TransactionFilter{PatronID: apitest.Ptr(data.PatronID(targetID))}, data.Paginator{}, data.Sorter{})
+	if err != nil || len(transactions) != 2 {
+		t.Errorf("transactions of the target = %d, %v; want 2", len(transactions), err)
+	}
+
+	if _, err = a.Models.Patrons.Get(context.Background(), data.PatronFilter{ID: apitest.Ptr(data.PatronID(sourceID))}); !errors.Is(err, data.ErrDocumentNotFound) {
+		t.Errorf("source patron after merge error = %v; want %v", err, data.ErrDocumentNotFound)
+	}
+	for _, patronID := range []string{sourceID, targetID} {
+		if _, err = a.Models.Tokens.GetPatronID(context.Background(), data.TokenFilter{PatronID: &patronID}); !errors.Is(err, data.ErrDocumentNotFound) {
+			t.Errorf("tokens of %s after merge error = %v; want %v", patronID, err, data.ErrDocumentNotFound)
+		}
+	}
+	if rec := a.Do(http.MethodPut, "/patrons/activated", map[string]string{"token": activation.Plaintext, "password": "pa55word1234"}); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("PUT /patrons/activated with a token of the source status = %v; want %v", rec.Code, http.StatusUnprocessableEntity)
+	}
+}
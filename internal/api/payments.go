@@ -0,0 +1,532 @@
+package api
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/mzeevi/library/internal/data"
+	"github.com/mzeevi/library/internal/payments"
+	"github.com/mzeevi/library/internal/timezone"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	errPaymentsDisabledMsg        = "fines cannot be paid online because no payment provider is configured"
+	errPaymentPatronOnlyMsg       = "only patrons can pay their fines"
+	errNoOutstandingFinesMsg      = "there are no outstanding fines to pay"
+	errInvalidWebhookSignatureMsg = "the webhook request is not signed by the payment provider"
+	errUnknownPaymentSessionMsg   = "the checkout session is not a payment of this library"
+	errFineNotOutstandingMsg      = "the fine of transaction %s is not outstanding"
+	errPaymentAmountMismatchMsg   = "the amount of %.2f does not match the fines of %.2f"
+	errInvalidReportDateMsg       = "Date must be formatted as YYYY-MM-DD"
+	paymentRecordedMsg            = "payment recorded"
+	paymentEventIgnoredMsg        = "event ignored"
+)
+
+// minSessionLifetime is how long a pending checkout session must still be payable to be reused.
+const minSessionLifetime = time.Minute
+
+type CheckoutFinesOutput struct {
+	Body FinesCheckout
+}
+
+// FinesCheckout is a checkout session in which a patron pays their outstanding fines, at URL.
+type FinesCheckout struct {
+	PaymentID string    `json:"payment_id"`
+	URL       string    `json:"url"`
+	Amount    float64   `json:"amount"`
+	Currency  string    `json:"currency"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Fines     []Fine    `json:"fines"`
+}
+
+type PaymentWebhookInput struct {
+	RawBody []byte
+	header  http.Header
+}
+
+type PaymentWebhookOutput struct {
+	Body string `json:"message"`
+}
+
+type RecordPaymentInput struct {
+	Body struct {
+		PatronID       string   `json:"patron_id" doc:"ID of the Patron who pays"`
+		TransactionIDs []string `json:"transaction_ids,omitempty" required:"false" doc:"IDs of the Transactions whose fines are paid. All outstanding fines of the patron by default"`
+		Method         string   `json:"method" enum:"cash,check" doc:"How the payment was taken at the desk"`
+		Amount         float64  `json:"amount" exclusiveMinimum:"0" doc:"The amount received, which must be the sum of the fines"`
+		Reference      string   `json:"reference,omitempty" required:"false" maxLength:"100" doc:"Reference of the payment, such as the number of the check or of the receipt"`
+		Note           string   `json:"note,omitempty" required:"false" maxLength:"500"`
+	}
+}
+
+type PaymentOutput struct {
+	Body data.Payment
+}
+
+type GetCashReportInput struct {
+	Date       string `query:"date" doc:"Day of the report, formatted as YYYY-MM-DD in the timezone of the library. Today by default"`
+	Method     string `query:"method" enum:"cash,check" doc:"Filter by payment method"`
+	AcceptedBy string `query:"accepted_by" doc:"Filter by the name of the admin who accepted the payments"`
+}
+
+type GetCashReportOutput struct {
+	Body CashReport
+}
+
+// CashReport sums up the payments taken at the desk on a day, in total and per admin who
+// accepted them, so that the cash drawer can be reconciled.
+type CashReport struct {
+	Date     string         `json:"date"`
+	Currency string         `json:"currency"`
+	Count    int            `json:"count"`
+	Total    float64        `json:"total"`
+	Cashiers []CashierTotal `json:"cashiers"`
+	Payments []data.Payment `json:"payments"`
+}
+
+// CashierTotal sums up the payments which an admin accepted.
+type CashierTotal struct {
+	AcceptedBy string  `json:"accepted_by"`
+	Count      int     `json:"count"`
+	Total      float64 `json:"total"`
+}
+
+// Resolve validates the input in RecordPaymentInput.
+func (p *RecordPaymentInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	err := validateID(&p.Body.PatronID, "body.patron_id")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	for i := range p.Body.TransactionIDs {
+		err = validateID(&p.Body.TransactionIDs[i], fmt.Sprintf("body.transaction_ids[%d]", i))
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	p.Body.Reference = strings.TrimSpace(p.Body.Reference)
+	p.Body.Note = strings.TrimSpace(p.Body.Note)
+
+	return errs
+}
+
+// Resolve validates the input in GetCashReportInput.
+func (c *GetCashReportInput) Resolve(ctx huma.Context) []error {
+	if c.Date == "" {
+		return nil
+	}
+
+	if _, err := time.Parse(time.DateOnly, c.Date); err != nil {
+		return []error{&huma.ErrorDetail{
+			Location: "query.date",
+			Message:  errInvalidReportDateMsg,
+			Value:    c.Date,
+		}}
+	}
+
+	return nil
+}
+
+// Resolve collects the headers of the webhook request, which the payment provider verifies.
+func (p *PaymentWebhookInput) Resolve(ctx huma.Context) []error {
+	p.header = http.Header{}
+	ctx.EachHeader(func(name, value string) {
+		p.header.Add(name, value)
+	})
+
+	return nil
+}
+
+// outstandingFines returns the fines of the returned transactions of a patron which were not paid
+// yet. Fines of borrowed books are not outstanding, since they grow until the book is returned.
+func (app *Application) outstandingFines(ctx context.Context, patronID string, now time.Time) ([]Fine, error) {
+	transactions, _, err := app.Models.Transactions.GetAll(ctx, data.TransactionFilter{PatronID: ptr(data.PatronID(patronID)), Status: ptr(data.TransactionStatusReturned)}, data.Paginator{}, data.Sorter{})
+	if err != nil {
+		return nil, err
+	}
+
+	var fines []Fine
+	for _, transaction := range transactions {
+		fine := app.transactionFine(&transaction, now)
+		if fine.Amount > 0 && !fine.Paid {
+			fines = append(fines, fine)
+		}
+	}
+
+	return fines, nil
+}
+
+// finesCheckout returns the checkout of a payment, with the fines it pays.
+func finesCheckout(payment *data.Payment, fines []Fine) FinesCheckout {
+	return FinesCheckout{
+		PaymentID: payment.ID,
+		URL:       payment.URL,
+		Amount:    payment.Amount,
+		Currency:  payment.Currency,
+		ExpiresAt: payment.ExpiresAt,
+		Fines:     fines,
+	}
+}
+
+// checkoutFinesHandler handles a request of a patron to pay their outstanding fines online. It
+// creates a checkout session with the payment provider, or returns the pending session of the same
+// fines if it has not expired, so that the fines are not paid twice.
+func (app *Application) checkoutFinesHandler(ctx context.Context, _ *struct{}) (*CheckoutFinesOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	if app.payments == nil {
+		return &CheckoutFinesOutput{}, huma.Error422UnprocessableEntity(errPaymentsDisabledMsg)
+	}
+
+	patron, ok := patronFromContext(ctx)
+	if !ok {
+		return &CheckoutFinesOutput{}, huma.Error403Forbidden(errPaymentPatronOnlyMsg)
+	}
+
+	now := time.Now()
+	fines, err := app.outstandingFines(ctx, patron.ID, now)
+	if err != nil {
+		return &CheckoutFinesOutput{}, app.serverError(ctx, err)
+	}
+	if len(fines) == 0 {
+		return &CheckoutFinesOutput{}, huma.Error422UnprocessableEntity(errNoOutstandingFinesMsg)
+	}
+
+	var amount float64
+	paymentFines := make([]data.PaymentFine, 0, len(fines))
+	for _, fine := range fines {
+		amount += fine.Amount
+		paymentFines = append(paymentFines, data.PaymentFine{TransactionID: fine.TransactionID, Amount: fine.Amount})
+	}
+
+	pending, err := app.Models.Payments.Get(ctx, data.PaymentFilter{
+		PatronID:     &patron.ID,
+		Status:       ptr(data.PaymentStatusPending),
+		MinExpiresAt: ptr(now.Add(minSessionLifetime)),
+	})
+	switch {
+	case err == nil && slices.Equal(pending.Fines, paymentFines):
+		return &CheckoutFinesOutput{Body: finesCheckout(pending, fines)}, nil
+	case err != nil && !errors.Is(err, data.ErrDocumentNotFound):
+		return &CheckoutFinesOutput{}, app.serverError(ctx, err)
+	}
+
+	items := make([]payments.Item, 0, len(fines))
+	for _, fine := range fines {
+		description := "Overdue fine"
+		if book, err := app.Models.Books.Get(ctx, data.BookFilter{ID: ptr(data.BookID(fine.BookID))}); err == nil {
+			description = fmt.Sprintf("Overdue fine for %s", book.Title)
+		}
+		items = append(items, payments.Item{Reference: fine.TransactionID, Description: description, Amount: fine.Amount})
+	}
+
+	session, err := app.payments.CreateCheckout(ctx, payments.Checkout{
+		Reference:  patron.ID,
+		Email:      patron.Email,
+		Currency:   app.Config.Payments.Currency,
+		Items:      items,
+		SuccessURL: app.Config.Payments.SuccessURL,
+		CancelURL:  app.Config.Payments.CancelURL,
+	})
+	if err != nil {
+		return &CheckoutFinesOutput{}, app.serverError(ctx, err)
+	}
+
+	payment := &data.Payment{
+		PatronID:  patron.ID,
+		Method:    data.PaymentMethodOnline,
+		Provider:  app.Config.Payments.Provider,
+		SessionID: session.ID,
+		URL:       session.URL,
+		Fines:     paymentFines,
+		Amount:    amount,
+		Currency:  app.Config.Payments.Currency,
+		Status:    data.PaymentStatusPending,
+		ExpiresAt: session.ExpiresAt,
+	}
+
+	payment.ID, err = app.Models.Payments.Insert(ctx, payment)
+	if err != nil {
+		return &CheckoutFinesOutput{}, app.serverError(ctx, err)
+	}
+
+	resp := &CheckoutFinesOutput{
+		Body: finesCheckout(payment, fines),
+	}
+
+	return resp, nil
+}
+
+// paymentWebhookHandler handles a notification of the payment provider about a checkout session.
+// When a session is paid, the payment is recorded on the fines it paid. Fines which were already
+// paid in another session are not recorded again. Notifications which are sent again are ignored.
+func (app *Application) paymentWebhookHandler(ctx context.Context, input *PaymentWebhookInput) (*PaymentWebhookOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	if app.payments == nil {
+		return &PaymentWebhookOutput{}, huma.Error404NotFound(errNotFoundMsg)
+	}
+
+	event, err := app.payments.ParseEvent(input.RawBody, input.header)
+	if err != nil {
+		switch {
+		case errors.Is(err, payments.ErrInvalidSignature):
+			return &PaymentWebhookOutput{}, huma.Error400BadRequest(errInvalidWebhookSignatureMsg)
+		default:
+			return &PaymentWebhookOutput{}, huma.Error400BadRequest(err.Error())
+		}
+	}
+
+	if !event.Paid {
+		return &PaymentWebhookOutput{Body: paymentEventIgnoredMsg}, nil
+	}
+
+	err = app.Models.Transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		payment, err := app.Models.Payments.Get(ctx, data.PaymentFilter{SessionID: &event.SessionID})
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrDocumentNotFound):
+				return huma.Error404NotFound(errUnknownPaymentSessionMsg)
+			default:
+				return err
+			}
+		}
+
+		if payment.Status == data.PaymentStatusPaid {
+			return nil
+		}
+
+		now := time.Now()
+		reference := cmp.Or(event.PaymentReference, event.SessionID)
+
+		for _, fine := range payment.Fines {
+			transaction, err := app.Models.Transactions.Get(ctx, data.TransactionFilter{ID: ptr(data.TransactionID(fine.TransactionID))})
+			if err != nil {
+				switch {
+				case errors.Is(err, data.ErrDocumentNotFound):
+					continue
+				default:
+					return err
+				}
+			}
+
+			if transaction.FinePayment != nil {
+				continue
+			}
+
+			transaction.FinePayment = &data.FinePayment{PaymentID: payment.ID, Reference: reference, Amount: fine.Amount, PaidAt: now}
+			if err = app.Models.Transactions.Update(ctx, data.TransactionFilter{ID: ptr(data.TransactionID(transaction.ID))}, transaction); err != nil {
+				return err
+			}
+		}
+
+		payment.Status = data.PaymentStatusPaid
+		payment.Reference = reference
+		payment.PaidAt = now
+
+		return app.Models.Payments.Update(ctx, data.PaymentFilter{ID: &payment.ID}, payment)
+	})
+	if err != nil {
+		return &PaymentWebhookOutput{}, app.transactionError(ctx, err)
+	}
+
+	resp := &PaymentWebhookOutput{
+		Body: paymentRecordedMsg,
+	}
+
+	return resp, nil
+}
+
+// roundAmount rounds an amount of money to cents, so that sums of fines can be compared.
+func roundAmount(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// recordPaymentHandler handles a request to record a payment of fines which was taken at the desk
+// by the authenticated admin. The paid fines must be outstanding, and the amount received must be
+// their sum.
+func (app *Application) recordPaymentHandler(ctx context.Context, input *RecordPaymentInput) (*PaymentOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	admin, ok := adminFromContext(ctx)
+	if !ok {
+		return &PaymentOutput{}, app.serverError(ctx, errors.New("no admin in the context of an admin request"))
+	}
+
+	var payment *data.Payment
+
+	err := app.Models.Transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		_, err := app.Models.Patrons.Get(ctx, data.PatronFilter{ID: ptr(data.PatronID(input.Body.PatronID))})
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrDocumentNotFound):
+				return huma.Error404NotFound(errNotFoundMsg)
+			default:
+				return err
+			}
+		}
+
+		now := time.Now()
+		fines, err := app.outstandingFines(ctx, input.Body.PatronID, now)
+		if err != nil {
+			return err
+		}
+
+		if len(input.Body.TransactionIDs) > 0 {
+			var selected []Fine
+			for _, id := range input.Body.TransactionIDs {
+				i := slices.IndexFunc(fines, func(fine Fine) bool { return fine.TransactionID == id })
+				if i < 0 {
+					return huma.Error422UnprocessableEntity(fmt.Sprintf(errFineNotOutstandingMsg, id))
+				}
+				if !slices.ContainsFunc(selected, func(fine Fine) bool { return fine.TransactionID == id }) {
+					selected = append(selected, fines[i])
+				}
+			}
+			fines = selected
+		}
+
+		if len(fines) == 0 {
+			return huma.Error422UnprocessableEntity(errNoOutstandingFinesMsg)
+		}
+
+		var amount float64
+		paymentFines := make([]data.PaymentFine, 0, len(fines))
+		for _, fine := range fines {
+			amount += fine.Amount
+			paymentFines = append(paymentFines, data.PaymentFine{TransactionID: fine.TransactionID, Amount: fine.Amount})
+		}
+
+		if roundAmount(amount) != roundAmount(input.Body.Amount) {
+			return huma.Error422UnprocessableEntity(fmt.Sprintf(errPaymentAmountMismatchMsg, input.Body.Amount, amount))
+		}
+
+		payment = &data.Payment{
+			PatronID:   input.Body.PatronID,
+			Method:     input.Body.Method,
+			Fines:      paymentFines,
+			Amount:     roundAmount(amount),
+			Currency:   app.Config.Payments.Currency,
+			Status:     data.PaymentStatusPaid,
+			Reference:  input.Body.Reference,
+			AcceptedBy: admin.Name,
+			Note:       input.Body.Note,
+			PaidAt:     now,
+		}
+
+		payment.ID, err = app.Models.Payments.Insert(ctx, payment)
+		if err != nil {
+			return err
+		}
+
+		for _, fine := range paymentFines {
+			transaction, err := app.Models.Transactions.Get(ctx, data.TransactionFilter{ID: ptr(data.TransactionID(fine.TransactionID))})
+			if err != nil {
+				return err
+			}
+
+			transaction.FinePayment = &data.FinePayment{PaymentID: payment.ID, Reference: payment.Reference, Amount: fine.Amount, PaidAt: now}
+			if err = app.Models.Transactions.Update(ctx, data.TransactionFilter{ID: ptr(data.TransactionID(transaction.ID))}, transaction); err != nil {
+				switch {
+				case errors.Is(err, data.ErrEditConflict):
+					return huma.Error409Conflict(errConflictMsg)
+				case errors.Is(err, data.ErrDocumentNotFound):
+					return huma.Error404NotFound(errNotFoundMsg)
+				default:
+					return err
+				}
+			}
+		}
+
+		return app.audit(ctx, data.AuditPaymentRecorded, payment.ID, payment.Method, payment.Note, map[string]any{
+			"patron_id":       payment.PatronID,
+			"amount":          payment.Amount,
+			"transaction_ids": input.Body.TransactionIDs,
+		})
+	})
+	if err != nil {
+		return &PaymentOutput{}, app.transactionError(ctx, err)
+	}
+
+	resp := &PaymentOutput{
+		Body: *payment,
+	}
+
+	return resp, nil
+}
+
+// getCashReportHandler handles a request to sum up the payments taken at the desk on a day.
+func (app *Application) getCashReportHandler(ctx context.Context, input *GetCashReportInput) (*GetCashReportOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	day := timezone.StartOfDay(time.Now(), app.location)
+	if input.Date != "" {
+		date, err := time.ParseInLocation(time.DateOnly, input.Date, app.location)
+		if err != nil {
+			return &GetCashReportOutput{}, huma.Error422UnprocessableEntity(errInvalidReportDateMsg)
+		}
+		day = date
+	}
+
+	filter := data.PaymentFilter{
+		Status:    ptr(data.PaymentStatusPaid),
+		Methods:   []string{data.PaymentMethodCash, data.PaymentMethodCheck},
+		MinPaidAt: &day,
+		MaxPaidAt: ptr(day.AddDate(0, 0, 1)),
+	}
+	if input.Method != "" {
+		filter.Methods = []string{input.Method}
+	}
+	if input.AcceptedBy != "" {
+		filter.AcceptedBy = &input.AcceptedBy
+	}
+
+	paid, _, err := app.Models.Payments.GetAll(ctx, filter, data.Paginator{}, data.Sorter{Field: "paid_at", SortSafelist: supportedCashReportSortFields})
+	if err != nil {
+		return &GetCashReportOutput{}, app.serverError(ctx, err)
+	}
+
+	report := CashReport{
+		Date:     day.Format(time.DateOnly),
+		Currency: app.Config.Payments.Currency,
+		Cashiers: make([]CashierTotal, 0),
+		Payments: paid,
+	}
+
+	for _, payment := range paid {
+		report.Count++
+		report.Total = roundAmount(report.Total + payment.Amount)
+
+		i := slices.IndexFunc(report.Cashiers, func(c CashierTotal) bool { return c.AcceptedBy == payment.AcceptedBy })
+		if i < 0 {
+			report.Cashiers = append(report.Cashiers, CashierTotal{AcceptedBy: payment.AcceptedBy})
+			i = len(report.Cashiers) - 1
+		}
+		report.Cashiers[i].Count++
+		report.Cashiers[i].Total = roundAmount(report.Cashiers[i].Total + payment.Amount)
+	}
+
+	slices.SortFunc(report.Cashiers, func(a, b CashierTotal) int {
+		return cmp.Compare(a.AcceptedBy, b.AcceptedBy)
+	})
+
+	resp := &GetCashReportOutput{
+		Body: report,
+	}
+
+	return resp, nil
+}
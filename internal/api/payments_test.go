@@ -0,0 +1,237 @@
+package api_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/mzeevi/library/internal/api"
+	"github.com/mzeevi/library/internal/api/apitest"
+	"github.com/mzeevi/library/internal/auth"
+	"github.com/mzeevi/library/internal/data"
+	"github.com/mzeevi/library/internal/payments"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPayFines(t *testing.T) {
+	a := apitest.New(t, func(app *api.Application) {
+		app.Config.Cost.OverdueFine = 2
+		app.Config.Payments.Provider = payments.Mock
+		app.Config.Payments.Currency = "usd"
+		app.Config.Payments.WebhookSecret = "webhook-secret"
+		app.Config.Payments.SuccessURL = "https://library.example.com/fines/paid"
+		app.Config.Payments.CancelURL = "https://library.example.com/fines"
+	})
+	a.SeedAdmin("admin", "admin-password")
+
+	bookID := a.SeedBook(apitest.Book("9780306406157", 3))
+	patronID := a.SeedPatron(apitest.Patron("patron@example.com", auth.ReadPatronPermission))
+	patron := a.PatronAuth(patronID)
+
+	now := time.Now()
+	late := data.NewTransaction("", patronID, bookID, data.TransactionStatusReturned, now.Add(-20*24*time.Hour), now.Add(-6*24*time.Hour))
+	late.ReturnedAt = now.Add(-2 * 24 * time.Hour)
+	onTime := data.NewTransaction("", patronID, bookID, data.TransactionStatusReturned, now.Add(-20*24*time.Hour), now.Add(-6*24*time.Hour))
+	onTime.ReturnedAt = now.Add(-7 * 24 * time.Hour)
+	overdue := data.NewTransaction("", patronID, bookID, data.TransactionStatusBorrowed, now.Add(-20*24*time.Hour), now.Add(-3*24*time.Hour))
+
+	var lateID string
+	for _, transaction := range []*data.Transaction{late, onTime, overdue} {
+		id, err := a.Models.Transactions.Insert(context.Background(), transaction)
+		if err != nil {
+			t.Fatalf("failed to seed transaction: %v", err)
+		}
+		if transaction == late {
+			lateID = id
+		}
+	}
+
+	if rec := a.Do(http.MethodPost, "/patrons/me/fines/checkout", apitest.AdminAuth("admin", "admin-password")); rec.Code != http.StatusForbidden {
+		t.Errorf("checkout by admin status = %v; want %v", rec.Code, http.StatusForbidden)
+	}
+
+	rec := a.Do(http.MethodPost, "/patrons/me/fines/checkout", patron)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("checkout status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var checkout api.FinesCheckout
+	a.Decode(rec, &checkout)
+	if checkout.Amount != 8 || checkout.Currency != "usd" || len(checkout.Fines) != 1 || checkout.Fines[0].TransactionID != lateID {
+		t.Errorf("checkout = %+v; want the fine of 8 of the late return", checkout)
+	}
+	if !strings.HasPrefix(checkout.URL, "https://library.example.com/fines/paid?session_id=mock_") {
+		t.Errorf("checkout url = %s; want the mock session", checkout.URL)
+	}
+
+	rec = a.Do(http.MethodPost, "/patrons/me/fines/checkout", patron)
+	var again api.FinesCheckout
+	a.Decode(rec, &again)
+	if again.PaymentID != checkout.PaymentID || again.URL != checkout.URL {
+		t.Errorf("checkout again = %+v; want the pending payment %s", again, checkout.PaymentID)
+	}
+
+	sessionID := strings.TrimPrefix(checkout.URL, "https://library.example.com/fines/paid?session_id=")
+	payload, err := json.Marshal(payments.MockEvent{SessionID: sessionID, Reference: patronID, PaymentReference: "mock-payment-1", Paid: true})
+	if err != nil {
+		t.Fatalf("failed to encode event: %v", err)
+	}
+	mac := hmac.New(sha256.New, []byte("webhook-secret"))
+	mac.Write(payload)
+	signature := payments.SignatureHeader + ": sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	if rec := a.Do(http.MethodPost, "/payments/webhook", payments.SignatureHeader+": sha256=00", json.RawMessage(payload)); rec.Code != http.StatusBadRequest {
+		t.Errorf("webhook with a wrong signature status = %v; want %v", rec.Code, http.StatusBadRequest)
+	}
+
+	for i := 0; i < 2; i++ {
+		if rec := a.Do(http.MethodPost, "/payments/webhook", signature, json.RawMessage(payload)); rec.Code != http.StatusOK {
+			t.Fatalf("webhook %d status = %v; want %v (body: %s)", i, rec.Code, http.StatusOK, rec.Body.String())
+		}
+	}
+
+	transaction, err := a.Models.Transactions.Get(context.Background(), data.TransactionFilter{ID: apitest.Ptr(data.TransactionID(lateID))})
+	if err != nil {
+		t.Fatalf("Transactions.Get() error = %v", err)
+	}
+	if p := transaction.FinePayment; p == nil || p.PaymentID != checkout.PaymentID || p.Reference != "mock-payment-1" || p.Amount != 8 {
+		t.Errorf("FinePayment = %+v; want the payment %s of 8 by mock-payment-1", p, checkout.PaymentID)
+	}
+
+	if rec := a.Do(http.MethodPost, "/patrons/me/fines/checkout", patron); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("checkout without outstanding fines status = %v; want %v", rec.Code, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestRecordPayment(t *testing.T) {
+	a := apitest.New(t, func(app *api.Application) {
+		app.Config.Cost.OverdueFine = 2
+		app.Config.Payments.Currency = "usd"
+	})
+	a.SeedAdmin("desk", "desk-password")
+	a.SeedAdmin("counter", "counter-password")
+	desk := apitest.AdminAuth("desk", "desk-password")
+	counter := apitest.AdminAuth("counter", "counter-password")
+
+	bookID := a.SeedBook(apitest.Book("9780306406157", 3))
+	patronID := a.SeedPatron(apitest.Patron("patron@example.com"))
+
+	now := time.Now()
+	var ids []string
+	for _, returnedDaysAgo := range []int{2, 4, 7} {
+		transaction := data.NewTransaction("", patronID, bookID, data.TransactionStatusReturned, now.Add(-20*24*time.Hour), now.Add(-6*24*time.Hour))
+		transaction.ReturnedAt = now.Add(-time.Duration(returnedDaysAgo) * 24 * time.Hour)
+		id, err := a.Models.Transactions.Insert(context.Background(), transaction)
+		if err != nil {
+			t.Fatalf("failed to seed transaction: %v", err)
+		}
+		ids = append(ids, id)
+	}
+
+	tests := []struct {
+		name       string
+		auth       string
+		body       map[string]any
+		wantStatus int
+	}{
+		{
+			name:       "wrong amount",
+			auth:       desk,
+			body:       map[string]any{"patron_id": patronID, "method": "cash", "amount": 10},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "fine which is not outstanding",
+			auth:       desk,
+			body:       map[string]any{"patron_id": patronID, "transaction_ids": []string{ids[2]}, "method": "cash", "amount": 1},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "unknown method",
+			auth:       desk,
+			body:       map[string]any{"patron_id": patronID, "method": "card", "amount": 12},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "cash for one fine",
+			auth:       desk,
+			body:       map[string]any{"patron_id": patronID, "transaction_ids": []string{ids[0]}, "method": "cash", "amount": 8},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "fine which was paid",
+			auth:       counter,
+			body:       map[string]any{"patron_id": patronID, "transaction_ids": []string{ids[0]}, "method": "cash", "amount": 8},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "check for the rest",
+			auth:       counter,
+			body:       map[string]any{"patron_id": patronID, "method": "check", "amount": 4, "reference": "check 1021"},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "no outstanding fines",
+			auth:       counter,
+			body:       map[string]any{"patron_id": patronID, "method": "cash", "amount": 1},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := a.Do(http.MethodPost, "/payments", tt.auth, tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %v; want %v (body: %s)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+		})
+	}
+
+	transaction, err := a.Models.Transactions.Get(context.Background(), data.TransactionFilter{ID: apitest.Ptr(data.TransactionID(ids[1]))})
+	if err != nil {
+		t.Fatalf("Transactions.Get() error = %v", err)
+	}
+	if p := transaction.FinePayment; p == nil || p.Reference != "check 1021" || p.Amount != 4 {
+		t.Errorf("FinePayment = %+v; want the check 1021 of 4", p)
+	}
+
+	rec := a.Do(http.MethodGet, "/reports/cash", desk)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("cash report status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var report api.CashReport
+	a.Decode(rec, &report)
+	if report.Count != 2 || report.Total != 12 || report.Date != now.UTC().Format(time.DateOnly) {
+		t.Errorf("cash report = %+v; want 2 payments of 12 today", report)
+	}
+	wantCashiers := []api.CashierTotal{{AcceptedBy: "counter", Count: 1, Total: 4}, {AcceptedBy: "desk", Count: 1, Total: 8}}
+	if len(report.Cashiers) != len(wantCashiers) || report.Cashiers[0] != wantCashiers[0] || report.Cashiers[1] != wantCashiers[1] {
+		t.Errorf("cashiers = %+v; want %+v", report.Cashiers, wantCashiers)
+	}
+
+	rec = a.Do(http.MethodGet, "/reports/cash?method=cash", desk)
+	a.Decode(rec, &report)
+	if report.Count != 1 || report.Total != 8 || report.Payments[0].AcceptedBy != "desk" {
+		t.Errorf("cash report of cash = %+v; want the payment of 8 accepted by desk", report)
+	}
+
+	rec = a.Do(http.MethodGet, "/reports/cash?date="+now.AddDate(0, 0, -1).UTC().Format(time.DateOnly), desk)
+	a.Decode(rec, &report)
+	if report.Count != 0 || report.Total != 0 {
+		t.Errorf("cash report of yesterday = %+v; want no payments", report)
+	}
+
+	if rec := a.Do(http.MethodGet, "/reports/cash?date=yesterday", desk); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("cash report of an invalid date status = %v; want %v", rec.Code, http.StatusUnprocessableEntity)
+	}
+
+	rec = a.Do(http.MethodGet, "/audit?action=payment.recorded", desk)
+	var log api.AuditLogInfo
+	a.Decode(rec, &log)
+	if len(log.Entries) != 2 {
+		t.Errorf("audit entries = %d; want 2", len(log.Entries))
+	}
+}
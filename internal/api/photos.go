@@ -0,0 +1,282 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/mzeevi/library/internal/data"
+	"github.com/mzeevi/library/internal/photo"
+	"github.com/mzeevi/library/internal/storage"
+	"io"
+	"log/slog"
+	"mime"
+	"strconv"
+	"time"
+)
+
+const (
+	errPhotosDisabledMsg = "photos are not stored, since no file storage is configured"
+	errPhotoTypeMsg      = "the photo must be a JPEG or a PNG"
+	errNoPhotoMsg        = "the patron has no photo"
+)
+
+const (
+	// photoSize is the largest width and height of the stored photos of patrons, which photos are
+	// scaled down to.
+	photoSize = 512
+	// maxPhotoBytes is the largest photo which is uploaded, before it is scaled down.
+	maxPhotoBytes = 10 << 20
+)
+
+// photoContentTypes are the content types of the photos which are uploaded.
+var photoContentTypes = []string{"image/jpeg", "image/png"}
+
+type UploadPatronPhotoInput struct {
+	ID          data.PatronID `json:"id" path:"id"`
+	ContentType string        `header:"Content-Type" doc:"image/jpeg or image/png"`
+	RawBody     []byte
+}
+
+type UploadPatronPhotoOutput struct {
+	Body data.Patron `json:"patron"`
+}
+
+type GetPatronPhotoInput struct {
+	ID data.PatronID `json:"id" path:"id"`
+}
+
+type GetPatronPhotoOutput struct {
+	ContentType        string `header:"Content-Type"`
+	ContentLength      string `header:"Content-Length"`
+	CacheControl       string `header:"Cache-Control"`
+	ContentTypeOptions string `header:"X-Content-Type-Options"`
+	Body               []byte
+}
+
+type DeletePatronPhotoInput struct {
+	ID data.PatronID `json:"id" path:"id"`
+}
+
+type DeletePatronPhotoOutput struct {
+	Body data.Patron `json:"patron"`
+}
+
+func (p *UploadPatronPhotoInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	if err := validateID(&p.ID, "path.id"); err != nil {
+		errs = append(errs, err)
+	}
+
+	mediaType, _, err := mime.ParseMediaType(p.ContentType)
+	if err != nil || (mediaType != photoContentTypes[0] && mediaType != photoContentTypes[1]) {
+		errs = append(errs, &huma.ErrorDetail{
+			Location: "header.Content-Type",
+			Message:  errPhotoTypeMsg,
+			Value:    p.ContentType,
+		})
+	}
+
+	return errs
+}
+
+func (p *GetPatronPhotoInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	if err := validateID(&p.ID, "path.id"); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+func (p *DeletePatronPhotoInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	if err := validateID(&p.ID, "path.id"); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// uploadPatronPhotoHandler handles a request to set the photo of a patron, replacing their photo.
+// The photo is scaled down and stored as a JPEG before the patron is updated, and the replaced
+// photo is deleted after it.
+func (app *Application) uploadPatronPhotoHandler(ctx context.Context, input *UploadPatronPhotoInput) (*UploadPatronPhotoOutput, error) {
+	if app.files == nil {
+		return &UploadPatronPhotoOutput{}, huma.Error422UnprocessableEntity(errPhotosDisabledMsg)
+	}
+
+	normalized, err := photo.Normalize(input.RawBody, photoSize)
+	if err != nil {
+		switch {
+		case errors.Is(err, photo.ErrUnsupportedFormat), errors.Is(err, photo.ErrTooLarge):
+			return &UploadPatronPhotoOutput{}, huma.Error422UnprocessableEntity(err.Error())
+		default:
+			return &UploadPatronPhotoOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), fileTimeout)
+	defer cancel()
+
+	patron, err := app.Models.Patrons.Get(ctx, data.PatronFilter{ID: &input.ID})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return &UploadPatronPhotoOutput{}, huma.Error404NotFound(errNotFoundMsg)
+		default:
+			return &UploadPatronPhotoOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	suffix := make([]byte, 16)
+	if _, err = rand.Read(suffix); err != nil {
+		return &UploadPatronPhotoOutput{}, app.serverError(ctx, err)
+	}
+
+	stored := &data.PatronPhoto{
+		Key:         fmt.Sprintf("%s/%s/%s.jpg", patronsKey, patron.ID, hex.EncodeToString(suffix)),
+		ContentType: photo.ContentType,
+		Size:        int64(len(normalized.Content)),
+		Width:       normalized.Width,
+		Height:      normalized.Height,
+		UploadedAt:  time.Now(),
+	}
+
+	if err = app.files.Put(ctx, stored.Key, normalized.Content, stored.ContentType); err != nil {
+		return &UploadPatronPhotoOutput{}, app.serverError(ctx, err)
+	}
+
+	replaced := patron.Photo
+	patron.Photo = stored
+
+	if err = app.updatePatronPhoto(ctx, patron); err != nil {
+		app.deletePatronPhoto(ctx, stored)
+		return &UploadPatronPhotoOutput{}, err
+	}
+
+	app.deletePatronPhoto(ctx, replaced)
+
+	resp := &UploadPatronPhotoOutput{
+		Body: *patron,
+	}
+
+	return resp, nil
+}
+
+// getPatronPhotoHandler handles a request of an admin to get the photo of a patron, such as to
+// verify their identity at the front desk. The photo is not cached, since it is personal.
+func (app *Application) getPatronPhotoHandler(ctx context.Context, input *GetPatronPhotoInput) (*GetPatronPhotoOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), fileTimeout)
+	defer cancel()
+
+	patron, err := app.Models.Patrons.Get(ctx, data.PatronFilter{ID: &input.ID})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return &GetPatronPhotoOutput{}, huma.Error404NotFound(errNotFoundMsg)
+		default:
+			return &GetPatronPhotoOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	if app.files == nil || patron.Photo == nil {
+		return &GetPatronPhotoOutput{}, huma.Error404NotFound(errNoPhotoMsg)
+	}
+
+	content, err := app.files.Open(ctx, patron.Photo.Key)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			return &GetPatronPhotoOutput{}, huma.Error404NotFound(errNoPhotoMsg)
+		default:
+			return &GetPatronPhotoOutput{}, app.serverError(ctx, err)
+		}
+	}
+	defer content.Close()
+
+	body, err := io.ReadAll(content)
+	if err != nil {
+		return &GetPatronPhotoOutput{}, app.serverError(ctx, err)
+	}
+
+	resp := &GetPatronPhotoOutput{
+		ContentType:        patron.Photo.ContentType,
+		ContentLength:      strconv.Itoa(len(body)),
+		CacheControl:       "private, no-store",
+		ContentTypeOptions: "nosniff",
+		Body:               body,
+	}
+
+	return resp, nil
+}
+
+// deletePatronPhotoHandler handles a request to remove the photo of a patron.
+func (app *Application) deletePatronPhotoHandler(ctx context.Context, input *DeletePatronPhotoInput) (*DeletePatronPhotoOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	patron, err := app.Models.Patrons.Get(ctx, data.PatronFilter{ID: &input.ID})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return &DeletePatronPhotoOutput{}, huma.Error404NotFound(errNotFoundMsg)
+		default:
+			return &DeletePatronPhotoOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	if patron.Photo == nil {
+		return &DeletePatronPhotoOutput{}, huma.Error404NotFound(errNoPhotoMsg)
+	}
+
+	removed := patron.Photo
+	patron.Photo = nil
+
+	if err = app.updatePatronPhoto(ctx, patron); err != nil {
+		return &DeletePatronPhotoOutput{}, err
+	}
+
+	app.deletePatronPhoto(ctx, removed)
+
+	resp := &DeletePatronPhotoOutput{
+		Body: *patron,
+	}
+
+	return resp, nil
+}
+
+// updatePatronPhoto stores the photo of a patron, returning huma errors if the patron was deleted
+// or changed since it was read.
+func (app *Application) updatePatronPhoto(ctx context.Context, patron *data.Patron) error {
+	err := app.Models.Patrons.Update(ctx, data.PatronFilter{ID: ptr(data.PatronID(patron.ID))}, patron)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			return huma.Error409Conflict(errConflictMsg)
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return huma.Error404NotFound(errNotFoundMsg)
+		default:
+			return app.serverError(ctx, err)
+		}
+	}
+
+	return nil
+}
+
+// deletePatronPhoto deletes a photo which is no longer of a patron from the storage. Failures are
+// only logged, since the patron was already updated.
+func (app *Application) deletePatronPhoto(ctx context.Context, stored *data.PatronPhoto) {
+	if stored == nil || app.files == nil {
+		return
+	}
+
+	if err := app.files.Delete(ctx, stored.Key); err != nil {
+		app.logger.Error("failed to delete patron photo", slog.String("key", stored.Key), slog.Any("error", err))
+	}
+}
@@ -0,0 +1,93 @@
+package api_test
+
+import (
+	"bytes"
+	"github.com/mzeevi/library/internal/api"
+	"github.com/mzeevi/library/internal/api/apitest"
+	"github.com/mzeevi/library/internal/auth"
+	"github.com/mzeevi/library/internal/data"
+	"github.com/mzeevi/library/internal/storage"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPatronPhotos(t *testing.T) {
+	dir := t.TempDir()
+	a := apitest.New(t, func(app *api.Application) {
+		app.Config.Files.Storage = storage.Local
+		app.Config.Files.Dir = dir
+	})
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+
+	patronID := a.SeedPatron(apitest.Patron("patron@example.com", auth.ReadPatronPermission, auth.WritePatronPermission))
+	photoPath := "/patrons/" + patronID + "/photo"
+
+	var b bytes.Buffer
+	if err := png.Encode(&b, image.NewRGBA(image.Rect(0, 0, 2048, 1024))); err != nil {
+		t.Fatalf("failed to encode PNG: %v", err)
+	}
+	picture := b.Bytes()
+
+	if rec := a.Do(http.MethodPut, photoPath, a.PatronAuth(patronID), "Content-Type: image/png", picture); rec.Code != http.StatusForbidden {
+		t.Errorf("upload by the patron status = %v; want %v", rec.Code, http.StatusForbidden)
+	}
+	if rec := a.Do(http.MethodPut, photoPath, admin, "Content-Type: image/gif", picture); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("upload gif status = %v; want %v", rec.Code, http.StatusUnprocessableEntity)
+	}
+	if rec := a.Do(http.MethodPut, photoPath, admin, "Content-Type: image/png", []byte("<script></script>")); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("upload html as png status = %v; want %v", rec.Code, http.StatusUnprocessableEntity)
+	}
+	if rec := a.Do(http.MethodGet, photoPath, admin); rec.Code != http.StatusNotFound {
+		t.Errorf("get missing photo status = %v; want %v", rec.Code, http.StatusNotFound)
+	}
+
+	rec := a.Do(http.MethodPut, photoPath, admin, "Content-Type: image/png", picture)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("upload status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var patron data.Patron
+	a.Decode(rec, &patron)
+	if patron.Photo == nil || patron.Photo.Width != 512 || patron.Photo.Height != 256 || patron.Photo.ContentType != "image/jpeg" {
+		t.Errorf("photo = %+v; want a 512x256 JPEG", patron.Photo)
+	}
+
+	// Photos are only shown to admins.
+	if rec := a.Do(http.MethodGet, photoPath, a.PatronAuth(patronID)); rec.Code != http.StatusForbidden {
+		t.Errorf("get photo by the patron status = %v; want %v", rec.Code, http.StatusForbidden)
+	}
+	rec = a.Do(http.MethodGet, photoPath, admin)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("get photo status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if got := rec.Header().Get("Cache-Control"); got != "private, no-store" {
+		t.Errorf("photo Cache-Control = %q; want it not to be stored", got)
+	}
+	img, err := jpeg.Decode(rec.Body)
+	if err != nil || img.Bounds().Dx() != 512 {
+		t.Errorf("photo = %v, error = %v; want a JPEG 512 pixels wide", img, err)
+	}
+
+	// Uploading again replaces the photo, and the replaced photo is deleted.
+	if rec := a.Do(http.MethodPut, photoPath, admin, "Content-Type: image/png", picture); rec.Code != http.StatusOK {
+		t.Fatalf("upload again status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "patrons", patronID, "*")); len(files) != 1 {
+		t.Errorf("stored photos = %v; want only the latest", files)
+	}
+
+	if rec := a.Do(http.MethodDelete, photoPath, admin); rec.Code != http.StatusOK {
+		t.Errorf("delete photo status = %v; want %v", rec.Code, http.StatusOK)
+	}
+	if rec := a.Do(http.MethodGet, photoPath, admin); rec.Code != http.StatusNotFound {
+		t.Errorf("get deleted photo status = %v; want %v", rec.Code, http.StatusNotFound)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(dir, "patrons", patronID)); len(entries) != 0 {
+		t.Errorf("stored photos after delete = %v; want none", entries)
+	}
+}
@@ -0,0 +1,248 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/mzeevi/library/internal/auth"
+	"github.com/mzeevi/library/internal/data"
+	"time"
+)
+
+const (
+	errPINPatronOnlyMsg     = "PINs are only set by patrons"
+	errPINLockedMsg         = "too many wrong PINs were entered, set a new PIN to log in at kiosks"
+	errKioskPINRequiredMsg  = "this kiosk requires patrons to log in with their PIN"
+	errInvalidKioskLoginMsg = "invalid card or PIN"
+)
+
+const (
+	// maxPINFailures is how many wrong PINs in a row lock the PIN of a patron until it is set again.
+	maxPINFailures = 5
+)
+
+type SetPINInput struct {
+	Body struct {
+		PIN      string `json:"pin" pattern:"^[0-9]{4,8}$" doc:"4 to 8 digits"`
+		Password string `json:"password" minLength:"8" maxLength:"72" doc:"Current password of the patron"`
+	}
+}
+
+type SetPINOutput struct {
+	Body string `json:"message"`
+}
+
+type DeletePINOutput struct {
+	Body string `json:"message"`
+}
+
+type KioskLoginInput struct {
+	Body struct {
+		Barcode string `json:"barcode" doc:"Barcode of the library card, which is the ID of the patron"`
+		PIN     string `json:"pin" pattern:"^[0-9]{4,8}$"`
+	}
+}
+
+type KioskLoginOutput struct {
+	Body KioskLoginInfo
+}
+
+type KioskLoginInfo struct {
+	PatronToken string    `json:"patron_token" doc:"Token which identifies the patron in borrows and returns at this kiosk"`
+	Name        string    `json:"name"`
+	Expiry      time.Time `json:"expiry"`
+}
+
+// Resolve validates the input in KioskLoginInput.
+func (k *KioskLoginInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	err := validateID(&k.Body.Barcode, "body.barcode")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// setPINHandler handles a request of a patron to set the PIN they log in at kiosks with. The
+// current password of the patron is required, so that a stolen token can't be used to set a PIN.
+func (app *Application) setPINHandler(ctx context.Context, input *SetPINInput) (*SetPINOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	patron, ok := patronFromContext(ctx)
+	if !ok {
+		return &SetPINOutput{}, huma.Error403Forbidden(errPINPatronOnlyMsg)
+	}
+
+	match, err := patron.Password.Matches(input.Body.Password)
+	if err != nil {
+		return &SetPINOutput{}, app.serverError(ctx, err)
+	}
+
+	if !match {
+		return &SetPINOutput{}, huma.Error401Unauthorized(errInvalidAuthenticationCreds)
+	}
+
+	if err = patron.PIN.Set(input.Body.PIN); err != nil {
+		return &SetPINOutput{}, app.serverError(ctx, err)
+	}
+
+	if err = app.updatePIN(ctx, patron); err != nil {
+		return &SetPINOutput{}, err
+	}
+
+	resp := &SetPINOutput{
+		Body: "PIN successfully set",
+	}
+
+	return resp, nil
+}
+
+// deletePINHandler handles a request of a patron to remove their PIN, which disables logging in at kiosks.
+func (app *Application) deletePINHandler(ctx context.Context, _ *struct{}) (*DeletePINOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	patron, ok := patronFromContext(ctx)
+	if !ok {
+		return &DeletePINOutput{}, huma.Error403Forbidden(errPINPatronOnlyMsg)
+	}
+
+	if !patron.PIN.IsSet() {
+		return &DeletePINOutput{}, huma.Error404NotFound(errNotFoundMsg)
+	}
+
+	patron.PIN = auth.PIN{}
+
+	if err := app.updatePIN(ctx, patron); err != nil {
+		return &DeletePINOutput{}, err
+	}
+
+	resp := &DeletePINOutput{
+		Body: "PIN successfully deleted",
+	}
+
+	return resp, nil
+}
+
+// kioskLoginHandler handles a request of a kiosk to log a patron in by the barcode of their
+// library card and their PIN. The token it returns is short-lived, and identifies the patron
+// only in borrows and returns at the same kiosk.
+func (app *Application) kioskLoginHandler(ctx context.Context, input *KioskLoginInput) (*KioskLoginOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	kiosk, _ := kioskFromContext(ctx)
+
+	patron, err := app.Models.Patrons.Get(ctx, data.PatronFilter{ID: ptr(data.PatronID(input.Body.Barcode))})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return &KioskLoginOutput{}, huma.Error401Unauthorized(errInvalidKioskLoginMsg)
+		default:
+			return &KioskLoginOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	if patron.PIN.Failures >= maxPINFailures {
+		return &KioskLoginOutput{}, huma.Error403Forbidden(errPINLockedMsg)
+	}
+
+	// The attempt is counted as a failure before the PIN is compared, so that wrong PINs which
+	// are sent at the same time are all counted, and is reset if the PIN matches.
+	if patron.PIN.IsSet() {
+		err = app.Models.Patrons.IncrementPINFailures(ctx, data.PatronFilter{ID: ptr(data.PatronID(patron.ID))}, maxPINFailures)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrPINLocked):
+				return &KioskLoginOutput{}, huma.Error403Forbidden(errPINLockedMsg)
+			case errors.Is(err, data.ErrDocumentNotFound):
+				return &KioskLoginOutput{}, huma.Error401Unauthorized(errInvalidKioskLoginMsg)
+			default:
+				return &KioskLoginOutput{}, app.serverError(ctx, err)
+			}
+		}
+	}
+
+	match, err := patron.PIN.Matches(input.Body.PIN)
+	if err != nil {
+		return &KioskLoginOutput{}, app.serverError(ctx, err)
+	}
+
+	if !match {
+		return &KioskLoginOutput{}, huma.Error401Unauthorized(errInvalidKioskLoginMsg)
+	}
+
+	err = app.Models.Patrons.ResetPINFailures(ctx, data.PatronFilter{ID: ptr(data.PatronID(patron.ID))})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return &KioskLoginOutput{}, huma.Error401Unauthorized(errInvalidKioskLoginMsg)
+		default:
+			return &KioskLoginOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	if !patron.Activated {
+		return &KioskLoginOutput{}, huma.Error403Forbidden(errInActiveAccountMsg)
+	}
+
+	if patron.Suspended {
+		return &KioskLoginOutput{}, huma.Error403Forbidden(errSuspendedAccountMsg)
+	}
+
+	expiry := time.Now().Add(app.Config.JTW.KioskTokenTTL)
+
+	jwtBytes, err := auth.CreateKioskJWT(patron.ID, kiosk.ID, app.jwtSecret.Value(), app.Config.JTW.Issuer, app.Config.JTW.Audience, app.Config.JTW.KioskTokenTTL)
+	if err != nil {
+		return &KioskLoginOutput{}, app.serverError(ctx, err)
+	}
+
+	resp := &KioskLoginOutput{
+		Body: KioskLoginInfo{
+			PatronToken: string(jwtBytes),
+			Name:        patron.Name,
+			Expiry:      expiry,
+		},
+	}
+
+	return resp, nil
+}
+
+// updatePIN stores the PIN of a patron.
+func (app *Application) updatePIN(ctx context.Context, patron *data.Patron) error {
+	err := app.Models.Patrons.Update(ctx, data.PatronFilter{ID: ptr(data.PatronID(patron.ID))}, patron)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			return huma.Error409Conflict(errConflictMsg)
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return huma.Error404NotFound(errNotFoundMsg)
+		default:
+			return app.serverError(ctx, err)
+		}
+	}
+
+	return nil
+}
+
+// kioskPatronID returns the ID of the patron of a kiosk request, which is identified either by
+// its ID or by the token it got by logging in at the kiosk. Kiosks which require a PIN only
+// accept tokens.
+func (app *Application) kioskPatronID(kiosk *data.Kiosk, patronID, patronToken string) (string, error) {
+	if patronToken == "" {
+		if kiosk.RequirePIN {
+			return "", huma.Error403Forbidden(errKioskPINRequiredMsg)
+		}
+		return patronID, nil
+	}
+
+	claims, err := app.checkJWT(patronToken)
+	if err != nil || !claims.Valid(time.Now()) || claims.Issuer != app.Config.JTW.Issuer || !claims.AcceptAudience(auth.KioskAudience(app.Config.JTW.Audience, kiosk.ID)) {
+		return "", huma.Error401Unauthorized(errInvalidTokenMsg)
+	}
+
+	return claims.Subject, nil
+}
@@ -0,0 +1,147 @@
+package api_test
+
+import (
+	"github.com/mzeevi/library/internal/api"
+	"github.com/mzeevi/library/internal/api/apitest"
+	"github.com/mzeevi/library/internal/auth"
+	"github.com/mzeevi/library/internal/data"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestKioskLogin(t *testing.T) {
+	a := apitest.New(t, func(app *api.Application) {
+		app.Config.JTW.KioskTokenTTL = time.Minute
+	})
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+
+	a.SeedBook(apitest.Book("9780306406157", 2))
+	patron := apitest.Patron("patron@example.com", auth.WritePatronPermission)
+	if err := patron.Password.Set("patron-password"); err != nil {
+		t.Fatalf("Password.Set() error = %v", err)
+	}
+	patronID := a.SeedPatron(patron)
+
+	kiosks := make([]string, 2)
+	for i := range kiosks {
+		rec := a.Do(http.MethodPost, "/kiosks", admin, map[string]any{"name": "Lobby", "branch": "north", "require_pin": true})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("create kiosk status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+		}
+		var kiosk data.Kiosk
+		a.Decode(rec, &kiosk)
+		kiosks[i] = "Authorization: Bearer " + kiosk.Key
+	}
+
+	login := map[string]any{"barcode": patronID, "pin": "4821"}
+	if rec := a.Do(http.MethodPost, "/kiosk/login", kiosks[0], login); rec.Code != http.StatusUnauthorized {
+		t.Errorf("login without a PIN status = %v; want %v", rec.Code, http.StatusUnauthorized)
+	}
+
+	if rec := a.Do(http.MethodPut, "/patrons/me/pin", a.PatronAuth(patronID), map[string]any{"pin": "4821", "password": "wrong-password"}); rec.Code != http.StatusUnauthorized {
+		t.Errorf("set PIN with wrong password status = %v; want %v", rec.Code, http.StatusUnauthorized)
+	}
+	if rec := a.Do(http.MethodPut, "/patrons/me/pin", a.PatronAuth(patronID), map[string]any{"pin": "48", "password": "patron-password"}); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("set short PIN status = %v; want %v", rec.Code, http.StatusUnprocessableEntity)
+	}
+	if rec := a.Do(http.MethodPut, "/patrons/me/pin", a.PatronAuth(patronID), map[string]any{"pin": "4821", "password": "patron-password"}); rec.Code != http.StatusOK {
+		t.Fatalf("set PIN status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	rec := a.Do(http.MethodPost, "/kiosk/login", kiosks[0], login)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("login status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var info api.KioskLoginInfo
+	a.Decode(rec, &info)
+
+	borrow := map[string]any{"patron_id": patronID, "barcode": "9780306406157"}
+	if rec := a.Do(http.MethodPost, "/kiosk/borrow", kiosks[0], "Idempotency-Key: 1e2d3c4b-5a69-4788-9a0b-c1d2e3f4a5b6", borrow); rec.Code != http.StatusForbidden {
+		t.Errorf("borrow by patron ID at a PIN kiosk status = %v; want %v", rec.Code, http.StatusForbidden)
+	}
+
+	borrow = map[string]any{"patron_token": info.PatronToken, "barcode": "9780306406157"}
+	if rec := a.Do(http.MethodPost, "/kiosk/borrow", kiosks[1], "Idempotency-Key: 2f3e4d5c-6b7a-4899-8a1b-d2e3f4a5b6c7", borrow); rec.Code != http.StatusUnauthorized {
+		t.Errorf("borrow with the token of another kiosk status = %v; want %v", rec.Code, http.StatusUnauthorized)
+	}
+	if rec := a.Do(http.MethodGet, "/patrons/"+patronID, "Authorization: Bearer "+info.PatronToken); rec.Code != http.StatusUnauthorized {
+		t.Errorf("get patron with a kiosk token status = %v; want %v", rec.Code, http.StatusUnauthorized)
+	}
+
+	rec = a.Do(http.MethodPost, "/kiosk/borrow", kiosks[0], "Idempotency-Key: 3a4f5e6d-7c8b-49aa-9b2c-e3f4a5b6c7d8", borrow)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("borrow with token status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	wrong := map[string]any{"barcode": patronID, "pin": "0000"}
+	for i := 0; i < 5; i++ {
+		if rec := a.Do(http.MethodPost, "/kiosk/login", kiosks[0], wrong); rec.Code != http.StatusUnauthorized {
+			t.Errorf("login with wrong PIN %d status = %v; want %v", i, rec.Code, http.StatusUnauthorized)
+		}
+	}
+	if rec := a.Do(http.MethodPost, "/kiosk/login", kiosks[0], login); rec.Code != http.StatusForbidden {
+		t.Errorf("login with a locked PIN status = %v; want %v", rec.Code, http.StatusForbidden)
+	}
+
+	if rec := a.Do(http.MethodPut, "/patrons/me/pin", a.PatronAuth(patronID), map[string]any{"pin": "7302", "password": "patron-password"}); rec.Code != http.StatusOK {
+		t.Fatalf("reset PIN status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if rec := a.Do(http.MethodPost, "/kiosk/login", kiosks[0], map[string]any{"barcode": patronID, "pin": "7302"}); rec.Code != http.StatusOK {
+		t.Errorf("login after reset status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	if rec := a.Do(http.MethodDelete, "/patrons/me/pin", a.PatronAuth(patronID)); rec.Code != http.StatusOK {
+		t.Fatalf("delete PIN status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if rec := a.Do(http.MethodPost, "/kiosk/login", kiosks[0], map[string]any{"barcode": patronID, "pin": "7302"}); rec.Code != http.StatusUnauthorized {
+		t.Errorf("login after delete status = %v; want %v", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestKioskLoginConcurrentFailures(t *testing.T) {
+	a := apitest.New(t)
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+
+	patron := apitest.Patron("patron@example.com")
+	if err := patron.PIN.Set("4821"); err != nil {
+		t.Fatalf("PIN.Set() error = %v", err)
+	}
+	patronID := a.SeedPatron(patron)
+
+	rec := a.Do(http.MethodPost, "/kiosks", admin, map[string]any{"name": "Lobby", "branch": "north"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("create kiosk status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var kiosk data.Kiosk
+	a.Decode(rec, &kiosk)
+	auth := "Authorization: Bearer " + kiosk.Key
+
+	const attempts = 10
+	codes := make(chan int, attempts)
+	var wg sync.WaitGroup
+	for range attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- a.Do(http.MethodPost, "/kiosk/login", auth, map[string]any{"barcode": patronID, "pin": "0000"}).Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	counts := make(map[int]int)
+	for code := range codes {
+		counts[code]++
+	}
+	if counts[http.StatusUnauthorized] != 5 || counts[http.StatusForbidden] != attempts-5 {
+		t.Errorf("concurrent logins with a wrong PIN = %v; want 5 %v and the rest %v", counts, http.StatusUnauthorized, http.StatusForbidden)
+	}
+
+	if rec := a.Do(http.MethodPost, "/kiosk/login", auth, map[string]any{"barcode": patronID, "pin": "4821"}); rec.Code != http.StatusForbidden {
+		t.Errorf("login with a locked PIN status = %v; want %v", rec.Code, http.StatusForbidden)
+	}
+}
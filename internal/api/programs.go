@@ -0,0 +1,560 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/mzeevi/library/internal/data"
+	"github.com/mzeevi/library/internal/mailer"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultProgramReminderLead is how long before a program its patrons are reminded of it when
+	// none is configured.
+	defaultProgramReminderLead = 24 * time.Hour
+	// defaultProgramReminderInterval is the interval between reminders of programs when none is configured.
+	defaultProgramReminderInterval = 15 * time.Minute
+)
+
+const (
+	errProgramEndsBeforeStartMsg = "a program must end after it starts"
+	errProgramCapacityMsg        = "capacity must not be lower than the %d patrons registered to the program"
+)
+
+type CreateProgramInput struct {
+	Body struct {
+		Title       string    `json:"title" minLength:"1" maxLength:"200" doc:"Title of the program, such as Story Hour or Intro to 3D Printing"`
+		Description string    `json:"description,omitempty" required:"false" maxLength:"2000"`
+		Branch      string    `json:"branch,omitempty" required:"false" maxLength:"200" doc:"Branch at which the program is held"`
+		Location    string    `json:"location,omitempty" required:"false" maxLength:"200" doc:"Room of the branch in which the program is held"`
+		StartsAt    time.Time `json:"starts_at" format:"date-time"`
+		EndsAt      time.Time `json:"ends_at" format:"date-time"`
+		Capacity    int       `json:"capacity" minimum:"1" doc:"Number of patrons who can register to the program. Patrons who register to a full program are waitlisted"`
+	}
+}
+
+type CreateProgramOutput struct {
+	Location string       `header:"Location"`
+	Body     data.Program `json:"program"`
+}
+
+type GetProgramInput struct {
+	ID string `json:"id" path:"id"`
+}
+
+type ProgramOutput struct {
+	Body data.Program `json:"program"`
+}
+
+type GetProgramsInput struct {
+	PaginationInput
+	Branch string    `query:"branch" doc:"Filter by branch"`
+	From   time.Time `query:"from" doc:"Filter by programs starting at or after this time, now by default"`
+	To     time.Time `query:"to" doc:"Filter by programs starting before this time"`
+	Sort   string    `query:"sort" enum:"starts_at,-starts_at,title,-title" default:"starts_at"`
+}
+
+type GetProgramsOutput struct {
+	Body ProgramsInfo
+}
+
+type ProgramsInfo struct {
+	Programs []data.Program `json:"programs"`
+	Metadata data.Metadata  `json:"metadata"`
+}
+
+type UpdateProgramInput struct {
+	ID   string `json:"id" path:"id"`
+	Body struct {
+		Title       *string    `json:"title,omitempty" minLength:"1" maxLength:"200"`
+		Description *string    `json:"description,omitempty" maxLength:"2000"`
+		Branch      *string    `json:"branch,omitempty" maxLength:"200"`
+		Location    *string    `json:"location,omitempty" maxLength:"200"`
+		StartsAt    *time.Time `json:"starts_at,omitempty" format:"date-time" doc:"Patrons are reminded again of a program whose start changed"`
+		EndsAt      *time.Time `json:"ends_at,omitempty" format:"date-time"`
+		Capacity    *int       `json:"capacity,omitempty" minimum:"1" doc:"Waitlisted patrons are registered, in the order of the waitlist, to the places which a higher capacity opens up"`
+	}
+}
+
+type DeleteProgramInput struct {
+	ID string `json:"id" path:"id"`
+}
+
+type DeleteProgramOutput struct {
+	Body string `json:"message"`
+}
+
+// Resolve validates the input in CreateProgramInput.
+func (p *CreateProgramInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	p.Body.Title = strings.TrimSpace(p.Body.Title)
+	p.Body.Description = strings.TrimSpace(p.Body.Description)
+	p.Body.Branch = strings.TrimSpace(p.Body.Branch)
+	p.Body.Location = strings.TrimSpace(p.Body.Location)
+
+	if p.Body.Title == "" {
+		errs = append(errs, &huma.ErrorDetail{
+			Location: "body.title",
+			Message:  "Title must not be empty",
+			Value:    p.Body.Title,
+		})
+	}
+
+	if !p.Body.EndsAt.After(p.Body.StartsAt) {
+		errs = append(errs, &huma.ErrorDetail{
+			Location: "body.ends_at",
+			Message:  errProgramEndsBeforeStartMsg,
+			Value:    p.Body.EndsAt,
+		})
+	}
+
+	return errs
+}
+
+// Resolve validates the input in GetProgramInput.
+func (p *GetProgramInput) Resolve(ctx huma.Context) []error {
+	if err := validateID(&p.ID, "path.id"); err != nil {
+		return []error{err}
+	}
+
+	return nil
+}
+
+// Resolve validates the input in GetProgramsInput.
+func (p *GetProgramsInput) Resolve(ctx huma.Context) []error {
+	if err := validateRange(optional(p.From), optional(p.To), "from", "to"); err != nil {
+		return []error{err}
+	}
+
+	return nil
+}
+
+// Resolve validates the input in UpdateProgramInput.
+func (p *UpdateProgramInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	if err := validateID(&p.ID, "path.id"); err != nil {
+		errs = append(errs, err)
+	}
+
+	if p.Body.Title != nil {
+		*p.Body.Title = strings.TrimSpace(*p.Body.Title)
+		if *p.Body.Title == "" {
+			errs = append(errs, &huma.ErrorDetail{
+				Location: "body.title",
+				Message:  "Title must not be empty",
+				Value:    *p.Body.Title,
+			})
+		}
+	}
+
+	return errs
+}
+
+// Resolve validates the input in DeleteProgramInput.
+func (p *DeleteProgramInput) Resolve(ctx huma.Context) []error {
+	if err := validateID(&p.ID, "path.id"); err != nil {
+		return []error{err}
+	}
+
+	return nil
+}
+
+// createProgramHandler handles a request to add a program, such as a story hour or a workshop,
+// which patrons can register to.
+func (app *Application) createProgramHandler(ctx context.Context, input *CreateProgramInput) (*CreateProgramOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	program := &data.Program{
+		Title:       input.Body.Title,
+		Description: input.Body.Description,
+		Branch:      input.Body.Branch,
+		Location:    input.Body.Location,
+		StartsAt:    input.Body.StartsAt,
+		EndsAt:      input.Body.EndsAt,
+		Capacity:    input.Body.Capacity,
+	}
+
+	id, err := app.Models.Programs.Insert(ctx, program)
+	if err != nil {
+		return &CreateProgramOutput{}, app.serverError(ctx, err)
+	}
+	program.ID = id
+
+	resp := &CreateProgramOutput{
+		Body:     *program,
+		Location: fmt.Sprintf("%s/%s/%s", basePath, programsKey, id),
+	}
+
+	return resp, nil
+}
+
+// getProgramHandler fetches a program by its ID.
+func (app *Application) getProgramHandler(ctx context.Context, input *GetProgramInput) (*ProgramOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	program, err := app.Models.Programs.Get(ctx, data.ProgramFilter{ID: &input.ID})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return &ProgramOutput{}, huma.Error404NotFound(errNotFoundMsg)
+		default:
+			return &ProgramOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	resp := &ProgramOutput{
+		Body: *program,
+	}
+
+	return resp, nil
+}
+
+// getProgramsHandler fetches programs with pagination, filtering and sorting, by default the
+// upcoming programs from the earliest.
+func (app *Application) getProgramsHandler(ctx context.Context, input *GetProgramsInput) (*GetProgramsOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	paginator := data.Paginator{Page: input.Page, PageSize: input.PageSize}
+	sorter := data.Sorter{Field: input.Sort, SortSafelist: supportedProgramsSortFields, Collation: app.collation}
+
+	from := input.From
+	if from.IsZero() {
+		from = time.Now()
+	}
+
+	filter := data.ProgramFilter{MinStartsAt: &from}
+	if input.Branch != "" {
+		filter.Branch = &input.Branch
+	}
+	if !input.To.IsZero() {
+		filter.MaxStartsAt = &input.To
+	}
+
+	programs, metadata, err := app.Models.Programs.GetAll(ctx, filter, paginator, sorter)
+	if err != nil {
+		return &GetProgramsOutput{}, app.serverError(ctx, err)
+	}
+
+	resp := &GetProgramsOutput{
+		Body: ProgramsInfo{
+			Programs: programs,
+			Metadata: metadata,
+		},
+	}
+
+	return resp, nil
+}
+
+// updateProgramHandler updates the fields of a program. The capacity of a program can't be lowered
+// below the patrons registered to it, and raising it registers waitlisted patrons to the places it
+// opens up, who are notified.
+func (app *Application) updateProgramHandler(ctx context.Context, input *UpdateProgramInput) (*ProgramOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	var program *data.Program
+	var promoted []data.Registration
+
+	err := app.Models.Transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+
+		program, err = app.Models.Programs.Get(ctx, data.ProgramFilter{ID: &input.ID})
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrDocumentNotFound):
+				return huma.Error404NotFound(errNotFoundMsg)
+			default:
+				return err
+			}
+		}
+
+		if input.Body.Title != nil {
+			program.Title = *input.Body.Title
+		}
+		if input.Body.Description != nil {
+			program.Description = strings.TrimSpace(*input.Body.Description)
+		}
+		if input.Body.Branch != nil {
+			program.Branch = strings.TrimSpace(*input.Body.Branch)
+		}
+		if input.Body.Location != nil {
+			program.Location = strings.TrimSpace(*input.Body.Location)
+		}
+		if input.Body.StartsAt != nil && !input.Body.StartsAt.Equal(program.StartsAt) {
+			program.StartsAt = *input.Body.StartsAt
+			program.RemindedAt = time.Time{}
+		}
+		if input.Body.EndsAt != nil {
+			program.EndsAt = *input.Body.EndsAt
+		}
+		if !program.EndsAt.After(program.StartsAt) {
+			return huma.Error422UnprocessableEntity(errProgramEndsBeforeStartMsg)
+		}
+
+		if input.Body.Capacity != nil {
+			if *input.Body.Capacity < program.Registered {
+				return huma.Error422UnprocessableEntity(fmt.Sprintf(errProgramCapacityMsg, program.Registered))
+			}
+			program.Capacity = *input.Body.Capacity
+		}
+
+		if promoted, err = app.promoteWaitlisted(ctx, program, time.Now()); err != nil {
+			return err
+		}
+
+		if err = app.Models.Programs.Update(ctx, data.ProgramFilter{ID: &program.ID}, program); err != nil {
+			switch {
+			case errors.Is(err, data.ErrEditConflict):
+				return huma.Error409Conflict(errConflictMsg)
+			default:
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return &ProgramOutput{}, app.transactionError(ctx, err)
+	}
+
+	for _, registration := range promoted {
+		app.sendProgramNotification(ctx, registration.PatronID, program, mailer.ProgramData{Promoted: true}, mailer.ProgramRegisteredTemplate)
+	}
+
+	resp := &ProgramOutput{
+		Body: *program,
+	}
+
+	return resp, nil
+}
+
+// deleteProgramHandler handles a request to delete a program. The registrations to it are
+// canceled, and if it has not started, its registered and waitlisted patrons are notified that it
+// was canceled.
+func (app *Application) deleteProgramHandler(ctx context.Context, input *DeleteProgramInput) (*DeleteProgramOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	var program *data.Program
+	var canceled []data.Registration
+
+	now := time.Now()
+	err := app.Models.Transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+
+		program, err = app.Models.Programs.Get(ctx, data.ProgramFilter{ID: &input.ID})
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrDocumentNotFound):
+				return huma.Error404NotFound(errNotFoundMsg)
+			default:
+				return err
+			}
+		}
+
+		canceled, _, err = app.Models.Registrations.GetAll(ctx, data.RegistrationFilter{
+			ProgramID: &program.ID,
+			Statuses:  []string{data.RegistrationStatusRegistered, data.RegistrationStatusWaitlisted},
+		}, data.Paginator{}, data.Sorter{})
+		if err != nil {
+			return err
+		}
+
+		for i := range canceled {
+			registration := &canceled[i]
+			registration.Status = data.RegistrationStatusCanceled
+			registration.CanceledAt = now
+
+			if err = app.Models.Registrations.Update(ctx, data.RegistrationFilter{ID: &registration.ID}, registration); err != nil {
+				switch {
+				case errors.Is(err, data.ErrEditConflict):
+					return huma.Error409Conflict(errConflictMsg)
+				default:
+					return err
+				}
+			}
+		}
+
+		return app.Models.Programs.Delete(ctx, data.ProgramFilter{ID: &program.ID})
+	})
+	if err != nil {
+		return &DeleteProgramOutput{}, app.transactionError(ctx, err)
+	}
+
+	if program.StartsAt.After(now) {
+		for _, registration := range canceled {
+			app.sendProgramNotification(ctx, registration.PatronID, program, mailer.ProgramData{}, mailer.ProgramCanceledTemplate)
+		}
+	}
+
+	resp := &DeleteProgramOutput{
+		Body: "program successfully deleted",
+	}
+
+	return resp, nil
+}
+
+// promoteWaitlisted registers the waitlisted patrons of a program, in the order in which they
+// registered, to the places left in it, and updates its counts of registered and waitlisted
+// patrons. It returns the promoted registrations, and the program must be updated by the caller,
+// in the same transaction.
+func (app *Application) promoteWaitlisted(ctx context.Context, program *data.Program, now time.Time) ([]data.Registration, error) {
+	places := program.Capacity - program.Registered
+	if places <= 0 || program.Waitlisted == 0 {
+		return nil, nil
+	}
+
+	waitlisted, _, err := app.Models.Registrations.GetAll(ctx, data.RegistrationFilter{
+		ProgramID: &program.ID,
+		Status:    ptr(data.RegistrationStatusWaitlisted),
+	}, data.Paginator{Page: 1, PageSize: int64(places)}, data.Sorter{Field: "created_at", SortSafelist: supportedRegistrationsSortFields})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range waitlisted {
+		registration := &waitlisted[i]
+		registration.Status = data.RegistrationStatusRegistered
+		registration.PromotedAt = now
+
+		if err = app.Models.Registrations.Update(ctx, data.RegistrationFilter{ID: &registration.ID}, registration); err != nil {
+			switch {
+			case errors.Is(err, data.ErrEditConflict):
+				return nil, huma.Error409Conflict(errConflictMsg)
+			default:
+				return nil, err
+			}
+		}
+
+		program.Registered++
+		program.Waitlisted--
+	}
+
+	return waitlisted, nil
+}
+
+// schedulePrograms reminds the patrons of the programs which are about to start every interval
+// until ctx is canceled.
+func (app *Application) schedulePrograms(ctx context.Context) {
+	interval := app.Config.Programs.ReminderInterval
+	if interval <= 0 {
+		interval = defaultProgramReminderInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		remindCtx, cancel := context.WithTimeout(ctx, reportTimeout)
+		if _, err := app.RemindPrograms(remindCtx); err != nil {
+			app.logger.Error("failed to remind patrons of programs", slog.Any("error", err))
+		}
+		cancel()
+	}
+}
+
+// RemindPrograms reminds the registered patrons of the programs which start within the reminder
+// lead and were not reminded of, and returns how many patrons were reminded. A program is marked
+// as reminded before its patrons are, so that they are reminded once even if reminders run
+// concurrently.
+func (app *Application) RemindPrograms(ctx context.Context) (int, error) {
+	lead := app.Config.Programs.ReminderLead
+	if lead <= 0 {
+		lead = defaultProgramReminderLead
+	}
+
+	now := time.Now()
+	until := now.Add(lead)
+
+	programs, _, err := app.Models.Programs.GetAll(ctx, data.ProgramFilter{
+		MinStartsAt: &now,
+		MaxStartsAt: &until,
+		Reminded:    ptr(false),
+	}, data.Paginator{}, data.Sorter{})
+	if err != nil {
+		return 0, err
+	}
+
+	var reminded int
+	for i := range programs {
+		program := &programs[i]
+		program.RemindedAt = now
+
+		if err = app.Models.Programs.Update(ctx, data.ProgramFilter{ID: &program.ID}, program); err != nil {
+			if errors.Is(err, data.ErrEditConflict) {
+				continue
+			}
+			return reminded, err
+		}
+
+		registrations, _, err := app.Models.Registrations.GetAll(ctx, data.RegistrationFilter{
+			ProgramID: &program.ID,
+			Status:    ptr(data.RegistrationStatusRegistered),
+		}, data.Paginator{}, data.Sorter{})
+		if err != nil {
+			return reminded, err
+		}
+
+		for _, registration := range registrations {
+			patron, err := app.Models.Patrons.Get(ctx, data.PatronFilter{ID: ptr(data.PatronID(registration.PatronID))})
+			if err == nil {
+				_, err = app.notifyPatron(ctx, patron, mailer.ProgramReminderTemplate, app.programData(patron.Name, program, mailer.ProgramData{}))
+			}
+			if err != nil {
+				app.logger.Error("failed to remind patron of program", slog.String("program_id", program.ID), slog.String("patron_id", registration.PatronID), slog.Any("error", err))
+				app.reportError(ctx, err)
+				continue
+			}
+
+			reminded++
+		}
+	}
+
+	return reminded, nil
+}
+
+// programData fills the details of a program in the data of a program email to a patron.
+func (app *Application) programData(name string, program *data.Program, programData mailer.ProgramData) mailer.ProgramData {
+	programData.Name = name
+	programData.Program = program.Title
+	programData.Location = program.Location
+	programData.StartsAt = program.StartsAt.In(app.location)
+	programData.EndsAt = program.EndsAt.In(app.location)
+
+	return programData
+}
+
+// sendProgramNotification notifies a patron of a program with a template, in the background.
+func (app *Application) sendProgramNotification(ctx context.Context, patronID string, program *data.Program, programData mailer.ProgramData, template string) {
+	programData = app.programData("", program, programData)
+
+	app.background(ctx, func(ctx context.Context) {
+		ctx, cancel := context.WithTimeout(ctx, emailTimeout)
+		defer cancel()
+
+		patron, err := app.Models.Patrons.Get(ctx, data.PatronFilter{ID: ptr(data.PatronID(patronID))})
+		if err == nil {
+			programData.Name = patron.Name
+			_, err = app.notifyPatron(ctx, patron, template, programData)
+		}
+		if err != nil {
+			app.requestLogger(ctx).Error("failed to send program notification", slog.String("template", template), slog.Any("error", err))
+			app.reportError(ctx, err)
+		}
+	})
+}
@@ -0,0 +1,206 @@
+package api_test
+
+import (
+	"context"
+	"github.com/mzeevi/library/internal/api"
+	"github.com/mzeevi/library/internal/api/apitest"
+	"github.com/mzeevi/library/internal/auth"
+	"github.com/mzeevi/library/internal/data"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// seedProgram creates a program as an admin, returning its ID.
+func seedProgram(t *testing.T, a *apitest.API, admin string, startsAt time.Time, capacity int) string {
+	t.Helper()
+
+	body := map[string]any{"title": "Story Hour", "location": "Children's Room", "starts_at": startsAt, "ends_at": startsAt.Add(time.Hour), "capacity": capacity}
+	rec := a.Do(http.MethodPost, "/programs", admin, body)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("create program status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	var program data.Program
+	a.Decode(rec, &program)
+
+	return program.ID
+}
+
+// register registers a patron to a program, returning the registration.
+func register(t *testing.T, a *apitest.API, patron, program string) data.Registration {
+	t.Helper()
+
+	rec := a.Do(http.MethodPost, "/programs/"+program+"/registrations", patron)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("register status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	var registration data.Registration
+	a.Decode(rec, &registration)
+
+	return registration
+}
+
+func TestRegisterToProgram(t *testing.T) {
+	a := apitest.New(t)
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+
+	patrons := make([]string, 3)
+	for i := range patrons {
+		patrons[i] = a.PatronAuth(a.SeedPatron(apitest.Patron(string(rune('a'+i))+"@example.com", auth.ReadBooksPermission, auth.ReadPatronPermission)))
+	}
+
+	program := seedProgram(t, a, admin, time.Now().Add(48*time.Hour), 2)
+	started := seedProgram(t, a, admin, time.Now().Add(-time.Hour), 2)
+
+	first, second, third := register(t, a, patrons[0], program), register(t, a, patrons[1], program), register(t, a, patrons[2], program)
+	for registration, want := range map[*data.Registration]string{
+		&first:  data.RegistrationStatusRegistered,
+		&second: data.RegistrationStatusRegistered,
+		&third:  data.RegistrationStatusWaitlisted,
+	} {
+		if registration.Status != want {
+			t.Errorf("registration of patron %s = %s; want %s", registration.PatronID, registration.Status, want)
+		}
+	}
+
+	for name, tt := range map[string]struct {
+		auth       string
+		program    string
+		wantStatus int
+	}{
+		"again":           {auth: patrons[2], program: program, wantStatus: http.StatusConflict},
+		"started":         {auth: patrons[0], program: started, wantStatus: http.StatusUnprocessableEntity},
+		"unknown program": {auth: patrons[0], program: "000000000000000000000000", wantStatus: http.StatusNotFound},
+		"by an admin":     {auth: admin, program: program, wantStatus: http.StatusForbidden},
+	} {
+		if rec := a.Do(http.MethodPost, "/programs/"+tt.program+"/registrations", tt.auth); rec.Code != tt.wantStatus {
+			t.Errorf("register %s status = %v; want %v (body: %s)", name, rec.Code, tt.wantStatus, rec.Body.String())
+		}
+	}
+
+	// The place of a registered patron who cancels goes to the waitlisted patron.
+	if rec := a.Do(http.MethodPost, "/patrons/me/registrations/"+first.ID+"/cancel", patrons[1]); rec.Code != http.StatusNotFound {
+		t.Errorf("cancel the registration of another patron status = %v; want %v", rec.Code, http.StatusNotFound)
+	}
+	if rec := a.Do(http.MethodPost, "/patrons/me/registrations/"+first.ID+"/cancel", patrons[0]); rec.Code != http.StatusOK {
+		t.Fatalf("cancel registration status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if rec := a.Do(http.MethodPost, "/patrons/me/registrations/"+first.ID+"/cancel", patrons[0]); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("cancel registration again status = %v; want %v", rec.Code, http.StatusUnprocessableEntity)
+	}
+
+	var info api.RegistrationsInfo
+	a.Decode(a.Do(http.MethodGet, "/patrons/me/registrations", patrons[2]), &info)
+	if len(info.Registrations) != 1 || info.Registrations[0].Status != data.RegistrationStatusRegistered || info.Registrations[0].PromotedAt.IsZero() {
+		t.Errorf("registrations of the waitlisted patron = %+v; want it promoted", info.Registrations)
+	}
+
+	var got data.Program
+	a.Decode(a.Do(http.MethodGet, "/programs/"+program, patrons[0]), &got)
+	if got.Registered != 2 || got.Waitlisted != 0 {
+		t.Errorf("program has %d registered and %d waitlisted; want 2 and 0", got.Registered, got.Waitlisted)
+	}
+
+	// The patron who canceled can register again, to the end of the waitlist.
+	if again := register(t, a, patrons[0], program); again.Status != data.RegistrationStatusWaitlisted {
+		t.Errorf("registration again = %s; want %s", again.Status, data.RegistrationStatusWaitlisted)
+	}
+
+	var programs api.ProgramsInfo
+	a.Decode(a.Do(http.MethodGet, "/programs", patrons[0]), &programs)
+	if len(programs.Programs) != 1 || programs.Programs[0].ID != program {
+		t.Errorf("upcoming programs = %+v; want the program which has not started", programs.Programs)
+	}
+}
+
+func TestUpdateProgram(t *testing.T) {
+	a := apitest.New(t)
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+
+	program := seedProgram(t, a, admin, time.Now().Add(48*time.Hour), 1)
+	registrations := make([]data.Registration, 3)
+	for i := range registrations {
+		patron := a.PatronAuth(a.SeedPatron(apitest.Patron(string(rune('a'+i))+"@example.com", auth.ReadBooksPermission)))
+		registrations[i] = register(t, a, patron, program)
+	}
+
+	if rec := a.Do(http.MethodPut, "/programs/"+program, admin, map[string]any{"capacity": 2}); rec.Code != http.StatusOK {
+		t.Fatalf("raise capacity status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	var info api.RegistrationsInfo
+	a.Decode(a.Do(http.MethodGet, "/programs/"+program+"/registrations", admin), &info)
+	want := []string{data.RegistrationStatusRegistered, data.RegistrationStatusRegistered, data.RegistrationStatusWaitlisted}
+	if len(info.Registrations) != len(want) {
+		t.Fatalf("registrations = %+v; want %d", info.Registrations, len(want))
+	}
+	for i, registration := range info.Registrations {
+		if registration.ID != registrations[i].ID || registration.Status != want[i] {
+			t.Errorf("registration %d = %s %s; want %s %s", i, registration.ID, registration.Status, registrations[i].ID, want[i])
+		}
+	}
+
+	for name, tt := range map[string]struct {
+		auth       string
+		body       map[string]any
+		wantStatus int
+	}{
+		"below the registered":  {auth: admin, body: map[string]any{"capacity": 1}, wantStatus: http.StatusUnprocessableEntity},
+		"ends before it starts": {auth: admin, body: map[string]any{"ends_at": time.Now()}, wantStatus: http.StatusUnprocessableEntity},
+		"by a patron":           {auth: a.PatronAuth(a.SeedPatron(apitest.Patron("reader@example.com", auth.ReadBooksPermission))), body: map[string]any{"capacity": 5}, wantStatus: http.StatusForbidden},
+	} {
+		if rec := a.Do(http.MethodPut, "/programs/"+program, tt.auth, tt.body); rec.Code != tt.wantStatus {
+			t.Errorf("update %s status = %v; want %v (body: %s)", name, rec.Code, tt.wantStatus, rec.Body.String())
+		}
+	}
+
+	// Deleting the program cancels the registrations to it.
+	if rec := a.Do(http.MethodDelete, "/programs/"+program, admin); rec.Code != http.StatusOK {
+		t.Fatalf("delete program status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	a.Decode(a.Do(http.MethodGet, "/programs/"+program+"/registrations?status=canceled", admin), &info)
+	if len(info.Registrations) != len(registrations) {
+		t.Errorf("canceled registrations = %d; want %d", len(info.Registrations), len(registrations))
+	}
+	if rec := a.Do(http.MethodGet, "/programs/"+program, admin); rec.Code != http.StatusNotFound {
+		t.Errorf("get deleted program status = %v; want %v", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestRemindPrograms(t *testing.T) {
+	a := apitest.New(t, func(app *api.Application) {
+		app.Config.Programs.ReminderLead = 24 * time.Hour
+	})
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+
+	soon := seedProgram(t, a, admin, time.Now().Add(2*time.Hour), 1)
+	later := seedProgram(t, a, admin, time.Now().Add(72*time.Hour), 1)
+	for i, program := range []string{soon, soon, later} {
+		patron := a.PatronAuth(a.SeedPatron(apitest.Patron(string(rune('a'+i))+"@example.com", auth.ReadBooksPermission)))
+		register(t, a, patron, program)
+	}
+
+	// Only the registered patron of the program which starts soon is reminded, and only once.
+	for _, want := range []int{1, 0} {
+		reminded, err := a.App.RemindPrograms(context.Background())
+		if err != nil {
+			t.Fatalf("RemindPrograms() error = %v", err)
+		}
+		if reminded != want {
+			t.Errorf("RemindPrograms() = %d; want %d", reminded, want)
+		}
+	}
+
+	// A program which was moved is reminded of again.
+	if rec := a.Do(http.MethodPut, "/programs/"+soon, admin, map[string]any{"starts_at": time.Now().Add(3 * time.Hour), "ends_at": time.Now().Add(4 * time.Hour)}); rec.Code != http.StatusOK {
+		t.Fatalf("move program status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if reminded, err := a.App.RemindPrograms(context.Background()); err != nil || reminded != 1 {
+		t.Errorf("RemindPrograms() after moving = %d, %v; want 1", reminded, err)
+	}
+}
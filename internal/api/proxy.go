@@ -0,0 +1,108 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+const (
+	headerXForwardedForKey = "X-Forwarded-For"
+	headerXRealIPKey       = "X-Real-IP"
+)
+
+// setupTrustedProxies parses the CIDRs (or single IPs) of the proxies whose forwarded headers are trusted.
+func (app *Application) setupTrustedProxies(proxies []string) error {
+	app.trustedProxies = make([]*net.IPNet, 0, len(proxies))
+
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return fmt.Errorf("invalid trusted proxy %q", proxy)
+			}
+
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+
+			app.trustedProxies = append(app.trustedProxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return fmt.Errorf("invalid trusted proxy %q: %v", proxy, err)
+		}
+
+		app.trustedProxies = append(app.trustedProxies, ipNet)
+	}
+
+	return nil
+}
+
+// isTrustedProxy checks if an IP belongs to one of the trusted proxies.
+func (app *Application) isTrustedProxy(ip net.IP) bool {
+	for _, ipNet := range app.trustedProxies {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// realIP sets the RemoteAddr of the request to the IP of the client, as reported by the
+// X-Forwarded-For or X-Real-IP headers. The headers are only honored when the request was
+// sent by a trusted proxy, since otherwise they can be spoofed to evade the rate limiter.
+func (app *Application) realIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ip := app.clientIP(r); ip != nil {
+			r.RemoteAddr = ip.String()
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientIP returns the IP of the client which sent the request through the trusted proxies,
+// or nil if the request was not sent by a trusted proxy.
+func (app *Application) clientIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	remoteIP := net.ParseIP(host)
+	if remoteIP == nil || !app.isTrustedProxy(remoteIP) {
+		return nil
+	}
+
+	if xff := r.Header.Get(headerXForwardedForKey); xff != "" {
+		// Walk the chain from the closest hop, skipping trusted proxies,
+		// since entries before the first untrusted hop can be forged by the client.
+		hops := strings.Split(xff, ",")
+		var ip net.IP
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip = net.ParseIP(strings.TrimSpace(hops[i]))
+			if ip == nil {
+				return nil
+			}
+
+			if !app.isTrustedProxy(ip) {
+				return ip
+			}
+		}
+
+		return ip
+	}
+
+	if xrip := r.Header.Get(headerXRealIPKey); xrip != "" {
+		return net.ParseIP(strings.TrimSpace(xrip))
+	}
+
+	return nil
+}
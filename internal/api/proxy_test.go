@@ -0,0 +1,85 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSetupTrustedProxies(t *testing.T) {
+	tests := []struct {
+		name    string
+		proxies []string
+		valid   bool
+	}{
+		{name: "none", proxies: nil, valid: true},
+		{name: "bare IPv4", proxies: []string{"10.0.0.1"}, valid: true},
+		{name: "bare IPv6", proxies: []string{"fd00::1"}, valid: true},
+		{name: "CIDRs", proxies: []string{"10.0.0.0/8", "fd00::/8"}, valid: true},
+		{name: "invalid IP", proxies: []string{"10.0.0.256"}, valid: false},
+		{name: "invalid CIDR", proxies: []string{"10.0.0.0/33"}, valid: false},
+		{name: "hostname", proxies: []string{"proxy.example.com"}, valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &Application{}
+			if err := app.setupTrustedProxies(tt.proxies); (err == nil) != tt.valid {
+				t.Errorf("setupTrustedProxies(%q) error = %v; want valid %v", tt.proxies, err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	app := &Application{}
+	if err := app.setupTrustedProxies([]string{"10.0.0.1", "192.168.0.0/16", "fd00::/8"}); err != nil {
+		t.Fatalf("setupTrustedProxies() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        string
+		xRealIP    string
+		want       string
+	}{
+		{name: "untrusted remote", remoteAddr: "203.0.113.9:1234", want: ""},
+		{name: "untrusted remote with spoofed X-Forwarded-For", remoteAddr: "203.0.113.9:1234", xff: "198.51.100.1", want: ""},
+		{name: "untrusted remote with spoofed X-Real-IP", remoteAddr: "203.0.113.9:1234", xRealIP: "198.51.100.1", want: ""},
+		{name: "trusted remote without headers", remoteAddr: "10.0.0.1:1234", want: ""},
+		{name: "bare trusted IP", remoteAddr: "10.0.0.1:1234", xff: "198.51.100.1", want: "198.51.100.1"},
+		{name: "neighbor of a bare trusted IP", remoteAddr: "10.0.0.2:1234", xff: "198.51.100.1", want: ""},
+		{name: "trusted CIDR", remoteAddr: "192.168.4.2:1234", xff: "198.51.100.1", want: "198.51.100.1"},
+		{name: "remote address without a port", remoteAddr: "10.0.0.1", xff: "198.51.100.1", want: "198.51.100.1"},
+		{name: "rightmost untrusted hop", remoteAddr: "10.0.0.1:1234", xff: "1.2.3.4, 198.51.100.1, 192.168.1.1", want: "198.51.100.1"},
+		{name: "all hops trusted", remoteAddr: "10.0.0.1:1234", xff: "192.168.1.2, 192.168.1.1", want: "192.168.1.2"},
+		{name: "invalid hop", remoteAddr: "10.0.0.1:1234", xff: "198.51.100.1, unknown", want: ""},
+		{name: "X-Forwarded-For before X-Real-IP", remoteAddr: "10.0.0.1:1234", xff: "198.51.100.1", xRealIP: "198.51.100.2", want: "198.51.100.1"},
+		{name: "X-Real-IP", remoteAddr: "10.0.0.1:1234", xRealIP: " 198.51.100.2 ", want: "198.51.100.2"},
+		{name: "IPv6 trusted remote", remoteAddr: "[fd00::1]:1234", xff: "2001:db8::1", want: "2001:db8::1"},
+		{name: "IPv6 untrusted remote", remoteAddr: "[2001:db8::2]:1234", xff: "2001:db8::1", want: ""},
+		{name: "IPv6 trusted hops", remoteAddr: "[fd00::1]:1234", xff: "2001:db8::1, fd00::2", want: "2001:db8::1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.xff != "" {
+				r.Header.Set(headerXForwardedForKey, tt.xff)
+			}
+			if tt.xRealIP != "" {
+				r.Header.Set(headerXRealIPKey, tt.xRealIP)
+			}
+
+			got := ""
+			if ip := app.clientIP(r); ip != nil {
+				got = ip.String()
+			}
+			if got != tt.want {
+				t.Errorf("clientIP() = %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
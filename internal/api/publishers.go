@@ -0,0 +1,392 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/mzeevi/library/internal/data"
+	"slices"
+)
+
+const (
+	errPublisherExistsMsg = "a publisher with this name already exists, merge the publishers instead"
+)
+
+type GetPublisherInput struct {
+	ID string `json:"id" path:"id"`
+}
+
+type GetPublisherOutput struct {
+	Body data.Publisher
+}
+
+type GetPublishersInput struct {
+	PaginationInput
+	Name string `query:"name" doc:"Filter by a part of the name"`
+	Sort string `query:"sort" enum:"name,-name" default:"name"`
+}
+
+type GetPublishersOutput struct {
+	Body PublishersInfo
+}
+
+type PublishersInfo struct {
+	Publishers []data.Publisher `json:"publishers"`
+	Metadata   data.Metadata    `json:"metadata"`
+}
+
+type UpdatePublisherInput struct {
+	ID   string `json:"id" path:"id"`
+	Body struct {
+		Name string `json:"name" minLength:"1" doc:"New name of the Publisher. The previous name is kept as an alias"`
+	}
+}
+
+type UpdatePublisherOutput struct {
+	Body UpdatedPublisherInfo
+}
+
+type MergePublishersInput struct {
+	Body struct {
+		SourceID string `json:"source_id" doc:"ID of the duplicate Publisher, which is deleted after the merge"`
+		TargetID string `json:"target_id" doc:"ID of the Publisher which remains after the merge"`
+	}
+}
+
+type MergePublishersOutput struct {
+	Body UpdatedPublisherInfo
+}
+
+// UpdatedPublisherInfo is a Publisher which was renamed or merged, with the number of Books
+// whose publishers were updated.
+type UpdatedPublisherInfo struct {
+	Publisher data.Publisher `json:"publisher"`
+	Books     int            `json:"books"`
+}
+
+// Resolve validates the input in GetPublisherInput.
+func (p *GetPublisherInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	err := validateID(&p.ID, "path.id")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// Resolve validates the input in UpdatePublisherInput.
+func (p *UpdatePublisherInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	err := validateID(&p.ID, "path.id")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	if data.NormalizePublisherName(p.Body.Name) == "" {
+		errs = append(errs, &huma.ErrorDetail{
+			Location: "body.name",
+			Message:  "name must contain a letter or a digit",
+			Value:    p.Body.Name,
+		})
+	}
+
+	return errs
+}
+
+// Resolve validates the input in MergePublishersInput.
+func (p *MergePublishersInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	err := validateID(&p.Body.SourceID, "body.source_id")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	err = validateID(&p.Body.TargetID, "body.target_id")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	if p.Body.SourceID == p.Body.TargetID {
+		errs = append(errs, &huma.ErrorDetail{
+			Location: "body.target_id",
+			Message:  "target_id must be different from source_id",
+			Value:    p.Body.TargetID,
+		})
+	}
+
+	return errs
+}
+
+// resolvePublishers returns the IDs and the names of the Publishers of the given names, creating
+// the Publishers which do not exist yet. Names which are variants of the same Publisher are
+// resolved to it once.
+func (app *Application) resolvePublishers(ctx context.Context, names []string) ([]string, []string, error) {
+	ids, resolved := make([]string, 0, len(names)), make([]string, 0, len(names))
+
+	for _, name := range names {
+		publisher, err := app.Models.Publishers.Ensure(ctx, name)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if slices.Contains(ids, publisher.ID) {
+			continue
+		}
+		ids, resolved = append(ids, publisher.ID), append(resolved, publisher.Name)
+	}
+
+	return ids, resolved, nil
+}
+
+// publisherNames returns the given names of publishers with the names of the Publishers they
+// are variants of, so that filtering books by a variant matches the books of its Publisher.
+func (app *Application) publisherNames(ctx context.Context, names []string) ([]string, error) {
+	all := slices.Clone(names)
+
+	for _, name := range names {
+		normalized := data.NormalizePublisherName(name)
+		publisher, err := app.Models.Publishers.Get(ctx, data.PublisherFilter{NormalizedName: &normalized})
+		if err != nil {
+			if errors.Is(err, data.ErrDocumentNotFound) {
+				continue
+			}
+			return nil, err
+		}
+
+		if !slices.Contains(all, publisher.Name) {
+			all = append(all, publisher.Name)
+		}
+	}
+
+	return all, nil
+}
+
+// reassignPublisher replaces the Publisher with fromID by to in all books, recording an event
+// for each updated book, and returns the number of updated books.
+func (app *Application) reassignPublisher(ctx context.Context, fromID string, to *data.Publisher) (int, error) {
+	bookIDs, err := app.Models.Books.ReassignPublisher(ctx, fromID, to)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, id := range bookIDs {
+		if err = app.recordEvent(ctx, data.EventBookUpdated, bookEvent{ID: id}); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(bookIDs), nil
+}
+
+// MigratePublishers references the Publishers of all books which were stored before books
+// referenced Publishers, creating a Publisher for each distinct normalized name. Variants of a
+// name are replaced by the name of their Publisher. It returns the number of migrated books.
+func (app *Application) MigratePublishers(ctx context.Context) (int, error) {
+	const pageSize = 500
+
+	migrated := 0
+	for page := int64(1); ; page++ {
+		books, _, err := app.Models.Books.GetAll(ctx, data.BookFilter{}, data.Paginator{Page: page, PageSize: pageSize}, data.Sorter{})
+		if err != nil {
+			return migrated, err
+		}
+
+		for _, book := range books {
+			if len(book.PublisherIDs) == len(book.Publishers) {
+				continue
+			}
+
+			err = app.Models.Transactor.WithTransaction(ctx, func(ctx context.Context) error {
+				var err error
+
+				book.PublisherIDs, book.Publishers, err = app.resolvePublishers(ctx, book.Publishers)
+				if err != nil {
+					return err
+				}
+
+				if err = app.Models.Books.Update(ctx, data.BookFilter{ID: ptr(data.BookID(book.ID))}, &book); err != nil {
+					return err
+				}
+
+				return app.recordEvent(ctx, data.EventBookUpdated, bookEvent{ID: book.ID})
+			})
+			if err != nil {
+				return migrated, err
+			}
+			migrated++
+		}
+
+		if len(books) < pageSize {
+			return migrated, nil
+		}
+	}
+}
+
+// getPublisherHandler retrieves a publisher by its ID.
+func (app *Application) getPublisherHandler(ctx context.Context, input *GetPublisherInput) (*GetPublisherOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	publisher, err := app.Models.Publishers.Get(ctx, data.PublisherFilter{ID: &input.ID})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return &GetPublisherOutput{}, huma.Error404NotFound(errNotFoundMsg)
+		default:
+			return &GetPublisherOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	resp := &GetPublisherOutput{
+		Body: *publisher,
+	}
+
+	return resp, nil
+}
+
+// getPublishersHandler retrieves a paginated list of publishers.
+func (app *Application) getPublishersHandler(ctx context.Context, input *GetPublishersInput) (*GetPublishersOutput, error) {
+	paginator := data.Paginator{Page: input.Page, PageSize: input.PageSize}
+	sorter := data.Sorter{Field: input.Sort, SortSafelist: supportedPublishersSortFields, Collation: app.collation}
+
+	filter := data.PublisherFilter{}
+	if input.Name != "" {
+		filter.Name = &input.Name
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	publishers, metadata, err := app.Models.Publishers.GetAll(ctx, filter, paginator, sorter)
+	if err != nil {
+		return &GetPublishersOutput{}, app.serverError(ctx, err)
+	}
+
+	resp := &GetPublishersOutput{
+		Body: PublishersInfo{
+			Publishers: publishers,
+			Metadata:   metadata,
+		},
+	}
+
+	return resp, nil
+}
+
+// updatePublisherHandler renames a publisher, and the publisher in its books.
+func (app *Application) updatePublisherHandler(ctx context.Context, input *UpdatePublisherInput) (*UpdatePublisherOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	var publisher *data.Publisher
+	var books int
+
+	err := app.Models.Transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+
+		publisher, err = app.Models.Publishers.Get(ctx, data.PublisherFilter{ID: &input.ID})
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrDocumentNotFound):
+				return huma.Error404NotFound(errNotFoundMsg)
+			default:
+				return err
+			}
+		}
+
+		publisher.Rename(input.Body.Name)
+		if err = app.Models.Publishers.Update(ctx, data.PublisherFilter{ID: &input.ID}, publisher); err != nil {
+			switch {
+			case errors.Is(err, data.ErrEditConflict):
+				return huma.Error409Conflict(errConflictMsg)
+			case errors.Is(err, data.ErrDuplicatePublisher):
+				return huma.Error422UnprocessableEntity(errPublisherExistsMsg)
+			default:
+				return err
+			}
+		}
+
+		books, err = app.reassignPublisher(ctx, publisher.ID, publisher)
+		return err
+	})
+	if err != nil {
+		return &UpdatePublisherOutput{}, app.transactionError(ctx, err)
+	}
+
+	resp := &UpdatePublisherOutput{
+		Body: UpdatedPublisherInfo{
+			Publisher: *publisher,
+			Books:     books,
+		},
+	}
+
+	return resp, nil
+}
+
+// mergePublishersHandler merges a duplicate publisher into another publisher. The books of the
+// source publisher are reassigned to the target publisher, which gets the names of the source
+// publisher as aliases, and the source publisher is deleted, all within a single database transaction.
+func (app *Application) mergePublishersHandler(ctx context.Context, input *MergePublishersInput) (*MergePublishersOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	var target *data.Publisher
+	var books int
+
+	err := app.Models.Transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+
+		target, err = app.Models.Publishers.Get(ctx, data.PublisherFilter{ID: &input.Body.TargetID})
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrDocumentNotFound):
+				return huma.Error404NotFound("the requested target publisher resource could not be found")
+			default:
+				return err
+			}
+		}
+
+		source, err := app.Models.Publishers.Get(ctx, data.PublisherFilter{ID: &input.Body.SourceID})
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrDocumentNotFound):
+				return huma.Error404NotFound("the requested source publisher resource could not be found")
+			default:
+				return err
+			}
+		}
+
+		// The source is deleted first, since its normalized names are moved to the target.
+		if err = app.Models.Publishers.Delete(ctx, data.PublisherFilter{ID: &source.ID}); err != nil {
+			return err
+		}
+
+		target.Merge(source)
+		if err = app.Models.Publishers.Update(ctx, data.PublisherFilter{ID: &target.ID}, target); err != nil {
+			switch {
+			case errors.Is(err, data.ErrEditConflict):
+				return huma.Error409Conflict(errConflictMsg)
+			default:
+				return err
+			}
+		}
+
+		books, err = app.reassignPublisher(ctx, source.ID, target)
+		return err
+	})
+	if err != nil {
+		return &MergePublishersOutput{}, app.transactionError(ctx, err)
+	}
+
+	resp := &MergePublishersOutput{
+		Body: UpdatedPublisherInfo{
+			Publisher: *target,
+			Books:     books,
+		},
+	}
+
+	return resp, nil
+}
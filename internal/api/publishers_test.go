@@ -0,0 +1,164 @@
+package api_test
+
+import (
+	"context"
+	"github.com/mzeevi/library/internal/api"
+	"github.com/mzeevi/library/internal/api/apitest"
+	"github.com/mzeevi/library/internal/auth"
+	"github.com/mzeevi/library/internal/data"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNormalizePublisherName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "Penguin Books", want: "penguin books"},
+		{name: "  Penguin   Books, Ltd. ", want: "penguin books"},
+		{name: "Simon & Schuster, Inc.", want: "simon and schuster"},
+		{name: "Farrar, Straus and Giroux LLC", want: "farrar straus and giroux"},
+		{name: "Co.", want: "co"},
+	}
+
+	for _, tt := range tests {
+		if got := data.NormalizePublisherName(tt.name); got != tt.want {
+			t.Errorf("NormalizePublisherName(%q) = %q; want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPublishers(t *testing.T) {
+	a := apitest.New(t)
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+	patronID := a.SeedPatron(apitest.Patron("reader@example.com", auth.ReadBooksPermission))
+
+	createBook := func(isbn string, publishers ...string) data.Book {
+		t.Helper()
+
+		rec := a.Do(http.MethodPost, "/books", admin, map[string]any{
+			"pages":        100,
+			"edition":      1,
+			"copies":       1,
+			"published_at": time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC),
+			"title":        "A Book",
+			"identifiers":  []map[string]string{{"type": "isbn13", "value": isbn}},
+			"authors":      []string{"Author"},
+			"publishers":   publishers,
+			"genres":       []string{"Fiction"},
+		})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("POST /books status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+		}
+
+		var book data.Book
+		a.Decode(rec, &book)
+		return book
+	}
+
+	getBook := func(id string) data.Book {
+		t.Helper()
+
+		var book data.Book
+		a.Decode(a.Do(http.MethodGet, "/books/"+id, a.PatronAuth(patronID)), &book)
+		return book
+	}
+
+	penguin := createBook("9780306406157", "Penguin Books Ltd.", "penguin books")
+	if len(penguin.PublisherIDs) != 1 || !reflect.DeepEqual(penguin.Publishers, []string{"Penguin Books Ltd."}) {
+		t.Fatalf("publishers = %v (%v); want one publisher for the variants of its name", penguin.Publishers, penguin.PublisherIDs)
+	}
+
+	variant := createBook("9780140449136", "PENGUIN BOOKS")
+	if !reflect.DeepEqual(variant.PublisherIDs, penguin.PublisherIDs) || !reflect.DeepEqual(variant.Publishers, penguin.Publishers) {
+		t.Errorf("publishers of a variant = %v (%v); want %v (%v)", variant.Publishers, variant.PublisherIDs, penguin.Publishers, penguin.PublisherIDs)
+	}
+
+	vintage := createBook("9781861972712", "Vintage")
+
+	var search api.BooksInfo
+	a.Decode(a.Do(http.MethodGet, "/search/books?"+url.Values{"publishers": {"penguin books"}}.Encode(), a.PatronAuth(patronID)), &search)
+	if len(search.Books) != 2 {
+		t.Errorf("search by a variant of the name = %d books; want %d", len(search.Books), 2)
+	}
+
+	rec := a.Do(http.MethodPost, "/publishers/merge", a.PatronAuth(patronID), map[string]string{"source_id": vintage.PublisherIDs[0], "target_id": penguin.PublisherIDs[0]})
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("merge by a patron status = %v; want %v", rec.Code, http.StatusForbidden)
+	}
+
+	rec = a.Do(http.MethodPost, "/publishers/merge", admin, map[string]string{"source_id": vintage.PublisherIDs[0], "target_id": penguin.PublisherIDs[0]})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("merge status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var merged api.UpdatedPublisherInfo
+	a.Decode(rec, &merged)
+	if merged.Books != 1 || !reflect.DeepEqual(merged.Publisher.Aliases, []string{"Vintage"}) {
+		t.Errorf("merge = %+v; want one book and the source as an alias", merged)
+	}
+
+	if got := getBook(vintage.ID); !reflect.DeepEqual(got.PublisherIDs, penguin.PublisherIDs) || !reflect.DeepEqual(got.Publishers, penguin.Publishers) {
+		t.Errorf("publishers of a book of the source = %v (%v); want the target", got.Publishers, got.PublisherIDs)
+	}
+	if rec = a.Do(http.MethodGet, "/publishers/"+vintage.PublisherIDs[0], admin); rec.Code != http.StatusNotFound {
+		t.Errorf("GET source publisher status = %v; want %v", rec.Code, http.StatusNotFound)
+	}
+	if book := createBook("9780000000002", "Vintage, Inc."); !reflect.DeepEqual(book.PublisherIDs, penguin.PublisherIDs) {
+		t.Errorf("publishers of a new book of the source = %v; want the target", book.PublisherIDs)
+	}
+
+	rec = a.Do(http.MethodPut, "/publishers/"+penguin.PublisherIDs[0], admin, map[string]string{"name": "Penguin Random House"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("rename status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if got := getBook(penguin.ID); !reflect.DeepEqual(got.Publishers, []string{"Penguin Random House"}) {
+		t.Errorf("publishers of a book of the renamed publisher = %v; want the new name", got.Publishers)
+	}
+
+	other := createBook("9780262033848", "MIT Press")
+	if rec = a.Do(http.MethodPut, "/publishers/"+other.PublisherIDs[0], admin, map[string]string{"name": "Penguin Books"}); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("rename to the name of another publisher status = %v; want %v", rec.Code, http.StatusUnprocessableEntity)
+	}
+
+	var publishers api.PublishersInfo
+	a.Decode(a.Do(http.MethodGet, "/publishers?name=penguin", a.PatronAuth(patronID)), &publishers)
+	if len(publishers.Publishers) != 1 || publishers.Publishers[0].Name != "Penguin Random House" {
+		t.Errorf("GET /publishers?name=penguin = %+v; want the renamed publisher", publishers.Publishers)
+	}
+}
+
+func TestMigratePublishers(t *testing.T) {
+	a := apitest.New(t)
+	ctx := context.Background()
+
+	first := a.SeedBook(apitest.Book("9780306406157", 1))
+	second := a.SeedBook(apitest.Book("9780140449136", 1))
+	book, _ := a.Models.Books.Get(ctx, data.BookFilter{ID: apitest.Ptr(data.BookID(second))})
+	book.Publishers = []string{"TEST PUBLISHER, INC.", "Other Publisher"}
+	if err := a.Models.Books.Update(ctx, data.BookFilter{ID: apitest.Ptr(data.BookID(second))}, book); err != nil {
+		t.Fatalf("Books.Update() error = %v", err)
+	}
+
+	migrated, err := a.App.MigratePublishers(ctx)
+	if err != nil || migrated != 2 {
+		t.Fatalf("MigratePublishers() = %v, %v; want 2 books", migrated, err)
+	}
+
+	a1, _ := a.Models.Books.Get(ctx, data.BookFilter{ID: apitest.Ptr(data.BookID(first))})
+	a2, _ := a.Models.Books.Get(ctx, data.BookFilter{ID: apitest.Ptr(data.BookID(second))})
+	if len(a1.PublisherIDs) != 1 || len(a2.PublisherIDs) != 2 || a1.PublisherIDs[0] != a2.PublisherIDs[0] {
+		t.Errorf("publisher IDs = %v and %v; want the same publisher for variants of a name", a1.PublisherIDs, a2.PublisherIDs)
+	}
+	if !reflect.DeepEqual(a2.Publishers, []string{"Test Publisher", "Other Publisher"}) {
+		t.Errorf("publishers = %v; want the names of the publishers", a2.Publishers)
+	}
+
+	if migrated, err = a.App.MigratePublishers(ctx); err != nil || migrated != 0 {
+		t.Errorf("MigratePublishers() again = %v, %v; want no books", migrated, err)
+	}
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/mzeevi/library/internal/data"
+	"github.com/mzeevi/library/internal/database"
+	"slices"
+)
+
+// defaultListReadTags are the tags of the operations whose lists are read with the list read
+// preference, which are the searches and reports that may scan many documents.
+var defaultListReadTags = []string{searchKey, reportsKey}
+
+// setupListReads sets the read preference of the lists of documents which operations with any
+// of the list read tags read. An empty read preference means they are read as any other reads.
+func (app *Application) setupListReads() error {
+	cfg := app.Config.DB
+	if cfg.ListReadPreference == "" {
+		return nil
+	}
+
+	rp, err := database.ReadPreference(cfg.ListReadPreference)
+	if err != nil {
+		return fmt.Errorf("invalid list read preference: %v", err)
+	}
+
+	app.listReads.preference = rp
+	app.listReads.tags = defaultListReadTags
+	if len(cfg.ListReadTags) > 0 {
+		app.listReads.tags = cfg.ListReadTags
+	}
+
+	return nil
+}
+
+// withListReads returns a copy of the context whose lists are read with the list read preference,
+// if it is set and any of the tags is a list read tag.
+func (app *Application) withListReads(ctx context.Context, tags ...string) context.Context {
+	if app.listReads.preference == nil {
+		return ctx
+	}
+
+	if !slices.ContainsFunc(tags, func(tag string) bool { return slices.Contains(app.listReads.tags, tag) }) {
+		return ctx
+	}
+
+	return data.WithReadPreference(ctx, app.listReads.preference)
+}
+
+// readLists reads the lists of operations with any of the list read tags with the list read preference.
+func (app *Application) readLists(ctx huma.Context, next func(huma.Context)) {
+	next(huma.WithContext(ctx, app.withListReads(ctx.Context(), ctx.Operation().Tags...)))
+}
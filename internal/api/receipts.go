@@ -0,0 +1,138 @@
+package api
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/mzeevi/library/internal/data"
+	"github.com/mzeevi/library/internal/receipt"
+	"mime"
+	"time"
+)
+
+const (
+	defaultLibraryName = "Library"
+)
+
+type GetTransactionReceiptInput struct {
+	ID data.TransactionID `json:"id" path:"id"`
+}
+
+type GetTransactionReceiptOutput struct {
+	ContentType        string `header:"Content-Type"`
+	ContentDisposition string `header:"Content-Disposition"`
+	Body               []byte
+}
+
+// ReceiptInput requests a PDF receipt instead of the JSON response of borrowing or returning a book.
+type ReceiptInput struct {
+	Accept string `header:"Accept" doc:"application/pdf for a printable receipt"`
+}
+
+// receiptRequested reports whether a PDF receipt is requested.
+func (r *ReceiptInput) receiptRequested() bool {
+	_, ok := acceptedMediaType(r.Accept, receipt.ContentType)
+	return ok
+}
+
+// transactionReceipt returns the receipt of a transaction, of the copies of the book in it. A
+// returned transaction has a return receipt with its fine.
+func (app *Application) transactionReceipt(ctx context.Context, transaction *data.Transaction, copies int) (*receipt.Receipt, error) {
+	patron, err := app.Models.Patrons.Get(ctx, data.PatronFilter{ID: ptr(data.PatronID(transaction.PatronID))})
+	if err != nil && !errors.Is(err, data.ErrDocumentNotFound) {
+		return nil, err
+	}
+
+	book, err := app.Models.Books.Get(ctx, data.BookFilter{ID: ptr(data.BookID(transaction.BookID))})
+	if err != nil && !errors.Is(err, data.ErrDocumentNotFound) {
+		return nil, err
+	}
+
+	r := &receipt.Receipt{
+		Kind:     receipt.KindBorrow,
+		Number:   transaction.ID,
+		IssuedAt: time.Now().In(app.location),
+		Library:  cmp.Or(app.Config.Name, defaultLibraryName),
+	}
+	if patron != nil {
+		r.Patron = patron.Name
+	}
+
+	item := receipt.Item{
+		Copies:     copies,
+		BorrowedAt: transaction.BorrowedAt.In(app.location),
+		DueDate:    transaction.DueDate.In(app.location),
+	}
+	if book != nil {
+		item.Title, item.ISBN = book.Title, book.ISBN()
+	}
+
+	if transaction.Status == data.TransactionStatusReturned {
+		r.Kind = receipt.KindReturn
+		item.ReturnedAt = transaction.ReturnedAt.In(app.location)
+		item.Fine = calculateFine(*transaction, app.cost.overdueFine, transaction.ReturnedAt, app.location)
+	}
+	r.Items = append(r.Items, item)
+
+	return r, nil
+}
+
+// writeReceipt renders the receipt of a transaction as a PDF, returning it with its content disposition.
+func (app *Application) writeReceipt(ctx context.Context, transaction *data.Transaction, copies int) ([]byte, string, error) {
+	r, err := app.transactionReceipt(ctx, transaction, copies)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var b bytes.Buffer
+	if err = r.Write(&b); err != nil {
+		return nil, "", err
+	}
+
+	disposition := mime.FormatMediaType("inline", map[string]string{"filename": fmt.Sprintf("receipt-%s-%s.pdf", r.Kind, transaction.ID)})
+
+	return b.Bytes(), disposition, nil
+}
+
+// Resolve validates the input in GetTransactionReceiptInput.
+func (t *GetTransactionReceiptInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	if err := validateID(&t.ID, "path.id"); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// getTransactionReceiptHandler handles a request to get the printable receipt of a transaction.
+func (app *Application) getTransactionReceiptHandler(ctx context.Context, input *GetTransactionReceiptInput) (*GetTransactionReceiptOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	transaction, err := app.Models.Transactions.Get(ctx, data.TransactionFilter{ID: &input.ID})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return &GetTransactionReceiptOutput{}, huma.Error404NotFound(errNotFoundMsg)
+		default:
+			return &GetTransactionReceiptOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	b, disposition, err := app.writeReceipt(ctx, transaction, 0)
+	if err != nil {
+		return &GetTransactionReceiptOutput{}, app.serverError(ctx, err)
+	}
+
+	resp := &GetTransactionReceiptOutput{
+		ContentType:        receipt.ContentType,
+		ContentDisposition: disposition,
+		Body:               b,
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,311 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/mzeevi/library/internal/data"
+	"github.com/mzeevi/library/internal/mailer"
+	"time"
+)
+
+const (
+	errRegistrationPatronOnlyMsg  = "registrations are only made by patrons"
+	errProgramStartedMsg          = "the program has already started"
+	errRegistrationDuplicateMsg   = "the patron is already registered or waitlisted to the program"
+	errRegistrationNotCanceledMsg = "only registrations to programs which have not started can be canceled"
+)
+
+type CreateRegistrationInput struct {
+	ID string `json:"id" path:"id" doc:"ID of the program to register to"`
+}
+
+type RegistrationOutput struct {
+	Body data.Registration `json:"registration"`
+}
+
+type GetProgramRegistrationsInput struct {
+	PaginationInput
+	ID     string `json:"id" path:"id"`
+	Status string `query:"status" enum:"registered,waitlisted,canceled" doc:"Filter by status"`
+	Sort   string `query:"sort" enum:"created_at,-created_at" default:"created_at"`
+}
+
+type GetMyRegistrationsInput struct {
+	PaginationInput
+	Status string `query:"status" enum:"registered,waitlisted,canceled" doc:"Filter by status"`
+	Sort   string `query:"sort" enum:"created_at,-created_at" default:"-created_at"`
+}
+
+type GetRegistrationsOutput struct {
+	Body RegistrationsInfo
+}
+
+type RegistrationsInfo struct {
+	Registrations []data.Registration `json:"registrations"`
+	Metadata      data.Metadata       `json:"metadata"`
+}
+
+type CancelRegistrationInput struct {
+	ID string `json:"id" path:"id"`
+}
+
+// Resolve validates the input in CreateRegistrationInput.
+func (r *CreateRegistrationInput) Resolve(ctx huma.Context) []error {
+	if err := validateID(&r.ID, "path.id"); err != nil {
+		return []error{err}
+	}
+
+	return nil
+}
+
+// Resolve validates the input in GetProgramRegistrationsInput.
+func (r *GetProgramRegistrationsInput) Resolve(ctx huma.Context) []error {
+	if err := validateID(&r.ID, "path.id"); err != nil {
+		return []error{err}
+	}
+
+	return nil
+}
+
+// Resolve validates the input in CancelRegistrationInput.
+func (r *CancelRegistrationInput) Resolve(ctx huma.Context) []error {
+	if err := validateID(&r.ID, "path.id"); err != nil {
+		return []error{err}
+	}
+
+	return nil
+}
+
+// createRegistrationHandler registers the authenticated patron to a program, or waitlists them if
+// it is full. The counts of registered and waitlisted patrons of the program are updated in the
+// same transaction as the registration is inserted, so that concurrent registrations conflict on
+// the version of the program instead of registering more patrons than its capacity.
+func (app *Application) createRegistrationHandler(ctx context.Context, input *CreateRegistrationInput) (*RegistrationOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	patron, ok := patronFromContext(ctx)
+	if !ok {
+		return &RegistrationOutput{}, huma.Error403Forbidden(errRegistrationPatronOnlyMsg)
+	}
+
+	var registration *data.Registration
+	var program *data.Program
+
+	err := app.Models.Transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+
+		program, err = app.Models.Programs.Get(ctx, data.ProgramFilter{ID: &input.ID})
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrDocumentNotFound):
+				return huma.Error404NotFound(errNotFoundMsg)
+			default:
+				return err
+			}
+		}
+
+		if !program.StartsAt.After(time.Now()) {
+			return huma.Error422UnprocessableEntity(errProgramStartedMsg)
+		}
+
+		active, _, err := app.Models.Registrations.GetAll(ctx, data.RegistrationFilter{
+			ProgramID: &program.ID,
+			PatronID:  &patron.ID,
+			Statuses:  []string{data.RegistrationStatusRegistered, data.RegistrationStatusWaitlisted},
+		}, data.Paginator{}, data.Sorter{})
+		if err != nil {
+			return err
+		}
+		if len(active) > 0 {
+			return huma.Error409Conflict(errRegistrationDuplicateMsg)
+		}
+
+		registration = &data.Registration{
+			ProgramID: program.ID,
+			PatronID:  patron.ID,
+			Status:    data.RegistrationStatusRegistered,
+		}
+		if program.Registered < program.Capacity {
+			program.Registered++
+		} else {
+			registration.Status = data.RegistrationStatusWaitlisted
+			program.Waitlisted++
+		}
+
+		registration.ID, err = app.Models.Registrations.Insert(ctx, registration)
+		if err != nil {
+			return err
+		}
+
+		if err = app.Models.Programs.Update(ctx, data.ProgramFilter{ID: &program.ID}, program); err != nil {
+			switch {
+			case errors.Is(err, data.ErrEditConflict):
+				return huma.Error409Conflict(errConflictMsg)
+			default:
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return &RegistrationOutput{}, app.transactionError(ctx, err)
+	}
+
+	switch registration.Status {
+	case data.RegistrationStatusWaitlisted:
+		app.sendProgramNotification(ctx, patron.ID, program, mailer.ProgramData{Position: program.Waitlisted}, mailer.ProgramWaitlistedTemplate)
+	default:
+		app.sendProgramNotification(ctx, patron.ID, program, mailer.ProgramData{}, mailer.ProgramRegisteredTemplate)
+	}
+
+	resp := &RegistrationOutput{
+		Body: *registration,
+	}
+
+	return resp, nil
+}
+
+// getProgramRegistrationsHandler fetches the registrations to a program, by default in the order
+// in which patrons registered, which is the order of its waitlist.
+func (app *Application) getProgramRegistrationsHandler(ctx context.Context, input *GetProgramRegistrationsInput) (*GetRegistrationsOutput, error) {
+	filter := data.RegistrationFilter{ProgramID: &input.ID}
+	if input.Status != "" {
+		filter.Status = &input.Status
+	}
+
+	return app.getRegistrations(ctx, filter, input.PaginationInput, input.Sort)
+}
+
+// getMyRegistrationsHandler fetches the registrations of the authenticated patron, by default from the latest.
+func (app *Application) getMyRegistrationsHandler(ctx context.Context, input *GetMyRegistrationsInput) (*GetRegistrationsOutput, error) {
+	patron, ok := patronFromContext(ctx)
+	if !ok {
+		return &GetRegistrationsOutput{}, huma.Error403Forbidden(errRegistrationPatronOnlyMsg)
+	}
+
+	filter := data.RegistrationFilter{PatronID: &patron.ID}
+	if input.Status != "" {
+		filter.Status = &input.Status
+	}
+
+	return app.getRegistrations(ctx, filter, input.PaginationInput, input.Sort)
+}
+
+// getRegistrations fetches the registrations matching filter with pagination and sorting.
+func (app *Application) getRegistrations(ctx context.Context, filter data.RegistrationFilter, pagination PaginationInput, sort string) (*GetRegistrationsOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	paginator := data.Paginator{Page: pagination.Page, PageSize: pagination.PageSize}
+	sorter := data.Sorter{Field: sort, SortSafelist: supportedRegistrationsSortFields, Collation: app.collation}
+
+	registrations, metadata, err := app.Models.Registrations.GetAll(ctx, filter, paginator, sorter)
+	if err != nil {
+		return &GetRegistrationsOutput{}, app.serverError(ctx, err)
+	}
+
+	resp := &GetRegistrationsOutput{
+		Body: RegistrationsInfo{
+			Registrations: registrations,
+			Metadata:      metadata,
+		},
+	}
+
+	return resp, nil
+}
+
+// cancelMyRegistrationHandler cancels a registration of the authenticated patron to a program which
+// has not started. The place of a registered patron goes to the first patron on the waitlist, who
+// is notified.
+func (app *Application) cancelMyRegistrationHandler(ctx context.Context, input *CancelRegistrationInput) (*RegistrationOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	patron, ok := patronFromContext(ctx)
+	if !ok {
+		return &RegistrationOutput{}, huma.Error403Forbidden(errRegistrationPatronOnlyMsg)
+	}
+
+	var registration *data.Registration
+	var program *data.Program
+	var promoted []data.Registration
+
+	err := app.Models.Transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+
+		registration, err = app.Models.Registrations.Get(ctx, data.RegistrationFilter{ID: &input.ID, PatronID: &patron.ID})
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrDocumentNotFound):
+				return huma.Error404NotFound(errNotFoundMsg)
+			default:
+				return err
+			}
+		}
+
+		program, err = app.Models.Programs.Get(ctx, data.ProgramFilter{ID: &registration.ProgramID})
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrDocumentNotFound):
+				return huma.Error422UnprocessableEntity(errRegistrationNotCanceledMsg)
+			default:
+				return err
+			}
+		}
+
+		now := time.Now()
+		if registration.Status == data.RegistrationStatusCanceled || !program.StartsAt.After(now) {
+			return huma.Error422UnprocessableEntity(errRegistrationNotCanceledMsg)
+		}
+
+		switch registration.Status {
+		case data.RegistrationStatusRegistered:
+			program.Registered--
+		case data.RegistrationStatusWaitlisted:
+			program.Waitlisted--
+		}
+
+		registration.Status = data.RegistrationStatusCanceled
+		registration.CanceledAt = now
+
+		if err = app.Models.Registrations.Update(ctx, data.RegistrationFilter{ID: &registration.ID}, registration); err != nil {
+			switch {
+			case errors.Is(err, data.ErrEditConflict):
+				return huma.Error409Conflict(errConflictMsg)
+			default:
+				return err
+			}
+		}
+
+		if promoted, err = app.promoteWaitlisted(ctx, program, now); err != nil {
+			return err
+		}
+
+		if err = app.Models.Programs.Update(ctx, data.ProgramFilter{ID: &program.ID}, program); err != nil {
+			switch {
+			case errors.Is(err, data.ErrEditConflict):
+				return huma.Error409Conflict(errConflictMsg)
+			default:
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return &RegistrationOutput{}, app.transactionError(ctx, err)
+	}
+
+	for _, registration := range promoted {
+		app.sendProgramNotification(ctx, registration.PatronID, program, mailer.ProgramData{Promoted: true}, mailer.ProgramRegisteredTemplate)
+	}
+
+	resp := &RegistrationOutput{
+		Body: *registration,
+	}
+
+	return resp, nil
+}
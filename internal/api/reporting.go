@@ -0,0 +1,103 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"github.com/getsentry/sentry-go"
+	sentryhttp "github.com/getsentry/sentry-go/http"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/mzeevi/library/internal/logging"
+	"net/http"
+	"time"
+)
+
+const (
+	principalReportingTag = "principal"
+	flushTimeout          = 5 * time.Second
+)
+
+// setupErrorReporting initializes the error reporting client when a DSN is configured.
+func (app *Application) setupErrorReporting(dsn, environment string) error {
+	if dsn == "" {
+		return nil
+	}
+
+	err := sentry.Init(sentry.ClientOptions{
+		Dsn:         dsn,
+		Environment: environment,
+		BeforeSend:  app.redactErrorReport,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to initialize error reporting: %v", err)
+	}
+
+	app.errorReporting = true
+
+	return nil
+}
+
+// redactErrorReport redacts the headers, the query parameters and the body of the request which
+// an error report was captured in, and drops its cookies.
+func (app *Application) redactErrorReport(event *sentry.Event, _ *sentry.EventHint) *sentry.Event {
+	if event.Request == nil {
+		return event
+	}
+
+	for name := range event.Request.Headers {
+		if app.redactor.IsHeader(name) {
+			event.Request.Headers[name] = logging.Redacted
+		}
+	}
+	event.Request.URL = app.redactor.URL(event.Request.URL)
+	event.Request.QueryString = app.redactor.Query(event.Request.QueryString)
+	event.Request.Data = app.redactor.Body(event.Request.Data)
+	event.Request.Cookies = ""
+
+	return event
+}
+
+// reportPanics reports panics which occur while handling a request and re-panics,
+// so that the recoverer middleware can still respond to the client.
+func (app *Application) reportPanics(next http.Handler) http.Handler {
+	if !app.errorReporting {
+		return next
+	}
+
+	return sentryhttp.New(sentryhttp.Options{Repanic: true}).Handle(next)
+}
+
+// setReportingUser attaches the authenticated patron or admin to errors reported for the request.
+func (app *Application) setReportingUser(ctx context.Context, id, principal string) {
+	if !app.errorReporting {
+		return
+	}
+
+	if hub := sentry.GetHubFromContext(ctx); hub != nil {
+		hub.Scope().SetUser(sentry.User{ID: id})
+		hub.Scope().SetTag(principalReportingTag, principal)
+	}
+}
+
+// reportError reports an unexpected error along with the ID of the request it occurred in.
+func (app *Application) reportError(ctx context.Context, err error) {
+	if !app.errorReporting {
+		return
+	}
+
+	hub := sentry.GetHubFromContext(ctx)
+	if hub == nil {
+		hub = sentry.CurrentHub().Clone()
+	}
+
+	hub.WithScope(func(scope *sentry.Scope) {
+		scope.SetTag(requestIDLogKey, middleware.GetReqID(ctx))
+		hub.CaptureException(err)
+	})
+}
+
+// flushErrorReports waits for queued error reports to be sent.
+func (app *Application) flushErrorReports() {
+	if app.errorReporting {
+		sentry.Flush(flushTimeout)
+	}
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"github.com/getsentry/sentry-go"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/mzeevi/library/internal/data"
+	"github.com/mzeevi/library/internal/logging"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingTransport is a sentry.Transport which records the events it is sent.
+type recordingTransport struct {
+	mutex  sync.Mutex
+	events []*sentry.Event
+}
+
+func (t *recordingTransport) Flush(_ time.Duration) bool {
+	return true
+}
+
+func (t *recordingTransport) Configure(_ sentry.ClientOptions) {}
+
+func (t *recordingTransport) SendEvent(event *sentry.Event) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.events = append(t.events, event)
+}
+
+// sent returns the events which were sent since the last call.
+func (t *recordingTransport) sent() []*sentry.Event {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	events := t.events
+	t.events = nil
+
+	return events
+}
+
+// newReportingApp returns an Application which reports errors to a recordingTransport, like
+// setupErrorReporting with a DSN.
+func newReportingApp(t *testing.T) (*Application, *recordingTransport) {
+	t.Helper()
+
+	transport := &recordingTransport{}
+	app := &Application{redactor: logging.NewRedactor(nil, nil), errorReporting: true}
+
+	err := sentry.Init(sentry.ClientOptions{Transport: transport, BeforeSend: app.redactErrorReport})
+	if err != nil {
+		t.Fatalf("sentry.Init() error = %v", err)
+	}
+	t.Cleanup(func() { _ = sentry.Init(sentry.ClientOptions{}) })
+
+	return app, transport
+}
+
+func TestReportPanics(t *testing.T) {
+	app, transport := newReportingApp(t)
+
+	handler := middleware.Recoverer(app.reportPanics(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("handler failed")
+	})))
+
+	r := httptest.NewRequest(http.MethodGet, "/books?token=secret", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+
+	// The panic is reported, and re-panicked for the recoverer to respond.
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %v; want %v", rec.Code, http.StatusInternalServerError)
+	}
+
+	events := transport.sent()
+	if len(events) != 1 {
+		t.Fatalf("reported %d events; want 1", len(events))
+	}
+	if events[0].Message != "handler failed" {
+		t.Errorf("reported message = %q; want %q", events[0].Message, "handler failed")
+	}
+	if events[0].Request == nil {
+		t.Fatalf("reported event has no request")
+	}
+	if got := events[0].Request.Headers["Authorization"]; strings.Contains(got, "secret") {
+		t.Errorf("reported Authorization header = %q; want it redacted", got)
+	}
+	if got := events[0].Request.QueryString; strings.Contains(got, "secret") {
+		t.Errorf("reported query = %q; want it redacted", got)
+	}
+}
+
+func TestReportError(t *testing.T) {
+	app, transport := newReportingApp(t)
+
+	// Errors are only reported through serverError, which responds to client errors, such as IDs
+	// which are not valid, with a 4xx error instead of reporting them.
+	tests := []struct {
+		name     string
+		err      error
+		status   int
+		reported bool
+	}{
+		{name: "unexpected error", err: errors.New("database is down"), status: http.StatusInternalServerError, reported: true},
+		{name: "invalid id", err: data.ErrInvalidID, status: http.StatusNotFound, reported: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hub := sentry.CurrentHub().Clone()
+			ctx := sentry.SetHubOnContext(context.WithValue(context.Background(), middleware.RequestIDKey, "request-id"), hub)
+			app.setReportingUser(ctx, "patron-id", patronContextKey.String())
+
+			var status interface{ GetStatus() int }
+			if !errors.As(app.serverError(ctx, tt.err), &status) || status.GetStatus() != tt.status {
+				t.Errorf("serverError(%v) status = %v; want %v", tt.err, status, tt.status)
+			}
+
+			events := transport.sent()
+			if !tt.reported {
+				if len(events) != 0 {
+					t.Errorf("reported %d events; want none", len(events))
+				}
+				return
+			}
+
+			if len(events) != 1 {
+				t.Fatalf("reported %d events; want 1", len(events))
+			}
+			event := events[0]
+			if len(event.Exception) == 0 || event.Exception[len(event.Exception)-1].Value != tt.err.Error() {
+				t.Errorf("reported exception = %+v; want %q", event.Exception, tt.err)
+			}
+			if event.User.ID != "patron-id" {
+				t.Errorf("reported user = %q; want %q", event.User.ID, "patron-id")
+			}
+			if got := event.Tags[principalReportingTag]; got != patronContextKey.String() {
+				t.Errorf("reported principal = %q; want %q", got, patronContextKey.String())
+			}
+			if got := event.Tags[requestIDLogKey]; got != "request-id" {
+				t.Errorf("reported request ID = %q; want %q", got, "request-id")
+			}
+		})
+	}
+}
+
+func TestReportErrorDisabled(t *testing.T) {
+	_, transport := newReportingApp(t)
+	app := &Application{}
+
+	app.setReportingUser(context.Background(), "patron-id", patronContextKey.String())
+	app.reportError(context.Background(), errors.New("database is down"))
+
+	if events := transport.sent(); len(events) != 0 {
+		t.Errorf("reported %d events without error reporting; want none", len(events))
+	}
+}
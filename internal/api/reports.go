@@ -0,0 +1,360 @@
+package api
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/mzeevi/library/internal/data"
+	"github.com/mzeevi/library/internal/mailer"
+	"github.com/mzeevi/library/internal/timezone"
+	"log/slog"
+	"mime"
+	"net/mail"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	errNoReportRecipientsMsg = "no overdue report recipients are configured"
+)
+
+// Names of the files attached to the overdue report, without the format suffix.
+const (
+	overduePatronsReportName = "overdue-patrons"
+	overdueBooksReportName   = "overdue-books"
+)
+
+// weekdays are the days the overdue report can be sent on, by their lowercase names.
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+var (
+	overduePatronsReportHeader = []string{"patron_id", "name", "email", "overdue_loans", "max_days_overdue", "fines"}
+	overdueBooksReportHeader   = []string{"book_id", "title", "isbn", "overdue_loans", "max_days_overdue", "fines"}
+)
+
+type SendOverdueReportInput struct {
+	AsOf string `query:"as_of" doc:"Day of the report, formatted as YYYY-MM-DD in the timezone of the library, as of its end. Now by default"`
+}
+
+type SendOverdueReportOutput struct {
+	Body OverdueReportInfo
+}
+
+type OverdueReportInfo struct {
+	Recipients  []string  `json:"recipients"`
+	GeneratedAt time.Time `json:"generated_at"`
+	Loans       int       `json:"loans"`
+	Patrons     int       `json:"patrons"`
+	Books       int       `json:"books"`
+	Fines       float64   `json:"fines"`
+}
+
+// Resolve validates the input in SendOverdueReportInput.
+func (s *SendOverdueReportInput) Resolve(ctx huma.Context) []error {
+	if err := validateAsOf(s.AsOf, "query.as_of"); err != nil {
+		return []error{err}
+	}
+
+	return nil
+}
+
+// overdueItems sums up the overdue loans of a patron or a book.
+type overdueItems struct {
+	id             string
+	loans          int
+	maxDaysOverdue int
+	fines          float64
+}
+
+// add adds an overdue loan to the items.
+func (o *overdueItems) add(daysOverdue int, fine float64) {
+	o.loans++
+	o.maxDaysOverdue = max(o.maxDaysOverdue, daysOverdue)
+	o.fines += fine
+}
+
+// record returns the columns of the overdue items which are common to patrons and books.
+func (o *overdueItems) record() []string {
+	return []string{strconv.Itoa(o.loans), strconv.Itoa(o.maxDaysOverdue), strconv.FormatFloat(o.fines, 'f', 2, 64)}
+}
+
+// setupOverdueReport parses the recipients, the day and the format of the weekly overdue report.
+// The report is disabled if it has no recipients.
+func (app *Application) setupOverdueReport() error {
+	cfg := app.Config.Reports
+
+	app.overdueReport.recipients = nil
+	if len(cfg.Recipients) == 0 {
+		return nil
+	}
+
+	for _, recipient := range cfg.Recipients {
+		address, err := mail.ParseAddress(recipient)
+		if err != nil {
+			return fmt.Errorf("invalid overdue report recipient %q: %v", recipient, err)
+		}
+		app.overdueReport.recipients = append(app.overdueReport.recipients, address)
+	}
+
+	weekday, ok := weekdays[strings.ToLower(cfg.Weekday)]
+	if !ok {
+		return fmt.Errorf("invalid overdue report day %q", cfg.Weekday)
+	}
+	app.overdueReport.weekday = weekday
+
+	if cfg.Hour < 0 || cfg.Hour > 23 {
+		return fmt.Errorf("invalid overdue report hour %d, it must be between 0 and 23", cfg.Hour)
+	}
+
+	if _, err := data.NewOutput(data.OutputType(cfg.Format)); err != nil {
+		return fmt.Errorf("invalid overdue report format %q: %v", cfg.Format, err)
+	}
+
+	return nil
+}
+
+// scheduleOverdueReport sends the overdue report every week until ctx is canceled, at the
+// configured day and hour in the timezone of the library.
+func (app *Application) scheduleOverdueReport(ctx context.Context) {
+	if len(app.overdueReport.recipients) == 0 {
+		return
+	}
+
+	for {
+		next := timezone.NextWeekly(time.Now(), app.overdueReport.weekday, app.Config.Reports.Hour, app.location)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(next)):
+		}
+
+		reportCtx, cancel := context.WithTimeout(ctx, reportTimeout)
+		if _, err := app.SendOverdueReport(reportCtx, time.Now()); err != nil {
+			app.logger.Error("failed to send overdue report", slog.Any("error", err))
+		}
+		cancel()
+	}
+}
+
+// SendOverdueReport emails the items which were overdue as of now, which may be in the past, per
+// patron and per book, to the recipients of the overdue report, as attachments in the configured
+// export format. It fails if any recipient could not be emailed.
+func (app *Application) SendOverdueReport(ctx context.Context, now time.Time) (*OverdueReportInfo, error) {
+	if len(app.overdueReport.recipients) == 0 {
+		return nil, errors.New(errNoReportRecipientsMsg)
+	}
+
+	now = now.In(app.location)
+
+	report, attachments, err := app.buildOverdueReport(ctx, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build overdue report: %v", err)
+	}
+
+	var errs []error
+	for _, recipient := range app.overdueReport.recipients {
+		report.Name = cmp.Or(recipient.Name, recipient.Address)
+
+		msg, err := app.mailer.Render(mailer.OverdueReportTemplate, app.Config.Mail.Locale, report)
+		if err != nil {
+			return nil, err
+		}
+		msg.To = recipient.Address
+		msg.Attachments = attachments
+
+		if err = app.mailer.Deliver(ctx, msg); err != nil {
+			errs = append(errs, fmt.Errorf("failed to send overdue report to %s: %v", recipient.Address, err))
+		}
+	}
+	if err = errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	info := &OverdueReportInfo{
+		GeneratedAt: report.GeneratedAt,
+		Loans:       report.Loans,
+		Patrons:     report.Patrons,
+		Books:       report.Books,
+		Fines:       report.Fines,
+	}
+	for _, recipient := range app.overdueReport.recipients {
+		info.Recipients = append(info.Recipients, recipient.Address)
+	}
+
+	return info, nil
+}
+
+// buildOverdueReport sums up the loans which were overdue as of now per patron and per book, and
+// writes them to files in the configured export format, which are returned as attachments. Loans
+// which were anonymized are only summed up per book.
+func (app *Application) buildOverdueReport(ctx context.Context, now time.Time) (mailer.OverdueReportData, []mailer.Attachment, error) {
+	const pageSize = 500
+
+	// The scheduled report is not built within an operation, so its reads are tagged here.
+	ctx = app.withListReads(ctx, reportsKey)
+
+	report := mailer.OverdueReportData{GeneratedAt: now}
+	patrons := make(map[string]*overdueItems)
+	books := make(map[string]*overdueItems)
+
+	for page := int64(1); ; page++ {
+		transactions, _, err := app.Models.Transactions.GetAll(ctx, data.TransactionFilter{OutstandingAt: &now, MaxDueDate: &now}, data.Paginator{Page: page, PageSize: pageSize}, data.Sorter{})
+		if err != nil {
+			return report, nil, err
+		}
+
+		for _, transaction := range transactions {
+			daysOverdue := timezone.DaysBetween(transaction.DueDate, now, app.location)
+			fine := calculateFine(transaction, app.cost.overdueFine, now, app.location)
+
+			if transaction.PatronID != "" {
+				if patrons[transaction.PatronID] == nil {
+					patrons[transaction.PatronID] = &overdueItems{id: transaction.PatronID}
+				}
+				patrons[transaction.PatronID].add(daysOverdue, fine)
+			}
+
+			if books[transaction.BookID] == nil {
+				books[transaction.BookID] = &overdueItems{id: transaction.BookID}
+			}
+			books[transaction.BookID].add(daysOverdue, fine)
+
+			report.Loans++
+			report.Fines += fine
+		}
+
+		if len(transactions) < pageSize {
+			break
+		}
+	}
+
+	report.Patrons = len(patrons)
+	report.Books = len(books)
+
+	// The patrons and the books of the report are resolved in one query each, and those which
+	// were deleted since are reported without their details.
+	overduePatrons, _, err := app.Models.Patrons.GetAll(ctx, data.PatronFilter{IDs: overdueIDs[data.PatronID](patrons)}, data.Paginator{}, data.Sorter{})
+	if err != nil {
+		return report, nil, err
+	}
+	patronsByID := make(map[string]data.Patron, len(overduePatrons))
+	for _, patron := range overduePatrons {
+		patronsByID[patron.ID] = patron
+	}
+
+	patronRecords := [][]string{overduePatronsReportHeader}
+	for _, items := range sortOverdueItems(patrons) {
+		patron := patronsByID[items.id]
+		patronRecords = append(patronRecords, append([]string{items.id, patron.Name, patron.Email}, items.record()...))
+	}
+
+	overdueBooks, _, err := app.Models.Books.GetAll(ctx, data.BookFilter{IDs: overdueIDs[data.BookID](books)}, data.Paginator{}, data.Sorter{})
+	if err != nil {
+		return report, nil, err
+	}
+	booksByID := make(map[string]data.Book, len(overdueBooks))
+	for _, book := range overdueBooks {
+		booksByID[book.ID] = book
+	}
+
+	bookRecords := [][]string{overdueBooksReportHeader}
+	for _, items := range sortOverdueItems(books) {
+		var title, isbn string
+		if book, ok := booksByID[items.id]; ok {
+			title, isbn = book.Title, book.ISBN()
+		}
+		bookRecords = append(bookRecords, append([]string{items.id, title, isbn}, items.record()...))
+	}
+
+	reports := []struct {
+		name    string
+		records [][]string
+	}{
+		{name: overduePatronsReportName, records: patronRecords},
+		{name: overdueBooksReportName, records: bookRecords},
+	}
+
+	var attachments []mailer.Attachment
+	for _, r := range reports {
+		attachment, err := writeReport(r.name, app.Config.Reports.Format, r.records)
+		if err != nil {
+			return report, nil, err
+		}
+		attachments = append(attachments, attachment)
+	}
+
+	return report, attachments, nil
+}
+
+// overdueIDs returns the IDs of the overdue items, by which their details are resolved.
+func overdueIDs[T ~string](items map[string]*overdueItems) []T {
+	ids := make([]T, 0, len(items))
+	for id := range items {
+		ids = append(ids, T(id))
+	}
+
+	return ids
+}
+
+// sortOverdueItems returns the overdue items with the longest overdue first.
+func sortOverdueItems(items map[string]*overdueItems) []*overdueItems {
+	sorted := make([]*overdueItems, 0, len(items))
+	for _, item := range items {
+		sorted = append(sorted, item)
+	}
+
+	slices.SortFunc(sorted, func(a, b *overdueItems) int {
+		return cmp.Or(cmp.Compare(b.maxDaysOverdue, a.maxDaysOverdue), cmp.Compare(b.loans, a.loans), cmp.Compare(a.id, b.id))
+	})
+
+	return sorted
+}
+
+// writeReport writes records to a file named name with the export writer of format, and returns
+// the file as an attachment.
+func writeReport(name, format string, records [][]string) (mailer.Attachment, error) {
+	b, err := exportRecords(data.OutputType(format), records)
+	if err != nil {
+		return mailer.Attachment{}, err
+	}
+
+	return mailer.Attachment{
+		Filename:    fmt.Sprintf("%s.%s", name, format),
+		ContentType: cmp.Or(mime.TypeByExtension("."+format), "application/octet-stream"),
+		Data:        b,
+	}, nil
+}
+
+// sendOverdueReportHandler handles a request to send the overdue report now.
+func (app *Application) sendOverdueReportHandler(ctx context.Context, input *SendOverdueReportInput) (*SendOverdueReportOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), reportTimeout)
+	defer cancel()
+
+	if len(app.overdueReport.recipients) == 0 {
+		return &SendOverdueReportOutput{}, huma.Error422UnprocessableEntity(errNoReportRecipientsMsg)
+	}
+
+	info, err := app.SendOverdueReport(ctx, app.asOf(input.AsOf))
+	if err != nil {
+		return &SendOverdueReportOutput{}, app.serverError(ctx, err)
+	}
+
+	resp := &SendOverdueReportOutput{
+		Body: *info,
+	}
+
+	return resp, nil
+}
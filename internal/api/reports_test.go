@@ -0,0 +1,368 @@
+package api_test
+
+import (
+	"context"
+	"github.com/mzeevi/library/internal/api"
+	"github.com/mzeevi/library/internal/api/apitest"
+	"github.com/mzeevi/library/internal/data"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSendOverdueReport(t *testing.T) {
+	a := apitest.New(t)
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+
+	if rec := a.Do(http.MethodPost, "/reports/overdue", admin); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("send without recipients status = %v; want %v", rec.Code, http.StatusUnprocessableEntity)
+	}
+
+	a = apitest.New(t, func(app *api.Application) {
+		app.Config.Cost.OverdueFine = 10
+		app.Config.Reports.Recipients = []string{"Noa Levi <noa@library.com>", "librarians@library.com"}
+		app.Config.Reports.Weekday = "monday"
+		app.Config.Reports.Hour = 8
+		app.Config.Reports.Format = "csv"
+	})
+	a.SeedAdmin("admin", "admin-password")
+
+	firstBookID := a.SeedBook(apitest.Book("9780306406157", 3))
+	secondBookID := a.SeedBook(apitest.Book("9781861972712", 3))
+	firstPatronID := a.SeedPatron(apitest.Patron("first@example.com"))
+	secondPatronID := a.SeedPatron(apitest.Patron("second@example.com"))
+
+	now := time.Now()
+	transactions := []*data.Transaction{
+		data.NewTransaction("", firstPatronID, firstBookID, data.TransactionStatusBorrowed, now.Add(-20*24*time.Hour), now.Add(-3*24*time.Hour)),
+		data.NewTransaction("", firstPatronID, secondBookID, data.TransactionStatusBorrowed, now.Add(-20*24*time.Hour), now.Add(-2*24*time.Hour)),
+		data.NewTransaction("", secondPatronID, firstBookID, data.TransactionStatusBorrowed, now.Add(-20*24*time.Hour), now.Add(-24*time.Hour)),
+		data.NewTransaction("", secondPatronID, secondBookID, data.TransactionStatusBorrowed, now.Add(-24*time.Hour), now.Add(2*24*time.Hour)),
+		data.NewTransaction("", secondPatronID, secondBookID, data.TransactionStatusReturned, now.Add(-20*24*time.Hour), now.Add(-6*24*time.Hour)),
+	}
+	lateReturn := data.NewTransaction("", secondPatronID, firstBookID, data.TransactionStatusReturned, now.Add(-20*24*time.Hour), now.Add(-10*24*time.Hour))
+	lateReturn.ReturnedAt = now.Add(-2 * 24 * time.Hour)
+	transactions = append(transactions, lateReturn)
+	for _, transaction := range transactions {
+		if _, err := a.Models.Transactions.Insert(context.Background(), transaction); err != nil {
+			t.Fatalf("failed to seed transaction: %v", err)
+		}
+	}
+
+	rec := a.Do(http.MethodPost, "/reports/overdue", admin)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("send status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	var report api.OverdueReportInfo
+	a.Decode(rec, &report)
+	if report.Loans != 3 || report.Patrons != 2 || report.Books != 2 || report.Fines != 60 {
+		t.Errorf("report = %+v; want 3 loans of 2 patrons and 2 books with 60 in fines", report)
+	}
+	if len(report.Recipients) != 2 || report.Recipients[0] != "noa@library.com" {
+		t.Errorf("report recipients = %v; want the addresses of both recipients", report.Recipients)
+	}
+
+	// As of five days ago, only the loan which was returned since was overdue.
+	asOf := now.UTC().AddDate(0, 0, -5).Format(time.DateOnly)
+	rec = a.Do(http.MethodPost, "/reports/overdue?as_of="+asOf, admin)
+	a.Decode(rec, &report)
+	if rec.Code != http.StatusOK || report.Loans != 1 || report.Patrons != 1 || report.Books != 1 || report.Fines != 50 {
+		t.Errorf("report as of %s = %v %+v; want 1 loan with 50 in fines", asOf, rec.Code, report)
+	}
+
+	if rec := a.Do(http.MethodPost, "/reports/overdue?as_of=last-week", admin); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("send with an invalid as of status = %v; want %v", rec.Code, http.StatusUnprocessableEntity)
+	}
+
+	if rec := a.Do(http.MethodPost, "/reports/overdue", apitest.AdminAuth("admin", "wrong-password")); rec.Code != http.StatusUnauthorized {
+		t.Errorf("send with wrong credentials status = %v; want %v", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestCirculationReport(t *testing.T) {
+	a := apitest.New(t, func(app *api.Application) {
+		app.Config.Cost.OverdueFine = 2
+	})
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+
+	bookID := a.SeedBook(apitest.Book("9780306406157", 3))
+	patronID := a.SeedPatron(apitest.Patron("patron@example.com"))
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	at := func(days int) time.Time {
+		return today.AddDate(0, 0, days).Add(10 * time.Hour)
+	}
+
+	late := data.NewTransaction("", patronID, bookID, data.TransactionStatusReturned, at(-3), at(-2))
+	late.ReturnedAt = at(-1)
+	borrowed := data.NewTransaction("", patronID, bookID, data.TransactionStatusBorrowed, at(-2), at(12))
+	for _, transaction := range []*data.Transaction{late, borrowed} {
+		if _, err := a.Models.Transactions.Insert(context.Background(), transaction); err != nil {
+			t.Fatalf("failed to seed transaction: %v", err)
+		}
+	}
+
+	if _, err := a.App.RollupDailyStats(context.Background(), time.Now()); err != nil {
+		t.Fatalf("RollupDailyStats() error = %v", err)
+	}
+
+	tests := []struct {
+		query string
+		want  api.CirculationReport
+	}{
+		{
+			query: "?as_of=" + at(-2).Format(time.DateOnly),
+			want:  api.CirculationReport{RolledUpThrough: at(-2).Format(time.DateOnly), Borrows: 2, ActiveLoans: 2, OverdueLoans: 1},
+		},
+		{
+			query: "",
+			want:  api.CirculationReport{RolledUpThrough: at(-1).Format(time.DateOnly), Borrows: 2, Returns: 1, Fines: 2, ActiveLoans: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		rec := a.Do(http.MethodGet, "/reports/circulation"+tt.query, admin)
+		var report api.CirculationReport
+		a.Decode(rec, &report)
+		report.AsOf = time.Time{}
+		if rec.Code != http.StatusOK || report != tt.want {
+			t.Errorf("GET /reports/circulation%s = %v %+v; want %+v", tt.query, rec.Code, report, tt.want)
+		}
+	}
+
+	if rec := a.Do(http.MethodGet, "/reports/circulation?as_of=2024-13-01", admin); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("GET /reports/circulation with an invalid as of status = %v; want %v", rec.Code, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestReportTerms(t *testing.T) {
+	a := apitest.New(t, func(app *api.Application) {
+		app.Config.Reports.Terms = map[string]string{"fall": "09-01/01-31", "spring": "02-01/06-30"}
+		app.Config.Reports.FiscalYearStart = "07-01"
+	})
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+
+	bookID := a.SeedBook(apitest.Book("9780306406157", 3))
+	patronID := a.SeedPatron(apitest.Patron("patron@example.com"))
+
+	day := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 10, 0, 0, 0, time.UTC)
+	}
+
+	fall := data.NewTransaction("", patronID, bookID, data.TransactionStatusReturned, day(2024, time.September, 10), day(2024, time.September, 24))
+	fall.ReturnedAt = day(2024, time.October, 1)
+	spring := data.NewTransaction("", patronID, bookID, data.TransactionStatusBorrowed, day(2025, time.February, 10), day(2025, time.February, 24))
+	for _, transaction := range []*data.Transaction{fall, spring} {
+		if _, err := a.Models.Transactions.Insert(context.Background(), transaction); err != nil {
+			t.Fatalf("failed to seed transaction: %v", err)
+		}
+	}
+
+	if _, err := a.App.RollupDailyStats(context.Background(), day(2025, time.February, 15)); err != nil {
+		t.Fatalf("RollupDailyStats() error = %v", err)
+	}
+
+	rec := a.Do(http.MethodGet, "/reports/daily?term=2024-fall", admin)
+	var info api.DailyStatsInfo
+	a.Decode(rec, &info)
+	if rec.Code != http.StatusOK || info.Metadata.TotalRecords != 144 || info.Days[0].ID != "2024-09-10" || info.Days[0].Borrows != 1 {
+		t.Errorf("GET /reports/daily?term=2024-fall = %v %+v; want the days from 2024-09-10 to 2025-01-31", rec.Code, info.Metadata)
+	}
+
+	tests := []struct {
+		term string
+		want api.CirculationReport
+	}{
+		{term: "2024-fall", want: api.CirculationReport{RolledUpThrough: "2025-01-31", Borrows: 1, Returns: 1}},
+		{term: "2025-spring", want: api.CirculationReport{RolledUpThrough: "2025-02-14", Borrows: 1, ActiveLoans: 1, OverdueLoans: 1}},
+		{term: "2024-fiscal", want: api.CirculationReport{RolledUpThrough: "2025-02-14", Borrows: 2, Returns: 1, ActiveLoans: 1, OverdueLoans: 1}},
+	}
+
+	for _, tt := range tests {
+		rec := a.Do(http.MethodGet, "/reports/circulation?term="+tt.term, admin)
+		var report api.CirculationReport
+		a.Decode(rec, &report)
+		if rec.Code != http.StatusOK || report.Term != tt.term || report.From == nil {
+			t.Fatalf("GET /reports/circulation?term=%s = %v %+v", tt.term, rec.Code, report)
+		}
+		report.Term, report.From, report.AsOf = "", nil, time.Time{}
+		if report != tt.want {
+			t.Errorf("GET /reports/circulation?term=%s = %+v; want %+v", tt.term, report, tt.want)
+		}
+	}
+
+	for _, query := range []string{"term=2024-winter", "term=2024-fall&as_of=2024-10-01"} {
+		if rec := a.Do(http.MethodGet, "/reports/circulation?"+query, admin); rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("GET /reports/circulation?%s status = %v; want %v", query, rec.Code, http.StatusUnprocessableEntity)
+		}
+	}
+}
+
+func TestDelinquentPatrons(t *testing.T) {
+	a := apitest.New(t, func(app *api.Application) {
+		app.Config.Cost.OverdueFine = 1
+	})
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+
+	bookID := a.SeedBook(apitest.Book("9780306406157", 5))
+	patronIDs := make(map[string]string)
+	for _, name := range []string{"late", "later", "unpaid", "paid"} {
+		patron := apitest.Patron(name + "@example.com")
+		patron.Phone = "+972501234567"
+		patron.NotificationChannel = "sms"
+		patronIDs[name] = a.SeedPatron(patron)
+	}
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	at := func(days int) time.Time {
+		return today.AddDate(0, 0, days).Add(10 * time.Hour)
+	}
+	returned := func(patron string, due, returnedAt int) *data.Transaction {
+		transaction := data.NewTransaction("", patronIDs[patron], bookID, data.TransactionStatusReturned, at(due-14), at(due))
+		transaction.ReturnedAt = at(returnedAt)
+		return transaction
+	}
+
+	paid := returned("paid", -40, -10)
+	paid.FinePayment = &data.FinePayment{PaymentID: "payment", Amount: 30, PaidAt: at(-10)}
+	transactions := []*data.Transaction{
+		data.NewTransaction("", patronIDs["late"], bookID, data.TransactionStatusBorrowed, at(-17), at(-3)),
+		data.NewTransaction("", patronIDs["late"], bookID, data.TransactionStatusBorrowed, at(-16), at(-2)),
+		data.NewTransaction("", patronIDs["later"], bookID, data.TransactionStatusBorrowed, at(-24), at(-10)),
+		returned("later", -20, -15),
+		returned("unpaid", -40, -10),
+		paid,
+	}
+	for _, transaction := range transactions {
+		if _, err := a.Models.Transactions.Insert(context.Background(), transaction); err != nil {
+			t.Fatalf("failed to seed transaction: %v", err)
+		}
+	}
+
+	late := api.DelinquentPatron{PatronID: patronIDs["late"], Name: "Test Patron", Email: "late@example.com", OverdueLoans: 2, MaxDaysOverdue: 3, OverdueFines: 5}
+	later := api.DelinquentPatron{PatronID: patronIDs["later"], Name: "Test Patron", Email: "later@example.com", OverdueLoans: 1, MaxDaysOverdue: 10, OverdueFines: 10, OutstandingFines: 5}
+	unpaid := api.DelinquentPatron{PatronID: patronIDs["unpaid"], Name: "Test Patron", Email: "unpaid@example.com", OutstandingFines: 30}
+
+	tests := []struct {
+		query string
+		want  []api.DelinquentPatron
+	}{
+		{query: "", want: []api.DelinquentPatron{late, later, unpaid}},
+		{query: "?rank=fines&limit=2", want: []api.DelinquentPatron{unpaid, later}},
+	}
+
+	for _, tt := range tests {
+		rec := a.Do(http.MethodGet, "/reports/delinquent"+tt.query, admin)
+		var report api.DelinquentPatronsReport
+		a.Decode(rec, &report)
+		if rec.Code != http.StatusOK || !reflect.DeepEqual(report.Patrons, tt.want) {
+			t.Errorf("GET /reports/delinquent%s = %v %+v; want %+v", tt.query, rec.Code, report.Patrons, tt.want)
+		}
+	}
+
+	rec := a.Do(http.MethodGet, "/reports/delinquent?format=csv", admin)
+	if got := rec.Header().Get("Content-Type"); rec.Code != http.StatusOK || !strings.HasPrefix(got, "text/csv") {
+		t.Fatalf("GET /reports/delinquent?format=csv = %v %q; want %v text/csv", rec.Code, got, http.StatusOK)
+	}
+	if lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n"); len(lines) != 4 || !strings.HasPrefix(lines[0], "patron_id,name,email") {
+		t.Errorf("GET /reports/delinquent?format=csv = %q; want a header and 3 patrons", rec.Body.String())
+	}
+
+	if rec := a.Do(http.MethodGet, "/reports/delinquent", a.PatronAuth(patronIDs["late"])); rec.Code != http.StatusForbidden {
+		t.Errorf("GET /reports/delinquent as a patron status = %v; want %v", rec.Code, http.StatusForbidden)
+	}
+
+	rec = a.Do(http.MethodPost, "/reports/delinquent/remind?rank=fines&limit=2", admin)
+	var reminders api.DelinquentReminders
+	a.Decode(rec, &reminders)
+	reminders.Failed = 0
+	if want := (api.DelinquentReminders{Patrons: 1, Notifications: 1, Skipped: 1}); rec.Code != http.StatusOK || reminders != want {
+		t.Errorf("POST /reports/delinquent/remind = %v %+v; want %+v", rec.Code, reminders, want)
+	}
+
+	reminded := patronIDs["later"]
+	notifications, _, err := a.Models.Notifications.GetAll(context.Background(), data.NotificationFilter{PatronID: &reminded}, data.Paginator{}, data.Sorter{})
+	if err != nil || len(notifications) != 1 || notifications[0].Template != "overdue" {
+		t.Errorf("notifications of the reminded patron = %+v, %v; want 1 overdue", notifications, err)
+	}
+}
+
+func TestCollectionReport(t *testing.T) {
+	a := apitest.New(t)
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+
+	acquired := apitest.Book("9780306406157", 3)
+	acquired.Circulation.Borrows = 4
+	acquiredID := a.SeedBook(acquired)
+
+	weeded := apitest.Book("9780140449136", 2)
+	weeded.PublishedAt = time.Date(1995, time.June, 1, 0, 0, 0, 0, time.UTC)
+	weeded.WithdrawnCopies = 1
+	weededID := a.SeedBook(weeded)
+
+	undated := apitest.Book("9780262033848", 1)
+	undated.PublishedAt = time.Time{}
+	undated.Genres = []string{"History"}
+	a.SeedBook(undated)
+
+	acquisitions := []*data.Acquisition{
+		{Source: data.AcquisitionSourcePurchase, Title: "Test Book", Copies: 3, ReceivedAt: time.Date(2019, time.May, 1, 0, 0, 0, 0, time.UTC), Status: data.AcquisitionStatusCataloged, BookID: acquiredID},
+		{Source: data.AcquisitionSourceDonation, Title: "Test Book", Copies: 1, ReceivedAt: time.Date(2010, time.May, 1, 0, 0, 0, 0, time.UTC), Status: data.AcquisitionStatusReceived, BookID: weededID},
+	}
+	for _, acquisition := range acquisitions {
+		if _, err := a.Models.Acquisitions.Insert(context.Background(), acquisition); err != nil {
+			t.Fatalf("failed to seed acquisition: %v", err)
+		}
+	}
+
+	thisYear := strconv.Itoa(time.Now().UTC().Year())
+	tests := []struct {
+		query     string
+		want      []api.CollectionGroup
+		wantYears []api.CollectionGroup
+	}{
+		{
+			query: "",
+			want: []api.CollectionGroup{
+				{Group: "1990s", Titles: 1, Copies: 2, WithdrawnCopies: 1, NeverBorrowed: 1},
+				{Group: "2000s", Titles: 1, Copies: 3, Borrows: 4},
+				{Group: "unknown", Titles: 1, Copies: 1, NeverBorrowed: 1},
+			},
+			wantYears: []api.CollectionGroup{
+				{Group: "2019", Titles: 1, Copies: 3, Borrows: 4},
+				{Group: thisYear, Titles: 2, Copies: 3, WithdrawnCopies: 1, NeverBorrowed: 2},
+			},
+		},
+		{
+			query:     "?genres=History",
+			want:      []api.CollectionGroup{{Group: "unknown", Titles: 1, Copies: 1, NeverBorrowed: 1}},
+			wantYears: []api.CollectionGroup{{Group: thisYear, Titles: 1, Copies: 1, NeverBorrowed: 1}},
+		},
+	}
+
+	for _, tt := range tests {
+		rec := a.Do(http.MethodGet, "/reports/collection"+tt.query, admin)
+		var report api.CollectionReport
+		a.Decode(rec, &report)
+		if rec.Code != http.StatusOK || !reflect.DeepEqual(report.ByDecade, tt.want) || !reflect.DeepEqual(report.ByAcquisitionYear, tt.wantYears) {
+			t.Errorf("GET /reports/collection%s = %v %+v %+v; want %+v %+v", tt.query, rec.Code, report.ByDecade, report.ByAcquisitionYear, tt.want, tt.wantYears)
+		}
+	}
+
+	rec := a.Do(http.MethodGet, "/reports/collection?format=csv", admin)
+	if got := rec.Header().Get("Content-Type"); rec.Code != http.StatusOK || !strings.HasPrefix(got, "text/csv") {
+		t.Fatalf("GET /reports/collection?format=csv = %v %q; want %v text/csv", rec.Code, got, http.StatusOK)
+	}
+	if lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n"); len(lines) != 6 || lines[1] != "decade,1990s,1,2,0,1,0,1" {
+		t.Errorf("GET /reports/collection?format=csv = %q; want a header and 5 groups", rec.Body.String())
+	}
+}
@@ -0,0 +1,445 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/mzeevi/library/internal/booking"
+	"github.com/mzeevi/library/internal/data"
+	"github.com/mzeevi/library/internal/mailer"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+const (
+	errReservationPatronOnlyMsg  = "reservations are only made by patrons"
+	errReservationSlotsMsg       = "a reservation must be made of whole slots of %v between %s and %s"
+	errReservationTooLongMsg     = "a reservation must not be longer than %v"
+	errReservationPastMsg        = "a reservation must start in the future"
+	errReservationHorizonMsg     = "a reservation must end within %d days from today"
+	errReservationMaximumMsg     = "a patron may have at most %d upcoming reservations"
+	errReservationConflictMsg    = "the resource is already reserved for part of this time"
+	errResourceInactiveMsg       = "the resource can't be reserved"
+	errReservationNotCanceledMsg = "only confirmed reservations which have not ended can be canceled"
+)
+
+type CreateReservationInput struct {
+	ID   string `json:"id" path:"id" doc:"ID of the resource to reserve"`
+	Body struct {
+		StartsAt time.Time `json:"starts_at" format:"date-time" doc:"Start of the first slot of the reservation"`
+		EndsAt   time.Time `json:"ends_at" format:"date-time" doc:"End of the last slot of the reservation"`
+		Purpose  string    `json:"purpose,omitempty" required:"false" maxLength:"500"`
+	}
+}
+
+type CreateReservationOutput struct {
+	Location string           `header:"Location"`
+	Body     data.Reservation `json:"reservation"`
+}
+
+type GetReservationInput struct {
+	ID string `json:"id" path:"id"`
+}
+
+type ReservationOutput struct {
+	Body data.Reservation `json:"reservation"`
+}
+
+type GetReservationsInput struct {
+	PaginationInput
+	ResourceID string `query:"resource_id" doc:"Filter by resource"`
+	PatronID   string `query:"patron_id" doc:"Filter by the patron who made the reservation"`
+	Status     string `query:"status" enum:"confirmed,canceled" doc:"Filter by status"`
+	Sort       string `query:"sort" enum:"starts_at,-starts_at,created_at,-created_at" default:"starts_at"`
+}
+
+type GetMyReservationsInput struct {
+	PaginationInput
+	Status string `query:"status" enum:"confirmed,canceled" doc:"Filter by status"`
+	Sort   string `query:"sort" enum:"starts_at,-starts_at,created_at,-created_at" default:"-starts_at"`
+}
+
+type GetReservationsOutput struct {
+	Body ReservationsInfo
+}
+
+type ReservationsInfo struct {
+	Reservations []data.Reservation `json:"reservations"`
+	Metadata     data.Metadata      `json:"metadata"`
+}
+
+type CancelReservationInput struct {
+	ID   string `json:"id" path:"id"`
+	Body *struct {
+		Reason string `json:"reason,omitempty" required:"false" maxLength:"500" doc:"Why the reservation was canceled, which is sent to the patron"`
+	}
+}
+
+// Resolve validates the input in CreateReservationInput.
+func (r *CreateReservationInput) Resolve(ctx huma.Context) []error {
+	if err := validateID(&r.ID, "path.id"); err != nil {
+		return []error{err}
+	}
+
+	r.Body.Purpose = strings.TrimSpace(r.Body.Purpose)
+
+	return nil
+}
+
+// Resolve validates the input in GetReservationInput.
+func (r *GetReservationInput) Resolve(ctx huma.Context) []error {
+	if err := validateID(&r.ID, "path.id"); err != nil {
+		return []error{err}
+	}
+
+	return nil
+}
+
+// Resolve validates the input in GetReservationsInput.
+func (r *GetReservationsInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	if r.ResourceID != "" {
+		if err := validateID(&r.ResourceID, "query.resource_id"); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if r.PatronID != "" {
+		if err := validateID(&r.PatronID, "query.patron_id"); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs
+}
+
+// Resolve validates the input in CancelReservationInput.
+func (r *CancelReservationInput) Resolve(ctx huma.Context) []error {
+	if err := validateID(&r.ID, "path.id"); err != nil {
+		return []error{err}
+	}
+
+	if r.Body != nil {
+		r.Body.Reason = strings.TrimSpace(r.Body.Reason)
+	}
+
+	return nil
+}
+
+// overlappingReservations returns the confirmed reservations of a resource which overlap a slot.
+func (app *Application) overlappingReservations(ctx context.Context, resourceID string, slot booking.Slot) ([]data.Reservation, error) {
+	filter := data.ReservationFilter{
+		ResourceID:   &resourceID,
+		Status:       ptr(data.ReservationStatusConfirmed),
+		StartsBefore: &slot.End,
+		EndsAfter:    &slot.Start,
+	}
+
+	reservations, _, err := app.Models.Reservations.GetAll(ctx, filter, data.Paginator{}, data.Sorter{})
+	return reservations, err
+}
+
+// validateReservationSlot checks that a slot can be reserved at now: it is made of whole slots
+// within the opening hours of a day, is not too long, and starts in the future within the days
+// which can be reserved ahead.
+func (app *Application) validateReservationSlot(slot booking.Slot, now time.Time) error {
+	if !app.booking.hours.Fits(slot, app.location, app.booking.slot) {
+		opens, closes := app.booking.hours.Day(slot.Start, app.location)
+		return huma.Error422UnprocessableEntity(fmt.Sprintf(errReservationSlotsMsg, app.booking.slot, opens.Format("15:04"), closes.Format("15:04")))
+	}
+
+	if slot.Duration() > app.booking.maxDuration {
+		return huma.Error422UnprocessableEntity(fmt.Sprintf(errReservationTooLongMsg, app.booking.maxDuration))
+	}
+
+	if !slot.Start.After(now) {
+		return huma.Error422UnprocessableEntity(errReservationPastMsg)
+	}
+
+	if slot.End.After(app.bookingHorizon(now)) {
+		return huma.Error422UnprocessableEntity(fmt.Sprintf(errReservationHorizonMsg, app.booking.horizonDays))
+	}
+
+	return nil
+}
+
+// createReservationHandler reserves a resource for the authenticated patron. The reservation is
+// checked against the confirmed reservations of the resource, and the resource is updated, in the
+// same transaction. Concurrent reservations of a resource therefore conflict on its version, so
+// that one of them sees the other and fails, instead of both being confirmed.
+func (app *Application) createReservationHandler(ctx context.Context, input *CreateReservationInput) (*CreateReservationOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	patron, ok := patronFromContext(ctx)
+	if !ok {
+		return &CreateReservationOutput{}, huma.Error403Forbidden(errReservationPatronOnlyMsg)
+	}
+
+	now := time.Now()
+	slot := booking.Slot{Start: input.Body.StartsAt, End: input.Body.EndsAt}
+	if err := app.validateReservationSlot(slot, now); err != nil {
+		return &CreateReservationOutput{}, err
+	}
+
+	var reservation *data.Reservation
+	var resource *data.Resource
+
+	err := app.Models.Transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+
+		resource, err = app.Models.Resources.Get(ctx, data.ResourceFilter{ID: &input.ID})
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrDocumentNotFound):
+				return huma.Error404NotFound(errNotFoundMsg)
+			default:
+				return err
+			}
+		}
+
+		if !resource.Active {
+			return huma.Error422UnprocessableEntity(errResourceInactiveMsg)
+		}
+
+		if app.booking.maxReservations > 0 {
+			upcoming, _, err := app.Models.Reservations.GetAll(ctx, data.ReservationFilter{
+				PatronID:  &patron.ID,
+				Status:    ptr(data.ReservationStatusConfirmed),
+				EndsAfter: &now,
+			}, data.Paginator{}, data.Sorter{})
+			if err != nil {
+				return err
+			}
+			if len(upcoming) >= app.booking.maxReservations {
+				return huma.Error422UnprocessableEntity(fmt.Sprintf(errReservationMaximumMsg, app.booking.maxReservations))
+			}
+		}
+
+		overlapping, err := app.overlappingReservations(ctx, resource.ID, slot)
+		if err != nil {
+			return err
+		}
+		if len(overlapping) > 0 {
+			return huma.Error409Conflict(errReservationConflictMsg)
+		}
+
+		reservation = &data.Reservation{
+			ResourceID: resource.ID,
+			PatronID:   patron.ID,
+			StartsAt:   slot.Start,
+			EndsAt:     slot.End,
+			Purpose:    input.Body.Purpose,
+			Status:     data.ReservationStatusConfirmed,
+		}
+
+		reservation.ID, err = app.Models.Reservations.Insert(ctx, reservation)
+		if err != nil {
+			return err
+		}
+
+		if err = app.Models.Resources.Update(ctx, data.ResourceFilter{ID: &resource.ID}, resource); err != nil {
+			switch {
+			case errors.Is(err, data.ErrEditConflict):
+				return huma.Error409Conflict(errConflictMsg)
+			default:
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return &CreateReservationOutput{}, app.transactionError(ctx, err)
+	}
+
+	app.sendReservationNotification(ctx, reservation, resource, mailer.ReservationConfirmedTemplate)
+
+	resp := &CreateReservationOutput{
+		Body:     *reservation,
+		Location: fmt.Sprintf("%s/%s/%s", basePath, reservationsKey, reservation.ID),
+	}
+
+	return resp, nil
+}
+
+// getReservationHandler fetches a reservation by its ID.
+func (app *Application) getReservationHandler(ctx context.Context, input *GetReservationInput) (*ReservationOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	reservation, err := app.Models.Reservations.Get(ctx, data.ReservationFilter{ID: &input.ID})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return &ReservationOutput{}, huma.Error404NotFound(errNotFoundMsg)
+		default:
+			return &ReservationOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	resp := &ReservationOutput{
+		Body: *reservation,
+	}
+
+	return resp, nil
+}
+
+// getReservationsHandler fetches reservations with pagination, filtering and sorting.
+func (app *Application) getReservationsHandler(ctx context.Context, input *GetReservationsInput) (*GetReservationsOutput, error) {
+	filter := data.ReservationFilter{}
+	if input.ResourceID != "" {
+		filter.ResourceID = &input.ResourceID
+	}
+	if input.PatronID != "" {
+		filter.PatronID = &input.PatronID
+	}
+	if input.Status != "" {
+		filter.Status = &input.Status
+	}
+
+	return app.getReservations(ctx, filter, input.PaginationInput, input.Sort)
+}
+
+// getMyReservationsHandler fetches the reservations of the authenticated patron, by default from the latest.
+func (app *Application) getMyReservationsHandler(ctx context.Context, input *GetMyReservationsInput) (*GetReservationsOutput, error) {
+	patron, ok := patronFromContext(ctx)
+	if !ok {
+		return &GetReservationsOutput{}, huma.Error403Forbidden(errReservationPatronOnlyMsg)
+	}
+
+	filter := data.ReservationFilter{PatronID: &patron.ID}
+	if input.Status != "" {
+		filter.Status = &input.Status
+	}
+
+	return app.getReservations(ctx, filter, input.PaginationInput, input.Sort)
+}
+
+// getReservations fetches the reservations matching filter with pagination and sorting.
+func (app *Application) getReservations(ctx context.Context, filter data.ReservationFilter, pagination PaginationInput, sort string) (*GetReservationsOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	paginator := data.Paginator{Page: pagination.Page, PageSize: pagination.PageSize}
+	sorter := data.Sorter{Field: sort, SortSafelist: supportedReservationsSortFields, Collation: app.collation}
+
+	reservations, metadata, err := app.Models.Reservations.GetAll(ctx, filter, paginator, sorter)
+	if err != nil {
+		return &GetReservationsOutput{}, app.serverError(ctx, err)
+	}
+
+	resp := &GetReservationsOutput{
+		Body: ReservationsInfo{
+			Reservations: reservations,
+			Metadata:     metadata,
+		},
+	}
+
+	return resp, nil
+}
+
+// cancelMyReservationHandler cancels a reservation of the authenticated patron.
+func (app *Application) cancelMyReservationHandler(ctx context.Context, input *CancelReservationInput) (*ReservationOutput, error) {
+	patron, ok := patronFromContext(ctx)
+	if !ok {
+		return &ReservationOutput{}, huma.Error403Forbidden(errReservationPatronOnlyMsg)
+	}
+
+	return app.cancelReservation(ctx, data.ReservationFilter{ID: &input.ID, PatronID: &patron.ID}, "", "")
+}
+
+// cancelReservationHandler cancels a reservation of any patron, with the reason which is sent to them.
+func (app *Application) cancelReservationHandler(ctx context.Context, input *CancelReservationInput) (*ReservationOutput, error) {
+	admin, ok := adminFromContext(ctx)
+	if !ok {
+		return &ReservationOutput{}, app.serverError(ctx, errors.New("no admin in the context of an admin request"))
+	}
+
+	var reason string
+	if input.Body != nil {
+		reason = input.Body.Reason
+	}
+
+	return app.cancelReservation(ctx, data.ReservationFilter{ID: &input.ID}, admin.Name, reason)
+}
+
+// cancelReservation cancels the confirmed reservation matching filter, which has not ended, and
+// notifies its patron. canceledBy is the name of the admin who canceled it, or empty if it was
+// canceled by its patron.
+func (app *Application) cancelReservation(ctx context.Context, filter data.ReservationFilter, canceledBy, reason string) (*ReservationOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	reservation, err := app.Models.Reservations.Get(ctx, filter)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return &ReservationOutput{}, huma.Error404NotFound(errNotFoundMsg)
+		default:
+			return &ReservationOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	now := time.Now()
+	if reservation.Status != data.ReservationStatusConfirmed || !reservation.EndsAt.After(now) {
+		return &ReservationOutput{}, huma.Error422UnprocessableEntity(errReservationNotCanceledMsg)
+	}
+
+	reservation.Status = data.ReservationStatusCanceled
+	reservation.CanceledBy = canceledBy
+	reservation.Reason = reason
+	reservation.CanceledAt = now
+
+	if err = app.Models.Reservations.Update(ctx, data.ReservationFilter{ID: &reservation.ID}, reservation); err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			return &ReservationOutput{}, huma.Error409Conflict(errConflictMsg)
+		default:
+			return &ReservationOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	resource, err := app.Models.Resources.Get(ctx, data.ResourceFilter{ID: &reservation.ResourceID})
+	if err != nil {
+		return &ReservationOutput{}, app.serverError(ctx, err)
+	}
+
+	app.sendReservationNotification(ctx, reservation, resource, mailer.ReservationCanceledTemplate)
+
+	resp := &ReservationOutput{
+		Body: *reservation,
+	}
+
+	return resp, nil
+}
+
+// sendReservationNotification notifies the patron of a reservation that it was confirmed or
+// canceled, in the background.
+func (app *Application) sendReservationNotification(ctx context.Context, reservation *data.Reservation, resource *data.Resource, template string) {
+	reservationData := mailer.ReservationData{
+		Resource: resource.Name,
+		StartsAt: reservation.StartsAt.In(app.location),
+		EndsAt:   reservation.EndsAt.In(app.location),
+		Reason:   reservation.Reason,
+	}
+	patronID := reservation.PatronID
+
+	app.background(ctx, func(ctx context.Context) {
+		ctx, cancel := context.WithTimeout(ctx, emailTimeout)
+		defer cancel()
+
+		patron, err := app.Models.Patrons.Get(ctx, data.PatronFilter{ID: ptr(data.PatronID(patronID))})
+		if err == nil {
+			reservationData.Name = patron.Name
+			_, err = app.notifyPatron(ctx, patron, template, reservationData)
+		}
+		if err != nil {
+			app.requestLogger(ctx).Error("failed to send reservation notification", slog.String("template", template), slog.Any("error", err))
+			app.reportError(ctx, err)
+		}
+	})
+}
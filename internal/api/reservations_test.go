@@ -0,0 +1,208 @@
+package api_test
+
+import (
+	"github.com/mzeevi/library/internal/api"
+	"github.com/mzeevi/library/internal/api/apitest"
+	"github.com/mzeevi/library/internal/auth"
+	"github.com/mzeevi/library/internal/data"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// seedResource creates an active resource as an admin, returning its ID.
+func seedResource(t *testing.T, a *apitest.API, admin, name string) string {
+	t.Helper()
+
+	rec := a.Do(http.MethodPost, "/resources", admin, map[string]any{"name": name, "kind": "room", "branch": "Main", "capacity": 4})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("create resource status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	var resource data.Resource
+	a.Decode(rec, &resource)
+
+	return resource.ID
+}
+
+// tomorrowAt returns the time of day of tomorrow in UTC, the timezone of the test library.
+func tomorrowAt(hour, minute int) time.Time {
+	year, month, day := time.Now().UTC().AddDate(0, 0, 1).Date()
+	return time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+}
+
+func TestCreateReservation(t *testing.T) {
+	a := apitest.New(t, func(app *api.Application) {
+		app.Config.Booking.MaxReservations = 2
+	})
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+	patron := a.PatronAuth(a.SeedPatron(apitest.Patron("reader@example.com", auth.ReadBooksPermission, auth.ReadPatronPermission)))
+	other := a.PatronAuth(a.SeedPatron(apitest.Patron("other@example.com", auth.ReadBooksPermission)))
+
+	room := seedResource(t, a, admin, "Study Room 1")
+	closed := seedResource(t, a, admin, "Study Room 2")
+	if rec := a.Do(http.MethodPut, "/resources/"+closed, admin, map[string]any{"active": false}); rec.Code != http.StatusOK {
+		t.Fatalf("deactivate resource status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	yesterday := tomorrowAt(10, 0).AddDate(0, 0, -2)
+
+	tests := []struct {
+		name       string
+		auth       string
+		resource   string
+		startsAt   time.Time
+		endsAt     time.Time
+		wantStatus int
+	}{
+		{name: "two slots", auth: patron, resource: room, startsAt: tomorrowAt(10, 0), endsAt: tomorrowAt(11, 0), wantStatus: http.StatusOK},
+		{name: "overlapping", auth: other, resource: room, startsAt: tomorrowAt(10, 30), endsAt: tomorrowAt(11, 30), wantStatus: http.StatusConflict},
+		{name: "adjacent", auth: other, resource: room, startsAt: tomorrowAt(11, 0), endsAt: tomorrowAt(12, 0), wantStatus: http.StatusOK},
+		{name: "off the slot boundaries", auth: patron, resource: room, startsAt: tomorrowAt(13, 15), endsAt: tomorrowAt(13, 45), wantStatus: http.StatusUnprocessableEntity},
+		{name: "after closing", auth: patron, resource: room, startsAt: tomorrowAt(20, 30), endsAt: tomorrowAt(21, 30), wantStatus: http.StatusUnprocessableEntity},
+		{name: "too long", auth: patron, resource: room, startsAt: tomorrowAt(12, 0), endsAt: tomorrowAt(16, 30), wantStatus: http.StatusUnprocessableEntity},
+		{name: "ends before it starts", auth: patron, resource: room, startsAt: tomorrowAt(13, 0), endsAt: tomorrowAt(12, 0), wantStatus: http.StatusUnprocessableEntity},
+		{name: "in the past", auth: patron, resource: room, startsAt: yesterday, endsAt: yesterday.Add(time.Hour), wantStatus: http.StatusUnprocessableEntity},
+		{name: "beyond the horizon", auth: patron, resource: room, startsAt: tomorrowAt(10, 0).AddDate(0, 0, 30), endsAt: tomorrowAt(11, 0).AddDate(0, 0, 30), wantStatus: http.StatusUnprocessableEntity},
+		{name: "inactive resource", auth: patron, resource: closed, startsAt: tomorrowAt(10, 0), endsAt: tomorrowAt(11, 0), wantStatus: http.StatusUnprocessableEntity},
+		{name: "unknown resource", auth: patron, resource: "000000000000000000000000", startsAt: tomorrowAt(10, 0), endsAt: tomorrowAt(11, 0), wantStatus: http.StatusNotFound},
+		{name: "by an admin", auth: admin, resource: room, startsAt: tomorrowAt(15, 0), endsAt: tomorrowAt(16, 0), wantStatus: http.StatusForbidden},
+		{name: "second upcoming", auth: patron, resource: room, startsAt: tomorrowAt(14, 0), endsAt: tomorrowAt(15, 0), wantStatus: http.StatusOK},
+		{name: "over the maximum", auth: patron, resource: room, startsAt: tomorrowAt(16, 0), endsAt: tomorrowAt(17, 0), wantStatus: http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := map[string]any{"starts_at": tt.startsAt, "ends_at": tt.endsAt, "purpose": "Group study"}
+			rec := a.Do(http.MethodPost, "/resources/"+tt.resource+"/reservations", tt.auth, body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %v; want %v (body: %s)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+		})
+	}
+
+	rec := a.Do(http.MethodGet, "/patrons/me/reservations?sort=starts_at", patron)
+	var info api.ReservationsInfo
+	a.Decode(rec, &info)
+	if len(info.Reservations) != 2 || !info.Reservations[0].StartsAt.Equal(tomorrowAt(10, 0)) || info.Reservations[0].Status != data.ReservationStatusConfirmed {
+		t.Errorf("reservations of the patron = %+v; want the two confirmed reservations", info.Reservations)
+	}
+}
+
+func TestCreateReservationConcurrently(t *testing.T) {
+	a := apitest.New(t)
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+	room := seedResource(t, a, admin, "Study Room 1")
+
+	const patrons = 8
+	auths := make([]string, patrons)
+	for i := range auths {
+		auths[i] = a.PatronAuth(a.SeedPatron(apitest.Patron(string(rune('a'+i))+"@example.com", auth.ReadBooksPermission)))
+	}
+
+	var wg sync.WaitGroup
+	codes := make([]int, patrons)
+	for i, patron := range auths {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			// Each patron reserves a different span of the same slot, so that all of them overlap.
+			body := map[string]any{"starts_at": tomorrowAt(10, 0).Add(-time.Duration(i%2) * 30 * time.Minute), "ends_at": tomorrowAt(10, 30)}
+			codes[i] = a.Do(http.MethodPost, "/resources/"+room+"/reservations", patron, body).Code
+		}()
+	}
+	wg.Wait()
+
+	confirmed := 0
+	for _, code := range codes {
+		switch code {
+		case http.StatusOK:
+			confirmed++
+		case http.StatusConflict:
+		default:
+			t.Errorf("concurrent reservation status = %v; want %v or %v", code, http.StatusOK, http.StatusConflict)
+		}
+	}
+	if confirmed != 1 {
+		t.Errorf("confirmed concurrent reservations = %d; want 1", confirmed)
+	}
+
+	var info api.ReservationsInfo
+	a.Decode(a.Do(http.MethodGet, "/reservations?status=confirmed&resource_id="+room, admin), &info)
+	if len(info.Reservations) != 1 {
+		t.Errorf("confirmed reservations of the resource = %d; want 1", len(info.Reservations))
+	}
+}
+
+func TestCancelReservation(t *testing.T) {
+	a := apitest.New(t)
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+	patron := a.PatronAuth(a.SeedPatron(apitest.Patron("reader@example.com", auth.ReadBooksPermission)))
+	other := a.PatronAuth(a.SeedPatron(apitest.Patron("other@example.com", auth.ReadBooksPermission)))
+	room := seedResource(t, a, admin, "Study Room 1")
+
+	reserve := func(hour int) string {
+		t.Helper()
+
+		body := map[string]any{"starts_at": tomorrowAt(hour, 0), "ends_at": tomorrowAt(hour+1, 0)}
+		rec := a.Do(http.MethodPost, "/resources/"+room+"/reservations", patron, body)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("create reservation status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+		}
+
+		var reservation data.Reservation
+		a.Decode(rec, &reservation)
+
+		return reservation.ID
+	}
+
+	mine, closure := reserve(10), reserve(12)
+
+	tests := []struct {
+		name       string
+		auth       string
+		path       string
+		body       []any
+		wantStatus int
+		wantBy     string
+	}{
+		{name: "by another patron", auth: other, path: "/patrons/me/reservations/" + mine + "/cancel", wantStatus: http.StatusNotFound},
+		{name: "by the patron", auth: patron, path: "/patrons/me/reservations/" + mine + "/cancel", wantStatus: http.StatusOK},
+		{name: "again", auth: patron, path: "/patrons/me/reservations/" + mine + "/cancel", wantStatus: http.StatusUnprocessableEntity},
+		{name: "by a patron on the admin route", auth: patron, path: "/reservations/" + closure + "/cancel", wantStatus: http.StatusForbidden},
+		{name: "by an admin", auth: admin, path: "/reservations/" + closure + "/cancel", body: []any{map[string]any{"reason": "Closed for maintenance"}}, wantStatus: http.StatusOK, wantBy: "admin"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := a.Do(http.MethodPost, tt.path, append([]any{tt.auth}, tt.body...)...)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %v; want %v (body: %s)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var reservation data.Reservation
+			a.Decode(rec, &reservation)
+			if reservation.Status != data.ReservationStatusCanceled || reservation.CanceledBy != tt.wantBy || reservation.CanceledAt.IsZero() {
+				t.Errorf("reservation = %+v; want it canceled by %q", reservation, tt.wantBy)
+			}
+		})
+	}
+
+	rec := a.Do(http.MethodGet, "/reservations/"+closure, admin)
+	var reservation data.Reservation
+	a.Decode(rec, &reservation)
+	if reservation.Reason != "Closed for maintenance" {
+		t.Errorf("reason = %q; want Closed for maintenance", reservation.Reason)
+	}
+
+	// The canceled slots can be reserved again.
+	reserve(10)
+}
@@ -0,0 +1,372 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/mzeevi/library/internal/booking"
+	"github.com/mzeevi/library/internal/data"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	errInvalidAvailabilityDateMsg = "date must be a day in the format YYYY-MM-DD"
+)
+
+type CreateResourceInput struct {
+	Body struct {
+		Name        string `json:"name" minLength:"1" maxLength:"200" doc:"Name of the resource, such as Study Room 2 or Laptop 7"`
+		Kind        string `json:"kind" enum:"room,equipment"`
+		Branch      string `json:"branch,omitempty" required:"false" maxLength:"200" doc:"Branch at which the resource is used or picked up"`
+		Description string `json:"description,omitempty" required:"false" maxLength:"1000"`
+		Capacity    int    `json:"capacity,omitempty" required:"false" minimum:"0" doc:"Number of people a room seats"`
+	}
+}
+
+type CreateResourceOutput struct {
+	Location string        `header:"Location"`
+	Body     data.Resource `json:"resource"`
+}
+
+type GetResourceInput struct {
+	ID string `json:"id" path:"id"`
+}
+
+type ResourceOutput struct {
+	Body data.Resource `json:"resource"`
+}
+
+type GetResourcesInput struct {
+	PaginationInput
+	Kind   string `query:"kind" enum:"room,equipment" doc:"Filter by kind"`
+	Branch string `query:"branch" doc:"Filter by branch"`
+	Active string `query:"active" enum:"true,false" doc:"Only resources which can be reserved if true, or only resources which can't if false"`
+	Sort   string `query:"sort" enum:"name,-name,created_at,-created_at" default:"name"`
+}
+
+type GetResourcesOutput struct {
+	Body ResourcesInfo
+}
+
+type ResourcesInfo struct {
+	Resources []data.Resource `json:"resources"`
+	Metadata  data.Metadata   `json:"metadata"`
+}
+
+type UpdateResourceInput struct {
+	ID   string `json:"id" path:"id"`
+	Body struct {
+		Name        *string `json:"name,omitempty" minLength:"1" maxLength:"200"`
+		Kind        *string `json:"kind,omitempty" enum:"room,equipment"`
+		Branch      *string `json:"branch,omitempty" maxLength:"200"`
+		Description *string `json:"description,omitempty" maxLength:"1000"`
+		Capacity    *int    `json:"capacity,omitempty" minimum:"0"`
+		Active      *bool   `json:"active,omitempty" doc:"Whether the resource can be reserved. Its reservations are kept when it can't"`
+	}
+}
+
+type GetResourceAvailabilityInput struct {
+	ID   string `json:"id" path:"id"`
+	Date string `query:"date" doc:"Day in the format YYYY-MM-DD, in the timezone of the library. Today by default"`
+}
+
+type GetResourceAvailabilityOutput struct {
+	Body ResourceAvailability
+}
+
+// ResourceAvailability is the calendar of a resource on a day, made of the slots in which it can
+// be reserved between its opening and its closing.
+type ResourceAvailability struct {
+	ResourceID string             `json:"resource_id"`
+	Date       string             `json:"date"`
+	Opens      time.Time          `json:"opens"`
+	Closes     time.Time          `json:"closes"`
+	Slots      []AvailabilitySlot `json:"slots"`
+}
+
+// AvailabilitySlot is a slot of a day of a resource. It is not available if it was reserved, has
+// started, or is beyond the days which can be reserved ahead.
+type AvailabilitySlot struct {
+	StartsAt  time.Time `json:"starts_at"`
+	EndsAt    time.Time `json:"ends_at"`
+	Available bool      `json:"available"`
+}
+
+// Resolve validates the input in CreateResourceInput.
+func (r *CreateResourceInput) Resolve(ctx huma.Context) []error {
+	r.Body.Name = strings.TrimSpace(r.Body.Name)
+	r.Body.Branch = strings.TrimSpace(r.Body.Branch)
+	r.Body.Description = strings.TrimSpace(r.Body.Description)
+
+	if r.Body.Name == "" {
+		return []error{&huma.ErrorDetail{
+			Location: "body.name",
+			Message:  "Name must not be empty",
+			Value:    r.Body.Name,
+		}}
+	}
+
+	return nil
+}
+
+// Resolve validates the input in GetResourceInput.
+func (r *GetResourceInput) Resolve(ctx huma.Context) []error {
+	if err := validateID(&r.ID, "path.id"); err != nil {
+		return []error{err}
+	}
+
+	return nil
+}
+
+// Resolve validates the input in UpdateResourceInput.
+func (r *UpdateResourceInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	if err := validateID(&r.ID, "path.id"); err != nil {
+		errs = append(errs, err)
+	}
+
+	if r.Body.Name != nil {
+		*r.Body.Name = strings.TrimSpace(*r.Body.Name)
+		if *r.Body.Name == "" {
+			errs = append(errs, &huma.ErrorDetail{
+				Location: "body.name",
+				Message:  "Name must not be empty",
+				Value:    *r.Body.Name,
+			})
+		}
+	}
+
+	return errs
+}
+
+// Resolve validates the input in GetResourceAvailabilityInput.
+func (r *GetResourceAvailabilityInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	if err := validateID(&r.ID, "path.id"); err != nil {
+		errs = append(errs, err)
+	}
+
+	if r.Date != "" {
+		if _, err := time.Parse(time.DateOnly, r.Date); err != nil {
+			errs = append(errs, &huma.ErrorDetail{
+				Location: "query.date",
+				Message:  errInvalidAvailabilityDateMsg,
+				Value:    r.Date,
+			})
+		}
+	}
+
+	return errs
+}
+
+// createResourceHandler handles a request to add a room or an item of equipment which patrons can reserve.
+func (app *Application) createResourceHandler(ctx context.Context, input *CreateResourceInput) (*CreateResourceOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	resource := &data.Resource{
+		Name:        input.Body.Name,
+		Kind:        input.Body.Kind,
+		Branch:      input.Body.Branch,
+		Description: input.Body.Description,
+		Capacity:    input.Body.Capacity,
+		Active:      true,
+	}
+
+	id, err := app.Models.Resources.Insert(ctx, resource)
+	if err != nil {
+		return &CreateResourceOutput{}, app.serverError(ctx, err)
+	}
+	resource.ID = id
+
+	resp := &CreateResourceOutput{
+		Body:     *resource,
+		Location: fmt.Sprintf("%s/%s/%s", basePath, resourcesKey, id),
+	}
+
+	return resp, nil
+}
+
+// getResourceHandler fetches a resource by its ID.
+func (app *Application) getResourceHandler(ctx context.Context, input *GetResourceInput) (*ResourceOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	resource, err := app.Models.Resources.Get(ctx, data.ResourceFilter{ID: &input.ID})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return &ResourceOutput{}, huma.Error404NotFound(errNotFoundMsg)
+		default:
+			return &ResourceOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	resp := &ResourceOutput{
+		Body: *resource,
+	}
+
+	return resp, nil
+}
+
+// getResourcesHandler fetches resources with pagination, filtering and sorting.
+func (app *Application) getResourcesHandler(ctx context.Context, input *GetResourcesInput) (*GetResourcesOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	paginator := data.Paginator{Page: input.Page, PageSize: input.PageSize}
+	sorter := data.Sorter{Field: input.Sort, SortSafelist: supportedResourcesSortFields, Collation: app.collation}
+
+	filter := data.ResourceFilter{}
+	if input.Kind != "" {
+		filter.Kind = &input.Kind
+	}
+	if input.Branch != "" {
+		filter.Branch = &input.Branch
+	}
+	if input.Active != "" {
+		active, _ := strconv.ParseBool(input.Active)
+		filter.Active = &active
+	}
+
+	resources, metadata, err := app.Models.Resources.GetAll(ctx, filter, paginator, sorter)
+	if err != nil {
+		return &GetResourcesOutput{}, app.serverError(ctx, err)
+	}
+
+	resp := &GetResourcesOutput{
+		Body: ResourcesInfo{
+			Resources: resources,
+			Metadata:  metadata,
+		},
+	}
+
+	return resp, nil
+}
+
+// updateResourceHandler updates the fields of a resource. A resource which is deactivated can't be
+// reserved, but its confirmed reservations are kept, and are canceled by admins one by one.
+func (app *Application) updateResourceHandler(ctx context.Context, input *UpdateResourceInput) (*ResourceOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	resource, err := app.Models.Resources.Get(ctx, data.ResourceFilter{ID: &input.ID})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return &ResourceOutput{}, huma.Error404NotFound(errNotFoundMsg)
+		default:
+			return &ResourceOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	if input.Body.Name != nil {
+		resource.Name = *input.Body.Name
+	}
+	if input.Body.Kind != nil {
+		resource.Kind = *input.Body.Kind
+	}
+	if input.Body.Branch != nil {
+		resource.Branch = strings.TrimSpace(*input.Body.Branch)
+	}
+	if input.Body.Description != nil {
+		resource.Description = strings.TrimSpace(*input.Body.Description)
+	}
+	if input.Body.Capacity != nil {
+		resource.Capacity = *input.Body.Capacity
+	}
+	if input.Body.Active != nil {
+		resource.Active = *input.Body.Active
+	}
+
+	if err = app.Models.Resources.Update(ctx, data.ResourceFilter{ID: &resource.ID}, resource); err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			return &ResourceOutput{}, huma.Error409Conflict(errConflictMsg)
+		default:
+			return &ResourceOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	resp := &ResourceOutput{
+		Body: *resource,
+	}
+
+	return resp, nil
+}
+
+// getResourceAvailabilityHandler returns the slots of a resource on a day, and which of them can
+// still be reserved.
+func (app *Application) getResourceAvailabilityHandler(ctx context.Context, input *GetResourceAvailabilityInput) (*GetResourceAvailabilityOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	now := time.Now()
+	day := now
+	if input.Date != "" {
+		date, err := time.ParseInLocation(time.DateOnly, input.Date, app.location)
+		if err != nil {
+			return &GetResourceAvailabilityOutput{}, huma.Error422UnprocessableEntity(errInvalidAvailabilityDateMsg)
+		}
+		day = date
+	}
+
+	resource, err := app.Models.Resources.Get(ctx, data.ResourceFilter{ID: &input.ID})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return &GetResourceAvailabilityOutput{}, huma.Error404NotFound(errNotFoundMsg)
+		default:
+			return &GetResourceAvailabilityOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	opens, closes := app.booking.hours.Day(day, app.location)
+	reserved, err := app.overlappingReservations(ctx, resource.ID, booking.Slot{Start: opens, End: closes})
+	if err != nil {
+		return &GetResourceAvailabilityOutput{}, app.serverError(ctx, err)
+	}
+
+	availability := ResourceAvailability{
+		ResourceID: resource.ID,
+		Date:       opens.Format(time.DateOnly),
+		Opens:      opens,
+		Closes:     closes,
+		Slots:      make([]AvailabilitySlot, 0),
+	}
+
+	horizon := app.bookingHorizon(now)
+	for _, slot := range app.booking.hours.Slots(day, app.location, app.booking.slot) {
+		available := resource.Active && slot.Start.After(now) && !slot.End.After(horizon)
+		for _, reservation := range reserved {
+			if slot.Overlaps(booking.Slot{Start: reservation.StartsAt, End: reservation.EndsAt}) {
+				available = false
+				break
+			}
+		}
+
+		availability.Slots = append(availability.Slots, AvailabilitySlot{
+			StartsAt:  slot.Start,
+			EndsAt:    slot.End,
+			Available: available,
+		})
+	}
+
+	resp := &GetResourceAvailabilityOutput{
+		Body: availability,
+	}
+
+	return resp, nil
+}
+
+// bookingHorizon returns the time until which resources can be reserved at now, which is the
+// end of the last day which can be reserved ahead.
+func (app *Application) bookingHorizon(now time.Time) time.Time {
+	year, month, day := now.In(app.location).Date()
+	return time.Date(year, month, day+app.booking.horizonDays+1, 0, 0, 0, 0, app.location)
+}
@@ -0,0 +1,79 @@
+package api_test
+
+import (
+	"github.com/mzeevi/library/internal/api"
+	"github.com/mzeevi/library/internal/api/apitest"
+	"github.com/mzeevi/library/internal/auth"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestResourceAvailability(t *testing.T) {
+	a := apitest.New(t, func(app *api.Application) {
+		app.Config.Booking.Opens = "09:00"
+		app.Config.Booking.Closes = "12:00"
+		app.Config.Booking.Slot = time.Hour
+	})
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+	patron := a.PatronAuth(a.SeedPatron(apitest.Patron("reader@example.com", auth.ReadBooksPermission)))
+	room := seedResource(t, a, admin, "Study Room 1")
+
+	body := map[string]any{"starts_at": tomorrowAt(10, 0), "ends_at": tomorrowAt(11, 0)}
+	if rec := a.Do(http.MethodPost, "/resources/"+room+"/reservations", patron, body); rec.Code != http.StatusOK {
+		t.Fatalf("create reservation status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	date := tomorrowAt(0, 0).Format(time.DateOnly)
+	rec := a.Do(http.MethodGet, "/resources/"+room+"/availability?date="+date, patron)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("availability status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	var availability api.ResourceAvailability
+	a.Decode(rec, &availability)
+	if availability.Date != date || !availability.Opens.Equal(tomorrowAt(9, 0)) || !availability.Closes.Equal(tomorrowAt(12, 0)) {
+		t.Errorf("availability of %s = %s from %v to %v; want %s from 09:00 to 12:00", date, availability.Date, availability.Opens, availability.Closes, date)
+	}
+
+	want := []bool{true, false, true}
+	if len(availability.Slots) != len(want) {
+		t.Fatalf("slots = %+v; want %d slots", availability.Slots, len(want))
+	}
+	for i, slot := range availability.Slots {
+		if !slot.StartsAt.Equal(tomorrowAt(9+i, 0)) || slot.Available != want[i] {
+			t.Errorf("slot %d = %+v; want it at %d:00 with available %v", i, slot, 9+i, want[i])
+		}
+	}
+
+	// The slots of a resource which can't be reserved are all unavailable.
+	if rec = a.Do(http.MethodPut, "/resources/"+room, admin, map[string]any{"active": false}); rec.Code != http.StatusOK {
+		t.Fatalf("deactivate resource status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	a.Decode(a.Do(http.MethodGet, "/resources/"+room+"/availability?date="+date, patron), &availability)
+	for i, slot := range availability.Slots {
+		if slot.Available {
+			t.Errorf("slot %d of an inactive resource is available; want unavailable", i)
+		}
+	}
+
+	var info api.ResourcesInfo
+	a.Decode(a.Do(http.MethodGet, "/resources?active=false&kind=room", patron), &info)
+	if len(info.Resources) != 1 || info.Resources[0].ID != room {
+		t.Errorf("inactive rooms = %+v; want the deactivated room", info.Resources)
+	}
+
+	for query, wantStatus := range map[string]int{
+		"/resources/" + room + "/availability?date=tomorrow":            http.StatusUnprocessableEntity,
+		"/resources/000000000000000000000000/availability?date=" + date: http.StatusNotFound,
+	} {
+		if rec = a.Do(http.MethodGet, query, patron); rec.Code != wantStatus {
+			t.Errorf("GET %s status = %v; want %v", query, rec.Code, wantStatus)
+		}
+	}
+
+	if rec = a.Do(http.MethodPost, "/resources", patron, map[string]any{"name": "Laptop 1", "kind": "equipment"}); rec.Code != http.StatusForbidden {
+		t.Errorf("create resource by a patron status = %v; want %v", rec.Code, http.StatusForbidden)
+	}
+}
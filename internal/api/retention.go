@@ -0,0 +1,181 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"github.com/mzeevi/library/internal/data"
+	"log/slog"
+	"slices"
+	"time"
+)
+
+// Modes of the retention policy, by which the history of returned transactions past the
+// retention period is either unlinked from the patrons or deleted.
+const (
+	RetentionAnonymize = "anonymize"
+	RetentionDelete    = "delete"
+)
+
+// defaultRetentionInterval is the interval between runs of the retention policy when none is configured.
+const defaultRetentionInterval = 24 * time.Hour
+
+// retentionBatchSize is the most transactions which are read, anonymized or deleted in one query.
+const retentionBatchSize = 500
+
+// retentionSortField is the field by which expired transactions are read in batches.
+const retentionSortField = "_id"
+
+type ApplyRetentionInput struct {
+	DryRun bool `query:"dry_run" doc:"Only count the transactions past the retention period, without anonymizing or deleting them"`
+}
+
+type ApplyRetentionOutput struct {
+	Body RetentionResult
+}
+
+// RetentionResult is the result of a run of the retention policy. Expired transactions were returned
+// before Cutoff, of which Kept have a fine which is outstanding, and Applied were anonymized or
+// deleted, by Mode, unless it was a DryRun.
+type RetentionResult struct {
+	Mode    string    `json:"mode"`
+	DryRun  bool      `json:"dry_run"`
+	Cutoff  time.Time `json:"cutoff"`
+	Expired int       `json:"expired"`
+	Kept    int       `json:"kept"`
+	Applied int64     `json:"applied"`
+}
+
+// setupRetention validates the retention policy, unless no retention period is configured.
+func (app *Application) setupRetention() error {
+	cfg := app.Config.Retention
+
+	if cfg.Years < 0 {
+		return fmt.Errorf("invalid retention period of %d years", cfg.Years)
+	}
+	if cfg.Years == 0 {
+		return nil
+	}
+
+	if cfg.Mode != RetentionAnonymize && cfg.Mode != RetentionDelete {
+		return fmt.Errorf("invalid retention mode %q, it must be %s or %s", cfg.Mode, RetentionAnonymize, RetentionDelete)
+	}
+
+	return nil
+}
+
+// scheduleRetention applies the retention policy every interval until ctx is canceled, unless no
+// retention period is configured.
+func (app *Application) scheduleRetention(ctx context.Context) {
+	if app.Config.Retention.Years == 0 {
+		return
+	}
+
+	interval := app.Config.Retention.Interval
+	if interval <= 0 {
+		interval = defaultRetentionInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		retentionCtx, cancel := context.WithTimeout(ctx, reportTimeout)
+		if _, err := app.ApplyRetention(retentionCtx, time.Now(), app.Config.Retention.DryRun); err != nil {
+			app.logger.Error("failed to apply the retention policy", slog.Any("error", err))
+		}
+		cancel()
+	}
+}
+
+// ApplyRetention anonymizes or deletes the returned transactions which were returned more than the
+// retention period before now, and returns how many were. Transactions whose fine is outstanding
+// are kept until it is paid. The circulation of books is counted as the loans are returned, so it
+// is kept when their transactions are deleted. A dry run only counts the transactions.
+func (app *Application) ApplyRetention(ctx context.Context, now time.Time, dryRun bool) (*RetentionResult, error) {
+	cfg := app.Config.Retention
+
+	result := &RetentionResult{
+		Mode:   cfg.Mode,
+		DryRun: dryRun,
+		Cutoff: now.AddDate(-cfg.Years, 0, 0),
+	}
+
+	filter := data.TransactionFilter{
+		Status:        ptr(data.TransactionStatusReturned),
+		MaxReturnedAt: &result.Cutoff,
+	}
+	if cfg.Mode == RetentionAnonymize {
+		filter.Anonymized = ptr(false)
+	}
+
+	// The expired transactions are read a batch at a time, sorted by ID so that pages do not overlap,
+	// and only applied once all were read, so that applying them does not shift the pages.
+	var ids []data.TransactionID
+	sorter := data.Sorter{Field: retentionSortField, SortSafelist: []string{retentionSortField}}
+	for page := int64(1); ; page++ {
+		transactions, metadata, err := app.Models.Transactions.GetAll(ctx, filter, data.Paginator{Page: page, PageSize: retentionBatchSize}, sorter)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, transaction := range transactions {
+			if fine := app.transactionFine(&transaction, now); fine.Amount > 0 && !fine.Paid {
+				result.Kept++
+				continue
+			}
+			ids = append(ids, data.TransactionID(transaction.ID))
+		}
+		result.Expired += len(transactions)
+
+		if page >= metadata.LastPage {
+			break
+		}
+	}
+
+	if !dryRun {
+		for batch := range slices.Chunk(ids, retentionBatchSize) {
+			filter.IDs = batch
+
+			var applied int64
+			var err error
+			if cfg.Mode == RetentionDelete {
+				applied, err = app.Models.Transactions.DeleteMany(ctx, filter)
+			} else {
+				applied, err = app.Models.Transactions.Anonymize(ctx, filter)
+			}
+			result.Applied += applied
+			if err != nil {
+				return result, err
+			}
+		}
+	}
+
+	app.logger.Info("applied the retention policy", slog.String("mode", result.Mode), slog.Bool("dry_run", dryRun),
+		slog.Time("cutoff", result.Cutoff), slog.Int("expired", result.Expired), slog.Int("kept", result.Kept), slog.Int64("applied", result.Applied))
+
+	return result, nil
+}
+
+// applyRetentionHandler handles a request of an admin to apply the retention policy now, or to
+// preview it with a dry run.
+func (app *Application) applyRetentionHandler(ctx context.Context, input *ApplyRetentionInput) (*ApplyRetentionOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), reportTimeout)
+	defer cancel()
+
+	result, err := app.ApplyRetention(ctx, time.Now(), input.DryRun || app.Config.Retention.DryRun)
+	if err != nil {
+		return nil, app.serverError(ctx, err)
+	}
+
+	resp := &ApplyRetentionOutput{
+		Body: *result,
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,140 @@
+package api_test
+
+import (
+	"context"
+	"github.com/mzeevi/library/internal/api"
+	"github.com/mzeevi/library/internal/api/apitest"
+	"github.com/mzeevi/library/internal/data"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestApplyRetention(t *testing.T) {
+	for _, mode := range []string{api.RetentionAnonymize, api.RetentionDelete} {
+		t.Run(mode, func(t *testing.T) {
+			a := apitest.New(t, func(app *api.Application) {
+				app.Config.Cost.OverdueFine = 2
+				app.Config.Retention.Years = 2
+				app.Config.Retention.Mode = mode
+			})
+			a.SeedAdmin("admin", "admin-password")
+			admin := apitest.AdminAuth("admin", "admin-password")
+
+			bookID := a.SeedBook(apitest.Book("9780306406157", 3))
+			patronID := a.SeedPatron(apitest.Patron("patron@example.com"))
+
+			returned := func(borrowedAt time.Time, loan time.Duration) *data.Transaction {
+				transaction := data.NewTransaction("", patronID, bookID, data.TransactionStatusReturned, borrowedAt, borrowedAt.Add(14*24*time.Hour))
+				transaction.ReturnedAt = borrowedAt.Add(loan)
+				return transaction
+			}
+			old := time.Now().AddDate(-3, 0, 0)
+			transactions := map[string]*data.Transaction{
+				"old":      returned(old, 7*24*time.Hour),
+				"old late": returned(old, 20*24*time.Hour),
+				"recent":   returned(time.Now().AddDate(0, -1, 0), 7*24*time.Hour),
+				"borrowed": data.NewTransaction("", patronID, bookID, data.TransactionStatusBorrowed, old, old.Add(14*24*time.Hour)),
+			}
+			ids := make(map[string]string)
+			for name, transaction := range transactions {
+				id, err := a.Models.Transactions.Insert(context.Background(), transaction)
+				if err != nil {
+					t.Fatalf("failed to seed transaction: %v", err)
+				}
+				ids[name] = id
+			}
+
+			if rec := a.Do(http.MethodPost, "/transactions/retention", a.PatronAuth(patronID)); rec.Code != http.StatusForbidden {
+				t.Errorf("POST /transactions/retention by a patron status = %v; want %v", rec.Code, http.StatusForbidden)
+			}
+
+			rec := a.Do(http.MethodPost, "/transactions/retention?dry_run=true", admin)
+			var result api.RetentionResult
+			a.Decode(rec, &result)
+			if rec.Code != http.StatusOK || result.Expired != 2 || result.Kept != 1 || result.Applied != 0 || !result.DryRun {
+				t.Fatalf("dry run = %v %+v; want 2 expired, 1 kept and none applied", rec.Code, result)
+			}
+
+			rec = a.Do(http.MethodPost, "/transactions/retention", admin)
+			a.Decode(rec, &result)
+			if rec.Code != http.StatusOK || result.Expired != 2 || result.Kept != 1 || result.Applied != 1 {
+				t.Fatalf("retention = %v %+v; want 2 expired, 1 kept and 1 applied", rec.Code, result)
+			}
+
+			for name, id := range ids {
+				transaction, err := a.Models.Transactions.Get(context.Background(), data.TransactionFilter{ID: apitest.Ptr(data.TransactionID(id))})
+				switch {
+				case name == "old" && mode == api.RetentionDelete:
+					if err == nil {
+						t.Errorf("transaction %s was not deleted", name)
+					}
+				case name == "old":
+					if err != nil || !transaction.Anonymized || transaction.PatronID != "" {
+						t.Errorf("transaction %s = %+v, %v; want anonymized", name, transaction, err)
+					}
+				default:
+					if err != nil || transaction.Anonymized || transaction.PatronID != patronID {
+						t.Errorf("transaction %s = %+v, %v; want it unchanged", name, transaction, err)
+					}
+				}
+			}
+
+			// A second run finds nothing more to do in either mode.
+			rec = a.Do(http.MethodPost, "/transactions/retention", admin)
+			a.Decode(rec, &result)
+			if result.Expired != 1 || result.Applied != 0 {
+				t.Errorf("second retention = %+v; want only the kept transaction", result)
+			}
+		})
+	}
+}
+
+func TestApplyRetentionBatches(t *testing.T) {
+	for _, mode := range []string{api.RetentionAnonymize, api.RetentionDelete} {
+		t.Run(mode, func(t *testing.T) {
+			a := apitest.New(t, func(app *api.Application) {
+				app.Config.Cost.OverdueFine = 2
+				app.Config.Retention.Years = 2
+				app.Config.Retention.Mode = mode
+			})
+
+			bookID := a.SeedBook(apitest.Book("9780306406157", 3))
+			patronID := a.SeedPatron(apitest.Patron("patron@example.com"))
+
+			// More transactions than are read in a batch, every tenth of which was returned late,
+			// so that its fine is outstanding and it is kept.
+			const count = 1234
+			old := time.Now().AddDate(-3, 0, 0)
+			kept := 0
+			for i := range count {
+				loan := 7 * 24 * time.Hour
+				if i%10 == 0 {
+					loan = 20 * 24 * time.Hour
+					kept++
+				}
+				transaction := data.NewTransaction("", patronID, bookID, data.TransactionStatusReturned, old, old.Add(14*24*time.Hour))
+				transaction.ReturnedAt = old.Add(loan)
+				if _, err := a.Models.Transactions.Insert(context.Background(), transaction); err != nil {
+					t.Fatalf("failed to seed transaction: %v", err)
+				}
+			}
+
+			result, err := a.App.ApplyRetention(context.Background(), time.Now(), false)
+			if err != nil {
+				t.Fatalf("ApplyRetention() error = %v", err)
+			}
+			if result.Expired != count || result.Kept != kept || result.Applied != int64(count-kept) {
+				t.Errorf("ApplyRetention() = %+v; want %d expired, %d kept and %d applied", result, count, kept, count-kept)
+			}
+
+			result, err = a.App.ApplyRetention(context.Background(), time.Now(), false)
+			if err != nil {
+				t.Fatalf("ApplyRetention() error = %v", err)
+			}
+			if result.Expired != kept || result.Applied != 0 {
+				t.Errorf("second ApplyRetention() = %+v; want only the %d kept transactions", result, kept)
+			}
+		})
+	}
+}
@@ -5,12 +5,15 @@ import (
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
-	"github.com/go-chi/cors"
 	"github.com/go-chi/httplog/v2"
 	"github.com/mzeevi/library/internal/auth"
-	"github.com/mzeevi/library/internal/query"
+	"github.com/mzeevi/library/internal/data"
+	"github.com/mzeevi/library/internal/labels"
+	"github.com/mzeevi/library/internal/oai"
+	"github.com/mzeevi/library/internal/photo"
+	"github.com/mzeevi/library/internal/receipt"
+	"github.com/mzeevi/library/internal/sru"
 	"net/http"
-	"reflect"
 	"time"
 
 	"github.com/danielgtaylor/huma/v2/adapters/humachi"
@@ -20,25 +23,101 @@ import (
 
 const (
 	bearerSecKey      = "bearer"
+	kioskSecKey       = "kiosk"
+	scimSecKey        = "scim"
 	basicAuthKey      = "basic"
 	basePath          = ""
 	booksKey          = "books"
+	fileKey           = "file"
+	downloadKey       = "download"
 	patronsKey        = "patrons"
+	adminsKey         = "admins"
+	categoriesKey     = "categories"
+	publishersKey     = "publishers"
+	passwordKey       = "password"
+	mergeKey          = "merge"
 	transactionsKey   = "transactions"
 	tokensKey         = "token"
 	authenticationKey = "authentication"
 	borrowKey         = "borrow"
+	guestKey          = "guest"
 	returnKey         = "return"
+	remindKey         = "remind"
+	forceReturnKey    = "force-return"
+	cancelKey         = "cancel"
+	auditKey          = "audit"
+	finesKey          = "fines"
+	waiveKey          = "waive"
+	adjustKey         = "adjust"
+	checkoutKey       = "checkout"
+	paymentsKey       = "payments"
+	webhookKey        = "webhook"
+	cashKey           = "cash"
+	acquisitionsKey   = "acquisitions"
+	catalogKey        = "catalog"
+	withdrawKey       = "withdraw"
+	withdrawalsKey    = "withdrawals"
+	inventoryKey      = "inventory"
+	scansKey          = "scans"
+	reportKey         = "report"
+	closeKey          = "close"
 	searchKey         = "search"
+	searchesKey       = "searches"
+	runKey            = "run"
 	healthcheckKey    = "healthcheck"
+	emailsKey         = "emails"
+	notificationsKey  = "notifications"
+	resendKey         = "resend"
+	eventsKey         = "events"
+	retryKey          = "retry"
+	availabilityKey   = "availability"
+	reportsKey        = "reports"
+	statsKey          = "stats"
+	fixturesKey       = "fixtures"
+	feedKey           = "feed"
+	feedsKey          = "feeds"
+	genresKey         = "genres"
+	meKey             = "me"
+	dueDatesFeedKey   = "due-dates.ics"
+	newArrivalsKey    = "new-arrivals"
+	arrivalsFeedKey   = "new-arrivals.atom"
+	overdueKey        = "overdue"
+	receiptKey        = "receipt"
+	labelsKey         = "labels"
+	sruKey            = "sru"
+	oaiKey            = "oai"
+	suggestionsKey    = "suggestions"
+	acceptKey         = "accept"
+	rejectKey         = "reject"
+	orderKey          = "order"
+	resourcesKey      = "resources"
+	reservationsKey   = "reservations"
+	programsKey       = "programs"
+	registrationsKey  = "registrations"
+	announcementsKey  = "announcements"
+	kiosksKey         = "kiosks"
+	kioskKey          = "kiosk"
+	barcodeKey        = "barcode"
+	pinKey            = "pin"
+	photoKey          = "photo"
+	loginKey          = "login"
+	previewKey        = "preview"
+	nameKey           = "name"
 	idKey             = "id"
 	activated         = "activated"
-)
-
-var (
-	typeInt    = reflect.TypeOf(0)
-	typeString = reflect.TypeOf("")
-	typeTime   = reflect.TypeOf(time.Now())
+	activationKey     = "activation"
+	importKey         = "import"
+	externalIDsKey    = "external-ids"
+	systemKey         = "system"
+	valueKey          = "value"
+	scimKey           = "scim/v2"
+	usersKey          = "Users"
+	serviceConfigKey  = "ServiceProviderConfig"
+	retentionKey      = "retention"
+	dailyKey          = "daily"
+	circulationKey    = "circulation"
+	delinquentKey     = "delinquent"
+	collectionKey     = "collection"
 )
 
 // routes sets up and returns the HTTP handler for the application.
@@ -56,30 +135,69 @@ func (app *Application) routes() http.Handler {
 			Scheme:       "basic",
 			BearerFormat: "Basic Auth",
 		},
+		kioskSecKey: {
+			Type:         "http",
+			Scheme:       "bearer",
+			BearerFormat: "kiosk key",
+		},
+		scimSecKey: {
+			Type:         "http",
+			Scheme:       "bearer",
+			BearerFormat: "SCIM token",
+		},
 	}
 
-	router.Use(middleware.RealIP)
+	router.Use(app.realIP)
 	router.Use(middleware.RequestID)
+	router.Use(app.correlateLogs)
+	router.Use(app.setLocation)
 	router.Use(httplog.RequestLogger(app.logger))
 	router.Use(middleware.Recoverer)
+	router.Use(app.reportPanics)
 	router.Use(httprate.Limit(100, 10*time.Second, httprate.WithKeyFuncs(httprate.KeyByIP, httprate.KeyByEndpoint)))
-	router.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   app.Config.CORS.TrustedOrigins,
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
-		AllowCredentials: false,
-		MaxAge:           300,
-	}))
+	router.Use(app.limitCatalog)
+	router.Use(app.handleCORS())
 
 	api := humachi.New(router, conf)
+	api.UseMiddleware(app.readLists)
 
 	app.registerHealthcheck(api)
 	app.registerBooks(api)
+	app.registerCatalog(api)
 	app.registerPatrons(api)
 	app.registerTransactions(api)
 	app.registerSearch(api)
+	app.registerSavedSearches(api)
+	app.registerSRU(api)
+	app.registerOAI(api)
 	app.registerToken(api)
+	app.registerAdmins(api)
+	app.registerCategories(api)
+	app.registerPublishers(api)
+	app.registerEmails(api)
+	app.registerNotifications(api)
+	app.registerEvents(api)
+	app.registerAudit(api)
+	app.registerFines(api)
+	app.registerPayments(api)
+	app.registerAcquisitions(api)
+	app.registerSuggestions(api)
+	app.registerResources(api)
+	app.registerReservations(api)
+	app.registerPrograms(api)
+	app.registerRegistrations(api)
+	app.registerAnnouncements(api)
+	app.registerLabels(api)
+	app.registerWithdrawals(api)
+	app.registerInventory(api)
+	app.registerAvailability(api)
+	app.registerReports(api)
+	app.registerRetention(api)
+	app.registerFeeds(api)
+	app.registerPINs(api)
+	app.registerKiosks(api)
+	app.registerSCIM(api)
+	app.registerFixtures(api)
 
 	return router
 }
@@ -111,6 +229,32 @@ func (app *Application) registerBooks(api huma.API) {
 		},
 	}, app.getBookHandler)
 
+	huma.Register(api, huma.Operation{
+		OperationID: "get-book-by-external-id",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s/%s/{%s}/{%s}", basePath, booksKey, externalIDsKey, systemKey, valueKey),
+		Summary:     "Get a Book by an external ID",
+		Description: "Get a Book by its ID in another system, such as its barcode in a legacy catalog",
+		Tags:        []string{booksKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requirePermission(api, auth.ReadBooksPermission)},
+		Security: []map[string][]string{
+			{bearerSecKey: {}},
+		},
+	}, app.getBookByExternalIDHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-book-availability",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s/{%s}/%s", basePath, booksKey, idKey, availabilityKey),
+		Summary:     "Get the availability of a Book",
+		Description: "Get the available copies and the loans of a Book from a specific ID",
+		Tags:        []string{booksKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requirePermission(api, auth.ReadBooksPermission)},
+		Security: []map[string][]string{
+			{bearerSecKey: {}},
+		},
+	}, app.getBookAvailabilityHandler)
+
 	huma.Register(api, huma.Operation{
 		OperationID: "get-books",
 		Method:      http.MethodGet,
@@ -125,6 +269,20 @@ func (app *Application) registerBooks(api huma.API) {
 		},
 	}, app.getBooksHandler)
 
+	huma.Register(api, huma.Operation{
+		OperationID: "get-new-arrivals",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s/%s", basePath, booksKey, newArrivalsKey),
+		Summary:     "Get the new arrivals",
+		Description: "Get the Books which were added recently, from the most recently added",
+		Tags:        []string{booksKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requirePermission(api, auth.ReadBooksPermission)},
+		Security: []map[string][]string{
+			{bearerSecKey: {}},
+			{basicAuthKey: {}},
+		},
+	}, app.getNewArrivalsHandler)
+
 	huma.Register(api, huma.Operation{
 		OperationID: "create-book",
 		Method:      http.MethodPost,
@@ -151,6 +309,19 @@ func (app *Application) registerBooks(api huma.API) {
 		},
 	}, app.updateBookHandler)
 
+	huma.Register(api, huma.Operation{
+		OperationID: "patch-book",
+		Method:      http.MethodPatch,
+		Path:        fmt.Sprintf("%s/%s/{%s}", basePath, booksKey, idKey),
+		Summary:     "Patch a Book",
+		Description: "Update only the given fields of a specific Book",
+		Tags:        []string{booksKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requirePermission(api, auth.WriteBooksPermission)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.updateBookHandler)
+
 	huma.Register(api, huma.Operation{
 		OperationID: "delete-book",
 		Method:      http.MethodDelete,
@@ -163,6 +334,65 @@ func (app *Application) registerBooks(api huma.API) {
 			{basicAuthKey: {}},
 		},
 	}, app.deleteBookHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID:     "upload-book-file",
+		Method:          http.MethodPut,
+		Path:            fmt.Sprintf("%s/%s/{%s}/%s", basePath, booksKey, idKey, fileKey),
+		Summary:         "Upload the file of a Book",
+		Description:     "Attach a PDF or EPUB file to a Book, such as the file of an e-book, replacing its file. Patrons who borrow the Book can download it",
+		Tags:            []string{booksKey},
+		MaxBodyBytes:    app.Config.Files.MaxSize,
+		BodyReadTimeout: fileTimeout,
+		Middlewares:     huma.Middlewares{app.authenticate(api), app.requirePermission(api, auth.WriteBooksPermission)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.uploadBookFileHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "delete-book-file",
+		Method:      http.MethodDelete,
+		Path:        fmt.Sprintf("%s/%s/{%s}/%s", basePath, booksKey, idKey, fileKey),
+		Summary:     "Delete the file of a Book",
+		Description: "Remove the file attached to a Book",
+		Tags:        []string{booksKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requirePermission(api, auth.WriteBooksPermission)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.deleteBookFileHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-book-download",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s/{%s}/%s", basePath, booksKey, idKey, downloadKey),
+		Summary:     "Get a download URL of a Book",
+		Description: "Get a signed URL for downloading the file of a Book which the authenticated patron borrows, which expires after a short time",
+		Tags:        []string{booksKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requirePermission(api, auth.ReadBooksPermission)},
+		Security: []map[string][]string{
+			{bearerSecKey: {}},
+		},
+	}, app.getBookDownloadHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-book-file",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s/{%s}/%s", basePath, booksKey, idKey, fileKey),
+		Summary:     "Download the file of a Book",
+		Description: "Download the file of a Book with the token of a download URL, while the patron of the token borrows the Book",
+		Tags:        []string{booksKey},
+		Responses: map[string]*huma.Response{
+			"200": {
+				Description: "File of the Book",
+				Content: map[string]*huma.MediaType{
+					contentTypePDF:  {Schema: &huma.Schema{Type: huma.TypeString, Format: "binary"}},
+					contentTypeEPUB: {Schema: &huma.Schema{Type: huma.TypeString, Format: "binary"}},
+				},
+			},
+		},
+	}, app.getBookFileHandler)
 }
 
 // registerPatrons registers patron endpoints.
@@ -181,6 +411,20 @@ func (app *Application) registerPatrons(api huma.API) {
 		},
 	}, app.getPatronHandler)
 
+	huma.Register(api, huma.Operation{
+		OperationID: "get-patron-stats",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s/{%s}/%s", basePath, patronsKey, idKey, statsKey),
+		Summary:     "Get the statistics of a Patron",
+		Description: "Get the total borrows, on-time return rate, favorite genres and streaks of a Patron from a specific ID, now or as of a past day",
+		Tags:        []string{patronsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requirePermission(api, auth.ReadPatronPermission), app.requireMatchingID(api)},
+		Security: []map[string][]string{
+			{bearerSecKey: {}},
+			{basicAuthKey: {}},
+		},
+	}, app.getPatronStatsHandler)
+
 	huma.Register(api, huma.Operation{
 		OperationID: "get-patrons",
 		Method:      http.MethodGet,
@@ -194,6 +438,19 @@ func (app *Application) registerPatrons(api huma.API) {
 		},
 	}, app.getPatronsHandler)
 
+	huma.Register(api, huma.Operation{
+		OperationID: "get-patron-by-external-id",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s/%s/{%s}/{%s}", basePath, patronsKey, externalIDsKey, systemKey, valueKey),
+		Summary:     "Get a Patron by an external ID",
+		Description: "Get a Patron by their ID in another system, such as their student ID in the school information system",
+		Tags:        []string{patronsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requirePermission(api, auth.ReadPatronsPermission)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.getPatronByExternalIDHandler)
+
 	huma.Register(api, huma.Operation{
 		OperationID: "create-patron",
 		Method:      http.MethodPost,
@@ -207,14 +464,43 @@ func (app *Application) registerPatrons(api huma.API) {
 		},
 	}, app.createPatronHandler)
 
+	huma.Register(api, huma.Operation{
+		OperationID:     "import-patrons",
+		Method:          http.MethodPost,
+		Path:            fmt.Sprintf("%s/%s/%s", basePath, patronsKey, importKey),
+		Summary:         "Import Patrons",
+		Description:     "Create the Patrons of a roster CSV file, such as the students of a school, with the name, email, category and optional student_id columns, which is the external sis ID of the Patron. Each created Patron is emailed an activation token, with which they set their password, and the result of each row is reported",
+		Tags:            []string{patronsKey},
+		MaxBodyBytes:    maxImportBytes,
+		BodyReadTimeout: importTimeout,
+		Middlewares:     huma.Middlewares{app.authenticate(api), app.requirePermission(api, auth.WritePatronsPermission)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.importPatronsHandler)
+
 	huma.Register(api, huma.Operation{
 		OperationID: "update-patron",
 		Method:      http.MethodPut,
 		Path:        fmt.Sprintf("%s/%s/{%s}", basePath, patronsKey, idKey),
 		Summary:     "Update a Patron",
-		Description: "Update a specific Patron",
+		Description: "Update a specific Patron. Patrons can only update themselves, and only admins can change the password, category and external IDs of a Patron",
 		Tags:        []string{patronsKey},
-		Middlewares: huma.Middlewares{app.authenticate(api), app.requirePermission(api, auth.WritePatronPermission)},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requirePermission(api, auth.WritePatronPermission), app.requireMatchingID(api)},
+		Security: []map[string][]string{
+			{bearerSecKey: {}},
+			{basicAuthKey: {}},
+		},
+	}, app.updatePatronHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "patch-patron",
+		Method:      http.MethodPatch,
+		Path:        fmt.Sprintf("%s/%s/{%s}", basePath, patronsKey, idKey),
+		Summary:     "Patch a Patron",
+		Description: "Update only the given fields of a specific Patron. Patrons can only update themselves, and only admins can change the password, category and external IDs of a Patron",
+		Tags:        []string{patronsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requirePermission(api, auth.WritePatronPermission), app.requireMatchingID(api)},
 		Security: []map[string][]string{
 			{bearerSecKey: {}},
 			{basicAuthKey: {}},
@@ -226,15 +512,88 @@ func (app *Application) registerPatrons(api huma.API) {
 		Method:      http.MethodDelete,
 		Path:        fmt.Sprintf("%s/%s/{%s}", basePath, patronsKey, idKey),
 		Summary:     "Delete a Patron",
-		Description: "Delete a specific Patron",
+		Description: "Delete a specific Patron. Patrons can only delete themselves",
 		Tags:        []string{patronsKey},
-		Middlewares: huma.Middlewares{app.authenticate(api), app.requirePermission(api, auth.WritePatronPermission)},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requirePermission(api, auth.WritePatronPermission), app.requireMatchingID(api)},
 		Security: []map[string][]string{
 			{basicAuthKey: {}},
 			{bearerSecKey: {}},
 		},
 	}, app.deletePatronHandler)
 
+	huma.Register(api, huma.Operation{
+		OperationID: "update-patron-password",
+		Method:      http.MethodPut,
+		Path:        fmt.Sprintf("%s/%s/%s/%s", basePath, patronsKey, meKey, passwordKey),
+		Summary:     "Update the password",
+		Description: "Change the password of the authenticated patron, confirmed with their current password, which signs them out everywhere",
+		Tags:        []string{patronsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requirePermission(api, auth.WritePatronPermission)},
+		Security: []map[string][]string{
+			{bearerSecKey: {}},
+		},
+	}, app.updatePatronPasswordHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID:     "upload-patron-photo",
+		Method:          http.MethodPut,
+		Path:            fmt.Sprintf("%s/%s/{%s}/%s", basePath, patronsKey, idKey, photoKey),
+		Summary:         "Upload the photo of a Patron",
+		Description:     "Set the photo of a Patron by which the front desk verifies their identity, replacing their photo. The photo is scaled down and stored as a JPEG",
+		Tags:            []string{patronsKey},
+		MaxBodyBytes:    maxPhotoBytes,
+		BodyReadTimeout: fileTimeout,
+		Middlewares:     huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.uploadPatronPhotoHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-patron-photo",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s/{%s}/%s", basePath, patronsKey, idKey, photoKey),
+		Summary:     "Get the photo of a Patron",
+		Description: "Get the photo of a Patron, to verify their identity at the front desk",
+		Tags:        []string{patronsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+		Responses: map[string]*huma.Response{
+			"200": {
+				Description: "Photo of the Patron",
+				Content:     map[string]*huma.MediaType{photo.ContentType: {Schema: &huma.Schema{Type: huma.TypeString, Format: "binary"}}},
+			},
+		},
+	}, app.getPatronPhotoHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "delete-patron-photo",
+		Method:      http.MethodDelete,
+		Path:        fmt.Sprintf("%s/%s/{%s}/%s", basePath, patronsKey, idKey, photoKey),
+		Summary:     "Delete the photo of a Patron",
+		Description: "Remove the photo of a Patron",
+		Tags:        []string{patronsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.deletePatronPhotoHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "merge-patrons",
+		Method:      http.MethodPost,
+		Path:        fmt.Sprintf("%s/%s/%s", basePath, patronsKey, mergeKey),
+		Summary:     "Merge Patrons",
+		Description: "Merge a duplicate Patron into another Patron",
+		Tags:        []string{patronsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.mergePatronsHandler)
+
 	huma.Register(api, huma.Operation{
 		OperationID: "activate-patron",
 		Method:      http.MethodPut,
@@ -243,6 +602,195 @@ func (app *Application) registerPatrons(api huma.API) {
 		Description: "Activate a specific Patron",
 		Tags:        []string{patronsKey},
 	}, app.activatePatronHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "resend-patron-activation",
+		Method:      http.MethodPost,
+		Path:        fmt.Sprintf("%s/%s/%s/%s", basePath, patronsKey, activationKey, resendKey),
+		Summary:     "Resend the activation token of a Patron",
+		Description: "Invalidate the activation tokens of a Patron who is not activated yet, and email them a new one",
+		Tags:        []string{patronsKey},
+	}, app.resendActivationHandler)
+}
+
+// registerAdmins registers admin endpoints.
+func (app *Application) registerAdmins(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "get-admins",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s", basePath, adminsKey),
+		Summary:     "Get Admins",
+		Description: "Get all Admins",
+		Tags:        []string{adminsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.getAdminsHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "update-admin",
+		Method:      http.MethodPut,
+		Path:        fmt.Sprintf("%s/%s/{%s}", basePath, adminsKey, idKey),
+		Summary:     "Update an Admin",
+		Description: "Rename, activate or deactivate a specific Admin",
+		Tags:        []string{adminsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.updateAdminHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "delete-admin",
+		Method:      http.MethodDelete,
+		Path:        fmt.Sprintf("%s/%s/{%s}", basePath, adminsKey, idKey),
+		Summary:     "Delete an Admin",
+		Description: "Delete a specific Admin other than the authenticated Admin",
+		Tags:        []string{adminsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.deleteAdminHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "update-admin-password",
+		Method:      http.MethodPut,
+		Path:        fmt.Sprintf("%s/%s/{%s}/%s", basePath, adminsKey, idKey, passwordKey),
+		Summary:     "Update an Admin password",
+		Description: "Rotate the password of a specific Admin",
+		Tags:        []string{adminsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.updateAdminPasswordHandler)
+}
+
+// registerCategories registers patron category endpoints.
+func (app *Application) registerCategories(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "get-category",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s/{%s}", basePath, categoriesKey, idKey),
+		Summary:     "Get a Category",
+		Description: "Get a Category from a specific ID",
+		Tags:        []string{categoriesKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.getCategoryHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-categories",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s", basePath, categoriesKey),
+		Summary:     "Get Categories",
+		Description: "Get all patron Categories",
+		Tags:        []string{categoriesKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.getCategoriesHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "create-category",
+		Method:      http.MethodPost,
+		Path:        fmt.Sprintf("%s/%s", basePath, categoriesKey),
+		Summary:     "Create a Category",
+		Description: "Create a specific patron Category",
+		Tags:        []string{categoriesKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.createCategoryHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "update-category",
+		Method:      http.MethodPut,
+		Path:        fmt.Sprintf("%s/%s/{%s}", basePath, categoriesKey, idKey),
+		Summary:     "Update a Category",
+		Description: "Update the discount and loan policy of a specific Category",
+		Tags:        []string{categoriesKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.updateCategoryHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "delete-category",
+		Method:      http.MethodDelete,
+		Path:        fmt.Sprintf("%s/%s/{%s}", basePath, categoriesKey, idKey),
+		Summary:     "Delete a Category",
+		Description: "Delete a specific Category which is not assigned to any Patron",
+		Tags:        []string{categoriesKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.deleteCategoryHandler)
+}
+
+// registerPublishers registers publisher endpoints.
+func (app *Application) registerPublishers(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "get-publisher",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s/{%s}", basePath, publishersKey, idKey),
+		Summary:     "Get a Publisher",
+		Description: "Get a Publisher from a specific ID",
+		Tags:        []string{publishersKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requirePermission(api, auth.ReadBooksPermission)},
+		Security: []map[string][]string{
+			{bearerSecKey: {}},
+			{basicAuthKey: {}},
+		},
+	}, app.getPublisherHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-publishers",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s", basePath, publishersKey),
+		Summary:     "Get Publishers",
+		Description: "Get all Publishers of books",
+		Tags:        []string{publishersKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requirePermission(api, auth.ReadBooksPermission)},
+		Security: []map[string][]string{
+			{bearerSecKey: {}},
+			{basicAuthKey: {}},
+		},
+	}, app.getPublishersHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "update-publisher",
+		Method:      http.MethodPut,
+		Path:        fmt.Sprintf("%s/%s/{%s}", basePath, publishersKey, idKey),
+		Summary:     "Rename a Publisher",
+		Description: "Rename a specific Publisher and its Books, keeping its previous name as an alias",
+		Tags:        []string{publishersKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requirePermission(api, auth.WriteBooksPermission)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.updatePublisherHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "merge-publishers",
+		Method:      http.MethodPost,
+		Path:        fmt.Sprintf("%s/%s/%s", basePath, publishersKey, mergeKey),
+		Summary:     "Merge Publishers",
+		Description: "Merge a duplicate Publisher into another Publisher",
+		Tags:        []string{publishersKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requirePermission(api, auth.WriteBooksPermission)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.mergePublishersHandler)
 }
 
 // registerTransactions registers transaction endpoints.
@@ -260,6 +808,25 @@ func (app *Application) registerTransactions(api huma.API) {
 		},
 	}, app.getTransactionHandler)
 
+	huma.Register(api, huma.Operation{
+		OperationID: "get-transaction-receipt",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s/{%s}/%s", basePath, transactionsKey, idKey, receiptKey),
+		Summary:     "Get a Transaction receipt",
+		Description: "Get the printable PDF receipt of a Transaction from a specific ID, which is a return receipt with the fine if the book was returned",
+		Tags:        []string{transactionsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requirePermission(api, auth.ReadTransactionsPermission)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+		Responses: map[string]*huma.Response{
+			"200": {
+				Description: "PDF receipt",
+				Content:     map[string]*huma.MediaType{receipt.ContentType: {Schema: &huma.Schema{Type: huma.TypeString, Format: "binary"}}},
+			},
+		},
+	}, app.getTransactionReceiptHandler)
+
 	huma.Register(api, huma.Operation{
 		OperationID: "get-transactions",
 		Method:      http.MethodGet,
@@ -285,8 +852,22 @@ func (app *Application) registerTransactions(api huma.API) {
 			{bearerSecKey: {}},
 			{basicAuthKey: {}},
 		},
+		Responses: fileResponses(api, "The borrow Transaction, or its PDF receipt", data.Transaction{}, receipt.ContentType),
 	}, app.borrowBookTransactionHandler)
 
+	huma.Register(api, huma.Operation{
+		OperationID: "guest-borrow-book-transaction",
+		Method:      http.MethodPost,
+		Path:        fmt.Sprintf("%s/%s/%s/%s", basePath, transactionsKey, borrowKey, guestKey),
+		Summary:     "Borrow Book for a guest",
+		Description: "Lend a Book to a walk-in who is not a member of the library, recording them as a guest Patron the first time they borrow",
+		Tags:        []string{transactionsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.guestBorrowHandler)
+
 	huma.Register(api, huma.Operation{
 		OperationID: "return-book-transaction",
 		Method:      http.MethodPost,
@@ -299,6 +880,7 @@ func (app *Application) registerTransactions(api huma.API) {
 			{bearerSecKey: {}},
 			{basicAuthKey: {}},
 		},
+		Responses: fileResponses(api, "A message, or the PDF receipt of the returned Transaction", "", receipt.ContentType),
 	}, app.returnBookTransactionHandler)
 
 	huma.Register(api, huma.Operation{
@@ -315,22 +897,74 @@ func (app *Application) registerTransactions(api huma.API) {
 	}, app.updateTransactionHandler)
 
 	huma.Register(api, huma.Operation{
-		OperationID: "delete-transaction",
-		Method:      http.MethodDelete,
-		Path:        fmt.Sprintf("%s/%s/{%s}", basePath, transactionsKey, idKey),
-		Summary:     "Delete a Transaction",
-		Description: "Delete a specific Transaction",
+		OperationID: "remind-transaction",
+		Method:      http.MethodPost,
+		Path:        fmt.Sprintf("%s/%s/{%s}/%s", basePath, transactionsKey, idKey, remindKey),
+		Summary:     "Remind of a Transaction",
+		Description: "Notify the Patron of a borrowed Book that it is due soon or overdue",
 		Tags:        []string{transactionsKey},
 		Middlewares: huma.Middlewares{app.authenticate(api), app.requirePermission(api, auth.WriteTransactionsPermission)},
 		Security: []map[string][]string{
 			{basicAuthKey: {}},
 		},
-	}, app.deleteTransactionHandler)
-}
+	}, app.remindTransactionHandler)
 
-func (app *Application) registerSearch(api huma.API) {
 	huma.Register(api, huma.Operation{
-		OperationID: "search-books",
+		OperationID: "force-return-transaction",
+		Method:      http.MethodPost,
+		Path:        fmt.Sprintf("%s/%s/{%s}/%s", basePath, transactionsKey, idKey, forceReturnKey),
+		Summary:     "Force-return a Transaction",
+		Description: "Mark a borrowed Transaction as returned and release its copies, optionally waiving its fine. The reason is recorded in the audit log",
+		Tags:        []string{transactionsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.forceReturnTransactionHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "cancel-transaction",
+		Method:      http.MethodPost,
+		Path:        fmt.Sprintf("%s/%s/{%s}/%s", basePath, transactionsKey, idKey, cancelKey),
+		Summary:     "Cancel a Transaction",
+		Description: "Cancel a Transaction which was recorded by mistake, releasing its copies if they are borrowed. The reason is recorded in the audit log",
+		Tags:        []string{transactionsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.cancelTransactionHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "delete-transaction",
+		Method:      http.MethodDelete,
+		Path:        fmt.Sprintf("%s/%s/{%s}", basePath, transactionsKey, idKey),
+		Summary:     "Delete a Transaction",
+		Description: "Delete a specific Transaction",
+		Tags:        []string{transactionsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requirePermission(api, auth.WriteTransactionsPermission)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.deleteTransactionHandler)
+}
+
+func (app *Application) registerSearch(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "search",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s", basePath, searchKey),
+		Summary:     "Search",
+		Description: "Search Books by title, author and ISBN, Patrons by name and email, and Transactions by ID at once, with the results grouped by their kind",
+		Tags:        []string{searchKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.globalSearchHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "search-books",
 		Method:      http.MethodGet,
 		Path:        fmt.Sprintf("%s/%s/%s", basePath, searchKey, booksKey),
 		Summary:     "Search Books",
@@ -341,83 +975,7 @@ func (app *Application) registerSearch(api huma.API) {
 			{bearerSecKey: {}},
 			{basicAuthKey: {}},
 		},
-		Parameters: []*huma.Param{
-			{
-				Name:   query.MinPagesKey,
-				In:     query.Key,
-				Schema: huma.SchemaFromType(api.OpenAPI().Components.Schemas, typeInt),
-			},
-			{
-				Name:   query.MaxPagesKey,
-				In:     query.Key,
-				Schema: huma.SchemaFromType(api.OpenAPI().Components.Schemas, typeInt),
-			},
-			{
-				Name:   query.MinEditionKey,
-				In:     query.Key,
-				Schema: huma.SchemaFromType(api.OpenAPI().Components.Schemas, typeInt),
-			},
-			{
-				Name:   query.MaxEditionKey,
-				In:     query.Key,
-				Schema: huma.SchemaFromType(api.OpenAPI().Components.Schemas, typeInt),
-			},
-			{
-				Name:   query.MinPublishedAtKey,
-				In:     query.Key,
-				Schema: huma.SchemaFromType(api.OpenAPI().Components.Schemas, typeTime),
-			},
-			{
-				Name:   query.MaxPublishedAtKey,
-				In:     query.Key,
-				Schema: huma.SchemaFromType(api.OpenAPI().Components.Schemas, typeTime),
-			},
-			{
-				Name:   query.TitleKey,
-				In:     query.Key,
-				Schema: huma.SchemaFromType(api.OpenAPI().Components.Schemas, typeString),
-			},
-			{
-				Name:   query.ISBNKey,
-				In:     query.Key,
-				Schema: huma.SchemaFromType(api.OpenAPI().Components.Schemas, typeString),
-			},
-			{
-				Name:   query.AuthorsKey,
-				In:     query.Key,
-				Schema: huma.SchemaFromType(api.OpenAPI().Components.Schemas, reflect.SliceOf(typeString)),
-			},
-			{
-				Name:   query.PublishersKey,
-				In:     query.Key,
-				Schema: huma.SchemaFromType(api.OpenAPI().Components.Schemas, reflect.SliceOf(typeString)),
-			},
-			{
-				Name:   query.GenresKey,
-				In:     query.Key,
-				Schema: huma.SchemaFromType(api.OpenAPI().Components.Schemas, reflect.SliceOf(typeString)),
-			},
-			{
-				Name:   query.MinCopiesKey,
-				In:     query.Key,
-				Schema: huma.SchemaFromType(api.OpenAPI().Components.Schemas, typeInt),
-			},
-			{
-				Name:   query.MaxCopiesKey,
-				In:     query.Key,
-				Schema: huma.SchemaFromType(api.OpenAPI().Components.Schemas, typeInt),
-			},
-			{
-				Name:   query.MinBorrowedCopiesKey,
-				In:     query.Key,
-				Schema: huma.SchemaFromType(api.OpenAPI().Components.Schemas, typeInt),
-			},
-			{
-				Name:   query.MaxBorrowedCopiesKey,
-				In:     query.Key,
-				Schema: huma.SchemaFromType(api.OpenAPI().Components.Schemas, typeInt),
-			},
-		},
+		Responses: fileResponses(api, "A page of the results, or all the results as a file", BooksInfo{}, csvContentType, xlsxContentType),
 	}, app.searchBookHandler)
 
 	huma.Register(api, huma.Operation{
@@ -431,23 +989,7 @@ func (app *Application) registerSearch(api huma.API) {
 		Security: []map[string][]string{
 			{basicAuthKey: {}},
 		},
-		Parameters: []*huma.Param{
-			{
-				Name:   query.NameKey,
-				In:     query.Key,
-				Schema: huma.SchemaFromType(api.OpenAPI().Components.Schemas, typeString),
-			},
-			{
-				Name:   query.EmailKey,
-				In:     query.Key,
-				Schema: huma.SchemaFromType(api.OpenAPI().Components.Schemas, typeString),
-			},
-			{
-				Name:   query.CategoryKey,
-				In:     query.Key,
-				Schema: huma.SchemaFromType(api.OpenAPI().Components.Schemas, typeString),
-			},
-		},
+		Responses: fileResponses(api, "A page of the results, or all the results as a file", PatronsInfo{}, csvContentType, xlsxContentType),
 	}, app.searchPatronsHandler)
 
 	huma.Register(api, huma.Operation{
@@ -461,73 +1003,1429 @@ func (app *Application) registerSearch(api huma.API) {
 		Security: []map[string][]string{
 			{basicAuthKey: {}},
 		},
-		Parameters: []*huma.Param{
-			{
-				Name:   query.PatronIDKey,
-				In:     query.Key,
-				Schema: huma.SchemaFromType(api.OpenAPI().Components.Schemas, typeString),
-			},
-			{
-				Name:   query.BookIDKey,
-				In:     query.Key,
-				Schema: huma.SchemaFromType(api.OpenAPI().Components.Schemas, typeString),
-			},
-			{
-				Name:   query.StatusKey,
-				In:     query.Key,
-				Schema: huma.SchemaFromType(api.OpenAPI().Components.Schemas, typeString),
-			},
-			{
-				Name:   query.MinBorrowedAtKey,
-				In:     query.Key,
-				Schema: huma.SchemaFromType(api.OpenAPI().Components.Schemas, typeTime),
-			},
-			{
-				Name:   query.MaxBorrowedAtKey,
-				In:     query.Key,
-				Schema: huma.SchemaFromType(api.OpenAPI().Components.Schemas, typeTime),
-			},
-			{
-				Name:   query.MinDueDateKey,
-				In:     query.Key,
-				Schema: huma.SchemaFromType(api.OpenAPI().Components.Schemas, typeTime),
-			},
-			{
-				Name:   query.MaxDueDateKey,
-				In:     query.Key,
-				Schema: huma.SchemaFromType(api.OpenAPI().Components.Schemas, typeTime),
-			},
-			{
-				Name:   query.MinReturnedAtKey,
-				In:     query.Key,
-				Schema: huma.SchemaFromType(api.OpenAPI().Components.Schemas, typeTime),
-			},
-			{
-				Name:   query.MaxReturnedAtKey,
-				In:     query.Key,
-				Schema: huma.SchemaFromType(api.OpenAPI().Components.Schemas, typeTime),
-			},
-			{
-				Name:   query.MinCreatedAtKey,
-				In:     query.Key,
-				Schema: huma.SchemaFromType(api.OpenAPI().Components.Schemas, typeTime),
+		Responses: fileResponses(api, "A page of the results, or all the results as a file", TransactionsInfo{}, csvContentType, xlsxContentType),
+	}, app.searchTransactionsHandler)
+}
+
+// registerEmails registers email template endpoints.
+func (app *Application) registerEmails(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "preview-email",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s/{%s}/%s", basePath, emailsKey, nameKey, previewKey),
+		Summary:     "Preview an email",
+		Description: "Render an email template with sample data",
+		Tags:        []string{emailsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.previewEmailHandler)
+}
+
+// registerNotifications registers notification outbox endpoints.
+func (app *Application) registerNotifications(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "get-notifications",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s", basePath, notificationsKey),
+		Summary:     "Get Notifications",
+		Description: "Get all Notifications with their delivery status",
+		Tags:        []string{notificationsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.getNotificationsHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "resend-failed-notifications",
+		Method:      http.MethodPost,
+		Path:        fmt.Sprintf("%s/%s/%s", basePath, notificationsKey, resendKey),
+		Summary:     "Resend failed Notifications",
+		Description: "Deliver all failed Notifications again",
+		Tags:        []string{notificationsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.resendFailedNotificationsHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "resend-notification",
+		Method:      http.MethodPost,
+		Path:        fmt.Sprintf("%s/%s/{%s}/%s", basePath, notificationsKey, idKey, resendKey),
+		Summary:     "Resend a Notification",
+		Description: "Deliver a Notification which was not sent again",
+		Tags:        []string{notificationsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.resendNotificationHandler)
+}
+
+// registerAvailability registers endpoints of the availability of books.
+func (app *Application) registerAvailability(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "get-availability",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s", basePath, availabilityKey),
+		Summary:     "Get the availability of Books",
+		Description: "Get the available copies and the loans of all Books, such as the most borrowed ones",
+		Tags:        []string{booksKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.getAvailabilityHandler)
+}
+
+// registerAudit registers audit log endpoints.
+func (app *Application) registerAudit(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "get-audit-log",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s", basePath, auditKey),
+		Summary:     "Get the Audit Log",
+		Description: "Get the corrections which admins made to the circulation state, with their reasons",
+		Tags:        []string{auditKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.getAuditLogHandler)
+}
+
+// registerFines registers endpoints for correcting the fines of transactions.
+func (app *Application) registerFines(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "waive-fine",
+		Method:      http.MethodPost,
+		Path:        fmt.Sprintf("%s/%s/{%s}/%s", basePath, finesKey, idKey, waiveKey),
+		Summary:     "Waive a Fine",
+		Description: "Waive the fine of a Transaction. The reason is recorded in the audit log",
+		Tags:        []string{finesKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.waiveFineHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "adjust-fine",
+		Method:      http.MethodPost,
+		Path:        fmt.Sprintf("%s/%s/{%s}/%s", basePath, finesKey, idKey, adjustKey),
+		Summary:     "Adjust a Fine",
+		Description: "Replace the fine of a Transaction with another amount. The reason is recorded in the audit log",
+		Tags:        []string{finesKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.adjustFineHandler)
+}
+
+// registerPayments registers the endpoints for paying fines online and at the desk.
+func (app *Application) registerPayments(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "checkout-fines",
+		Method:      http.MethodPost,
+		Path:        fmt.Sprintf("%s/%s/%s/%s/%s", basePath, patronsKey, meKey, finesKey, checkoutKey),
+		Summary:     "Pay the Fines",
+		Description: "Create a checkout session of the payment provider, in which the authenticated patron pays their outstanding fines",
+		Tags:        []string{paymentsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requirePermission(api, auth.ReadPatronPermission)},
+		Security: []map[string][]string{
+			{bearerSecKey: {}},
+		},
+	}, app.checkoutFinesHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "payment-webhook",
+		Method:      http.MethodPost,
+		Path:        fmt.Sprintf("%s/%s/%s", basePath, paymentsKey, webhookKey),
+		Summary:     "Payment Webhook",
+		Description: "Receive the notifications of the payment provider about checkout sessions, which are verified by their signature",
+		Tags:        []string{paymentsKey},
+	}, app.paymentWebhookHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "record-payment",
+		Method:      http.MethodPost,
+		Path:        fmt.Sprintf("%s/%s", basePath, paymentsKey),
+		Summary:     "Record a Payment",
+		Description: "Record a payment of fines in cash or by check, which the authenticated admin accepted at the desk",
+		Tags:        []string{paymentsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.recordPaymentHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-cash-report",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s/%s", basePath, reportsKey, cashKey),
+		Summary:     "Get the Cash Report",
+		Description: "Sum up the payments taken at the desk on a day, in total and per admin who accepted them",
+		Tags:        []string{reportsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.getCashReportHandler)
+}
+
+// registerAcquisitions registers the endpoints for tracking donated and purchased books.
+func (app *Application) registerAcquisitions(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "create-acquisition",
+		Method:      http.MethodPost,
+		Path:        fmt.Sprintf("%s/%s", basePath, acquisitionsKey),
+		Summary:     "Create an Acquisition",
+		Description: "Record copies of a book which were donated to or purchased by the library",
+		Tags:        []string{acquisitionsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.createAcquisitionHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-acquisitions",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s", basePath, acquisitionsKey),
+		Summary:     "Get Acquisitions",
+		Description: "Get all Acquisitions with optional filtering and sorting",
+		Tags:        []string{acquisitionsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.getAcquisitionsHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-acquisition",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s/{%s}", basePath, acquisitionsKey, idKey),
+		Summary:     "Get an Acquisition",
+		Description: "Get an Acquisition from a specific ID",
+		Tags:        []string{acquisitionsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.getAcquisitionHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "catalog-acquisition",
+		Method:      http.MethodPost,
+		Path:        fmt.Sprintf("%s/%s/{%s}/%s", basePath, acquisitionsKey, idKey, catalogKey),
+		Summary:     "Catalog an Acquisition",
+		Description: "Add the copies of an Acquisition to a Book of the catalog",
+		Tags:        []string{acquisitionsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.catalogAcquisitionHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-book-acquisitions",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s/{%s}/%s", basePath, booksKey, idKey, acquisitionsKey),
+		Summary:     "Get the Acquisitions of a Book",
+		Description: "Get the Acquisitions whose copies were added to a Book",
+		Tags:        []string{acquisitionsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.getBookAcquisitionsHandler)
+}
+
+// registerCatalog registers the anonymous endpoints of the public catalog, by which the website of
+// the library shows its holdings to visitors without accounts.
+func (app *Application) registerCatalog(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "get-catalog-books",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s/%s", basePath, catalogKey, booksKey),
+		Summary:     "Get the Books of the catalog",
+		Description: "Get the bibliographic records, holdings and available copies of Books, anonymously",
+		Tags:        []string{catalogKey},
+	}, app.getCatalogBooksHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-catalog-book",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s/%s/{%s}", basePath, catalogKey, booksKey, idKey),
+		Summary:     "Get a Book of the catalog",
+		Description: "Get the bibliographic record, holdings and available copies of a Book from a specific ID, anonymously",
+		Tags:        []string{catalogKey},
+	}, app.getCatalogBookHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-catalog-book-availability",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s/%s/{%s}/%s", basePath, catalogKey, booksKey, idKey, availabilityKey),
+		Summary:     "Get the availability of a Book of the catalog",
+		Description: "Get the copies and the available copies of a Book from a specific ID, anonymously and from any origin, for the availability widget which other sites embed",
+		Tags:        []string{catalogKey},
+	}, app.getCatalogAvailabilityHandler)
+}
+
+// registerSavedSearches registers the endpoints for saving searches of books, patrons and
+// transactions, and for running them.
+func (app *Application) registerSavedSearches(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "create-saved-search",
+		Method:      http.MethodPost,
+		Path:        fmt.Sprintf("%s/%s", basePath, searchesKey),
+		Summary:     "Create a Saved Search",
+		Description: "Save a named search of Books, Patrons or Transactions, optionally emailing its results on a schedule",
+		Tags:        []string{searchesKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.createSavedSearchHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-saved-searches",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s", basePath, searchesKey),
+		Summary:     "Get Saved Searches",
+		Description: "Get Saved Searches with optional filtering and sorting",
+		Tags:        []string{searchesKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.getSavedSearchesHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-saved-search",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s/{%s}", basePath, searchesKey, idKey),
+		Summary:     "Get a Saved Search",
+		Description: "Get a Saved Search from a specific ID",
+		Tags:        []string{searchesKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.getSavedSearchHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "update-saved-search",
+		Method:      http.MethodPut,
+		Path:        fmt.Sprintf("%s/%s/{%s}", basePath, searchesKey, idKey),
+		Summary:     "Update a Saved Search",
+		Description: "Update the fields of a specific Saved Search, such as its query or its schedule",
+		Tags:        []string{searchesKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.updateSavedSearchHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "delete-saved-search",
+		Method:      http.MethodDelete,
+		Path:        fmt.Sprintf("%s/%s/{%s}", basePath, searchesKey, idKey),
+		Summary:     "Delete a Saved Search",
+		Description: "Delete a specific Saved Search, which also stops its schedule",
+		Tags:        []string{searchesKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.deleteSavedSearchHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "run-saved-search",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s/{%s}/%s", basePath, searchesKey, idKey, runKey),
+		Summary:     "Run a Saved Search",
+		Description: "Run a specific Saved Search, returning a page of its results or exporting them like the search of its target",
+		Tags:        []string{searchesKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+		Responses: fileResponses(api, "A page of the results, like those of the search of the target of the Saved Search, or all the results as a file", map[string]any{}, csvContentType, xlsxContentType),
+	}, app.runSavedSearchHandler)
+}
+
+// registerSRU registers the SRU endpoint, by which other libraries and federated search tools search the catalog.
+func (app *Application) registerSRU(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "sru",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s", basePath, sruKey),
+		Summary:     "Search Books with SRU",
+		Description: "Search Books with CQL queries by SRU 1.2, returning Dublin Core records, or describe the server with the explain operation",
+		Tags:        []string{searchKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requirePermission(api, auth.ReadBooksPermission)},
+		Security: []map[string][]string{
+			{bearerSecKey: {}},
+			{basicAuthKey: {}},
+		},
+		Responses: map[string]*huma.Response{
+			"200": {
+				Description: "SRU response, with diagnostics if the request failed",
+				Content:     map[string]*huma.MediaType{sru.ContentType: {Schema: &huma.Schema{Type: huma.TypeString}}},
 			},
-			{
-				Name:   query.MaxCreatedAtKey,
-				In:     query.Key,
-				Schema: huma.SchemaFromType(api.OpenAPI().Components.Schemas, typeTime),
+		},
+	}, app.sruHandler)
+}
+
+// registerOAI registers the OAI-PMH endpoint, by which aggregators harvest the catalog.
+func (app *Application) registerOAI(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "oai",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s", basePath, oaiKey),
+		Summary:     "Harvest Books with OAI-PMH",
+		Description: "Harvest the Dublin Core records of Books by OAI-PMH 2.0, incrementally by when they were updated, with resumption tokens for lists of more than 100 records",
+		Tags:        []string{searchKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requirePermission(api, auth.ReadBooksPermission)},
+		Security: []map[string][]string{
+			{bearerSecKey: {}},
+			{basicAuthKey: {}},
+		},
+		Responses: map[string]*huma.Response{
+			"200": {
+				Description: "OAI-PMH response, with errors if the request failed",
+				Content:     map[string]*huma.MediaType{oai.ContentType: {Schema: &huma.Schema{Type: huma.TypeString}}},
 			},
 		},
-	}, app.searchTransactionsHandler)
+	}, app.oaiHandler)
 }
 
-func (app *Application) registerToken(api huma.API) {
+// registerSuggestions registers the endpoints by which patrons suggest titles to acquire, and admins triage them.
+func (app *Application) registerSuggestions(api huma.API) {
 	huma.Register(api, huma.Operation{
-		OperationID: "create-auth-token",
+		OperationID: "create-suggestion",
 		Method:      http.MethodPost,
-		Path:        fmt.Sprintf("%s/%s/%s", basePath, tokensKey, authenticationKey),
-		Summary:     "Create an auth token",
-		Description: "Create a specific auth token",
-		Tags:        []string{tokensKey},
-	}, app.createAuthTokenHandler)
+		Path:        fmt.Sprintf("%s/%s", basePath, suggestionsKey),
+		Summary:     "Suggest a Book",
+		Description: "Suggest a title for the library to acquire, unless a book with its ISBN, or with its title by one of its authors, is already in the catalog",
+		Tags:        []string{suggestionsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requirePermission(api, auth.ReadBooksPermission)},
+		Security: []map[string][]string{
+			{bearerSecKey: {}},
+		},
+	}, app.createSuggestionHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-my-suggestions",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s/%s/%s", basePath, patronsKey, meKey, suggestionsKey),
+		Summary:     "Get my Suggestions",
+		Description: "Get the Suggestions of the authenticated patron, with the responses of the admins",
+		Tags:        []string{suggestionsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requirePermission(api, auth.ReadPatronPermission)},
+		Security: []map[string][]string{
+			{bearerSecKey: {}},
+		},
+	}, app.getMySuggestionsHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-suggestions",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s", basePath, suggestionsKey),
+		Summary:     "Get Suggestions",
+		Description: "Get all Suggestions with optional filtering and sorting",
+		Tags:        []string{suggestionsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.getSuggestionsHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-suggestion",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s/{%s}", basePath, suggestionsKey, idKey),
+		Summary:     "Get a Suggestion",
+		Description: "Get a Suggestion from a specific ID",
+		Tags:        []string{suggestionsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.getSuggestionHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "accept-suggestion",
+		Method:      http.MethodPost,
+		Path:        fmt.Sprintf("%s/%s/{%s}/%s", basePath, suggestionsKey, idKey, acceptKey),
+		Summary:     "Accept a Suggestion",
+		Description: "Accept a pending Suggestion, which the library intends to acquire",
+		Tags:        []string{suggestionsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.acceptSuggestionHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "reject-suggestion",
+		Method:      http.MethodPost,
+		Path:        fmt.Sprintf("%s/%s/{%s}/%s", basePath, suggestionsKey, idKey, rejectKey),
+		Summary:     "Reject a Suggestion",
+		Description: "Reject a pending or accepted Suggestion, which the library will not acquire",
+		Tags:        []string{suggestionsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.rejectSuggestionHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "order-suggestion",
+		Method:      http.MethodPost,
+		Path:        fmt.Sprintf("%s/%s/{%s}/%s", basePath, suggestionsKey, idKey, orderKey),
+		Summary:     "Order a Suggestion",
+		Description: "Mark a pending or accepted Suggestion as ordered from a vendor",
+		Tags:        []string{suggestionsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.orderSuggestionHandler)
+}
+
+// registerResources registers the endpoints for managing the rooms and equipment which patrons
+// reserve, and for browsing them and their availability.
+func (app *Application) registerResources(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "create-resource",
+		Method:      http.MethodPost,
+		Path:        fmt.Sprintf("%s/%s", basePath, resourcesKey),
+		Summary:     "Create a Resource",
+		Description: "Add a room or an item of equipment, such as a study room or a laptop, which patrons can reserve",
+		Tags:        []string{resourcesKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.createResourceHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-resources",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s", basePath, resourcesKey),
+		Summary:     "Get Resources",
+		Description: "Get all rooms and equipment with optional filtering and sorting",
+		Tags:        []string{resourcesKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requirePermission(api, auth.ReadBooksPermission)},
+		Security: []map[string][]string{
+			{bearerSecKey: {}},
+			{basicAuthKey: {}},
+		},
+	}, app.getResourcesHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-resource",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s/{%s}", basePath, resourcesKey, idKey),
+		Summary:     "Get a Resource",
+		Description: "Get a Resource from a specific ID",
+		Tags:        []string{resourcesKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requirePermission(api, auth.ReadBooksPermission)},
+		Security: []map[string][]string{
+			{bearerSecKey: {}},
+			{basicAuthKey: {}},
+		},
+	}, app.getResourceHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "update-resource",
+		Method:      http.MethodPut,
+		Path:        fmt.Sprintf("%s/%s/{%s}", basePath, resourcesKey, idKey),
+		Summary:     "Update a Resource",
+		Description: "Update the fields of a specific Resource, or deactivate it so that it can't be reserved",
+		Tags:        []string{resourcesKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.updateResourceHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-resource-availability",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s/{%s}/%s", basePath, resourcesKey, idKey, availabilityKey),
+		Summary:     "Get the Availability of a Resource",
+		Description: "Get the time slots of a Resource on a day, and which of them can be reserved",
+		Tags:        []string{resourcesKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requirePermission(api, auth.ReadBooksPermission)},
+		Security: []map[string][]string{
+			{bearerSecKey: {}},
+			{basicAuthKey: {}},
+		},
+	}, app.getResourceAvailabilityHandler)
+}
+
+// registerReservations registers the endpoints by which patrons reserve rooms and equipment, and
+// admins oversee the reservations.
+func (app *Application) registerReservations(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "create-reservation",
+		Method:      http.MethodPost,
+		Path:        fmt.Sprintf("%s/%s/{%s}/%s", basePath, resourcesKey, idKey, reservationsKey),
+		Summary:     "Reserve a Resource",
+		Description: "Reserve a Resource for consecutive time slots of a day, unless it is already reserved for any of them. The patron is notified of the reservation",
+		Tags:        []string{reservationsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requirePermission(api, auth.ReadBooksPermission)},
+		Security: []map[string][]string{
+			{bearerSecKey: {}},
+		},
+	}, app.createReservationHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-my-reservations",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s/%s/%s", basePath, patronsKey, meKey, reservationsKey),
+		Summary:     "Get my Reservations",
+		Description: "Get the Reservations of the authenticated patron",
+		Tags:        []string{reservationsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requirePermission(api, auth.ReadPatronPermission)},
+		Security: []map[string][]string{
+			{bearerSecKey: {}},
+		},
+	}, app.getMyReservationsHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "cancel-my-reservation",
+		Method:      http.MethodPost,
+		Path:        fmt.Sprintf("%s/%s/%s/%s/{%s}/%s", basePath, patronsKey, meKey, reservationsKey, idKey, cancelKey),
+		Summary:     "Cancel my Reservation",
+		Description: "Cancel a Reservation of the authenticated patron which has not ended, freeing its time slots",
+		Tags:        []string{reservationsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requirePermission(api, auth.ReadBooksPermission)},
+		Security: []map[string][]string{
+			{bearerSecKey: {}},
+		},
+	}, app.cancelMyReservationHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-reservations",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s", basePath, reservationsKey),
+		Summary:     "Get Reservations",
+		Description: "Get all Reservations with optional filtering and sorting",
+		Tags:        []string{reservationsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.getReservationsHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-reservation",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s/{%s}", basePath, reservationsKey, idKey),
+		Summary:     "Get a Reservation",
+		Description: "Get a Reservation from a specific ID",
+		Tags:        []string{reservationsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.getReservationHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "cancel-reservation",
+		Method:      http.MethodPost,
+		Path:        fmt.Sprintf("%s/%s/{%s}/%s", basePath, reservationsKey, idKey, cancelKey),
+		Summary:     "Cancel a Reservation",
+		Description: "Cancel a Reservation of any patron which has not ended. The patron is notified with the reason",
+		Tags:        []string{reservationsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.cancelReservationHandler)
+}
+
+// registerPrograms registers the endpoints for managing the programs of the library, such as story
+// hours and workshops, and for browsing them.
+func (app *Application) registerPrograms(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "create-program",
+		Method:      http.MethodPost,
+		Path:        fmt.Sprintf("%s/%s", basePath, programsKey),
+		Summary:     "Create a Program",
+		Description: "Add a program, such as a story hour or a workshop, which patrons can register to",
+		Tags:        []string{programsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.createProgramHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-programs",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s", basePath, programsKey),
+		Summary:     "Get Programs",
+		Description: "Get the upcoming Programs with optional filtering and sorting",
+		Tags:        []string{programsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requirePermission(api, auth.ReadBooksPermission)},
+		Security: []map[string][]string{
+			{bearerSecKey: {}},
+			{basicAuthKey: {}},
+		},
+	}, app.getProgramsHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-program",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s/{%s}", basePath, programsKey, idKey),
+		Summary:     "Get a Program",
+		Description: "Get a Program from a specific ID",
+		Tags:        []string{programsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requirePermission(api, auth.ReadBooksPermission)},
+		Security: []map[string][]string{
+			{bearerSecKey: {}},
+			{basicAuthKey: {}},
+		},
+	}, app.getProgramHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "update-program",
+		Method:      http.MethodPut,
+		Path:        fmt.Sprintf("%s/%s/{%s}", basePath, programsKey, idKey),
+		Summary:     "Update a Program",
+		Description: "Update the fields of a specific Program. Raising its capacity registers waitlisted patrons",
+		Tags:        []string{programsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.updateProgramHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "delete-program",
+		Method:      http.MethodDelete,
+		Path:        fmt.Sprintf("%s/%s/{%s}", basePath, programsKey, idKey),
+		Summary:     "Delete a Program",
+		Description: "Delete a specific Program, canceling the registrations to it. Its patrons are notified if it has not started",
+		Tags:        []string{programsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.deleteProgramHandler)
+}
+
+// registerRegistrations registers the endpoints by which patrons register to programs, and admins
+// oversee the registrations to them.
+func (app *Application) registerRegistrations(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "create-registration",
+		Method:      http.MethodPost,
+		Path:        fmt.Sprintf("%s/%s/{%s}/%s", basePath, programsKey, idKey, registrationsKey),
+		Summary:     "Register to a Program",
+		Description: "Register to a Program which has not started, or join its waitlist if it is full. The patron is notified of the registration",
+		Tags:        []string{registrationsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requirePermission(api, auth.ReadBooksPermission)},
+		Security: []map[string][]string{
+			{bearerSecKey: {}},
+		},
+	}, app.createRegistrationHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-program-registrations",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s/{%s}/%s", basePath, programsKey, idKey, registrationsKey),
+		Summary:     "Get the Registrations to a Program",
+		Description: "Get the Registrations to a Program, in the order of its waitlist by default",
+		Tags:        []string{registrationsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.getProgramRegistrationsHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-my-registrations",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s/%s/%s", basePath, patronsKey, meKey, registrationsKey),
+		Summary:     "Get my Registrations",
+		Description: "Get the Registrations of the authenticated patron to Programs",
+		Tags:        []string{registrationsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requirePermission(api, auth.ReadPatronPermission)},
+		Security: []map[string][]string{
+			{bearerSecKey: {}},
+		},
+	}, app.getMyRegistrationsHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "cancel-my-registration",
+		Method:      http.MethodPost,
+		Path:        fmt.Sprintf("%s/%s/%s/%s/{%s}/%s", basePath, patronsKey, meKey, registrationsKey, idKey, cancelKey),
+		Summary:     "Cancel my Registration",
+		Description: "Cancel a Registration of the authenticated patron to a Program which has not started. Its place goes to the first patron on the waitlist",
+		Tags:        []string{registrationsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requirePermission(api, auth.ReadBooksPermission)},
+		Security: []map[string][]string{
+			{bearerSecKey: {}},
+		},
+	}, app.cancelMyRegistrationHandler)
+}
+
+// registerAnnouncements registers the endpoints for scheduling announcements, and for fetching the
+// announcements shown to a client, which anonymous clients may also do.
+func (app *Application) registerAnnouncements(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "create-announcement",
+		Method:      http.MethodPost,
+		Path:        fmt.Sprintf("%s/%s", basePath, announcementsKey),
+		Summary:     "Create an Announcement",
+		Description: "Schedule an announcement, such as a maintenance notice or the hours of a holiday, for an audience",
+		Tags:        []string{announcementsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.createAnnouncementHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-announcements",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s", basePath, announcementsKey),
+		Summary:     "Get Announcements",
+		Description: "Get the active Announcements to the audience of the client, or all Announcements for admins, with optional filtering and sorting",
+		Tags:        []string{announcementsKey},
+		Middlewares: huma.Middlewares{app.authenticateOptional(api)},
+		Security: []map[string][]string{
+			{},
+			{bearerSecKey: {}},
+			{basicAuthKey: {}},
+		},
+	}, app.getAnnouncementsHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-announcement",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s/{%s}", basePath, announcementsKey, idKey),
+		Summary:     "Get an Announcement",
+		Description: "Get an Announcement from a specific ID",
+		Tags:        []string{announcementsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.getAnnouncementHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "update-announcement",
+		Method:      http.MethodPut,
+		Path:        fmt.Sprintf("%s/%s/{%s}", basePath, announcementsKey, idKey),
+		Summary:     "Update an Announcement",
+		Description: "Update the fields of a specific Announcement, such as its schedule",
+		Tags:        []string{announcementsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.updateAnnouncementHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "delete-announcement",
+		Method:      http.MethodDelete,
+		Path:        fmt.Sprintf("%s/%s/{%s}", basePath, announcementsKey, idKey),
+		Summary:     "Delete an Announcement",
+		Description: "Delete a specific Announcement, which stops showing it",
+		Tags:        []string{announcementsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.deleteAnnouncementHandler)
+}
+
+// registerLabels registers the endpoints for printing labels of copies.
+func (app *Application) registerLabels(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "create-labels",
+		Method:      http.MethodPost,
+		Path:        fmt.Sprintf("%s/%s", basePath, labelsKey),
+		Summary:     "Create Labels",
+		Description: "Get a printable PDF sheet of the spine and barcode labels of copies of Books, such as the copies of new Acquisitions",
+		Tags:        []string{labelsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+		Responses: map[string]*huma.Response{
+			"200": {
+				Description: "PDF sheet of labels",
+				Content:     map[string]*huma.MediaType{labels.ContentType: {Schema: &huma.Schema{Type: huma.TypeString, Format: "binary"}}},
+			},
+		},
+	}, app.createLabelsHandler)
+}
+
+// registerWithdrawals registers the endpoints for withdrawing copies from the stock.
+func (app *Application) registerWithdrawals(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "withdraw-copies",
+		Method:      http.MethodPost,
+		Path:        fmt.Sprintf("%s/%s/{%s}/%s", basePath, booksKey, idKey, withdrawKey),
+		Summary:     "Withdraw Copies",
+		Description: "Retire copies of a Book which are damaged, lost or outdated, so that they cannot be borrowed",
+		Tags:        []string{withdrawalsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.withdrawCopiesHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-withdrawals",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s", basePath, withdrawalsKey),
+		Summary:     "Get Withdrawals",
+		Description: "Get the copies which were withdrawn from the stock, with the total of the withdrawn copies",
+		Tags:        []string{withdrawalsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.getWithdrawalsHandler)
+}
+
+// registerInventory registers the endpoints for taking stock of the copies on the shelves.
+func (app *Application) registerInventory(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "open-inventory",
+		Method:      http.MethodPost,
+		Path:        fmt.Sprintf("%s/%s", basePath, inventoryKey),
+		Summary:     "Open Inventory",
+		Description: "Open an inventory session to take stock of the copies on the shelves, optionally of some genres",
+		Tags:        []string{inventoryKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.openInventoryHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-inventory-sessions",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s", basePath, inventoryKey),
+		Summary:     "Get Inventory Sessions",
+		Description: "Get the inventory sessions",
+		Tags:        []string{inventoryKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.getInventorySessionsHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-inventory-session",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s/{%s}", basePath, inventoryKey, idKey),
+		Summary:     "Get Inventory Session",
+		Description: "Get an inventory session by its ID",
+		Tags:        []string{inventoryKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.getInventorySessionHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "scan-inventory",
+		Method:      http.MethodPost,
+		Path:        fmt.Sprintf("%s/%s/{%s}/%s", basePath, inventoryKey, idKey, scansKey),
+		Summary:     "Scan Inventory",
+		Description: "Record a batch of barcodes scanned in an open inventory session, one for each copy",
+		Tags:        []string{inventoryKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.scanInventoryHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-inventory-report",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s/{%s}/%s", basePath, inventoryKey, idKey, reportKey),
+		Summary:     "Get Inventory Report",
+		Description: "Get the discrepancies between the expected and the scanned copies of an inventory session: missing, surplus and misplaced copies, and unknown barcodes",
+		Tags:        []string{inventoryKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.getInventoryReportHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "close-inventory",
+		Method:      http.MethodPost,
+		Path:        fmt.Sprintf("%s/%s/{%s}/%s", basePath, inventoryKey, idKey, closeKey),
+		Summary:     "Close Inventory",
+		Description: "Close an inventory session and store its discrepancy report",
+		Tags:        []string{inventoryKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.closeInventoryHandler)
+}
+
+// registerEvents registers event outbox endpoints.
+func (app *Application) registerEvents(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "get-events",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s", basePath, eventsKey),
+		Summary:     "Get Events",
+		Description: "Get all domain Events of the outbox with their dispatch status",
+		Tags:        []string{eventsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.getEventsHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "retry-event",
+		Method:      http.MethodPost,
+		Path:        fmt.Sprintf("%s/%s/{%s}/%s", basePath, eventsKey, idKey, retryKey),
+		Summary:     "Retry an Event",
+		Description: "Dispatch an Event which was not dispatched again",
+		Tags:        []string{eventsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.retryEventHandler)
+}
+
+func (app *Application) registerToken(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "create-auth-token",
+		Method:      http.MethodPost,
+		Path:        fmt.Sprintf("%s/%s/%s", basePath, tokensKey, authenticationKey),
+		Summary:     "Create an auth token",
+		Description: "Create a specific auth token",
+		Tags:        []string{tokensKey},
+	}, app.createAuthTokenHandler)
+}
+
+// registerReports registers report endpoints.
+func (app *Application) registerReports(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "send-overdue-report",
+		Method:      http.MethodPost,
+		Path:        fmt.Sprintf("%s/%s/%s", basePath, reportsKey, overdueKey),
+		Summary:     "Send the overdue report",
+		Description: "Email the overdue items per patron and per book to the librarians now, instead of waiting for the weekly report, or the items which were overdue as of a past day",
+		Tags:        []string{reportsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.sendOverdueReportHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-daily-stats",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s/%s", basePath, reportsKey, dailyKey),
+		Summary:     "Get the daily statistics",
+		Description: "Get the nightly rollups of the borrows, returns, new patrons and fines of each day",
+		Tags:        []string{reportsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.getDailyStatsHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-circulation-report",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s/%s", basePath, reportsKey, circulationKey),
+		Summary:     "Get the Circulation Report",
+		Description: "Get the total borrows, returns, new patrons and fines from the daily rollups, and the active and overdue loans, now or as of a past day",
+		Tags:        []string{reportsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.getCirculationReportHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-delinquent-patrons",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s/%s", basePath, reportsKey, delinquentKey),
+		Summary:     "Get the delinquent patrons",
+		Description: "Get the patrons with the most overdue loans or the highest fines, or export them as a CSV or XLSX file",
+		Tags:        []string{reportsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.getDelinquentPatronsHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "remind-delinquent-patrons",
+		Method:      http.MethodPost,
+		Path:        fmt.Sprintf("%s/%s/%s/%s", basePath, reportsKey, delinquentKey, remindKey),
+		Summary:     "Remind the delinquent patrons",
+		Description: "Notify each of the patrons with the most overdue loans or the highest fines of each of their overdue loans",
+		Tags:        []string{reportsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.remindDelinquentPatronsHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-collection-report",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s/%s", basePath, reportsKey, collectionKey),
+		Summary:     "Get the Collection Report",
+		Description: "Get the titles, copies and borrows of the books by the decade they were published and the year they were acquired, or export them as a CSV or XLSX file",
+		Tags:        []string{reportsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.getCollectionReportHandler)
+}
+
+// registerSCIM registers the SCIM endpoints, by which an identity provider provisions patrons,
+// which are not registered if no SCIM token is configured.
+func (app *Application) registerSCIM(api huma.API) {
+	if app.Config.SCIM.Token == "" {
+		return
+	}
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-scim-users",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s/%s", basePath, scimKey, usersKey),
+		Summary:     "Get SCIM Users",
+		Description: "Get the patrons as SCIM Users, such as to find a User by their userName or externalId before provisioning them",
+		Tags:        []string{scimSecKey},
+		Middlewares: huma.Middlewares{app.authenticateSCIM(api)},
+		Security: []map[string][]string{
+			{scimSecKey: {}},
+		},
+	}, scimHandler(app.getSCIMUsersHandler))
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-scim-user",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s/%s/{%s}", basePath, scimKey, usersKey, idKey),
+		Summary:     "Get a SCIM User",
+		Description: "Get a patron as a SCIM User from a specific ID",
+		Tags:        []string{scimSecKey},
+		Middlewares: huma.Middlewares{app.authenticateSCIM(api)},
+		Security: []map[string][]string{
+			{scimSecKey: {}},
+		},
+	}, scimHandler(app.getSCIMUserHandler))
+
+	huma.Register(api, huma.Operation{
+		OperationID:   "create-scim-user",
+		Method:        http.MethodPost,
+		Path:          fmt.Sprintf("%s/%s/%s", basePath, scimKey, usersKey),
+		Summary:       "Create a SCIM User",
+		Description:   "Provision a SCIM User as a patron of the category of their groups. A patron without a password is sent an activation token",
+		Tags:          []string{scimSecKey},
+		DefaultStatus: http.StatusCreated,
+		Middlewares:   huma.Middlewares{app.authenticateSCIM(api)},
+		Security: []map[string][]string{
+			{scimSecKey: {}},
+		},
+	}, scimHandler(app.createSCIMUserHandler))
+
+	huma.Register(api, huma.Operation{
+		OperationID: "replace-scim-user",
+		Method:      http.MethodPut,
+		Path:        fmt.Sprintf("%s/%s/%s/{%s}", basePath, scimKey, usersKey, idKey),
+		Summary:     "Replace a SCIM User",
+		Description: "Replace the patron of a SCIM User from a specific ID. A User which is not active suspends the patron",
+		Tags:        []string{scimSecKey},
+		Middlewares: huma.Middlewares{app.authenticateSCIM(api)},
+		Security: []map[string][]string{
+			{scimSecKey: {}},
+		},
+	}, scimHandler(app.replaceSCIMUserHandler))
+
+	huma.Register(api, huma.Operation{
+		OperationID: "patch-scim-user",
+		Method:      http.MethodPatch,
+		Path:        fmt.Sprintf("%s/%s/%s/{%s}", basePath, scimKey, usersKey, idKey),
+		Summary:     "Patch a SCIM User",
+		Description: "Patch the patron of a SCIM User from a specific ID, such as to deactivate them, which suspends the patron",
+		Tags:        []string{scimSecKey},
+		Middlewares: huma.Middlewares{app.authenticateSCIM(api)},
+		Security: []map[string][]string{
+			{scimSecKey: {}},
+		},
+	}, scimHandler(app.patchSCIMUserHandler))
+
+	huma.Register(api, huma.Operation{
+		OperationID:   "delete-scim-user",
+		Method:        http.MethodDelete,
+		Path:          fmt.Sprintf("%s/%s/%s/{%s}", basePath, scimKey, usersKey, idKey),
+		Summary:       "Delete a SCIM User",
+		Description:   "Delete the patron of a SCIM User from a specific ID",
+		Tags:          []string{scimSecKey},
+		DefaultStatus: http.StatusNoContent,
+		Middlewares:   huma.Middlewares{app.authenticateSCIM(api)},
+		Security: []map[string][]string{
+			{scimSecKey: {}},
+		},
+	}, scimHandler(app.deleteSCIMUserHandler))
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-scim-service-provider-config",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s/%s", basePath, scimKey, serviceConfigKey),
+		Summary:     "Get the SCIM service provider configuration",
+		Description: "Get the SCIM features which are supported",
+		Tags:        []string{scimSecKey},
+		Middlewares: huma.Middlewares{app.authenticateSCIM(api)},
+		Security: []map[string][]string{
+			{scimSecKey: {}},
+		},
+	}, scimHandler(app.getServiceProviderConfigHandler))
+}
+
+// registerRetention registers the retention policy endpoint, which is not registered if no
+// retention period is configured.
+func (app *Application) registerRetention(api huma.API) {
+	if app.Config.Retention.Years == 0 {
+		return
+	}
+
+	huma.Register(api, huma.Operation{
+		OperationID: "apply-retention",
+		Method:      http.MethodPost,
+		Path:        fmt.Sprintf("%s/%s/%s", basePath, transactionsKey, retentionKey),
+		Summary:     "Apply the retention policy",
+		Description: "Anonymize or delete the returned Transactions past the retention period now, instead of waiting for the next scheduled run, or count them with a dry run",
+		Tags:        []string{transactionsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.applyRetentionHandler)
+}
+
+// registerFixtures registers fixture endpoints, which are not registered in production.
+func (app *Application) registerFixtures(api huma.API) {
+	if app.Config.Environment == productionEnvironment {
+		return
+	}
+
+	huma.Register(api, huma.Operation{
+		OperationID: "load-fixture",
+		Method:      http.MethodPost,
+		Path:        fmt.Sprintf("%s/%s", basePath, fixturesKey),
+		Summary:     "Load a fixture set",
+		Description: "Fill the database with the generated books, patrons, transactions, resources and reservations of a fixture set, for staging environments",
+		Tags:        []string{fixturesKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.loadFixtureHandler)
+}
+
+// registerFeeds registers calendar feed endpoints.
+func (app *Application) registerFeeds(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "create-feed-token",
+		Method:      http.MethodPost,
+		Path:        fmt.Sprintf("%s/%s/%s", basePath, tokensKey, feedKey),
+		Summary:     "Create a feed token",
+		Description: "Create a token for subscribing to the due dates calendar feed of the authenticated patron",
+		Tags:        []string{tokensKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requirePermission(api, auth.ReadPatronPermission)},
+		Security: []map[string][]string{
+			{bearerSecKey: {}},
+		},
+	}, app.createFeedTokenHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-due-dates-feed",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s/%s/%s", basePath, patronsKey, meKey, dueDatesFeedKey),
+		Summary:     "Get the due dates calendar feed",
+		Description: "Get an iCalendar feed of the due dates of the books borrowed by the patron of the feed token",
+		Tags:        []string{patronsKey},
+		Responses: map[string]*huma.Response{
+			"200": {
+				Description: "iCalendar feed",
+				Content:     map[string]*huma.MediaType{"text/calendar": {}},
+			},
+		},
+	}, app.getDueDatesFeedHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-new-arrivals-feed",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s/%s", basePath, booksKey, arrivalsFeedKey),
+		Summary:     "Get the new arrivals feed",
+		Description: "Get an Atom feed of the Books which were added recently, anonymously, to subscribe to in a feed reader",
+		Tags:        []string{booksKey},
+		Responses: map[string]*huma.Response{
+			"200": {
+				Description: "Atom feed",
+				Content:     map[string]*huma.MediaType{"application/atom+xml": {}},
+			},
+		},
+	}, app.getNewArrivalsFeedHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-genre-feed",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s/%s/{genre}%s", basePath, feedsKey, genresKey, genreFeedExt),
+		Summary:     "Get the feed of a genre",
+		Description: "Get an Atom feed of the Books of a genre which were added recently, anonymously, to subscribe to in a feed reader",
+		Tags:        []string{booksKey},
+		Responses: map[string]*huma.Response{
+			"200": {
+				Description: "Atom feed",
+				Content:     map[string]*huma.MediaType{"application/atom+xml": {}},
+			},
+		},
+	}, app.getGenreFeedHandler)
+}
+
+// registerPINs registers the endpoints of patrons for managing their kiosk PIN.
+func (app *Application) registerPINs(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "set-pin",
+		Method:      http.MethodPut,
+		Path:        fmt.Sprintf("%s/%s/%s/%s", basePath, patronsKey, meKey, pinKey),
+		Summary:     "Set the PIN",
+		Description: "Set the PIN which the authenticated patron logs in at kiosks with, which also unlocks it after too many wrong PINs",
+		Tags:        []string{patronsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requirePermission(api, auth.WritePatronPermission)},
+		Security: []map[string][]string{
+			{bearerSecKey: {}},
+		},
+	}, app.setPINHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "delete-pin",
+		Method:      http.MethodDelete,
+		Path:        fmt.Sprintf("%s/%s/%s/%s", basePath, patronsKey, meKey, pinKey),
+		Summary:     "Delete the PIN",
+		Description: "Delete the PIN of the authenticated patron, so that they can't log in at kiosks",
+		Tags:        []string{patronsKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requirePermission(api, auth.WritePatronPermission)},
+		Security: []map[string][]string{
+			{bearerSecKey: {}},
+		},
+	}, app.deletePINHandler)
+}
+
+// registerKiosks registers the endpoints for managing kiosks, and the endpoints of self-checkout kiosks.
+func (app *Application) registerKiosks(api huma.API) {
+	huma.Register(api, huma.Operation{
+		OperationID: "create-kiosk",
+		Method:      http.MethodPost,
+		Path:        fmt.Sprintf("%s/%s", basePath, kiosksKey),
+		Summary:     "Create a Kiosk",
+		Description: "Register a self-checkout Kiosk of a branch. The API key of the Kiosk is only returned in the response",
+		Tags:        []string{kiosksKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.createKioskHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "get-kiosks",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s", basePath, kiosksKey),
+		Summary:     "Get Kiosks",
+		Description: "Get all self-checkout Kiosks",
+		Tags:        []string{kiosksKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.getKiosksHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "delete-kiosk",
+		Method:      http.MethodDelete,
+		Path:        fmt.Sprintf("%s/%s/{%s}", basePath, kiosksKey, idKey),
+		Summary:     "Delete a Kiosk",
+		Description: "Delete a Kiosk from a specific ID, which revokes its API key",
+		Tags:        []string{kiosksKey},
+		Middlewares: huma.Middlewares{app.authenticate(api), app.requireAdmin(api)},
+		Security: []map[string][]string{
+			{basicAuthKey: {}},
+		},
+	}, app.deleteKioskHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "lookup-kiosk-book",
+		Method:      http.MethodGet,
+		Path:        fmt.Sprintf("%s/%s/%s/{%s}", basePath, kioskKey, booksKey, barcodeKey),
+		Summary:     "Look up a Book at a Kiosk",
+		Description: "Find a Book by its ISBN barcode, with its available copies",
+		Tags:        []string{kiosksKey},
+		Middlewares: huma.Middlewares{app.authenticateKiosk(api), app.requireKioskPermission(api, auth.LookupBookPermission)},
+		Security: []map[string][]string{
+			{kioskSecKey: {}},
+		},
+	}, app.lookupKioskBookHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "kiosk-login",
+		Method:      http.MethodPost,
+		Path:        fmt.Sprintf("%s/%s/%s", basePath, kioskKey, loginKey),
+		Summary:     "Log a Patron in at a Kiosk",
+		Description: "Log a Patron in by the barcode of their library card and their PIN, returning a short-lived token which identifies the Patron in borrows and returns at the Kiosk",
+		Tags:        []string{kiosksKey},
+		Middlewares: huma.Middlewares{app.authenticateKiosk(api)},
+		Security: []map[string][]string{
+			{kioskSecKey: {}},
+		},
+	}, app.kioskLoginHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "kiosk-borrow-book",
+		Method:      http.MethodPost,
+		Path:        fmt.Sprintf("%s/%s/%s", basePath, kioskKey, borrowKey),
+		Summary:     "Borrow a Book at a Kiosk",
+		Description: "Borrow a Book by its ISBN barcode for the loan period of the category of the Patron. Sending a request with the same Idempotency-Key again returns its result without borrowing again",
+		Tags:        []string{kiosksKey},
+		Middlewares: huma.Middlewares{app.authenticateKiosk(api), app.requireKioskPermission(api, auth.BorrowBookPermission)},
+		Security: []map[string][]string{
+			{kioskSecKey: {}},
+		},
+	}, app.kioskBorrowHandler)
+
+	huma.Register(api, huma.Operation{
+		OperationID: "kiosk-return-book",
+		Method:      http.MethodPost,
+		Path:        fmt.Sprintf("%s/%s/%s", basePath, kioskKey, returnKey),
+		Summary:     "Return a Book at a Kiosk",
+		Description: "Return a Book by its ISBN barcode. Sending a request with the same Idempotency-Key again returns its result without returning again",
+		Tags:        []string{kiosksKey},
+		Middlewares: huma.Middlewares{app.authenticateKiosk(api), app.requireKioskPermission(api, auth.ReturnBookPermission)},
+		Security: []map[string][]string{
+			{kioskSecKey: {}},
+		},
+	}, app.kioskReturnHandler)
 }
@@ -0,0 +1,567 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/mzeevi/library/internal/data"
+	"github.com/mzeevi/library/internal/scim"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	errUnmappedGroupsMsg = "none of the groups of the user is mapped to a category, and there is no default category"
+	errSCIMEmailMsg      = "the userName or an email of the user must be an email address"
+	errSCIMNameMsg       = "the user must have a name or a display name"
+)
+
+// scimSystem is the system of the external IDs which identity providers give to the users they
+// provision, which are the externalId of the users.
+const scimSystem = "scim"
+
+// maxSCIMResults is the most users in a page of the SCIM users.
+const maxSCIMResults = 100
+
+type GetSCIMUsersInput struct {
+	Filter     string `query:"filter" doc:"Filter of the users, such as userName eq \"noa@example.com\" or externalId eq \"1001\""`
+	StartIndex int64  `query:"startIndex" default:"1" doc:"Position of the first user in the results, from 1, which is rounded down to the first user of a page of count users"`
+	Count      int64  `query:"count" default:"100" doc:"Number of users in the page, at most 100, or 0 for only the total"`
+}
+
+type GetSCIMUsersOutput struct {
+	ContentType string `header:"Content-Type"`
+	Body        scim.ListResponse
+}
+
+type GetSCIMUserInput struct {
+	ID data.PatronID `path:"id"`
+}
+
+type SCIMUserOutput struct {
+	ContentType string `header:"Content-Type"`
+	Body        scim.User
+}
+
+type CreateSCIMUserInput struct {
+	AcceptLanguage string `header:"Accept-Language" doc:"Locale of the activation email and later notifications"`
+	Body           scim.User
+}
+
+type CreateSCIMUserOutput struct {
+	ContentType string `header:"Content-Type"`
+	Location    string `header:"Location"`
+	Body        scim.User
+}
+
+type ReplaceSCIMUserInput struct {
+	ID   data.PatronID `path:"id"`
+	Body scim.User
+}
+
+type PatchSCIMUserInput struct {
+	ID   data.PatronID `path:"id"`
+	Body scim.PatchOp
+}
+
+type DeleteSCIMUserInput struct {
+	ID data.PatronID `path:"id"`
+}
+
+type DeleteSCIMUserOutput struct{}
+
+type GetServiceProviderConfigOutput struct {
+	ContentType string `header:"Content-Type"`
+	Body        scim.ServiceProviderConfig
+}
+
+// scimHandler wraps a handler of the SCIM endpoints, so that its errors are written as SCIM errors.
+func scimHandler[I, O any](handler func(context.Context, *I) (*O, error)) func(context.Context, *I) (*O, error) {
+	return func(ctx context.Context, input *I) (*O, error) {
+		output, err := handler(ctx, input)
+		if err != nil {
+			return nil, scimError(err)
+		}
+
+		return output, nil
+	}
+}
+
+// scimError maps an error of a handler to a SCIM error. Validation errors are bad requests, since
+// SCIM has no status for them.
+func scimError(err error) error {
+	var scimErr *scim.Error
+	if errors.As(err, &scimErr) {
+		return scimErr
+	}
+
+	status, detail := http.StatusInternalServerError, errInternalServerErrorMsg
+	var statusErr huma.StatusError
+	if errors.As(err, &statusErr) {
+		status, detail = statusErr.GetStatus(), statusErr.Error()
+	}
+
+	var model *huma.ErrorModel
+	if errors.As(err, &model) && len(model.Errors) > 0 {
+		details := make([]string, len(model.Errors))
+		for i, e := range model.Errors {
+			details[i] = e.Error()
+		}
+		detail = strings.Join(details, "; ")
+	}
+
+	if status == http.StatusUnprocessableEntity {
+		return scim.NewError(http.StatusBadRequest, scim.ErrorInvalidValue, detail)
+	}
+
+	return scim.NewError(status, "", detail)
+}
+
+// authenticateSCIM authenticates an identity provider by the SCIM token in the Authorization
+// header. The token is only accepted by the SCIM endpoints, and patron and admin credentials are
+// not.
+func (app *Application) authenticateSCIM(api huma.API) func(ctx huma.Context, next func(huma.Context)) {
+	return func(ctx huma.Context, next func(huma.Context)) {
+		ctx.SetHeader("Vary", headerAuthorizationKey)
+
+		token, found := strings.CutPrefix(ctx.Header(headerAuthorizationKey), bearerKey+" ")
+		if !found || subtle.ConstantTimeCompare([]byte(token), []byte(app.Config.SCIM.Token)) != 1 {
+			ctx.SetHeader(headerWWWAuthenticateKey, bearerKey)
+			writeSCIMError(ctx, scim.NewError(http.StatusUnauthorized, "", errInvalidTokenMsg))
+			return
+		}
+
+		next(ctx)
+	}
+}
+
+// writeSCIMError writes a SCIM error as the response of a request which is not handled, such as
+// one which is not authenticated.
+func writeSCIMError(ctx huma.Context, scimErr *scim.Error) {
+	ctx.SetHeader("Content-Type", scim.ContentType)
+	ctx.SetStatus(scimErr.GetStatus())
+	_ = json.NewEncoder(ctx.BodyWriter()).Encode(scimErr)
+}
+
+// scimPatronFilter returns the filter of the patrons which match a SCIM filter, by which identity
+// providers find a user by their userName, which is their email, or by their externalId.
+func scimPatronFilter(filter string) (data.PatronFilter, error) {
+	if filter == "" {
+		return data.PatronFilter{}, nil
+	}
+
+	f, err := scim.ParseFilter(filter)
+	if err != nil {
+		return data.PatronFilter{}, err
+	}
+
+	switch f.Attribute {
+	case "username", "emails.value":
+		return data.PatronFilter{Email: &f.Value}, nil
+	case "externalid":
+		return data.PatronFilter{ExternalID: &data.ExternalID{System: scimSystem, Value: f.Value}}, nil
+	default:
+		return data.PatronFilter{}, scim.NewError(http.StatusBadRequest, scim.ErrorInvalidFilter, "users can only be filtered by userName, emails.value or externalId")
+	}
+}
+
+// scimUser returns the SCIM user of a patron. The patron is active unless it is suspended.
+func scimUser(patron *data.Patron) scim.User {
+	lastModified := patron.CreatedAt
+	if patron.UpdatedAt.After(lastModified) {
+		lastModified = patron.UpdatedAt
+	}
+
+	return scim.User{
+		Schemas:     []string{scim.UserSchema},
+		ID:          patron.ID,
+		ExternalID:  patron.ExternalIDs[scimSystem],
+		UserName:    patron.Email,
+		Name:        scim.SplitName(patron.Name),
+		DisplayName: patron.Name,
+		Emails:      []scim.Email{{Value: patron.Email, Primary: true}},
+		Active:      ptr(!patron.Suspended),
+		Meta: &scim.Meta{
+			ResourceType: scim.UserResourceType,
+			Created:      patron.CreatedAt,
+			LastModified: lastModified,
+			Location:     fmt.Sprintf("%s/%s/%s/%s", basePath, scimKey, usersKey, patron.ID),
+		},
+	}
+}
+
+// scimEmail returns the email address of a SCIM user: their userName, or their primary email, or
+// else their first email, if it is an email address.
+func scimEmail(user *scim.User) string {
+	candidates := []string{user.UserName}
+	if i := slices.IndexFunc(user.Emails, func(email scim.Email) bool { return email.Primary }); i >= 0 {
+		candidates = append(candidates, user.Emails[i].Value)
+	}
+	if len(user.Emails) > 0 {
+		candidates = append(candidates, user.Emails[0].Value)
+	}
+
+	for _, candidate := range candidates {
+		if email := strings.TrimSpace(candidate); validateEmail(&email, "userName") == nil {
+			return email
+		}
+	}
+
+	return ""
+}
+
+// scimCategory returns the category of the first group of a SCIM user which is mapped to one, by
+// its name or its ID, or an empty string if none is.
+func (app *Application) scimCategory(groups []scim.Group) string {
+	for _, group := range groups {
+		for _, key := range []string{group.Display, group.Value} {
+			if category, ok := app.Config.SCIM.GroupCategories[key]; ok && key != "" {
+				return category
+			}
+		}
+	}
+
+	return ""
+}
+
+// applySCIMUser sets the fields of a patron from a SCIM user. The category of the patron is of the
+// first group of the user which is mapped to one, and is kept if none is, unless the patron is new
+// and is of the default category. A user which is not active suspends the patron.
+func (app *Application) applySCIMUser(ctx context.Context, user *scim.User, patron *data.Patron) error {
+	email := scimEmail(user)
+	if email == "" {
+		return scim.NewError(http.StatusBadRequest, scim.ErrorInvalidValue, errSCIMEmailMsg)
+	}
+
+	name := user.FullName()
+	if name == "" {
+		return scim.NewError(http.StatusBadRequest, scim.ErrorInvalidValue, errSCIMNameMsg)
+	}
+
+	ids := maps.Clone(patron.ExternalIDs)
+	if user.ExternalID == "" {
+		delete(ids, scimSystem)
+	} else {
+		value := user.ExternalID
+		if errs := validateExternalID(scimSystem, &value, "externalId", "externalId"); len(errs) > 0 {
+			return scim.NewError(http.StatusBadRequest, scim.ErrorInvalidValue, errs[0].Error())
+		}
+		if ids == nil {
+			ids = make(map[string]string)
+		}
+		ids[scimSystem] = value
+	}
+
+	category := app.scimCategory(user.Groups)
+	if category == "" && patron.ID == "" {
+		category = app.Config.SCIM.DefaultCategory
+	}
+	if category != "" {
+		if err := app.validateCategory(ctx, category, "groups"); err != nil {
+			return err
+		}
+		patron.Category = category
+	}
+	if patron.Category == "" {
+		return scim.NewError(http.StatusBadRequest, scim.ErrorInvalidValue, errUnmappedGroupsMsg)
+	}
+
+	if user.Password != "" {
+		if err := app.checkPassword(ctx, user.Password, "password"); err != nil {
+			return err
+		}
+		if err := patron.Password.Set(user.Password); err != nil {
+			return app.serverError(ctx, err)
+		}
+	}
+
+	patron.Name = name
+	patron.Email = email
+	patron.ExternalIDs = ids
+	if user.Active != nil {
+		patron.Suspended = !*user.Active
+	}
+
+	return nil
+}
+
+// checkSCIMExternalIDs checks the external IDs of a provisioned patron as checkPatronExternalIDs
+// does, returning a SCIM uniqueness error if another patron has one of them.
+func (app *Application) checkSCIMExternalIDs(ctx context.Context, patron *data.Patron) error {
+	err := app.checkPatronExternalIDs(ctx, patron.ExternalIDs, patron.ID)
+
+	var statusErr huma.StatusError
+	if errors.As(err, &statusErr) {
+		return scim.NewError(http.StatusConflict, scim.ErrorUniqueness, statusErr.Error())
+	}
+
+	return err
+}
+
+// getSCIMPatron returns the patron of a SCIM user by its ID, returning a SCIM error if there is
+// none.
+func (app *Application) getSCIMPatron(ctx context.Context, id data.PatronID) (*data.Patron, error) {
+	if !data.ValidID(id) {
+		return nil, scim.NewError(http.StatusNotFound, "", errNotFoundMsg)
+	}
+
+	patron, err := app.Models.Patrons.Get(ctx, data.PatronFilter{ID: &id})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return nil, scim.NewError(http.StatusNotFound, "", errNotFoundMsg)
+		default:
+			return nil, app.serverError(ctx, err)
+		}
+	}
+
+	return patron, nil
+}
+
+// getSCIMUsersHandler handles a request of an identity provider to list the users, which are the
+// patrons, such as to find a user by their userName before provisioning them.
+func (app *Application) getSCIMUsersHandler(ctx context.Context, input *GetSCIMUsersInput) (*GetSCIMUsersOutput, error) {
+	filter, err := scimPatronFilter(input.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	startIndex := max(input.StartIndex, 1)
+	count := min(max(input.Count, 0), maxSCIMResults)
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	resp := &GetSCIMUsersOutput{ContentType: scim.ContentType}
+
+	if count == 0 {
+		total, err := app.Models.Patrons.Count(ctx, filter)
+		if err != nil {
+			return nil, app.serverError(ctx, err)
+		}
+		resp.Body = scim.NewListResponse(nil, total, startIndex)
+		return resp, nil
+	}
+
+	// Patrons are paged by count, so the users are of the page which has the startIndex-th one, and
+	// the first of them is reported as the start index.
+	page := (startIndex-1)/count + 1
+	patrons, metadata, err := app.Models.Patrons.GetAll(ctx, filter, data.Paginator{Page: page, PageSize: count}, data.Sorter{Field: "id", SortSafelist: []string{"id"}})
+	if err != nil {
+		return nil, app.serverError(ctx, err)
+	}
+
+	users := make([]scim.User, len(patrons))
+	for i := range patrons {
+		users[i] = scimUser(&patrons[i])
+	}
+	resp.Body = scim.NewListResponse(users, metadata.TotalRecords, (page-1)*count+1)
+
+	return resp, nil
+}
+
+// getSCIMUserHandler handles a request of an identity provider to get a user.
+func (app *Application) getSCIMUserHandler(ctx context.Context, input *GetSCIMUserInput) (*SCIMUserOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	patron, err := app.getSCIMPatron(ctx, input.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &SCIMUserOutput{
+		ContentType: scim.ContentType,
+		Body:        scimUser(patron),
+	}
+
+	return resp, nil
+}
+
+// createSCIMUserHandler handles a request of an identity provider to provision a user as a new
+// patron. A patron whose password is set by the identity provider is activated, while any other
+// patron is sent an activation token, by which they set a password.
+func (app *Application) createSCIMUserHandler(ctx context.Context, input *CreateSCIMUserInput) (*CreateSCIMUserOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	patron := &data.Patron{
+		Locale:      app.mailer.Locale(input.AcceptLanguage),
+		Permissions: slices.Clone(patronPermissions),
+		Activated:   input.Body.Password != "",
+	}
+	if err := app.applySCIMUser(ctx, &input.Body, patron); err != nil {
+		return nil, err
+	}
+
+	var token *data.Token
+	err := app.Models.Transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := app.checkSCIMExternalIDs(ctx, patron); err != nil {
+			return err
+		}
+
+		id, err := app.Models.Patrons.Insert(ctx, patron)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrDuplicateEmail):
+				return scim.NewError(http.StatusConflict, scim.ErrorUniqueness, errEmailAlreadyExistsMsg)
+			default:
+				return err
+			}
+		}
+		patron.ID = id
+
+		if !patron.Activated && !patron.Suspended {
+			token, err = app.Models.Tokens.New(ctx, id, activationTokenTTL, data.ScopeActivation)
+			if err != nil {
+				return err
+			}
+		}
+
+		return app.recordEvent(ctx, data.EventPatronCreated, patronEvent{ID: id, Category: patron.Category})
+	})
+	if err != nil {
+		return nil, app.transactionError(ctx, err)
+	}
+
+	if token != nil {
+		app.sendActivationEmail(ctx, patron, token)
+	}
+
+	user := scimUser(patron)
+	resp := &CreateSCIMUserOutput{
+		ContentType: scim.ContentType,
+		Location:    user.Meta.Location,
+		Body:        user,
+	}
+
+	return resp, nil
+}
+
+// replaceSCIMUserHandler handles a request of an identity provider to replace a user.
+func (app *Application) replaceSCIMUserHandler(ctx context.Context, input *ReplaceSCIMUserInput) (*SCIMUserOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	patron, err := app.getSCIMPatron(ctx, input.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return app.updateSCIMUser(ctx, patron, &input.Body)
+}
+
+// patchSCIMUserHandler handles a request of an identity provider to patch a user, such as to
+// deactivate them when they leave.
+func (app *Application) patchSCIMUserHandler(ctx context.Context, input *PatchSCIMUserInput) (*SCIMUserOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	patron, err := app.getSCIMPatron(ctx, input.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	user := scimUser(patron)
+	if err = input.Body.Apply(&user); err != nil {
+		return nil, err
+	}
+
+	return app.updateSCIMUser(ctx, patron, &user)
+}
+
+// updateSCIMUser updates a patron from a SCIM user, which is the patron as replaced or patched by
+// the identity provider. A new password revokes the sessions of the patron.
+func (app *Application) updateSCIMUser(ctx context.Context, patron *data.Patron, user *scim.User) (*SCIMUserOutput, error) {
+	original := *patron
+
+	if err := app.applySCIMUser(ctx, user, patron); err != nil {
+		return nil, err
+	}
+	if user.Password != "" {
+		changedAt := time.Now()
+		patron.PasswordChangedAt = &changedAt
+	}
+
+	err := app.Models.Transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := app.checkSCIMExternalIDs(ctx, patron); err != nil {
+			return err
+		}
+
+		err := app.Models.Patrons.Patch(ctx, data.PatronFilter{ID: ptr(data.PatronID(patron.ID))}, &original, patron)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrDocumentNotFound):
+				return scim.NewError(http.StatusNotFound, "", errNotFoundMsg)
+			case errors.Is(err, data.ErrDuplicateEmail):
+				return scim.NewError(http.StatusConflict, scim.ErrorUniqueness, errEmailAlreadyExistsMsg)
+			default:
+				return err
+			}
+		}
+
+		if user.Password == "" {
+			return nil
+		}
+
+		err = app.Models.Tokens.DeleteAllForPatron(ctx, data.TokenFilter{PatronID: &patron.ID, Scope: ptr(data.ScopeAuthentication)})
+		if err != nil && !errors.Is(err, data.ErrDocumentNotFound) {
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, app.transactionError(ctx, err)
+	}
+
+	resp := &SCIMUserOutput{
+		ContentType: scim.ContentType,
+		Body:        scimUser(patron),
+	}
+
+	return resp, nil
+}
+
+// deleteSCIMUserHandler handles a request of an identity provider to delete a user, which deletes
+// the patron and their photo.
+func (app *Application) deleteSCIMUserHandler(ctx context.Context, input *DeleteSCIMUserInput) (*DeleteSCIMUserOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	patron, err := app.getSCIMPatron(ctx, input.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = app.Models.Patrons.Delete(ctx, data.PatronFilter{ID: &input.ID})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return nil, scim.NewError(http.StatusNotFound, "", errNotFoundMsg)
+		default:
+			return nil, app.serverError(ctx, err)
+		}
+	}
+
+	app.deletePatronPhoto(ctx, patron.Photo)
+
+	return &DeleteSCIMUserOutput{}, nil
+}
+
+// getServiceProviderConfigHandler handles a request of an identity provider for the SCIM features
+// which are supported.
+func (app *Application) getServiceProviderConfigHandler(ctx context.Context, input *struct{}) (*GetServiceProviderConfigOutput, error) {
+	resp := &GetServiceProviderConfigOutput{
+		ContentType: scim.ContentType,
+		Body:        scim.NewServiceProviderConfig(maxSCIMResults),
+	}
+
+	return resp, nil
+}
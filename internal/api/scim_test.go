@@ -0,0 +1,118 @@
+package api_test
+
+import (
+	"context"
+	"github.com/mzeevi/library/internal/api"
+	"github.com/mzeevi/library/internal/api/apitest"
+	"github.com/mzeevi/library/internal/data"
+	"github.com/mzeevi/library/internal/scim"
+	"net/http"
+	"testing"
+)
+
+func TestSCIMUsers(t *testing.T) {
+	a := apitest.New(t, func(app *api.Application) {
+		app.Config.SCIM.Token = "scim-token"
+		app.Config.SCIM.GroupCategories = map[string]string{"Teachers": data.TeacherCategory}
+		app.Config.SCIM.DefaultCategory = data.StudentCategory
+	})
+	token := "Authorization: Bearer scim-token"
+	contentType := "Content-Type: " + scim.ContentType
+
+	if rec := a.Do(http.MethodGet, "/scim/v2/Users", "Authorization: Bearer wrong-token"); rec.Code != http.StatusUnauthorized || rec.Header().Get("Content-Type") != scim.ContentType {
+		t.Errorf("GET /scim/v2/Users with a wrong token = %v %q; want %v %q", rec.Code, rec.Header().Get("Content-Type"), http.StatusUnauthorized, scim.ContentType)
+	}
+
+	body := []byte(`{
+		"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+		"externalId": "00u1a2b3",
+		"userName": "noa@example.com",
+		"name": {"givenName": "Noa", "familyName": "Levi"},
+		"active": true,
+		"password": "pa55word1234",
+		"groups": [{"value": "g1", "display": "Teachers"}],
+		"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User": {"department": "Science"}
+	}`)
+	rec := a.Do(http.MethodPost, "/scim/v2/Users", token, contentType, body)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST /scim/v2/Users status = %v; want %v (body: %s)", rec.Code, http.StatusCreated, rec.Body.String())
+	}
+	var user scim.User
+	a.Decode(rec, &user)
+	if rec.Header().Get("Location") != "/scim/v2/Users/"+user.ID || user.ExternalID != "00u1a2b3" || user.UserName != "noa@example.com" {
+		t.Errorf("created user = %+v (location %q)", user, rec.Header().Get("Location"))
+	}
+
+	patron, err := a.Models.Patrons.Get(context.Background(), data.PatronFilter{ID: apitest.Ptr(data.PatronID(user.ID))})
+	if err != nil {
+		t.Fatalf("failed to get the provisioned patron: %v", err)
+	}
+	if patron.Name != "Noa Levi" || patron.Category != data.TeacherCategory || !patron.Activated || patron.ExternalIDs["scim"] != "00u1a2b3" {
+		t.Errorf("provisioned patron = %+v", patron)
+	}
+
+	login := map[string]string{"email": "noa@example.com", "password": "pa55word1234"}
+	if rec := a.Do(http.MethodPost, "/token/authentication", login); rec.Code != http.StatusOK {
+		t.Fatalf("login of a provisioned patron status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	if rec := a.Do(http.MethodPost, "/scim/v2/Users", token, contentType, body); rec.Code != http.StatusConflict {
+		t.Errorf("POST of a provisioned user status = %v; want %v (body: %s)", rec.Code, http.StatusConflict, rec.Body.String())
+	}
+
+	rec = a.Do(http.MethodGet, `/scim/v2/Users?filter=userName+eq+%22NOA@example.com%22`, token)
+	var list scim.ListResponse
+	a.Decode(rec, &list)
+	if rec.Code != http.StatusOK || list.TotalResults != 1 || len(list.Resources) != 1 || list.Resources[0].ID != user.ID {
+		t.Errorf("GET /scim/v2/Users by userName = %v %+v; want the user", rec.Code, list)
+	}
+
+	if rec := a.Do(http.MethodGet, `/scim/v2/Users?filter=displayName+sw+%22Noa%22`, token); rec.Code != http.StatusBadRequest {
+		t.Errorf("GET /scim/v2/Users with an unsupported filter status = %v; want %v", rec.Code, http.StatusBadRequest)
+	}
+
+	// Deactivating the user suspends the patron, who can no longer log in.
+	deactivate := []byte(`{"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"], "Operations": [{"op": "Replace", "value": {"active": false}}]}`)
+	rec = a.Do(http.MethodPatch, "/scim/v2/Users/"+user.ID, token, contentType, deactivate)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PATCH /scim/v2/Users/%s status = %v; want %v (body: %s)", user.ID, rec.Code, http.StatusOK, rec.Body.String())
+	}
+	a.Decode(rec, &user)
+	if user.Active == nil || *user.Active {
+		t.Errorf("patched user active = %v; want false", user.Active)
+	}
+	if rec := a.Do(http.MethodPost, "/token/authentication", login); rec.Code != http.StatusForbidden {
+		t.Errorf("login of a suspended patron status = %v; want %v", rec.Code, http.StatusForbidden)
+	}
+
+	// Replacing the user without groups keeps the category of the patron.
+	replace := []byte(`{"userName": "noa.levi@example.com", "displayName": "Noa Bat Levi", "active": true}`)
+	if rec := a.Do(http.MethodPut, "/scim/v2/Users/"+user.ID, token, contentType, replace); rec.Code != http.StatusOK {
+		t.Fatalf("PUT /scim/v2/Users/%s status = %v; want %v (body: %s)", user.ID, rec.Code, http.StatusOK, rec.Body.String())
+	}
+	patron, err = a.Models.Patrons.Get(context.Background(), data.PatronFilter{ID: apitest.Ptr(data.PatronID(user.ID))})
+	if err != nil {
+		t.Fatalf("failed to get the replaced patron: %v", err)
+	}
+	if patron.Email != "noa.levi@example.com" || patron.Name != "Noa Bat Levi" || patron.Suspended || patron.Category != data.TeacherCategory || patron.ExternalIDs["scim"] != "" {
+		t.Errorf("replaced patron = %+v", patron)
+	}
+
+	if rec := a.Do(http.MethodDelete, "/scim/v2/Users/"+user.ID, token); rec.Code != http.StatusNoContent {
+		t.Errorf("DELETE /scim/v2/Users/%s status = %v; want %v", user.ID, rec.Code, http.StatusNoContent)
+	}
+	if rec := a.Do(http.MethodGet, "/scim/v2/Users/"+user.ID, token); rec.Code != http.StatusNotFound {
+		t.Errorf("GET of a deleted user status = %v; want %v", rec.Code, http.StatusNotFound)
+	}
+	if rec := a.Do(http.MethodGet, "/scim/v2/Users/not-an-id", token); rec.Code != http.StatusNotFound {
+		t.Errorf("GET of an invalid ID status = %v; want %v", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestSCIMUsersDisabled(t *testing.T) {
+	a := apitest.New(t)
+
+	if rec := a.Do(http.MethodGet, "/scim/v2/Users", "Authorization: Bearer "); rec.Code != http.StatusNotFound {
+		t.Errorf("GET /scim/v2/Users without a SCIM token status = %v; want %v", rec.Code, http.StatusNotFound)
+	}
+}
@@ -2,698 +2,472 @@ package api
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/mzeevi/library/internal/data"
+	"github.com/mzeevi/library/internal/isbn"
 	"github.com/mzeevi/library/internal/query"
+	"github.com/mzeevi/library/internal/timezone"
+	"log/slog"
+	"strings"
 	"time"
 )
 
 const (
-	errPositiveIntegerMsg       = "%s must be a positive integer"
-	errMinLengthMsg             = "%s must have a minimum length of 1"
-	errExactLengthMsg           = "%s must be exactly 13 characters long"
-	errPositiveIntegerOrZeroMsg = "%s must be a positive integer or zero"
-	errMinMaxGreaterMsg         = "%s cannot be greater than %s"
-	errMinMaxLaterMsg           = "%s cannot be later than %s"
-	errAtLeastOneItemMsg        = "%s must have at least one item"
-	errMustEqualOneOfMsg        = "%s must be equal to %s or %s"
+	errCannotCombineMsg = "%s cannot be combined with %s"
 )
 
 type SearchBookInput struct {
 	GetBooksInput
-	MinPages          *int       `json:"min_pages,omitempty"`
-	MaxPages          *int       `json:"max_pages,omitempty"`
-	MinEdition        *int       `json:"min_edition,omitempty"`
-	MaxEdition        *int       `json:"max_edition,omitempty"`
-	MinPublishedAt    *time.Time `json:"min_published_at,omitempty"`
-	MaxPublishedAt    *time.Time `json:"max_published_at,omitempty"`
-	Title             *string    `json:"title,omitempty"`
-	ISBN              *string    `json:"isbn,omitempty"`
-	Authors           []string   `json:"authors,omitempty"`
-	Publishers        []string   `json:"publishers,omitempty"`
-	Genres            []string   `json:"genres,omitempty"`
-	MinCopies         *int       `json:"min_copies,omitempty"`
-	MaxCopies         *int       `json:"max_copies,omitempty"`
-	MinBorrowedCopies *int       `json:"min_borrowed_copies,omitempty"`
-	MaxBorrowedCopies *int       `json:"max_borrowed_copies,omitempty"`
-}
-
-type SearchBooksOutput struct {
-	Body BooksInfo
+	ExportInput
+	MinPages          int        `query:"min_pages" minimum:"1"`
+	MaxPages          int        `query:"max_pages" minimum:"1"`
+	MinEdition        int        `query:"min_edition" minimum:"1"`
+	MaxEdition        int        `query:"max_edition" minimum:"1"`
+	MinPublishedAt    query.Time `query:"min_published_at"`
+	MaxPublishedAt    query.Time `query:"max_published_at"`
+	Title             string     `query:"title"`
+	Match             string     `query:"match" enum:"contains,exact,prefix" doc:"Whether the title contains, equals or begins with the title filter, regardless of case. The title filter is matched literally"`
+	Identifier        string     `query:"identifier" doc:"Identifier of the books, such as an ISBN, with or without hyphens"`
+	Language          string     `query:"language" doc:"ISO 639-1 code of the language of the books, such as en"`
+	BookFormat        string     `query:"book_format" enum:"hardcover,paperback,ebook,audiobook" doc:"Format of the books"`
+	CallNumber        string     `query:"call_number" doc:"Beginning of the call number of a copy of the books, such as 823 or QA76"`
+	ShelfLocation     string     `query:"shelf_location" doc:"Shelf location of a copy of the books"`
+	Authors           []string   `query:"authors" doc:"Authors of the books (comma separated)"`
+	Publishers        []string   `query:"publishers" doc:"Publishers of the books, by name or alias (comma separated)"`
+	Genres            []string   `query:"genres" doc:"Genres of the books (comma separated)"`
+	ExcludeAuthors    []string   `query:"exclude_authors" doc:"Authors of which the books may have none (comma separated)"`
+	ExcludeGenres     []string   `query:"exclude_genres" doc:"Genres of which the books may have none (comma separated)"`
+	MinCopies         int        `query:"min_copies" minimum:"1"`
+	MaxCopies         int        `query:"max_copies" minimum:"1"`
+	MinBorrowedCopies int        `query:"min_borrowed_copies" minimum:"0"`
+	MaxBorrowedCopies int        `query:"max_borrowed_copies" minimum:"1"`
+	Available         string     `query:"available" enum:"true,false" doc:"Only books with at least one copy which is not borrowed if true, or only books with no such copy if false"`
 }
 
 type SearchPatronsInput struct {
 	GetPatronsInput
-	Category *string `json:"category,omitempty"`
-	Name     *string `json:"name,omitempty"`
-	Email    *string `json:"email,omitempty"`
-}
-
-type SearchPatronsOutput struct {
-	Body PatronsInfo
+	ExportInput
+	Category string `query:"category"`
+	Name     string `query:"name"`
+	Match    string `query:"match" enum:"contains,exact,prefix" doc:"Whether the name contains, equals or begins with the name filter, regardless of case. The name filter is matched literally"`
+	Email    string `query:"email" format:"email"`
 }
 
 type SearchTransactionsInput struct {
 	GetTransactionsInput
-	PatronID      *string    `json:"patron_id,omitempty"`
-	BookID        *string    `json:"book_id,omitempty"`
-	Status        *string    `json:"status,omitempty"`
-	MinBorrowedAt *time.Time `json:"min_borrowed_at,omitempty"`
-	MaxBorrowedAt *time.Time `json:"max_borrowed_at,omitempty"`
-	MinDueDate    *time.Time `json:"min_due_date,omitempty"`
-	MaxDueDate    *time.Time `json:"max_due_date,omitempty"`
-	MinReturnedAt *time.Time `json:"min_returned_at,omitempty"`
-	MaxReturnedAt *time.Time `json:"max_returned_at,omitempty"`
-	MinCreatedAt  *time.Time `json:"min_created_at,omitempty"`
-	MaxCreatedAt  *time.Time `json:"max_created_at,omitempty"`
+	ExportInput
+	PatronID      data.PatronID `query:"patron_id"`
+	BookID        data.BookID   `query:"book_id"`
+	Status        string        `query:"status" enum:"borrowed,returned"`
+	NotStatus     []string      `query:"not_status" enum:"borrowed,returned,canceled" doc:"Statuses which the transactions may not have (comma separated)"`
+	MinBorrowedAt query.Time    `query:"min_borrowed_at"`
+	MaxBorrowedAt query.Time    `query:"max_borrowed_at"`
+	MinDueDate    query.Time    `query:"min_due_date"`
+	MaxDueDate    query.Time    `query:"max_due_date"`
+	MinReturnedAt query.Time    `query:"min_returned_at"`
+	MaxReturnedAt query.Time    `query:"max_returned_at"`
+	MinCreatedAt  query.Time    `query:"min_created_at"`
+	MaxCreatedAt  query.Time    `query:"max_created_at"`
+	Overdue       string        `query:"overdue" enum:"true,false" doc:"Only borrowed transactions which are past their due date if true, or only the other transactions if false. Cannot be combined with status"`
 }
 
-type SearchTransactionsOutput struct {
-	Body TransactionsInfo
+type GlobalSearchInput struct {
+	Q     string `query:"q" required:"true" minLength:"1" maxLength:"200" doc:"Text which titles, authors, names and emails contain, regardless of case, or an ISBN or transaction ID"`
+	Limit int    `query:"limit" minimum:"1" maximum:"20" default:"5" doc:"Maximum number of results of each kind"`
 }
 
-// Resolve validates the input in SearchPatronsInput.
-func (s *SearchPatronsInput) Resolve(ctx huma.Context) []error {
-	var errs []error
-
-	if name, err := query.ResolveString(ctx, query.NameKey); err != nil {
-		errs = append(errs, err)
-	} else {
-		s.Name = name
-	}
-
-	if s.Name != nil {
-		if len(*s.Name) < 1 {
-			errs = append(errs, &huma.ErrorDetail{
-				Location: fmt.Sprintf("%s.%s", query.Key, query.NameKey),
-				Message:  fmt.Sprintf(errMinLengthMsg, query.NameKey),
-				Value:    *s.Name,
-			})
-		}
-	}
-
-	if email, err := query.ResolveString(ctx, query.EmailKey); err != nil {
-		errs = append(errs, err)
-	} else {
-		s.Email = email
-	}
+type GlobalSearchOutput struct {
+	Body GlobalSearchInfo
+}
 
-	if s.Email != nil {
-		errs = append(errs, validateEmail(s.Email, "body.email"))
-	}
+// GlobalSearchInfo is the results of a global search, grouped by their kind.
+type GlobalSearchInfo struct {
+	Books        []data.Book        `json:"books"`
+	Patrons      []data.Patron      `json:"patrons"`
+	Transactions []data.Transaction `json:"transactions"`
+}
 
-	if category, err := query.ResolveString(ctx, query.CategoryKey); err != nil {
-		errs = append(errs, err)
-	} else {
-		s.Category = category
+// Resolve validates the input in GlobalSearchInput.
+func (s *GlobalSearchInput) Resolve(ctx huma.Context) []error {
+	s.Q = strings.TrimSpace(s.Q)
+	if s.Q == "" {
+		return []error{&huma.ErrorDetail{
+			Location: fmt.Sprintf("%s.%s", query.Key, query.QKey),
+			Message:  "Query must not be empty",
+			Value:    s.Q,
+		}}
 	}
 
-	if s.Category != nil {
-		if *s.Category != studentCategory && *s.Category != teacherCategory {
-			errs = append(errs, &huma.ErrorDetail{
-				Location: fmt.Sprintf("%s.%s", query.Key, query.CategoryKey),
-				Message:  fmt.Sprintf(errMustEqualOneOfMsg, query.CategoryKey, studentCategory, teacherCategory),
-				Value:    *s.Category,
-			})
-		}
-	}
+	return nil
+}
 
-	return errs
+// Resolve validates the input in SearchPatronsInput.
+func (s *SearchPatronsInput) Resolve(ctx huma.Context) []error {
+	return query.Normalize(s)
 }
 
 // Resolve validates the input in SearchTransactionsInput.
 func (s *SearchTransactionsInput) Resolve(ctx huma.Context) []error {
-	var errs []error
+	return s.resolve(timezone.FromContext(ctx.Context()))
+}
 
-	if patronID, err := query.ResolveString(ctx, query.PatronIDKey); err != nil {
-		errs = append(errs, err)
-	} else {
-		s.PatronID = patronID
-	}
-	if s.PatronID != nil && len(*s.PatronID) < 1 {
-		errs = append(errs, &huma.ErrorDetail{
-			Location: fmt.Sprintf("%s.%s", query.Key, query.PatronIDKey),
-			Message:  fmt.Sprintf(errMinLengthMsg, query.PatronIDKey),
-			Value:    *s.PatronID,
-		})
+// resolve validates the input in SearchTransactionsInput, with dates in loc.
+func (s *SearchTransactionsInput) resolve(loc *time.Location) []error {
+	errs := query.Normalize(s)
+
+	for _, err := range []error{
+		validateRange(s.MinBorrowedAt.In(loc), s.MaxBorrowedAt.In(loc), query.MinBorrowedAtKey, query.MaxBorrowedAtKey),
+		validateRange(s.MinDueDate.In(loc), s.MaxDueDate.In(loc), query.MinDueDateKey, query.MaxDueDateKey),
+		validateRange(s.MinReturnedAt.In(loc), s.MaxReturnedAt.In(loc), query.MinReturnedAtKey, query.MaxReturnedAtKey),
+		validateRange(s.MinCreatedAt.In(loc), s.MaxCreatedAt.In(loc), query.MinCreatedAtKey, query.MaxCreatedAtKey),
+		validateID(optional(s.PatronID), fmt.Sprintf("%s.%s", query.Key, query.PatronIDKey)),
+		validateID(optional(s.BookID), fmt.Sprintf("%s.%s", query.Key, query.BookIDKey)),
+	} {
+		if err != nil {
+			errs = append(errs, err)
+		}
 	}
 
-	if bookID, err := query.ResolveString(ctx, query.BookIDKey); err != nil {
-		errs = append(errs, err)
-	} else {
-		s.BookID = bookID
-	}
-	if s.BookID != nil && len(*s.BookID) < 1 {
+	if s.Overdue != "" && s.Status != "" {
 		errs = append(errs, &huma.ErrorDetail{
-			Location: fmt.Sprintf("%s.%s", query.Key, query.BookIDKey),
-			Message:  fmt.Sprintf(errMinLengthMsg, query.BookIDKey),
-			Value:    *s.BookID,
+			Location: fmt.Sprintf("%s.%s, %s.%s", query.Key, query.OverdueKey, query.Key, query.StatusKey),
+			Message:  fmt.Sprintf(errCannotCombineMsg, query.OverdueKey, query.StatusKey),
+			Value:    s.Status,
 		})
 	}
 
-	if status, err := query.ResolveString(ctx, query.StatusKey); err != nil {
-		errs = append(errs, err)
-	} else {
-		s.Status = status
-	}
-	if s.Status != nil {
-		if *s.Status != string(data.TransactionStatusReturned) && *s.Status != string(data.TransactionStatusBorrowed) {
-			errs = append(errs, &huma.ErrorDetail{
-				Location: fmt.Sprintf("%s.%s", query.Key, query.StatusKey),
-				Message:  fmt.Sprintf(errMustEqualOneOfMsg, query.StatusKey, data.TransactionStatusReturned, data.TransactionStatusBorrowed),
-				Value:    *s.Status,
-			})
-		}
-	}
-
-	if minBorrowedAt, err := query.ResolveTime(ctx, query.MinBorrowedAtKey); err != nil {
-		errs = append(errs, err)
-	} else {
-		s.MinBorrowedAt = minBorrowedAt
-	}
-
-	if maxBorrowedAt, err := query.ResolveTime(ctx, query.MaxBorrowedAtKey); err != nil {
-		errs = append(errs, err)
-	} else {
-		s.MaxBorrowedAt = maxBorrowedAt
-	}
-	if s.MinBorrowedAt != nil && s.MaxBorrowedAt != nil {
-		if s.MinBorrowedAt.After(*s.MaxBorrowedAt) {
-			errs = append(errs, &huma.ErrorDetail{
-				Location: fmt.Sprintf("%s.%s, %s.%s", query.Key, query.MinBorrowedAtKey, query.Key, query.MaxBorrowedAtKey),
-				Message:  fmt.Sprintf(errMinMaxLaterMsg, query.MinBorrowedAtKey, query.MaxBorrowedAtKey),
-				Value:    s.MinBorrowedAt,
-			})
-		}
-	}
-
-	if minDueDate, err := query.ResolveTime(ctx, query.MinDueDateKey); err != nil {
-		errs = append(errs, err)
-	} else {
-		s.MinDueDate = minDueDate
-	}
-
-	if maxDueDate, err := query.ResolveTime(ctx, query.MaxDueDateKey); err != nil {
-		errs = append(errs, err)
-	} else {
-		s.MaxDueDate = maxDueDate
-	}
-	if s.MinDueDate != nil && s.MaxDueDate != nil {
-		if s.MinDueDate.After(*s.MaxDueDate) {
-			errs = append(errs, &huma.ErrorDetail{
-				Location: fmt.Sprintf("%s.%s, %s.%s", query.Key, query.MinDueDateKey, query.Key, query.MaxDueDateKey),
-				Message:  fmt.Sprintf(errMinMaxLaterMsg, query.MinDueDateKey, query.MaxDueDateKey),
-				Value:    s.MinDueDate,
-			})
-		}
-	}
-
-	if minReturnedAt, err := query.ResolveTime(ctx, query.MinReturnedAtKey); err != nil {
-		errs = append(errs, err)
-	} else {
-		s.MinReturnedAt = minReturnedAt
-	}
-
-	if maxReturnedAt, err := query.ResolveTime(ctx, query.MaxReturnedAtKey); err != nil {
-		errs = append(errs, err)
-	} else {
-		s.MaxReturnedAt = maxReturnedAt
-	}
-
-	if minCreatedAt, err := query.ResolveTime(ctx, query.MinCreatedAtKey); err != nil {
-		errs = append(errs, err)
-	} else {
-		s.MinCreatedAt = minCreatedAt
-	}
-
-	if maxCreatedAt, err := query.ResolveTime(ctx, query.MaxCreatedAtKey); err != nil {
-		errs = append(errs, err)
-	} else {
-		s.MaxCreatedAt = maxCreatedAt
-	}
-	if s.MinCreatedAt != nil && s.MaxCreatedAt != nil {
-		if s.MinCreatedAt.After(*s.MaxCreatedAt) {
-			errs = append(errs, &huma.ErrorDetail{
-				Location: fmt.Sprintf("%s.%s, %s.%s", query.Key, query.MinCreatedAtKey, query.Key, query.MaxCreatedAtKey),
-				Message:  fmt.Sprintf(errMinMaxLaterMsg, query.MinCreatedAtKey, query.MaxCreatedAtKey),
-				Value:    s.MinCreatedAt,
-			})
-		}
-	}
-
 	return errs
 }
 
-// Resolve validates the input in SearchBookInput.
+// Resolve validates the input in SearchBookInput, and normalizes its identifier, language and
+// call number like those of books are stored.
 func (s *SearchBookInput) Resolve(ctx huma.Context) []error {
-	var errs []error
-
-	if minPages, err := query.ResolveInt(ctx, query.MinPagesKey); err != nil {
-		errs = append(errs, err)
-	} else {
-		s.MinPages = minPages
-	}
-
-	if maxPages, err := query.ResolveInt(ctx, query.MaxPagesKey); err != nil {
-		errs = append(errs, err)
-	} else {
-		s.MaxPages = maxPages
-	}
-
-	if s.MinPages != nil {
-		if *s.MinPages <= 0 {
-			errs = append(errs, &huma.ErrorDetail{
-				Location: fmt.Sprintf("%s.%s", query.Key, query.MinPagesKey),
-				Message:  fmt.Sprintf(errPositiveIntegerMsg, query.MinPagesKey),
-				Value:    *s.MinPages,
-			})
-		}
-	}
+	return s.resolve(timezone.FromContext(ctx.Context()))
+}
 
-	if s.MaxPages != nil {
-		if *s.MaxPages <= 0 {
-			errs = append(errs, &huma.ErrorDetail{
-				Location: fmt.Sprintf("%s.%s", query.Key, query.MaxPagesKey),
-				Message:  fmt.Sprintf(errPositiveIntegerMsg, query.MaxPagesKey),
-				Value:    *s.MaxPages,
-			})
-		}
-	}
-	if s.MinPages != nil && s.MaxPages != nil {
-		if *s.MinPages > *s.MaxPages {
-			errs = append(errs, &huma.ErrorDetail{
-				Location: fmt.Sprintf("%s.%s, %s.%s", query.Key, query.MinPagesKey, query.Key, query.MaxPagesKey),
-				Message:  fmt.Sprintf(errMinMaxGreaterMsg, query.MinPagesKey, query.MaxPagesKey),
-				Value:    *s.MinPages,
-			})
+// resolve validates and normalizes the input in SearchBookInput, with dates in loc.
+func (s *SearchBookInput) resolve(loc *time.Location) []error {
+	errs := query.Normalize(s)
+
+	for _, err := range []error{
+		validateRange(optional(s.MinPages), optional(s.MaxPages), query.MinPagesKey, query.MaxPagesKey),
+		validateRange(optional(s.MinEdition), optional(s.MaxEdition), query.MinEditionKey, query.MaxEditionKey),
+		validateRange(optional(s.MinCopies), optional(s.MaxCopies), query.MinCopiesKey, query.MaxCopiesKey),
+		validateRange(optional(s.MinBorrowedCopies), optional(s.MaxBorrowedCopies), query.MinBorrowedCopiesKey, query.MaxBorrowedCopiesKey),
+		validateRange(s.MinPublishedAt.In(loc), s.MaxPublishedAt.In(loc), query.MinPublishedAtKey, query.MaxPublishedAtKey),
+	} {
+		if err != nil {
+			errs = append(errs, err)
 		}
 	}
 
-	if minEdition, err := query.ResolveInt(ctx, query.MinEditionKey); err != nil {
-		errs = append(errs, err)
-	} else {
-		s.MinEdition = minEdition
+	// ISBNs are stored without hyphens and spaces.
+	if code, err := isbn.Normalize(s.Identifier); err == nil {
+		s.Identifier = code
 	}
 
-	if maxEdition, err := query.ResolveInt(ctx, query.MaxEditionKey); err != nil {
-		errs = append(errs, err)
-	} else {
-		s.MaxEdition = maxEdition
-	}
-
-	if s.MinEdition != nil {
-		if *s.MinEdition <= 0 {
-			errs = append(errs, &huma.ErrorDetail{
-				Location: fmt.Sprintf("%s.%s", query.Key, query.MinEditionKey),
-				Message:  fmt.Sprintf(errPositiveIntegerMsg, query.MinEditionKey),
-				Value:    *s.MinEdition,
-			})
+	if s.Language != "" {
+		if err := validateLanguage(&s.Language, fmt.Sprintf("%s.%s", query.Key, query.LanguageKey)); err != nil {
+			errs = append(errs, err)
 		}
 	}
 
-	if s.MaxEdition != nil {
-		if *s.MaxEdition <= 0 {
-			errs = append(errs, &huma.ErrorDetail{
-				Location: fmt.Sprintf("%s.%s", query.Key, query.MaxEditionKey),
-				Message:  fmt.Sprintf(errPositiveIntegerMsg, query.MaxEditionKey),
-				Value:    *s.MaxEdition,
-			})
-		}
-	}
-	if s.MinEdition != nil && s.MaxEdition != nil {
-		if *s.MinEdition > *s.MaxEdition {
-			errs = append(errs, &huma.ErrorDetail{
-				Location: fmt.Sprintf("%s.%s, %s.%s", query.Key, query.MinEditionKey, query.Key, query.MaxEditionKey),
-				Message:  fmt.Sprintf(errMinMaxGreaterMsg, query.MinEditionKey, query.MaxEditionKey),
-				Value:    *s.MinEdition,
-			})
-		}
-	}
+	s.CallNumber = strings.Join(strings.Fields(strings.ToUpper(s.CallNumber)), " ")
 
-	if minCopies, err := query.ResolveInt(ctx, query.MinCopiesKey); err != nil {
-		errs = append(errs, err)
-	} else {
-		s.MinCopies = minCopies
-	}
+	return errs
+}
 
-	if maxCopies, err := query.ResolveInt(ctx, query.MaxCopiesKey); err != nil {
-		errs = append(errs, err)
-	} else {
-		s.MaxCopies = maxCopies
+// searchBookHandler handles the search for books based on the provided input filters and pagination.
+func (app *Application) searchBookHandler(ctx context.Context, input *SearchBookInput) (*ExportOutput, error) {
+	paginator := data.Paginator{Page: input.Page, PageSize: input.PageSize}
+	format, export := input.exportFormat()
+	if export {
+		paginator = data.Paginator{Page: 1, PageSize: maxExportRecords}
+	}
+
+	loc := timezone.FromContext(ctx)
+	filter := data.BookFilter{
+		IDs:               typedIDs[data.BookID](input.IDs),
+		MinPages:          optional(input.MinPages),
+		MaxPages:          optional(input.MaxPages),
+		MinEdition:        optional(input.MinEdition),
+		MaxEdition:        optional(input.MaxEdition),
+		MinCopies:         optional(input.MinCopies),
+		MaxCopies:         optional(input.MaxCopies),
+		MinBorrowedCopies: optional(input.MinBorrowedCopies),
+		MaxBorrowedCopies: optional(input.MaxBorrowedCopies),
+		Available:         optionalBool(input.Available),
+		Title:             optional(input.Title),
+		TitleMatch:        data.Match(input.Match),
+		Identifier:        optional(input.Identifier),
+		Language:          optional(input.Language),
+		Format:            optional(input.BookFormat),
+		CallNumber:        optional(input.CallNumber),
+		ShelfLocation:     optional(input.ShelfLocation),
+		Authors:           input.Authors,
+		Genres:            input.Genres,
+		ExcludeAuthors:    input.ExcludeAuthors,
+		ExcludeGenres:     input.ExcludeGenres,
+		MinPublishedAt:    input.MinPublishedAt.In(loc),
+		MaxPublishedAt:    input.MaxPublishedAt.In(loc),
 	}
 
-	if s.MinCopies != nil {
-		if *s.MinCopies <= 0 {
-			errs = append(errs, &huma.ErrorDetail{
-				Location: fmt.Sprintf("%s.%s", query.Key, query.MinCopiesKey),
-				Message:  fmt.Sprintf(errPositiveIntegerMsg, query.MinCopiesKey),
-				Value:    *s.MinCopies,
-			})
-		}
-	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
 
-	if s.MaxCopies != nil {
-		if *s.MaxCopies <= 0 {
-			errs = append(errs, &huma.ErrorDetail{
-				Location: fmt.Sprintf("%s.%s", query.Key, query.MaxCopiesKey),
-				Message:  fmt.Sprintf(errPositiveIntegerMsg, query.MaxCopiesKey),
-				Value:    *s.MaxCopies,
-			})
-		}
-	}
-	if s.MinCopies != nil && s.MaxCopies != nil {
-		if *s.MinCopies > *s.MaxCopies {
-			errs = append(errs, &huma.ErrorDetail{
-				Location: fmt.Sprintf("%s.%s, %s.%s", query.Key, query.MinCopiesKey, query.Key, query.MaxCopiesKey),
-				Message:  fmt.Sprintf(errMinMaxGreaterMsg, query.MinCopiesKey, query.MaxCopiesKey),
-				Value:    *s.MinCopies,
-			})
+	if input.Publishers != nil {
+		publishers, err := app.publisherNames(ctx, input.Publishers)
+		if err != nil {
+			return &ExportOutput{}, app.serverError(ctx, err)
 		}
+		filter.Publishers = publishers
 	}
 
-	if minBorrowedCopies, err := query.ResolveInt(ctx, query.MinBorrowedCopiesKey); err != nil {
-		errs = append(errs, err)
-	} else {
-		s.MinBorrowedCopies = minBorrowedCopies
-	}
-
-	if maxBorrowedCopies, err := query.ResolveInt(ctx, query.MaxBorrowedCopiesKey); err != nil {
-		errs = append(errs, err)
-	} else {
-		s.MaxBorrowedCopies = maxBorrowedCopies
+	books, metadata, err := app.searchBooks(ctx, filter, paginator, input.Sort)
+	if err != nil {
+		return &ExportOutput{}, app.serverError(ctx, err)
 	}
 
-	if s.MinBorrowedCopies != nil {
-		if *s.MinBorrowedCopies < 0 {
-			errs = append(errs, &huma.ErrorDetail{
-				Location: fmt.Sprintf("%s.%s", query.Key, query.MinBorrowedCopiesKey),
-				Message:  fmt.Sprintf(errPositiveIntegerOrZeroMsg, query.MinBorrowedCopiesKey),
-				Value:    *s.MinBorrowedCopies,
-			})
-		}
+	if export {
+		return app.exportResults(ctx, booksKey, format, bookRecords(books))
 	}
 
-	if s.MaxBorrowedCopies != nil {
-		if *s.MaxBorrowedCopies <= 0 {
-			errs = append(errs, &huma.ErrorDetail{
-				Location: fmt.Sprintf("%s.%s", query.Key, query.MaxBorrowedCopiesKey),
-				Message:  fmt.Sprintf(errPositiveIntegerMsg, query.MaxBorrowedCopiesKey),
-				Value:    *s.MaxBorrowedCopies,
-			})
-		}
-	}
-	if s.MinBorrowedCopies != nil && s.MaxBorrowedCopies != nil {
-		if *s.MinBorrowedCopies > *s.MaxBorrowedCopies {
-			errs = append(errs, &huma.ErrorDetail{
-				Location: fmt.Sprintf("%s.%s, %s.%s", query.Key, query.MinBorrowedCopiesKey, query.Key, query.MaxBorrowedCopiesKey),
-				Message:  fmt.Sprintf(errMinMaxGreaterMsg, query.MinBorrowedCopiesKey, query.MaxBorrowedCopiesKey),
-				Value:    *s.MinBorrowedCopies,
-			})
-		}
+	resp := &ExportOutput{
+		Body: BooksInfo{
+			Books:    books,
+			Metadata: metadata,
+		},
 	}
 
-	if title, err := query.ResolveString(ctx, query.TitleKey); err != nil {
-		errs = append(errs, err)
-	} else {
-		s.Title = title
-	}
+	return resp, nil
+}
 
-	if s.Title != nil {
-		if len(*s.Title) < 1 {
-			errs = append(errs, &huma.ErrorDetail{
-				Location: fmt.Sprintf("%s.%s", query.Key, query.TitleKey),
-				Message:  fmt.Sprintf(errMinLengthMsg, query.TitleKey),
-				Value:    *s.Title,
-			})
+// searchBooks searches books in the search index, or in the database if there is no search index
+// or it is unavailable. Books are ranked by relevance in the search index if sort is empty.
+func (app *Application) searchBooks(ctx context.Context, filter data.BookFilter, paginator data.Paginator, sort string) ([]data.Book, data.Metadata, error) {
+	if app.search != nil {
+		books, total, err := app.search.SearchBooks(ctx, filter, paginator, sort)
+		if err == nil {
+			return books, data.NewMetadata(total, paginator), nil
 		}
-	}
 
-	if isbn, err := query.ResolveString(ctx, query.ISBNKey); err != nil {
-		errs = append(errs, err)
-	} else {
-		s.ISBN = isbn
+		// The database can answer every search the index can, without ranking or typo tolerance.
+		app.requestLogger(ctx).Warn("failed to search books in the search index, searching the database", slog.Any("error", err))
 	}
 
-	if s.ISBN != nil {
-		if len(*s.ISBN) != 13 {
-			errs = append(errs, &huma.ErrorDetail{
-				Location: fmt.Sprintf("%s.%s", query.Key, query.ISBNKey),
-				Message:  fmt.Sprintf(errExactLengthMsg, query.ISBNKey),
-				Value:    *s.ISBN,
-			})
-		}
-	}
+	return app.Models.Books.GetAll(ctx, filter, paginator, data.Sorter{Field: sort, SortSafelist: supportedBooksSortFields, Collation: app.collation})
+}
 
-	if authors, err := query.ResolveStringSlice(ctx, query.AuthorsKey); err != nil {
-		errs = append(errs, err)
-	} else {
-		s.Authors = authors
+// searchPatronsHandler handles the search for patrons based on the provided input filters and pagination.
+func (app *Application) searchPatronsHandler(ctx context.Context, input *SearchPatronsInput) (*ExportOutput, error) {
+	paginator := data.Paginator{Page: input.Page, PageSize: input.PageSize}
+	format, export := input.exportFormat()
+	if export {
+		paginator = data.Paginator{Page: 1, PageSize: maxExportRecords}
 	}
-
-	if s.Authors != nil {
-		if len(s.Authors) < 1 {
-			errs = append(errs, &huma.ErrorDetail{
-				Location: fmt.Sprintf("%s.%s", query.Key, query.AuthorsKey),
-				Message:  fmt.Sprintf(errAtLeastOneItemMsg, query.AuthorsKey),
-				Value:    s.Authors,
-			})
-		}
+	filter := data.PatronFilter{
+		IDs:       typedIDs[data.PatronID](input.IDs),
+		Name:      optional(input.Name),
+		NameMatch: data.Match(input.Match),
+		Email:     optional(input.Email),
 	}
 
-	if publishers, err := query.ResolveStringSlice(ctx, query.PublishersKey); err != nil {
-		errs = append(errs, err)
-	} else {
-		s.Publishers = publishers
-	}
+	sorter := data.Sorter{Field: input.Sort, SortSafelist: supportedPatronsSortFields, Collation: app.collation}
 
-	if s.Publishers != nil {
-		if len(s.Publishers) < 1 {
-			errs = append(errs, &huma.ErrorDetail{
-				Location: fmt.Sprintf("%s.%s", query.Key, query.PublishersKey),
-				Message:  fmt.Sprintf(errAtLeastOneItemMsg, query.PublishersKey),
-				Value:    s.Publishers,
-			})
-		}
+	if err := app.checkEncryptedPatronsQuery(input.Sort, input.Name, input.Match); err != nil {
+		return &ExportOutput{}, err
 	}
 
-	if genres, err := query.ResolveStringSlice(ctx, query.PublishersKey); err != nil {
-		errs = append(errs, err)
-	} else {
-		s.Genres = genres
-	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
 
-	if s.Genres != nil {
-		if len(s.Genres) < 1 {
-			errs = append(errs, &huma.ErrorDetail{
-				Location: fmt.Sprintf("%s.%s", query.Key, query.GenresKey),
-				Message:  fmt.Sprintf(errAtLeastOneItemMsg, query.GenresKey),
-				Value:    s.Genres,
-			})
+	if input.Category != "" {
+		if err := app.validateCategory(ctx, input.Category, fmt.Sprintf("%s.%s", query.Key, query.CategoryKey)); err != nil {
+			return &ExportOutput{}, err
 		}
+		filter.Category = &input.Category
 	}
 
-	if minPublishedAt, err := query.ResolveTime(ctx, query.MinPublishedAtKey); err != nil {
-		errs = append(errs, err)
-	} else {
-		s.MinPublishedAt = minPublishedAt
+	patrons, metadata, err := app.Models.Patrons.GetAll(ctx, filter, paginator, sorter)
+	if err != nil {
+		return &ExportOutput{}, app.serverError(ctx, err)
 	}
-	if maxPublishedAt, err := query.ResolveTime(ctx, query.MaxPublishedAtKey); err != nil {
-		errs = append(errs, err)
-	} else {
-		s.MaxPublishedAt = maxPublishedAt
+
+	if export {
+		return app.exportResults(ctx, patronsKey, format, patronRecords(patrons))
 	}
 
-	if s.MinPublishedAt != nil && s.MaxPublishedAt != nil {
-		if s.MinPublishedAt.After(*s.MaxPublishedAt) {
-			errs = append(errs, &huma.ErrorDetail{
-				Location: fmt.Sprintf("%s.%s %s.%s", query.Key, query.MinPublishedAtKey, query.Key, query.MaxPublishedAtKey),
-				Message:  fmt.Sprintf(errMinMaxLaterMsg, query.MinPublishedAtKey, query.MaxPublishedAtKey),
-				Value:    s.MinPublishedAt.Format(time.RFC3339),
-			})
-		}
+	resp := &ExportOutput{
+		Body: PatronsInfo{
+			Patrons:  patrons,
+			Metadata: metadata,
+		},
 	}
 
-	return errs
+	return resp, nil
 }
 
-// searchBookHandler handles the search for books based on the provided input filters and pagination.
-func (app *Application) searchBookHandler(ctx context.Context, input *SearchBookInput) (*SearchBooksOutput, error) {
+// searchTransactionsHandler handles the search for transactions based on the provided input filters and pagination.
+func (app *Application) searchTransactionsHandler(ctx context.Context, input *SearchTransactionsInput) (*ExportOutput, error) {
 	paginator := data.Paginator{Page: input.Page, PageSize: input.PageSize}
-	filter := data.BookFilter{}
-
-	if input.MinPages != nil {
-		filter.MinPages = input.MinPages
-	}
-	if input.MaxPages != nil {
-		filter.MaxPages = input.MaxPages
-	}
-	if input.MinEdition != nil {
-		filter.MinEdition = input.MinEdition
-	}
-	if input.MaxEdition != nil {
-		filter.MaxEdition = input.MaxEdition
-	}
-	if input.MinCopies != nil {
-		filter.MinCopies = input.MinCopies
-	}
-	if input.MaxCopies != nil {
-		filter.MaxCopies = input.MaxCopies
-	}
-	if input.MinBorrowedCopies != nil {
-		filter.MinBorrowedCopies = input.MinBorrowedCopies
-	}
-	if input.MaxBorrowedCopies != nil {
-		filter.MaxBorrowedCopies = input.MaxBorrowedCopies
-	}
-	if input.Title != nil {
-		filter.Title = input.Title
-	}
-	if input.ISBN != nil {
-		filter.ISBN = input.ISBN
-	}
-
-	if input.Authors != nil {
-		filter.Authors = input.Authors
-	}
-	if input.Publishers != nil {
-		filter.Publishers = input.Publishers
-	}
-	if input.Genres != nil {
-		filter.Genres = input.Genres
-	}
-
-	if input.MinPublishedAt != nil {
-		filter.MinPublishedAt = input.MinPublishedAt
-	}
-	if input.MaxPublishedAt != nil {
-		filter.MaxPublishedAt = input.MaxPublishedAt
-	}
-
-	sorter := data.Sorter{Field: input.Sort, SortSafelist: supportedBooksSortFields}
+	format, export := input.exportFormat()
+	if export {
+		paginator = data.Paginator{Page: 1, PageSize: maxExportRecords}
+	}
+
+	loc := timezone.FromContext(ctx)
+	filter := data.TransactionFilter{
+		IDs:           typedIDs[data.TransactionID](input.IDs),
+		PatronID:      optional(input.PatronID),
+		BookID:        optional(input.BookID),
+		Status:        optional(input.Status),
+		NotStatus:     input.NotStatus,
+		Overdue:       optionalBool(input.Overdue),
+		MinBorrowedAt: input.MinBorrowedAt.In(loc),
+		MaxBorrowedAt: input.MaxBorrowedAt.In(loc),
+		MinDueDate:    input.MinDueDate.In(loc),
+		MaxDueDate:    input.MaxDueDate.In(loc),
+		MinReturnedAt: input.MinReturnedAt.In(loc),
+		MaxReturnedAt: input.MaxReturnedAt.In(loc),
+		MinCreatedAt:  input.MinCreatedAt.In(loc),
+		MaxCreatedAt:  input.MaxCreatedAt.In(loc),
+	}
+
+	sorter := data.Sorter{Field: input.Sort, SortSafelist: supportedTransactionsSortFields, Collation: app.collation}
 
 	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
 	defer cancel()
 
-	books, metadata, err := app.Models.Books.GetAll(ctx, filter, paginator, sorter)
+	transactions, metadata, err := app.Models.Transactions.GetAll(ctx, filter, paginator, sorter)
 	if err != nil {
-		return &SearchBooksOutput{}, err
+		return &ExportOutput{}, app.serverError(ctx, err)
 	}
 
-	resp := &SearchBooksOutput{
-		Body: BooksInfo{
-			Books:    books,
-			Metadata: metadata,
+	if export {
+		return app.exportResults(ctx, transactionsKey, format, transactionRecords(transactions, app.location))
+	}
+
+	resp := &ExportOutput{
+		Body: TransactionsInfo{
+			Transactions: transactions,
+			Metadata:     metadata,
 		},
 	}
 
 	return resp, nil
 }
 
-// searchPatronsHandler handles the search for patrons based on the provided input filters and pagination.
-func (app *Application) searchPatronsHandler(ctx context.Context, input *SearchPatronsInput) (*SearchPatronsOutput, error) {
-	paginator := data.Paginator{Page: input.Page, PageSize: input.PageSize}
-	filter := data.PatronFilter{}
+// globalSearchHandler searches books by title, author and ISBN, patrons by name and email, and
+// transactions by ID at once, such as for a command palette. Books are searched in the database,
+// since the search index ranks rather than matches titles.
+func (app *Application) globalSearchHandler(ctx context.Context, input *GlobalSearchInput) (*GlobalSearchOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
 
-	if input.Name != nil {
-		filter.Name = input.Name
-	}
+	paginator := data.Paginator{Page: 1, PageSize: int64(input.Limit)}
 
-	if input.Email != nil {
-		filter.Email = input.Email
+	// ISBNs are stored without hyphens and spaces.
+	keyword := input.Q
+	if code, err := isbn.Normalize(keyword); err == nil {
+		keyword = code
 	}
 
-	if input.Category != nil {
-		filter.Category = input.Category
+	books, _, err := app.Models.Books.GetAll(ctx, data.BookFilter{Keyword: &keyword}, paginator, data.Sorter{Field: "title", SortSafelist: supportedBooksSortFields, Collation: app.collation})
+	if err != nil {
+		return &GlobalSearchOutput{}, app.serverError(ctx, err)
 	}
 
-	sorter := data.Sorter{Field: input.Sort, SortSafelist: supportedPatronsSortFields}
-
-	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
-	defer cancel()
-
-	patrons, metadata, err := app.Models.Patrons.GetAll(ctx, filter, paginator, sorter)
+	patrons, _, err := app.Models.Patrons.GetAll(ctx, data.PatronFilter{Keyword: &input.Q}, paginator, data.Sorter{Field: "name", SortSafelist: supportedPatronsSortFields, Collation: app.collation})
 	if err != nil {
-		return &SearchPatronsOutput{}, err
+		return &GlobalSearchOutput{}, app.serverError(ctx, err)
 	}
 
-	resp := &SearchPatronsOutput{
-		Body: PatronsInfo{
-			Patrons:  patrons,
-			Metadata: metadata,
+	transactions := make([]data.Transaction, 0)
+	if id := data.TransactionID(input.Q); data.ValidID(id) {
+		transaction, err := app.Models.Transactions.Get(ctx, data.TransactionFilter{ID: &id})
+		switch {
+		case err == nil:
+			transactions = append(transactions, *transaction)
+		case !errors.Is(err, data.ErrDocumentNotFound):
+			return &GlobalSearchOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	resp := &GlobalSearchOutput{
+		Body: GlobalSearchInfo{
+			Books:        books,
+			Patrons:      patrons,
+			Transactions: transactions,
 		},
 	}
 
 	return resp, nil
 }
 
-// searchTransactionsHandler handles the search for transactions based on the provided input filters and pagination.
-func (app *Application) searchTransactionsHandler(ctx context.Context, input *SearchTransactionsInput) (*SearchTransactionsOutput, error) {
-	paginator := data.Paginator{Page: input.Page, PageSize: input.PageSize}
-	filter := data.TransactionFilter{}
-
-	if input.PatronID != nil {
-		filter.PatronID = input.PatronID
-	}
-	if input.BookID != nil {
-		filter.BookID = input.BookID
-	}
-
-	if input.Status != nil {
-		filter.Status = input.Status
-	}
-
-	if input.MinBorrowedAt != nil {
-		filter.MinBorrowedAt = input.MinBorrowedAt
-	}
-	if input.MaxBorrowedAt != nil {
-		filter.MaxBorrowedAt = input.MaxBorrowedAt
+// indexBook mirrors the book of an event into the search index. The book is read from the
+// database rather than the event, so that events which are delivered late or more than once
+// do not overwrite it with an older version.
+func (app *Application) indexBook(ctx context.Context, event data.Event) error {
+	var bookID string
+	switch event.Type {
+	case data.EventBookBorrowed, data.EventBookReturned:
+		var payload transactionEvent
+		if err := json.Unmarshal(event.Payload, &payload); err != nil {
+			return fmt.Errorf("failed to decode %s event: %v", event.Type, err)
+		}
+		bookID = payload.Transaction.BookID
+	default:
+		var payload bookEvent
+		if err := json.Unmarshal(event.Payload, &payload); err != nil {
+			return fmt.Errorf("failed to decode %s event: %v", event.Type, err)
+		}
+		bookID = payload.ID
 	}
 
-	if input.MinDueDate != nil {
-		filter.MinDueDate = input.MinDueDate
-	}
-	if input.MaxDueDate != nil {
-		filter.MaxDueDate = input.MaxDueDate
-	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
 
-	if input.MinReturnedAt != nil {
-		filter.MinReturnedAt = input.MinReturnedAt
-	}
-	if input.MaxReturnedAt != nil {
-		filter.MaxReturnedAt = input.MaxReturnedAt
+	book, err := app.Models.Books.Get(ctx, data.BookFilter{ID: ptr(data.BookID(bookID))})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return app.search.DeleteBook(ctx, bookID)
+		default:
+			return err
+		}
 	}
 
-	if input.MinCreatedAt != nil {
-		filter.MinCreatedAt = input.MinCreatedAt
-	}
-	if input.MaxCreatedAt != nil {
-		filter.MaxCreatedAt = input.MaxCreatedAt
-	}
+	return app.search.IndexBook(ctx, *book)
+}
 
-	if input.MinReturnedAt != nil {
-		filter.MinReturnedAt = input.MinReturnedAt
-	}
-	if input.MaxReturnedAt != nil {
-		filter.MaxReturnedAt = input.MaxReturnedAt
+// ReindexSearch indexes all the books in the database, for books which were stored before
+// the search index was enabled or without recording events, such as seeded books.
+func (app *Application) ReindexSearch(ctx context.Context) (int, error) {
+	if app.search == nil {
+		return 0, errors.New("no search index is configured")
 	}
 
-	sorter := data.Sorter{Field: input.Sort, SortSafelist: supportedTransactionsSortFields}
+	const pageSize = 500
 
-	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
-	defer cancel()
+	indexed := 0
+	for page := int64(1); ; page++ {
+		books, _, err := app.Models.Books.GetAll(ctx, data.BookFilter{}, data.Paginator{Page: page, PageSize: pageSize}, data.Sorter{})
+		if err != nil {
+			return indexed, err
+		}
 
-	transactions, metadata, err := app.Models.Transactions.GetAll(ctx, filter, paginator, sorter)
-	if err != nil {
-		return &SearchTransactionsOutput{}, err
-	}
+		for _, book := range books {
+			if err = app.search.IndexBook(ctx, book); err != nil {
+				return indexed, fmt.Errorf("failed to index book %s: %v", book.ID, err)
+			}
+			indexed++
+		}
 
-	resp := &SearchTransactionsOutput{
-		Body: TransactionsInfo{
-			Transactions: transactions,
-			Metadata:     metadata,
-		},
+		if len(books) < pageSize {
+			return indexed, nil
+		}
 	}
-
-	return resp, nil
 }
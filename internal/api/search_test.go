@@ -0,0 +1,765 @@
+package api_test
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/mzeevi/library/internal/api"
+	"github.com/mzeevi/library/internal/api/apitest"
+	"github.com/mzeevi/library/internal/auth"
+	"github.com/mzeevi/library/internal/data"
+	"github.com/mzeevi/library/internal/query"
+	"github.com/xuri/excelize/v2"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fuzzSearch fuzzes a search endpoint with a value for one of keys and a second, raw query
+// string, asserting that malformed input never results in a server error.
+func fuzzSearch(f *testing.F, path string, keys []string, seeds []string) {
+	for i, seed := range seeds {
+		f.Add(uint8(i), seed, "")
+	}
+	f.Add(uint8(0), "1", "page=1000&pageSize=1000")
+	f.Add(uint8(0), "1", "sort=unknown")
+
+	a := apitest.New(f)
+	a.SeedBook(apitest.Book("9780306406157", 2))
+	patronID := a.SeedPatron(apitest.Patron("patron@example.com",
+		auth.ReadBooksPermission, auth.ReadPatronsPermission, auth.ReadTransactionsPermission))
+	header := a.PatronAuth(patronID)
+
+	f.Fuzz(func(t *testing.T, key uint8, value, raw string) {
+		values, err := url.ParseQuery(raw)
+		if err != nil {
+			values = url.Values{}
+		}
+		values.Set(keys[int(key)%len(keys)], value)
+
+		target := path + "?" + values.Encode()
+		if rec := a.WithTB(t).Do(http.MethodGet, target, header); rec.Code >= http.StatusInternalServerError {
+			t.Fatalf("GET %s status = %v; want < 500 (body: %s)", target, rec.Code, rec.Body.String())
+		}
+	})
+}
+
+func FuzzSearchBooks(f *testing.F) {
+	keys := []string{
+		query.MinPagesKey, query.MaxPagesKey, query.MinEditionKey, query.MaxEditionKey,
+		query.MinCopiesKey, query.MaxCopiesKey, query.MinBorrowedCopiesKey, query.MaxBorrowedCopiesKey,
+		query.MinPublishedAtKey, query.MaxPublishedAtKey, query.TitleKey, query.IdentifierKey,
+		query.AuthorsKey, query.PublishersKey, query.GenresKey, query.AvailableKey,
+		query.LanguageKey, query.BookFormatKey, query.ExcludeAuthorsKey, query.ExcludeGenresKey,
+		query.MatchKey,
+	}
+	seeds := []string{"99999999999999999999", "-1", "0x1", "1e9", "2", "3", "-0", "9223372036854775807",
+		"2024-01-02T03:04:05Z", "2024-13-01", "(", "978030640615", ",,,", " a , b ", "a,,b", "true"}
+
+	fuzzSearch(f, "/search/books", keys, seeds)
+}
+
+func FuzzSearchPatrons(f *testing.F) {
+	keys := []string{query.NameKey, query.EmailKey, query.CategoryKey, query.MatchKey}
+	seeds := []string{"[a-", "(a+)+$", "prefix", "patron@example.com", "unknown"}
+
+	fuzzSearch(f, "/search/patrons", keys, seeds)
+}
+
+func FuzzSearchTransactions(f *testing.F) {
+	keys := []string{
+		query.PatronIDKey, query.BookIDKey, query.StatusKey, query.NotStatusKey,
+		query.MinBorrowedAtKey, query.MaxBorrowedAtKey, query.MinDueDateKey, query.MaxDueDateKey,
+		query.MinReturnedAtKey, query.MaxReturnedAtKey, query.MinCreatedAtKey, query.MaxCreatedAtKey, query.OverdueKey,
+	}
+	seeds := []string{"not-an-id", "000000000000000000000000", "lost", "2024-01-02T03:04:05Z", "2024-01-02T03:04:05+25:00",
+		"0000-01-01T00:00:00Z", "9999-12-31T23:59:59Z", "yesterday", "2024-02-30T00:00:00Z", "", "-7d", "1"}
+
+	fuzzSearch(f, "/search/transactions", keys, seeds)
+}
+
+func TestSearchPatronsByEmail(t *testing.T) {
+	a := apitest.New(t)
+	patronID := a.SeedPatron(apitest.Patron("patron@example.com", auth.ReadPatronsPermission))
+
+	if rec := a.Do(http.MethodGet, "/search/patrons?email=patron@example.com", a.PatronAuth(patronID)); rec.Code != http.StatusOK {
+		t.Errorf("GET /search/patrons with a valid email status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	if rec := a.Do(http.MethodGet, "/search/patrons?email=invalid", a.PatronAuth(patronID)); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("GET /search/patrons with an invalid email status = %v; want %v", rec.Code, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestSearchEncryptedPatrons(t *testing.T) {
+	a := apitest.New(t, func(app *api.Application) {
+		app.Config.Encryption.Key = "a2V5LWtleS1rZXkta2V5LWtleS1rZXkta2V5LWtleS0="
+	})
+	patronID := a.SeedPatron(apitest.Patron("patron@example.com", auth.ReadPatronsPermission))
+
+	// Encrypted names are matched by their digests, which can't match partly or be sorted by.
+	tests := []struct {
+		path string
+		want int
+	}{
+		{path: "/search/patrons?name=Ann&match=exact", want: http.StatusOK},
+		{path: "/search/patrons?name=Ann", want: http.StatusUnprocessableEntity},
+		{path: "/search/patrons?name=Ann&match=prefix", want: http.StatusUnprocessableEntity},
+		{path: "/search/patrons?name=Ann&match=contains", want: http.StatusUnprocessableEntity},
+		{path: "/search/patrons?sort=category", want: http.StatusOK},
+		{path: "/search/patrons?sort=-name", want: http.StatusUnprocessableEntity},
+		{path: "/search/patrons?sort=email", want: http.StatusUnprocessableEntity},
+		{path: "/patrons?sort=name", want: http.StatusUnprocessableEntity},
+		{path: "/patrons?sort=-email", want: http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		if rec := a.Do(http.MethodGet, tt.path, a.PatronAuth(patronID)); rec.Code != tt.want {
+			t.Errorf("GET %s status = %v; want %v (body: %s)", tt.path, rec.Code, tt.want, rec.Body.String())
+		}
+	}
+}
+
+func TestSearchBooksByGenres(t *testing.T) {
+	a := apitest.New(t)
+	a.SeedBook(apitest.Book("9780306406157", 1))
+	patronID := a.SeedPatron(apitest.Patron("patron@example.com", auth.ReadBooksPermission))
+
+	var body struct {
+		Books []data.Book `json:"books"`
+	}
+
+	tests := []struct {
+		genres string
+		want   int
+	}{
+		{genres: "Fiction", want: 1},
+		{genres: "Horror, Fiction", want: 1},
+		{genres: "Horror", want: 0},
+	}
+
+	for _, tt := range tests {
+		rec := a.Do(http.MethodGet, "/search/books?"+url.Values{query.GenresKey: {tt.genres}}.Encode(), a.PatronAuth(patronID))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET /search/books?genres=%s status = %v; want %v (body: %s)", tt.genres, rec.Code, http.StatusOK, rec.Body.String())
+		}
+
+		a.Decode(rec, &body)
+		if len(body.Books) != tt.want {
+			t.Errorf("GET /search/books?genres=%s len = %v; want %v", tt.genres, len(body.Books), tt.want)
+		}
+	}
+
+	if rec := a.Do(http.MethodGet, "/search/books?genres=,,", a.PatronAuth(patronID)); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("GET /search/books?genres=,, status = %v; want %v", rec.Code, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestSearchExclusions(t *testing.T) {
+	a := apitest.New(t)
+
+	fiction := apitest.Book("9780306406157", 1)
+	romance := apitest.Book("9780140449136", 1)
+	romance.Genres, romance.Authors = []string{"Fiction", "Romance"}, []string{"Jane Austen"}
+	fictionID, romanceID := a.SeedBook(fiction), a.SeedBook(romance)
+
+	patronID := a.SeedPatron(apitest.Patron("patron@example.com", auth.ReadBooksPermission, auth.ReadTransactionsPermission))
+	for _, status := range []string{data.TransactionStatusBorrowed, data.TransactionStatusReturned, data.TransactionStatusCanceled} {
+		transaction := data.NewTransaction("", patronID, fictionID, status, time.Now(), time.Now().Add(7*24*time.Hour))
+		if _, err := a.Models.Transactions.Insert(context.Background(), transaction); err != nil {
+			t.Fatalf("Transactions.Insert() error = %v", err)
+		}
+	}
+
+	var books struct {
+		Books []data.Book `json:"books"`
+	}
+
+	bookTests := []struct {
+		query string
+		want  []string
+	}{
+		{query: "genres=Fiction&exclude_genres=Romance", want: []string{fictionID}},
+		{query: "exclude_genres=Horror,Romance", want: []string{fictionID}},
+		{query: "exclude_authors=Test Author", want: []string{romanceID}},
+		{query: "genres=Romance&exclude_authors=Jane Austen"},
+	}
+
+	for _, tt := range bookTests {
+		rec := a.Do(http.MethodGet, "/search/books?"+strings.ReplaceAll(tt.query, " ", "+"), a.PatronAuth(patronID))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET /search/books?%s status = %v; want %v (body: %s)", tt.query, rec.Code, http.StatusOK, rec.Body.String())
+		}
+
+		a.Decode(rec, &books)
+		var got []string
+		for _, book := range books.Books {
+			got = append(got, book.ID)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("GET /search/books?%s = %v; want %v", tt.query, got, tt.want)
+		}
+	}
+
+	var transactions struct {
+		Transactions []data.Transaction `json:"transactions"`
+	}
+
+	transactionTests := []struct {
+		query string
+		want  []string
+	}{
+		{query: "not_status=canceled", want: []string{data.TransactionStatusBorrowed, data.TransactionStatusReturned}},
+		{query: "not_status=borrowed,canceled", want: []string{data.TransactionStatusReturned}},
+		{query: "status=returned&not_status=returned"},
+	}
+
+	for _, tt := range transactionTests {
+		rec := a.Do(http.MethodGet, "/search/transactions?"+tt.query, a.PatronAuth(patronID))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET /search/transactions?%s status = %v; want %v (body: %s)", tt.query, rec.Code, http.StatusOK, rec.Body.String())
+		}
+
+		a.Decode(rec, &transactions)
+		var got []string
+		for _, transaction := range transactions.Transactions {
+			got = append(got, transaction.Status)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("GET /search/transactions?%s statuses = %v; want %v", tt.query, got, tt.want)
+		}
+	}
+
+	if rec := a.Do(http.MethodGet, "/search/transactions?not_status=lost", a.PatronAuth(patronID)); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("GET /search/transactions?not_status=lost status = %v; want %v", rec.Code, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestSearchMatch(t *testing.T) {
+	a := apitest.New(t)
+
+	dune := apitest.Book("9780306406157", 1)
+	dune.Title = "Dune (1965)"
+	messiah := apitest.Book("9780140449136", 1)
+	messiah.Title = "Dune Messiah"
+	duneID, messiahID := a.SeedBook(dune), a.SeedBook(messiah)
+
+	patronID := a.SeedPatron(apitest.Patron("patron@example.com", auth.ReadBooksPermission))
+
+	var body struct {
+		Books []data.Book `json:"books"`
+	}
+
+	tests := []struct {
+		query url.Values
+		want  []string
+	}{
+		{query: url.Values{query.TitleKey: {"(1965)"}}, want: []string{duneID}},
+		{query: url.Values{query.TitleKey: {"dune"}, query.MatchKey: {"prefix"}}, want: []string{duneID, messiahID}},
+		{query: url.Values{query.TitleKey: {"messiah"}, query.MatchKey: {"prefix"}}},
+		{query: url.Values{query.TitleKey: {"dune (1965)"}, query.MatchKey: {"exact"}}, want: []string{duneID}},
+		{query: url.Values{query.TitleKey: {"dune"}, query.MatchKey: {"exact"}}},
+		{query: url.Values{query.TitleKey: {".*"}, query.MatchKey: {"contains"}}},
+	}
+
+	for _, tt := range tests {
+		rec := a.Do(http.MethodGet, "/search/books?"+tt.query.Encode(), a.PatronAuth(patronID))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET /search/books?%s status = %v; want %v (body: %s)", tt.query.Encode(), rec.Code, http.StatusOK, rec.Body.String())
+		}
+
+		a.Decode(rec, &body)
+		var got []string
+		for _, book := range body.Books {
+			got = append(got, book.ID)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("GET /search/books?%s = %v; want %v", tt.query.Encode(), got, tt.want)
+		}
+	}
+
+	if rec := a.Do(http.MethodGet, "/search/books?title=dune&match=regex", a.PatronAuth(patronID)); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("GET /search/books?match=regex status = %v; want %v", rec.Code, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestSearchBooksByIdentifier(t *testing.T) {
+	a := apitest.New(t)
+
+	book := apitest.Book("9780306406157", 1)
+	book.Identifiers = append(book.Identifiers,
+		data.Identifier{Type: data.IdentifierISBN10, Value: "0306406152"},
+		data.Identifier{Type: data.IdentifierEISBN, Value: "9781861972712"},
+	)
+	id := a.SeedBook(book)
+	a.SeedBook(apitest.Book("9780140449136", 1))
+
+	patronID := a.SeedPatron(apitest.Patron("patron@example.com", auth.ReadBooksPermission))
+
+	var body struct {
+		Books []data.Book `json:"books"`
+	}
+
+	for _, identifier := range []string{"9780306406157", "0306406152", "0-306-40615-2", "9781861972712"} {
+		a.Decode(a.Do(http.MethodGet, "/search/books?identifier="+identifier, a.PatronAuth(patronID)), &body)
+		if len(body.Books) != 1 || body.Books[0].ID != id {
+			t.Errorf("GET /search/books?identifier=%s = %+v; want only the book with the identifier", identifier, body.Books)
+		}
+	}
+
+	a.Decode(a.Do(http.MethodGet, "/search/books?identifier=9780000000002", a.PatronAuth(patronID)), &body)
+	if len(body.Books) != 0 {
+		t.Errorf("GET /search/books with an unknown identifier = %+v; want no books", body.Books)
+	}
+}
+
+func TestSearchBooksByLanguageAndFormat(t *testing.T) {
+	a := apitest.New(t)
+
+	english := apitest.Book("9780306406157", 1)
+	english.Language, english.Format = "en", data.FormatPaperback
+	a.SeedBook(english)
+
+	hebrew := apitest.Book("9781861972712", 1)
+	hebrew.Language, hebrew.Format = "he", data.FormatEbook
+	a.SeedBook(hebrew)
+
+	patronID := a.SeedPatron(apitest.Patron("patron@example.com", auth.ReadBooksPermission))
+
+	var body struct {
+		Books []data.Book `json:"books"`
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{query: "language=en", want: []string{english.ISBN()}},
+		{query: "language=HE", want: []string{hebrew.ISBN()}},
+		{query: "book_format=ebook", want: []string{hebrew.ISBN()}},
+		{query: "language=en&book_format=ebook"},
+		{query: "language=fr"},
+	}
+
+	for _, tt := range tests {
+		rec := a.Do(http.MethodGet, "/search/books?"+tt.query, a.PatronAuth(patronID))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET /search/books?%s status = %v; want %v (body: %s)", tt.query, rec.Code, http.StatusOK, rec.Body.String())
+		}
+
+		a.Decode(rec, &body)
+		var got []string
+		for _, book := range body.Books {
+			got = append(got, book.ISBN())
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("GET /search/books?%s = %v; want %v", tt.query, got, tt.want)
+		}
+	}
+
+	for _, query := range []string{"language=english", "language=xx", "book_format=scroll"} {
+		if rec := a.Do(http.MethodGet, "/search/books?"+query, a.PatronAuth(patronID)); rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("GET /search/books?%s status = %v; want %v", query, rec.Code, http.StatusUnprocessableEntity)
+		}
+	}
+}
+
+func TestSearchBooksByAvailability(t *testing.T) {
+	a := apitest.New(t)
+
+	available := apitest.Book("9780306406157", 2)
+	available.BorrowedCopies = 1
+	a.SeedBook(available)
+
+	unavailable := apitest.Book("9781861972712", 1)
+	unavailable.BorrowedCopies = 1
+	a.SeedBook(unavailable)
+
+	patronID := a.SeedPatron(apitest.Patron("patron@example.com", auth.ReadBooksPermission))
+
+	var body struct {
+		Books []data.Book `json:"books"`
+	}
+
+	tests := []struct {
+		available string
+		want      string
+	}{
+		{available: "true", want: available.ISBN()},
+		{available: "false", want: unavailable.ISBN()},
+	}
+
+	for _, tt := range tests {
+		rec := a.Do(http.MethodGet, "/search/books?available="+tt.available, a.PatronAuth(patronID))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET /search/books?available=%s status = %v; want %v (body: %s)", tt.available, rec.Code, http.StatusOK, rec.Body.String())
+		}
+
+		a.Decode(rec, &body)
+		if len(body.Books) != 1 || body.Books[0].ISBN() != tt.want {
+			t.Errorf("GET /search/books?available=%s = %v; want only %s", tt.available, body.Books, tt.want)
+		}
+	}
+
+	if rec := a.Do(http.MethodGet, "/search/books?available=maybe", a.PatronAuth(patronID)); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("GET /search/books?available=maybe status = %v; want %v", rec.Code, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestSearchTransactionsByOverdue(t *testing.T) {
+	a := apitest.New(t)
+	patronID := a.SeedPatron(apitest.Patron("patron@example.com", auth.ReadTransactionsPermission))
+
+	now := time.Now()
+	overdue := data.NewTransaction("", patronID, "overdue", data.TransactionStatusBorrowed, now.Add(-20*24*time.Hour), now.Add(-6*24*time.Hour))
+	due := data.NewTransaction("", patronID, "due", data.TransactionStatusBorrowed, now.Add(-24*time.Hour), now.Add(13*24*time.Hour))
+	returned := data.NewTransaction("", patronID, "returned", data.TransactionStatusReturned, now.Add(-20*24*time.Hour), now.Add(-6*24*time.Hour))
+	for _, transaction := range []*data.Transaction{overdue, due, returned} {
+		if _, err := a.Models.Transactions.Insert(context.Background(), transaction); err != nil {
+			t.Fatalf("failed to seed transaction: %v", err)
+		}
+	}
+
+	var body struct {
+		Transactions []struct {
+			BookID string `json:"book_id"`
+		} `json:"transactions"`
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{query: "overdue=true", want: []string{"overdue"}},
+		{query: "overdue=false", want: []string{"due", "returned"}},
+	}
+
+	for _, tt := range tests {
+		rec := a.Do(http.MethodGet, "/search/transactions?"+tt.query, a.PatronAuth(patronID))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET /search/transactions?%s status = %v; want %v (body: %s)", tt.query, rec.Code, http.StatusOK, rec.Body.String())
+		}
+
+		a.Decode(rec, &body)
+		var got []string
+		for _, transaction := range body.Transactions {
+			got = append(got, transaction.BookID)
+		}
+		sort.Strings(got)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("GET /search/transactions?%s = %v; want %v", tt.query, got, tt.want)
+		}
+	}
+
+	if rec := a.Do(http.MethodGet, "/search/transactions?overdue=true&status=returned", a.PatronAuth(patronID)); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("GET /search/transactions?overdue=true&status=returned status = %v; want %v", rec.Code, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestSearchValidation(t *testing.T) {
+	a := apitest.New(t)
+	header := a.PatronAuth(a.SeedPatron(apitest.Patron("patron@example.com", auth.ReadBooksPermission, auth.ReadTransactionsPermission)))
+
+	// Each invalid parameter is reported at its own location, and no other.
+	tests := []struct {
+		path         string
+		wantLocation string
+	}{
+		{path: "/search/books?min_pages=0", wantLocation: "query.min_pages"},
+		{path: "/search/books?max_borrowed_copies=-1", wantLocation: "query.max_borrowed_copies"},
+		{path: "/search/books?min_edition=3&max_edition=2", wantLocation: "query.min_edition, query.max_edition"},
+		{path: "/search/books?publishers=,", wantLocation: "query.publishers"},
+		{path: "/search/books?genres=,", wantLocation: "query.genres"},
+		{path: "/search/books?authors=%20", wantLocation: "query.authors"},
+		{path: "/search/books?min_published_at=yesterday", wantLocation: "query.min_published_at"},
+		{path: "/search/books?title=%FF", wantLocation: "query.title"},
+		{path: "/search/transactions?status=lost", wantLocation: "query.status"},
+		{path: "/search/transactions?min_returned_at=-1d&max_returned_at=-2d", wantLocation: "query.min_returned_at, query.max_returned_at"},
+		{path: "/search/transactions?book_id=not-an-id", wantLocation: "query.book_id"},
+	}
+
+	for _, tt := range tests {
+		rec := a.Do(http.MethodGet, tt.path, header)
+		if rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("GET %s status = %v; want %v (body: %s)", tt.path, rec.Code, http.StatusUnprocessableEntity, rec.Body.String())
+			continue
+		}
+
+		var body struct {
+			Errors []struct {
+				Location string `json:"location"`
+			} `json:"errors"`
+		}
+		a.Decode(rec, &body)
+		if len(body.Errors) != 1 || body.Errors[0].Location != tt.wantLocation {
+			t.Errorf("GET %s errors = %+v; want one at %s", tt.path, body.Errors, tt.wantLocation)
+		}
+	}
+
+	for _, path := range []string{"/search/books?min_borrowed_copies=0&genres=Fiction,%20Horror&min_published_at=2024-01-02", "/search/transactions?min_borrowed_at=-7d&max_borrowed_at=%2B1d"} {
+		if rec := a.Do(http.MethodGet, path, header); rec.Code != http.StatusOK {
+			t.Errorf("GET %s status = %v; want %v (body: %s)", path, rec.Code, http.StatusOK, rec.Body.String())
+		}
+	}
+}
+
+// fakeOpenSearch is an OpenSearch index of books which matches every search.
+type fakeOpenSearch struct {
+	mu   sync.Mutex
+	docs map[string]map[string]any
+	down atomic.Bool
+}
+
+func (f *fakeOpenSearch) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if f.down.Load() {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := strings.TrimPrefix(r.URL.Path, "/books/_doc/")
+	switch {
+	case r.URL.Path == "/books":
+	case r.URL.Path == "/books/_search":
+		hits := make([]any, 0, len(f.docs))
+		for _, doc := range f.docs {
+			hits = append(hits, map[string]any{"_source": doc})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"hits": map[string]any{"total": map[string]any{"value": len(hits)}, "hits": hits}})
+	case r.Method == http.MethodPut:
+		doc := map[string]any{}
+		_ = json.NewDecoder(r.Body).Decode(&doc)
+		f.docs[id] = doc
+	case r.Method == http.MethodDelete:
+		delete(f.docs, id)
+	}
+}
+
+func TestSearchExport(t *testing.T) {
+	a := apitest.New(t)
+	patronID := a.SeedPatron(apitest.Patron("patron@example.com", auth.ReadBooksPermission, auth.ReadTransactionsPermission))
+
+	// More books than fit in the default page, all of which are exported.
+	for i := range 12 {
+		book := apitest.Book(fmt.Sprintf("97800000000%02d", i), 1)
+		if i%2 == 1 {
+			book.Genres = []string{"Horror"}
+		}
+		a.SeedBook(book)
+	}
+
+	now := time.Now()
+	overdue := data.NewTransaction("", patronID, "overdue", data.TransactionStatusBorrowed, now.Add(-20*24*time.Hour), now.Add(-6*24*time.Hour))
+	returned := data.NewTransaction("", patronID, "returned", data.TransactionStatusReturned, now.Add(-20*24*time.Hour), now.Add(-6*24*time.Hour))
+	for _, transaction := range []*data.Transaction{overdue, returned} {
+		if _, err := a.Models.Transactions.Insert(context.Background(), transaction); err != nil {
+			t.Fatalf("failed to seed transaction: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		path        string
+		accept      string
+		contentType string
+		want        int
+	}{
+		{name: "csv parameter", path: "/search/books?format=csv", contentType: "text/csv", want: 12},
+		{name: "csv accept", path: "/search/books?genres=Horror", accept: "text/csv", contentType: "text/csv", want: 6},
+		{name: "xlsx accept", path: "/search/books?genres=Fiction", accept: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", contentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", want: 6},
+		{name: "xlsx parameter", path: "/search/transactions?overdue=true&format=xlsx", contentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := []any{a.PatronAuth(patronID)}
+			if tt.accept != "" {
+				args = append(args, "Accept: "+tt.accept)
+			}
+
+			rec := a.Do(http.MethodGet, tt.path, args...)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("GET %s status = %v; want %v (body: %s)", tt.path, rec.Code, http.StatusOK, rec.Body.String())
+			}
+
+			if got := rec.Header().Get("Content-Type"); !strings.HasPrefix(got, tt.contentType) {
+				t.Errorf("GET %s Content-Type = %q; want %q", tt.path, got, tt.contentType)
+			}
+			if got := rec.Header().Get("Content-Disposition"); !strings.HasPrefix(got, "attachment") {
+				t.Errorf("GET %s Content-Disposition = %q; want an attachment", tt.path, got)
+			}
+
+			var records [][]string
+			var err error
+			if tt.contentType == "text/csv" {
+				records, err = csv.NewReader(rec.Body).ReadAll()
+			} else {
+				var f *excelize.File
+				if f, err = excelize.OpenReader(rec.Body); err == nil {
+					records, err = f.GetRows(f.GetSheetName(f.GetActiveSheetIndex()))
+				}
+			}
+			if err != nil {
+				t.Fatalf("failed to read export: %v", err)
+			}
+
+			// The first record is the header.
+			if got := len(records) - 1; got != tt.want {
+				t.Errorf("GET %s exported %d records; want %d", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchBooksIndex(t *testing.T) {
+	index := &fakeOpenSearch{docs: map[string]map[string]any{}}
+	srv := httptest.NewServer(index)
+	defer srv.Close()
+
+	a := apitest.New(t, func(app *api.Application) {
+		app.Config.Search.URL = srv.URL
+		app.Config.Search.Index = "books"
+	})
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+	patronID := a.SeedPatron(apitest.Patron("patron@example.com", auth.ReadBooksPermission, auth.BorrowBookPermission))
+	patron := a.PatronAuth(patronID)
+
+	// A seeded book is in the database, but is not indexed until it is reindexed.
+	a.SeedBook(apitest.Book("9780306406157", 1))
+
+	newBook := map[string]any{
+		"pages":        100,
+		"edition":      1,
+		"copies":       2,
+		"published_at": time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC),
+		"title":        "A New Book",
+		"identifiers":  []map[string]string{{"type": "isbn13", "value": "9781861972712"}},
+		"authors":      []string{"Author"},
+		"publishers":   []string{"Publisher"},
+		"genres":       []string{"Fiction"},
+	}
+	var book data.Book
+	a.Decode(a.Do(http.MethodPost, "/books", admin, newBook), &book)
+
+	borrow := map[string]any{"patron_id": patronID, "book_id": book.ID, "due_date": time.Now().Add(14 * 24 * time.Hour), "copies": 1}
+	if rec := a.Do(http.MethodPost, "/transactions/borrow", patron, borrow); rec.Code != http.StatusOK {
+		t.Fatalf("borrow status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	if _, err := a.App.DispatchEvents(context.Background()); err != nil {
+		t.Fatalf("DispatchEvents() error = %v", err)
+	}
+
+	var body struct {
+		Books    []data.Book   `json:"books"`
+		Metadata data.Metadata `json:"metadata"`
+	}
+	a.Decode(a.Do(http.MethodGet, "/search/books?title=new+bok", patron), &body)
+	if len(body.Books) != 1 || body.Books[0].ID != book.ID || body.Books[0].BorrowedCopies != 1 || body.Metadata.TotalRecords != 1 {
+		t.Errorf("GET /search/books from the index = %+v; want the created book with a borrowed copy", body)
+	}
+
+	if indexed, err := a.App.ReindexSearch(context.Background()); err != nil || indexed != 2 {
+		t.Errorf("ReindexSearch() = %d, %v; want 2, nil", indexed, err)
+	}
+	if len(index.docs) != 2 {
+		t.Errorf("indexed %d books after reindexing; want 2", len(index.docs))
+	}
+
+	if rec := a.Do(http.MethodDelete, "/books/"+book.ID, admin); rec.Code != http.StatusOK {
+		t.Fatalf("delete book status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if _, err := a.App.DispatchEvents(context.Background()); err != nil {
+		t.Fatalf("DispatchEvents() error = %v", err)
+	}
+	if _, ok := index.docs[book.ID]; ok {
+		t.Error("deleted book is still indexed")
+	}
+
+	// Searches fall back to the database while the index is unavailable.
+	index.down.Store(true)
+	a.Decode(a.Do(http.MethodGet, "/search/books?identifier=9780306406157", patron), &body)
+	if len(body.Books) != 1 || body.Books[0].ISBN() != "9780306406157" {
+		t.Errorf("GET /search/books with the index down = %+v; want the seeded book", body.Books)
+	}
+}
+
+func TestGlobalSearch(t *testing.T) {
+	a := apitest.New(t)
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+
+	earthsea := apitest.Book("9780306406157", 1)
+	earthsea.Title = "A Wizard of Earthsea"
+	earthsea.Authors = []string{"Ursula K. Le Guin"}
+	dune := apitest.Book("9780140449136", 1)
+	dune.Title = "Dune"
+	dune.Authors = []string{"Frank Herbert"}
+	earthseaID, duneID := a.SeedBook(earthsea), a.SeedBook(dune)
+
+	ursula := apitest.Patron("ursula@example.com")
+	ursula.Name = "Ursula Levi"
+	frank := apitest.Patron("frank@example.com")
+	frank.Name = "Frank Cohen"
+	ursulaID, frankID := a.SeedPatron(ursula), a.SeedPatron(frank)
+
+	transaction := data.NewTransaction("", frankID, duneID, data.TransactionStatusBorrowed, time.Now(), time.Now().Add(14*24*time.Hour))
+	transactionID, err := a.Models.Transactions.Insert(context.Background(), transaction)
+	if err != nil {
+		t.Fatalf("failed to seed transaction: %v", err)
+	}
+
+	tests := []struct {
+		q                              string
+		books, patrons, transactionIDs []string
+	}{
+		{q: "ursula", books: []string{earthseaID}, patrons: []string{ursulaID}},
+		{q: "EARTHSEA", books: []string{earthseaID}},
+		{q: "978-0-14-044913-6", books: []string{duneID}},
+		{q: "frank@", patrons: []string{frankID}},
+		{q: transactionID, transactionIDs: []string{transactionID}},
+		{q: "(.*)"},
+	}
+
+	for _, tt := range tests {
+		rec := a.Do(http.MethodGet, "/search?"+url.Values{query.QKey: {tt.q}}.Encode(), admin)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET /search?q=%s status = %v; want %v (body: %s)", tt.q, rec.Code, http.StatusOK, rec.Body.String())
+		}
+
+		var results api.GlobalSearchInfo
+		a.Decode(rec, &results)
+
+		var books, patrons, transactions []string
+		for _, book := range results.Books {
+			books = append(books, book.ID)
+		}
+		for _, patron := range results.Patrons {
+			patrons = append(patrons, patron.ID)
+		}
+		for _, transaction := range results.Transactions {
+			transactions = append(transactions, transaction.ID)
+		}
+		if !slices.Equal(books, tt.books) || !slices.Equal(patrons, tt.patrons) || !slices.Equal(transactions, tt.transactionIDs) {
+			t.Errorf("GET /search?q=%s = %v, %v, %v; want %v, %v, %v", tt.q, books, patrons, transactions, tt.books, tt.patrons, tt.transactionIDs)
+		}
+	}
+
+	if rec := a.Do(http.MethodGet, "/search?q=%20", admin); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("GET /search with a blank query status = %v; want %v", rec.Code, http.StatusUnprocessableEntity)
+	}
+	if rec := a.Do(http.MethodGet, "/search?q=ursula", a.PatronAuth(ursulaID)); rec.Code != http.StatusForbidden {
+		t.Errorf("GET /search as a patron status = %v; want %v", rec.Code, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,591 @@
+package api
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/mzeevi/library/internal/data"
+	"github.com/mzeevi/library/internal/mailer"
+	"github.com/mzeevi/library/internal/query"
+	"github.com/mzeevi/library/internal/timezone"
+	"log/slog"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	errSavedSearchNoRecipientsMsg = "a scheduled search must have recipients"
+)
+
+// savedSearchScheduleNone is the schedule of saved searches which are only run on demand.
+const savedSearchScheduleNone = "none"
+
+// savedSearchPollInterval is how often the scheduled searches which are due are run.
+const savedSearchPollInterval = time.Minute
+
+type CreateSavedSearchInput struct {
+	Body struct {
+		Name       string   `json:"name" minLength:"1" maxLength:"200"`
+		Target     string   `json:"target" enum:"books,patrons,transactions" doc:"The search which is run"`
+		Query      string   `json:"query" required:"false" maxLength:"2000" doc:"Query string of the search, such as status=borrowed&min_due_date=-7d. Its page, pageSize and format are set when it is run"`
+		Schedule   string   `json:"schedule,omitempty" required:"false" enum:"none,daily,weekly" default:"none" doc:"When the results of the search are emailed to its recipients, at the hour, and for weekly searches on the day, of the overdue report"`
+		Recipients []string `json:"recipients,omitempty" required:"false" doc:"Email addresses the results of a scheduled search are sent to"`
+	}
+}
+
+type CreateSavedSearchOutput struct {
+	Location string           `header:"Location"`
+	Body     data.SavedSearch `json:"saved_search"`
+}
+
+type GetSavedSearchInput struct {
+	ID string `json:"id" path:"id"`
+}
+
+type SavedSearchOutput struct {
+	Body data.SavedSearch `json:"saved_search"`
+}
+
+type GetSavedSearchesInput struct {
+	PaginationInput
+	Target string `query:"target" enum:"books,patrons,transactions" doc:"Filter by the search which is run"`
+	Sort   string `query:"sort" enum:"name,-name,created_at,-created_at" default:"name"`
+}
+
+type GetSavedSearchesOutput struct {
+	Body SavedSearchesInfo
+}
+
+type SavedSearchesInfo struct {
+	SavedSearches []data.SavedSearch `json:"saved_searches"`
+	Metadata      data.Metadata      `json:"metadata"`
+}
+
+type UpdateSavedSearchInput struct {
+	ID   string `json:"id" path:"id"`
+	Body struct {
+		Name       *string   `json:"name,omitempty" minLength:"1" maxLength:"200"`
+		Target     *string   `json:"target,omitempty" enum:"books,patrons,transactions"`
+		Query      *string   `json:"query,omitempty" maxLength:"2000"`
+		Schedule   *string   `json:"schedule,omitempty" enum:"none,daily,weekly"`
+		Recipients *[]string `json:"recipients,omitempty"`
+	}
+}
+
+type DeleteSavedSearchInput struct {
+	ID string `json:"id" path:"id"`
+}
+
+type DeleteSavedSearchOutput struct {
+	Body string `json:"message"`
+}
+
+type RunSavedSearchInput struct {
+	PaginationInput
+	ExportInput
+	ID string `json:"id" path:"id"`
+}
+
+// Resolve validates the input in CreateSavedSearchInput, and that its query is a valid search of its target.
+func (s *CreateSavedSearchInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	s.Body.Name = strings.TrimSpace(s.Body.Name)
+	if s.Body.Name == "" {
+		errs = append(errs, &huma.ErrorDetail{
+			Location: "body.name",
+			Message:  "Name must not be empty",
+			Value:    s.Body.Name,
+		})
+	}
+
+	s.Body.Query = strings.TrimPrefix(strings.TrimSpace(s.Body.Query), "?")
+	if _, queryErrs := decodeSavedSearch(s.Body.Target, s.Body.Query, timezone.FromContext(ctx.Context())); queryErrs != nil {
+		errs = append(errs, savedSearchQueryErrors(queryErrs)...)
+	}
+
+	errs = append(errs, validateRecipients(s.Body.Recipients)...)
+	if s.Body.Schedule != savedSearchScheduleNone && len(s.Body.Recipients) == 0 {
+		errs = append(errs, &huma.ErrorDetail{
+			Location: "body.recipients",
+			Message:  errSavedSearchNoRecipientsMsg,
+			Value:    s.Body.Recipients,
+		})
+	}
+
+	return errs
+}
+
+// Resolve validates the input in GetSavedSearchInput.
+func (s *GetSavedSearchInput) Resolve(ctx huma.Context) []error {
+	if err := validateID(&s.ID, "path.id"); err != nil {
+		return []error{err}
+	}
+
+	return nil
+}
+
+// Resolve validates the input in UpdateSavedSearchInput.
+func (s *UpdateSavedSearchInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	if err := validateID(&s.ID, "path.id"); err != nil {
+		errs = append(errs, err)
+	}
+
+	if s.Body.Name != nil {
+		*s.Body.Name = strings.TrimSpace(*s.Body.Name)
+		if *s.Body.Name == "" {
+			errs = append(errs, &huma.ErrorDetail{
+				Location: "body.name",
+				Message:  "Name must not be empty",
+				Value:    *s.Body.Name,
+			})
+		}
+	}
+
+	if s.Body.Query != nil {
+		*s.Body.Query = strings.TrimPrefix(strings.TrimSpace(*s.Body.Query), "?")
+	}
+
+	if s.Body.Recipients != nil {
+		errs = append(errs, validateRecipients(*s.Body.Recipients)...)
+	}
+
+	return errs
+}
+
+// Resolve validates the input in DeleteSavedSearchInput.
+func (s *DeleteSavedSearchInput) Resolve(ctx huma.Context) []error {
+	if err := validateID(&s.ID, "path.id"); err != nil {
+		return []error{err}
+	}
+
+	return nil
+}
+
+// Resolve validates the input in RunSavedSearchInput.
+func (s *RunSavedSearchInput) Resolve(ctx huma.Context) []error {
+	if err := validateID(&s.ID, "path.id"); err != nil {
+		return []error{err}
+	}
+
+	return nil
+}
+
+// validateRecipients checks that the recipients of a saved search are email addresses.
+func validateRecipients(recipients []string) []error {
+	var errs []error
+
+	for i, recipient := range recipients {
+		if _, err := mail.ParseAddress(recipient); err != nil {
+			errs = append(errs, &huma.ErrorDetail{
+				Location: fmt.Sprintf("body.recipients[%d]", i),
+				Message:  "expected string to be RFC 5322 email",
+				Value:    recipient,
+			})
+		}
+	}
+
+	return errs
+}
+
+// savedSearchQueryErrors reports the errors of the query of a saved search at the query in the body,
+// keeping the parameters they are about in their messages.
+func savedSearchQueryErrors(errs []error) []error {
+	reported := make([]error, 0, len(errs))
+
+	for _, err := range errs {
+		detail := &huma.ErrorDetail{Location: "body.query", Message: err.Error()}
+
+		var errDetail *huma.ErrorDetail
+		if errors.As(err, &errDetail) {
+			detail.Message = fmt.Sprintf("%s: %s", errDetail.Location, errDetail.Message)
+			detail.Value = errDetail.Value
+		}
+
+		reported = append(reported, detail)
+	}
+
+	return reported
+}
+
+// decodeSavedSearch decodes the query of a saved search into the input of the search of its
+// target, and validates it like the search validates its query, with dates in loc.
+func decodeSavedSearch(target, rawQuery string, loc *time.Location) (any, []error) {
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	switch target {
+	case data.SavedSearchTargetBooks:
+		input := &SearchBookInput{}
+		errs := query.Decode(values, input)
+		if errs == nil {
+			errs = append(validateIDs(input.IDs, "query.ids"), input.resolve(loc)...)
+		}
+		return input, errs
+	case data.SavedSearchTargetPatrons:
+		input := &SearchPatronsInput{}
+		errs := query.Decode(values, input)
+		if errs == nil {
+			errs = append(validateIDs(input.IDs, "query.ids"), query.Normalize(input)...)
+		}
+		return input, errs
+	case data.SavedSearchTargetTransactions:
+		input := &SearchTransactionsInput{}
+		errs := query.Decode(values, input)
+		if errs == nil {
+			errs = append(validateIDs(input.IDs, "query.ids"), input.resolve(loc)...)
+		}
+		return input, errs
+	default:
+		return nil, []error{fmt.Errorf("unknown search target %q", target)}
+	}
+}
+
+// runSavedSearch runs a saved search with the page and export format of the run, like its query is
+// sent to the search of its target.
+func (app *Application) runSavedSearch(ctx context.Context, search *data.SavedSearch, page PaginationInput, export ExportInput) (*ExportOutput, error) {
+	input, errs := decodeSavedSearch(search.Target, search.Query, timezone.FromContext(ctx))
+	if errs != nil {
+		return &ExportOutput{}, huma.Error422UnprocessableEntity("validation failed", savedSearchQueryErrors(errs)...)
+	}
+
+	switch input := input.(type) {
+	case *SearchBookInput:
+		input.PaginationInput, input.ExportInput = page, export
+		return app.searchBookHandler(ctx, input)
+	case *SearchPatronsInput:
+		input.PaginationInput, input.ExportInput = page, export
+		return app.searchPatronsHandler(ctx, input)
+	case *SearchTransactionsInput:
+		input.PaginationInput, input.ExportInput = page, export
+		return app.searchTransactionsHandler(ctx, input)
+	default:
+		return &ExportOutput{}, app.serverError(ctx, fmt.Errorf("unknown search target %q", search.Target))
+	}
+}
+
+// nextSavedSearchRun returns when a search with schedule runs next after now, at the hour of the
+// overdue report in the timezone of the library, and on its day for weekly searches. It is zero
+// for searches which are only run on demand.
+func (app *Application) nextSavedSearchRun(schedule string, now time.Time) time.Time {
+	switch schedule {
+	case data.SavedSearchScheduleDaily:
+		return timezone.NextDaily(now, app.Config.Reports.Hour, app.location)
+	case data.SavedSearchScheduleWeekly:
+		weekday := weekdays[strings.ToLower(app.Config.Reports.Weekday)]
+		return timezone.NextWeekly(now, weekday, app.Config.Reports.Hour, app.location)
+	default:
+		return time.Time{}
+	}
+}
+
+// scheduleSavedSearches runs the scheduled searches which are due every poll interval until ctx is canceled.
+func (app *Application) scheduleSavedSearches(ctx context.Context) {
+	ticker := time.NewTicker(savedSearchPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		runCtx, cancel := context.WithTimeout(ctx, reportTimeout)
+		if _, err := app.RunScheduledSearches(runCtx); err != nil {
+			app.logger.Error("failed to run scheduled searches", slog.Any("error", err))
+		}
+		cancel()
+	}
+}
+
+// RunScheduledSearches runs the scheduled searches which are due, and emails their results to
+// their recipients as attachments in the format of the overdue report. It returns how many
+// searches were run. The next run of a search is set before it is run, so that it is run once
+// even if scheduled searches run concurrently.
+func (app *Application) RunScheduledSearches(ctx context.Context) (int, error) {
+	// Scheduled searches are not run within an operation, so their reads are tagged and located here.
+	ctx = timezone.WithLocation(app.withListReads(ctx, searchesKey), app.location)
+
+	now := time.Now()
+
+	searches, _, err := app.Models.SavedSearches.GetAll(ctx, data.SavedSearchFilter{MaxNextRunAt: &now}, data.Paginator{}, data.Sorter{})
+	if err != nil {
+		return 0, err
+	}
+
+	var ran int
+	for i := range searches {
+		search := &searches[i]
+		search.LastRunAt = now
+		search.NextRunAt = app.nextSavedSearchRun(search.Schedule, now)
+
+		if err = app.Models.SavedSearches.Update(ctx, data.SavedSearchFilter{ID: &search.ID}, search); err != nil {
+			if errors.Is(err, data.ErrEditConflict) {
+				continue
+			}
+			return ran, err
+		}
+
+		if err = app.sendSavedSearch(ctx, search, now); err != nil {
+			app.logger.Error("failed to send saved search", slog.String("saved_search_id", search.ID), slog.Any("error", err))
+			app.reportError(ctx, err)
+			continue
+		}
+
+		ran++
+	}
+
+	return ran, nil
+}
+
+// sendSavedSearch runs a saved search and emails its results to each of its recipients. It fails
+// if any recipient could not be emailed.
+func (app *Application) sendSavedSearch(ctx context.Context, search *data.SavedSearch, now time.Time) error {
+	format := app.Config.Reports.Format
+
+	output, err := app.runSavedSearch(ctx, search, PaginationInput{Page: 1, PageSize: maxExportRecords}, ExportInput{Format: format})
+	if err != nil {
+		return err
+	}
+
+	results, ok := output.Body.([]byte)
+	if !ok {
+		return fmt.Errorf("saved search %s was not exported", search.ID)
+	}
+
+	attachment := mailer.Attachment{
+		Filename:    fmt.Sprintf("%s.%s", search.Target, format),
+		ContentType: output.ContentType,
+		Data:        results,
+	}
+
+	var errs []error
+	for _, recipient := range search.Recipients {
+		address, err := mail.ParseAddress(recipient)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		msg, err := app.mailer.Render(mailer.SavedSearchTemplate, app.Config.Mail.Locale, mailer.SavedSearchData{
+			Name:        cmp.Or(address.Name, address.Address),
+			Search:      search.Name,
+			GeneratedAt: now.In(app.location),
+		})
+		if err != nil {
+			return err
+		}
+		msg.To = address.Address
+		msg.Attachments = []mailer.Attachment{attachment}
+
+		if err = app.mailer.Deliver(ctx, msg); err != nil {
+			errs = append(errs, fmt.Errorf("failed to send saved search to %s: %v", address.Address, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// createSavedSearchHandler handles a request to save a search, and schedules it if it has a schedule.
+func (app *Application) createSavedSearchHandler(ctx context.Context, input *CreateSavedSearchInput) (*CreateSavedSearchOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	admin, ok := adminFromContext(ctx)
+	if !ok {
+		return &CreateSavedSearchOutput{}, app.serverError(ctx, errors.New("no admin in the context of an admin request"))
+	}
+
+	search := &data.SavedSearch{
+		Name:      input.Body.Name,
+		Target:    input.Body.Target,
+		Query:     input.Body.Query,
+		CreatedBy: admin.Name,
+	}
+	if input.Body.Schedule != savedSearchScheduleNone {
+		search.Schedule = input.Body.Schedule
+		search.Recipients = input.Body.Recipients
+		search.NextRunAt = app.nextSavedSearchRun(search.Schedule, time.Now())
+	}
+
+	id, err := app.Models.SavedSearches.Insert(ctx, search)
+	if err != nil {
+		return &CreateSavedSearchOutput{}, app.serverError(ctx, err)
+	}
+	search.ID = id
+
+	resp := &CreateSavedSearchOutput{
+		Body:     *search,
+		Location: fmt.Sprintf("%s/%s/%s", basePath, searchesKey, id),
+	}
+
+	return resp, nil
+}
+
+// getSavedSearchHandler fetches a saved search by its ID.
+func (app *Application) getSavedSearchHandler(ctx context.Context, input *GetSavedSearchInput) (*SavedSearchOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	search, err := app.Models.SavedSearches.Get(ctx, data.SavedSearchFilter{ID: &input.ID})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return &SavedSearchOutput{}, huma.Error404NotFound(errNotFoundMsg)
+		default:
+			return &SavedSearchOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	resp := &SavedSearchOutput{
+		Body: *search,
+	}
+
+	return resp, nil
+}
+
+// getSavedSearchesHandler fetches the saved searches with pagination, filtering and sorting.
+func (app *Application) getSavedSearchesHandler(ctx context.Context, input *GetSavedSearchesInput) (*GetSavedSearchesOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	paginator := data.Paginator{Page: input.Page, PageSize: input.PageSize}
+	sorter := data.Sorter{Field: input.Sort, SortSafelist: supportedSavedSearchesSortFields, Collation: app.collation}
+
+	filter := data.SavedSearchFilter{}
+	if input.Target != "" {
+		filter.Target = &input.Target
+	}
+
+	searches, metadata, err := app.Models.SavedSearches.GetAll(ctx, filter, paginator, sorter)
+	if err != nil {
+		return &GetSavedSearchesOutput{}, app.serverError(ctx, err)
+	}
+
+	resp := &GetSavedSearchesOutput{
+		Body: SavedSearchesInfo{
+			SavedSearches: searches,
+			Metadata:      metadata,
+		},
+	}
+
+	return resp, nil
+}
+
+// updateSavedSearchHandler updates the fields of a saved search, such as its query or its schedule.
+// Its next run is set again if its schedule changes.
+func (app *Application) updateSavedSearchHandler(ctx context.Context, input *UpdateSavedSearchInput) (*SavedSearchOutput, error) {
+	loc := timezone.FromContext(ctx)
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	search, err := app.Models.SavedSearches.Get(ctx, data.SavedSearchFilter{ID: &input.ID})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return &SavedSearchOutput{}, huma.Error404NotFound(errNotFoundMsg)
+		default:
+			return &SavedSearchOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	if input.Body.Name != nil {
+		search.Name = *input.Body.Name
+	}
+	if input.Body.Target != nil {
+		search.Target = *input.Body.Target
+	}
+	if input.Body.Query != nil {
+		search.Query = *input.Body.Query
+	}
+	if input.Body.Recipients != nil {
+		search.Recipients = *input.Body.Recipients
+	}
+	if input.Body.Schedule != nil {
+		schedule := *input.Body.Schedule
+		if schedule == savedSearchScheduleNone {
+			schedule = ""
+		}
+		if schedule != search.Schedule {
+			search.Schedule = schedule
+			search.NextRunAt = app.nextSavedSearchRun(schedule, time.Now())
+		}
+	}
+
+	if _, errs := decodeSavedSearch(search.Target, search.Query, loc); errs != nil {
+		return &SavedSearchOutput{}, huma.Error422UnprocessableEntity("validation failed", savedSearchQueryErrors(errs)...)
+	}
+	if search.Schedule != "" && len(search.Recipients) == 0 {
+		return &SavedSearchOutput{}, huma.Error422UnprocessableEntity(errSavedSearchNoRecipientsMsg)
+	}
+
+	if err = app.Models.SavedSearches.Update(ctx, data.SavedSearchFilter{ID: &search.ID}, search); err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			return &SavedSearchOutput{}, huma.Error409Conflict(errConflictMsg)
+		default:
+			return &SavedSearchOutput{}, app.serverError(ctx, err)
+		}
+	}
+	if search.Schedule == "" {
+		search.Recipients = nil
+		search.NextRunAt = time.Time{}
+	}
+
+	resp := &SavedSearchOutput{
+		Body: *search,
+	}
+
+	return resp, nil
+}
+
+// deleteSavedSearchHandler handles a request to delete a saved search, which also stops its schedule.
+func (app *Application) deleteSavedSearchHandler(ctx context.Context, input *DeleteSavedSearchInput) (*DeleteSavedSearchOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	err := app.Models.SavedSearches.Delete(ctx, data.SavedSearchFilter{ID: &input.ID})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return &DeleteSavedSearchOutput{}, huma.Error404NotFound(errNotFoundMsg)
+		default:
+			return &DeleteSavedSearchOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	resp := &DeleteSavedSearchOutput{
+		Body: "saved search successfully deleted",
+	}
+
+	return resp, nil
+}
+
+// runSavedSearchHandler runs a saved search, returning a page of its results or exporting them
+// like the search of its target.
+func (app *Application) runSavedSearchHandler(ctx context.Context, input *RunSavedSearchInput) (*ExportOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	search, err := app.Models.SavedSearches.Get(ctx, data.SavedSearchFilter{ID: &input.ID})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return &ExportOutput{}, huma.Error404NotFound(errNotFoundMsg)
+		default:
+			return &ExportOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	return app.runSavedSearch(ctx, search, input.PaginationInput, input.ExportInput)
+}
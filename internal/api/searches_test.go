@@ -0,0 +1,137 @@
+package api_test
+
+import (
+	"context"
+	"github.com/mzeevi/library/internal/api"
+	"github.com/mzeevi/library/internal/api/apitest"
+	"github.com/mzeevi/library/internal/data"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSavedSearches(t *testing.T) {
+	a := apitest.New(t)
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+
+	fiction := apitest.Book("9780306406157", 1)
+	fiction.Title = "Fiction Book"
+	a.SeedBook(fiction)
+	poetry := apitest.Book("9781861972712", 1)
+	poetry.Title = "Poetry Book"
+	poetry.Genres = []string{"Poetry"}
+	a.SeedBook(poetry)
+
+	rec := a.Do(http.MethodPost, "/searches", admin, map[string]any{"name": "Poetry", "target": "books", "query": "?genres=Poetry"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("create status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var search data.SavedSearch
+	a.Decode(rec, &search)
+	if search.Query != "genres=Poetry" || search.CreatedBy != "admin" || search.Schedule != "" {
+		t.Errorf("search = %+v; want an unscheduled search of poetry created by admin", search)
+	}
+
+	rec = a.Do(http.MethodGet, "/searches/"+search.ID+"/run", admin)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("run status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var books api.BooksInfo
+	a.Decode(rec, &books)
+	if len(books.Books) != 1 || books.Books[0].Title != "Poetry Book" {
+		t.Errorf("run books = %v; want the poetry book", books.Books)
+	}
+
+	if rec := a.Do(http.MethodGet, "/searches/"+search.ID+"/run?format=csv", admin); rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "text/csv; charset=utf-8" {
+		t.Errorf("export status = %v, content type = %q; want %v and csv", rec.Code, rec.Header().Get("Content-Type"), http.StatusOK)
+	}
+
+	for name, body := range map[string]map[string]any{
+		"unknown parameter":       {"name": "Bad", "target": "books", "query": "status=borrowed"},
+		"invalid value":           {"name": "Bad", "target": "transactions", "query": "status=lost"},
+		"conflicting parameters":  {"name": "Bad", "target": "transactions", "query": "status=borrowed&overdue=true"},
+		"schedule, no recipients": {"name": "Bad", "target": "books", "schedule": "daily"},
+		"invalid recipient":       {"name": "Bad", "target": "books", "schedule": "daily", "recipients": []string{"librarians"}},
+	} {
+		if rec := a.Do(http.MethodPost, "/searches", admin, body); rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("create with %s status = %v; want %v", name, rec.Code, http.StatusUnprocessableEntity)
+		}
+	}
+
+	rec = a.Do(http.MethodPut, "/searches/"+search.ID, admin, map[string]any{"schedule": "weekly", "recipients": []string{"librarians@library.com"}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("schedule status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	a.Decode(rec, &search)
+	if search.Schedule != data.SavedSearchScheduleWeekly || !search.NextRunAt.After(time.Now()) {
+		t.Errorf("scheduled search = %+v; want a weekly search which runs next in the future", search)
+	}
+
+	if rec := a.Do(http.MethodPut, "/searches/"+search.ID, admin, map[string]any{"query": "pages=many"}); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("update with an invalid query status = %v; want %v", rec.Code, http.StatusUnprocessableEntity)
+	}
+
+	if rec := a.Do(http.MethodGet, "/searches/"+search.ID+"/run", apitest.AdminAuth("admin", "wrong-password")); rec.Code != http.StatusUnauthorized {
+		t.Errorf("run with wrong credentials status = %v; want %v", rec.Code, http.StatusUnauthorized)
+	}
+
+	if rec := a.Do(http.MethodDelete, "/searches/"+search.ID, admin); rec.Code != http.StatusOK {
+		t.Errorf("delete status = %v; want %v", rec.Code, http.StatusOK)
+	}
+	if rec := a.Do(http.MethodGet, "/searches/"+search.ID+"/run", admin); rec.Code != http.StatusNotFound {
+		t.Errorf("run deleted search status = %v; want %v", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestRunScheduledSearches(t *testing.T) {
+	a := apitest.New(t, func(app *api.Application) {
+		app.Config.Reports.Weekday = "monday"
+		app.Config.Reports.Hour = 8
+		app.Config.Reports.Format = "csv"
+	})
+	a.SeedBook(apitest.Book("9780306406157", 1))
+
+	ctx := context.Background()
+	due := &data.SavedSearch{
+		Name:       "Fiction",
+		Target:     data.SavedSearchTargetBooks,
+		Query:      "genres=Fiction",
+		Schedule:   data.SavedSearchScheduleDaily,
+		Recipients: []string{"Noa Levi <noa@library.com>"},
+		NextRunAt:  time.Now().Add(-time.Minute),
+	}
+	later := &data.SavedSearch{
+		Name:       "Later",
+		Target:     data.SavedSearchTargetBooks,
+		Schedule:   data.SavedSearchScheduleWeekly,
+		Recipients: []string{"librarians@library.com"},
+		NextRunAt:  time.Now().Add(time.Hour),
+	}
+	for _, search := range []*data.SavedSearch{due, later, {Name: "On demand", Target: data.SavedSearchTargetBooks}} {
+		if _, err := a.Models.SavedSearches.Insert(ctx, search); err != nil {
+			t.Fatalf("failed to seed saved search: %v", err)
+		}
+	}
+
+	// Only the search which is due is run, and only once.
+	for _, want := range []int{1, 0} {
+		ran, err := a.App.RunScheduledSearches(ctx)
+		if err != nil {
+			t.Fatalf("RunScheduledSearches() error = %v", err)
+		}
+		if ran != want {
+			t.Errorf("RunScheduledSearches() = %d; want %d", ran, want)
+		}
+	}
+
+	searches, _, err := a.Models.SavedSearches.GetAll(ctx, data.SavedSearchFilter{Target: apitest.Ptr(data.SavedSearchTargetBooks)}, data.Paginator{}, data.Sorter{})
+	if err != nil {
+		t.Fatalf("failed to get saved searches: %v", err)
+	}
+	for _, search := range searches {
+		if search.Name == due.Name && (search.LastRunAt.IsZero() || !search.NextRunAt.After(time.Now())) {
+			t.Errorf("run search = %+v; want it to have run and to run next tomorrow", search)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"github.com/mzeevi/library/internal/data"
+	"github.com/mzeevi/library/internal/seed"
+)
+
+// seedBatchSize is the number of documents inserted at once when seeding.
+const seedBatchSize = 1000
+
+// SeedResult holds the number of documents inserted by Seed or LoadFixture.
+type SeedResult struct {
+	Books        int `json:"books"`
+	Patrons      int `json:"patrons"`
+	Transactions int `json:"transactions"`
+	Resources    int `json:"resources"`
+	Reservations int `json:"reservations"`
+}
+
+// Seed fills the database with generated books, patrons and transactions, as
+// configured in Config.Seed.
+func (app *Application) Seed(ctx context.Context) (SeedResult, error) {
+	cfg := app.Config.Seed
+
+	return app.LoadFixture(ctx, seed.Fixture{Books: cfg.Books, Patrons: cfg.Patrons, Transactions: cfg.Transactions})
+}
+
+// LoadFixture fills the database with the generated documents of a fixture set. The documents are
+// generated with the random seed and the patron password of Config.Seed.
+func (app *Application) LoadFixture(ctx context.Context, fixture seed.Fixture) (SeedResult, error) {
+	cfg := app.Config.Seed
+
+	generator, err := seed.NewGenerator(cfg.RandomSeed, cfg.Password)
+	if err != nil {
+		return SeedResult{}, err
+	}
+
+	books := generator.Books(fixture.Books)
+	bookIDs, err := insertBatches(ctx, books, app.Models.Books.InsertMany)
+	if err != nil {
+		return SeedResult{}, fmt.Errorf("failed to insert books: %v", err)
+	}
+	for i, id := range bookIDs {
+		books[i].ID = id
+	}
+
+	patrons := generator.Patrons(fixture.Patrons)
+	patronIDs, err := insertBatches(ctx, patrons, app.Models.Patrons.InsertMany)
+	if err != nil {
+		return SeedResult{}, fmt.Errorf("failed to insert patrons: %v", err)
+	}
+	for i, id := range patronIDs {
+		patrons[i].ID = id
+	}
+
+	transactions := generator.Transactions(fixture.Transactions, books, patrons)
+	if _, err = insertBatches(ctx, transactions, app.Models.Transactions.InsertMany); err != nil {
+		return SeedResult{}, fmt.Errorf("failed to insert transactions: %v", err)
+	}
+
+	for _, book := range books {
+		if book.BorrowedCopies == 0 && book.Circulation.Borrows == 0 {
+			continue
+		}
+
+		if err = app.Models.Books.Update(ctx, data.BookFilter{ID: ptr(data.BookID(book.ID))}, book); err != nil {
+			return SeedResult{}, fmt.Errorf("failed to update borrowed copies and circulation: %v", err)
+		}
+	}
+
+	resources := generator.Resources(fixture.Resources)
+	for _, resource := range resources {
+		if resource.ID, err = app.Models.Resources.Insert(ctx, resource); err != nil {
+			return SeedResult{}, fmt.Errorf("failed to insert resources: %v", err)
+		}
+	}
+
+	reservations := generator.Reservations(fixture.Reservations, resources, patrons)
+	for _, reservation := range reservations {
+		if _, err = app.Models.Reservations.Insert(ctx, reservation); err != nil {
+			return SeedResult{}, fmt.Errorf("failed to insert reservations: %v", err)
+		}
+	}
+
+	return SeedResult{Books: len(books), Patrons: len(patrons), Transactions: len(transactions), Resources: len(resources), Reservations: len(reservations)}, nil
+}
+
+// insertBatches inserts documents in batches of seedBatchSize, returning the IDs of the inserted documents.
+func insertBatches[T any](ctx context.Context, documents []T, insert func(context.Context, []T) ([]string, error)) ([]string, error) {
+	ids := make([]string, 0, len(documents))
+
+	for start := 0; start < len(documents); start += seedBatchSize {
+		batchIDs, err := insert(ctx, documents[start:min(start+seedBatchSize, len(documents))])
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, batchIDs...)
+	}
+
+	return ids, nil
+}
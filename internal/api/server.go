@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/mzeevi/library/internal/logging"
 	"log/slog"
 	"net/http"
 	"os"
@@ -12,16 +13,61 @@ import (
 	"time"
 )
 
+// Handler returns the HTTP handler which serves the API.
+func (app *Application) Handler() http.Handler {
+	return app.routes()
+}
+
 func (app *Application) Serve() error {
 	srv := &http.Server{
 		Addr:         fmt.Sprintf(":%d", app.Config.Port),
-		Handler:      app.routes(),
+		Handler:      app.Handler(),
 		IdleTimeout:  time.Minute,
 		ReadTimeout:  5 * time.Second,
 		WriteTimeout: 10 * time.Second,
 		ErrorLog:     slog.NewLogLogger(app.logger.Handler(), slog.LevelError),
 	}
 
+	// The event dispatcher, the availability watcher, the overdue report schedule, the returns of
+	// e-books, the reminders of programs, the scheduled searches, the retention policy and the
+	// rollups of the statistics are stopped after the server, and completed with the background tasks.
+	workersCtx, stopWorkers := context.WithCancel(logging.WithLogger(context.Background(), app.logger.Logger))
+	defer stopWorkers()
+
+	app.wg.Add(8)
+	go func() {
+		defer app.wg.Done()
+		app.events.Run(workersCtx, app.Config.Events.DispatchInterval)
+	}()
+	go func() {
+		defer app.wg.Done()
+		app.watchAvailability(workersCtx)
+	}()
+	go func() {
+		defer app.wg.Done()
+		app.scheduleOverdueReport(workersCtx)
+	}()
+	go func() {
+		defer app.wg.Done()
+		app.scheduleEbookReturns(workersCtx)
+	}()
+	go func() {
+		defer app.wg.Done()
+		app.schedulePrograms(workersCtx)
+	}()
+	go func() {
+		defer app.wg.Done()
+		app.scheduleSavedSearches(workersCtx)
+	}()
+	go func() {
+		defer app.wg.Done()
+		app.scheduleRetention(workersCtx)
+	}()
+	go func() {
+		defer app.wg.Done()
+		app.scheduleDailyStats(workersCtx)
+	}()
+
 	shutdownError := make(chan error)
 
 	go func() {
@@ -41,6 +87,11 @@ func (app *Application) Serve() error {
 
 		app.logger.Info("completing background tasks", "addr", srv.Addr)
 
+		stopWorkers()
+
+		app.wg.Wait()
+		app.flushErrorReports()
+
 		shutdownError <- nil
 	}()
 
@@ -0,0 +1,300 @@
+package api
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mzeevi/library/internal/data"
+	"github.com/mzeevi/library/internal/dublincore"
+	"github.com/mzeevi/library/internal/isbn"
+	"github.com/mzeevi/library/internal/sru"
+	"net"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	defaultSRURecords = 10
+	maxSRURecords     = 100
+)
+
+// Fields of books which SRU indexes search.
+const (
+	sruFieldTitle      = "title"
+	sruFieldAuthors    = "authors"
+	sruFieldSubjects   = "subjects"
+	sruFieldPublishers = "publishers"
+	sruFieldIdentifier = "identifier"
+	sruFieldLanguage   = "language"
+	sruFieldCallNumber = "call_number"
+)
+
+// sruIndex is an index of SRU queries, with the field of books it searches.
+type sruIndex struct {
+	index sru.Index
+	field string
+}
+
+// sruIndexes are the indexes of SRU queries. An index without a context set, such as title, is
+// in the dc context set.
+var sruIndexes = []sruIndex{
+	{index: sru.Index{Set: "cql", Name: "serverChoice", Title: "Title or author"}, field: sruFieldTitle},
+	{index: sru.Index{Set: "dc", Name: "title", Title: "Title"}, field: sruFieldTitle},
+	{index: sru.Index{Set: "bath", Name: "title", Title: "Title"}, field: sruFieldTitle},
+	{index: sru.Index{Set: "dc", Name: "creator", Title: "Author"}, field: sruFieldAuthors},
+	{index: sru.Index{Set: "bath", Name: "author", Title: "Author"}, field: sruFieldAuthors},
+	{index: sru.Index{Set: "dc", Name: "subject", Title: "Genre"}, field: sruFieldSubjects},
+	{index: sru.Index{Set: "bath", Name: "subject", Title: "Genre"}, field: sruFieldSubjects},
+	{index: sru.Index{Set: "dc", Name: "publisher", Title: "Publisher"}, field: sruFieldPublishers},
+	{index: sru.Index{Set: "dc", Name: "identifier", Title: "Identifier, such as an ISBN"}, field: sruFieldIdentifier},
+	{index: sru.Index{Set: "bath", Name: "isbn", Title: "ISBN"}, field: sruFieldIdentifier},
+	{index: sru.Index{Set: "dc", Name: "language", Title: "ISO 639-1 code of the language"}, field: sruFieldLanguage},
+	{index: sru.Index{Set: "local", Name: "callNumber", Title: "Beginning of the call number of a copy"}, field: sruFieldCallNumber},
+}
+
+// sruRelations are the relations of SRU queries, which match a term as the other filters of
+// books do. Titles are matched as substrings, and the other fields exactly.
+var sruRelations = []string{"=", "==", "exact", "adj", "all", "any"}
+
+type SRUInput struct {
+	Host           string `header:"Host"`
+	Operation      string `query:"operation" doc:"explain or searchRetrieve, by default explain"`
+	Version        string `query:"version" doc:"Version of SRU, which is 1.2"`
+	Query          string `query:"query" doc:"CQL query of searchRetrieve, such as dc.title = hobbit and dc.creator = \"J. R. R. Tolkien\""`
+	StartRecord    int    `query:"startRecord" default:"1" doc:"Position of the first record in the results, from 1"`
+	MaximumRecords int    `query:"maximumRecords" default:"10" doc:"Number of records, at most 100"`
+	RecordSchema   string `query:"recordSchema" doc:"Schema of the records, which is dc for Dublin Core"`
+	RecordPacking  string `query:"recordPacking" doc:"Packing of the records, which is xml"`
+}
+
+type SRUOutput struct {
+	ContentType string `header:"Content-Type"`
+	Body        []byte
+}
+
+// dublinCore returns the Dublin Core record of a book. Its ISBNs are identified as URNs, such as
+// urn:isbn:9780306406157.
+func dublinCore(book data.Book) dublincore.Record {
+	record := dublincore.Record{
+		Titles:     []string{book.Title},
+		Creators:   book.Authors,
+		Subjects:   book.Genres,
+		Publishers: book.Publishers,
+		Types:      []string{dublincore.TypeText},
+	}
+
+	if !book.PublishedAt.IsZero() {
+		record.Dates = []string{book.PublishedAt.Format(time.DateOnly)}
+	}
+	if book.Format != "" {
+		record.Formats = []string{book.Format}
+	}
+	if book.Language != "" {
+		record.Languages = []string{book.Language}
+	}
+
+	for _, identifier := range book.Identifiers {
+		switch identifier.Type {
+		case data.IdentifierISBN13, data.IdentifierISBN10, data.IdentifierEISBN:
+			record.Identifiers = append(record.Identifiers, "urn:isbn:"+identifier.Value)
+		case data.IdentifierOCLC:
+			record.Identifiers = append(record.Identifiers, "(OCoLC)"+identifier.Value)
+		case data.IdentifierLCCN:
+			record.Identifiers = append(record.Identifiers, "info:lccn/"+identifier.Value)
+		}
+	}
+
+	return record
+}
+
+// sruFilter returns the filter of books of the clauses of an SRU query.
+func sruFilter(clauses []sru.Clause) (data.BookFilter, error) {
+	filter := data.BookFilter{}
+	fields := make(map[string]bool, len(clauses))
+
+	for _, clause := range clauses {
+		index := cmp.Or(clause.Index, "cql.serverchoice")
+		if !strings.Contains(index, ".") {
+			index = "dc." + index
+		}
+
+		i := slices.IndexFunc(sruIndexes, func(i sruIndex) bool {
+			return strings.EqualFold(i.index.Set+"."+i.index.Name, index)
+		})
+		if i < 0 {
+			return filter, &sru.Diagnostic{Code: sru.DiagnosticUnsupportedIndex, Details: clause.Index}
+		}
+		field := sruIndexes[i].field
+
+		if clause.Relation != "" && !slices.Contains(sruRelations, clause.Relation) {
+			return filter, &sru.Diagnostic{Code: sru.DiagnosticUnsupportedRelation, Details: clause.Relation}
+		}
+		if fields[field] {
+			return filter, &sru.Diagnostic{Code: sru.DiagnosticUnsupportedFeature, Details: fmt.Sprintf("more than one clause of index %s", clause.Index)}
+		}
+		fields[field] = true
+
+		term := clause.Term
+		switch field {
+		case sruFieldTitle:
+			filter.Title = &term
+		case sruFieldAuthors:
+			filter.Authors = []string{term}
+		case sruFieldSubjects:
+			filter.Genres = []string{term}
+		case sruFieldPublishers:
+			filter.Publishers = []string{term}
+		case sruFieldIdentifier:
+			term = strings.TrimPrefix(term, "urn:isbn:")
+			// Books with an ISBN have its ISBN-13, which ISBN-10s are converted to.
+			if code, err := isbn.FromBarcode(term); err == nil {
+				term = code
+			}
+			filter.Identifier = &term
+		case sruFieldLanguage:
+			term = strings.ToLower(term)
+			filter.Language = &term
+		case sruFieldCallNumber:
+			term = strings.Join(strings.Fields(strings.ToUpper(term)), " ")
+			filter.CallNumber = &term
+		}
+	}
+
+	return filter, nil
+}
+
+// sruSearch returns the records of the books matching an SRU query from a position, with the
+// number of matching books. The records are read from the pages of the results they span.
+func (app *Application) sruSearch(ctx context.Context, query string, start, maximum int) ([]sru.Record, int64, error) {
+	clauses, err := sru.Parse(query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	filter, err := sruFilter(clauses)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if filter.Publishers != nil {
+		filter.Publishers, err = app.publisherNames(ctx, filter.Publishers)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	pageSize := int64(max(maximum, 1))
+	page := int64(start-1)/pageSize + 1
+	offset := int64(start-1) % pageSize
+
+	books, metadata, err := app.searchBooks(ctx, filter, data.Paginator{Page: page, PageSize: pageSize}, "")
+	if err != nil {
+		return nil, 0, err
+	}
+	if offset > 0 && int64(len(books)) == pageSize {
+		next, _, err := app.searchBooks(ctx, filter, data.Paginator{Page: page + 1, PageSize: pageSize}, "")
+		if err != nil {
+			return nil, 0, err
+		}
+		books = append(books, next...)
+	}
+	books = books[min(offset, int64(len(books))):]
+	books = books[:min(int64(maximum), int64(len(books)))]
+
+	if start > 1 && metadata.TotalRecords < int64(start) {
+		return nil, 0, &sru.Diagnostic{Code: sru.DiagnosticStartOutOfRange, Details: fmt.Sprint(start)}
+	}
+
+	records := make([]sru.Record, 0, len(books))
+	for i, book := range books {
+		records = append(records, sru.NewDCRecord(dublinCore(book), int64(start+i)))
+	}
+
+	return records, metadata.TotalRecords, nil
+}
+
+// sruHandler handles the explain and searchRetrieve operations of SRU. Errors of requests are
+// reported as SRU diagnostics in successful responses, as the protocol requires.
+func (app *Application) sruHandler(ctx context.Context, input *SRUInput) (*SRUOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	var b bytes.Buffer
+	resp := &SRUOutput{ContentType: sru.ContentType}
+
+	diagnose := func(diagnostic *sru.Diagnostic) (*SRUOutput, error) {
+		if err := sru.NewDiagnosticResponse(diagnostic).Write(&b); err != nil {
+			return &SRUOutput{}, app.serverError(ctx, err)
+		}
+		resp.Body = b.Bytes()
+
+		return resp, nil
+	}
+
+	if input.Version != "" && input.Version != "1.1" && input.Version != sru.Version {
+		return diagnose(&sru.Diagnostic{Code: sru.DiagnosticUnsupportedVersion, Details: sru.Version})
+	}
+
+	switch input.Operation {
+	case "", sru.OperationExplain:
+		host, port, err := net.SplitHostPort(input.Host)
+		if err != nil {
+			host, port = input.Host, fmt.Sprint(app.Config.Port)
+		}
+
+		indexes := make([]sru.Index, 0, len(sruIndexes))
+		for _, i := range sruIndexes {
+			indexes = append(indexes, i.index)
+		}
+
+		err = sru.WriteExplain(&b, sru.Explain{
+			Host:           host,
+			Port:           port,
+			Database:       strings.TrimPrefix(fmt.Sprintf("%s/%s", basePath, sruKey), "/"),
+			Title:          cmp.Or(app.Config.Name, defaultLibraryName),
+			Indexes:        indexes,
+			DefaultRecords: defaultSRURecords,
+			MaximumRecords: maxSRURecords,
+		})
+		if err != nil {
+			return &SRUOutput{}, app.serverError(ctx, err)
+		}
+	case sru.OperationSearchRetrieve:
+		switch {
+		case input.Query == "":
+			return diagnose(&sru.Diagnostic{Code: sru.DiagnosticMissingParameter, Details: "query"})
+		case input.RecordSchema != "" && input.RecordSchema != sru.SchemaDC && input.RecordSchema != sru.SchemaDCURI:
+			return diagnose(&sru.Diagnostic{Code: sru.DiagnosticUnsupportedSchema, Details: input.RecordSchema})
+		case input.RecordPacking != "" && input.RecordPacking != "xml":
+			return diagnose(&sru.Diagnostic{Code: sru.DiagnosticUnsupportedPacking, Details: input.RecordPacking})
+		case input.StartRecord < 1:
+			return diagnose(&sru.Diagnostic{Code: sru.DiagnosticUnsupportedValue, Details: "startRecord"})
+		case input.MaximumRecords < 0 || input.MaximumRecords > maxSRURecords:
+			return diagnose(&sru.Diagnostic{Code: sru.DiagnosticUnsupportedValue, Details: "maximumRecords"})
+		}
+
+		records, total, err := app.sruSearch(ctx, input.Query, input.StartRecord, input.MaximumRecords)
+		if err != nil {
+			var diagnostic *sru.Diagnostic
+			switch {
+			case errors.As(err, &diagnostic):
+				return diagnose(diagnostic)
+			default:
+				return &SRUOutput{}, app.serverError(ctx, err)
+			}
+		}
+
+		if err = sru.NewSearchRetrieveResponse(records, int64(input.StartRecord), total).Write(&b); err != nil {
+			return &SRUOutput{}, app.serverError(ctx, err)
+		}
+	default:
+		return diagnose(&sru.Diagnostic{Code: sru.DiagnosticUnsupportedOperation, Details: input.Operation})
+	}
+
+	resp.Body = b.Bytes()
+
+	return resp, nil
+}
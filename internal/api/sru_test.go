@@ -0,0 +1,94 @@
+package api_test
+
+import (
+	"encoding/xml"
+	"github.com/mzeevi/library/internal/api/apitest"
+	"github.com/mzeevi/library/internal/auth"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// sruResponse is the part of an SRU searchRetrieve response which the tests read.
+type sruResponse struct {
+	NumberOfRecords    int64 `xml:"numberOfRecords"`
+	NextRecordPosition int64 `xml:"nextRecordPosition"`
+	Records            []struct {
+		Position int64    `xml:"recordPosition"`
+		Titles   []string `xml:"recordData>dc>title"`
+		IDs      []string `xml:"recordData>dc>identifier"`
+	} `xml:"records>record"`
+	Diagnostics []struct {
+		URI string `xml:"uri"`
+	} `xml:"diagnostics>diagnostic"`
+}
+
+func TestSRU(t *testing.T) {
+	a := apitest.New(t)
+	patronID := a.SeedPatron(apitest.Patron("partner@example.com", auth.ReadBooksPermission))
+	partner := a.PatronAuth(patronID)
+
+	for _, code := range []string{"9780306406157", "9780140449136", "9781861972712"} {
+		a.SeedBook(apitest.Book(code, 1))
+	}
+
+	search := func(params url.Values) sruResponse {
+		t.Helper()
+
+		rec := a.Do(http.MethodGet, "/sru?"+params.Encode(), partner)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET /sru?%s status = %v; want %v (body: %s)", params.Encode(), rec.Code, http.StatusOK, rec.Body.String())
+		}
+		if contentType := rec.Header().Get("Content-Type"); contentType != "application/xml" {
+			t.Errorf("GET /sru?%s content type = %s; want application/xml", params.Encode(), contentType)
+		}
+
+		var resp sruResponse
+		if err := xml.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("GET /sru?%s = %s; want an SRU response (%v)", params.Encode(), rec.Body.String(), err)
+		}
+		return resp
+	}
+
+	rec := a.Do(http.MethodGet, "/sru", partner)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "<explainResponse") || !strings.Contains(rec.Body.String(), "callNumber") {
+		t.Errorf("GET /sru = %v %s; want an explain response", rec.Code, rec.Body.String())
+	}
+
+	resp := search(url.Values{"operation": {"searchRetrieve"}, "version": {"1.2"}, "query": {`bath.isbn = "0-306-40615-2"`}})
+	if resp.NumberOfRecords != 1 || len(resp.Records) != 1 || !strings.Contains(strings.Join(resp.Records[0].IDs, " "), "urn:isbn:9780306406157") {
+		t.Errorf("search by ISBN = %+v; want the book", resp)
+	}
+
+	resp = search(url.Values{"operation": {"searchRetrieve"}, "query": {"dc.subject = Fiction"}, "startRecord": {"2"}, "maximumRecords": {"1"}})
+	if resp.NumberOfRecords != 3 || len(resp.Records) != 1 || resp.Records[0].Position != 2 || resp.NextRecordPosition != 3 {
+		t.Errorf("second page = %+v; want the second of 3 records and the next position", resp)
+	}
+
+	for query, uri := range map[string]string{
+		"dc.title = a or dc.title = b": "info:srw/diagnostic/1/37",
+		"dc.rights = free":             "info:srw/diagnostic/1/16",
+		"dc.title < a":                 "info:srw/diagnostic/1/19",
+		"dc.title = ":                  "info:srw/diagnostic/1/10",
+	} {
+		resp = search(url.Values{"operation": {"searchRetrieve"}, "query": {query}})
+		if len(resp.Diagnostics) != 1 || resp.Diagnostics[0].URI != uri {
+			t.Errorf("search %q diagnostics = %+v; want %s", query, resp.Diagnostics, uri)
+		}
+	}
+
+	resp = search(url.Values{"operation": {"searchRetrieve"}, "query": {"dc.subject = Fiction"}, "startRecord": {"4"}})
+	if len(resp.Diagnostics) != 1 || resp.Diagnostics[0].URI != "info:srw/diagnostic/1/61" {
+		t.Errorf("search beyond the results diagnostics = %+v; want info:srw/diagnostic/1/61", resp.Diagnostics)
+	}
+
+	resp = search(url.Values{"operation": {"scan"}})
+	if len(resp.Diagnostics) != 1 || resp.Diagnostics[0].URI != "info:srw/diagnostic/1/4" {
+		t.Errorf("scan diagnostics = %+v; want info:srw/diagnostic/1/4", resp.Diagnostics)
+	}
+
+	if rec = a.Do(http.MethodGet, "/sru"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("GET /sru without credentials status = %v; want %v", rec.Code, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,408 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/mzeevi/library/internal/data"
+	"github.com/mzeevi/library/internal/isbn"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	errSuggestionPatronOnlyMsg = "suggestions are only made by patrons"
+	errSuggestionInCatalogMsg  = "the suggested book is already in the catalog"
+	errSuggestionStatusMsg     = "a %s suggestion cannot be %s"
+)
+
+// maxSuggestionCandidates bounds the books whose titles contain the title of a suggestion, which
+// are compared with it to detect a duplicate.
+const maxSuggestionCandidates = 1000
+
+// suggestionTransitions are the statuses which a suggestion may move to from each status. Rejected
+// and ordered suggestions are final.
+var suggestionTransitions = map[string][]string{
+	data.SuggestionStatusPending:  {data.SuggestionStatusAccepted, data.SuggestionStatusRejected, data.SuggestionStatusOrdered},
+	data.SuggestionStatusAccepted: {data.SuggestionStatusRejected, data.SuggestionStatusOrdered},
+}
+
+type CreateSuggestionInput struct {
+	Body struct {
+		Title   string   `json:"title" minLength:"1" maxLength:"500"`
+		Authors []string `json:"authors,omitempty" required:"false" maxItems:"10"`
+		ISBN    string   `json:"isbn,omitempty" required:"false" doc:"ISBN-10 or ISBN-13 of the book, with or without hyphens"`
+		Note    string   `json:"note,omitempty" required:"false" maxLength:"500" doc:"Why the library should acquire the book"`
+	}
+}
+
+type CreateSuggestionOutput struct {
+	Location string          `header:"Location"`
+	Body     data.Suggestion `json:"suggestion"`
+}
+
+type GetSuggestionInput struct {
+	ID string `json:"id" path:"id"`
+}
+
+type SuggestionOutput struct {
+	Body data.Suggestion `json:"suggestion"`
+}
+
+type GetSuggestionsInput struct {
+	PaginationInput
+	Status   string `query:"status" enum:"pending,accepted,rejected,ordered" doc:"Filter by status"`
+	PatronID string `query:"patron_id" doc:"Filter by the patron who made the suggestion"`
+	Sort     string `query:"sort" enum:"created_at,-created_at" default:"created_at"`
+}
+
+type GetMySuggestionsInput struct {
+	PaginationInput
+	Status string `query:"status" enum:"pending,accepted,rejected,ordered" doc:"Filter by status"`
+	Sort   string `query:"sort" enum:"created_at,-created_at" default:"-created_at"`
+}
+
+type GetSuggestionsOutput struct {
+	Body SuggestionsInfo
+}
+
+type SuggestionsInfo struct {
+	Suggestions []data.Suggestion `json:"suggestions"`
+	Metadata    data.Metadata     `json:"metadata"`
+}
+
+type DecideSuggestionInput struct {
+	ID   string `json:"id" path:"id"`
+	Body *struct {
+		Response string `json:"response,omitempty" required:"false" maxLength:"500" doc:"Response to the patron who made the suggestion, such as why it was rejected"`
+	}
+}
+
+// Resolve validates the input in CreateSuggestionInput. The ISBN is converted to its ISBN-13,
+// by which books of the catalog are identified.
+func (s *CreateSuggestionInput) Resolve(ctx huma.Context) []error {
+	s.Body.Title = strings.TrimSpace(s.Body.Title)
+	s.Body.Note = strings.TrimSpace(s.Body.Note)
+
+	var errs []error
+
+	authors := make([]string, 0, len(s.Body.Authors))
+	for i, author := range s.Body.Authors {
+		author = strings.TrimSpace(author)
+		if author == "" {
+			errs = append(errs, &huma.ErrorDetail{
+				Location: fmt.Sprintf("body.authors[%d]", i),
+				Message:  "Author must not be empty",
+				Value:    s.Body.Authors[i],
+			})
+			continue
+		}
+		authors = append(authors, author)
+	}
+	s.Body.Authors = authors
+
+	if s.Body.Title == "" {
+		errs = append(errs, &huma.ErrorDetail{
+			Location: "body.title",
+			Message:  "Title must not be empty",
+			Value:    s.Body.Title,
+		})
+	}
+
+	if s.Body.ISBN != "" {
+		code, err := isbn.FromBarcode(s.Body.ISBN)
+		if err != nil {
+			errs = append(errs, &huma.ErrorDetail{
+				Location: "body.isbn",
+				Message:  "Invalid ISBN",
+				Value:    s.Body.ISBN,
+			})
+		}
+		s.Body.ISBN = code
+	}
+
+	return errs
+}
+
+// Resolve validates the input in GetSuggestionInput.
+func (s *GetSuggestionInput) Resolve(ctx huma.Context) []error {
+	if err := validateID(&s.ID, "path.id"); err != nil {
+		return []error{err}
+	}
+
+	return nil
+}
+
+// Resolve validates the input in GetSuggestionsInput.
+func (s *GetSuggestionsInput) Resolve(ctx huma.Context) []error {
+	if s.PatronID == "" {
+		return nil
+	}
+
+	if err := validateID(&s.PatronID, "query.patron_id"); err != nil {
+		return []error{err}
+	}
+
+	return nil
+}
+
+// Resolve validates the input in DecideSuggestionInput.
+func (s *DecideSuggestionInput) Resolve(ctx huma.Context) []error {
+	if err := validateID(&s.ID, "path.id"); err != nil {
+		return []error{err}
+	}
+
+	if s.Body != nil {
+		s.Body.Response = strings.TrimSpace(s.Body.Response)
+	}
+
+	return nil
+}
+
+// normalizeTitle returns a title or a name in lower case without punctuation, by which the
+// titles and authors of suggestions are compared with the books of the catalog.
+func normalizeTitle(title string) string {
+	words := strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	return strings.Join(words, " ")
+}
+
+// catalogDuplicate returns the book of the catalog which a suggestion duplicates, with the
+// location of the field of the suggestion which matched it: the book with its ISBN, or else a
+// book with its title, by one of its authors if it has any. It returns nil if there is none.
+func (app *Application) catalogDuplicate(ctx context.Context, suggestion *data.Suggestion) (*data.Book, string, error) {
+	if suggestion.ISBN != "" {
+		book, err := app.Models.Books.Get(ctx, data.BookFilter{Identifier: &suggestion.ISBN})
+		switch {
+		case err == nil:
+			return book, "body.isbn", nil
+		case !errors.Is(err, data.ErrDocumentNotFound):
+			return nil, "", err
+		}
+	}
+
+	// The books are looked up by the longest word of the title, which they contain whatever their
+	// punctuation and case.
+	title := normalizeTitle(suggestion.Title)
+	if title == "" {
+		return nil, "", nil
+	}
+	word := slices.MaxFunc(strings.Fields(title), func(a, b string) int { return len(a) - len(b) })
+
+	books, _, err := app.Models.Books.GetAll(ctx, data.BookFilter{Title: &word}, data.Paginator{Page: 1, PageSize: maxSuggestionCandidates}, data.Sorter{})
+	if err != nil {
+		return nil, "", err
+	}
+
+	authors := make([]string, 0, len(suggestion.Authors))
+	for _, author := range suggestion.Authors {
+		authors = append(authors, normalizeTitle(author))
+	}
+
+	for _, book := range books {
+		if normalizeTitle(book.Title) != title {
+			continue
+		}
+
+		if len(authors) == 0 || slices.ContainsFunc(book.Authors, func(author string) bool {
+			return slices.Contains(authors, normalizeTitle(author))
+		}) {
+			return &book, "body.title", nil
+		}
+	}
+
+	return nil, "", nil
+}
+
+// createSuggestionHandler records a title which a patron suggests the library to acquire, unless
+// the book is already in the catalog.
+func (app *Application) createSuggestionHandler(ctx context.Context, input *CreateSuggestionInput) (*CreateSuggestionOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	patron, ok := patronFromContext(ctx)
+	if !ok {
+		return &CreateSuggestionOutput{}, huma.Error403Forbidden(errSuggestionPatronOnlyMsg)
+	}
+
+	suggestion := &data.Suggestion{
+		PatronID: patron.ID,
+		Title:    input.Body.Title,
+		Authors:  input.Body.Authors,
+		ISBN:     input.Body.ISBN,
+		Note:     input.Body.Note,
+		Status:   data.SuggestionStatusPending,
+	}
+
+	book, location, err := app.catalogDuplicate(ctx, suggestion)
+	if err != nil {
+		return &CreateSuggestionOutput{}, app.serverError(ctx, err)
+	}
+	if book != nil {
+		return &CreateSuggestionOutput{}, huma.Error409Conflict(errSuggestionInCatalogMsg, &huma.ErrorDetail{
+			Location: location,
+			Message:  fmt.Sprintf("Book %s is in the catalog", book.ID),
+			Value:    book.Title,
+		})
+	}
+
+	id, err := app.Models.Suggestions.Insert(ctx, suggestion)
+	if err != nil {
+		return &CreateSuggestionOutput{}, app.serverError(ctx, err)
+	}
+	suggestion.ID = id
+
+	resp := &CreateSuggestionOutput{
+		Body:     *suggestion,
+		Location: fmt.Sprintf("%s/%s/%s", basePath, suggestionsKey, id),
+	}
+
+	return resp, nil
+}
+
+// getSuggestionHandler fetches a suggestion by its ID.
+func (app *Application) getSuggestionHandler(ctx context.Context, input *GetSuggestionInput) (*SuggestionOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	suggestion, err := app.Models.Suggestions.Get(ctx, data.SuggestionFilter{ID: &input.ID})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return &SuggestionOutput{}, huma.Error404NotFound(errNotFoundMsg)
+		default:
+			return &SuggestionOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	resp := &SuggestionOutput{
+		Body: *suggestion,
+	}
+
+	return resp, nil
+}
+
+// getSuggestionsHandler fetches suggestions with pagination, filtering and sorting, by default
+// from the earliest, in which order admins triage them.
+func (app *Application) getSuggestionsHandler(ctx context.Context, input *GetSuggestionsInput) (*GetSuggestionsOutput, error) {
+	filter := data.SuggestionFilter{}
+	if input.Status != "" {
+		filter.Status = &input.Status
+	}
+	if input.PatronID != "" {
+		filter.PatronID = &input.PatronID
+	}
+
+	return app.getSuggestions(ctx, filter, input.PaginationInput, input.Sort)
+}
+
+// getMySuggestionsHandler fetches the suggestions of the authenticated patron, by default from the latest.
+func (app *Application) getMySuggestionsHandler(ctx context.Context, input *GetMySuggestionsInput) (*GetSuggestionsOutput, error) {
+	patron, ok := patronFromContext(ctx)
+	if !ok {
+		return &GetSuggestionsOutput{}, huma.Error403Forbidden(errSuggestionPatronOnlyMsg)
+	}
+
+	filter := data.SuggestionFilter{PatronID: &patron.ID}
+	if input.Status != "" {
+		filter.Status = &input.Status
+	}
+
+	return app.getSuggestions(ctx, filter, input.PaginationInput, input.Sort)
+}
+
+// getSuggestions fetches the suggestions matching filter with pagination and sorting.
+func (app *Application) getSuggestions(ctx context.Context, filter data.SuggestionFilter, pagination PaginationInput, sort string) (*GetSuggestionsOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	paginator := data.Paginator{Page: pagination.Page, PageSize: pagination.PageSize}
+	sorter := data.Sorter{Field: sort, SortSafelist: supportedSuggestionsSortFields, Collation: app.collation}
+
+	suggestions, metadata, err := app.Models.Suggestions.GetAll(ctx, filter, paginator, sorter)
+	if err != nil {
+		return &GetSuggestionsOutput{}, app.serverError(ctx, err)
+	}
+
+	resp := &GetSuggestionsOutput{
+		Body: SuggestionsInfo{
+			Suggestions: suggestions,
+			Metadata:    metadata,
+		},
+	}
+
+	return resp, nil
+}
+
+// acceptSuggestionHandler accepts a suggestion, which the library intends to acquire.
+func (app *Application) acceptSuggestionHandler(ctx context.Context, input *DecideSuggestionInput) (*SuggestionOutput, error) {
+	return app.decideSuggestion(ctx, input, data.SuggestionStatusAccepted)
+}
+
+// rejectSuggestionHandler rejects a suggestion, which the library will not acquire.
+func (app *Application) rejectSuggestionHandler(ctx context.Context, input *DecideSuggestionInput) (*SuggestionOutput, error) {
+	return app.decideSuggestion(ctx, input, data.SuggestionStatusRejected)
+}
+
+// orderSuggestionHandler marks a suggestion as ordered, once its copies were ordered from a vendor.
+func (app *Application) orderSuggestionHandler(ctx context.Context, input *DecideSuggestionInput) (*SuggestionOutput, error) {
+	return app.decideSuggestion(ctx, input, data.SuggestionStatusOrdered)
+}
+
+// decideSuggestion moves a suggestion to a status, with the response of the admin who decided it.
+// A suggestion which is ordered without being accepted first is accepted by the same admin.
+func (app *Application) decideSuggestion(ctx context.Context, input *DecideSuggestionInput, status string) (*SuggestionOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	admin, ok := adminFromContext(ctx)
+	if !ok {
+		return &SuggestionOutput{}, app.serverError(ctx, errors.New("no admin in the context of an admin request"))
+	}
+
+	suggestion, err := app.Models.Suggestions.Get(ctx, data.SuggestionFilter{ID: &input.ID})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return &SuggestionOutput{}, huma.Error404NotFound(errNotFoundMsg)
+		default:
+			return &SuggestionOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	if !slices.Contains(suggestionTransitions[suggestion.Status], status) {
+		return &SuggestionOutput{}, huma.Error422UnprocessableEntity(fmt.Sprintf(errSuggestionStatusMsg, suggestion.Status, status))
+	}
+
+	now := time.Now()
+	if status == data.SuggestionStatusOrdered {
+		suggestion.OrderedAt = now
+	}
+	if suggestion.Status == data.SuggestionStatusPending {
+		suggestion.DecidedBy, suggestion.DecidedAt = admin.Name, now
+	}
+	if input.Body != nil && input.Body.Response != "" {
+		suggestion.Response = input.Body.Response
+	}
+	suggestion.Status = status
+
+	if err = app.Models.Suggestions.Update(ctx, data.SuggestionFilter{ID: &suggestion.ID}, suggestion); err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			return &SuggestionOutput{}, huma.Error409Conflict(errConflictMsg)
+		default:
+			return &SuggestionOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	resp := &SuggestionOutput{
+		Body: *suggestion,
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,136 @@
+package api_test
+
+import (
+	"github.com/mzeevi/library/internal/api"
+	"github.com/mzeevi/library/internal/api/apitest"
+	"github.com/mzeevi/library/internal/auth"
+	"github.com/mzeevi/library/internal/data"
+	"net/http"
+	"testing"
+)
+
+func TestCreateSuggestion(t *testing.T) {
+	a := apitest.New(t)
+	patronID := a.SeedPatron(apitest.Patron("reader@example.com", auth.ReadBooksPermission, auth.ReadPatronPermission))
+	patron := a.PatronAuth(patronID)
+	a.SeedBook(apitest.Book("9780306406157", 1))
+
+	tests := []struct {
+		name       string
+		body       map[string]any
+		wantStatus int
+	}{
+		{name: "new title", body: map[string]any{"title": "The Left Hand of Darkness", "authors": []string{"Ursula K. Le Guin"}, "isbn": "0-441-47812-3"}, wantStatus: http.StatusOK},
+		{name: "isbn in the catalog", body: map[string]any{"title": "Another Title", "isbn": "0-306-40615-2"}, wantStatus: http.StatusConflict},
+		{name: "title in the catalog", body: map[string]any{"title": "test book!"}, wantStatus: http.StatusConflict},
+		{name: "title by an author in the catalog", body: map[string]any{"title": "Test Book", "authors": []string{"test author"}}, wantStatus: http.StatusConflict},
+		{name: "title by another author", body: map[string]any{"title": "Test Book", "authors": []string{"Someone Else"}}, wantStatus: http.StatusOK},
+		{name: "invalid isbn", body: map[string]any{"title": "Unknown", "isbn": "1234"}, wantStatus: http.StatusUnprocessableEntity},
+		{name: "empty title", body: map[string]any{"title": "  "}, wantStatus: http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := a.Do(http.MethodPost, "/suggestions", patron, tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %v; want %v (body: %s)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+		})
+	}
+
+	rec := a.Do(http.MethodGet, "/patrons/me/suggestions", patron)
+	var info api.SuggestionsInfo
+	a.Decode(rec, &info)
+	if len(info.Suggestions) != 2 {
+		t.Fatalf("suggestions of the patron = %d; want 2", len(info.Suggestions))
+	}
+	for _, suggestion := range info.Suggestions {
+		if suggestion.PatronID != patronID || suggestion.Status != data.SuggestionStatusPending {
+			t.Errorf("suggestion = %+v; want a pending suggestion of the patron", suggestion)
+		}
+		if suggestion.Title == "The Left Hand of Darkness" && suggestion.ISBN != "9780441478125" {
+			t.Errorf("ISBN = %q; want the ISBN-13 9780441478125", suggestion.ISBN)
+		}
+	}
+
+	a.SeedAdmin("admin", "admin-password")
+	if rec = a.Do(http.MethodPost, "/suggestions", apitest.AdminAuth("admin", "admin-password"), map[string]any{"title": "By an admin"}); rec.Code != http.StatusForbidden {
+		t.Errorf("suggestion by an admin status = %v; want %v", rec.Code, http.StatusForbidden)
+	}
+}
+
+func TestDecideSuggestion(t *testing.T) {
+	a := apitest.New(t)
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+	patron := a.PatronAuth(a.SeedPatron(apitest.Patron("reader@example.com", auth.ReadBooksPermission)))
+
+	suggest := func(title string) string {
+		t.Helper()
+
+		rec := a.Do(http.MethodPost, "/suggestions", patron, map[string]any{"title": title})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("create suggestion status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+		}
+
+		var suggestion data.Suggestion
+		a.Decode(rec, &suggestion)
+
+		return suggestion.ID
+	}
+
+	accepted, rejected := suggest("Accepted"), suggest("Rejected")
+
+	tests := []struct {
+		name       string
+		id         string
+		action     string
+		body       []any
+		wantStatus int
+		want       string
+	}{
+		{name: "accept", id: accepted, action: "accept", wantStatus: http.StatusOK, want: data.SuggestionStatusAccepted},
+		{name: "accept again", id: accepted, action: "accept", wantStatus: http.StatusUnprocessableEntity},
+		{name: "order accepted", id: accepted, action: "order", wantStatus: http.StatusOK, want: data.SuggestionStatusOrdered},
+		{name: "reject ordered", id: accepted, action: "reject", wantStatus: http.StatusUnprocessableEntity},
+		{name: "reject", id: rejected, action: "reject", body: []any{map[string]any{"response": "Out of print"}}, wantStatus: http.StatusOK, want: data.SuggestionStatusRejected},
+		{name: "order rejected", id: rejected, action: "order", wantStatus: http.StatusUnprocessableEntity},
+		{name: "not found", id: "000000000000000000000000", action: "accept", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := a.Do(http.MethodPost, "/suggestions/"+tt.id+"/"+tt.action, append([]any{admin}, tt.body...)...)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %v; want %v (body: %s)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.want == "" {
+				return
+			}
+
+			var suggestion data.Suggestion
+			a.Decode(rec, &suggestion)
+			if suggestion.Status != tt.want || suggestion.DecidedBy != "admin" || suggestion.DecidedAt.IsZero() {
+				t.Errorf("suggestion = %+v; want it %s by admin", suggestion, tt.want)
+			}
+		})
+	}
+
+	rec := a.Do(http.MethodGet, "/suggestions/"+rejected, admin)
+	var suggestion data.Suggestion
+	a.Decode(rec, &suggestion)
+	if suggestion.Response != "Out of print" {
+		t.Errorf("response = %q; want Out of print", suggestion.Response)
+	}
+
+	rec = a.Do(http.MethodGet, "/suggestions?status=ordered", admin)
+	var info api.SuggestionsInfo
+	a.Decode(rec, &info)
+	if len(info.Suggestions) != 1 || info.Suggestions[0].ID != accepted || info.Suggestions[0].OrderedAt.IsZero() {
+		t.Errorf("ordered suggestions = %+v; want the ordered suggestion", info.Suggestions)
+	}
+
+	if rec = a.Do(http.MethodPost, "/suggestions/"+rejected+"/accept", patron); rec.Code != http.StatusForbidden {
+		t.Errorf("accept by a patron status = %v; want %v", rec.Code, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"cmp"
+	"fmt"
+	"github.com/danielgtaylor/huma/v2"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	errUnknownTermMsg     = "Term must be a year and a configured term, such as 2024-fall or 2024-fiscal"
+	errTermWithDatesMsg   = "Term cannot be combined with dates"
+	fiscalTerm            = "fiscal"
+	defaultFiscalYearDate = "01-01"
+)
+
+// monthDay is a day of the year, which is formatted as MM-DD.
+type monthDay struct {
+	month time.Month
+	day   int
+}
+
+// reportTerm is a reporting window which recurs every year, from start to end. A term which ends
+// on an earlier day of the year than it starts, such as a fall term which ends in January, ends in
+// the year after it starts, and a term without an end, such as the fiscal year, ends the day before
+// it starts again.
+type reportTerm struct {
+	start monthDay
+	end   monthDay
+}
+
+// parseMonthDay parses a day of the year formatted as MM-DD. February 29 is rejected, since it is
+// not a day of every year.
+func parseMonthDay(s string) (monthDay, error) {
+	t, err := time.Parse("01-02", s)
+	if err != nil || (t.Month() == time.February && t.Day() == 29) {
+		return monthDay{}, fmt.Errorf("invalid day %q, it must be formatted as MM-DD", s)
+	}
+
+	return monthDay{month: t.Month(), day: t.Day()}, nil
+}
+
+// before reports whether m is an earlier day of the year than other.
+func (m monthDay) before(other monthDay) bool {
+	return m.month < other.month || (m.month == other.month && m.day < other.day)
+}
+
+// window returns the first and the last moment of the term which starts in year, in loc.
+func (r reportTerm) window(year int, loc *time.Location) (time.Time, time.Time) {
+	start := time.Date(year, r.start.month, r.start.day, 0, 0, 0, 0, loc)
+	if r.end == (monthDay{}) {
+		return start, endOfDay(start.AddDate(1, 0, 0).AddDate(0, 0, -1))
+	}
+
+	endYear := year
+	if r.end.before(r.start) {
+		endYear++
+	}
+
+	return start, endOfDay(time.Date(endYear, r.end.month, r.end.day, 0, 0, 0, 0, loc))
+}
+
+// setupReportTerms parses the reporting terms, such as fall=09-01/01-31, and the fiscal year,
+// which is the fiscal term from its first day to the day before it a year later.
+func (app *Application) setupReportTerms() error {
+	cfg := app.Config.Reports
+
+	fiscalStart, err := parseMonthDay(cmp.Or(cfg.FiscalYearStart, defaultFiscalYearDate))
+	if err != nil {
+		return fmt.Errorf("invalid fiscal year start: %v", err)
+	}
+	app.reportTerms = map[string]reportTerm{
+		fiscalTerm: {start: fiscalStart},
+	}
+
+	for name, days := range cfg.Terms {
+		if name == fiscalTerm || name == "" || strings.Contains(name, "-") {
+			return fmt.Errorf("invalid term name %q", name)
+		}
+
+		from, to, found := strings.Cut(days, "/")
+		if !found {
+			return fmt.Errorf("invalid term %s %q, it must be formatted as MM-DD/MM-DD", name, days)
+		}
+
+		var term reportTerm
+		if term.start, err = parseMonthDay(from); err != nil {
+			return fmt.Errorf("invalid start of term %s: %v", name, err)
+		}
+		if term.end, err = parseMonthDay(to); err != nil {
+			return fmt.Errorf("invalid end of term %s: %v", name, err)
+		}
+		app.reportTerms[name] = term
+	}
+
+	return nil
+}
+
+// termWindow resolves a term such as 2024-fall to the first and the last moment of the term which
+// starts in that year, in the timezone of the library. It returns a 422 error if the term is not
+// configured.
+func (app *Application) termWindow(term, location string) (time.Time, time.Time, error) {
+	year, name, _ := strings.Cut(term, "-")
+
+	n, err := strconv.Atoi(year)
+	t, ok := app.reportTerms[name]
+	if err != nil || len(year) != 4 || !ok {
+		return time.Time{}, time.Time{}, huma.Error422UnprocessableEntity("validation failed", &huma.ErrorDetail{
+			Location: location,
+			Message:  errUnknownTermMsg,
+			Value:    term,
+		})
+	}
+
+	start, end := t.window(n, app.location)
+
+	return start, end, nil
+}
@@ -50,22 +50,28 @@ func (app *Application) createAuthTokenHandler(ctx context.Context, input *Creat
 		case errors.Is(err, data.ErrDocumentNotFound):
 			return &CreateAuthTokenOutput{}, huma.Error404NotFound(errNotFoundMsg)
 		default:
-			return &CreateAuthTokenOutput{}, err
+			return &CreateAuthTokenOutput{}, app.serverError(ctx, err)
 		}
 	}
 
 	match, err := patron.Password.Matches(input.Body.Password)
 	if err != nil {
-		return &CreateAuthTokenOutput{}, err
+		return &CreateAuthTokenOutput{}, app.serverError(ctx, err)
 	}
 
 	if !match {
 		return &CreateAuthTokenOutput{}, huma.Error401Unauthorized(errInvalidAuthenticationCreds)
 	}
 
-	jwtBytes, err := auth.CreateJWT(patron.ID, app.Config.JTW.Secret, app.Config.JTW.Issuer, app.Config.JTW.Audience)
+	if patron.Suspended {
+		return &CreateAuthTokenOutput{}, huma.Error403Forbidden(errSuspendedAccountMsg)
+	}
+
+	app.rehashPatronPassword(ctx, patron, input.Body.Password)
+
+	jwtBytes, err := auth.CreateJWT(patron.ID, app.jwtSecret.Value(), app.Config.JTW.Issuer, app.Config.JTW.Audience)
 	if err != nil {
-		return &CreateAuthTokenOutput{}, err
+		return &CreateAuthTokenOutput{}, app.serverError(ctx, err)
 	}
 
 	resp := &CreateAuthTokenOutput{
@@ -1,18 +1,21 @@
 package api
 
 import (
+	"cmp"
 	"context"
 	"errors"
 	"fmt"
-	"go.mongodb.org/mongo-driver/mongo"
 	"time"
 
 	"github.com/danielgtaylor/huma/v2"
 	"github.com/mzeevi/library/internal/data"
+	"github.com/mzeevi/library/internal/mailer"
+	"github.com/mzeevi/library/internal/receipt"
+	"github.com/mzeevi/library/internal/timezone"
 )
 
 type GetTransactionInput struct {
-	ID string `json:"id" path:"id"`
+	ID data.TransactionID `json:"id" path:"id"`
 }
 
 type GetTransactionOutput struct {
@@ -21,7 +24,8 @@ type GetTransactionOutput struct {
 
 type GetTransactionsInput struct {
 	PaginationInput
-	Sort string `json:"sort,omitempty" query:"sort" enum:"patronID,bookID,status,borrowed_at,due_date,returned_at,-patronID,-bookID,-status,-borrowed_at,-due_date,-returned_at"`
+	IDs  []string `json:"ids,omitempty" query:"ids" maxItems:"100" doc:"Only the transactions with these IDs, such as to resolve the references in a list in one request"`
+	Sort string   `json:"sort,omitempty" query:"sort" enum:"patronID,bookID,status,borrowed_at,due_date,returned_at,-patronID,-bookID,-status,-borrowed_at,-due_date,-returned_at"`
 }
 
 type GetTransactionsOutput struct {
@@ -34,20 +38,25 @@ type TransactionsInfo struct {
 }
 
 type BorrowBookTransactionInput struct {
+	ReceiptInput
 	Body struct {
-		PatronID string    `json:"patron_id"`
-		BookID   string    `json:"book_id"`
-		DueDate  time.Time `json:"due_date" format:"date-time"`
-		Copies   int       `json:"copies" minimum:"1" default:"1"`
+		PatronID string     `json:"patron_id"`
+		BookID   string     `json:"book_id"`
+		DueDate  *time.Time `json:"due_date,omitempty" format:"date-time" required:"false" doc:"Due date of the loan, which overrides the loan period of the category of the patron"`
+		Copies   int        `json:"copies" minimum:"1" default:"1"`
 	}
 }
 
 type BorrowBookTransactionOutput struct {
-	Location string           `header:"Location"`
-	Body     data.Transaction `json:"transaction"`
+	Location           string `header:"Location"`
+	ContentType        string `header:"Content-Type"`
+	ContentDisposition string `header:"Content-Disposition"`
+	// Body is the data.Transaction, or its PDF receipt if it is requested.
+	Body any
 }
 
 type ReturnBookTransactionInput struct {
+	ReceiptInput
 	Body struct {
 		PatronID string `json:"patron_id"`
 		BookID   string `json:"book_id"`
@@ -56,11 +65,14 @@ type ReturnBookTransactionInput struct {
 }
 
 type ReturnBookTransactionOutput struct {
-	Body string `json:"message"`
+	ContentType        string `header:"Content-Type"`
+	ContentDisposition string `header:"Content-Disposition"`
+	// Body is a message, or the PDF receipt of the returned transaction if it is requested.
+	Body any
 }
 
 type UpdateTransactionInput struct {
-	ID   string `json:"id" path:"id"`
+	ID   data.TransactionID `json:"id" path:"id"`
 	Body struct {
 		DueDate *time.Time `json:"due_date" format:"date-time"`
 	}
@@ -70,14 +82,50 @@ type UpdateTransactionOutput struct {
 	Body data.Transaction `json:"transaction"`
 }
 
+type RemindTransactionInput struct {
+	ID data.TransactionID `json:"id" path:"id"`
+}
+
+type RemindTransactionOutput struct {
+	Body data.Notification `json:"notification"`
+}
+
+type ForceReturnTransactionInput struct {
+	ID   data.TransactionID `json:"id" path:"id"`
+	Body struct {
+		Reason    string `json:"reason" maxLength:"500" doc:"Why the Transaction is corrected, which is recorded in the audit log"`
+		WaiveFine bool   `json:"waive_fine,omitempty" required:"false" doc:"Waive the overdue fine of the Transaction"`
+	}
+}
+
+type ForceReturnTransactionOutput struct {
+	Body data.Transaction `json:"transaction"`
+}
+
+type CancelTransactionInput struct {
+	ID   data.TransactionID `json:"id" path:"id"`
+	Body struct {
+		Reason string `json:"reason" maxLength:"500" doc:"Why the Transaction is corrected, which is recorded in the audit log"`
+	}
+}
+
+type CancelTransactionOutput struct {
+	Body data.Transaction `json:"transaction"`
+}
+
 type DeleteTransactionInput struct {
-	ID string `json:"id" path:"id"`
+	ID data.TransactionID `json:"id" path:"id"`
 }
 
 type DeleteTransactionOutput struct {
 	Body string `json:"message"`
 }
 
+// Resolve validates the input in GetTransactionsInput.
+func (b *GetTransactionsInput) Resolve(ctx huma.Context) []error {
+	return validateIDs(b.IDs, "query.ids")
+}
+
 // Resolve validates the input in ReturnBookTransactionInput.
 func (t *ReturnBookTransactionInput) Resolve(ctx huma.Context) []error {
 	var errs []error
@@ -109,7 +157,14 @@ func (t *BorrowBookTransactionInput) Resolve(ctx huma.Context) []error {
 		errs = append(errs, err)
 	}
 
-	err = validateDueDate(&t.Body.DueDate, "body.dueDate")
+	return errs
+}
+
+// Resolve validates the input in UpdateTransactionInput.
+func (t *UpdateTransactionInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	err := validateDueDate(t.Body.DueDate, time.Now(), timezone.FromContext(ctx.Context()), defaultLoanPeriodDays, "body.dueDate")
 	if err != nil {
 		errs = append(errs, err)
 	}
@@ -117,11 +172,57 @@ func (t *BorrowBookTransactionInput) Resolve(ctx huma.Context) []error {
 	return errs
 }
 
-// Resolve validates the input in UpdateTransactionInput.
-func (t *UpdateTransactionInput) Resolve(ctx huma.Context) []error {
+// Resolve validates the input in RemindTransactionInput.
+func (t *RemindTransactionInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	err := validateID(&t.ID, "path.ID")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// Resolve validates the input in ForceReturnTransactionInput.
+func (t *ForceReturnTransactionInput) Resolve(ctx huma.Context) []error {
 	var errs []error
 
-	err := validateDueDate(t.Body.DueDate, "body.dueDate")
+	err := validateID(&t.ID, "path.ID")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	err = validateReason(&t.Body.Reason, "body.reason")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// Resolve validates the input in CancelTransactionInput.
+func (t *CancelTransactionInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	err := validateID(&t.ID, "path.ID")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	err = validateReason(&t.Body.Reason, "body.reason")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// Resolve validates the input in GetTransactionInput.
+func (t *GetTransactionInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	err := validateID(&t.ID, "path.id")
 	if err != nil {
 		errs = append(errs, err)
 	}
@@ -152,7 +253,7 @@ func (app *Application) getTransactionHandler(ctx context.Context, input *GetTra
 		case errors.Is(err, data.ErrDocumentNotFound):
 			return &GetTransactionOutput{}, huma.Error404NotFound(errNotFoundMsg)
 		default:
-			return &GetTransactionOutput{}, err
+			return &GetTransactionOutput{}, app.serverError(ctx, err)
 		}
 	}
 
@@ -164,17 +265,18 @@ func (app *Application) getTransactionHandler(ctx context.Context, input *GetTra
 
 // getTransactionsHandler handles a request to fetch all transactions with pagination and sorting.
 func (app *Application) getTransactionsHandler(ctx context.Context, input *GetTransactionsInput) (*GetTransactionsOutput, error) {
-	paginator := data.Paginator{Page: input.Page, PageSize: input.PageSize}
-	filter := data.TransactionFilter{}
+	// A batch of IDs is returned in one page.
+	paginator := data.Paginator{Page: input.Page, PageSize: max(input.PageSize, int64(len(input.IDs)))}
+	filter := data.TransactionFilter{IDs: typedIDs[data.TransactionID](input.IDs)}
 
-	sorter := data.Sorter{Field: input.Sort, SortSafelist: supportedTransactionsSortFields}
+	sorter := data.Sorter{Field: input.Sort, SortSafelist: supportedTransactionsSortFields, Collation: app.collation}
 
 	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
 	defer cancel()
 
 	transactions, metadata, err := app.Models.Transactions.GetAll(ctx, filter, paginator, sorter)
 	if err != nil {
-		return &GetTransactionsOutput{}, err
+		return &GetTransactionsOutput{}, app.serverError(ctx, err)
 	}
 
 	resp := &GetTransactionsOutput{
@@ -187,151 +289,301 @@ func (app *Application) getTransactionsHandler(ctx context.Context, input *GetTr
 	return resp, nil
 }
 
-func (app *Application) borrowBookTransactionHandler(ctx context.Context, input *BorrowBookTransactionInput) (*BorrowBookTransactionOutput, error) {
-	dbClient := app.Models.Transactions.Client
+const (
+	// defaultLoanPeriodDays is the loan period of books borrowed by patrons whose category is not
+	// found.
+	defaultLoanPeriodDays = 14
+)
 
-	session, err := dbClient.StartSession()
-	if err != nil {
-		return &BorrowBookTransactionOutput{}, err
-	}
-	defer session.EndSession(context.Background())
+// borrowRequest is a request to borrow copies of a book. The loan is due at the end of the loan
+// period of the category of the patron if DueDate is zero, and DueDate must be within that period
+// otherwise.
+type borrowRequest struct {
+	PatronID   string
+	BookID     string
+	DueDate    time.Time
+	Copies     int
+	BorrowedAt time.Time
+	Branch     string
+}
 
-	sessionContext := mongo.NewSessionContext(ctx, session)
-	if err = session.StartTransaction(); err != nil {
-		return &BorrowBookTransactionOutput{}, err
-	}
+// returnRequest is a request to return copies of a borrowed book.
+type returnRequest struct {
+	PatronID   string
+	BookID     string
+	Copies     int
+	ReturnedAt time.Time
+}
 
-	book, err := app.Models.Books.Get(sessionContext, data.BookFilter{ID: &input.Body.BookID})
+// borrowBook lends copies of a book to a patron and records the transaction. It should be called
+// within a database transaction, and returns huma errors for requests which cannot be applied.
+func (app *Application) borrowBook(ctx context.Context, req borrowRequest) (*data.Transaction, error) {
+	book, err := app.Models.Books.Get(ctx, data.BookFilter{ID: ptr(data.BookID(req.BookID))})
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrDocumentNotFound):
 			return nil, huma.Error404NotFound("the requested book resource could not be found")
 		default:
-			return &BorrowBookTransactionOutput{}, err
+			return nil, err
+		}
+	}
+
+	digital := book.Format == data.FormatEbook
+	if digital {
+		if req.Copies > 1 {
+			return nil, huma.Error422UnprocessableEntity(errEbookCopiesMsg)
+		}
+
+		// The license seats of loans which expired since the last scheduled return are released first.
+		returned, err := app.returnExpiredEbooks(ctx, ptr(data.BookID(book.ID)), req.BorrowedAt)
+		if err != nil {
+			return nil, err
+		}
+		if returned > 0 {
+			if book, err = app.Models.Books.Get(ctx, data.BookFilter{ID: ptr(data.BookID(req.BookID))}); err != nil {
+				return nil, err
+			}
 		}
 	}
 
-	patron, err := app.Models.Patrons.Get(sessionContext, data.PatronFilter{ID: &input.Body.PatronID})
+	patron, err := app.Models.Patrons.Get(ctx, data.PatronFilter{ID: ptr(data.PatronID(req.PatronID))})
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrDocumentNotFound):
-			return &BorrowBookTransactionOutput{}, huma.Error404NotFound("the requested patron resource could not be found")
+			return nil, huma.Error404NotFound("the requested patron resource could not be found")
 		default:
-			return &BorrowBookTransactionOutput{}, err
+			return nil, err
 		}
 	}
 
-	if isBookUnavailable(book, input.Body.Copies) {
+	if isBookUnavailable(book, req.Copies) {
 		return nil, huma.Error409Conflict("not enough copies of the book are available for borrowing")
 	}
 
-	transaction := &data.Transaction{
-		PatronID:   patron.ID,
-		BookID:     book.ID,
-		DueDate:    input.Body.DueDate,
-		Status:     data.TransactionStatusBorrowed,
-		BorrowedAt: time.Now(),
+	category, err := app.patronCategory(ctx, patron)
+	if err != nil {
+		return nil, err
 	}
 
-	id, err := app.Models.Transactions.Insert(sessionContext, transaction)
-	if err != nil {
-		return &BorrowBookTransactionOutput{}, err
+	if limit := category.LoanPolicy.MaxBorrowedBooks; limit > 0 {
+		borrowed, err := app.borrowedCopies(ctx, patron.ID)
+		if err != nil {
+			return nil, err
+		}
+		if borrowed+req.Copies > limit {
+			return nil, huma.Error409Conflict(fmt.Sprintf("patrons of the %s category may borrow at most %d books at a time", category.Name, limit))
+		}
+	}
+
+	days := category.LoanPolicy.LoanPeriodDays
+	if req.DueDate.IsZero() {
+		req.DueDate = timezone.StartOfDay(req.BorrowedAt, app.location).AddDate(0, 0, days)
+	} else if err = validateDueDate(&req.DueDate, req.BorrowedAt, app.location, days, "body.dueDate"); err != nil {
+		return nil, huma.Error422UnprocessableEntity("validation failed", err)
 	}
 
-	book.BorrowedCopies = book.BorrowedCopies + input.Body.Copies
-	err = app.Models.Books.Update(sessionContext, data.BookFilter{ID: &book.ID}, book)
+	transaction := &data.Transaction{
+		PatronID:     patron.ID,
+		BookID:       book.ID,
+		DueDate:      req.DueDate,
+		Status:       data.TransactionStatusBorrowed,
+		BorrowedAt:   req.BorrowedAt,
+		Branch:       req.Branch,
+		Copies:       req.Copies,
+		Digital:      digital,
+		FineDiscount: category.DiscountPercentage,
+	}
+
+	transaction.ID, err = app.Models.Transactions.Insert(ctx, transaction)
 	if err != nil {
-		return &BorrowBookTransactionOutput{}, err
+		return nil, err
 	}
 
-	if err = session.CommitTransaction(ctx); err != nil {
-		return &BorrowBookTransactionOutput{}, err
+	book.BorrowedCopies = book.BorrowedCopies + req.Copies
+	if err = app.Models.Books.Update(ctx, data.BookFilter{ID: ptr(data.BookID(book.ID))}, book); err != nil {
+		return nil, err
 	}
 
-	resp := &BorrowBookTransactionOutput{
-		Body:     *transaction,
-		Location: fmt.Sprintf("%s/%s/%s", basePath, transactionsKey, id),
+	if err = app.recordEvent(ctx, data.EventBookBorrowed, transactionEvent{Transaction: *transaction, Copies: req.Copies}); err != nil {
+		return nil, err
 	}
 
-	return resp, nil
+	return transaction, nil
 }
 
-func (app *Application) returnBookTransactionHandler(ctx context.Context, input *ReturnBookTransactionInput) (*ReturnBookTransactionOutput, error) {
-	dbClient := app.Models.Transactions.Client
+// patronCategory returns the category of a patron, whose loan policy and discount apply to their
+// loans. Patrons whose category is not found, such as guests, borrow for defaultLoanPeriodDays,
+// without a limit on the number of books and without a discount.
+func (app *Application) patronCategory(ctx context.Context, patron *data.Patron) (*data.Category, error) {
+	category, err := app.Models.Categories.Get(ctx, data.CategoryFilter{Name: &patron.Category})
+	switch {
+	case err == nil:
+		return category, nil
+	case errors.Is(err, data.ErrDocumentNotFound):
+		return &data.Category{Name: patron.Category, LoanPolicy: data.LoanPolicy{LoanPeriodDays: defaultLoanPeriodDays}}, nil
+	default:
+		return nil, err
+	}
+}
 
-	session, err := dbClient.StartSession()
+// borrowedCopies returns the number of copies of books which a patron has borrowed and not returned.
+// Transactions which were recorded before copies were counted are of one copy.
+func (app *Application) borrowedCopies(ctx context.Context, patronID string) (int, error) {
+	transactions, _, err := app.Models.Transactions.GetAll(ctx, data.TransactionFilter{
+		PatronID: ptr(data.PatronID(patronID)),
+		Status:   ptr(data.TransactionStatusBorrowed),
+	}, data.Paginator{}, data.Sorter{})
 	if err != nil {
-		return &ReturnBookTransactionOutput{}, err
+		return 0, err
 	}
-	defer session.EndSession(context.Background())
 
-	sessionContext := mongo.NewSessionContext(ctx, session)
-	if err = session.StartTransaction(); err != nil {
-		return &ReturnBookTransactionOutput{}, err
+	copies := 0
+	for _, transaction := range transactions {
+		copies += max(transaction.Copies, 1)
 	}
 
-	book, err := app.Models.Books.Get(sessionContext, data.BookFilter{ID: &input.Body.BookID})
+	return copies, nil
+}
+
+// returnBook returns copies of a book which a patron borrowed and closes the transaction. It should
+// be called within a database transaction, and returns huma errors for requests which cannot be applied.
+func (app *Application) returnBook(ctx context.Context, req returnRequest) (*data.Book, *data.Transaction, error) {
+	book, err := app.Models.Books.Get(ctx, data.BookFilter{ID: ptr(data.BookID(req.BookID))})
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrDocumentNotFound):
-			return nil, huma.Error404NotFound("the requested book resource could not be found")
+			return nil, nil, huma.Error404NotFound("the requested book resource could not be found")
 		default:
-			return &ReturnBookTransactionOutput{}, err
+			return nil, nil, err
 		}
 	}
 
-	patron, err := app.Models.Patrons.Get(sessionContext, data.PatronFilter{ID: &input.Body.PatronID})
+	patron, err := app.Models.Patrons.Get(ctx, data.PatronFilter{ID: ptr(data.PatronID(req.PatronID))})
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrDocumentNotFound):
-			return &ReturnBookTransactionOutput{}, huma.Error404NotFound("the requested patron resource could not be found")
+			return nil, nil, huma.Error404NotFound("the requested patron resource could not be found")
 		default:
-			return &ReturnBookTransactionOutput{}, err
+			return nil, nil, err
 		}
 	}
 
-	transaction, err := app.Models.Transactions.Get(sessionContext, data.TransactionFilter{
+	transaction, err := app.Models.Transactions.Get(ctx, data.TransactionFilter{
 		Status:   ptr(data.TransactionStatusBorrowed),
-		BookID:   &book.ID,
-		PatronID: &patron.ID,
+		BookID:   ptr(data.BookID(book.ID)),
+		PatronID: ptr(data.PatronID(patron.ID)),
 	})
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrDocumentNotFound):
-			return &ReturnBookTransactionOutput{}, huma.Error404NotFound("the requested transaction resource could not be found")
+			return nil, nil, huma.Error404NotFound("the requested transaction resource could not be found")
 		default:
-			return &ReturnBookTransactionOutput{}, err
+			return nil, nil, err
 		}
 	}
 
-	transaction.ReturnedAt = time.Now()
+	if transaction.Digital {
+		return nil, nil, huma.Error422UnprocessableEntity(errEbookReturnMsg)
+	}
+
+	transaction.ReturnedAt = req.ReturnedAt
 	transaction.Status = data.TransactionStatusReturned
 
-	if err = app.Models.Transactions.Update(sessionContext, data.TransactionFilter{ID: &transaction.ID}, transaction); err != nil {
-		return &ReturnBookTransactionOutput{}, err
+	if err = app.Models.Transactions.Update(ctx, data.TransactionFilter{ID: ptr(data.TransactionID(transaction.ID))}, transaction); err != nil {
+		return nil, nil, err
+	}
+
+	book.BorrowedCopies = book.BorrowedCopies - req.Copies
+	book.RecordLoan(transaction.BorrowedAt, transaction.ReturnedAt)
+	if err = app.Models.Books.Update(ctx, data.BookFilter{ID: ptr(data.BookID(book.ID))}, book); err != nil {
+		return nil, nil, err
+	}
+
+	if err = app.recordEvent(ctx, data.EventBookReturned, transactionEvent{Transaction: *transaction, Copies: req.Copies}); err != nil {
+		return nil, nil, err
+	}
+
+	return book, transaction, nil
+}
+
+func (app *Application) borrowBookTransactionHandler(ctx context.Context, input *BorrowBookTransactionInput) (*BorrowBookTransactionOutput, error) {
+	var transaction *data.Transaction
+
+	var dueDate time.Time
+	if input.Body.DueDate != nil {
+		dueDate = *input.Body.DueDate
 	}
 
-	book.BorrowedCopies = book.BorrowedCopies - input.Body.Copies
-	err = app.Models.Books.Update(sessionContext, data.BookFilter{ID: &book.ID}, book)
+	err := app.Models.Transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+
+		transaction, err = app.borrowBook(ctx, borrowRequest{
+			PatronID:   input.Body.PatronID,
+			BookID:     input.Body.BookID,
+			DueDate:    dueDate,
+			Copies:     input.Body.Copies,
+			BorrowedAt: time.Now(),
+		})
+
+		return err
+	})
 	if err != nil {
-		return &ReturnBookTransactionOutput{}, err
+		return &BorrowBookTransactionOutput{}, app.transactionError(ctx, err)
+	}
+
+	resp := &BorrowBookTransactionOutput{
+		Body:     *transaction,
+		Location: fmt.Sprintf("%s/%s/%s", basePath, transactionsKey, transaction.ID),
 	}
 
-	if err = session.CommitTransaction(ctx); err != nil {
-		return &ReturnBookTransactionOutput{}, err
+	if input.receiptRequested() {
+		resp.ContentType = receipt.ContentType
+		if resp.Body, resp.ContentDisposition, err = app.writeReceipt(ctx, transaction, input.Body.Copies); err != nil {
+			return &BorrowBookTransactionOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	return resp, nil
+}
+
+func (app *Application) returnBookTransactionHandler(ctx context.Context, input *ReturnBookTransactionInput) (*ReturnBookTransactionOutput, error) {
+	var book *data.Book
+	var transaction *data.Transaction
+
+	err := app.Models.Transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+
+		book, transaction, err = app.returnBook(ctx, returnRequest{
+			PatronID:   input.Body.PatronID,
+			BookID:     input.Body.BookID,
+			Copies:     input.Body.Copies,
+			ReturnedAt: time.Now(),
+		})
+
+		return err
+	})
+	if err != nil {
+		return &ReturnBookTransactionOutput{}, app.transactionError(ctx, err)
 	}
 
 	var message string
 	if input.Body.Copies > 1 {
-		message = fmt.Sprintf("successfully returned %v copies of book with ISBN %v (id: %v)", input.Body.Copies, book.ISBN, book.ID)
+		message = fmt.Sprintf("successfully returned %v copies of book with ISBN %v (id: %v)", input.Body.Copies, book.ISBN(), book.ID)
 	} else {
-		message = fmt.Sprintf("successfully returned %v copy of book with ISBN %v (id: %v)", input.Body.Copies, book.ISBN, book.ID)
+		message = fmt.Sprintf("successfully returned %v copy of book with ISBN %v (id: %v)", input.Body.Copies, book.ISBN(), book.ID)
 	}
 
 	resp := &ReturnBookTransactionOutput{
 		Body: message,
 	}
 
+	if input.receiptRequested() {
+		resp.ContentType = receipt.ContentType
+		if resp.Body, resp.ContentDisposition, err = app.writeReceipt(ctx, transaction, input.Body.Copies); err != nil {
+			return &ReturnBookTransactionOutput{}, app.serverError(ctx, err)
+		}
+	}
+
 	return resp, nil
 }
 
@@ -346,7 +598,7 @@ func (app *Application) updateTransactionHandler(ctx context.Context, input *Upd
 		case errors.Is(err, data.ErrDocumentNotFound):
 			return nil, huma.Error404NotFound(errNotFoundMsg)
 		default:
-			return &UpdateTransactionOutput{}, err
+			return &UpdateTransactionOutput{}, app.serverError(ctx, err)
 		}
 	}
 
@@ -376,7 +628,7 @@ func (app *Application) deleteTransactionHandler(ctx context.Context, input *Del
 		case errors.Is(err, data.ErrDocumentNotFound):
 			return nil, huma.Error404NotFound(errNotFoundMsg)
 		default:
-			return &DeleteTransactionOutput{}, err
+			return &DeleteTransactionOutput{}, app.serverError(ctx, err)
 		}
 	}
 
@@ -386,3 +638,205 @@ func (app *Application) deleteTransactionHandler(ctx context.Context, input *Del
 
 	return resp, nil
 }
+
+// remindTransactionHandler handles a request to remind the patron of a borrowed book that it is due soon,
+// or that it is overdue, over the notification channel of the patron. The notification is returned with
+// its delivery status.
+func (app *Application) remindTransactionHandler(ctx context.Context, input *RemindTransactionInput) (*RemindTransactionOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	transaction, err := app.Models.Transactions.Get(ctx, data.TransactionFilter{ID: &input.ID})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return &RemindTransactionOutput{}, huma.Error404NotFound(errNotFoundMsg)
+		default:
+			return &RemindTransactionOutput{}, app.serverError(ctx, err)
+		}
+	}
+
+	if transaction.Status != data.TransactionStatusBorrowed {
+		return &RemindTransactionOutput{}, huma.Error422UnprocessableEntity(fmt.Sprintf("A reminder cannot be sent because the transaction status is %s", transaction.Status))
+	}
+
+	patron, err := app.Models.Patrons.Get(ctx, data.PatronFilter{ID: ptr(data.PatronID(transaction.PatronID))})
+	if err != nil {
+		return &RemindTransactionOutput{}, app.serverError(ctx, err)
+	}
+
+	book, err := app.Models.Books.Get(ctx, data.BookFilter{ID: ptr(data.BookID(transaction.BookID))})
+	if err != nil {
+		return &RemindTransactionOutput{}, app.serverError(ctx, err)
+	}
+
+	now := time.Now()
+	loanData := mailer.LoanData{
+		Name:    patron.Name,
+		Title:   book.Title,
+		DueDate: transaction.DueDate.In(app.location),
+	}
+
+	template := mailer.DueSoonTemplate
+	if daysOverdue := timezone.DaysBetween(transaction.DueDate, now, app.location); daysOverdue > 0 {
+		template = mailer.OverdueTemplate
+		loanData.DaysOverdue = daysOverdue
+		loanData.Fine = calculateFine(*transaction, app.cost.overdueFine, now, app.location)
+	}
+
+	notification, err := app.notifyPatron(ctx, patron, template, loanData)
+	if err != nil {
+		return &RemindTransactionOutput{}, app.serverError(ctx, err)
+	}
+
+	resp := &RemindTransactionOutput{
+		Body: *notification,
+	}
+
+	return resp, nil
+}
+
+// releaseCopies puts the copies of a borrowed transaction back on the shelf, and returns how many
+// were released. The loan of a transaction which was returned is counted in the circulation of the book. Transactions which were recorded before their copies were stored released one
+// copy, and nothing is released for books which were deleted since.
+func (app *Application) releaseCopies(ctx context.Context, transaction *data.Transaction) (int, error) {
+	copies := cmp.Or(transaction.Copies, 1)
+
+	book, err := app.Models.Books.Get(ctx, data.BookFilter{ID: ptr(data.BookID(transaction.BookID))})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDocumentNotFound):
+			return 0, nil
+		default:
+			return 0, err
+		}
+	}
+
+	book.BorrowedCopies = max(book.BorrowedCopies-copies, 0)
+	if transaction.Status == data.TransactionStatusReturned {
+		book.RecordLoan(transaction.BorrowedAt, transaction.ReturnedAt)
+	}
+	if err = app.Models.Books.Update(ctx, data.BookFilter{ID: ptr(data.BookID(book.ID))}, book); err != nil {
+		return 0, err
+	}
+
+	return copies, nil
+}
+
+// forceReturnTransactionHandler handles a request to mark a borrowed transaction as returned without
+// the patron returning the book at the desk, such as when it was returned elsewhere, optionally
+// waiving its fine. The correction is recorded in the audit log.
+func (app *Application) forceReturnTransactionHandler(ctx context.Context, input *ForceReturnTransactionInput) (*ForceReturnTransactionOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	var transaction *data.Transaction
+
+	err := app.Models.Transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+
+		transaction, err = app.Models.Transactions.Get(ctx, data.TransactionFilter{ID: &input.ID})
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrDocumentNotFound):
+				return huma.Error404NotFound(errNotFoundMsg)
+			default:
+				return err
+			}
+		}
+
+		if transaction.Status != data.TransactionStatusBorrowed {
+			return huma.Error422UnprocessableEntity(fmt.Sprintf("The transaction cannot be force-returned because its status is %s", transaction.Status))
+		}
+
+		now := time.Now()
+		fine := calculateFine(*transaction, app.cost.overdueFine, now, app.location)
+
+		transaction.ReturnedAt = now
+		transaction.Status = data.TransactionStatusReturned
+		transaction.FineWaived = input.Body.WaiveFine
+
+		if err = app.Models.Transactions.Update(ctx, data.TransactionFilter{ID: ptr(data.TransactionID(transaction.ID))}, transaction); err != nil {
+			return err
+		}
+
+		copies, err := app.releaseCopies(ctx, transaction)
+		if err != nil {
+			return err
+		}
+
+		return app.audit(ctx, data.AuditTransactionForceReturned, transaction.ID, "", input.Body.Reason, map[string]any{
+			"patron_id":   transaction.PatronID,
+			"book_id":     transaction.BookID,
+			"copies":      copies,
+			"fine":        fine,
+			"fine_waived": transaction.FineWaived,
+		})
+	})
+	if err != nil {
+		return &ForceReturnTransactionOutput{}, app.transactionError(ctx, err)
+	}
+
+	resp := &ForceReturnTransactionOutput{
+		Body: *transaction,
+	}
+
+	return resp, nil
+}
+
+// cancelTransactionHandler handles a request to cancel a transaction which should not have been
+// recorded, such as a borrow which was scanned twice. The copies of a borrowed transaction are
+// released, and a canceled transaction is never fined. The correction is recorded in the audit log.
+func (app *Application) cancelTransactionHandler(ctx context.Context, input *CancelTransactionInput) (*CancelTransactionOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	var transaction *data.Transaction
+
+	err := app.Models.Transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+
+		transaction, err = app.Models.Transactions.Get(ctx, data.TransactionFilter{ID: &input.ID})
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrDocumentNotFound):
+				return huma.Error404NotFound(errNotFoundMsg)
+			default:
+				return err
+			}
+		}
+
+		if transaction.Status == data.TransactionStatusCanceled {
+			return huma.Error422UnprocessableEntity("The transaction is already canceled")
+		}
+
+		var copies int
+		previousStatus := transaction.Status
+		if previousStatus == data.TransactionStatusBorrowed {
+			if copies, err = app.releaseCopies(ctx, transaction); err != nil {
+				return err
+			}
+		}
+
+		transaction.Status = data.TransactionStatusCanceled
+		if err = app.Models.Transactions.Update(ctx, data.TransactionFilter{ID: ptr(data.TransactionID(transaction.ID))}, transaction); err != nil {
+			return err
+		}
+
+		return app.audit(ctx, data.AuditTransactionCanceled, transaction.ID, "", input.Body.Reason, map[string]any{
+			"patron_id":       transaction.PatronID,
+			"book_id":         transaction.BookID,
+			"previous_status": previousStatus,
+			"copies":          copies,
+		})
+	})
+	if err != nil {
+		return &CancelTransactionOutput{}, app.transactionError(ctx, err)
+	}
+
+	resp := &CancelTransactionOutput{
+		Body: *transaction,
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,368 @@
+package api_test
+
+import (
+	"context"
+	"github.com/mzeevi/library/internal/api"
+	"github.com/mzeevi/library/internal/api/apitest"
+	"github.com/mzeevi/library/internal/auth"
+	"github.com/mzeevi/library/internal/data"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBorrowAndReturnBook(t *testing.T) {
+	a := apitest.New(t)
+
+	bookID := a.SeedBook(apitest.Book("9780306406157", 1))
+	patronID := a.SeedPatron(apitest.Patron("patron@example.com", auth.BorrowBookPermission, auth.ReturnBookPermission))
+	patron := a.PatronAuth(patronID)
+
+	borrow := map[string]any{
+		"patron_id": patronID,
+		"book_id":   bookID,
+		"due_date":  time.Now().Add(14 * 24 * time.Hour),
+		"copies":    1,
+	}
+
+	if rec := a.Do(http.MethodPost, "/transactions/borrow", patron, borrow); rec.Code != http.StatusOK {
+		t.Fatalf("borrow status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	book, err := a.Models.Books.Get(context.Background(), data.BookFilter{ID: apitest.Ptr(data.BookID(bookID))})
+	if err != nil {
+		t.Fatalf("Books.Get() error = %v", err)
+	}
+	if book.BorrowedCopies != 1 {
+		t.Errorf("BorrowedCopies after borrow = %v; want %v", book.BorrowedCopies, 1)
+	}
+
+	if rec := a.Do(http.MethodPost, "/transactions/borrow", patron, borrow); rec.Code != http.StatusConflict {
+		t.Errorf("borrow unavailable book status = %v; want %v", rec.Code, http.StatusConflict)
+	}
+
+	missing := map[string]any{
+		"patron_id": patronID,
+		"book_id":   "000000000000000000000000",
+		"due_date":  time.Now().Add(14 * 24 * time.Hour),
+		"copies":    1,
+	}
+	if rec := a.Do(http.MethodPost, "/transactions/borrow", patron, missing); rec.Code != http.StatusNotFound {
+		t.Errorf("borrow missing book status = %v; want %v", rec.Code, http.StatusNotFound)
+	}
+
+	giveBack := map[string]any{"patron_id": patronID, "book_id": bookID, "copies": 1}
+	if rec := a.Do(http.MethodPost, "/transactions/return", patron, giveBack); rec.Code != http.StatusOK {
+		t.Fatalf("return status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	book, err = a.Models.Books.Get(context.Background(), data.BookFilter{ID: apitest.Ptr(data.BookID(bookID))})
+	if err != nil {
+		t.Fatalf("Books.Get() error = %v", err)
+	}
+	if book.BorrowedCopies != 0 {
+		t.Errorf("BorrowedCopies after return = %v; want %v", book.BorrowedCopies, 0)
+	}
+	if book.Circulation.Borrows != 1 || book.Circulation.LastBorrowedAt.IsZero() {
+		t.Errorf("Circulation after return = %+v; want one borrow", book.Circulation)
+	}
+
+	if rec := a.Do(http.MethodPost, "/transactions/return", patron, giveBack); rec.Code != http.StatusNotFound {
+		t.Errorf("return twice status = %v; want %v", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestBorrowDefaultDueDate(t *testing.T) {
+	a := apitest.New(t)
+
+	// Loans are due at the end of the loan period of the category of the patron, which is 28 days
+	// for teachers and 14 days for students.
+	teacher := apitest.Patron("teacher@example.com", auth.BorrowBookPermission)
+	teacher.Category = data.TeacherCategory
+	teacherID := a.SeedPatron(teacher)
+	studentID := a.SeedPatron(apitest.Patron("student@example.com", auth.BorrowBookPermission))
+
+	tests := []struct {
+		name     string
+		patronID string
+		days     int
+	}{
+		{name: "teacher", patronID: teacherID, days: 28},
+		{name: "student", patronID: studentID, days: 14},
+	}
+
+	for i, tt := range tests {
+		bookID := a.SeedBook(apitest.Book([]string{"9780306406157", "9781861972712"}[i], 1))
+
+		now := time.Now()
+		rec := a.Do(http.MethodPost, "/transactions/borrow", a.PatronAuth(tt.patronID), map[string]any{"patron_id": tt.patronID, "book_id": bookID, "copies": 1})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s borrow without a due date status = %v; want %v (body: %s)", tt.name, rec.Code, http.StatusOK, rec.Body.String())
+		}
+
+		var transaction data.Transaction
+		a.Decode(rec, &transaction)
+		// The loan is due at the start of the day at the end of the loan period.
+		if !transaction.DueDate.After(now.AddDate(0, 0, tt.days-1)) || transaction.DueDate.After(now.AddDate(0, 0, tt.days)) {
+			t.Errorf("%s due date = %v; want the start of the day %d days from %v", tt.name, transaction.DueDate, tt.days, now)
+		}
+	}
+
+	// Due dates which are given are validated against the loan period of the category of the
+	// patron, so teachers may borrow for longer than 14 days, but not longer than 28 days.
+	overrides := []struct {
+		name     string
+		patronID string
+		days     int
+		want     int
+	}{
+		{name: "teacher in 20 days", patronID: teacherID, days: 20, want: http.StatusOK},
+		{name: "teacher in 30 days", patronID: teacherID, days: 30, want: http.StatusUnprocessableEntity},
+		{name: "student in 20 days", patronID: studentID, days: 20, want: http.StatusUnprocessableEntity},
+	}
+
+	for i, tt := range overrides {
+		bookID := a.SeedBook(apitest.Book([]string{"9780262033848", "9780140449136", "9780131103627"}[i], 1))
+		borrow := map[string]any{"patron_id": tt.patronID, "book_id": bookID, "due_date": time.Now().AddDate(0, 0, tt.days), "copies": 1}
+		if rec := a.Do(http.MethodPost, "/transactions/borrow", a.PatronAuth(tt.patronID), borrow); rec.Code != tt.want {
+			t.Errorf("borrow by %s status = %v; want %v (body: %s)", tt.name, rec.Code, tt.want, rec.Body.String())
+		}
+	}
+}
+
+func TestTransactionInvalidID(t *testing.T) {
+	a := apitest.New(t)
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+
+	for _, path := range []string{"/transactions/not-an-id", "/transactions/not-an-id/receipt"} {
+		if rec := a.Do(http.MethodGet, path, admin); rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("GET %s status = %v; want %v (body: %s)", path, rec.Code, http.StatusUnprocessableEntity, rec.Body.String())
+		}
+	}
+}
+
+func TestRemindTransaction(t *testing.T) {
+	a := apitest.New(t)
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+
+	bookID := a.SeedBook(apitest.Book("9780306406157", 3))
+	patron := apitest.Patron("patron@example.com")
+	patron.Phone = "+972501234567"
+	patron.NotificationChannel = "sms"
+	patronID := a.SeedPatron(patron)
+
+	now := time.Now()
+	transactions := map[string]*data.Transaction{
+		"due":      data.NewTransaction("", patronID, bookID, data.TransactionStatusBorrowed, now.Add(-24*time.Hour), now.Add(2*24*time.Hour)),
+		"overdue":  data.NewTransaction("", patronID, bookID, data.TransactionStatusBorrowed, now.Add(-20*24*time.Hour), now.Add(-3*24*time.Hour)),
+		"returned": data.NewTransaction("", patronID, bookID, data.TransactionStatusReturned, now.Add(-20*24*time.Hour), now.Add(-6*24*time.Hour)),
+	}
+	ids := make(map[string]string)
+	for name, transaction := range transactions {
+		id, err := a.Models.Transactions.Insert(context.Background(), transaction)
+		if err != nil {
+			t.Fatalf("failed to seed transaction: %v", err)
+		}
+		ids[name] = id
+	}
+
+	tests := []struct {
+		transaction  string
+		want         int
+		wantTemplate string
+	}{
+		{transaction: "due", want: http.StatusOK, wantTemplate: "due_soon"},
+		{transaction: "overdue", want: http.StatusOK, wantTemplate: "overdue"},
+		{transaction: "returned", want: http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		rec := a.Do(http.MethodPost, "/transactions/"+ids[tt.transaction]+"/remind", admin)
+		if rec.Code != tt.want {
+			t.Errorf("remind %s status = %v; want %v (body: %s)", tt.transaction, rec.Code, tt.want, rec.Body.String())
+			continue
+		}
+		if tt.want != http.StatusOK {
+			continue
+		}
+
+		var body struct {
+			Channel  string `json:"channel"`
+			Template string `json:"template"`
+		}
+		a.Decode(rec, &body)
+		if body.Channel != "sms" || body.Template != tt.wantTemplate {
+			t.Errorf("remind %s = %+v; want sms with %s", tt.transaction, body, tt.wantTemplate)
+		}
+	}
+
+	if rec := a.Do(http.MethodPost, "/transactions/000000000000000000000000/remind", admin); rec.Code != http.StatusNotFound {
+		t.Errorf("remind missing transaction status = %v; want %v", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestTransactionReceipts(t *testing.T) {
+	a := apitest.New(t)
+
+	bookID := a.SeedBook(apitest.Book("9780306406157", 2))
+	patronID := a.SeedPatron(apitest.Patron("patron@example.com", auth.BorrowBookPermission, auth.ReturnBookPermission, auth.ReadTransactionsPermission))
+	patron := a.PatronAuth(patronID)
+
+	borrow := map[string]any{
+		"patron_id": patronID,
+		"book_id":   bookID,
+		"due_date":  time.Now().Add(14 * 24 * time.Hour),
+		"copies":    2,
+	}
+
+	rec := a.Do(http.MethodPost, "/transactions/borrow", patron, "Accept: application/pdf", borrow)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("borrow status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/pdf" {
+		t.Errorf("borrow Content-Type = %q; want %q", got, "application/pdf")
+	}
+	if !strings.HasPrefix(rec.Body.String(), "%PDF-") {
+		t.Errorf("borrow body is not a PDF")
+	}
+
+	location := rec.Header().Get("Location")
+	id := location[strings.LastIndex(location, "/")+1:]
+
+	rec = a.Do(http.MethodGet, "/transactions/"+id+"/receipt", patron)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("receipt status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if !strings.HasPrefix(rec.Body.String(), "%PDF-") {
+		t.Errorf("receipt body is not a PDF")
+	}
+	if got, want := rec.Header().Get("Content-Disposition"), `inline; filename=receipt-borrow-`+id+`.pdf`; got != want {
+		t.Errorf("receipt Content-Disposition = %q; want %q", got, want)
+	}
+
+	giveBack := map[string]any{"patron_id": patronID, "book_id": bookID, "copies": 2}
+	rec = a.Do(http.MethodPost, "/transactions/return", patron, "Accept: application/pdf", giveBack)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("return status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if got, want := rec.Header().Get("Content-Disposition"), `inline; filename=receipt-return-`+id+`.pdf`; got != want {
+		t.Errorf("return Content-Disposition = %q; want %q", got, want)
+	}
+
+	if rec := a.Do(http.MethodGet, "/transactions/000000000000000000000000/receipt", patron); rec.Code != http.StatusNotFound {
+		t.Errorf("missing receipt status = %v; want %v", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestCorrectTransaction(t *testing.T) {
+	a := apitest.New(t, func(app *api.Application) {
+		app.Config.Cost.OverdueFine = 2
+	})
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+
+	book := apitest.Book("9780306406157", 4)
+	book.BorrowedCopies = 3
+	bookID := a.SeedBook(book)
+	patronID := a.SeedPatron(apitest.Patron("patron@example.com", auth.ReadTransactionsPermission))
+
+	now := time.Now()
+	overdue := data.NewTransaction("", patronID, bookID, data.TransactionStatusBorrowed, now.Add(-20*24*time.Hour), now.Add(-3*24*time.Hour))
+	overdue.Copies = 2
+	transactions := map[string]*data.Transaction{
+		"overdue":  overdue,
+		"legacy":   data.NewTransaction("", patronID, bookID, data.TransactionStatusBorrowed, now.Add(-24*time.Hour), now.Add(13*24*time.Hour)),
+		"returned": data.NewTransaction("", patronID, bookID, data.TransactionStatusReturned, now.Add(-20*24*time.Hour), now.Add(-6*24*time.Hour)),
+	}
+	ids := make(map[string]string)
+	for name, transaction := range transactions {
+		id, err := a.Models.Transactions.Insert(context.Background(), transaction)
+		if err != nil {
+			t.Fatalf("failed to seed transaction: %v", err)
+		}
+		ids[name] = id
+	}
+
+	borrowedCopies := func() int {
+		t.Helper()
+		book, err := a.Models.Books.Get(context.Background(), data.BookFilter{ID: apitest.Ptr(data.BookID(bookID))})
+		if err != nil {
+			t.Fatalf("Books.Get() error = %v", err)
+		}
+		return book.BorrowedCopies
+	}
+
+	reason := map[string]any{"reason": "returned at another branch", "waive_fine": true}
+	if rec := a.Do(http.MethodPost, "/transactions/"+ids["overdue"]+"/force-return", a.PatronAuth(patronID), reason); rec.Code != http.StatusForbidden {
+		t.Errorf("force-return by patron status = %v; want %v", rec.Code, http.StatusForbidden)
+	}
+	if rec := a.Do(http.MethodPost, "/transactions/"+ids["overdue"]+"/force-return", admin, map[string]any{"reason": "  "}); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("force-return without reason status = %v; want %v", rec.Code, http.StatusUnprocessableEntity)
+	}
+
+	rec := a.Do(http.MethodPost, "/transactions/"+ids["overdue"]+"/force-return", admin, reason)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("force-return status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var returned data.Transaction
+	a.Decode(rec, &returned)
+	if returned.Status != data.TransactionStatusReturned || !returned.FineWaived {
+		t.Errorf("force-returned transaction = %+v; want returned with a waived fine", returned)
+	}
+	if got := borrowedCopies(); got != 1 {
+		t.Errorf("BorrowedCopies after force-return = %v; want %v", got, 1)
+	}
+
+	if rec := a.Do(http.MethodPost, "/transactions/"+ids["returned"]+"/force-return", admin, reason); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("force-return returned transaction status = %v; want %v", rec.Code, http.StatusUnprocessableEntity)
+	}
+
+	cancel := map[string]any{"reason": "scanned twice"}
+	if rec := a.Do(http.MethodPost, "/transactions/"+ids["legacy"]+"/cancel", admin, cancel); rec.Code != http.StatusOK {
+		t.Fatalf("cancel status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	if got := borrowedCopies(); got != 0 {
+		t.Errorf("BorrowedCopies after cancel = %v; want %v", got, 0)
+	}
+	if rec := a.Do(http.MethodPost, "/transactions/"+ids["legacy"]+"/cancel", admin, cancel); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("cancel twice status = %v; want %v", rec.Code, http.StatusUnprocessableEntity)
+	}
+	if rec := a.Do(http.MethodPost, "/transactions/"+ids["returned"]+"/cancel", admin, cancel); rec.Code != http.StatusOK {
+		t.Errorf("cancel returned transaction status = %v; want %v", rec.Code, http.StatusOK)
+	}
+	if got := borrowedCopies(); got != 0 {
+		t.Errorf("BorrowedCopies after canceling a returned transaction = %v; want %v", got, 0)
+	}
+	if rec := a.Do(http.MethodPost, "/transactions/000000000000000000000000/cancel", admin, cancel); rec.Code != http.StatusNotFound {
+		t.Errorf("cancel missing transaction status = %v; want %v", rec.Code, http.StatusNotFound)
+	}
+
+	rec = a.Do(http.MethodGet, "/audit?sort=created_at", admin)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("get audit log status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+	var log struct {
+		Entries []data.AuditEntry `json:"entries"`
+	}
+	a.Decode(rec, &log)
+	want := []struct{ action, targetID, reason string }{
+		{data.AuditTransactionForceReturned, ids["overdue"], "returned at another branch"},
+		{data.AuditTransactionCanceled, ids["legacy"], "scanned twice"},
+		{data.AuditTransactionCanceled, ids["returned"], "scanned twice"},
+	}
+	if len(log.Entries) != len(want) {
+		t.Fatalf("audit log has %d entries; want %d", len(log.Entries), len(want))
+	}
+	for i, w := range want {
+		entry := log.Entries[i]
+		if entry.Action != w.action || entry.TargetID != w.targetID || entry.Reason != w.reason || entry.Actor != "admin" {
+			t.Errorf("audit entry %d = %+v; want %s of %s by admin because %q", i, entry, w.action, w.targetID, w.reason)
+		}
+	}
+	if fine := log.Entries[0].Details["fine"]; fine != float64(6) {
+		t.Errorf("force-return audit fine = %v; want %v", fine, 6)
+	}
+}
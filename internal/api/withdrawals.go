@@ -0,0 +1,204 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/danielgtaylor/huma/v2"
+	"github.com/mzeevi/library/internal/data"
+	"strings"
+	"time"
+)
+
+const (
+	errWithdrawBorrowedCopiesMsg = "only %d copies of the book are on the shelf, borrowed copies must be returned before they are withdrawn"
+)
+
+type WithdrawCopiesInput struct {
+	ID   data.BookID `json:"id" path:"id" doc:"ID of the Book whose copies are withdrawn"`
+	Body struct {
+		Copies int    `json:"copies" minimum:"1" doc:"Number of copies on the shelf which are withdrawn"`
+		Reason string `json:"reason" enum:"damaged,lost,outdated"`
+		Note   string `json:"note,omitempty" required:"false" maxLength:"500"`
+	}
+}
+
+type WithdrawCopiesOutput struct {
+	Body WithdrawnCopies
+}
+
+// WithdrawnCopies is a Withdrawal with the Book after its copies were withdrawn.
+type WithdrawnCopies struct {
+	Withdrawal data.Withdrawal `json:"withdrawal"`
+	Book       data.Book       `json:"book"`
+}
+
+type GetWithdrawalsInput struct {
+	PaginationInput
+	BookID string    `query:"book_id" doc:"Filter by book"`
+	Reason string    `query:"reason" enum:"damaged,lost,outdated" doc:"Filter by reason"`
+	From   time.Time `query:"from" doc:"Filter by copies withdrawn at or after this time"`
+	To     time.Time `query:"to" doc:"Filter by copies withdrawn at or before this time"`
+	Sort   string    `query:"sort" enum:"withdrawn_at,copies,-withdrawn_at,-copies" default:"-withdrawn_at"`
+}
+
+type GetWithdrawalsOutput struct {
+	Body WithdrawalsInfo
+}
+
+type WithdrawalsInfo struct {
+	Withdrawals []data.Withdrawal `json:"withdrawals"`
+	Copies      int               `json:"copies"`
+	Metadata    data.Metadata     `json:"metadata"`
+}
+
+// Resolve validates the input in WithdrawCopiesInput.
+func (w *WithdrawCopiesInput) Resolve(ctx huma.Context) []error {
+	w.Body.Note = strings.TrimSpace(w.Body.Note)
+
+	if err := validateID(&w.ID, "path.id"); err != nil {
+		return []error{err}
+	}
+
+	return nil
+}
+
+// Resolve validates the input in GetWithdrawalsInput.
+func (w *GetWithdrawalsInput) Resolve(ctx huma.Context) []error {
+	var errs []error
+
+	if w.BookID != "" {
+		if err := validateID(&w.BookID, "query.book_id"); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if err := validateRange(optional(w.From), optional(w.To), "from", "to"); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errs
+}
+
+// withdrawCopiesHandler handles a request to retire copies of a book from the stock. The copies
+// are removed from the copies of the book, so that they cannot be borrowed, and the withdrawal is
+// recorded with the admin who made it. The book is kept even if all of its copies are withdrawn.
+func (app *Application) withdrawCopiesHandler(ctx context.Context, input *WithdrawCopiesInput) (*WithdrawCopiesOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	admin, ok := adminFromContext(ctx)
+	if !ok {
+		return &WithdrawCopiesOutput{}, app.serverError(ctx, errors.New("no admin in the context of an admin request"))
+	}
+
+	var withdrawn WithdrawnCopies
+
+	err := app.Models.Transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		book, err := app.Models.Books.Get(ctx, data.BookFilter{ID: &input.ID})
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrDocumentNotFound):
+				return huma.Error404NotFound(errNotFoundMsg)
+			default:
+				return err
+			}
+		}
+
+		onShelf := book.Copies - book.BorrowedCopies
+		if input.Body.Copies > onShelf {
+			return huma.Error422UnprocessableEntity(fmt.Sprintf(errWithdrawBorrowedCopiesMsg, max(onShelf, 0)))
+		}
+
+		book.Copies -= input.Body.Copies
+		book.WithdrawnCopies += input.Body.Copies
+		if err = app.Models.Books.Update(ctx, data.BookFilter{ID: ptr(data.BookID(book.ID))}, book); err != nil {
+			switch {
+			case errors.Is(err, data.ErrEditConflict):
+				return huma.Error409Conflict(errConflictMsg)
+			case errors.Is(err, data.ErrDocumentNotFound):
+				return huma.Error404NotFound(errNotFoundMsg)
+			default:
+				return err
+			}
+		}
+
+		withdrawal := &data.Withdrawal{
+			BookID:      book.ID,
+			ISBN:        book.ISBN(),
+			Title:       book.Title,
+			Copies:      input.Body.Copies,
+			Reason:      input.Body.Reason,
+			Note:        input.Body.Note,
+			WithdrawnBy: admin.Name,
+			WithdrawnAt: time.Now(),
+		}
+
+		withdrawal.ID, err = app.Models.Withdrawals.Insert(ctx, withdrawal)
+		if err != nil {
+			return err
+		}
+
+		withdrawn = WithdrawnCopies{Withdrawal: *withdrawal, Book: *book}
+
+		return app.recordEvent(ctx, data.EventBookUpdated, book)
+	})
+	if err != nil {
+		return &WithdrawCopiesOutput{}, app.transactionError(ctx, err)
+	}
+
+	resp := &WithdrawCopiesOutput{
+		Body: withdrawn,
+	}
+
+	return resp, nil
+}
+
+// getWithdrawalsHandler handles a request to report the withdrawn copies with pagination,
+// filtering and sorting. The total of the copies counts all withdrawals matching the filter.
+func (app *Application) getWithdrawalsHandler(ctx context.Context, input *GetWithdrawalsInput) (*GetWithdrawalsOutput, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	filter := data.WithdrawalFilter{}
+	if !input.From.IsZero() {
+		filter.MinWithdrawnAt = &input.From
+	}
+	if !input.To.IsZero() {
+		filter.MaxWithdrawnAt = &input.To
+	}
+	if input.BookID != "" {
+		filter.BookID = &input.BookID
+	}
+	if input.Reason != "" {
+		filter.Reason = &input.Reason
+	}
+
+	paginator := data.Paginator{Page: input.Page, PageSize: input.PageSize}
+	sorter := data.Sorter{Field: input.Sort, SortSafelist: supportedWithdrawalsSortFields, Collation: app.collation}
+
+	withdrawals, metadata, err := app.Models.Withdrawals.GetAll(ctx, filter, paginator, sorter)
+	if err != nil {
+		return &GetWithdrawalsOutput{}, app.serverError(ctx, err)
+	}
+
+	all, _, err := app.Models.Withdrawals.GetAll(ctx, filter, data.Paginator{}, data.Sorter{})
+	if err != nil {
+		return &GetWithdrawalsOutput{}, app.serverError(ctx, err)
+	}
+
+	var copies int
+	for _, withdrawal := range all {
+		copies += withdrawal.Copies
+	}
+
+	resp := &GetWithdrawalsOutput{
+		Body: WithdrawalsInfo{
+			Withdrawals: withdrawals,
+			Copies:      copies,
+			Metadata:    metadata,
+		},
+	}
+
+	return resp, nil
+}
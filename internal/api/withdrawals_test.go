@@ -0,0 +1,78 @@
+package api_test
+
+import (
+	"context"
+	"github.com/mzeevi/library/internal/api"
+	"github.com/mzeevi/library/internal/api/apitest"
+	"github.com/mzeevi/library/internal/auth"
+	"github.com/mzeevi/library/internal/data"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestWithdrawCopies(t *testing.T) {
+	a := apitest.New(t)
+	a.SeedAdmin("admin", "admin-password")
+	admin := apitest.AdminAuth("admin", "admin-password")
+
+	bookID := a.SeedBook(apitest.Book("9780306406157", 3))
+	patronID := a.SeedPatron(apitest.Patron("patron@example.com", auth.BorrowBookPermission))
+
+	borrow := map[string]any{"patron_id": patronID, "book_id": bookID, "due_date": time.Now().Add(14 * 24 * time.Hour), "copies": 1}
+	if rec := a.Do(http.MethodPost, "/transactions/borrow", a.PatronAuth(patronID), borrow); rec.Code != http.StatusOK {
+		t.Fatalf("borrow status = %v; want %v (body: %s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	tests := []struct {
+		name          string
+		body          map[string]any
+		wantStatus    int
+		wantCopies    int
+		wantWithdrawn int
+	}{
+		{name: "more copies than on the shelf", body: map[string]any{"copies": 3, "reason": "damaged"}, wantStatus: http.StatusUnprocessableEntity, wantCopies: 3},
+		{name: "unknown reason", body: map[string]any{"copies": 1, "reason": "boring"}, wantStatus: http.StatusUnprocessableEntity, wantCopies: 3},
+		{name: "damaged", body: map[string]any{"copies": 1, "reason": "damaged", "note": "water damage"}, wantStatus: http.StatusOK, wantCopies: 2, wantWithdrawn: 1},
+		{name: "outdated", body: map[string]any{"copies": 1, "reason": "outdated"}, wantStatus: http.StatusOK, wantCopies: 1, wantWithdrawn: 2},
+		{name: "borrowed copy", body: map[string]any{"copies": 1, "reason": "lost"}, wantStatus: http.StatusUnprocessableEntity, wantCopies: 1, wantWithdrawn: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := a.Do(http.MethodPost, "/books/"+bookID+"/withdraw", admin, tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %v; want %v (body: %s)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+
+			book, err := a.Models.Books.Get(context.Background(), data.BookFilter{ID: apitest.Ptr(data.BookID(bookID))})
+			if err != nil {
+				t.Fatalf("Books.Get() error = %v", err)
+			}
+			if book.Copies != tt.wantCopies || book.WithdrawnCopies != tt.wantWithdrawn {
+				t.Errorf("copies = %v, withdrawn = %v; want %v, %v", book.Copies, book.WithdrawnCopies, tt.wantCopies, tt.wantWithdrawn)
+			}
+		})
+	}
+
+	if rec := a.Do(http.MethodPost, "/transactions/borrow", a.PatronAuth(patronID), borrow); rec.Code == http.StatusOK {
+		t.Errorf("borrow of a withdrawn copy status = %v; want an error", rec.Code)
+	}
+
+	rec := a.Do(http.MethodGet, "/withdrawals?book_id="+bookID, admin)
+	var info api.WithdrawalsInfo
+	a.Decode(rec, &info)
+	if len(info.Withdrawals) != 2 || info.Copies != 2 {
+		t.Fatalf("withdrawals = %+v; want 2 withdrawals of 2 copies", info)
+	}
+	if w := info.Withdrawals[1]; w.Reason != data.WithdrawalReasonDamaged || w.WithdrawnBy != "admin" || w.Note != "water damage" || w.ISBN != "9780306406157" {
+		t.Errorf("withdrawal = %+v; want the damaged copy withdrawn by admin", w)
+	}
+
+	rec = a.Do(http.MethodGet, "/withdrawals?reason=outdated&from="+url.QueryEscape(time.Now().Add(-time.Hour).Format(time.RFC3339)), admin)
+	a.Decode(rec, &info)
+	if len(info.Withdrawals) != 1 || info.Copies != 1 {
+		t.Errorf("outdated withdrawals = %+v; want 1 withdrawal of 1 copy", info)
+	}
+}
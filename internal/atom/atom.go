@@ -0,0 +1,130 @@
+// Package atom encodes Atom (RFC 4287) feeds which feed readers can subscribe to.
+package atom
+
+import (
+	"encoding/xml"
+	"io"
+	"time"
+)
+
+// ContentType is the media type of an Atom feed.
+const ContentType = "application/atom+xml; charset=utf-8"
+
+const namespace = "http://www.w3.org/2005/Atom"
+
+// Feed is a feed of entries.
+type Feed struct {
+	// ID identifies the feed permanently, such as by its URL.
+	ID    string
+	Title string
+	// Link is the URL of the feed itself.
+	Link string
+	// Author is the author of the entries which have no authors, such as the name of the library.
+	Author  string
+	Updated time.Time
+	Entries []Entry
+}
+
+// Entry is an entry of a feed.
+type Entry struct {
+	// ID identifies the entry across updates of the feed.
+	ID    string
+	Title string
+	// Link is the URL of the page of the entry.
+	Link       string
+	Authors    []string
+	Summary    string
+	Categories []string
+	Published  time.Time
+	Updated    time.Time
+}
+
+type xmlFeed struct {
+	XMLName xml.Name   `xml:"feed"`
+	Xmlns   string     `xml:"xmlns,attr"`
+	ID      string     `xml:"id"`
+	Title   string     `xml:"title"`
+	Updated string     `xml:"updated"`
+	Links   []xmlLink  `xml:"link"`
+	Author  *xmlPerson `xml:"author"`
+	Entries []xmlEntry `xml:"entry"`
+}
+
+type xmlEntry struct {
+	ID         string        `xml:"id"`
+	Title      string        `xml:"title"`
+	Updated    string        `xml:"updated"`
+	Published  string        `xml:"published,omitempty"`
+	Links      []xmlLink     `xml:"link"`
+	Authors    []xmlPerson   `xml:"author"`
+	Categories []xmlCategory `xml:"category"`
+	Summary    string        `xml:"summary,omitempty"`
+}
+
+type xmlLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type xmlPerson struct {
+	Name string `xml:"name"`
+}
+
+type xmlCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+// Encode writes the feed to w.
+func (f *Feed) Encode(w io.Writer) error {
+	feed := xmlFeed{
+		Xmlns:   namespace,
+		ID:      f.ID,
+		Title:   f.Title,
+		Updated: formatTime(f.Updated),
+	}
+	if f.Link != "" {
+		feed.Links = []xmlLink{{Rel: "self", Href: f.Link}}
+	}
+	if f.Author != "" {
+		feed.Author = &xmlPerson{Name: f.Author}
+	}
+
+	for _, entry := range f.Entries {
+		e := xmlEntry{
+			ID:      entry.ID,
+			Title:   entry.Title,
+			Updated: formatTime(entry.Updated),
+			Summary: entry.Summary,
+		}
+		if !entry.Published.IsZero() {
+			e.Published = formatTime(entry.Published)
+		}
+		if entry.Link != "" {
+			e.Links = []xmlLink{{Rel: "alternate", Href: entry.Link}}
+		}
+		for _, author := range entry.Authors {
+			e.Authors = append(e.Authors, xmlPerson{Name: author})
+		}
+		for _, category := range entry.Categories {
+			e.Categories = append(e.Categories, xmlCategory{Term: category})
+		}
+		feed.Entries = append(feed.Entries, e)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(feed); err != nil {
+		return err
+	}
+
+	return enc.Close()
+}
+
+// formatTime formats a time as an RFC 3339 timestamp in UTC.
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,59 @@
+package atom
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncode(t *testing.T) {
+	feed := &Feed{
+		ID:      "http://library.example.org/books/new-arrivals.atom",
+		Title:   "New arrivals",
+		Link:    "http://library.example.org/books/new-arrivals.atom",
+		Author:  "Library",
+		Updated: time.Date(2024, time.December, 17, 12, 30, 0, 0, time.FixedZone("UTC+2", 2*60*60)),
+		Entries: []Entry{
+			{
+				ID:         "http://library.example.org/catalog/books/1",
+				Title:      "Sapiens & <Homo Deus>",
+				Link:       "http://library.example.org/catalog/books/1",
+				Authors:    []string{"Yuval Noah Harari"},
+				Summary:    "Harper, 2015",
+				Categories: []string{"History"},
+				Published:  time.Date(2024, time.December, 16, 9, 0, 0, 0, time.UTC),
+				Updated:    time.Date(2024, time.December, 17, 9, 0, 0, 0, time.UTC),
+			},
+		},
+	}
+
+	var b strings.Builder
+	if err := feed.Encode(&b); err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	got := b.String()
+
+	for _, want := range []string{
+		xml.Header + `<feed xmlns="http://www.w3.org/2005/Atom">`,
+		"<updated>2024-12-17T10:30:00Z</updated>",
+		`<link rel="self" href="http://library.example.org/books/new-arrivals.atom"></link>`,
+		"<author>\n    <name>Library</name>\n  </author>",
+		"<title>Sapiens &amp; &lt;Homo Deus&gt;</title>",
+		"<published>2024-12-16T09:00:00Z</published>",
+		`<link rel="alternate" href="http://library.example.org/catalog/books/1"></link>`,
+		`<category term="History"></category>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Encode() = %q; want it to contain %q", got, want)
+		}
+	}
+
+	var decoded xmlFeed
+	if err := xml.Unmarshal([]byte(got), &decoded); err != nil {
+		t.Fatalf("Encode() is not valid XML: %v", err)
+	}
+	if len(decoded.Entries) != 1 || decoded.Entries[0].Title != feed.Entries[0].Title {
+		t.Errorf("decoded entries = %+v; want the entry of the feed", decoded.Entries)
+	}
+}
@@ -0,0 +1,180 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+)
+
+const (
+	Bcrypt   = "bcrypt"
+	Argon2id = "argon2id"
+)
+
+// Algorithms are the algorithms which passwords and PINs are hashed with.
+var Algorithms = []string{Bcrypt, Argon2id}
+
+const (
+	// DefaultBcryptCost is the cost of bcrypt hashes unless another is configured.
+	DefaultBcryptCost = 12
+	// DefaultArgon2idMemory, DefaultArgon2idIterations and DefaultArgon2idParallelism are the
+	// parameters of argon2id hashes unless others are configured, which are the second recommended
+	// option of RFC 9106. The memory is in KiB.
+	DefaultArgon2idMemory      = 64 * 1024
+	DefaultArgon2idIterations  = 3
+	DefaultArgon2idParallelism = 4
+
+	argon2idSaltLength = 16
+	argon2idKeyLength  = 32
+)
+
+var ErrUnknownHash = errors.New("unknown password hash algorithm")
+
+// Hasher hashes passwords and PINs. Hashes are tagged with their algorithm and parameters, so that
+// any hash is verified regardless of the Hasher which hashes new ones.
+type Hasher interface {
+	// Hash calculates the hash of a plaintext.
+	Hash(plaintext []byte) ([]byte, error)
+	// Current reports whether a hash was calculated by the Hasher with its current parameters, or
+	// should be calculated again once its plaintext is known.
+	Current(hash []byte) bool
+}
+
+// hasher hashes new passwords and PINs, which SetHasher configures.
+var hasher Hasher = BcryptHasher{Cost: DefaultBcryptCost}
+
+// SetHasher sets the Hasher of the passwords and PINs which are set from now on. Existing hashes
+// still match, and passwords are hashed again by it when NeedsRehash reports so.
+func SetHasher(h Hasher) {
+	hasher = h
+}
+
+// BcryptHasher hashes with bcrypt, whose hashes are in the modular crypt format, such as
+// $2a$12$..., as all hashes were before other algorithms were supported.
+type BcryptHasher struct {
+	Cost int
+}
+
+// NewBcryptHasher creates a BcryptHasher with a cost.
+func NewBcryptHasher(cost int) (BcryptHasher, error) {
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return BcryptHasher{}, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+
+	return BcryptHasher{Cost: cost}, nil
+}
+
+func (b BcryptHasher) Hash(plaintext []byte) ([]byte, error) {
+	return bcrypt.GenerateFromPassword(plaintext, b.Cost)
+}
+
+func (b BcryptHasher) Current(hash []byte) bool {
+	cost, err := bcrypt.Cost(hash)
+
+	return err == nil && cost == b.Cost
+}
+
+// Argon2idHasher hashes with argon2id, whose hashes are in the PHC string format, such as
+// $argon2id$v=19$m=65536,t=3,p=4$<salt>$<key>. Memory is in KiB.
+type Argon2idHasher struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+// NewArgon2idHasher creates an Argon2idHasher with its parameters.
+func NewArgon2idHasher(memory, iterations, parallelism int) (Argon2idHasher, error) {
+	switch {
+	case parallelism < 1 || parallelism > 255:
+		return Argon2idHasher{}, errors.New("argon2id parallelism must be between 1 and 255")
+	case iterations < 1 || iterations > 1<<16:
+		return Argon2idHasher{}, errors.New("argon2id iterations must be between 1 and 65536")
+	case memory < 8*parallelism || memory > 4<<20:
+		return Argon2idHasher{}, errors.New("argon2id memory must be at least 8 KiB for every degree of parallelism and at most 4 GiB")
+	}
+
+	return Argon2idHasher{Memory: uint32(memory), Iterations: uint32(iterations), Parallelism: uint8(parallelism)}, nil
+}
+
+func (a Argon2idHasher) Hash(plaintext []byte) ([]byte, error) {
+	salt := make([]byte, argon2idSaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	key := argon2.IDKey(plaintext, salt, a.Iterations, a.Memory, a.Parallelism, argon2idKeyLength)
+
+	return []byte(fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s", Argon2id, argon2.Version, a.Memory, a.Iterations, a.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))), nil
+}
+
+func (a Argon2idHasher) Current(hash []byte) bool {
+	params, _, _, err := decodeArgon2id(hash)
+
+	return err == nil && params == a
+}
+
+// decodeArgon2id decodes the parameters, the salt and the key of an argon2id hash.
+func decodeArgon2id(hash []byte) (Argon2idHasher, []byte, []byte, error) {
+	// The hash is split to "", "argon2id", the version, the parameters, the salt and the key.
+	parts := strings.Split(string(hash), "$")
+	if len(parts) != 6 || parts[1] != Argon2id {
+		return Argon2idHasher{}, nil, nil, ErrUnknownHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return Argon2idHasher{}, nil, nil, fmt.Errorf("unsupported argon2id version %q", parts[2])
+	}
+
+	var params Argon2idHasher
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return Argon2idHasher{}, nil, nil, fmt.Errorf("invalid argon2id parameters %q: %w", parts[3], err)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Argon2idHasher{}, nil, nil, fmt.Errorf("invalid argon2id salt: %w", err)
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return Argon2idHasher{}, nil, nil, fmt.Errorf("invalid argon2id key: %w", err)
+	}
+
+	return params, salt, key, nil
+}
+
+// verifyHash checks whether a plaintext matches a hash of any of the Algorithms, which is found by
+// the tag of the hash.
+func verifyHash(hash, plaintext []byte) (bool, error) {
+	switch {
+	case bytes.HasPrefix(hash, []byte("$"+Argon2id+"$")):
+		params, salt, key, err := decodeArgon2id(hash)
+		if err != nil {
+			return false, err
+		}
+
+		other := argon2.IDKey(plaintext, salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+
+		return subtle.ConstantTimeCompare(key, other) == 1, nil
+	case bytes.HasPrefix(hash, []byte("$2")):
+		err := bcrypt.CompareHashAndPassword(hash, plaintext)
+		switch {
+		case err == nil:
+			return true, nil
+		case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
+			return false, nil
+		default:
+			return false, err
+		}
+	default:
+		return false, ErrUnknownHash
+	}
+}
@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"testing"
+)
+
+func TestHashers(t *testing.T) {
+	t.Cleanup(func() { SetHasher(BcryptHasher{Cost: DefaultBcryptCost}) })
+
+	bcryptHasher := BcryptHasher{Cost: bcrypt.MinCost}
+	argon2idHasher := Argon2idHasher{Memory: 64, Iterations: 1, Parallelism: 1}
+
+	// A bcrypt hash, like all hashes before argon2id, must still match once argon2id is configured.
+	SetHasher(bcryptHasher)
+	var legacy Password
+	if err := legacy.Set("pa55word1234"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	SetHasher(argon2idHasher)
+	var password Password
+	if err := password.Set("pa55word1234"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if !strings.HasPrefix(string(password.Hash), "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Errorf("Set() hash = %s; want an argon2id hash", password.Hash)
+	}
+
+	for _, p := range []Password{legacy, password} {
+		if match, err := p.Matches("pa55word1234"); err != nil || !match {
+			t.Errorf("Matches(%s) = %v, %v; want true, nil", p.Hash, match, err)
+		}
+		if match, err := p.Matches("pa55word4321"); err != nil || match {
+			t.Errorf("Matches(%s) of another password = %v, %v; want false, nil", p.Hash, match, err)
+		}
+	}
+
+	if !legacy.NeedsRehash() {
+		t.Errorf("NeedsRehash() of a bcrypt hash with argon2id configured = false; want true")
+	}
+	if password.NeedsRehash() {
+		t.Errorf("NeedsRehash() of a current argon2id hash = true; want false")
+	}
+
+	SetHasher(Argon2idHasher{Memory: 128, Iterations: 1, Parallelism: 1})
+	if !password.NeedsRehash() {
+		t.Errorf("NeedsRehash() of an argon2id hash with other parameters = false; want true")
+	}
+
+	unknown := Password{Hash: []byte("$scrypt$ln=16,r=8,p=1$c2FsdA$a2V5")}
+	if _, err := unknown.Matches("pa55word1234"); err == nil {
+		t.Errorf("Matches() of an unknown hash error = nil; want an error")
+	}
+}
+
+func TestNewArgon2idHasher(t *testing.T) {
+	if _, err := NewArgon2idHasher(DefaultArgon2idMemory, DefaultArgon2idIterations, DefaultArgon2idParallelism); err != nil {
+		t.Errorf("NewArgon2idHasher() of the defaults error = %v", err)
+	}
+	if _, err := NewArgon2idHasher(16, 1, 4); err == nil {
+		t.Errorf("NewArgon2idHasher() with too little memory error = nil; want an error")
+	}
+	if _, err := NewBcryptHasher(bcrypt.MaxCost + 1); err == nil {
+		t.Errorf("NewBcryptHasher() with too high a cost error = nil; want an error")
+	}
+}
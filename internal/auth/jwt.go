@@ -23,3 +23,67 @@ func CreateJWT(patronID, jwtSecret, issuer, audience string) ([]byte, error) {
 
 	return jwtBytes, nil
 }
+
+// FeedAudience returns the audience of feed tokens for the audience of authentication tokens.
+// Feed tokens have their own audience so that they are not accepted as authentication tokens.
+func FeedAudience(audience string) string {
+	return audience + "/feed"
+}
+
+// CreateFeedJWT generates a JWT which only grants reading the calendar feed of a patron. It is
+// valid for ttl, since calendar apps keep polling the feed with the same URL.
+func CreateFeedJWT(patronID, jwtSecret, issuer, audience string, ttl time.Duration) ([]byte, error) {
+	var claims jwt.Claims
+
+	claims.Subject = patronID
+	claims.Issued = jwt.NewNumericTime(time.Now())
+	claims.NotBefore = jwt.NewNumericTime(time.Now())
+	claims.Expires = jwt.NewNumericTime(time.Now().Add(ttl))
+	claims.Issuer = issuer
+	claims.Audiences = []string{FeedAudience(audience)}
+
+	return claims.HMACSign(jwt.HS256, []byte(jwtSecret))
+}
+
+// KioskAudience returns the audience of the patron tokens of a kiosk for the audience of
+// authentication tokens. The audience is bound to the kiosk, so that a patron token is only
+// accepted from the kiosk which the patron logged in at.
+func KioskAudience(audience, kioskID string) string {
+	return audience + "/kiosk/" + kioskID
+}
+
+// CreateKioskJWT generates a short-lived JWT which identifies a patron who logged in at a kiosk.
+func CreateKioskJWT(patronID, kioskID, jwtSecret, issuer, audience string, ttl time.Duration) ([]byte, error) {
+	var claims jwt.Claims
+
+	claims.Subject = patronID
+	claims.Issued = jwt.NewNumericTime(time.Now())
+	claims.NotBefore = jwt.NewNumericTime(time.Now())
+	claims.Expires = jwt.NewNumericTime(time.Now().Add(ttl))
+	claims.Issuer = issuer
+	claims.Audiences = []string{KioskAudience(audience, kioskID)}
+
+	return claims.HMACSign(jwt.HS256, []byte(jwtSecret))
+}
+
+// DownloadAudience returns the audience of the download tokens of the file of a book for the
+// audience of authentication tokens. The audience is bound to the book, so that a download token
+// only grants downloading the file of the book it was issued for.
+func DownloadAudience(audience, bookID string) string {
+	return audience + "/download/" + bookID
+}
+
+// CreateDownloadJWT generates a short-lived JWT which grants a patron downloading the file of a
+// book, so that the download URL can be opened without authenticating.
+func CreateDownloadJWT(patronID, bookID, jwtSecret, issuer, audience string, ttl time.Duration) ([]byte, error) {
+	var claims jwt.Claims
+
+	claims.Subject = patronID
+	claims.Issued = jwt.NewNumericTime(time.Now())
+	claims.NotBefore = jwt.NewNumericTime(time.Now())
+	claims.Expires = jwt.NewNumericTime(time.Now().Add(ttl))
+	claims.Issuer = issuer
+	claims.Audiences = []string{DownloadAudience(audience, bookID)}
+
+	return claims.HMACSign(jwt.HS256, []byte(jwtSecret))
+}
@@ -1,19 +1,14 @@
 package auth
 
-import (
-	"errors"
-	"golang.org/x/crypto/bcrypt"
-)
-
 type Password struct {
 	Plaintext *string `bson:"plaintext" json:"plaintext"`
 	Hash      []byte  `bson:"hash" json:"-"`
 }
 
-// Set calculates the bcrypt hash of a plaintext password, and stores both
+// Set calculates the hash of a plaintext password with the configured Hasher, and stores both
 // the hash and the plaintext versions in the struct.
 func (p *Password) Set(plaintextPassword string) error {
-	hash, err := bcrypt.GenerateFromPassword([]byte(plaintextPassword), 12)
+	hash, err := hasher.Hash([]byte(plaintextPassword))
 	if err != nil {
 		return err
 	}
@@ -26,16 +21,54 @@ func (p *Password) Set(plaintextPassword string) error {
 
 // Matches checks whether the provided plaintext password matches the
 // hashed password stored in the struct, returning true if it matches and false otherwise.
+// The hash may be of any of the Algorithms, regardless of the configured Hasher.
+// A Password which was never set, such as that of a guest patron, matches no password.
 func (p *Password) Matches(plaintextPassword string) (bool, error) {
-	err := bcrypt.CompareHashAndPassword(p.Hash, []byte(plaintextPassword))
+	if len(p.Hash) == 0 {
+		return false, nil
+	}
+
+	return verifyHash(p.Hash, []byte(plaintextPassword))
+}
+
+// NeedsRehash checks whether the hash of a set Password was not calculated by the configured
+// Hasher with its current parameters, so that it should be set again from the plaintext password
+// once it matches.
+func (p *Password) NeedsRehash() bool {
+	return len(p.Hash) > 0 && !hasher.Current(p.Hash)
+}
+
+// PIN is a short numeric code which a patron uses to log in at kiosks. Unlike Password, only
+// its hash is kept. Failures counts the wrong PINs since the last correct one.
+type PIN struct {
+	Hash     []byte `bson:"hash,omitempty" json:"-"`
+	Failures int    `bson:"failures" json:"-"`
+}
+
+// Set calculates the hash of a plaintext PIN with the configured Hasher, and resets the failures.
+func (p *PIN) Set(plaintextPIN string) error {
+	hash, err := hasher.Hash([]byte(plaintextPIN))
 	if err != nil {
-		switch {
-		case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
-			return false, nil
-		default:
-			return false, err
-		}
+		return err
+	}
+
+	p.Hash = hash
+	p.Failures = 0
+
+	return nil
+}
+
+// IsSet checks whether a PIN was set.
+func (p *PIN) IsSet() bool {
+	return len(p.Hash) > 0
+}
+
+// Matches checks whether the provided plaintext PIN matches the hashed PIN, of any of the
+// Algorithms. An unset PIN matches nothing.
+func (p *PIN) Matches(plaintextPIN string) (bool, error) {
+	if !p.IsSet() {
+		return false, nil
 	}
 
-	return true, nil
+	return verifyHash(p.Hash, []byte(plaintextPIN))
 }
@@ -11,8 +11,12 @@ const (
 	WritePatronPermission       = "patron:write"
 	ReadTransactionsPermission  = "transactions:read"
 	WriteTransactionsPermission = "transactions:write"
+	LookupBookPermission        = "book:lookup"
 )
 
 var AdminPermissions = []string{WriteBooksPermission, ReadBooksPermission, BorrowBookPermission, ReturnBookPermission,
 	ReadPatronsPermission, WritePatronsPermission, ReadPatronPermission, WritePatronPermission,
 	ReadTransactionsPermission, WriteTransactionsPermission}
+
+// KioskPermissions are the permissions which a self-checkout kiosk may be granted.
+var KioskPermissions = []string{BorrowBookPermission, ReturnBookPermission, LookupBookPermission}
@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"bufio"
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultMinPasswordLength is the minimum length of passwords unless another is configured.
+const DefaultMinPasswordLength = 8
+
+var (
+	ErrPasswordTooShort = errors.New("password is too short")
+	ErrCommonPassword   = errors.New("password is too common")
+	ErrBreachedPassword = errors.New("password appeared in a data breach")
+)
+
+//go:embed common_passwords.txt
+var commonPasswordsList string
+
+// commonPasswords are the most common passwords which are long enough to pass the minimum length,
+// in lower case.
+var commonPasswords = func() map[string]bool {
+	passwords := map[string]bool{}
+	scanner := bufio.NewScanner(strings.NewReader(commonPasswordsList))
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			passwords[line] = true
+		}
+	}
+
+	return passwords
+}()
+
+// BreachChecker checks whether a password appeared in a data breach.
+type BreachChecker interface {
+	Breached(ctx context.Context, password string) (bool, error)
+}
+
+// PasswordPolicy is the rules which new passwords must follow. MinLength counts characters rather
+// than bytes. Common passwords are compared regardless of case. Breaches is nil if passwords are
+// not checked against breaches.
+type PasswordPolicy struct {
+	MinLength  int
+	DenyCommon bool
+	Breaches   BreachChecker
+}
+
+// Check returns ErrPasswordTooShort, ErrCommonPassword or ErrBreachedPassword, wrapped with a
+// description of the rule, if a password breaks the policy. The cheap rules are checked first, so
+// that the breach checker is only asked about passwords which follow them. Other errors are of the
+// breach checker, which callers may choose to ignore rather than reject every password while it
+// is unavailable.
+func (p PasswordPolicy) Check(ctx context.Context, password string) error {
+	if utf8.RuneCountInString(password) < p.MinLength {
+		return fmt.Errorf("%w: it must have at least %d characters", ErrPasswordTooShort, p.MinLength)
+	}
+
+	if p.DenyCommon && commonPasswords[strings.ToLower(password)] {
+		return fmt.Errorf("%w: it is one of the most common passwords", ErrCommonPassword)
+	}
+
+	if p.Breaches != nil {
+		breached, err := p.Breaches.Breached(ctx, password)
+		if err != nil {
+			return err
+		}
+		if breached {
+			return fmt.Errorf("%w: choose a password which was not exposed", ErrBreachedPassword)
+		}
+	}
+
+	return nil
+}
+
+// IsPolicyViolation reports whether err is a violation of a PasswordPolicy, rather than a failure
+// to check it.
+func IsPolicyViolation(err error) bool {
+	return errors.Is(err, ErrPasswordTooShort) || errors.Is(err, ErrCommonPassword) || errors.Is(err, ErrBreachedPassword)
+}
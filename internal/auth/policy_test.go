@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	// The SHA-1 hash of "correct horse" is 2F9E53523B62ABC141A2B4D6019D23CBA835DBD0, and the server
+	// returns its suffix in every range, with a padding entry.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.URL.Path) != len("/range/")+5 || r.Header.Get("Add-Padding") != "true" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, "0018A45C4D1DEF81644B54AB7F969B88D65:1\r\n3523B62ABC141A2B4D6019D23CBA835DBD0:3\r\nFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF:0\r\n")
+	}))
+	defer server.Close()
+
+	policy := PasswordPolicy{
+		MinLength:  10,
+		DenyCommon: true,
+		Breaches:   PwnedPasswords{URL: server.URL + "/range/", Client: server.Client()},
+	}
+
+	tests := []struct {
+		password string
+		want     error
+	}{
+		{password: "short", want: ErrPasswordTooShort},
+		{password: "סיסמהקצרה", want: ErrPasswordTooShort},
+		{password: "Password123", want: ErrCommonPassword},
+		{password: "correct horse", want: ErrBreachedPassword},
+		{password: "correct horse battery staple"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.password, func(t *testing.T) {
+			err := policy.Check(context.Background(), tt.password)
+			if tt.want == nil {
+				if err != nil {
+					t.Errorf("Check() error = %v; want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.want) || !IsPolicyViolation(err) {
+				t.Errorf("Check() error = %v; want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPwnedPasswordsUnavailable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	policy := PasswordPolicy{Breaches: PwnedPasswords{URL: server.URL + "/", Client: server.Client()}}
+	if err := policy.Check(context.Background(), "correct horse battery staple"); err == nil || IsPolicyViolation(err) {
+		t.Errorf("Check() error = %v; want a failure to check breaches", err)
+	}
+}
@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// DefaultPwnedPasswordsURL is the range API of Have I Been Pwned.
+const DefaultPwnedPasswordsURL = "https://api.pwnedpasswords.com/range/"
+
+// PwnedPasswords checks passwords against the breached passwords of Have I Been Pwned with
+// k-anonymity: only the first 5 characters of the SHA-1 hash of a password are sent, and the
+// suffixes of the hashes in that range are compared locally, so the password is never disclosed.
+type PwnedPasswords struct {
+	// URL is the range API, to which the prefix of a hash is appended.
+	URL    string
+	Client *http.Client
+}
+
+// Breached reports whether a password appeared in a breach.
+func (p PwnedPasswords) Breached(ctx context.Context, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.URL+prefix, nil)
+	if err != nil {
+		return false, err
+	}
+	// Padding hides the number of hashes in the range from observers of the response size.
+	req.Header.Set("Add-Padding", "true")
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to check breached passwords: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("failed to check breached passwords: status %d", resp.StatusCode)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		hashSuffix, count, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		// Padding entries have a count of 0.
+		if ok && strings.EqualFold(hashSuffix, suffix) && count != "0" {
+			return true, nil
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return false, fmt.Errorf("failed to check breached passwords: %w", err)
+	}
+
+	return false, nil
+}
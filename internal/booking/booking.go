@@ -0,0 +1,100 @@
+// Package booking computes the time slots in which resources of the library, such as study rooms
+// and laptops, can be reserved. Slots are laid out from the opening of each day in the timezone of
+// the library, so that they start at the same time of day on days on which daylight saving time
+// begins or ends.
+package booking
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Defaults of the hours and slots of reservations.
+const (
+	DefaultSlot        = 30 * time.Minute
+	DefaultMaxDuration = 4 * time.Hour
+	DefaultHorizonDays = 14
+)
+
+// DefaultHours are the hours in which resources can be reserved by default.
+var DefaultHours = Hours{Opens: 9 * time.Hour, Closes: 21 * time.Hour}
+
+var (
+	ErrInvalidTimeOfDay = errors.New("invalid time of day")
+)
+
+// Hours are the times of day, as offsets from midnight, between which resources can be reserved.
+type Hours struct {
+	Opens  time.Duration
+	Closes time.Duration
+}
+
+// Slot is a period of time from Start up to, but not including, End.
+type Slot struct {
+	Start time.Time
+	End   time.Time
+}
+
+// ParseTimeOfDay parses a time of day such as "09:30" to its offset from midnight. "24:00" is the
+// end of the day.
+func ParseTimeOfDay(s string) (time.Duration, error) {
+	if s == "24:00" {
+		return 24 * time.Hour, nil
+	}
+
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidTimeOfDay, s)
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Overlaps reports whether the slot and other share any instant.
+func (s Slot) Overlaps(other Slot) bool {
+	return s.Start.Before(other.End) && other.Start.Before(s.End)
+}
+
+// Duration returns the length of the slot.
+func (s Slot) Duration() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+// Day returns the times at which the day of t in loc opens and closes.
+func (h Hours) Day(t time.Time, loc *time.Location) (opens, closes time.Time) {
+	year, month, day := t.In(loc).Date()
+
+	opens = time.Date(year, month, day, 0, 0, int(h.Opens.Seconds()), 0, loc)
+	closes = time.Date(year, month, day, 0, 0, int(h.Closes.Seconds()), 0, loc)
+
+	return opens, closes
+}
+
+// Slots returns the consecutive slots of length between the opening and the closing of the day of
+// date in loc. A last slot which would end after the closing is not returned.
+func (h Hours) Slots(date time.Time, loc *time.Location, length time.Duration) []Slot {
+	opens, closes := h.Day(date, loc)
+
+	var slots []Slot
+	for start := opens; !start.Add(length).After(closes); start = start.Add(length) {
+		slots = append(slots, Slot{Start: start, End: start.Add(length)})
+	}
+
+	return slots
+}
+
+// Fits reports whether the slot is made of whole slots of length of the day on which it starts,
+// so that it starts and ends on their boundaries within the opening hours of that day.
+func (h Hours) Fits(s Slot, loc *time.Location, length time.Duration) bool {
+	if !s.Start.Before(s.End) {
+		return false
+	}
+
+	opens, closes := h.Day(s.Start, loc)
+	if s.Start.Before(opens) || s.End.After(closes) {
+		return false
+	}
+
+	return s.Start.Sub(opens)%length == 0 && s.Duration()%length == 0
+}
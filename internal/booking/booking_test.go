@@ -0,0 +1,123 @@
+package booking
+
+import (
+	"errors"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestParseTimeOfDay(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    time.Duration
+		wantErr bool
+	}{
+		{s: "09:00", want: 9 * time.Hour},
+		{s: "17:30", want: 17*time.Hour + 30*time.Minute},
+		{s: "00:00", want: 0},
+		{s: "24:00", want: 24 * time.Hour},
+		{s: "9:00", want: 9 * time.Hour},
+		{s: "24:30", wantErr: true},
+		{s: "12:60", wantErr: true},
+		{s: "noon", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := ParseTimeOfDay(tt.s)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidTimeOfDay) {
+					t.Errorf("ParseTimeOfDay(%q) error = %v; want %v", tt.s, err, ErrInvalidTimeOfDay)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("ParseTimeOfDay(%q) = %v, %v; want %v", tt.s, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSlots(t *testing.T) {
+	jerusalem, err := time.LoadLocation("Asia/Jerusalem")
+	if err != nil {
+		t.Fatalf("failed to load location: %v", err)
+	}
+
+	hours := Hours{Opens: 9 * time.Hour, Closes: 12*time.Hour + 30*time.Minute}
+
+	slots := hours.Slots(time.Date(2024, time.December, 10, 12, 0, 0, 0, time.UTC), jerusalem, time.Hour)
+	if len(slots) != 3 {
+		t.Fatalf("Slots() = %d slots; want 3 whole hours before closing", len(slots))
+	}
+	if want := time.Date(2024, time.December, 10, 9, 0, 0, 0, jerusalem); !slots[0].Start.Equal(want) {
+		t.Errorf("first slot starts at %v; want %v", slots[0].Start, want)
+	}
+	if want := time.Date(2024, time.December, 10, 12, 0, 0, 0, jerusalem); !slots[2].End.Equal(want) {
+		t.Errorf("last slot ends at %v; want %v", slots[2].End, want)
+	}
+
+	// Daylight saving time ends in Jerusalem on the night of 27 October 2024.
+	slots = hours.Slots(time.Date(2024, time.October, 27, 12, 0, 0, 0, jerusalem), jerusalem, time.Hour)
+	if got := slots[0].Start.In(jerusalem).Hour(); got != 9 {
+		t.Errorf("first slot on the day daylight saving time ends starts at %d:00; want 9:00", got)
+	}
+}
+
+func TestFits(t *testing.T) {
+	hours := Hours{Opens: 9 * time.Hour, Closes: 17 * time.Hour}
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, time.December, 10, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name string
+		slot Slot
+		want bool
+	}{
+		{name: "one slot", slot: Slot{Start: at(9, 0), End: at(9, 30)}, want: true},
+		{name: "several slots", slot: Slot{Start: at(14, 30), End: at(17, 0)}, want: true},
+		{name: "before opening", slot: Slot{Start: at(8, 30), End: at(9, 30)}, want: false},
+		{name: "after closing", slot: Slot{Start: at(16, 30), End: at(17, 30)}, want: false},
+		{name: "off the boundaries", slot: Slot{Start: at(9, 15), End: at(9, 45)}, want: false},
+		{name: "part of a slot", slot: Slot{Start: at(9, 0), End: at(9, 45)}, want: false},
+		{name: "empty", slot: Slot{Start: at(10, 0), End: at(10, 0)}, want: false},
+		{name: "reversed", slot: Slot{Start: at(11, 0), End: at(10, 0)}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hours.Fits(tt.slot, time.UTC, 30*time.Minute); got != tt.want {
+				t.Errorf("Fits(%v - %v) = %v; want %v", tt.slot.Start, tt.slot.End, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOverlaps(t *testing.T) {
+	at := func(hour int) time.Time {
+		return time.Date(2024, time.December, 10, hour, 0, 0, 0, time.UTC)
+	}
+	slot := Slot{Start: at(10), End: at(12)}
+
+	tests := []struct {
+		name  string
+		other Slot
+		want  bool
+	}{
+		{name: "same", other: slot, want: true},
+		{name: "inside", other: Slot{Start: at(10), End: at(11)}, want: true},
+		{name: "across the start", other: Slot{Start: at(9), End: at(11)}, want: true},
+		{name: "ends at the start", other: Slot{Start: at(9), End: at(10)}, want: false},
+		{name: "starts at the end", other: Slot{Start: at(12), End: at(13)}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := slot.Overlaps(tt.other); got != tt.want {
+				t.Errorf("Overlaps() = %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
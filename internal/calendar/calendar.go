@@ -0,0 +1,109 @@
+// Package calendar encodes iCalendar (RFC 5545) feeds which calendar apps can subscribe to.
+package calendar
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ContentType is the media type of an iCalendar feed.
+const ContentType = "text/calendar; charset=utf-8"
+
+const (
+	dateFormat     = "20060102"
+	dateTimeFormat = "20060102T150405Z"
+	// maxLineLength is the maximum length of a content line in octets, excluding the line break.
+	maxLineLength = 75
+)
+
+// Calendar is a feed of events.
+type Calendar struct {
+	// ProductID identifies the product which created the feed, such as "-//Library//Due Dates//EN".
+	ProductID string
+	Name      string
+	Events    []Event
+}
+
+// Event is an all-day event.
+type Event struct {
+	// UID identifies the event across updates of the feed.
+	UID         string
+	Date        time.Time
+	Summary     string
+	Description string
+	// Stamp is when the event was last modified.
+	Stamp time.Time
+	// Reminder is how long before the start of the day to alert, which is 0 for no alert.
+	Reminder time.Duration
+}
+
+// Encode writes the calendar to w.
+func (c *Calendar) Encode(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	writeLine(bw, "BEGIN", "VCALENDAR")
+	writeLine(bw, "VERSION", "2.0")
+	writeLine(bw, "PRODID", escape(c.ProductID))
+	writeLine(bw, "CALSCALE", "GREGORIAN")
+	writeLine(bw, "METHOD", "PUBLISH")
+	if c.Name != "" {
+		writeLine(bw, "X-WR-CALNAME", escape(c.Name))
+	}
+
+	for _, event := range c.Events {
+		writeLine(bw, "BEGIN", "VEVENT")
+		writeLine(bw, "UID", escape(event.UID))
+		writeLine(bw, "DTSTAMP", event.Stamp.UTC().Format(dateTimeFormat))
+		writeLine(bw, "DTSTART;VALUE=DATE", event.Date.Format(dateFormat))
+		writeLine(bw, "DTEND;VALUE=DATE", event.Date.AddDate(0, 0, 1).Format(dateFormat))
+		writeLine(bw, "SUMMARY", escape(event.Summary))
+		if event.Description != "" {
+			writeLine(bw, "DESCRIPTION", escape(event.Description))
+		}
+		writeLine(bw, "TRANSP", "TRANSPARENT")
+
+		if event.Reminder > 0 {
+			writeLine(bw, "BEGIN", "VALARM")
+			writeLine(bw, "ACTION", "DISPLAY")
+			writeLine(bw, "DESCRIPTION", escape(event.Summary))
+			writeLine(bw, "TRIGGER", fmt.Sprintf("-PT%dM", int(event.Reminder.Minutes())))
+			writeLine(bw, "END", "VALARM")
+		}
+
+		writeLine(bw, "END", "VEVENT")
+	}
+
+	writeLine(bw, "END", "VCALENDAR")
+
+	return bw.Flush()
+}
+
+// escape escapes a text value.
+func escape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(value)
+}
+
+// writeLine writes a content line, folded into lines of at most maxLineLength octets without
+// splitting UTF-8 characters. Write errors are reported by the Flush of w.
+func writeLine(w *bufio.Writer, name, value string) {
+	line := name + ":" + value
+
+	limit := maxLineLength
+	for len(line) > limit {
+		n := limit
+		for n > 0 && !utf8.RuneStart(line[n]) {
+			n--
+		}
+
+		_, _ = w.WriteString(line[:n] + "\r\n ")
+		line = line[n:]
+		// Continuation lines start with a space, which counts towards their length.
+		limit = maxLineLength - 1
+	}
+
+	_, _ = w.WriteString(line + "\r\n")
+}
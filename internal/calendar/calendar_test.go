@@ -0,0 +1,67 @@
+package calendar
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncode(t *testing.T) {
+	cal := &Calendar{
+		ProductID: "-//Library//Due Dates//EN",
+		Name:      "Library due dates",
+		Events: []Event{
+			{
+				UID:         "transaction-1@library",
+				Date:        time.Date(2024, time.December, 31, 0, 0, 0, 0, time.UTC),
+				Summary:     `Return "Sapiens; A Brief History, Vol. 1"`,
+				Description: "Borrowed on 17/12/2024\nPlease return it on time",
+				Stamp:       time.Date(2024, time.December, 17, 12, 30, 0, 0, time.FixedZone("UTC+2", 2*60*60)),
+				Reminder:    24 * time.Hour,
+			},
+		},
+	}
+
+	var b strings.Builder
+	if err := cal.Encode(&b); err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	got := b.String()
+
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\nVERSION:2.0\r\n",
+		"X-WR-CALNAME:Library due dates\r\n",
+		"UID:transaction-1@library\r\n",
+		"DTSTAMP:20241217T103000Z\r\n",
+		"DTSTART;VALUE=DATE:20241231\r\nDTEND;VALUE=DATE:20250101\r\n",
+		`SUMMARY:Return "Sapiens\; A Brief History\, Vol. 1"` + "\r\n",
+		`DESCRIPTION:Borrowed on 17/12/2024\nPlease return it on time` + "\r\n",
+		"TRIGGER:-PT1440M\r\n",
+		"END:VEVENT\r\nEND:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Encode() = %q; want it to contain %q", got, want)
+		}
+	}
+}
+
+func TestEncodeFoldsLongLines(t *testing.T) {
+	summary := strings.Repeat("ספר ארוך מאוד ", 20)
+	cal := &Calendar{ProductID: "-//Library//Due Dates//EN", Events: []Event{{UID: "1", Summary: summary}}}
+
+	var b strings.Builder
+	if err := cal.Encode(&b); err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+
+	for _, line := range strings.Split(strings.TrimSuffix(b.String(), "\r\n"), "\r\n") {
+		if len(line) > maxLineLength {
+			t.Errorf("line %q is %d octets long; want at most %d", line, len(line), maxLineLength)
+		}
+	}
+
+	unfolded := strings.ReplaceAll(b.String(), "\r\n ", "")
+	if !strings.Contains(unfolded, "SUMMARY:"+summary+"\r\n") {
+		t.Errorf("unfolded Encode() = %q; want it to contain the summary", unfolded)
+	}
+}
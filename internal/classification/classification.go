@@ -0,0 +1,55 @@
+// Package classification validates the call numbers of the classification schemes by which
+// libraries shelve books, such as the Dewey Decimal Classification and the Library of Congress
+// Classification.
+package classification
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// Classification schemes.
+const (
+	Dewey = "dewey"
+	LCC   = "lcc"
+)
+
+// Schemes are the supported classification schemes.
+var Schemes = []string{Dewey, LCC}
+
+var (
+	ErrInvalid       = errors.New("invalid call number")
+	ErrUnknownScheme = errors.New("unknown classification scheme")
+)
+
+var (
+	// deweyRX matches a Dewey class of three digits with an optional decimal part, such as 823.914,
+	// followed by optional parts such as a cutter number and a year.
+	deweyRX = regexp.MustCompile(`^\d{3}(\.\d+)?( [A-Z0-9][A-Z0-9.\-]*)*$`)
+	// lccRX matches an LCC class of one to three letters, of which the first is not I, O, W, X or Y,
+	// and a number with an optional decimal part, such as QA76.73, followed by cutter numbers
+	// such as .G63 and optional parts such as a year.
+	lccRX = regexp.MustCompile(`^[A-HJ-NP-VZ][A-Z]{0,2} ?\d{1,4}(\.\d+)?( ?\.?[A-Z]\d+[A-Z]*)*( [A-Z0-9][A-Z0-9.\-]*)*$`)
+)
+
+// Normalize returns a call number of a scheme in upper case and with single spaces, if it is valid.
+func Normalize(scheme, callNumber string) (string, error) {
+	callNumber = strings.Join(strings.Fields(strings.ToUpper(callNumber)), " ")
+
+	var rx *regexp.Regexp
+	switch scheme {
+	case Dewey:
+		rx = deweyRX
+	case LCC:
+		rx = lccRX
+	default:
+		return "", ErrUnknownScheme
+	}
+
+	if !rx.MatchString(callNumber) {
+		return "", ErrInvalid
+	}
+
+	return callNumber, nil
+}
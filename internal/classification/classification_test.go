@@ -0,0 +1,41 @@
+package classification
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		scheme     string
+		callNumber string
+		want       string
+		err        error
+	}{
+		{scheme: Dewey, callNumber: "823.914 ROW", want: "823.914 ROW"},
+		{scheme: Dewey, callNumber: " 005.133  k42 2018 ", want: "005.133 K42 2018"},
+		{scheme: Dewey, callNumber: "510", want: "510"},
+		{scheme: Dewey, callNumber: "82.3", err: ErrInvalid},
+		{scheme: Dewey, callNumber: "FIC ROW", err: ErrInvalid},
+		{scheme: Dewey, callNumber: "QA76.73", err: ErrInvalid},
+		{scheme: LCC, callNumber: "QA76.73.G63 D66 2016", want: "QA76.73.G63 D66 2016"},
+		{scheme: LCC, callNumber: "ps3552.r685 h37 1997", want: "PS3552.R685 H37 1997"},
+		{scheme: LCC, callNumber: "KF 801", want: "KF 801"},
+		{scheme: LCC, callNumber: "IQ76", err: ErrInvalid},
+		{scheme: LCC, callNumber: "823.914", err: ErrInvalid},
+		{scheme: LCC, callNumber: "QA", err: ErrInvalid},
+		{scheme: "udc", callNumber: "823.914", err: ErrUnknownScheme},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.scheme+" "+tt.callNumber, func(t *testing.T) {
+			got, err := Normalize(tt.scheme, tt.callNumber)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Normalize(%q, %q) error = %v; want %v", tt.scheme, tt.callNumber, err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("Normalize(%q, %q) = %q; want %q", tt.scheme, tt.callNumber, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,7 +1,20 @@
 package config
 
+import "time"
+
 type Input struct {
-	Port int
+	Port     int
+	Name     string
+	Timezone string
+	// Collation is the locale by which text, such as the titles of books, is sorted.
+	Collation string
+	// Environment is the environment the library runs in, such as production or staging.
+	Environment string
+	// Classification is the classification scheme of the call numbers of the library.
+	Classification string
+	Server         struct {
+		TrustedProxies []string
+	}
 	Cost struct {
 		OverdueFine float64
 		Discount    struct {
@@ -15,29 +28,238 @@ type Input struct {
 		Format  string
 	}
 	DB struct {
-		DSN                    string
-		Database               string
-		BooksCollection        string
-		PatronsCollection      string
-		TransactionsCollection string
-		TokensCollection       string
-		AdminsCollection       string
+		DSN                         string
+		DSNFile                     string
+		DSNVaultPath                string
+		Database                    string
+		BooksCollection             string
+		PatronsCollection           string
+		TransactionsCollection      string
+		TokensCollection            string
+		AdminsCollection            string
+		CategoriesCollection        string
+		PublishersCollection        string
+		NotificationsCollection     string
+		EventsCollection            string
+		AvailabilityCollection      string
+		KiosksCollection            string
+		KioskRequestsCollection     string
+		AuditCollection             string
+		PaymentsCollection          string
+		AcquisitionsCollection      string
+		WithdrawalsCollection       string
+		InventorySessionsCollection string
+		InventoryScansCollection    string
+		SuggestionsCollection       string
+		ResourcesCollection         string
+		ReservationsCollection      string
+		ProgramsCollection          string
+		RegistrationsCollection     string
+		AnnouncementsCollection     string
+		SavedSearchesCollection     string
+		DailyStatsCollection        string
+		// MaxPoolSize, MinPoolSize, MaxConnIdleTime, ConnectTimeout, ServerSelectionTimeout, Timeout,
+		// ReadPreference, RetryWrites and Compressors tune the client, and are left to the DSN or to
+		// the defaults of the driver when zero.
+		MaxPoolSize            uint64
+		MinPoolSize            uint64
+		MaxConnIdleTime        time.Duration
+		ConnectTimeout         time.Duration
+		ServerSelectionTimeout time.Duration
+		Timeout                time.Duration
+		ReadPreference         string
+		RetryWrites            *bool
+		Compressors            []string
+		// ListReadPreference is the mode of the read preference of the lists of documents which
+		// operations with any of ListReadTags read, or empty to read them as ReadPreference.
+		ListReadPreference string
+		ListReadTags       []string
+		// SlowQueryThreshold is the duration from which queries are logged as slow, or 0 to not log them.
+		SlowQueryThreshold time.Duration
+		// IndexHints hints known-hot queries to use their indexes.
+		IndexHints bool
+		// SkipIndexes disables creating indexes on setup, for migrations which must run before them.
+		SkipIndexes bool
 	}
 	JTW struct {
-		Secret   string
-		Issuer   string
-		Audience string
+		Secret          string
+		SecretFile      string
+		SecretVaultPath string
+		Issuer          string
+		Audience        string
+		FeedTokenTTL    time.Duration
+		KioskTokenTTL   time.Duration
 	}
 	Admin struct {
 		Username string
 		Password string
 		Create   bool
 	}
-	Demo struct {
-		Books   bool
-		Patrons bool
+	// Passwords is the policy of the passwords which patrons and admins set. Passwords are checked
+	// against breaches only if CheckBreached is set. Hash is the algorithm of their hashes, or empty
+	// for bcrypt, with its parameters, which are the defaults when 0.
+	Passwords struct {
+		MinLength     int
+		DenyCommon    bool
+		CheckBreached bool
+		BreachURL     string
+		Hash          string
+		BcryptCost    int
+		Argon2id      struct {
+			Memory      int
+			Iterations  int
+			Parallelism int
+		}
+	}
+	// Activation limits resending the activation tokens of a patron to once in every ResendInterval,
+	// or does not limit it if ResendInterval is 0.
+	Activation struct {
+		ResendInterval time.Duration
+	}
+	// SCIM provisions patrons from an identity provider, which authenticates with Token, and is
+	// disabled if Token is empty. GroupCategories maps the groups of provisioned users, by their
+	// names or IDs, to the categories of the patrons, who are of DefaultCategory if none of their
+	// groups is mapped.
+	SCIM struct {
+		Token           string
+		GroupCategories map[string]string
+		DefaultCategory string
+	}
+	Seed struct {
+		Books        int
+		Patrons      int
+		Transactions int
+		Password     string
+		RandomSeed   int64
 	}
 	CORS struct {
-		TrustedOrigins []string
+		TrustedOrigins   []string
+		AllowedMethods   []string
+		AllowedHeaders   []string
+		ExposedHeaders   []string
+		AllowCredentials bool
+		MaxAge           time.Duration
+	}
+	// Catalog limits the rate of the anonymous requests to the public catalog by IP, to RateLimit
+	// requests in every RateWindow, or does not limit them if RateLimit is 0.
+	Catalog struct {
+		RateLimit  int
+		RateWindow time.Duration
+	}
+	Encryption struct {
+		Key     string
+		KeyFile string
+	}
+	Log struct {
+		Level   string
+		JSON    bool
+		Concise bool
+		// RedactedHeaders and RedactedFields are redacted from logs in addition to the defaults.
+		RedactedHeaders []string
+		RedactedFields  []string
+	}
+	Mail struct {
+		Host     string
+		Port     int
+		Username string
+		Password string
+		Sender   string
+		Locale   string
+	}
+	SMS struct {
+		Provider         string
+		TwilioAccountSID string
+		TwilioAuthToken  string
+		TwilioFrom       string
+		WebhookURL       string
+		WebhookSecret    string
+	}
+	Events struct {
+		WebhookURLs      []string
+		WebhookSecret    string
+		DispatchInterval time.Duration
+		BorrowReceipts   bool
+	}
+	Ebooks struct {
+		ReturnInterval time.Duration
+	}
+	Files struct {
+		Storage        string
+		Dir            string
+		MaxSize        int64
+		DownloadURLTTL time.Duration
+		S3             struct {
+			Bucket          string
+			Region          string
+			Endpoint        string
+			AccessKeyID     string
+			SecretAccessKey string
+		}
+	}
+	Labels struct {
+		Layout string
+	}
+	Booking struct {
+		Opens           string
+		Closes          string
+		Slot            time.Duration
+		MaxDuration     time.Duration
+		HorizonDays     int
+		MaxReservations int
+	}
+	// Retention anonymizes or deletes, by Mode, the returned transactions which were returned more
+	// than Years ago every Interval, and is disabled if Years is 0. A DryRun only counts them.
+	Retention struct {
+		Years    int
+		Mode     string
+		DryRun   bool
+		Interval time.Duration
+	}
+	Programs struct {
+		ReminderLead     time.Duration
+		ReminderInterval time.Duration
+	}
+	OAI struct {
+		BaseURL    string
+		AdminEmail string
+	}
+	// Reports also holds the reporting windows which recur every year: the Terms, from their first
+	// to their last day formatted as MM-DD/MM-DD by their names, and the fiscal year, which starts
+	// on FiscalYearStart.
+	Reports struct {
+		Recipients      []string
+		Weekday         string
+		Hour            int
+		Format          string
+		Terms           map[string]string
+		FiscalYearStart string
+	}
+	// Stats rolls up the circulation of the days which are over every night at RollupHour.
+	Stats struct {
+		RollupHour int
+	}
+	Search struct {
+		URL      string
+		Index    string
+		Username string
+		Password string
+		Analyzer string
+	}
+	Payments struct {
+		Provider        string
+		Currency        string
+		StripeSecretKey string
+		WebhookSecret   string
+		SuccessURL      string
+		CancelURL       string
+	}
+	ErrorReporting struct {
+		DSN         string
+		Environment string
+	}
+	Secrets struct {
+		VaultAddress    string
+		VaultToken      string
+		RefreshInterval time.Duration
 	}
 }
@@ -0,0 +1,260 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+	"time"
+)
+
+// Sources of Acquisitions.
+const (
+	AcquisitionSourceDonation = "donation"
+	AcquisitionSourcePurchase = "purchase"
+)
+
+const (
+	AcquisitionStatusReceived  = "received"
+	AcquisitionStatusCataloged = "cataloged"
+)
+
+// Acquisition records copies of a book which the library received, either donated or purchased,
+// from the Vendor or donor, at a Cost. It is received until its copies are added to the catalog,
+// and then records the Book they were added to.
+type Acquisition struct {
+	ID          string    `bson:"_id,omitempty" json:"id,omitempty"`
+	Source      string    `bson:"source" json:"source"`
+	Vendor      string    `bson:"vendor" json:"vendor"`
+	ISBN        string    `bson:"isbn,omitempty" json:"isbn,omitempty"`
+	Title       string    `bson:"title" json:"title"`
+	Copies      int       `bson:"copies" json:"copies"`
+	Cost        float64   `bson:"cost" json:"cost"`
+	ReceivedAt  time.Time `bson:"received_at" json:"received_at"`
+	Note        string    `bson:"note,omitempty" json:"note,omitempty"`
+	Status      string    `bson:"status" json:"status"`
+	BookID      string    `bson:"book_id,omitempty" json:"book_id,omitempty"`
+	CatalogedAt time.Time `bson:"cataloged_at,omitempty" json:"cataloged_at,omitempty"`
+	CreatedAt   time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt   time.Time `bson:"updated_at" json:"-"`
+	Version     int32     `bson:"version" json:"-"`
+}
+
+type AcquisitionFilter struct {
+	ID            *string    `json:"id,omitempty"`
+	Source        *string    `json:"source,omitempty"`
+	Vendor        *string    `json:"vendor,omitempty"`
+	Status        *string    `json:"status,omitempty"`
+	BookID        *string    `json:"book_id,omitempty"`
+	MinReceivedAt *time.Time `json:"min_received_at,omitempty"`
+	MaxReceivedAt *time.Time `json:"max_received_at,omitempty"`
+	Version       *int32     `json:"-,omitempty"`
+}
+
+type AcquisitionModel struct {
+	Client     *mongo.Client
+	Database   string
+	Collection string
+}
+
+// buildAcquisitionFilter constructs a filter query for filtering acquisitions.
+func buildAcquisitionFilter(filter AcquisitionFilter) (bson.M, error) {
+	query := bson.M{}
+
+	if filter.ID != nil {
+		id, err := objectID(*filter.ID)
+		if err != nil {
+			return query, err
+		}
+		query[idTag] = id
+	}
+	if filter.Source != nil {
+		query[sourceTag] = *filter.Source
+	}
+	if filter.Vendor != nil {
+		query[vendorTag] = *filter.Vendor
+	}
+	if filter.Status != nil {
+		query[statusTag] = *filter.Status
+	}
+	if filter.BookID != nil {
+		query[bookIDTag] = *filter.BookID
+	}
+
+	receivedAtQuery := bson.M{}
+	if filter.MinReceivedAt != nil {
+		receivedAtQuery["$gte"] = *filter.MinReceivedAt
+	}
+	if filter.MaxReceivedAt != nil {
+		receivedAtQuery["$lte"] = *filter.MaxReceivedAt
+	}
+	if len(receivedAtQuery) > 0 {
+		query[receivedAtTag] = receivedAtQuery
+	}
+
+	if filter.Version != nil {
+		query[versionTag] = *filter.Version
+	}
+
+	return query, nil
+}
+
+// buildAcquisitionUpdater constructs an update document for updating an Acquisition.
+func buildAcquisitionUpdater(acquisition *Acquisition) bson.D {
+	updateFields := bson.D{
+		{Key: sourceTag, Value: acquisition.Source},
+		{Key: vendorTag, Value: acquisition.Vendor},
+		{Key: isbnTag, Value: acquisition.ISBN},
+		{Key: titleTag, Value: acquisition.Title},
+		{Key: copiesTag, Value: acquisition.Copies},
+		{Key: costTag, Value: acquisition.Cost},
+		{Key: receivedAtTag, Value: acquisition.ReceivedAt},
+		{Key: noteTag, Value: acquisition.Note},
+		{Key: statusTag, Value: acquisition.Status},
+		{Key: bookIDTag, Value: acquisition.BookID},
+		{Key: catalogedAtTag, Value: acquisition.CatalogedAt},
+	}
+
+	updateFields = append(updateFields, bson.E{Key: updatedAtTag, Value: time.Now()})
+
+	update := bson.D{
+		{Key: "$set", Value: updateFields},
+		{Key: "$inc", Value: bson.D{{Key: versionTag, Value: 1}}},
+	}
+
+	return update
+}
+
+// CreateIndexes creates an index on the books of the acquisitions, by which the history of the
+// stock of a book is looked up.
+func (a AcquisitionModel) CreateIndexes() error {
+	coll := a.Client.Database(a.Database).Collection(a.Collection)
+	indexModel := mongo.IndexModel{
+		Keys: bson.D{{Key: bookIDTag, Value: 1}},
+	}
+
+	_, err := coll.Indexes().CreateOne(context.TODO(), indexModel)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Insert inserts a new Acquisition into the database.
+func (a AcquisitionModel) Insert(ctx context.Context, acquisition *Acquisition) (string, error) {
+	coll := a.Client.Database(a.Database).Collection(a.Collection)
+
+	now := time.Now()
+	acquisition.CreatedAt = now
+	acquisition.UpdatedAt = now
+
+	res, err := coll.InsertOne(ctx, acquisition)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "_id_ dup key:"):
+			return "", ErrDuplicateID
+		default:
+			return "", err
+		}
+	}
+
+	return res.InsertedID.(primitive.ObjectID).Hex(), nil
+}
+
+// Get retrieves a single Acquisition from the database matching an optional filter.
+func (a AcquisitionModel) Get(ctx context.Context, filter AcquisitionFilter) (*Acquisition, error) {
+	coll := a.Client.Database(a.Database).Collection(a.Collection)
+
+	filterQuery, err := buildAcquisitionFilter(filter)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	acquisition := &Acquisition{}
+
+	logQuery(ctx, a.Collection, "findOne", filterQuery)
+	err = coll.FindOne(ctx, filterQuery).Decode(acquisition)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrDocumentNotFound
+		}
+		return nil, err
+	}
+
+	return acquisition, nil
+}
+
+// GetAll retrieves a paginated list of Acquisitions from the database matching an optional filter and sorting.
+func (a AcquisitionModel) GetAll(ctx context.Context, filter AcquisitionFilter, paginator Paginator, sorter Sorter) ([]Acquisition, Metadata, error) {
+	coll := a.Client.Database(a.Database).Collection(a.Collection, listOptions(ctx))
+
+	acquisitions := make([]Acquisition, 0)
+	metadata := Metadata{}
+
+	filterQuery, err := buildAcquisitionFilter(filter)
+	if err != nil {
+		return acquisitions, Metadata{}, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	sortQuery, err := buildSorter(sorter)
+	if err != nil {
+		return nil, Metadata{}, fmt.Errorf("%v: %v", errCreatingQuerySort, err)
+	}
+
+	findOpt := options.Find().SetSort(sortQuery).SetCollation(sorter.collation())
+
+	if paginator.valid() {
+		var totalRecords int64
+
+		findOpt = findOpt.SetLimit(paginator.limit()).SetSkip(paginator.offset())
+		totalRecords, err = coll.CountDocuments(ctx, filterQuery)
+		if err != nil {
+			return acquisitions, Metadata{}, errCreatingQueryFilter
+		}
+
+		metadata = calculateMetadata(totalRecords, paginator.Page, paginator.PageSize)
+	}
+
+	logQuery(ctx, a.Collection, "find", filterQuery)
+	cursor, err := coll.Find(ctx, filterQuery, findOpt)
+	if err != nil {
+		return acquisitions, Metadata{}, err
+	}
+	defer cursor.Close(ctx)
+
+	if err = cursor.All(ctx, &acquisitions); err != nil {
+		return acquisitions, Metadata{}, err
+	}
+
+	return acquisitions, metadata, nil
+}
+
+// Update updates an Acquisition in the database.
+func (a AcquisitionModel) Update(ctx context.Context, filter AcquisitionFilter, acquisition *Acquisition) error {
+	coll := a.Client.Database(a.Database).Collection(a.Collection)
+
+	update := buildAcquisitionUpdater(acquisition)
+
+	filter.Version = &acquisition.Version
+	filterQuery, err := buildAcquisitionFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	logQuery(ctx, a.Collection, "updateOne", filterQuery)
+	result, err := coll.UpdateOne(ctx, filterQuery, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
@@ -6,13 +6,16 @@ import (
 	"fmt"
 	"github.com/mzeevi/library/internal/auth"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"strings"
 )
 
 var (
 	AnonymousAdmin = &Admin{}
+
+	ErrDuplicateName = errors.New("duplicate name")
+	ErrEmptyName     = errors.New("admin name must not be empty")
 )
 
 type Admin struct {
@@ -21,6 +24,7 @@ type Admin struct {
 	Activated   bool          `bson:"activated" json:"activated"`
 	Password    auth.Password `bson:"password" json:"-"`
 	Permissions []string      `bson:"permissions" json:"-"`
+	Version     int32         `bson:"version" json:"-"`
 }
 
 type AdminModel struct {
@@ -30,8 +34,9 @@ type AdminModel struct {
 }
 
 type AdminFilter struct {
-	ID   *string `json:"id,omitempty"`
-	Name *string `json:"name,omitempty"`
+	ID      *string `json:"id,omitempty"`
+	Name    *string `json:"name,omitempty"`
+	Version *int32  `json:"-,omitempty"`
 }
 
 // IsAnonymous checks if a Patron instance is anonymous.
@@ -44,7 +49,7 @@ func buildAdminFilter(filter AdminFilter) (bson.M, error) {
 	query := bson.M{}
 
 	if filter.ID != nil {
-		id, err := primitive.ObjectIDFromHex(*filter.ID)
+		id, err := objectID(*filter.ID)
 		if err != nil {
 			return query, err
 		}
@@ -55,9 +60,35 @@ func buildAdminFilter(filter AdminFilter) (bson.M, error) {
 		query[nameTag] = *filter.Name
 	}
 
+	if filter.Version != nil {
+		if *filter.Version == 0 {
+			// Admins created before versioning was added have no version field.
+			query[versionTag] = bson.M{"$in": bson.A{0, nil}}
+		} else {
+			query[versionTag] = *filter.Version
+		}
+	}
+
 	return query, nil
 }
 
+// buildAdminUpdater constructs an update query for updating an admin.
+func buildAdminUpdater(admin *Admin) bson.D {
+	updateFields := bson.D{
+		{Key: nameTag, Value: admin.Name},
+		{Key: passwordTag, Value: admin.Password},
+		{Key: activatedTag, Value: admin.Activated},
+		{Key: permissionsTag, Value: admin.Permissions},
+	}
+
+	update := bson.D{
+		{Key: "$set", Value: updateFields},
+		{Key: "$inc", Value: bson.D{{Key: versionTag, Value: 1}}},
+	}
+
+	return update
+}
+
 // generateAdmin constructs a new Admin.
 func generateAdmin(username, password string) (*Admin, error) {
 	admin := &Admin{}
@@ -74,6 +105,72 @@ func generateAdmin(username, password string) (*Admin, error) {
 	return admin, nil
 }
 
+// CreateUniqueIndex creates a unique index using a field.
+func (a AdminModel) CreateUniqueIndex() error {
+	coll := a.Client.Database(a.Database).Collection(a.Collection)
+	indexModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: nameTag, Value: -1}},
+		Options: options.Index().SetUnique(true),
+	}
+
+	_, err := coll.Indexes().CreateOne(context.TODO(), indexModel)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteDuplicates deletes all but the first created Admin of each name, returning the number of
+// deleted Admins. Admins were created again on every start before their names were unique, and
+// the unique index on names cannot be created until the duplicates are deleted. The first Admin
+// is kept, since it is the one which logins have found by its name.
+func (a AdminModel) DeleteDuplicates(ctx context.Context) (int64, error) {
+	coll := a.Client.Database(a.Database).Collection(a.Collection)
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$sort", Value: bson.M{idTag: 1}}},
+		{{Key: "$group", Value: bson.M{
+			idTag:   "$" + nameTag,
+			"ids":   bson.M{"$push": "$" + idTag},
+			"count": bson.M{"$sum": 1},
+		}}},
+		{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+	}
+
+	logQuery(ctx, a.Collection, "aggregate", bson.M{})
+	cursor, err := coll.Aggregate(ctx, pipeline)
+	if err != nil {
+		return 0, err
+	}
+
+	var groups []struct {
+		IDs []any `bson:"ids"`
+	}
+	if err = cursor.All(ctx, &groups); err != nil {
+		return 0, err
+	}
+
+	duplicates := bson.A{}
+	for _, group := range groups {
+		duplicates = append(duplicates, group.IDs[1:]...)
+	}
+	if len(duplicates) == 0 {
+		return 0, nil
+	}
+
+	filterQuery := bson.M{idTag: bson.M{"$in": duplicates}}
+
+	logQuery(ctx, a.Collection, "deleteMany", filterQuery)
+	result, err := coll.DeleteMany(ctx, filterQuery)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
+
+// New creates a new Admin and inserts it into the database.
 func (a AdminModel) New(ctx context.Context, username, password string) error {
 	admin, err := generateAdmin(username, password)
 	if err != nil {
@@ -83,7 +180,38 @@ func (a AdminModel) New(ctx context.Context, username, password string) error {
 	return a.Insert(ctx, admin)
 }
 
-// Insert inserts a new Patron into the database.
+// Ensure creates an Admin with the given name if one does not exist yet, returning whether it was created.
+// An existing Admin is left untouched, so Ensure can safely run on every start.
+func (a AdminModel) Ensure(ctx context.Context, username, password string) (bool, error) {
+	if username == "" {
+		return false, ErrEmptyName
+	}
+
+	coll := a.Client.Database(a.Database).Collection(a.Collection)
+
+	admin, err := generateAdmin(username, password)
+	if err != nil {
+		return false, err
+	}
+
+	filter := bson.M{nameTag: username}
+	update := bson.M{"$setOnInsert": admin}
+
+	res, err := coll.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "name_-1 dup key"):
+			// A concurrent Ensure created the same Admin.
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+
+	return res.UpsertedCount > 0, nil
+}
+
+// Insert inserts a new Admin into the database.
 func (a AdminModel) Insert(ctx context.Context, admin *Admin) error {
 	coll := a.Client.Database(a.Database).Collection(a.Collection)
 
@@ -92,6 +220,8 @@ func (a AdminModel) Insert(ctx context.Context, admin *Admin) error {
 		switch {
 		case strings.Contains(err.Error(), "_id_ dup key:"):
 			return ErrDuplicateID
+		case strings.Contains(err.Error(), "name_-1 dup key"):
+			return ErrDuplicateName
 		default:
 			return err
 		}
@@ -100,17 +230,18 @@ func (a AdminModel) Insert(ctx context.Context, admin *Admin) error {
 	return nil
 }
 
-// Get retrieves a single Patron from the database matching an optional filter.
+// Get retrieves a single Admin from the database matching an optional filter.
 func (a AdminModel) Get(ctx context.Context, filter AdminFilter) (*Admin, error) {
 	coll := a.Client.Database(a.Database).Collection(a.Collection)
 
 	filterQuery, err := buildAdminFilter(filter)
 	if err != nil {
-		return nil, fmt.Errorf("%v: %v", errCreatingQueryFilter, err)
+		return nil, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
 	}
 
 	admin := &Admin{}
 
+	logQuery(ctx, a.Collection, "findOne", filterQuery)
 	err = coll.FindOne(ctx, filterQuery).Decode(admin)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
@@ -121,3 +252,100 @@ func (a AdminModel) Get(ctx context.Context, filter AdminFilter) (*Admin, error)
 
 	return admin, nil
 }
+
+// GetAll retrieves all Admins from the database matching an optional filter and paginator.
+func (a AdminModel) GetAll(ctx context.Context, filter AdminFilter, paginator Paginator, sorter Sorter) ([]Admin, Metadata, error) {
+	coll := a.Client.Database(a.Database).Collection(a.Collection, listOptions(ctx))
+
+	admins := make([]Admin, 0)
+	metadata := Metadata{}
+
+	filterQuery, err := buildAdminFilter(filter)
+	if err != nil {
+		return admins, Metadata{}, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	sortQuery, err := buildSorter(sorter)
+	if err != nil {
+		return admins, Metadata{}, fmt.Errorf("%v: %v", errCreatingQuerySort, err)
+	}
+
+	findOpt := options.Find().SetSort(sortQuery).SetCollation(sorter.collation())
+
+	if paginator.valid() {
+		var totalRecords int64
+
+		findOpt = findOpt.SetLimit(paginator.limit()).SetSkip(paginator.offset())
+		totalRecords, err = coll.CountDocuments(ctx, filterQuery)
+		if err != nil {
+			return admins, Metadata{}, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+		}
+
+		metadata = calculateMetadata(totalRecords, paginator.Page, paginator.PageSize)
+	}
+
+	logQuery(ctx, a.Collection, "find", filterQuery)
+	cursor, err := coll.Find(ctx, filterQuery, findOpt)
+	if err != nil {
+		return admins, Metadata{}, err
+	}
+	defer cursor.Close(ctx)
+
+	if err = cursor.All(ctx, &admins); err != nil {
+		return admins, Metadata{}, err
+	}
+
+	return admins, metadata, nil
+}
+
+// Update updates an Admin in the database matching a filter.
+func (a AdminModel) Update(ctx context.Context, filter AdminFilter, admin *Admin) error {
+	coll := a.Client.Database(a.Database).Collection(a.Collection)
+
+	update := buildAdminUpdater(admin)
+
+	filter.Version = &admin.Version
+	filterQuery, err := buildAdminFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	logQuery(ctx, a.Collection, "updateOne", filterQuery)
+	result, err := coll.UpdateOne(ctx, filterQuery, update)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "name_-1 dup key"):
+			return ErrDuplicateName
+		default:
+			return err
+		}
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+// Delete deletes an Admin from the database by filter.
+func (a AdminModel) Delete(ctx context.Context, filter AdminFilter) error {
+	coll := a.Client.Database(a.Database).Collection(a.Collection)
+
+	filterQuery, err := buildAdminFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	logQuery(ctx, a.Collection, "deleteOne", filterQuery)
+	result, err := coll.DeleteOne(ctx, filterQuery)
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return ErrDocumentNotFound
+	}
+
+	return nil
+}
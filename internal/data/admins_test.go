@@ -0,0 +1,41 @@
+package data
+
+import (
+	"github.com/stretchr/testify/assert"
+)
+
+func (ts *TestSuite) TestDeleteDuplicateAdmins() {
+	t := ts.T()
+
+	var firstID string
+	for i, name := range []string{"admin", "admin", "other", "admin"} {
+		admin, err := generateAdmin(name, "admin-password")
+		if !assert.NoError(t, err) || !assert.NoError(t, ts.models.Admins.Insert(ts.ctx, admin)) {
+			return
+		}
+
+		if i == 0 {
+			first, err := ts.models.Admins.Get(ts.ctx, AdminFilter{Name: &name})
+			if !assert.NoError(t, err) {
+				return
+			}
+			firstID = first.ID
+		}
+	}
+
+	deleted, err := ts.models.Admins.DeleteDuplicates(ts.ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), deleted)
+
+	admins, _, err := ts.models.Admins.GetAll(ts.ctx, AdminFilter{Name: ptr("admin")}, Paginator{}, Sorter{})
+	assert.NoError(t, err)
+	if assert.Len(t, admins, 1) {
+		assert.Equal(t, firstID, admins[0].ID)
+	}
+
+	assert.NoError(t, ts.models.Admins.CreateUniqueIndex())
+
+	deleted, err = ts.models.Admins.DeleteDuplicates(ts.ctx)
+	assert.NoError(t, err)
+	assert.Zero(t, deleted)
+}
@@ -0,0 +1,276 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+	"time"
+)
+
+// Audiences of Announcements.
+const (
+	AnnouncementAudienceAll     = "all"
+	AnnouncementAudiencePatrons = "patrons"
+	AnnouncementAudienceAdmins  = "admins"
+)
+
+// Severities of Announcements.
+const (
+	AnnouncementSeverityInfo     = "info"
+	AnnouncementSeverityWarning  = "warning"
+	AnnouncementSeverityCritical = "critical"
+)
+
+// Announcement is a notice of the library shown to clients as a banner, such as a maintenance
+// notice or the hours of a holiday. It is shown to its Audience from StartsAt until EndsAt, or
+// until it is deleted if it has no EndsAt.
+type Announcement struct {
+	ID        string    `bson:"_id,omitempty" json:"id,omitempty"`
+	Title     string    `bson:"title" json:"title"`
+	Message   string    `bson:"message" json:"message"`
+	Severity  string    `bson:"severity" json:"severity"`
+	Audience  string    `bson:"audience" json:"audience"`
+	StartsAt  time.Time `bson:"starts_at" json:"starts_at"`
+	EndsAt    time.Time `bson:"ends_at,omitempty" json:"ends_at,omitempty"`
+	CreatedBy string    `bson:"created_by" json:"created_by"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at" json:"-"`
+	Version   int32     `bson:"version" json:"-"`
+}
+
+// AnnouncementFilter filters Announcements. Audiences matches any of the audiences, and Active
+// matches the announcements which are shown at now if true, or which are not if false.
+type AnnouncementFilter struct {
+	ID        *string  `json:"id,omitempty"`
+	Audiences []string `json:"audiences,omitempty"`
+	Severity  *string  `json:"severity,omitempty"`
+	Active    *bool    `json:"active,omitempty"`
+	Version   *int32   `json:"-,omitempty"`
+}
+
+type AnnouncementModel struct {
+	Client     *mongo.Client
+	Database   string
+	Collection string
+}
+
+// buildAnnouncementFilter constructs a filter query for filtering announcements.
+func buildAnnouncementFilter(filter AnnouncementFilter) (bson.M, error) {
+	query := bson.M{}
+
+	if filter.ID != nil {
+		id, err := objectID(*filter.ID)
+		if err != nil {
+			return query, err
+		}
+		query[idTag] = id
+	}
+	if len(filter.Audiences) > 0 {
+		query[audienceTag] = bson.M{"$in": filter.Audiences}
+	}
+	if filter.Severity != nil {
+		query[severityTag] = *filter.Severity
+	}
+	if filter.Version != nil {
+		query[versionTag] = *filter.Version
+	}
+
+	if filter.Active != nil {
+		now := time.Now()
+		active := bson.M{
+			startsAtTag: bson.M{"$lte": now},
+			"$nor":      bson.A{bson.M{endsAtTag: bson.M{"$lte": now}}},
+		}
+		if *filter.Active {
+			query["$and"] = bson.A{active}
+		} else {
+			query["$nor"] = bson.A{active}
+		}
+	}
+
+	return query, nil
+}
+
+// buildAnnouncementUpdater constructs an update document for updating an Announcement. Its end is
+// unset if it has none.
+func buildAnnouncementUpdater(announcement *Announcement) bson.D {
+	updateFields := bson.D{
+		{Key: titleTag, Value: announcement.Title},
+		{Key: messageTag, Value: announcement.Message},
+		{Key: severityTag, Value: announcement.Severity},
+		{Key: audienceTag, Value: announcement.Audience},
+		{Key: startsAtTag, Value: announcement.StartsAt},
+	}
+	if !announcement.EndsAt.IsZero() {
+		updateFields = append(updateFields, bson.E{Key: endsAtTag, Value: announcement.EndsAt})
+	}
+
+	updateFields = append(updateFields, bson.E{Key: updatedAtTag, Value: time.Now()})
+
+	update := bson.D{
+		{Key: "$set", Value: updateFields},
+		{Key: "$inc", Value: bson.D{{Key: versionTag, Value: 1}}},
+	}
+	if announcement.EndsAt.IsZero() {
+		update = append(update, bson.E{Key: "$unset", Value: bson.D{{Key: endsAtTag, Value: ""}}})
+	}
+
+	return update
+}
+
+// CreateIndexes creates an index on the audiences and the start times of the announcements, by
+// which clients fetch the announcements shown to them.
+func (a AnnouncementModel) CreateIndexes() error {
+	coll := a.Client.Database(a.Database).Collection(a.Collection)
+	indexModel := mongo.IndexModel{
+		Keys: bson.D{{Key: audienceTag, Value: 1}, {Key: startsAtTag, Value: -1}},
+	}
+
+	_, err := coll.Indexes().CreateOne(context.TODO(), indexModel)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Insert inserts a new Announcement into the database.
+func (a AnnouncementModel) Insert(ctx context.Context, announcement *Announcement) (string, error) {
+	coll := a.Client.Database(a.Database).Collection(a.Collection)
+
+	now := time.Now()
+	announcement.CreatedAt = now
+	announcement.UpdatedAt = now
+
+	res, err := coll.InsertOne(ctx, announcement)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "_id_ dup key:"):
+			return "", ErrDuplicateID
+		default:
+			return "", err
+		}
+	}
+
+	return res.InsertedID.(primitive.ObjectID).Hex(), nil
+}
+
+// Get retrieves a single Announcement from the database matching an optional filter.
+func (a AnnouncementModel) Get(ctx context.Context, filter AnnouncementFilter) (*Announcement, error) {
+	coll := a.Client.Database(a.Database).Collection(a.Collection)
+
+	filterQuery, err := buildAnnouncementFilter(filter)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	announcement := &Announcement{}
+
+	logQuery(ctx, a.Collection, "findOne", filterQuery)
+	err = coll.FindOne(ctx, filterQuery).Decode(announcement)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrDocumentNotFound
+		}
+		return nil, err
+	}
+
+	return announcement, nil
+}
+
+// GetAll retrieves a paginated list of Announcements from the database matching an optional filter and sorting.
+func (a AnnouncementModel) GetAll(ctx context.Context, filter AnnouncementFilter, paginator Paginator, sorter Sorter) ([]Announcement, Metadata, error) {
+	coll := a.Client.Database(a.Database).Collection(a.Collection, listOptions(ctx))
+
+	announcements := make([]Announcement, 0)
+	metadata := Metadata{}
+
+	filterQuery, err := buildAnnouncementFilter(filter)
+	if err != nil {
+		return announcements, Metadata{}, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	sortQuery, err := buildSorter(sorter)
+	if err != nil {
+		return nil, Metadata{}, fmt.Errorf("%v: %v", errCreatingQuerySort, err)
+	}
+
+	findOpt := options.Find().SetSort(sortQuery).SetCollation(sorter.collation())
+
+	if paginator.valid() {
+		var totalRecords int64
+
+		findOpt = findOpt.SetLimit(paginator.limit()).SetSkip(paginator.offset())
+		totalRecords, err = coll.CountDocuments(ctx, filterQuery)
+		if err != nil {
+			return announcements, Metadata{}, errCreatingQueryFilter
+		}
+
+		metadata = calculateMetadata(totalRecords, paginator.Page, paginator.PageSize)
+	}
+
+	logQuery(ctx, a.Collection, "find", filterQuery)
+	cursor, err := coll.Find(ctx, filterQuery, findOpt)
+	if err != nil {
+		return announcements, Metadata{}, err
+	}
+	defer cursor.Close(ctx)
+
+	if err = cursor.All(ctx, &announcements); err != nil {
+		return announcements, Metadata{}, err
+	}
+
+	return announcements, metadata, nil
+}
+
+// Update updates an Announcement in the database.
+func (a AnnouncementModel) Update(ctx context.Context, filter AnnouncementFilter, announcement *Announcement) error {
+	coll := a.Client.Database(a.Database).Collection(a.Collection)
+
+	update := buildAnnouncementUpdater(announcement)
+
+	filter.Version = &announcement.Version
+	filterQuery, err := buildAnnouncementFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	logQuery(ctx, a.Collection, "updateOne", filterQuery)
+	result, err := coll.UpdateOne(ctx, filterQuery, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+// Delete deletes an Announcement from the database.
+func (a AnnouncementModel) Delete(ctx context.Context, filter AnnouncementFilter) error {
+	coll := a.Client.Database(a.Database).Collection(a.Collection)
+
+	filterQuery, err := buildAnnouncementFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	logQuery(ctx, a.Collection, "deleteOne", filterQuery)
+	result, err := coll.DeleteOne(ctx, filterQuery)
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return ErrDocumentNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,156 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+	"time"
+)
+
+// Actions of AuditEntries.
+const (
+	AuditTransactionForceReturned = "transaction.force_returned"
+	AuditTransactionCanceled      = "transaction.canceled"
+	AuditFineWaived               = "fine.waived"
+	AuditFineAdjusted             = "fine.adjusted"
+	AuditPaymentRecorded          = "payment.recorded"
+)
+
+// AuditEntry records a correction which an admin made to the circulation state, and the reason
+// for it, with the Code of the reason if it is one of a set of common reasons. Entries are
+// inserted in the same database transaction as the correction, and are never updated or deleted.
+type AuditEntry struct {
+	ID        string         `bson:"_id,omitempty" json:"id,omitempty"`
+	Action    string         `bson:"action" json:"action"`
+	Actor     string         `bson:"actor" json:"actor"`
+	TargetID  string         `bson:"target_id" json:"target_id"`
+	Reason    string         `bson:"reason" json:"reason"`
+	Code      string         `bson:"code,omitempty" json:"code,omitempty"`
+	Details   map[string]any `bson:"details,omitempty" json:"details,omitempty"`
+	CreatedAt time.Time      `bson:"created_at" json:"created_at"`
+}
+
+type AuditFilter struct {
+	Action   *string `json:"action,omitempty"`
+	Actor    *string `json:"actor,omitempty"`
+	TargetID *string `json:"target_id,omitempty"`
+}
+
+type AuditModel struct {
+	Client     *mongo.Client
+	Database   string
+	Collection string
+}
+
+// NewAuditEntry is a constructor for AuditEntry.
+func NewAuditEntry(action, actor, targetID, code, reason string, details map[string]any) *AuditEntry {
+	return &AuditEntry{
+		Action:    action,
+		Actor:     actor,
+		TargetID:  targetID,
+		Reason:    reason,
+		Code:      code,
+		Details:   details,
+		CreatedAt: time.Now(),
+	}
+}
+
+// buildAuditFilter constructs a filter query for filtering audit entries.
+func buildAuditFilter(filter AuditFilter) bson.M {
+	query := bson.M{}
+
+	if filter.Action != nil {
+		query[actionTag] = *filter.Action
+	}
+	if filter.Actor != nil {
+		query[actorTag] = *filter.Actor
+	}
+	if filter.TargetID != nil {
+		query[targetIDTag] = *filter.TargetID
+	}
+
+	return query
+}
+
+// CreateIndexes creates an index on the targets of the entries, so that the history of a
+// resource can be looked up.
+func (a AuditModel) CreateIndexes() error {
+	coll := a.Client.Database(a.Database).Collection(a.Collection)
+	indexModel := mongo.IndexModel{
+		Keys: bson.D{{Key: targetIDTag, Value: 1}, {Key: createdAtTag, Value: -1}},
+	}
+
+	_, err := coll.Indexes().CreateOne(context.TODO(), indexModel)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Insert inserts a new AuditEntry into the database.
+func (a AuditModel) Insert(ctx context.Context, entry *AuditEntry) (string, error) {
+	coll := a.Client.Database(a.Database).Collection(a.Collection)
+
+	res, err := coll.InsertOne(ctx, entry)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "_id_ dup key:"):
+			return "", ErrDuplicateID
+		default:
+			return "", err
+		}
+	}
+
+	if oid, ok := res.InsertedID.(primitive.ObjectID); ok {
+		return oid.Hex(), nil
+	}
+
+	return res.InsertedID.(string), nil
+}
+
+// GetAll retrieves a paginated list of AuditEntries from the database matching an optional filter and sorting.
+func (a AuditModel) GetAll(ctx context.Context, filter AuditFilter, paginator Paginator, sorter Sorter) ([]AuditEntry, Metadata, error) {
+	coll := a.Client.Database(a.Database).Collection(a.Collection, listOptions(ctx))
+
+	entries := make([]AuditEntry, 0)
+	metadata := Metadata{}
+
+	filterQuery := buildAuditFilter(filter)
+
+	sortQuery, err := buildSorter(sorter)
+	if err != nil {
+		return nil, Metadata{}, fmt.Errorf("%v: %v", errCreatingQuerySort, err)
+	}
+
+	findOpt := options.Find().SetSort(sortQuery).SetCollation(sorter.collation())
+
+	if paginator.valid() {
+		var totalRecords int64
+
+		findOpt = findOpt.SetLimit(paginator.limit()).SetSkip(paginator.offset())
+		totalRecords, err = coll.CountDocuments(ctx, filterQuery)
+		if err != nil {
+			return entries, Metadata{}, errCreatingQueryFilter
+		}
+
+		metadata = calculateMetadata(totalRecords, paginator.Page, paginator.PageSize)
+	}
+
+	logQuery(ctx, a.Collection, "find", filterQuery)
+	cursor, err := coll.Find(ctx, filterQuery, findOpt)
+	if err != nil {
+		return entries, Metadata{}, err
+	}
+	defer cursor.Close(ctx)
+
+	if err = cursor.All(ctx, &entries); err != nil {
+		return entries, Metadata{}, err
+	}
+
+	return entries, metadata, nil
+}
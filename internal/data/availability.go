@@ -0,0 +1,315 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+// BookAvailability is the availability of a Book and a summary of its loans. It is derived from
+// the books and transactions collections, and kept up to date from their change streams, so that
+// it can be queried without aggregating transactions.
+type BookAvailability struct {
+	BookID          string    `bson:"_id" json:"book_id"`
+	Title           string    `bson:"title" json:"title"`
+	ISBN            string    `bson:"isbn" json:"isbn"`
+	Copies          int       `bson:"copies" json:"copies"`
+	BorrowedCopies  int       `bson:"borrowed_copies" json:"borrowed_copies"`
+	AvailableCopies int       `bson:"available_copies" json:"available_copies"`
+	ActiveLoans     int       `bson:"active_loans" json:"active_loans"`
+	TotalLoans      int       `bson:"total_loans" json:"total_loans"`
+	LastBorrowedAt  time.Time `bson:"last_borrowed_at,omitempty" json:"last_borrowed_at,omitempty"`
+	LastReturnedAt  time.Time `bson:"last_returned_at,omitempty" json:"last_returned_at,omitempty"`
+	UpdatedAt       time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+type AvailabilityFilter struct {
+	BookID    *string `json:"book_id,omitempty"`
+	Available *bool   `json:"available,omitempty"`
+}
+
+// loanStats summarizes the transactions of a Book.
+type loanStats struct {
+	TotalLoans     int       `bson:"total_loans"`
+	ActiveLoans    int       `bson:"active_loans"`
+	LastBorrowedAt time.Time `bson:"last_borrowed_at"`
+	LastReturnedAt time.Time `bson:"last_returned_at"`
+}
+
+type AvailabilityModel struct {
+	Client                 *mongo.Client
+	Database               string
+	Collection             string
+	BooksCollection        string
+	TransactionsCollection string
+}
+
+// newBookAvailability returns the availability of a Book with the summary of its transactions.
+func newBookAvailability(book *Book, stats loanStats) *BookAvailability {
+	return &BookAvailability{
+		BookID:          book.ID,
+		Title:           book.Title,
+		ISBN:            book.ISBN(),
+		Copies:          book.Copies,
+		BorrowedCopies:  book.BorrowedCopies,
+		AvailableCopies: book.Copies - book.BorrowedCopies,
+		ActiveLoans:     stats.ActiveLoans,
+		TotalLoans:      stats.TotalLoans,
+		LastBorrowedAt:  stats.LastBorrowedAt,
+		LastReturnedAt:  stats.LastReturnedAt,
+		UpdatedAt:       time.Now(),
+	}
+}
+
+// buildAvailabilityFilter constructs a filter query for filtering the availability of books.
+func buildAvailabilityFilter(filter AvailabilityFilter) bson.M {
+	query := bson.M{}
+
+	if filter.BookID != nil {
+		query[idTag] = *filter.BookID
+	}
+	if filter.Available != nil {
+		if *filter.Available {
+			query[availableCopiesTag] = bson.M{"$gt": 0}
+		} else {
+			query[availableCopiesTag] = bson.M{"$lte": 0}
+		}
+	}
+
+	return query
+}
+
+// CreateIndexes creates indexes for listing the most borrowed and the available books.
+func (a AvailabilityModel) CreateIndexes() error {
+	coll := a.Client.Database(a.Database).Collection(a.Collection)
+	indexModels := []mongo.IndexModel{
+		{Keys: bson.D{{Key: activeLoansTag, Value: -1}}},
+		{Keys: bson.D{{Key: availableCopiesTag, Value: 1}}},
+	}
+
+	_, err := coll.Indexes().CreateMany(context.TODO(), indexModels)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Refresh derives the availability of a Book again from its document and transactions. The
+// availability of a Book which does not exist anymore is removed.
+func (a AvailabilityModel) Refresh(ctx context.Context, bookID string) error {
+	coll := a.Client.Database(a.Database).Collection(a.Collection)
+
+	books := BookModel{Client: a.Client, Database: a.Database, Collection: a.BooksCollection}
+	book, err := books.Get(ctx, BookFilter{ID: ptr(BookID(bookID))})
+	if err != nil {
+		if errors.Is(err, ErrDocumentNotFound) {
+			logQuery(ctx, a.Collection, "deleteOne", bson.M{idTag: bookID})
+			_, err = coll.DeleteOne(ctx, bson.M{idTag: bookID})
+		}
+		return err
+	}
+
+	stats, err := a.loanStats(ctx, bookID)
+	if err != nil {
+		return err
+	}
+
+	logQuery(ctx, a.Collection, "replaceOne", bson.M{idTag: bookID})
+	_, err = coll.ReplaceOne(ctx, bson.M{idTag: bookID}, newBookAvailability(book, stats), options.Replace().SetUpsert(true))
+
+	return err
+}
+
+// loanStats aggregates the transactions of a Book.
+func (a AvailabilityModel) loanStats(ctx context.Context, bookID string) (loanStats, error) {
+	coll := a.Client.Database(a.Database).Collection(a.TransactionsCollection)
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{bookIDTag: bookID}}},
+		{{Key: "$group", Value: bson.M{
+			idTag:         nil,
+			"total_loans": bson.M{"$sum": 1},
+			activeLoansTag: bson.M{"$sum": bson.M{
+				"$cond": bson.A{bson.M{"$eq": bson.A{"$" + statusTag, TransactionStatusBorrowed}}, 1, 0},
+			}},
+			"last_borrowed_at": bson.M{"$max": "$" + borrowedAtTag},
+			"last_returned_at": bson.M{"$max": "$" + returnedAtTag},
+		}}},
+	}
+
+	logQuery(ctx, a.TransactionsCollection, "aggregate", bson.M{bookIDTag: bookID})
+	cursor, err := coll.Aggregate(ctx, pipeline)
+	if err != nil {
+		return loanStats{}, err
+	}
+	defer cursor.Close(ctx)
+
+	var stats loanStats
+	if cursor.Next(ctx) {
+		if err = cursor.Decode(&stats); err != nil {
+			return loanStats{}, err
+		}
+	}
+
+	return stats, cursor.Err()
+}
+
+// Rebuild derives the availability of all books again, and removes the availability of books
+// which do not exist anymore. It returns the number of books.
+func (a AvailabilityModel) Rebuild(ctx context.Context) (int, error) {
+	books := a.Client.Database(a.Database).Collection(a.BooksCollection)
+
+	cursor, err := books.Find(ctx, bson.M{}, options.Find().SetProjection(bson.M{idTag: 1}))
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var ids []string
+	for cursor.Next(ctx) {
+		var book Book
+		if err = cursor.Decode(&book); err != nil {
+			return len(ids), err
+		}
+
+		if err = a.Refresh(ctx, book.ID); err != nil {
+			return len(ids), fmt.Errorf("failed to refresh availability of book %s: %v", book.ID, err)
+		}
+		ids = append(ids, book.ID)
+	}
+	if err = cursor.Err(); err != nil {
+		return len(ids), err
+	}
+
+	coll := a.Client.Database(a.Database).Collection(a.Collection)
+	_, err = coll.DeleteMany(ctx, bson.M{idTag: bson.M{"$nin": ids}})
+
+	return len(ids), err
+}
+
+// Watch keeps the availability of books up to date from the change streams of the books and
+// transactions collections until ctx is canceled. The availability of all books is rebuilt once
+// the streams are open, so that changes made while no one was watching are not missed.
+//
+// Change streams require a replica set. The book of a deleted transaction is unknown, so its
+// deletion is only reflected when the availability is rebuilt.
+func (a AvailabilityModel) Watch(ctx context.Context) error {
+	db := a.Client.Database(a.Database)
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"ns.coll": bson.M{"$in": bson.A{a.BooksCollection, a.TransactionsCollection}}}}},
+	}
+
+	stream, err := db.Watch(ctx, pipeline, options.ChangeStream().SetFullDocument(options.UpdateLookup))
+	if err != nil {
+		return fmt.Errorf("failed to watch changes: %v", err)
+	}
+	defer stream.Close(ctx)
+
+	if _, err = a.Rebuild(ctx); err != nil {
+		return err
+	}
+
+	for stream.Next(ctx) {
+		var change struct {
+			NS struct {
+				Coll string `bson:"coll"`
+			} `bson:"ns"`
+			DocumentKey struct {
+				ID interface{} `bson:"_id"`
+			} `bson:"documentKey"`
+			FullDocument struct {
+				BookID string `bson:"book_id"`
+			} `bson:"fullDocument"`
+		}
+		if err = stream.Decode(&change); err != nil {
+			return err
+		}
+
+		var bookID string
+		switch {
+		case change.NS.Coll == a.TransactionsCollection:
+			bookID = change.FullDocument.BookID
+		case change.NS.Coll == a.BooksCollection:
+			if oid, ok := change.DocumentKey.ID.(primitive.ObjectID); ok {
+				bookID = oid.Hex()
+			}
+		}
+		if bookID == "" {
+			continue
+		}
+
+		if err = a.Refresh(ctx, bookID); err != nil {
+			return fmt.Errorf("failed to refresh availability of book %s: %v", bookID, err)
+		}
+	}
+
+	return stream.Err()
+}
+
+// Get retrieves the availability of a Book.
+func (a AvailabilityModel) Get(ctx context.Context, bookID string) (*BookAvailability, error) {
+	coll := a.Client.Database(a.Database).Collection(a.Collection)
+
+	filterQuery := buildAvailabilityFilter(AvailabilityFilter{BookID: &bookID})
+	availability := &BookAvailability{}
+
+	logQuery(ctx, a.Collection, "findOne", filterQuery)
+	err := coll.FindOne(ctx, filterQuery).Decode(availability)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrDocumentNotFound
+		}
+		return nil, err
+	}
+
+	return availability, nil
+}
+
+// GetAll retrieves a paginated list of the availability of books matching an optional filter and sorting.
+func (a AvailabilityModel) GetAll(ctx context.Context, filter AvailabilityFilter, paginator Paginator, sorter Sorter) ([]BookAvailability, Metadata, error) {
+	coll := a.Client.Database(a.Database).Collection(a.Collection, listOptions(ctx))
+
+	availabilities := make([]BookAvailability, 0)
+	metadata := Metadata{}
+
+	filterQuery := buildAvailabilityFilter(filter)
+
+	sortQuery, err := buildSorter(sorter)
+	if err != nil {
+		return nil, Metadata{}, fmt.Errorf("%v: %v", errCreatingQuerySort, err)
+	}
+
+	findOpt := options.Find().SetSort(sortQuery).SetCollation(sorter.collation())
+
+	if paginator.valid() {
+		var totalRecords int64
+
+		findOpt = findOpt.SetLimit(paginator.limit()).SetSkip(paginator.offset())
+		totalRecords, err = coll.CountDocuments(ctx, filterQuery)
+		if err != nil {
+			return availabilities, Metadata{}, errCreatingQueryFilter
+		}
+
+		metadata = calculateMetadata(totalRecords, paginator.Page, paginator.PageSize)
+	}
+
+	logQuery(ctx, a.Collection, "find", filterQuery)
+	cursor, err := coll.Find(ctx, filterQuery, findOpt)
+	if err != nil {
+		return availabilities, Metadata{}, err
+	}
+	defer cursor.Close(ctx)
+
+	if err = cursor.All(ctx, &availabilities); err != nil {
+		return availabilities, Metadata{}, err
+	}
+
+	return availabilities, metadata, nil
+}
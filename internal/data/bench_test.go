@@ -0,0 +1,244 @@
+package data_test
+
+import (
+	"context"
+	"flag"
+	"github.com/mzeevi/library/internal/data"
+	"github.com/mzeevi/library/internal/data/testhelpers"
+	"github.com/mzeevi/library/internal/seed"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+const benchDatabase = "bench-library"
+
+var enforceThresholds = flag.Bool("thresholds", false, "fail benchmarks which are slower than their regression threshold")
+
+// bench holds the seeded models shared by all benchmarks. The container is started and seeded
+// once, by the first benchmark which needs it.
+var bench struct {
+	once      sync.Once
+	container *testhelpers.MongoDBContainer
+	models    data.Models
+	patronID  string
+	err       error
+}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+
+	if bench.container != nil {
+		if err := bench.container.Terminate(context.Background()); err != nil {
+			log.Printf("error terminating mongodb container: %s", err)
+		}
+	}
+
+	os.Exit(code)
+}
+
+// benchSize returns the number of documents to seed from an environment variable.
+func benchSize(key string, fallback int) int {
+	if n, err := strconv.Atoi(os.Getenv(key)); err == nil && n > 0 {
+		return n
+	}
+
+	return fallback
+}
+
+// benchModels returns models backed by a MongoDB container seeded with BENCH_BOOKS books,
+// BENCH_PATRONS patrons and BENCH_TRANSACTIONS transactions.
+func benchModels(b *testing.B) data.Models {
+	b.Helper()
+	testhelpers.SkipIfNoDocker(b)
+
+	bench.once.Do(func() {
+		ctx := context.Background()
+
+		bench.container, bench.err = testhelpers.CreateMongoDBContainer(ctx)
+		if bench.err != nil {
+			return
+		}
+
+		client, err := bench.container.Client(ctx)
+		if err != nil {
+			bench.err = err
+			return
+		}
+
+		bench.models = data.NewModels(client, benchDatabase, map[string]string{
+			data.BooksCollectionKey:        data.BooksCollectionKey,
+			data.PatronsCollectionKey:      data.PatronsCollectionKey,
+			data.TransactionsCollectionKey: data.TransactionsCollectionKey,
+		}, nil)
+
+		if err = bench.models.Books.CreateUniqueIndex(); err != nil {
+			bench.err = err
+			return
+		}
+		if err = bench.models.Patrons.CreateUniqueIndex(); err != nil {
+			bench.err = err
+			return
+		}
+
+		bench.err = seedBench(ctx, bench.models)
+	})
+
+	if bench.err != nil {
+		b.Fatalf("failed to set up benchmark database: %v", bench.err)
+	}
+
+	return bench.models
+}
+
+// seedBench fills the benchmark database with generated data.
+func seedBench(ctx context.Context, models data.Models) error {
+	g, err := seed.NewGenerator(1, "password")
+	if err != nil {
+		return err
+	}
+
+	books := g.Books(benchSize("BENCH_BOOKS", 10000))
+	patrons := g.Patrons(benchSize("BENCH_PATRONS", 1000))
+
+	bookIDs, err := models.Books.InsertMany(ctx, books)
+	if err != nil {
+		return err
+	}
+	for i, id := range bookIDs {
+		books[i].ID = id
+	}
+
+	patronIDs, err := models.Patrons.InsertMany(ctx, patrons)
+	if err != nil {
+		return err
+	}
+	for i, id := range patronIDs {
+		patrons[i].ID = id
+	}
+	bench.patronID = patronIDs[0]
+
+	_, err = models.Transactions.InsertMany(ctx, g.Transactions(benchSize("BENCH_TRANSACTIONS", 20000), books, patrons))
+	return err
+}
+
+// checkThreshold fails the benchmark if its average time per operation exceeds threshold,
+// when thresholds are enforced with -thresholds.
+func checkThreshold(b *testing.B, threshold time.Duration) {
+	b.Helper()
+
+	if !*enforceThresholds || b.N == 0 {
+		return
+	}
+
+	if perOp := b.Elapsed() / time.Duration(b.N); perOp > threshold {
+		b.Errorf("%s took %v per operation; regression threshold is %v", b.Name(), perOp, threshold)
+	}
+}
+
+func BenchmarkBooksGetAll(b *testing.B) {
+	models := benchModels(b)
+	ctx := context.Background()
+
+	sortFields := []string{"title", "-copies"}
+	page := data.Paginator{Page: 1, PageSize: 20}
+
+	benchmarks := []struct {
+		name      string
+		filter    data.BookFilter
+		paginator data.Paginator
+		sorter    data.Sorter
+		threshold time.Duration
+	}{
+		{name: "first page", paginator: page, threshold: 20 * time.Millisecond},
+		{name: "deep page", paginator: data.Paginator{Page: 400, PageSize: 20}, threshold: 50 * time.Millisecond},
+		{name: "title regex", filter: data.BookFilter{Title: ptr("river")}, paginator: page, threshold: 50 * time.Millisecond},
+		{name: "identifier", filter: data.BookFilter{Identifier: ptr("9780306406157")}, threshold: 5 * time.Millisecond},
+		{name: "genres", filter: data.BookFilter{Genres: []string{"Fantasy", "Mystery"}}, paginator: page, threshold: 50 * time.Millisecond},
+		{name: "copies range", filter: data.BookFilter{MinCopies: ptr(3), MaxCopies: ptr(6)}, paginator: page, threshold: 50 * time.Millisecond},
+		{name: "sort by title", paginator: page, sorter: data.Sorter{Field: "title", SortSafelist: sortFields}, threshold: 50 * time.Millisecond},
+		{name: "sort by copies", paginator: page, sorter: data.Sorter{Field: "-copies", SortSafelist: sortFields}, threshold: 50 * time.Millisecond},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, _, err := models.Books.GetAll(ctx, bm.filter, bm.paginator, bm.sorter); err != nil {
+					b.Fatalf("GetAll() error = %v", err)
+				}
+			}
+			checkThreshold(b, bm.threshold)
+		})
+	}
+}
+
+func BenchmarkPatronsGetAll(b *testing.B) {
+	models := benchModels(b)
+	ctx := context.Background()
+
+	page := data.Paginator{Page: 1, PageSize: 20}
+
+	benchmarks := []struct {
+		name      string
+		filter    data.PatronFilter
+		paginator data.Paginator
+		threshold time.Duration
+	}{
+		{name: "first page", paginator: page, threshold: 20 * time.Millisecond},
+		{name: "category", filter: data.PatronFilter{Category: ptr(data.TeacherCategory)}, paginator: page, threshold: 20 * time.Millisecond},
+		{name: "email", filter: data.PatronFilter{Email: ptr("olivia.smith.1@example.com")}, threshold: 5 * time.Millisecond},
+		{name: "name regex", filter: data.PatronFilter{Name: ptr("noa")}, paginator: page, threshold: 20 * time.Millisecond},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, _, err := models.Patrons.GetAll(ctx, bm.filter, bm.paginator, data.Sorter{}); err != nil {
+					b.Fatalf("GetAll() error = %v", err)
+				}
+			}
+			checkThreshold(b, bm.threshold)
+		})
+	}
+}
+
+func BenchmarkTransactionsGetAll(b *testing.B) {
+	models := benchModels(b)
+	ctx := context.Background()
+
+	sortFields := []string{"borrowed_at", "-due_date"}
+	page := data.Paginator{Page: 1, PageSize: 20}
+	now := time.Now()
+
+	benchmarks := []struct {
+		name      string
+		filter    data.TransactionFilter
+		paginator data.Paginator
+		sorter    data.Sorter
+		threshold time.Duration
+	}{
+		{name: "first page", paginator: page, threshold: 20 * time.Millisecond},
+		{name: "patron history", filter: data.TransactionFilter{PatronID: ptr(data.PatronID(bench.patronID))}, threshold: 50 * time.Millisecond},
+		{name: "overdue", filter: data.TransactionFilter{Status: ptr(data.TransactionStatusBorrowed), MaxDueDate: &now}, paginator: page, threshold: 50 * time.Millisecond},
+		{name: "sort by borrowed at", paginator: page, sorter: data.Sorter{Field: "borrowed_at", SortSafelist: sortFields}, threshold: 50 * time.Millisecond},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, _, err := models.Transactions.GetAll(ctx, bm.filter, bm.paginator, bm.sorter); err != nil {
+					b.Fatalf("GetAll() error = %v", err)
+				}
+			}
+			checkThreshold(b, bm.threshold)
+		})
+	}
+}
+
+// ptr is a generic helper function for creating a pointer to any type.
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -8,68 +8,187 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"regexp"
+	"slices"
 	"strings"
 	"time"
 )
 
 var (
-	ErrDuplicateISBN = errors.New("duplicate isbn")
+	ErrDuplicateIdentifier = errors.New("duplicate identifier")
 )
 
+// Types of Identifiers.
+const (
+	IdentifierISBN13 = "isbn13"
+	IdentifierISBN10 = "isbn10"
+	IdentifierEISBN  = "eisbn"
+	IdentifierOCLC   = "oclc"
+	IdentifierLCCN   = "lccn"
+)
+
+// Formats of Books.
+const (
+	FormatHardcover = "hardcover"
+	FormatPaperback = "paperback"
+	FormatEbook     = "ebook"
+	FormatAudiobook = "audiobook"
+)
+
+// Formats are the formats of Books, in print and in other media.
+var Formats = []string{FormatHardcover, FormatPaperback, FormatEbook, FormatAudiobook}
+
+// legacyISBNIndex is the name of the unique index of the ISBNs of Books, which was replaced by
+// the index of their Identifiers.
+const legacyISBNIndex = "isbn_-1"
+
+// Identifier identifies a Book in a numbering scheme, such as its ISBN-13 or the e-ISBN of its
+// electronic edition. A Book has at most one Identifier of each Type, and no two Books have the
+// same Identifier.
+type Identifier struct {
+	Type  string `bson:"type" json:"type"`
+	Value string `bson:"value" json:"value"`
+}
+
+// BookFile is a file attached to a Book, such as the PDF or EPUB of an e-book, which is kept in
+// the file storage under Key. SHA256 is the hex encoded hash of its content.
+type BookFile struct {
+	Key         string    `bson:"key" json:"-"`
+	Name        string    `bson:"name" json:"name"`
+	ContentType string    `bson:"content_type" json:"content_type"`
+	Size        int64     `bson:"size" json:"size"`
+	SHA256      string    `bson:"sha256" json:"sha256"`
+	UploadedAt  time.Time `bson:"uploaded_at" json:"uploaded_at"`
+}
+
+// Holding is the shelving of a copy of a Book, by the number of the copy from 1 to the Copies of
+// the Book: its CallNumber in the classification scheme of the library, and the ShelfLocation it
+// is shelved at, such as a room or a shelf.
+type Holding struct {
+	Copy          int    `bson:"copy" json:"copy"`
+	CallNumber    string `bson:"call_number,omitempty" json:"call_number,omitempty"`
+	ShelfLocation string `bson:"shelf_location,omitempty" json:"shelf_location,omitempty"`
+}
+
+// Circulation counts the returned loans of a Book: how many there were, when the last of them was
+// borrowed, and how many days they lasted on average.
+type Circulation struct {
+	Borrows         int       `bson:"borrows" json:"borrows"`
+	LastBorrowedAt  time.Time `bson:"last_borrowed_at,omitempty" json:"last_borrowed_at,omitempty"`
+	AverageLoanDays float64   `bson:"average_loan_days" json:"average_loan_days"`
+}
+
+// Book is a title of the catalog with its Copies in stock, of which BorrowedCopies are borrowed.
+// Copies which were withdrawn from the stock are not counted in Copies, but in WithdrawnCopies.
+// Language is the ISO 639-1 code of the language of the Book, and Format is one of Formats.
+// File is the file attached to the Book, if any, which patrons download while they borrow it.
+// PublisherIDs are the IDs of the Publishers whose names are Publishers, in the same order.
+// Holdings are the call numbers and shelf locations of its copies.
+// ExternalIDs are the IDs of the Book in other systems by the name of the system, such as its
+// accession number or its barcode in a legacy catalog.
+// Circulation counts its returned loans, by which books are sorted by popularity.
 type Book struct {
-	ID             string    `bson:"_id,omitempty" json:"id,omitempty"`
-	Pages          int       `bson:"pages" json:"pages"`
-	Edition        int       `bson:"edition" json:"edition"`
-	Copies         int       `bson:"copies" json:"copies"`
-	BorrowedCopies int       `bson:"borrowed_copies" json:"borrowed_copies"`
-	PublishedAt    time.Time `bson:"published_at" json:"published_at"`
-	CreatedAt      time.Time `bson:"created_at" json:"-"`
-	UpdatedAt      time.Time `bson:"updated_at" json:"-"`
-	Title          string    `bson:"title" json:"title"`
-	ISBN           string    `bson:"isbn" json:"isbn"`
-	Authors        []string  `bson:"authors" json:"authors"`
-	Publishers     []string  `bson:"publishers" json:"publishers"`
-	Genres         []string  `bson:"genres" json:"genres"`
-	Version        int32     `bson:"version" json:"-"`
+	ID              string            `bson:"_id,omitempty" json:"id,omitempty"`
+	Pages           int               `bson:"pages" json:"pages"`
+	Edition         int               `bson:"edition" json:"edition"`
+	Copies          int               `bson:"copies" json:"copies"`
+	BorrowedCopies  int               `bson:"borrowed_copies" json:"borrowed_copies"`
+	WithdrawnCopies int               `bson:"withdrawn_copies" json:"withdrawn_copies"`
+	PublishedAt     time.Time         `bson:"published_at" json:"published_at"`
+	CreatedAt       time.Time         `bson:"created_at" json:"-"`
+	UpdatedAt       time.Time         `bson:"updated_at" json:"-"`
+	Title           string            `bson:"title" json:"title"`
+	Identifiers     []Identifier      `bson:"identifiers" json:"identifiers"`
+	ExternalIDs     map[string]string `bson:"external_ids,omitempty" json:"external_ids,omitempty"`
+	Language        string            `bson:"language,omitempty" json:"language,omitempty"`
+	Format          string            `bson:"format,omitempty" json:"format,omitempty"`
+	Authors         []string          `bson:"authors" json:"authors"`
+	Publishers      []string          `bson:"publishers" json:"publishers"`
+	PublisherIDs    []string          `bson:"publisher_ids,omitempty" json:"publisher_ids,omitempty"`
+	Genres          []string          `bson:"genres" json:"genres"`
+	Holdings        []Holding         `bson:"holdings,omitempty" json:"holdings,omitempty"`
+	File            *BookFile         `bson:"file,omitempty" json:"file,omitempty"`
+	Circulation     Circulation       `bson:"circulation" json:"circulation"`
+	Version         int32             `bson:"version" json:"-"`
 }
 
 type BookFilter struct {
-	ID                *string    `json:"id,omitempty"`
-	MinPages          *int       `json:"min_pages,omitempty"`
-	MaxPages          *int       `json:"max_pages,omitempty"`
-	MinEdition        *int       `json:"min_edition,omitempty"`
-	MaxEdition        *int       `json:"max_edition,omitempty"`
-	MinPublishedAt    *time.Time `json:"min_published_at,omitempty"`
-	MaxPublishedAt    *time.Time `json:"max_published_at,omitempty"`
-	MinCreatedAt      *time.Time `json:"min_created_at,omitempty"`
-	MaxCreatedAt      *time.Time `json:"max_created_at,omitempty"`
-	MinUpdatedAt      *time.Time `json:"min_updated_at,omitempty"`
-	MaxUpdatedAt      *time.Time `json:"max_updated_at,omitempty"`
-	Title             *string    `json:"title,omitempty"`
-	ISBN              *string    `json:"isbn,omitempty"`
-	Authors           []string   `json:"authors,omitempty"`
-	Publishers        []string   `json:"publishers,omitempty"`
-	Genres            []string   `json:"genres,omitempty"`
-	Version           *int32     `json:"version,omitempty"`
-	MinCopies         *int       `json:"min_copies,omitempty"`
-	MaxCopies         *int       `json:"max_copies,omitempty"`
-	MinBorrowedCopies *int       `json:"min_borrowed_copies,omitempty"`
-	MaxBorrowedCopies *int       `json:"max_borrowed_copies,omitempty"`
+	ID                *BookID     `json:"id,omitempty"`
+	IDs               []BookID    `json:"ids,omitempty"`
+	MinPages          *int        `json:"min_pages,omitempty"`
+	MaxPages          *int        `json:"max_pages,omitempty"`
+	MinEdition        *int        `json:"min_edition,omitempty"`
+	MaxEdition        *int        `json:"max_edition,omitempty"`
+	MinPublishedAt    *time.Time  `json:"min_published_at,omitempty"`
+	MaxPublishedAt    *time.Time  `json:"max_published_at,omitempty"`
+	MinCreatedAt      *time.Time  `json:"min_created_at,omitempty"`
+	MaxCreatedAt      *time.Time  `json:"max_created_at,omitempty"`
+	MinUpdatedAt      *time.Time  `json:"min_updated_at,omitempty"`
+	MaxUpdatedAt      *time.Time  `json:"max_updated_at,omitempty"`
+	Title             *string     `json:"title,omitempty"`
+	TitleMatch        Match       `json:"title_match,omitempty"`
+	Identifier        *string     `json:"identifier,omitempty"`
+	ExternalID        *ExternalID `json:"external_id,omitempty"`
+	Language          *string     `json:"language,omitempty"`
+	Format            *string     `json:"format,omitempty"`
+	CallNumber        *string     `json:"call_number,omitempty"`
+	ShelfLocation     *string     `json:"shelf_location,omitempty"`
+	Authors           []string    `json:"authors,omitempty"`
+	ExcludeAuthors    []string    `json:"exclude_authors,omitempty"`
+	Publishers        []string    `json:"publishers,omitempty"`
+	PublisherIDs      []string    `json:"publisher_ids,omitempty"`
+	Genres            []string    `json:"genres,omitempty"`
+	ExcludeGenres     []string    `json:"exclude_genres,omitempty"`
+	Version           *int32      `json:"version,omitempty"`
+	MinCopies         *int        `json:"min_copies,omitempty"`
+	MaxCopies         *int        `json:"max_copies,omitempty"`
+	MinBorrowedCopies *int        `json:"min_borrowed_copies,omitempty"`
+	MaxBorrowedCopies *int        `json:"max_borrowed_copies,omitempty"`
+	// Available matches books with at least one copy which is not borrowed if true,
+	// and books with all copies borrowed if false.
+	Available *bool `json:"available,omitempty"`
+	// Keyword matches books whose title or one of whose authors contains it, regardless of case,
+	// or which have an identifier equal to it.
+	Keyword *string `json:"keyword,omitempty"`
 }
 
 type BookModel struct {
 	Client     *mongo.Client
 	Database   string
 	Collection string
+	// IndexHints hints queries by a field of a hinted index to use that index.
+	IndexHints bool
+}
+
+// bookHintedIndexes are the keys of the indexes of books which queries are hinted to use, in
+// order of preference, since the query planner may pick a collection scan for them on small or
+// skewed collections.
+var bookHintedIndexes = []bson.D{
+	{{Key: identifierValueTag, Value: 1}},
+	{{Key: callNumberTag, Value: 1}},
+	{{Key: publisherIDsTag, Value: 1}},
+}
+
+// RecordLoan counts a loan of the Book which was borrowed and returned at the given times.
+func (b *Book) RecordLoan(borrowedAt, returnedAt time.Time) {
+	c := &b.Circulation
+
+	days := max(returnedAt.Sub(borrowedAt), 0).Hours() / 24
+	c.AverageLoanDays = (c.AverageLoanDays*float64(c.Borrows) + days) / float64(c.Borrows+1)
+	c.Borrows++
+
+	if borrowedAt.After(c.LastBorrowedAt) {
+		c.LastBorrowedAt = borrowedAt
+	}
 }
 
-// NewBook creates a new book with the provided details.
+// NewBook creates a new book with the provided details, identified by its ISBN-13.
 func NewBook(id string, title, isbn string, pages, edition, copies int, authors, publishers, genres []string, publishedAt time.Time) *Book {
 	now := time.Now()
 	return &Book{
 		ID:          id,
 		Title:       title,
-		ISBN:        isbn,
+		Identifiers: []Identifier{{Type: IdentifierISBN13, Value: isbn}},
 		Copies:      copies,
 		Pages:       pages,
 		Edition:     edition,
@@ -82,12 +201,102 @@ func NewBook(id string, title, isbn string, pages, edition, copies int, authors,
 	}
 }
 
+// Identifier returns the value of the Identifier of the Book of a type, or an empty string if it
+// has none.
+func (b Book) Identifier(kind string) string {
+	for _, identifier := range b.Identifiers {
+		if identifier.Type == kind {
+			return identifier.Value
+		}
+	}
+
+	return ""
+}
+
+// ISBN returns the ISBN of the Book, which is its ISBN-13, or else its ISBN-10 or its e-ISBN.
+func (b Book) ISBN() string {
+	for _, kind := range []string{IdentifierISBN13, IdentifierISBN10, IdentifierEISBN} {
+		if value := b.Identifier(kind); value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
+
+// replacePublisher replaces the Publisher with fromID among the Publishers of the Book by to,
+// or removes it if the Book has to already. It reports whether the Book had the Publisher.
+func (b *Book) replacePublisher(fromID string, to *Publisher) bool {
+	ids, names := make([]string, 0, len(b.PublisherIDs)), make([]string, 0, len(b.Publishers))
+	replaced := false
+
+	for i, id := range b.PublisherIDs {
+		name := ""
+		if i < len(b.Publishers) {
+			name = b.Publishers[i]
+		}
+
+		if id == fromID {
+			id, name, replaced = to.ID, to.Name, true
+		}
+		if slices.Contains(ids, id) {
+			continue
+		}
+
+		ids, names = append(ids, id), append(names, name)
+	}
+
+	b.PublisherIDs, b.Publishers = ids, names
+
+	return replaced
+}
+
+// reassignPublisher replaces the Publisher with fromID by to in all Books, returning the IDs
+// of the updated Books. If fromID is the ID of to, the Books get its current name.
+func reassignPublisher(ctx context.Context, books BookStore, fromID string, to *Publisher) ([]string, error) {
+	found, _, err := books.GetAll(ctx, BookFilter{PublisherIDs: []string{fromID}}, Paginator{}, Sorter{})
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(found))
+	for _, book := range found {
+		if !book.replacePublisher(fromID, to) {
+			continue
+		}
+
+		if err = books.Update(ctx, BookFilter{ID: ptr(BookID(book.ID))}, &book); err != nil {
+			return ids, err
+		}
+		ids = append(ids, book.ID)
+	}
+
+	return ids, nil
+}
+
+// legacyIdentifier returns the Identifier of the ISBN of a Book which was stored before Books had
+// Identifiers. ISBNs were stored as given, so they are told apart by the number of their digits.
+func legacyIdentifier(isbn string) Identifier {
+	digits := strings.Map(func(r rune) rune {
+		if (r >= '0' && r <= '9') || r == 'X' || r == 'x' {
+			return r
+		}
+		return -1
+	}, isbn)
+
+	if len(digits) == 10 {
+		return Identifier{Type: IdentifierISBN10, Value: isbn}
+	}
+
+	return Identifier{Type: IdentifierISBN13, Value: isbn}
+}
+
 // buildBookFilter constructs a filter query for filtering books.
 func buildBookFilter(filter BookFilter) (bson.M, error) {
 	query := bson.M{}
 
-	if filter.ID != nil {
-		id, err := primitive.ObjectIDFromHex(*filter.ID)
+	if filter.ID != nil || filter.IDs != nil {
+		id, err := idQuery(filter.ID, filter.IDs)
 		if err != nil {
 			return query, err
 		}
@@ -144,19 +353,44 @@ func buildBookFilter(filter BookFilter) (bson.M, error) {
 		query[updatedAtTag] = updatedAtRange
 	}
 	if filter.Title != nil {
-		query[titleTag] = bson.M{"$regex": *filter.Title, "$options": "i"}
+		query[titleTag] = textQuery(*filter.Title, filter.TitleMatch)
+	}
+	if filter.Keyword != nil {
+		query["$or"] = bson.A{
+			bson.M{titleTag: textQuery(*filter.Keyword, MatchContains)},
+			bson.M{authorsTag: textQuery(*filter.Keyword, MatchContains)},
+			bson.M{identifierValueTag: *filter.Keyword},
+		}
+	}
+	if filter.Identifier != nil {
+		query[identifierValueTag] = *filter.Identifier
+	}
+	if filter.ExternalID != nil {
+		query[externalIDKey(filter.ExternalID.System)] = filter.ExternalID.Value
+	}
+	if filter.Language != nil {
+		query[languageTag] = *filter.Language
+	}
+	if filter.Format != nil {
+		query[formatTag] = *filter.Format
+	}
+	if filter.CallNumber != nil {
+		query[callNumberTag] = bson.M{"$regex": "^" + regexp.QuoteMeta(*filter.CallNumber)}
 	}
-	if filter.ISBN != nil {
-		query[isbnTag] = *filter.ISBN
+	if filter.ShelfLocation != nil {
+		query[shelfLocationTag] = *filter.ShelfLocation
 	}
-	if len(filter.Authors) > 0 {
-		query[authorsTag] = bson.M{"$in": filter.Authors}
+	if len(filter.Authors) > 0 || len(filter.ExcludeAuthors) > 0 {
+		query[authorsTag] = membershipQuery(filter.Authors, filter.ExcludeAuthors)
 	}
 	if len(filter.Publishers) > 0 {
 		query[publishersTag] = bson.M{"$in": filter.Publishers}
 	}
-	if len(filter.Genres) > 0 {
-		query[genresTag] = bson.M{"$in": filter.Genres}
+	if len(filter.PublisherIDs) > 0 {
+		query[publisherIDsTag] = bson.M{"$in": filter.PublisherIDs}
+	}
+	if len(filter.Genres) > 0 || len(filter.ExcludeGenres) > 0 {
+		query[genresTag] = membershipQuery(filter.Genres, filter.ExcludeGenres)
 	}
 	if filter.Version != nil {
 		query[versionTag] = *filter.Version
@@ -181,49 +415,157 @@ func buildBookFilter(filter BookFilter) (bson.M, error) {
 		}
 		query[borrowedCopiesTag] = borrowedCopiesRange
 	}
+	if filter.Available != nil {
+		operator := "$lt"
+		if !*filter.Available {
+			operator = "$gte"
+		}
+		query["$expr"] = bson.M{operator: bson.A{"$" + borrowedCopiesTag, "$" + copiesTag}}
+	}
 
 	return query, nil
 }
 
-// buildBookUpdater constructs an update document for updating a Book.
-func buildBookUpdater(book *Book) bson.D {
-	updateFields := bson.D{
+// bookFields returns the fields of a Book which are updated.
+func bookFields(book *Book) bson.D {
+	return bson.D{
 		{Key: titleTag, Value: book.Title},
-		{Key: isbnTag, Value: book.ISBN},
+		{Key: identifiersTag, Value: book.Identifiers},
+		{Key: externalIDsTag, Value: book.ExternalIDs},
+		{Key: languageTag, Value: book.Language},
+		{Key: formatTag, Value: book.Format},
 		{Key: pagesTag, Value: book.Pages},
 		{Key: editionTag, Value: book.Edition},
 		{Key: publishedAtTag, Value: book.PublishedAt},
 		{Key: authorsTag, Value: book.Authors},
 		{Key: publishersTag, Value: book.Publishers},
+		{Key: publisherIDsTag, Value: book.PublisherIDs},
 		{Key: genresTag, Value: book.Genres},
+		{Key: holdingsTag, Value: book.Holdings},
 		{Key: copiesTag, Value: book.Copies},
 		{Key: borrowedCopiesTag, Value: book.BorrowedCopies},
+		{Key: withdrawnCopiesTag, Value: book.WithdrawnCopies},
+		{Key: fileTag, Value: book.File},
+		{Key: circulationTag, Value: book.Circulation},
 	}
+}
+
+// buildBookUpdater constructs an update document for updating a Book.
+func buildBookUpdater(book *Book) bson.D {
+	return buildUpdater(bookFields(book))
+}
+
+// buildBookPatcher constructs an update document for updating only the fields of a Book which
+// differ from those of original.
+func buildBookPatcher(original, book *Book) bson.D {
+	fields := bookFields(book)
 
-	updateFields = append(updateFields, bson.E{Key: updatedAtTag, Value: time.Now()})
+	return buildUpdater(selectFields(fields, changedFields(bookFields(original), fields)))
+}
 
-	update := bson.D{
-		{Key: "$set", Value: updateFields},
-		{Key: "$inc", Value: bson.D{{Key: versionTag, Value: 1}}},
+// CreateUniqueIndex creates a unique index on the Identifiers of the books, and an index on their
+// values, by which books are looked up by any of their Identifiers. Identifiers are indexed as
+// whole documents, so that the same value may identify books in different numbering schemes.
+// Books which were stored before they had Identifiers are not indexed until they are migrated.
+// Books are also indexed by when they were updated, by which they are harvested, and by when they
+// were created, by which the new arrivals are listed.
+func (b BookModel) CreateUniqueIndex() error {
+	coll := b.Client.Database(b.Database).Collection(b.Collection)
+	indexModels := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: identifiersTag, Value: 1}},
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(bson.M{identifiersTag + "." + typeTag: bson.M{"$exists": true}}),
+		},
+		{
+			Keys: bson.D{{Key: identifierValueTag, Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: externalIDsTag + ".$**", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: publisherIDsTag, Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: callNumberTag, Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: updatedAtTag, Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: createdAtTag, Value: 1}},
+		},
+	}
+
+	_, err := coll.Indexes().CreateMany(context.TODO(), indexModels)
+	if err != nil {
+		return err
 	}
 
-	return update
+	return nil
 }
 
-// CreateUniqueIndex creates a unique index using a field.
-func (b BookModel) CreateUniqueIndex() error {
+// MigrateIdentifiers replaces the ISBN of all Books which were stored before Books had
+// Identifiers with its Identifier, returning the number of migrated Books. The unique index of
+// the ISBNs is dropped first, since it would not allow more than one Book without an ISBN.
+func (b BookModel) MigrateIdentifiers(ctx context.Context) (int, error) {
 	coll := b.Client.Database(b.Database).Collection(b.Collection)
-	indexModel := mongo.IndexModel{
-		Keys:    bson.D{{Key: isbnTag, Value: -1}},
-		Options: options.Index().SetUnique(true),
+
+	if _, err := coll.Indexes().DropOne(ctx, legacyISBNIndex); err != nil {
+		var commandErr mongo.CommandError
+		if !errors.As(err, &commandErr) || (commandErr.Name != "IndexNotFound" && commandErr.Name != "NamespaceNotFound") {
+			return 0, err
+		}
 	}
 
-	_, err := coll.Indexes().CreateOne(context.TODO(), indexModel)
+	cursor, err := coll.Find(ctx, bson.M{isbnTag: bson.M{"$exists": true}})
 	if err != nil {
-		return err
+		return 0, err
 	}
+	defer cursor.Close(ctx)
 
-	return nil
+	migrated := 0
+	for cursor.Next(ctx) {
+		var legacy struct {
+			ID          primitive.ObjectID `bson:"_id"`
+			ISBN        string             `bson:"isbn"`
+			Identifiers []Identifier       `bson:"identifiers"`
+		}
+		if err = cursor.Decode(&legacy); err != nil {
+			return migrated, err
+		}
+
+		identifiers := legacy.Identifiers
+		if legacy.ISBN != "" {
+			identifiers = append(identifiers, legacyIdentifier(legacy.ISBN))
+		}
+
+		update := bson.D{
+			{Key: "$set", Value: bson.D{{Key: identifiersTag, Value: identifiers}}},
+			{Key: "$unset", Value: bson.D{{Key: isbnTag, Value: ""}}},
+		}
+
+		if _, err = coll.UpdateOne(ctx, bson.M{idTag: legacy.ID}, update); err != nil {
+			if strings.Contains(err.Error(), "identifiers_1 dup key") {
+				return migrated, fmt.Errorf("%w: book %s (%s)", ErrDuplicateIdentifier, legacy.ID.Hex(), legacy.ISBN)
+			}
+			return migrated, err
+		}
+
+		migrated++
+	}
+
+	if err = cursor.Err(); err != nil {
+		return migrated, err
+	}
+
+	return migrated, nil
+}
+
+// ReassignPublisher replaces the Publisher with fromID by to in all Books, returning the IDs
+// of the updated Books.
+func (b BookModel) ReassignPublisher(ctx context.Context, fromID string, to *Publisher) ([]string, error) {
+	return reassignPublisher(ctx, b, fromID, to)
 }
 
 // Insert inserts a new Book into the database.
@@ -238,8 +580,8 @@ func (b BookModel) Insert(ctx context.Context, book *Book) (string, error) {
 		switch {
 		case strings.Contains(err.Error(), "_id_ dup key:"):
 			return "", ErrDuplicateID
-		case strings.Contains(err.Error(), "isbn_-1 dup key"):
-			return "", ErrDuplicateISBN
+		case strings.Contains(err.Error(), "identifiers_1 dup key"):
+			return "", ErrDuplicateIdentifier
 		default:
 			return "", err
 		}
@@ -252,18 +594,49 @@ func (b BookModel) Insert(ctx context.Context, book *Book) (string, error) {
 	return res.InsertedID.(string), nil
 }
 
+// InsertMany inserts multiple Books into the database, returning their IDs.
+func (b BookModel) InsertMany(ctx context.Context, books []*Book) ([]string, error) {
+	coll := b.Client.Database(b.Database).Collection(b.Collection)
+
+	now := time.Now()
+	documents := make([]interface{}, 0, len(books))
+	for _, book := range books {
+		book.CreatedAt = now
+		book.UpdatedAt = now
+		documents = append(documents, book)
+	}
+
+	res, err := coll.InsertMany(ctx, documents)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "identifiers_1 dup key"):
+			return nil, ErrDuplicateIdentifier
+		default:
+			return nil, err
+		}
+	}
+
+	return insertedIDs(res.InsertedIDs), nil
+}
+
 // Get retrieves a single Book from the database matching an optional filter.
 func (b BookModel) Get(ctx context.Context, filter BookFilter) (*Book, error) {
 	coll := b.Client.Database(b.Database).Collection(b.Collection)
 
 	filterQuery, err := buildBookFilter(filter)
 	if err != nil {
-		return nil, fmt.Errorf("%v: %v", errCreatingQueryFilter, err)
+		return nil, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
 	}
 
 	book := &Book{}
 
-	err = coll.FindOne(ctx, filterQuery).Decode(book)
+	findOpt := options.FindOne()
+	if hint := b.indexHint(filterQuery); hint != nil {
+		findOpt = findOpt.SetHint(hint)
+	}
+
+	logQuery(ctx, b.Collection, "findOne", filterQuery)
+	err = coll.FindOne(ctx, filterQuery, findOpt).Decode(book)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			return nil, ErrDocumentNotFound
@@ -274,16 +647,30 @@ func (b BookModel) Get(ctx context.Context, filter BookFilter) (*Book, error) {
 	return book, nil
 }
 
+// indexHint returns the hint of a query by the filter, or nil if queries are not hinted or the
+// filter is not by a field of a hinted index.
+func (b BookModel) indexHint(filter bson.M) interface{} {
+	if !b.IndexHints {
+		return nil
+	}
+
+	if keys := hintedIndex(filter, bookHintedIndexes); keys != nil {
+		return keys
+	}
+
+	return nil
+}
+
 // GetAll retrieves all mockBooks from the database matching an optional filter and paginator.
 func (b BookModel) GetAll(ctx context.Context, filter BookFilter, paginator Paginator, sorter Sorter) ([]Book, Metadata, error) {
-	coll := b.Client.Database(b.Database).Collection(b.Collection)
+	coll := b.Client.Database(b.Database).Collection(b.Collection, listOptions(ctx))
 
 	books := make([]Book, 0)
 	metadata := Metadata{}
 
 	filterQuery, err := buildBookFilter(filter)
 	if err != nil {
-		return books, Metadata{}, fmt.Errorf("%v: %v", errCreatingQueryFilter, err)
+		return books, Metadata{}, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
 	}
 
 	sortQuery, err := buildSorter(sorter)
@@ -291,20 +678,26 @@ func (b BookModel) GetAll(ctx context.Context, filter BookFilter, paginator Pagi
 		return books, Metadata{}, fmt.Errorf("%v: %v", errCreatingQuerySort, err)
 	}
 
-	findOpt := options.Find().SetSort(sortQuery)
+	findOpt := options.Find().SetSort(sortQuery).SetCollation(sorter.collation())
+	countOpt := options.Count()
+	if hint := b.indexHint(filterQuery); hint != nil {
+		findOpt = findOpt.SetHint(hint)
+		countOpt = countOpt.SetHint(hint)
+	}
 
 	if paginator.valid() {
 		var totalRecords int64
 
 		findOpt = findOpt.SetLimit(paginator.limit()).SetSkip(paginator.offset())
-		totalRecords, err = coll.CountDocuments(ctx, filterQuery)
+		totalRecords, err = coll.CountDocuments(ctx, filterQuery, countOpt)
 		if err != nil {
-			return books, Metadata{}, fmt.Errorf("%v: %v", errCreatingQueryFilter, err)
+			return books, Metadata{}, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
 		}
 
 		metadata = calculateMetadata(totalRecords, paginator.Page, paginator.PageSize)
 	}
 
+	logQuery(ctx, b.Collection, "find", filterQuery)
 	cursor, err := coll.Find(ctx, filterQuery, findOpt)
 	if err != nil {
 		return books, Metadata{}, err
@@ -327,7 +720,8 @@ func (b BookModel) GetAll(ctx context.Context, filter BookFilter, paginator Pagi
 	return books, metadata, nil
 }
 
-// Update updates a Book's details in the database.
+// Update updates a Book's details in the database. ErrDocumentNotFound is returned if no Book
+// matches the filter, and ErrEditConflict if its version was changed by another update.
 func (b BookModel) Update(ctx context.Context, filter BookFilter, book *Book) error {
 	coll := b.Client.Database(b.Database).Collection(b.Collection)
 
@@ -336,23 +730,53 @@ func (b BookModel) Update(ctx context.Context, filter BookFilter, book *Book) er
 	filter.Version = &book.Version
 	filterQuery, err := buildBookFilter(filter)
 	if err != nil {
-		return fmt.Errorf("%v: %v", errCreatingQueryFilter, err)
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
 	}
 
+	logQuery(ctx, b.Collection, "updateOne", filterQuery)
 	result, err := coll.UpdateOne(ctx, filterQuery, update)
 	if err != nil {
 		switch {
 		case strings.Contains(err.Error(), "_id_ dup key:"):
 			return ErrDuplicateID
-		case strings.Contains(err.Error(), "isbn_-1 dup key"):
-			return ErrDuplicateISBN
+		case strings.Contains(err.Error(), "identifiers_1 dup key"):
+			return ErrDuplicateIdentifier
 		default:
 			return err
 		}
 	}
 
 	if result.MatchedCount == 0 {
-		return ErrEditConflict
+		return unmatchedUpdateError(ctx, coll, filterQuery)
+	}
+
+	return nil
+}
+
+// Patch updates only the fields of a Book which differ from those of original, so that the
+// fields which other updates set concurrently are kept. Unlike Update, the version of the Book
+// is not checked. ErrDocumentNotFound is returned if no Book matches the filter.
+func (b BookModel) Patch(ctx context.Context, filter BookFilter, original, book *Book) error {
+	coll := b.Client.Database(b.Database).Collection(b.Collection)
+
+	filterQuery, err := buildBookFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	logQuery(ctx, b.Collection, "updateOne", filterQuery)
+	result, err := coll.UpdateOne(ctx, filterQuery, buildBookPatcher(original, book))
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "identifiers_1 dup key"):
+			return ErrDuplicateIdentifier
+		default:
+			return err
+		}
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrDocumentNotFound
 	}
 
 	return nil
@@ -364,9 +788,10 @@ func (b BookModel) Delete(ctx context.Context, filter BookFilter) error {
 
 	filterQuery, err := buildBookFilter(filter)
 	if err != nil {
-		return fmt.Errorf("%v: %v", errCreatingQueryFilter, err)
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
 	}
 
+	logQuery(ctx, b.Collection, "deleteOne", filterQuery)
 	result, err := coll.DeleteOne(ctx, filterQuery)
 	if err != nil {
 		return err
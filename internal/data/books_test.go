@@ -116,7 +116,7 @@ func (ts *TestSuite) TestGetBook() {
 	}{
 		{
 			name:        "FindByID",
-			filter:      BookFilter{ID: ptr(testBooksIDs[4].(primitive.ObjectID).Hex())},
+			filter:      BookFilter{ID: ptr(BookID(testBooksIDs[4].(primitive.ObjectID).Hex()))},
 			expectedID:  testBooksIDs[4].(primitive.ObjectID).Hex(),
 			expectError: false,
 		},
@@ -615,6 +615,40 @@ func (ts *TestSuite) TestGetAllBooks() {
 			expectedCount:    0,
 			expectError:      false,
 		},
+		{
+			name: "FilterByAvailable",
+			filter: BookFilter{
+				Title:     ptr("Test"),
+				MinCopies: ptr(8),
+				Available: ptr(true),
+			},
+			paginator: Paginator{Page: 1, PageSize: 2},
+			expectedIDs: []string{
+				testBooksIDs[5].(primitive.ObjectID).Hex(),
+				testBooksIDs[6].(primitive.ObjectID).Hex(),
+			},
+			expectedMetadata: Metadata{
+				CurrentPage:  1,
+				PageSize:     2,
+				FirstPage:    1,
+				LastPage:     1,
+				TotalRecords: 2,
+			},
+			expectedCount: 2,
+			expectError:   false,
+		},
+		{
+			name: "FilterByUnavailable",
+			filter: BookFilter{
+				Title:     ptr("Test"),
+				Available: ptr(false),
+			},
+			paginator:        Paginator{Page: 1, PageSize: 3},
+			expectedIDs:      []string{},
+			expectedMetadata: Metadata{},
+			expectedCount:    0,
+			expectError:      false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -684,21 +718,21 @@ func (ts *TestSuite) TestUpdateBook() {
 	for _, tt := range tests {
 		ts.Run(tt.name, func() {
 			if tt.expectError {
-				err := ts.models.Books.Update(ts.ctx, BookFilter{ID: &tt.initialBook.ID}, &tt.updateData)
-				assert.ErrorIs(t, err, ErrEditConflict)
+				err := ts.models.Books.Update(ts.ctx, BookFilter{ID: ptr(BookID(tt.initialBook.ID))}, &tt.updateData)
+				assert.ErrorIs(t, err, ErrDocumentNotFound)
 			} else {
 				id, err := ts.models.Books.Insert(ts.ctx, &tt.initialBook)
 				assert.NoError(t, err)
 
-				err = ts.models.Books.Update(ts.ctx, BookFilter{ID: &id}, &tt.updateData)
+				err = ts.models.Books.Update(ts.ctx, BookFilter{ID: ptr(BookID(id))}, &tt.updateData)
 				assert.NoError(t, err)
 
-				updatedBook, err := ts.models.Books.Get(ts.ctx, BookFilter{ID: &id})
+				updatedBook, err := ts.models.Books.Get(ts.ctx, BookFilter{ID: ptr(BookID(id))})
 				assert.NoError(t, err)
 
 				assert.Equal(t, updatedBook.Version, int32(1))
 
-				err = ts.deleteBooksFromDB(BookFilter{ID: &id})
+				err = ts.deleteBooksFromDB(BookFilter{ID: ptr(BookID(id))})
 				assert.NoError(t, err)
 			}
 		})
@@ -732,18 +766,31 @@ func (ts *TestSuite) TestDeleteBook() {
 	for _, tt := range tests {
 		ts.Run(tt.name, func() {
 			if tt.expectError {
-				err := ts.models.Books.Delete(ts.ctx, BookFilter{ID: &tt.initialBook.ID})
+				err := ts.models.Books.Delete(ts.ctx, BookFilter{ID: ptr(BookID(tt.initialBook.ID))})
 				assert.ErrorIs(t, err, ErrDocumentNotFound)
 			} else {
 				id, err := ts.models.Books.Insert(ts.ctx, &tt.initialBook)
 				assert.NoError(t, err)
 
-				err = ts.models.Books.Delete(ts.ctx, BookFilter{ID: &id})
+				err = ts.models.Books.Delete(ts.ctx, BookFilter{ID: ptr(BookID(id))})
 				assert.NoError(t, err)
 
-				_, err = ts.models.Books.Get(ts.ctx, BookFilter{ID: &id})
+				_, err = ts.models.Books.Get(ts.ctx, BookFilter{ID: ptr(BookID(id))})
 				assert.ErrorIs(t, err, ErrDocumentNotFound)
 			}
 		})
 	}
 }
+
+func TestBookRecordLoan(t *testing.T) {
+	borrowedAt := time.Date(2024, time.March, 1, 10, 0, 0, 0, time.UTC)
+
+	book := &Book{}
+	book.RecordLoan(borrowedAt, borrowedAt.Add(4*24*time.Hour))
+	book.RecordLoan(borrowedAt.Add(-30*24*time.Hour), borrowedAt.Add(-20*24*time.Hour))
+
+	want := Circulation{Borrows: 2, LastBorrowedAt: borrowedAt, AverageLoanDays: 7}
+	if book.Circulation != want {
+		t.Errorf("Circulation = %+v; want %+v", book.Circulation, want)
+	}
+}
@@ -0,0 +1,264 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+	"time"
+)
+
+// Names of the default Categories, which are created on start.
+const (
+	StudentCategory = "student"
+	TeacherCategory = "teacher"
+)
+
+var (
+	ErrDuplicateCategory = errors.New("duplicate category")
+)
+
+// LoanPolicy defines how many books Patrons of a Category may borrow, and for how long.
+type LoanPolicy struct {
+	MaxBorrowedBooks int `bson:"max_borrowed_books" json:"max_borrowed_books"`
+	LoanPeriodDays   int `bson:"loan_period_days" json:"loan_period_days"`
+}
+
+type Category struct {
+	ID                 string     `bson:"_id,omitempty" json:"id,omitempty"`
+	Name               string     `bson:"name" json:"name"`
+	DiscountPercentage float64    `bson:"discount_percentage" json:"discount_percentage"`
+	LoanPolicy         LoanPolicy `bson:"loan_policy" json:"loan_policy"`
+	CreatedAt          time.Time  `bson:"created_at" json:"-"`
+	UpdatedAt          time.Time  `bson:"updated_at" json:"-"`
+	Version            int32      `bson:"version" json:"-"`
+}
+
+type CategoryFilter struct {
+	ID      *string `json:"id,omitempty"`
+	Name    *string `json:"name,omitempty"`
+	Version *int32  `json:"-,omitempty"`
+}
+
+type CategoryModel struct {
+	Client     *mongo.Client
+	Database   string
+	Collection string
+}
+
+// NewCategory constructs a new Category.
+func NewCategory(id, name string, discountPercentage float64, loanPolicy LoanPolicy) *Category {
+	now := time.Now()
+	return &Category{
+		ID:                 id,
+		Name:               name,
+		DiscountPercentage: discountPercentage,
+		LoanPolicy:         loanPolicy,
+		CreatedAt:          now,
+		UpdatedAt:          now,
+	}
+}
+
+// buildCategoryFilter constructs a filter query for filtering categories.
+func buildCategoryFilter(filter CategoryFilter) (bson.M, error) {
+	query := bson.M{}
+
+	if filter.ID != nil {
+		id, err := objectID(*filter.ID)
+		if err != nil {
+			return query, err
+		}
+		query[idTag] = id
+	}
+
+	if filter.Name != nil {
+		query[nameTag] = *filter.Name
+	}
+
+	if filter.Version != nil {
+		query[versionTag] = *filter.Version
+	}
+
+	return query, nil
+}
+
+// buildCategoryUpdater constructs an update query for updating a category.
+func buildCategoryUpdater(category *Category) bson.D {
+	updateFields := bson.D{
+		{Key: nameTag, Value: category.Name},
+		{Key: discountPercentageTag, Value: category.DiscountPercentage},
+		{Key: loanPolicyTag, Value: category.LoanPolicy},
+		{Key: updatedAtTag, Value: time.Now()},
+	}
+
+	update := bson.D{
+		{Key: "$set", Value: updateFields},
+		{Key: "$inc", Value: bson.D{{Key: versionTag, Value: 1}}},
+	}
+
+	return update
+}
+
+// CreateUniqueIndex creates a unique index using a field.
+func (c CategoryModel) CreateUniqueIndex() error {
+	coll := c.Client.Database(c.Database).Collection(c.Collection)
+	indexModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: nameTag, Value: -1}},
+		Options: options.Index().SetUnique(true),
+	}
+
+	_, err := coll.Indexes().CreateOne(context.TODO(), indexModel)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// EnsureDefaults inserts the given Categories if no Category with the same name exists.
+// Existing Categories are left untouched, so changes made by admins are kept.
+func (c CategoryModel) EnsureDefaults(ctx context.Context, categories []*Category) error {
+	coll := c.Client.Database(c.Database).Collection(c.Collection)
+
+	for _, category := range categories {
+		filter := bson.M{nameTag: category.Name}
+		update := bson.M{"$setOnInsert": category}
+
+		_, err := coll.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+		if err != nil && !strings.Contains(err.Error(), "name_-1 dup key") {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Insert inserts a new Category into the database.
+func (c CategoryModel) Insert(ctx context.Context, category *Category) (string, error) {
+	coll := c.Client.Database(c.Database).Collection(c.Collection)
+
+	category.CreatedAt = time.Now()
+	category.UpdatedAt = time.Now()
+
+	res, err := coll.InsertOne(ctx, category)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "_id_ dup key:"):
+			return "", ErrDuplicateID
+		case strings.Contains(err.Error(), "name_-1 dup key"):
+			return "", ErrDuplicateCategory
+		default:
+			return "", err
+		}
+	}
+
+	if oid, ok := res.InsertedID.(primitive.ObjectID); ok {
+		return oid.Hex(), nil
+	}
+
+	return res.InsertedID.(string), nil
+}
+
+// Get retrieves a single Category from the database matching an optional filter.
+func (c CategoryModel) Get(ctx context.Context, filter CategoryFilter) (*Category, error) {
+	coll := c.Client.Database(c.Database).Collection(c.Collection)
+
+	filterQuery, err := buildCategoryFilter(filter)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	category := &Category{}
+
+	logQuery(ctx, c.Collection, "findOne", filterQuery)
+	err = coll.FindOne(ctx, filterQuery).Decode(category)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrDocumentNotFound
+		}
+		return nil, err
+	}
+
+	return category, nil
+}
+
+// GetAll retrieves all Categories from the database matching an optional filter, sorted by name.
+func (c CategoryModel) GetAll(ctx context.Context, filter CategoryFilter) ([]Category, error) {
+	coll := c.Client.Database(c.Database).Collection(c.Collection, listOptions(ctx))
+
+	categories := make([]Category, 0)
+
+	filterQuery, err := buildCategoryFilter(filter)
+	if err != nil {
+		return categories, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	logQuery(ctx, c.Collection, "find", filterQuery)
+	cursor, err := coll.Find(ctx, filterQuery, options.Find().SetSort(bson.D{{Key: nameTag, Value: 1}}))
+	if err != nil {
+		return categories, err
+	}
+	defer cursor.Close(ctx)
+
+	if err = cursor.All(ctx, &categories); err != nil {
+		return categories, err
+	}
+
+	return categories, nil
+}
+
+// Update updates a Category in the database matching a filter.
+func (c CategoryModel) Update(ctx context.Context, filter CategoryFilter, category *Category) error {
+	coll := c.Client.Database(c.Database).Collection(c.Collection)
+
+	update := buildCategoryUpdater(category)
+
+	filter.Version = &category.Version
+	filterQuery, err := buildCategoryFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	logQuery(ctx, c.Collection, "updateOne", filterQuery)
+	result, err := coll.UpdateOne(ctx, filterQuery, update)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "name_-1 dup key"):
+			return ErrDuplicateCategory
+		default:
+			return err
+		}
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+// Delete deletes a Category from the database by filter.
+func (c CategoryModel) Delete(ctx context.Context, filter CategoryFilter) error {
+	coll := c.Client.Database(c.Database).Collection(c.Collection)
+
+	filterQuery, err := buildCategoryFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	logQuery(ctx, c.Collection, "deleteOne", filterQuery)
+	result, err := coll.DeleteOne(ctx, filterQuery)
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return ErrDocumentNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+	"time"
+)
+
+// DailyStats are the circulation aggregates of a day, which are rolled up from the transactions
+// and the patrons once the day is over. The ID is the date of the day in the library time zone.
+// Rollups are never updated or deleted, so they outlive the history which the retention policy
+// anonymizes or deletes.
+type DailyStats struct {
+	ID         string    `bson:"_id" json:"date"`
+	Date       time.Time `bson:"date" json:"-"`
+	Borrows    int       `bson:"borrows" json:"borrows"`
+	Returns    int       `bson:"returns" json:"returns"`
+	NewPatrons int64     `bson:"new_patrons" json:"new_patrons"`
+	Fines      float64   `bson:"fines" json:"fines"`
+	CreatedAt  time.Time `bson:"created_at" json:"created_at"`
+}
+
+type DailyStatsFilter struct {
+	MinDate *time.Time `json:"min_date,omitempty"`
+	MaxDate *time.Time `json:"max_date,omitempty"`
+}
+
+type DailyStatsModel struct {
+	Client     *mongo.Client
+	Database   string
+	Collection string
+}
+
+// buildDailyStatsFilter constructs a filter query for filtering daily stats.
+func buildDailyStatsFilter(filter DailyStatsFilter) bson.M {
+	query := bson.M{}
+
+	if filter.MinDate != nil || filter.MaxDate != nil {
+		dateRange := bson.M{}
+		if filter.MinDate != nil {
+			dateRange["$gte"] = *filter.MinDate
+		}
+		if filter.MaxDate != nil {
+			dateRange["$lte"] = *filter.MaxDate
+		}
+		query[dateTag] = dateRange
+	}
+
+	return query
+}
+
+// CreateIndexes creates an index on the dates of the rollups, so that a range of days can be looked up.
+func (d DailyStatsModel) CreateIndexes() error {
+	coll := d.Client.Database(d.Database).Collection(d.Collection)
+	indexModel := mongo.IndexModel{
+		Keys: bson.D{{Key: dateTag, Value: 1}},
+	}
+
+	_, err := coll.Indexes().CreateOne(context.TODO(), indexModel)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Insert inserts new DailyStats into the database. It returns ErrDuplicateID if the day was already rolled up.
+func (d DailyStatsModel) Insert(ctx context.Context, stats *DailyStats) error {
+	coll := d.Client.Database(d.Database).Collection(d.Collection)
+
+	_, err := coll.InsertOne(ctx, stats)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "_id_ dup key:"):
+			return ErrDuplicateID
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetAll retrieves a paginated list of DailyStats from the database matching an optional filter and sorting.
+func (d DailyStatsModel) GetAll(ctx context.Context, filter DailyStatsFilter, paginator Paginator, sorter Sorter) ([]DailyStats, Metadata, error) {
+	coll := d.Client.Database(d.Database).Collection(d.Collection, listOptions(ctx))
+
+	stats := make([]DailyStats, 0)
+	metadata := Metadata{}
+
+	filterQuery := buildDailyStatsFilter(filter)
+
+	sortQuery, err := buildSorter(sorter)
+	if err != nil {
+		return nil, Metadata{}, fmt.Errorf("%v: %v", errCreatingQuerySort, err)
+	}
+
+	findOpt := options.Find().SetSort(sortQuery).SetCollation(sorter.collation())
+
+	if paginator.valid() {
+		var totalRecords int64
+
+		findOpt = findOpt.SetLimit(paginator.limit()).SetSkip(paginator.offset())
+		totalRecords, err = coll.CountDocuments(ctx, filterQuery)
+		if err != nil {
+			return stats, Metadata{}, errCreatingQueryFilter
+		}
+
+		metadata = calculateMetadata(totalRecords, paginator.Page, paginator.PageSize)
+	}
+
+	logQuery(ctx, d.Collection, "find", filterQuery)
+	cursor, err := coll.Find(ctx, filterQuery, findOpt)
+	if err != nil {
+		return stats, Metadata{}, err
+	}
+	defer cursor.Close(ctx)
+
+	if err = cursor.All(ctx, &stats); err != nil {
+		return stats, Metadata{}, err
+	}
+
+	return stats, metadata, nil
+}
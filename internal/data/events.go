@@ -0,0 +1,264 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+	"time"
+)
+
+// Types of domain Events.
+const (
+	EventBookCreated   = "book.created"
+	EventBookUpdated   = "book.updated"
+	EventBookDeleted   = "book.deleted"
+	EventBookBorrowed  = "book.borrowed"
+	EventBookReturned  = "book.returned"
+	EventPatronCreated = "patron.created"
+)
+
+const (
+	EventStatusPending    = "pending"
+	EventStatusDispatched = "dispatched"
+	EventStatusFailed     = "failed"
+)
+
+// Event is a domain event in the outbox. Events are inserted in the same database transaction
+// as the change they describe, and are dispatched to subscribers afterward, so that no event
+// is lost if the server stops in between.
+type Event struct {
+	ID      string          `bson:"_id,omitempty" json:"id,omitempty"`
+	Type    string          `bson:"type" json:"type"`
+	Payload json.RawMessage `bson:"payload" json:"payload"`
+	Status  string          `bson:"status" json:"status"`
+	// Delivered are the names of the subscribers which handled the Event, which are skipped when it is retried.
+	Delivered     []string  `bson:"delivered" json:"delivered"`
+	Attempts      int       `bson:"attempts" json:"attempts"`
+	LastError     string    `bson:"last_error,omitempty" json:"last_error,omitempty"`
+	NextAttemptAt time.Time `bson:"next_attempt_at" json:"next_attempt_at"`
+	DispatchedAt  time.Time `bson:"dispatched_at,omitempty" json:"dispatched_at,omitempty"`
+	CreatedAt     time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt     time.Time `bson:"updated_at" json:"-"`
+	Version       int32     `bson:"version" json:"-"`
+}
+
+type EventFilter struct {
+	ID               *string    `json:"id,omitempty"`
+	Type             *string    `json:"type,omitempty"`
+	Status           *string    `json:"status,omitempty"`
+	MaxNextAttemptAt *time.Time `json:"max_next_attempt_at,omitempty"`
+	Version          *int32     `json:"-,omitempty"`
+}
+
+type EventModel struct {
+	Client     *mongo.Client
+	Database   string
+	Collection string
+}
+
+// NewEvent constructs a new pending Event with a payload encoded as JSON.
+func NewEvent(eventType string, payload any) (*Event, error) {
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s event: %v", eventType, err)
+	}
+
+	now := time.Now()
+
+	return &Event{
+		Type:          eventType,
+		Payload:       encoded,
+		Status:        EventStatusPending,
+		Delivered:     []string{},
+		NextAttemptAt: now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}, nil
+}
+
+// buildEventFilter constructs a filter query for filtering events.
+func buildEventFilter(filter EventFilter) (bson.M, error) {
+	query := bson.M{}
+
+	if filter.ID != nil {
+		id, err := objectID(*filter.ID)
+		if err != nil {
+			return query, err
+		}
+		query[idTag] = id
+	}
+	if filter.Type != nil {
+		query[typeTag] = *filter.Type
+	}
+	if filter.Status != nil {
+		query[statusTag] = *filter.Status
+	}
+	if filter.MaxNextAttemptAt != nil {
+		query[nextAttemptAtTag] = bson.M{"$lte": *filter.MaxNextAttemptAt}
+	}
+	if filter.Version != nil {
+		query[versionTag] = *filter.Version
+	}
+
+	return query, nil
+}
+
+// buildEventUpdater constructs an update document for recording the dispatch of an Event.
+func buildEventUpdater(event *Event) bson.D {
+	updateFields := bson.D{
+		{Key: statusTag, Value: event.Status},
+		{Key: deliveredTag, Value: event.Delivered},
+		{Key: attemptsTag, Value: event.Attempts},
+		{Key: lastErrorTag, Value: event.LastError},
+		{Key: nextAttemptAtTag, Value: event.NextAttemptAt},
+		{Key: dispatchedAtTag, Value: event.DispatchedAt},
+		{Key: updatedAtTag, Value: time.Now()},
+	}
+
+	update := bson.D{
+		{Key: "$set", Value: updateFields},
+		{Key: "$inc", Value: bson.D{{Key: versionTag, Value: 1}}},
+	}
+
+	return update
+}
+
+// CreateIndexes creates an index for finding the Events which are due to be dispatched.
+func (e EventModel) CreateIndexes() error {
+	coll := e.Client.Database(e.Database).Collection(e.Collection)
+	indexModel := mongo.IndexModel{
+		Keys: bson.D{{Key: statusTag, Value: 1}, {Key: nextAttemptAtTag, Value: 1}},
+	}
+
+	_, err := coll.Indexes().CreateOne(context.TODO(), indexModel)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Insert inserts a new Event into the database. It should be called within the database
+// transaction of the change which the Event describes.
+func (e EventModel) Insert(ctx context.Context, event *Event) (string, error) {
+	coll := e.Client.Database(e.Database).Collection(e.Collection)
+
+	event.CreatedAt = time.Now()
+	event.UpdatedAt = time.Now()
+
+	res, err := coll.InsertOne(ctx, event)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "_id_ dup key:"):
+			return "", ErrDuplicateID
+		default:
+			return "", err
+		}
+	}
+
+	if oid, ok := res.InsertedID.(primitive.ObjectID); ok {
+		return oid.Hex(), nil
+	}
+
+	return res.InsertedID.(string), nil
+}
+
+// Get retrieves a single Event from the database matching an optional filter.
+func (e EventModel) Get(ctx context.Context, filter EventFilter) (*Event, error) {
+	coll := e.Client.Database(e.Database).Collection(e.Collection)
+
+	filterQuery, err := buildEventFilter(filter)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	event := &Event{}
+
+	logQuery(ctx, e.Collection, "findOne", filterQuery)
+	err = coll.FindOne(ctx, filterQuery).Decode(event)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrDocumentNotFound
+		}
+		return nil, err
+	}
+
+	return event, nil
+}
+
+// GetAll retrieves a paginated list of Events from the database matching an optional filter and sorting.
+func (e EventModel) GetAll(ctx context.Context, filter EventFilter, paginator Paginator, sorter Sorter) ([]Event, Metadata, error) {
+	coll := e.Client.Database(e.Database).Collection(e.Collection, listOptions(ctx))
+
+	events := make([]Event, 0)
+	metadata := Metadata{}
+
+	filterQuery, err := buildEventFilter(filter)
+	if err != nil {
+		return events, Metadata{}, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	sortQuery, err := buildSorter(sorter)
+	if err != nil {
+		return nil, Metadata{}, fmt.Errorf("%v: %v", errCreatingQuerySort, err)
+	}
+
+	findOpt := options.Find().SetSort(sortQuery).SetCollation(sorter.collation())
+
+	if paginator.valid() {
+		var totalRecords int64
+
+		findOpt = findOpt.SetLimit(paginator.limit()).SetSkip(paginator.offset())
+		totalRecords, err = coll.CountDocuments(ctx, filterQuery)
+		if err != nil {
+			return events, Metadata{}, errCreatingQueryFilter
+		}
+
+		metadata = calculateMetadata(totalRecords, paginator.Page, paginator.PageSize)
+	}
+
+	logQuery(ctx, e.Collection, "find", filterQuery)
+	cursor, err := coll.Find(ctx, filterQuery, findOpt)
+	if err != nil {
+		return events, Metadata{}, err
+	}
+	defer cursor.Close(ctx)
+
+	if err = cursor.All(ctx, &events); err != nil {
+		return events, Metadata{}, err
+	}
+
+	return events, metadata, nil
+}
+
+// Update records the dispatch of an Event in the database matching a filter. ErrEditConflict
+// is returned if the Event was updated since it was read, for example by another dispatcher.
+func (e EventModel) Update(ctx context.Context, filter EventFilter, event *Event) error {
+	coll := e.Client.Database(e.Database).Collection(e.Collection)
+
+	update := buildEventUpdater(event)
+
+	filter.Version = &event.Version
+	filterQuery, err := buildEventFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	logQuery(ctx, e.Collection, "updateOne", filterQuery)
+	result, err := coll.UpdateOne(ctx, filterQuery, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
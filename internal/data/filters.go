@@ -3,9 +3,25 @@ package data
 import (
 	"fmt"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"regexp"
 	"strings"
+	"time"
 )
 
+// Match is how a text filter, such as the title of books, matches the values of a field.
+type Match string
+
+const (
+	MatchContains Match = "contains"
+	MatchExact    Match = "exact"
+	MatchPrefix   Match = "prefix"
+)
+
+// timeNow returns the current time, relative to which filters such as overdue transactions are
+// built. It is replaced in tests.
+var timeNow = time.Now
+
 type Paginator struct {
 	Page     int64
 	PageSize int64
@@ -14,6 +30,9 @@ type Paginator struct {
 type Sorter struct {
 	Field        string
 	SortSafelist []string
+	// Collation is the locale by which text is sorted, such as he or en_US. Text is sorted by
+	// its bytes if it is empty.
+	Collation string
 }
 
 type Metadata struct {
@@ -36,6 +55,14 @@ func (p Paginator) offset() int64 {
 	return (p.Page - 1) * p.PageSize
 }
 
+// sortFieldTags maps the sort fields which are not named as the fields of documents to them.
+var sortFieldTags = map[string]string{
+	"id":             idTag,
+	"borrowedCopies": borrowedCopiesTag,
+	"publishedAt":    publishedAtTag,
+	"popularity":     circulationBorrowsTag,
+}
+
 func (s Sorter) field() (string, error) {
 	if s.Field == "" {
 		return "", nil
@@ -43,7 +70,11 @@ func (s Sorter) field() (string, error) {
 
 	for _, safeValue := range s.SortSafelist {
 		if s.Field == safeValue {
-			return strings.TrimPrefix(s.Field, "-"), nil
+			field := strings.TrimPrefix(s.Field, "-")
+			if tag, ok := sortFieldTags[field]; ok {
+				return tag, nil
+			}
+			return field, nil
 		}
 	}
 
@@ -58,7 +89,26 @@ func (s Sorter) sortDirection() int {
 	return 1
 }
 
+// collation returns the collation by which the sorter sorts text, or nil if it sorts it by its bytes.
+func (s Sorter) collation() *options.Collation {
+	if s.Collation == "" {
+		return nil
+	}
+
+	return &options.Collation{Locale: s.Collation}
+}
+
 // calculateMetadata returns metadata regarding pagination.
+// NewMetadata returns the Metadata of a page of results, for results which are not queried
+// from the database, such as the results of a search index.
+func NewMetadata(totalRecords int64, paginator Paginator) Metadata {
+	if !paginator.valid() {
+		return Metadata{}
+	}
+
+	return calculateMetadata(totalRecords, paginator.Page, paginator.PageSize)
+}
+
 func calculateMetadata(totalRecords, page, pageSize int64) Metadata {
 	if totalRecords == 0 {
 		return Metadata{}
@@ -86,3 +136,45 @@ func buildSorter(sorter Sorter) (bson.D, error) {
 
 	return bson.D{{Key: field, Value: sorter.sortDirection()}}, nil
 }
+
+// textQuery returns a case-insensitive regular expression matching the values of a field which
+// contain text, equal it or begin with it, as set by match, and contain it if match is empty.
+// The text is escaped, so that it is matched literally rather than run as a pattern, which could
+// be invalid or take long to evaluate.
+func textQuery(text string, match Match) bson.M {
+	pattern := regexp.QuoteMeta(text)
+	switch match {
+	case MatchExact:
+		pattern = "^" + pattern + "$"
+	case MatchPrefix:
+		pattern = "^" + pattern
+	}
+
+	return bson.M{"$regex": pattern, "$options": "i"}
+}
+
+// membershipQuery returns the operators matching a field with a value, or an element, which is in
+// in, unless in is empty, and none which is in nin, unless nin is empty.
+func membershipQuery(in, nin []string) bson.M {
+	operators := bson.M{}
+	if len(in) > 0 {
+		operators["$in"] = in
+	}
+	if len(nin) > 0 {
+		operators["$nin"] = nin
+	}
+
+	return operators
+}
+
+// hintedIndex returns the keys of the first of the indexes whose leading field the filter is by,
+// or nil if there is none.
+func hintedIndex(filter bson.M, indexes []bson.D) bson.D {
+	for _, keys := range indexes {
+		if _, ok := filter[keys[0].Key]; ok {
+			return keys
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,233 @@
+package data
+
+import (
+	"bytes"
+	"github.com/mzeevi/library/internal/encryption"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// filterTest is a case of a filter builder: a filter and the query which is built for it.
+type filterTest[F any] struct {
+	name   string
+	filter F
+	want   bson.M
+}
+
+// runFilterTests runs the cases of a filter builder. Every field of the filter must be set by at
+// least one case, so that a field which is added to the filter is tested too.
+func runFilterTests[F any](t *testing.T, build func(F) (bson.M, error), tests []filterTest[F]) {
+	t.Helper()
+
+	covered := map[string]bool{}
+	for _, tt := range tests {
+		v := reflect.ValueOf(tt.filter)
+		for i := 0; i < v.NumField(); i++ {
+			if !v.Field(i).IsZero() {
+				covered[v.Type().Field(i).Name] = true
+			}
+		}
+
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := build(tt.filter)
+			if err != nil {
+				t.Fatalf("build(%+v) error = %v", tt.filter, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("build(%+v) = %v; want %v", tt.filter, got, tt.want)
+			}
+		})
+	}
+
+	filterType := reflect.TypeFor[F]()
+	for i := 0; i < filterType.NumField(); i++ {
+		if name := filterType.Field(i).Name; !covered[name] {
+			t.Errorf("%s.%s is not set by any case", filterType.Name(), name)
+		}
+	}
+}
+
+var (
+	filterFrom = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	filterTo   = time.Date(2024, time.December, 31, 0, 0, 0, 0, time.UTC)
+	filterHex  = "5f1b2c3d4e5f6a7b8c9d0e1f"
+	filterOID  = func() primitive.ObjectID { id, _ := primitive.ObjectIDFromHex(filterHex); return id }()
+)
+
+func TestBuildBookFilter(t *testing.T) {
+	runFilterTests(t, buildBookFilter, []filterTest[BookFilter]{
+		{name: "Empty", filter: BookFilter{}, want: bson.M{}},
+		{name: "ID", filter: BookFilter{ID: ptr(BookID(filterHex))}, want: bson.M{idTag: filterOID}},
+		{name: "IDs", filter: BookFilter{IDs: []BookID{BookID(filterHex)}}, want: bson.M{idTag: bson.M{"$in": bson.A{filterOID}}}},
+		{name: "IDAndIDs", filter: BookFilter{ID: ptr(BookID(filterHex)), IDs: []BookID{}}, want: bson.M{idTag: bson.M{"$in": bson.A{}}}},
+		{name: "Pages", filter: BookFilter{MinPages: ptr(10), MaxPages: ptr(20)}, want: bson.M{pagesTag: bson.M{"$gte": 10, "$lte": 20}}},
+		{name: "Edition", filter: BookFilter{MinEdition: ptr(1), MaxEdition: ptr(2)}, want: bson.M{editionTag: bson.M{"$gte": 1, "$lte": 2}}},
+		{name: "PublishedAt", filter: BookFilter{MinPublishedAt: &filterFrom, MaxPublishedAt: &filterTo}, want: bson.M{publishedAtTag: bson.M{"$gte": filterFrom, "$lte": filterTo}}},
+		{name: "CreatedAt", filter: BookFilter{MinCreatedAt: &filterFrom, MaxCreatedAt: &filterTo}, want: bson.M{createdAtTag: bson.M{"$gte": filterFrom, "$lte": filterTo}}},
+		{name: "UpdatedAt", filter: BookFilter{MinUpdatedAt: &filterFrom, MaxUpdatedAt: &filterTo}, want: bson.M{updatedAtTag: bson.M{"$gte": filterFrom, "$lte": filterTo}}},
+		{name: "Title", filter: BookFilter{Title: ptr("Dune (1965)")}, want: bson.M{titleTag: bson.M{"$regex": `Dune \(1965\)`, "$options": "i"}}},
+		{name: "TitleExact", filter: BookFilter{Title: ptr("Dune (1965)"), TitleMatch: MatchExact}, want: bson.M{titleTag: bson.M{"$regex": `^Dune \(1965\)$`, "$options": "i"}}},
+		{name: "TitlePrefix", filter: BookFilter{Title: ptr("Dune"), TitleMatch: MatchPrefix}, want: bson.M{titleTag: bson.M{"$regex": `^Dune`, "$options": "i"}}},
+		{name: "Identifier", filter: BookFilter{Identifier: ptr("9780306406157")}, want: bson.M{identifierValueTag: "9780306406157"}},
+		{name: "ExternalID", filter: BookFilter{ExternalID: &ExternalID{System: "legacy_ils", Value: "B004213"}}, want: bson.M{"external_ids.legacy_ils": "B004213"}},
+		{name: "Language", filter: BookFilter{Language: ptr("en")}, want: bson.M{languageTag: "en"}},
+		{name: "Format", filter: BookFilter{Format: ptr("ebook")}, want: bson.M{formatTag: "ebook"}},
+		{name: "CallNumber", filter: BookFilter{CallNumber: ptr("QA76.73")}, want: bson.M{callNumberTag: bson.M{"$regex": `^QA76\.73`}}},
+		{name: "ShelfLocation", filter: BookFilter{ShelfLocation: ptr("Main")}, want: bson.M{shelfLocationTag: "Main"}},
+		{name: "Authors", filter: BookFilter{Authors: []string{"Herbert"}}, want: bson.M{authorsTag: bson.M{"$in": []string{"Herbert"}}}},
+		{name: "ExcludeAuthors", filter: BookFilter{ExcludeAuthors: []string{"Anderson"}}, want: bson.M{authorsTag: bson.M{"$nin": []string{"Anderson"}}}},
+		{name: "Publishers", filter: BookFilter{Publishers: []string{"Chilton"}}, want: bson.M{publishersTag: bson.M{"$in": []string{"Chilton"}}}},
+		{name: "PublisherIDs", filter: BookFilter{PublisherIDs: []string{filterHex}}, want: bson.M{publisherIDsTag: bson.M{"$in": []string{filterHex}}}},
+		{name: "Genres", filter: BookFilter{Genres: []string{"Fiction"}}, want: bson.M{genresTag: bson.M{"$in": []string{"Fiction"}}}},
+		{
+			name:   "GenresAndExcludeGenres",
+			filter: BookFilter{Genres: []string{"Fiction"}, ExcludeGenres: []string{"Romance"}},
+			want:   bson.M{genresTag: bson.M{"$in": []string{"Fiction"}, "$nin": []string{"Romance"}}},
+		},
+		{name: "Version", filter: BookFilter{Version: ptr(int32(3))}, want: bson.M{versionTag: int32(3)}},
+		{name: "Copies", filter: BookFilter{MinCopies: ptr(1), MaxCopies: ptr(5)}, want: bson.M{copiesTag: bson.M{"$gte": 1, "$lte": 5}}},
+		{name: "BorrowedCopies", filter: BookFilter{MinBorrowedCopies: ptr(0), MaxBorrowedCopies: ptr(2)}, want: bson.M{borrowedCopiesTag: bson.M{"$gte": 0, "$lte": 2}}},
+		{name: "MinOnly", filter: BookFilter{MinPages: ptr(10)}, want: bson.M{pagesTag: bson.M{"$gte": 10}}},
+		{name: "Available", filter: BookFilter{Available: ptr(true)}, want: bson.M{"$expr": bson.M{"$lt": bson.A{"$" + borrowedCopiesTag, "$" + copiesTag}}}},
+		{name: "Unavailable", filter: BookFilter{Available: ptr(false)}, want: bson.M{"$expr": bson.M{"$gte": bson.A{"$" + borrowedCopiesTag, "$" + copiesTag}}}},
+		{name: "Keyword", filter: BookFilter{Keyword: ptr("Le Guin")}, want: bson.M{"$or": bson.A{
+			bson.M{titleTag: bson.M{"$regex": `Le Guin`, "$options": "i"}},
+			bson.M{authorsTag: bson.M{"$regex": `Le Guin`, "$options": "i"}},
+			bson.M{identifierValueTag: "Le Guin"},
+		}}},
+	})
+}
+
+func TestBuildPatronFilter(t *testing.T) {
+	runFilterTests(t, buildPatronFilter, []filterTest[PatronFilter]{
+		{name: "Empty", filter: PatronFilter{}, want: bson.M{}},
+		{name: "ID", filter: PatronFilter{ID: ptr(PatronID(filterHex))}, want: bson.M{idTag: filterOID}},
+		{name: "IDs", filter: PatronFilter{IDs: []PatronID{PatronID(filterHex)}}, want: bson.M{idTag: bson.M{"$in": bson.A{filterOID}}}},
+		{name: "IDAndIDs", filter: PatronFilter{ID: ptr(PatronID(filterHex)), IDs: []PatronID{}}, want: bson.M{idTag: bson.M{"$in": bson.A{}}}},
+		{name: "Name", filter: PatronFilter{Name: ptr("Ann.")}, want: bson.M{nameTag: bson.M{"$regex": `Ann\.`, "$options": "i"}}},
+		{name: "NameExact", filter: PatronFilter{Name: ptr("Ann (Jr.)"), NameMatch: MatchExact}, want: bson.M{nameTag: bson.M{"$regex": `^Ann \(Jr\.\)$`, "$options": "i"}}},
+		{name: "Email", filter: PatronFilter{Email: ptr(" Reader@Example.com ")}, want: bson.M{emailTag: "reader@example.com"}},
+		{name: "Keyword", filter: PatronFilter{Keyword: ptr("ann.")}, want: bson.M{"$or": bson.A{
+			bson.M{nameTag: bson.M{"$regex": `ann\.`, "$options": "i"}},
+			bson.M{emailTag: bson.M{"$regex": `ann\.`, "$options": "i"}},
+		}}},
+		{name: "Category", filter: PatronFilter{Category: ptr("student")}, want: bson.M{categoryTag: "student"}},
+		{name: "Version", filter: PatronFilter{Version: ptr(int32(1))}, want: bson.M{versionTag: int32(1)}},
+		{name: "ExternalID", filter: PatronFilter{ExternalID: &ExternalID{System: "sis", Value: "1001"}}, want: bson.M{"external_ids.sis": "1001"}},
+		{name: "CreatedAt", filter: PatronFilter{MinCreatedAt: &filterFrom, MaxCreatedAt: &filterTo}, want: bson.M{createdAtTag: bson.M{"$gte": filterFrom, "$lte": filterTo}}},
+		{name: "UpdatedAt", filter: PatronFilter{MinUpdatedAt: &filterFrom, MaxUpdatedAt: &filterTo}, want: bson.M{updatedAtTag: bson.M{"$gte": filterFrom, "$lte": filterTo}}},
+	})
+}
+
+func TestPatronModelBuildFilter(t *testing.T) {
+	cipher, err := encryption.NewCipher(bytes.Repeat([]byte("k"), 32))
+	if err != nil {
+		t.Fatalf("NewCipher() error = %v", err)
+	}
+	model := PatronModel{Cipher: cipher}
+	unmigrated := bson.M{"$exists": false}
+
+	tests := []struct {
+		name   string
+		filter PatronFilter
+		want   bson.M
+	}{
+		{name: "Email", filter: PatronFilter{Email: ptr(" Reader@Example.com ")}, want: bson.M{"$and": bson.A{
+			bson.M{"$or": bson.A{
+				bson.M{emailDigestTag: cipher.Digest("reader@example.com")},
+				bson.M{emailDigestTag: unmigrated, emailTag: "reader@example.com"},
+			}},
+		}}},
+		{name: "NameAndKeyword", filter: PatronFilter{Name: ptr(" Ann "), NameMatch: MatchExact, Keyword: ptr("ANN")}, want: bson.M{"$and": bson.A{
+			bson.M{"$or": bson.A{
+				bson.M{nameDigestTag: cipher.Digest("ann")},
+				bson.M{nameDigestTag: unmigrated, nameTag: bson.M{"$regex": `^ Ann $`, "$options": "i"}},
+			}},
+			bson.M{"$or": bson.A{
+				bson.M{nameDigestTag: cipher.Digest("ann")},
+				bson.M{emailDigestTag: cipher.Digest("ann")},
+				bson.M{emailDigestTag: unmigrated, "$or": bson.A{
+					bson.M{nameTag: bson.M{"$regex": `ANN`, "$options": "i"}},
+					bson.M{emailTag: bson.M{"$regex": `ANN`, "$options": "i"}},
+				}},
+			}},
+		}}},
+		{name: "Category", filter: PatronFilter{Category: ptr("student")}, want: bson.M{categoryTag: "student"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := model.buildFilter(tt.filter)
+			if err != nil {
+				t.Fatalf("buildFilter(%+v) error = %v", tt.filter, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("buildFilter(%+v) = %v; want %v", tt.filter, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildTransactionFilter(t *testing.T) {
+	fixed := time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return fixed }
+	defer func() { timeNow = time.Now }()
+
+	overdue := bson.M{statusTag: TransactionStatusBorrowed, dueDateTag: bson.M{"$lt": fixed}}
+
+	runFilterTests(t, buildTransactionFilter, []filterTest[TransactionFilter]{
+		{name: "Empty", filter: TransactionFilter{}, want: bson.M{}},
+		{name: "ID", filter: TransactionFilter{ID: ptr(TransactionID(filterHex))}, want: bson.M{idTag: filterOID}},
+		{name: "IDs", filter: TransactionFilter{IDs: []TransactionID{TransactionID(filterHex)}}, want: bson.M{idTag: bson.M{"$in": bson.A{filterOID}}}},
+		{name: "IDAndIDs", filter: TransactionFilter{ID: ptr(TransactionID(filterHex)), IDs: []TransactionID{}}, want: bson.M{idTag: bson.M{"$in": bson.A{}}}},
+		{name: "PatronID", filter: TransactionFilter{PatronID: ptr(PatronID(filterHex))}, want: bson.M{patronIDTag: filterHex}},
+		{name: "BookID", filter: TransactionFilter{BookID: ptr(BookID(filterHex))}, want: bson.M{bookIDTag: filterHex}},
+		{name: "PatronIDs", filter: TransactionFilter{PatronIDs: []PatronID{PatronID(filterHex)}}, want: bson.M{patronIDTag: bson.M{"$in": bson.A{filterHex}}}},
+		{name: "BookIDs", filter: TransactionFilter{BookIDs: []BookID{}}, want: bson.M{bookIDTag: bson.M{"$in": bson.A{}}}},
+		{name: "BookIDAndBookIDs", filter: TransactionFilter{BookID: ptr(BookID(filterHex)), BookIDs: []BookID{BookID(filterHex)}}, want: bson.M{bookIDTag: bson.M{"$in": bson.A{filterHex}}}},
+		{name: "Status", filter: TransactionFilter{Status: ptr(TransactionStatusReturned)}, want: bson.M{statusTag: TransactionStatusReturned}},
+		{name: "NotStatus", filter: TransactionFilter{NotStatus: []string{TransactionStatusCanceled}}, want: bson.M{statusTag: bson.M{"$nin": []string{TransactionStatusCanceled}}}},
+		{
+			name:   "StatusAndNotStatus",
+			filter: TransactionFilter{Status: ptr(TransactionStatusReturned), NotStatus: []string{TransactionStatusReturned}},
+			want:   bson.M{statusTag: bson.M{"$in": []string{TransactionStatusReturned}, "$nin": []string{TransactionStatusReturned}}},
+		},
+		{name: "BorrowedAt", filter: TransactionFilter{MinBorrowedAt: &filterFrom, MaxBorrowedAt: &filterTo}, want: bson.M{borrowedAtTag: bson.M{"$gte": filterFrom, "$lte": filterTo}}},
+		{name: "DueDate", filter: TransactionFilter{MinDueDate: &filterFrom, MaxDueDate: &filterTo}, want: bson.M{dueDateTag: bson.M{"$gte": filterFrom, "$lte": filterTo}}},
+		{name: "ReturnedAt", filter: TransactionFilter{MinReturnedAt: &filterFrom, MaxReturnedAt: &filterTo}, want: bson.M{returnedAtTag: bson.M{"$gte": filterFrom, "$lte": filterTo}}},
+		{
+			name:   "ReturnedAndBorrowedAt",
+			filter: TransactionFilter{MinReturnedAt: &filterTo, MaxBorrowedAt: &filterFrom},
+			want:   bson.M{returnedAtTag: bson.M{"$gte": filterTo}, borrowedAtTag: bson.M{"$lte": filterFrom}},
+		},
+		{name: "CreatedAt", filter: TransactionFilter{MinCreatedAt: &filterFrom, MaxCreatedAt: &filterTo}, want: bson.M{createdAtTag: bson.M{"$gte": filterFrom, "$lte": filterTo}}},
+		{name: "UpdatedAt", filter: TransactionFilter{MinUpdatedAt: &filterFrom, MaxUpdatedAt: &filterTo}, want: bson.M{updatedAtTag: bson.M{"$gte": filterFrom, "$lte": filterTo}}},
+		{name: "Version", filter: TransactionFilter{Version: ptr(int32(2))}, want: bson.M{versionTag: int32(2)}},
+		{name: "Digital", filter: TransactionFilter{Digital: ptr(true)}, want: bson.M{digitalTag: true}},
+		{name: "NotDigital", filter: TransactionFilter{Digital: ptr(false)}, want: bson.M{digitalTag: bson.M{"$nin": bson.A{true}}}},
+		{name: "Anonymized", filter: TransactionFilter{Anonymized: ptr(true)}, want: bson.M{anonymizedTag: true}},
+		{name: "NotAnonymized", filter: TransactionFilter{Anonymized: ptr(false)}, want: bson.M{anonymizedTag: bson.M{"$nin": bson.A{true}}}},
+		{name: "FinePaid", filter: TransactionFilter{FinePaid: ptr(true)}, want: bson.M{finePaymentTag: bson.M{"$exists": true}}},
+		{name: "FineUnpaid", filter: TransactionFilter{FinePaid: ptr(false)}, want: bson.M{finePaymentTag: bson.M{"$exists": false}}},
+		{name: "Overdue", filter: TransactionFilter{Overdue: ptr(true)}, want: bson.M{"$and": bson.A{overdue}}},
+		{name: "NotOverdue", filter: TransactionFilter{Overdue: ptr(false)}, want: bson.M{"$nor": bson.A{overdue}}},
+		{name: "OutstandingAt", filter: TransactionFilter{OutstandingAt: &filterFrom}, want: bson.M{"$or": bson.A{
+			bson.M{statusTag: TransactionStatusBorrowed, borrowedAtTag: bson.M{"$lte": filterFrom}},
+			bson.M{statusTag: TransactionStatusReturned, borrowedAtTag: bson.M{"$lte": filterFrom}, returnedAtTag: bson.M{"$gt": filterFrom}},
+		}}},
+	})
+}
+
+func TestBuildTokenFilter(t *testing.T) {
+	runFilterTests(t, buildTokenFilter, []filterTest[TokenFilter]{
+		{name: "Empty", filter: TokenFilter{}, want: bson.M{}},
+		{name: "Plaintext", filter: TokenFilter{Plaintext: ptr("ABC")}, want: bson.M{plaintextTag: "ABC"}},
+		{name: "PatronID", filter: TokenFilter{PatronID: ptr(filterHex)}, want: bson.M{patronIDTag: filterHex}},
+		{name: "Hash", filter: TokenFilter{Hash: []byte{1, 2}}, want: bson.M{hashTag: []byte{1, 2}}},
+		{name: "Expiry", filter: TokenFilter{MinExpiry: &filterFrom, MaxExpiry: &filterTo}, want: bson.M{expiryTag: bson.M{"$gte": filterFrom, "$lte": filterTo}}},
+		{name: "Scope", filter: TokenFilter{Scope: ptr(ScopeActivation)}, want: bson.M{scopeTag: ScopeActivation}},
+	})
+}
@@ -0,0 +1,125 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"slices"
+)
+
+// ErrInvalidID is returned for an ID which is not the hex of an ObjectID, so it can't be the ID
+// of any document.
+var ErrInvalidID = errors.New("invalid id")
+
+// BookID is the ID of a Book, the hex of its ObjectID.
+type BookID string
+
+// PatronID is the ID of a Patron, the hex of its ObjectID.
+type PatronID string
+
+// TransactionID is the ID of a Transaction, the hex of its ObjectID.
+type TransactionID string
+
+// ParseBookID parses the ID of a Book.
+func ParseBookID(s string) (BookID, error) {
+	return parseID[BookID](s)
+}
+
+// ParsePatronID parses the ID of a Patron.
+func ParsePatronID(s string) (PatronID, error) {
+	return parseID[PatronID](s)
+}
+
+// ParseTransactionID parses the ID of a Transaction.
+func ParseTransactionID(s string) (TransactionID, error) {
+	return parseID[TransactionID](s)
+}
+
+// ValidID checks if an ID is the hex of an ObjectID.
+func ValidID[T ~string](id T) bool {
+	return primitive.IsValidObjectID(string(id))
+}
+
+// parseID parses an ID, returning an error which wraps ErrInvalidID if it is not the hex of
+// an ObjectID.
+func parseID[T ~string](s string) (T, error) {
+	if !ValidID(s) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidID, s)
+	}
+
+	return T(s), nil
+}
+
+// objectID returns the ObjectID of an ID, for filtering documents by their _id.
+func objectID[T ~string](id T) (primitive.ObjectID, error) {
+	oid, err := primitive.ObjectIDFromHex(string(id))
+	if err != nil {
+		return primitive.NilObjectID, fmt.Errorf("%w: %q", ErrInvalidID, string(id))
+	}
+
+	return oid, nil
+}
+
+// idQuery returns the query of the _id of the documents with the ID id, if it is not nil, and with
+// any of ids, if they are not nil. Empty, non-nil ids match no documents.
+func idQuery[T ~string](id *T, ids []T) (interface{}, error) {
+	if ids == nil {
+		return objectID(*id)
+	}
+
+	if id != nil {
+		if !slices.Contains(ids, *id) {
+			return bson.M{"$in": bson.A{}}, nil
+		}
+		ids = []T{*id}
+	}
+
+	oids := make(bson.A, 0, len(ids))
+	for _, id := range ids {
+		oid, err := objectID(id)
+		if err != nil {
+			return nil, err
+		}
+		oids = append(oids, oid)
+	}
+
+	return bson.M{"$in": oids}, nil
+}
+
+// refQuery returns the query of a field which refers to documents by their IDs, such as the
+// patron_id of Transactions, with the ID id, if it is not nil, and any of ids, if they are not nil.
+// Empty, non-nil ids match no documents.
+func refQuery[T ~string](id *T, ids []T) interface{} {
+	if ids == nil {
+		return string(*id)
+	}
+
+	if id != nil {
+		if !slices.Contains(ids, *id) {
+			return bson.M{"$in": bson.A{}}
+		}
+		ids = []T{*id}
+	}
+
+	refs := make(bson.A, 0, len(ids))
+	for _, id := range ids {
+		refs = append(refs, string(id))
+	}
+
+	return bson.M{"$in": refs}
+}
+
+// ExternalID is the ID of a Patron or a Book in another System, such as the ID of a student in
+// the school information system or the barcode of a book in a legacy catalog. Patrons and Books
+// keep their external IDs in a map by System, so they have at most one ID in each System.
+type ExternalID struct {
+	System string `json:"system"`
+	Value  string `json:"value"`
+}
+
+// externalIDKey returns the key of the external ID of a document in a System, for filtering
+// documents by it.
+func externalIDKey(system string) string {
+	return externalIDsTag + "." + system
+}
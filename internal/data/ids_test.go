@@ -0,0 +1,44 @@
+package data
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseID(t *testing.T) {
+	tests := []struct {
+		id      string
+		wantErr bool
+	}{
+		{id: "5f1b2c3d4e5f6a7b8c9d0e1f"},
+		{id: "5F1B2C3D4E5F6A7B8C9D0E1F"},
+		{id: "", wantErr: true},
+		{id: "not-an-id", wantErr: true},
+		{id: "5f1b2c3d4e5f6a7b8c9d0e1", wantErr: true},
+		{id: "5f1b2c3d4e5f6a7b8c9d0e1g", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		id, err := ParseBookID(tt.id)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidID) {
+				t.Errorf("ParseBookID(%q) error = %v; want %v", tt.id, err, ErrInvalidID)
+			}
+			continue
+		}
+		if err != nil || string(id) != tt.id {
+			t.Errorf("ParseBookID(%q) = %q, %v; want %q", tt.id, id, err, tt.id)
+		}
+	}
+}
+
+func TestBuildFilterInvalidID(t *testing.T) {
+	if _, err := buildTransactionFilter(TransactionFilter{ID: ptr(TransactionID("not-an-id"))}); !errors.Is(err, ErrInvalidID) {
+		t.Errorf("buildTransactionFilter() error = %v; want %v", err, ErrInvalidID)
+	}
+
+	query, err := buildBookFilter(BookFilter{ID: ptr(BookID("5f1b2c3d4e5f6a7b8c9d0e1f"))})
+	if err != nil || query[idTag] == nil {
+		t.Errorf("buildBookFilter() = %v, %v; want a filter by _id", query, err)
+	}
+}
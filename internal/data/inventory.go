@@ -0,0 +1,322 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+	"time"
+)
+
+const (
+	InventoryStatusOpen   = "open"
+	InventoryStatusClosed = "closed"
+)
+
+// InventorySession is a stock-taking, in which the copies on the shelves are scanned and compared
+// with the copies the catalog expects on the shelves. A session may be limited to Genres, such as
+// to take stock of one section at a time. The Report is stored when the session is closed.
+type InventorySession struct {
+	ID        string           `bson:"_id,omitempty" json:"id,omitempty"`
+	Name      string           `bson:"name" json:"name"`
+	Genres    []string         `bson:"genres,omitempty" json:"genres,omitempty"`
+	Status    string           `bson:"status" json:"status"`
+	OpenedBy  string           `bson:"opened_by" json:"opened_by"`
+	OpenedAt  time.Time        `bson:"opened_at" json:"opened_at"`
+	ClosedAt  time.Time        `bson:"closed_at,omitempty" json:"closed_at,omitempty"`
+	Report    *InventoryReport `bson:"report,omitempty" json:"report,omitempty"`
+	UpdatedAt time.Time        `bson:"updated_at" json:"-"`
+	Version   int32            `bson:"version" json:"-"`
+}
+
+// InventoryReport compares the copies which were scanned in an InventorySession with the copies
+// which were expected on the shelves. Copies of Books outside the Genres of the session are
+// misplaced, and barcodes which are not ISBNs of the catalog are unknown.
+type InventoryReport struct {
+	GeneratedAt   time.Time              `bson:"generated_at" json:"generated_at"`
+	Expected      int                    `bson:"expected" json:"expected"`
+	Scanned       int                    `bson:"scanned" json:"scanned"`
+	Missing       int                    `bson:"missing" json:"missing"`
+	Surplus       int                    `bson:"surplus" json:"surplus"`
+	Misplaced     int                    `bson:"misplaced" json:"misplaced"`
+	Unknown       int                    `bson:"unknown" json:"unknown"`
+	Discrepancies []InventoryDiscrepancy `bson:"discrepancies" json:"discrepancies"`
+	Unrecognized  []UnknownBarcode       `bson:"unrecognized" json:"unrecognized"`
+}
+
+// InventoryDiscrepancy is a Book whose scanned copies do not match its expected copies.
+type InventoryDiscrepancy struct {
+	BookID   string `bson:"book_id" json:"book_id"`
+	ISBN     string `bson:"isbn" json:"isbn"`
+	Title    string `bson:"title" json:"title"`
+	Kind     string `bson:"kind" json:"kind"`
+	Expected int    `bson:"expected" json:"expected"`
+	Scanned  int    `bson:"scanned" json:"scanned"`
+}
+
+// UnknownBarcode is a barcode which was scanned in an InventorySession but is not of a Book.
+type UnknownBarcode struct {
+	Barcode string `bson:"barcode" json:"barcode"`
+	Count   int    `bson:"count" json:"count"`
+}
+
+// Kinds of InventoryDiscrepancies.
+const (
+	DiscrepancyMissing   = "missing"
+	DiscrepancySurplus   = "surplus"
+	DiscrepancyMisplaced = "misplaced"
+)
+
+// InventoryScan is a barcode which was scanned in an InventorySession. The ISBN is empty if the
+// barcode is not an ISBN.
+type InventoryScan struct {
+	ID        string    `bson:"_id,omitempty" json:"id,omitempty"`
+	SessionID string    `bson:"session_id" json:"session_id"`
+	Barcode   string    `bson:"barcode" json:"barcode"`
+	ISBN      string    `bson:"isbn,omitempty" json:"isbn,omitempty"`
+	ScannedBy string    `bson:"scanned_by" json:"scanned_by"`
+	ScannedAt time.Time `bson:"scanned_at" json:"scanned_at"`
+}
+
+type InventorySessionFilter struct {
+	ID      *string `json:"id,omitempty"`
+	Status  *string `json:"status,omitempty"`
+	Version *int32  `json:"-,omitempty"`
+}
+
+type InventoryScanFilter struct {
+	SessionID *string `json:"session_id,omitempty"`
+}
+
+type InventorySessionModel struct {
+	Client     *mongo.Client
+	Database   string
+	Collection string
+}
+
+type InventoryScanModel struct {
+	Client     *mongo.Client
+	Database   string
+	Collection string
+}
+
+// buildInventorySessionFilter constructs a filter query for filtering inventory sessions.
+func buildInventorySessionFilter(filter InventorySessionFilter) (bson.M, error) {
+	query := bson.M{}
+
+	if filter.ID != nil {
+		id, err := objectID(*filter.ID)
+		if err != nil {
+			return query, err
+		}
+		query[idTag] = id
+	}
+	if filter.Status != nil {
+		query[statusTag] = *filter.Status
+	}
+	if filter.Version != nil {
+		query[versionTag] = *filter.Version
+	}
+
+	return query, nil
+}
+
+// buildInventorySessionUpdater constructs an update document for closing an InventorySession.
+func buildInventorySessionUpdater(session *InventorySession) bson.D {
+	updateFields := bson.D{
+		{Key: statusTag, Value: session.Status},
+		{Key: closedAtTag, Value: session.ClosedAt},
+		{Key: reportTag, Value: session.Report},
+	}
+
+	updateFields = append(updateFields, bson.E{Key: updatedAtTag, Value: time.Now()})
+
+	update := bson.D{
+		{Key: "$set", Value: updateFields},
+		{Key: "$inc", Value: bson.D{{Key: versionTag, Value: 1}}},
+	}
+
+	return update
+}
+
+// buildInventoryScanFilter constructs a filter query for filtering inventory scans.
+func buildInventoryScanFilter(filter InventoryScanFilter) bson.M {
+	query := bson.M{}
+
+	if filter.SessionID != nil {
+		query[sessionIDTag] = *filter.SessionID
+	}
+
+	return query
+}
+
+// Insert inserts a new InventorySession into the database.
+func (i InventorySessionModel) Insert(ctx context.Context, session *InventorySession) (string, error) {
+	coll := i.Client.Database(i.Database).Collection(i.Collection)
+
+	session.UpdatedAt = time.Now()
+
+	res, err := coll.InsertOne(ctx, session)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "_id_ dup key:"):
+			return "", ErrDuplicateID
+		default:
+			return "", err
+		}
+	}
+
+	return res.InsertedID.(primitive.ObjectID).Hex(), nil
+}
+
+// Get retrieves a single InventorySession from the database matching an optional filter.
+func (i InventorySessionModel) Get(ctx context.Context, filter InventorySessionFilter) (*InventorySession, error) {
+	coll := i.Client.Database(i.Database).Collection(i.Collection)
+
+	filterQuery, err := buildInventorySessionFilter(filter)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	session := &InventorySession{}
+
+	logQuery(ctx, i.Collection, "findOne", filterQuery)
+	err = coll.FindOne(ctx, filterQuery).Decode(session)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrDocumentNotFound
+		}
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// GetAll retrieves a paginated list of InventorySessions from the database matching an optional
+// filter and sorting.
+func (i InventorySessionModel) GetAll(ctx context.Context, filter InventorySessionFilter, paginator Paginator, sorter Sorter) ([]InventorySession, Metadata, error) {
+	coll := i.Client.Database(i.Database).Collection(i.Collection, listOptions(ctx))
+
+	sessions := make([]InventorySession, 0)
+	metadata := Metadata{}
+
+	filterQuery, err := buildInventorySessionFilter(filter)
+	if err != nil {
+		return sessions, Metadata{}, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	sortQuery, err := buildSorter(sorter)
+	if err != nil {
+		return nil, Metadata{}, fmt.Errorf("%v: %v", errCreatingQuerySort, err)
+	}
+
+	findOpt := options.Find().SetSort(sortQuery).SetCollation(sorter.collation())
+
+	if paginator.valid() {
+		var totalRecords int64
+
+		findOpt = findOpt.SetLimit(paginator.limit()).SetSkip(paginator.offset())
+		totalRecords, err = coll.CountDocuments(ctx, filterQuery)
+		if err != nil {
+			return sessions, Metadata{}, errCreatingQueryFilter
+		}
+
+		metadata = calculateMetadata(totalRecords, paginator.Page, paginator.PageSize)
+	}
+
+	logQuery(ctx, i.Collection, "find", filterQuery)
+	cursor, err := coll.Find(ctx, filterQuery, findOpt)
+	if err != nil {
+		return sessions, Metadata{}, err
+	}
+	defer cursor.Close(ctx)
+
+	if err = cursor.All(ctx, &sessions); err != nil {
+		return sessions, Metadata{}, err
+	}
+
+	return sessions, metadata, nil
+}
+
+// Update updates an InventorySession's status and report in the database.
+func (i InventorySessionModel) Update(ctx context.Context, filter InventorySessionFilter, session *InventorySession) error {
+	coll := i.Client.Database(i.Database).Collection(i.Collection)
+
+	update := buildInventorySessionUpdater(session)
+
+	filter.Version = &session.Version
+	filterQuery, err := buildInventorySessionFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	logQuery(ctx, i.Collection, "updateOne", filterQuery)
+	result, err := coll.UpdateOne(ctx, filterQuery, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+// CreateIndexes creates an index on the sessions of the scans, by which the report of a session
+// is built.
+func (i InventoryScanModel) CreateIndexes() error {
+	coll := i.Client.Database(i.Database).Collection(i.Collection)
+	indexModel := mongo.IndexModel{
+		Keys: bson.D{{Key: sessionIDTag, Value: 1}},
+	}
+
+	_, err := coll.Indexes().CreateOne(context.TODO(), indexModel)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// InsertMany inserts multiple InventoryScans into the database, returning their IDs.
+func (i InventoryScanModel) InsertMany(ctx context.Context, scans []*InventoryScan) ([]string, error) {
+	coll := i.Client.Database(i.Database).Collection(i.Collection)
+
+	documents := make([]interface{}, 0, len(scans))
+	for _, scan := range scans {
+		documents = append(documents, scan)
+	}
+
+	res, err := coll.InsertMany(ctx, documents)
+	if err != nil {
+		return nil, err
+	}
+
+	return insertedIDs(res.InsertedIDs), nil
+}
+
+// GetAll retrieves all InventoryScans from the database matching an optional filter.
+func (i InventoryScanModel) GetAll(ctx context.Context, filter InventoryScanFilter) ([]InventoryScan, error) {
+	coll := i.Client.Database(i.Database).Collection(i.Collection, listOptions(ctx))
+
+	scans := make([]InventoryScan, 0)
+	filterQuery := buildInventoryScanFilter(filter)
+
+	logQuery(ctx, i.Collection, "find", filterQuery)
+	cursor, err := coll.Find(ctx, filterQuery)
+	if err != nil {
+		return scans, err
+	}
+	defer cursor.Close(ctx)
+
+	if err = cursor.All(ctx, &scans); err != nil {
+		return scans, err
+	}
+
+	return scans, nil
+}
@@ -0,0 +1,329 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+	"time"
+)
+
+// Operations of KioskRequests.
+const (
+	KioskOperationBorrow = "borrow"
+	KioskOperationReturn = "return"
+)
+
+var (
+	ErrDuplicateRequestID = errors.New("duplicate request id")
+)
+
+// Kiosk is a self-service checkout station of a branch. It authenticates with an API key, which
+// grants only the Permissions of the Kiosk. Only the hash of the key is stored. A Kiosk which
+// requires a PIN identifies patrons only by the tokens they get by logging in with their PIN.
+type Kiosk struct {
+	ID          string    `bson:"_id,omitempty" json:"id,omitempty"`
+	Name        string    `bson:"name" json:"name"`
+	Branch      string    `bson:"branch" json:"branch"`
+	Key         string    `bson:"-" json:"key,omitempty"`
+	Hash        []byte    `bson:"hash" json:"-"`
+	Permissions []string  `bson:"permissions" json:"permissions"`
+	RequirePIN  bool      `bson:"require_pin" json:"require_pin"`
+	CreatedAt   time.Time `bson:"created_at" json:"created_at"`
+}
+
+type KioskFilter struct {
+	ID     *string `json:"id,omitempty"`
+	Branch *string `json:"branch,omitempty"`
+	Hash   []byte  `json:"-"`
+}
+
+type KioskModel struct {
+	Client     *mongo.Client
+	Database   string
+	Collection string
+}
+
+// KioskRequest records a borrow or return of a Kiosk by the ID which the Kiosk generated for it,
+// so that a request which is sent again, such as from the offline queue of the Kiosk, is not
+// applied twice.
+type KioskRequest struct {
+	ID            string    `bson:"_id,omitempty" json:"id,omitempty"`
+	RequestID     string    `bson:"request_id" json:"request_id"`
+	KioskID       string    `bson:"kiosk_id" json:"kiosk_id"`
+	Operation     string    `bson:"operation" json:"operation"`
+	TransactionID string    `bson:"transaction_id" json:"transaction_id"`
+	Copies        int       `bson:"copies" json:"copies"`
+	CreatedAt     time.Time `bson:"created_at" json:"created_at"`
+}
+
+type KioskRequestFilter struct {
+	RequestID *string `json:"request_id,omitempty"`
+	KioskID   *string `json:"kiosk_id,omitempty"`
+}
+
+type KioskRequestModel struct {
+	Client     *mongo.Client
+	Database   string
+	Collection string
+}
+
+// NewKiosk constructs a new Kiosk with a random API key.
+func NewKiosk(name, branch string, permissions []string, requirePIN bool) (*Kiosk, error) {
+	randomBytes := make([]byte, 32)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return nil, err
+	}
+
+	key := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+
+	return &Kiosk{
+		Name:        name,
+		Branch:      branch,
+		Key:         key,
+		Hash:        HashKioskKey(key),
+		Permissions: permissions,
+		RequirePIN:  requirePIN,
+		CreatedAt:   time.Now(),
+	}, nil
+}
+
+// HashKioskKey returns the hash of a Kiosk API key, by which the Kiosk is found.
+func HashKioskKey(key string) []byte {
+	hash := sha256.Sum256([]byte(key))
+	return hash[:]
+}
+
+// buildKioskFilter constructs a filter query for filtering kiosks.
+func buildKioskFilter(filter KioskFilter) (bson.M, error) {
+	query := bson.M{}
+
+	if filter.ID != nil {
+		id, err := objectID(*filter.ID)
+		if err != nil {
+			return query, err
+		}
+		query[idTag] = id
+	}
+
+	if filter.Branch != nil {
+		query[branchTag] = *filter.Branch
+	}
+
+	if len(filter.Hash) > 0 {
+		query[hashTag] = filter.Hash
+	}
+
+	return query, nil
+}
+
+// CreateIndexes creates an index for finding Kiosks by the hash of their key.
+func (k KioskModel) CreateIndexes() error {
+	coll := k.Client.Database(k.Database).Collection(k.Collection)
+	indexModel := mongo.IndexModel{
+		Keys: bson.D{{Key: hashTag, Value: 1}},
+	}
+
+	_, err := coll.Indexes().CreateOne(context.TODO(), indexModel)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Insert inserts a new Kiosk into the database.
+func (k KioskModel) Insert(ctx context.Context, kiosk *Kiosk) (string, error) {
+	coll := k.Client.Database(k.Database).Collection(k.Collection)
+
+	res, err := coll.InsertOne(ctx, kiosk)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "_id_ dup key:"):
+			return "", ErrDuplicateID
+		default:
+			return "", err
+		}
+	}
+
+	if oid, ok := res.InsertedID.(primitive.ObjectID); ok {
+		return oid.Hex(), nil
+	}
+
+	return res.InsertedID.(string), nil
+}
+
+// Get retrieves a single Kiosk from the database matching an optional filter.
+func (k KioskModel) Get(ctx context.Context, filter KioskFilter) (*Kiosk, error) {
+	coll := k.Client.Database(k.Database).Collection(k.Collection)
+
+	filterQuery, err := buildKioskFilter(filter)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	kiosk := &Kiosk{}
+
+	logQuery(ctx, k.Collection, "findOne", filterQuery)
+	err = coll.FindOne(ctx, filterQuery).Decode(kiosk)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrDocumentNotFound
+		}
+		return nil, err
+	}
+
+	return kiosk, nil
+}
+
+// GetAll retrieves a paginated list of Kiosks from the database matching an optional filter and sorting.
+func (k KioskModel) GetAll(ctx context.Context, filter KioskFilter, paginator Paginator, sorter Sorter) ([]Kiosk, Metadata, error) {
+	coll := k.Client.Database(k.Database).Collection(k.Collection, listOptions(ctx))
+
+	kiosks := make([]Kiosk, 0)
+	metadata := Metadata{}
+
+	filterQuery, err := buildKioskFilter(filter)
+	if err != nil {
+		return kiosks, Metadata{}, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	sortQuery, err := buildSorter(sorter)
+	if err != nil {
+		return nil, Metadata{}, fmt.Errorf("%v: %v", errCreatingQuerySort, err)
+	}
+
+	findOpt := options.Find().SetSort(sortQuery).SetCollation(sorter.collation())
+
+	if paginator.valid() {
+		var totalRecords int64
+
+		findOpt = findOpt.SetLimit(paginator.limit()).SetSkip(paginator.offset())
+		totalRecords, err = coll.CountDocuments(ctx, filterQuery)
+		if err != nil {
+			return kiosks, Metadata{}, errCreatingQueryFilter
+		}
+
+		metadata = calculateMetadata(totalRecords, paginator.Page, paginator.PageSize)
+	}
+
+	logQuery(ctx, k.Collection, "find", filterQuery)
+	cursor, err := coll.Find(ctx, filterQuery, findOpt)
+	if err != nil {
+		return kiosks, Metadata{}, err
+	}
+	defer cursor.Close(ctx)
+
+	if err = cursor.All(ctx, &kiosks); err != nil {
+		return kiosks, Metadata{}, err
+	}
+
+	return kiosks, metadata, nil
+}
+
+// Delete deletes a Kiosk from the database matching a filter, which revokes its key.
+func (k KioskModel) Delete(ctx context.Context, filter KioskFilter) error {
+	coll := k.Client.Database(k.Database).Collection(k.Collection)
+
+	filterQuery, err := buildKioskFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	logQuery(ctx, k.Collection, "deleteOne", filterQuery)
+	result, err := coll.DeleteOne(ctx, filterQuery)
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return ErrDocumentNotFound
+	}
+
+	return nil
+}
+
+// buildKioskRequestFilter constructs a filter query for filtering kiosk requests.
+func buildKioskRequestFilter(filter KioskRequestFilter) bson.M {
+	query := bson.M{}
+
+	if filter.RequestID != nil {
+		query[requestIDTag] = *filter.RequestID
+	}
+
+	if filter.KioskID != nil {
+		query[kioskIDTag] = *filter.KioskID
+	}
+
+	return query
+}
+
+// CreateUniqueIndex creates a unique index on the request IDs, so that a request is recorded once.
+func (k KioskRequestModel) CreateUniqueIndex() error {
+	coll := k.Client.Database(k.Database).Collection(k.Collection)
+	indexModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: requestIDTag, Value: -1}},
+		Options: options.Index().SetUnique(true),
+	}
+
+	_, err := coll.Indexes().CreateOne(context.TODO(), indexModel)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Insert inserts a new KioskRequest into the database. It should be called within the database
+// transaction of the borrow or return, and returns ErrDuplicateRequestID if the request was
+// already recorded.
+func (k KioskRequestModel) Insert(ctx context.Context, request *KioskRequest) (string, error) {
+	coll := k.Client.Database(k.Database).Collection(k.Collection)
+
+	request.CreatedAt = time.Now()
+
+	res, err := coll.InsertOne(ctx, request)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "_id_ dup key:"):
+			return "", ErrDuplicateID
+		case strings.Contains(err.Error(), "request_id_-1 dup key"):
+			return "", ErrDuplicateRequestID
+		default:
+			return "", err
+		}
+	}
+
+	if oid, ok := res.InsertedID.(primitive.ObjectID); ok {
+		return oid.Hex(), nil
+	}
+
+	return res.InsertedID.(string), nil
+}
+
+// Get retrieves a single KioskRequest from the database matching an optional filter.
+func (k KioskRequestModel) Get(ctx context.Context, filter KioskRequestFilter) (*KioskRequest, error) {
+	coll := k.Client.Database(k.Database).Collection(k.Collection)
+
+	filterQuery := buildKioskRequestFilter(filter)
+
+	request := &KioskRequest{}
+
+	logQuery(ctx, k.Collection, "findOne", filterQuery)
+	err := coll.FindOne(ctx, filterQuery).Decode(request)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrDocumentNotFound
+		}
+		return nil, err
+	}
+
+	return request, nil
+}
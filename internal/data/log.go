@@ -0,0 +1,30 @@
+package data
+
+import (
+	"context"
+	"github.com/mzeevi/library/internal/logging"
+	"go.mongodb.org/mongo-driver/bson"
+	"log/slog"
+	"slices"
+)
+
+// logQuery logs a query against a collection along with the fields it filters by.
+// The values of the filter are omitted, since they may contain personal data.
+func logQuery(ctx context.Context, collection, operation string, filter bson.M) {
+	logging.FromContext(ctx).Debug("executing query",
+		slog.String("collection", collection),
+		slog.String("operation", operation),
+		slog.Any("filter", filterShape(filter)),
+	)
+}
+
+// filterShape returns the sorted keys of a filter.
+func filterShape(filter bson.M) []string {
+	keys := make([]string, 0, len(filter))
+	for key := range filter {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	return keys
+}
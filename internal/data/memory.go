@@ -0,0 +1,2748 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+	"maps"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memoryIndex is a unique index of a memoryCollection.
+type memoryIndex struct {
+	field string
+	// caseInsensitive mirrors the collation of the email index.
+	caseInsensitive bool
+	err             error
+}
+
+// memoryCollection is an in-memory collection of documents, which supports the subset of
+// MongoDB queries and updates that the models use. Documents are stored as they would be
+// encoded by the driver, so the same filter and update builders are used as for MongoDB.
+type memoryCollection struct {
+	mu      sync.Mutex
+	docs    []bson.M
+	indexes []memoryIndex
+}
+
+// NewMemoryModels returns Models which are stored in memory. They are meant for tests which
+// should not depend on a running database.
+func NewMemoryModels() Models {
+	books := &memoryCollection{indexes: []memoryIndex{{field: identifiersTag, err: ErrDuplicateIdentifier}}}
+	patrons := &memoryCollection{indexes: []memoryIndex{{field: emailTag, caseInsensitive: true, err: ErrDuplicateEmail}}}
+	transactions := &memoryCollection{}
+	tokens := &memoryCollection{}
+	admins := &memoryCollection{indexes: []memoryIndex{{field: nameTag, err: ErrDuplicateName}}}
+	categories := &memoryCollection{indexes: []memoryIndex{{field: nameTag, err: ErrDuplicateCategory}}}
+	publishers := &memoryCollection{indexes: []memoryIndex{{field: normalizedNamesTag, err: ErrDuplicatePublisher}}}
+	notifications := &memoryCollection{}
+	events := &memoryCollection{}
+	availability := &memoryCollection{}
+	kiosks := &memoryCollection{}
+	kioskRequests := &memoryCollection{indexes: []memoryIndex{{field: requestIDTag, err: ErrDuplicateRequestID}}}
+	audit := &memoryCollection{}
+	payments := &memoryCollection{}
+	acquisitions := &memoryCollection{}
+	withdrawals := &memoryCollection{}
+	inventorySessions := &memoryCollection{}
+	inventoryScans := &memoryCollection{}
+	suggestions := &memoryCollection{}
+	resources := &memoryCollection{}
+	reservations := &memoryCollection{}
+	programs := &memoryCollection{}
+	registrations := &memoryCollection{}
+	announcements := &memoryCollection{}
+	savedSearches := &memoryCollection{}
+	dailyStats := &memoryCollection{}
+
+	return Models{
+		Books:             memoryBookModel{coll: books},
+		Patrons:           memoryPatronModel{coll: patrons},
+		Transactions:      memoryTransactionModel{coll: transactions, books: books},
+		Tokens:            memoryTokenModel{coll: tokens},
+		Admins:            memoryAdminModel{coll: admins},
+		Categories:        memoryCategoryModel{coll: categories},
+		Publishers:        memoryPublisherModel{coll: publishers},
+		Notifications:     memoryNotificationModel{coll: notifications},
+		Events:            memoryEventModel{coll: events},
+		Availability:      memoryAvailabilityModel{coll: availability, books: books, transactions: transactions},
+		Kiosks:            memoryKioskModel{coll: kiosks},
+		KioskRequests:     memoryKioskRequestModel{coll: kioskRequests},
+		Audit:             memoryAuditModel{coll: audit},
+		Payments:          memoryPaymentModel{coll: payments},
+		Acquisitions:      memoryAcquisitionModel{coll: acquisitions},
+		Withdrawals:       memoryWithdrawalModel{coll: withdrawals},
+		InventorySessions: memoryInventorySessionModel{coll: inventorySessions},
+		InventoryScans:    memoryInventoryScanModel{coll: inventoryScans},
+		Suggestions:       memorySuggestionModel{coll: suggestions},
+		Resources:         memoryResourceModel{coll: resources},
+		Reservations:      memoryReservationModel{coll: reservations},
+		Programs:          memoryProgramModel{coll: programs},
+		Registrations:     memoryRegistrationModel{coll: registrations},
+		Announcements:     memoryAnnouncementModel{coll: announcements},
+		SavedSearches:     memorySavedSearchModel{coll: savedSearches},
+		DailyStats:        memoryDailyStatsModel{coll: dailyStats},
+		Transactor:        &memoryTransactor{collections: []*memoryCollection{books, patrons, transactions, tokens, admins, categories, publishers, notifications, events, kiosks, kioskRequests, audit, payments, acquisitions, withdrawals, inventorySessions, inventoryScans, suggestions, resources, reservations, programs, registrations, announcements, savedSearches, dailyStats}},
+	}
+}
+
+// toDocument encodes a value the same way the driver does, so that it can be stored and matched.
+func toDocument(value interface{}) (bson.M, error) {
+	raw, err := bson.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := bson.M{}
+	if err = bson.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+
+	return doc, nil
+}
+
+// fromDocuments decodes stored documents into a slice of T.
+func fromDocuments[T any](docs []bson.M) ([]T, error) {
+	values := make([]T, 0, len(docs))
+	for _, doc := range docs {
+		raw, err := bson.Marshal(doc)
+		if err != nil {
+			return values, err
+		}
+
+		var value T
+		if err = bson.Unmarshal(raw, &value); err != nil {
+			return values, err
+		}
+		values = append(values, value)
+	}
+
+	return values, nil
+}
+
+// asDocument returns the fields of an embedded document.
+func asDocument(value interface{}) (bson.M, bool) {
+	switch v := value.(type) {
+	case bson.M:
+		return v, true
+	case map[string]interface{}:
+		return v, true
+	case bson.D:
+		doc := bson.M{}
+		for _, e := range v {
+			doc[e.Key] = e.Value
+		}
+		return doc, true
+	default:
+		return nil, false
+	}
+}
+
+// asArray returns the elements of an array.
+func asArray(value interface{}) ([]interface{}, bool) {
+	switch v := value.(type) {
+	case bson.A:
+		return v, true
+	case []interface{}:
+		return v, true
+	default:
+		return nil, false
+	}
+}
+
+// compareValues compares two stored values, returning false if they are not comparable.
+func compareValues(a, b interface{}) (int, bool) {
+	if a == nil || b == nil {
+		if a == nil && b == nil {
+			return 0, true
+		}
+		return 0, false
+	}
+
+	switch x := a.(type) {
+	case int32, int64, float64:
+		y, ok := toFloat(b)
+		if !ok {
+			return 0, false
+		}
+		xf, _ := toFloat(x)
+		switch {
+		case xf < y:
+			return -1, true
+		case xf > y:
+			return 1, true
+		}
+		return 0, true
+	case string:
+		y, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(x, y), true
+	case bool:
+		y, ok := b.(bool)
+		switch {
+		case !ok:
+			return 0, false
+		case x == y:
+			return 0, true
+		case !x:
+			return -1, true
+		}
+		return 1, true
+	case primitive.DateTime:
+		y, ok := b.(primitive.DateTime)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		}
+		return 0, true
+	case primitive.ObjectID:
+		y, ok := b.(primitive.ObjectID)
+		if !ok {
+			return 0, false
+		}
+		return bytes.Compare(x[:], y[:]), true
+	case primitive.Binary:
+		y, ok := b.(primitive.Binary)
+		if !ok {
+			return 0, false
+		}
+		return bytes.Compare(x.Data, y.Data), true
+	default:
+		return 0, false
+	}
+}
+
+// toFloat converts a stored number to a float64.
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	default:
+		return 0, false
+	}
+}
+
+// valuesEqual checks if a stored value equals a filter value. Like MongoDB, a filter value
+// matches an array if it equals any of its elements.
+func valuesEqual(stored, value interface{}) bool {
+	if elements, ok := asArray(stored); ok {
+		if _, isArray := asArray(value); !isArray {
+			for _, element := range elements {
+				if valuesEqual(element, value) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	cmp, ok := compareValues(stored, value)
+	return ok && cmp == 0
+}
+
+// anyCompare checks if a stored value, or any of its elements, satisfies a comparison.
+func anyCompare(stored, value interface{}, satisfies func(int) bool) bool {
+	if elements, ok := asArray(stored); ok {
+		for _, element := range elements {
+			if anyCompare(element, value, satisfies) {
+				return true
+			}
+		}
+		return false
+	}
+
+	cmp, ok := compareValues(stored, value)
+	return ok && satisfies(cmp)
+}
+
+// anyMatch checks if a stored string, or any of the strings of a stored array, matches a regular expression.
+func anyMatch(stored interface{}, re *regexp.Regexp) bool {
+	if elements, ok := asArray(stored); ok {
+		for _, element := range elements {
+			if anyMatch(element, re) {
+				return true
+			}
+		}
+		return false
+	}
+
+	s, ok := stored.(string)
+	return ok && re.MatchString(s)
+}
+
+// matchOperators checks if a stored value satisfies a document of query operators.
+func matchOperators(stored interface{}, exists bool, operators bson.M) (bool, error) {
+	for operator, value := range operators {
+		switch operator {
+		case "$gte":
+			if !anyCompare(stored, value, func(c int) bool { return c >= 0 }) {
+				return false, nil
+			}
+		case "$gt":
+			if !anyCompare(stored, value, func(c int) bool { return c > 0 }) {
+				return false, nil
+			}
+		case "$lte":
+			if !anyCompare(stored, value, func(c int) bool { return c <= 0 }) {
+				return false, nil
+			}
+		case "$lt":
+			if !anyCompare(stored, value, func(c int) bool { return c < 0 }) {
+				return false, nil
+			}
+		case "$in":
+			values, ok := asArray(value)
+			if !ok {
+				return false, fmt.Errorf("$in needs an array")
+			}
+			found := false
+			for _, v := range values {
+				if (v == nil && !exists) || valuesEqual(stored, v) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false, nil
+			}
+		case "$nin":
+			values, ok := asArray(value)
+			if !ok {
+				return false, fmt.Errorf("$nin needs an array")
+			}
+			for _, v := range values {
+				if (v == nil && !exists) || valuesEqual(stored, v) {
+					return false, nil
+				}
+			}
+		case "$exists":
+			want, _ := value.(bool)
+			if exists != want {
+				return false, nil
+			}
+		case "$regex":
+			pattern, _ := value.(string)
+			if options, _ := operators["$options"].(string); strings.Contains(options, "i") {
+				pattern = "(?i)" + pattern
+			}
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return false, err
+			}
+			if !anyMatch(stored, re) {
+				return false, nil
+			}
+		case "$options":
+		default:
+			return false, fmt.Errorf("unsupported query operator %s", operator)
+		}
+	}
+
+	return true, nil
+}
+
+// matchExpression checks if a document satisfies an $expr comparison of two operands,
+// which are either field paths such as "$copies" or literals.
+func matchExpression(doc bson.M, expression interface{}) (bool, error) {
+	comparison, ok := asDocument(expression)
+	if !ok || len(comparison) != 1 {
+		return false, fmt.Errorf("$expr needs a single comparison")
+	}
+
+	for operator, value := range comparison {
+		operands, ok := asArray(value)
+		if !ok || len(operands) != 2 {
+			return false, fmt.Errorf("%s needs two operands", operator)
+		}
+
+		resolved := make([]interface{}, 2)
+		for i, operand := range operands {
+			resolved[i] = operand
+			if path, ok := operand.(string); ok && strings.HasPrefix(path, "$") {
+				resolved[i] = doc[strings.TrimPrefix(path, "$")]
+			}
+		}
+
+		cmp, ok := compareValues(resolved[0], resolved[1])
+		if !ok {
+			return false, nil
+		}
+
+		switch operator {
+		case "$eq":
+			return cmp == 0, nil
+		case "$lt":
+			return cmp < 0, nil
+		case "$lte":
+			return cmp <= 0, nil
+		case "$gt":
+			return cmp > 0, nil
+		case "$gte":
+			return cmp >= 0, nil
+		default:
+			return false, fmt.Errorf("unsupported expression operator %s", operator)
+		}
+	}
+
+	return true, nil
+}
+
+// matchLogical checks if a document satisfies an $and, $or or $nor of filters.
+func matchLogical(doc bson.M, operator string, value interface{}) (bool, error) {
+	filters, ok := asArray(value)
+	if !ok || len(filters) == 0 {
+		return false, fmt.Errorf("%s needs a non-empty array", operator)
+	}
+
+	for _, f := range filters {
+		filter, ok := asDocument(f)
+		if !ok {
+			return false, fmt.Errorf("%s needs an array of documents", operator)
+		}
+
+		matched, err := matches(doc, filter)
+		if err != nil {
+			return false, err
+		}
+		if operator == "$or" {
+			if matched {
+				return true, nil
+			}
+			continue
+		}
+		if matched == (operator == "$nor") {
+			return false, nil
+		}
+	}
+
+	return operator != "$or", nil
+}
+
+// matches checks if a document matches a normalized filter.
+func matches(doc, filter bson.M) (bool, error) {
+	for field, value := range filter {
+		switch field {
+		case "$expr":
+			matched, err := matchExpression(doc, value)
+			if err != nil || !matched {
+				return false, err
+			}
+			continue
+		case "$and", "$or", "$nor":
+			matched, err := matchLogical(doc, field, value)
+			if err != nil || !matched {
+				return false, err
+			}
+			continue
+		}
+
+		stored, exists := lookup(doc, field)
+
+		if operators, ok := asDocument(value); ok && isOperatorDocument(operators) {
+			matched, err := matchOperators(stored, exists, operators)
+			if err != nil || !matched {
+				return false, err
+			}
+			continue
+		}
+
+		if !valuesEqual(stored, value) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// lookup returns the value of a field of a document, which may be the path of a field of an
+// embedded document such as "identifiers.value". Like MongoDB, the path of a field of the
+// documents of an array is the array of the values of the field.
+func lookup(doc bson.M, path string) (interface{}, bool) {
+	field, rest, nested := strings.Cut(path, ".")
+
+	value, exists := doc[field]
+	if !nested || !exists {
+		return value, exists
+	}
+
+	if embedded, ok := asDocument(value); ok {
+		return lookup(embedded, rest)
+	}
+
+	elements, ok := asArray(value)
+	if !ok {
+		return nil, false
+	}
+
+	values := bson.A{}
+	for _, element := range elements {
+		if embedded, ok := asDocument(element); ok {
+			if v, ok := lookup(embedded, rest); ok {
+				values = append(values, v)
+			}
+		}
+	}
+
+	return values, len(values) > 0
+}
+
+// indexKeys returns the keys of a value in a unique index. Like MongoDB, an array is indexed by
+// each of its elements, and an embedded document as a whole.
+func indexKeys(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case bson.A, []interface{}:
+		elements, _ := asArray(v)
+		keys := make([]string, 0, len(elements))
+		for _, element := range elements {
+			keys = append(keys, indexKeys(element)...)
+		}
+		return keys
+	default:
+		if embedded, ok := asDocument(v); ok {
+			// Maps are printed sorted by their keys.
+			return []string{fmt.Sprint(map[string]interface{}(embedded))}
+		}
+		return nil
+	}
+}
+
+// isOperatorDocument checks if all keys of a document are query operators.
+func isOperatorDocument(doc bson.M) bool {
+	if len(doc) == 0 {
+		return false
+	}
+
+	for key := range doc {
+		if !strings.HasPrefix(key, "$") {
+			return false
+		}
+	}
+
+	return true
+}
+
+// violatesIndex returns the error of the first unique index which doc violates,
+// ignoring the document at position skip.
+func (c *memoryCollection) violatesIndex(doc bson.M, skip int) error {
+	for i, other := range c.docs {
+		if i == skip {
+			continue
+		}
+
+		if cmp, ok := compareValues(doc[idTag], other[idTag]); ok && cmp == 0 {
+			return ErrDuplicateID
+		}
+
+		for _, index := range c.indexes {
+			for _, a := range indexKeys(doc[index.field]) {
+				for _, b := range indexKeys(other[index.field]) {
+					if a == b || (index.caseInsensitive && strings.EqualFold(a, b)) {
+						return index.err
+					}
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// insert inserts documents, returning their IDs. No document is inserted if any of them
+// violates a unique index.
+func (c *memoryCollection) insert(values ...interface{}) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	count := len(c.docs)
+	ids := make([]string, 0, len(values))
+
+	for _, value := range values {
+		doc, err := toDocument(value)
+		if err != nil {
+			c.docs = c.docs[:count]
+			return nil, err
+		}
+
+		if _, ok := doc[idTag]; !ok {
+			doc[idTag] = primitive.NewObjectID()
+		}
+
+		if err = c.violatesIndex(doc, -1); err != nil {
+			c.docs = c.docs[:count]
+			return nil, err
+		}
+
+		c.docs = append(c.docs, doc)
+
+		switch id := doc[idTag].(type) {
+		case primitive.ObjectID:
+			ids = append(ids, id.Hex())
+		default:
+			ids = append(ids, fmt.Sprint(id))
+		}
+	}
+
+	return ids, nil
+}
+
+// find returns the documents matching a filter, sorted and paginated. A limit of 0 means no limit.
+func (c *memoryCollection) find(filter bson.M, sorter bson.D, skip, limit int64) ([]bson.M, error) {
+	return c.findCollated(filter, sorter, nil, skip, limit)
+}
+
+// findCollated is find which sorts text by a collator, or by its bytes if collator is nil.
+func (c *memoryCollection) findCollated(filter bson.M, sorter bson.D, collator *collate.Collator, skip, limit int64) ([]bson.M, error) {
+	normalized, err := toDocument(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	found := make([]bson.M, 0)
+	for _, doc := range c.docs {
+		matched, err := matches(doc, normalized)
+		if err != nil {
+			return nil, err
+		}
+		if matched {
+			found = append(found, doc)
+		}
+	}
+
+	sort.SliceStable(found, func(i, j int) bool {
+		for _, e := range sorter {
+			a, _ := lookup(found[i], e.Key)
+			b, _ := lookup(found[j], e.Key)
+			cmp, _ := compareValues(a, b)
+			if x, ok := a.(string); ok && collator != nil {
+				if y, ok := b.(string); ok {
+					cmp = collator.CompareString(x, y)
+				}
+			}
+			if cmp == 0 {
+				continue
+			}
+			if direction, _ := e.Value.(int); direction < 0 {
+				return cmp > 0
+			}
+			return cmp < 0
+		}
+		return false
+	})
+
+	if skip >= int64(len(found)) {
+		return []bson.M{}, nil
+	}
+	found = found[skip:]
+
+	if limit > 0 && limit < int64(len(found)) {
+		found = found[:limit]
+	}
+
+	return found, nil
+}
+
+// applyUpdate returns a copy of doc with the $set, $setOnInsert, $unset and $inc operators of an update applied.
+func applyUpdate(doc bson.M, update interface{}) (bson.M, error) {
+	normalized, err := toDocument(update)
+	if err != nil {
+		return nil, err
+	}
+
+	updated := bson.M{}
+	for k, v := range doc {
+		updated[k] = v
+	}
+
+	for operator, value := range normalized {
+		fields, ok := asDocument(value)
+		if !ok {
+			return nil, fmt.Errorf("%s needs a document", operator)
+		}
+
+		switch operator {
+		case "$set":
+			for k, v := range fields {
+				setPath(updated, k, v)
+			}
+		case "$unset":
+			for k := range fields {
+				delete(updated, k)
+			}
+		case "$inc":
+			for k, v := range fields {
+				stored, _ := lookup(updated, k)
+				setPath(updated, k, increment(stored, v))
+			}
+		default:
+			return nil, fmt.Errorf("unsupported update operator %s", operator)
+		}
+	}
+
+	return updated, nil
+}
+
+// setPath sets a field of a document, which may be the path of a field of an embedded document
+// such as "pin.failures". The embedded documents on the path are copied, so that the documents
+// which were read before the update are not changed.
+func setPath(doc bson.M, path string, value interface{}) {
+	field, rest, nested := strings.Cut(path, ".")
+	if !nested {
+		doc[field] = value
+		return
+	}
+
+	embedded := bson.M{}
+	if stored, ok := asDocument(doc[field]); ok {
+		for k, v := range stored {
+			embedded[k] = v
+		}
+	}
+	setPath(embedded, rest, value)
+	doc[field] = embedded
+}
+
+// increment adds delta to a stored number, keeping the type of the stored number.
+func increment(stored, delta interface{}) interface{} {
+	d, _ := toFloat(delta)
+
+	switch v := stored.(type) {
+	case int32:
+		return v + int32(d)
+	case int64:
+		return v + int64(d)
+	case float64:
+		return v + d
+	default:
+		return delta
+	}
+}
+
+// update applies an update to the first matching document, or to all of them if many is set,
+// returning the number of matched documents.
+func (c *memoryCollection) update(filter bson.M, update interface{}, many bool) (int64, error) {
+	normalized, err := toDocument(filter)
+	if err != nil {
+		return 0, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var matched int64
+	for i, doc := range c.docs {
+		ok, err := matches(doc, normalized)
+		if err != nil {
+			return matched, err
+		}
+		if !ok {
+			continue
+		}
+
+		updated, err := applyUpdate(doc, update)
+		if err != nil {
+			return matched, err
+		}
+
+		if err = c.violatesIndex(updated, i); err != nil {
+			return matched, err
+		}
+
+		// Documents are replaced rather than modified, so that transactions can restore them.
+		c.docs[i] = updated
+		matched++
+
+		if !many {
+			break
+		}
+	}
+
+	return matched, nil
+}
+
+// unmatchedUpdateError returns the error of an update of a versioned document whose filter matched
+// no document, like unmatchedUpdateError of a mongo collection.
+func (c *memoryCollection) unmatchedUpdateError(filter bson.M) error {
+	unversioned := maps.Clone(filter)
+	delete(unversioned, versionTag)
+
+	docs, err := c.find(unversioned, nil, 0, 1)
+	if err != nil {
+		return err
+	}
+	if len(docs) == 0 {
+		return ErrDocumentNotFound
+	}
+
+	return ErrEditConflict
+}
+
+// delete deletes the first matching document, or all of them if many is set, returning
+// the number of deleted documents.
+func (c *memoryCollection) delete(filter bson.M, many bool) (int64, error) {
+	normalized, err := toDocument(filter)
+	if err != nil {
+		return 0, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var deleted int64
+	kept := make([]bson.M, 0, len(c.docs))
+	for _, doc := range c.docs {
+		if many || deleted == 0 {
+			ok, err := matches(doc, normalized)
+			if err != nil {
+				return 0, err
+			}
+			if ok {
+				deleted++
+				continue
+			}
+		}
+		kept = append(kept, doc)
+	}
+	c.docs = kept
+
+	return deleted, nil
+}
+
+// getOne returns the first document matching a filter decoded into a T.
+func getOne[T any](c *memoryCollection, filter bson.M) (*T, error) {
+	docs, err := c.find(filter, nil, 0, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(docs) == 0 {
+		return nil, ErrDocumentNotFound
+	}
+
+	values, err := fromDocuments[T](docs)
+	if err != nil {
+		return nil, err
+	}
+
+	return &values[0], nil
+}
+
+// getAll returns the documents matching a filter decoded into a slice of T, in the same way as
+// the GetAll methods of the MongoDB models.
+func getAll[T any](c *memoryCollection, filter bson.M, paginator Paginator, sorter Sorter) ([]T, Metadata, error) {
+	sortQuery, err := buildSorter(sorter)
+	if err != nil {
+		return make([]T, 0), Metadata{}, fmt.Errorf("%v: %v", errCreatingQuerySort, err)
+	}
+
+	collator, err := memoryCollator(sorter.Collation)
+	if err != nil {
+		return make([]T, 0), Metadata{}, fmt.Errorf("%v: %v", errCreatingQuerySort, err)
+	}
+
+	metadata := Metadata{}
+	var skip, limit int64
+
+	if paginator.valid() {
+		all, err := c.find(filter, nil, 0, 0)
+		if err != nil {
+			return make([]T, 0), Metadata{}, err
+		}
+
+		skip, limit = paginator.offset(), paginator.limit()
+		metadata = calculateMetadata(int64(len(all)), paginator.Page, paginator.PageSize)
+	}
+
+	docs, err := c.findCollated(filter, sortQuery, collator, skip, limit)
+	if err != nil {
+		return make([]T, 0), Metadata{}, err
+	}
+
+	values, err := fromDocuments[T](docs)
+	if err != nil {
+		return values, Metadata{}, err
+	}
+
+	return values, metadata, nil
+}
+
+// memoryCollator returns the collator of the locale of a collation, such as he or en_US, or nil
+// if the locale is empty.
+func memoryCollator(locale string) (*collate.Collator, error) {
+	if locale == "" {
+		return nil, nil
+	}
+
+	tag, err := language.Parse(strings.ReplaceAll(locale, "_", "-"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid collation locale %q: %w", locale, err)
+	}
+
+	return collate.New(tag), nil
+}
+
+// memoryTransactor is a Transactor for memory models. Changes are rolled back if the function
+// fails, but are visible to concurrent callers before the transaction ends.
+type memoryTransactor struct {
+	mu          sync.Mutex
+	collections []*memoryCollection
+}
+
+// WithTransaction runs fn, restoring all collections if it returns an error.
+func (t *memoryTransactor) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	snapshots := make([][]bson.M, len(t.collections))
+	for i, c := range t.collections {
+		c.mu.Lock()
+		snapshots[i] = append([]bson.M(nil), c.docs...)
+		c.mu.Unlock()
+	}
+
+	if err := fn(ctx); err != nil {
+		for i, c := range t.collections {
+			c.mu.Lock()
+			c.docs = snapshots[i]
+			c.mu.Unlock()
+		}
+		return err
+	}
+
+	return nil
+}
+
+type memoryBookModel struct {
+	coll *memoryCollection
+}
+
+// CreateUniqueIndex is a no-op, since uniqueness is always enforced in memory.
+func (b memoryBookModel) CreateUniqueIndex() error {
+	return nil
+}
+
+func (b memoryBookModel) MigrateIdentifiers(_ context.Context) (int, error) {
+	docs, err := b.coll.find(bson.M{isbnTag: bson.M{"$exists": true}}, nil, 0, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	migrated := 0
+	for _, doc := range docs {
+		identifiers, _ := asArray(doc[identifiersTag])
+		if isbn, _ := doc[isbnTag].(string); isbn != "" {
+			identifiers = append(identifiers, legacyIdentifier(isbn))
+		}
+
+		update := bson.D{
+			{Key: "$set", Value: bson.D{{Key: identifiersTag, Value: identifiers}}},
+			{Key: "$unset", Value: bson.D{{Key: isbnTag, Value: ""}}},
+		}
+		if _, err = b.coll.update(bson.M{idTag: doc[idTag]}, update, false); err != nil {
+			return migrated, err
+		}
+		migrated++
+	}
+
+	return migrated, nil
+}
+
+func (b memoryBookModel) ReassignPublisher(ctx context.Context, fromID string, to *Publisher) ([]string, error) {
+	return reassignPublisher(ctx, b, fromID, to)
+}
+
+func (b memoryBookModel) Insert(_ context.Context, book *Book) (string, error) {
+	book.CreatedAt = time.Now()
+	book.UpdatedAt = time.Now()
+
+	ids, err := b.coll.insert(book)
+	if err != nil {
+		return "", err
+	}
+
+	return ids[0], nil
+}
+
+func (b memoryBookModel) InsertMany(_ context.Context, books []*Book) ([]string, error) {
+	now := time.Now()
+	documents := make([]interface{}, 0, len(books))
+	for _, book := range books {
+		book.CreatedAt = now
+		book.UpdatedAt = now
+		documents = append(documents, book)
+	}
+
+	return b.coll.insert(documents...)
+}
+
+func (b memoryBookModel) Get(_ context.Context, filter BookFilter) (*Book, error) {
+	filterQuery, err := buildBookFilter(filter)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	return getOne[Book](b.coll, filterQuery)
+}
+
+func (b memoryBookModel) GetAll(_ context.Context, filter BookFilter, paginator Paginator, sorter Sorter) ([]Book, Metadata, error) {
+	filterQuery, err := buildBookFilter(filter)
+	if err != nil {
+		return make([]Book, 0), Metadata{}, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	return getAll[Book](b.coll, filterQuery, paginator, sorter)
+}
+
+func (b memoryBookModel) Update(_ context.Context, filter BookFilter, book *Book) error {
+	filter.Version = &book.Version
+	filterQuery, err := buildBookFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	matched, err := b.coll.update(filterQuery, buildBookUpdater(book), false)
+	if err != nil {
+		return err
+	}
+	if matched == 0 {
+		return b.coll.unmatchedUpdateError(filterQuery)
+	}
+
+	return nil
+}
+
+func (b memoryBookModel) Patch(_ context.Context, filter BookFilter, original, book *Book) error {
+	filterQuery, err := buildBookFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	matched, err := b.coll.update(filterQuery, buildBookPatcher(original, book), false)
+	if err != nil {
+		return err
+	}
+	if matched == 0 {
+		return ErrDocumentNotFound
+	}
+
+	return nil
+}
+
+func (b memoryBookModel) Delete(_ context.Context, filter BookFilter) error {
+	filterQuery, err := buildBookFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	deleted, err := b.coll.delete(filterQuery, false)
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrDocumentNotFound
+	}
+
+	return nil
+}
+
+// memoryPatronModel stores Patrons in memory. Patrons are never encrypted.
+type memoryPatronModel struct {
+	coll *memoryCollection
+}
+
+// CreateUniqueIndex is a no-op, since uniqueness is always enforced in memory.
+func (p memoryPatronModel) CreateUniqueIndex() error {
+	return nil
+}
+
+func (p memoryPatronModel) EncryptExisting(_ context.Context) (int, error) {
+	return 0, ErrEncryptionDisabled
+}
+
+func (p memoryPatronModel) NormalizeEmails(_ context.Context) (int, error) {
+	docs, err := p.coll.find(bson.M{}, nil, 0, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	migrated := 0
+	for _, doc := range docs {
+		email, _ := doc[emailTag].(string)
+		if normalizeEmail(email) == email {
+			continue
+		}
+
+		update := bson.M{"$set": bson.M{emailTag: normalizeEmail(email)}}
+		if _, err = p.coll.update(bson.M{idTag: doc[idTag]}, update, false); err != nil {
+			return migrated, err
+		}
+		migrated++
+	}
+
+	return migrated, nil
+}
+
+func (p memoryPatronModel) Insert(_ context.Context, patron *Patron) (string, error) {
+	patron.CreatedAt = time.Now()
+	patron.Email = normalizeEmail(patron.Email)
+
+	ids, err := p.coll.insert(patron)
+	if err != nil {
+		return "", err
+	}
+
+	return ids[0], nil
+}
+
+func (p memoryPatronModel) InsertMany(_ context.Context, patrons []*Patron) ([]string, error) {
+	now := time.Now()
+	documents := make([]interface{}, 0, len(patrons))
+	for _, patron := range patrons {
+		patron.CreatedAt = now
+		patron.UpdatedAt = now
+		patron.Email = normalizeEmail(patron.Email)
+		documents = append(documents, patron)
+	}
+
+	return p.coll.insert(documents...)
+}
+
+func (p memoryPatronModel) Get(_ context.Context, filter PatronFilter) (*Patron, error) {
+	filterQuery, err := buildPatronFilter(filter)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	return getOne[Patron](p.coll, filterQuery)
+}
+
+func (p memoryPatronModel) GetAll(_ context.Context, filter PatronFilter, paginator Paginator, sorter Sorter) ([]Patron, Metadata, error) {
+	filterQuery, err := buildPatronFilter(filter)
+	if err != nil {
+		return make([]Patron, 0), Metadata{}, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	return getAll[Patron](p.coll, filterQuery, paginator, sorter)
+}
+
+func (p memoryPatronModel) Count(_ context.Context, filter PatronFilter) (int64, error) {
+	filterQuery, err := buildPatronFilter(filter)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	docs, err := p.coll.find(filterQuery, nil, 0, 0)
+	return int64(len(docs)), err
+}
+
+func (p memoryPatronModel) Update(_ context.Context, filter PatronFilter, patron *Patron) error {
+	patron.Email = normalizeEmail(patron.Email)
+
+	filter.Version = &patron.Version
+	filterQuery, err := buildPatronFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	matched, err := p.coll.update(filterQuery, buildPatronUpdater(patron), false)
+	if err != nil {
+		return err
+	}
+	if matched == 0 {
+		return p.coll.unmatchedUpdateError(filterQuery)
+	}
+
+	return nil
+}
+
+func (p memoryPatronModel) Patch(_ context.Context, filter PatronFilter, original, patron *Patron) error {
+	patron.Email = normalizeEmail(patron.Email)
+
+	filterQuery, err := buildPatronFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	matched, err := p.coll.update(filterQuery, buildPatronPatcher(original, patron, patron), false)
+	if err != nil {
+		return err
+	}
+	if matched == 0 {
+		return ErrDocumentNotFound
+	}
+
+	return nil
+}
+
+func (p memoryPatronModel) IncrementPINFailures(_ context.Context, filter PatronFilter, maxFailures int) error {
+	filterQuery, err := buildPatronFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+	filterQuery[pinFailuresPath] = bson.M{"$lt": maxFailures}
+
+	matched, err := p.coll.update(filterQuery, bson.M{"$inc": bson.M{pinFailuresPath: 1, versionTag: 1}}, false)
+	if err != nil {
+		return err
+	}
+	if matched == 0 {
+		delete(filterQuery, pinFailuresPath)
+		return pinLockedError(p.coll.unmatchedUpdateError(filterQuery))
+	}
+
+	return nil
+}
+
+func (p memoryPatronModel) ResetPINFailures(_ context.Context, filter PatronFilter) error {
+	filterQuery, err := buildPatronFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	matched, err := p.coll.update(filterQuery, bson.M{"$set": bson.M{pinFailuresPath: 0}, "$inc": bson.M{versionTag: 1}}, false)
+	if err != nil {
+		return err
+	}
+	if matched == 0 {
+		return ErrDocumentNotFound
+	}
+
+	return nil
+}
+
+func (p memoryPatronModel) Delete(_ context.Context, filter PatronFilter) error {
+	filterQuery, err := buildPatronFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	deleted, err := p.coll.delete(filterQuery, false)
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrDocumentNotFound
+	}
+
+	return nil
+}
+
+type memoryTransactionModel struct {
+	coll  *memoryCollection
+	books *memoryCollection
+}
+
+func (t memoryTransactionModel) Insert(_ context.Context, transaction *Transaction) (string, error) {
+	transaction.CreatedAt = time.Now()
+	transaction.UpdatedAt = time.Now()
+
+	ids, err := t.coll.insert(transaction)
+	if err != nil {
+		return "", err
+	}
+
+	return ids[0], nil
+}
+
+func (t memoryTransactionModel) InsertMany(_ context.Context, transactions []*Transaction) ([]string, error) {
+	now := time.Now()
+	documents := make([]interface{}, 0, len(transactions))
+	for _, transaction := range transactions {
+		transaction.CreatedAt = now
+		transaction.UpdatedAt = now
+		documents = append(documents, transaction)
+	}
+
+	return t.coll.insert(documents...)
+}
+
+func (t memoryTransactionModel) Get(_ context.Context, filter TransactionFilter) (*Transaction, error) {
+	filterQuery, err := buildTransactionFilter(filter)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	return getOne[Transaction](t.coll, filterQuery)
+}
+
+func (t memoryTransactionModel) GetAll(_ context.Context, filter TransactionFilter, paginator Paginator, sorter Sorter) ([]Transaction, Metadata, error) {
+	filterQuery, err := buildTransactionFilter(filter)
+	if err != nil {
+		return make([]Transaction, 0), Metadata{}, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	return getAll[Transaction](t.coll, filterQuery, paginator, sorter)
+}
+
+func (t memoryTransactionModel) Update(_ context.Context, filter TransactionFilter, transaction *Transaction) error {
+	filter.Version = &transaction.Version
+	filterQuery, err := buildTransactionFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	matched, err := t.coll.update(filterQuery, buildTransactionUpdater(transaction), false)
+	if err != nil {
+		return err
+	}
+	if matched == 0 {
+		return t.coll.unmatchedUpdateError(filterQuery)
+	}
+
+	return nil
+}
+
+func (t memoryTransactionModel) Delete(_ context.Context, filter TransactionFilter) error {
+	filterQuery, err := buildTransactionFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	deleted, err := t.coll.delete(filterQuery, false)
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrDocumentNotFound
+	}
+
+	return nil
+}
+
+func (t memoryTransactionModel) DeleteMany(_ context.Context, filter TransactionFilter) (int64, error) {
+	filterQuery, err := buildTransactionFilter(filter)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	return t.coll.delete(filterQuery, true)
+}
+
+func (t memoryTransactionModel) Anonymize(_ context.Context, filter TransactionFilter) (int64, error) {
+	filterQuery, err := buildTransactionFilter(filter)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	return t.coll.update(filterQuery, buildTransactionAnonymizer(), true)
+}
+
+func (t memoryTransactionModel) ReassignPatron(_ context.Context, fromPatronID, toPatronID string) (int64, error) {
+	update := bson.D{
+		{Key: "$set", Value: bson.D{{Key: patronIDTag, Value: toPatronID}, {Key: updatedAtTag, Value: time.Now()}}},
+		{Key: "$inc", Value: bson.D{{Key: versionTag, Value: 1}}},
+	}
+
+	return t.coll.update(bson.M{patronIDTag: fromPatronID}, update, true)
+}
+
+func (t memoryTransactionModel) PatronStats(_ context.Context, patronID string, now time.Time) (*PatronStats, error) {
+	transactions, _, err := getAll[Transaction](t.coll, bson.M{patronIDTag: patronID}, Paginator{}, Sorter{})
+	if err != nil {
+		return nil, err
+	}
+
+	totals := loanTotals{}
+	genres := map[string]int{}
+	weeks := map[int]bool{}
+	var returns []Transaction
+
+	for _, transaction := range transactions {
+		if transaction.Status == TransactionStatusCanceled || transaction.BorrowedAt.After(now) {
+			continue
+		}
+
+		totals.Total++
+		if transaction.Status == TransactionStatusReturned && !transaction.ReturnedAt.After(now) {
+			totals.Returned++
+			if !transaction.ReturnedAt.After(transaction.DueDate) {
+				totals.OnTime++
+			}
+			returns = append(returns, transaction)
+		}
+
+		bookFilter, err := buildBookFilter(BookFilter{ID: ptr(BookID(transaction.BookID))})
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+		}
+		if book, err := getOne[Book](t.books, bookFilter); err == nil {
+			for _, genre := range book.Genres {
+				genres[genre]++
+			}
+		}
+
+		weeks[int(now.Sub(transaction.BorrowedAt)/week)] = true
+	}
+
+	loans := patronLoans{Totals: []loanTotals{totals}}
+
+	names := make([]string, 0, len(genres))
+	for genre := range genres {
+		names = append(names, genre)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if genres[names[i]] != genres[names[j]] {
+			return genres[names[i]] > genres[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	for _, genre := range names[:min(len(names), favoriteGenres)] {
+		loans.Genres = append(loans.Genres, loanGenre{Genre: genre})
+	}
+
+	sort.Slice(returns, func(i, j int) bool { return returns[i].ReturnedAt.After(returns[j].ReturnedAt) })
+	for _, transaction := range returns {
+		loans.Returns = append(loans.Returns, loanReturn{OnTime: !transaction.ReturnedAt.After(transaction.DueDate)})
+	}
+
+	for w := range weeks {
+		loans.Weeks = append(loans.Weeks, loanWeek{Week: w})
+	}
+	sort.Slice(loans.Weeks, func(i, j int) bool { return loans.Weeks[i].Week < loans.Weeks[j].Week })
+
+	return loans.stats(), nil
+}
+
+type memoryTokenModel struct {
+	coll *memoryCollection
+}
+
+func (t memoryTokenModel) New(ctx context.Context, patronID string, ttl time.Duration, scope string) (*Token, error) {
+	token, err := generateToken(patronID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	err = t.Insert(ctx, token)
+	return token, err
+}
+
+func (t memoryTokenModel) Insert(_ context.Context, token *Token) error {
+	_, err := t.coll.insert(token)
+	return err
+}
+
+func (t memoryTokenModel) GetPatronID(_ context.Context, filter TokenFilter) (string, error) {
+	filterQuery, err := buildTokenFilter(filter)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	token, err := getOne[Token](t.coll, filterQuery)
+	if err != nil {
+		return "", err
+	}
+
+	return token.PatronID, nil
+}
+
+func (t memoryTokenModel) DeleteAllForPatron(_ context.Context, filter TokenFilter) error {
+	filterQuery, err := buildTokenFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	deleted, err := t.coll.delete(filterQuery, true)
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrDocumentNotFound
+	}
+
+	return nil
+}
+
+type memoryAdminModel struct {
+	coll *memoryCollection
+}
+
+// CreateUniqueIndex is a no-op, since uniqueness is always enforced in memory.
+func (a memoryAdminModel) CreateUniqueIndex() error {
+	return nil
+}
+
+// DeleteDuplicates is a no-op, since uniqueness is always enforced in memory.
+func (a memoryAdminModel) DeleteDuplicates(_ context.Context) (int64, error) {
+	return 0, nil
+}
+
+func (a memoryAdminModel) Ensure(ctx context.Context, username, password string) (bool, error) {
+	if username == "" {
+		return false, ErrEmptyName
+	}
+
+	if _, err := getOne[Admin](a.coll, bson.M{nameTag: username}); err == nil {
+		return false, nil
+	}
+
+	admin, err := generateAdmin(username, password)
+	if err != nil {
+		return false, err
+	}
+
+	if err = a.Insert(ctx, admin); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (a memoryAdminModel) Insert(_ context.Context, admin *Admin) error {
+	_, err := a.coll.insert(admin)
+	return err
+}
+
+func (a memoryAdminModel) Get(_ context.Context, filter AdminFilter) (*Admin, error) {
+	filterQuery, err := buildAdminFilter(filter)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	return getOne[Admin](a.coll, filterQuery)
+}
+
+func (a memoryAdminModel) GetAll(_ context.Context, filter AdminFilter, paginator Paginator, sorter Sorter) ([]Admin, Metadata, error) {
+	filterQuery, err := buildAdminFilter(filter)
+	if err != nil {
+		return make([]Admin, 0), Metadata{}, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	return getAll[Admin](a.coll, filterQuery, paginator, sorter)
+}
+
+func (a memoryAdminModel) Update(_ context.Context, filter AdminFilter, admin *Admin) error {
+	filter.Version = &admin.Version
+	filterQuery, err := buildAdminFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	matched, err := a.coll.update(filterQuery, buildAdminUpdater(admin), false)
+	if err != nil {
+		return err
+	}
+	if matched == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+func (a memoryAdminModel) Delete(_ context.Context, filter AdminFilter) error {
+	filterQuery, err := buildAdminFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	deleted, err := a.coll.delete(filterQuery, false)
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrDocumentNotFound
+	}
+
+	return nil
+}
+
+type memoryCategoryModel struct {
+	coll *memoryCollection
+}
+
+// CreateUniqueIndex is a no-op, since uniqueness is always enforced in memory.
+func (c memoryCategoryModel) CreateUniqueIndex() error {
+	return nil
+}
+
+func (c memoryCategoryModel) EnsureDefaults(ctx context.Context, categories []*Category) error {
+	for _, category := range categories {
+		if _, err := getOne[Category](c.coll, bson.M{nameTag: category.Name}); err == nil {
+			continue
+		}
+
+		if _, err := c.Insert(ctx, category); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c memoryCategoryModel) Insert(_ context.Context, category *Category) (string, error) {
+	category.CreatedAt = time.Now()
+	category.UpdatedAt = time.Now()
+
+	ids, err := c.coll.insert(category)
+	if err != nil {
+		return "", err
+	}
+
+	return ids[0], nil
+}
+
+func (c memoryCategoryModel) Get(_ context.Context, filter CategoryFilter) (*Category, error) {
+	filterQuery, err := buildCategoryFilter(filter)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	return getOne[Category](c.coll, filterQuery)
+}
+
+func (c memoryCategoryModel) GetAll(_ context.Context, filter CategoryFilter) ([]Category, error) {
+	filterQuery, err := buildCategoryFilter(filter)
+	if err != nil {
+		return make([]Category, 0), fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	docs, err := c.coll.find(filterQuery, bson.D{{Key: nameTag, Value: 1}}, 0, 0)
+	if err != nil {
+		return make([]Category, 0), err
+	}
+
+	return fromDocuments[Category](docs)
+}
+
+func (c memoryCategoryModel) Update(_ context.Context, filter CategoryFilter, category *Category) error {
+	filter.Version = &category.Version
+	filterQuery, err := buildCategoryFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	matched, err := c.coll.update(filterQuery, buildCategoryUpdater(category), false)
+	if err != nil {
+		return err
+	}
+	if matched == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+func (c memoryCategoryModel) Delete(_ context.Context, filter CategoryFilter) error {
+	filterQuery, err := buildCategoryFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	deleted, err := c.coll.delete(filterQuery, false)
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrDocumentNotFound
+	}
+
+	return nil
+}
+
+type memoryPublisherModel struct {
+	coll *memoryCollection
+}
+
+// CreateUniqueIndex is a no-op, since uniqueness is always enforced in memory.
+func (p memoryPublisherModel) CreateUniqueIndex() error {
+	return nil
+}
+
+func (p memoryPublisherModel) Ensure(ctx context.Context, name string) (*Publisher, error) {
+	return ensurePublisher(ctx, p, name)
+}
+
+func (p memoryPublisherModel) Insert(_ context.Context, publisher *Publisher) (string, error) {
+	publisher.CreatedAt = time.Now()
+	publisher.UpdatedAt = time.Now()
+
+	ids, err := p.coll.insert(publisher)
+	if err != nil {
+		return "", err
+	}
+
+	return ids[0], nil
+}
+
+func (p memoryPublisherModel) Get(_ context.Context, filter PublisherFilter) (*Publisher, error) {
+	filterQuery, err := buildPublisherFilter(filter)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	return getOne[Publisher](p.coll, filterQuery)
+}
+
+func (p memoryPublisherModel) GetAll(_ context.Context, filter PublisherFilter, paginator Paginator, sorter Sorter) ([]Publisher, Metadata, error) {
+	filterQuery, err := buildPublisherFilter(filter)
+	if err != nil {
+		return make([]Publisher, 0), Metadata{}, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	return getAll[Publisher](p.coll, filterQuery, paginator, sorter)
+}
+
+func (p memoryPublisherModel) Update(_ context.Context, filter PublisherFilter, publisher *Publisher) error {
+	filter.Version = &publisher.Version
+	filterQuery, err := buildPublisherFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	matched, err := p.coll.update(filterQuery, buildPublisherUpdater(publisher), false)
+	if err != nil {
+		return err
+	}
+	if matched == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+func (p memoryPublisherModel) Delete(_ context.Context, filter PublisherFilter) error {
+	filterQuery, err := buildPublisherFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	deleted, err := p.coll.delete(filterQuery, false)
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrDocumentNotFound
+	}
+
+	return nil
+}
+
+type memoryNotificationModel struct {
+	coll *memoryCollection
+}
+
+// CreateIndexes is a no-op, since memory collections are not indexed.
+func (n memoryNotificationModel) CreateIndexes() error {
+	return nil
+}
+
+func (n memoryNotificationModel) Insert(_ context.Context, notification *Notification) (string, error) {
+	notification.CreatedAt = time.Now()
+	notification.UpdatedAt = time.Now()
+
+	ids, err := n.coll.insert(notification)
+	if err != nil {
+		return "", err
+	}
+
+	return ids[0], nil
+}
+
+func (n memoryNotificationModel) Get(_ context.Context, filter NotificationFilter) (*Notification, error) {
+	filterQuery, err := buildNotificationFilter(filter)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	return getOne[Notification](n.coll, filterQuery)
+}
+
+func (n memoryNotificationModel) GetAll(_ context.Context, filter NotificationFilter, paginator Paginator, sorter Sorter) ([]Notification, Metadata, error) {
+	filterQuery, err := buildNotificationFilter(filter)
+	if err != nil {
+		return make([]Notification, 0), Metadata{}, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	return getAll[Notification](n.coll, filterQuery, paginator, sorter)
+}
+
+func (n memoryNotificationModel) Update(_ context.Context, filter NotificationFilter, notification *Notification) error {
+	filter.Version = &notification.Version
+	filterQuery, err := buildNotificationFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	matched, err := n.coll.update(filterQuery, buildNotificationUpdater(notification), false)
+	if err != nil {
+		return err
+	}
+	if matched == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+type memoryEventModel struct {
+	coll *memoryCollection
+}
+
+// CreateIndexes is a no-op, since memory collections are not indexed.
+func (e memoryEventModel) CreateIndexes() error {
+	return nil
+}
+
+func (e memoryEventModel) Insert(_ context.Context, event *Event) (string, error) {
+	event.CreatedAt = time.Now()
+	event.UpdatedAt = time.Now()
+
+	ids, err := e.coll.insert(event)
+	if err != nil {
+		return "", err
+	}
+
+	return ids[0], nil
+}
+
+func (e memoryEventModel) Get(_ context.Context, filter EventFilter) (*Event, error) {
+	filterQuery, err := buildEventFilter(filter)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	return getOne[Event](e.coll, filterQuery)
+}
+
+func (e memoryEventModel) GetAll(_ context.Context, filter EventFilter, paginator Paginator, sorter Sorter) ([]Event, Metadata, error) {
+	filterQuery, err := buildEventFilter(filter)
+	if err != nil {
+		return make([]Event, 0), Metadata{}, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	return getAll[Event](e.coll, filterQuery, paginator, sorter)
+}
+
+func (e memoryEventModel) Update(_ context.Context, filter EventFilter, event *Event) error {
+	filter.Version = &event.Version
+	filterQuery, err := buildEventFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	matched, err := e.coll.update(filterQuery, buildEventUpdater(event), false)
+	if err != nil {
+		return err
+	}
+	if matched == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+// memoryAvailabilityModel derives the availability of books when it is read, since memory
+// collections have no change streams. It is always up to date, unlike AvailabilityModel.
+type memoryAvailabilityModel struct {
+	coll         *memoryCollection
+	books        *memoryCollection
+	transactions *memoryCollection
+}
+
+// CreateIndexes is a no-op, since memory collections are not indexed.
+func (a memoryAvailabilityModel) CreateIndexes() error {
+	return nil
+}
+
+func (a memoryAvailabilityModel) Refresh(_ context.Context, bookID string) error {
+	filterQuery, err := buildBookFilter(BookFilter{ID: ptr(BookID(bookID))})
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	if _, err = a.coll.delete(bson.M{idTag: bookID}, false); err != nil {
+		return err
+	}
+
+	book, err := getOne[Book](a.books, filterQuery)
+	if err != nil {
+		if errors.Is(err, ErrDocumentNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	transactions, _, err := getAll[Transaction](a.transactions, bson.M{bookIDTag: bookID}, Paginator{}, Sorter{})
+	if err != nil {
+		return err
+	}
+
+	var stats loanStats
+	for _, transaction := range transactions {
+		stats.TotalLoans++
+		if transaction.Status == TransactionStatusBorrowed {
+			stats.ActiveLoans++
+		}
+		if transaction.BorrowedAt.After(stats.LastBorrowedAt) {
+			stats.LastBorrowedAt = transaction.BorrowedAt
+		}
+		if transaction.ReturnedAt.After(stats.LastReturnedAt) {
+			stats.LastReturnedAt = transaction.ReturnedAt
+		}
+	}
+
+	_, err = a.coll.insert(newBookAvailability(book, stats))
+	return err
+}
+
+func (a memoryAvailabilityModel) Rebuild(ctx context.Context) (int, error) {
+	books, _, err := getAll[Book](a.books, bson.M{}, Paginator{}, Sorter{})
+	if err != nil {
+		return 0, err
+	}
+
+	ids := make([]string, 0, len(books))
+	for _, book := range books {
+		if err = a.Refresh(ctx, book.ID); err != nil {
+			return len(ids), err
+		}
+		ids = append(ids, book.ID)
+	}
+
+	_, err = a.coll.delete(bson.M{idTag: bson.M{"$nin": ids}}, true)
+	return len(ids), err
+}
+
+// Watch blocks until ctx is canceled, since the availability is derived when it is read.
+func (a memoryAvailabilityModel) Watch(ctx context.Context) error {
+	<-ctx.Done()
+	return nil
+}
+
+func (a memoryAvailabilityModel) Get(ctx context.Context, bookID string) (*BookAvailability, error) {
+	if err := a.Refresh(ctx, bookID); err != nil {
+		return nil, err
+	}
+
+	return getOne[BookAvailability](a.coll, buildAvailabilityFilter(AvailabilityFilter{BookID: &bookID}))
+}
+
+func (a memoryAvailabilityModel) GetAll(ctx context.Context, filter AvailabilityFilter, paginator Paginator, sorter Sorter) ([]BookAvailability, Metadata, error) {
+	if _, err := a.Rebuild(ctx); err != nil {
+		return make([]BookAvailability, 0), Metadata{}, err
+	}
+
+	return getAll[BookAvailability](a.coll, buildAvailabilityFilter(filter), paginator, sorter)
+}
+
+type memoryKioskModel struct {
+	coll *memoryCollection
+}
+
+// CreateIndexes is a no-op, since memory collections are not indexed.
+func (k memoryKioskModel) CreateIndexes() error {
+	return nil
+}
+
+func (k memoryKioskModel) Insert(_ context.Context, kiosk *Kiosk) (string, error) {
+	ids, err := k.coll.insert(kiosk)
+	if err != nil {
+		return "", err
+	}
+
+	return ids[0], nil
+}
+
+func (k memoryKioskModel) Get(_ context.Context, filter KioskFilter) (*Kiosk, error) {
+	filterQuery, err := buildKioskFilter(filter)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	return getOne[Kiosk](k.coll, filterQuery)
+}
+
+func (k memoryKioskModel) GetAll(_ context.Context, filter KioskFilter, paginator Paginator, sorter Sorter) ([]Kiosk, Metadata, error) {
+	filterQuery, err := buildKioskFilter(filter)
+	if err != nil {
+		return make([]Kiosk, 0), Metadata{}, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	return getAll[Kiosk](k.coll, filterQuery, paginator, sorter)
+}
+
+func (k memoryKioskModel) Delete(_ context.Context, filter KioskFilter) error {
+	filterQuery, err := buildKioskFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	deleted, err := k.coll.delete(filterQuery, false)
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrDocumentNotFound
+	}
+
+	return nil
+}
+
+type memoryKioskRequestModel struct {
+	coll *memoryCollection
+}
+
+// CreateUniqueIndex is a no-op, since uniqueness is always enforced in memory.
+func (k memoryKioskRequestModel) CreateUniqueIndex() error {
+	return nil
+}
+
+func (k memoryKioskRequestModel) Insert(_ context.Context, request *KioskRequest) (string, error) {
+	request.CreatedAt = time.Now()
+
+	ids, err := k.coll.insert(request)
+	if err != nil {
+		return "", err
+	}
+
+	return ids[0], nil
+}
+
+func (k memoryKioskRequestModel) Get(_ context.Context, filter KioskRequestFilter) (*KioskRequest, error) {
+	return getOne[KioskRequest](k.coll, buildKioskRequestFilter(filter))
+}
+
+type memoryAuditModel struct {
+	coll *memoryCollection
+}
+
+// CreateIndexes is a no-op, since memory collections are not indexed.
+func (a memoryAuditModel) CreateIndexes() error {
+	return nil
+}
+
+func (a memoryAuditModel) Insert(_ context.Context, entry *AuditEntry) (string, error) {
+	ids, err := a.coll.insert(entry)
+	if err != nil {
+		return "", err
+	}
+
+	return ids[0], nil
+}
+
+func (a memoryAuditModel) GetAll(_ context.Context, filter AuditFilter, paginator Paginator, sorter Sorter) ([]AuditEntry, Metadata, error) {
+	return getAll[AuditEntry](a.coll, buildAuditFilter(filter), paginator, sorter)
+}
+
+type memoryDailyStatsModel struct {
+	coll *memoryCollection
+}
+
+// CreateIndexes is a no-op, since memory collections are not indexed.
+func (d memoryDailyStatsModel) CreateIndexes() error {
+	return nil
+}
+
+func (d memoryDailyStatsModel) Insert(_ context.Context, stats *DailyStats) error {
+	_, err := d.coll.insert(stats)
+	return err
+}
+
+func (d memoryDailyStatsModel) GetAll(_ context.Context, filter DailyStatsFilter, paginator Paginator, sorter Sorter) ([]DailyStats, Metadata, error) {
+	return getAll[DailyStats](d.coll, buildDailyStatsFilter(filter), paginator, sorter)
+}
+
+type memoryPaymentModel struct {
+	coll *memoryCollection
+}
+
+// CreateIndexes is a no-op, since memory collections are not indexed.
+func (p memoryPaymentModel) CreateIndexes() error {
+	return nil
+}
+
+func (p memoryPaymentModel) Insert(_ context.Context, payment *Payment) (string, error) {
+	now := time.Now()
+	payment.CreatedAt = now
+	payment.UpdatedAt = now
+
+	ids, err := p.coll.insert(payment)
+	if err != nil {
+		return "", err
+	}
+
+	return ids[0], nil
+}
+
+func (p memoryPaymentModel) Get(_ context.Context, filter PaymentFilter) (*Payment, error) {
+	filterQuery, err := buildPaymentFilter(filter)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	docs, err := p.coll.find(filterQuery, bson.D{{Key: createdAtTag, Value: -1}}, 0, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(docs) == 0 {
+		return nil, ErrDocumentNotFound
+	}
+
+	payments, err := fromDocuments[Payment](docs)
+	if err != nil {
+		return nil, err
+	}
+
+	return &payments[0], nil
+}
+
+func (p memoryPaymentModel) GetAll(_ context.Context, filter PaymentFilter, paginator Paginator, sorter Sorter) ([]Payment, Metadata, error) {
+	filterQuery, err := buildPaymentFilter(filter)
+	if err != nil {
+		return nil, Metadata{}, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	return getAll[Payment](p.coll, filterQuery, paginator, sorter)
+}
+
+func (p memoryPaymentModel) Update(_ context.Context, filter PaymentFilter, payment *Payment) error {
+	filter.Version = &payment.Version
+	filterQuery, err := buildPaymentFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	matched, err := p.coll.update(filterQuery, buildPaymentUpdater(payment), false)
+	if err != nil {
+		return err
+	}
+	if matched == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+type memoryAcquisitionModel struct {
+	coll *memoryCollection
+}
+
+// CreateIndexes is a no-op, since memory collections are not indexed.
+func (a memoryAcquisitionModel) CreateIndexes() error {
+	return nil
+}
+
+func (a memoryAcquisitionModel) Insert(_ context.Context, acquisition *Acquisition) (string, error) {
+	now := time.Now()
+	acquisition.CreatedAt = now
+	acquisition.UpdatedAt = now
+
+	ids, err := a.coll.insert(acquisition)
+	if err != nil {
+		return "", err
+	}
+
+	return ids[0], nil
+}
+
+func (a memoryAcquisitionModel) Get(_ context.Context, filter AcquisitionFilter) (*Acquisition, error) {
+	filterQuery, err := buildAcquisitionFilter(filter)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	return getOne[Acquisition](a.coll, filterQuery)
+}
+
+func (a memoryAcquisitionModel) GetAll(_ context.Context, filter AcquisitionFilter, paginator Paginator, sorter Sorter) ([]Acquisition, Metadata, error) {
+	filterQuery, err := buildAcquisitionFilter(filter)
+	if err != nil {
+		return make([]Acquisition, 0), Metadata{}, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	return getAll[Acquisition](a.coll, filterQuery, paginator, sorter)
+}
+
+func (a memoryAcquisitionModel) Update(_ context.Context, filter AcquisitionFilter, acquisition *Acquisition) error {
+	filter.Version = &acquisition.Version
+	filterQuery, err := buildAcquisitionFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	matched, err := a.coll.update(filterQuery, buildAcquisitionUpdater(acquisition), false)
+	if err != nil {
+		return err
+	}
+	if matched == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+type memoryWithdrawalModel struct {
+	coll *memoryCollection
+}
+
+// CreateIndexes is a no-op, since memory collections are not indexed.
+func (w memoryWithdrawalModel) CreateIndexes() error {
+	return nil
+}
+
+func (w memoryWithdrawalModel) Insert(_ context.Context, withdrawal *Withdrawal) (string, error) {
+	ids, err := w.coll.insert(withdrawal)
+	if err != nil {
+		return "", err
+	}
+
+	return ids[0], nil
+}
+
+func (w memoryWithdrawalModel) GetAll(_ context.Context, filter WithdrawalFilter, paginator Paginator, sorter Sorter) ([]Withdrawal, Metadata, error) {
+	return getAll[Withdrawal](w.coll, buildWithdrawalFilter(filter), paginator, sorter)
+}
+
+type memoryInventorySessionModel struct {
+	coll *memoryCollection
+}
+
+func (i memoryInventorySessionModel) Insert(_ context.Context, session *InventorySession) (string, error) {
+	session.UpdatedAt = time.Now()
+
+	ids, err := i.coll.insert(session)
+	if err != nil {
+		return "", err
+	}
+
+	return ids[0], nil
+}
+
+func (i memoryInventorySessionModel) Get(_ context.Context, filter InventorySessionFilter) (*InventorySession, error) {
+	filterQuery, err := buildInventorySessionFilter(filter)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	return getOne[InventorySession](i.coll, filterQuery)
+}
+
+func (i memoryInventorySessionModel) GetAll(_ context.Context, filter InventorySessionFilter, paginator Paginator, sorter Sorter) ([]InventorySession, Metadata, error) {
+	filterQuery, err := buildInventorySessionFilter(filter)
+	if err != nil {
+		return make([]InventorySession, 0), Metadata{}, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	return getAll[InventorySession](i.coll, filterQuery, paginator, sorter)
+}
+
+func (i memoryInventorySessionModel) Update(_ context.Context, filter InventorySessionFilter, session *InventorySession) error {
+	filter.Version = &session.Version
+	filterQuery, err := buildInventorySessionFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	matched, err := i.coll.update(filterQuery, buildInventorySessionUpdater(session), false)
+	if err != nil {
+		return err
+	}
+	if matched == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+type memoryInventoryScanModel struct {
+	coll *memoryCollection
+}
+
+// CreateIndexes is a no-op, since memory collections are not indexed.
+func (i memoryInventoryScanModel) CreateIndexes() error {
+	return nil
+}
+
+func (i memoryInventoryScanModel) InsertMany(_ context.Context, scans []*InventoryScan) ([]string, error) {
+	documents := make([]interface{}, 0, len(scans))
+	for _, scan := range scans {
+		documents = append(documents, scan)
+	}
+
+	return i.coll.insert(documents...)
+}
+
+func (i memoryInventoryScanModel) GetAll(_ context.Context, filter InventoryScanFilter) ([]InventoryScan, error) {
+	scans, _, err := getAll[InventoryScan](i.coll, buildInventoryScanFilter(filter), Paginator{}, Sorter{})
+	return scans, err
+}
+
+type memorySuggestionModel struct {
+	coll *memoryCollection
+}
+
+// CreateIndexes is a no-op, since memory collections are not indexed.
+func (s memorySuggestionModel) CreateIndexes() error {
+	return nil
+}
+
+func (s memorySuggestionModel) Insert(_ context.Context, suggestion *Suggestion) (string, error) {
+	now := time.Now()
+	suggestion.CreatedAt = now
+	suggestion.UpdatedAt = now
+
+	ids, err := s.coll.insert(suggestion)
+	if err != nil {
+		return "", err
+	}
+
+	return ids[0], nil
+}
+
+func (s memorySuggestionModel) Get(_ context.Context, filter SuggestionFilter) (*Suggestion, error) {
+	filterQuery, err := buildSuggestionFilter(filter)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	return getOne[Suggestion](s.coll, filterQuery)
+}
+
+func (s memorySuggestionModel) GetAll(_ context.Context, filter SuggestionFilter, paginator Paginator, sorter Sorter) ([]Suggestion, Metadata, error) {
+	filterQuery, err := buildSuggestionFilter(filter)
+	if err != nil {
+		return make([]Suggestion, 0), Metadata{}, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	return getAll[Suggestion](s.coll, filterQuery, paginator, sorter)
+}
+
+func (s memorySuggestionModel) Update(_ context.Context, filter SuggestionFilter, suggestion *Suggestion) error {
+	filter.Version = &suggestion.Version
+	filterQuery, err := buildSuggestionFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	matched, err := s.coll.update(filterQuery, buildSuggestionUpdater(suggestion), false)
+	if err != nil {
+		return err
+	}
+	if matched == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+type memoryResourceModel struct {
+	coll *memoryCollection
+}
+
+// CreateIndexes is a no-op, since memory collections are not indexed.
+func (r memoryResourceModel) CreateIndexes() error {
+	return nil
+}
+
+func (r memoryResourceModel) Insert(_ context.Context, resource *Resource) (string, error) {
+	now := time.Now()
+	resource.CreatedAt = now
+	resource.UpdatedAt = now
+
+	ids, err := r.coll.insert(resource)
+	if err != nil {
+		return "", err
+	}
+
+	return ids[0], nil
+}
+
+func (r memoryResourceModel) Get(_ context.Context, filter ResourceFilter) (*Resource, error) {
+	filterQuery, err := buildResourceFilter(filter)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	return getOne[Resource](r.coll, filterQuery)
+}
+
+func (r memoryResourceModel) GetAll(_ context.Context, filter ResourceFilter, paginator Paginator, sorter Sorter) ([]Resource, Metadata, error) {
+	filterQuery, err := buildResourceFilter(filter)
+	if err != nil {
+		return make([]Resource, 0), Metadata{}, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	return getAll[Resource](r.coll, filterQuery, paginator, sorter)
+}
+
+func (r memoryResourceModel) Update(_ context.Context, filter ResourceFilter, resource *Resource) error {
+	filter.Version = &resource.Version
+	filterQuery, err := buildResourceFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	matched, err := r.coll.update(filterQuery, buildResourceUpdater(resource), false)
+	if err != nil {
+		return err
+	}
+	if matched == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+type memoryReservationModel struct {
+	coll *memoryCollection
+}
+
+// CreateIndexes is a no-op, since memory collections are not indexed.
+func (r memoryReservationModel) CreateIndexes() error {
+	return nil
+}
+
+func (r memoryReservationModel) Insert(_ context.Context, reservation *Reservation) (string, error) {
+	now := time.Now()
+	reservation.CreatedAt = now
+	reservation.UpdatedAt = now
+
+	ids, err := r.coll.insert(reservation)
+	if err != nil {
+		return "", err
+	}
+
+	return ids[0], nil
+}
+
+func (r memoryReservationModel) Get(_ context.Context, filter ReservationFilter) (*Reservation, error) {
+	filterQuery, err := buildReservationFilter(filter)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	return getOne[Reservation](r.coll, filterQuery)
+}
+
+func (r memoryReservationModel) GetAll(_ context.Context, filter ReservationFilter, paginator Paginator, sorter Sorter) ([]Reservation, Metadata, error) {
+	filterQuery, err := buildReservationFilter(filter)
+	if err != nil {
+		return make([]Reservation, 0), Metadata{}, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	return getAll[Reservation](r.coll, filterQuery, paginator, sorter)
+}
+
+func (r memoryReservationModel) Update(_ context.Context, filter ReservationFilter, reservation *Reservation) error {
+	filter.Version = &reservation.Version
+	filterQuery, err := buildReservationFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	matched, err := r.coll.update(filterQuery, buildReservationUpdater(reservation), false)
+	if err != nil {
+		return err
+	}
+	if matched == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+type memoryProgramModel struct {
+	coll *memoryCollection
+}
+
+// CreateIndexes is a no-op, since memory collections are not indexed.
+func (p memoryProgramModel) CreateIndexes() error {
+	return nil
+}
+
+func (p memoryProgramModel) Insert(_ context.Context, program *Program) (string, error) {
+	now := time.Now()
+	program.CreatedAt = now
+	program.UpdatedAt = now
+
+	ids, err := p.coll.insert(program)
+	if err != nil {
+		return "", err
+	}
+
+	return ids[0], nil
+}
+
+func (p memoryProgramModel) Get(_ context.Context, filter ProgramFilter) (*Program, error) {
+	filterQuery, err := buildProgramFilter(filter)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	return getOne[Program](p.coll, filterQuery)
+}
+
+func (p memoryProgramModel) GetAll(_ context.Context, filter ProgramFilter, paginator Paginator, sorter Sorter) ([]Program, Metadata, error) {
+	filterQuery, err := buildProgramFilter(filter)
+	if err != nil {
+		return make([]Program, 0), Metadata{}, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	return getAll[Program](p.coll, filterQuery, paginator, sorter)
+}
+
+func (p memoryProgramModel) Update(_ context.Context, filter ProgramFilter, program *Program) error {
+	filter.Version = &program.Version
+	filterQuery, err := buildProgramFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	matched, err := p.coll.update(filterQuery, buildProgramUpdater(program), false)
+	if err != nil {
+		return err
+	}
+	if matched == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+func (p memoryProgramModel) Delete(_ context.Context, filter ProgramFilter) error {
+	filterQuery, err := buildProgramFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	deleted, err := p.coll.delete(filterQuery, false)
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrDocumentNotFound
+	}
+
+	return nil
+}
+
+type memoryRegistrationModel struct {
+	coll *memoryCollection
+}
+
+// CreateIndexes is a no-op, since memory collections are not indexed.
+func (r memoryRegistrationModel) CreateIndexes() error {
+	return nil
+}
+
+func (r memoryRegistrationModel) Insert(_ context.Context, registration *Registration) (string, error) {
+	now := time.Now()
+	registration.CreatedAt = now
+	registration.UpdatedAt = now
+
+	ids, err := r.coll.insert(registration)
+	if err != nil {
+		return "", err
+	}
+
+	return ids[0], nil
+}
+
+func (r memoryRegistrationModel) Get(_ context.Context, filter RegistrationFilter) (*Registration, error) {
+	filterQuery, err := buildRegistrationFilter(filter)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	return getOne[Registration](r.coll, filterQuery)
+}
+
+func (r memoryRegistrationModel) GetAll(_ context.Context, filter RegistrationFilter, paginator Paginator, sorter Sorter) ([]Registration, Metadata, error) {
+	filterQuery, err := buildRegistrationFilter(filter)
+	if err != nil {
+		return make([]Registration, 0), Metadata{}, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	return getAll[Registration](r.coll, filterQuery, paginator, sorter)
+}
+
+func (r memoryRegistrationModel) Update(_ context.Context, filter RegistrationFilter, registration *Registration) error {
+	filter.Version = &registration.Version
+	filterQuery, err := buildRegistrationFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	matched, err := r.coll.update(filterQuery, buildRegistrationUpdater(registration), false)
+	if err != nil {
+		return err
+	}
+	if matched == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+type memoryAnnouncementModel struct {
+	coll *memoryCollection
+}
+
+// CreateIndexes is a no-op, since memory collections are not indexed.
+func (a memoryAnnouncementModel) CreateIndexes() error {
+	return nil
+}
+
+func (a memoryAnnouncementModel) Insert(_ context.Context, announcement *Announcement) (string, error) {
+	now := time.Now()
+	announcement.CreatedAt = now
+	announcement.UpdatedAt = now
+
+	ids, err := a.coll.insert(announcement)
+	if err != nil {
+		return "", err
+	}
+
+	return ids[0], nil
+}
+
+func (a memoryAnnouncementModel) Get(_ context.Context, filter AnnouncementFilter) (*Announcement, error) {
+	filterQuery, err := buildAnnouncementFilter(filter)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	return getOne[Announcement](a.coll, filterQuery)
+}
+
+func (a memoryAnnouncementModel) GetAll(_ context.Context, filter AnnouncementFilter, paginator Paginator, sorter Sorter) ([]Announcement, Metadata, error) {
+	filterQuery, err := buildAnnouncementFilter(filter)
+	if err != nil {
+		return make([]Announcement, 0), Metadata{}, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	return getAll[Announcement](a.coll, filterQuery, paginator, sorter)
+}
+
+func (a memoryAnnouncementModel) Update(_ context.Context, filter AnnouncementFilter, announcement *Announcement) error {
+	filter.Version = &announcement.Version
+	filterQuery, err := buildAnnouncementFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	matched, err := a.coll.update(filterQuery, buildAnnouncementUpdater(announcement), false)
+	if err != nil {
+		return err
+	}
+	if matched == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+func (a memoryAnnouncementModel) Delete(_ context.Context, filter AnnouncementFilter) error {
+	filterQuery, err := buildAnnouncementFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	deleted, err := a.coll.delete(filterQuery, false)
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrDocumentNotFound
+	}
+
+	return nil
+}
+
+type memorySavedSearchModel struct {
+	coll *memoryCollection
+}
+
+// CreateIndexes is a no-op, since memory collections are not indexed.
+func (s memorySavedSearchModel) CreateIndexes() error {
+	return nil
+}
+
+func (s memorySavedSearchModel) Insert(_ context.Context, search *SavedSearch) (string, error) {
+	now := time.Now()
+	search.CreatedAt = now
+	search.UpdatedAt = now
+
+	ids, err := s.coll.insert(search)
+	if err != nil {
+		return "", err
+	}
+
+	return ids[0], nil
+}
+
+func (s memorySavedSearchModel) Get(_ context.Context, filter SavedSearchFilter) (*SavedSearch, error) {
+	filterQuery, err := buildSavedSearchFilter(filter)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	return getOne[SavedSearch](s.coll, filterQuery)
+}
+
+func (s memorySavedSearchModel) GetAll(_ context.Context, filter SavedSearchFilter, paginator Paginator, sorter Sorter) ([]SavedSearch, Metadata, error) {
+	filterQuery, err := buildSavedSearchFilter(filter)
+	if err != nil {
+		return make([]SavedSearch, 0), Metadata{}, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	return getAll[SavedSearch](s.coll, filterQuery, paginator, sorter)
+}
+
+func (s memorySavedSearchModel) Update(_ context.Context, filter SavedSearchFilter, search *SavedSearch) error {
+	filter.Version = &search.Version
+	filterQuery, err := buildSavedSearchFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	matched, err := s.coll.update(filterQuery, buildSavedSearchUpdater(search), false)
+	if err != nil {
+		return err
+	}
+	if matched == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+func (s memorySavedSearchModel) Delete(_ context.Context, filter SavedSearchFilter) error {
+	filterQuery, err := buildSavedSearchFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	deleted, err := s.coll.delete(filterQuery, false)
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return ErrDocumentNotFound
+	}
+
+	return nil
+}
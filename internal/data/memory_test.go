@@ -0,0 +1,182 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"slices"
+	"testing"
+)
+
+func TestMemoryUpdateErrors(t *testing.T) {
+	ctx := context.Background()
+	models := NewMemoryModels()
+	missing := "995cb5a4d3ddbde5ebeecc1f"
+
+	bookID, err := models.Books.Insert(ctx, &Book{Title: "Test"})
+	if err != nil {
+		t.Fatalf("Books.Insert() error = %v", err)
+	}
+	patronID, err := models.Patrons.Insert(ctx, &Patron{Name: "Test", Email: "test@example.com"})
+	if err != nil {
+		t.Fatalf("Patrons.Insert() error = %v", err)
+	}
+	transactionID, err := models.Transactions.Insert(ctx, &Transaction{PatronID: patronID, BookID: bookID, Status: TransactionStatusBorrowed})
+	if err != nil {
+		t.Fatalf("Transactions.Insert() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		update func(id string, version int32) error
+		id     string
+	}{
+		{
+			name: "Book",
+			update: func(id string, version int32) error {
+				return models.Books.Update(ctx, BookFilter{ID: ptr(BookID(id))}, &Book{Version: version})
+			},
+			id: bookID,
+		},
+		{
+			name: "Patron",
+			update: func(id string, version int32) error {
+				return models.Patrons.Update(ctx, PatronFilter{ID: ptr(PatronID(id))}, &Patron{Email: "test@example.com", Version: version})
+			},
+			id: patronID,
+		},
+		{
+			name: "Transaction",
+			update: func(id string, version int32) error {
+				return models.Transactions.Update(ctx, TransactionFilter{ID: ptr(TransactionID(id))}, &Transaction{Version: version})
+			},
+			id: transactionID,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.update(missing, 0); !errors.Is(err, ErrDocumentNotFound) {
+				t.Errorf("Update() of a missing document error = %v; want %v", err, ErrDocumentNotFound)
+			}
+
+			if err := tt.update(tt.id, 0); err != nil {
+				t.Fatalf("Update() error = %v", err)
+			}
+
+			// The version of the document was incremented by the first update.
+			if err := tt.update(tt.id, 0); !errors.Is(err, ErrEditConflict) {
+				t.Errorf("Update() of a stale version error = %v; want %v", err, ErrEditConflict)
+			}
+		})
+	}
+}
+
+func TestMemoryUpdateLegacyAdmin(t *testing.T) {
+	ctx := context.Background()
+	models := NewMemoryModels()
+
+	// Admins created before versioning have no version field.
+	if _, err := models.Admins.(memoryAdminModel).coll.insert(bson.M{nameTag: "legacy", activatedTag: true}); err != nil {
+		t.Fatalf("insert() error = %v", err)
+	}
+
+	admin, err := models.Admins.Get(ctx, AdminFilter{Name: ptr("legacy")})
+	if err != nil {
+		t.Fatalf("Admins.Get() error = %v", err)
+	}
+	if admin.Version != 0 {
+		t.Fatalf("Admins.Get() version = %v; want 0", admin.Version)
+	}
+
+	admin.Name = "renamed"
+	if err = models.Admins.Update(ctx, AdminFilter{ID: &admin.ID}, admin); err != nil {
+		t.Fatalf("Admins.Update() of an admin without a version error = %v", err)
+	}
+
+	// The update set the version to 1, so version 0 no longer matches.
+	if err = models.Admins.Update(ctx, AdminFilter{ID: &admin.ID}, admin); !errors.Is(err, ErrEditConflict) {
+		t.Errorf("Admins.Update() of a stale version error = %v; want %v", err, ErrEditConflict)
+	}
+}
+
+func TestMemoryPatch(t *testing.T) {
+	ctx := context.Background()
+	models := NewMemoryModels()
+
+	id, err := models.Books.Insert(ctx, &Book{Title: "Test", Pages: 100, Genres: []string{"Fiction"}})
+	if err != nil {
+		t.Fatalf("Books.Insert() error = %v", err)
+	}
+	filter := BookFilter{ID: ptr(BookID(id))}
+
+	// Two updates of different fields of the same version of the book.
+	first, err := models.Books.Get(ctx, filter)
+	if err != nil {
+		t.Fatalf("Books.Get() error = %v", err)
+	}
+	second := *first
+
+	titled := *first
+	titled.Title = "Retitled"
+	if err = models.Books.Patch(ctx, filter, first, &titled); err != nil {
+		t.Fatalf("Books.Patch() of the title error = %v", err)
+	}
+
+	paged := second
+	paged.Pages = 200
+	if err = models.Books.Patch(ctx, filter, &second, &paged); err != nil {
+		t.Fatalf("Books.Patch() of the pages error = %v", err)
+	}
+
+	book, err := models.Books.Get(ctx, filter)
+	if err != nil {
+		t.Fatalf("Books.Get() error = %v", err)
+	}
+	if book.Title != "Retitled" || book.Pages != 200 || book.Version != 2 {
+		t.Errorf("Books.Get() = %q with %v pages at version %v; want %q with %v pages at version %v", book.Title, book.Pages, book.Version, "Retitled", 200, 2)
+	}
+
+	if err = models.Books.Patch(ctx, BookFilter{ID: ptr(BookID("995cb5a4d3ddbde5ebeecc1f"))}, first, &titled); !errors.Is(err, ErrDocumentNotFound) {
+		t.Errorf("Books.Patch() of a missing book error = %v; want %v", err, ErrDocumentNotFound)
+	}
+}
+
+func TestMemoryCollation(t *testing.T) {
+	ctx := context.Background()
+	models := NewMemoryModels()
+
+	for _, title := range []string{"Zebra", "Émile", "apple", "Eagle"} {
+		if _, err := models.Books.Insert(ctx, &Book{Title: title}); err != nil {
+			t.Fatalf("Books.Insert() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		collation string
+		want      []string
+	}{
+		{want: []string{"Eagle", "Zebra", "apple", "Émile"}},
+		{collation: "en", want: []string{"apple", "Eagle", "Émile", "Zebra"}},
+		{collation: "fr_CA", want: []string{"apple", "Eagle", "Émile", "Zebra"}},
+	}
+
+	for _, tt := range tests {
+		books, _, err := models.Books.GetAll(ctx, BookFilter{}, Paginator{}, Sorter{Field: "title", SortSafelist: []string{"title"}, Collation: tt.collation})
+		if err != nil {
+			t.Fatalf("GetAll() with collation %q error = %v", tt.collation, err)
+		}
+
+		var got []string
+		for _, book := range books {
+			got = append(got, book.Title)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("GetAll() with collation %q = %v; want %v", tt.collation, got, tt.want)
+		}
+	}
+
+	if _, _, err := models.Books.GetAll(ctx, BookFilter{}, Paginator{}, Sorter{Collation: "not a locale"}); err == nil {
+		t.Errorf("GetAll() with an invalid collation error = nil; want an error")
+	}
+}
@@ -1,8 +1,16 @@
 package data
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"github.com/mzeevi/library/internal/encryption"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"maps"
+	"time"
 )
 
 var (
@@ -12,27 +20,419 @@ var (
 )
 
 const (
-	BooksCollectionKey        = "books"
-	PatronsCollectionKey      = "patrons"
-	TransactionsCollectionKey = "transactions"
-	TokensCollectionKey       = "tokens"
-	AdminsCollectionKey       = "admins"
+	BooksCollectionKey             = "books"
+	PatronsCollectionKey           = "patrons"
+	TransactionsCollectionKey      = "transactions"
+	TokensCollectionKey            = "tokens"
+	AdminsCollectionKey            = "admins"
+	CategoriesCollectionKey        = "categories"
+	PublishersCollectionKey        = "publishers"
+	NotificationsCollectionKey     = "notifications"
+	EventsCollectionKey            = "events"
+	AvailabilityCollectionKey      = "availability"
+	KiosksCollectionKey            = "kiosks"
+	KioskRequestsCollectionKey     = "kiosk_requests"
+	AuditCollectionKey             = "audit"
+	PaymentsCollectionKey          = "payments"
+	AcquisitionsCollectionKey      = "acquisitions"
+	WithdrawalsCollectionKey       = "withdrawals"
+	InventorySessionsCollectionKey = "inventory_sessions"
+	InventoryScansCollectionKey    = "inventory_scans"
+	SuggestionsCollectionKey       = "suggestions"
+	ResourcesCollectionKey         = "resources"
+	ReservationsCollectionKey      = "reservations"
+	ProgramsCollectionKey          = "programs"
+	RegistrationsCollectionKey     = "registrations"
+	AnnouncementsCollectionKey     = "announcements"
+	SavedSearchesCollectionKey     = "saved_searches"
+	DailyStatsCollectionKey        = "stats_daily"
 )
 
+// BookStore stores Books.
+type BookStore interface {
+	CreateUniqueIndex() error
+	MigrateIdentifiers(ctx context.Context) (int, error)
+	ReassignPublisher(ctx context.Context, fromID string, to *Publisher) ([]string, error)
+	Insert(ctx context.Context, book *Book) (string, error)
+	InsertMany(ctx context.Context, books []*Book) ([]string, error)
+	Get(ctx context.Context, filter BookFilter) (*Book, error)
+	GetAll(ctx context.Context, filter BookFilter, paginator Paginator, sorter Sorter) ([]Book, Metadata, error)
+	Update(ctx context.Context, filter BookFilter, book *Book) error
+	Patch(ctx context.Context, filter BookFilter, original, book *Book) error
+	Delete(ctx context.Context, filter BookFilter) error
+}
+
+// PatronStore stores Patrons.
+type PatronStore interface {
+	CreateUniqueIndex() error
+	EncryptExisting(ctx context.Context) (int, error)
+	NormalizeEmails(ctx context.Context) (int, error)
+	Insert(ctx context.Context, patron *Patron) (string, error)
+	InsertMany(ctx context.Context, patrons []*Patron) ([]string, error)
+	Get(ctx context.Context, filter PatronFilter) (*Patron, error)
+	GetAll(ctx context.Context, filter PatronFilter, paginator Paginator, sorter Sorter) ([]Patron, Metadata, error)
+	Count(ctx context.Context, filter PatronFilter) (int64, error)
+	Update(ctx context.Context, filter PatronFilter, patron *Patron) error
+	Patch(ctx context.Context, filter PatronFilter, original, patron *Patron) error
+	IncrementPINFailures(ctx context.Context, filter PatronFilter, maxFailures int) error
+	ResetPINFailures(ctx context.Context, filter PatronFilter) error
+	Delete(ctx context.Context, filter PatronFilter) error
+}
+
+// TransactionStore stores Transactions.
+type TransactionStore interface {
+	Insert(ctx context.Context, transaction *Transaction) (string, error)
+	InsertMany(ctx context.Context, transactions []*Transaction) ([]string, error)
+	Get(ctx context.Context, filter TransactionFilter) (*Transaction, error)
+	GetAll(ctx context.Context, filter TransactionFilter, paginator Paginator, sorter Sorter) ([]Transaction, Metadata, error)
+	Update(ctx context.Context, filter TransactionFilter, transaction *Transaction) error
+	Delete(ctx context.Context, filter TransactionFilter) error
+	DeleteMany(ctx context.Context, filter TransactionFilter) (int64, error)
+	Anonymize(ctx context.Context, filter TransactionFilter) (int64, error)
+	ReassignPatron(ctx context.Context, fromPatronID, toPatronID string) (int64, error)
+	PatronStats(ctx context.Context, patronID string, now time.Time) (*PatronStats, error)
+}
+
+// TokenStore stores Tokens.
+type TokenStore interface {
+	New(ctx context.Context, patronID string, ttl time.Duration, scope string) (*Token, error)
+	Insert(ctx context.Context, token *Token) error
+	GetPatronID(ctx context.Context, filter TokenFilter) (string, error)
+	DeleteAllForPatron(ctx context.Context, filter TokenFilter) error
+}
+
+// AdminStore stores Admins.
+type AdminStore interface {
+	CreateUniqueIndex() error
+	DeleteDuplicates(ctx context.Context) (int64, error)
+	Ensure(ctx context.Context, username, password string) (bool, error)
+	Insert(ctx context.Context, admin *Admin) error
+	Get(ctx context.Context, filter AdminFilter) (*Admin, error)
+	GetAll(ctx context.Context, filter AdminFilter, paginator Paginator, sorter Sorter) ([]Admin, Metadata, error)
+	Update(ctx context.Context, filter AdminFilter, admin *Admin) error
+	Delete(ctx context.Context, filter AdminFilter) error
+}
+
+// CategoryStore stores Categories.
+type CategoryStore interface {
+	CreateUniqueIndex() error
+	EnsureDefaults(ctx context.Context, categories []*Category) error
+	Insert(ctx context.Context, category *Category) (string, error)
+	Get(ctx context.Context, filter CategoryFilter) (*Category, error)
+	GetAll(ctx context.Context, filter CategoryFilter) ([]Category, error)
+	Update(ctx context.Context, filter CategoryFilter, category *Category) error
+	Delete(ctx context.Context, filter CategoryFilter) error
+}
+
+// PublisherStore stores Publishers.
+type PublisherStore interface {
+	CreateUniqueIndex() error
+	Ensure(ctx context.Context, name string) (*Publisher, error)
+	Insert(ctx context.Context, publisher *Publisher) (string, error)
+	Get(ctx context.Context, filter PublisherFilter) (*Publisher, error)
+	GetAll(ctx context.Context, filter PublisherFilter, paginator Paginator, sorter Sorter) ([]Publisher, Metadata, error)
+	Update(ctx context.Context, filter PublisherFilter, publisher *Publisher) error
+	Delete(ctx context.Context, filter PublisherFilter) error
+}
+
+// NotificationStore stores Notifications.
+type NotificationStore interface {
+	CreateIndexes() error
+	Insert(ctx context.Context, notification *Notification) (string, error)
+	Get(ctx context.Context, filter NotificationFilter) (*Notification, error)
+	GetAll(ctx context.Context, filter NotificationFilter, paginator Paginator, sorter Sorter) ([]Notification, Metadata, error)
+	Update(ctx context.Context, filter NotificationFilter, notification *Notification) error
+}
+
+// EventStore stores the Events of the outbox.
+type EventStore interface {
+	CreateIndexes() error
+	Insert(ctx context.Context, event *Event) (string, error)
+	Get(ctx context.Context, filter EventFilter) (*Event, error)
+	GetAll(ctx context.Context, filter EventFilter, paginator Paginator, sorter Sorter) ([]Event, Metadata, error)
+	Update(ctx context.Context, filter EventFilter, event *Event) error
+}
+
+// AvailabilityStore stores the availability of Books, derived from the books and transactions.
+type AvailabilityStore interface {
+	CreateIndexes() error
+	Refresh(ctx context.Context, bookID string) error
+	Rebuild(ctx context.Context) (int, error)
+	Watch(ctx context.Context) error
+	Get(ctx context.Context, bookID string) (*BookAvailability, error)
+	GetAll(ctx context.Context, filter AvailabilityFilter, paginator Paginator, sorter Sorter) ([]BookAvailability, Metadata, error)
+}
+
+// KioskStore stores Kiosks.
+type KioskStore interface {
+	CreateIndexes() error
+	Insert(ctx context.Context, kiosk *Kiosk) (string, error)
+	Get(ctx context.Context, filter KioskFilter) (*Kiosk, error)
+	GetAll(ctx context.Context, filter KioskFilter, paginator Paginator, sorter Sorter) ([]Kiosk, Metadata, error)
+	Delete(ctx context.Context, filter KioskFilter) error
+}
+
+// KioskRequestStore stores the KioskRequests which were applied.
+type KioskRequestStore interface {
+	CreateUniqueIndex() error
+	Insert(ctx context.Context, request *KioskRequest) (string, error)
+	Get(ctx context.Context, filter KioskRequestFilter) (*KioskRequest, error)
+}
+
+// AuditStore stores the AuditEntries of the audit log.
+type AuditStore interface {
+	CreateIndexes() error
+	Insert(ctx context.Context, entry *AuditEntry) (string, error)
+	GetAll(ctx context.Context, filter AuditFilter, paginator Paginator, sorter Sorter) ([]AuditEntry, Metadata, error)
+}
+
+// DailyStatsStore stores the DailyStats which the circulation is rolled up into.
+type DailyStatsStore interface {
+	CreateIndexes() error
+	Insert(ctx context.Context, stats *DailyStats) error
+	GetAll(ctx context.Context, filter DailyStatsFilter, paginator Paginator, sorter Sorter) ([]DailyStats, Metadata, error)
+}
+
+// PaymentStore stores the Payments of fines.
+type PaymentStore interface {
+	CreateIndexes() error
+	Insert(ctx context.Context, payment *Payment) (string, error)
+	Get(ctx context.Context, filter PaymentFilter) (*Payment, error)
+	GetAll(ctx context.Context, filter PaymentFilter, paginator Paginator, sorter Sorter) ([]Payment, Metadata, error)
+	Update(ctx context.Context, filter PaymentFilter, payment *Payment) error
+}
+
+// AcquisitionStore stores the Acquisitions of books.
+type AcquisitionStore interface {
+	CreateIndexes() error
+	Insert(ctx context.Context, acquisition *Acquisition) (string, error)
+	Get(ctx context.Context, filter AcquisitionFilter) (*Acquisition, error)
+	GetAll(ctx context.Context, filter AcquisitionFilter, paginator Paginator, sorter Sorter) ([]Acquisition, Metadata, error)
+	Update(ctx context.Context, filter AcquisitionFilter, acquisition *Acquisition) error
+}
+
+// WithdrawalStore stores the Withdrawals of copies of Books.
+type WithdrawalStore interface {
+	CreateIndexes() error
+	Insert(ctx context.Context, withdrawal *Withdrawal) (string, error)
+	GetAll(ctx context.Context, filter WithdrawalFilter, paginator Paginator, sorter Sorter) ([]Withdrawal, Metadata, error)
+}
+
+// InventorySessionStore stores the InventorySessions of stock-taking.
+type InventorySessionStore interface {
+	Insert(ctx context.Context, session *InventorySession) (string, error)
+	Get(ctx context.Context, filter InventorySessionFilter) (*InventorySession, error)
+	GetAll(ctx context.Context, filter InventorySessionFilter, paginator Paginator, sorter Sorter) ([]InventorySession, Metadata, error)
+	Update(ctx context.Context, filter InventorySessionFilter, session *InventorySession) error
+}
+
+// InventoryScanStore stores the InventoryScans of stock-taking sessions.
+type InventoryScanStore interface {
+	CreateIndexes() error
+	InsertMany(ctx context.Context, scans []*InventoryScan) ([]string, error)
+	GetAll(ctx context.Context, filter InventoryScanFilter) ([]InventoryScan, error)
+}
+
+// SuggestionStore stores the Suggestions of patrons of titles to acquire.
+type SuggestionStore interface {
+	CreateIndexes() error
+	Insert(ctx context.Context, suggestion *Suggestion) (string, error)
+	Get(ctx context.Context, filter SuggestionFilter) (*Suggestion, error)
+	GetAll(ctx context.Context, filter SuggestionFilter, paginator Paginator, sorter Sorter) ([]Suggestion, Metadata, error)
+	Update(ctx context.Context, filter SuggestionFilter, suggestion *Suggestion) error
+}
+
+// ResourceStore stores the Resources which patrons reserve, such as study rooms and laptops.
+type ResourceStore interface {
+	CreateIndexes() error
+	Insert(ctx context.Context, resource *Resource) (string, error)
+	Get(ctx context.Context, filter ResourceFilter) (*Resource, error)
+	GetAll(ctx context.Context, filter ResourceFilter, paginator Paginator, sorter Sorter) ([]Resource, Metadata, error)
+	Update(ctx context.Context, filter ResourceFilter, resource *Resource) error
+}
+
+// ReservationStore stores the Reservations of Resources.
+type ReservationStore interface {
+	CreateIndexes() error
+	Insert(ctx context.Context, reservation *Reservation) (string, error)
+	Get(ctx context.Context, filter ReservationFilter) (*Reservation, error)
+	GetAll(ctx context.Context, filter ReservationFilter, paginator Paginator, sorter Sorter) ([]Reservation, Metadata, error)
+	Update(ctx context.Context, filter ReservationFilter, reservation *Reservation) error
+}
+
+// ProgramStore stores the Programs of the library, such as story hours and workshops.
+type ProgramStore interface {
+	CreateIndexes() error
+	Insert(ctx context.Context, program *Program) (string, error)
+	Get(ctx context.Context, filter ProgramFilter) (*Program, error)
+	GetAll(ctx context.Context, filter ProgramFilter, paginator Paginator, sorter Sorter) ([]Program, Metadata, error)
+	Update(ctx context.Context, filter ProgramFilter, program *Program) error
+	Delete(ctx context.Context, filter ProgramFilter) error
+}
+
+// RegistrationStore stores the Registrations of patrons to Programs.
+type RegistrationStore interface {
+	CreateIndexes() error
+	Insert(ctx context.Context, registration *Registration) (string, error)
+	Get(ctx context.Context, filter RegistrationFilter) (*Registration, error)
+	GetAll(ctx context.Context, filter RegistrationFilter, paginator Paginator, sorter Sorter) ([]Registration, Metadata, error)
+	Update(ctx context.Context, filter RegistrationFilter, registration *Registration) error
+}
+
+// AnnouncementStore stores the Announcements which clients show as banners.
+type AnnouncementStore interface {
+	CreateIndexes() error
+	Insert(ctx context.Context, announcement *Announcement) (string, error)
+	Get(ctx context.Context, filter AnnouncementFilter) (*Announcement, error)
+	GetAll(ctx context.Context, filter AnnouncementFilter, paginator Paginator, sorter Sorter) ([]Announcement, Metadata, error)
+	Update(ctx context.Context, filter AnnouncementFilter, announcement *Announcement) error
+	Delete(ctx context.Context, filter AnnouncementFilter) error
+}
+
+// SavedSearchStore stores the SavedSearches of librarians.
+type SavedSearchStore interface {
+	CreateIndexes() error
+	Insert(ctx context.Context, search *SavedSearch) (string, error)
+	Get(ctx context.Context, filter SavedSearchFilter) (*SavedSearch, error)
+	GetAll(ctx context.Context, filter SavedSearchFilter, paginator Paginator, sorter Sorter) ([]SavedSearch, Metadata, error)
+	Update(ctx context.Context, filter SavedSearchFilter, search *SavedSearch) error
+	Delete(ctx context.Context, filter SavedSearchFilter) error
+}
+
+// Transactor runs a function within a database transaction. The transaction is committed
+// if the function returns nil, and aborted otherwise.
+type Transactor interface {
+	WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
 type Models struct {
-	Books        BookModel
-	Patrons      PatronModel
-	Transactions TransactionModel
-	Tokens       TokenModel
-	Admins       AdminModel
+	Books             BookStore
+	Patrons           PatronStore
+	Transactions      TransactionStore
+	Tokens            TokenStore
+	Admins            AdminStore
+	Categories        CategoryStore
+	Publishers        PublisherStore
+	Notifications     NotificationStore
+	Events            EventStore
+	Availability      AvailabilityStore
+	Kiosks            KioskStore
+	KioskRequests     KioskRequestStore
+	Audit             AuditStore
+	Payments          PaymentStore
+	Acquisitions      AcquisitionStore
+	Withdrawals       WithdrawalStore
+	InventorySessions InventorySessionStore
+	InventoryScans    InventoryScanStore
+	Suggestions       SuggestionStore
+	Resources         ResourceStore
+	Reservations      ReservationStore
+	Programs          ProgramStore
+	Registrations     RegistrationStore
+	Announcements     AnnouncementStore
+	SavedSearches     SavedSearchStore
+	DailyStats        DailyStatsStore
+	Transactor        Transactor
 }
 
-func NewModels(client *mongo.Client, database string, collections map[string]string) Models {
+// MongoTransactor is a Transactor which uses MongoDB sessions.
+type MongoTransactor struct {
+	Client *mongo.Client
+}
+
+// NewModels returns Models which are stored in MongoDB. If cipher is not nil, the
+// personal fields of Patrons and the recipients and content of Notifications are encrypted with it.
+func NewModels(client *mongo.Client, database string, collections map[string]string, cipher *encryption.Cipher) Models {
 	return Models{
-		Books:        BookModel{Client: client, Database: database, Collection: collections[BooksCollectionKey]},
-		Patrons:      PatronModel{Client: client, Database: database, Collection: collections[PatronsCollectionKey]},
-		Transactions: TransactionModel{Client: client, Database: database, Collection: collections[TransactionsCollectionKey]},
-		Tokens:       TokenModel{Client: client, Database: database, Collection: collections[TokensCollectionKey]},
-		Admins:       AdminModel{Client: client, Database: database, Collection: collections[AdminsCollectionKey]},
+		Books:             BookModel{Client: client, Database: database, Collection: collections[BooksCollectionKey]},
+		Patrons:           PatronModel{Client: client, Database: database, Collection: collections[PatronsCollectionKey], Cipher: cipher},
+		Transactions:      TransactionModel{Client: client, Database: database, Collection: collections[TransactionsCollectionKey], BooksCollection: collections[BooksCollectionKey]},
+		Tokens:            TokenModel{Client: client, Database: database, Collection: collections[TokensCollectionKey]},
+		Admins:            AdminModel{Client: client, Database: database, Collection: collections[AdminsCollectionKey]},
+		Categories:        CategoryModel{Client: client, Database: database, Collection: collections[CategoriesCollectionKey]},
+		Publishers:        PublisherModel{Client: client, Database: database, Collection: collections[PublishersCollectionKey]},
+		Notifications:     NotificationModel{Client: client, Database: database, Collection: collections[NotificationsCollectionKey], Cipher: cipher},
+		Events:            EventModel{Client: client, Database: database, Collection: collections[EventsCollectionKey]},
+		Availability:      AvailabilityModel{Client: client, Database: database, Collection: collections[AvailabilityCollectionKey], BooksCollection: collections[BooksCollectionKey], TransactionsCollection: collections[TransactionsCollectionKey]},
+		Kiosks:            KioskModel{Client: client, Database: database, Collection: collections[KiosksCollectionKey]},
+		KioskRequests:     KioskRequestModel{Client: client, Database: database, Collection: collections[KioskRequestsCollectionKey]},
+		Audit:             AuditModel{Client: client, Database: database, Collection: collections[AuditCollectionKey]},
+		Payments:          PaymentModel{Client: client, Database: database, Collection: collections[PaymentsCollectionKey]},
+		Acquisitions:      AcquisitionModel{Client: client, Database: database, Collection: collections[AcquisitionsCollectionKey]},
+		Withdrawals:       WithdrawalModel{Client: client, Database: database, Collection: collections[WithdrawalsCollectionKey]},
+		InventorySessions: InventorySessionModel{Client: client, Database: database, Collection: collections[InventorySessionsCollectionKey]},
+		InventoryScans:    InventoryScanModel{Client: client, Database: database, Collection: collections[InventoryScansCollectionKey]},
+		Suggestions:       SuggestionModel{Client: client, Database: database, Collection: collections[SuggestionsCollectionKey]},
+		Resources:         ResourceModel{Client: client, Database: database, Collection: collections[ResourcesCollectionKey]},
+		Reservations:      ReservationModel{Client: client, Database: database, Collection: collections[ReservationsCollectionKey]},
+		Programs:          ProgramModel{Client: client, Database: database, Collection: collections[ProgramsCollectionKey]},
+		Registrations:     RegistrationModel{Client: client, Database: database, Collection: collections[RegistrationsCollectionKey]},
+		Announcements:     AnnouncementModel{Client: client, Database: database, Collection: collections[AnnouncementsCollectionKey]},
+		SavedSearches:     SavedSearchModel{Client: client, Database: database, Collection: collections[SavedSearchesCollectionKey]},
+		DailyStats:        DailyStatsModel{Client: client, Database: database, Collection: collections[DailyStatsCollectionKey]},
+		Transactor:        MongoTransactor{Client: client},
+	}
+}
+
+// WithIndexHints returns the models with queries by fields of known-hot indexes hinted to use them.
+func (m Models) WithIndexHints() Models {
+	if books, ok := m.Books.(BookModel); ok {
+		books.IndexHints = true
+		m.Books = books
+	}
+
+	return m
+}
+
+// WithTransaction runs fn within a MongoDB transaction. fn may be retried on transient errors.
+func (t MongoTransactor) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	session, err := t.Client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(context.Background())
+
+	_, err = session.WithTransaction(ctx, func(sessionContext mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sessionContext)
+	})
+
+	return err
+}
+
+// insertedIDs converts the IDs of inserted documents to strings.
+func insertedIDs(ids []interface{}) []string {
+	hexIDs := make([]string, 0, len(ids))
+	for _, id := range ids {
+		switch v := id.(type) {
+		case primitive.ObjectID:
+			hexIDs = append(hexIDs, v.Hex())
+		default:
+			hexIDs = append(hexIDs, fmt.Sprint(v))
+		}
 	}
+
+	return hexIDs
+}
+
+// unmatchedUpdateError returns the error of an update of a versioned document whose filter matched
+// no document: ErrDocumentNotFound if no document matches the filter regardless of its version, or
+// else ErrEditConflict, since the version of the document was changed by another update.
+func unmatchedUpdateError(ctx context.Context, coll *mongo.Collection, filter bson.M) error {
+	unversioned := maps.Clone(filter)
+	delete(unversioned, versionTag)
+
+	count, err := coll.CountDocuments(ctx, unversioned, options.Count().SetLimit(1))
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrDocumentNotFound
+	}
+
+	return ErrEditConflict
+}
+
+// ptr is a generic helper function for creating a pointer to any type.
+func ptr[T any](v T) *T {
+	return &v
 }
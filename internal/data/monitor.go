@@ -0,0 +1,123 @@
+package data
+
+import (
+	"context"
+	"github.com/mzeevi/library/internal/logging"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// startedQuery is a command which was sent to the database and has not finished yet.
+type startedQuery struct {
+	collection string
+	filter     []string
+}
+
+// queryMonitor logs the commands which take at least the threshold to finish, along with the
+// fields they filter by, so that operators can spot queries which are missing an index.
+type queryMonitor struct {
+	threshold time.Duration
+	started   sync.Map
+}
+
+// NewQueryMonitor returns a command monitor which logs commands that take at least the threshold,
+// or nil if the threshold is not positive.
+func NewQueryMonitor(threshold time.Duration) *event.CommandMonitor {
+	if threshold <= 0 {
+		return nil
+	}
+
+	m := &queryMonitor{threshold: threshold}
+
+	return &event.CommandMonitor{
+		Started: m.commandStarted,
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			m.commandFinished(ctx, e.CommandFinishedEvent, "")
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			m.commandFinished(ctx, e.CommandFinishedEvent, e.Failure)
+		},
+	}
+}
+
+// commandStarted records the collection and the filter shape of a command until it finishes.
+func (m *queryMonitor) commandStarted(_ context.Context, e *event.CommandStartedEvent) {
+	query := startedQuery{}
+	if collection, ok := e.Command.Lookup(e.CommandName).StringValueOK(); ok {
+		query.collection = collection
+	}
+
+	var filter bson.M
+	if raw, ok := commandFilter(e.CommandName, e.Command); ok && bson.Unmarshal(raw, &filter) == nil {
+		query.filter = filterShape(filter)
+	}
+
+	m.started.Store(e.RequestID, query)
+}
+
+// commandFinished logs a command which took at least the threshold to finish.
+func (m *queryMonitor) commandFinished(ctx context.Context, e event.CommandFinishedEvent, failure string) {
+	value, ok := m.started.LoadAndDelete(e.RequestID)
+	if !ok || e.Duration < m.threshold {
+		return
+	}
+	query := value.(startedQuery)
+
+	attrs := []any{
+		slog.String("collection", query.collection),
+		slog.String("operation", e.CommandName),
+		slog.Any("filter", query.filter),
+		slog.Duration("duration", e.Duration),
+	}
+	if failure != "" {
+		attrs = append(attrs, slog.String("error", failure))
+	}
+
+	logging.FromContext(ctx).Warn("slow query", attrs...)
+}
+
+// commandFilter returns the filter of a command, which is the filter of its first statement for
+// updates and deletes.
+func commandFilter(name string, command bson.Raw) (bson.Raw, bool) {
+	switch name {
+	case "find", "findAndModify", "count", "distinct":
+		key := "filter"
+		if name != "find" {
+			key = "query"
+		}
+		return command.Lookup(key).DocumentOK()
+	case "update", "delete":
+		statements, ok := command.Lookup(name + "s").ArrayOK()
+		if !ok {
+			return nil, false
+		}
+		statement, err := statements.IndexErr(0)
+		if err != nil {
+			return nil, false
+		}
+		q, ok := statement.Value().DocumentOK()
+		if !ok {
+			return nil, false
+		}
+		return q.Lookup("q").DocumentOK()
+	case "aggregate":
+		stages, ok := command.Lookup("pipeline").ArrayOK()
+		if !ok {
+			return nil, false
+		}
+		first, err := stages.IndexErr(0)
+		if err != nil {
+			return nil, false
+		}
+		stage, ok := first.Value().DocumentOK()
+		if !ok {
+			return nil, false
+		}
+		return stage.Lookup("$match").DocumentOK()
+	}
+
+	return nil, false
+}
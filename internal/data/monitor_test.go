@@ -0,0 +1,125 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/mzeevi/library/internal/logging"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+	"log/slog"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestQueryMonitor(t *testing.T) {
+	if NewQueryMonitor(0) != nil {
+		t.Errorf("NewQueryMonitor(0) = non-nil; want nil")
+	}
+
+	command := func(doc bson.D) bson.Raw {
+		raw, err := bson.Marshal(doc)
+		if err != nil {
+			t.Fatalf("bson.Marshal() error = %v", err)
+		}
+		return raw
+	}
+
+	tests := []struct {
+		name       string
+		command    string
+		doc        bson.D
+		duration   time.Duration
+		wantLogged bool
+		wantFilter []string
+	}{
+		{
+			name:       "SlowFind",
+			command:    "find",
+			doc:        bson.D{{Key: "find", Value: "books"}, {Key: "filter", Value: bson.D{{Key: titleTag, Value: "Dune"}, {Key: copiesTag, Value: 1}}}},
+			duration:   time.Second,
+			wantLogged: true,
+			wantFilter: []string{copiesTag, titleTag},
+		},
+		{
+			name:       "FastFind",
+			command:    "find",
+			doc:        bson.D{{Key: "find", Value: "books"}, {Key: "filter", Value: bson.D{{Key: titleTag, Value: "Dune"}}}},
+			duration:   time.Millisecond,
+			wantLogged: false,
+		},
+		{
+			name:       "SlowUpdate",
+			command:    "update",
+			doc:        bson.D{{Key: "update", Value: "books"}, {Key: "updates", Value: bson.A{bson.D{{Key: "q", Value: bson.D{{Key: idTag, Value: 1}}}}}}},
+			duration:   time.Second,
+			wantLogged: true,
+			wantFilter: []string{idTag},
+		},
+		{
+			name:       "SlowAggregate",
+			command:    "aggregate",
+			doc:        bson.D{{Key: "aggregate", Value: "books"}, {Key: "pipeline", Value: bson.A{bson.D{{Key: "$match", Value: bson.D{{Key: genresTag, Value: "Fiction"}}}}}}},
+			duration:   time.Second,
+			wantLogged: true,
+			wantFilter: []string{genresTag},
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			ctx := logging.WithLogger(context.Background(), slog.New(slog.NewJSONHandler(&buf, nil)))
+			monitor := NewQueryMonitor(100 * time.Millisecond)
+
+			monitor.Started(ctx, &event.CommandStartedEvent{Command: command(tt.doc), CommandName: tt.command, RequestID: int64(i)})
+			monitor.Succeeded(ctx, &event.CommandSucceededEvent{CommandFinishedEvent: event.CommandFinishedEvent{CommandName: tt.command, RequestID: int64(i), Duration: tt.duration}})
+
+			if !tt.wantLogged {
+				if buf.Len() != 0 {
+					t.Errorf("logged %s; want nothing", buf.String())
+				}
+				return
+			}
+
+			var entry struct {
+				Msg        string   `json:"msg"`
+				Collection string   `json:"collection"`
+				Operation  string   `json:"operation"`
+				Filter     []string `json:"filter"`
+			}
+			if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+				t.Fatalf("json.Unmarshal(%s) error = %v", buf.String(), err)
+			}
+			if entry.Msg != "slow query" || entry.Collection != "books" || entry.Operation != tt.command || !reflect.DeepEqual(entry.Filter, tt.wantFilter) {
+				t.Errorf("logged %+v; want a slow %s of books by %v", entry, tt.command, tt.wantFilter)
+			}
+		})
+	}
+}
+
+func TestHintedIndex(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter bson.M
+		want   bson.D
+	}{
+		{name: "Identifier", filter: bson.M{identifierValueTag: "9780306406157", titleTag: "Dune"}, want: bookHintedIndexes[0]},
+		{name: "Preferred", filter: bson.M{callNumberTag: "QA76", identifierValueTag: "9780306406157"}, want: bookHintedIndexes[0]},
+		{name: "CallNumber", filter: bson.M{callNumberTag: "QA76"}, want: bookHintedIndexes[1]},
+		{name: "NotHinted", filter: bson.M{titleTag: "Dune"}, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hintedIndex(tt.filter, bookHintedIndexes); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("hintedIndex(%v) = %v; want %v", tt.filter, got, tt.want)
+			}
+		})
+	}
+
+	if hint := (BookModel{}).indexHint(bson.M{identifierValueTag: "9780306406157"}); hint != nil {
+		t.Errorf("indexHint() without IndexHints = %v; want nil", hint)
+	}
+}
@@ -0,0 +1,314 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mzeevi/library/internal/encryption"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+	"time"
+)
+
+const (
+	NotificationStatusPending = "pending"
+	NotificationStatusSent    = "sent"
+	NotificationStatusFailed  = "failed"
+)
+
+// Notification is an outgoing notification to a Patron, stored with its rendered content so that
+// it can be delivered again if delivery fails.
+type Notification struct {
+	ID        string    `bson:"_id,omitempty" json:"id,omitempty"`
+	PatronID  string    `bson:"patron_id" json:"patron_id"`
+	Channel   string    `bson:"channel" json:"channel"`
+	Recipient string    `bson:"recipient" json:"recipient"`
+	Template  string    `bson:"template" json:"template"`
+	Subject   string    `bson:"subject,omitempty" json:"subject,omitempty"`
+	Body      string    `bson:"body" json:"-"`
+	HTMLBody  string    `bson:"html_body,omitempty" json:"-"`
+	Status    string    `bson:"status" json:"status"`
+	Attempts  int       `bson:"attempts" json:"attempts"`
+	LastError string    `bson:"last_error,omitempty" json:"last_error,omitempty"`
+	SentAt    time.Time `bson:"sent_at,omitempty" json:"sent_at,omitempty"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+	Version   int32     `bson:"version" json:"-"`
+}
+
+type NotificationFilter struct {
+	ID       *string `json:"id,omitempty"`
+	PatronID *string `json:"patron_id,omitempty"`
+	Channel  *string `json:"channel,omitempty"`
+	Template *string `json:"template,omitempty"`
+	Status   *string `json:"status,omitempty"`
+	Version  *int32  `json:"-,omitempty"`
+}
+
+type NotificationModel struct {
+	Client     *mongo.Client
+	Database   string
+	Collection string
+	Cipher     *encryption.Cipher
+}
+
+// NewNotification constructs a new pending Notification.
+func NewNotification(id, patronID, channel, recipient, template string) *Notification {
+	now := time.Now()
+
+	return &Notification{
+		ID:        id,
+		PatronID:  patronID,
+		Channel:   channel,
+		Recipient: recipient,
+		Template:  template,
+		Status:    NotificationStatusPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// buildNotificationFilter constructs a filter query for filtering notifications.
+func buildNotificationFilter(filter NotificationFilter) (bson.M, error) {
+	query := bson.M{}
+
+	if filter.ID != nil {
+		id, err := objectID(*filter.ID)
+		if err != nil {
+			return query, err
+		}
+		query[idTag] = id
+	}
+	if filter.PatronID != nil {
+		query[patronIDTag] = *filter.PatronID
+	}
+	if filter.Channel != nil {
+		query[channelTag] = *filter.Channel
+	}
+	if filter.Template != nil {
+		query[templateTag] = *filter.Template
+	}
+	if filter.Status != nil {
+		query[statusTag] = *filter.Status
+	}
+	if filter.Version != nil {
+		query[versionTag] = *filter.Version
+	}
+
+	return query, nil
+}
+
+// buildNotificationUpdater constructs an update document for recording a delivery attempt of a Notification.
+func buildNotificationUpdater(notification *Notification) bson.D {
+	updateFields := bson.D{
+		{Key: statusTag, Value: notification.Status},
+		{Key: attemptsTag, Value: notification.Attempts},
+		{Key: lastErrorTag, Value: notification.LastError},
+		{Key: sentAtTag, Value: notification.SentAt},
+		{Key: updatedAtTag, Value: time.Now()},
+	}
+
+	update := bson.D{
+		{Key: "$set", Value: updateFields},
+		{Key: "$inc", Value: bson.D{{Key: versionTag, Value: 1}}},
+	}
+
+	return update
+}
+
+// encrypt returns a copy of the Notification with its recipient and content encrypted.
+// The Notification is returned as-is if encryption is not enabled.
+func (n NotificationModel) encrypt(notification *Notification) (*Notification, error) {
+	if n.Cipher == nil {
+		return notification, nil
+	}
+
+	encrypted := *notification
+	for _, field := range []*string{&encrypted.Recipient, &encrypted.Subject, &encrypted.Body, &encrypted.HTMLBody} {
+		if *field == "" {
+			continue
+		}
+
+		value, err := n.Cipher.Encrypt(*field)
+		if err != nil {
+			return nil, err
+		}
+		*field = value
+	}
+
+	return &encrypted, nil
+}
+
+// decrypt decrypts the recipient and content of a Notification in place.
+func (n NotificationModel) decrypt(notification *Notification) error {
+	if n.Cipher == nil {
+		return nil
+	}
+
+	for _, field := range []*string{&notification.Recipient, &notification.Subject, &notification.Body, &notification.HTMLBody} {
+		value, err := n.Cipher.Decrypt(*field)
+		if err != nil {
+			return err
+		}
+		*field = value
+	}
+
+	return nil
+}
+
+// CreateIndexes creates an index for listing Notifications by status.
+func (n NotificationModel) CreateIndexes() error {
+	coll := n.Client.Database(n.Database).Collection(n.Collection)
+	indexModel := mongo.IndexModel{
+		Keys: bson.D{{Key: statusTag, Value: 1}, {Key: createdAtTag, Value: -1}},
+	}
+
+	_, err := coll.Indexes().CreateOne(context.TODO(), indexModel)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Insert inserts a new Notification into the database.
+func (n NotificationModel) Insert(ctx context.Context, notification *Notification) (string, error) {
+	coll := n.Client.Database(n.Database).Collection(n.Collection)
+
+	notification.CreatedAt = time.Now()
+	notification.UpdatedAt = time.Now()
+
+	encrypted, err := n.encrypt(notification)
+	if err != nil {
+		return "", err
+	}
+
+	res, err := coll.InsertOne(ctx, encrypted)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "_id_ dup key:"):
+			return "", ErrDuplicateID
+		default:
+			return "", err
+		}
+	}
+
+	if oid, ok := res.InsertedID.(primitive.ObjectID); ok {
+		return oid.Hex(), nil
+	}
+
+	return res.InsertedID.(string), nil
+}
+
+// Get retrieves a single Notification from the database matching an optional filter.
+func (n NotificationModel) Get(ctx context.Context, filter NotificationFilter) (*Notification, error) {
+	coll := n.Client.Database(n.Database).Collection(n.Collection)
+
+	filterQuery, err := buildNotificationFilter(filter)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	notification := &Notification{}
+
+	logQuery(ctx, n.Collection, "findOne", filterQuery)
+	err = coll.FindOne(ctx, filterQuery).Decode(notification)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrDocumentNotFound
+		}
+		return nil, err
+	}
+
+	if err = n.decrypt(notification); err != nil {
+		return nil, err
+	}
+
+	return notification, nil
+}
+
+// GetAll retrieves a paginated list of Notifications from the database matching an optional filter and sorting.
+func (n NotificationModel) GetAll(ctx context.Context, filter NotificationFilter, paginator Paginator, sorter Sorter) ([]Notification, Metadata, error) {
+	coll := n.Client.Database(n.Database).Collection(n.Collection, listOptions(ctx))
+
+	notifications := make([]Notification, 0)
+	metadata := Metadata{}
+
+	filterQuery, err := buildNotificationFilter(filter)
+	if err != nil {
+		return notifications, Metadata{}, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	sortQuery, err := buildSorter(sorter)
+	if err != nil {
+		return nil, Metadata{}, fmt.Errorf("%v: %v", errCreatingQuerySort, err)
+	}
+
+	findOpt := options.Find().SetSort(sortQuery).SetCollation(sorter.collation())
+
+	if paginator.valid() {
+		var totalRecords int64
+
+		findOpt = findOpt.SetLimit(paginator.limit()).SetSkip(paginator.offset())
+		totalRecords, err = coll.CountDocuments(ctx, filterQuery)
+		if err != nil {
+			return notifications, Metadata{}, errCreatingQueryFilter
+		}
+
+		metadata = calculateMetadata(totalRecords, paginator.Page, paginator.PageSize)
+	}
+
+	logQuery(ctx, n.Collection, "find", filterQuery)
+	cursor, err := coll.Find(ctx, filterQuery, findOpt)
+	if err != nil {
+		return notifications, Metadata{}, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var notification Notification
+		if err = cursor.Decode(&notification); err != nil {
+			return notifications, Metadata{}, err
+		}
+
+		if err = n.decrypt(&notification); err != nil {
+			return notifications, Metadata{}, err
+		}
+
+		notifications = append(notifications, notification)
+	}
+
+	if err = cursor.Err(); err != nil {
+		return notifications, Metadata{}, err
+	}
+
+	return notifications, metadata, nil
+}
+
+// Update records a delivery attempt of a Notification in the database matching a filter.
+func (n NotificationModel) Update(ctx context.Context, filter NotificationFilter, notification *Notification) error {
+	coll := n.Client.Database(n.Database).Collection(n.Collection)
+
+	update := buildNotificationUpdater(notification)
+
+	filter.Version = &notification.Version
+	filterQuery, err := buildNotificationFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	logQuery(ctx, n.Collection, "updateOne", filterQuery)
+	result, err := coll.UpdateOne(ctx, filterQuery, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
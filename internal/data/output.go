@@ -49,10 +49,24 @@ type CSVTransactionOutput struct {
 	writer *csv.Writer
 }
 
+// ExcelTransactionOutput writes records to a sheet of a workbook, which is saved when the writer is closed.
 type ExcelTransactionOutput struct {
 	f         *excelize.File
 	filename  string
 	sheetName string
+	nextRow   int
+}
+
+// NewOutput returns an Output which writes files of the given format.
+func NewOutput(format OutputType) (Output, error) {
+	switch format {
+	case CSVOutputFormat:
+		return &CSVTransactionOutput{}, nil
+	case EXLAMOutputFormat, XLSMOutputFormat, XLSXOutputFormat, XLTMOutputFormat, XLTXOutputFormat:
+		return &ExcelTransactionOutput{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported output format")
+	}
 }
 
 // addFormatSuffix ensures the given filename ends with the appropriate file format suffix.
@@ -115,6 +129,9 @@ func (c *ExcelTransactionOutput) CreateWriter(filename, format string) error {
 		}
 
 		c.f = excelize.NewFile()
+		if err = c.f.SetSheetName(c.f.GetSheetName(c.f.GetActiveSheetIndex()), excelSheetName); err != nil {
+			return fmt.Errorf("%v: %v", errCreatingWriter, err)
+		}
 	}
 
 	i, err := c.f.GetSheetIndex(excelSheetName)
@@ -129,8 +146,14 @@ func (c *ExcelTransactionOutput) CreateWriter(filename, format string) error {
 		}
 	}
 
+	rows, err := c.f.GetRows(excelSheetName)
+	if err != nil {
+		return fmt.Errorf("%v: %v", errCreatingWriter, err)
+	}
+
 	c.sheetName = excelSheetName
 	c.filename = normalizedFilename
+	c.nextRow = len(rows) + 1
 
 	return nil
 }
@@ -140,22 +163,15 @@ func (c *ExcelTransactionOutput) WriteRecord(record []string) error {
 		return fmt.Errorf("%v: %v", errWritingRecord, errWriterNotInitialized)
 	}
 
-	rows, err := c.f.GetRows(c.sheetName)
+	cell, err := excelize.CoordinatesToCellName(1, c.nextRow)
 	if err != nil {
 		return fmt.Errorf("%v: %v", errWritingRecord, err)
 	}
-	nextRow := len(rows) + 1
-
-	for colIndex, value := range record {
-		cell := fmt.Sprintf("%s%d", string(rune('A'+colIndex)), nextRow)
-		if err = c.f.SetCellValue(c.sheetName, cell, value); err != nil {
-			return fmt.Errorf("%v: %v", errWritingRecord, err)
-		}
-	}
 
-	if err = c.f.SaveAs(c.filename); err != nil {
+	if err = c.f.SetSheetRow(c.sheetName, cell, &record); err != nil {
 		return fmt.Errorf("%v: %v", errWritingRecord, err)
 	}
+	c.nextRow++
 
 	return nil
 }
@@ -165,6 +181,11 @@ func (c *ExcelTransactionOutput) CloseWriter() error {
 		return fmt.Errorf("%v: %v", errClosingWriter, errWriterNotInitialized)
 	}
 
+	if err := c.f.SaveAs(c.filename); err != nil {
+		_ = c.f.Close()
+		return fmt.Errorf("%v: %v", errClosingWriter, err)
+	}
+
 	if err := c.f.Close(); err != nil {
 		return fmt.Errorf("%v: %v", errClosingWriter, err)
 	}
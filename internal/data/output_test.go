@@ -1,6 +1,11 @@
 package data
 
 import (
+	"encoding/csv"
+	"github.com/xuri/excelize/v2"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 )
 
@@ -52,3 +57,57 @@ func TestAddFormatSuffix(t *testing.T) {
 		})
 	}
 }
+
+func TestOutputs(t *testing.T) {
+	records := [][]string{{"id", "title"}, {"1", "The Great Adventure"}, {"2", "Sapiens, A Brief History"}}
+
+	for _, format := range []OutputType{CSVOutputFormat, XLSXOutputFormat} {
+		t.Run(string(format), func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "output")
+
+			output, err := NewOutput(format)
+			if err != nil {
+				t.Fatalf("NewOutput() error = %v", err)
+			}
+			if err = output.CreateWriter(filename, string(format)); err != nil {
+				t.Fatalf("CreateWriter() error = %v", err)
+			}
+			for _, record := range records {
+				if err = output.WriteRecord(record); err != nil {
+					t.Fatalf("WriteRecord() error = %v", err)
+				}
+			}
+			if err = output.CloseWriter(); err != nil {
+				t.Fatalf("CloseWriter() error = %v", err)
+			}
+
+			var got [][]string
+			switch format {
+			case CSVOutputFormat:
+				f, err := os.Open(filename + ".csv")
+				if err != nil {
+					t.Fatalf("failed to open output: %v", err)
+				}
+				defer f.Close()
+
+				if got, err = csv.NewReader(f).ReadAll(); err != nil {
+					t.Fatalf("failed to read output: %v", err)
+				}
+			default:
+				f, err := excelize.OpenFile(filename + "." + string(format))
+				if err != nil {
+					t.Fatalf("failed to open output: %v", err)
+				}
+				defer f.Close()
+
+				if got, err = f.GetRows(f.GetSheetName(f.GetActiveSheetIndex())); err != nil {
+					t.Fatalf("failed to read output: %v", err)
+				}
+			}
+
+			if !reflect.DeepEqual(got, records) {
+				t.Errorf("output = %v; want %v", got, records)
+			}
+		})
+	}
+}
@@ -5,51 +5,98 @@ import (
 	"errors"
 	"fmt"
 	"github.com/mzeevi/library/internal/auth"
+	"github.com/mzeevi/library/internal/encryption"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"slices"
 	"strings"
 	"time"
 )
 
+const (
+	// emailIndexName is the name of the case-insensitive unique index on emails.
+	emailIndexName = "email_ci"
+	// legacyEmailIndexName is the name of the case-sensitive unique index on emails,
+	// which is dropped by NormalizeEmails.
+	legacyEmailIndexName = "email_-1"
+)
+
 var (
-	ErrDuplicateEmail = errors.New("duplicate email")
+	ErrDuplicateEmail     = errors.New("duplicate email")
+	ErrEncryptionDisabled = errors.New("encryption is not enabled")
+	ErrPINLocked          = errors.New("PIN locked")
 )
 
 var (
 	AnonymousPatron = &Patron{}
 )
 
+// Patron is a member of the library. A Guest is a walk-in who borrowed books without registering,
+// who has no password or permissions and cannot log in. A Suspended Patron was deprovisioned by the
+// identity provider of the library, and cannot log in or be activated until it is provisioned
+// again. PasswordChangedAt is when the password was last changed, before which the authentication
+// tokens of the Patron are revoked. ExternalIDs are the IDs of the Patron in other systems by the
+// name of the system, such as their student ID in the school information system.
 type Patron struct {
-	ID          string        `bson:"_id,omitempty" json:"id,omitempty"`
-	Name        string        `bson:"name" json:"name"`
-	Email       string        `bson:"email" json:"email"`
-	Category    string        `bson:"category" json:"category"`
-	Password    auth.Password `bson:"password" json:"-"`
-	Activated   bool          `bson:"activated" json:"activated"`
-	Permissions []string      `bson:"permissions" json:"-"`
-	Version     int32         `bson:"version" json:"-"`
-	CreatedAt   time.Time     `bson:"created_at" json:"-"`
-	UpdatedAt   time.Time     `bson:"updated_at" json:"-"`
+	ID                  string            `bson:"_id,omitempty" json:"id,omitempty"`
+	Name                string            `bson:"name" json:"name"`
+	Email               string            `bson:"email" json:"email"`
+	Category            string            `bson:"category" json:"category"`
+	Password            auth.Password     `bson:"password" json:"-"`
+	PasswordChangedAt   *time.Time        `bson:"password_changed_at,omitempty" json:"-"`
+	PIN                 auth.PIN          `bson:"pin" json:"-"`
+	Activated           bool              `bson:"activated" json:"activated"`
+	Guest               bool              `bson:"guest,omitempty" json:"guest,omitempty"`
+	Suspended           bool              `bson:"suspended,omitempty" json:"suspended,omitempty"`
+	Photo               *PatronPhoto      `bson:"photo,omitempty" json:"photo,omitempty"`
+	Phone               string            `bson:"phone,omitempty" json:"phone,omitempty"`
+	NotificationChannel string            `bson:"notification_channel,omitempty" json:"notification_channel,omitempty"`
+	Locale              string            `bson:"locale,omitempty" json:"locale,omitempty"`
+	ExternalIDs         map[string]string `bson:"external_ids,omitempty" json:"external_ids,omitempty"`
+	Permissions         []string          `bson:"permissions" json:"-"`
+	Version             int32             `bson:"version" json:"-"`
+	CreatedAt           time.Time         `bson:"created_at" json:"-"`
+	UpdatedAt           time.Time         `bson:"updated_at" json:"-"`
+	EmailDigest         string            `bson:"email_digest,omitempty" json:"-"`
+	NameDigest          string            `bson:"name_digest,omitempty" json:"-"`
+}
+
+// PatronPhoto is the photo of a Patron by which the front desk verifies their identity, which is
+// kept in the file storage under Key and only shown to admins.
+type PatronPhoto struct {
+	Key         string    `bson:"key" json:"-"`
+	ContentType string    `bson:"content_type" json:"content_type"`
+	Size        int64     `bson:"size" json:"size"`
+	Width       int       `bson:"width" json:"width"`
+	Height      int       `bson:"height" json:"height"`
+	UploadedAt  time.Time `bson:"uploaded_at" json:"uploaded_at"`
 }
 
 type PatronFilter struct {
-	ID           *string    `json:"id,omitempty"`
-	Name         *string    `json:"name,omitempty"`
-	Email        *string    `json:"email,omitempty"`
-	Category     *string    `json:"category,omitempty"`
-	Version      *int32     `json:"version,omitempty"`
-	MinCreatedAt *time.Time `json:"min_created_at,omitempty"`
-	MaxCreatedAt *time.Time `json:"max_created_at,omitempty"`
-	MinUpdatedAt *time.Time `json:"min_updated_at,omitempty"`
-	MaxUpdatedAt *time.Time `json:"max_updated_at,omitempty"`
+	ID           *PatronID   `json:"id,omitempty"`
+	IDs          []PatronID  `json:"ids,omitempty"`
+	Name         *string     `json:"name,omitempty"`
+	NameMatch    Match       `json:"name_match,omitempty"`
+	Email        *string     `json:"email,omitempty"`
+	Category     *string     `json:"category,omitempty"`
+	Version      *int32      `json:"version,omitempty"`
+	ExternalID   *ExternalID `json:"external_id,omitempty"`
+	MinCreatedAt *time.Time  `json:"min_created_at,omitempty"`
+	MaxCreatedAt *time.Time  `json:"max_created_at,omitempty"`
+	MinUpdatedAt *time.Time  `json:"min_updated_at,omitempty"`
+	MaxUpdatedAt *time.Time  `json:"max_updated_at,omitempty"`
+	// Keyword matches patrons whose name or email contains it, regardless of case. When encryption
+	// is enabled, it only matches patrons whose name or email equals it.
+	Keyword *string `json:"keyword,omitempty"`
 }
 
 type PatronModel struct {
 	Client     *mongo.Client
 	Database   string
 	Collection string
+	Cipher     *encryption.Cipher
 }
 
 // NewPatron is a constructor for Patron.
@@ -71,12 +118,35 @@ func (p *Patron) IsAnonymous() bool {
 	return p == AnonymousPatron
 }
 
+// normalizeEmail returns the canonical form of an email address, so that addresses
+// differing only in case belong to the same Patron.
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// normalizeName returns the form of a name which its digest is computed of, so that encrypted
+// names are matched regardless of case, as plaintext names are.
+func normalizeName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// isDuplicateEmail checks if an error was caused by one of the unique email indexes.
+func isDuplicateEmail(err error) bool {
+	for _, index := range []string{emailIndexName, legacyEmailIndexName, emailDigestTag + "_-1"} {
+		if strings.Contains(err.Error(), index+" dup key") {
+			return true
+		}
+	}
+
+	return false
+}
+
 // buildPatronFilter constructs a filter query for filtering patrons.
 func buildPatronFilter(filter PatronFilter) (bson.M, error) {
 	query := bson.M{}
 
-	if filter.ID != nil {
-		id, err := primitive.ObjectIDFromHex(*filter.ID)
+	if filter.ID != nil || filter.IDs != nil {
+		id, err := idQuery(filter.ID, filter.IDs)
 		if err != nil {
 			return query, err
 		}
@@ -103,10 +173,16 @@ func buildPatronFilter(filter PatronFilter) (bson.M, error) {
 		query[updatedAtTag] = updatedAtRange
 	}
 	if filter.Name != nil {
-		query[nameTag] = bson.M{"$regex": *filter.Name, "$options": "i"}
+		query[nameTag] = textQuery(*filter.Name, filter.NameMatch)
 	}
 	if filter.Email != nil {
-		query[emailTag] = *filter.Email
+		query[emailTag] = normalizeEmail(*filter.Email)
+	}
+	if filter.Keyword != nil {
+		query["$or"] = bson.A{
+			bson.M{nameTag: textQuery(*filter.Keyword, MatchContains)},
+			bson.M{emailTag: textQuery(*filter.Keyword, MatchContains)},
+		}
 	}
 	if filter.Category != nil {
 		query[categoryTag] = *filter.Category
@@ -114,40 +190,208 @@ func buildPatronFilter(filter PatronFilter) (bson.M, error) {
 	if filter.Version != nil {
 		query[versionTag] = *filter.Version
 	}
+	if filter.ExternalID != nil {
+		query[externalIDKey(filter.ExternalID.System)] = filter.ExternalID.Value
+	}
 
 	return query, nil
 }
 
-// buildPatronUpdater constructs an update document for updating a Patron.
-func buildPatronUpdater(patron *Patron) bson.D {
-	updateFields := bson.D{
+// patronFields returns the fields of a Patron which are updated.
+func patronFields(patron *Patron) bson.D {
+	fields := bson.D{
 		{Key: nameTag, Value: patron.Name},
 		{Key: emailTag, Value: patron.Email},
 		{Key: categoryTag, Value: patron.Category},
 		{Key: passwordTag, Value: patron.Password},
+		{Key: passwordChangedAtTag, Value: patron.PasswordChangedAt},
+		{Key: pinTag, Value: patron.PIN},
 		{Key: activatedTag, Value: patron.Activated},
+		{Key: suspendedTag, Value: patron.Suspended},
 		{Key: permissionsTag, Value: patron.Permissions},
+		{Key: phoneTag, Value: patron.Phone},
+		{Key: notificationChannelTag, Value: patron.NotificationChannel},
+		{Key: localeTag, Value: patron.Locale},
+		{Key: externalIDsTag, Value: patron.ExternalIDs},
+		{Key: photoTag, Value: patron.Photo},
+	}
+
+	if patron.EmailDigest != "" {
+		fields = append(fields, bson.E{Key: emailDigestTag, Value: patron.EmailDigest})
+	}
+	if patron.NameDigest != "" {
+		fields = append(fields, bson.E{Key: nameDigestTag, Value: patron.NameDigest})
+	}
+
+	return fields
+}
+
+// buildPatronUpdater constructs an update document for updating a Patron.
+func buildPatronUpdater(patron *Patron) bson.D {
+	return buildUpdater(patronFields(patron))
+}
+
+// buildPatronPatcher constructs an update document for updating only the fields of a Patron
+// which differ from those of original, to their values in stored, which is the Patron as it is
+// stored, with its personal fields encrypted. The digests of the name and the email are updated
+// with them.
+func buildPatronPatcher(original, patron, stored *Patron) bson.D {
+	keys := changedFields(patronFields(original), patronFields(patron))
+	if slices.Contains(keys, nameTag) {
+		keys = append(keys, nameDigestTag)
+	}
+	if slices.Contains(keys, emailTag) {
+		keys = append(keys, emailDigestTag)
+	}
+
+	return buildUpdater(selectFields(patronFields(stored), keys))
+}
+
+// buildFilter constructs a filter query for filtering patrons. When encryption is
+// enabled, lookups by email and name are done against their digests, or against the
+// plaintext fields of Patrons which were stored before encryption and have no digests.
+func (p PatronModel) buildFilter(filter PatronFilter) (bson.M, error) {
+	query, err := buildPatronFilter(filter)
+	if err != nil {
+		return query, err
+	}
+
+	if p.Cipher == nil {
+		return query, nil
+	}
+
+	unmigrated := bson.M{"$exists": false}
+
+	var conditions bson.A
+	if filter.Email != nil {
+		conditions = append(conditions, bson.M{"$or": bson.A{
+			bson.M{emailDigestTag: p.Cipher.Digest(normalizeEmail(*filter.Email))},
+			bson.M{emailDigestTag: unmigrated, emailTag: query[emailTag]},
+		}})
+		delete(query, emailTag)
+	}
+	if filter.Name != nil {
+		conditions = append(conditions, bson.M{"$or": bson.A{
+			bson.M{nameDigestTag: p.Cipher.Digest(normalizeName(*filter.Name))},
+			bson.M{nameDigestTag: unmigrated, nameTag: query[nameTag]},
+		}})
+		delete(query, nameTag)
+	}
+	if filter.Keyword != nil {
+		conditions = append(conditions, bson.M{"$or": bson.A{
+			bson.M{nameDigestTag: p.Cipher.Digest(normalizeName(*filter.Keyword))},
+			bson.M{emailDigestTag: p.Cipher.Digest(normalizeEmail(*filter.Keyword))},
+			bson.M{emailDigestTag: unmigrated, "$or": query["$or"]},
+		}})
+		delete(query, "$or")
+	}
+	if len(conditions) > 0 {
+		query["$and"] = conditions
+	}
+
+	return query, nil
+}
+
+// encrypt returns a copy of the Patron with its personal fields encrypted.
+// The Patron is returned as-is if encryption is not enabled.
+func (p PatronModel) encrypt(patron *Patron) (*Patron, error) {
+	if p.Cipher == nil {
+		return patron, nil
+	}
+
+	encrypted := *patron
+
+	name, err := p.Cipher.Encrypt(patron.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	email, err := p.Cipher.Encrypt(patron.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	if patron.Phone != "" {
+		phone, err := p.Cipher.Encrypt(patron.Phone)
+		if err != nil {
+			return nil, err
+		}
+		encrypted.Phone = phone
+	}
+
+	// Encrypt passes fields which are encrypted already through, so the digests are of the
+	// decrypted fields, not of their ciphertext.
+	plainName, err := p.Cipher.Decrypt(patron.Name)
+	if err != nil {
+		return nil, err
 	}
 
-	updateFields = append(updateFields, bson.E{Key: updatedAtTag, Value: time.Now()})
+	plainEmail, err := p.Cipher.Decrypt(patron.Email)
+	if err != nil {
+		return nil, err
+	}
 
-	update := bson.D{
-		{Key: "$set", Value: updateFields},
-		{Key: "$inc", Value: bson.D{{Key: versionTag, Value: 1}}},
+	encrypted.Name = name
+	encrypted.Email = email
+	encrypted.NameDigest = p.Cipher.Digest(normalizeName(plainName))
+	encrypted.EmailDigest = p.Cipher.Digest(normalizeEmail(plainEmail))
+
+	return &encrypted, nil
+}
+
+// decrypt decrypts the personal fields of a Patron in place.
+func (p PatronModel) decrypt(patron *Patron) error {
+	if p.Cipher == nil {
+		return nil
 	}
 
-	return update
+	name, err := p.Cipher.Decrypt(patron.Name)
+	if err != nil {
+		return err
+	}
+
+	email, err := p.Cipher.Decrypt(patron.Email)
+	if err != nil {
+		return err
+	}
+
+	phone, err := p.Cipher.Decrypt(patron.Phone)
+	if err != nil {
+		return err
+	}
+
+	patron.Name = name
+	patron.Email = email
+	patron.Phone = phone
+	patron.NameDigest = ""
+	patron.EmailDigest = ""
+
+	return nil
 }
 
 // CreateUniqueIndex creates a unique index using a field.
 func (p PatronModel) CreateUniqueIndex() error {
 	coll := p.Client.Database(p.Database).Collection(p.Collection)
-	indexModel := mongo.IndexModel{
-		Keys:    bson.D{{Key: emailTag, Value: -1}},
-		Options: options.Index().SetUnique(true),
+	indexModels := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: emailTag, Value: -1}},
+			Options: options.Index().SetName(emailIndexName).SetUnique(true).
+				SetCollation(&options.Collation{Locale: "en", Strength: 2}),
+		},
+		{
+			Keys: bson.D{{Key: externalIDsTag + ".$**", Value: 1}},
+		},
+	}
+
+	if p.Cipher != nil {
+		indexModels = append(indexModels, mongo.IndexModel{
+			Keys: bson.D{{Key: emailDigestTag, Value: -1}},
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(bson.M{emailDigestTag: bson.M{"$exists": true}}),
+		})
 	}
 
-	_, err := coll.Indexes().CreateOne(context.TODO(), indexModel)
+	_, err := coll.Indexes().CreateMany(context.TODO(), indexModels)
 	if err != nil {
 		return err
 	}
@@ -155,18 +399,156 @@ func (p PatronModel) CreateUniqueIndex() error {
 	return nil
 }
 
+// EncryptExisting encrypts the personal fields of all Patrons which were stored
+// before encryption was enabled, and updates digests which are out of date, returning
+// the number of migrated Patrons.
+func (p PatronModel) EncryptExisting(ctx context.Context) (int, error) {
+	if p.Cipher == nil {
+		return 0, ErrEncryptionDisabled
+	}
+
+	coll := p.Client.Database(p.Database).Collection(p.Collection)
+
+	cursor, err := coll.Find(ctx, bson.M{})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	migrated := 0
+	for cursor.Next(ctx) {
+		var patron Patron
+		if err = cursor.Decode(&patron); err != nil {
+			return migrated, err
+		}
+
+		encrypted, err := p.encrypt(&patron)
+		if err != nil {
+			return migrated, err
+		}
+
+		// Patrons which were encrypted before names were normalized are migrated to the digests of
+		// their normalized names.
+		if encryption.IsEncrypted(patron.Email) && encryption.IsEncrypted(patron.Name) &&
+			(patron.Phone == "" || encryption.IsEncrypted(patron.Phone)) &&
+			patron.NameDigest == encrypted.NameDigest && patron.EmailDigest == encrypted.EmailDigest {
+			continue
+		}
+
+		filterQuery, err := buildPatronFilter(PatronFilter{ID: ptr(PatronID(patron.ID))})
+		if err != nil {
+			return migrated, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+		}
+
+		fields := bson.D{
+			{Key: nameTag, Value: encrypted.Name},
+			{Key: emailTag, Value: encrypted.Email},
+			{Key: nameDigestTag, Value: encrypted.NameDigest},
+			{Key: emailDigestTag, Value: encrypted.EmailDigest},
+		}
+		if encrypted.Phone != "" {
+			fields = append(fields, bson.E{Key: phoneTag, Value: encrypted.Phone})
+		}
+
+		update := bson.D{{Key: "$set", Value: fields}}
+
+		if _, err = coll.UpdateOne(ctx, filterQuery, update); err != nil {
+			return migrated, err
+		}
+
+		migrated++
+	}
+
+	if err = cursor.Err(); err != nil {
+		return migrated, err
+	}
+
+	return migrated, nil
+}
+
+// NormalizeEmails lowercases the emails of all existing Patrons and replaces the legacy
+// case-sensitive email index with the case-insensitive one, returning the number of migrated Patrons. Patrons whose
+// emails only differ in case must be merged first, otherwise ErrDuplicateEmail is returned.
+func (p PatronModel) NormalizeEmails(ctx context.Context) (int, error) {
+	coll := p.Client.Database(p.Database).Collection(p.Collection)
+
+	cursor, err := coll.Find(ctx, bson.M{})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	migrated := 0
+	for cursor.Next(ctx) {
+		var patron Patron
+		if err = cursor.Decode(&patron); err != nil {
+			return migrated, err
+		}
+
+		if err = p.decrypt(&patron); err != nil {
+			return migrated, err
+		}
+
+		email := normalizeEmail(patron.Email)
+		if email == patron.Email {
+			continue
+		}
+		patron.Email = email
+
+		encrypted, err := p.encrypt(&patron)
+		if err != nil {
+			return migrated, err
+		}
+
+		filterQuery, err := buildPatronFilter(PatronFilter{ID: ptr(PatronID(patron.ID))})
+		if err != nil {
+			return migrated, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+		}
+
+		fields := bson.D{{Key: emailTag, Value: encrypted.Email}}
+		if encrypted.EmailDigest != "" {
+			fields = append(fields, bson.E{Key: emailDigestTag, Value: encrypted.EmailDigest})
+		}
+
+		if _, err = coll.UpdateOne(ctx, filterQuery, bson.D{{Key: "$set", Value: fields}}); err != nil {
+			if isDuplicateEmail(err) {
+				return migrated, fmt.Errorf("%w: patron %s (%s)", ErrDuplicateEmail, patron.ID, email)
+			}
+			return migrated, err
+		}
+
+		migrated++
+	}
+
+	if err = cursor.Err(); err != nil {
+		return migrated, err
+	}
+
+	if _, err = coll.Indexes().DropOne(ctx, legacyEmailIndexName); err != nil && !strings.Contains(err.Error(), "index not found") {
+		return migrated, err
+	}
+
+	return migrated, p.CreateUniqueIndex()
+}
+
 // Insert inserts a new Patron into the database.
 func (p PatronModel) Insert(ctx context.Context, patron *Patron) (string, error) {
 	coll := p.Client.Database(p.Database).Collection(p.Collection)
 
 	patron.CreatedAt = time.Now()
+	patron.Email = normalizeEmail(patron.Email)
+
+	encrypted, err := p.encrypt(patron)
+	if err != nil {
+		return "", err
+	}
 
-	res, err := coll.InsertOne(ctx, patron)
+	res, err := coll.InsertOne(ctx, encrypted)
 	if err != nil {
 		switch {
 		case strings.Contains(err.Error(), "_id_ dup key:"):
 			return "", ErrDuplicateID
-		case strings.Contains(err.Error(), "email_-1 dup key"):
+		case isDuplicateEmail(err):
 			return "", ErrDuplicateEmail
 		default:
 			return "", err
@@ -180,17 +562,49 @@ func (p PatronModel) Insert(ctx context.Context, patron *Patron) (string, error)
 	return res.InsertedID.(string), nil
 }
 
+// InsertMany inserts multiple Patrons into the database, returning their IDs.
+func (p PatronModel) InsertMany(ctx context.Context, patrons []*Patron) ([]string, error) {
+	coll := p.Client.Database(p.Database).Collection(p.Collection)
+
+	now := time.Now()
+	documents := make([]interface{}, 0, len(patrons))
+	for _, patron := range patrons {
+		patron.CreatedAt = now
+		patron.UpdatedAt = now
+		patron.Email = normalizeEmail(patron.Email)
+
+		encrypted, err := p.encrypt(patron)
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, encrypted)
+	}
+
+	res, err := coll.InsertMany(ctx, documents)
+	if err != nil {
+		switch {
+		case isDuplicateEmail(err):
+			return nil, ErrDuplicateEmail
+		default:
+			return nil, err
+		}
+	}
+
+	return insertedIDs(res.InsertedIDs), nil
+}
+
 // Get retrieves a single Patron from the database matching an optional filter.
 func (p PatronModel) Get(ctx context.Context, filter PatronFilter) (*Patron, error) {
 	coll := p.Client.Database(p.Database).Collection(p.Collection)
 
-	filterQuery, err := buildPatronFilter(filter)
+	filterQuery, err := p.buildFilter(filter)
 	if err != nil {
-		return nil, fmt.Errorf("%v: %v", errCreatingQueryFilter, err)
+		return nil, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
 	}
 
 	patron := &Patron{}
 
+	logQuery(ctx, p.Collection, "findOne", filterQuery)
 	err = coll.FindOne(ctx, filterQuery).Decode(patron)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
@@ -199,19 +613,23 @@ func (p PatronModel) Get(ctx context.Context, filter PatronFilter) (*Patron, err
 		return nil, err
 	}
 
+	if err = p.decrypt(patron); err != nil {
+		return nil, err
+	}
+
 	return patron, nil
 }
 
 // GetAll retrieves all patrons from the database matching an optional filter and paginator.
 func (p PatronModel) GetAll(ctx context.Context, filter PatronFilter, paginator Paginator, sorter Sorter) ([]Patron, Metadata, error) {
-	coll := p.Client.Database(p.Database).Collection(p.Collection)
+	coll := p.Client.Database(p.Database).Collection(p.Collection, listOptions(ctx))
 
 	patrons := make([]Patron, 0)
 	metadata := Metadata{}
 
-	filterQuery, err := buildPatronFilter(filter)
+	filterQuery, err := p.buildFilter(filter)
 	if err != nil {
-		return patrons, Metadata{}, fmt.Errorf("%v: %v", errCreatingQueryFilter, err)
+		return patrons, Metadata{}, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
 	}
 
 	sortQuery, err := buildSorter(sorter)
@@ -219,7 +637,7 @@ func (p PatronModel) GetAll(ctx context.Context, filter PatronFilter, paginator
 		return patrons, Metadata{}, fmt.Errorf("%v: %v", errCreatingQuerySort, err)
 	}
 
-	findOpt := options.Find().SetSort(sortQuery)
+	findOpt := options.Find().SetSort(sortQuery).SetCollation(sorter.collation())
 
 	if paginator.valid() {
 		var totalRecords int64
@@ -227,12 +645,13 @@ func (p PatronModel) GetAll(ctx context.Context, filter PatronFilter, paginator
 		findOpt = findOpt.SetLimit(paginator.limit()).SetSkip(paginator.offset())
 		totalRecords, err = coll.CountDocuments(ctx, filterQuery)
 		if err != nil {
-			return patrons, Metadata{}, fmt.Errorf("%v: %v", errCreatingQueryFilter, err)
+			return patrons, Metadata{}, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
 		}
 
 		metadata = calculateMetadata(totalRecords, paginator.Page, paginator.PageSize)
 	}
 
+	logQuery(ctx, p.Collection, "find", filterQuery)
 	cursor, err := coll.Find(ctx, filterQuery, findOpt)
 	if err != nil {
 		return patrons, Metadata{}, err
@@ -245,6 +664,10 @@ func (p PatronModel) GetAll(ctx context.Context, filter PatronFilter, paginator
 			return patrons, Metadata{}, err
 		}
 
+		if err = p.decrypt(&patron); err != nil {
+			return patrons, Metadata{}, err
+		}
+
 		patrons = append(patrons, patron)
 	}
 
@@ -255,39 +678,172 @@ func (p PatronModel) GetAll(ctx context.Context, filter PatronFilter, paginator
 	return patrons, metadata, nil
 }
 
-// Update updates a Patron's details in the database.
+// Count returns the number of Patrons matching a filter.
+func (p PatronModel) Count(ctx context.Context, filter PatronFilter) (int64, error) {
+	coll := p.Client.Database(p.Database).Collection(p.Collection, listOptions(ctx))
+
+	filterQuery, err := p.buildFilter(filter)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	logQuery(ctx, p.Collection, "countDocuments", filterQuery)
+	return coll.CountDocuments(ctx, filterQuery)
+}
+
+// Update updates a Patron's details in the database. ErrDocumentNotFound is returned if no Patron
+// matches the filter, and ErrEditConflict if its version was changed by another update.
 func (p PatronModel) Update(ctx context.Context, filter PatronFilter, patron *Patron) error {
 	coll := p.Client.Database(p.Database).Collection(p.Collection)
 
-	update := buildPatronUpdater(patron)
+	patron.Email = normalizeEmail(patron.Email)
+
+	encrypted, err := p.encrypt(patron)
+	if err != nil {
+		return err
+	}
+
+	update := buildPatronUpdater(encrypted)
 
 	filter.Version = &patron.Version
-	filterQuery, err := buildPatronFilter(filter)
+	filterQuery, err := p.buildFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	logQuery(ctx, p.Collection, "updateOne", filterQuery)
+	result, err := coll.UpdateOne(ctx, filterQuery, update)
 	if err != nil {
-		return fmt.Errorf("%v: %v", errCreatingQueryFilter, err)
+		switch {
+		case isDuplicateEmail(err):
+			return ErrDuplicateEmail
+		default:
+			return err
+		}
+	}
+
+	if result.MatchedCount == 0 {
+		return unmatchedUpdateError(ctx, coll, filterQuery)
 	}
 
+	return nil
+}
+
+// Patch updates only the fields of a Patron which differ from those of original, so that the
+// fields which other updates set concurrently are kept. Unlike Update, the version of the Patron
+// is not checked. ErrDocumentNotFound is returned if no Patron matches the filter.
+func (p PatronModel) Patch(ctx context.Context, filter PatronFilter, original, patron *Patron) error {
+	coll := p.Client.Database(p.Database).Collection(p.Collection)
+
+	patron.Email = normalizeEmail(patron.Email)
+
+	encrypted, err := p.encrypt(patron)
+	if err != nil {
+		return err
+	}
+
+	filterQuery, err := p.buildFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	logQuery(ctx, p.Collection, "updateOne", filterQuery)
+	result, err := coll.UpdateOne(ctx, filterQuery, buildPatronPatcher(original, patron, encrypted))
+	if err != nil {
+		switch {
+		case isDuplicateEmail(err):
+			return ErrDuplicateEmail
+		default:
+			return err
+		}
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrDocumentNotFound
+	}
+
+	return nil
+}
+
+// pinFailuresPath is the path of the failures of the PIN of Patrons.
+const pinFailuresPath = pinTag + "." + failuresTag
+
+// IncrementPINFailures counts an attempt to use the PIN of a Patron as a failure, unless the PIN
+// failed maxFailures times already, in which case ErrPINLocked is returned. The failure is
+// counted in one update before the PIN is compared, so that attempts which are made at the same
+// time cannot get past the lockout, and ResetPINFailures undoes it if the PIN matches.
+func (p PatronModel) IncrementPINFailures(ctx context.Context, filter PatronFilter, maxFailures int) error {
+	coll := p.Client.Database(p.Database).Collection(p.Collection)
+
+	filterQuery, err := p.buildFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+	filterQuery[pinFailuresPath] = bson.M{"$lt": maxFailures}
+
+	update := bson.M{"$inc": bson.M{pinFailuresPath: 1, versionTag: 1}}
+
+	logQuery(ctx, p.Collection, "updateOne", filterQuery)
+	result, err := coll.UpdateOne(ctx, filterQuery, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		delete(filterQuery, pinFailuresPath)
+		return pinLockedError(unmatchedUpdateError(ctx, coll, filterQuery))
+	}
+
+	return nil
+}
+
+// ResetPINFailures resets the failures of the PIN of a Patron.
+func (p PatronModel) ResetPINFailures(ctx context.Context, filter PatronFilter) error {
+	coll := p.Client.Database(p.Database).Collection(p.Collection)
+
+	filterQuery, err := p.buildFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	update := bson.M{
+		"$set": bson.M{pinFailuresPath: 0},
+		"$inc": bson.M{versionTag: 1},
+	}
+
+	logQuery(ctx, p.Collection, "updateOne", filterQuery)
 	result, err := coll.UpdateOne(ctx, filterQuery, update)
 	if err != nil {
 		return err
 	}
 
 	if result.MatchedCount == 0 {
-		return ErrEditConflict
+		return ErrDocumentNotFound
 	}
 
 	return nil
 }
 
+// pinLockedError returns ErrPINLocked for the error of an IncrementPINFailures which did not
+// match a Patron which exists.
+func pinLockedError(err error) error {
+	if errors.Is(err, ErrEditConflict) {
+		return ErrPINLocked
+	}
+
+	return err
+}
+
 // Delete deletes a Patron from the database by filter.
 func (p PatronModel) Delete(ctx context.Context, filter PatronFilter) error {
 	coll := p.Client.Database(p.Database).Collection(p.Collection)
 
-	filterQuery, err := buildPatronFilter(filter)
+	filterQuery, err := p.buildFilter(filter)
 	if err != nil {
-		return fmt.Errorf("%v: %v", errCreatingQueryFilter, err)
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
 	}
 
+	logQuery(ctx, p.Collection, "deleteOne", filterQuery)
 	result, err := coll.DeleteOne(ctx, filterQuery)
 	if err != nil {
 		return err
@@ -1,6 +1,8 @@
 package data
 
 import (
+	"bytes"
+	"github.com/mzeevi/library/internal/encryption"
 	"github.com/stretchr/testify/assert"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"testing"
@@ -111,7 +113,7 @@ func (ts *TestSuite) TestGetPatron() {
 	}{
 		{
 			name:        "FindByID",
-			filter:      PatronFilter{ID: ptr(testPatronsIDs[4].(primitive.ObjectID).Hex())},
+			filter:      PatronFilter{ID: ptr(PatronID(testPatronsIDs[4].(primitive.ObjectID).Hex()))},
 			expectedID:  testPatronsIDs[4].(primitive.ObjectID).Hex(),
 			expectError: false,
 		},
@@ -470,21 +472,21 @@ func (ts *TestSuite) TestUpdatePatron() {
 	for _, tt := range tests {
 		ts.Run(tt.name, func() {
 			if tt.expectError {
-				err := ts.models.Patrons.Update(ts.ctx, PatronFilter{ID: &tt.initialPatron.ID}, &tt.updateData)
-				assert.ErrorIs(t, err, ErrEditConflict)
+				err := ts.models.Patrons.Update(ts.ctx, PatronFilter{ID: ptr(PatronID(tt.initialPatron.ID))}, &tt.updateData)
+				assert.ErrorIs(t, err, ErrDocumentNotFound)
 			} else {
 				id, err := ts.models.Patrons.Insert(ts.ctx, &tt.initialPatron)
 				assert.NoError(t, err)
 
-				err = ts.models.Patrons.Update(ts.ctx, PatronFilter{ID: &id}, &tt.updateData)
+				err = ts.models.Patrons.Update(ts.ctx, PatronFilter{ID: ptr(PatronID(id))}, &tt.updateData)
 				assert.NoError(t, err)
 
-				updatedPatron, err := ts.models.Patrons.Get(ts.ctx, PatronFilter{ID: &id})
+				updatedPatron, err := ts.models.Patrons.Get(ts.ctx, PatronFilter{ID: ptr(PatronID(id))})
 				assert.NoError(t, err)
 
 				assert.Equal(t, updatedPatron.Version, int32(1))
 
-				err = ts.deletePatronsFromDB(PatronFilter{ID: &id})
+				err = ts.deletePatronsFromDB(PatronFilter{ID: ptr(PatronID(id))})
 				assert.NoError(t, err)
 			}
 		})
@@ -519,19 +521,57 @@ func (ts *TestSuite) TestDeletePatron() {
 	for _, tt := range tests {
 		ts.Run(tt.name, func() {
 			if tt.expectError {
-				err := ts.models.Patrons.Delete(ts.ctx, PatronFilter{ID: &tt.initialPatron.ID})
+				err := ts.models.Patrons.Delete(ts.ctx, PatronFilter{ID: ptr(PatronID(tt.initialPatron.ID))})
 				assert.ErrorIs(t, err, ErrDocumentNotFound)
 			} else {
 				id, err := ts.models.Patrons.Insert(ts.ctx, &tt.initialPatron)
 				assert.NoError(t, err)
 
-				err = ts.models.Patrons.Delete(ts.ctx, PatronFilter{ID: &id})
+				err = ts.models.Patrons.Delete(ts.ctx, PatronFilter{ID: ptr(PatronID(id))})
 				assert.NoError(t, err)
 
 				assert.NoError(t, err)
-				_, err = ts.models.Patrons.Get(ts.ctx, PatronFilter{ID: &id})
+				_, err = ts.models.Patrons.Get(ts.ctx, PatronFilter{ID: ptr(PatronID(id))})
 				assert.ErrorIs(t, err, ErrDocumentNotFound)
 			}
 		})
 	}
 }
+
+func TestPatronEncryptDigests(t *testing.T) {
+	cipher, err := encryption.NewCipher(bytes.Repeat([]byte("k"), 32))
+	if err != nil {
+		t.Fatalf("NewCipher() error = %v", err)
+	}
+	model := PatronModel{Cipher: cipher}
+
+	name, err := cipher.Encrypt(" Ann Reader")
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	email, err := cipher.Encrypt("ann@example.com")
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+
+	// A Patron whose name and email were encrypted already, but whose phone was not, as
+	// EncryptExisting migrates it. Names are digested regardless of case and surrounding spaces.
+	patrons := map[string]*Patron{
+		"plaintext":         {Name: "ANN READER ", Email: "ann@example.com", Phone: "+972501234567"},
+		"partly encrypted":  {Name: name, Email: email, Phone: "+972501234567"},
+		"already encrypted": {Name: name, Email: email},
+	}
+
+	for desc, patron := range patrons {
+		encrypted, err := model.encrypt(patron)
+		if err != nil {
+			t.Fatalf("encrypt(%s) error = %v", desc, err)
+		}
+		if encrypted.NameDigest != cipher.Digest("ann reader") || encrypted.EmailDigest != cipher.Digest("ann@example.com") {
+			t.Errorf("encrypt(%s) digests = %q, %q; want the digests of the normalized plaintext", desc, encrypted.NameDigest, encrypted.EmailDigest)
+		}
+		if !encryption.IsEncrypted(encrypted.Name) || !encryption.IsEncrypted(encrypted.Email) {
+			t.Errorf("encrypt(%s) = %q, %q; want them encrypted", desc, encrypted.Name, encrypted.Email)
+		}
+	}
+}
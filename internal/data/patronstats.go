@@ -0,0 +1,166 @@
+package data
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"time"
+)
+
+const (
+	// favoriteGenres is the number of the most borrowed genres of a Patron.
+	favoriteGenres = 3
+	week           = 7 * 24 * time.Hour
+)
+
+// PatronStats summarizes the loans of a Patron, which don't include canceled transactions, as of a time:
+// only the loans borrowed by then are counted, and those returned after it count as borrowed.
+// OnTimeReturnRate is the share of the returned loans which were returned by their due date, and
+// FavoriteGenres are the genres of the books the Patron borrowed the most. OnTimeStreak is the
+// number of the latest returns which were on time, and BorrowingStreakWeeks is the number of
+// consecutive weeks, counted back from now, in each of which the Patron borrowed a book.
+type PatronStats struct {
+	TotalBorrows         int      `json:"total_borrows"`
+	ReturnedLoans        int      `json:"returned_loans"`
+	OnTimeReturnRate     float64  `json:"on_time_return_rate"`
+	FavoriteGenres       []string `json:"favorite_genres"`
+	OnTimeStreak         int      `json:"on_time_streak"`
+	BorrowingStreakWeeks int      `json:"borrowing_streak_weeks"`
+}
+
+// patronLoans is the aggregation of the loans of a Patron: their totals, the favorite genres, whether
+// each return was on time from the latest, and the weeks before now in which books were borrowed.
+type patronLoans struct {
+	Totals  []loanTotals `bson:"totals"`
+	Genres  []loanGenre  `bson:"genres"`
+	Returns []loanReturn `bson:"returns"`
+	Weeks   []loanWeek   `bson:"weeks"`
+}
+
+type loanTotals struct {
+	Total    int `bson:"total"`
+	Returned int `bson:"returned"`
+	OnTime   int `bson:"on_time"`
+}
+
+type loanGenre struct {
+	Genre string `bson:"_id"`
+}
+
+type loanReturn struct {
+	OnTime bool `bson:"on_time"`
+}
+
+// loanWeek is a week in which a book was borrowed, counted back from now.
+type loanWeek struct {
+	Week int `bson:"_id"`
+}
+
+// stats derives the PatronStats from the aggregation of the loans.
+func (l patronLoans) stats() *PatronStats {
+	stats := &PatronStats{FavoriteGenres: make([]string, 0, len(l.Genres))}
+
+	if len(l.Totals) > 0 {
+		totals := l.Totals[0]
+		stats.TotalBorrows = totals.Total
+		stats.ReturnedLoans = totals.Returned
+		if totals.Returned > 0 {
+			stats.OnTimeReturnRate = float64(totals.OnTime) / float64(totals.Returned)
+		}
+	}
+
+	for _, genre := range l.Genres {
+		stats.FavoriteGenres = append(stats.FavoriteGenres, genre.Genre)
+	}
+
+	for _, ret := range l.Returns {
+		if !ret.OnTime {
+			break
+		}
+		stats.OnTimeStreak++
+	}
+
+	for _, w := range l.Weeks {
+		if w.Week < stats.BorrowingStreakWeeks {
+			continue
+		}
+		if w.Week > stats.BorrowingStreakWeeks {
+			break
+		}
+		stats.BorrowingStreakWeeks++
+	}
+
+	return stats
+}
+
+// PatronStats aggregates the loans of a Patron as of now, which may be in the past.
+func (t TransactionModel) PatronStats(ctx context.Context, patronID string, now time.Time) (*PatronStats, error) {
+	coll := t.Client.Database(t.Database).Collection(t.Collection, listOptions(ctx))
+
+	returned := bson.M{"$and": bson.A{
+		bson.M{"$eq": bson.A{"$" + statusTag, TransactionStatusReturned}},
+		bson.M{"$lte": bson.A{"$" + returnedAtTag, now}},
+	}}
+	onTime := bson.M{"$lte": bson.A{"$" + returnedAtTag, "$" + dueDateTag}}
+	match := bson.M{patronIDTag: patronID, statusTag: bson.M{"$ne": TransactionStatusCanceled}, borrowedAtTag: bson.M{"$lte": now}}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$facet", Value: bson.M{
+			"totals": bson.A{
+				bson.M{"$group": bson.M{
+					idTag:      nil,
+					"total":    bson.M{"$sum": 1},
+					"returned": bson.M{"$sum": bson.M{"$cond": bson.A{returned, 1, 0}}},
+					"on_time":  bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$and": bson.A{returned, onTime}}, 1, 0}}},
+				}},
+			},
+			"genres": bson.A{
+				bson.M{"$lookup": bson.M{
+					"from": t.BooksCollection,
+					"let":  bson.M{"book_id": bson.M{"$toObjectId": "$" + bookIDTag}},
+					"pipeline": bson.A{
+						bson.M{"$match": bson.M{"$expr": bson.M{"$eq": bson.A{"$" + idTag, "$$book_id"}}}},
+						bson.M{"$project": bson.M{genresTag: 1}},
+					},
+					"as": "book",
+				}},
+				bson.M{"$unwind": "$book"},
+				bson.M{"$unwind": "$book." + genresTag},
+				bson.M{"$group": bson.M{idTag: "$book." + genresTag, "count": bson.M{"$sum": 1}}},
+				bson.M{"$sort": bson.D{{Key: "count", Value: -1}, {Key: idTag, Value: 1}}},
+				bson.M{"$limit": favoriteGenres},
+			},
+			"returns": bson.A{
+				bson.M{"$match": bson.M{statusTag: TransactionStatusReturned, returnedAtTag: bson.M{"$lte": now}}},
+				bson.M{"$sort": bson.M{returnedAtTag: -1}},
+				bson.M{"$project": bson.M{idTag: 0, "on_time": onTime}},
+			},
+			"weeks": bson.A{
+				bson.M{"$group": bson.M{idTag: bson.M{"$floor": bson.M{"$divide": bson.A{
+					bson.M{"$subtract": bson.A{now, "$" + borrowedAtTag}}, week.Milliseconds(),
+				}}}}},
+				bson.M{"$sort": bson.M{idTag: 1}},
+			},
+		}}},
+	}
+
+	logQuery(ctx, t.Collection, "aggregate", match)
+	cursor, err := coll.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var loans patronLoans
+	if cursor.Next(ctx) {
+		if err = cursor.Decode(&loans); err != nil {
+			return nil, err
+		}
+	}
+	if err = cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	return loans.stats(), nil
+}
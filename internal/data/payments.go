@@ -0,0 +1,279 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+	"time"
+)
+
+const (
+	PaymentStatusPending = "pending"
+	PaymentStatusPaid    = "paid"
+)
+
+const (
+	PaymentMethodOnline = "online"
+	PaymentMethodCash   = "cash"
+	PaymentMethodCheck  = "check"
+)
+
+// Payment is a payment of the Fines of Transactions by a Patron. Online payments are checkout
+// sessions of a payment provider, which are pending until the provider notifies that the session
+// was paid, and the Reference of the payment at the provider is recorded then. Cash and check
+// payments are taken at the desk, and are recorded as paid with the admin who AcceptedBy them.
+type Payment struct {
+	ID         string        `bson:"_id,omitempty" json:"id,omitempty"`
+	PatronID   string        `bson:"patron_id" json:"patron_id"`
+	Method     string        `bson:"method" json:"method"`
+	Provider   string        `bson:"provider,omitempty" json:"provider,omitempty"`
+	SessionID  string        `bson:"session_id,omitempty" json:"session_id,omitempty"`
+	URL        string        `bson:"url,omitempty" json:"url,omitempty"`
+	Fines      []PaymentFine `bson:"fines" json:"fines"`
+	Amount     float64       `bson:"amount" json:"amount"`
+	Currency   string        `bson:"currency" json:"currency"`
+	Status     string        `bson:"status" json:"status"`
+	Reference  string        `bson:"reference,omitempty" json:"reference,omitempty"`
+	AcceptedBy string        `bson:"accepted_by,omitempty" json:"accepted_by,omitempty"`
+	Note       string        `bson:"note,omitempty" json:"note,omitempty"`
+	ExpiresAt  time.Time     `bson:"expires_at,omitempty" json:"expires_at,omitempty"`
+	PaidAt     time.Time     `bson:"paid_at,omitempty" json:"paid_at,omitempty"`
+	CreatedAt  time.Time     `bson:"created_at" json:"created_at"`
+	UpdatedAt  time.Time     `bson:"updated_at" json:"-"`
+	Version    int32         `bson:"version" json:"-"`
+}
+
+// PaymentFine is the fine of a Transaction which is paid in a Payment.
+type PaymentFine struct {
+	TransactionID string  `bson:"transaction_id" json:"transaction_id"`
+	Amount        float64 `bson:"amount" json:"amount"`
+}
+
+// FinePayment records the Payment in which the fine of a Transaction was paid.
+type FinePayment struct {
+	PaymentID string    `bson:"payment_id" json:"payment_id"`
+	Reference string    `bson:"reference" json:"reference"`
+	Amount    float64   `bson:"amount" json:"amount"`
+	PaidAt    time.Time `bson:"paid_at" json:"paid_at"`
+}
+
+type PaymentFilter struct {
+	ID           *string    `json:"id,omitempty"`
+	PatronID     *string    `json:"patron_id,omitempty"`
+	SessionID    *string    `json:"session_id,omitempty"`
+	Status       *string    `json:"status,omitempty"`
+	Methods      []string   `json:"methods,omitempty"`
+	AcceptedBy   *string    `json:"accepted_by,omitempty"`
+	MinExpiresAt *time.Time `json:"min_expires_at,omitempty"`
+	MinPaidAt    *time.Time `json:"min_paid_at,omitempty"`
+	MaxPaidAt    *time.Time `json:"max_paid_at,omitempty"`
+	Version      *int32     `json:"-,omitempty"`
+}
+
+type PaymentModel struct {
+	Client     *mongo.Client
+	Database   string
+	Collection string
+}
+
+// buildPaymentFilter constructs a filter query for filtering payments.
+func buildPaymentFilter(filter PaymentFilter) (bson.M, error) {
+	query := bson.M{}
+
+	if filter.ID != nil {
+		id, err := objectID(*filter.ID)
+		if err != nil {
+			return query, err
+		}
+		query[idTag] = id
+	}
+	if filter.PatronID != nil {
+		query[patronIDTag] = *filter.PatronID
+	}
+	if filter.SessionID != nil {
+		query[sessionIDTag] = *filter.SessionID
+	}
+	if filter.Status != nil {
+		query[statusTag] = *filter.Status
+	}
+	if len(filter.Methods) > 0 {
+		query[methodTag] = bson.M{"$in": filter.Methods}
+	}
+	if filter.AcceptedBy != nil {
+		query[acceptedByTag] = *filter.AcceptedBy
+	}
+	if filter.MinExpiresAt != nil {
+		query[expiresAtTag] = bson.M{"$gte": *filter.MinExpiresAt}
+	}
+
+	paidAtQuery := bson.M{}
+	if filter.MinPaidAt != nil {
+		paidAtQuery["$gte"] = *filter.MinPaidAt
+	}
+	if filter.MaxPaidAt != nil {
+		paidAtQuery["$lt"] = *filter.MaxPaidAt
+	}
+	if len(paidAtQuery) > 0 {
+		query[paidAtTag] = paidAtQuery
+	}
+	if filter.Version != nil {
+		query[versionTag] = *filter.Version
+	}
+
+	return query, nil
+}
+
+// buildPaymentUpdater constructs an update document for recording that a Payment was paid.
+func buildPaymentUpdater(payment *Payment) bson.D {
+	updateFields := bson.D{
+		{Key: statusTag, Value: payment.Status},
+		{Key: referenceTag, Value: payment.Reference},
+		{Key: paidAtTag, Value: payment.PaidAt},
+	}
+
+	updateFields = append(updateFields, bson.E{Key: updatedAtTag, Value: time.Now()})
+
+	update := bson.D{
+		{Key: "$set", Value: updateFields},
+		{Key: "$inc", Value: bson.D{{Key: versionTag, Value: 1}}},
+	}
+
+	return update
+}
+
+// CreateIndexes creates an index on the session IDs, by which providers notify of payments, and
+// on the times payments were paid, by which the daily cash report is built.
+func (p PaymentModel) CreateIndexes() error {
+	coll := p.Client.Database(p.Database).Collection(p.Collection)
+	indexModels := []mongo.IndexModel{
+		{Keys: bson.D{{Key: sessionIDTag, Value: 1}}},
+		{Keys: bson.D{{Key: paidAtTag, Value: 1}}},
+	}
+
+	_, err := coll.Indexes().CreateMany(context.TODO(), indexModels)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Insert inserts a new Payment into the database.
+func (p PaymentModel) Insert(ctx context.Context, payment *Payment) (string, error) {
+	coll := p.Client.Database(p.Database).Collection(p.Collection)
+
+	now := time.Now()
+	payment.CreatedAt = now
+	payment.UpdatedAt = now
+
+	res, err := coll.InsertOne(ctx, payment)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "_id_ dup key:"):
+			return "", ErrDuplicateID
+		default:
+			return "", err
+		}
+	}
+
+	return res.InsertedID.(primitive.ObjectID).Hex(), nil
+}
+
+// Get retrieves a single Payment from the database matching an optional filter.
+func (p PaymentModel) Get(ctx context.Context, filter PaymentFilter) (*Payment, error) {
+	coll := p.Client.Database(p.Database).Collection(p.Collection)
+
+	filterQuery, err := buildPaymentFilter(filter)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	payment := &Payment{}
+
+	logQuery(ctx, p.Collection, "findOne", filterQuery)
+	err = coll.FindOne(ctx, filterQuery, options.FindOne().SetSort(bson.D{{Key: createdAtTag, Value: -1}})).Decode(payment)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrDocumentNotFound
+		}
+		return nil, err
+	}
+
+	return payment, nil
+}
+
+// GetAll retrieves all Payments from the database matching an optional filter, with pagination
+// and sorting.
+func (p PaymentModel) GetAll(ctx context.Context, filter PaymentFilter, paginator Paginator, sorter Sorter) ([]Payment, Metadata, error) {
+	coll := p.Client.Database(p.Database).Collection(p.Collection, listOptions(ctx))
+
+	payments := make([]Payment, 0)
+	metadata := Metadata{}
+
+	filterQuery, err := buildPaymentFilter(filter)
+	if err != nil {
+		return nil, Metadata{}, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	sortQuery, err := buildSorter(sorter)
+	if err != nil {
+		return nil, Metadata{}, fmt.Errorf("%v: %v", errCreatingQuerySort, err)
+	}
+
+	findOpt := options.Find().SetSort(sortQuery).SetCollation(sorter.collation())
+
+	if paginator.valid() {
+		var totalRecords int64
+
+		findOpt = findOpt.SetLimit(paginator.limit()).SetSkip(paginator.offset())
+		totalRecords, err = coll.CountDocuments(ctx, filterQuery)
+		if err != nil {
+			return payments, Metadata{}, errCreatingQueryFilter
+		}
+
+		metadata = calculateMetadata(totalRecords, paginator.Page, paginator.PageSize)
+	}
+
+	logQuery(ctx, p.Collection, "find", filterQuery)
+	cursor, err := coll.Find(ctx, filterQuery, findOpt)
+	if err != nil {
+		return payments, Metadata{}, err
+	}
+	defer cursor.Close(ctx)
+
+	if err = cursor.All(ctx, &payments); err != nil {
+		return payments, Metadata{}, err
+	}
+
+	return payments, metadata, nil
+}
+
+// Update updates a Payment's status in the database.
+func (p PaymentModel) Update(ctx context.Context, filter PaymentFilter, payment *Payment) error {
+	coll := p.Client.Database(p.Database).Collection(p.Collection)
+
+	update := buildPaymentUpdater(payment)
+
+	filter.Version = &payment.Version
+	filterQuery, err := buildPaymentFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	logQuery(ctx, p.Collection, "updateOne", filterQuery)
+	result, err := coll.UpdateOne(ctx, filterQuery, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
@@ -0,0 +1,269 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+	"time"
+)
+
+// Program is an activity of the library, such as a story hour or a workshop, which patrons
+// register to. Registered is the number of patrons registered to it, which is at most its Capacity,
+// and Waitlisted is the number of patrons waiting for a place. RemindedAt is when its registered
+// patrons were reminded of it.
+type Program struct {
+	ID          string    `bson:"_id,omitempty" json:"id,omitempty"`
+	Title       string    `bson:"title" json:"title"`
+	Description string    `bson:"description,omitempty" json:"description,omitempty"`
+	Branch      string    `bson:"branch,omitempty" json:"branch,omitempty"`
+	Location    string    `bson:"location,omitempty" json:"location,omitempty"`
+	StartsAt    time.Time `bson:"starts_at" json:"starts_at"`
+	EndsAt      time.Time `bson:"ends_at" json:"ends_at"`
+	Capacity    int       `bson:"capacity" json:"capacity"`
+	Registered  int       `bson:"registered" json:"registered"`
+	Waitlisted  int       `bson:"waitlisted" json:"waitlisted"`
+	RemindedAt  time.Time `bson:"reminded_at,omitempty" json:"reminded_at,omitempty"`
+	CreatedAt   time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt   time.Time `bson:"updated_at" json:"-"`
+	Version     int32     `bson:"version" json:"-"`
+}
+
+// ProgramFilter filters Programs. MinStartsAt is inclusive and MaxStartsAt is exclusive.
+type ProgramFilter struct {
+	ID          *string    `json:"id,omitempty"`
+	Branch      *string    `json:"branch,omitempty"`
+	MinStartsAt *time.Time `json:"min_starts_at,omitempty"`
+	MaxStartsAt *time.Time `json:"max_starts_at,omitempty"`
+	Reminded    *bool      `json:"reminded,omitempty"`
+	Version     *int32     `json:"-,omitempty"`
+}
+
+type ProgramModel struct {
+	Client     *mongo.Client
+	Database   string
+	Collection string
+}
+
+// buildProgramFilter constructs a filter query for filtering programs.
+func buildProgramFilter(filter ProgramFilter) (bson.M, error) {
+	query := bson.M{}
+
+	if filter.ID != nil {
+		id, err := objectID(*filter.ID)
+		if err != nil {
+			return query, err
+		}
+		query[idTag] = id
+	}
+	if filter.Branch != nil {
+		query[branchTag] = *filter.Branch
+	}
+
+	startsAtQuery := bson.M{}
+	if filter.MinStartsAt != nil {
+		startsAtQuery["$gte"] = *filter.MinStartsAt
+	}
+	if filter.MaxStartsAt != nil {
+		startsAtQuery["$lt"] = *filter.MaxStartsAt
+	}
+	if len(startsAtQuery) > 0 {
+		query[startsAtTag] = startsAtQuery
+	}
+
+	if filter.Reminded != nil {
+		query[remindedAtTag] = bson.M{"$exists": *filter.Reminded}
+	}
+	if filter.Version != nil {
+		query[versionTag] = *filter.Version
+	}
+
+	return query, nil
+}
+
+// buildProgramUpdater constructs an update document for updating a Program. The time at which
+// its patrons were reminded is unset if they were not.
+func buildProgramUpdater(program *Program) bson.D {
+	updateFields := bson.D{
+		{Key: titleTag, Value: program.Title},
+		{Key: descriptionTag, Value: program.Description},
+		{Key: branchTag, Value: program.Branch},
+		{Key: locationTag, Value: program.Location},
+		{Key: startsAtTag, Value: program.StartsAt},
+		{Key: endsAtTag, Value: program.EndsAt},
+		{Key: capacityTag, Value: program.Capacity},
+		{Key: registeredTag, Value: program.Registered},
+		{Key: waitlistedTag, Value: program.Waitlisted},
+	}
+	if !program.RemindedAt.IsZero() {
+		updateFields = append(updateFields, bson.E{Key: remindedAtTag, Value: program.RemindedAt})
+	}
+
+	updateFields = append(updateFields, bson.E{Key: updatedAtTag, Value: time.Now()})
+
+	update := bson.D{
+		{Key: "$set", Value: updateFields},
+		{Key: "$inc", Value: bson.D{{Key: versionTag, Value: 1}}},
+	}
+	if program.RemindedAt.IsZero() {
+		update = append(update, bson.E{Key: "$unset", Value: bson.D{{Key: remindedAtTag, Value: ""}}})
+	}
+
+	return update
+}
+
+// CreateIndexes creates an index on the start times of the programs, by which patrons browse the
+// upcoming programs and their patrons are reminded of them.
+func (p ProgramModel) CreateIndexes() error {
+	coll := p.Client.Database(p.Database).Collection(p.Collection)
+	indexModel := mongo.IndexModel{
+		Keys: bson.D{{Key: startsAtTag, Value: 1}},
+	}
+
+	_, err := coll.Indexes().CreateOne(context.TODO(), indexModel)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Insert inserts a new Program into the database.
+func (p ProgramModel) Insert(ctx context.Context, program *Program) (string, error) {
+	coll := p.Client.Database(p.Database).Collection(p.Collection)
+
+	now := time.Now()
+	program.CreatedAt = now
+	program.UpdatedAt = now
+
+	res, err := coll.InsertOne(ctx, program)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "_id_ dup key:"):
+			return "", ErrDuplicateID
+		default:
+			return "", err
+		}
+	}
+
+	return res.InsertedID.(primitive.ObjectID).Hex(), nil
+}
+
+// Get retrieves a single Program from the database matching an optional filter.
+func (p ProgramModel) Get(ctx context.Context, filter ProgramFilter) (*Program, error) {
+	coll := p.Client.Database(p.Database).Collection(p.Collection)
+
+	filterQuery, err := buildProgramFilter(filter)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	program := &Program{}
+
+	logQuery(ctx, p.Collection, "findOne", filterQuery)
+	err = coll.FindOne(ctx, filterQuery).Decode(program)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrDocumentNotFound
+		}
+		return nil, err
+	}
+
+	return program, nil
+}
+
+// GetAll retrieves a paginated list of Programs from the database matching an optional filter and sorting.
+func (p ProgramModel) GetAll(ctx context.Context, filter ProgramFilter, paginator Paginator, sorter Sorter) ([]Program, Metadata, error) {
+	coll := p.Client.Database(p.Database).Collection(p.Collection, listOptions(ctx))
+
+	programs := make([]Program, 0)
+	metadata := Metadata{}
+
+	filterQuery, err := buildProgramFilter(filter)
+	if err != nil {
+		return programs, Metadata{}, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	sortQuery, err := buildSorter(sorter)
+	if err != nil {
+		return nil, Metadata{}, fmt.Errorf("%v: %v", errCreatingQuerySort, err)
+	}
+
+	findOpt := options.Find().SetSort(sortQuery).SetCollation(sorter.collation())
+
+	if paginator.valid() {
+		var totalRecords int64
+
+		findOpt = findOpt.SetLimit(paginator.limit()).SetSkip(paginator.offset())
+		totalRecords, err = coll.CountDocuments(ctx, filterQuery)
+		if err != nil {
+			return programs, Metadata{}, errCreatingQueryFilter
+		}
+
+		metadata = calculateMetadata(totalRecords, paginator.Page, paginator.PageSize)
+	}
+
+	logQuery(ctx, p.Collection, "find", filterQuery)
+	cursor, err := coll.Find(ctx, filterQuery, findOpt)
+	if err != nil {
+		return programs, Metadata{}, err
+	}
+	defer cursor.Close(ctx)
+
+	if err = cursor.All(ctx, &programs); err != nil {
+		return programs, Metadata{}, err
+	}
+
+	return programs, metadata, nil
+}
+
+// Update updates a Program in the database.
+func (p ProgramModel) Update(ctx context.Context, filter ProgramFilter, program *Program) error {
+	coll := p.Client.Database(p.Database).Collection(p.Collection)
+
+	update := buildProgramUpdater(program)
+
+	filter.Version = &program.Version
+	filterQuery, err := buildProgramFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	logQuery(ctx, p.Collection, "updateOne", filterQuery)
+	result, err := coll.UpdateOne(ctx, filterQuery, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+// Delete deletes a Program from the database.
+func (p ProgramModel) Delete(ctx context.Context, filter ProgramFilter) error {
+	coll := p.Client.Database(p.Database).Collection(p.Collection)
+
+	filterQuery, err := buildProgramFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	logQuery(ctx, p.Collection, "deleteOne", filterQuery)
+	result, err := coll.DeleteOne(ctx, filterQuery)
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return ErrDocumentNotFound
+	}
+
+	return nil
+}
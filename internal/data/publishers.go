@@ -0,0 +1,356 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var (
+	ErrDuplicatePublisher = errors.New("duplicate publisher")
+)
+
+// publisherSuffixes are the corporate suffixes which NormalizePublisherName drops.
+var publisherSuffixes = map[string]bool{
+	"co":          true,
+	"company":     true,
+	"corp":        true,
+	"corporation": true,
+	"gmbh":        true,
+	"inc":         true,
+	"limited":     true,
+	"llc":         true,
+	"ltd":         true,
+	"plc":         true,
+}
+
+// Publisher is a publisher of Books. Books reference Publishers by ID and keep their names,
+// so variants of a name such as "Penguin Books Ltd." and "penguin books" are one Publisher.
+// Aliases are the names of the Publishers which were merged into it, and NormalizedNames are
+// the normalized forms of its name and Aliases, by which names are matched.
+type Publisher struct {
+	ID              string    `bson:"_id,omitempty" json:"id,omitempty"`
+	Name            string    `bson:"name" json:"name"`
+	Aliases         []string  `bson:"aliases" json:"aliases"`
+	NormalizedNames []string  `bson:"normalized_names" json:"-"`
+	CreatedAt       time.Time `bson:"created_at" json:"-"`
+	UpdatedAt       time.Time `bson:"updated_at" json:"-"`
+	Version         int32     `bson:"version" json:"-"`
+}
+
+type PublisherFilter struct {
+	ID             *string `json:"id,omitempty"`
+	Name           *string `json:"name,omitempty"`
+	NormalizedName *string `json:"normalized_name,omitempty"`
+	Version        *int32  `json:"-,omitempty"`
+}
+
+type PublisherModel struct {
+	Client     *mongo.Client
+	Database   string
+	Collection string
+}
+
+// NewPublisher constructs a new Publisher.
+func NewPublisher(id, name string) *Publisher {
+	now := time.Now()
+	return &Publisher{
+		ID:              id,
+		Name:            strings.Join(strings.Fields(name), " "),
+		Aliases:         []string{},
+		NormalizedNames: []string{NormalizePublisherName(name)},
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+}
+
+// NormalizePublisherName returns the form of the name of a Publisher by which its variants are
+// matched. It is lower-cased, "&" is spelled "and", punctuation is dropped, and corporate
+// suffixes such as "Inc." are removed, unless the name consists of nothing else.
+func NormalizePublisherName(name string) string {
+	name = strings.ReplaceAll(strings.ToLower(name), "&", " and ")
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	for len(words) > 1 && publisherSuffixes[words[len(words)-1]] {
+		words = words[:len(words)-1]
+	}
+
+	return strings.Join(words, " ")
+}
+
+// AddAlias adds a name, and the normalized forms of the given normalized names, to the names by
+// which a Publisher is matched.
+func (p *Publisher) AddAlias(name string, normalizedNames ...string) {
+	if name != p.Name && !slices.Contains(p.Aliases, name) {
+		p.Aliases = append(p.Aliases, name)
+	}
+
+	for _, normalized := range append([]string{NormalizePublisherName(name)}, normalizedNames...) {
+		if !slices.Contains(p.NormalizedNames, normalized) {
+			p.NormalizedNames = append(p.NormalizedNames, normalized)
+		}
+	}
+}
+
+// Rename renames a Publisher. Its previous name is kept as an alias, so that it still matches.
+func (p *Publisher) Rename(name string) {
+	previous := p.Name
+	p.Name = strings.Join(strings.Fields(name), " ")
+	p.Aliases = slices.DeleteFunc(p.Aliases, func(alias string) bool { return alias == p.Name })
+
+	p.AddAlias(previous)
+	p.AddAlias(p.Name)
+}
+
+// Merge adds the name and the aliases of a duplicate Publisher to the aliases of a Publisher.
+func (p *Publisher) Merge(duplicate *Publisher) {
+	p.AddAlias(duplicate.Name, duplicate.NormalizedNames...)
+	for _, alias := range duplicate.Aliases {
+		p.AddAlias(alias)
+	}
+}
+
+// buildPublisherFilter constructs a filter query for filtering publishers.
+func buildPublisherFilter(filter PublisherFilter) (bson.M, error) {
+	query := bson.M{}
+
+	if filter.ID != nil {
+		id, err := objectID(*filter.ID)
+		if err != nil {
+			return query, err
+		}
+		query[idTag] = id
+	}
+
+	if filter.Name != nil {
+		query[nameTag] = textQuery(*filter.Name, MatchContains)
+	}
+
+	if filter.NormalizedName != nil {
+		query[normalizedNamesTag] = *filter.NormalizedName
+	}
+
+	if filter.Version != nil {
+		query[versionTag] = *filter.Version
+	}
+
+	return query, nil
+}
+
+// buildPublisherUpdater constructs an update query for updating a publisher.
+func buildPublisherUpdater(publisher *Publisher) bson.D {
+	updateFields := bson.D{
+		{Key: nameTag, Value: publisher.Name},
+		{Key: aliasesTag, Value: publisher.Aliases},
+		{Key: normalizedNamesTag, Value: publisher.NormalizedNames},
+		{Key: updatedAtTag, Value: time.Now()},
+	}
+
+	update := bson.D{
+		{Key: "$set", Value: updateFields},
+		{Key: "$inc", Value: bson.D{{Key: versionTag, Value: 1}}},
+	}
+
+	return update
+}
+
+// ensurePublisher returns the Publisher matching the normalized form of a name, inserting a new
+// Publisher with the name if there is none.
+func ensurePublisher(ctx context.Context, publishers PublisherStore, name string) (*Publisher, error) {
+	normalized := NormalizePublisherName(name)
+
+	publisher, err := publishers.Get(ctx, PublisherFilter{NormalizedName: &normalized})
+	if !errors.Is(err, ErrDocumentNotFound) {
+		return publisher, err
+	}
+
+	publisher = NewPublisher("", name)
+	publisher.ID, err = publishers.Insert(ctx, publisher)
+	if errors.Is(err, ErrDuplicatePublisher) {
+		// The Publisher was inserted concurrently.
+		return publishers.Get(ctx, PublisherFilter{NormalizedName: &normalized})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return publisher, nil
+}
+
+// CreateUniqueIndex creates a unique index using a field.
+func (p PublisherModel) CreateUniqueIndex() error {
+	coll := p.Client.Database(p.Database).Collection(p.Collection)
+	indexModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: normalizedNamesTag, Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+
+	_, err := coll.Indexes().CreateOne(context.TODO(), indexModel)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Ensure returns the Publisher whose name, or one of whose Aliases, normalizes to the same form
+// as name, inserting a new Publisher with the name if there is none.
+func (p PublisherModel) Ensure(ctx context.Context, name string) (*Publisher, error) {
+	return ensurePublisher(ctx, p, name)
+}
+
+// Insert inserts a new Publisher into the database.
+func (p PublisherModel) Insert(ctx context.Context, publisher *Publisher) (string, error) {
+	coll := p.Client.Database(p.Database).Collection(p.Collection)
+
+	publisher.CreatedAt = time.Now()
+	publisher.UpdatedAt = time.Now()
+
+	res, err := coll.InsertOne(ctx, publisher)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "_id_ dup key:"):
+			return "", ErrDuplicateID
+		case strings.Contains(err.Error(), "normalized_names_1 dup key"):
+			return "", ErrDuplicatePublisher
+		default:
+			return "", err
+		}
+	}
+
+	if oid, ok := res.InsertedID.(primitive.ObjectID); ok {
+		return oid.Hex(), nil
+	}
+
+	return res.InsertedID.(string), nil
+}
+
+// Get retrieves a single Publisher from the database matching an optional filter.
+func (p PublisherModel) Get(ctx context.Context, filter PublisherFilter) (*Publisher, error) {
+	coll := p.Client.Database(p.Database).Collection(p.Collection)
+
+	filterQuery, err := buildPublisherFilter(filter)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	publisher := &Publisher{}
+
+	logQuery(ctx, p.Collection, "findOne", filterQuery)
+	err = coll.FindOne(ctx, filterQuery).Decode(publisher)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrDocumentNotFound
+		}
+		return nil, err
+	}
+
+	return publisher, nil
+}
+
+// GetAll retrieves all Publishers from the database matching an optional filter and paginator.
+func (p PublisherModel) GetAll(ctx context.Context, filter PublisherFilter, paginator Paginator, sorter Sorter) ([]Publisher, Metadata, error) {
+	coll := p.Client.Database(p.Database).Collection(p.Collection, listOptions(ctx))
+
+	publishers := make([]Publisher, 0)
+	metadata := Metadata{}
+
+	filterQuery, err := buildPublisherFilter(filter)
+	if err != nil {
+		return publishers, Metadata{}, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	sortQuery, err := buildSorter(sorter)
+	if err != nil {
+		return publishers, Metadata{}, fmt.Errorf("%v: %v", errCreatingQuerySort, err)
+	}
+
+	findOpt := options.Find().SetSort(sortQuery).SetCollation(sorter.collation())
+
+	if paginator.valid() {
+		var totalRecords int64
+
+		findOpt = findOpt.SetLimit(paginator.limit()).SetSkip(paginator.offset())
+		totalRecords, err = coll.CountDocuments(ctx, filterQuery)
+		if err != nil {
+			return publishers, Metadata{}, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+		}
+
+		metadata = calculateMetadata(totalRecords, paginator.Page, paginator.PageSize)
+	}
+
+	logQuery(ctx, p.Collection, "find", filterQuery)
+	cursor, err := coll.Find(ctx, filterQuery, findOpt)
+	if err != nil {
+		return publishers, Metadata{}, err
+	}
+	defer cursor.Close(ctx)
+
+	if err = cursor.All(ctx, &publishers); err != nil {
+		return publishers, Metadata{}, err
+	}
+
+	return publishers, metadata, nil
+}
+
+// Update updates a Publisher in the database matching a filter.
+func (p PublisherModel) Update(ctx context.Context, filter PublisherFilter, publisher *Publisher) error {
+	coll := p.Client.Database(p.Database).Collection(p.Collection)
+
+	update := buildPublisherUpdater(publisher)
+
+	filter.Version = &publisher.Version
+	filterQuery, err := buildPublisherFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	logQuery(ctx, p.Collection, "updateOne", filterQuery)
+	result, err := coll.UpdateOne(ctx, filterQuery, update)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "normalized_names_1 dup key"):
+			return ErrDuplicatePublisher
+		default:
+			return err
+		}
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+// Delete deletes a Publisher from the database by filter.
+func (p PublisherModel) Delete(ctx context.Context, filter PublisherFilter) error {
+	coll := p.Client.Database(p.Database).Collection(p.Collection)
+
+	filterQuery, err := buildPublisherFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	logQuery(ctx, p.Collection, "deleteOne", filterQuery)
+	result, err := coll.DeleteOne(ctx, filterQuery)
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return ErrDocumentNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,28 @@
+package data
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+type contextKey string
+
+const readPreferenceContextKey = contextKey("readPreference")
+
+// WithReadPreference returns a copy of the context whose lists of documents are read according to
+// the read preference, such as from secondaries, instead of that of the client.
+func WithReadPreference(ctx context.Context, rp *readpref.ReadPref) context.Context {
+	return context.WithValue(ctx, readPreferenceContextKey, rp)
+}
+
+// listOptions returns the options of a collection which lists of documents are read from,
+// according to the read preference carried by the context, if any.
+func listOptions(ctx context.Context) *options.CollectionOptions {
+	opts := options.Collection()
+	if rp, ok := ctx.Value(readPreferenceContextKey).(*readpref.ReadPref); ok && rp != nil {
+		opts = opts.SetReadPreference(rp)
+	}
+
+	return opts
+}
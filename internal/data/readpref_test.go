@@ -0,0 +1,18 @@
+package data
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"testing"
+)
+
+func TestListOptions(t *testing.T) {
+	if opts := listOptions(context.Background()); opts.ReadPreference != nil {
+		t.Errorf("listOptions() without a read preference = %v; want nil", opts.ReadPreference)
+	}
+
+	ctx := WithReadPreference(context.Background(), readpref.SecondaryPreferred())
+	if opts := listOptions(ctx); opts.ReadPreference == nil || opts.ReadPreference.Mode() != readpref.SecondaryPreferredMode {
+		t.Errorf("listOptions() = %v; want %v", opts.ReadPreference, readpref.SecondaryPreferredMode)
+	}
+}
@@ -0,0 +1,234 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+	"time"
+)
+
+// Statuses of Registrations.
+const (
+	RegistrationStatusRegistered = "registered"
+	RegistrationStatusWaitlisted = "waitlisted"
+	RegistrationStatusCanceled   = "canceled"
+)
+
+// Registration is a place of a patron in a Program. A patron who registers to a full Program is
+// waitlisted, and is registered when a place opens up, in the order of the waitlist, at PromotedAt.
+type Registration struct {
+	ID         string    `bson:"_id,omitempty" json:"id,omitempty"`
+	ProgramID  string    `bson:"program_id" json:"program_id"`
+	PatronID   string    `bson:"patron_id" json:"patron_id"`
+	Status     string    `bson:"status" json:"status"`
+	PromotedAt time.Time `bson:"promoted_at,omitempty" json:"promoted_at,omitempty"`
+	CanceledAt time.Time `bson:"canceled_at,omitempty" json:"canceled_at,omitempty"`
+	CreatedAt  time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt  time.Time `bson:"updated_at" json:"-"`
+	Version    int32     `bson:"version" json:"-"`
+}
+
+// RegistrationFilter filters Registrations. Statuses matches any of the statuses.
+type RegistrationFilter struct {
+	ID        *string  `json:"id,omitempty"`
+	ProgramID *string  `json:"program_id,omitempty"`
+	PatronID  *string  `json:"patron_id,omitempty"`
+	Status    *string  `json:"status,omitempty"`
+	Statuses  []string `json:"statuses,omitempty"`
+	Version   *int32   `json:"-,omitempty"`
+}
+
+type RegistrationModel struct {
+	Client     *mongo.Client
+	Database   string
+	Collection string
+}
+
+// buildRegistrationFilter constructs a filter query for filtering registrations.
+func buildRegistrationFilter(filter RegistrationFilter) (bson.M, error) {
+	query := bson.M{}
+
+	if filter.ID != nil {
+		id, err := objectID(*filter.ID)
+		if err != nil {
+			return query, err
+		}
+		query[idTag] = id
+	}
+	if filter.ProgramID != nil {
+		query[programIDTag] = *filter.ProgramID
+	}
+	if filter.PatronID != nil {
+		query[patronIDTag] = *filter.PatronID
+	}
+	if filter.Status != nil {
+		query[statusTag] = *filter.Status
+	}
+	if len(filter.Statuses) > 0 {
+		query[statusTag] = bson.M{"$in": filter.Statuses}
+	}
+	if filter.Version != nil {
+		query[versionTag] = *filter.Version
+	}
+
+	return query, nil
+}
+
+// buildRegistrationUpdater constructs an update document for updating a Registration.
+func buildRegistrationUpdater(registration *Registration) bson.D {
+	updateFields := bson.D{
+		{Key: statusTag, Value: registration.Status},
+		{Key: promotedAtTag, Value: registration.PromotedAt},
+		{Key: canceledAtTag, Value: registration.CanceledAt},
+	}
+
+	updateFields = append(updateFields, bson.E{Key: updatedAtTag, Value: time.Now()})
+
+	update := bson.D{
+		{Key: "$set", Value: updateFields},
+		{Key: "$inc", Value: bson.D{{Key: versionTag, Value: 1}}},
+	}
+
+	return update
+}
+
+// CreateIndexes creates an index on the programs of the registrations, by which their registered
+// and waitlisted patrons are found in order, and on the patrons of the registrations, by which
+// patrons list their registrations.
+func (r RegistrationModel) CreateIndexes() error {
+	coll := r.Client.Database(r.Database).Collection(r.Collection)
+	indexModels := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: programIDTag, Value: 1}, {Key: statusTag, Value: 1}, {Key: createdAtTag, Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: patronIDTag, Value: 1}, {Key: createdAtTag, Value: -1}},
+		},
+	}
+
+	_, err := coll.Indexes().CreateMany(context.TODO(), indexModels)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Insert inserts a new Registration into the database.
+func (r RegistrationModel) Insert(ctx context.Context, registration *Registration) (string, error) {
+	coll := r.Client.Database(r.Database).Collection(r.Collection)
+
+	now := time.Now()
+	registration.CreatedAt = now
+	registration.UpdatedAt = now
+
+	res, err := coll.InsertOne(ctx, registration)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "_id_ dup key:"):
+			return "", ErrDuplicateID
+		default:
+			return "", err
+		}
+	}
+
+	return res.InsertedID.(primitive.ObjectID).Hex(), nil
+}
+
+// Get retrieves a single Registration from the database matching an optional filter.
+func (r RegistrationModel) Get(ctx context.Context, filter RegistrationFilter) (*Registration, error) {
+	coll := r.Client.Database(r.Database).Collection(r.Collection)
+
+	filterQuery, err := buildRegistrationFilter(filter)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	registration := &Registration{}
+
+	logQuery(ctx, r.Collection, "findOne", filterQuery)
+	err = coll.FindOne(ctx, filterQuery).Decode(registration)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrDocumentNotFound
+		}
+		return nil, err
+	}
+
+	return registration, nil
+}
+
+// GetAll retrieves a paginated list of Registrations from the database matching an optional filter and sorting.
+func (r RegistrationModel) GetAll(ctx context.Context, filter RegistrationFilter, paginator Paginator, sorter Sorter) ([]Registration, Metadata, error) {
+	coll := r.Client.Database(r.Database).Collection(r.Collection, listOptions(ctx))
+
+	registrations := make([]Registration, 0)
+	metadata := Metadata{}
+
+	filterQuery, err := buildRegistrationFilter(filter)
+	if err != nil {
+		return registrations, Metadata{}, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	sortQuery, err := buildSorter(sorter)
+	if err != nil {
+		return nil, Metadata{}, fmt.Errorf("%v: %v", errCreatingQuerySort, err)
+	}
+
+	findOpt := options.Find().SetSort(sortQuery).SetCollation(sorter.collation())
+
+	if paginator.valid() {
+		var totalRecords int64
+
+		findOpt = findOpt.SetLimit(paginator.limit()).SetSkip(paginator.offset())
+		totalRecords, err = coll.CountDocuments(ctx, filterQuery)
+		if err != nil {
+			return registrations, Metadata{}, errCreatingQueryFilter
+		}
+
+		metadata = calculateMetadata(totalRecords, paginator.Page, paginator.PageSize)
+	}
+
+	logQuery(ctx, r.Collection, "find", filterQuery)
+	cursor, err := coll.Find(ctx, filterQuery, findOpt)
+	if err != nil {
+		return registrations, Metadata{}, err
+	}
+	defer cursor.Close(ctx)
+
+	if err = cursor.All(ctx, &registrations); err != nil {
+		return registrations, Metadata{}, err
+	}
+
+	return registrations, metadata, nil
+}
+
+// Update updates a Registration in the database.
+func (r RegistrationModel) Update(ctx context.Context, filter RegistrationFilter, registration *Registration) error {
+	coll := r.Client.Database(r.Database).Collection(r.Collection)
+
+	update := buildRegistrationUpdater(registration)
+
+	filter.Version = &registration.Version
+	filterQuery, err := buildRegistrationFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	logQuery(ctx, r.Collection, "updateOne", filterQuery)
+	result, err := coll.UpdateOne(ctx, filterQuery, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
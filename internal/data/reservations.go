@@ -0,0 +1,247 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+	"time"
+)
+
+// Statuses of Reservations.
+const (
+	ReservationStatusConfirmed = "confirmed"
+	ReservationStatusCanceled  = "canceled"
+)
+
+// Reservation is a slot of time, from StartsAt up to EndsAt, for which a patron reserved a Resource.
+// Confirmed reservations of a Resource never overlap. A Reservation is canceled by its patron or by
+// an admin, who is recorded in CanceledBy with the Reason.
+type Reservation struct {
+	ID         string    `bson:"_id,omitempty" json:"id,omitempty"`
+	ResourceID string    `bson:"resource_id" json:"resource_id"`
+	PatronID   string    `bson:"patron_id" json:"patron_id"`
+	StartsAt   time.Time `bson:"starts_at" json:"starts_at"`
+	EndsAt     time.Time `bson:"ends_at" json:"ends_at"`
+	Purpose    string    `bson:"purpose,omitempty" json:"purpose,omitempty"`
+	Status     string    `bson:"status" json:"status"`
+	CanceledBy string    `bson:"canceled_by,omitempty" json:"canceled_by,omitempty"`
+	Reason     string    `bson:"reason,omitempty" json:"reason,omitempty"`
+	CanceledAt time.Time `bson:"canceled_at,omitempty" json:"canceled_at,omitempty"`
+	CreatedAt  time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt  time.Time `bson:"updated_at" json:"-"`
+	Version    int32     `bson:"version" json:"-"`
+}
+
+// ReservationFilter filters Reservations. StartsBefore and EndsAfter together match the
+// Reservations which overlap a period of time.
+type ReservationFilter struct {
+	ID           *string    `json:"id,omitempty"`
+	ResourceID   *string    `json:"resource_id,omitempty"`
+	PatronID     *string    `json:"patron_id,omitempty"`
+	Status       *string    `json:"status,omitempty"`
+	StartsBefore *time.Time `json:"starts_before,omitempty"`
+	EndsAfter    *time.Time `json:"ends_after,omitempty"`
+	Version      *int32     `json:"-,omitempty"`
+}
+
+type ReservationModel struct {
+	Client     *mongo.Client
+	Database   string
+	Collection string
+}
+
+// buildReservationFilter constructs a filter query for filtering reservations.
+func buildReservationFilter(filter ReservationFilter) (bson.M, error) {
+	query := bson.M{}
+
+	if filter.ID != nil {
+		id, err := objectID(*filter.ID)
+		if err != nil {
+			return query, err
+		}
+		query[idTag] = id
+	}
+	if filter.ResourceID != nil {
+		query[resourceIDTag] = *filter.ResourceID
+	}
+	if filter.PatronID != nil {
+		query[patronIDTag] = *filter.PatronID
+	}
+	if filter.Status != nil {
+		query[statusTag] = *filter.Status
+	}
+	if filter.StartsBefore != nil {
+		query[startsAtTag] = bson.M{"$lt": *filter.StartsBefore}
+	}
+	if filter.EndsAfter != nil {
+		query[endsAtTag] = bson.M{"$gt": *filter.EndsAfter}
+	}
+	if filter.Version != nil {
+		query[versionTag] = *filter.Version
+	}
+
+	return query, nil
+}
+
+// buildReservationUpdater constructs an update document for updating a Reservation.
+func buildReservationUpdater(reservation *Reservation) bson.D {
+	updateFields := bson.D{
+		{Key: startsAtTag, Value: reservation.StartsAt},
+		{Key: endsAtTag, Value: reservation.EndsAt},
+		{Key: purposeTag, Value: reservation.Purpose},
+		{Key: statusTag, Value: reservation.Status},
+		{Key: canceledByTag, Value: reservation.CanceledBy},
+		{Key: reasonTag, Value: reservation.Reason},
+		{Key: canceledAtTag, Value: reservation.CanceledAt},
+	}
+
+	updateFields = append(updateFields, bson.E{Key: updatedAtTag, Value: time.Now()})
+
+	update := bson.D{
+		{Key: "$set", Value: updateFields},
+		{Key: "$inc", Value: bson.D{{Key: versionTag, Value: 1}}},
+	}
+
+	return update
+}
+
+// CreateIndexes creates an index on the resources of the reservations, by which overlapping
+// reservations and the availability of resources are found, and on the patrons of the
+// reservations, by which patrons list their reservations.
+func (r ReservationModel) CreateIndexes() error {
+	coll := r.Client.Database(r.Database).Collection(r.Collection)
+	indexModels := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: resourceIDTag, Value: 1}, {Key: startsAtTag, Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: patronIDTag, Value: 1}, {Key: startsAtTag, Value: -1}},
+		},
+	}
+
+	_, err := coll.Indexes().CreateMany(context.TODO(), indexModels)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Insert inserts a new Reservation into the database.
+func (r ReservationModel) Insert(ctx context.Context, reservation *Reservation) (string, error) {
+	coll := r.Client.Database(r.Database).Collection(r.Collection)
+
+	now := time.Now()
+	reservation.CreatedAt = now
+	reservation.UpdatedAt = now
+
+	res, err := coll.InsertOne(ctx, reservation)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "_id_ dup key:"):
+			return "", ErrDuplicateID
+		default:
+			return "", err
+		}
+	}
+
+	return res.InsertedID.(primitive.ObjectID).Hex(), nil
+}
+
+// Get retrieves a single Reservation from the database matching an optional filter.
+func (r ReservationModel) Get(ctx context.Context, filter ReservationFilter) (*Reservation, error) {
+	coll := r.Client.Database(r.Database).Collection(r.Collection)
+
+	filterQuery, err := buildReservationFilter(filter)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	reservation := &Reservation{}
+
+	logQuery(ctx, r.Collection, "findOne", filterQuery)
+	err = coll.FindOne(ctx, filterQuery).Decode(reservation)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrDocumentNotFound
+		}
+		return nil, err
+	}
+
+	return reservation, nil
+}
+
+// GetAll retrieves a paginated list of Reservations from the database matching an optional filter and sorting.
+func (r ReservationModel) GetAll(ctx context.Context, filter ReservationFilter, paginator Paginator, sorter Sorter) ([]Reservation, Metadata, error) {
+	coll := r.Client.Database(r.Database).Collection(r.Collection, listOptions(ctx))
+
+	reservations := make([]Reservation, 0)
+	metadata := Metadata{}
+
+	filterQuery, err := buildReservationFilter(filter)
+	if err != nil {
+		return reservations, Metadata{}, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	sortQuery, err := buildSorter(sorter)
+	if err != nil {
+		return nil, Metadata{}, fmt.Errorf("%v: %v", errCreatingQuerySort, err)
+	}
+
+	findOpt := options.Find().SetSort(sortQuery).SetCollation(sorter.collation())
+
+	if paginator.valid() {
+		var totalRecords int64
+
+		findOpt = findOpt.SetLimit(paginator.limit()).SetSkip(paginator.offset())
+		totalRecords, err = coll.CountDocuments(ctx, filterQuery)
+		if err != nil {
+			return reservations, Metadata{}, errCreatingQueryFilter
+		}
+
+		metadata = calculateMetadata(totalRecords, paginator.Page, paginator.PageSize)
+	}
+
+	logQuery(ctx, r.Collection, "find", filterQuery)
+	cursor, err := coll.Find(ctx, filterQuery, findOpt)
+	if err != nil {
+		return reservations, Metadata{}, err
+	}
+	defer cursor.Close(ctx)
+
+	if err = cursor.All(ctx, &reservations); err != nil {
+		return reservations, Metadata{}, err
+	}
+
+	return reservations, metadata, nil
+}
+
+// Update updates a Reservation in the database.
+func (r ReservationModel) Update(ctx context.Context, filter ReservationFilter, reservation *Reservation) error {
+	coll := r.Client.Database(r.Database).Collection(r.Collection)
+
+	update := buildReservationUpdater(reservation)
+
+	filter.Version = &reservation.Version
+	filterQuery, err := buildReservationFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	logQuery(ctx, r.Collection, "updateOne", filterQuery)
+	result, err := coll.UpdateOne(ctx, filterQuery, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
@@ -0,0 +1,227 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+	"time"
+)
+
+// Kinds of Resources.
+const (
+	ResourceKindRoom      = "room"
+	ResourceKindEquipment = "equipment"
+)
+
+// Resource is a room or an item of equipment of a branch, such as a study room or a laptop, which
+// patrons reserve for slots of time. Capacity is the number of people a room seats. A Resource
+// which is not Active can't be reserved, but its reservations are kept.
+type Resource struct {
+	ID          string    `bson:"_id,omitempty" json:"id,omitempty"`
+	Name        string    `bson:"name" json:"name"`
+	Kind        string    `bson:"kind" json:"kind"`
+	Branch      string    `bson:"branch,omitempty" json:"branch,omitempty"`
+	Description string    `bson:"description,omitempty" json:"description,omitempty"`
+	Capacity    int       `bson:"capacity,omitempty" json:"capacity,omitempty"`
+	Active      bool      `bson:"active" json:"active"`
+	CreatedAt   time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt   time.Time `bson:"updated_at" json:"-"`
+	Version     int32     `bson:"version" json:"-"`
+}
+
+type ResourceFilter struct {
+	ID      *string `json:"id,omitempty"`
+	Kind    *string `json:"kind,omitempty"`
+	Branch  *string `json:"branch,omitempty"`
+	Active  *bool   `json:"active,omitempty"`
+	Version *int32  `json:"-,omitempty"`
+}
+
+type ResourceModel struct {
+	Client     *mongo.Client
+	Database   string
+	Collection string
+}
+
+// buildResourceFilter constructs a filter query for filtering resources.
+func buildResourceFilter(filter ResourceFilter) (bson.M, error) {
+	query := bson.M{}
+
+	if filter.ID != nil {
+		id, err := objectID(*filter.ID)
+		if err != nil {
+			return query, err
+		}
+		query[idTag] = id
+	}
+	if filter.Kind != nil {
+		query[kindTag] = *filter.Kind
+	}
+	if filter.Branch != nil {
+		query[branchTag] = *filter.Branch
+	}
+	if filter.Active != nil {
+		query[activeTag] = *filter.Active
+	}
+	if filter.Version != nil {
+		query[versionTag] = *filter.Version
+	}
+
+	return query, nil
+}
+
+// buildResourceUpdater constructs an update document for updating a Resource.
+func buildResourceUpdater(resource *Resource) bson.D {
+	updateFields := bson.D{
+		{Key: nameTag, Value: resource.Name},
+		{Key: kindTag, Value: resource.Kind},
+		{Key: branchTag, Value: resource.Branch},
+		{Key: descriptionTag, Value: resource.Description},
+		{Key: capacityTag, Value: resource.Capacity},
+		{Key: activeTag, Value: resource.Active},
+	}
+
+	updateFields = append(updateFields, bson.E{Key: updatedAtTag, Value: time.Now()})
+
+	update := bson.D{
+		{Key: "$set", Value: updateFields},
+		{Key: "$inc", Value: bson.D{{Key: versionTag, Value: 1}}},
+	}
+
+	return update
+}
+
+// CreateIndexes creates an index on the branches and kinds of the resources, by which patrons
+// browse them.
+func (r ResourceModel) CreateIndexes() error {
+	coll := r.Client.Database(r.Database).Collection(r.Collection)
+	indexModel := mongo.IndexModel{
+		Keys: bson.D{{Key: branchTag, Value: 1}, {Key: kindTag, Value: 1}},
+	}
+
+	_, err := coll.Indexes().CreateOne(context.TODO(), indexModel)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Insert inserts a new Resource into the database.
+func (r ResourceModel) Insert(ctx context.Context, resource *Resource) (string, error) {
+	coll := r.Client.Database(r.Database).Collection(r.Collection)
+
+	now := time.Now()
+	resource.CreatedAt = now
+	resource.UpdatedAt = now
+
+	res, err := coll.InsertOne(ctx, resource)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "_id_ dup key:"):
+			return "", ErrDuplicateID
+		default:
+			return "", err
+		}
+	}
+
+	return res.InsertedID.(primitive.ObjectID).Hex(), nil
+}
+
+// Get retrieves a single Resource from the database matching an optional filter.
+func (r ResourceModel) Get(ctx context.Context, filter ResourceFilter) (*Resource, error) {
+	coll := r.Client.Database(r.Database).Collection(r.Collection)
+
+	filterQuery, err := buildResourceFilter(filter)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	resource := &Resource{}
+
+	logQuery(ctx, r.Collection, "findOne", filterQuery)
+	err = coll.FindOne(ctx, filterQuery).Decode(resource)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrDocumentNotFound
+		}
+		return nil, err
+	}
+
+	return resource, nil
+}
+
+// GetAll retrieves a paginated list of Resources from the database matching an optional filter and sorting.
+func (r ResourceModel) GetAll(ctx context.Context, filter ResourceFilter, paginator Paginator, sorter Sorter) ([]Resource, Metadata, error) {
+	coll := r.Client.Database(r.Database).Collection(r.Collection, listOptions(ctx))
+
+	resources := make([]Resource, 0)
+	metadata := Metadata{}
+
+	filterQuery, err := buildResourceFilter(filter)
+	if err != nil {
+		return resources, Metadata{}, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	sortQuery, err := buildSorter(sorter)
+	if err != nil {
+		return nil, Metadata{}, fmt.Errorf("%v: %v", errCreatingQuerySort, err)
+	}
+
+	findOpt := options.Find().SetSort(sortQuery).SetCollation(sorter.collation())
+
+	if paginator.valid() {
+		var totalRecords int64
+
+		findOpt = findOpt.SetLimit(paginator.limit()).SetSkip(paginator.offset())
+		totalRecords, err = coll.CountDocuments(ctx, filterQuery)
+		if err != nil {
+			return resources, Metadata{}, errCreatingQueryFilter
+		}
+
+		metadata = calculateMetadata(totalRecords, paginator.Page, paginator.PageSize)
+	}
+
+	logQuery(ctx, r.Collection, "find", filterQuery)
+	cursor, err := coll.Find(ctx, filterQuery, findOpt)
+	if err != nil {
+		return resources, Metadata{}, err
+	}
+	defer cursor.Close(ctx)
+
+	if err = cursor.All(ctx, &resources); err != nil {
+		return resources, Metadata{}, err
+	}
+
+	return resources, metadata, nil
+}
+
+// Update updates a Resource in the database.
+func (r ResourceModel) Update(ctx context.Context, filter ResourceFilter, resource *Resource) error {
+	coll := r.Client.Database(r.Database).Collection(r.Collection)
+
+	update := buildResourceUpdater(resource)
+
+	filter.Version = &resource.Version
+	filterQuery, err := buildResourceFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	logQuery(ctx, r.Collection, "updateOne", filterQuery)
+	result, err := coll.UpdateOne(ctx, filterQuery, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
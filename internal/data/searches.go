@@ -0,0 +1,273 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+	"time"
+)
+
+// Targets of SavedSearches, which are the searches they run.
+const (
+	SavedSearchTargetBooks        = "books"
+	SavedSearchTargetPatrons      = "patrons"
+	SavedSearchTargetTransactions = "transactions"
+)
+
+// Schedules of SavedSearches, by which their results are emailed.
+const (
+	SavedSearchScheduleDaily  = "daily"
+	SavedSearchScheduleWeekly = "weekly"
+)
+
+// SavedSearch is a named search of books, patrons or transactions which librarians re-run, such
+// as the overdue loans of a class. Query holds the query parameters of the search, as they are
+// sent to it, so that relative times such as -7d are relative to when it runs. A search with a
+// Schedule is run at NextRunAt and its results are emailed to its Recipients.
+type SavedSearch struct {
+	ID         string    `bson:"_id,omitempty" json:"id,omitempty"`
+	Name       string    `bson:"name" json:"name"`
+	Target     string    `bson:"target" json:"target"`
+	Query      string    `bson:"query" json:"query"`
+	Schedule   string    `bson:"schedule,omitempty" json:"schedule,omitempty"`
+	Recipients []string  `bson:"recipients,omitempty" json:"recipients,omitempty"`
+	NextRunAt  time.Time `bson:"next_run_at,omitempty" json:"next_run_at,omitempty"`
+	LastRunAt  time.Time `bson:"last_run_at,omitempty" json:"last_run_at,omitempty"`
+	CreatedBy  string    `bson:"created_by" json:"created_by"`
+	CreatedAt  time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt  time.Time `bson:"updated_at" json:"-"`
+	Version    int32     `bson:"version" json:"-"`
+}
+
+// SavedSearchFilter filters SavedSearches. MaxNextRunAt matches the scheduled searches which are
+// due to run by then.
+type SavedSearchFilter struct {
+	ID           *string    `json:"id,omitempty"`
+	Target       *string    `json:"target,omitempty"`
+	MaxNextRunAt *time.Time `json:"max_next_run_at,omitempty"`
+	Version      *int32     `json:"-,omitempty"`
+}
+
+type SavedSearchModel struct {
+	Client     *mongo.Client
+	Database   string
+	Collection string
+}
+
+// buildSavedSearchFilter constructs a filter query for filtering saved searches.
+func buildSavedSearchFilter(filter SavedSearchFilter) (bson.M, error) {
+	query := bson.M{}
+
+	if filter.ID != nil {
+		id, err := objectID(*filter.ID)
+		if err != nil {
+			return query, err
+		}
+		query[idTag] = id
+	}
+	if filter.Target != nil {
+		query[targetTag] = *filter.Target
+	}
+	if filter.MaxNextRunAt != nil {
+		query[nextRunAtTag] = bson.M{"$lte": *filter.MaxNextRunAt}
+	}
+	if filter.Version != nil {
+		query[versionTag] = *filter.Version
+	}
+
+	return query, nil
+}
+
+// buildSavedSearchUpdater constructs an update document for updating a SavedSearch. Its schedule,
+// recipients and next run are unset if it is not scheduled.
+func buildSavedSearchUpdater(search *SavedSearch) bson.D {
+	updateFields := bson.D{
+		{Key: nameTag, Value: search.Name},
+		{Key: targetTag, Value: search.Target},
+		{Key: queryTag, Value: search.Query},
+	}
+	if search.Schedule != "" {
+		updateFields = append(updateFields,
+			bson.E{Key: scheduleTag, Value: search.Schedule},
+			bson.E{Key: recipientsTag, Value: search.Recipients},
+			bson.E{Key: nextRunAtTag, Value: search.NextRunAt},
+		)
+	}
+	if !search.LastRunAt.IsZero() {
+		updateFields = append(updateFields, bson.E{Key: lastRunAtTag, Value: search.LastRunAt})
+	}
+
+	updateFields = append(updateFields, bson.E{Key: updatedAtTag, Value: time.Now()})
+
+	update := bson.D{
+		{Key: "$set", Value: updateFields},
+		{Key: "$inc", Value: bson.D{{Key: versionTag, Value: 1}}},
+	}
+	if search.Schedule == "" {
+		update = append(update, bson.E{Key: "$unset", Value: bson.D{
+			{Key: scheduleTag, Value: ""},
+			{Key: recipientsTag, Value: ""},
+			{Key: nextRunAtTag, Value: ""},
+		}})
+	}
+
+	return update
+}
+
+// CreateIndexes creates an index on the next runs of the saved searches, by which the scheduled
+// searches which are due are found.
+func (s SavedSearchModel) CreateIndexes() error {
+	coll := s.Client.Database(s.Database).Collection(s.Collection)
+	indexModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: nextRunAtTag, Value: 1}},
+		Options: options.Index().SetSparse(true),
+	}
+
+	_, err := coll.Indexes().CreateOne(context.TODO(), indexModel)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Insert inserts a new SavedSearch into the database.
+func (s SavedSearchModel) Insert(ctx context.Context, search *SavedSearch) (string, error) {
+	coll := s.Client.Database(s.Database).Collection(s.Collection)
+
+	now := time.Now()
+	search.CreatedAt = now
+	search.UpdatedAt = now
+
+	res, err := coll.InsertOne(ctx, search)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "_id_ dup key:"):
+			return "", ErrDuplicateID
+		default:
+			return "", err
+		}
+	}
+
+	return res.InsertedID.(primitive.ObjectID).Hex(), nil
+}
+
+// Get retrieves a single SavedSearch from the database matching an optional filter.
+func (s SavedSearchModel) Get(ctx context.Context, filter SavedSearchFilter) (*SavedSearch, error) {
+	coll := s.Client.Database(s.Database).Collection(s.Collection)
+
+	filterQuery, err := buildSavedSearchFilter(filter)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	search := &SavedSearch{}
+
+	logQuery(ctx, s.Collection, "findOne", filterQuery)
+	err = coll.FindOne(ctx, filterQuery).Decode(search)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrDocumentNotFound
+		}
+		return nil, err
+	}
+
+	return search, nil
+}
+
+// GetAll retrieves a paginated list of SavedSearches from the database matching an optional filter and sorting.
+func (s SavedSearchModel) GetAll(ctx context.Context, filter SavedSearchFilter, paginator Paginator, sorter Sorter) ([]SavedSearch, Metadata, error) {
+	coll := s.Client.Database(s.Database).Collection(s.Collection, listOptions(ctx))
+
+	searches := make([]SavedSearch, 0)
+	metadata := Metadata{}
+
+	filterQuery, err := buildSavedSearchFilter(filter)
+	if err != nil {
+		return searches, Metadata{}, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	sortQuery, err := buildSorter(sorter)
+	if err != nil {
+		return nil, Metadata{}, fmt.Errorf("%v: %v", errCreatingQuerySort, err)
+	}
+
+	findOpt := options.Find().SetSort(sortQuery).SetCollation(sorter.collation())
+
+	if paginator.valid() {
+		var totalRecords int64
+
+		findOpt = findOpt.SetLimit(paginator.limit()).SetSkip(paginator.offset())
+		totalRecords, err = coll.CountDocuments(ctx, filterQuery)
+		if err != nil {
+			return searches, Metadata{}, errCreatingQueryFilter
+		}
+
+		metadata = calculateMetadata(totalRecords, paginator.Page, paginator.PageSize)
+	}
+
+	logQuery(ctx, s.Collection, "find", filterQuery)
+	cursor, err := coll.Find(ctx, filterQuery, findOpt)
+	if err != nil {
+		return searches, Metadata{}, err
+	}
+	defer cursor.Close(ctx)
+
+	if err = cursor.All(ctx, &searches); err != nil {
+		return searches, Metadata{}, err
+	}
+
+	return searches, metadata, nil
+}
+
+// Update updates a SavedSearch in the database.
+func (s SavedSearchModel) Update(ctx context.Context, filter SavedSearchFilter, search *SavedSearch) error {
+	coll := s.Client.Database(s.Database).Collection(s.Collection)
+
+	update := buildSavedSearchUpdater(search)
+
+	filter.Version = &search.Version
+	filterQuery, err := buildSavedSearchFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	logQuery(ctx, s.Collection, "updateOne", filterQuery)
+	result, err := coll.UpdateOne(ctx, filterQuery, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+// Delete deletes a SavedSearch from the database.
+func (s SavedSearchModel) Delete(ctx context.Context, filter SavedSearchFilter) error {
+	coll := s.Client.Database(s.Database).Collection(s.Collection)
+
+	filterQuery, err := buildSavedSearchFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	logQuery(ctx, s.Collection, "deleteOne", filterQuery)
+	result, err := coll.DeleteOne(ctx, filterQuery)
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return ErrDocumentNotFound
+	}
+
+	return nil
+}
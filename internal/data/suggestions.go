@@ -0,0 +1,241 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+	"time"
+)
+
+// Statuses of Suggestions.
+const (
+	SuggestionStatusPending  = "pending"
+	SuggestionStatusAccepted = "accepted"
+	SuggestionStatusRejected = "rejected"
+	SuggestionStatusOrdered  = "ordered"
+)
+
+// Suggestion is a title which a patron suggested the library to acquire. It is pending until an
+// admin accepts or rejects it, with a Response to the patron, and is ordered once its copies
+// were ordered from a vendor.
+type Suggestion struct {
+	ID        string    `bson:"_id,omitempty" json:"id,omitempty"`
+	PatronID  string    `bson:"patron_id" json:"patron_id"`
+	Title     string    `bson:"title" json:"title"`
+	Authors   []string  `bson:"authors,omitempty" json:"authors,omitempty"`
+	ISBN      string    `bson:"isbn,omitempty" json:"isbn,omitempty"`
+	Note      string    `bson:"note,omitempty" json:"note,omitempty"`
+	Status    string    `bson:"status" json:"status"`
+	Response  string    `bson:"response,omitempty" json:"response,omitempty"`
+	DecidedBy string    `bson:"decided_by,omitempty" json:"decided_by,omitempty"`
+	DecidedAt time.Time `bson:"decided_at,omitempty" json:"decided_at,omitempty"`
+	OrderedAt time.Time `bson:"ordered_at,omitempty" json:"ordered_at,omitempty"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at" json:"-"`
+	Version   int32     `bson:"version" json:"-"`
+}
+
+type SuggestionFilter struct {
+	ID       *string `json:"id,omitempty"`
+	PatronID *string `json:"patron_id,omitempty"`
+	Status   *string `json:"status,omitempty"`
+	ISBN     *string `json:"isbn,omitempty"`
+	Version  *int32  `json:"-,omitempty"`
+}
+
+type SuggestionModel struct {
+	Client     *mongo.Client
+	Database   string
+	Collection string
+}
+
+// buildSuggestionFilter constructs a filter query for filtering suggestions.
+func buildSuggestionFilter(filter SuggestionFilter) (bson.M, error) {
+	query := bson.M{}
+
+	if filter.ID != nil {
+		id, err := objectID(*filter.ID)
+		if err != nil {
+			return query, err
+		}
+		query[idTag] = id
+	}
+	if filter.PatronID != nil {
+		query[patronIDTag] = *filter.PatronID
+	}
+	if filter.Status != nil {
+		query[statusTag] = *filter.Status
+	}
+	if filter.ISBN != nil {
+		query[isbnTag] = *filter.ISBN
+	}
+	if filter.Version != nil {
+		query[versionTag] = *filter.Version
+	}
+
+	return query, nil
+}
+
+// buildSuggestionUpdater constructs an update document for updating a Suggestion.
+func buildSuggestionUpdater(suggestion *Suggestion) bson.D {
+	updateFields := bson.D{
+		{Key: titleTag, Value: suggestion.Title},
+		{Key: authorsTag, Value: suggestion.Authors},
+		{Key: isbnTag, Value: suggestion.ISBN},
+		{Key: noteTag, Value: suggestion.Note},
+		{Key: statusTag, Value: suggestion.Status},
+		{Key: responseTag, Value: suggestion.Response},
+		{Key: decidedByTag, Value: suggestion.DecidedBy},
+		{Key: decidedAtTag, Value: suggestion.DecidedAt},
+		{Key: orderedAtTag, Value: suggestion.OrderedAt},
+	}
+
+	updateFields = append(updateFields, bson.E{Key: updatedAtTag, Value: time.Now()})
+
+	update := bson.D{
+		{Key: "$set", Value: updateFields},
+		{Key: "$inc", Value: bson.D{{Key: versionTag, Value: 1}}},
+	}
+
+	return update
+}
+
+// CreateIndexes creates an index on the patrons of the suggestions, by which patrons list their
+// suggestions, and on the statuses of the suggestions, by which admins triage them.
+func (s SuggestionModel) CreateIndexes() error {
+	coll := s.Client.Database(s.Database).Collection(s.Collection)
+	indexModels := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: patronIDTag, Value: 1}, {Key: createdAtTag, Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: statusTag, Value: 1}, {Key: createdAtTag, Value: -1}},
+		},
+	}
+
+	_, err := coll.Indexes().CreateMany(context.TODO(), indexModels)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Insert inserts a new Suggestion into the database.
+func (s SuggestionModel) Insert(ctx context.Context, suggestion *Suggestion) (string, error) {
+	coll := s.Client.Database(s.Database).Collection(s.Collection)
+
+	now := time.Now()
+	suggestion.CreatedAt = now
+	suggestion.UpdatedAt = now
+
+	res, err := coll.InsertOne(ctx, suggestion)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "_id_ dup key:"):
+			return "", ErrDuplicateID
+		default:
+			return "", err
+		}
+	}
+
+	return res.InsertedID.(primitive.ObjectID).Hex(), nil
+}
+
+// Get retrieves a single Suggestion from the database matching an optional filter.
+func (s SuggestionModel) Get(ctx context.Context, filter SuggestionFilter) (*Suggestion, error) {
+	coll := s.Client.Database(s.Database).Collection(s.Collection)
+
+	filterQuery, err := buildSuggestionFilter(filter)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	suggestion := &Suggestion{}
+
+	logQuery(ctx, s.Collection, "findOne", filterQuery)
+	err = coll.FindOne(ctx, filterQuery).Decode(suggestion)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrDocumentNotFound
+		}
+		return nil, err
+	}
+
+	return suggestion, nil
+}
+
+// GetAll retrieves a paginated list of Suggestions from the database matching an optional filter and sorting.
+func (s SuggestionModel) GetAll(ctx context.Context, filter SuggestionFilter, paginator Paginator, sorter Sorter) ([]Suggestion, Metadata, error) {
+	coll := s.Client.Database(s.Database).Collection(s.Collection, listOptions(ctx))
+
+	suggestions := make([]Suggestion, 0)
+	metadata := Metadata{}
+
+	filterQuery, err := buildSuggestionFilter(filter)
+	if err != nil {
+		return suggestions, Metadata{}, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	sortQuery, err := buildSorter(sorter)
+	if err != nil {
+		return nil, Metadata{}, fmt.Errorf("%v: %v", errCreatingQuerySort, err)
+	}
+
+	findOpt := options.Find().SetSort(sortQuery).SetCollation(sorter.collation())
+
+	if paginator.valid() {
+		var totalRecords int64
+
+		findOpt = findOpt.SetLimit(paginator.limit()).SetSkip(paginator.offset())
+		totalRecords, err = coll.CountDocuments(ctx, filterQuery)
+		if err != nil {
+			return suggestions, Metadata{}, errCreatingQueryFilter
+		}
+
+		metadata = calculateMetadata(totalRecords, paginator.Page, paginator.PageSize)
+	}
+
+	logQuery(ctx, s.Collection, "find", filterQuery)
+	cursor, err := coll.Find(ctx, filterQuery, findOpt)
+	if err != nil {
+		return suggestions, Metadata{}, err
+	}
+	defer cursor.Close(ctx)
+
+	if err = cursor.All(ctx, &suggestions); err != nil {
+		return suggestions, Metadata{}, err
+	}
+
+	return suggestions, metadata, nil
+}
+
+// Update updates a Suggestion in the database.
+func (s SuggestionModel) Update(ctx context.Context, filter SuggestionFilter, suggestion *Suggestion) error {
+	coll := s.Client.Database(s.Database).Collection(s.Collection)
+
+	update := buildSuggestionUpdater(suggestion)
+
+	filter.Version = &suggestion.Version
+	filterQuery, err := buildSuggestionFilter(filter)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	logQuery(ctx, s.Collection, "updateOne", filterQuery)
+	result, err := coll.UpdateOne(ctx, filterQuery, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
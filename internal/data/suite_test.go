@@ -15,10 +15,18 @@ func TestSuiteLibrary(t *testing.T) {
 type TestSuite struct {
 	suite.Suite
 	mdbContainer *testhelpers.MongoDBContainer
-	models       *Models
+	models       *testModels
 	ctx          context.Context
 }
 
+// testModels holds the MongoDB models under test.
+type testModels struct {
+	Books        BookModel
+	Patrons      PatronModel
+	Transactions TransactionModel
+	Admins       AdminModel
+}
+
 // SetupSuite sets up the testing suite.
 func (ts *TestSuite) SetupSuite() {
 	ts.ctx = context.Background()
@@ -35,10 +43,11 @@ func (ts *TestSuite) SetupSuite() {
 		log.Fatal(err)
 	}
 
-	ts.models = &Models{
+	ts.models = &testModels{
 		Books:        BookModel{Client: client, Database: "test-library", Collection: BooksCollectionKey},
 		Patrons:      PatronModel{Client: client, Database: "test-library", Collection: PatronsCollectionKey},
 		Transactions: TransactionModel{Client: client, Database: "test-library", Collection: TransactionsCollectionKey},
+		Admins:       AdminModel{Client: client, Database: "test-library", Collection: AdminsCollectionKey},
 	}
 
 	if err = ts.populateBooksInDB(); err != nil {
@@ -60,8 +69,3 @@ func (ts *TestSuite) TearDownSuite() {
 		log.Fatalf("error terminating mongodb container: %s", err)
 	}
 }
-
-// ptr is a generic helper function for creating a pointer to any type.
-func ptr[T any](v T) *T {
-	return &v
-}
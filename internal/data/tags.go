@@ -28,11 +28,133 @@ const (
 	emailTag       = "email"
 	categoryTag    = "category"
 	passwordTag    = "password"
+	pinTag         = "pin"
 	activatedTag   = "activated"
 	permissionsTag = "permissions"
+	emailDigestTag = "email_digest"
+	nameDigestTag  = "name_digest"
+	phoneTag       = "phone"
+	localeTag      = "locale"
+
+	notificationChannelTag = "notification_channel"
+
+	discountPercentageTag = "discount_percentage"
+	loanPolicyTag         = "loan_policy"
 
 	hashTag      = "hash"
 	plaintextTag = "plaintext"
 	expiryTag    = "expiry"
 	scopeTag     = "scope"
+
+	channelTag   = "channel"
+	templateTag  = "template"
+	attemptsTag  = "attempts"
+	failuresTag  = "failures"
+	lastErrorTag = "last_error"
+	sentAtTag    = "sent_at"
+
+	typeTag          = "type"
+	deliveredTag     = "delivered"
+	nextAttemptAtTag = "next_attempt_at"
+	dispatchedAtTag  = "dispatched_at"
+
+	availableCopiesTag = "available_copies"
+	activeLoansTag     = "active_loans"
+
+	branchTag    = "branch"
+	kioskIDTag   = "kiosk_id"
+	requestIDTag = "request_id"
+
+	actionTag   = "action"
+	actorTag    = "actor"
+	targetIDTag = "target_id"
+
+	fineWaivedTag   = "fine_waived"
+	adjustedFineTag = "adjusted_fine"
+	finePaymentTag  = "fine_payment"
+	anonymizedTag   = "anonymized"
+
+	sessionIDTag  = "session_id"
+	referenceTag  = "reference"
+	expiresAtTag  = "expires_at"
+	paidAtTag     = "paid_at"
+	methodTag     = "method"
+	acceptedByTag = "accepted_by"
+
+	sourceTag      = "source"
+	vendorTag      = "vendor"
+	costTag        = "cost"
+	receivedAtTag  = "received_at"
+	noteTag        = "note"
+	catalogedAtTag = "cataloged_at"
+
+	withdrawnCopiesTag = "withdrawn_copies"
+	reasonTag          = "reason"
+	withdrawnAtTag     = "withdrawn_at"
+
+	closedAtTag = "closed_at"
+	reportTag   = "report"
+
+	identifiersTag     = "identifiers"
+	identifierValueTag = "identifiers.value"
+
+	languageTag = "language"
+	formatTag   = "format"
+	digitalTag  = "digital"
+
+	fileTag  = "file"
+	photoTag = "photo"
+
+	passwordChangedAtTag = "password_changed_at"
+
+	externalIDsTag = "external_ids"
+	suspendedTag   = "suspended"
+
+	publisherIDsTag    = "publisher_ids"
+	aliasesTag         = "aliases"
+	normalizedNamesTag = "normalized_names"
+
+	responseTag  = "response"
+	decidedByTag = "decided_by"
+	decidedAtTag = "decided_at"
+	orderedAtTag = "ordered_at"
+
+	kindTag        = "kind"
+	descriptionTag = "description"
+	capacityTag    = "capacity"
+	activeTag      = "active"
+
+	resourceIDTag = "resource_id"
+	startsAtTag   = "starts_at"
+	endsAtTag     = "ends_at"
+	purposeTag    = "purpose"
+	canceledByTag = "canceled_by"
+	canceledAtTag = "canceled_at"
+
+	locationTag   = "location"
+	registeredTag = "registered"
+	waitlistedTag = "waitlisted"
+	remindedAtTag = "reminded_at"
+	programIDTag  = "program_id"
+	promotedAtTag = "promoted_at"
+
+	targetTag     = "target"
+	queryTag      = "query"
+	scheduleTag   = "schedule"
+	recipientsTag = "recipients"
+	nextRunAtTag  = "next_run_at"
+	lastRunAtTag  = "last_run_at"
+
+	messageTag  = "message"
+	severityTag = "severity"
+	audienceTag = "audience"
+
+	holdingsTag      = "holdings"
+	callNumberTag    = "holdings.call_number"
+	shelfLocationTag = "holdings.shelf_location"
+
+	circulationTag        = "circulation"
+	circulationBorrowsTag = "circulation.borrows"
+
+	dateTag = "date"
 )
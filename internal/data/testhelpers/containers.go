@@ -7,6 +7,7 @@ import (
 	"github.com/testcontainers/testcontainers-go/wait"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"testing"
 )
 
 type MongoDBContainer struct {
@@ -55,3 +56,29 @@ func (m MongoDBContainer) Client(ctx context.Context) (*mongo.Client, error) {
 
 	return client, nil
 }
+
+// DockerAvailable checks if Docker is available to run containers.
+func DockerAvailable() (available bool) {
+	// testcontainers panics instead of failing if it can't find a Docker host.
+	defer func() {
+		if r := recover(); r != nil {
+			available = false
+		}
+	}()
+
+	provider, err := testcontainers.ProviderDocker.GetProvider()
+	if err != nil {
+		return false
+	}
+
+	return provider.Health(context.Background()) == nil
+}
+
+// SkipIfNoDocker skips a test or benchmark if Docker is not available to run containers.
+func SkipIfNoDocker(tb testing.TB) {
+	tb.Helper()
+
+	if !DockerAvailable() {
+		tb.Skip("docker is not available")
+	}
+}
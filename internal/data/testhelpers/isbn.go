@@ -2,6 +2,7 @@ package testhelpers
 
 import (
 	"fmt"
+	"github.com/mzeevi/library/internal/isbn"
 	"math/rand"
 	"time"
 )
@@ -39,15 +40,7 @@ func splitDigits(num int) []int {
 
 // calculateCheckDigit computes the ISBN-13 check digit.
 func calculateCheckDigit(digits []int) int {
-	sum := 0
-	for i, digit := range digits {
-		if i%2 == 0 {
-			sum += digit
-		} else {
-			sum += digit * 3
-		}
-	}
-	return (10 - (sum % 10)) % 10
+	return isbn.CheckDigit13(digits)
 }
 
 // digitsToString converts a slice of integers to a string.
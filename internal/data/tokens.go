@@ -120,7 +120,7 @@ func (t TokenModel) GetPatronID(ctx context.Context, filter TokenFilter) (string
 
 	filterQuery, err := buildTokenFilter(filter)
 	if err != nil {
-		return "", fmt.Errorf("%v: %v", errCreatingQueryFilter, err)
+		return "", fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
 	}
 
 	token := &Token{}
@@ -142,7 +142,7 @@ func (t TokenModel) DeleteAllForPatron(ctx context.Context, filter TokenFilter)
 
 	filterQuery, err := buildTokenFilter(filter)
 	if err != nil {
-		return fmt.Errorf("%v: %v", errCreatingQueryFilter, err)
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
 	}
 
 	result, err := coll.DeleteMany(ctx, filterQuery)
@@ -20,43 +20,72 @@ var (
 const (
 	TransactionStatusBorrowed = "borrowed"
 	TransactionStatusReturned = "returned"
+	TransactionStatusCanceled = "canceled"
 )
 
+// Transaction is a loan of Copies of a Book to a Patron. A Digital Transaction lends a license seat
+// of an e-book, which is returned automatically at its DueDate instead of at the desk. An
+// Anonymized Transaction was unlinked from its Patron by the retention policy, and has no PatronID.
+// FineDiscount is the discount percentage of the category of the Patron when the Book was borrowed,
+// which is taken off its fine.
 type Transaction struct {
-	ID         string    `bson:"_id,omitempty" json:"id,omitempty"`
-	PatronID   string    `bson:"patron_id" json:"patron_id"`
-	BookID     string    `bson:"book_id" json:"book_id"`
-	Status     string    `bson:"status" json:"status"`
-	BorrowedAt time.Time `bson:"borrowed_at" json:"borrowed_at"`
-	DueDate    time.Time `bson:"due_date" json:"due_date"`
-	ReturnedAt time.Time `bson:"returned_at,omitempty" json:"returned_at,omitempty"`
-	CreatedAt  time.Time `bson:"created_at" json:"-"`
-	UpdatedAt  time.Time `bson:"updated_at" json:"-"`
-	Version    int32     `bson:"version" json:"-"`
+	ID           string       `bson:"_id,omitempty" json:"id,omitempty"`
+	PatronID     string       `bson:"patron_id" json:"patron_id"`
+	BookID       string       `bson:"book_id" json:"book_id"`
+	Status       string       `bson:"status" json:"status"`
+	BorrowedAt   time.Time    `bson:"borrowed_at" json:"borrowed_at"`
+	DueDate      time.Time    `bson:"due_date" json:"due_date"`
+	ReturnedAt   time.Time    `bson:"returned_at,omitempty" json:"returned_at,omitempty"`
+	Branch       string       `bson:"branch,omitempty" json:"branch,omitempty"`
+	Copies       int          `bson:"copies,omitempty" json:"copies,omitempty"`
+	Digital      bool         `bson:"digital,omitempty" json:"digital,omitempty"`
+	Anonymized   bool         `bson:"anonymized,omitempty" json:"anonymized,omitempty"`
+	FineWaived   bool         `bson:"fine_waived,omitempty" json:"fine_waived,omitempty"`
+	AdjustedFine *float64     `bson:"adjusted_fine,omitempty" json:"adjusted_fine,omitempty"`
+	FinePayment  *FinePayment `bson:"fine_payment,omitempty" json:"fine_payment,omitempty"`
+	FineDiscount float64      `bson:"fine_discount,omitempty" json:"fine_discount,omitempty"`
+	CreatedAt    time.Time    `bson:"created_at" json:"-"`
+	UpdatedAt    time.Time    `bson:"updated_at" json:"-"`
+	Version      int32        `bson:"version" json:"-"`
 }
 
 type TransactionFilter struct {
-	ID            *string    `json:"id,omitempty"`
-	PatronID      *string    `json:"patron_id,omitempty"`
-	BookID        *string    `json:"book_id,omitempty"`
-	Status        *string    `json:"status,omitempty"`
-	MinBorrowedAt *time.Time `json:"min_borrowed_at,omitempty"`
-	MaxBorrowedAt *time.Time `json:"max_borrowed_at,omitempty"`
-	MinDueDate    *time.Time `json:"min_due_date,omitempty"`
-	MaxDueDate    *time.Time `json:"max_due_date,omitempty"`
-	MinReturnedAt *time.Time `json:"min_returned_at,omitempty"`
-	MaxReturnedAt *time.Time `json:"max_returned_at,omitempty"`
-	MinCreatedAt  *time.Time `json:"min_created_at,omitempty"`
-	MaxCreatedAt  *time.Time `json:"max_created_at,omitempty"`
-	MinUpdatedAt  *time.Time `json:"min_updated_at,omitempty"`
-	MaxUpdatedAt  *time.Time `json:"max_updated_at,omitempty"`
-	Version       *int32     `json:"-,omitempty"`
+	ID            *TransactionID  `json:"id,omitempty"`
+	IDs           []TransactionID `json:"ids,omitempty"`
+	PatronID      *PatronID       `json:"patron_id,omitempty"`
+	PatronIDs     []PatronID      `json:"patron_ids,omitempty"`
+	BookID        *BookID         `json:"book_id,omitempty"`
+	BookIDs       []BookID        `json:"book_ids,omitempty"`
+	Status        *string         `json:"status,omitempty"`
+	NotStatus     []string        `json:"not_status,omitempty"`
+	MinBorrowedAt *time.Time      `json:"min_borrowed_at,omitempty"`
+	MaxBorrowedAt *time.Time      `json:"max_borrowed_at,omitempty"`
+	MinDueDate    *time.Time      `json:"min_due_date,omitempty"`
+	MaxDueDate    *time.Time      `json:"max_due_date,omitempty"`
+	MinReturnedAt *time.Time      `json:"min_returned_at,omitempty"`
+	MaxReturnedAt *time.Time      `json:"max_returned_at,omitempty"`
+	MinCreatedAt  *time.Time      `json:"min_created_at,omitempty"`
+	MaxCreatedAt  *time.Time      `json:"max_created_at,omitempty"`
+	MinUpdatedAt  *time.Time      `json:"min_updated_at,omitempty"`
+	MaxUpdatedAt  *time.Time      `json:"max_updated_at,omitempty"`
+	Version       *int32          `json:"-,omitempty"`
+	Digital       *bool           `json:"digital,omitempty"`
+	Anonymized    *bool           `json:"anonymized,omitempty"`
+	FinePaid      *bool           `json:"fine_paid,omitempty"`
+	// Overdue matches borrowed transactions which are due before now if true,
+	// and all other transactions if false.
+	Overdue *bool `json:"overdue,omitempty"`
+	// OutstandingAt matches the loans which were outstanding at the time: borrowed by then, and
+	// still borrowed or returned after it. Canceled transactions are not matched.
+	OutstandingAt *time.Time `json:"outstanding_at,omitempty"`
 }
 
 type TransactionModel struct {
 	Client     *mongo.Client
 	Database   string
 	Collection string
+	// BooksCollection is the collection of the books of the transactions, which PatronStats looks up.
+	BooksCollection string
 }
 
 // NewTransaction is a constructor for Transaction.
@@ -78,21 +107,25 @@ func NewTransaction(id, patronID, bookID, status string, borrowedAt, dueDate tim
 func buildTransactionFilter(filter TransactionFilter) (bson.M, error) {
 	query := bson.M{}
 
-	if filter.ID != nil {
-		id, err := primitive.ObjectIDFromHex(*filter.ID)
+	if filter.ID != nil || filter.IDs != nil {
+		id, err := idQuery(filter.ID, filter.IDs)
 		if err != nil {
 			return query, err
 		}
 		query[idTag] = id
 	}
-	if filter.PatronID != nil {
-		query[patronIDTag] = *filter.PatronID
+	if filter.PatronID != nil || filter.PatronIDs != nil {
+		query[patronIDTag] = refQuery(filter.PatronID, filter.PatronIDs)
 	}
-	if filter.BookID != nil {
-		query[bookIDTag] = *filter.BookID
+	if filter.BookID != nil || filter.BookIDs != nil {
+		query[bookIDTag] = refQuery(filter.BookID, filter.BookIDs)
 	}
-	if filter.Status != nil {
+	if filter.Status != nil && len(filter.NotStatus) > 0 {
+		query[statusTag] = membershipQuery([]string{*filter.Status}, filter.NotStatus)
+	} else if filter.Status != nil {
 		query[statusTag] = *filter.Status
+	} else if len(filter.NotStatus) > 0 {
+		query[statusTag] = membershipQuery(nil, filter.NotStatus)
 	}
 
 	if filter.MinReturnedAt != nil || filter.MaxReturnedAt != nil {
@@ -103,7 +136,7 @@ func buildTransactionFilter(filter TransactionFilter) (bson.M, error) {
 		if filter.MaxReturnedAt != nil {
 			returnedAtRange["$lte"] = *filter.MaxReturnedAt
 		}
-		query[borrowedAtTag] = returnedAtRange
+		query[returnedAtTag] = returnedAtRange
 	}
 
 	if filter.MinBorrowedAt != nil || filter.MaxBorrowedAt != nil {
@@ -154,6 +187,43 @@ func buildTransactionFilter(filter TransactionFilter) (bson.M, error) {
 		query[versionTag] = *filter.Version
 	}
 
+	if filter.Digital != nil {
+		if *filter.Digital {
+			query[digitalTag] = true
+		} else {
+			query[digitalTag] = bson.M{"$nin": bson.A{true}}
+		}
+	}
+
+	if filter.Anonymized != nil {
+		if *filter.Anonymized {
+			query[anonymizedTag] = true
+		} else {
+			query[anonymizedTag] = bson.M{"$nin": bson.A{true}}
+		}
+	}
+
+	if filter.FinePaid != nil {
+		query[finePaymentTag] = bson.M{"$exists": *filter.FinePaid}
+	}
+
+	if filter.Overdue != nil {
+		overdue := bson.M{statusTag: TransactionStatusBorrowed, dueDateTag: bson.M{"$lt": timeNow()}}
+		if *filter.Overdue {
+			query["$and"] = bson.A{overdue}
+		} else {
+			query["$nor"] = bson.A{overdue}
+		}
+	}
+
+	if filter.OutstandingAt != nil {
+		borrowedBy := bson.M{"$lte": *filter.OutstandingAt}
+		query["$or"] = bson.A{
+			bson.M{statusTag: TransactionStatusBorrowed, borrowedAtTag: borrowedBy},
+			bson.M{statusTag: TransactionStatusReturned, borrowedAtTag: borrowedBy, returnedAtTag: bson.M{"$gt": *filter.OutstandingAt}},
+		}
+	}
+
 	return query, nil
 }
 
@@ -163,6 +233,9 @@ func buildTransactionUpdater(transaction *Transaction) bson.D {
 		{Key: dueDateTag, Value: transaction.DueDate},
 		{Key: returnedAtTag, Value: transaction.ReturnedAt},
 		{Key: statusTag, Value: transaction.Status},
+		{Key: fineWaivedTag, Value: transaction.FineWaived},
+		{Key: adjustedFineTag, Value: transaction.AdjustedFine},
+		{Key: finePaymentTag, Value: transaction.FinePayment},
 	}
 
 	updateFields = append(updateFields, bson.E{Key: updatedAtTag, Value: time.Now()})
@@ -175,6 +248,15 @@ func buildTransactionUpdater(transaction *Transaction) bson.D {
 	return update
 }
 
+// buildTransactionAnonymizer constructs an update document which unlinks a Transaction from its
+// Patron.
+func buildTransactionAnonymizer() bson.D {
+	return bson.D{
+		{Key: "$set", Value: bson.D{{Key: patronIDTag, Value: ""}, {Key: anonymizedTag, Value: true}, {Key: updatedAtTag, Value: time.Now()}}},
+		{Key: "$inc", Value: bson.D{{Key: versionTag, Value: 1}}},
+	}
+}
+
 // Insert inserts a new Transaction into the database.
 func (t TransactionModel) Insert(ctx context.Context, transaction *Transaction) (string, error) {
 	coll := t.Client.Database(t.Database).Collection(t.Collection)
@@ -196,17 +278,38 @@ func (t TransactionModel) Insert(ctx context.Context, transaction *Transaction)
 	return res.InsertedID.(primitive.ObjectID).Hex(), nil
 }
 
+// InsertMany inserts multiple Transactions into the database, returning their IDs.
+func (t TransactionModel) InsertMany(ctx context.Context, transactions []*Transaction) ([]string, error) {
+	coll := t.Client.Database(t.Database).Collection(t.Collection)
+
+	now := time.Now()
+	documents := make([]interface{}, 0, len(transactions))
+	for _, transaction := range transactions {
+		transaction.CreatedAt = now
+		transaction.UpdatedAt = now
+		documents = append(documents, transaction)
+	}
+
+	res, err := coll.InsertMany(ctx, documents)
+	if err != nil {
+		return nil, err
+	}
+
+	return insertedIDs(res.InsertedIDs), nil
+}
+
 // Get retrieves a single Transaction from the database matching an optional filter.
 func (t TransactionModel) Get(ctx context.Context, filter TransactionFilter) (*Transaction, error) {
 	coll := t.Client.Database(t.Database).Collection(t.Collection)
 
 	filterQuery, err := buildTransactionFilter(filter)
 	if err != nil {
-		return nil, fmt.Errorf("%v: %v", errCreatingQueryFilter, err)
+		return nil, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
 	}
 
 	transaction := &Transaction{}
 
+	logQuery(ctx, t.Collection, "findOne", filterQuery)
 	if err = coll.FindOne(ctx, filterQuery).Decode(transaction); err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			return nil, ErrDocumentNotFound
@@ -219,14 +322,14 @@ func (t TransactionModel) Get(ctx context.Context, filter TransactionFilter) (*T
 
 // GetAll retrieves all Transactions from the database matching an optional filter and paginator.
 func (t TransactionModel) GetAll(ctx context.Context, filter TransactionFilter, paginator Paginator, sorter Sorter) ([]Transaction, Metadata, error) {
-	coll := t.Client.Database(t.Database).Collection(t.Collection)
+	coll := t.Client.Database(t.Database).Collection(t.Collection, listOptions(ctx))
 
 	transactions := make([]Transaction, 0)
 	metadata := Metadata{}
 
 	filterQuery, err := buildTransactionFilter(filter)
 	if err != nil {
-		return transactions, Metadata{}, fmt.Errorf("%v: %v", errCreatingQueryFilter, err)
+		return transactions, Metadata{}, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
 	}
 
 	sortQuery, err := buildSorter(sorter)
@@ -234,7 +337,7 @@ func (t TransactionModel) GetAll(ctx context.Context, filter TransactionFilter,
 		return nil, Metadata{}, fmt.Errorf("%v: %v", errCreatingQuerySort, err)
 	}
 
-	findOpt := options.Find().SetSort(sortQuery)
+	findOpt := options.Find().SetSort(sortQuery).SetCollation(sorter.collation())
 
 	if paginator.valid() {
 		var totalRecords int64
@@ -248,6 +351,7 @@ func (t TransactionModel) GetAll(ctx context.Context, filter TransactionFilter,
 		metadata = calculateMetadata(totalRecords, paginator.Page, paginator.PageSize)
 	}
 
+	logQuery(ctx, t.Collection, "find", filterQuery)
 	cursor, err := coll.Find(ctx, filterQuery, findOpt)
 	if err != nil {
 		return transactions, Metadata{}, err
@@ -270,7 +374,8 @@ func (t TransactionModel) GetAll(ctx context.Context, filter TransactionFilter,
 	return transactions, metadata, nil
 }
 
-// Update updates a Transaction's details in the database.
+// Update updates a Transaction's details in the database. ErrDocumentNotFound is returned if no Transaction
+// matches the filter, and ErrEditConflict if its version was changed by another update.
 func (t TransactionModel) Update(ctx context.Context, filter TransactionFilter, transaction *Transaction) error {
 	coll := t.Client.Database(t.Database).Collection(t.Collection)
 
@@ -279,16 +384,17 @@ func (t TransactionModel) Update(ctx context.Context, filter TransactionFilter,
 	filter.Version = &transaction.Version
 	filterQuery, err := buildTransactionFilter(filter)
 	if err != nil {
-		return fmt.Errorf("%v: %v", errCreatingQueryFilter, err)
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
 	}
 
+	logQuery(ctx, t.Collection, "updateOne", filterQuery)
 	result, err := coll.UpdateOne(ctx, filterQuery, update)
 	if err != nil {
 		return err
 	}
 
 	if result.MatchedCount == 0 {
-		return ErrEditConflict
+		return unmatchedUpdateError(ctx, coll, filterQuery)
 	}
 
 	return nil
@@ -300,9 +406,10 @@ func (t TransactionModel) Delete(ctx context.Context, filter TransactionFilter)
 
 	filterQuery, err := buildTransactionFilter(filter)
 	if err != nil {
-		return fmt.Errorf("%v: %v", errCreatingQueryFilter, err)
+		return fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
 	}
 
+	logQuery(ctx, t.Collection, "deleteOne", filterQuery)
 	result, err := coll.DeleteOne(ctx, filterQuery)
 	if err != nil {
 		return err
@@ -314,3 +421,60 @@ func (t TransactionModel) Delete(ctx context.Context, filter TransactionFilter)
 
 	return nil
 }
+
+// Anonymize unlinks the Transactions matching a filter from their Patrons, returning the number of
+// anonymized Transactions.
+func (t TransactionModel) Anonymize(ctx context.Context, filter TransactionFilter) (int64, error) {
+	coll := t.Client.Database(t.Database).Collection(t.Collection)
+
+	filterQuery, err := buildTransactionFilter(filter)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	logQuery(ctx, t.Collection, "updateMany", filterQuery)
+	result, err := coll.UpdateMany(ctx, filterQuery, buildTransactionAnonymizer())
+	if err != nil {
+		return 0, err
+	}
+
+	return result.ModifiedCount, nil
+}
+
+// DeleteMany deletes the Transactions matching a filter, returning the number of deleted
+// Transactions.
+func (t TransactionModel) DeleteMany(ctx context.Context, filter TransactionFilter) (int64, error) {
+	coll := t.Client.Database(t.Database).Collection(t.Collection)
+
+	filterQuery, err := buildTransactionFilter(filter)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", errCreatingQueryFilter, err)
+	}
+
+	logQuery(ctx, t.Collection, "deleteMany", filterQuery)
+	result, err := coll.DeleteMany(ctx, filterQuery)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
+
+// ReassignPatron moves all Transactions of one Patron to another, returning the number of moved Transactions.
+func (t TransactionModel) ReassignPatron(ctx context.Context, fromPatronID, toPatronID string) (int64, error) {
+	coll := t.Client.Database(t.Database).Collection(t.Collection)
+
+	filterQuery := bson.M{patronIDTag: fromPatronID}
+	update := bson.D{
+		{Key: "$set", Value: bson.D{{Key: patronIDTag, Value: toPatronID}, {Key: updatedAtTag, Value: time.Now()}}},
+		{Key: "$inc", Value: bson.D{{Key: versionTag, Value: 1}}},
+	}
+
+	logQuery(ctx, t.Collection, "updateMany", filterQuery)
+	result, err := coll.UpdateMany(ctx, filterQuery, update)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.ModifiedCount, nil
+}
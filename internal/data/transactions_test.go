@@ -91,7 +91,7 @@ func (ts *TestSuite) TestTransactionInsert() {
 				assert.ErrorIs(t, err, ErrDuplicateID)
 			} else {
 				assert.NoError(t, err)
-				err = ts.deleteTransactionsFromDB(TransactionFilter{ID: &id})
+				err = ts.deleteTransactionsFromDB(TransactionFilter{ID: ptr(TransactionID(id))})
 				assert.NoError(t, err)
 			}
 		})
@@ -109,26 +109,26 @@ func (ts *TestSuite) TestTransactionGet() {
 	}{
 		{
 			name:        "ValidTransactionByID",
-			filter:      TransactionFilter{ID: ptr(testTransactionsIDs[0].(primitive.ObjectID).Hex())},
+			filter:      TransactionFilter{ID: ptr(TransactionID(testTransactionsIDs[0].(primitive.ObjectID).Hex()))},
 			expectError: false,
 			expectedID:  testTransactionsIDs[0].(primitive.ObjectID).Hex(),
 		},
 		{
 			name:        "ValidTransactionByPatronID",
-			filter:      TransactionFilter{PatronID: ptr("1")},
+			filter:      TransactionFilter{PatronID: ptr(PatronID("1"))},
 			expectError: false,
 			expectedID:  testTransactionsIDs[0].(primitive.ObjectID).Hex(),
 		},
 		{
 			name:        "ValidTransactionByBookID",
-			filter:      TransactionFilter{BookID: ptr("B2")},
+			filter:      TransactionFilter{BookID: ptr(BookID("B2"))},
 			expectError: false,
 			expectedID:  testTransactionsIDs[1].(primitive.ObjectID).Hex(),
 		},
 		{
 			name: "TransactionNotFound",
 			filter: TransactionFilter{
-				ID: ptr("nonexistentID"),
+				ID: ptr(TransactionID("nonexistentID")),
 			},
 			expectError: true,
 			expectedID:  "",
@@ -166,7 +166,7 @@ func (ts *TestSuite) TestGetAllTransactions() {
 		{
 			name: "FilterByPatronID",
 			filter: TransactionFilter{
-				PatronID: ptr("1"),
+				PatronID: ptr(PatronID("1")),
 			},
 			paginator:     Paginator{Page: 1, PageSize: 5},
 			expectedIDs:   []string{testTransactionsIDs[0].(primitive.ObjectID).Hex()},
@@ -183,7 +183,7 @@ func (ts *TestSuite) TestGetAllTransactions() {
 		{
 			name: "FilterByBookID",
 			filter: TransactionFilter{
-				BookID: ptr("B2"),
+				BookID: ptr(BookID("B2")),
 			},
 			paginator:     Paginator{Page: 1, PageSize: 3},
 			expectedIDs:   []string{testTransactionsIDs[1].(primitive.ObjectID).Hex()},
@@ -312,7 +312,7 @@ func (ts *TestSuite) TestGetAllTransactions() {
 		{
 			name: "FilterByID",
 			filter: TransactionFilter{
-				ID: ptr(testTransactionsIDs[5].(primitive.ObjectID).Hex()),
+				ID: ptr(TransactionID(testTransactionsIDs[5].(primitive.ObjectID).Hex())),
 			},
 			paginator:     Paginator{Page: 1, PageSize: 5},
 			expectedIDs:   []string{testTransactionsIDs[5].(primitive.ObjectID).Hex()},
@@ -329,7 +329,7 @@ func (ts *TestSuite) TestGetAllTransactions() {
 		{
 			name: "FilterByMultipleParams",
 			filter: TransactionFilter{
-				PatronID:   ptr(testTransactionsIDs[1].(primitive.ObjectID).Hex()),
+				PatronID:   ptr(PatronID(testTransactionsIDs[1].(primitive.ObjectID).Hex())),
 				MinDueDate: ptr(time.Date(2023, time.March, 1, 0, 0, 0, 0, time.UTC)),
 				MaxDueDate: ptr(time.Date(2023, time.March, 31, 23, 59, 59, 0, time.UTC)),
 				Status:     ptr(TransactionStatusReturned),
@@ -373,6 +373,50 @@ func (ts *TestSuite) TestGetAllTransactions() {
 			},
 			expectError: false,
 		},
+		{
+			name: "FilterByOverdue",
+			filter: TransactionFilter{
+				Overdue:       ptr(true),
+				MinBorrowedAt: ptr(time.Date(2024, time.December, 5, 0, 0, 0, 0, time.UTC)),
+				MaxBorrowedAt: ptr(time.Date(2024, time.December, 9, 0, 0, 0, 0, time.UTC)),
+			},
+			paginator: Paginator{Page: 1, PageSize: 5},
+			expectedIDs: []string{
+				testTransactionsIDs[2].(primitive.ObjectID).Hex(),
+				testTransactionsIDs[4].(primitive.ObjectID).Hex(),
+			},
+			expectedCount: 2,
+			expectedMetadata: Metadata{
+				CurrentPage:  1,
+				PageSize:     5,
+				FirstPage:    1,
+				LastPage:     1,
+				TotalRecords: 2,
+			},
+			expectError: false,
+		},
+		{
+			name: "FilterByNotOverdue",
+			filter: TransactionFilter{
+				Overdue:       ptr(false),
+				MinBorrowedAt: ptr(time.Date(2024, time.December, 5, 0, 0, 0, 0, time.UTC)),
+				MaxBorrowedAt: ptr(time.Date(2024, time.December, 9, 0, 0, 0, 0, time.UTC)),
+			},
+			paginator: Paginator{Page: 1, PageSize: 5},
+			expectedIDs: []string{
+				testTransactionsIDs[3].(primitive.ObjectID).Hex(),
+				testTransactionsIDs[5].(primitive.ObjectID).Hex(),
+			},
+			expectedCount: 2,
+			expectedMetadata: Metadata{
+				CurrentPage:  1,
+				PageSize:     5,
+				FirstPage:    1,
+				LastPage:     1,
+				TotalRecords: 2,
+			},
+			expectError: false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -445,21 +489,21 @@ func (ts *TestSuite) TestUpdateTransaction() {
 	for _, tt := range tests {
 		ts.Run(tt.name, func() {
 			if tt.expectError {
-				err := ts.models.Transactions.Update(ts.ctx, TransactionFilter{ID: &tt.initialTransaction.ID}, &tt.updateData)
-				assert.ErrorIs(t, err, ErrEditConflict)
+				err := ts.models.Transactions.Update(ts.ctx, TransactionFilter{ID: ptr(TransactionID(tt.initialTransaction.ID))}, &tt.updateData)
+				assert.ErrorIs(t, err, ErrDocumentNotFound)
 			} else {
 				id, err := ts.models.Transactions.Insert(ts.ctx, &tt.initialTransaction)
 				assert.NoError(t, err)
 
-				err = ts.models.Transactions.Update(ts.ctx, TransactionFilter{ID: &id}, &tt.updateData)
+				err = ts.models.Transactions.Update(ts.ctx, TransactionFilter{ID: ptr(TransactionID(id))}, &tt.updateData)
 				assert.NoError(t, err)
 
-				updatedTransaction, err := ts.models.Transactions.Get(ts.ctx, TransactionFilter{ID: &id})
+				updatedTransaction, err := ts.models.Transactions.Get(ts.ctx, TransactionFilter{ID: ptr(TransactionID(id))})
 				assert.NoError(t, err)
 
 				assert.Equal(t, updatedTransaction.Version, int32(1))
 
-				err = ts.deleteTransactionsFromDB(TransactionFilter{ID: &id})
+				err = ts.deleteTransactionsFromDB(TransactionFilter{ID: ptr(TransactionID(id))})
 				assert.NoError(t, err)
 			}
 		})
@@ -494,15 +538,15 @@ func (ts *TestSuite) TestDeleteTransaction() {
 	for _, tt := range tests {
 		ts.Run(tt.name, func() {
 			if tt.expectError {
-				err := ts.models.Transactions.Delete(ts.ctx, TransactionFilter{ID: &tt.initialTransaction.ID})
+				err := ts.models.Transactions.Delete(ts.ctx, TransactionFilter{ID: ptr(TransactionID(tt.initialTransaction.ID))})
 				assert.ErrorIs(t, err, ErrDocumentNotFound)
 			} else {
 				id, err := ts.models.Transactions.Insert(ts.ctx, &tt.initialTransaction)
 				assert.NoError(t, err)
 
-				err = ts.models.Transactions.Delete(ts.ctx, TransactionFilter{ID: &id})
+				err = ts.models.Transactions.Delete(ts.ctx, TransactionFilter{ID: ptr(TransactionID(id))})
 				assert.NoError(t, err)
-				_, err = ts.models.Transactions.Get(ts.ctx, TransactionFilter{ID: &id})
+				_, err = ts.models.Transactions.Get(ts.ctx, TransactionFilter{ID: ptr(TransactionID(id))})
 				assert.ErrorIs(t, err, ErrDocumentNotFound)
 			}
 		})
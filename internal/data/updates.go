@@ -0,0 +1,49 @@
+package data
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"reflect"
+	"slices"
+	"time"
+)
+
+// buildUpdater constructs an update document which sets the fields and the time of the update,
+// and increments the version of the document.
+func buildUpdater(fields bson.D) bson.D {
+	fields = append(fields, bson.E{Key: updatedAtTag, Value: time.Now()})
+
+	return bson.D{
+		{Key: "$set", Value: fields},
+		{Key: "$inc", Value: bson.D{{Key: versionTag, Value: 1}}},
+	}
+}
+
+// changedFields returns the keys of the fields of updated whose values differ from those of
+// original, or which original doesn't have.
+func changedFields(original, updated bson.D) []string {
+	values := make(map[string]interface{}, len(original))
+	for _, field := range original {
+		values[field.Key] = field.Value
+	}
+
+	var keys []string
+	for _, field := range updated {
+		if value, ok := values[field.Key]; !ok || !reflect.DeepEqual(value, field.Value) {
+			keys = append(keys, field.Key)
+		}
+	}
+
+	return keys
+}
+
+// selectFields returns the fields with the keys.
+func selectFields(fields bson.D, keys []string) bson.D {
+	selected := bson.D{}
+	for _, field := range fields {
+		if slices.Contains(keys, field.Key) {
+			selected = append(selected, field)
+		}
+	}
+
+	return selected
+}
@@ -0,0 +1,29 @@
+package data
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"slices"
+	"testing"
+)
+
+func TestBuildPatronPatcher(t *testing.T) {
+	original := &Patron{Name: "Test", Email: "test@example.com", Category: "student"}
+	patron := *original
+	patron.Email = "other@example.com"
+	stored := patron
+	stored.Email, stored.EmailDigest, stored.NameDigest = "encrypted", "email-digest", "name-digest"
+
+	update := buildPatronPatcher(original, &patron, &stored)
+
+	var keys []string
+	for _, field := range update[0].Value.(bson.D) {
+		keys = append(keys, field.Key)
+		if field.Key == emailTag && field.Value != "encrypted" {
+			t.Errorf("buildPatronPatcher() sets %s to %v; want the stored value", emailTag, field.Value)
+		}
+	}
+
+	if want := []string{emailTag, emailDigestTag, updatedAtTag}; !slices.Equal(keys, want) {
+		t.Errorf("buildPatronPatcher() sets %v; want %v", keys, want)
+	}
+}
@@ -0,0 +1,147 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+	"time"
+)
+
+// Reasons of Withdrawals.
+const (
+	WithdrawalReasonDamaged  = "damaged"
+	WithdrawalReasonLost     = "lost"
+	WithdrawalReasonOutdated = "outdated"
+)
+
+// Withdrawal records copies of a Book which were retired from the stock, and why. The copies are
+// removed from the copies of the Book, which is kept, so that withdrawn stock stays in reports.
+// The ISBN and the Title of the Book are copied, so that the Withdrawal is readable on its own.
+type Withdrawal struct {
+	ID          string    `bson:"_id,omitempty" json:"id,omitempty"`
+	BookID      string    `bson:"book_id" json:"book_id"`
+	ISBN        string    `bson:"isbn" json:"isbn"`
+	Title       string    `bson:"title" json:"title"`
+	Copies      int       `bson:"copies" json:"copies"`
+	Reason      string    `bson:"reason" json:"reason"`
+	Note        string    `bson:"note,omitempty" json:"note,omitempty"`
+	WithdrawnBy string    `bson:"withdrawn_by" json:"withdrawn_by"`
+	WithdrawnAt time.Time `bson:"withdrawn_at" json:"withdrawn_at"`
+}
+
+type WithdrawalFilter struct {
+	BookID         *string    `json:"book_id,omitempty"`
+	Reason         *string    `json:"reason,omitempty"`
+	MinWithdrawnAt *time.Time `json:"min_withdrawn_at,omitempty"`
+	MaxWithdrawnAt *time.Time `json:"max_withdrawn_at,omitempty"`
+}
+
+type WithdrawalModel struct {
+	Client     *mongo.Client
+	Database   string
+	Collection string
+}
+
+// buildWithdrawalFilter constructs a filter query for filtering withdrawals.
+func buildWithdrawalFilter(filter WithdrawalFilter) bson.M {
+	query := bson.M{}
+
+	if filter.BookID != nil {
+		query[bookIDTag] = *filter.BookID
+	}
+	if filter.Reason != nil {
+		query[reasonTag] = *filter.Reason
+	}
+
+	withdrawnAtQuery := bson.M{}
+	if filter.MinWithdrawnAt != nil {
+		withdrawnAtQuery["$gte"] = *filter.MinWithdrawnAt
+	}
+	if filter.MaxWithdrawnAt != nil {
+		withdrawnAtQuery["$lte"] = *filter.MaxWithdrawnAt
+	}
+	if len(withdrawnAtQuery) > 0 {
+		query[withdrawnAtTag] = withdrawnAtQuery
+	}
+
+	return query
+}
+
+// CreateIndexes creates an index on the books of the withdrawals, by which the history of the
+// stock of a book is looked up.
+func (w WithdrawalModel) CreateIndexes() error {
+	coll := w.Client.Database(w.Database).Collection(w.Collection)
+	indexModel := mongo.IndexModel{
+		Keys: bson.D{{Key: bookIDTag, Value: 1}, {Key: withdrawnAtTag, Value: -1}},
+	}
+
+	_, err := coll.Indexes().CreateOne(context.TODO(), indexModel)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Insert inserts a new Withdrawal into the database.
+func (w WithdrawalModel) Insert(ctx context.Context, withdrawal *Withdrawal) (string, error) {
+	coll := w.Client.Database(w.Database).Collection(w.Collection)
+
+	res, err := coll.InsertOne(ctx, withdrawal)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "_id_ dup key:"):
+			return "", ErrDuplicateID
+		default:
+			return "", err
+		}
+	}
+
+	return res.InsertedID.(primitive.ObjectID).Hex(), nil
+}
+
+// GetAll retrieves a paginated list of Withdrawals from the database matching an optional filter and sorting.
+func (w WithdrawalModel) GetAll(ctx context.Context, filter WithdrawalFilter, paginator Paginator, sorter Sorter) ([]Withdrawal, Metadata, error) {
+	coll := w.Client.Database(w.Database).Collection(w.Collection, listOptions(ctx))
+
+	withdrawals := make([]Withdrawal, 0)
+	metadata := Metadata{}
+
+	filterQuery := buildWithdrawalFilter(filter)
+
+	sortQuery, err := buildSorter(sorter)
+	if err != nil {
+		return nil, Metadata{}, fmt.Errorf("%v: %v", errCreatingQuerySort, err)
+	}
+
+	findOpt := options.Find().SetSort(sortQuery).SetCollation(sorter.collation())
+
+	if paginator.valid() {
+		var totalRecords int64
+
+		findOpt = findOpt.SetLimit(paginator.limit()).SetSkip(paginator.offset())
+		totalRecords, err = coll.CountDocuments(ctx, filterQuery)
+		if err != nil {
+			return withdrawals, Metadata{}, errCreatingQueryFilter
+		}
+
+		metadata = calculateMetadata(totalRecords, paginator.Page, paginator.PageSize)
+	}
+
+	logQuery(ctx, w.Collection, "find", filterQuery)
+	cursor, err := coll.Find(ctx, filterQuery, findOpt)
+	if err != nil {
+		return withdrawals, Metadata{}, err
+	}
+	defer cursor.Close(ctx)
+
+	if err = cursor.All(ctx, &withdrawals); err != nil {
+		return withdrawals, Metadata{}, err
+	}
+
+	return withdrawals, metadata, nil
+}
@@ -2,16 +2,46 @@ package database
 
 import (
 	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/event"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"slices"
+	"time"
 )
 
+// compressors are the compressors of messages which the driver supports.
+var compressors = []string{"snappy", "zlib", "zstd"}
+
+// Options tunes the client to the database. Options which are zero are left to the DSN, or to the
+// defaults of the driver.
+type Options struct {
+	MaxPoolSize            uint64
+	MinPoolSize            uint64
+	MaxConnIdleTime        time.Duration
+	ConnectTimeout         time.Duration
+	ServerSelectionTimeout time.Duration
+	// Timeout is the default timeout of operations which are run without a deadline.
+	Timeout time.Duration
+	// ReadPreference is the mode of the read preference, such as primary or secondaryPreferred.
+	ReadPreference string
+	RetryWrites    *bool
+	// Compressors are the compressors of messages to the server, in order of preference, such as
+	// zstd, zlib or snappy.
+	Compressors []string
+	// Monitor, if not nil, is reported the commands of the client.
+	Monitor *event.CommandMonitor
+}
+
 // Client initializes a client to the database.
-func Client(dsn string) (*mongo.Client, error) {
-	serverAPI := options.ServerAPI(options.ServerAPIVersion1)
-	opts := options.Client().ApplyURI(dsn).SetServerAPIOptions(serverAPI)
+func Client(dsn string, opts Options) (*mongo.Client, error) {
+	clientOpts, err := opts.clientOptions(dsn)
+	if err != nil {
+		return nil, err
+	}
 
-	client, err := mongo.Connect(context.TODO(), opts)
+	client, err := mongo.Connect(context.TODO(), clientOpts)
 	if err != nil {
 		return nil, err
 	}
@@ -23,3 +53,65 @@ func Client(dsn string) (*mongo.Client, error) {
 
 	return client, nil
 }
+
+// clientOptions returns the options of the driver for a client to the DSN.
+func (o Options) clientOptions(dsn string) (*options.ClientOptions, error) {
+	serverAPI := options.ServerAPI(options.ServerAPIVersion1)
+	opts := options.Client().ApplyURI(dsn).SetServerAPIOptions(serverAPI)
+
+	if o.MaxPoolSize > 0 {
+		opts = opts.SetMaxPoolSize(o.MaxPoolSize)
+	}
+	if o.MinPoolSize > 0 {
+		opts = opts.SetMinPoolSize(o.MinPoolSize)
+	}
+	if o.MaxConnIdleTime > 0 {
+		opts = opts.SetMaxConnIdleTime(o.MaxConnIdleTime)
+	}
+	if o.ConnectTimeout > 0 {
+		opts = opts.SetConnectTimeout(o.ConnectTimeout)
+	}
+	if o.ServerSelectionTimeout > 0 {
+		opts = opts.SetServerSelectionTimeout(o.ServerSelectionTimeout)
+	}
+	if o.Timeout > 0 {
+		opts = opts.SetTimeout(o.Timeout)
+	}
+	if o.ReadPreference != "" {
+		rp, err := ReadPreference(o.ReadPreference)
+		if err != nil {
+			return nil, err
+		}
+		opts = opts.SetReadPreference(rp)
+	}
+	if o.RetryWrites != nil {
+		opts = opts.SetRetryWrites(*o.RetryWrites)
+	}
+	if len(o.Compressors) > 0 {
+		for _, compressor := range o.Compressors {
+			if !slices.Contains(compressors, compressor) {
+				return nil, fmt.Errorf("unknown compressor %q, expected one of %v", compressor, compressors)
+			}
+		}
+		opts = opts.SetCompressors(o.Compressors)
+	}
+	if o.Monitor != nil {
+		opts = opts.SetMonitor(o.Monitor)
+	}
+
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	return opts, nil
+}
+
+// ReadPreference returns the read preference of a mode, such as primary or secondaryPreferred.
+func ReadPreference(mode string) (*readpref.ReadPref, error) {
+	m, err := readpref.ModeFromString(mode)
+	if err != nil {
+		return nil, err
+	}
+
+	return readpref.New(m)
+}
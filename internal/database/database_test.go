@@ -0,0 +1,59 @@
+package database
+
+import (
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestClientOptions(t *testing.T) {
+	const dsn = "mongodb://localhost:27017/?maxPoolSize=50&retryWrites=false"
+	retryWrites := true
+
+	t.Run("Zero", func(t *testing.T) {
+		opts, err := Options{}.clientOptions(dsn)
+		if err != nil {
+			t.Fatalf("clientOptions() error = %v", err)
+		}
+		if *opts.MaxPoolSize != 50 || *opts.RetryWrites {
+			t.Errorf("clientOptions() has maxPoolSize %v and retryWrites %v; want those of the DSN", *opts.MaxPoolSize, *opts.RetryWrites)
+		}
+	})
+
+	t.Run("Set", func(t *testing.T) {
+		opts, err := Options{
+			MaxPoolSize:            10,
+			MinPoolSize:            2,
+			ServerSelectionTimeout: 5 * time.Second,
+			ReadPreference:         "secondaryPreferred",
+			RetryWrites:            &retryWrites,
+			Compressors:            []string{"zstd", "snappy"},
+		}.clientOptions(dsn)
+		if err != nil {
+			t.Fatalf("clientOptions() error = %v", err)
+		}
+		if *opts.MaxPoolSize != 10 || *opts.MinPoolSize != 2 || *opts.ServerSelectionTimeout != 5*time.Second {
+			t.Errorf("clientOptions() has pool of %v to %v and server selection timeout %v; want 2 to 10 and 5s", *opts.MinPoolSize, *opts.MaxPoolSize, *opts.ServerSelectionTimeout)
+		}
+		if opts.ReadPreference.Mode() != readpref.SecondaryPreferredMode || !*opts.RetryWrites || !slices.Equal(opts.Compressors, []string{"zstd", "snappy"}) {
+			t.Errorf("clientOptions() has read preference %v, retryWrites %v and compressors %v", opts.ReadPreference.Mode(), *opts.RetryWrites, opts.Compressors)
+		}
+	})
+
+	invalid := []struct {
+		name string
+		opts Options
+	}{
+		{name: "ReadPreference", opts: Options{ReadPreference: "closest"}},
+		{name: "Compressor", opts: Options{Compressors: []string{"gzip"}}},
+		{name: "PoolSize", opts: Options{MaxPoolSize: 1, MinPoolSize: 2}},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.opts.clientOptions(dsn); err == nil {
+				t.Errorf("clientOptions(%+v) error = nil; want an error", tt.opts)
+			}
+		})
+	}
+}
@@ -0,0 +1,23 @@
+// Package dublincore describes books with the Dublin Core metadata element set, by which library
+// protocols such as SRU exchange records.
+package dublincore
+
+// Namespace is the XML namespace of the Dublin Core elements, which are written with the dc prefix.
+const Namespace = "http://purl.org/dc/elements/1.1/"
+
+// TypeText is the type of books in the DCMI Type Vocabulary.
+const TypeText = "Text"
+
+// Record is the Dublin Core elements of a book. Its elements are written with the dc prefix, so
+// the element which contains it declares the prefix with Namespace.
+type Record struct {
+	Titles      []string `xml:"dc:title"`
+	Creators    []string `xml:"dc:creator"`
+	Subjects    []string `xml:"dc:subject"`
+	Publishers  []string `xml:"dc:publisher"`
+	Dates       []string `xml:"dc:date"`
+	Types       []string `xml:"dc:type"`
+	Formats     []string `xml:"dc:format"`
+	Identifiers []string `xml:"dc:identifier"`
+	Languages   []string `xml:"dc:language"`
+}
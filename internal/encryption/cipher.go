@@ -0,0 +1,119 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	// ciphertextPrefix marks values which were encrypted by a Cipher, so that
+	// plaintext values stored before encryption was enabled can still be read.
+	ciphertextPrefix = "enc:v1:"
+	keySize          = 32
+)
+
+var (
+	ErrInvalidKey        = errors.New("encryption key must be 32 bytes long")
+	ErrInvalidCiphertext = errors.New("invalid ciphertext")
+)
+
+// Cipher encrypts and decrypts field values using AES-256-GCM, and computes
+// deterministic digests of values so that encrypted fields can still be looked up.
+type Cipher struct {
+	aead      cipher.AEAD
+	digestKey []byte
+}
+
+// NewCipher creates a Cipher from a 32 byte key.
+func NewCipher(key []byte) (*Cipher, error) {
+	if len(key) != keySize {
+		return nil, ErrInvalidKey
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("digest"))
+
+	return &Cipher{aead: aead, digestKey: mac.Sum(nil)}, nil
+}
+
+// NewCipherFromString creates a Cipher from a base64 encoded 32 byte key.
+func NewCipherFromString(key string) (*Cipher, error) {
+	decoded, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode encryption key: %v", err)
+	}
+
+	return NewCipher(decoded)
+}
+
+// IsEncrypted reports whether a value was produced by Encrypt.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, ciphertextPrefix)
+}
+
+// Encrypt encrypts a plaintext value. Values which are already encrypted are returned as-is.
+func (c *Cipher) Encrypt(plaintext string) (string, error) {
+	if IsEncrypted(plaintext) {
+		return plaintext, nil
+	}
+
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	sealed := c.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+
+	return ciphertextPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt decrypts a value produced by Encrypt. Values which are not encrypted are returned as-is.
+func (c *Cipher) Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, ciphertextPrefix))
+	if err != nil {
+		return "", fmt.Errorf("%v: %v", ErrInvalidCiphertext, err)
+	}
+
+	nonceSize := c.aead.NonceSize()
+	if len(sealed) < nonceSize {
+		return "", ErrInvalidCiphertext
+	}
+
+	plaintext, err := c.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], nil)
+	if err != nil {
+		return "", fmt.Errorf("%v: %v", ErrInvalidCiphertext, err)
+	}
+
+	return string(plaintext), nil
+}
+
+// Digest returns a deterministic keyed hash of a value, used as a blind index for equality lookups.
+func (c *Cipher) Digest(value string) string {
+	mac := hmac.New(sha256.New, c.digestKey)
+	mac.Write([]byte(value))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,79 @@
+package encryption
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCipherRoundTrip(t *testing.T) {
+	c, err := NewCipher(bytes.Repeat([]byte("k"), keySize))
+	if err != nil {
+		t.Fatalf("NewCipher() error = %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{
+			name:  "Email",
+			value: "test@email.com",
+		},
+		{
+			name:  "Unicode",
+			value: "ישראל ישראלי",
+		},
+		{
+			name:  "Empty",
+			value: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encrypted, err := c.Encrypt(tt.value)
+			if err != nil {
+				t.Fatalf("Encrypt(%v) error = %v", tt.value, err)
+			}
+
+			if !IsEncrypted(encrypted) {
+				t.Errorf("Encrypt(%v) = %v; want encrypted value", tt.value, encrypted)
+			}
+
+			decrypted, err := c.Decrypt(encrypted)
+			if err != nil {
+				t.Fatalf("Decrypt(%v) error = %v", encrypted, err)
+			}
+
+			if decrypted != tt.value {
+				t.Errorf("Decrypt(Encrypt(%v)) = %v; want %v", tt.value, decrypted, tt.value)
+			}
+
+			if c.Digest(tt.value) != c.Digest(tt.value) {
+				t.Errorf("Digest(%v) is not deterministic", tt.value)
+			}
+		})
+	}
+}
+
+func TestCipherDecryptPlaintext(t *testing.T) {
+	c, err := NewCipher(bytes.Repeat([]byte("k"), keySize))
+	if err != nil {
+		t.Fatalf("NewCipher() error = %v", err)
+	}
+
+	decrypted, err := c.Decrypt("test@email.com")
+	if err != nil {
+		t.Fatalf("Decrypt() error = %v", err)
+	}
+
+	if decrypted != "test@email.com" {
+		t.Errorf("Decrypt() = %v; want %v", decrypted, "test@email.com")
+	}
+}
+
+func TestNewCipherInvalidKey(t *testing.T) {
+	if _, err := NewCipher([]byte("short")); err != ErrInvalidKey {
+		t.Errorf("NewCipher() error = %v; want %v", err, ErrInvalidKey)
+	}
+}
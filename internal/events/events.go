@@ -0,0 +1,205 @@
+// Package events dispatches the domain events of the outbox to their subscribers.
+//
+// Events are inserted into the outbox in the same database transaction as the change they
+// describe. The Dispatcher polls the outbox for pending events and hands each of them to every
+// subscriber of its type, retrying with backoff until all of them handled it. Delivery is at
+// least once, so subscribers must tolerate receiving an event more than once.
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mzeevi/library/internal/data"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultBatchSize is the number of events dispatched in each batch.
+	DefaultBatchSize = 100
+	// DefaultMaxAttempts is the number of attempts after which an event is marked as failed.
+	DefaultMaxAttempts = 10
+	// DefaultBackoff is the delay before the first retry, which doubles with each attempt.
+	DefaultBackoff = 5 * time.Second
+	// DefaultLease is how long an event is reserved for the dispatcher which claimed it.
+	DefaultLease = time.Minute
+	// DefaultInterval is the interval between batches when Run is not given one.
+	DefaultInterval = 5 * time.Second
+)
+
+// maxBackoff caps the delay between retries.
+const maxBackoff = time.Hour
+
+// Handler handles an event for a subscriber.
+type Handler func(ctx context.Context, event data.Event) error
+
+type subscriber struct {
+	name    string
+	types   []string
+	handler Handler
+}
+
+// Dispatcher delivers the events of the outbox to subscribers.
+type Dispatcher struct {
+	Store       data.EventStore
+	Logger      *slog.Logger
+	BatchSize   int64
+	MaxAttempts int
+	Backoff     time.Duration
+	Lease       time.Duration
+
+	subscribers []subscriber
+}
+
+// New returns a Dispatcher of the events in store with the default settings.
+func New(store data.EventStore, logger *slog.Logger) *Dispatcher {
+	return &Dispatcher{
+		Store:       store,
+		Logger:      logger,
+		BatchSize:   DefaultBatchSize,
+		MaxAttempts: DefaultMaxAttempts,
+		Backoff:     DefaultBackoff,
+		Lease:       DefaultLease,
+	}
+}
+
+// Subscribe registers a handler for events of the given types, or of all types if none are given.
+// The name identifies the subscriber in the outbox, so it must be unique and stable across restarts.
+func (d *Dispatcher) Subscribe(name string, handler Handler, types ...string) {
+	d.subscribers = append(d.subscribers, subscriber{name: name, types: types, handler: handler})
+}
+
+// Run dispatches pending events every interval until ctx is canceled.
+func (d *Dispatcher) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := d.Dispatch(ctx); err != nil && ctx.Err() == nil {
+			d.Logger.Error("failed to dispatch events", slog.Any("error", err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Dispatch delivers a batch of the pending events which are due, and returns how many of them
+// were delivered to all of their subscribers.
+func (d *Dispatcher) Dispatch(ctx context.Context) (int, error) {
+	now := time.Now()
+	filter := data.EventFilter{Status: ptr(data.EventStatusPending), MaxNextAttemptAt: &now}
+	paginator := data.Paginator{Page: 1, PageSize: d.BatchSize}
+	sorter := data.Sorter{Field: "created_at", SortSafelist: []string{"created_at"}}
+
+	events, _, err := d.Store.GetAll(ctx, filter, paginator, sorter)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get pending events: %v", err)
+	}
+
+	dispatched := 0
+	for i := range events {
+		event := &events[i]
+
+		ok, err := d.claim(ctx, event)
+		if err != nil {
+			return dispatched, err
+		}
+		if !ok {
+			continue
+		}
+
+		if err = d.deliver(ctx, event); err != nil {
+			return dispatched, err
+		}
+
+		if event.Status == data.EventStatusDispatched {
+			dispatched++
+		}
+	}
+
+	return dispatched, nil
+}
+
+// claim reserves an event for the lease, so that other dispatchers skip it while it is delivered.
+// It returns false if another dispatcher claimed the event first.
+func (d *Dispatcher) claim(ctx context.Context, event *data.Event) (bool, error) {
+	event.NextAttemptAt = time.Now().Add(d.Lease)
+
+	err := d.Store.Update(ctx, data.EventFilter{ID: &event.ID}, event)
+	switch {
+	case errors.Is(err, data.ErrEditConflict):
+		return false, nil
+	case err != nil:
+		return false, fmt.Errorf("failed to claim event %s: %v", event.ID, err)
+	}
+	event.Version++
+
+	return true, nil
+}
+
+// deliver hands a claimed event to the subscribers which did not handle it yet, and records the attempt.
+func (d *Dispatcher) deliver(ctx context.Context, event *data.Event) error {
+	var errs []string
+
+	for _, sub := range d.subscribers {
+		if slices.Contains(event.Delivered, sub.name) {
+			continue
+		}
+		if len(sub.types) > 0 && !slices.Contains(sub.types, event.Type) {
+			continue
+		}
+
+		if err := sub.handler(ctx, *event); err != nil {
+			d.Logger.Warn("failed to deliver event", slog.String("id", event.ID), slog.String("type", event.Type), slog.String("subscriber", sub.name), slog.Any("error", err))
+			errs = append(errs, fmt.Sprintf("%s: %v", sub.name, err))
+			continue
+		}
+
+		event.Delivered = append(event.Delivered, sub.name)
+	}
+
+	event.Attempts++
+	if len(errs) == 0 {
+		event.Status = data.EventStatusDispatched
+		event.LastError = ""
+		event.DispatchedAt = time.Now()
+	} else {
+		event.LastError = strings.Join(errs, "; ")
+		event.NextAttemptAt = time.Now().Add(d.backoff(event.Attempts))
+		if event.Attempts >= d.MaxAttempts {
+			event.Status = data.EventStatusFailed
+		}
+	}
+
+	if err := d.Store.Update(ctx, data.EventFilter{ID: &event.ID}, event); err != nil {
+		return fmt.Errorf("failed to record delivery of event %s: %v", event.ID, err)
+	}
+	event.Version++
+
+	return nil
+}
+
+// backoff returns the delay before the next attempt, after the given number of attempts.
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.Backoff
+	for i := 1; i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+
+	return min(delay, maxBackoff)
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
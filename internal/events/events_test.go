@@ -0,0 +1,185 @@
+package events
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/mzeevi/library/internal/data"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newEvent(t *testing.T, store data.EventStore, eventType string) string {
+	t.Helper()
+
+	event, err := data.NewEvent(eventType, map[string]string{"id": "1"})
+	if err != nil {
+		t.Fatalf("NewEvent() error = %v", err)
+	}
+
+	id, err := store.Insert(context.Background(), event)
+	if err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+
+	return id
+}
+
+func TestDispatch(t *testing.T) {
+	ctx := context.Background()
+	store := data.NewMemoryModels().Events
+	d := New(store, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	d.Backoff = 0
+
+	var books, all []string
+	failing := true
+	d.Subscribe("books", func(_ context.Context, event data.Event) error {
+		books = append(books, event.Type)
+		return nil
+	}, data.EventBookCreated)
+	d.Subscribe("all", func(_ context.Context, event data.Event) error {
+		if failing {
+			return errors.New("unavailable")
+		}
+		all = append(all, event.Type)
+		return nil
+	})
+
+	bookID := newEvent(t, store, data.EventBookCreated)
+	newEvent(t, store, data.EventPatronCreated)
+
+	dispatched, err := d.Dispatch(ctx)
+	if err != nil {
+		t.Fatalf("Dispatch() error = %v", err)
+	}
+	if dispatched != 0 {
+		t.Errorf("Dispatch() with a failing subscriber = %d; want 0", dispatched)
+	}
+
+	event, err := store.Get(ctx, data.EventFilter{ID: &bookID})
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if event.Status != data.EventStatusPending || event.Attempts != 1 || event.LastError == "" {
+		t.Errorf("failed event = %+v; want pending with one attempt and an error", event)
+	}
+
+	failing = false
+	if dispatched, err = d.Dispatch(ctx); err != nil {
+		t.Fatalf("Dispatch() error = %v", err)
+	}
+	if dispatched != 2 {
+		t.Errorf("Dispatch() = %d; want 2", dispatched)
+	}
+
+	// The subscriber which handled the event already is not called again when it is retried.
+	if len(books) != 1 || books[0] != data.EventBookCreated {
+		t.Errorf("books subscriber received %v; want one %s", books, data.EventBookCreated)
+	}
+	if len(all) != 2 {
+		t.Errorf("all subscriber received %v; want 2 events", all)
+	}
+
+	event, err = store.Get(ctx, data.EventFilter{ID: &bookID})
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if event.Status != data.EventStatusDispatched || event.DispatchedAt.IsZero() || len(event.Delivered) != 2 {
+		t.Errorf("dispatched event = %+v; want dispatched to both subscribers", event)
+	}
+
+	if dispatched, err = d.Dispatch(ctx); err != nil || dispatched != 0 {
+		t.Errorf("Dispatch() without pending events = %d, %v; want 0, nil", dispatched, err)
+	}
+}
+
+func TestDispatchFailed(t *testing.T) {
+	ctx := context.Background()
+	store := data.NewMemoryModels().Events
+	d := New(store, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	d.Backoff = 0
+	d.MaxAttempts = 2
+
+	d.Subscribe("failing", func(_ context.Context, _ data.Event) error {
+		return errors.New("unavailable")
+	})
+	id := newEvent(t, store, data.EventBookReturned)
+
+	for range 3 {
+		if _, err := d.Dispatch(ctx); err != nil {
+			t.Fatalf("Dispatch() error = %v", err)
+		}
+	}
+
+	event, err := store.Get(ctx, data.EventFilter{ID: &id})
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if event.Status != data.EventStatusFailed || event.Attempts != 2 {
+		t.Errorf("event = %+v; want failed after 2 attempts", event)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	d := &Dispatcher{Backoff: time.Second}
+
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 1, want: time.Second},
+		{attempts: 2, want: 2 * time.Second},
+		{attempts: 4, want: 8 * time.Second},
+		{attempts: 100, want: maxBackoff},
+	}
+
+	for _, tt := range tests {
+		if got := d.backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) = %v; want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	var signature, eventType string
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signature = r.Header.Get(SignatureHeader)
+		eventType = r.Header.Get(TypeHeader)
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	event, err := data.NewEvent(data.EventBookBorrowed, map[string]int{"copies": 1})
+	if err != nil {
+		t.Fatalf("NewEvent() error = %v", err)
+	}
+
+	if err = Webhook(srv.URL, "secret", nil)(context.Background(), *event); err != nil {
+		t.Fatalf("Webhook() error = %v", err)
+	}
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(body)
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); signature != want {
+		t.Errorf("%s = %q; want %q", SignatureHeader, signature, want)
+	}
+	if eventType != data.EventBookBorrowed {
+		t.Errorf("%s = %q; want %q", TypeHeader, eventType, data.EventBookBorrowed)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+
+	if err = Webhook(failing.URL, "", nil)(context.Background(), *event); err == nil {
+		t.Error("Webhook() with a failing receiver error = nil; want an error")
+	}
+}
@@ -0,0 +1,66 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/mzeevi/library/internal/data"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	// TypeHeader holds the type of the event in webhook requests.
+	TypeHeader = "X-Library-Event"
+	// SignatureHeader holds the HMAC-SHA256 of the body of webhook requests, when a secret is set.
+	SignatureHeader = "X-Library-Signature"
+)
+
+// maxErrorBody limits how much of an error response is read.
+const maxErrorBody = 4096
+
+// Webhook returns a Handler which posts events as JSON to a URL. If secret is set, requests
+// are signed with it in SignatureHeader so that the receiver can verify them.
+func Webhook(url, secret string, client *http.Client) Handler {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return func(ctx context.Context, event data.Event) error {
+		body, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(TypeHeader, event.Type)
+
+		if secret != "" {
+			mac := hmac.New(sha256.New, []byte(secret))
+			mac.Write(body)
+			req.Header.Set(SignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			respBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+			return fmt.Errorf("webhook responded with status %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+		}
+
+		return nil
+	}
+}
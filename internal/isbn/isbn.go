@@ -0,0 +1,99 @@
+package isbn
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalid = errors.New("invalid isbn")
+)
+
+// CheckDigit13 computes the ISBN-13 check digit of the first 12 digits of an ISBN.
+func CheckDigit13(digits []int) int {
+	sum := 0
+	for i, digit := range digits {
+		if i%2 == 0 {
+			sum += digit
+		} else {
+			sum += digit * 3
+		}
+	}
+	return (10 - (sum % 10)) % 10
+}
+
+// checkDigit10 computes the ISBN-10 check digit of the first 9 digits of an ISBN, where 10 is X.
+func checkDigit10(digits []int) int {
+	sum := 0
+	for i, digit := range digits {
+		sum += digit * (10 - i)
+	}
+	return (11 - (sum % 11)) % 11
+}
+
+// Normalize returns an ISBN-13 or ISBN-10 without its hyphens and spaces, and with an upper case
+// check digit X, if its check digit is valid.
+func Normalize(code string) (string, error) {
+	code, _, err := parse(code)
+	if err != nil {
+		return "", err
+	}
+
+	return code, nil
+}
+
+// FromBarcode returns the ISBN-13 of a scanned barcode or a typed ISBN. It accepts EAN-13
+// barcodes, which are ISBN-13s, and ISBN-10s, with or without hyphens and spaces.
+func FromBarcode(code string) (string, error) {
+	code, digits, err := parse(code)
+	if err != nil {
+		return "", err
+	}
+
+	if len(digits) == 13 {
+		return code, nil
+	}
+
+	isbn13 := append([]int{9, 7, 8}, digits[:9]...)
+	isbn13 = append(isbn13, CheckDigit13(isbn13))
+
+	var b strings.Builder
+	for _, digit := range isbn13 {
+		b.WriteString(strconv.Itoa(digit))
+	}
+	return b.String(), nil
+}
+
+// parse returns an ISBN-13 or ISBN-10 without its hyphens and spaces, with its digits, if its
+// check digit is valid.
+func parse(code string) (string, []int, error) {
+	code = strings.NewReplacer("-", "", " ", "").Replace(strings.ToUpper(code))
+
+	digits := make([]int, 0, len(code))
+	for i, r := range code {
+		switch {
+		case r >= '0' && r <= '9':
+			digits = append(digits, int(r-'0'))
+		case r == 'X' && i == 9 && len(code) == 10:
+			digits = append(digits, 10)
+		default:
+			return "", nil, ErrInvalid
+		}
+	}
+
+	switch len(digits) {
+	case 13:
+		if CheckDigit13(digits[:12]) != digits[12] {
+			return "", nil, ErrInvalid
+		}
+	case 10:
+		if checkDigit10(digits[:9]) != digits[9] {
+			return "", nil, ErrInvalid
+		}
+	default:
+		return "", nil, ErrInvalid
+	}
+
+	return code, digits, nil
+}
@@ -0,0 +1,63 @@
+package isbn
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFromBarcode(t *testing.T) {
+	tests := []struct {
+		code string
+		want string
+		err  error
+	}{
+		{code: "9780306406157", want: "9780306406157"},
+		{code: "978-0-306-40615-7", want: "9780306406157"},
+		{code: "0306406152", want: "9780306406157"},
+		{code: "0-8044-2957-x", want: "9780804429573"},
+		{code: "9780306406158", err: ErrInvalid},
+		{code: "0306406153", err: ErrInvalid},
+		{code: "97803064061", err: ErrInvalid},
+		{code: "978030640615X", err: ErrInvalid},
+		{code: "", err: ErrInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			got, err := FromBarcode(tt.code)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("FromBarcode(%q) error = %v; want %v", tt.code, err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("FromBarcode(%q) = %q; want %q", tt.code, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		code string
+		want string
+		err  error
+	}{
+		{code: "978-0-306-40615-7", want: "9780306406157"},
+		{code: "0 306 40615 2", want: "0306406152"},
+		{code: "0-8044-2957-x", want: "080442957X"},
+		{code: "978-0-306-40615-8", err: ErrInvalid},
+		{code: "0-8044-2957-1", err: ErrInvalid},
+		{code: "ISBN 0306406152", err: ErrInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			got, err := Normalize(tt.code)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Normalize(%q) error = %v; want %v", tt.code, err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("Normalize(%q) = %q; want %q", tt.code, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,279 @@
+// Package labels renders printable PDF sheets of spine and barcode labels for the copies of books,
+// in the layouts of Avery label sheets.
+package labels
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-pdf/fpdf"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ContentType is the media type of a sheet of labels.
+const ContentType = "application/pdf"
+
+// DefaultLayout is the layout of sheets of labels if none is configured.
+const DefaultLayout = "avery-l7160"
+
+var (
+	ErrUnknownLayout = errors.New("unknown label layout")
+	ErrInvalidEAN    = errors.New("invalid EAN-13")
+)
+
+const (
+	padding    = 1.5
+	fontFamily = "Helvetica"
+	// pointsPerMM converts font sizes in points to millimeters.
+	pointsPerMM = 2.835
+)
+
+// Layout is the layout of a sheet of labels, in millimeters. Labels are placed in Rows and
+// Columns from the top and left margins, HorizontalPitch and VerticalPitch apart.
+type Layout struct {
+	PageWidth       float64
+	PageHeight      float64
+	Columns         int
+	Rows            int
+	LabelWidth      float64
+	LabelHeight     float64
+	TopMargin       float64
+	LeftMargin      float64
+	HorizontalPitch float64
+	VerticalPitch   float64
+}
+
+// Layouts are the supported layouts of Avery label sheets, by their product codes.
+var Layouts = map[string]Layout{
+	// Avery 5160 has 30 labels of 66.7 x 25.4 mm on a US Letter sheet.
+	"avery-5160": {
+		PageWidth: 215.9, PageHeight: 279.4, Columns: 3, Rows: 10,
+		LabelWidth: 66.7, LabelHeight: 25.4, TopMargin: 12.7, LeftMargin: 4.8,
+		HorizontalPitch: 69.85, VerticalPitch: 25.4,
+	},
+	// Avery L7160 has 21 labels of 63.5 x 38.1 mm on an A4 sheet.
+	"avery-l7160": {
+		PageWidth: 210, PageHeight: 297, Columns: 3, Rows: 7,
+		LabelWidth: 63.5, LabelHeight: 38.1, TopMargin: 15.15, LeftMargin: 7.2,
+		HorizontalPitch: 66, VerticalPitch: 38.1,
+	},
+	// Avery L7651 has 65 labels of 38.1 x 21.2 mm on an A4 sheet.
+	"avery-l7651": {
+		PageWidth: 210, PageHeight: 297, Columns: 5, Rows: 13,
+		LabelWidth: 38.1, LabelHeight: 21.2, TopMargin: 10.7, LeftMargin: 4.7,
+		HorizontalPitch: 40.6, VerticalPitch: 21.2,
+	},
+}
+
+// LayoutNames returns the names of the supported layouts in order.
+func LayoutNames() []string {
+	return slices.Sorted(maps.Keys(Layouts))
+}
+
+// PerSheet returns the number of labels on a sheet of the layout.
+func (l Layout) PerSheet() int {
+	return l.Columns * l.Rows
+}
+
+// Label is the label of a copy of a book. The spine part has the CallNumber, broken into lines,
+// and the number of the Copy, and the barcode part has the Title and a barcode of the ISBN.
+type Label struct {
+	Title      string
+	ISBN       string
+	CallNumber string
+	Copy       int
+}
+
+// Sheet is the labels of copies, laid out on sheets. Skip is the number of labels which were
+// already used on the first sheet, which are left blank.
+type Sheet struct {
+	Layout    string
+	Skip      int
+	Labels    []Label
+	CreatedAt time.Time
+}
+
+// Write renders the sheets of labels as a PDF to w, one page per sheet. Text which can't be
+// encoded in the standard PDF fonts, which cover Western European languages, is replaced.
+func (s *Sheet) Write(w io.Writer) error {
+	layout, ok := Layouts[s.Layout]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownLayout, s.Layout)
+	}
+
+	pdf := fpdf.NewCustom(&fpdf.InitType{
+		OrientationStr: "P",
+		UnitStr:        "mm",
+		Size:           fpdf.SizeType{Wd: layout.PageWidth, Ht: layout.PageHeight},
+	})
+	pdf.SetMargins(0, 0, 0)
+	pdf.SetAutoPageBreak(false, 0)
+	pdf.SetTitle("Labels", true)
+	pdf.SetCreationDate(s.CreatedAt)
+	pdf.SetFillColor(0, 0, 0)
+
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+
+	for i, label := range s.Labels {
+		position := (s.Skip + i) % layout.PerSheet()
+		if i == 0 || position == 0 {
+			pdf.AddPage()
+		}
+
+		x := layout.LeftMargin + float64(position%layout.Columns)*layout.HorizontalPitch
+		y := layout.TopMargin + float64(position/layout.Columns)*layout.VerticalPitch
+		label.write(pdf, tr, x, y, layout.LabelWidth, layout.LabelHeight)
+	}
+
+	if len(s.Labels) == 0 {
+		pdf.AddPage()
+	}
+
+	return pdf.Output(w)
+}
+
+// write draws a label with its top left corner at x and y. The spine part takes the left
+// third of the label, and the barcode part the rest.
+func (l Label) write(pdf *fpdf.Fpdf, tr func(string) string, x, y, width, height float64) {
+	spineWidth := width / 3
+	x, y = x+padding, y+padding
+	width, height = width-2*padding, height-2*padding
+
+	// The spine part has a line for each part of the call number, and the number of the copy.
+	lines := SpineLines(l.CallNumber)
+	if l.Copy > 0 {
+		lines = append(lines, fmt.Sprintf("c.%d", l.Copy))
+	}
+	if len(lines) > 0 {
+		lineHeight := min(height/float64(len(lines)), 4)
+		pdf.SetFont(fontFamily, "B", lineHeight*pointsPerMM*0.9)
+		for i, line := range lines {
+			pdf.SetXY(x, y+float64(i)*lineHeight)
+			pdf.CellFormat(spineWidth-padding, lineHeight, fit(pdf, tr(line), spineWidth-padding), "", 0, "L", false, 0, "")
+		}
+	}
+
+	// The barcode part has the title, the barcode and the digits of the ISBN.
+	x, width = x+spineWidth, width-spineWidth
+	textHeight := min(height/6, 3)
+	pdf.SetFont(fontFamily, "", textHeight*pointsPerMM*0.9)
+	pdf.SetXY(x, y)
+	pdf.CellFormat(width, textHeight, fit(pdf, tr(l.Title), width), "", 0, "L", false, 0, "")
+
+	modules, err := EAN13(l.ISBN)
+	if err != nil {
+		return
+	}
+
+	barHeight := height - 2*textHeight - padding
+	moduleWidth := width / float64(len(modules))
+	for i, module := range modules {
+		if module {
+			pdf.Rect(x+float64(i)*moduleWidth, y+textHeight+padding/2, moduleWidth, barHeight, "F")
+		}
+	}
+
+	pdf.SetXY(x, y+height-textHeight)
+	pdf.CellFormat(width, textHeight, l.ISBN, "", 0, "C", false, 0, "")
+}
+
+// fit truncates a text with an ellipsis to fit a width in the current font.
+func fit(pdf *fpdf.Fpdf, text string, width float64) string {
+	if pdf.GetStringWidth(text) <= width {
+		return text
+	}
+
+	runes := []rune(text)
+	for len(runes) > 0 && pdf.GetStringWidth(string(runes)+"...") > width {
+		runes = runes[:len(runes)-1]
+	}
+
+	return string(runes) + "..."
+}
+
+// SpineLines breaks a call number into the lines of a spine label: at spaces, before the cutter
+// numbers of an LCC call number such as .G63, and between the class letters and the class
+// number of an LCC call number, such as QA and 76.73.
+func SpineLines(callNumber string) []string {
+	var lines []string
+
+	for i, part := range strings.Fields(callNumber) {
+		if i == 0 {
+			if letters := strings.IndexFunc(part, unicode.IsDigit); letters > 0 && !strings.ContainsFunc(part[:letters], unicode.IsDigit) {
+				lines = append(lines, part[:letters])
+				part = part[letters:]
+			}
+		}
+
+		start := 0
+		for j := 1; j < len(part)-1; j++ {
+			if part[j] == '.' && unicode.IsLetter(rune(part[j+1])) {
+				lines = append(lines, part[start:j])
+				start = j
+			}
+		}
+		lines = append(lines, part[start:])
+	}
+
+	return lines
+}
+
+var (
+	// eanCodes are the left-hand odd parity (L) patterns of the digits. The even parity (G)
+	// patterns are their reverses, and the right-hand (R) patterns their complements.
+	eanCodes = [10]string{"0001101", "0011001", "0010011", "0111101", "0100011", "0110001", "0101111", "0111011", "0110111", "0001011"}
+	// eanParities are the parities of the left-hand digits, by the first digit, where G is even parity.
+	eanParities = [10]string{"LLLLLL", "LLGLGG", "LLGGLG", "LLGGGL", "LGLLGG", "LGGLLG", "LGGGLL", "LGLGLG", "LGLGGL", "LGGLGL"}
+)
+
+// EAN13 returns the 95 modules of the EAN-13 barcode of a code of 13 digits, such as an ISBN-13,
+// where true is a bar. The check digit is not validated.
+func EAN13(code string) ([]bool, error) {
+	if len(code) != 13 || strings.ContainsFunc(code, func(r rune) bool { return r < '0' || r > '9' }) {
+		return nil, ErrInvalidEAN
+	}
+
+	var b strings.Builder
+	b.WriteString("101")
+	for i, parity := range eanParities[code[0]-'0'] {
+		pattern := eanCodes[code[i+1]-'0']
+		if parity == 'G' {
+			pattern = reverse(complement(pattern))
+		}
+		b.WriteString(pattern)
+	}
+	b.WriteString("01010")
+	for _, digit := range code[7:] {
+		b.WriteString(complement(eanCodes[digit-'0']))
+	}
+	b.WriteString("101")
+
+	modules := make([]bool, 0, b.Len())
+	for _, module := range b.String() {
+		modules = append(modules, module == '1')
+	}
+
+	return modules, nil
+}
+
+// complement returns a pattern with its bars and spaces swapped.
+func complement(pattern string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '1' {
+			return '0'
+		}
+		return '1'
+	}, pattern)
+}
+
+// reverse returns a pattern from right to left.
+func reverse(pattern string) string {
+	b := []byte(pattern)
+	slices.Reverse(b)
+
+	return string(b)
+}
@@ -0,0 +1,112 @@
+package labels
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSpineLines(t *testing.T) {
+	tests := []struct {
+		callNumber string
+		want       []string
+	}{
+		{callNumber: "823.914 ROW", want: []string{"823.914", "ROW"}},
+		{callNumber: "005.133 K42 2018", want: []string{"005.133", "K42", "2018"}},
+		{callNumber: "QA76.73.G63 D66 2016", want: []string{"QA", "76.73", ".G63", "D66", "2016"}},
+		{callNumber: "KF 801", want: []string{"KF", "801"}},
+		{callNumber: "", want: nil},
+	}
+
+	for _, tt := range tests {
+		if got := SpineLines(tt.callNumber); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SpineLines(%q) = %q; want %q", tt.callNumber, got, tt.want)
+		}
+	}
+}
+
+func TestEAN13(t *testing.T) {
+	const code = "9780306406157"
+
+	modules, err := EAN13(code)
+	if err != nil {
+		t.Fatalf("EAN13(%q) error = %v", code, err)
+	}
+	if len(modules) != 95 {
+		t.Fatalf("EAN13(%q) has %d modules; want 95", code, len(modules))
+	}
+
+	pattern := func(from, to int) string {
+		b := bytes.Repeat([]byte("0"), to-from)
+		for i, module := range modules[from:to] {
+			if module {
+				b[i] = '1'
+			}
+		}
+		return string(b)
+	}
+	if pattern(0, 3) != "101" || pattern(45, 50) != "01010" || pattern(92, 95) != "101" {
+		t.Errorf("EAN13(%q) guards = %s, %s, %s; want 101, 01010, 101", code, pattern(0, 3), pattern(45, 50), pattern(92, 95))
+	}
+
+	// Decode the digits back from their patterns, and the first digit from the parities.
+	decoded := make([]byte, 13)
+	var parities string
+	for i := range 6 {
+		p := pattern(3+7*i, 10+7*i)
+		if digit := slices.Index(eanCodes[:], p); digit >= 0 {
+			decoded[i+1], parities = byte('0'+digit), parities+"L"
+		} else if digit = slices.Index(eanCodes[:], reverse(complement(p))); digit >= 0 {
+			decoded[i+1], parities = byte('0'+digit), parities+"G"
+		}
+		if digit := slices.Index(eanCodes[:], complement(pattern(50+7*i, 57+7*i))); digit >= 0 {
+			decoded[i+7] = byte('0' + digit)
+		}
+	}
+	decoded[0] = byte('0' + slices.Index(eanParities[:], parities))
+	if string(decoded) != code {
+		t.Errorf("EAN13(%q) decodes to %q", code, decoded)
+	}
+
+	for _, invalid := range []string{"978030640615", "978030640615X", ""} {
+		if _, err := EAN13(invalid); !errors.Is(err, ErrInvalidEAN) {
+			t.Errorf("EAN13(%q) error = %v; want %v", invalid, err, ErrInvalidEAN)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	labels := make([]Label, 25)
+	for i := range labels {
+		labels[i] = Label{
+			Title:      "Cien años de soledad, a very long title which does not fit on a label",
+			ISBN:       "9780306406157",
+			CallNumber: "QA76.73.G63 D66 2016",
+			Copy:       i + 1,
+		}
+	}
+	labels = append(labels, Label{Title: "A book without an ISBN"})
+
+	for _, layout := range LayoutNames() {
+		t.Run(layout, func(t *testing.T) {
+			s := &Sheet{Layout: layout, Skip: 3, Labels: labels, CreatedAt: time.Date(2024, time.December, 10, 12, 0, 0, 0, time.UTC)}
+
+			var b bytes.Buffer
+			if err := s.Write(&b); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+
+			if !bytes.HasPrefix(b.Bytes(), []byte("%PDF-")) || !bytes.Contains(b.Bytes(), []byte("%%EOF")) {
+				t.Errorf("Write() = %q...; want a PDF document", b.Bytes()[:min(b.Len(), 16)])
+			}
+		})
+	}
+
+	s := &Sheet{Layout: "avery-0000"}
+	if err := s.Write(&bytes.Buffer{}); !errors.Is(err, ErrUnknownLayout) {
+		t.Errorf("Write() with an unknown layout error = %v; want %v", err, ErrUnknownLayout)
+	}
+}
@@ -0,0 +1,240 @@
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Redacted replaces the values of sensitive headers, query parameters and fields.
+const Redacted = "***"
+
+var (
+	// DefaultRedactedHeaders are the headers which are always redacted.
+	DefaultRedactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key", "X-Library-Signature", "Stripe-Signature"}
+	// DefaultRedactedFields are the fields of bodies, query parameters and log attributes which are always redacted.
+	DefaultRedactedFields = []string{"password", "token", "auth_token", "feed_token", "patron_token", "secret", "api_key"}
+)
+
+const (
+	headerGroup = "header"
+	urlKey      = "url"
+	bodyKey     = "body"
+)
+
+// Redactor hides the values of sensitive headers, query parameters and fields, so that
+// credentials sent by clients are not written to logs or error reports. Names are matched
+// case-insensitively.
+type Redactor struct {
+	headers map[string]struct{}
+	fields  map[string]struct{}
+}
+
+// NewRedactor returns a Redactor of the default headers and fields, and of the given ones.
+func NewRedactor(headers, fields []string) *Redactor {
+	r := &Redactor{headers: map[string]struct{}{}, fields: map[string]struct{}{}}
+	for _, header := range append(DefaultRedactedHeaders, headers...) {
+		r.headers[strings.ToLower(header)] = struct{}{}
+	}
+	for _, field := range append(DefaultRedactedFields, fields...) {
+		r.fields[strings.ToLower(field)] = struct{}{}
+	}
+
+	return r
+}
+
+// IsHeader checks if the header is redacted.
+func (r *Redactor) IsHeader(name string) bool {
+	_, ok := r.headers[strings.ToLower(name)]
+	return ok
+}
+
+// IsField checks if the field is redacted.
+func (r *Redactor) IsField(name string) bool {
+	_, ok := r.fields[strings.ToLower(name)]
+	return ok
+}
+
+// Headers returns a copy of the headers with the values of the redacted ones replaced.
+func (r *Redactor) Headers(header http.Header) http.Header {
+	redacted := header.Clone()
+	for name := range redacted {
+		if r.IsHeader(name) {
+			redacted[name] = []string{Redacted}
+		}
+	}
+
+	return redacted
+}
+
+// Query returns the query string with the values of the redacted parameters replaced. A query
+// string which can't be parsed is redacted entirely.
+func (r *Redactor) Query(query string) string {
+	if query == "" {
+		return query
+	}
+
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return Redacted
+	}
+
+	redact := false
+	for name := range values {
+		if r.IsField(name) {
+			values[name] = []string{Redacted}
+			redact = true
+		}
+	}
+	if !redact {
+		return query
+	}
+
+	return values.Encode()
+}
+
+// URL returns the URL with the values of the redacted query parameters replaced.
+func (r *Redactor) URL(rawURL string) string {
+	base, query, ok := strings.Cut(rawURL, "?")
+	if !ok {
+		return rawURL
+	}
+
+	return base + "?" + r.Query(query)
+}
+
+// Body returns the JSON body with the values of the redacted fields replaced, at any depth. The
+// values of validation errors whose location is a redacted field, such as body.password, are
+// replaced too, since they echo the field. A body which is not JSON, or is truncated, is returned
+// as-is.
+func (r *Redactor) Body(body string) string {
+	var v any
+	if err := json.Unmarshal([]byte(body), &v); err != nil {
+		return body
+	}
+
+	if !r.redactJSON(v) {
+		return body
+	}
+
+	var redacted strings.Builder
+	encoder := json.NewEncoder(&redacted)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		return Redacted
+	}
+
+	return strings.TrimSuffix(redacted.String(), "\n")
+}
+
+// redactJSON replaces the values of the redacted fields of a decoded JSON value in place,
+// reporting whether any were replaced.
+func (r *Redactor) redactJSON(v any) bool {
+	redacted := false
+
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if r.IsField(key) {
+				v[key] = Redacted
+				redacted = true
+				continue
+			}
+			redacted = r.redactJSON(value) || redacted
+		}
+
+		if location, ok := v["location"].(string); ok {
+			if _, ok = v["value"]; ok && r.IsField(location[strings.LastIndex(location, ".")+1:]) {
+				v["value"] = Redacted
+				redacted = true
+			}
+		}
+	case []any:
+		for _, value := range v {
+			redacted = r.redactJSON(value) || redacted
+		}
+	}
+
+	return redacted
+}
+
+// Attr returns the log attribute with its redacted values replaced. Attributes of redacted
+// fields are replaced entirely, attributes in a header group are redacted as headers, and the
+// URL and body attributes which httplog writes are redacted as such.
+func (r *Redactor) Attr(groups []string, a slog.Attr) slog.Attr {
+	a.Value = a.Value.Resolve()
+
+	switch {
+	case r.IsField(a.Key):
+		return slog.String(a.Key, Redacted)
+	case len(groups) > 0 && groups[len(groups)-1] == headerGroup && r.IsHeader(a.Key):
+		return slog.String(a.Key, Redacted)
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindGroup:
+		attrs := a.Value.Group()
+		redacted := make([]slog.Attr, len(attrs))
+		for i, attr := range attrs {
+			redacted[i] = r.Attr(append(groups[:len(groups):len(groups)], a.Key), attr)
+		}
+		a.Value = slog.GroupValue(redacted...)
+	case slog.KindString:
+		switch a.Key {
+		case urlKey:
+			a.Value = slog.StringValue(r.URL(a.Value.String()))
+		case bodyKey:
+			a.Value = slog.StringValue(r.Body(a.Value.String()))
+		}
+	}
+
+	return a
+}
+
+// redactingHandler is a slog.Handler which redacts the attributes of records before passing
+// them to another handler.
+type redactingHandler struct {
+	handler  slog.Handler
+	redactor *Redactor
+	groups   []string
+}
+
+// NewRedactingHandler returns a slog.Handler which redacts the attributes of records with the
+// redactor before passing them to handler.
+func NewRedactingHandler(handler slog.Handler, redactor *Redactor) slog.Handler {
+	return &redactingHandler{handler: handler, redactor: redactor}
+}
+
+// Enabled reports whether the wrapped handler handles records of the level.
+func (h *redactingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.handler.Enabled(ctx, level)
+}
+
+// Handle redacts the attributes of the record and passes it to the wrapped handler.
+func (h *redactingHandler) Handle(ctx context.Context, record slog.Record) error {
+	redacted := slog.NewRecord(record.Time, record.Level, record.Message, record.PC)
+	record.Attrs(func(a slog.Attr) bool {
+		redacted.AddAttrs(h.redactor.Attr(h.groups, a))
+		return true
+	})
+
+	return h.handler.Handle(ctx, redacted)
+}
+
+// WithAttrs redacts the attributes and passes them to the wrapped handler.
+func (h *redactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		redacted[i] = h.redactor.Attr(h.groups, a)
+	}
+
+	return &redactingHandler{handler: h.handler.WithAttrs(redacted), redactor: h.redactor, groups: h.groups}
+}
+
+// WithGroup opens the group in the wrapped handler.
+func (h *redactingHandler) WithGroup(name string) slog.Handler {
+	return &redactingHandler{handler: h.handler.WithGroup(name), redactor: h.redactor, groups: append(h.groups[:len(h.groups):len(h.groups)], name)}
+}
@@ -0,0 +1,100 @@
+package logging
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRedactorBody(t *testing.T) {
+	r := NewRedactor(nil, []string{"card_number"})
+
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			name: "Field",
+			body: `{"email":"reader@example.com","password":"hunter22"}`,
+			want: `{"email":"reader@example.com","password":"***"}`,
+		},
+		{
+			name: "NestedConfiguredField",
+			body: `{"payment":{"Card_Number":"4242424242424242"}}`,
+			want: `{"payment":{"Card_Number":"***"}}`,
+		},
+		{
+			name: "ValidationError",
+			body: `{"errors":[{"location":"body.password","message":"expected length >= 8","value":"abc"},{"location":"body.name","value":"a"}]}`,
+			want: `{"errors":[{"location":"body.password","message":"expected length >= 8","value":"***"},{"location":"body.name","value":"a"}]}`,
+		},
+		{
+			name: "NothingRedacted",
+			body: `{"title": "Dune"}`,
+			want: `{"title": "Dune"}`,
+		},
+		{
+			name: "Truncated",
+			body: `{"password":"hun`,
+			want: `{"password":"hun`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.Body(tt.body); got != tt.want {
+				t.Errorf("Body(%s) = %s; want %s", tt.body, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactorURL(t *testing.T) {
+	r := NewRedactor(nil, nil)
+
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{url: "http://localhost/books?title=dune", want: "http://localhost/books?title=dune"},
+		{url: "http://localhost/feeds/loans.ics?token=secret-token", want: "http://localhost/feeds/loans.ics?token=%2A%2A%2A"},
+		{url: "http://localhost/books", want: "http://localhost/books"},
+	}
+
+	for _, tt := range tests {
+		if got := r.URL(tt.url); got != tt.want {
+			t.Errorf("URL(%s) = %s; want %s", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestRedactingHandler(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewRedactor([]string{"X-Session"}, nil)
+	logger := slog.New(NewRedactingHandler(slog.NewJSONHandler(&buf, nil), r))
+
+	header := r.Headers(http.Header{"Authorization": {"Bearer secret-jwt"}, "X-Session": {"secret-session"}, "Accept": {"application/json"}})
+	if header.Get("Authorization") != Redacted || header.Get("X-Session") != Redacted || header.Get("Accept") != "application/json" {
+		t.Errorf("Headers() = %v; want Authorization and X-Session redacted", header)
+	}
+
+	logger.With(slog.Group("httpRequest",
+		slog.String("url", "http://localhost/files/1?token=secret-download"),
+		slog.Group("header", slog.String("x-session", "secret-session"), slog.String("accept", "application/json")),
+	)).Error("Response: 422 Unprocessable Entity",
+		slog.Group("httpResponse", slog.String("body", `{"password":"secret-password"}`)),
+		slog.String("token", "secret-token"),
+	)
+
+	for _, secret := range []string{"secret-download", "secret-session", "secret-password", "secret-token"} {
+		if strings.Contains(buf.String(), secret) {
+			t.Errorf("log %s contains %s", buf.String(), secret)
+		}
+	}
+	if !strings.Contains(buf.String(), "application/json") {
+		t.Errorf("log %s does not contain the accept header", buf.String())
+	}
+}
@@ -0,0 +1,115 @@
+package mailer
+
+import (
+	"fmt"
+	"time"
+)
+
+// ActivationData is the data of the activation email.
+type ActivationData struct {
+	Name      string
+	Token     string
+	ExpiresAt time.Time
+}
+
+// PasswordResetData is the data of the password reset email.
+type PasswordResetData struct {
+	Name      string
+	Token     string
+	ExpiresAt time.Time
+}
+
+// LoanData is the data of the borrowed, due soon and overdue emails. DaysOverdue and Fine are only
+// set for overdue loans.
+type LoanData struct {
+	Name        string
+	Title       string
+	DueDate     time.Time
+	DaysOverdue int
+	Fine        float64
+}
+
+// HoldReadyData is the data of the hold ready email.
+type HoldReadyData struct {
+	Name     string
+	Title    string
+	PickupBy time.Time
+}
+
+// OverdueReportData is the data of the overdue report email, which is sent to librarians with the
+// overdue items attached.
+type OverdueReportData struct {
+	Name        string
+	GeneratedAt time.Time
+	Loans       int
+	Patrons     int
+	Books       int
+	Fines       float64
+}
+
+// SavedSearchData is the data of the email of a scheduled saved search, which is sent to its
+// recipients with its results attached.
+type SavedSearchData struct {
+	Name        string
+	Search      string
+	GeneratedAt time.Time
+}
+
+// ReservationData is the data of the reservation confirmed and canceled emails. Reason is only set
+// for reservations which an admin canceled.
+type ReservationData struct {
+	Name     string
+	Resource string
+	StartsAt time.Time
+	EndsAt   time.Time
+	Reason   string
+}
+
+// ProgramData is the data of the emails of the programs which patrons registered to. Promoted is
+// set for patrons who were registered from the waitlist, and Position is the place of a waitlisted
+// patron in the waitlist.
+type ProgramData struct {
+	Name     string
+	Program  string
+	Location string
+	StartsAt time.Time
+	EndsAt   time.Time
+	Promoted bool
+	Position int
+}
+
+// SampleData returns example data for the template with the given name, to preview it.
+func SampleData(name string, now time.Time) (any, error) {
+	switch name {
+	case ActivationTemplate:
+		return ActivationData{Name: "Noa Levi", Token: "Y3QMGX3PJ3WLRL2YRTQGQ6KRHU", ExpiresAt: now.Add(3 * 24 * time.Hour)}, nil
+	case PasswordResetTemplate:
+		return PasswordResetData{Name: "Noa Levi", Token: "Y3QMGX3PJ3WLRL2YRTQGQ6KRHU", ExpiresAt: now.Add(45 * time.Minute)}, nil
+	case DueSoonTemplate:
+		return LoanData{Name: "Noa Levi", Title: "The Great Adventure", DueDate: now.Add(2 * 24 * time.Hour)}, nil
+	case OverdueTemplate:
+		return LoanData{Name: "Noa Levi", Title: "The Great Adventure", DueDate: now.Add(-3 * 24 * time.Hour), DaysOverdue: 3, Fine: 30}, nil
+	case BorrowedTemplate:
+		return LoanData{Name: "Noa Levi", Title: "The Great Adventure", DueDate: now.Add(14 * 24 * time.Hour)}, nil
+	case HoldReadyTemplate:
+		return HoldReadyData{Name: "Noa Levi", Title: "The Great Adventure", PickupBy: now.Add(7 * 24 * time.Hour)}, nil
+	case OverdueReportTemplate:
+		return OverdueReportData{Name: "Noa Levi", GeneratedAt: now, Loans: 12, Patrons: 8, Books: 11, Fines: 340}, nil
+	case SavedSearchTemplate:
+		return SavedSearchData{Name: "Noa Levi", Search: "Overdue loans of class 7B", GeneratedAt: now}, nil
+	case ReservationConfirmedTemplate:
+		return ReservationData{Name: "Noa Levi", Resource: "Study Room 2", StartsAt: now.Add(24 * time.Hour), EndsAt: now.Add(26 * time.Hour)}, nil
+	case ReservationCanceledTemplate:
+		return ReservationData{Name: "Noa Levi", Resource: "Study Room 2", StartsAt: now.Add(24 * time.Hour), EndsAt: now.Add(26 * time.Hour), Reason: "The room is closed for maintenance"}, nil
+	case ProgramRegisteredTemplate:
+		return ProgramData{Name: "Noa Levi", Program: "Story Hour", Location: "Children's Room", StartsAt: now.Add(48 * time.Hour), EndsAt: now.Add(49 * time.Hour), Promoted: true}, nil
+	case ProgramWaitlistedTemplate:
+		return ProgramData{Name: "Noa Levi", Program: "Story Hour", Location: "Children's Room", StartsAt: now.Add(48 * time.Hour), EndsAt: now.Add(49 * time.Hour), Position: 3}, nil
+	case ProgramReminderTemplate:
+		return ProgramData{Name: "Noa Levi", Program: "Story Hour", Location: "Children's Room", StartsAt: now.Add(24 * time.Hour), EndsAt: now.Add(25 * time.Hour)}, nil
+	case ProgramCanceledTemplate:
+		return ProgramData{Name: "Noa Levi", Program: "Story Hour", Location: "Children's Room", StartsAt: now.Add(48 * time.Hour), EndsAt: now.Add(49 * time.Hour)}, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownTemplate, name)
+	}
+}
@@ -0,0 +1,22 @@
+package mailer
+
+import (
+	"context"
+	"github.com/mzeevi/library/internal/logging"
+)
+
+// LogSender logs emails instead of sending them, for development without an SMTP server.
+type LogSender struct{}
+
+// Send logs the recipient, subject, plain text body and attachment names of a message.
+func (LogSender) Send(ctx context.Context, msg *Message) error {
+	attachments := make([]string, 0, len(msg.Attachments))
+	for _, attachment := range msg.Attachments {
+		attachments = append(attachments, attachment.Filename)
+	}
+
+	logging.FromContext(ctx).Info("email not sent, no smtp server is configured",
+		"to", msg.To, "subject", msg.Subject, "body", msg.PlainBody, "attachments", attachments)
+
+	return nil
+}
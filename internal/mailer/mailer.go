@@ -0,0 +1,243 @@
+// Package mailer renders and sends emails to patrons. Every email has a template in
+// templates/<locale>/<name>.tmpl which defines its "subject", "plainBody" and "htmlBody",
+// and falls back to the default locale if it has no variant in the requested locale.
+// Templates may also define an "sms", a short text for patrons notified by text message.
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	texttemplate "text/template"
+)
+
+// DefaultLocale is the locale which every template has.
+const DefaultLocale = "en"
+
+// Names of the email templates.
+const (
+	ActivationTemplate    = "activation"
+	PasswordResetTemplate = "password_reset"
+	DueSoonTemplate       = "due_soon"
+	OverdueTemplate       = "overdue"
+	HoldReadyTemplate     = "hold_ready"
+	BorrowedTemplate      = "borrowed"
+	OverdueReportTemplate = "overdue_report"
+	SavedSearchTemplate   = "saved_search"
+
+	ReservationConfirmedTemplate = "reservation_confirmed"
+	ReservationCanceledTemplate  = "reservation_canceled"
+	ProgramRegisteredTemplate    = "program_registered"
+	ProgramWaitlistedTemplate    = "program_waitlisted"
+	ProgramReminderTemplate      = "program_reminder"
+	ProgramCanceledTemplate      = "program_canceled"
+)
+
+// Templates are the names of all email templates.
+var Templates = []string{ActivationTemplate, PasswordResetTemplate, DueSoonTemplate, OverdueTemplate, HoldReadyTemplate, BorrowedTemplate, OverdueReportTemplate, SavedSearchTemplate, ReservationConfirmedTemplate, ReservationCanceledTemplate, ProgramRegisteredTemplate, ProgramWaitlistedTemplate, ProgramReminderTemplate, ProgramCanceledTemplate}
+
+var (
+	ErrUnknownTemplate = errors.New("unknown email template")
+	ErrNoSMS           = errors.New("template has no sms text")
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+// Message is a rendered email.
+type Message struct {
+	To          string       `json:"-"`
+	Subject     string       `json:"subject"`
+	PlainBody   string       `json:"plain_body"`
+	HTMLBody    string       `json:"html_body"`
+	Attachments []Attachment `json:"-"`
+}
+
+// Attachment is a file attached to an email.
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// Sender delivers rendered emails.
+type Sender interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// emailTemplate is a template parsed for its plain text and HTML parts.
+type emailTemplate struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+// Mailer renders emails from the embedded templates and sends them with a Sender.
+type Mailer struct {
+	sender        Sender
+	defaultLocale string
+	// templates maps a locale to the templates which have a variant in it.
+	templates map[string]map[string]emailTemplate
+}
+
+// New parses the embedded templates and creates a Mailer which sends emails with sender.
+// Emails are rendered in defaultLocale if no other locale is requested.
+func New(sender Sender, defaultLocale string) (*Mailer, error) {
+	m := &Mailer{
+		sender:    sender,
+		templates: make(map[string]map[string]emailTemplate),
+	}
+
+	files, err := fs.Glob(templateFS, "templates/*/*.tmpl")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		locale := path.Base(path.Dir(file))
+		name := strings.TrimSuffix(path.Base(file), ".tmpl")
+
+		text, err := texttemplate.New("").ParseFS(templateFS, file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse template %s: %v", file, err)
+		}
+
+		html, err := htmltemplate.New("").ParseFS(templateFS, file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse template %s: %v", file, err)
+		}
+
+		if m.templates[locale] == nil {
+			m.templates[locale] = make(map[string]emailTemplate)
+		}
+		m.templates[locale][name] = emailTemplate{text: text, html: html}
+	}
+
+	for _, name := range Templates {
+		if _, ok := m.templates[DefaultLocale][name]; !ok {
+			return nil, fmt.Errorf("template %s has no %s variant", name, DefaultLocale)
+		}
+	}
+
+	if _, ok := m.templates[defaultLocale]; !ok {
+		return nil, fmt.Errorf("unsupported locale %q, supported locales are %s", defaultLocale, strings.Join(m.Locales(), ", "))
+	}
+	m.defaultLocale = defaultLocale
+
+	return m, nil
+}
+
+// Locales returns the sorted locales which have templates.
+func (m *Mailer) Locales() []string {
+	locales := make([]string, 0, len(m.templates))
+	for locale := range m.templates {
+		locales = append(locales, locale)
+	}
+	slices.Sort(locales)
+
+	return locales
+}
+
+// Locale returns the first supported locale of an Accept-Language header, ignoring regions
+// and weights, or the default locale if none is supported.
+func (m *Mailer) Locale(acceptLanguage string) string {
+	for _, tag := range strings.Split(acceptLanguage, ",") {
+		tag, _, _ = strings.Cut(tag, ";")
+		tag, _, _ = strings.Cut(strings.TrimSpace(tag), "-")
+
+		if locale := strings.ToLower(tag); m.templates[locale] != nil {
+			return locale
+		}
+	}
+
+	return m.defaultLocale
+}
+
+// Render renders the template with the given name for a locale, falling back to the default
+// locale and then to DefaultLocale if the template has no variant in it.
+func (m *Mailer) Render(name, locale string, data any) (*Message, error) {
+	tmpl, err := m.lookup(name, locale)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &Message{}
+	parts := []struct {
+		execute func(*bytes.Buffer) error
+		dst     *string
+	}{
+		{execute: func(b *bytes.Buffer) error { return tmpl.text.ExecuteTemplate(b, "subject", data) }, dst: &msg.Subject},
+		{execute: func(b *bytes.Buffer) error { return tmpl.text.ExecuteTemplate(b, "plainBody", data) }, dst: &msg.PlainBody},
+		{execute: func(b *bytes.Buffer) error { return tmpl.html.ExecuteTemplate(b, "htmlBody", data) }, dst: &msg.HTMLBody},
+	}
+
+	for _, part := range parts {
+		var b bytes.Buffer
+		if err := part.execute(&b); err != nil {
+			return nil, fmt.Errorf("failed to render template %s: %v", name, err)
+		}
+		*part.dst = strings.TrimSpace(b.String())
+	}
+
+	return msg, nil
+}
+
+// RenderSMS renders the "sms" text of the template with the given name for a locale, with the
+// same fallbacks as Render. ErrNoSMS is returned if the template has no text.
+func (m *Mailer) RenderSMS(name, locale string, data any) (string, error) {
+	tmpl, err := m.lookup(name, locale)
+	if err != nil {
+		return "", err
+	}
+
+	if tmpl.text.Lookup("sms") == nil {
+		return "", fmt.Errorf("%w: %s", ErrNoSMS, name)
+	}
+
+	var b bytes.Buffer
+	if err = tmpl.text.ExecuteTemplate(&b, "sms", data); err != nil {
+		return "", fmt.Errorf("failed to render template %s: %v", name, err)
+	}
+
+	return strings.TrimSpace(b.String()), nil
+}
+
+// lookup returns the template with the given name for a locale, falling back to the default
+// locale and then to DefaultLocale.
+func (m *Mailer) lookup(name, locale string) (emailTemplate, error) {
+	if !slices.Contains(Templates, name) {
+		return emailTemplate{}, fmt.Errorf("%w: %s", ErrUnknownTemplate, name)
+	}
+
+	tmpl, ok := m.templates[locale][name]
+	if !ok {
+		tmpl, ok = m.templates[m.defaultLocale][name]
+	}
+	if !ok {
+		tmpl = m.templates[DefaultLocale][name]
+	}
+
+	return tmpl, nil
+}
+
+// Send renders the template with the given name for a locale and sends it to recipient.
+func (m *Mailer) Send(ctx context.Context, recipient, name, locale string, data any) error {
+	msg, err := m.Render(name, locale, data)
+	if err != nil {
+		return err
+	}
+	msg.To = recipient
+
+	return m.Deliver(ctx, msg)
+}
+
+// Deliver sends a rendered message.
+func (m *Mailer) Deliver(ctx context.Context, msg *Message) error {
+	return m.sender.Send(ctx, msg)
+}
@@ -0,0 +1,281 @@
+package mailer
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recordingSender records the messages it is asked to send.
+type recordingSender struct {
+	messages []*Message
+}
+
+func (s *recordingSender) Send(_ context.Context, msg *Message) error {
+	s.messages = append(s.messages, msg)
+	return nil
+}
+
+func TestRenderAllTemplates(t *testing.T) {
+	m, err := New(&recordingSender{}, DefaultLocale)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	now := time.Date(2024, time.December, 10, 12, 0, 0, 0, time.UTC)
+
+	for _, locale := range m.Locales() {
+		for _, name := range Templates {
+			t.Run(locale+"/"+name, func(t *testing.T) {
+				data, err := SampleData(name, now)
+				if err != nil {
+					t.Fatalf("SampleData() error = %v", err)
+				}
+
+				msg, err := m.Render(name, locale, data)
+				if err != nil {
+					t.Fatalf("Render() error = %v", err)
+				}
+
+				for part, value := range map[string]string{"subject": msg.Subject, "plain body": msg.PlainBody, "html body": msg.HTMLBody} {
+					if value == "" {
+						t.Errorf("Render() %s is empty", part)
+					}
+					if strings.Contains(value, "<no value>") {
+						t.Errorf("Render() %s = %q; has a missing value", part, value)
+					}
+				}
+
+				if strings.Contains(msg.Subject, "\n") {
+					t.Errorf("Render() subject = %q; must be a single line", msg.Subject)
+				}
+				if !strings.Contains(msg.PlainBody, "Noa Levi") || !strings.Contains(msg.HTMLBody, "Noa Levi") {
+					t.Errorf("Render() bodies don't include the patron name")
+				}
+			})
+		}
+	}
+}
+
+func TestRenderLocale(t *testing.T) {
+	m, err := New(&recordingSender{}, DefaultLocale)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	data := ActivationData{Name: "Noa", Token: "TOKEN", ExpiresAt: time.Now()}
+
+	he, err := m.Render(ActivationTemplate, "he", data)
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if !strings.Contains(he.HTMLBody, `dir="rtl"`) {
+		t.Errorf("Render() in he html body = %q; want a right to left document", he.HTMLBody)
+	}
+
+	unknown, err := m.Render(ActivationTemplate, "xx", data)
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	en, _ := m.Render(ActivationTemplate, DefaultLocale, data)
+	if unknown.Subject != en.Subject {
+		t.Errorf("Render() in an unknown locale subject = %q; want the default locale subject %q", unknown.Subject, en.Subject)
+	}
+
+	if _, err := m.Render("unknown", DefaultLocale, data); !errors.Is(err, ErrUnknownTemplate) {
+		t.Errorf("Render() of an unknown template error = %v; want %v", err, ErrUnknownTemplate)
+	}
+}
+
+func TestRenderEscapesHTML(t *testing.T) {
+	m, err := New(&recordingSender{}, DefaultLocale)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	msg, err := m.Render(DueSoonTemplate, DefaultLocale, LoanData{Name: "O'Brien", Title: "<script>", DueDate: time.Now()})
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+
+	if strings.Contains(msg.HTMLBody, "<script>") {
+		t.Errorf("Render() html body = %q; want the title escaped", msg.HTMLBody)
+	}
+	if !strings.Contains(msg.PlainBody, "O'Brien") || !strings.Contains(msg.PlainBody, "<script>") {
+		t.Errorf("Render() plain body = %q; want the name and title unescaped", msg.PlainBody)
+	}
+}
+
+func TestRenderSMS(t *testing.T) {
+	m, err := New(&recordingSender{}, DefaultLocale)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	now := time.Date(2024, time.December, 10, 12, 0, 0, 0, time.UTC)
+
+	for _, locale := range m.Locales() {
+		for _, name := range []string{DueSoonTemplate, OverdueTemplate, HoldReadyTemplate} {
+			data, _ := SampleData(name, now)
+
+			text, err := m.RenderSMS(name, locale, data)
+			if err != nil {
+				t.Fatalf("RenderSMS(%s, %s) error = %v", name, locale, err)
+			}
+			if text == "" || strings.Contains(text, "\n") || !strings.Contains(text, "The Great Adventure") {
+				t.Errorf("RenderSMS(%s, %s) = %q; want a single line with the title", name, locale, text)
+			}
+		}
+	}
+
+	if _, err := m.RenderSMS(ActivationTemplate, DefaultLocale, ActivationData{}); !errors.Is(err, ErrNoSMS) {
+		t.Errorf("RenderSMS() of a template without a text error = %v; want %v", err, ErrNoSMS)
+	}
+}
+
+func TestNewUnsupportedLocale(t *testing.T) {
+	if _, err := New(&recordingSender{}, "xx"); err == nil {
+		t.Errorf("New() with an unsupported locale error = nil; want an error")
+	}
+}
+
+func TestLocale(t *testing.T) {
+	m, err := New(&recordingSender{}, DefaultLocale)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	tests := []struct {
+		acceptLanguage string
+		want           string
+	}{
+		{acceptLanguage: "", want: DefaultLocale},
+		{acceptLanguage: "he", want: "he"},
+		{acceptLanguage: "he-IL,he;q=0.9,en;q=0.8", want: "he"},
+		{acceptLanguage: "fr-FR, en;q=0.5", want: "en"},
+		{acceptLanguage: "fr", want: DefaultLocale},
+	}
+
+	for _, tt := range tests {
+		if got := m.Locale(tt.acceptLanguage); got != tt.want {
+			t.Errorf("Locale(%q) = %q; want %q", tt.acceptLanguage, got, tt.want)
+		}
+	}
+}
+
+func TestSend(t *testing.T) {
+	sender := &recordingSender{}
+	m, err := New(sender, "he")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if err := m.Send(context.Background(), "noa@example.com", ActivationTemplate, "", ActivationData{Name: "Noa"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	if len(sender.messages) != 1 || sender.messages[0].To != "noa@example.com" {
+		t.Fatalf("Send() sent %v; want one message to noa@example.com", sender.messages)
+	}
+	if !strings.Contains(sender.messages[0].HTMLBody, `lang="he"`) {
+		t.Errorf("Send() without a locale didn't use the default locale of the Mailer")
+	}
+}
+
+func TestEncodeMessage(t *testing.T) {
+	msg := &Message{To: "noa@example.com", Subject: "ברוכים הבאים", PlainBody: "plain", HTMLBody: "<p>html</p>"}
+
+	encoded, err := encodeMessage("Library <no-reply@library.com>", msg, time.Now())
+	if err != nil {
+		t.Fatalf("encodeMessage() error = %v", err)
+	}
+
+	parsed, err := mail.ReadMessage(strings.NewReader(string(encoded)))
+	if err != nil {
+		t.Fatalf("failed to parse encoded message: %v", err)
+	}
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if err != nil || subject != msg.Subject {
+		t.Errorf("Subject = %q, %v; want %q", subject, err, msg.Subject)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q, %v; want multipart/alternative", mediaType, err)
+	}
+
+	reader := multipart.NewReader(parsed.Body, params["boundary"])
+	for _, want := range []struct{ contentType, body string }{
+		{contentType: "text/plain; charset=utf-8", body: msg.PlainBody},
+		{contentType: "text/html; charset=utf-8", body: msg.HTMLBody},
+	} {
+		part, err := reader.NextPart()
+		if err != nil {
+			t.Fatalf("NextPart() error = %v", err)
+		}
+
+		body, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatalf("failed to read part: %v", err)
+		}
+
+		if got := part.Header.Get("Content-Type"); got != want.contentType || string(body) != want.body {
+			t.Errorf("part = %q %q; want %q %q", got, body, want.contentType, want.body)
+		}
+	}
+}
+
+func TestEncodeMessageAttachments(t *testing.T) {
+	attachment := Attachment{Filename: "overdue-patrons.csv", ContentType: "text/csv", Data: []byte(strings.Repeat("id,name\n", 20))}
+	msg := &Message{To: "noa@example.com", Subject: "Report", PlainBody: "plain", HTMLBody: "<p>html</p>", Attachments: []Attachment{attachment}}
+
+	encoded, err := encodeMessage("Library <no-reply@library.com>", msg, time.Now())
+	if err != nil {
+		t.Fatalf("encodeMessage() error = %v", err)
+	}
+
+	parsed, err := mail.ReadMessage(strings.NewReader(string(encoded)))
+	if err != nil {
+		t.Fatalf("failed to parse encoded message: %v", err)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		t.Fatalf("Content-Type = %q, %v; want multipart/mixed", mediaType, err)
+	}
+
+	reader := multipart.NewReader(parsed.Body, params["boundary"])
+
+	body, err := reader.NextPart()
+	if err != nil {
+		t.Fatalf("NextPart() error = %v", err)
+	}
+	if mediaType, _, err = mime.ParseMediaType(body.Header.Get("Content-Type")); err != nil || mediaType != "multipart/alternative" {
+		t.Errorf("first part Content-Type = %q, %v; want multipart/alternative", mediaType, err)
+	}
+
+	part, err := reader.NextPart()
+	if err != nil {
+		t.Fatalf("NextPart() error = %v", err)
+	}
+
+	if got := part.FileName(); got != attachment.Filename {
+		t.Errorf("attachment filename = %q; want %q", got, attachment.Filename)
+	}
+
+	decoded, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, part))
+	if err != nil {
+		t.Fatalf("failed to decode attachment: %v", err)
+	}
+	if string(decoded) != string(attachment.Data) {
+		t.Errorf("attachment = %q; want %q", decoded, attachment.Data)
+	}
+}
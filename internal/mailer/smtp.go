@@ -0,0 +1,206 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"time"
+)
+
+// SMTPSender sends emails through an SMTP server, using STARTTLS if the server supports it.
+type SMTPSender struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	// From is the sender address, such as "Library <no-reply@library.com>".
+	From string
+}
+
+// Send sends a message, aborting when the context is done.
+func (s *SMTPSender) Send(ctx context.Context, msg *Message) error {
+	body, err := encodeMessage(s.From, msg, time.Now())
+	if err != nil {
+		return err
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(s.Host, strconv.Itoa(s.Port)))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err = conn.SetDeadline(deadline); err != nil {
+			return err
+		}
+	}
+
+	client, err := smtp.NewClient(conn, s.Host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err = client.StartTLS(&tls.Config{ServerName: s.Host}); err != nil {
+			return err
+		}
+	}
+
+	if s.Username != "" {
+		if err = client.Auth(smtp.PlainAuth("", s.Username, s.Password, s.Host)); err != nil {
+			return err
+		}
+	}
+
+	from, err := mail.ParseAddress(s.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender address: %v", err)
+	}
+
+	if err = client.Mail(from.Address); err != nil {
+		return err
+	}
+	if err = client.Rcpt(msg.To); err != nil {
+		return err
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(body); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+// encodeMessage encodes a message as a multipart/alternative email with a plain text and an HTML part.
+// A message with attachments is encoded as a multipart/mixed email, whose first part is the
+// multipart/alternative body.
+func encodeMessage(from string, msg *Message, date time.Time) ([]byte, error) {
+	var b bytes.Buffer
+	w := multipart.NewWriter(&b)
+
+	contentType := fmt.Sprintf("multipart/alternative; boundary=%q", w.Boundary())
+	if len(msg.Attachments) > 0 {
+		contentType = fmt.Sprintf("multipart/mixed; boundary=%q", w.Boundary())
+	}
+
+	headers := []struct{ key, value string }{
+		{key: "From", value: from},
+		{key: "To", value: msg.To},
+		{key: "Subject", value: mime.QEncoding.Encode("utf-8", msg.Subject)},
+		{key: "Date", value: date.Format(time.RFC1123Z)},
+		{key: "MIME-Version", value: "1.0"},
+		{key: "Content-Type", value: contentType},
+	}
+	for _, header := range headers {
+		fmt.Fprintf(&b, "%s: %s\r\n", header.key, header.value)
+	}
+	b.WriteString("\r\n")
+
+	if len(msg.Attachments) == 0 {
+		if err := writeAlternative(w, msg); err != nil {
+			return nil, err
+		}
+		return b.Bytes(), nil
+	}
+
+	var alternative bytes.Buffer
+	aw := multipart.NewWriter(&alternative)
+	if err := writeAlternative(aw, msg); err != nil {
+		return nil, err
+	}
+
+	pw, err := w.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {fmt.Sprintf("multipart/alternative; boundary=%q", aw.Boundary())},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err = pw.Write(alternative.Bytes()); err != nil {
+		return nil, err
+	}
+
+	for _, attachment := range msg.Attachments {
+		pw, err = w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {attachment.ContentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename})},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if err = writeBase64(pw, attachment.Data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+// writeAlternative writes the plain text and HTML parts of a message and closes w.
+func writeAlternative(w *multipart.Writer, msg *Message) error {
+	parts := []struct{ contentType, body string }{
+		{contentType: "text/plain; charset=utf-8", body: msg.PlainBody},
+		{contentType: "text/html; charset=utf-8", body: msg.HTMLBody},
+	}
+	for _, part := range parts {
+		pw, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return err
+		}
+
+		qw := quotedprintable.NewWriter(pw)
+		if _, err = qw.Write([]byte(part.body)); err != nil {
+			return err
+		}
+		if err = qw.Close(); err != nil {
+			return err
+		}
+	}
+
+	return w.Close()
+}
+
+// writeBase64 writes data encoded in base64, in lines of at most 76 characters as required by MIME.
+func writeBase64(w io.Writer, data []byte) error {
+	const lineLength = 76
+
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 0 {
+		n := min(lineLength, len(encoded))
+		if _, err := io.WriteString(w, encoded[:n]+"\r\n"); err != nil {
+			return err
+		}
+		encoded = encoded[n:]
+	}
+
+	return nil
+}
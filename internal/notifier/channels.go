@@ -0,0 +1,60 @@
+package notifier
+
+import (
+	"context"
+	"github.com/mzeevi/library/internal/mailer"
+)
+
+// EmailChannel delivers notifications by email.
+type EmailChannel struct {
+	Mailer *mailer.Mailer
+}
+
+// Render renders the email of a template for the email address of recipient.
+func (c *EmailChannel) Render(recipient Recipient, template string, data any) (*Message, error) {
+	if recipient.Email == "" {
+		return nil, ErrNoAddress
+	}
+
+	email, err := c.Mailer.Render(template, recipient.Locale, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Message{To: recipient.Email, Subject: email.Subject, Body: email.PlainBody, HTMLBody: email.HTMLBody}, nil
+}
+
+// Deliver sends a rendered email.
+func (c *EmailChannel) Deliver(ctx context.Context, msg *Message) error {
+	return c.Mailer.Deliver(ctx, &mailer.Message{To: msg.To, Subject: msg.Subject, PlainBody: msg.Body, HTMLBody: msg.HTMLBody})
+}
+
+// SMSSender delivers text messages.
+type SMSSender interface {
+	SendSMS(ctx context.Context, to, body string) error
+}
+
+// SMSChannel delivers notifications by text message, rendered from the "sms" text of a template.
+type SMSChannel struct {
+	Mailer *mailer.Mailer
+	Sender SMSSender
+}
+
+// Render renders the text of a template for the phone number of recipient.
+func (c *SMSChannel) Render(recipient Recipient, template string, data any) (*Message, error) {
+	if recipient.Phone == "" {
+		return nil, ErrNoAddress
+	}
+
+	body, err := c.Mailer.RenderSMS(template, recipient.Locale, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Message{To: recipient.Phone, Body: body}, nil
+}
+
+// Deliver sends a rendered text message.
+func (c *SMSChannel) Deliver(ctx context.Context, msg *Message) error {
+	return c.Sender.SendSMS(ctx, msg.To, msg.Body)
+}
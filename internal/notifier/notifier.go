@@ -0,0 +1,108 @@
+// Package notifier notifies patrons over the channel they prefer, such as email or text message.
+// Notifications are rendered from the templates of the mailer package.
+package notifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Names of the notification channels.
+const (
+	Email = "email"
+	SMS   = "sms"
+)
+
+// Channels are the names of all notification channels.
+var Channels = []string{Email, SMS}
+
+var (
+	ErrUnknownChannel = errors.New("unknown notification channel")
+	ErrNoAddress      = errors.New("recipient has no address on the channel")
+)
+
+// Recipient is a patron to notify.
+type Recipient struct {
+	Email string
+	Phone string
+	// Locale is the locale to render the notification in, the default locale if empty.
+	Locale string
+}
+
+// Message is a notification rendered for a channel, which can be delivered again if delivery fails.
+// To is the address of the recipient on the channel, and HTMLBody is only set by channels which support HTML.
+type Message struct {
+	Channel  string
+	To       string
+	Subject  string
+	Body     string
+	HTMLBody string
+}
+
+// Channel renders notifications from a template and delivers them.
+type Channel interface {
+	Render(recipient Recipient, template string, data any) (*Message, error)
+	Deliver(ctx context.Context, msg *Message) error
+}
+
+// Notifier delivers notifications over the channel of each recipient.
+type Notifier struct {
+	channels map[string]Channel
+}
+
+// New creates a Notifier which delivers notifications over the given channels, keyed by their names.
+func New(channels map[string]Channel) *Notifier {
+	return &Notifier{channels: channels}
+}
+
+// Render renders the template with the given name for recipient on a channel.
+// Notifications are rendered for email if channel is empty.
+func (n *Notifier) Render(channel string, recipient Recipient, template string, data any) (*Message, error) {
+	if channel == "" {
+		channel = Email
+	}
+
+	c, err := n.channel(channel)
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := c.Render(recipient, template, data)
+	if err != nil {
+		return nil, err
+	}
+	msg.Channel = channel
+
+	return msg, nil
+}
+
+// Deliver delivers a rendered message over its channel.
+func (n *Notifier) Deliver(ctx context.Context, msg *Message) error {
+	c, err := n.channel(msg.Channel)
+	if err != nil {
+		return err
+	}
+
+	return c.Deliver(ctx, msg)
+}
+
+// Notify renders the template with the given name and delivers it to recipient over a channel.
+func (n *Notifier) Notify(ctx context.Context, channel string, recipient Recipient, template string, data any) error {
+	msg, err := n.Render(channel, recipient, template, data)
+	if err != nil {
+		return err
+	}
+
+	return n.Deliver(ctx, msg)
+}
+
+// channel returns the Channel with the given name.
+func (n *Notifier) channel(name string) (Channel, error) {
+	c, ok := n.channels[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownChannel, name)
+	}
+
+	return c, nil
+}
@@ -0,0 +1,141 @@
+package notifier
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/mzeevi/library/internal/mailer"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recordingSMSSender records the text messages it is asked to send.
+type recordingSMSSender struct {
+	to, body []string
+}
+
+func (s *recordingSMSSender) SendSMS(_ context.Context, to, body string) error {
+	s.to = append(s.to, to)
+	s.body = append(s.body, body)
+	return nil
+}
+
+// recordingEmailSender records the emails it is asked to send.
+type recordingEmailSender struct {
+	messages []*mailer.Message
+}
+
+func (s *recordingEmailSender) Send(_ context.Context, msg *mailer.Message) error {
+	s.messages = append(s.messages, msg)
+	return nil
+}
+
+func TestNotify(t *testing.T) {
+	emails := &recordingEmailSender{}
+	m, err := mailer.New(emails, mailer.DefaultLocale)
+	if err != nil {
+		t.Fatalf("mailer.New() error = %v", err)
+	}
+	texts := &recordingSMSSender{}
+
+	n := New(map[string]Channel{
+		Email: &EmailChannel{Mailer: m},
+		SMS:   &SMSChannel{Mailer: m, Sender: texts},
+	})
+
+	recipient := Recipient{Email: "noa@example.com", Phone: "+972501234567", Locale: "he"}
+	data := mailer.LoanData{Name: "Noa", Title: "Dune", DueDate: time.Now()}
+
+	if err = n.Notify(context.Background(), "", recipient, mailer.DueSoonTemplate, data); err != nil {
+		t.Fatalf("Notify() without a channel error = %v", err)
+	}
+	if len(emails.messages) != 1 || emails.messages[0].To != recipient.Email {
+		t.Errorf("Notify() without a channel sent emails %v; want one to %s", emails.messages, recipient.Email)
+	}
+
+	if err = n.Notify(context.Background(), SMS, recipient, mailer.DueSoonTemplate, data); err != nil {
+		t.Fatalf("Notify() by sms error = %v", err)
+	}
+	if len(texts.to) != 1 || texts.to[0] != recipient.Phone || !strings.Contains(texts.body[0], "הספרייה") {
+		t.Errorf("Notify() by sms sent %v %v; want one in he to %s", texts.to, texts.body, recipient.Phone)
+	}
+
+	if err = n.Notify(context.Background(), SMS, Recipient{Email: "noa@example.com"}, mailer.DueSoonTemplate, data); !errors.Is(err, ErrNoAddress) {
+		t.Errorf("Notify() by sms without a phone error = %v; want %v", err, ErrNoAddress)
+	}
+	if err = n.Notify(context.Background(), "pigeon", recipient, mailer.DueSoonTemplate, data); !errors.Is(err, ErrUnknownChannel) {
+		t.Errorf("Notify() by an unknown channel error = %v; want %v", err, ErrUnknownChannel)
+	}
+}
+
+func TestTwilioSender(t *testing.T) {
+	var got *http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("failed to parse form: %v", err)
+		}
+		got = r
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	s := &TwilioSender{AccountSID: "AC123", AuthToken: "secret", From: "+15005550006", BaseURL: srv.URL}
+	if err := s.SendSMS(context.Background(), "+972501234567", "hello"); err != nil {
+		t.Fatalf("SendSMS() error = %v", err)
+	}
+
+	if got.URL.Path != "/2010-04-01/Accounts/AC123/Messages.json" {
+		t.Errorf("path = %s; want the messages of the account", got.URL.Path)
+	}
+	if user, password, ok := got.BasicAuth(); !ok || user != "AC123" || password != "secret" {
+		t.Errorf("basic auth = %s:%s; want the account credentials", user, password)
+	}
+	if got.PostForm.Get("To") != "+972501234567" || got.PostForm.Get("From") != s.From || got.PostForm.Get("Body") != "hello" {
+		t.Errorf("form = %v; want To, From and Body", got.PostForm)
+	}
+}
+
+func TestWebhookSender(t *testing.T) {
+	var body []byte
+	var signature string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		signature = r.Header.Get(SignatureHeader)
+	}))
+	defer srv.Close()
+
+	s := &WebhookSender{URL: srv.URL, Secret: "secret"}
+	if err := s.SendSMS(context.Background(), "+972501234567", "hello"); err != nil {
+		t.Fatalf("SendSMS() error = %v", err)
+	}
+
+	var payload map[string]string
+	if err := json.Unmarshal(body, &payload); err != nil || payload["to"] != "+972501234567" || payload["body"] != "hello" {
+		t.Errorf("payload = %s, %v; want the phone and text", body, err)
+	}
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(body)
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); signature != want {
+		t.Errorf("signature = %q; want %q", signature, want)
+	}
+}
+
+func TestSenderError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message": "invalid number"}`, http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	err := (&WebhookSender{URL: srv.URL}).SendSMS(context.Background(), "+1", "hello")
+	if err == nil || !strings.Contains(err.Error(), "invalid number") {
+		t.Errorf("SendSMS() error = %v; want the error of the gateway", err)
+	}
+}
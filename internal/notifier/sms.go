@@ -0,0 +1,123 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/mzeevi/library/internal/logging"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	// TwilioBaseURL is the base URL of the Twilio REST API.
+	TwilioBaseURL = "https://api.twilio.com"
+	// SignatureHeader holds the HMAC-SHA256 of the body of webhook requests, when a secret is set.
+	SignatureHeader = "X-Library-Signature"
+)
+
+// maxErrorBody limits how much of an error response is read.
+const maxErrorBody = 4096
+
+// TwilioSender sends text messages with the Twilio Messages API.
+type TwilioSender struct {
+	AccountSID string
+	AuthToken  string
+	// From is the phone number or messaging service SID to send from.
+	From string
+	// BaseURL overrides TwilioBaseURL, for testing.
+	BaseURL string
+	Client  *http.Client
+}
+
+// SendSMS sends a text message to a phone number.
+func (s *TwilioSender) SendSMS(ctx context.Context, to, body string) error {
+	baseURL := s.BaseURL
+	if baseURL == "" {
+		baseURL = TwilioBaseURL
+	}
+
+	form := url.Values{"To": {to}, "Body": {body}}
+	if strings.HasPrefix(s.From, "MG") {
+		form.Set("MessagingServiceSid", s.From)
+	} else {
+		form.Set("From", s.From)
+	}
+
+	endpoint := fmt.Sprintf("%s/2010-04-01/Accounts/%s/Messages.json", baseURL, url.PathEscape(s.AccountSID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(s.AccountSID, s.AuthToken)
+
+	return do(s.Client, req)
+}
+
+// WebhookSender sends text messages by posting them as JSON to a gateway, which
+// receives {"to": "<phone>", "body": "<text>"}.
+type WebhookSender struct {
+	URL string
+	// Secret signs requests in SignatureHeader if set, so that the gateway can verify them.
+	Secret string
+	Client *http.Client
+}
+
+// SendSMS posts a text message to the webhook.
+func (s *WebhookSender) SendSMS(ctx context.Context, to, body string) error {
+	payload, err := json.Marshal(map[string]string{"to": to, "body": body})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if s.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(s.Secret))
+		mac.Write(payload)
+		req.Header.Set(SignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	return do(s.Client, req)
+}
+
+// LogSender logs text messages instead of sending them, for development without an SMS provider.
+type LogSender struct{}
+
+// SendSMS logs the recipient and body of a text message.
+func (LogSender) SendSMS(ctx context.Context, to, body string) error {
+	logging.FromContext(ctx).Info("sms not sent, no sms provider is configured", "to", to, "body", body)
+
+	return nil
+}
+
+// do sends a request, returning an error if the response status is not successful.
+func do(client *http.Client, req *http.Request) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return fmt.Errorf("failed to send sms, status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	return nil
+}
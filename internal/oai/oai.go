@@ -0,0 +1,314 @@
+// Package oai implements the responses of OAI-PMH 2.0, the Open Archives Initiative Protocol for
+// Metadata Harvesting, by which aggregators harvest the records of a repository incrementally.
+package oai
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"github.com/mzeevi/library/internal/dublincore"
+	"io"
+	"strings"
+	"time"
+)
+
+// ContentType is the media type of OAI-PMH responses.
+const ContentType = "text/xml; charset=utf-8"
+
+// ProtocolVersion is the supported version of OAI-PMH.
+const ProtocolVersion = "2.0"
+
+// Verbs of OAI-PMH.
+const (
+	VerbIdentify            = "Identify"
+	VerbListMetadataFormats = "ListMetadataFormats"
+	VerbListSets            = "ListSets"
+	VerbListIdentifiers     = "ListIdentifiers"
+	VerbListRecords         = "ListRecords"
+	VerbGetRecord           = "GetRecord"
+)
+
+// Error codes of OAI-PMH.
+const (
+	ErrorBadArgument             = "badArgument"
+	ErrorBadResumptionToken      = "badResumptionToken"
+	ErrorBadVerb                 = "badVerb"
+	ErrorCannotDisseminateFormat = "cannotDisseminateFormat"
+	ErrorIDDoesNotExist          = "idDoesNotExist"
+	ErrorNoRecordsMatch          = "noRecordsMatch"
+	ErrorNoSetHierarchy          = "noSetHierarchy"
+)
+
+// MetadataPrefixDC is the prefix of the Dublin Core metadata format, which every repository supports.
+const MetadataPrefixDC = "oai_dc"
+
+// Granularity is the granularity of datestamps, in seconds. Dates of days are accepted as well.
+const Granularity = "YYYY-MM-DDThh:mm:ssZ"
+
+const (
+	namespace         = "http://www.openarchives.org/OAI/2.0/"
+	schemaLocation    = "http://www.openarchives.org/OAI/2.0/ http://www.openarchives.org/OAI/2.0/OAI-PMH.xsd"
+	xsiNamespace      = "http://www.w3.org/2001/XMLSchema-instance"
+	dcNamespace       = "http://www.openarchives.org/OAI/2.0/oai_dc/"
+	dcSchema          = "http://www.openarchives.org/OAI/2.0/oai_dc.xsd"
+	datestampFormat   = "2006-01-02T15:04:05Z"
+	dayFormat         = time.DateOnly
+	deletedRecordNone = "no"
+)
+
+// ErrInvalidDatestamp is returned for a from or until argument which is not a datestamp.
+var ErrInvalidDatestamp = errors.New("invalid datestamp")
+
+// Error is an error of an OAI-PMH request, such as a missing argument.
+type Error struct {
+	Code    string `xml:"code,attr"`
+	Message string `xml:",chardata"`
+}
+
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// Request is the request which a response answers. Its arguments are omitted if the request
+// failed with a badVerb or a badArgument error.
+type Request struct {
+	Verb            string `xml:"verb,attr,omitempty"`
+	Identifier      string `xml:"identifier,attr,omitempty"`
+	MetadataPrefix  string `xml:"metadataPrefix,attr,omitempty"`
+	From            string `xml:"from,attr,omitempty"`
+	Until           string `xml:"until,attr,omitempty"`
+	Set             string `xml:"set,attr,omitempty"`
+	ResumptionToken string `xml:"resumptionToken,attr,omitempty"`
+	BaseURL         string `xml:",chardata"`
+}
+
+// Response is an OAI-PMH response, with the result of its verb or its errors.
+type Response struct {
+	XMLName             xml.Name             `xml:"OAI-PMH"`
+	Xmlns               string               `xml:"xmlns,attr"`
+	XmlnsXSI            string               `xml:"xmlns:xsi,attr"`
+	SchemaLocation      string               `xml:"xsi:schemaLocation,attr"`
+	ResponseDate        string               `xml:"responseDate"`
+	Request             Request              `xml:"request"`
+	Errors              []*Error             `xml:"error,omitempty"`
+	Identify            *Identify            `xml:"Identify,omitempty"`
+	ListMetadataFormats *listMetadataFormats `xml:"ListMetadataFormats,omitempty"`
+	ListIdentifiers     *listIdentifiers     `xml:"ListIdentifiers,omitempty"`
+	ListRecords         *listRecords         `xml:"ListRecords,omitempty"`
+	GetRecord           *getRecord           `xml:"GetRecord,omitempty"`
+}
+
+// NewResponse returns a response to a request at a time.
+func NewResponse(request Request, now time.Time) *Response {
+	return &Response{
+		Xmlns:          namespace,
+		XmlnsXSI:       xsiNamespace,
+		SchemaLocation: schemaLocation,
+		ResponseDate:   FormatDatestamp(now),
+		Request:        request,
+	}
+}
+
+// Fail sets the error of a response. The arguments of the request are omitted for badVerb and
+// badArgument errors, as the protocol requires.
+func (r *Response) Fail(err *Error) {
+	if err.Code == ErrorBadVerb || err.Code == ErrorBadArgument {
+		r.Request = Request{BaseURL: r.Request.BaseURL}
+	}
+
+	r.Errors = append(r.Errors, err)
+}
+
+// Identify describes a repository.
+type Identify struct {
+	RepositoryName    string `xml:"repositoryName"`
+	BaseURL           string `xml:"baseURL"`
+	ProtocolVersion   string `xml:"protocolVersion"`
+	AdminEmail        string `xml:"adminEmail"`
+	EarliestDatestamp string `xml:"earliestDatestamp"`
+	DeletedRecord     string `xml:"deletedRecord"`
+	Granularity       string `xml:"granularity"`
+}
+
+// SetIdentify sets the description of the repository at baseURL, whose records are not kept
+// after they are deleted.
+func (r *Response) SetIdentify(name, baseURL, adminEmail string, earliest time.Time) {
+	r.Identify = &Identify{
+		RepositoryName:    name,
+		BaseURL:           baseURL,
+		ProtocolVersion:   ProtocolVersion,
+		AdminEmail:        adminEmail,
+		EarliestDatestamp: FormatDatestamp(earliest),
+		DeletedRecord:     deletedRecordNone,
+		Granularity:       Granularity,
+	}
+}
+
+type listMetadataFormats struct {
+	Formats []metadataFormat `xml:"metadataFormat"`
+}
+
+type metadataFormat struct {
+	MetadataPrefix    string `xml:"metadataPrefix"`
+	Schema            string `xml:"schema"`
+	MetadataNamespace string `xml:"metadataNamespace"`
+}
+
+// SetMetadataFormats sets the metadata formats of the repository, which is Dublin Core.
+func (r *Response) SetMetadataFormats() {
+	r.ListMetadataFormats = &listMetadataFormats{Formats: []metadataFormat{{
+		MetadataPrefix:    MetadataPrefixDC,
+		Schema:            dcSchema,
+		MetadataNamespace: dcNamespace,
+	}}}
+}
+
+// Header is the header of a record, by which harvesters know which records changed.
+type Header struct {
+	Identifier string `xml:"identifier"`
+	Datestamp  string `xml:"datestamp"`
+}
+
+// NewHeader returns the header of a record with an identifier, which changed at a time.
+func NewHeader(identifier string, updatedAt time.Time) Header {
+	return Header{Identifier: identifier, Datestamp: FormatDatestamp(updatedAt)}
+}
+
+// Record is a record of a repository, with its header and its Dublin Core metadata.
+type Record struct {
+	Header   Header `xml:"header"`
+	Metadata struct {
+		DC dcRecord `xml:"oai_dc:dc"`
+	} `xml:"metadata"`
+}
+
+// dcRecord is a Dublin Core record in the oai_dc format.
+type dcRecord struct {
+	XmlnsOAIDC     string `xml:"xmlns:oai_dc,attr"`
+	XmlnsDC        string `xml:"xmlns:dc,attr"`
+	XmlnsXSI       string `xml:"xmlns:xsi,attr"`
+	SchemaLocation string `xml:"xsi:schemaLocation,attr"`
+	dublincore.Record
+}
+
+// NewRecord returns a record with a header and its Dublin Core metadata.
+func NewRecord(header Header, record dublincore.Record) Record {
+	r := Record{Header: header}
+	r.Metadata.DC = dcRecord{
+		XmlnsOAIDC:     dcNamespace,
+		XmlnsDC:        dublincore.Namespace,
+		XmlnsXSI:       xsiNamespace,
+		SchemaLocation: dcNamespace + " " + dcSchema,
+		Record:         record,
+	}
+
+	return r
+}
+
+// ResumptionToken is the resumption token of an incomplete list, with the size of the complete
+// list and the position of the list in it. An empty token ends a list which was resumed.
+type ResumptionToken struct {
+	CompleteListSize int64  `xml:"completeListSize,attr"`
+	Cursor           int64  `xml:"cursor,attr"`
+	Token            string `xml:",chardata"`
+}
+
+type listIdentifiers struct {
+	Headers         []Header         `xml:"header"`
+	ResumptionToken *ResumptionToken `xml:"resumptionToken,omitempty"`
+}
+
+type listRecords struct {
+	Records         []Record         `xml:"record"`
+	ResumptionToken *ResumptionToken `xml:"resumptionToken,omitempty"`
+}
+
+type getRecord struct {
+	Record Record `xml:"record"`
+}
+
+// SetIdentifiers sets the headers of a ListIdentifiers response.
+func (r *Response) SetIdentifiers(headers []Header, token *ResumptionToken) {
+	r.ListIdentifiers = &listIdentifiers{Headers: headers, ResumptionToken: token}
+}
+
+// SetRecords sets the records of a ListRecords response.
+func (r *Response) SetRecords(records []Record, token *ResumptionToken) {
+	r.ListRecords = &listRecords{Records: records, ResumptionToken: token}
+}
+
+// SetRecord sets the record of a GetRecord response.
+func (r *Response) SetRecord(record Record) {
+	r.GetRecord = &getRecord{Record: record}
+}
+
+// Write writes a response to w.
+func (r *Response) Write(w io.Writer) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+
+	return enc.Encode(r)
+}
+
+// FormatDatestamp formats a time as a datestamp in UTC, in seconds.
+func FormatDatestamp(t time.Time) string {
+	return t.UTC().Format(datestampFormat)
+}
+
+// ParseDatestamp parses the datestamp of a from or until argument, in seconds or in days. An
+// until datestamp includes the whole second or day, so it is returned at its end.
+func ParseDatestamp(s string, until bool) (time.Time, error) {
+	layout, length := datestampFormat, time.Second
+	if !strings.Contains(s, "T") {
+		layout, length = dayFormat, 24*time.Hour
+	}
+
+	t, err := time.Parse(layout, s)
+	if err != nil {
+		return time.Time{}, ErrInvalidDatestamp
+	}
+
+	if until {
+		t = t.Add(length - time.Nanosecond)
+	}
+
+	return t, nil
+}
+
+// Token is the state of a harvest which a resumption token resumes: the arguments of the
+// request which started it, the datestamp of the last record which was returned, the number of
+// the returned records with that datestamp, and the number of all the returned records.
+type Token struct {
+	MetadataPrefix string    `json:"p"`
+	From           time.Time `json:"f"`
+	Until          time.Time `json:"u"`
+	Last           time.Time `json:"l"`
+	SkipLast       int64     `json:"s,omitempty"`
+	Returned       int64     `json:"r"`
+}
+
+// Encode returns the resumption token of the state of a harvest.
+func (t Token) Encode() string {
+	b, _ := json.Marshal(t)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeToken returns the state of a harvest from its resumption token.
+func DecodeToken(s string) (Token, error) {
+	var t Token
+
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return t, &Error{Code: ErrorBadResumptionToken, Message: "The resumption token is invalid"}
+	}
+	if err = json.Unmarshal(b, &t); err != nil || t.MetadataPrefix == "" || t.Until.IsZero() {
+		return t, &Error{Code: ErrorBadResumptionToken, Message: "The resumption token is invalid"}
+	}
+
+	return t, nil
+}
@@ -0,0 +1,59 @@
+package oai
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseDatestamp(t *testing.T) {
+	tests := []struct {
+		datestamp string
+		until     bool
+		want      time.Time
+		err       error
+	}{
+		{datestamp: "2024-01-31", want: time.Date(2024, time.January, 31, 0, 0, 0, 0, time.UTC)},
+		{datestamp: "2024-01-31", until: true, want: time.Date(2024, time.January, 31, 23, 59, 59, 999999999, time.UTC)},
+		{datestamp: "2024-01-31T08:30:00Z", want: time.Date(2024, time.January, 31, 8, 30, 0, 0, time.UTC)},
+		{datestamp: "2024-01-31T08:30:00Z", until: true, want: time.Date(2024, time.January, 31, 8, 30, 0, 999999999, time.UTC)},
+		{datestamp: "2024-01-31T08:30:00+02:00", err: ErrInvalidDatestamp},
+		{datestamp: "2024-01", err: ErrInvalidDatestamp},
+		{datestamp: "", err: ErrInvalidDatestamp},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseDatestamp(tt.datestamp, tt.until)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("ParseDatestamp(%q, %v) error = %v; want %v", tt.datestamp, tt.until, err, tt.err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("ParseDatestamp(%q, %v) = %v; want %v", tt.datestamp, tt.until, got, tt.want)
+		}
+	}
+}
+
+func TestToken(t *testing.T) {
+	token := Token{
+		MetadataPrefix: MetadataPrefixDC,
+		From:           time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC),
+		Until:          time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC),
+		Last:           time.Date(2024, time.January, 15, 8, 30, 0, 123000000, time.UTC),
+		SkipLast:       2,
+		Returned:       100,
+	}
+
+	got, err := DecodeToken(token.Encode())
+	if err != nil || !got.From.Equal(token.From) || !got.Until.Equal(token.Until) || !got.Last.Equal(token.Last) ||
+		got.SkipLast != token.SkipLast || got.Returned != token.Returned || got.MetadataPrefix != token.MetadataPrefix {
+		t.Errorf("DecodeToken(Encode(%+v)) = %+v, %v; want the token", token, got, err)
+	}
+
+	for _, s := range []string{"", "invalid", Token{}.Encode()} {
+		var oaiErr *Error
+		if _, err = DecodeToken(s); !errors.As(err, &oaiErr) || oaiErr.Code != ErrorBadResumptionToken {
+			t.Errorf("DecodeToken(%q) error = %v; want %s", s, err, ErrorBadResumptionToken)
+		}
+	}
+}
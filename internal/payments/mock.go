@@ -0,0 +1,86 @@
+package payments
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// SignatureHeader holds the HMAC-SHA256 of the body of mock webhook requests.
+const SignatureHeader = "X-Library-Signature"
+
+// mockSessionTTL is how long mock checkout sessions can be paid, as long as Stripe's.
+const mockSessionTTL = 24 * time.Hour
+
+// MockProvider pretends to collect payments, for development and testing without a payment
+// provider. Its checkout sessions redirect straight to the success URL, and are paid by posting
+// {"session_id": "<id>", "reference": "<reference>", "paid": true} to the webhook, signed
+// with the webhook secret in SignatureHeader like the event webhooks of the library.
+type MockProvider struct {
+	WebhookSecret string
+}
+
+// MockEvent is the payload of mock webhook requests.
+type MockEvent struct {
+	SessionID        string `json:"session_id"`
+	Reference        string `json:"reference"`
+	PaymentReference string `json:"payment_reference,omitempty"`
+	Paid             bool   `json:"paid"`
+}
+
+// CreateCheckout creates a mock checkout session.
+func (m *MockProvider) CreateCheckout(_ context.Context, checkout Checkout) (*Session, error) {
+	if len(checkout.Items) == 0 {
+		return nil, ErrNoItems
+	}
+
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	id := "mock_" + hex.EncodeToString(b)
+
+	successURL, err := url.Parse(checkout.SuccessURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid success url: %v", err)
+	}
+	query := successURL.Query()
+	query.Set("session_id", id)
+	successURL.RawQuery = query.Encode()
+
+	return &Session{ID: id, URL: successURL.String(), ExpiresAt: time.Now().Add(mockSessionTTL)}, nil
+}
+
+// ParseEvent verifies the signature of a mock webhook request and parses its payload.
+func (m *MockProvider) ParseEvent(payload []byte, header http.Header) (*Event, error) {
+	signature, ok := strings.CutPrefix(header.Get(SignatureHeader), "sha256=")
+	if !ok {
+		return nil, ErrInvalidSignature
+	}
+
+	mac := hmac.New(sha256.New, []byte(m.WebhookSecret))
+	mac.Write(payload)
+	if sig, err := hex.DecodeString(signature); err != nil || !hmac.Equal(sig, mac.Sum(nil)) {
+		return nil, ErrInvalidSignature
+	}
+
+	var event MockEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("failed to decode mock event: %v", err)
+	}
+
+	return &Event{
+		SessionID:        event.SessionID,
+		Reference:        event.Reference,
+		PaymentReference: event.PaymentReference,
+		Paid:             event.Paid,
+	}, nil
+}
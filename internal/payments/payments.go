@@ -0,0 +1,67 @@
+// Package payments collects the fines of patrons with a payment provider. A checkout session is
+// created for the fines, the patron pays on the page of the provider, and the provider notifies
+// the library that the session was paid with a signed webhook.
+package payments
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// Names of the payment providers.
+const (
+	Stripe = "stripe"
+	Mock   = "mock"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrNoItems          = errors.New("a checkout must have at least one item")
+)
+
+// Item is a fine which is paid in a checkout.
+type Item struct {
+	// Reference identifies the fine, such as the ID of its transaction.
+	Reference   string
+	Description string
+	Amount      float64
+}
+
+// Checkout is a request to pay for Items.
+type Checkout struct {
+	// Reference identifies the payment in the library, and is returned in the Events of the session.
+	Reference string
+	Email     string
+	Currency  string
+	Items     []Item
+	// SuccessURL and CancelURL are where the patron is sent after paying or canceling.
+	SuccessURL string
+	CancelURL  string
+}
+
+// Session is a checkout session of a provider, which the patron pays at URL until it expires.
+type Session struct {
+	ID        string
+	URL       string
+	ExpiresAt time.Time
+}
+
+// Event is a notification of a provider about a checkout session.
+type Event struct {
+	SessionID string
+	// Reference is the Reference of the Checkout of the session.
+	Reference string
+	// PaymentReference identifies the payment at the provider, such as a Stripe payment intent.
+	PaymentReference string
+	// Paid is true if the session was paid.
+	Paid bool
+}
+
+// Provider creates checkout sessions and verifies the webhooks it sends about them.
+type Provider interface {
+	CreateCheckout(ctx context.Context, checkout Checkout) (*Session, error)
+	// ParseEvent verifies the signature of a webhook request and parses its payload.
+	ParseEvent(payload []byte, header http.Header) (*Event, error)
+}
@@ -0,0 +1,142 @@
+package payments
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestStripeCreateCheckout(t *testing.T) {
+	var got *http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("failed to parse form: %v", err)
+		}
+		got = r
+		fmt.Fprint(w, `{"id": "cs_test_1", "url": "https://checkout.stripe.com/c/pay/cs_test_1", "expires_at": 1790000000}`)
+	}))
+	defer srv.Close()
+
+	s := &StripeProvider{SecretKey: "sk_test", BaseURL: srv.URL}
+	session, err := s.CreateCheckout(context.Background(), Checkout{
+		Reference:  "payment-1",
+		Email:      "noa@example.com",
+		Currency:   "USD",
+		Items:      []Item{{Reference: "transaction-1", Description: "Overdue fine for Dune", Amount: 4.35}},
+		SuccessURL: "https://library.example.com/paid",
+		CancelURL:  "https://library.example.com/fines",
+	})
+	if err != nil {
+		t.Fatalf("CreateCheckout() error = %v", err)
+	}
+
+	if session.ID != "cs_test_1" || session.URL != "https://checkout.stripe.com/c/pay/cs_test_1" || !session.ExpiresAt.Equal(time.Unix(1790000000, 0)) {
+		t.Errorf("CreateCheckout() = %+v; want the created session", session)
+	}
+	if got.URL.Path != "/v1/checkout/sessions" {
+		t.Errorf("path = %s; want the checkout sessions", got.URL.Path)
+	}
+	if user, _, ok := got.BasicAuth(); !ok || user != "sk_test" {
+		t.Errorf("basic auth user = %s; want the secret key", user)
+	}
+	want := url.Values{
+		"mode":                                   {"payment"},
+		"client_reference_id":                    {"payment-1"},
+		"customer_email":                         {"noa@example.com"},
+		"line_items[0][price_data][currency]":    {"usd"},
+		"line_items[0][price_data][unit_amount]": {"435"},
+		"line_items[0][quantity]":                {"1"},
+	}
+	for key, value := range want {
+		if got.PostForm.Get(key) != value[0] {
+			t.Errorf("form %s = %q; want %q", key, got.PostForm.Get(key), value[0])
+		}
+	}
+
+	if _, err = s.CreateCheckout(context.Background(), Checkout{}); !errors.Is(err, ErrNoItems) {
+		t.Errorf("CreateCheckout() without items error = %v; want %v", err, ErrNoItems)
+	}
+}
+
+func TestStripeParseEvent(t *testing.T) {
+	now := time.Unix(1790000000, 0)
+	s := &StripeProvider{WebhookSecret: "whsec_test", now: func() time.Time { return now }}
+
+	payload := []byte(`{"type": "checkout.session.completed", "data": {"object": {"id": "cs_test_1", "client_reference_id": "payment-1", "payment_intent": "pi_1", "payment_status": "paid"}}}`)
+	sign := func(t time.Time, secret string, payload []byte) http.Header {
+		timestamp := fmt.Sprint(t.Unix())
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(timestamp + "." + string(payload)))
+		return http.Header{StripeSignatureHeader: {fmt.Sprintf("t=%s,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil)))}}
+	}
+
+	event, err := s.ParseEvent(payload, sign(now, "whsec_test", payload))
+	if err != nil {
+		t.Fatalf("ParseEvent() error = %v", err)
+	}
+	want := Event{SessionID: "cs_test_1", Reference: "payment-1", PaymentReference: "pi_1", Paid: true}
+	if *event != want {
+		t.Errorf("ParseEvent() = %+v; want %+v", *event, want)
+	}
+
+	tests := []struct {
+		name   string
+		header http.Header
+	}{
+		{name: "unsigned", header: http.Header{}},
+		{name: "wrong secret", header: sign(now, "whsec_other", payload)},
+		{name: "old", header: sign(now.Add(-10*time.Minute), "whsec_test", payload)},
+		{name: "other payload", header: sign(now, "whsec_test", []byte(`{}`))},
+	}
+	for _, tt := range tests {
+		if _, err = s.ParseEvent(payload, tt.header); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("ParseEvent() %s error = %v; want %v", tt.name, err, ErrInvalidSignature)
+		}
+	}
+
+	unpaid := []byte(`{"type": "checkout.session.completed", "data": {"object": {"id": "cs_test_2", "payment_status": "unpaid"}}}`)
+	if event, err = s.ParseEvent(unpaid, sign(now, "whsec_test", unpaid)); err != nil || event.Paid {
+		t.Errorf("ParseEvent() of an unpaid session = %+v, %v; want not paid", event, err)
+	}
+}
+
+func TestMockProvider(t *testing.T) {
+	m := &MockProvider{WebhookSecret: "secret"}
+
+	session, err := m.CreateCheckout(context.Background(), Checkout{
+		Reference:  "payment-1",
+		Items:      []Item{{Reference: "transaction-1", Amount: 2}},
+		SuccessURL: "https://library.example.com/paid?from=fines",
+	})
+	if err != nil {
+		t.Fatalf("CreateCheckout() error = %v", err)
+	}
+	if want := "https://library.example.com/paid?from=fines&session_id=" + session.ID; session.URL != want {
+		t.Errorf("CreateCheckout() url = %s; want %s", session.URL, want)
+	}
+
+	payload := []byte(fmt.Sprintf(`{"session_id": %q, "reference": "payment-1", "paid": true}`, session.ID))
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(payload)
+	header := http.Header{SignatureHeader: {"sha256=" + hex.EncodeToString(mac.Sum(nil))}}
+
+	event, err := m.ParseEvent(payload, header)
+	if err != nil {
+		t.Fatalf("ParseEvent() error = %v", err)
+	}
+	if event.SessionID != session.ID || event.Reference != "payment-1" || !event.Paid {
+		t.Errorf("ParseEvent() = %+v; want the paid session", event)
+	}
+
+	if _, err = m.ParseEvent([]byte(`{"paid": true}`), header); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("ParseEvent() of another payload error = %v; want %v", err, ErrInvalidSignature)
+	}
+}
@@ -0,0 +1,190 @@
+package payments
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// StripeBaseURL is the base URL of the Stripe API.
+	StripeBaseURL = "https://api.stripe.com"
+	// StripeSignatureHeader holds the timestamp and the signatures of Stripe webhook requests.
+	StripeSignatureHeader = "Stripe-Signature"
+	// stripeTolerance bounds how old a Stripe webhook request may be, to prevent replaying it.
+	stripeTolerance = 5 * time.Minute
+)
+
+// maxErrorBody limits how much of an error response is read.
+const maxErrorBody = 4096
+
+// StripeProvider collects payments with Stripe Checkout.
+type StripeProvider struct {
+	SecretKey string
+	// WebhookSecret is the signing secret of the webhook endpoint.
+	WebhookSecret string
+	// BaseURL overrides StripeBaseURL, for testing.
+	BaseURL string
+	Client  *http.Client
+	// now overrides time.Now, for testing.
+	now func() time.Time
+}
+
+// stripeSession is the part of a Stripe checkout session which is used.
+type stripeSession struct {
+	ID                string `json:"id"`
+	URL               string `json:"url"`
+	ExpiresAt         int64  `json:"expires_at"`
+	ClientReferenceID string `json:"client_reference_id"`
+	PaymentIntent     string `json:"payment_intent"`
+	PaymentStatus     string `json:"payment_status"`
+}
+
+// CreateCheckout creates a Stripe checkout session with a line item for each Item.
+func (s *StripeProvider) CreateCheckout(ctx context.Context, checkout Checkout) (*Session, error) {
+	if len(checkout.Items) == 0 {
+		return nil, ErrNoItems
+	}
+
+	baseURL := s.BaseURL
+	if baseURL == "" {
+		baseURL = StripeBaseURL
+	}
+
+	form := url.Values{
+		"mode":                {"payment"},
+		"client_reference_id": {checkout.Reference},
+		"success_url":         {checkout.SuccessURL},
+		"cancel_url":          {checkout.CancelURL},
+	}
+	if checkout.Email != "" {
+		form.Set("customer_email", checkout.Email)
+	}
+	for i, item := range checkout.Items {
+		prefix := fmt.Sprintf("line_items[%d]", i)
+		form.Set(prefix+"[quantity]", "1")
+		form.Set(prefix+"[price_data][currency]", strings.ToLower(checkout.Currency))
+		form.Set(prefix+"[price_data][unit_amount]", strconv.FormatInt(int64(math.Round(item.Amount*100)), 10))
+		form.Set(prefix+"[price_data][product_data][name]", item.Description)
+		form.Set(prefix+"[price_data][product_data][metadata][reference]", item.Reference)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+"/v1/checkout/sessions", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(s.SecretKey, "")
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return nil, fmt.Errorf("failed to create checkout session, status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var session stripeSession
+	if err = json.NewDecoder(resp.Body).Decode(&session); err != nil {
+		return nil, fmt.Errorf("failed to decode checkout session: %v", err)
+	}
+
+	return &Session{ID: session.ID, URL: session.URL, ExpiresAt: time.Unix(session.ExpiresAt, 0)}, nil
+}
+
+// ParseEvent verifies the Stripe-Signature of a webhook request, which signs the timestamp and the
+// payload with the webhook secret, and parses the checkout session of checkout.session events.
+// Events of other types are returned without a session.
+func (s *StripeProvider) ParseEvent(payload []byte, header http.Header) (*Event, error) {
+	if err := s.verify(payload, header.Get(StripeSignatureHeader)); err != nil {
+		return nil, err
+	}
+
+	var event struct {
+		Type string `json:"type"`
+		Data struct {
+			Object json.RawMessage `json:"object"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("failed to decode stripe event: %v", err)
+	}
+
+	if !strings.HasPrefix(event.Type, "checkout.session.") {
+		return &Event{}, nil
+	}
+
+	var session stripeSession
+	if err := json.Unmarshal(event.Data.Object, &session); err != nil {
+		return nil, fmt.Errorf("failed to decode checkout session: %v", err)
+	}
+
+	paid := (event.Type == "checkout.session.completed" || event.Type == "checkout.session.async_payment_succeeded") && session.PaymentStatus == "paid"
+
+	return &Event{
+		SessionID:        session.ID,
+		Reference:        session.ClientReferenceID,
+		PaymentReference: session.PaymentIntent,
+		Paid:             paid,
+	}, nil
+}
+
+// verify checks a Stripe-Signature header, which holds the timestamp of the request in t and
+// its signatures in v1.
+func (s *StripeProvider) verify(payload []byte, header string) error {
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+
+	t, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return ErrInvalidSignature
+	}
+
+	now := time.Now
+	if s.now != nil {
+		now = s.now
+	}
+	if age := now().Sub(time.Unix(t, 0)); age > stripeTolerance || age < -stripeTolerance {
+		return ErrInvalidSignature
+	}
+
+	mac := hmac.New(sha256.New, []byte(s.WebhookSecret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	expected := mac.Sum(nil)
+
+	for _, signature := range signatures {
+		if sig, err := hex.DecodeString(signature); err == nil && hmac.Equal(sig, expected) {
+			return nil
+		}
+	}
+
+	return ErrInvalidSignature
+}
@@ -0,0 +1,101 @@
+// Package photo normalizes the photos of patrons which the front desk verifies their identity by.
+// Photos are decoded from JPEG or PNG, scaled down to fit a square and encoded as JPEG, so that
+// whatever a camera takes is stored small and in a single format.
+package photo
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	_ "image/png"
+)
+
+// ContentType is the media type of normalized photos.
+const ContentType = "image/jpeg"
+
+// quality is the JPEG quality of normalized photos.
+const quality = 85
+
+var (
+	ErrUnsupportedFormat = errors.New("the photo must be a JPEG or a PNG")
+	ErrTooLarge          = errors.New("the photo has too many pixels")
+)
+
+// maxPixels is the largest number of pixels of photos which are decoded, so that a small file
+// which declares huge dimensions can't exhaust memory.
+const maxPixels = 50_000_000
+
+// Photo is a normalized photo.
+type Photo struct {
+	Content []byte
+	Width   int
+	Height  int
+}
+
+// Normalize decodes a JPEG or PNG photo, scales it down to fit within size by size pixels, keeping
+// its aspect ratio, and encodes it as JPEG. Photos which already fit are not scaled up.
+func Normalize(content []byte, size int) (*Photo, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil || (format != "jpeg" && format != "png") {
+		return nil, ErrUnsupportedFormat
+	}
+	if config.Width*config.Height > maxPixels {
+		return nil, ErrTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return nil, ErrUnsupportedFormat
+	}
+
+	img = fit(img, size)
+
+	var b bytes.Buffer
+	if err = jpeg.Encode(&b, img, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+
+	return &Photo{Content: b.Bytes(), Width: bounds.Dx(), Height: bounds.Dy()}, nil
+}
+
+// fit scales img down to fit within size by size pixels. Each pixel of the result is the average
+// of the pixels of img which it covers, which keeps the detail of faces when photos are shrunk a lot.
+func fit(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+	if srcW <= size && srcH <= size {
+		return img
+	}
+
+	dstW, dstH := size, size
+	if srcW > srcH {
+		dstH = max(1, srcH*size/srcW)
+	} else {
+		dstW = max(1, srcW*size/srcH)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+	for y := 0; y < dstH; y++ {
+		y0, y1 := y*srcH/dstH, max((y+1)*srcH/dstH, y*srcH/dstH+1)
+		for x := 0; x < dstW; x++ {
+			x0, x1 := x*srcW/dstW, max((x+1)*srcW/dstW, x*srcW/dstW+1)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := img.At(bounds.Min.X+sx, bounds.Min.Y+sy).RGBA()
+					r, g, b, a = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+
+			dst.SetRGBA(x, y, color.RGBA{R: uint8(r / n >> 8), G: uint8(g / n >> 8), B: uint8(b / n >> 8), A: uint8(a / n >> 8)})
+		}
+	}
+
+	return dst
+}
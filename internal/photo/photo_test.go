@@ -0,0 +1,76 @@
+package photo
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func encodePNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: 200, G: 100, B: 50, A: 255})
+		}
+	}
+
+	var b bytes.Buffer
+	if err := png.Encode(&b, img); err != nil {
+		t.Fatalf("failed to encode PNG: %v", err)
+	}
+
+	return b.Bytes()
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		wantW, wantH  int
+	}{
+		{name: "landscape", width: 1200, height: 800, wantW: 300, wantH: 200},
+		{name: "portrait", width: 600, height: 900, wantW: 200, wantH: 300},
+		{name: "small", width: 120, height: 160, wantW: 120, wantH: 160},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Normalize(encodePNG(t, tt.width, tt.height), 300)
+			if err != nil {
+				t.Fatalf("Normalize() error = %v", err)
+			}
+			if got.Width != tt.wantW || got.Height != tt.wantH {
+				t.Errorf("Normalize() = %dx%d; want %dx%d", got.Width, got.Height, tt.wantW, tt.wantH)
+			}
+
+			img, err := jpeg.Decode(bytes.NewReader(got.Content))
+			if err != nil {
+				t.Fatalf("Normalize() content is not a JPEG: %v", err)
+			}
+			if bounds := img.Bounds(); bounds.Dx() != tt.wantW || bounds.Dy() != tt.wantH {
+				t.Errorf("decoded photo = %v; want %dx%d", bounds, tt.wantW, tt.wantH)
+			}
+			if r, _, _, _ := img.At(tt.wantW/2, tt.wantH/2).RGBA(); r>>8 < 190 || r>>8 > 210 {
+				t.Errorf("decoded photo red = %d; want about 200", r>>8)
+			}
+		})
+	}
+}
+
+func TestNormalizeUnsupported(t *testing.T) {
+	for name, content := range map[string][]byte{
+		"empty": nil,
+		"pdf":   []byte("%PDF-1.7"),
+		"gif":   []byte("GIF89a\x01\x00\x01\x00\x00\x00\x00;"),
+	} {
+		if _, err := Normalize(content, 300); !errors.Is(err, ErrUnsupportedFormat) {
+			t.Errorf("Normalize(%s) error = %v; want %v", name, err, ErrUnsupportedFormat)
+		}
+	}
+}
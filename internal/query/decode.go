@@ -0,0 +1,142 @@
+package query
+
+import (
+	"encoding"
+	"fmt"
+	"github.com/danielgtaylor/huma/v2"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Decode sets the fields of input, which is a pointer to an input struct, from the query
+// parameters in values, the way they are set from the query string of a request to the operation
+// of the input. Fields which are not in values are set to their defaults. The enum, minimum,
+// maximum, maxItems and email format of the fields are validated, and parameters which are not
+// fields of input are errors, so that a stored query string can be checked before it is run.
+func Decode(values url.Values, input any) []error {
+	v := reflect.ValueOf(input).Elem()
+
+	known := map[string]bool{}
+	errs := decode(v, values, known)
+
+	var unknown []string
+	for name := range values {
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	slices.Sort(unknown)
+	for _, name := range unknown {
+		errs = append(errs, &huma.ErrorDetail{Location: fmt.Sprintf("%s.%s", Key, name), Message: "unknown parameter", Value: values.Get(name)})
+	}
+
+	return errs
+}
+
+// decode sets the query parameter fields of v, and of its embedded structs, recording their names in known.
+func decode(v reflect.Value, values url.Values, known map[string]bool) []error {
+	var errs []error
+
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		value := v.Field(i)
+
+		if field.Anonymous && value.Kind() == reflect.Struct {
+			errs = append(errs, decode(value, values, known)...)
+			continue
+		}
+
+		name, ok := field.Tag.Lookup(Key)
+		if !ok || !field.IsExported() {
+			continue
+		}
+		known[name] = true
+
+		raw := values.Get(name)
+		if _, sent := values[name]; !sent || raw == "" {
+			raw = field.Tag.Get("default")
+		}
+		if raw == "" {
+			continue
+		}
+
+		if err := decodeField(field, value, raw); err != nil {
+			errs = append(errs, &huma.ErrorDetail{Location: fmt.Sprintf("%s.%s", Key, name), Message: err.Error(), Value: raw})
+		}
+	}
+
+	return errs
+}
+
+// decodeField parses raw into the value of field and validates it.
+func decodeField(field reflect.StructField, value reflect.Value, raw string) error {
+	if u, ok := value.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(raw))
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		if err := validateItem(field, raw); err != nil {
+			return err
+		}
+		value.SetString(raw)
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return fmt.Errorf("expected an integer")
+		}
+		if minimum, ok := field.Tag.Lookup("minimum"); ok {
+			if m, _ := strconv.ParseInt(minimum, 10, 64); n < m {
+				return fmt.Errorf("expected number >= %d", m)
+			}
+		}
+		if maximum, ok := field.Tag.Lookup("maximum"); ok {
+			if m, _ := strconv.ParseInt(maximum, 10, 64); n > m {
+				return fmt.Errorf("expected number <= %d", m)
+			}
+		}
+		value.SetInt(n)
+	case reflect.Slice:
+		if value.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported parameter type %s", value.Type())
+		}
+		items := strings.Split(raw, ",")
+		if maxItems, ok := field.Tag.Lookup("maxItems"); ok {
+			if m, _ := strconv.Atoi(maxItems); len(items) > m {
+				return fmt.Errorf("expected array length <= %d", m)
+			}
+		}
+		list := reflect.MakeSlice(value.Type(), 0, len(items))
+		for _, item := range items {
+			if err := validateItem(field, strings.TrimSpace(item)); err != nil {
+				return err
+			}
+			list = reflect.Append(list, reflect.ValueOf(item).Convert(value.Type().Elem()))
+		}
+		value.Set(list)
+	default:
+		return fmt.Errorf("unsupported parameter type %s", value.Type())
+	}
+
+	return nil
+}
+
+// validateItem checks that a string, or an item of a list, is one of the enum of field and has
+// its format.
+func validateItem(field reflect.StructField, item string) error {
+	if enum, ok := field.Tag.Lookup("enum"); ok && item != "" && !slices.Contains(strings.Split(enum, ","), item) {
+		return fmt.Errorf("expected value to be one of %q", strings.ReplaceAll(enum, ",", ", "))
+	}
+
+	if field.Tag.Get("format") == "email" {
+		if _, err := mail.ParseAddress(item); err != nil {
+			return fmt.Errorf("expected string to be RFC 5322 email: %s", item)
+		}
+	}
+
+	return nil
+}
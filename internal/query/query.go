@@ -1,59 +1,213 @@
 package query
 
 import (
+	"errors"
 	"fmt"
 	"github.com/danielgtaylor/huma/v2"
+	"math"
+	"reflect"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 )
 
-// ResolveInt retrieves and parses an integer query parameter from the context.
-// If the parameter is present and valid, it returns a pointer to the parsed integer.
-// Otherwise, it returns nil.
-func ResolveInt(ctx huma.Context, paramName string) (*int, error) {
-	if v := ctx.Query(paramName); v != "" {
-		parsed, err := strconv.ParseInt(v, 10, 64)
-		if err != nil {
-			return nil, fmt.Errorf("invalid value for %s: %v", paramName, err)
-		}
-		tmp := int(parsed)
-		return &tmp, nil
+var errInvalidUTF8 = errors.New("not valid UTF-8")
+
+// Time is an optional time query parameter. Valid values are RFC3339 times, dates in the form
+// YYYY-MM-DD, which are interpreted as midnight in the timezone of the library, and times
+// relative to now, such as -7d or +12h, with the units h (hours), d (days) and w (weeks).
+type Time struct {
+	value string
+}
+
+// UnmarshalText checks that the value of the parameter is a valid time. It is parsed by In,
+// since dates depend on the timezone of the library and relative times on when they are read.
+func (t *Time) UnmarshalText(text []byte) error {
+	if _, err := parseTime(string(text), time.UTC); err != nil {
+		return err
+	}
+
+	t.value = string(text)
+
+	return nil
+}
+
+// Schema describes the parameter in the OpenAPI document as a string.
+func (t Time) Schema(huma.Registry) *huma.Schema {
+	return &huma.Schema{
+		Type:        huma.TypeString,
+		Description: "An RFC3339 time, a date such as 2024-01-02, or a time relative to now, such as -7d or +12h",
+		Examples:    []any{"2024-01-02T03:04:05Z", "2024-01-02", "-7d"},
+	}
+}
+
+// In returns the time, with dates at midnight in loc, or nil if the parameter was not sent.
+func (t Time) In(loc *time.Location) *time.Time {
+	if t.value == "" {
+		return nil
+	}
+
+	parsed, err := parseTime(t.value, loc)
+	if err != nil {
+		return nil
+	}
+
+	return &parsed
+}
+
+// Period is an optional query parameter of a length of time back from now, such as 30d, with the
+// units h (hours), d (days) and w (weeks).
+type Period struct {
+	value time.Duration
+	set   bool
+}
+
+// UnmarshalText parses the length of the period.
+func (p *Period) UnmarshalText(text []byte) error {
+	d, err := parseDuration(string(text))
+	if err != nil {
+		return fmt.Errorf("%q %v", text, err)
 	}
-	return nil, nil
+
+	p.value, p.set = d, true
+
+	return nil
 }
 
-// ResolveString retrieves a string query parameter from the context.
-// If the parameter is present, it returns a pointer to the string value.
-// Otherwise, it returns nil.
-func ResolveString(ctx huma.Context, paramName string) (*string, error) {
-	if v := ctx.Query(paramName); v != "" {
-		return &v, nil
+// Schema describes the parameter in the OpenAPI document as a string.
+func (p Period) Schema(huma.Registry) *huma.Schema {
+	return &huma.Schema{
+		Type:        huma.TypeString,
+		Description: "A length of time back from now, such as 30d, 12h or 2w",
+		Examples:    []any{"30d"},
 	}
-	return nil, nil
 }
 
-// ResolveStringSlice retrieves a comma-separated string slice query parameter from the context.
-// If the parameter is present, it splits the string into a slice of strings and returns it.
-// Otherwise, it returns nil.
-func ResolveStringSlice(ctx huma.Context, paramName string) ([]string, error) {
-	if v := ctx.Query(paramName); v != "" {
-		items := strings.Split(v, ",")
-		return items, nil
+// Start returns when the period began, or nil if the parameter was not sent.
+func (p Period) Start() *time.Time {
+	if !p.set {
+		return nil
 	}
-	return nil, nil
+
+	start := now().Add(-p.value)
+
+	return &start
+}
+
+// Normalize checks that the string and list query parameters of input, which is a pointer to
+// an input struct, are valid UTF-8, and trims the items of the lists, dropping the empty ones.
+// A list parameter which was sent with no items, such as ",,", is an error. The location of each
+// error is the name in the query tag of the field, so that it can't refer to another parameter.
+func Normalize(input any) []error {
+	return normalize(reflect.ValueOf(input).Elem())
 }
 
-// ResolveTime retrieves and parses a time query parameter from the context.
-// If the parameter is present and valid (in RFC3339 format), it returns a pointer to the parsed time.
-// Otherwise, it returns nil.
-func ResolveTime(ctx huma.Context, paramName string) (*time.Time, error) {
-	if v := ctx.Query(paramName); v != "" {
-		parsed, err := time.Parse(time.RFC3339, v)
-		if err != nil {
-			return nil, fmt.Errorf("invalid value for %s: %v", paramName, err)
+// normalize normalizes the query parameters of the fields of v, and of its embedded structs.
+func normalize(v reflect.Value) []error {
+	var errs []error
+
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		value := v.Field(i)
+
+		if field.Anonymous && value.Kind() == reflect.Struct {
+			errs = append(errs, normalize(value)...)
+			continue
+		}
+
+		name, ok := field.Tag.Lookup(Key)
+		if !ok || !field.IsExported() {
+			continue
+		}
+		location := fmt.Sprintf("%s.%s", Key, name)
+
+		switch {
+		case value.Kind() == reflect.String:
+			if !utf8.ValidString(value.String()) {
+				errs = append(errs, &huma.ErrorDetail{Location: location, Message: errInvalidUTF8.Error()})
+			}
+		case value.Kind() == reflect.Slice && value.Type().Elem().Kind() == reflect.String:
+			if value.IsNil() {
+				continue
+			}
+
+			items := reflect.MakeSlice(value.Type(), 0, value.Len())
+			for j := 0; j < value.Len(); j++ {
+				item := strings.TrimSpace(value.Index(j).String())
+				switch {
+				case !utf8.ValidString(item):
+					errs = append(errs, &huma.ErrorDetail{Location: location, Message: errInvalidUTF8.Error()})
+				case item != "":
+					items = reflect.Append(items, reflect.ValueOf(item).Convert(value.Type().Elem()))
+				}
+			}
+			if items.Len() == 0 {
+				errs = append(errs, &huma.ErrorDetail{Location: location, Message: fmt.Sprintf("%s must have at least one item", name)})
+			}
+			value.Set(items)
 		}
-		return &parsed, nil
 	}
-	return nil, nil
+
+	return errs
+}
+
+// now returns the current time. It is a variable so that tests can fix it.
+var now = time.Now
+
+// relativeUnits are the units of relative times.
+var relativeUnits = map[byte]time.Duration{
+	'h': time.Hour,
+	'd': 24 * time.Hour,
+	'w': 7 * 24 * time.Hour,
+}
+
+// parseTime parses an RFC3339 time, a date at midnight in loc or a relative time.
+func parseTime(v string, loc *time.Location) (time.Time, error) {
+	if v[0] == '-' || v[0] == '+' {
+		return parseRelativeTime(v)
+	}
+
+	if parsed, err := time.ParseInLocation(time.DateOnly, v, loc); err == nil {
+		return parsed, nil
+	}
+
+	return time.Parse(time.RFC3339, v)
+}
+
+// parseRelativeTime parses a time relative to now, such as -7d.
+func parseRelativeTime(v string) (time.Time, error) {
+	offset, err := parseDuration(v[1:])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q %v", v, err)
+	}
+
+	if v[0] == '-' {
+		offset = -offset
+	}
+
+	return now().Add(offset), nil
+}
+
+// parseDuration parses a number and a unit, such as 7d.
+func parseDuration(v string) (time.Duration, error) {
+	if v == "" {
+		return 0, errors.New("must have a number and a unit, such as 7d")
+	}
+
+	unit, ok := relativeUnits[v[len(v)-1]]
+	if !ok {
+		return 0, errors.New("must end with one of the units h, d or w")
+	}
+
+	n, err := strconv.ParseInt(v[:len(v)-1], 10, 64)
+	if err != nil || v[0] < '0' || v[0] > '9' {
+		return 0, errors.New("must have a number and a unit, such as 7d")
+	}
+
+	if n > int64(math.MaxInt64/unit) {
+		return 0, errors.New("is too far from now")
+	}
+
+	return time.Duration(n) * unit, nil
 }
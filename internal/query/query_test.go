@@ -0,0 +1,251 @@
+package query
+
+import (
+	"github.com/danielgtaylor/huma/v2"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func FuzzTime(f *testing.F) {
+	for _, seed := range []string{"2024-01-02T03:04:05Z", "2024-01-02T03:04:05+02:00", "2024-01-02", "2024-13-45T99:99:99Z", "0000-01-01T00:00:00Z", "9999-12-31T23:59:59.999999999Z", "-7d", "now", "2024-01-02T03:04:05"} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, value string) {
+		var param Time
+		err := param.UnmarshalText([]byte(value))
+
+		got := param.In(time.UTC)
+		if err != nil {
+			if got != nil {
+				t.Fatalf("UnmarshalText(%q) error = %v, but In() = %v; want nil", value, err, got)
+			}
+			return
+		}
+
+		if got == nil {
+			t.Fatalf("UnmarshalText(%q) = nil, but In() = nil; want a time", value)
+		}
+
+		// Times are echoed back in validation errors, so they must be encodable.
+		if _, err := got.MarshalJSON(); err != nil {
+			t.Fatalf("In() = %v for %q, which cannot be encoded: %v", got, value, err)
+		}
+	})
+}
+
+// fuzzInput is an input struct with a string and a list query parameter.
+type fuzzInput struct {
+	Name  string   `query:"name"`
+	Items []string `query:"items"`
+}
+
+func FuzzNormalize(f *testing.F) {
+	for _, seed := range []string{"a", "a,b", ",", ",,,", "a,,b", " a , b ", "a,", ",a", "\t,\n", "é,日本", "a,\xff"} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, value string) {
+		input := fuzzInput{Name: value, Items: strings.Split(value, ",")}
+		errs := Normalize(&input)
+
+		if !utf8.ValidString(value) {
+			if len(errs) == 0 {
+				t.Fatalf("Normalize(%q) = %q; want an error", value, input.Items)
+			}
+			return
+		}
+
+		if len(input.Items) == 0 && len(errs) == 0 {
+			t.Fatalf("Normalize(%q) has no items; want an error", value)
+		}
+
+		for _, item := range input.Items {
+			if item == "" || item != strings.TrimSpace(item) {
+				t.Fatalf("Normalize(%q) = %q; item %q is not trimmed", value, input.Items, item)
+			}
+		}
+	})
+}
+
+func TestNormalize(t *testing.T) {
+	type embedded struct {
+		Genres []string `query:"genres"`
+	}
+	type input struct {
+		embedded
+		Authors []string `query:"authors"`
+		Title   string   `query:"title"`
+	}
+
+	got := input{embedded: embedded{Genres: []string{"", " "}}, Authors: []string{" Tolkien ", "", "Lewis"}, Title: "\xff"}
+	errs := Normalize(&got)
+
+	var locations []string
+	for _, err := range errs {
+		locations = append(locations, err.(*huma.ErrorDetail).Location)
+	}
+	if want := []string{"query.genres", "query.title"}; strings.Join(locations, " ") != strings.Join(want, " ") {
+		t.Errorf("Normalize() errors at %v; want %v", locations, want)
+	}
+
+	if want := []string{"Tolkien", "Lewis"}; strings.Join(got.Authors, ",") != strings.Join(want, ",") {
+		t.Errorf("Normalize() authors = %q; want %q", got.Authors, want)
+	}
+}
+
+func TestTime(t *testing.T) {
+	fixed := time.Date(2024, time.December, 10, 15, 30, 0, 0, time.UTC)
+	now = func() time.Time { return fixed }
+	defer func() { now = time.Now }()
+
+	tests := []struct {
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{value: "2024-01-02T03:04:05Z", want: time.Date(2024, time.January, 2, 3, 4, 5, 0, time.UTC)},
+		{value: "2024-01-02T03:04:05+02:00", want: time.Date(2024, time.January, 2, 1, 4, 5, 0, time.UTC)},
+		{value: "2024-12-01", want: time.Date(2024, time.December, 1, 0, 0, 0, 0, time.UTC)},
+		{value: "-7d", want: fixed.Add(-7 * 24 * time.Hour)},
+		{value: "+12h", want: fixed.Add(12 * time.Hour)},
+		{value: "-2w", want: fixed.Add(-14 * 24 * time.Hour)},
+		{value: "-0d", want: fixed},
+		{value: "yesterday", wantErr: true},
+		{value: "2024-01-02T03:04:05", wantErr: true},
+		{value: "2024-02-30T00:00:00Z", wantErr: true},
+		{value: "2024-02-30", wantErr: true},
+		{value: "2024-1-2", wantErr: true},
+		{value: "7d", wantErr: true},
+		{value: "-7", wantErr: true},
+		{value: "-7m", wantErr: true},
+		{value: "--7d", wantErr: true},
+		{value: "-+7d", wantErr: true},
+		{value: "-d", wantErr: true},
+		{value: "-", wantErr: true},
+		{value: "-99999999999999w", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		var param Time
+		err := param.UnmarshalText([]byte(tt.value))
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("UnmarshalText(%q) = %v; want an error", tt.value, param.In(time.UTC))
+			}
+			continue
+		}
+
+		if got := param.In(time.UTC); err != nil || got == nil || !got.Equal(tt.want) {
+			t.Errorf("UnmarshalText(%q) = %v, %v; want %v", tt.value, got, err, tt.want)
+		}
+	}
+
+	if got := (Time{}).In(time.UTC); got != nil {
+		t.Errorf("In() of a parameter which was not sent = %v; want nil", got)
+	}
+}
+
+func TestPeriod(t *testing.T) {
+	fixed := time.Date(2024, time.December, 10, 15, 30, 0, 0, time.UTC)
+	now = func() time.Time { return fixed }
+	defer func() { now = time.Now }()
+
+	tests := []struct {
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{value: "30d", want: fixed.Add(-30 * 24 * time.Hour)},
+		{value: "12h", want: fixed.Add(-12 * time.Hour)},
+		{value: "2w", want: fixed.Add(-14 * 24 * time.Hour)},
+		{value: "0d", want: fixed},
+		{value: "-30d", wantErr: true},
+		{value: "+30d", wantErr: true},
+		{value: "30", wantErr: true},
+		{value: "30m", wantErr: true},
+		{value: "d", wantErr: true},
+		{value: "", wantErr: true},
+		{value: "99999999999999w", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		var param Period
+		err := param.UnmarshalText([]byte(tt.value))
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("UnmarshalText(%q) = %v; want an error", tt.value, param.Start())
+			}
+			continue
+		}
+
+		if got := param.Start(); err != nil || got == nil || !got.Equal(tt.want) {
+			t.Errorf("UnmarshalText(%q) = %v, %v; want %v", tt.value, got, err, tt.want)
+		}
+	}
+
+	if got := (Period{}).Start(); got != nil {
+		t.Errorf("Start() of a parameter which was not sent = %v; want nil", got)
+	}
+}
+
+func TestTimeInLocation(t *testing.T) {
+	loc := time.FixedZone("UTC+2", 2*60*60)
+
+	var param Time
+	if err := param.UnmarshalText([]byte("2024-12-01")); err != nil {
+		t.Fatalf("UnmarshalText() error = %v", err)
+	}
+
+	if got, want := param.In(loc), time.Date(2024, time.November, 30, 22, 0, 0, 0, time.UTC); got == nil || !got.Equal(want) {
+		t.Errorf("In() = %v; want %v", got, want)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	type embedded struct {
+		Page int64  `query:"page" minimum:"1" default:"1"`
+		Sort string `query:"sort" enum:"title,-title"`
+	}
+	type input struct {
+		embedded
+		Genres   []string `query:"genres" maxItems:"2"`
+		Status   []string `query:"status" enum:"borrowed,returned"`
+		Email    string   `query:"email" format:"email"`
+		MinDate  Time     `query:"min_date"`
+		Internal string
+	}
+
+	var got input
+	if errs := Decode(url.Values{"genres": {"Fiction,Horror"}, "sort": {"-title"}, "min_date": {"2024-01-02"}}, &got); len(errs) != 0 {
+		t.Fatalf("Decode() errors = %v; want none", errs)
+	}
+	if got.Page != 1 || got.Sort != "-title" || strings.Join(got.Genres, ",") != "Fiction,Horror" || got.MinDate.In(time.UTC) == nil {
+		t.Errorf("Decode() = %+v; want the parameters and the default page", got)
+	}
+
+	tests := []struct {
+		query    string
+		location string
+	}{
+		{query: "page=0", location: "query.page"},
+		{query: "page=one", location: "query.page"},
+		{query: "sort=pages", location: "query.sort"},
+		{query: "genres=a,b,c", location: "query.genres"},
+		{query: "status=borrowed,lost", location: "query.status"},
+		{query: "email=invalid", location: "query.email"},
+		{query: "min_date=yesterday", location: "query.min_date"},
+		{query: "Internal=x", location: "query.Internal"},
+	}
+
+	for _, tt := range tests {
+		values, _ := url.ParseQuery(tt.query)
+		errs := Decode(values, &input{})
+		if len(errs) != 1 || errs[0].(*huma.ErrorDetail).Location != tt.location {
+			t.Errorf("Decode(%q) errors = %v; want one at %s", tt.query, errs, tt.location)
+		}
+	}
+}
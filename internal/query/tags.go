@@ -3,6 +3,10 @@ package query
 const (
 	Key = "query"
 
+	QKey     = "q"
+	MatchKey = "match"
+	SortKey  = "sort"
+
 	MinPagesKey          = "min_pages"
 	MaxPagesKey          = "max_pages"
 	MinEditionKey        = "min_edition"
@@ -10,18 +14,26 @@ const (
 	MinPublishedAtKey    = "min_published_at"
 	MaxPublishedAtKey    = "max_published_at"
 	TitleKey             = "title"
-	ISBNKey              = "isbn"
+	IdentifierKey        = "identifier"
+	LanguageKey          = "language"
+	BookFormatKey        = "book_format"
+	CallNumberKey        = "call_number"
+	ShelfLocationKey     = "shelf_location"
 	AuthorsKey           = "authors"
 	PublishersKey        = "publishers"
 	GenresKey            = "genres"
+	ExcludeAuthorsKey    = "exclude_authors"
+	ExcludeGenresKey     = "exclude_genres"
 	MinCopiesKey         = "min_copies"
 	MaxCopiesKey         = "max_copies"
 	MinBorrowedCopiesKey = "min_borrowed_copies"
 	MaxBorrowedCopiesKey = "max_borrowed_copies"
+	AvailableKey         = "available"
 
 	PatronIDKey      = "patron_id"
 	BookIDKey        = "book_id"
 	StatusKey        = "status"
+	NotStatusKey     = "not_status"
 	MinBorrowedAtKey = "min_borrowed_at"
 	MaxBorrowedAtKey = "max_borrowed_at"
 	MinDueDateKey    = "min_due_date"
@@ -30,6 +42,7 @@ const (
 	MaxReturnedAtKey = "max_returned_at"
 	MinCreatedAtKey  = "min_created_at"
 	MaxCreatedAtKey  = "max_created_at"
+	OverdueKey       = "overdue"
 
 	CategoryKey = "category"
 	NameKey     = "name"
@@ -0,0 +1,140 @@
+// Package receipt renders printable PDF receipts of borrowed and returned books for the front desk.
+package receipt
+
+import (
+	"fmt"
+	"github.com/go-pdf/fpdf"
+	"io"
+	"time"
+)
+
+// ContentType is the media type of a receipt.
+const ContentType = "application/pdf"
+
+// Kinds of receipts.
+const (
+	KindBorrow = "borrow"
+	KindReturn = "return"
+)
+
+const (
+	dateFormat     = "02/01/2006"
+	dateTimeFormat = "02/01/2006 15:04"
+	// pageWidth is the width in millimeters of the receipt paper, which fits receipt printers.
+	pageWidth   = 80
+	margin      = 5
+	lineHeight  = 5
+	titleSize   = 14
+	textSize    = 9
+	minPageSize = 100
+)
+
+// Receipt is a receipt of a borrowed or returned book.
+type Receipt struct {
+	Kind string
+	// Number identifies the receipt, such as the ID of its transaction.
+	Number   string
+	IssuedAt time.Time
+	Library  string
+	Patron   string
+	Items    []Item
+}
+
+// Item is a book on a receipt. ReturnedAt and Fine are only set on return receipts.
+type Item struct {
+	Title      string
+	ISBN       string
+	Copies     int
+	BorrowedAt time.Time
+	DueDate    time.Time
+	ReturnedAt time.Time
+	Fine       float64
+}
+
+// Fines returns the sum of the fines of the items.
+func (r *Receipt) Fines() float64 {
+	var fines float64
+	for _, item := range r.Items {
+		fines += item.Fine
+	}
+
+	return fines
+}
+
+// Write renders the receipt as a PDF to w. Text which can't be encoded in the standard PDF
+// fonts, which cover Western European languages, is replaced.
+func (r *Receipt) Write(w io.Writer) error {
+	// The page is as long as the receipt, like the paper of a receipt printer.
+	height := float64(minPageSize + len(r.Items)*8*lineHeight)
+
+	pdf := fpdf.NewCustom(&fpdf.InitType{
+		OrientationStr: "P",
+		UnitStr:        "mm",
+		Size:           fpdf.SizeType{Wd: pageWidth, Ht: height},
+	})
+	pdf.SetMargins(margin, margin, margin)
+	pdf.SetAutoPageBreak(false, margin)
+	pdf.SetTitle(r.title(), true)
+	pdf.SetCreationDate(r.IssuedAt)
+	pdf.AddPage()
+
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	width := float64(pageWidth - 2*margin)
+
+	line := func(label, value string) {
+		pdf.SetFont("Helvetica", "B", textSize)
+		pdf.CellFormat(width/2-5, lineHeight, tr(label), "", 0, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "", textSize)
+		pdf.MultiCell(width/2+5, lineHeight, tr(value), "", "R", false)
+	}
+	separator := func() {
+		pdf.Ln(1)
+		pdf.Line(margin, pdf.GetY(), pageWidth-margin, pdf.GetY())
+		pdf.Ln(2)
+	}
+
+	pdf.SetFont("Helvetica", "B", titleSize)
+	pdf.MultiCell(width, lineHeight+2, tr(r.Library), "", "C", false)
+	pdf.SetFont("Helvetica", "", textSize+1)
+	pdf.CellFormat(width, lineHeight+1, tr(r.title()), "", 1, "C", false, 0, "")
+	separator()
+
+	line("Receipt", r.Number)
+	line("Date", r.IssuedAt.Format(dateTimeFormat))
+	line("Patron", r.Patron)
+	separator()
+
+	for _, item := range r.Items {
+		pdf.SetFont("Helvetica", "B", textSize+1)
+		pdf.MultiCell(width, lineHeight, tr(item.Title), "", "L", false)
+		line("ISBN", item.ISBN)
+		if item.Copies > 1 {
+			line("Copies", fmt.Sprint(item.Copies))
+		}
+		line("Borrowed", item.BorrowedAt.Format(dateFormat))
+		line("Due", item.DueDate.Format(dateFormat))
+		if r.Kind == KindReturn {
+			line("Returned", item.ReturnedAt.Format(dateFormat))
+			line("Fine", fmt.Sprintf("%.2f", item.Fine))
+		}
+		separator()
+	}
+
+	if r.Kind == KindReturn {
+		line("Total fines", fmt.Sprintf("%.2f", r.Fines()))
+	} else {
+		pdf.SetFont("Helvetica", "", textSize)
+		pdf.MultiCell(width, lineHeight, "Please return the books by their due dates.", "", "C", false)
+	}
+
+	return pdf.Output(w)
+}
+
+// title returns the title of the receipt for its kind.
+func (r *Receipt) title() string {
+	if r.Kind == KindReturn {
+		return "Return receipt"
+	}
+
+	return "Borrow receipt"
+}
@@ -0,0 +1,48 @@
+package receipt
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestWrite(t *testing.T) {
+	now := time.Date(2024, time.December, 10, 12, 0, 0, 0, time.UTC)
+
+	for _, kind := range []string{KindBorrow, KindReturn} {
+		t.Run(kind, func(t *testing.T) {
+			r := &Receipt{
+				Kind:     kind,
+				Number:   "675abc0123456789abcdef01",
+				IssuedAt: now,
+				Library:  "Library",
+				Patron:   "Noa Levi",
+				Items: []Item{{
+					Title:      "Cien años de soledad, a very long title which has to wrap over several lines of the receipt",
+					ISBN:       "9780306406157",
+					Copies:     2,
+					BorrowedAt: now.Add(-20 * 24 * time.Hour),
+					DueDate:    now.Add(-3 * 24 * time.Hour),
+					ReturnedAt: now,
+					Fine:       30,
+				}},
+			}
+
+			var b bytes.Buffer
+			if err := r.Write(&b); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+
+			if !bytes.HasPrefix(b.Bytes(), []byte("%PDF-")) || !bytes.Contains(b.Bytes(), []byte("%%EOF")) {
+				t.Errorf("Write() = %q...; want a PDF document", b.Bytes()[:min(b.Len(), 16)])
+			}
+		})
+	}
+}
+
+func TestFines(t *testing.T) {
+	r := &Receipt{Items: []Item{{Fine: 10}, {Fine: 2.5}, {}}}
+	if got := r.Fines(); got != 12.5 {
+		t.Errorf("Fines() = %v; want %v", got, 12.5)
+	}
+}
@@ -0,0 +1,34 @@
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Filter is a filter of a query which matches the resources whose Attribute equals Value, such as
+// userName eq "noa@example.com". Attribute is lower-cased, since the attributes of SCIM are
+// case-insensitive.
+type Filter struct {
+	Attribute string
+	Value     string
+}
+
+// ParseFilter parses a filter of the form attribute eq "value", by which identity providers find a
+// user before provisioning them. Other operators and logical expressions are not supported.
+func ParseFilter(filter string) (Filter, error) {
+	attribute, rest, _ := strings.Cut(strings.TrimSpace(filter), " ")
+	op, value, _ := strings.Cut(strings.TrimSpace(rest), " ")
+	value = strings.TrimSpace(value)
+
+	if attribute == "" || !strings.EqualFold(op, "eq") || value == "" {
+		return Filter{}, invalid(ErrorInvalidFilter, fmt.Sprintf("unsupported filter %q, only filters of the form attribute eq \"value\" are supported", filter))
+	}
+
+	var s string
+	if err := json.Unmarshal([]byte(value), &s); err != nil {
+		return Filter{}, invalid(ErrorInvalidFilter, fmt.Sprintf("the value of the filter %q must be a quoted string", filter))
+	}
+
+	return Filter{Attribute: strings.ToLower(attribute), Value: s}, nil
+}
@@ -0,0 +1,340 @@
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Operations of a PatchOp.
+const (
+	OpAdd     = "add"
+	OpReplace = "replace"
+	OpRemove  = "remove"
+)
+
+// PatchOp is a request to modify a resource by its Operations, which are applied in order.
+type PatchOp struct {
+	_          struct{}    `json:"-" additionalProperties:"true"`
+	Schemas    []string    `json:"schemas,omitempty"`
+	Operations []Operation `json:"Operations"`
+}
+
+// Operation is an operation of a PatchOp, which adds, replaces or removes the attribute of Path, or
+// the attributes of Value, which is an object, if it has no Path. Op is case-insensitive.
+type Operation struct {
+	_     struct{} `json:"-" additionalProperties:"true"`
+	Op    string   `json:"op"`
+	Path  string   `json:"path,omitempty"`
+	Value any      `json:"value,omitempty"`
+}
+
+// Apply applies the operations of a PatchOp to a User in order, stopping at the first operation
+// which is not valid. The attributes of schema extensions are ignored.
+func (p PatchOp) Apply(user *User) error {
+	for _, op := range p.Operations {
+		if err := user.apply(op); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// apply applies an operation to a User. The attributes of an operation without a path which are not
+// of the User are ignored, as attributes of schema extensions are.
+func (u *User) apply(op Operation) error {
+	kind := strings.ToLower(op.Op)
+	if kind != OpAdd && kind != OpReplace && kind != OpRemove {
+		return invalid(ErrorInvalidSyntax, fmt.Sprintf("unsupported operation %q", op.Op))
+	}
+
+	if op.Path != "" {
+		return u.set(kind, op.Path, op.Value)
+	}
+
+	if kind == OpRemove {
+		return invalid(ErrorNoTarget, "a remove operation must have a path")
+	}
+
+	attributes, ok := op.Value.(map[string]any)
+	if !ok {
+		return invalid(ErrorInvalidValue, "the value of an operation without a path must be an object")
+	}
+
+	for _, path := range slices.Sorted(maps.Keys(attributes)) {
+		err := u.set(kind, path, attributes[path])
+		if e, ok := err.(*Error); ok && e.ScimType == ErrorInvalidPath {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// set adds, replaces or removes the attribute of a path of a User.
+func (u *User) set(kind, path string, value any) error {
+	path = strings.TrimSpace(path)
+	if len(path) > len(UserSchema) && strings.EqualFold(path[:len(UserSchema)+1], UserSchema+":") {
+		path = path[len(UserSchema)+1:]
+	} else if strings.HasPrefix(strings.ToLower(path), "urn:") {
+		return nil
+	}
+
+	attribute, filter, sub := splitPath(path)
+	remove := kind == OpRemove
+
+	switch strings.ToLower(attribute) {
+	case "active":
+		if remove {
+			return invalid(ErrorInvalidValue, "active can't be removed")
+		}
+		active, err := boolValue(path, value)
+		if err != nil {
+			return err
+		}
+		u.Active = &active
+	case "username":
+		if remove {
+			return invalid(ErrorInvalidValue, "userName can't be removed")
+		}
+		return stringValue(path, value, &u.UserName)
+	case "password":
+		if remove {
+			return invalid(ErrorInvalidValue, "password can't be removed")
+		}
+		return stringValue(path, value, &u.Password)
+	case "displayname":
+		if remove {
+			u.DisplayName = ""
+			return nil
+		}
+		return stringValue(path, value, &u.DisplayName)
+	case "externalid":
+		if remove {
+			u.ExternalID = ""
+			return nil
+		}
+		return stringValue(path, value, &u.ExternalID)
+	case "name":
+		return u.setName(kind, path, sub, value)
+	case "emails":
+		return u.setEmails(kind, path, filter, sub, value)
+	case "groups":
+		return u.setGroups(kind, path, filter, value)
+	default:
+		return invalid(ErrorInvalidPath, fmt.Sprintf("unsupported path %q", path))
+	}
+
+	return nil
+}
+
+// setName adds, replaces or removes the name of a User or one of its parts. The formatted name is
+// cleared when a part is changed, since it is made of the parts.
+func (u *User) setName(kind, path, sub string, value any) error {
+	if u.Name == nil {
+		u.Name = &Name{}
+	}
+	remove := kind == OpRemove
+
+	var field *string
+	switch strings.ToLower(sub) {
+	case "":
+		if remove {
+			u.Name = nil
+			return nil
+		}
+		var name Name
+		if err := decodeValue(path, value, &name); err != nil {
+			return err
+		}
+		if kind == OpReplace {
+			*u.Name = name
+			return nil
+		}
+		for _, part := range []struct{ from, to *string }{
+			{&name.Formatted, &u.Name.Formatted}, {&name.GivenName, &u.Name.GivenName}, {&name.FamilyName, &u.Name.FamilyName},
+		} {
+			if *part.from != "" {
+				*part.to = *part.from
+			}
+		}
+		return nil
+	case "formatted":
+		field = &u.Name.Formatted
+	case "givenname":
+		field = &u.Name.GivenName
+		u.Name.Formatted = ""
+	case "familyname":
+		field = &u.Name.FamilyName
+		u.Name.Formatted = ""
+	default:
+		return invalid(ErrorInvalidPath, fmt.Sprintf("unsupported path %q", path))
+	}
+
+	if remove {
+		*field = ""
+		return nil
+	}
+
+	return stringValue(path, value, field)
+}
+
+// setEmails adds, replaces or removes the emails of a User, or the value of the emails which match
+// a filter by their type or value, such as emails[type eq "work"].value.
+func (u *User) setEmails(kind, path, filter, sub string, value any) error {
+	if filter == "" {
+		if sub != "" {
+			return invalid(ErrorInvalidPath, fmt.Sprintf("unsupported path %q", path))
+		}
+		if kind == OpRemove {
+			u.Emails = nil
+			return nil
+		}
+		var emails []Email
+		if err := decodeValue(path, arrayValue(value), &emails); err != nil {
+			return err
+		}
+		if kind == OpReplace {
+			u.Emails = emails
+		} else {
+			u.Emails = append(u.Emails, emails...)
+		}
+		return nil
+	}
+
+	f, err := ParseFilter(filter)
+	if err != nil || (f.Attribute != "type" && f.Attribute != "value") || (sub != "" && !strings.EqualFold(sub, "value")) {
+		return invalid(ErrorInvalidPath, fmt.Sprintf("unsupported path %q", path))
+	}
+	matches := func(email Email) bool {
+		if f.Attribute == "type" {
+			return strings.EqualFold(email.Type, f.Value)
+		}
+		return strings.EqualFold(email.Value, f.Value)
+	}
+
+	if kind == OpRemove {
+		u.Emails = slices.DeleteFunc(u.Emails, matches)
+		return nil
+	}
+
+	var address string
+	if err := stringValue(path, value, &address); err != nil {
+		return err
+	}
+	if i := slices.IndexFunc(u.Emails, matches); i >= 0 {
+		u.Emails[i].Value = address
+		return nil
+	}
+	email := Email{Value: address}
+	if f.Attribute == "type" {
+		email.Type = f.Value
+	}
+	u.Emails = append(u.Emails, email)
+
+	return nil
+}
+
+// setGroups adds, replaces or removes the groups of a User, or removes the groups whose value
+// matches a filter, such as groups[value eq "7d1c"].
+func (u *User) setGroups(kind, path, filter string, value any) error {
+	if filter != "" {
+		f, err := ParseFilter(filter)
+		if err != nil || f.Attribute != "value" || kind != OpRemove {
+			return invalid(ErrorInvalidPath, fmt.Sprintf("unsupported path %q", path))
+		}
+		u.Groups = slices.DeleteFunc(u.Groups, func(group Group) bool { return group.Value == f.Value })
+		return nil
+	}
+
+	if kind == OpRemove && value == nil {
+		u.Groups = nil
+		return nil
+	}
+
+	var groups []Group
+	if err := decodeValue(path, arrayValue(value), &groups); err != nil {
+		return err
+	}
+
+	switch kind {
+	case OpAdd:
+		u.Groups = append(u.Groups, groups...)
+	case OpReplace:
+		u.Groups = groups
+	case OpRemove:
+		u.Groups = slices.DeleteFunc(u.Groups, func(group Group) bool {
+			return slices.ContainsFunc(groups, func(removed Group) bool { return removed.Value == group.Value })
+		})
+	}
+
+	return nil
+}
+
+// splitPath splits a path, such as emails[type eq "work"].value, into its attribute, the filter of
+// the values of the attribute and its sub-attribute.
+func splitPath(path string) (attribute, filter, sub string) {
+	if i, j := strings.Index(path, "["), strings.LastIndex(path, "]"); i >= 0 && j > i {
+		return path[:i], path[i+1 : j], strings.TrimPrefix(path[j+1:], ".")
+	}
+
+	attribute, sub, _ = strings.Cut(path, ".")
+	return attribute, "", sub
+}
+
+// stringValue sets a string to the value of an operation, which must be a string.
+func stringValue(path string, value any, s *string) error {
+	v, ok := value.(string)
+	if !ok {
+		return invalid(ErrorInvalidValue, fmt.Sprintf("the value of %q must be a string", path))
+	}
+	*s = v
+
+	return nil
+}
+
+// boolValue returns the value of an operation, which must be a boolean. Some identity providers
+// send booleans as strings, such as "False", which are parsed.
+func boolValue(path string, value any) (bool, error) {
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case string:
+		b, err := strconv.ParseBool(strings.ToLower(v))
+		if err == nil {
+			return b, nil
+		}
+	}
+
+	return false, invalid(ErrorInvalidValue, fmt.Sprintf("the value of %q must be a boolean", path))
+}
+
+// decodeValue decodes the value of an operation, such as an object or an array, into v.
+func decodeValue(path string, value any, v any) error {
+	content, err := json.Marshal(value)
+	if err == nil {
+		err = json.Unmarshal(content, v)
+	}
+	if err != nil {
+		return invalid(ErrorInvalidValue, fmt.Sprintf("the value of %q is not valid", path))
+	}
+
+	return nil
+}
+
+// arrayValue returns the value of an operation of a multi-valued attribute as an array, since some
+// identity providers send a single value as an object.
+func arrayValue(value any) any {
+	if object, ok := value.(map[string]any); ok {
+		return []any{object}
+	}
+
+	return value
+}
@@ -0,0 +1,236 @@
+// Package scim implements the Users resource of SCIM 2.0 (RFC 7643 and RFC 7644), by which
+// identity providers provision the accounts of their users in applications, and deprovision them
+// when the users leave.
+package scim
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ContentType is the media type of SCIM requests and responses.
+const ContentType = "application/scim+json"
+
+// Schemas of SCIM resources and messages.
+const (
+	UserSchema                  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	ListResponseSchema          = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	PatchOpSchema               = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	ErrorSchema                 = "urn:ietf:params:scim:api:messages:2.0:Error"
+	ServiceProviderConfigSchema = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+)
+
+// UserResourceType is the type of the User resource, in the metadata of users.
+const UserResourceType = "User"
+
+// Types of the errors of SCIM, by which clients tell why a request failed.
+const (
+	ErrorInvalidFilter = "invalidFilter"
+	ErrorInvalidSyntax = "invalidSyntax"
+	ErrorInvalidPath   = "invalidPath"
+	ErrorInvalidValue  = "invalidValue"
+	ErrorNoTarget      = "noTarget"
+	ErrorUniqueness    = "uniqueness"
+)
+
+// User is a user of an identity provider, who is provisioned as an account. Attributes which are
+// not of the core User schema, such as those of schema extensions, are ignored. Password is only
+// written by clients and never returned, and ID and Meta are only returned.
+type User struct {
+	_           struct{} `json:"-" additionalProperties:"true"`
+	Schemas     []string `json:"schemas,omitempty"`
+	ID          string   `json:"id,omitempty" readOnly:"true"`
+	ExternalID  string   `json:"externalId,omitempty"`
+	UserName    string   `json:"userName,omitempty"`
+	Name        *Name    `json:"name,omitempty"`
+	DisplayName string   `json:"displayName,omitempty"`
+	Emails      []Email  `json:"emails,omitempty"`
+	Active      *bool    `json:"active,omitempty"`
+	Password    string   `json:"password,omitempty"`
+	Groups      []Group  `json:"groups,omitempty"`
+	Meta        *Meta    `json:"meta,omitempty" readOnly:"true"`
+}
+
+// Name is the name of a User. Formatted is the full name, which GivenName and FamilyName are the
+// parts of.
+type Name struct {
+	_          struct{} `json:"-" additionalProperties:"true"`
+	Formatted  string   `json:"formatted,omitempty"`
+	GivenName  string   `json:"givenName,omitempty"`
+	FamilyName string   `json:"familyName,omitempty"`
+}
+
+// Email is an email address of a User, of a Type such as work.
+type Email struct {
+	_       struct{} `json:"-" additionalProperties:"true"`
+	Value   string   `json:"value,omitempty"`
+	Type    string   `json:"type,omitempty"`
+	Primary bool     `json:"primary,omitempty"`
+}
+
+// Group is a group which a User is a member of, by its ID in Value and its name in Display.
+type Group struct {
+	_       struct{} `json:"-" additionalProperties:"true"`
+	Value   string   `json:"value,omitempty"`
+	Display string   `json:"display,omitempty"`
+}
+
+// Meta is the metadata of a resource. Version is a weak entity tag of the resource.
+type Meta struct {
+	ResourceType string    `json:"resourceType"`
+	Created      time.Time `json:"created"`
+	LastModified time.Time `json:"lastModified"`
+	Location     string    `json:"location,omitempty"`
+	Version      string    `json:"version,omitempty"`
+}
+
+// ListResponse is a page of the resources which match a query, of which the first is the
+// StartIndex-th, from 1, of TotalResults.
+type ListResponse struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int64    `json:"totalResults"`
+	StartIndex   int64    `json:"startIndex"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	Resources    []User   `json:"Resources"`
+}
+
+// NewListResponse returns the list response of a page of users.
+func NewListResponse(users []User, total, startIndex int64) ListResponse {
+	if users == nil {
+		users = []User{}
+	}
+
+	return ListResponse{
+		Schemas:      []string{ListResponseSchema},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(users),
+		Resources:    users,
+	}
+}
+
+// FullName returns the name of a User: the formatted name, its given and family names if it has
+// none, or the display name if it has neither.
+func (u *User) FullName() string {
+	if u.Name != nil {
+		if formatted := strings.TrimSpace(u.Name.Formatted); formatted != "" {
+			return formatted
+		}
+		if name := strings.TrimSpace(u.Name.GivenName + " " + u.Name.FamilyName); name != "" {
+			return name
+		}
+	}
+
+	return strings.TrimSpace(u.DisplayName)
+}
+
+// SplitName returns the Name of a full name, whose family name is its last word.
+func SplitName(full string) *Name {
+	name := &Name{Formatted: full}
+
+	words := strings.Fields(full)
+	switch len(words) {
+	case 0:
+	case 1:
+		name.GivenName = words[0]
+	default:
+		name.GivenName = strings.Join(words[:len(words)-1], " ")
+		name.FamilyName = words[len(words)-1]
+	}
+
+	return name
+}
+
+// Error is a SCIM error response, with the HTTP status of the response in Status and the type of
+// the error, if any, in ScimType. It has GetStatus and ContentType methods, so that it is written
+// as the response of the request by huma.
+type Error struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+}
+
+// NewError returns an Error with an HTTP status.
+func NewError(status int, scimType, detail string) *Error {
+	return &Error{
+		Schemas:  []string{ErrorSchema},
+		Status:   strconv.Itoa(status),
+		ScimType: scimType,
+		Detail:   detail,
+	}
+}
+
+// invalid returns a bad request Error of a type.
+func invalid(scimType, detail string) *Error {
+	return NewError(http.StatusBadRequest, scimType, detail)
+}
+
+func (e *Error) Error() string {
+	return e.Detail
+}
+
+// GetStatus returns the HTTP status of the Error.
+func (e *Error) GetStatus() int {
+	status, _ := strconv.Atoi(e.Status)
+	return status
+}
+
+// ContentType returns the media type of the Error, which is the SCIM media type.
+func (e *Error) ContentType(string) string {
+	return ContentType
+}
+
+// ServiceProviderConfig describes the features of SCIM which a service provider supports.
+type ServiceProviderConfig struct {
+	Schemas               []string               `json:"schemas"`
+	Patch                 Supported              `json:"patch"`
+	Bulk                  BulkSupport            `json:"bulk"`
+	Filter                FilterSupport          `json:"filter"`
+	ChangePassword        Supported              `json:"changePassword"`
+	Sort                  Supported              `json:"sort"`
+	ETag                  Supported              `json:"etag"`
+	AuthenticationSchemes []AuthenticationScheme `json:"authenticationSchemes"`
+}
+
+// Supported tells whether a feature is supported.
+type Supported struct {
+	Supported bool `json:"supported"`
+}
+
+// BulkSupport tells whether bulk operations are supported, and their limits.
+type BulkSupport struct {
+	Supported      bool `json:"supported"`
+	MaxOperations  int  `json:"maxOperations"`
+	MaxPayloadSize int  `json:"maxPayloadSize"`
+}
+
+// FilterSupport tells whether filters are supported, and the most results of a query.
+type FilterSupport struct {
+	Supported  bool `json:"supported"`
+	MaxResults int  `json:"maxResults"`
+}
+
+// AuthenticationScheme is a scheme by which clients authenticate, such as oauthbearertoken.
+type AuthenticationScheme struct {
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// NewServiceProviderConfig returns the configuration of a service provider which supports patching
+// and filtering users, with at most maxResults in a page, and authenticates clients by bearer
+// tokens.
+func NewServiceProviderConfig(maxResults int) ServiceProviderConfig {
+	return ServiceProviderConfig{
+		Schemas:        []string{ServiceProviderConfigSchema},
+		Patch:          Supported{Supported: true},
+		Filter:         FilterSupport{Supported: true, MaxResults: maxResults},
+		ChangePassword: Supported{Supported: true},
+		AuthenticationSchemes: []AuthenticationScheme{
+			{Type: "oauthbearertoken", Name: "OAuth Bearer Token", Description: "Authentication with a bearer token"},
+		},
+	}
+}
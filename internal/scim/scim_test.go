@@ -0,0 +1,143 @@
+package scim
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   Filter
+		valid  bool
+	}{
+		{filter: `userName eq "noa@example.com"`, want: Filter{Attribute: "username", Value: "noa@example.com"}, valid: true},
+		{filter: ` externalId EQ "a \"quoted\" id" `, want: Filter{Attribute: "externalid", Value: `a "quoted" id`}, valid: true},
+		{filter: `userName sw "noa"`},
+		{filter: `userName eq noa`},
+		{filter: `userName eq "noa" and active eq true`},
+		{filter: ``},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseFilter(tt.filter)
+		if !tt.valid {
+			var e *Error
+			if !errors.As(err, &e) || e.ScimType != ErrorInvalidFilter || e.GetStatus() != 400 {
+				t.Errorf("ParseFilter(%q) error = %v; want an invalidFilter error", tt.filter, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseFilter(%q) = %+v, %v; want %+v", tt.filter, got, err, tt.want)
+		}
+	}
+}
+
+func TestPatchOpApply(t *testing.T) {
+	user := func() *User {
+		return &User{
+			UserName: "noa@example.com",
+			Name:     SplitName("Noa Bat Levi"),
+			Emails:   []Email{{Value: "noa@example.com", Type: "work", Primary: true}},
+			Active:   ptr(true),
+		}
+	}
+
+	tests := []struct {
+		name  string
+		patch string
+		check func(u *User) bool
+	}{
+		{
+			name:  "pathless",
+			patch: `{"Operations": [{"op": "replace", "value": {"active": false, "displayName": "Noa"}}]}`,
+			check: func(u *User) bool { return !*u.Active && u.DisplayName == "Noa" },
+		},
+		{
+			name:  "boolean string",
+			patch: `{"Operations": [{"op": "Replace", "path": "active", "value": "False"}]}`,
+			check: func(u *User) bool { return !*u.Active },
+		},
+		{
+			name:  "name part",
+			patch: `{"Operations": [{"op": "replace", "path": "name.familyName", "value": "Cohen"}]}`,
+			check: func(u *User) bool { return u.FullName() == "Noa Bat Cohen" },
+		},
+		{
+			name:  "email by type",
+			patch: `{"Operations": [{"op": "replace", "path": "emails[type eq \"work\"].value", "value": "noa@school.example"}]}`,
+			check: func(u *User) bool { return len(u.Emails) == 1 && u.Emails[0].Value == "noa@school.example" },
+		},
+		{
+			name:  "core schema path",
+			patch: `{"Operations": [{"op": "replace", "path": "urn:ietf:params:scim:schemas:core:2.0:User:userName", "value": "noa@school.example"}]}`,
+			check: func(u *User) bool { return u.UserName == "noa@school.example" },
+		},
+		{
+			name:  "extension ignored",
+			patch: `{"Operations": [{"op": "add", "path": "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:department", "value": "7B"}, {"op": "add", "value": {"title": "Pupil", "externalId": "1001"}}]}`,
+			check: func(u *User) bool { return u.ExternalID == "1001" },
+		},
+		{
+			name:  "groups",
+			patch: `{"Operations": [{"op": "add", "path": "groups", "value": {"value": "g1", "display": "Students"}}, {"op": "add", "path": "groups", "value": [{"value": "g2"}]}, {"op": "remove", "path": "groups[value eq \"g1\"]"}]}`,
+			check: func(u *User) bool { return reflect.DeepEqual(u.Groups, []Group{{Value: "g2"}}) },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var patch PatchOp
+			if err := json.Unmarshal([]byte(tt.patch), &patch); err != nil {
+				t.Fatalf("failed to decode patch: %v", err)
+			}
+
+			u := user()
+			if err := patch.Apply(u); err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+			if !tt.check(u) {
+				t.Errorf("Apply() = %+v", u)
+			}
+		})
+	}
+
+	invalidPatches := map[string]string{
+		"unknown path":      `{"Operations": [{"op": "replace", "path": "nickName", "value": "Noa"}]}`,
+		"unknown operation": `{"Operations": [{"op": "move", "path": "displayName", "value": "Noa"}]}`,
+		"not a boolean":     `{"Operations": [{"op": "replace", "path": "active", "value": "maybe"}]}`,
+		"remove username":   `{"Operations": [{"op": "remove", "path": "userName"}]}`,
+	}
+	for name, body := range invalidPatches {
+		var patch PatchOp
+		if err := json.Unmarshal([]byte(body), &patch); err != nil {
+			t.Fatalf("failed to decode patch: %v", err)
+		}
+
+		var e *Error
+		if err := patch.Apply(user()); !errors.As(err, &e) || e.GetStatus() != 400 {
+			t.Errorf("Apply() of %s error = %v; want a bad request error", name, err)
+		}
+	}
+}
+
+func TestSplitName(t *testing.T) {
+	tests := map[string]Name{
+		"Noa Bat Levi": {Formatted: "Noa Bat Levi", GivenName: "Noa Bat", FamilyName: "Levi"},
+		"Noa":          {Formatted: "Noa", GivenName: "Noa"},
+		"":             {},
+	}
+
+	for full, want := range tests {
+		if got := SplitName(full); *got != want {
+			t.Errorf("SplitName(%q) = %+v; want %+v", full, *got, want)
+		}
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
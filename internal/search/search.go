@@ -0,0 +1,406 @@
+// Package search mirrors books into OpenSearch (or Elasticsearch), whose full text search
+// offers typo tolerance, relevance ranking and language analyzers which regular expressions
+// in MongoDB cannot.
+//
+// The index is a copy of the books collection, which is kept up to date from the events of
+// the outbox, so it may briefly lag behind it.
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mzeevi/library/internal/data"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultAnalyzer is the language analyzer of the text fields of books.
+const DefaultAnalyzer = "english"
+
+// maxErrorBody limits how much of an error response is read.
+const maxErrorBody = 4096
+
+var ErrUnsupportedSort = errors.New("unsupported sort field")
+
+// sortFields maps the sort fields of books to the fields of documents.
+var sortFields = map[string]string{
+	"id":             "id",
+	"pages":          "pages",
+	"edition":        "edition",
+	"copies":         "copies",
+	"borrowedCopies": "borrowed_copies",
+	"publishedAt":    "published_at",
+	"title":          "title.keyword",
+	"popularity":     "circulation.borrows",
+}
+
+// Client indexes and searches books in an OpenSearch index.
+type Client struct {
+	URL   string
+	Index string
+	// Username and Password are sent with basic authentication if set.
+	Username string
+	Password string
+	// Analyzer is the language analyzer of titles, such as english, in addition to the standard one.
+	Analyzer string
+	Client   *http.Client
+}
+
+// document is a book as it is indexed.
+type document struct {
+	ID              string            `json:"id"`
+	Title           string            `json:"title"`
+	Identifiers     []data.Identifier `json:"identifiers"`
+	Language        string            `json:"language,omitempty"`
+	Format          string            `json:"format,omitempty"`
+	Authors         []string          `json:"authors"`
+	Publishers      []string          `json:"publishers"`
+	Genres          []string          `json:"genres"`
+	Holdings        []data.Holding    `json:"holdings,omitempty"`
+	Pages           int               `json:"pages"`
+	Edition         int               `json:"edition"`
+	Copies          int               `json:"copies"`
+	BorrowedCopies  int               `json:"borrowed_copies"`
+	AvailableCopies int               `json:"available_copies"`
+	PublishedAt     time.Time         `json:"published_at"`
+	Circulation     data.Circulation  `json:"circulation"`
+}
+
+func newDocument(book data.Book) document {
+	return document{
+		ID:              book.ID,
+		Title:           book.Title,
+		Identifiers:     book.Identifiers,
+		Language:        book.Language,
+		Format:          book.Format,
+		Authors:         book.Authors,
+		Publishers:      book.Publishers,
+		Genres:          book.Genres,
+		Holdings:        book.Holdings,
+		Pages:           book.Pages,
+		Edition:         book.Edition,
+		Copies:          book.Copies,
+		BorrowedCopies:  book.BorrowedCopies,
+		AvailableCopies: book.Copies - book.BorrowedCopies,
+		PublishedAt:     book.PublishedAt,
+		Circulation:     book.Circulation,
+	}
+}
+
+func (d document) book() data.Book {
+	return data.Book{
+		ID:             d.ID,
+		Title:          d.Title,
+		Identifiers:    d.Identifiers,
+		Language:       d.Language,
+		Format:         d.Format,
+		Authors:        d.Authors,
+		Publishers:     d.Publishers,
+		Genres:         d.Genres,
+		Holdings:       d.Holdings,
+		Pages:          d.Pages,
+		Edition:        d.Edition,
+		Copies:         d.Copies,
+		BorrowedCopies: d.BorrowedCopies,
+		PublishedAt:    d.PublishedAt,
+		Circulation:    d.Circulation,
+	}
+}
+
+// CreateIndex creates the index with its mappings, if it does not exist yet.
+func (c *Client) CreateIndex(ctx context.Context) error {
+	analyzer := c.Analyzer
+	if analyzer == "" {
+		analyzer = DefaultAnalyzer
+	}
+
+	keyword := map[string]any{"type": "keyword"}
+	text := map[string]any{
+		"type": "text",
+		"fields": map[string]any{
+			"keyword":  keyword,
+			"language": map[string]any{"type": "text", "analyzer": analyzer},
+		},
+	}
+
+	holdings := map[string]any{
+		"properties": map[string]any{
+			"copy":           map[string]any{"type": "integer"},
+			"call_number":    keyword,
+			"shelf_location": keyword,
+		},
+	}
+
+	circulation := map[string]any{
+		"properties": map[string]any{
+			"borrows":           map[string]any{"type": "integer"},
+			"last_borrowed_at":  map[string]any{"type": "date"},
+			"average_loan_days": map[string]any{"type": "float"},
+		},
+	}
+
+	mappings := map[string]any{
+		"mappings": map[string]any{
+			"properties": map[string]any{
+				"id":               keyword,
+				"title":            text,
+				"identifiers":      map[string]any{"properties": map[string]any{"type": keyword, "value": keyword}},
+				"language":         keyword,
+				"format":           keyword,
+				"authors":          text,
+				"publishers":       text,
+				"genres":           keyword,
+				"holdings":         holdings,
+				"pages":            map[string]any{"type": "integer"},
+				"edition":          map[string]any{"type": "integer"},
+				"copies":           map[string]any{"type": "integer"},
+				"borrowed_copies":  map[string]any{"type": "integer"},
+				"available_copies": map[string]any{"type": "integer"},
+				"published_at":     map[string]any{"type": "date"},
+				"circulation":      circulation,
+			},
+		},
+	}
+
+	err := c.do(ctx, http.MethodPut, c.Index, mappings, nil)
+	if err != nil && strings.Contains(err.Error(), "resource_already_exists_exception") {
+		return nil
+	}
+
+	return err
+}
+
+// IndexBook adds a book to the index, or replaces it if it is indexed already.
+func (c *Client) IndexBook(ctx context.Context, book data.Book) error {
+	return c.do(ctx, http.MethodPut, fmt.Sprintf("%s/_doc/%s", c.Index, url.PathEscape(book.ID)), newDocument(book), nil)
+}
+
+// DeleteBook removes a book from the index. Removing a book which is not indexed is not an error.
+func (c *Client) DeleteBook(ctx context.Context, id string) error {
+	err := c.do(ctx, http.MethodDelete, fmt.Sprintf("%s/_doc/%s", c.Index, url.PathEscape(id)), nil, nil)
+	if err != nil && strings.Contains(err.Error(), "status 404") {
+		return nil
+	}
+
+	return err
+}
+
+// SearchBooks returns a page of the books matching a filter and the total number of matches.
+// A title is matched against the titles and authors of books, tolerating typos, and books are
+// ranked by relevance unless a sort field is given.
+func (c *Client) SearchBooks(ctx context.Context, filter data.BookFilter, paginator data.Paginator, sort string) ([]data.Book, int64, error) {
+	body := map[string]any{
+		"query":            buildQuery(filter),
+		"track_total_hits": true,
+	}
+
+	if paginator.Page > 0 && paginator.PageSize > 0 {
+		body["from"] = (paginator.Page - 1) * paginator.PageSize
+		body["size"] = paginator.PageSize
+	}
+
+	if sort != "" {
+		field, ok := sortFields[strings.TrimPrefix(sort, "-")]
+		if !ok {
+			return nil, 0, fmt.Errorf("%w: %s", ErrUnsupportedSort, sort)
+		}
+
+		order := "asc"
+		if strings.HasPrefix(sort, "-") {
+			order = "desc"
+		}
+		body["sort"] = []any{map[string]any{field: map[string]any{"order": order}}}
+	}
+
+	var result struct {
+		Hits struct {
+			Total struct {
+				Value int64 `json:"value"`
+			} `json:"total"`
+			Hits []struct {
+				Source document `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+
+	if err := c.do(ctx, http.MethodPost, c.Index+"/_search", body, &result); err != nil {
+		return nil, 0, err
+	}
+
+	books := make([]data.Book, 0, len(result.Hits.Hits))
+	for _, hit := range result.Hits.Hits {
+		books = append(books, hit.Source.book())
+	}
+
+	return books, result.Hits.Total.Value, nil
+}
+
+// buildQuery constructs a bool query of a filter. The title is scored unless it must match exactly or
+// as a prefix, the other fields only filter, and excluded authors and genres filter out the books
+// which have any of them.
+func buildQuery(filter data.BookFilter) map[string]any {
+	var must []any
+	var filters []any
+	var mustNot []any
+
+	switch {
+	case filter.Title != nil && (filter.TitleMatch == data.MatchExact || filter.TitleMatch == data.MatchPrefix):
+		kind := "term"
+		if filter.TitleMatch == data.MatchPrefix {
+			kind = "prefix"
+		}
+		filters = append(filters, map[string]any{kind: map[string]any{
+			"title.keyword": map[string]any{"value": *filter.Title, "case_insensitive": true},
+		}})
+	case filter.Title != nil:
+		must = append(must, map[string]any{
+			"multi_match": map[string]any{
+				"query":     *filter.Title,
+				"fields":    []string{"title^3", "title.language^2", "authors"},
+				"fuzziness": "AUTO",
+			},
+		})
+	}
+
+	if filter.ID != nil {
+		filters = append(filters, term("id", *filter.ID))
+	}
+	if filter.IDs != nil {
+		ids := make([]string, 0, len(filter.IDs))
+		for _, id := range filter.IDs {
+			ids = append(ids, string(id))
+		}
+		filters = append(filters, terms("id", ids))
+	}
+	if filter.Identifier != nil {
+		filters = append(filters, term("identifiers.value", *filter.Identifier))
+	}
+	if filter.Language != nil {
+		filters = append(filters, term("language", *filter.Language))
+	}
+	if filter.Format != nil {
+		filters = append(filters, term("format", *filter.Format))
+	}
+	if filter.CallNumber != nil {
+		filters = append(filters, map[string]any{"prefix": map[string]any{"holdings.call_number": *filter.CallNumber}})
+	}
+	if filter.ShelfLocation != nil {
+		filters = append(filters, term("holdings.shelf_location", *filter.ShelfLocation))
+	}
+	if len(filter.Authors) > 0 {
+		filters = append(filters, terms("authors.keyword", filter.Authors))
+	}
+	if len(filter.Publishers) > 0 {
+		filters = append(filters, terms("publishers.keyword", filter.Publishers))
+	}
+	if len(filter.Genres) > 0 {
+		filters = append(filters, terms("genres", filter.Genres))
+	}
+	if len(filter.ExcludeAuthors) > 0 {
+		mustNot = append(mustNot, terms("authors.keyword", filter.ExcludeAuthors))
+	}
+	if len(filter.ExcludeGenres) > 0 {
+		mustNot = append(mustNot, terms("genres", filter.ExcludeGenres))
+	}
+
+	filters = appendRange(filters, "pages", filter.MinPages, filter.MaxPages)
+	filters = appendRange(filters, "edition", filter.MinEdition, filter.MaxEdition)
+	filters = appendRange(filters, "copies", filter.MinCopies, filter.MaxCopies)
+	filters = appendRange(filters, "borrowed_copies", filter.MinBorrowedCopies, filter.MaxBorrowedCopies)
+	filters = appendRange(filters, "published_at", filter.MinPublishedAt, filter.MaxPublishedAt)
+
+	if filter.Available != nil {
+		if *filter.Available {
+			filters = append(filters, map[string]any{"range": map[string]any{"available_copies": map[string]any{"gte": 1}}})
+		} else {
+			filters = append(filters, map[string]any{"range": map[string]any{"available_copies": map[string]any{"lte": 0}}})
+		}
+	}
+
+	if len(must) == 0 && len(filters) == 0 && len(mustNot) == 0 {
+		return map[string]any{"match_all": map[string]any{}}
+	}
+
+	query := map[string]any{"must": must, "filter": filters}
+	if len(mustNot) > 0 {
+		query["must_not"] = mustNot
+	}
+
+	return map[string]any{"bool": query}
+}
+
+func term(field string, value any) map[string]any {
+	return map[string]any{"term": map[string]any{field: value}}
+}
+
+func terms(field string, values []string) map[string]any {
+	return map[string]any{"terms": map[string]any{field: values}}
+}
+
+// appendRange appends a range filter on a field if either bound is set.
+func appendRange[T any](filters []any, field string, minValue, maxValue *T) []any {
+	if minValue == nil && maxValue == nil {
+		return filters
+	}
+
+	bounds := map[string]any{}
+	if minValue != nil {
+		bounds["gte"] = *minValue
+	}
+	if maxValue != nil {
+		bounds["lte"] = *maxValue
+	}
+
+	return append(filters, map[string]any{"range": map[string]any{field: bounds}})
+}
+
+// do sends a request with a JSON body to a path of the cluster, and decodes the JSON response into v if it is set.
+func (c *Client) do(ctx context.Context, method, path string, body, v any) error {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(c.URL, "/")+"/"+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return fmt.Errorf("opensearch %s %s failed, status %d: %s", method, path, resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+
+	if v == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
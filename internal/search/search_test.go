@@ -0,0 +1,136 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/mzeevi/library/internal/data"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBuildQuery(t *testing.T) {
+	title := "dune"
+	minPages, maxPages := 100, 300
+	available := true
+
+	got := buildQuery(data.BookFilter{Title: &title, MinPages: &minPages, MaxPages: &maxPages, Genres: []string{"Fiction"}, Available: &available})
+
+	want := map[string]any{"bool": map[string]any{
+		"must": []any{map[string]any{"multi_match": map[string]any{
+			"query":     "dune",
+			"fields":    []string{"title^3", "title.language^2", "authors"},
+			"fuzziness": "AUTO",
+		}}},
+		"filter": []any{
+			map[string]any{"terms": map[string]any{"genres": []string{"Fiction"}}},
+			map[string]any{"range": map[string]any{"pages": map[string]any{"gte": 100, "lte": 300}}},
+			map[string]any{"range": map[string]any{"available_copies": map[string]any{"gte": 1}}},
+		},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("buildQuery() = %v; want %v", got, want)
+	}
+
+	if got = buildQuery(data.BookFilter{}); !reflect.DeepEqual(got, map[string]any{"match_all": map[string]any{}}) {
+		t.Errorf("buildQuery() without filters = %v; want match_all", got)
+	}
+
+	got = buildQuery(data.BookFilter{IDs: []data.BookID{"5f1b2c3d4e5f6a7b8c9d0e1f"}})
+	want = map[string]any{"bool": map[string]any{
+		"must":   []any(nil),
+		"filter": []any{map[string]any{"terms": map[string]any{"id": []string{"5f1b2c3d4e5f6a7b8c9d0e1f"}}}},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("buildQuery() with IDs = %v; want %v", got, want)
+	}
+
+	got = buildQuery(data.BookFilter{Genres: []string{"Fiction"}, ExcludeGenres: []string{"Romance"}, ExcludeAuthors: []string{"Jane Austen"}})
+	want = map[string]any{"bool": map[string]any{
+		"must":   []any(nil),
+		"filter": []any{map[string]any{"terms": map[string]any{"genres": []string{"Fiction"}}}},
+		"must_not": []any{
+			map[string]any{"terms": map[string]any{"authors.keyword": []string{"Jane Austen"}}},
+			map[string]any{"terms": map[string]any{"genres": []string{"Romance"}}},
+		},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("buildQuery() with exclusions = %v; want %v", got, want)
+	}
+
+	got = buildQuery(data.BookFilter{Title: &title, TitleMatch: data.MatchPrefix})
+	want = map[string]any{"bool": map[string]any{
+		"must":   []any(nil),
+		"filter": []any{map[string]any{"prefix": map[string]any{"title.keyword": map[string]any{"value": "dune", "case_insensitive": true}}}},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("buildQuery() with a title prefix = %v; want %v", got, want)
+	}
+}
+
+func TestClient(t *testing.T) {
+	var requests []string
+	var indexed document
+	var searched map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/books":
+			http.Error(w, `{"error":{"type":"resource_already_exists_exception"}}`, http.StatusBadRequest)
+		case r.Method == http.MethodPut:
+			_ = json.NewDecoder(r.Body).Decode(&indexed)
+		case r.Method == http.MethodDelete:
+			http.Error(w, `{"result":"not_found"}`, http.StatusNotFound)
+		case r.URL.Path == "/books/_search":
+			_ = json.NewDecoder(r.Body).Decode(&searched)
+			_, _ = w.Write([]byte(`{"hits":{"total":{"value":42},"hits":[{"_source":{"id":"1","title":"Dune","copies":2,"borrowed_copies":1}}]}}`))
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	c := &Client{URL: srv.URL, Index: "books"}
+
+	if err := c.CreateIndex(ctx); err != nil {
+		t.Errorf("CreateIndex() of an existing index error = %v", err)
+	}
+
+	book := data.Book{ID: "1", Title: "Dune", Copies: 3, BorrowedCopies: 1, PublishedAt: time.Date(1965, time.August, 1, 0, 0, 0, 0, time.UTC)}
+	if err := c.IndexBook(ctx, book); err != nil {
+		t.Fatalf("IndexBook() error = %v", err)
+	}
+	if indexed.ID != "1" || indexed.AvailableCopies != 2 {
+		t.Errorf("indexed document = %+v; want book 1 with 2 available copies", indexed)
+	}
+
+	if err := c.DeleteBook(ctx, "2"); err != nil {
+		t.Errorf("DeleteBook() of a missing book error = %v", err)
+	}
+
+	books, total, err := c.SearchBooks(ctx, data.BookFilter{}, data.Paginator{Page: 3, PageSize: 10}, "-publishedAt")
+	if err != nil {
+		t.Fatalf("SearchBooks() error = %v", err)
+	}
+	if total != 42 || len(books) != 1 || books[0].Title != "Dune" || books[0].BorrowedCopies != 1 {
+		t.Errorf("SearchBooks() = %+v, %d; want Dune of 42", books, total)
+	}
+	if searched["from"] != float64(20) || searched["size"] != float64(10) {
+		t.Errorf("search from, size = %v, %v; want 20, 10", searched["from"], searched["size"])
+	}
+	wantSort := []any{map[string]any{"published_at": map[string]any{"order": "desc"}}}
+	if !reflect.DeepEqual(searched["sort"], wantSort) {
+		t.Errorf("search sort = %v; want %v", searched["sort"], wantSort)
+	}
+
+	if _, _, err = c.SearchBooks(ctx, data.BookFilter{}, data.Paginator{}, "color"); err == nil {
+		t.Error("SearchBooks() with an unsupported sort error = nil; want an error")
+	}
+
+	want := []string{"PUT /books", "PUT /books/_doc/1", "DELETE /books/_doc/2", "POST /books/_search"}
+	if !reflect.DeepEqual(requests, want) {
+		t.Errorf("requests = %v; want %v", requests, want)
+	}
+}
@@ -0,0 +1,149 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrEmptySecret = errors.New("secret is empty")
+)
+
+// Source loads the current value of a secret.
+type Source interface {
+	// Load returns the current value of the secret.
+	Load(ctx context.Context) (string, error)
+}
+
+// StaticSource is a Source for a secret which was passed directly.
+type StaticSource string
+
+// FileSource is a Source for a secret which is stored in a file, such as a mounted Kubernetes secret.
+type FileSource struct {
+	Path string
+}
+
+// Secret holds the value of a secret loaded from a Source. It keeps the previous value
+// after a rotation so that values signed with it can still be verified.
+type Secret struct {
+	source   Source
+	mutex    sync.RWMutex
+	current  string
+	previous string
+}
+
+// Load returns the static value.
+func (s StaticSource) Load(_ context.Context) (string, error) {
+	return string(s), nil
+}
+
+// Load reads the secret from the file, trimming surrounding whitespace.
+func (f FileSource) Load(_ context.Context) (string, error) {
+	b, err := os.ReadFile(f.Path)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(b)), nil
+}
+
+// NewSource returns the Source for a secret which can be configured as a value,
+// a file or a Vault path. A file takes precedence over Vault, and Vault over a value.
+func NewSource(value, file, vaultPath string, vault Vault) Source {
+	switch {
+	case file != "":
+		return FileSource{Path: file}
+	case vaultPath != "":
+		return VaultSource{Vault: vault, Path: vaultPath}
+	default:
+		return StaticSource(value)
+	}
+}
+
+// Resolve loads the value of a secret once.
+func Resolve(ctx context.Context, source Source) (string, error) {
+	value, err := source.Load(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if value == "" {
+		return "", ErrEmptySecret
+	}
+
+	return value, nil
+}
+
+// New creates a Secret and loads its initial value from the Source. Like Refresh, it fails
+// with ErrEmptySecret if the Source is empty.
+func New(ctx context.Context, source Source) (*Secret, error) {
+	value, err := Resolve(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Secret{source: source, current: value}, nil
+}
+
+// Value returns the current value of the Secret.
+func (s *Secret) Value() string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.current
+}
+
+// Values returns the current value of the Secret, followed by the previous value if it was rotated.
+func (s *Secret) Values() []string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if s.previous == "" {
+		return []string{s.current}
+	}
+
+	return []string{s.current, s.previous}
+}
+
+// Refresh reloads the Secret from its Source, returning whether the value changed.
+func (s *Secret) Refresh(ctx context.Context) (bool, error) {
+	value, err := Resolve(ctx, s.source)
+	if err != nil {
+		return false, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if value == s.current {
+		return false, nil
+	}
+
+	s.previous = s.current
+	s.current = value
+
+	return true, nil
+}
+
+// Watch refreshes the Secret every interval until the context is cancelled.
+// onRefresh is called after every refresh attempt.
+func (s *Secret) Watch(ctx context.Context, interval time.Duration, onRefresh func(changed bool, err error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			changed, err := s.Refresh(ctx)
+			if onRefresh != nil {
+				onRefresh(changed, err)
+			}
+		}
+	}
+}
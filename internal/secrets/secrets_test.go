@@ -0,0 +1,172 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestNewSource(t *testing.T) {
+	vault := Vault{Address: "http://vault.example.com"}
+
+	tests := []struct {
+		name      string
+		value     string
+		file      string
+		vaultPath string
+		want      Source
+	}{
+		{name: "value", value: "secret", want: StaticSource("secret")},
+		{name: "file before vault", value: "secret", file: "/run/secret", vaultPath: "secret/data/library", want: FileSource{Path: "/run/secret"}},
+		{name: "vault before value", value: "secret", vaultPath: "secret/data/library", want: VaultSource{Vault: vault, Path: "secret/data/library"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewSource(tt.value, tt.file, tt.vaultPath, vault); got != tt.want {
+				t.Errorf("NewSource() = %#v; want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "secret")
+	if err := os.WriteFile(path, []byte("  file-secret\n"), 0o600); err != nil {
+		t.Fatalf("failed to write secret file: %v", err)
+	}
+	empty := filepath.Join(dir, "empty")
+	if err := os.WriteFile(empty, []byte("\n"), 0o600); err != nil {
+		t.Fatalf("failed to write secret file: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		source  Source
+		want    string
+		wantErr error
+	}{
+		{name: "static", source: StaticSource("secret"), want: "secret"},
+		{name: "empty static", source: StaticSource(""), wantErr: ErrEmptySecret},
+		{name: "file", source: FileSource{Path: path}, want: "file-secret"},
+		{name: "empty file", source: FileSource{Path: empty}, wantErr: ErrEmptySecret},
+		{name: "missing file", source: FileSource{Path: filepath.Join(dir, "missing")}, wantErr: os.ErrNotExist},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret, err := New(context.Background(), tt.source)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("New() error = %v; want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+
+			if got := secret.Value(); got != tt.want {
+				t.Errorf("Value() = %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSecretRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret")
+	write := func(value string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(value), 0o600); err != nil {
+			t.Fatalf("failed to write secret file: %v", err)
+		}
+	}
+
+	write("first")
+	secret, err := New(context.Background(), FileSource{Path: path})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if got := secret.Values(); !slices.Equal(got, []string{"first"}) {
+		t.Errorf("Values() before a rotation = %q; want %q", got, []string{"first"})
+	}
+
+	if changed, err := secret.Refresh(context.Background()); err != nil || changed {
+		t.Errorf("Refresh() of the same value = %v, %v; want false, nil", changed, err)
+	}
+
+	write("second")
+	if changed, err := secret.Refresh(context.Background()); err != nil || !changed {
+		t.Errorf("Refresh() of a rotated value = %v, %v; want true, nil", changed, err)
+	}
+	if got := secret.Value(); got != "second" {
+		t.Errorf("Value() after a rotation = %q; want %q", got, "second")
+	}
+	if got := secret.Values(); !slices.Equal(got, []string{"second", "first"}) {
+		t.Errorf("Values() after a rotation = %q; want %q", got, []string{"second", "first"})
+	}
+
+	// A failed refresh keeps the values, so a broken source does not lock out valid tokens.
+	write("")
+	if _, err := secret.Refresh(context.Background()); !errors.Is(err, ErrEmptySecret) {
+		t.Errorf("Refresh() of an empty value error = %v; want %v", err, ErrEmptySecret)
+	}
+	if got := secret.Values(); !slices.Equal(got, []string{"second", "first"}) {
+		t.Errorf("Values() after a failed refresh = %q; want %q", got, []string{"second", "first"})
+	}
+
+	write("third")
+	if _, err := secret.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if got := secret.Values(); !slices.Equal(got, []string{"third", "second"}) {
+		t.Errorf("Values() after a second rotation = %q; want %q", got, []string{"third", "second"})
+	}
+}
+
+func TestSecretWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(path, []byte("first"), 0o600); err != nil {
+		t.Fatalf("failed to write secret file: %v", err)
+	}
+	secret, err := New(context.Background(), FileSource{Path: path})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte("second"), 0o600); err != nil {
+		t.Fatalf("failed to write secret file: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	refreshed := make(chan bool)
+	done := make(chan struct{})
+	go func() {
+		secret.Watch(ctx, time.Millisecond, func(changed bool, err error) {
+			if err != nil {
+				t.Errorf("Watch() refresh error = %v", err)
+			}
+			if changed {
+				refreshed <- changed
+			}
+		})
+		close(done)
+	}()
+
+	select {
+	case <-refreshed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Watch() did not pick up the rotated secret")
+	}
+	cancel()
+	<-done
+
+	if got := secret.Value(); got != "second" {
+		t.Errorf("Value() after Watch() = %q; want %q", got, "second")
+	}
+}
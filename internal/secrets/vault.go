@@ -0,0 +1,93 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	vaultTokenHeader = "X-Vault-Token"
+	vaultFieldSep    = "#"
+	defaultField     = "value"
+)
+
+var (
+	ErrVaultNotConfigured = errors.New("vault address is not configured")
+	ErrVaultFieldNotFound = errors.New("field not found in vault secret")
+)
+
+// Vault holds the connection details of a HashiCorp Vault server.
+type Vault struct {
+	Address string
+	Token   string
+	Client  *http.Client
+}
+
+// VaultSource is a Source for a secret stored in a Vault KV secrets engine.
+// Path is in the format "<path>#<field>", for example "secret/data/library#jwt".
+// If the field is omitted, the "value" field is used.
+type VaultSource struct {
+	Vault Vault
+	Path  string
+}
+
+type vaultResponse struct {
+	Data map[string]any `json:"data"`
+}
+
+// Load reads the secret from Vault. Both the KV version 1 and version 2 response formats are supported.
+func (v VaultSource) Load(ctx context.Context) (string, error) {
+	if v.Vault.Address == "" {
+		return "", ErrVaultNotConfigured
+	}
+
+	path, field, found := strings.Cut(v.Path, vaultFieldSep)
+	if !found {
+		field = defaultField
+	}
+
+	url := fmt.Sprintf("%s/v1/%s", strings.TrimSuffix(v.Vault.Address, "/"), strings.TrimPrefix(path, "/"))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set(vaultTokenHeader, v.Vault.Token)
+
+	client := v.Vault.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault returned status %d for %s", res.StatusCode, path)
+	}
+
+	var body vaultResponse
+	if err = json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("failed to decode vault response: %v", err)
+	}
+
+	data := body.Data
+	if nested, ok := data["data"].(map[string]any); ok {
+		data = nested
+	}
+
+	value, ok := data[field].(string)
+	if !ok {
+		return "", fmt.Errorf("%v: %s", ErrVaultFieldNotFound, field)
+	}
+
+	return value, nil
+}
@@ -0,0 +1,101 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const testVaultToken = "vault-token"
+
+// newTestVault starts a Vault server which serves the given KV responses by path.
+func newTestVault(t *testing.T, responses map[string]string) Vault {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(vaultTokenHeader) != testVaultToken {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		body, ok := responses[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+
+	return Vault{Address: srv.URL + "/", Token: testVaultToken, Client: srv.Client()}
+}
+
+func TestVaultSourceLoad(t *testing.T) {
+	vault := newTestVault(t, map[string]string{
+		"/v1/secret/data/library": `{"data": {"data": {"value": "kv2-secret", "jwt": "kv2-jwt"}, "metadata": {"version": 3}}}`,
+		"/v1/kv/library":          `{"data": {"value": "kv1-secret", "dsn": "mongodb://db"}}`,
+		"/v1/kv/empty":            `{"data": {"value": ""}}`,
+		"/v1/kv/number":           `{"data": {"value": 42}}`,
+		"/v1/kv/invalid":          `not json`,
+	})
+
+	tests := []struct {
+		name    string
+		vault   Vault
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{name: "kv2 default field", vault: vault, path: "secret/data/library", want: "kv2-secret"},
+		{name: "kv2 field", vault: vault, path: "secret/data/library#jwt", want: "kv2-jwt"},
+		{name: "kv1 default field", vault: vault, path: "kv/library", want: "kv1-secret"},
+		{name: "kv1 field with leading slash", vault: vault, path: "/kv/library#dsn", want: "mongodb://db"},
+		{name: "empty value", vault: vault, path: "kv/empty", want: ""},
+		{name: "missing field", vault: vault, path: "kv/library#jwt", wantErr: true},
+		{name: "field which is not a string", vault: vault, path: "kv/number", wantErr: true},
+		{name: "invalid response", vault: vault, path: "kv/invalid", wantErr: true},
+		{name: "missing path", vault: vault, path: "kv/missing", wantErr: true},
+		{name: "wrong token", vault: Vault{Address: vault.Address, Token: "wrong", Client: vault.Client}, path: "kv/library", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := VaultSource{Vault: tt.vault, Path: tt.path}.Load(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v; want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Load() = %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVaultSourceNotConfigured(t *testing.T) {
+	_, err := VaultSource{Path: "secret/data/library"}.Load(context.Background())
+	if !errors.Is(err, ErrVaultNotConfigured) {
+		t.Errorf("Load() error = %v; want %v", err, ErrVaultNotConfigured)
+	}
+}
+
+func TestNewFromVault(t *testing.T) {
+	vault := newTestVault(t, map[string]string{
+		"/v1/secret/data/library": `{"data": {"data": {"jwt": "vault-jwt", "empty": ""}}}`,
+	})
+
+	secret, err := New(context.Background(), NewSource("", "", "secret/data/library#jwt", vault))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if got := secret.Value(); got != "vault-jwt" {
+		t.Errorf("Value() = %q; want %q", got, "vault-jwt")
+	}
+
+	if _, err := New(context.Background(), NewSource("", "", "secret/data/library#empty", vault)); !errors.Is(err, ErrEmptySecret) {
+		t.Errorf("New() of an empty field error = %v; want %v", err, ErrEmptySecret)
+	}
+}
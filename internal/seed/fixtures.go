@@ -0,0 +1,96 @@
+package seed
+
+import (
+	"fmt"
+	"github.com/mzeevi/library/internal/data"
+	"time"
+)
+
+const (
+	// reservationLength is the length of generated reservations, which start on the hour.
+	reservationLength = time.Hour
+	firstReservation  = 10 * time.Hour
+	lastReservation   = 17 * time.Hour
+)
+
+// Fixture is the number of documents of each kind which a fixture set generates.
+type Fixture struct {
+	Books        int
+	Patrons      int
+	Transactions int
+	Resources    int
+	Reservations int
+}
+
+// Fixtures are the named fixture sets, from a few documents to click through to enough to
+// load test with.
+var Fixtures = map[string]Fixture{
+	"small":  {Books: 50, Patrons: 20, Transactions: 200, Resources: 3, Reservations: 10},
+	"medium": {Books: 1000, Patrons: 200, Transactions: 5000, Resources: 10, Reservations: 100},
+	"large":  {Books: 10000, Patrons: 2000, Transactions: 50000, Resources: 30, Reservations: 1000},
+}
+
+// resourceKinds are the kinds of generated resources and the names they are numbered by.
+var resourceKinds = []struct {
+	kind string
+	name string
+}{
+	{kind: data.ResourceKindRoom, name: "Study Room"},
+	{kind: data.ResourceKindEquipment, name: "Laptop"},
+}
+
+// Resources generates n active rooms and equipment.
+func (g *Generator) Resources(n int) []*data.Resource {
+	resources := make([]*data.Resource, 0, n)
+
+	for i := 0; i < n; i++ {
+		kind := resourceKinds[i%len(resourceKinds)]
+
+		resource := &data.Resource{
+			Name:   fmt.Sprintf("%s %d", kind.name, i/len(resourceKinds)+1),
+			Kind:   kind.kind,
+			Active: true,
+		}
+		if kind.kind == data.ResourceKindRoom {
+			resource.Capacity = 2 + g.rand.Intn(10)
+		}
+
+		resources = append(resources, resource)
+	}
+
+	return resources
+}
+
+// Reservations generates n confirmed reservations of an hour in the coming days between the given
+// resources and patrons, which must already have IDs. The reservations of a resource follow each
+// other, so that they never overlap.
+func (g *Generator) Reservations(n int, resources []*data.Resource, patrons []*data.Patron) []*data.Reservation {
+	if len(resources) == 0 || len(patrons) == 0 {
+		return nil
+	}
+
+	perDay := int((lastReservation - firstReservation) / reservationLength)
+	tomorrow := time.Date(g.now.Year(), g.now.Month(), g.now.Day()+1, 0, 0, 0, 0, time.UTC)
+	next := make(map[string]int, len(resources))
+
+	reservations := make([]*data.Reservation, 0, n)
+	for i := 0; i < n; i++ {
+		resource := resources[g.rand.Intn(len(resources))]
+		patron := patrons[g.rand.Intn(len(patrons))]
+
+		slot := next[resource.ID]
+		next[resource.ID]++
+
+		startsAt := tomorrow.AddDate(0, 0, slot/perDay).Add(firstReservation + time.Duration(slot%perDay)*reservationLength)
+
+		reservations = append(reservations, &data.Reservation{
+			ResourceID: resource.ID,
+			PatronID:   patron.ID,
+			StartsAt:   startsAt,
+			EndsAt:     startsAt.Add(reservationLength),
+			Status:     data.ReservationStatusConfirmed,
+		})
+	}
+
+	return reservations
+}
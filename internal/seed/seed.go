@@ -0,0 +1,183 @@
+package seed
+
+import (
+	"fmt"
+	"github.com/mzeevi/library/internal/auth"
+	"github.com/mzeevi/library/internal/data"
+	"github.com/mzeevi/library/internal/isbn"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+const (
+	loanPeriod      = 14 * 24 * time.Hour
+	historyDuration = 365 * 24 * time.Hour
+	// returnedRatio is the share of generated transactions which were already returned.
+	returnedRatio = 0.8
+)
+
+// authors are the full names used for book authors.
+var authors = authorNames()
+
+// Generator generates realistic books, patrons and transactions. Generators created
+// with the same seed generate the same data, apart from the password hash.
+type Generator struct {
+	rand     *rand.Rand
+	now      time.Time
+	password auth.Password
+}
+
+// NewGenerator creates a Generator. All generated patrons share the given password,
+// which is hashed once since hashing is deliberately slow.
+func NewGenerator(seed int64, password string) (*Generator, error) {
+	g := &Generator{
+		rand: rand.New(rand.NewSource(seed)),
+		now:  time.Now().UTC(),
+	}
+
+	if err := g.password.Set(password); err != nil {
+		return nil, fmt.Errorf("failed to hash seed password: %v", err)
+	}
+	g.password.Plaintext = nil
+
+	return g, nil
+}
+
+// Books generates n books with unique ISBNs.
+func (g *Generator) Books(n int) []*data.Book {
+	books := make([]*data.Book, 0, n)
+	isbns := make(map[string]bool, n)
+
+	for len(books) < n {
+		bookISBN := g.isbn()
+		if isbns[bookISBN] {
+			continue
+		}
+		isbns[bookISBN] = true
+
+		publishedAt := time.Date(1950+g.rand.Intn(75), time.Month(1+g.rand.Intn(12)), 1+g.rand.Intn(28), 0, 0, 0, 0, time.UTC)
+
+		books = append(books, data.NewBook("", g.title(), bookISBN,
+			80+g.rand.Intn(900), 1+g.rand.Intn(5), 1+g.rand.Intn(10),
+			g.pick(authors, 1+g.rand.Intn(2)),
+			g.pick(publishers, 1),
+			g.pick(genres, 1+g.rand.Intn(3)),
+			publishedAt,
+		))
+	}
+
+	return books
+}
+
+// Patrons generates n activated patrons with unique email addresses.
+func (g *Generator) Patrons(n int) []*data.Patron {
+	patrons := make([]*data.Patron, 0, n)
+
+	for i := 1; i <= n; i++ {
+		first := firstNames[g.rand.Intn(len(firstNames))]
+		last := lastNames[g.rand.Intn(len(lastNames))]
+
+		category := data.StudentCategory
+		if g.rand.Intn(4) == 0 {
+			category = data.TeacherCategory
+		}
+
+		email := fmt.Sprintf("%s.%s.%d@example.com", strings.ToLower(first), strings.ToLower(last), i)
+
+		patron := data.NewPatron("", fmt.Sprintf("%s %s", first, last), email, category)
+		patron.Password = g.password
+		patron.Activated = true
+		patron.Permissions = []string{auth.WritePatronPermission, auth.ReadPatronPermission, auth.ReadBooksPermission, auth.BorrowBookPermission, auth.ReturnBookPermission}
+
+		patrons = append(patrons, patron)
+	}
+
+	return patrons
+}
+
+// Transactions generates up to n transactions over the past year between the given
+// books and patrons, which must already have IDs. The borrowed copies of the books are
+// incremented for every transaction which is still borrowed, and a book is never
+// borrowed beyond its copies. Returned transactions are counted in the circulation of the books.
+func (g *Generator) Transactions(n int, books []*data.Book, patrons []*data.Patron) []*data.Transaction {
+	if len(books) == 0 || len(patrons) == 0 {
+		return nil
+	}
+
+	transactions := make([]*data.Transaction, 0, n)
+
+	for i := 0; i < n; i++ {
+		book := books[g.rand.Intn(len(books))]
+		patron := patrons[g.rand.Intn(len(patrons))]
+
+		borrowedAt := g.now.Add(-time.Duration(g.rand.Int63n(int64(historyDuration))))
+		dueDate := borrowedAt.Add(loanPeriod)
+
+		returned := g.rand.Float64() < returnedRatio || book.BorrowedCopies >= book.Copies
+		if !returned {
+			book.BorrowedCopies++
+			transactions = append(transactions, data.NewTransaction("", patron.ID, book.ID, data.TransactionStatusBorrowed, borrowedAt, dueDate))
+			continue
+		}
+
+		// Most books are returned on time, some are returned up to two weeks late.
+		returnedAt := borrowedAt.Add(time.Duration(g.rand.Int63n(int64(2 * loanPeriod))))
+		if returnedAt.After(g.now) {
+			returnedAt = g.now
+		}
+
+		transaction := data.NewTransaction("", patron.ID, book.ID, data.TransactionStatusReturned, borrowedAt, dueDate)
+		transaction.ReturnedAt = returnedAt
+		book.RecordLoan(borrowedAt, returnedAt)
+		transactions = append(transactions, transaction)
+	}
+
+	return transactions
+}
+
+// title generates a book title from the title patterns.
+func (g *Generator) title() string {
+	pattern := titlePatterns[g.rand.Intn(len(titlePatterns))]
+
+	return fmt.Sprintf(pattern,
+		titleAdjectives[g.rand.Intn(len(titleAdjectives))],
+		titleNouns[g.rand.Intn(len(titleNouns))],
+	)
+}
+
+// isbn generates a valid ISBN-13.
+func (g *Generator) isbn() string {
+	digits := []int{9, 7, 8}
+	for i := 0; i < 9; i++ {
+		digits = append(digits, g.rand.Intn(10))
+	}
+	digits = append(digits, isbn.CheckDigit13(digits))
+
+	var sb strings.Builder
+	for _, digit := range digits {
+		sb.WriteByte(byte('0' + digit))
+	}
+
+	return sb.String()
+}
+
+// pick returns n distinct random values from values.
+func (g *Generator) pick(values []string, n int) []string {
+	picked := make([]string, 0, n)
+	for _, i := range g.rand.Perm(len(values))[:min(n, len(values))] {
+		picked = append(picked, values[i])
+	}
+
+	return picked
+}
+
+// authorNames returns the full names which are used for authors.
+func authorNames() []string {
+	names := make([]string, 0, len(firstNames))
+	for i, first := range firstNames {
+		names = append(names, fmt.Sprintf("%s %s", first, lastNames[(i*7)%len(lastNames)]))
+	}
+
+	return names
+}
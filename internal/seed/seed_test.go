@@ -0,0 +1,99 @@
+package seed
+
+import (
+	"fmt"
+	"github.com/mzeevi/library/internal/data"
+	"github.com/mzeevi/library/internal/isbn"
+	"testing"
+)
+
+func TestGenerator(t *testing.T) {
+	g, err := NewGenerator(1, "password")
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+
+	books := g.Books(100)
+	patrons := g.Patrons(20)
+
+	for i, book := range books {
+		book.ID = fmt.Sprintf("book-%d", i)
+
+		digits := make([]int, 0, len(book.ISBN()))
+		for _, r := range book.ISBN() {
+			digits = append(digits, int(r-'0'))
+		}
+		if len(digits) != 13 || isbn.CheckDigit13(digits[:12]) != digits[12] {
+			t.Errorf("Books() ISBN = %v; want valid ISBN-13", book.ISBN())
+		}
+	}
+
+	for i, patron := range patrons {
+		patron.ID = fmt.Sprintf("patron-%d", i)
+	}
+
+	transactions := g.Transactions(1000, books, patrons)
+	if len(transactions) != 1000 {
+		t.Fatalf("Transactions() len = %v; want %v", len(transactions), 1000)
+	}
+
+	borrowed := make(map[string]int)
+	for _, transaction := range transactions {
+		if transaction.Status == data.TransactionStatusBorrowed {
+			borrowed[transaction.BookID]++
+			continue
+		}
+
+		if transaction.ReturnedAt.Before(transaction.BorrowedAt) {
+			t.Errorf("Transactions() ReturnedAt = %v; want after %v", transaction.ReturnedAt, transaction.BorrowedAt)
+		}
+	}
+
+	for _, book := range books {
+		if book.BorrowedCopies != borrowed[book.ID] {
+			t.Errorf("BorrowedCopies of %v = %v; want %v", book.ID, book.BorrowedCopies, borrowed[book.ID])
+		}
+		if book.BorrowedCopies > book.Copies {
+			t.Errorf("BorrowedCopies of %v = %v; want at most %v", book.ID, book.BorrowedCopies, book.Copies)
+		}
+	}
+}
+
+func TestGeneratorReservations(t *testing.T) {
+	g, err := NewGenerator(1, "password")
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+
+	resources := g.Resources(3)
+	for i, resource := range resources {
+		resource.ID = fmt.Sprintf("resource-%d", i)
+	}
+	patrons := g.Patrons(5)
+	for i, patron := range patrons {
+		patron.ID = fmt.Sprintf("patron-%d", i)
+	}
+
+	reservations := g.Reservations(100, resources, patrons)
+	if len(reservations) != 100 {
+		t.Fatalf("Reservations() len = %v; want %v", len(reservations), 100)
+	}
+
+	for i, reservation := range reservations {
+		if !reservation.StartsAt.After(g.now) {
+			t.Errorf("Reservations() StartsAt = %v; want after %v", reservation.StartsAt, g.now)
+		}
+
+		for _, other := range reservations[i+1:] {
+			if reservation.ResourceID == other.ResourceID && reservation.StartsAt.Before(other.EndsAt) && other.StartsAt.Before(reservation.EndsAt) {
+				t.Errorf("Reservations() of %v at %v and %v overlap", reservation.ResourceID, reservation.StartsAt, other.StartsAt)
+			}
+		}
+	}
+
+	for _, name := range []string{"small", "medium", "large"} {
+		if _, ok := Fixtures[name]; !ok {
+			t.Errorf("Fixtures[%q] is missing", name)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package seed
+
+var titlePatterns = []string{
+	"The %s %s",
+	"A %s %s",
+	"%s %s",
+	"The %s %s Chronicles",
+	"Return of the %s %s",
+	"Beyond the %s %s",
+	"Notes on a %s %s",
+	"The Last %s %s",
+}
+
+var titleAdjectives = []string{
+	"Silent", "Hidden", "Broken", "Golden", "Forgotten", "Crimson", "Endless", "Distant",
+	"Quiet", "Wild", "Midnight", "Burning", "Frozen", "Secret", "Lost", "Iron",
+	"Hollow", "Restless", "Invisible", "Ancient", "Northern", "Bitter", "Gentle", "Electric",
+}
+
+var titleNouns = []string{
+	"River", "Garden", "Kingdom", "Harbor", "Orchard", "Library", "Mountain", "Empire",
+	"Letters", "Shadows", "Tide", "Voyage", "Cartographer", "Lighthouse", "Winter", "Storm",
+	"Archive", "Machine", "Forest", "Promise", "Island", "Witness", "Inheritance", "Horizon",
+}
+
+var genres = []string{
+	"Fiction", "Mystery", "Thriller", "Science Fiction", "Fantasy", "Romance", "Historical Fiction",
+	"Horror", "Biography", "History", "Poetry", "Philosophy", "Science", "Self-Help",
+	"Young Adult", "Children", "Graphic Novel", "Travel", "Cooking", "Economics",
+}
+
+var publishers = []string{
+	"Penguin Random House", "HarperCollins", "Simon & Schuster", "Macmillan", "Hachette",
+	"Scholastic", "Bloomsbury", "Oxford University Press", "Cambridge University Press",
+	"Faber & Faber", "Vintage", "Tor Books", "Orbit", "Knopf", "Beacon Press",
+}
+
+var firstNames = []string{
+	"Olivia", "Liam", "Emma", "Noah", "Ava", "Elijah", "Sophia", "James", "Isabella", "Lucas",
+	"Mia", "Mateo", "Amelia", "Ethan", "Harper", "Daniel", "Yael", "Omer", "Noa", "Ariel",
+	"Chloe", "Samuel", "Leah", "David", "Maya", "Benjamin", "Zoe", "Jonah", "Hannah", "Adam",
+}
+
+var lastNames = []string{
+	"Smith", "Johnson", "Williams", "Brown", "Jones", "Garcia", "Miller", "Davis", "Rodriguez",
+	"Martinez", "Cohen", "Levi", "Mizrahi", "Peretz", "Wilson", "Anderson", "Taylor", "Thomas",
+	"Moore", "Jackson", "Martin", "Lee", "Thompson", "White", "Harris", "Clark", "Lewis",
+}
@@ -0,0 +1,228 @@
+package sru
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Clause is a search clause of a CQL query, such as dc.title = "the hobbit". Index and Relation
+// are lower-cased, and are empty if the clause is only a term, which searches the default index.
+type Clause struct {
+	Index    string
+	Relation string
+	Term     string
+}
+
+var (
+	// relationSymbols are the symbolic relations of CQL, longest first.
+	relationSymbols = []string{"==", "<>", "<=", ">=", "=", "<", ">"}
+	// relationNames are the named relations of CQL.
+	relationNames = []string{"adj", "all", "any", "encloses", "exact", "within"}
+	// booleans are the boolean operators of CQL.
+	booleans = []string{"and", "or", "not", "prox"}
+)
+
+// token is a token of a CQL query. A quoted token is a term, even if it reads as a keyword.
+type token struct {
+	value  string
+	quoted bool
+}
+
+// Parse parses a CQL query into its search clauses, which are combined with "and". Queries with
+// other boolean operators are not supported, and searching an index by more than one clause is
+// not, since clauses of an index are not combined consistently by the catalog.
+func Parse(query string) ([]Clause, error) {
+	tokens, err := tokenize(query)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	clauses, err := p.query()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, &Diagnostic{Code: DiagnosticQuerySyntax, Details: p.tokens[p.pos].value}
+	}
+
+	indexes := make(map[string]bool, len(clauses))
+	for _, clause := range clauses {
+		if indexes[clause.Index] {
+			return nil, &Diagnostic{Code: DiagnosticUnsupportedFeature, Details: fmt.Sprintf("more than one clause of index %s", indexName(clause.Index))}
+		}
+		indexes[clause.Index] = true
+	}
+
+	return clauses, nil
+}
+
+// indexName returns the name of an index in diagnostics, where the default index has no name.
+func indexName(index string) string {
+	if index == "" {
+		return "cql.serverChoice"
+	}
+
+	return index
+}
+
+// tokenize splits a CQL query into tokens: parentheses, relation symbols, quoted strings and words.
+func tokenize(query string) ([]token, error) {
+	var tokens []token
+
+	runes := []rune(query)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(' || r == ')':
+			tokens = append(tokens, token{value: string(r)})
+			i++
+		case r == '"':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(runes) && runes[j] != '"'; j++ {
+				if runes[j] == '\\' && j+1 < len(runes) {
+					j++
+				}
+				b.WriteRune(runes[j])
+			}
+			if j == len(runes) {
+				return nil, &Diagnostic{Code: DiagnosticQuerySyntax, Details: "unterminated quoted string"}
+			}
+			tokens = append(tokens, token{value: b.String(), quoted: true})
+			i = j + 1
+		case strings.ContainsRune("=<>", r):
+			symbol := string(r)
+			if i+1 < len(runes) && slices.Contains(relationSymbols, string(runes[i:i+2])) {
+				symbol = string(runes[i : i+2])
+			}
+			tokens = append(tokens, token{value: symbol})
+			i += len(symbol)
+		default:
+			j := i
+			for j < len(runes) && !unicode.IsSpace(runes[j]) && !strings.ContainsRune(`()"=<>`, runes[j]) {
+				j++
+			}
+			tokens = append(tokens, token{value: string(runes[i:j])})
+			i = j
+		}
+	}
+
+	if len(tokens) == 0 {
+		return nil, &Diagnostic{Code: DiagnosticQuerySyntax, Details: "empty query"}
+	}
+
+	return tokens, nil
+}
+
+// parser parses the tokens of a CQL query by recursive descent.
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// peek returns the token at an offset from the current token, and whether there is one.
+func (p *parser) peek(offset int) (token, bool) {
+	if p.pos+offset >= len(p.tokens) {
+		return token{}, false
+	}
+
+	return p.tokens[p.pos+offset], true
+}
+
+// isKeyword reports whether a token is one of the given unquoted keywords, ignoring case.
+func isKeyword(t token, keywords []string) bool {
+	return !t.quoted && slices.Contains(keywords, strings.ToLower(t.value))
+}
+
+// query parses search clauses separated by boolean operators.
+func (p *parser) query() ([]Clause, error) {
+	clauses, err := p.clause()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		t, ok := p.peek(0)
+		if !ok || !isKeyword(t, booleans) {
+			return clauses, nil
+		}
+		if boolean := strings.ToLower(t.value); boolean != "and" {
+			return nil, &Diagnostic{Code: DiagnosticUnsupportedBoolean, Details: boolean}
+		}
+		p.pos++
+
+		more, err := p.clause()
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, more...)
+	}
+}
+
+// clause parses a search clause, or a query in parentheses.
+func (p *parser) clause() ([]Clause, error) {
+	t, ok := p.peek(0)
+	if !ok {
+		return nil, &Diagnostic{Code: DiagnosticQuerySyntax, Details: "missing search term"}
+	}
+
+	if t.value == "(" && !t.quoted {
+		p.pos++
+		clauses, err := p.query()
+		if err != nil {
+			return nil, err
+		}
+		if closing, ok := p.peek(0); !ok || closing.value != ")" || closing.quoted {
+			return nil, &Diagnostic{Code: DiagnosticQuerySyntax, Details: "missing closing parenthesis"}
+		}
+		p.pos++
+
+		return clauses, nil
+	}
+
+	// A term followed by a relation and another term is an index.
+	if relation, ok := p.peek(1); ok && !t.quoted && p.isRelation(relation) {
+		term, ok := p.peek(2)
+		if !ok || !isTerm(term) {
+			return nil, &Diagnostic{Code: DiagnosticQuerySyntax, Details: fmt.Sprintf("missing search term after %s %s", t.value, relation.value)}
+		}
+		p.pos += 3
+
+		return []Clause{{Index: strings.ToLower(t.value), Relation: strings.ToLower(relation.value), Term: term.value}}, nil
+	}
+
+	if !isTerm(t) {
+		return nil, &Diagnostic{Code: DiagnosticQuerySyntax, Details: t.value}
+	}
+	p.pos++
+
+	return []Clause{{Term: t.value}}, nil
+}
+
+// isRelation reports whether a token is a relation, where a named relation must be followed by a term.
+func (p *parser) isRelation(t token) bool {
+	if t.quoted {
+		return false
+	}
+	if slices.Contains(relationSymbols, t.value) {
+		return true
+	}
+
+	next, ok := p.peek(2)
+	return isKeyword(t, relationNames) && ok && isTerm(next)
+}
+
+// isTerm reports whether a token can be a search term.
+func isTerm(t token) bool {
+	if t.quoted {
+		return true
+	}
+
+	return t.value != "(" && t.value != ")" && !slices.Contains(relationSymbols, t.value) && !isKeyword(t, booleans)
+}
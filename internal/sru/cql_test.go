@@ -0,0 +1,54 @@
+package sru
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []Clause
+		code  int
+	}{
+		{query: "hobbit", want: []Clause{{Term: "hobbit"}}},
+		{query: `"the hobbit"`, want: []Clause{{Term: "the hobbit"}}},
+		{query: `dc.title = "the hobbit"`, want: []Clause{{Index: "dc.title", Relation: "=", Term: "the hobbit"}}},
+		{query: `DC.Title all hobbit AND (dc.creator=Tolkien and bath.isbn == "9780306406157")`, want: []Clause{
+			{Index: "dc.title", Relation: "all", Term: "hobbit"},
+			{Index: "dc.creator", Relation: "=", Term: "Tolkien"},
+			{Index: "bath.isbn", Relation: "==", Term: "9780306406157"},
+		}},
+		{query: `"and"`, want: []Clause{{Term: "and"}}},
+		{query: `dc.title = "say \"hi\""`, want: []Clause{{Index: "dc.title", Relation: "=", Term: `say "hi"`}}},
+		{query: "hobbit or dragon", code: DiagnosticUnsupportedBoolean},
+		{query: "hobbit not dragon", code: DiagnosticUnsupportedBoolean},
+		{query: "dc.title = hobbit and dc.title = dragon", code: DiagnosticUnsupportedFeature},
+		{query: "the hobbit", code: DiagnosticQuerySyntax},
+		{query: "dc.title =", code: DiagnosticQuerySyntax},
+		{query: "(hobbit", code: DiagnosticQuerySyntax},
+		{query: `"hobbit`, code: DiagnosticQuerySyntax},
+		{query: "  ", code: DiagnosticQuerySyntax},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got, err := Parse(tt.query)
+			if tt.code != 0 {
+				var diagnostic *Diagnostic
+				if !errors.As(err, &diagnostic) || diagnostic.Code != tt.code {
+					t.Fatalf("Parse(%q) error = %v; want diagnostic %d", tt.query, err, tt.code)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", tt.query, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse(%q) = %+v; want %+v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
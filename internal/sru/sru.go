@@ -0,0 +1,316 @@
+// Package sru implements SRU (Search/Retrieve via URL) 1.2, the successor of Z39.50 by which
+// library catalogs are searched with CQL queries and return records such as Dublin Core.
+package sru
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/mzeevi/library/internal/dublincore"
+	"io"
+	"slices"
+)
+
+// ContentType is the media type of SRU responses.
+const ContentType = "application/xml"
+
+// Version is the supported version of SRU.
+const Version = "1.2"
+
+// Operations of SRU.
+const (
+	OperationExplain        = "explain"
+	OperationSearchRetrieve = "searchRetrieve"
+)
+
+const (
+	namespace           = "http://www.loc.gov/zing/srw/"
+	diagnosticNamespace = "http://www.loc.gov/zing/srw/diagnostic/"
+	explainNamespace    = "http://explain.z3950.org/dtd/2.0/"
+	dcSchemaNamespace   = "info:srw/schema/1/dc-schema"
+	recordPacking       = "xml"
+)
+
+// Record schemas.
+const (
+	SchemaDC        = "dc"
+	SchemaDCURI     = "info:srw/schema/1/dc-v1.1"
+	explainSchemaID = "http://explain.z3950.org/dtd/2.0/"
+)
+
+// Codes of the diagnostics of SRU, which are reported in responses instead of HTTP errors.
+const (
+	DiagnosticGeneral              = 1
+	DiagnosticUnsupportedOperation = 4
+	DiagnosticUnsupportedVersion   = 5
+	DiagnosticUnsupportedValue     = 6
+	DiagnosticMissingParameter     = 7
+	DiagnosticQuerySyntax          = 10
+	DiagnosticUnsupportedIndex     = 16
+	DiagnosticUnsupportedRelation  = 19
+	DiagnosticUnsupportedBoolean   = 37
+	DiagnosticUnsupportedFeature   = 48
+	DiagnosticStartOutOfRange      = 61
+	DiagnosticUnsupportedSchema    = 66
+	DiagnosticUnsupportedPacking   = 71
+	diagnosticURIFormat            = "info:srw/diagnostic/1/%d"
+)
+
+// diagnosticMessages are the messages of the diagnostics.
+var diagnosticMessages = map[int]string{
+	DiagnosticGeneral:              "General system error",
+	DiagnosticUnsupportedOperation: "Unsupported operation",
+	DiagnosticUnsupportedVersion:   "Unsupported version",
+	DiagnosticUnsupportedValue:     "Unsupported parameter value",
+	DiagnosticMissingParameter:     "Mandatory parameter not supplied",
+	DiagnosticQuerySyntax:          "Query syntax error",
+	DiagnosticUnsupportedIndex:     "Unsupported index",
+	DiagnosticUnsupportedRelation:  "Unsupported relation",
+	DiagnosticUnsupportedBoolean:   "Unsupported boolean operator",
+	DiagnosticUnsupportedFeature:   "Query feature unsupported",
+	DiagnosticStartOutOfRange:      "First record position out of range",
+	DiagnosticUnsupportedSchema:    "Unknown schema for retrieval",
+	DiagnosticUnsupportedPacking:   "Unsupported record packing",
+}
+
+// Diagnostic is an error of an SRU request, such as an unsupported index in its query.
+type Diagnostic struct {
+	XMLName xml.Name `xml:"diagnostic"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	URI     string   `xml:"uri"`
+	Details string   `xml:"details,omitempty"`
+	Message string   `xml:"message"`
+	Code    int      `xml:"-"`
+}
+
+func (d *Diagnostic) Error() string {
+	if d.Details == "" {
+		return diagnosticMessages[d.Code]
+	}
+
+	return fmt.Sprintf("%s: %s", diagnosticMessages[d.Code], d.Details)
+}
+
+// prepare sets the namespace, the URI and the message of a diagnostic from its code.
+func (d *Diagnostic) prepare() {
+	d.Xmlns = diagnosticNamespace
+	d.URI = fmt.Sprintf(diagnosticURIFormat, d.Code)
+	d.Message = diagnosticMessages[d.Code]
+}
+
+// SearchRetrieveResponse is the response of a searchRetrieve operation.
+type SearchRetrieveResponse struct {
+	XMLName            xml.Name     `xml:"searchRetrieveResponse"`
+	Xmlns              string       `xml:"xmlns,attr"`
+	Version            string       `xml:"version"`
+	NumberOfRecords    int64        `xml:"numberOfRecords"`
+	Records            *records     `xml:"records,omitempty"`
+	NextRecordPosition int64        `xml:"nextRecordPosition,omitempty"`
+	Diagnostics        *diagnostics `xml:"diagnostics,omitempty"`
+}
+
+type records struct {
+	Records []Record `xml:"record"`
+}
+
+type diagnostics struct {
+	Diagnostics []*Diagnostic `xml:"diagnostic"`
+}
+
+// Record is a record of a searchRetrieve response, at its position in the results from 1.
+type Record struct {
+	RecordSchema   string     `xml:"recordSchema"`
+	RecordPacking  string     `xml:"recordPacking"`
+	RecordData     recordData `xml:"recordData"`
+	RecordPosition int64      `xml:"recordPosition"`
+}
+
+type recordData struct {
+	DC dcRecord `xml:"srw_dc:dc"`
+}
+
+// dcRecord is a Dublin Core record in the schema of SRU.
+type dcRecord struct {
+	XmlnsSRWDC string `xml:"xmlns:srw_dc,attr"`
+	XmlnsDC    string `xml:"xmlns:dc,attr"`
+	dublincore.Record
+}
+
+// NewDCRecord returns a Dublin Core record at a position in the results.
+func NewDCRecord(record dublincore.Record, position int64) Record {
+	return Record{
+		RecordSchema:  SchemaDCURI,
+		RecordPacking: recordPacking,
+		RecordData: recordData{DC: dcRecord{
+			XmlnsSRWDC: dcSchemaNamespace,
+			XmlnsDC:    dublincore.Namespace,
+			Record:     record,
+		}},
+		RecordPosition: position,
+	}
+}
+
+// NewSearchRetrieveResponse returns the response of a searchRetrieve operation with the records
+// from a position, of total records. The next record position is set if there are more records.
+func NewSearchRetrieveResponse(results []Record, start, total int64) *SearchRetrieveResponse {
+	resp := &SearchRetrieveResponse{
+		Xmlns:           namespace,
+		Version:         Version,
+		NumberOfRecords: total,
+	}
+	if len(results) > 0 {
+		resp.Records = &records{Records: results}
+	}
+	if next := start + int64(len(results)); len(results) > 0 && next <= total {
+		resp.NextRecordPosition = next
+	}
+
+	return resp
+}
+
+// NewDiagnosticResponse returns the response of a searchRetrieve operation which failed with a diagnostic.
+func NewDiagnosticResponse(diagnostic *Diagnostic) *SearchRetrieveResponse {
+	diagnostic.prepare()
+
+	return &SearchRetrieveResponse{
+		Xmlns:       namespace,
+		Version:     Version,
+		Diagnostics: &diagnostics{Diagnostics: []*Diagnostic{diagnostic}},
+	}
+}
+
+// Index is an index of CQL queries, such as title in the dc context set.
+type Index struct {
+	Set   string
+	Name  string
+	Title string
+}
+
+// Explain describes the server in an explain response: its database, its indexes and the
+// default and maximum number of records of searchRetrieve responses.
+type Explain struct {
+	Host           string
+	Port           string
+	Database       string
+	Title          string
+	Indexes        []Index
+	DefaultRecords int
+	MaximumRecords int
+}
+
+// contextSets are the identifiers of the CQL context sets of indexes.
+var contextSets = map[string]string{
+	"cql":   "info:srw/cql-context-set/1/cql-v1.2",
+	"dc":    "info:srw/cql-context-set/1/dc-v1.1",
+	"bath":  "http://zing.z3950.org/cql/bath/2.0/",
+	"local": "info:srw/cql-context-set/1/local",
+}
+
+type explainResponse struct {
+	XMLName xml.Name      `xml:"explainResponse"`
+	Xmlns   string        `xml:"xmlns,attr"`
+	Version string        `xml:"version"`
+	Record  explainRecord `xml:"record"`
+}
+
+type explainRecord struct {
+	RecordSchema  string `xml:"recordSchema"`
+	RecordPacking string `xml:"recordPacking"`
+	RecordData    struct {
+		Explain explainData `xml:"explain"`
+	} `xml:"recordData"`
+}
+
+type explainData struct {
+	Xmlns      string `xml:"xmlns,attr"`
+	ServerInfo struct {
+		Protocol string `xml:"protocol,attr"`
+		Version  string `xml:"version,attr"`
+		Host     string `xml:"host"`
+		Port     string `xml:"port"`
+		Database string `xml:"database"`
+	} `xml:"serverInfo"`
+	DatabaseInfo struct {
+		Title string `xml:"title"`
+	} `xml:"databaseInfo"`
+	IndexInfo struct {
+		Sets    []explainSet   `xml:"set"`
+		Indexes []explainIndex `xml:"index"`
+	} `xml:"indexInfo"`
+	SchemaInfo struct {
+		Schemas []explainSchema `xml:"schema"`
+	} `xml:"schemaInfo"`
+	ConfigInfo struct {
+		Defaults []explainSetting `xml:"default"`
+		Settings []explainSetting `xml:"setting"`
+	} `xml:"configInfo"`
+}
+
+type explainSet struct {
+	Name       string `xml:"name,attr"`
+	Identifier string `xml:"identifier,attr"`
+}
+
+type explainIndex struct {
+	Title string `xml:"title"`
+	Name  struct {
+		Set  string `xml:"set,attr"`
+		Name string `xml:",chardata"`
+	} `xml:"map>name"`
+}
+
+type explainSchema struct {
+	Identifier string `xml:"identifier,attr"`
+	Name       string `xml:"name,attr"`
+	Title      string `xml:"title"`
+}
+
+type explainSetting struct {
+	Type  string `xml:"type,attr"`
+	Value int    `xml:",chardata"`
+}
+
+// WriteExplain writes the explain response of a server to w.
+func WriteExplain(w io.Writer, e Explain) error {
+	var data explainData
+	data.Xmlns = explainNamespace
+	data.ServerInfo.Protocol, data.ServerInfo.Version = "SRU", Version
+	data.ServerInfo.Host, data.ServerInfo.Port, data.ServerInfo.Database = e.Host, e.Port, e.Database
+	data.DatabaseInfo.Title = e.Title
+
+	for _, index := range e.Indexes {
+		if !slices.ContainsFunc(data.IndexInfo.Sets, func(set explainSet) bool { return set.Name == index.Set }) {
+			data.IndexInfo.Sets = append(data.IndexInfo.Sets, explainSet{Name: index.Set, Identifier: contextSets[index.Set]})
+		}
+
+		i := explainIndex{Title: index.Title}
+		i.Name.Set, i.Name.Name = index.Set, index.Name
+		data.IndexInfo.Indexes = append(data.IndexInfo.Indexes, i)
+	}
+
+	data.SchemaInfo.Schemas = []explainSchema{{Identifier: SchemaDCURI, Name: SchemaDC, Title: "Dublin Core"}}
+	data.ConfigInfo.Defaults = []explainSetting{{Type: "numberOfRecords", Value: e.DefaultRecords}}
+	data.ConfigInfo.Settings = []explainSetting{{Type: "maximumRecords", Value: e.MaximumRecords}}
+
+	resp := explainResponse{Xmlns: namespace, Version: Version}
+	resp.Record.RecordSchema, resp.Record.RecordPacking = explainSchemaID, recordPacking
+	resp.Record.RecordData.Explain = data
+
+	return write(w, resp)
+}
+
+// Write writes a searchRetrieve response to w.
+func (r *SearchRetrieveResponse) Write(w io.Writer) error {
+	return write(w, r)
+}
+
+// write writes an XML document to w.
+func write(w io.Writer, v any) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+
+	return enc.Encode(v)
+}
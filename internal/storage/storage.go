@@ -0,0 +1,43 @@
+// Package storage stores the files attached to books, such as the PDFs and EPUBs of e-books,
+// either in a directory on the local disk or in an S3 bucket. Files are stored under keys which
+// the library generates, and are never served directly by the store.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"strings"
+)
+
+// Names of the stores.
+const (
+	Local = "local"
+	S3    = "s3"
+)
+
+var (
+	ErrNotFound   = errors.New("file not found")
+	ErrInvalidKey = errors.New("invalid file key")
+)
+
+// Store stores files by their keys.
+type Store interface {
+	// Put stores content under key, replacing the file stored under it.
+	Put(ctx context.Context, key string, content []byte, contentType string) error
+	// Open returns the content of the file stored under key, or ErrNotFound.
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete deletes the file stored under key. Deleting a missing file is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// validKey checks that a key is a slash separated relative path without empty, "." or ".."
+// elements, so that it can't point outside of the directory or the bucket of a store.
+func validKey(key string) error {
+	if !fs.ValidPath(key) || key == "." || strings.Contains(key, "\\") {
+		return ErrInvalidKey
+	}
+
+	return nil
+}
@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalStore(t *testing.T) {
+	ctx := context.Background()
+	s := &LocalStore{Dir: filepath.Join(t.TempDir(), "files")}
+
+	if err := s.Put(ctx, "books/1/file.pdf", []byte("%PDF-1.7"), "application/pdf"); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	info, err := os.Stat(filepath.Join(s.Dir, "books", "1", "file.pdf"))
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("file mode = %v; want 0600", perm)
+	}
+
+	f, err := s.Open(ctx, "books/1/file.pdf")
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	content, _ := io.ReadAll(f)
+	f.Close()
+	if string(content) != "%PDF-1.7" {
+		t.Errorf("Open() content = %q; want the stored content", content)
+	}
+
+	if err = s.Delete(ctx, "books/1/file.pdf"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err = s.Open(ctx, "books/1/file.pdf"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Open() after Delete() error = %v; want %v", err, ErrNotFound)
+	}
+	if err = s.Delete(ctx, "books/1/file.pdf"); err != nil {
+		t.Errorf("Delete() of a missing file error = %v; want nil", err)
+	}
+
+	for _, key := range []string{"", ".", "../secret", "books/../../secret", "/etc/passwd", "books//file", `books\file`} {
+		if err = s.Put(ctx, key, []byte("x"), ""); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Put(%q) error = %v; want %v", key, err, ErrInvalidKey)
+		}
+	}
+}
+
+func TestS3Store(t *testing.T) {
+	var got *http.Request
+	var body []byte
+	objects := map[string][]byte{}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		body, _ = io.ReadAll(r.Body)
+
+		switch r.Method {
+		case http.MethodPut:
+			objects[r.URL.Path] = body
+		case http.MethodGet:
+			content, ok := objects[r.URL.Path]
+			if !ok {
+				http.Error(w, "<Error><Code>NoSuchKey</Code></Error>", http.StatusNotFound)
+				return
+			}
+			w.Write(content)
+		case http.MethodDelete:
+			delete(objects, r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	s := &S3Store{
+		Bucket:          "library",
+		Region:          "eu-west-1",
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "secret",
+		Endpoint:        srv.URL,
+		now:             func() time.Time { return time.Date(2024, time.May, 1, 12, 30, 0, 0, time.UTC) },
+	}
+
+	if err := s.Put(ctx, "books/1/file.epub", []byte("PK\x03\x04"), "application/epub+zip"); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	if got.URL.Path != "/library/books/1/file.epub" {
+		t.Errorf("path = %s; want the key in the bucket", got.URL.Path)
+	}
+	if got.Header.Get("Content-Type") != "application/epub+zip" || string(body) != "PK\x03\x04" {
+		t.Errorf("uploaded %q as %s; want the content and its type", body, got.Header.Get("Content-Type"))
+	}
+	hash := sha256.Sum256([]byte("PK\x03\x04"))
+	if got.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(hash[:]) {
+		t.Errorf("X-Amz-Content-Sha256 = %s; want the hash of the content", got.Header.Get("X-Amz-Content-Sha256"))
+	}
+	if got.Header.Get("X-Amz-Date") != "20240501T123000Z" {
+		t.Errorf("X-Amz-Date = %s; want the time of the request", got.Header.Get("X-Amz-Date"))
+	}
+	authorization := got.Header.Get("Authorization")
+	wantPrefix := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20240501/eu-west-1/s3/aws4_request, SignedHeaders=content-type;host;x-amz-content-sha256;x-amz-date, Signature="
+	if !strings.HasPrefix(authorization, wantPrefix) || len(authorization) != len(wantPrefix)+64 {
+		t.Errorf("Authorization = %s; want a signature with the scope and the signed headers", authorization)
+	}
+
+	f, err := s.Open(ctx, "books/1/file.epub")
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	content, _ := io.ReadAll(f)
+	f.Close()
+	if string(content) != "PK\x03\x04" {
+		t.Errorf("Open() content = %q; want the uploaded content", content)
+	}
+
+	if err = s.Delete(ctx, "books/1/file.epub"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if got.Method != http.MethodDelete {
+		t.Errorf("method = %s; want %s", got.Method, http.MethodDelete)
+	}
+	if _, err = s.Open(ctx, "books/1/file.epub"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Open() after Delete() error = %v; want %v", err, ErrNotFound)
+	}
+
+	s.SecretAccessKey = "other"
+	if err = s.Put(ctx, "books/1/file.epub", []byte("PK\x03\x04"), "application/epub+zip"); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if got.Header.Get("Authorization") == authorization {
+		t.Errorf("Authorization with another secret = %s; want another signature", got.Header.Get("Authorization"))
+	}
+}
@@ -0,0 +1,72 @@
+// Package timezone carries the timezone of the library, in which days start and end,
+// and provides helpers for calendar day computations in it.
+package timezone
+
+import (
+	"context"
+	"time"
+)
+
+type contextKey string
+
+const (
+	locationContextKey = contextKey("location")
+)
+
+// WithLocation returns a copy of the context which carries the location of the library.
+func WithLocation(ctx context.Context, loc *time.Location) context.Context {
+	return context.WithValue(ctx, locationContextKey, loc)
+}
+
+// FromContext returns the location carried by the context, or UTC if there is none.
+func FromContext(ctx context.Context) *time.Location {
+	if loc, ok := ctx.Value(locationContextKey).(*time.Location); ok {
+		return loc
+	}
+
+	return time.UTC
+}
+
+// StartOfDay returns midnight of the day of t in loc.
+func StartOfDay(t time.Time, loc *time.Location) time.Time {
+	year, month, day := t.In(loc).Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, loc)
+}
+
+// DaysBetween returns the number of calendar days in loc from the day of from to the day
+// of to, which is negative if to is on an earlier day. Days are counted by date, so days
+// which are shorter or longer due to daylight saving time count as one.
+func DaysBetween(from, to time.Time, loc *time.Location) int {
+	fromYear, fromMonth, fromDay := from.In(loc).Date()
+	toYear, toMonth, toDay := to.In(loc).Date()
+
+	fromDate := time.Date(fromYear, fromMonth, fromDay, 0, 0, 0, 0, time.UTC)
+	toDate := time.Date(toYear, toMonth, toDay, 0, 0, 0, 0, time.UTC)
+
+	return int(toDate.Sub(fromDate).Hours() / 24)
+}
+
+// NextWeekly returns the first time after t which is on weekday at the start of hour in loc.
+func NextWeekly(t time.Time, weekday time.Weekday, hour int, loc *time.Location) time.Time {
+	year, month, day := t.In(loc).Date()
+	days := (int(weekday) - int(t.In(loc).Weekday()) + 7) % 7
+
+	next := time.Date(year, month, day+days, hour, 0, 0, 0, loc)
+	if !next.After(t) {
+		next = time.Date(year, month, day+days+7, hour, 0, 0, 0, loc)
+	}
+
+	return next
+}
+
+// NextDaily returns the first time after t which is at the start of hour in loc.
+func NextDaily(t time.Time, hour int, loc *time.Location) time.Time {
+	year, month, day := t.In(loc).Date()
+
+	next := time.Date(year, month, day, hour, 0, 0, 0, loc)
+	if !next.After(t) {
+		next = time.Date(year, month, day+1, hour, 0, 0, 0, loc)
+	}
+
+	return next
+}
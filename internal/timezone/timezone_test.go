@@ -0,0 +1,177 @@
+package timezone
+
+import (
+	"context"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestFromContext(t *testing.T) {
+	if got := FromContext(context.Background()); got != time.UTC {
+		t.Errorf("FromContext() without a location = %v; want UTC", got)
+	}
+
+	loc := time.FixedZone("UTC+2", 2*60*60)
+	if got := FromContext(WithLocation(context.Background(), loc)); got != loc {
+		t.Errorf("FromContext() = %v; want %v", got, loc)
+	}
+}
+
+func TestDaysBetween(t *testing.T) {
+	jerusalem, err := time.LoadLocation("Asia/Jerusalem")
+	if err != nil {
+		t.Fatalf("failed to load location: %v", err)
+	}
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("failed to load location: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		from, to time.Time
+		loc      *time.Location
+		want     int
+	}{
+		{
+			name: "same day",
+			from: time.Date(2024, time.December, 10, 0, 0, 0, 0, time.UTC),
+			to:   time.Date(2024, time.December, 10, 23, 59, 0, 0, time.UTC),
+			loc:  time.UTC,
+			want: 0,
+		},
+		{
+			name: "next day by a minute",
+			from: time.Date(2024, time.December, 10, 23, 59, 0, 0, time.UTC),
+			to:   time.Date(2024, time.December, 11, 0, 0, 0, 0, time.UTC),
+			loc:  time.UTC,
+			want: 1,
+		},
+		{
+			name: "same UTC day is the next day in the library",
+			from: time.Date(2024, time.December, 10, 20, 0, 0, 0, time.UTC),
+			to:   time.Date(2024, time.December, 10, 23, 0, 0, 0, time.UTC),
+			loc:  jerusalem,
+			want: 1,
+		},
+		{
+			name: "earlier day",
+			from: time.Date(2024, time.December, 10, 12, 0, 0, 0, time.UTC),
+			to:   time.Date(2024, time.December, 7, 12, 0, 0, 0, time.UTC),
+			loc:  time.UTC,
+			want: -3,
+		},
+		{
+			name: "across daylight saving time",
+			from: time.Date(2024, time.March, 9, 12, 0, 0, 0, newYork),
+			to:   time.Date(2024, time.March, 11, 0, 30, 0, 0, newYork),
+			loc:  newYork,
+			want: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DaysBetween(tt.from, tt.to, tt.loc); got != tt.want {
+				t.Errorf("DaysBetween(%v, %v) = %v; want %v", tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStartOfDay(t *testing.T) {
+	jerusalem, err := time.LoadLocation("Asia/Jerusalem")
+	if err != nil {
+		t.Fatalf("failed to load location: %v", err)
+	}
+
+	got := StartOfDay(time.Date(2024, time.December, 10, 23, 0, 0, 0, time.UTC), jerusalem)
+	if want := time.Date(2024, time.December, 11, 0, 0, 0, 0, jerusalem); !got.Equal(want) {
+		t.Errorf("StartOfDay() = %v; want %v", got, want)
+	}
+}
+
+func TestNextWeekly(t *testing.T) {
+	jerusalem, err := time.LoadLocation("Asia/Jerusalem")
+	if err != nil {
+		t.Fatalf("failed to load location: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		t    time.Time
+		want time.Time
+	}{
+		{
+			name: "later this week",
+			t:    time.Date(2024, time.December, 10, 12, 0, 0, 0, jerusalem),
+			want: time.Date(2024, time.December, 12, 8, 0, 0, 0, jerusalem),
+		},
+		{
+			name: "later today",
+			t:    time.Date(2024, time.December, 12, 7, 59, 0, 0, jerusalem),
+			want: time.Date(2024, time.December, 12, 8, 0, 0, 0, jerusalem),
+		},
+		{
+			name: "at the time",
+			t:    time.Date(2024, time.December, 12, 8, 0, 0, 0, jerusalem),
+			want: time.Date(2024, time.December, 19, 8, 0, 0, 0, jerusalem),
+		},
+		{
+			name: "next week",
+			t:    time.Date(2024, time.December, 13, 9, 0, 0, 0, jerusalem),
+			want: time.Date(2024, time.December, 19, 8, 0, 0, 0, jerusalem),
+		},
+		{
+			name: "day in the library timezone",
+			t:    time.Date(2024, time.December, 12, 7, 0, 0, 0, time.UTC),
+			want: time.Date(2024, time.December, 19, 8, 0, 0, 0, jerusalem),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NextWeekly(tt.t, time.Thursday, 8, jerusalem); !got.Equal(tt.want) {
+				t.Errorf("NextWeekly(%v) = %v; want %v", tt.t, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextDaily(t *testing.T) {
+	jerusalem, err := time.LoadLocation("Asia/Jerusalem")
+	if err != nil {
+		t.Fatalf("failed to load location: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		t    time.Time
+		want time.Time
+	}{
+		{
+			name: "later today",
+			t:    time.Date(2024, time.December, 12, 7, 59, 0, 0, jerusalem),
+			want: time.Date(2024, time.December, 12, 8, 0, 0, 0, jerusalem),
+		},
+		{
+			name: "at the time",
+			t:    time.Date(2024, time.December, 12, 8, 0, 0, 0, jerusalem),
+			want: time.Date(2024, time.December, 13, 8, 0, 0, 0, jerusalem),
+		},
+		{
+			name: "day in the library timezone",
+			t:    time.Date(2024, time.December, 31, 23, 0, 0, 0, time.UTC),
+			want: time.Date(2025, time.January, 1, 8, 0, 0, 0, jerusalem),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NextDaily(tt.t, 8, jerusalem); !got.Equal(tt.want) {
+				t.Errorf("NextDaily(%v) = %v; want %v", tt.t, got, tt.want)
+			}
+		})
+	}
+}